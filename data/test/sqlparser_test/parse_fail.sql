@@ -5,3 +5,15 @@ select 078 from t#syntax error at position 11 near 078
 select 'aa\#syntax error at position 12 near aa
 select 'aa#syntax error at position 12 near aa
 select /* aa#syntax error at position 13 near /* aa
+savepoint#syntax error at position 11
+release a#syntax error at position 10 near a
+rollback to#syntax error at position 13
+rollback foo to a#expecting work at position 13 near foo
+rollback to foo a#syntax error at position 18 near a
+set foo a = 1#expecting session or global at position 15
+set names utf8 collation utf8_bin#expecting collate at position 34 near utf8_bin
+show processlist#expecting tables, columns or variables at position 18
+show full variables#unexpected modifier at position 21
+show columns#expecting a table at position 14
+create foo table a#expecting temporary at position 19 near a
+drop foo table a#expecting temporary at position 17 near a
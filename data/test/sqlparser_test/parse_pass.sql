@@ -21,6 +21,23 @@ select /* union all */ 1 from t union all select 1 from t
 select /* minus */ 1 from t minus select 1 from t
 select /* except */ 1 from t except select 1 from t
 select /* intersect */ 1 from t intersect select 1 from t
+select /* union distinct */ 1 from t union distinct select 1 from t
+select /* union order by limit */ a from t union select b from t order by a asc limit 10
+select /* union all order by */ a from t union all select b from t order by a desc
+select /* union lock */ a from t union select b from t for update
+select /* union parenthesized */ a from t union (select b from t)
+(select /* parenthesized union */ a from t) union (select b from t order by b asc limit 1)
+(select /* parenthesized union order by */ a from t order by a asc) union all (select b from t) order by a asc limit 5
+(select /* parenthesized union chain */ a from t) union select b from t union (select c from t)
+select /* union in subquery */ 1 from t where a in (select b from t union select c from t)
+select /* parenthesized union in subquery */ 1 from t where a in ((select b from t) union (select c from t))
+select /* union in derived table */ a from (select a from t union all select b from t) as t1
+select /* derived table in join */ t1.a from t1 join (select b from t2) as t3 on t1.a = t3.b
+select /* scalar subquery */ (select max(a) from t) from t
+select /* scalar subquery comparison */ 1 from t where a > (select max(b) from t)+1
+select /* tuple in subquery */ 1 from t where (a, b) in (select c, d from t)
+select /* not in subquery */ 1 from t where a not in (select b from t union select c from t)
+select /* exists union */ 1 from t where exists (select 1 from t union select 1 from t)
 select /* distinct */ distinct 1 from t
 select /* for update */ 1 from t for update
 select /* lock in share mode */ 1 from t lock in share mode
@@ -135,6 +152,10 @@ insert /* value expression list */ into a values (a+1, 2*3)
 insert /* column list */ into a(a, b) values (1, 2)
 insert /* qualified column list */ into a(a, a.b) values (1, 2)
 insert /* select */ into a select b, c from d
+insert /* parenthesized select */ into a (select b, c from d)
+insert /* column list parenthesized select */ into a(b, c) (select b, c from d)
+insert /* union */ into a select b, c from d union all select e, f from g
+insert /* parenthesized union */ into a(b, c) (select b, c from d) union (select e, f from g) order by b asc limit 5
 insert /* on duplicate */ into a values (1, 2) on duplicate key update b = values(a), c = d
 update /* simple */ a set b = 3
 update /* a.b */ a.b set b = 3
@@ -151,6 +172,25 @@ delete /* order */ from a order by b desc
 delete /* limit */ from a limit b
 set /* simple */ a = 3
 set /* list */ a = 3, b = 4
+set /* session */ session autocommit = 1
+set /* local */ local a = 1#set /* local */ session a = 1
+set /* global */ GLOBAL a = 1#set /* global */ global a = 1
+set /* sysvar */ @@session.autocommit = on#set /* sysvar */ @@session.autocommit = 'on'
+set /* names */ names utf8#set /* names */ names 'utf8'
+set /* names collate */ NAMES 'utf8' COLLATE utf8_bin#set /* names collate */ names 'utf8' collate 'utf8_bin'
+set /* charset */ charset latin1#set /* charset */ charset 'latin1'
+set /* character set */ character set utf8#set /* character set */ charset 'utf8'
+show tables
+show full tables from a like 'b%'#show full tables from a like 'b%'
+show tables in a where Tables_in_a = 'b'#show tables from a where tables_in_a = 'b'
+show columns from a
+show full fields from a.b#show full columns from a.b
+show columns in b from a where Field like 'c%'#show columns from a.b where field like 'c%'
+show variables like 'max%'
+show session variables#show session variables
+show global variables where Variable_name = 'autocommit'#show global variables where variable_name = 'autocommit'
+use a
+use `a:-80@replica`#use a:-80@replica
 alter ignore table a add foo#alter table a
 alter table a add foo#alter table a
 alter table a alter foo#alter table a
@@ -167,6 +207,8 @@ alter table a rename b#rename table a b
 alter table a rename to b#rename table a b
 create table a
 create table if not exists a#create table a
+create temporary table a (id int primary key)#create temporary table a
+create temporary table if not exists a#create temporary table a
 create index a on b#alter table b
 create unique index a on b#alter table b
 create unique index a using foo on b#alter table b
@@ -175,5 +217,14 @@ alter view a#alter table a
 drop view a#drop table a
 drop table a
 drop table if exists a#drop table a
+drop temporary table a
+drop temporary table if exists a#drop temporary table a
 drop view if exists a#drop table a
 drop index b on a#alter table a
+savepoint a
+SAVEPOINT a#savepoint a
+savepoint /* comment */ `select`#savepoint `select`
+rollback to savepoint a
+rollback work to a#rollback to savepoint a
+ROLLBACK TO SAVEPOINT a#rollback to savepoint a
+release savepoint a
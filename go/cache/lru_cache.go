@@ -78,6 +78,18 @@ func (lru *LRUCache) Get(key string) (v Value, ok bool) {
 	return element.Value.(*entry).value, true
 }
 
+// Peek returns a value from the cache without changing the LRU order.
+func (lru *LRUCache) Peek(key string) (v Value, ok bool) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	element := lru.table[key]
+	if element == nil {
+		return nil, false
+	}
+	return element.Value.(*entry).value, true
+}
+
 // Set sets a value in the cache.
 func (lru *LRUCache) Set(key string, value Value) {
 	lru.mu.Lock()
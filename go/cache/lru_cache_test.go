@@ -145,6 +145,24 @@ func TestGetNonExistent(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("key1", &CacheValue{1})
+	cache.Set("key2", &CacheValue{1})
+
+	if v, ok := cache.Peek("key1"); !ok || v.(*CacheValue).size != 1 {
+		t.Errorf("Peek(key1) = %v, %v, want the value of key1", v, ok)
+	}
+	if _, ok := cache.Peek("crap"); ok {
+		t.Error("Cache returned a crap value after no inserts.")
+	}
+	// key1 was only peeked at, so it's still the least recently used.
+	cache.Set("key3", &CacheValue{1})
+	if _, ok := cache.Get("key1"); ok {
+		t.Error("key1 was not evicted")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	cache := NewLRUCache(100)
 	value := &CacheValue{1}
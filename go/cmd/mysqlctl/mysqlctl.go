@@ -9,30 +9,90 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 var port = flag.Int("port", 6612, "vtocc port")
 var mysqlPort = flag.Int("mysql_port", 3306, "mysql port")
 var tabletUid = flag.Uint("tablet_uid", 41983, "tablet uid")
 var mysqlSocket = flag.String("mysql_socket", "", "path to the mysql socket")
+var tabletUids = flag.String("tablet_uids", "", "comma separated list of tablet uids, to run init, start, shutdown or teardown on several mysqld instances of this host at once")
+var mysqlPortBase = flag.Int("mysql_port_base", 0, "with -tablet_uids, the mysql port of each instance is mysql_port_base + its tablet uid")
 var tabletAddr string
+var dbcfgs *dbconfigs.DBConfigs
 
-func initCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+func backupCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	concurrency := subFlags.Int("concurrency", 4, "how many compression jobs to run simultaneously")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("Command backup requires <bucket>")
+	}
+
+	name := fmt.Sprintf("%v.%v", time.Now().UTC().Format("2006-01-02.150405"), *tabletUid)
+	if err := mysqld.Backup(subFlags.Arg(0), name, *concurrency, nil); err != nil {
+		log.Fatalf("backup failed: %v", err)
+	}
+}
+
+func backupBinlogsCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("Command backupbinlogs requires <bucket>")
+	}
+
+	if err := mysqld.BackupBinlogs(subFlags.Arg(0)); err != nil {
+		log.Fatalf("backupbinlogs failed: %v", err)
+	}
+}
+
+func initAction(subFlags *flag.FlagSet, args []string) func(*mysqlctl.Mysqld) error {
 	waitTime := subFlags.Duration("wait_time", mysqlctl.MysqlWaitTime, "how long to wait for startup")
 	subFlags.Parse(args)
 
-	if err := mysqld.Init(*waitTime); err != nil {
+	return func(mysqld *mysqlctl.Mysqld) error {
+		return mysqld.Init(*waitTime)
+	}
+}
+
+func initCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	if err := initAction(subFlags, args)(mysqld); err != nil {
 		log.Fatalf("failed init mysql: %v", err)
 	}
 }
 
+func applyUsersCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	defaults := subFlags.Bool("defaults", false, "also create or update the vitess users of the db-config flags")
+	usersFile := subFlags.String("users_file", "", "JSON file with the list of users to create or update")
+	subFlags.Parse(args)
+	if !*defaults && *usersFile == "" {
+		log.Fatalf("Command applyusers requires -defaults or -users_file")
+	}
+
+	var users []*mysqlctl.UserConfig
+	if *defaults {
+		users = mysqlctl.DefaultUsers(dbcfgs)
+	}
+	if *usersFile != "" {
+		fileUsers, err := mysqlctl.ReadUsersFile(*usersFile)
+		if err != nil {
+			log.Fatalf("applyusers failed: %v", err)
+		}
+		users = append(users, fileUsers...)
+	}
+	if err := mysqld.ApplyUsers(users); err != nil {
+		log.Fatalf("applyusers failed: %v", err)
+	}
+}
+
 func multisnapshotCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
 	concurrency := subFlags.Int("concurrency", 8, "how many compression jobs to run simultaneously")
 	spec := subFlags.String("spec", "-", "shard specification")
@@ -141,11 +201,56 @@ func restoreCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string)
 	}
 }
 
-func shutdownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+func restoreFromBackupCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	concurrency := subFlags.Int("concurrency", 4, "how many files to restore simultaneously")
+	toTime := subFlags.String("restore_to_time", "", "if set, replay the binlogs up to this time (RFC 3339, like 2014-12-31T12:00:00Z)")
+	toGTID := subFlags.String("restore_to_gtid", "", "if set, replay the binlogs up to this GTID (flavor/value)")
+	binlogSource := subFlags.String("binlog_source", "", "host:port of the mysqld to read the binlogs from, instead of the BackupStorage")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 {
+		log.Fatalf("Command restorefrombackup requires <bucket>")
+	}
+
+	if *toTime != "" || *toGTID != "" {
+		point := &mysqlctl.RestorePoint{}
+		if *toTime != "" {
+			t, err := time.Parse(time.RFC3339, *toTime)
+			if err != nil {
+				log.Fatalf("invalid -restore_to_time: %v", err)
+			}
+			point.Time = t
+		}
+		if *toGTID != "" {
+			gtid, err := myproto.DecodeGTID(*toGTID)
+			if err != nil {
+				log.Fatalf("invalid -restore_to_gtid: %v", err)
+			}
+			point.GTID = gtid
+		}
+		if err := mysqld.RestoreToPoint(subFlags.Arg(0), *concurrency, nil, point, *binlogSource); err != nil {
+			log.Fatalf("restorefrombackup failed: %v", err)
+		}
+		return
+	}
+
+	rp, err := mysqld.Restore(subFlags.Arg(0), *concurrency, nil)
+	if err != nil {
+		log.Fatalf("restorefrombackup failed: %v", err)
+	}
+	log.Infof("replication position: %#v", rp)
+}
+
+func shutdownAction(subFlags *flag.FlagSet, args []string) func(*mysqlctl.Mysqld) error {
 	waitTime := subFlags.Duration("wait_time", mysqlctl.MysqlWaitTime, "how long to wait for shutdown")
 	subFlags.Parse(args)
 
-	if mysqlErr := mysqld.Shutdown(true, *waitTime); mysqlErr != nil {
+	return func(mysqld *mysqlctl.Mysqld) error {
+		return mysqld.Shutdown(true, *waitTime)
+	}
+}
+
+func shutdownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	if mysqlErr := shutdownAction(subFlags, args)(mysqld); mysqlErr != nil {
 		log.Fatalf("failed shutdown mysql: %v", mysqlErr)
 	}
 }
@@ -193,21 +298,76 @@ func snapshotSourceEndCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args
 	}
 }
 
-func startCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+func startAction(subFlags *flag.FlagSet, args []string) func(*mysqlctl.Mysqld) error {
 	waitTime := subFlags.Duration("wait_time", mysqlctl.MysqlWaitTime, "how long to wait for startup")
 	subFlags.Parse(args)
 
-	if err := mysqld.Start(*waitTime); err != nil {
+	return func(mysqld *mysqlctl.Mysqld) error {
+		return mysqld.Start(*waitTime)
+	}
+}
+
+func startCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	if err := startAction(subFlags, args)(mysqld); err != nil {
 		log.Fatalf("failed start mysql: %v", err)
 	}
 }
 
-func teardownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+func teardownAction(subFlags *flag.FlagSet, args []string) func(*mysqlctl.Mysqld) error {
 	force := subFlags.Bool("force", false, "will remove the root directory even if mysqld shutdown fails")
 	subFlags.Parse(args)
 
-	if err := mysqld.Teardown(*force); err != nil {
-		log.Fatalf("failed teardown mysql (forced? %v): %v", *force, err)
+	return func(mysqld *mysqlctl.Mysqld) error {
+		if err := mysqld.Teardown(*force); err != nil {
+			return fmt.Errorf("forced? %v: %v", *force, err)
+		}
+		return nil
+	}
+}
+
+func teardownCmd(mysqld *mysqlctl.Mysqld, subFlags *flag.FlagSet, args []string) {
+	if err := teardownAction(subFlags, args)(mysqld); err != nil {
+		log.Fatalf("failed teardown mysql: %v", err)
+	}
+}
+
+// instanceActions are the commands that can run on several mysqld
+// instances at once, with -tablet_uids.
+var instanceActions = map[string]func(*flag.FlagSet, []string) func(*mysqlctl.Mysqld) error{
+	"init":     initAction,
+	"start":    startAction,
+	"shutdown": shutdownAction,
+	"teardown": teardownAction,
+}
+
+// runInstancesCmd runs a command on all the instances of -tablet_uids.
+func runInstancesCmd(action string, args []string) {
+	newAction, ok := instanceActions[action]
+	if !ok {
+		log.Fatalf("action %v cannot run on several instances", action)
+	}
+
+	var uids []uint32
+	for _, s := range strings.Split(*tabletUids, ",") {
+		uid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			log.Fatalf("invalid tablet uid %v: %v", s, err)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	mysqlds, err := mysqlctl.NewMysqlds(uids, *mysqlPortBase, &dbcfgs.Dba, &dbcfgs.Repl)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer func() {
+		for _, mysqld := range mysqlds {
+			mysqld.Close()
+		}
+	}()
+
+	subFlags := flag.NewFlagSet(action, flag.ExitOnError)
+	if err := mysqlctl.ForAllMysqlds(mysqlds, newAction(subFlags, args)); err != nil {
+		log.Fatalf("%v failed: %v", action, err)
 	}
 }
 
@@ -227,6 +387,8 @@ var commands = []command{
 		"Starts mysqld on an already 'init'-ed directory"},
 	command{"shutdown", shutdownCmd, "[-wait_time=20s]",
 		"Shuts down mysqld, does not remove any file"},
+	command{"applyusers", applyUsersCmd, "[-defaults] [-users_file=<file>]",
+		"Creates or updates MySQL users and adds their grants"},
 
 	command{"snapshot", snapshotCmd,
 		"[-concurrency=4] <db name>",
@@ -243,6 +405,15 @@ var commands = []command{
 	command{"multirestore", multiRestoreCmd,
 		"[-force] [-concurrency=3] [-fetch_concurrency=4] [-insert_table_concurrency=4] [-fetch_retry_count=3] [-starts=start1,start2,...] [-ends=end1,end2,...] [-strategy=] <destination_dbname> <source_host>[/<source_dbname>]...",
 		"Restores a snapshot form multiple hosts"},
+	command{"backup", backupCmd,
+		"[-concurrency=4] <bucket>",
+		"Takes a backup of mysqld into the BackupStorage, in the given bucket (usually keyspace/shard)"},
+	command{"restorefrombackup", restoreFromBackupCmd,
+		"[-concurrency=4] [-restore_to_time=<time>] [-restore_to_gtid=<flavor/gtid>] [-binlog_source=<host:port>] <bucket>",
+		"Restores mysqld from the latest backup of the given bucket in the BackupStorage, and optionally replays the binlogs up to a point in time"},
+	command{"backupbinlogs", backupBinlogsCmd,
+		"<bucket>",
+		"Saves the binlogs of mysqld to the BackupStorage, for point-in-time recovery from the backups of the given bucket"},
 	command{"multisnapshot", multisnapshotCmd, "[-concurrency=8] [-spec='-'] [-tables=''] [-exclude_tables=''] [-skip_slave_restart] [-maximum_file_size=134217728] <db name> <key name>",
 		"Makes a complete snapshot using 'select * into' commands."},
 }
@@ -276,14 +447,21 @@ func main() {
 		mycnf.SocketFile = *mysqlSocket
 	}
 
-	dbcfgs, err := dbconfigs.Init(mycnf.SocketFile)
+	var err error
+	dbcfgs, err = dbconfigs.Init(mycnf.SocketFile)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
+
+	action := flag.Arg(0)
+	if *tabletUids != "" {
+		runInstancesCmd(action, flag.Args()[1:])
+		return
+	}
+
 	mysqld := mysqlctl.NewMysqld("Dba", mycnf, &dbcfgs.Dba, &dbcfgs.Repl)
 	defer mysqld.Close()
 
-	action := flag.Arg(0)
 	for _, cmd := range commands {
 		if cmd.name == action {
 			subFlags := flag.NewFlagSet(action, flag.ExitOnError)
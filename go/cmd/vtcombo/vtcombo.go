@@ -0,0 +1,118 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vtcombo runs a vttablet and a vtgate in a single process, for
+// development. Its topology is in memory: at startup, it creates the
+// keyspace, the shard and the master tablet it serves, and the
+// serving graph vtgate reads. It only needs the mysqld of the tablet.
+package main
+
+import (
+	"flag"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/binlog"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/tabletmanager"
+	"github.com/youtube/vitess/go/vt/tabletserver"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+var (
+	tabletAliasFlag = flag.String("tablet_alias", "test-0000000001", "alias of the master tablet, its cell must be in -memorytopo_cells")
+	keyspace        = flag.String("keyspace", "test_keyspace", "keyspace of the tablet")
+	shard           = flag.String("shard", "0", "shard of the tablet")
+	dbNameOverride  = flag.String("db-name-override", "", "override the name of the db used by the tablet")
+	enableRowcache  = flag.Bool("enable-rowcache", false, "enable rowcacche")
+	lockTimeout     = flag.Duration("lock_timeout", 30*time.Second, "timeout of the topology locks taken to create the serving graph")
+
+	retryDelay = flag.Duration("retry-delay", 200*time.Millisecond, "retry delay")
+	retryCount = flag.Int("retry-count", 10, "retry count")
+	timeout    = flag.Duration("timeout", 5*time.Second, "connection and call timeout")
+
+	agent *tabletmanager.ActionAgent
+)
+
+func init() {
+	servenv.RegisterDefaultFlags()
+}
+
+func main() {
+	dbconfigs.RegisterFlags()
+	mysqlctl.RegisterFlags()
+	flag.Parse()
+	if len(flag.Args()) > 0 {
+		flag.Usage()
+		log.Fatalf("vtcombo doesn't take any positional arguments")
+	}
+
+	servenv.Init()
+
+	tabletAlias, err := topo.ParseTabletAliasString(*tabletAliasFlag)
+	if err != nil {
+		log.Fatalf("Invalid tablet alias %v: %v", *tabletAliasFlag, err)
+	}
+
+	mycnf, err := mysqlctl.NewMycnfFromFlags(tabletAlias.Uid)
+	if err != nil {
+		log.Fatalf("mycnf read failed: %v", err)
+	}
+
+	dbcfgs, err := dbconfigs.Init(mycnf.SocketFile)
+	if err != nil {
+		log.Warning(err)
+	}
+	dbcfgs.App.EnableRowcache = *enableRowcache
+
+	// The topology is empty, create the master tablet, and its
+	// keyspace and shard.
+	ts := topo.GetServer()
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, *lockTimeout, *lockTimeout)
+	tablet := &topo.Tablet{
+		Alias:    tabletAlias,
+		Hostname: "localhost",
+		Portmap: map[string]int{
+			"vt":    *servenv.Port,
+			"mysql": mycnf.MysqlPort,
+		},
+		Keyspace:       *keyspace,
+		Shard:          *shard,
+		Type:           topo.TYPE_MASTER,
+		DbNameOverride: *dbNameOverride,
+	}
+	if err := wr.InitTablet(tablet, false, true, true); err != nil {
+		log.Fatalf("cannot create tablet %v in the topology, is its cell in -memorytopo_cells? %v", tabletAlias, err)
+	}
+
+	tabletserver.InitQueryService()
+	binlog.RegisterUpdateStreamService(mycnf)
+
+	// Depends on both query and updateStream.
+	agent, err = tabletmanager.NewActionAgent(tabletAlias, dbcfgs, mycnf, *servenv.Port, 0, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// vtgate finds the tablet in the serving graph.
+	if err := wr.RebuildKeyspaceGraph(*keyspace, nil, nil); err != nil {
+		log.Fatalf("cannot rebuild the serving graph of keyspace %v: %v", *keyspace, err)
+	}
+	vtgate.Init(vtgate.NewResilientSrvTopoServer(ts, "ResilientSrvTopoServerCounts"), tabletAlias.Cell, *retryDelay, *retryCount, *timeout)
+
+	servenv.OnTerm(func() {
+		tabletserver.DisallowQueries()
+		binlog.DisableUpdateStreamService()
+		agent.Stop()
+	})
+	servenv.OnClose(func() {
+		topo.CloseServers()
+	})
+	servenv.RunDefault()
+}
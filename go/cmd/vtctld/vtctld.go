@@ -18,12 +18,15 @@ import (
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
 	"github.com/youtube/vitess/go/vt/wrangler"
 )
 
 var (
 	templateDir = flag.String("templates", "", "directory containing templates")
 	debug       = flag.Bool("debug", false, "recompile templates for every request")
+
+	globalCopyInterval = flag.Duration("global_copy_interval", 0, "if set, how often the global keyspace and shard records are copied into each cell, where they are read when the global topology is not available")
 )
 
 func init() {
@@ -348,6 +351,10 @@ func main() {
 
 	wr := wrangler.New(logutil.NewConsoleLogger(), ts, 30*time.Second, 30*time.Second)
 
+	if *globalCopyInterval > 0 {
+		go topotools.CopyGlobalRecordsLoop(wr.Logger(), ts, nil, *globalCopyInterval, nil)
+	}
+
 	actionRepo = NewActionRepository(wr)
 
 	// keyspace actions
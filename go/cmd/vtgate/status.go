@@ -3,9 +3,52 @@ package main
 import (
 	"github.com/youtube/vitess/go/vt/servenv"
 	_ "github.com/youtube/vitess/go/vt/status"
+	"github.com/youtube/vitess/go/vt/vtgate"
 )
 
 var (
+	shardsTemplate = `
+<style>
+  table {
+    border-collapse: collapse;
+  }
+  td, th {
+    border: 1px solid #999;
+    padding: 0.5rem;
+  }
+  .over-budget {
+    background-color: #f99;
+  }
+</style>
+<table>
+  <tr>
+    <th>Keyspace</th>
+    <th>Shard</th>
+    <th>TabletType</th>
+    <th>Serving Tablet</th>
+    <th>Queries</th>
+    <th>Errors</th>
+    <th>Avg Latency</th>
+    <th>QPS</th>
+    <th>Error Rate (15m)</th>
+  </tr>
+  {{range $i, $s := .}}
+  <tr{{if $s.OverBudget}} class="over-budget"{{end}}>
+    <td>{{$s.Keyspace}}</td>
+    <td>{{$s.Shard}}</td>
+    <td>{{$s.TabletType}}</td>
+    <td>{{if $s.Connected}}{{$s.EndPoint.Host}} ({{$s.EndPoint.Uid}}){{else}}<i>not connected</i>{{end}}</td>
+    <td>{{$s.QueryCount}}</td>
+    <td>{{$s.ErrorCount}}</td>
+    <td>{{$s.AvgLatency}}</td>
+    <td>{{printf "%.2f" $s.QPS}}</td>
+    <td>{{printf "%.4f" $s.ErrorRate}}{{if $s.OverBudget}} <b>over budget</b>{{end}}</td>
+  </tr>
+  {{end}}
+</table>
+<small>The shards over their error budget (-error_budget) are highlighted.</small>
+`
+
 	topoTemplate = `
 <style>
   table {
@@ -45,7 +88,7 @@ var (
   <tr>
     <td>{{github_com_youtube_vitess_vtctld_srv_cell $sk.Cell}}</td>
     <td>{{github_com_youtube_vitess_vtctld_srv_keyspace $sk.Cell $sk.Keyspace}}</td>
-    <td>{{if $sk.LastError}}<b>{{$sk.LastError}}</b><br/>Client: {{$sk.LastErrorContext.HTML}}{{else}}{{$sk.StatusAsHTML}}{{end}}</td>
+    <td>{{if $sk.Stale}}<b>Stale:</b> {{end}}{{if $sk.LastError}}<b>{{$sk.LastError}}</b><br/>Client: {{$sk.LastErrorContext.HTML}}{{else}}{{$sk.StatusAsHTML}}{{end}}</td>
   </tr>
   {{end}}
 </table>
@@ -67,7 +110,7 @@ var (
     <td>{{github_com_youtube_vitess_vtctld_srv_keyspace $ep.Cell $ep.Keyspace}}</td>
     <td>{{github_com_youtube_vitess_vtctld_srv_shard $ep.Cell $ep.Keyspace $ep.Shard}}</td>
     <td>{{github_com_youtube_vitess_vtctld_srv_type $ep.Cell $ep.Keyspace $ep.Shard $ep.TabletType}}</td>
-    <td>{{if $ep.LastError}}<b>{{$ep.LastError}}</b><br/>Client: {{$ep.LastErrorContext.HTML}}{{else}}{{$ep.StatusAsHTML}}{{end}}</td>
+    <td>{{if $ep.Stale}}<b>Stale:</b> {{end}}{{if $ep.LastError}}<b>{{$ep.LastError}}</b><br/>Client: {{$ep.LastErrorContext.HTML}}{{else}}{{$ep.StatusAsHTML}}{{end}}</td>
   </tr>
   {{end}}
 </table>
@@ -94,6 +137,10 @@ var (
     <td><div id="qps_by_operation"></div></td>
     <td><div id="errors_by_operation"></div></td>
   </tr>
+  <tr>
+    <td><div id="qps_by_shard"></div></td>
+    <td><div id="errors_by_code"></div></td>
+  </tr>
 </table>
 
 <script type="text/javascript" src="https://www.google.com/jsapi"></script>
@@ -179,6 +226,9 @@ google.setOnLoadCallback(function() {
   drawQPSChart('#errors_by_db_type', 'ErrorsByDbType', 'Errors by DB type');
   drawQPSChart('#errors_by_keyspace', 'ErrorsByKeyspace', 'Errors by keyspace');
   drawQPSChart('#errors_by_operation', 'ErrorsByOperation', 'Errors by operation');
+
+  drawQPSChart('#qps_by_shard', 'VttabletCallQPSByShard', 'Tablet QPS by shard');
+  drawQPSChart('#errors_by_code', 'VttabletCallErrorsByCode', 'Tablet errors by code');
   update();
 });
 
@@ -191,6 +241,9 @@ func init() {
 		servenv.AddStatusPart("Topology Cache", topoTemplate, func() interface{} {
 			return resilientSrvTopoServer.CacheStatus()
 		})
+		servenv.AddStatusPart("Shards", shardsTemplate, func() interface{} {
+			return vtgate.RpcVTGate.ShardStatus()
+		})
 		servenv.AddStatusPart("Stats", statsTemplate, func() interface{} {
 			return nil
 		})
@@ -0,0 +1,72 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// vtkafka produces the events of the update stream of a tablet to Kafka.
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/binlog"
+	"github.com/youtube/vitess/go/vt/binlog/kafkasink"
+	"github.com/youtube/vitess/go/vt/logutil"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var (
+	updateStreamAddr = flag.String("update_stream_addr", "", "address of the update stream of the tablet")
+	brokers          = flag.String("kafka_brokers", "", "comma-separated list of the kafka brokers to bootstrap from")
+	clientID         = flag.String("kafka_client_id", "vtkafka", "client id of the kafka producer")
+	kafkaTimeout     = flag.Duration("kafka_timeout", 10*time.Second, "timeout of the kafka requests")
+	topic            = flag.String("topic", "", "topic of all the events; if empty, there's a topic per table")
+	topicPrefix      = flag.String("topic_prefix", "", "prefix of the topics of the tables")
+	defaultTopic     = flag.String("default_topic", "", "topic of the events without a table, with a topic per table; if empty, they're skipped")
+	checkpointFile   = flag.String("checkpoint_file", "", "file where the position of the events produced is checkpointed")
+	startPosition    = flag.String("start_position", "", "encoded GTID to start from when there's no checkpoint yet, like the replication position of a tablet")
+	retryDelay       = flag.Duration("retry_delay", 5*time.Second, "delay before restarting a broken stream from its checkpoint")
+	batchSize        = flag.Int("batch_size", 0, "number of events to request per reply from the update stream, 0 for one per reply")
+)
+
+func main() {
+	defer logutil.Flush()
+
+	flag.Parse()
+	if *updateStreamAddr == "" || *brokers == "" || *checkpointFile == "" {
+		flag.Usage()
+		log.Fatalf("-update_stream_addr, -kafka_brokers and -checkpoint_file are required")
+	}
+
+	route := kafkasink.TopicPerTable(*topicPrefix, *defaultTopic)
+	if *topic != "" {
+		route = kafkasink.SingleTopic(*topic)
+	}
+	producer := kafkasink.NewProducer(strings.Split(*brokers, ","), *clientID, *kafkaTimeout)
+	defer producer.Close()
+
+	source := binlog.NewRemoteEventStreamer(*updateStreamAddr, nil)
+	source.SetDMLSql()
+	source.SetBatchSize(*batchSize)
+	var checkpointer binlog.Checkpointer = binlog.FileCheckpointer(*checkpointFile)
+	if *startPosition != "" {
+		start, err := myproto.DecodeGTID(*startPosition)
+		if err != nil {
+			log.Fatalf("invalid -start_position: %v", err)
+		}
+		checkpointer = binlog.StartCheckpointer{Checkpointer: checkpointer, Start: start}
+	}
+	if gtid, err := checkpointer.Load(); err == nil && gtid == nil {
+		log.Fatalf("no checkpoint in %v, -start_position is required for the first run", *checkpointFile)
+	}
+	for {
+		// Each run restarts from the last checkpoint, so the events
+		// that weren't checkpointed are produced again.
+		sink := kafkasink.NewSink(producer, route)
+		err := binlog.RunSink(source, sink, checkpointer)
+		log.Errorf("event stream to kafka broke, restarting in %v: %v", *retryDelay, err)
+		time.Sleep(*retryDelay)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"time"
 
 	"github.com/youtube/vitess/go/vt/health"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
@@ -9,13 +10,17 @@ import (
 )
 
 var (
-	allowedReplicationLag = flag.Int("allowed_replication_lag", 0, "how many seconds of replication lag will make this tablet unhealthy (ignored if the value is 0)")
+	allowedReplicationLag = flag.Int("allowed_replication_lag", 0, "how many seconds of replication lag will make this tablet unhealthy (ignored if the value is 0). The lag comes from the heartbeat if heartbeat_interval is set, from Seconds_Behind_Master otherwise")
 )
 
 func init() {
 	servenv.OnRun(func() {
 		if *allowedReplicationLag > 0 {
-			health.Register("replication_reporter", mysqlctl.MySQLReplicationLag(agent.Mysqld, *allowedReplicationLag))
+			if agent.IsRunningHeartbeat() {
+				health.Register("replication_reporter", agent.HeartbeatReplicationLag(time.Duration(*allowedReplicationLag)*time.Second))
+			} else {
+				health.Register("replication_reporter", mysqlctl.MySQLReplicationLag(agent.Mysqld, *allowedReplicationLag))
+			}
 		}
 	})
 }
@@ -0,0 +1,11 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Imports and register the Google Cloud Storage BackupStorage
+
+import (
+	_ "github.com/youtube/vitess/go/vt/mysqlctl/gcsbackupstorage"
+)
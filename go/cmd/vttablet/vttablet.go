@@ -11,6 +11,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/binlog"
+	"github.com/youtube/vitess/go/vt/binlog/binlogserver"
 	"github.com/youtube/vitess/go/vt/dbconfigs"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/servenv"
@@ -21,10 +22,11 @@ import (
 )
 
 var (
-	tabletPath     = flag.String("tablet-path", "", "tablet alias or path to zk node representing the tablet")
-	enableRowcache = flag.Bool("enable-rowcache", false, "enable rowcacche")
-	overridesFile  = flag.String("schema-override", "", "schema overrides file")
-	tableAclConfig = flag.String("table-acl-config", "", "path to table access checker config file")
+	tabletPath       = flag.String("tablet-path", "", "tablet alias or path to zk node representing the tablet")
+	enableRowcache   = flag.Bool("enable-rowcache", false, "enable rowcacche")
+	overridesFile    = flag.String("schema-override", "", "schema overrides file")
+	tableAclConfig   = flag.String("table-acl-config", "", "path to table access checker config file")
+	binlogServerPort = flag.Int("binlog-server-port", 0, "port to serve the binlogs to MySQL replicas on, with the replication credentials (0 to disable)")
 
 	agent *tabletmanager.ActionAgent
 )
@@ -92,9 +94,25 @@ func main() {
 	}
 
 	tabletmanager.HttpHandleSnapshots(mycnf, tabletAlias.Uid)
+
+	// Downstream MySQL replicas can replicate from us, with the
+	// credentials they would use to replicate from mysqld.
+	var binlogServer *binlogserver.Server
+	if *binlogServerPort != 0 {
+		binlogServer = binlogserver.NewServer(agent.Mysqld, dbcfgs.Repl.Uname, dbcfgs.Repl.Pass)
+		go func() {
+			if err := binlogServer.ListenAndServe(*binlogServerPort); err != nil {
+				log.Fatalf("binlog server failed: %v", err)
+			}
+		}()
+	}
+
 	servenv.OnTerm(func() {
 		tabletserver.DisallowQueries()
 		binlog.DisableUpdateStreamService()
+		if binlogServer != nil {
+			binlogServer.Close()
+		}
 		agent.Stop()
 	})
 	servenv.OnClose(func() {
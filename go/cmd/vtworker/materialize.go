@@ -0,0 +1,147 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/worker"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+const defaultCatchUpTimeout = 10 * time.Minute
+
+const materializeHTML = `
+<!DOCTYPE html>
+<head>
+  <title>Materialize Action</title>
+</head>
+<body>
+  <h1>Materialize Action</h1>
+    <form action="/Clones/Materialize" method="post">
+      <LABEL for="source">Source Shard (keyspace/shard): </LABEL>
+        <INPUT type="text" id="source" name="source" value=""></BR>
+      <LABEL for="table">Source Table: </LABEL>
+        <INPUT type="text" id="table" name="table" value=""></BR>
+      <LABEL for="destination">Destination Shard (keyspace/shard): </LABEL>
+        <INPUT type="text" id="destination" name="destination" value=""></BR>
+      <LABEL for="createSql">Create Table Statement: </LABEL>
+        <TEXTAREA id="createSql" name="createSql" rows="10" cols="80"></TEXTAREA></BR>
+      <LABEL for="sourceReaderCount">Source Reader Count: </LABEL>
+        <INPUT type="text" id="sourceReaderCount" name="sourceReaderCount" value="{{.DefaultSourceReaderCount}}"></BR>
+      <LABEL for="minTableSizeForSplit">Minimun Table Size For Split: </LABEL>
+        <INPUT type="text" id="minTableSizeForSplit" name="minTableSizeForSplit" value="{{.DefaultMinTableSizeForSplit}}"></BR>
+      <LABEL for="destinationWriterCount">Destination Writer Count: </LABEL>
+        <INPUT type="text" id="destinationWriterCount" name="destinationWriterCount" value="{{.DefaultDestinationWriterCount}}"></BR>
+      <LABEL for="catchUpTimeout">Catch Up Timeout: </LABEL>
+        <INPUT type="text" id="catchUpTimeout" name="catchUpTimeout" value="{{.DefaultCatchUpTimeout}}"></BR>
+      <INPUT type="submit" value="Materialize"/>
+    </form>
+
+  <h1>Help</h1>
+    <p>The table is created in the destination shard with the create table statement, which uses {{"{{"}}.DatabaseName{{"}}"}} for the database name, and must have the columns of the source table. If it's empty, the schema of the source table is used.</p>
+    <p>The table is then backfilled from a rdonly tablet of the source shard, and kept in sync by filtered replication. The action finishes once filtered replication has caught up with the source master.</p>
+  </body>
+`
+
+var materializeTemplate = loadTemplate("materialize", materializeHTML)
+
+func commandMaterialize(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) worker.Worker {
+	source := subFlags.String("source", "", "source keyspace/shard")
+	table := subFlags.String("table", "", "source table to materialize")
+	createSql := subFlags.String("create_sql", "", "create table statement of the derived table, with {{.DatabaseName}} for the database name (defaults to the schema of the source table)")
+	sourceReaderCount := subFlags.Int("source_reader_count", defaultSourceReaderCount, "number of concurrent streaming queries to use on the source")
+	minTableSizeForSplit := subFlags.Int("min_table_size_for_split", defaultMinTableSizeForSplit, "tables bigger than this size on disk in bytes will be split into source_reader_count chunks if possible")
+	destinationWriterCount := subFlags.Int("destination_writer_count", defaultDestinationWriterCount, "number of concurrent RPCs to execute on the destination")
+	catchUpTimeout := subFlags.Duration("catch_up_timeout", defaultCatchUpTimeout, "how long to wait for filtered replication to catch up with the source master")
+	subFlags.Parse(args)
+	if subFlags.NArg() != 1 || *source == "" || *table == "" {
+		log.Fatalf("command Materialize requires --source=<keyspace/shard> --table=<table> <destination keyspace/shard|zk shard path>")
+	}
+
+	sourceKeyspace, sourceShard := shardParamToKeyspaceShard(*source)
+	keyspace, shard := shardParamToKeyspaceShard(subFlags.Arg(0))
+	return worker.NewMaterializeWorker(wr, *cell, sourceKeyspace, sourceShard, keyspace, shard, *table, *createSql, *sourceReaderCount, uint64(*minTableSizeForSplit), *destinationWriterCount, *catchUpTimeout)
+}
+
+func interactiveMaterialize(wr *wrangler.Wrangler, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		httpError(w, "cannot parse form: %s", err)
+		return
+	}
+
+	source := r.FormValue("source")
+	table := r.FormValue("table")
+	destination := r.FormValue("destination")
+	if source == "" || table == "" || destination == "" {
+		// display the input form
+		result := make(map[string]interface{})
+		result["DefaultSourceReaderCount"] = fmt.Sprintf("%v", defaultSourceReaderCount)
+		result["DefaultMinTableSizeForSplit"] = fmt.Sprintf("%v", defaultMinTableSizeForSplit)
+		result["DefaultDestinationWriterCount"] = fmt.Sprintf("%v", defaultDestinationWriterCount)
+		result["DefaultCatchUpTimeout"] = defaultCatchUpTimeout.String()
+		executeTemplate(w, materializeTemplate, result)
+		return
+	}
+
+	// get other parameters
+	createSql := r.FormValue("createSql")
+	sourceReaderCountStr := r.FormValue("sourceReaderCount")
+	sourceReaderCount, err := strconv.ParseInt(sourceReaderCountStr, 0, 64)
+	if err != nil {
+		httpError(w, "cannot parse sourceReaderCount: %s", err)
+		return
+	}
+	minTableSizeForSplitStr := r.FormValue("minTableSizeForSplit")
+	minTableSizeForSplit, err := strconv.ParseInt(minTableSizeForSplitStr, 0, 64)
+	if err != nil {
+		httpError(w, "cannot parse minTableSizeForSplit: %s", err)
+		return
+	}
+	destinationWriterCountStr := r.FormValue("destinationWriterCount")
+	destinationWriterCount, err := strconv.ParseInt(destinationWriterCountStr, 0, 64)
+	if err != nil {
+		httpError(w, "cannot parse destinationWriterCount: %s", err)
+		return
+	}
+	catchUpTimeout, err := time.ParseDuration(r.FormValue("catchUpTimeout"))
+	if err != nil {
+		httpError(w, "cannot parse catchUpTimeout: %s", err)
+		return
+	}
+
+	// shardParamToKeyspaceShard exits on bad values, don't use it here
+	sourceParts := strings.Split(source, "/")
+	destinationParts := strings.Split(destination, "/")
+	if len(sourceParts) != 2 || len(destinationParts) != 2 {
+		httpError(w, "invalid source or destination shard: %s", fmt.Errorf("%v %v", source, destination))
+		return
+	}
+	sourceKeyspace, sourceShard := sourceParts[0], sourceParts[1]
+	keyspace, shard := destinationParts[0], destinationParts[1]
+
+	// start the materialize job
+	wrk := worker.NewMaterializeWorker(wr, *cell, sourceKeyspace, sourceShard, keyspace, shard, table, createSql, int(sourceReaderCount), uint64(minTableSizeForSplit), int(destinationWriterCount), catchUpTimeout)
+	if _, err := setAndStartWorker(wrk, nil); err != nil {
+		httpError(w, "cannot set worker: %s", err)
+		return
+	}
+
+	http.Redirect(w, r, servenv.StatusURLPath(), http.StatusTemporaryRedirect)
+}
+
+func init() {
+	addCommand("Clones", command{"Materialize",
+		commandMaterialize, interactiveMaterialize,
+		"--source=<keyspace/shard> --table=<table> [--create_sql=''] <destination keyspace/shard|zk shard path>",
+		"Creates a derived copy of a table in a destination shard, backfills it, and keeps it in sync with filtered replication."})
+}
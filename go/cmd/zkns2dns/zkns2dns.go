@@ -0,0 +1,57 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// zkns2dns serves the zkns entries as DNS A and SRV records, for the
+// clients that can't link the zkns library. See the zkdns package.
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/zk"
+	"github.com/youtube/vitess/go/zk/zkns/zkdns"
+)
+
+func main() {
+	defer logutil.Flush()
+
+	zknsDomain := flag.String("zkns-domain", "", "The naming hierarchy portion to serve")
+	zknsRoot := flag.String("zkns-root", "", "The root path from which to resolve")
+	dnsAddr := flag.String("dns-addr", ":53", "Serve DNS on this address, over UDP and TCP")
+	defaultTTL := flag.Duration("default-ttl", time.Second, "The TTL of the records whose zkns entry doesn't specify one")
+	bindAddr := flag.String("bind-addr", ":31982", "Bind the debug http server")
+	flag.Parse()
+
+	if *bindAddr != "" {
+		go func() {
+			err := http.ListenAndServe(*bindAddr, nil)
+			if err != nil {
+				log.Fatalf("ListenAndServe: %s", err)
+			}
+		}()
+	}
+
+	zconn := zk.NewMetaConn(false)
+	server := zkdns.NewServer(zconn, *zknsDomain, *zknsRoot, *defaultTTL)
+
+	l, err := net.Listen("tcp", *dnsAddr)
+	if err != nil {
+		log.Fatalf("cannot listen on %v: %v", *dnsAddr, err)
+	}
+	go func() {
+		log.Fatalf("ServeTCP: %v", server.ServeTCP(l))
+	}()
+
+	conn, err := net.ListenPacket("udp", *dnsAddr)
+	if err != nil {
+		log.Fatalf("cannot listen on %v: %v", *dnsAddr, err)
+	}
+	log.Infof("serving %v from %v on %v", *zknsDomain, *zknsRoot, *dnsAddr)
+	log.Fatalf("ServeUDP: %v", server.ServeUDP(conn))
+}
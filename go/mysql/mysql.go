@@ -38,6 +38,9 @@ const (
 	LOCK_WAIT_TIMEOUT         = C.ER_LOCK_WAIT_TIMEOUT
 	LOCK_DEADLOCK             = C.ER_LOCK_DEADLOCK
 	OPTION_PREVENTS_STATEMENT = C.ER_OPTION_PREVENTS_STATEMENT
+	NO_SUCH_TABLE             = C.ER_NO_SUCH_TABLE
+	BAD_FIELD_ERROR           = C.ER_BAD_FIELD_ERROR
+	WRONG_VALUE_COUNT_ON_ROW  = C.ER_WRONG_VALUE_COUNT_ON_ROW
 
 	REDACTED_PASSWORD = "****"
 )
@@ -80,18 +83,23 @@ type ConnectionParams struct {
 	Charset    string `json:"charset"`
 	Flags      uint64 `json:"flags"`
 
-	// the following flags are only used for 'Change Master' command
-	// for now (along with flags |= 2048 for CLIENT_SSL)
+	// the following flags are used to connect over TLS, and for the
+	// 'Change Master' command, when flags has CLIENT_SSL (see EnableSsl)
 	SslCa     string `json:"ssl_ca"`
 	SslCaPath string `json:"ssl_ca_path"`
 	SslCert   string `json:"ssl_cert"`
 	SslKey    string `json:"ssl_key"`
+	SslCipher string `json:"ssl_cipher"`
 }
 
 func (c *ConnectionParams) EnableMultiStatements() {
 	c.Flags |= C.CLIENT_MULTI_STATEMENTS
 }
 
+func (c *ConnectionParams) EnableSsl() {
+	c.Flags |= C.CLIENT_SSL
+}
+
 func (c *ConnectionParams) SslEnabled() bool {
 	return (c.Flags & C.CLIENT_SSL) != 0
 }
@@ -121,9 +129,19 @@ func Connect(params ConnectionParams) (conn *Connection, err error) {
 	charset := C.CString(params.Charset)
 	defer cfree(charset)
 	flags := C.ulong(params.Flags)
+	sslKey := C.CString(params.SslKey)
+	defer cfree(sslKey)
+	sslCert := C.CString(params.SslCert)
+	defer cfree(sslCert)
+	sslCa := C.CString(params.SslCa)
+	defer cfree(sslCa)
+	sslCaPath := C.CString(params.SslCaPath)
+	defer cfree(sslCaPath)
+	sslCipher := C.CString(params.SslCipher)
+	defer cfree(sslCipher)
 
 	conn = &Connection{}
-	if C.vt_connect(&conn.c, host, uname, pass, dbname, port, unix_socket, charset, flags) != 0 {
+	if C.vt_connect(&conn.c, host, uname, pass, dbname, port, unix_socket, charset, flags, sslKey, sslCert, sslCa, sslCaPath, sslCipher) != 0 {
 		defer conn.Close()
 		return nil, conn.lastError("")
 	}
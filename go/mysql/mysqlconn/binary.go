@@ -0,0 +1,518 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// This file has the binary protocol of the prepared statements: the
+// replies to COM_STMT_PREPARE, the parsing of the params of
+// COM_STMT_EXECUTE and COM_STMT_SEND_LONG_DATA, and the binary
+// resultsets.
+
+// flagUnsigned is the flag of the unsigned integer params.
+const flagUnsigned = 0x80
+
+// Stmt is a prepared statement, as far as the protocol is concerned.
+type Stmt struct {
+	ID        uint32
+	NumParams int
+
+	// types are the types of the params, with their flags. Clients
+	// send them with the first execution, and only when they change
+	// afterwards.
+	types []byte
+
+	// longData are the values of the params sent with
+	// COM_STMT_SEND_LONG_DATA, for the next execution.
+	longData map[int][]byte
+}
+
+// ReplaceParams replaces the params of a query to prepare, which are
+// the question marks outside of the quoted strings and identifiers,
+// with the names returned by name for their index. It returns the new
+// query, and the number of params.
+func ReplaceParams(query string, name func(i int) string) (string, int) {
+	var buf bytes.Buffer
+	count := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' && i+1 < len(query) {
+				buf.WriteByte(c)
+				i++
+				c = query[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			buf.WriteString(name(count))
+			count++
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String(), count
+}
+
+// WritePrepareOK replies to a COM_STMT_PREPARE. The columns of the
+// statement are not announced, they come with the resultsets of its
+// executions.
+func (c *Conn) WritePrepareOK(stmt *Stmt) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0x00)
+	binary.Write(&buf, binary.LittleEndian, stmt.ID)
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // columns
+	binary.Write(&buf, binary.LittleEndian, uint16(stmt.NumParams))
+	buf.WriteByte(0)                                   // filler
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // warnings
+	if err := c.WritePacket(buf.Bytes()); err != nil {
+		return err
+	}
+	if stmt.NumParams == 0 {
+		return nil
+	}
+	for i := 0; i < stmt.NumParams; i++ {
+		if err := c.WritePacket(columnDefinition(proto.Field{Name: "?", Type: proto.VT_VAR_STRING})); err != nil {
+			return err
+		}
+	}
+	return c.WriteEOF()
+}
+
+// StmtID returns the statement id at the start of the payload of a
+// COM_STMT_EXECUTE, COM_STMT_SEND_LONG_DATA, COM_STMT_CLOSE or
+// COM_STMT_RESET.
+func StmtID(data []byte) (uint32, error) {
+	if len(data) < 4 {
+		return 0, fmt.Errorf("statement command is too short: %v bytes", len(data))
+	}
+	return binary.LittleEndian.Uint32(data[:4]), nil
+}
+
+// AppendLongData appends the data of a COM_STMT_SEND_LONG_DATA to its
+// param.
+func (stmt *Stmt) AppendLongData(data []byte) error {
+	if len(data) < 6 {
+		return fmt.Errorf("COM_STMT_SEND_LONG_DATA is too short: %v bytes", len(data))
+	}
+	param := int(binary.LittleEndian.Uint16(data[4:6]))
+	if param >= stmt.NumParams {
+		return fmt.Errorf("invalid param %v for a statement with %v params", param, stmt.NumParams)
+	}
+	if stmt.longData == nil {
+		stmt.longData = make(map[int][]byte)
+	}
+	stmt.longData[param] = append(stmt.longData[param], data[6:]...)
+	return nil
+}
+
+// Reset forgets the long data of the params, for COM_STMT_RESET.
+func (stmt *Stmt) Reset() {
+	stmt.longData = nil
+}
+
+// ParseExecute parses the params of a COM_STMT_EXECUTE, and returns
+// their values: nil, int64, uint64, float64, string for the dates and
+// times, and []byte for everything else. The long data of the params
+// is consumed.
+//
+// Expected format:
+//
+//	# bytes   field
+//	4         statement id
+//	1         flags
+//	4         iteration count
+//	n         NULL bitmap of the params, (NumParams+7)/8 bytes
+//	1         new params bound flag
+//	2 * p     types of the params, if the flag is set
+//	...       values of the non NULL params
+func (stmt *Stmt) ParseExecute(data []byte) ([]interface{}, error) {
+	defer stmt.Reset()
+	if len(data) < 9 {
+		return nil, fmt.Errorf("COM_STMT_EXECUTE is too short: %v bytes", len(data))
+	}
+	if stmt.NumParams == 0 {
+		return nil, nil
+	}
+	data = data[9:]
+	bitmapLen := (stmt.NumParams + 7) / 8
+	if len(data) < bitmapLen+1 {
+		return nil, fmt.Errorf("COM_STMT_EXECUTE is too short for %v params", stmt.NumParams)
+	}
+	nulls := data[:bitmapLen]
+	newParams := data[bitmapLen]
+	data = data[bitmapLen+1:]
+	if newParams == 1 {
+		if len(data) < 2*stmt.NumParams {
+			return nil, fmt.Errorf("COM_STMT_EXECUTE is too short for the types of %v params", stmt.NumParams)
+		}
+		stmt.types = append([]byte(nil), data[:2*stmt.NumParams]...)
+		data = data[2*stmt.NumParams:]
+	}
+	if stmt.types == nil {
+		return nil, fmt.Errorf("COM_STMT_EXECUTE without the types of the params")
+	}
+
+	values := make([]interface{}, stmt.NumParams)
+	for i := range values {
+		if nulls[i/8]&(1<<uint(i%8)) != 0 {
+			continue
+		}
+		if long, ok := stmt.longData[i]; ok {
+			values[i] = long
+			continue
+		}
+		var err error
+		if values[i], data, err = readBinaryValue(data, stmt.types[2*i], stmt.types[2*i+1]&flagUnsigned != 0); err != nil {
+			return nil, fmt.Errorf("can't read param %v: %v", i, err)
+		}
+	}
+	return values, nil
+}
+
+// readBinaryValue reads a value of the binary protocol at the start
+// of data, and returns it with the rest of data.
+func readBinaryValue(data []byte, typ byte, unsigned bool) (interface{}, []byte, error) {
+	fixed := func(n int) ([]byte, error) {
+		if len(data) < n {
+			return nil, fmt.Errorf("%v bytes for a value of type %v, want %v", len(data), typ, n)
+		}
+		return data[:n], nil
+	}
+	switch typ {
+	case proto.VT_NULL:
+		return nil, data, nil
+	case proto.VT_TINY:
+		b, err := fixed(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if unsigned {
+			return uint64(b[0]), data[1:], nil
+		}
+		return int64(int8(b[0])), data[1:], nil
+	case proto.VT_SHORT, proto.VT_YEAR:
+		b, err := fixed(2)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := binary.LittleEndian.Uint16(b)
+		if unsigned {
+			return uint64(v), data[2:], nil
+		}
+		return int64(int16(v)), data[2:], nil
+	case proto.VT_LONG, proto.VT_INT24:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := binary.LittleEndian.Uint32(b)
+		if unsigned {
+			return uint64(v), data[4:], nil
+		}
+		return int64(int32(v)), data[4:], nil
+	case proto.VT_LONGLONG:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := binary.LittleEndian.Uint64(b)
+		if unsigned {
+			return v, data[8:], nil
+		}
+		return int64(v), data[8:], nil
+	case proto.VT_FLOAT:
+		b, err := fixed(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), data[4:], nil
+	case proto.VT_DOUBLE:
+		b, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), data[8:], nil
+	case proto.VT_DATE, proto.VT_DATETIME, proto.VT_TIMESTAMP:
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, nil, fmt.Errorf("truncated date")
+		}
+		s, err := readBinaryDatetime(data[1:1+int(data[0])], typ == proto.VT_DATE)
+		return s, data[1+int(data[0]):], err
+	case proto.VT_TIME:
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, nil, fmt.Errorf("truncated time")
+		}
+		s, err := readBinaryTime(data[1 : 1+int(data[0])])
+		return s, data[1+int(data[0]):], err
+	}
+	v, rest, ok := ReadLenEncString(data)
+	if !ok {
+		return nil, nil, fmt.Errorf("truncated value of type %v", typ)
+	}
+	return v, rest, nil
+}
+
+// readBinaryDatetime formats a binary date or datetime, whose length
+// is 0, 4 (date), 7 (seconds) or 11 (microseconds).
+func readBinaryDatetime(b []byte, dateOnly bool) (string, error) {
+	var year, month, day, hour, minute, second, micro int
+	switch len(b) {
+	case 0:
+	case 11:
+		micro = int(binary.LittleEndian.Uint32(b[7:11]))
+		fallthrough
+	case 7:
+		hour, minute, second = int(b[4]), int(b[5]), int(b[6])
+		fallthrough
+	case 4:
+		year, month, day = int(binary.LittleEndian.Uint16(b[:2])), int(b[2]), int(b[3])
+	default:
+		return "", fmt.Errorf("invalid datetime length: %v", len(b))
+	}
+	s := fmt.Sprintf("%04d-%02d-%02d", year, month, day)
+	if dateOnly {
+		return s, nil
+	}
+	s += fmt.Sprintf(" %02d:%02d:%02d", hour, minute, second)
+	if micro != 0 {
+		s += fmt.Sprintf(".%06d", micro)
+	}
+	return s, nil
+}
+
+// readBinaryTime formats a binary time, whose length is 0, 8
+// (seconds) or 12 (microseconds).
+func readBinaryTime(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "00:00:00", nil
+	}
+	if len(b) != 8 && len(b) != 12 {
+		return "", fmt.Errorf("invalid time length: %v", len(b))
+	}
+	sign := ""
+	if b[0] == 1 {
+		sign = "-"
+	}
+	hours := int(binary.LittleEndian.Uint32(b[1:5]))*24 + int(b[5])
+	s := fmt.Sprintf("%v%02d:%02d:%02d", sign, hours, b[6], b[7])
+	if len(b) == 12 {
+		if micro := binary.LittleEndian.Uint32(b[8:12]); micro != 0 {
+			s += fmt.Sprintf(".%06d", micro)
+		}
+	}
+	return s, nil
+}
+
+// WriteBinaryResult writes qr as a binary resultset, or as an OK
+// packet if it has no fields. The rows are encoded before anything is
+// written: if one can't be, an ERR packet is written instead.
+func (c *Conn) WriteBinaryResult(qr *proto.QueryResult) error {
+	if len(qr.Fields) == 0 {
+		return c.WriteOK(qr.RowsAffected, qr.InsertId)
+	}
+	rows := make([][]byte, len(qr.Rows))
+	for i, row := range qr.Rows {
+		var err error
+		if rows[i], err = binaryRow(qr.Fields, row); err != nil {
+			return c.WriteError(ER_UNKNOWN_ERROR, "can't encode row %v: %v", i, err)
+		}
+	}
+	if err := c.writeFields(qr.Fields); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := c.WritePacket(row); err != nil {
+			return err
+		}
+	}
+	return c.WriteEOF()
+}
+
+// binaryRow encodes a row of a binary resultset: a 0x00 header, the
+// NULL bitmap of the columns with an offset of 2 bits, and the values
+// of the non NULL columns.
+func binaryRow(fields []proto.Field, row []sqltypes.Value) ([]byte, error) {
+	if len(row) != len(fields) {
+		return nil, fmt.Errorf("row has %v values for %v fields", len(row), len(fields))
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(0x00)
+	nulls := make([]byte, (len(fields)+7+2)/8)
+	for i, value := range row {
+		if value.IsNull() {
+			nulls[(i+2)/8] |= 1 << uint((i+2)%8)
+		}
+	}
+	buf.Write(nulls)
+	for i, value := range row {
+		if value.IsNull() {
+			continue
+		}
+		if err := writeBinaryValue(&buf, fields[i].Type, value.String()); err != nil {
+			return nil, fmt.Errorf("column %v: %v", fields[i].Name, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBinaryValue encodes a value of the given type in the binary
+// protocol. The integers are encoded as signed, unless they don't fit.
+func writeBinaryValue(buf *bytes.Buffer, typ int64, s string) error {
+	integer := func() (uint64, error) {
+		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return uint64(v), nil
+		}
+		return strconv.ParseUint(s, 10, 64)
+	}
+	switch typ {
+	case proto.VT_TINY:
+		v, err := integer()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(byte(v))
+	case proto.VT_SHORT, proto.VT_YEAR:
+		v, err := integer()
+		if err != nil {
+			return err
+		}
+		binary.Write(buf, binary.LittleEndian, uint16(v))
+	case proto.VT_LONG, proto.VT_INT24:
+		v, err := integer()
+		if err != nil {
+			return err
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(v))
+	case proto.VT_LONGLONG:
+		v, err := integer()
+		if err != nil {
+			return err
+		}
+		binary.Write(buf, binary.LittleEndian, v)
+	case proto.VT_FLOAT:
+		v, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return err
+		}
+		binary.Write(buf, binary.LittleEndian, math.Float32bits(float32(v)))
+	case proto.VT_DOUBLE:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(v))
+	case proto.VT_DATE, proto.VT_DATETIME, proto.VT_TIMESTAMP, proto.VT_NEWDATE:
+		return writeBinaryDatetime(buf, s)
+	case proto.VT_TIME:
+		return writeBinaryTime(buf, s)
+	default:
+		WriteLenEncString(buf, s)
+	}
+	return nil
+}
+
+// writeBinaryDatetime encodes a date or datetime, formatted as
+// YYYY-MM-DD[ hh:mm:ss[.ffffff]], in its shortest binary form.
+func writeBinaryDatetime(buf *bytes.Buffer, s string) error {
+	var year, month, day, hour, minute, second, micro int
+	date, clock := s, ""
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		date, clock = s[:i], s[i+1:]
+	}
+	if _, err := fmt.Sscanf(date, "%d-%d-%d", &year, &month, &day); err != nil {
+		return fmt.Errorf("invalid date %q: %v", s, err)
+	}
+	if clock != "" {
+		var err error
+		if hour, minute, second, micro, err = parseClock(clock); err != nil {
+			return fmt.Errorf("invalid datetime %q: %v", s, err)
+		}
+	}
+	switch {
+	case micro != 0:
+		buf.WriteByte(11)
+	case hour != 0 || minute != 0 || second != 0:
+		buf.WriteByte(7)
+	case year != 0 || month != 0 || day != 0:
+		buf.WriteByte(4)
+	default:
+		buf.WriteByte(0)
+		return nil
+	}
+	binary.Write(buf, binary.LittleEndian, uint16(year))
+	buf.Write([]byte{byte(month), byte(day)})
+	if hour == 0 && minute == 0 && second == 0 && micro == 0 {
+		return nil
+	}
+	buf.Write([]byte{byte(hour), byte(minute), byte(second)})
+	if micro != 0 {
+		binary.Write(buf, binary.LittleEndian, uint32(micro))
+	}
+	return nil
+}
+
+// writeBinaryTime encodes a time, formatted as [-]h:mm:ss[.ffffff]
+// with any number of hours, in its shortest binary form.
+func writeBinaryTime(buf *bytes.Buffer, s string) error {
+	negative := strings.HasPrefix(s, "-")
+	hours, minute, second, micro, err := parseClock(strings.TrimPrefix(s, "-"))
+	if err != nil {
+		return fmt.Errorf("invalid time %q: %v", s, err)
+	}
+	switch {
+	case micro != 0:
+		buf.WriteByte(12)
+	case hours != 0 || minute != 0 || second != 0:
+		buf.WriteByte(8)
+	default:
+		buf.WriteByte(0)
+		return nil
+	}
+	if negative {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(hours/24))
+	buf.Write([]byte{byte(hours % 24), byte(minute), byte(second)})
+	if micro != 0 {
+		binary.Write(buf, binary.LittleEndian, uint32(micro))
+	}
+	return nil
+}
+
+// parseClock parses hh:mm:ss[.ffffff].
+func parseClock(s string) (hour, minute, second, micro int, err error) {
+	fraction := ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s, fraction = s[:i], s[i+1:]
+	}
+	if _, err = fmt.Sscanf(s, "%d:%d:%d", &hour, &minute, &second); err != nil {
+		return
+	}
+	if fraction != "" {
+		if len(fraction) > 6 {
+			fraction = fraction[:6]
+		}
+		fraction += strings.Repeat("0", 6-len(fraction))
+		micro, err = strconv.Atoi(fraction)
+	}
+	return
+}
@@ -0,0 +1,157 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestReplaceParams(t *testing.T) {
+	testcases := []struct {
+		query, want string
+		count       int
+	}{
+		{"select 1", "select 1", 0},
+		{"select * from t where a = ? and b in (?, ?)", "select * from t where a = :v0 and b in (:v1, :v2)", 3},
+		{"select '?', \"?\", `?` from t where a = ?", "select '?', \"?\", `?` from t where a = :v0", 1},
+		{"select 'it\\'s ?' from t where a = ?", "select 'it\\'s ?' from t where a = :v0", 1},
+		{"select '' from t where a = ?", "select '' from t where a = :v0", 1},
+	}
+	for _, tc := range testcases {
+		got, count := ReplaceParams(tc.query, func(i int) string { return fmt.Sprintf(":v%v", i) })
+		if got != tc.want || count != tc.count {
+			t.Errorf("ReplaceParams(%q) = %q, %v, want %q, %v", tc.query, got, count, tc.want, tc.count)
+		}
+	}
+}
+
+func TestParseExecute(t *testing.T) {
+	stmt := &Stmt{ID: 1, NumParams: 6}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // statement id
+	buf.WriteByte(0)                                   // flags
+	binary.Write(&buf, binary.LittleEndian, uint32(1)) // iteration count
+	buf.WriteByte(0x02)                                // the second param is NULL
+	buf.WriteByte(1)                                   // new params bound
+	buf.Write([]byte{
+		proto.VT_LONGLONG, 0,
+		proto.VT_NULL, 0,
+		proto.VT_TINY, flagUnsigned,
+		proto.VT_DOUBLE, 0,
+		proto.VT_DATETIME, 0,
+		proto.VT_VAR_STRING, 0,
+	})
+	binary.Write(&buf, binary.LittleEndian, int64(-5))
+	buf.WriteByte(200)
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(1.5))
+	buf.Write([]byte{7, 0xdf, 0x07, 10, 15, 13, 45, 30})
+	WriteLenEncString(&buf, "abc")
+
+	want := []interface{}{int64(-5), nil, uint64(200), 1.5, "2015-10-15 13:45:30", []byte("abc")}
+	got, err := stmt.ParseExecute(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseExecute: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExecute = %#v, want %#v", got, want)
+	}
+
+	// The types are remembered, and long data replaces the values.
+	if err := stmt.AppendLongData([]byte{1, 0, 0, 0, 5, 0, 'l', 'o'}); err != nil {
+		t.Fatalf("AppendLongData: %v", err)
+	}
+	if err := stmt.AppendLongData([]byte{1, 0, 0, 0, 5, 0, 'n', 'g'}); err != nil {
+		t.Fatalf("AppendLongData: %v", err)
+	}
+	buf.Reset()
+	buf.Write([]byte{1, 0, 0, 0, 0, 1, 0, 0, 0})
+	buf.WriteByte(0x3e) // all the params but the first are NULL
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, int64(7))
+	got, err = stmt.ParseExecute(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseExecute: %v", err)
+	}
+	if want := []interface{}{int64(7), nil, nil, nil, nil, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseExecute = %#v, want %#v", got, want)
+	}
+
+	if _, err := stmt.ParseExecute([]byte{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 1}); err == nil {
+		t.Errorf("ParseExecute(truncated) succeeded")
+	}
+}
+
+func TestBinaryRow(t *testing.T) {
+	fields := []proto.Field{
+		{Name: "id", Type: proto.VT_LONGLONG},
+		{Name: "name", Type: proto.VT_VAR_STRING},
+		{Name: "score", Type: proto.VT_DOUBLE},
+		{Name: "created", Type: proto.VT_DATETIME},
+		{Name: "day", Type: proto.VT_DATE},
+		{Name: "duration", Type: proto.VT_TIME},
+		{Name: "small", Type: proto.VT_SHORT},
+	}
+	row := []sqltypes.Value{
+		sqltypes.MakeNumeric([]byte("-2")),
+		{},
+		sqltypes.MakeFractional([]byte("0.25")),
+		sqltypes.MakeString([]byte("2015-10-15 13:45:30.5")),
+		sqltypes.MakeString([]byte("2015-10-15")),
+		sqltypes.MakeString([]byte("-26:00:01")),
+		sqltypes.MakeNumeric([]byte("300")),
+	}
+	got, err := binaryRow(fields, row)
+	if err != nil {
+		t.Fatalf("binaryRow: %v", err)
+	}
+	var want bytes.Buffer
+	want.Write([]byte{0x00, 0x08, 0x00}) // header, NULL bitmap with offset 2
+	binary.Write(&want, binary.LittleEndian, int64(-2))
+	binary.Write(&want, binary.LittleEndian, math.Float64bits(0.25))
+	want.Write([]byte{11, 0xdf, 0x07, 10, 15, 13, 45, 30})
+	binary.Write(&want, binary.LittleEndian, uint32(500000))
+	want.Write([]byte{4, 0xdf, 0x07, 10, 15})
+	want.Write([]byte{8, 1, 1, 0, 0, 0, 2, 0, 1})
+	binary.Write(&want, binary.LittleEndian, uint16(300))
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("binaryRow =\n%v, want\n%v", got, want.Bytes())
+	}
+
+	if _, err := binaryRow(fields[:1], []sqltypes.Value{sqltypes.MakeString([]byte("abc"))}); err == nil {
+		t.Errorf("binaryRow(bad integer) succeeded")
+	}
+}
+
+func TestBinaryDatetimeRoundTrip(t *testing.T) {
+	for _, s := range []string{"2015-10-15 13:45:30.000001", "2015-10-15 13:45:30", "0000-00-00 00:00:00"} {
+		var buf bytes.Buffer
+		if err := writeBinaryDatetime(&buf, s); err != nil {
+			t.Fatalf("writeBinaryDatetime(%v): %v", s, err)
+		}
+		got, err := readBinaryDatetime(buf.Bytes()[1:], false)
+		if err != nil || got != s {
+			t.Errorf("round trip of %v: got %v, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"-838:59:59", "12:00:00.500000", "00:00:00"} {
+		var buf bytes.Buffer
+		if err := writeBinaryTime(&buf, s); err != nil {
+			t.Fatalf("writeBinaryTime(%v): %v", s, err)
+		}
+		got, err := readBinaryTime(buf.Bytes()[1:])
+		if err != nil || got != s {
+			t.Errorf("round trip of %v: got %v, %v", s, got, err)
+		}
+	}
+}
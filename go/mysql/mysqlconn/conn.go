@@ -0,0 +1,439 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mysqlconn has the server side of the MySQL client/server
+// protocol: the packet framing, the handshake, mysql_native_password
+// authentication, the OK, ERR, EOF and resultset replies, and the
+// binary protocol of the prepared statements. It lets Go servers
+// accept the connections of MySQL clients and replicas.
+package mysqlconn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+)
+
+// Commands sent by the clients.
+const (
+	COM_QUIT                = 0x01
+	COM_INIT_DB             = 0x02
+	COM_QUERY               = 0x03
+	COM_PING                = 0x0e
+	COM_BINLOG_DUMP         = 0x12
+	COM_REGISTER_SLAVE      = 0x15
+	COM_STMT_PREPARE        = 0x16
+	COM_STMT_EXECUTE        = 0x17
+	COM_STMT_SEND_LONG_DATA = 0x18
+	COM_STMT_CLOSE          = 0x19
+	COM_STMT_RESET          = 0x1a
+	COM_BINLOG_DUMP_GTID    = 0x1e
+)
+
+// Capability flags.
+const (
+	CLIENT_LONG_PASSWORD     = 0x00000001
+	CLIENT_LONG_FLAG         = 0x00000004
+	CLIENT_CONNECT_WITH_DB   = 0x00000008
+	CLIENT_PROTOCOL_41       = 0x00000200
+	CLIENT_TRANSACTIONS      = 0x00002000
+	CLIENT_SECURE_CONNECTION = 0x00008000
+
+	serverCapabilities = CLIENT_LONG_PASSWORD | CLIENT_LONG_FLAG | CLIENT_CONNECT_WITH_DB |
+		CLIENT_PROTOCOL_41 | CLIENT_TRANSACTIONS | CLIENT_SECURE_CONNECTION
+)
+
+// Status flags of the replies.
+const (
+	SERVER_STATUS_IN_TRANS   = 0x0001
+	SERVER_STATUS_AUTOCOMMIT = 0x0002
+)
+
+// Error numbers of the replies that don't come from mysqld.
+const (
+	ER_ACCESS_DENIED_ERROR  = 1045
+	ER_NO_DB_ERROR          = 1046
+	ER_UNKNOWN_COM_ERROR    = 1047
+	ER_BAD_DB_ERROR         = 1049
+	ER_UNKNOWN_ERROR        = 1105
+	ER_WRONG_VALUE_FOR_VAR  = 1231
+	ER_UNKNOWN_STMT_HANDLER = 1243
+)
+
+const (
+	// maxPacketSize is the largest payload of a single packet. Larger
+	// payloads are split, and followed by a shorter (maybe empty) packet.
+	maxPacketSize = 0xffffff
+
+	// CharsetUTF8 is utf8_general_ci, the collation announced for the
+	// connection and the columns of resultsets.
+	CharsetUTF8 = 33
+
+	// MaxHandshakeSize is the MaxPayload of connections that are
+	// not authenticated yet. Handshake responses are much smaller.
+	MaxHandshakeSize = 64 * 1024
+)
+
+// Conn reads and writes the packets of a connection, keeping track
+// of their sequence ids.
+type Conn struct {
+	r *bufio.Reader
+	w io.Writer
+
+	// Sequence is the id of the next packet. It's reset to 0 when the
+	// client sends a new command.
+	Sequence uint8
+
+	// Status is the status flags of the OK and EOF replies.
+	Status uint16
+
+	// MaxPayload, if not 0, is the largest payload ReadPacket
+	// accepts, so clients can't make it allocate without limit.
+	MaxPayload int
+}
+
+// NewConn creates a Conn reading from and writing to rw.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		r:      bufio.NewReader(rw),
+		w:      rw,
+		Status: SERVER_STATUS_AUTOCOMMIT,
+	}
+}
+
+// ReadByte reads a single byte of the connection, outside of any
+// packet. It's used to wait for the end of connections which aren't
+// expected to send anything.
+func (c *Conn) ReadByte() (byte, error) {
+	return c.r.ReadByte()
+}
+
+// ReadPacket reads a payload, joining the packets of the payloads
+// that don't fit in one.
+func (c *Conn) ReadPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		if header[3] != c.Sequence {
+			return nil, fmt.Errorf("invalid packet sequence id: got %v, want %v", header[3], c.Sequence)
+		}
+		c.Sequence++
+		if c.MaxPayload > 0 && len(payload)+length > c.MaxPayload {
+			return nil, fmt.Errorf("packet too large: more than %v bytes", c.MaxPayload)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		if length < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+// WritePacket writes a payload, split in as many packets as needed.
+func (c *Conn) WritePacket(payload []byte) error {
+	for {
+		length := len(payload)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+		header := []byte{byte(length), byte(length >> 8), byte(length >> 16), c.Sequence}
+		c.Sequence++
+		if _, err := c.w.Write(header); err != nil {
+			return err
+		}
+		if _, err := c.w.Write(payload[:length]); err != nil {
+			return err
+		}
+		payload = payload[length:]
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// WriteOK writes an OK packet.
+func (c *Conn) WriteOK(affectedRows, insertID uint64) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0x00)
+	WriteLenEncInt(&buf, affectedRows)
+	WriteLenEncInt(&buf, insertID)
+	binary.Write(&buf, binary.LittleEndian, c.Status)
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // warnings
+	return c.WritePacket(buf.Bytes())
+}
+
+// WriteEOF writes an EOF packet.
+func (c *Conn) WriteEOF() error {
+	var buf bytes.Buffer
+	buf.WriteByte(0xfe)
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // warnings
+	binary.Write(&buf, binary.LittleEndian, c.Status)
+	return c.WritePacket(buf.Bytes())
+}
+
+// WriteError writes an ERR packet.
+func (c *Conn) WriteError(num int, format string, args ...interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteByte(0xff)
+	binary.Write(&buf, binary.LittleEndian, uint16(num))
+	buf.WriteString("#HY000")
+	fmt.Fprintf(&buf, format, args...)
+	return c.WritePacket(buf.Bytes())
+}
+
+// WriteResult writes qr as a text resultset, or as an OK
+// packet if it has no fields.
+func (c *Conn) WriteResult(qr *proto.QueryResult) error {
+	if len(qr.Fields) == 0 {
+		return c.WriteOK(qr.RowsAffected, qr.InsertId)
+	}
+	if err := c.writeFields(qr.Fields); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, row := range qr.Rows {
+		buf.Reset()
+		for _, value := range row {
+			if value.IsNull() {
+				buf.WriteByte(0xfb)
+				continue
+			}
+			WriteLenEncString(&buf, value.String())
+		}
+		if err := c.WritePacket(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return c.WriteEOF()
+}
+
+// writeFields writes the column count and the column definitions of
+// a resultset, followed by an EOF.
+func (c *Conn) writeFields(fields []proto.Field) error {
+	var buf bytes.Buffer
+	WriteLenEncInt(&buf, uint64(len(fields)))
+	if err := c.WritePacket(buf.Bytes()); err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if err := c.WritePacket(columnDefinition(field)); err != nil {
+			return err
+		}
+	}
+	return c.WriteEOF()
+}
+
+// columnDefinition returns the ColumnDefinition41 packet of field.
+func columnDefinition(field proto.Field) []byte {
+	var buf bytes.Buffer
+	WriteLenEncString(&buf, "def") // catalog
+	WriteLenEncString(&buf, "")    // schema
+	WriteLenEncString(&buf, "")    // table
+	WriteLenEncString(&buf, "")    // org_table
+	WriteLenEncString(&buf, field.Name)
+	WriteLenEncString(&buf, field.Name) // org_name
+	buf.WriteByte(0x0c)                 // length of the fixed fields
+	binary.Write(&buf, binary.LittleEndian, uint16(CharsetUTF8))
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // column length
+	buf.WriteByte(byte(field.Type))
+	binary.Write(&buf, binary.LittleEndian, uint16(0)) // flags
+	buf.WriteByte(0)                                   // decimals
+	buf.Write([]byte{0, 0})                            // filler
+	return buf.Bytes()
+}
+
+// HandshakePacket returns the initial handshake packet (protocol version 10)
+// sent by the server. The salt is the 20 bytes of scramble for the
+// mysql_native_password authentication.
+func HandshakePacket(serverVersion string, connectionID uint32, salt []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(10)
+	buf.WriteString(serverVersion)
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, connectionID)
+	buf.Write(salt[:8])
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, uint16(serverCapabilities&0xffff))
+	buf.WriteByte(CharsetUTF8)
+	binary.Write(&buf, binary.LittleEndian, uint16(SERVER_STATUS_AUTOCOMMIT))
+	binary.Write(&buf, binary.LittleEndian, uint16(serverCapabilities>>16))
+	buf.WriteByte(byte(len(salt) + 1))
+	buf.Write(make([]byte, 10))
+	buf.Write(salt[8:])
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+// HandshakeResponse is what we need of the handshake response of
+// the clients (protocol 4.1).
+type HandshakeResponse struct {
+	Capabilities uint32
+	User         string
+	AuthResponse []byte
+	Database     string
+}
+
+// ParseHandshakeResponse parses a HandshakeResponse41 packet.
+//
+// Expected format:
+//
+//	# bytes   field
+//	4         capability flags
+//	4         max packet size
+//	1         character set
+//	23        reserved
+//	string    user name, NUL-terminated
+//	1 + n     auth response, with its length (CLIENT_SECURE_CONNECTION)
+//	string    database, NUL-terminated (CLIENT_CONNECT_WITH_DB)
+func ParseHandshakeResponse(data []byte) (*HandshakeResponse, error) {
+	if len(data) < 32 {
+		return nil, fmt.Errorf("handshake response is too short: %v bytes", len(data))
+	}
+	resp := &HandshakeResponse{Capabilities: binary.LittleEndian.Uint32(data[:4])}
+	if resp.Capabilities&CLIENT_PROTOCOL_41 == 0 {
+		return nil, fmt.Errorf("client doesn't support protocol 4.1: capabilities %#x", resp.Capabilities)
+	}
+	data = data[32:]
+
+	var ok bool
+	if resp.User, data, ok = ReadNulString(data); !ok {
+		return nil, fmt.Errorf("can't read user name from handshake response")
+	}
+	if resp.Capabilities&CLIENT_SECURE_CONNECTION != 0 {
+		if len(data) < 1 || len(data) < 1+int(data[0]) {
+			return nil, fmt.Errorf("can't read auth response from handshake response")
+		}
+		resp.AuthResponse = data[1 : 1+int(data[0])]
+		data = data[1+int(data[0]):]
+	} else {
+		var auth string
+		if auth, data, ok = ReadNulString(data); !ok {
+			return nil, fmt.Errorf("can't read auth response from handshake response")
+		}
+		resp.AuthResponse = []byte(auth)
+	}
+	if resp.Capabilities&CLIENT_CONNECT_WITH_DB != 0 && len(data) > 0 {
+		resp.Database, _, _ = ReadNulString(data)
+	}
+	return resp, nil
+}
+
+// NewSalt returns a random salt for mysql_native_password. Its bytes
+// can't be NUL, since it's sent as a NUL-terminated string.
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, 20)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	for i := range salt {
+		salt[i] = salt[i]&0x7f | 0x01
+	}
+	return salt, nil
+}
+
+// ScramblePassword computes the mysql_native_password auth response
+// for password and salt:
+//
+//	SHA1(password) XOR SHA1(salt + SHA1(SHA1(password)))
+//
+// The auth response of an empty password is empty.
+func ScramblePassword(salt []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(stage2[:])
+	scramble := h.Sum(nil)
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
+
+// ReadNulString reads a NUL-terminated string at the start of data,
+// and returns it with the rest of data.
+func ReadNulString(data []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		return "", data, false
+	}
+	return string(data[:i]), data[i+1:], true
+}
+
+// ReadLenEncInt reads a length-encoded integer at the start of data,
+// and returns it with the rest of data.
+func ReadLenEncInt(data []byte) (uint64, []byte, bool) {
+	if len(data) == 0 {
+		return 0, data, false
+	}
+	switch data[0] {
+	case 0xfc:
+		if len(data) < 3 {
+			return 0, data, false
+		}
+		return uint64(binary.LittleEndian.Uint16(data[1:3])), data[3:], true
+	case 0xfd:
+		if len(data) < 4 {
+			return 0, data, false
+		}
+		return uint64(data[1]) | uint64(data[2])<<8 | uint64(data[3])<<16, data[4:], true
+	case 0xfe:
+		if len(data) < 9 {
+			return 0, data, false
+		}
+		return binary.LittleEndian.Uint64(data[1:9]), data[9:], true
+	case 0xfb, 0xff:
+		return 0, data, false
+	}
+	return uint64(data[0]), data[1:], true
+}
+
+// ReadLenEncString reads a length-encoded string at the start of data,
+// and returns it with the rest of data.
+func ReadLenEncString(data []byte) ([]byte, []byte, bool) {
+	length, rest, ok := ReadLenEncInt(data)
+	if !ok || uint64(len(rest)) < length {
+		return nil, data, false
+	}
+	return rest[:length], rest[length:], true
+}
+
+// WriteLenEncInt writes a length-encoded integer.
+func WriteLenEncInt(buf *bytes.Buffer, i uint64) {
+	switch {
+	case i < 251:
+		buf.WriteByte(byte(i))
+	case i < 1<<16:
+		buf.WriteByte(0xfc)
+		binary.Write(buf, binary.LittleEndian, uint16(i))
+	case i < 1<<24:
+		buf.WriteByte(0xfd)
+		buf.Write([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+	default:
+		buf.WriteByte(0xfe)
+		binary.Write(buf, binary.LittleEndian, i)
+	}
+}
+
+// WriteLenEncString writes a length-encoded string.
+func WriteLenEncString(buf *bytes.Buffer, s string) {
+	WriteLenEncInt(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
@@ -0,0 +1,79 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlconn
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScramblePassword(t *testing.T) {
+	// The auth response of the empty password is empty.
+	if got := ScramblePassword([]byte("01234567890123456789"), ""); got != nil {
+		t.Errorf("ScramblePassword(empty) = %v, want nil", got)
+	}
+	salt := []byte("abcdefghijklmnopqrst")
+	got := ScramblePassword(salt, "secret")
+	if len(got) != 20 {
+		t.Fatalf("ScramblePassword() has %v bytes, want 20", len(got))
+	}
+	if bytes.Equal(got, ScramblePassword([]byte("ABCDEFGHIJKLMNOPQRST"), "secret")) {
+		t.Errorf("ScramblePassword() doesn't depend on the salt")
+	}
+}
+
+func TestWritePacketSplit(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Conn{w: &buf}
+	payload := make([]byte, maxPacketSize)
+	if err := c.WritePacket(payload); err != nil {
+		t.Fatalf("WritePacket: %v", err)
+	}
+	// A full packet, and an empty one to end the payload.
+	if got, want := buf.Len(), 4+maxPacketSize+4; got != want {
+		t.Errorf("written %v bytes, want %v", got, want)
+	}
+	if got := buf.Bytes()[4+maxPacketSize:]; !bytes.Equal(got, []byte{0, 0, 0, 1}) {
+		t.Errorf("last packet header = %v, want [0 0 0 1]", got)
+	}
+}
+
+func TestReadPacketMaxPayload(t *testing.T) {
+	var buf bytes.Buffer
+	w := &Conn{w: &buf}
+	if err := w.WritePacket(make([]byte, 100)); err != nil {
+		t.Fatalf("WritePacket: %v", err)
+	}
+	packet := buf.Bytes()
+
+	c := NewConn(bytes.NewBuffer(packet))
+	c.MaxPayload = 100
+	if data, err := c.ReadPacket(); err != nil || len(data) != 100 {
+		t.Errorf("ReadPacket: got %v bytes, %v, want 100 bytes", len(data), err)
+	}
+	c = NewConn(bytes.NewBuffer(packet))
+	c.MaxPayload = 99
+	if _, err := c.ReadPacket(); err == nil || err.Error() != "packet too large: more than 99 bytes" {
+		t.Errorf("ReadPacket: got %v, want a packet too large error", err)
+	}
+}
+
+func TestLenEncInt(t *testing.T) {
+	for _, i := range []uint64{0, 250, 251, 1<<16 - 1, 1 << 16, 1<<24 - 1, 1 << 24, 1<<64 - 1} {
+		var buf bytes.Buffer
+		WriteLenEncInt(&buf, i)
+		buf.WriteByte('x')
+		got, rest, ok := ReadLenEncInt(buf.Bytes())
+		if !ok || got != i || !bytes.Equal(rest, []byte("x")) {
+			t.Errorf("ReadLenEncInt(%v) = %v, %q, %v", buf.Bytes(), got, rest, ok)
+		}
+	}
+	if _, _, ok := ReadLenEncInt([]byte{0xfc, 1}); ok {
+		t.Errorf("ReadLenEncInt(truncated) succeeded")
+	}
+	if _, _, ok := ReadLenEncString([]byte{5, 'a', 'b'}); ok {
+		t.Errorf("ReadLenEncString(truncated) succeeded")
+	}
+}
@@ -26,6 +26,12 @@ void vt_library_init(void) {
   mysql_library_init(0, 0, 0);
 }
 
+// null_if_empty converts the empty strings of unset parameters to the
+// NULL values the MySQL library expects.
+static const char *null_if_empty(const char *s) {
+  return (s && *s) ? s : 0;
+}
+
 int vt_connect(
     VT_CONN *conn,
     const char *host,
@@ -35,12 +41,21 @@ int vt_connect(
     unsigned int port,
     const char *unix_socket,
     const char *csname,
-    unsigned long client_flag)
+    unsigned long client_flag,
+    const char *ssl_key,
+    const char *ssl_cert,
+    const char *ssl_ca,
+    const char *ssl_capath,
+    const char *ssl_cipher)
 {
   MYSQL *c;
 
   mysql_thread_init();
   conn->mysql = mysql_init(0);
+  if(client_flag & CLIENT_SSL) {
+    mysql_ssl_set(conn->mysql, null_if_empty(ssl_key), null_if_empty(ssl_cert),
+        null_if_empty(ssl_ca), null_if_empty(ssl_capath), null_if_empty(ssl_cipher));
+  }
   c = mysql_real_connect(conn->mysql, host, user, passwd, db, port, unix_socket, client_flag);
   if(!c) {
     return 1;
@@ -19,6 +19,7 @@ typedef struct vt_conn {
 } VT_CONN;
 
 // vt_connect: Create a connection. You must call vt_close even if vt_connect fails.
+// The ssl parameters are only used if client_flag has CLIENT_SSL, empty strings are ignored.
 int vt_connect(
     VT_CONN *conn,
     const char *host,
@@ -28,7 +29,12 @@ int vt_connect(
     unsigned int port,
     const char *unix_socket,
     const char *csname,
-    unsigned long client_flag);
+    unsigned long client_flag,
+    const char *ssl_key,
+    const char *ssl_cert,
+    const char *ssl_ca,
+    const char *ssl_capath,
+    const char *ssl_cipher);
 void vt_close(VT_CONN *conn);
 
 // vt_execute: stream!=0 uses streaming (use_result). Otherwise it prefetches (store_result).
@@ -109,6 +109,26 @@ func (nu *Numbered) GetOutdated(age time.Duration, purpose string) (vals []inter
 	return vals
 }
 
+// GetOutdatedFunc is like GetOutdated, but lets the caller decide the
+// age limit of each resource. isOutdated is called with the resource
+// and its age, under the pool lock.
+func (nu *Numbered) GetOutdatedFunc(isOutdated func(val interface{}, age time.Duration) bool, purpose string) (vals []interface{}) {
+	nu.mu.Lock()
+	defer nu.mu.Unlock()
+	now := time.Now()
+	for _, nw := range nu.resources {
+		if nw.inUse {
+			continue
+		}
+		if isOutdated(nw.val, now.Sub(nw.timeCreated)) {
+			nw.inUse = true
+			nw.purpose = purpose
+			vals = append(vals, nw.val)
+		}
+	}
+	return vals
+}
+
 // GetIdle returns a list of resurces that have been idle for longer
 // than timeout, and locks them. It does not return any resources that
 // are already locked.
@@ -129,6 +149,19 @@ func (nu *Numbered) GetIdle(timeout time.Duration, purpose string) (vals []inter
 	return vals
 }
 
+// GetAll returns all the resources, with the purpose they're used
+// for, or "" if they're not in use. It doesn't lock them: it's meant
+// for reporting.
+func (nu *Numbered) GetAll() (vals []interface{}, purposes []string) {
+	nu.mu.Lock()
+	defer nu.mu.Unlock()
+	for _, nw := range nu.resources {
+		vals = append(vals, nw.val)
+		purposes = append(purposes, nw.purpose)
+	}
+	return vals, purposes
+}
+
 // WaitForEmpty returns as soon as the pool becomes empty
 func (nu *Numbered) WaitForEmpty() {
 	nu.mu.Lock()
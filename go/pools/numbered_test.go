@@ -59,6 +59,20 @@ func TestNumbered(t *testing.T) {
 	}
 	time.Sleep(100 * time.Millisecond)
 
+	// 1 has a longer age limit than 0 and 2
+	vals = p.GetOutdatedFunc(func(val interface{}, age time.Duration) bool {
+		if val.(int64) == 1 {
+			return age >= time.Second
+		}
+		return age >= 300*time.Millisecond
+	}, "by outdated func")
+	if len(vals) != 1 || vals[0].(int64) != 0 {
+		t.Errorf("want [0], got %v", vals)
+	}
+	for _, v := range vals {
+		p.Put(v.(int64))
+	}
+
 	// p has 0, 1, 2 (2 is idle)
 	vals = p.GetIdle(200*time.Millisecond, "by idle")
 	if len(vals) != 1 {
@@ -76,6 +90,21 @@ func TestNumbered(t *testing.T) {
 	if p.Size() != 2 {
 		t.Errorf("want 2, got %v", p.Size())
 	}
+	p.Get(1, "test3")
+	vals, purposes := p.GetAll()
+	if len(vals) != 2 {
+		t.Errorf("want 2, got %v", len(vals))
+	}
+	for i, v := range vals {
+		want := ""
+		if v.(int64) == 1 {
+			want = "test3"
+		}
+		if purposes[i] != want {
+			t.Errorf("purpose of %v: want %q, got %q", v, want, purposes[i])
+		}
+	}
+	p.Put(1)
 	go func() {
 		p.Unregister(0)
 		p.Unregister(1)
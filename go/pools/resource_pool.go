@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
 )
 
 var (
@@ -33,10 +34,14 @@ type ResourcePool struct {
 	factory     Factory
 	capacity    sync2.AtomicInt64
 	idleTimeout sync2.AtomicDuration
+	// idleTimer closes the idle resources, so the pool
+	// shrinks back after traffic spikes.
+	idleTimer *timer.Timer
 
 	// stats
-	waitCount sync2.AtomicInt64
-	waitTime  sync2.AtomicDuration
+	waitCount  sync2.AtomicInt64
+	waitTime   sync2.AtomicDuration
+	idleClosed sync2.AtomicInt64
 }
 
 type resourceWrapper struct {
@@ -58,10 +63,12 @@ func NewResourcePool(factory Factory, capacity, maxCap int, idleTimeout time.Dur
 		factory:     factory,
 		capacity:    sync2.AtomicInt64(capacity),
 		idleTimeout: sync2.AtomicDuration(idleTimeout),
+		idleTimer:   timer.NewTimer(idleTimeout / 10),
 	}
 	for i := 0; i < capacity; i++ {
 		rp.resources <- resourceWrapper{}
 	}
+	rp.idleTimer.Start(rp.closeIdleResources)
 	return rp
 }
 
@@ -71,6 +78,7 @@ func NewResourcePool(factory Factory, capacity, maxCap int, idleTimeout time.Dur
 // After a Close, Get and TryGet are not allowed.
 func (rp *ResourcePool) Close() {
 	rp.SetCapacity(0)
+	rp.idleTimer.Stop()
 }
 
 func (rp *ResourcePool) IsClosed() (closed bool) {
@@ -185,13 +193,45 @@ func (rp *ResourcePool) SetCapacity(capacity int) error {
 	return nil
 }
 
+// closeIdleResources closes the available resources that have
+// not been used for longer than the idle timeout. Their slots stay
+// in the pool, and get a new resource when they're used again.
+func (rp *ResourcePool) closeIdleResources() {
+	timeout := rp.idleTimeout.Get()
+	if timeout <= 0 {
+		return
+	}
+	available := int(rp.Available())
+	for i := 0; i < available; i++ {
+		var wrapper resourceWrapper
+		var ok bool
+		select {
+		case wrapper, ok = <-rp.resources:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+		if wrapper.resource != nil && time.Now().Sub(wrapper.timeUsed) > timeout {
+			wrapper.resource.Close()
+			wrapper.resource = nil
+			rp.idleClosed.Add(1)
+		}
+		rp.resources <- wrapper
+	}
+}
+
 func (rp *ResourcePool) recordWait(start time.Time) {
 	rp.waitCount.Add(1)
 	rp.waitTime.Add(time.Now().Sub(start))
 }
 
+// SetIdleTimeout changes the idle timeout, and how often
+// the idle resources are closed.
 func (rp *ResourcePool) SetIdleTimeout(idleTimeout time.Duration) {
 	rp.idleTimeout.Set(idleTimeout)
+	rp.idleTimer.SetInterval(idleTimeout / 10)
 }
 
 func (rp *ResourcePool) StatsJSON() string {
@@ -226,3 +266,9 @@ func (rp *ResourcePool) WaitTime() time.Duration {
 func (rp *ResourcePool) IdleTimeout() time.Duration {
 	return rp.idleTimeout.Get()
 }
+
+// IdleClosed returns the number of resources closed
+// because they were idle.
+func (rp *ResourcePool) IdleClosed() int64 {
+	return rp.idleClosed.Get()
+}
@@ -485,3 +485,38 @@ func TestSlowCreateFail(t *testing.T) {
 		t.Errorf("Expecting 2, received %d", available)
 	}
 }
+
+func TestIdleReaping(t *testing.T) {
+	lastId.Set(0)
+	count.Set(0)
+	p := NewResourcePool(PoolFactory, 2, 2, 10*time.Millisecond)
+	defer p.Close()
+
+	var resources [2]Resource
+	for i := range resources {
+		r, err := p.Get()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		resources[i] = r
+	}
+	for _, r := range resources {
+		p.Put(r)
+	}
+	if count.Get() != 2 {
+		t.Errorf("Expecting 2, received %d", count.Get())
+	}
+	// The idle resources are closed without any Get.
+	for i := 0; i < 100 && count.Get() != 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if count.Get() != 0 {
+		t.Errorf("Expecting 0, received %d", count.Get())
+	}
+	if p.IdleClosed() != 2 {
+		t.Errorf("Expecting 2, received %d", p.IdleClosed())
+	}
+	if p.Available() != 2 {
+		t.Errorf("Expecting 2, received %d", p.Available())
+	}
+}
@@ -7,6 +7,7 @@ package stats
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"sync"
 )
 
@@ -138,3 +139,29 @@ func (h *Histogram) Buckets() []int64 {
 	defer h.mu.Unlock()
 	return h.buckets
 }
+
+// Percentile returns an upper bound of the p-th percentile (between
+// 0 and 100) of the values: the cutoff of the bucket it falls in.
+// If it falls in the last bucket, the highest cutoff is returned.
+// It returns 0 if there are no values.
+func (h *Histogram) Percentile(p float64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := int64(0)
+	for _, v := range h.buckets {
+		count += v
+	}
+	if count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(count)))
+	cumulative := int64(0)
+	for i, v := range h.buckets[:len(h.cutoffs)] {
+		cumulative += v
+		if cumulative >= rank {
+			return h.cutoffs[i]
+		}
+	}
+	return h.cutoffs[len(h.cutoffs)-1]
+}
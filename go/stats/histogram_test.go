@@ -58,6 +58,25 @@ func TestGenericHistogram(t *testing.T) {
 	}
 }
 
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram("", []int64{1, 5, 10})
+	if p := h.Percentile(50); p != 0 {
+		t.Errorf("want 0, got %d", p)
+	}
+	for i := 0; i < 20; i++ {
+		h.Add(int64(i))
+	}
+	testcases := []struct {
+		p    float64
+		want int64
+	}{{0, 1}, {10, 1}, {11, 5}, {50, 10}, {55, 10}, {99, 10}, {100, 10}}
+	for _, tc := range testcases {
+		if got := h.Percentile(tc.p); got != tc.want {
+			t.Errorf("Percentile(%v): want %d, got %d", tc.p, tc.want, got)
+		}
+	}
+}
+
 func TestHistogramHook(t *testing.T) {
 	var gotname string
 	var gotv *Histogram
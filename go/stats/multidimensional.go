@@ -34,3 +34,39 @@ func CounterForDimension(mt MultiTracker, dimension string) CountTracker {
 	panic(fmt.Sprintf("label %v is not one of %v", dimension, mt.Labels))
 
 }
+
+// CounterForDimensions returns a CountTracker for the provided
+// dimensions, the values of which are joined with dots in its
+// keys. It will panic if a dimension isn't a legal label for mt.
+func CounterForDimensions(mt MultiTracker, dimensions ...string) CountTracker {
+	var indexes []int
+	for _, dimension := range dimensions {
+		index := -1
+		for i, lab := range mt.Labels() {
+			if lab == dimension {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			panic(fmt.Sprintf("label %v is not one of %v", dimension, mt.Labels()))
+		}
+		indexes = append(indexes, index)
+	}
+	return CountersFunc(func() map[string]int64 {
+		result := make(map[string]int64)
+		for k, v := range mt.Counts() {
+			if k == "All" {
+				result[k] = v
+				continue
+			}
+			values := strings.Split(k, ".")
+			names := make([]string, len(indexes))
+			for i, index := range indexes {
+				names[i] = values[index]
+			}
+			result[strings.Join(names, ".")] += v
+		}
+		return result
+	})
+}
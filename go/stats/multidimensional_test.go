@@ -28,3 +28,26 @@ func TestMultiTimingsCounterFor(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiCountersCounterForDimensions(t *testing.T) {
+	clear()
+	mc := NewMultiCounters("multicounters4", []string{"dim1", "dim2", "dim3"})
+
+	mc.Add([]string{"a", "b", "c"}, 1)
+	mc.Add([]string{"a", "b", "d"}, 2)
+	mc.Add([]string{"e", "b", "c"}, 4)
+
+	cases := []struct {
+		dims []string
+		want map[string]int64
+	}{
+		{[]string{"dim1", "dim2"}, map[string]int64{"a.b": 3, "e.b": 4}},
+		{[]string{"dim3", "dim1"}, map[string]int64{"c.a": 1, "d.a": 2, "c.e": 4}},
+	}
+	for _, c := range cases {
+		counts := CounterForDimensions(mc, c.dims...).Counts()
+		if !reflect.DeepEqual(c.want, counts) {
+			t.Errorf("CounterForDimensions(%v).Counts()=%v, want %v", c.dims, counts, c.want)
+		}
+	}
+}
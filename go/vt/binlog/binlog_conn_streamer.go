@@ -7,10 +7,12 @@ package binlog
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
@@ -27,8 +29,22 @@ type binlogConnStreamer struct {
 	svm  sync2.ServiceManager
 	conn *mysqlctl.SlaveConnection
 
-	// pos is the GTID of the most recent event we've seen.
+	// pos is the GTID of the most recent event we've seen. For
+	// GTID sets, like the MySQL 5.6 ones, it's the set of all the
+	// transactions up to that event.
 	pos myproto.GTID
+
+	// getTableSchema is used to look up the column names and primary key
+	// of tables that appear in row based replication events. Results are
+	// cached in tableSchemas until the next DDL.
+	getTableSchema func(table string) (*tableSchema, error)
+	tableSchemas   map[string]*tableSchema
+
+	// keyspaceIdColumn and keyspaceIdType describe the sharding column, for
+	// the keyspace_id comments of row based replication statements. They're
+	// only set for key range streams.
+	keyspaceIdColumn string
+	keyspaceIdType   key.KeyspaceIdType
 }
 
 // newBinlogConnStreamer creates a BinlogStreamer.
@@ -38,7 +54,40 @@ func newBinlogConnStreamer(dbname string, mysqld *mysqlctl.Mysqld) BinlogStreame
 	return &binlogConnStreamer{
 		dbname: dbname,
 		mysqld: mysqld,
+		getTableSchema: func(table string) (*tableSchema, error) {
+			return loadTableSchema(mysqld, dbname, table)
+		},
+		tableSchemas: make(map[string]*tableSchema),
+	}
+}
+
+// tableSchema returns the cached schema of a table, or loads it.
+func (bls *binlogConnStreamer) tableSchema(table string) (*tableSchema, error) {
+	if ts, ok := bls.tableSchemas[table]; ok {
+		return ts, nil
+	}
+	ts, err := bls.getTableSchema(table)
+	if err != nil {
+		return nil, err
+	}
+	ts.KeyspaceIdColumn = -1
+	if bls.keyspaceIdColumn != "" {
+		for i, col := range ts.Columns {
+			if strings.EqualFold(col, bls.keyspaceIdColumn) {
+				ts.KeyspaceIdColumn = i
+				break
+			}
+		}
 	}
+	bls.tableSchemas[table] = ts
+	return ts, nil
+}
+
+// setKeyspaceIdColumn sets the sharding column of a key range stream.
+// It must be called before Stream.
+func (bls *binlogConnStreamer) setKeyspaceIdColumn(column string, kit key.KeyspaceIdType) {
+	bls.keyspaceIdColumn = column
+	bls.keyspaceIdType = kit
 }
 
 // Stream implements BinlogStreamer.Stream().
@@ -48,6 +97,7 @@ func (bls *binlogConnStreamer) Stream(startPos myproto.GTID, sendTransaction sen
 		var events <-chan proto.BinlogEvent
 		var err error
 
+		bls.pos = startPos
 		if bls.conn, err = mysqlctl.NewSlaveConnection(bls.mysqld); err != nil {
 			return err
 		}
@@ -95,6 +145,12 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 	var statements []proto.Statement
 	var format proto.BinlogFormat
 	var autocommit = true
+	// charset is the character set of the statements of the current
+	// transaction. Each transaction sets it, since it's applied on its own.
+	var charset *proto.Charset
+	// tableMaps holds the last TABLE_MAP_EVENT for each table ID. Row based
+	// replication sends one before the rows events of each statement.
+	tableMaps := make(map[uint64]*proto.TableMap)
 
 	// A commit can be triggered either by a COMMIT query, or by an XID_EVENT.
 	commit := func(timestamp int64) error {
@@ -111,6 +167,7 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 		}
 		statements = nil
 		autocommit = true
+		charset = nil
 		return nil
 	}
 
@@ -156,14 +213,21 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 			continue
 		}
 
+		// Strip the checksum, if the binlogs have them, after verifying it.
+		ev, _, err = ev.StripChecksum(format)
+		if err != nil {
+			return fmt.Errorf("can't strip checksum from binlog event: %v, event data: %#v", err, ev)
+		}
+
 		// Update the GTID if the event has one. The actual event type could be
 		// something special like GTID_EVENT (MariaDB, MySQL 5.6), or it could be
 		// an arbitrary event with a GTID in the header (Google MySQL).
 		if ev.HasGTID(format) {
-			bls.pos, err = ev.GTID(format)
+			gtid, err := ev.GTID(format)
 			if err != nil {
 				return fmt.Errorf("can't get GTID from binlog event: %v, event data: %#v", err, ev)
 			}
+			bls.pos = myproto.AdvanceGTID(bls.pos, gtid)
 			// If it's a dedicated GTID_EVENT, there's nothing else to do.
 			if ev.IsGTID() {
 				continue
@@ -195,11 +259,11 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 			})
 		case ev.IsQuery(): // QUERY_EVENT
 			// Extract the query string and group into transactions.
-			db, sql, err := ev.Query(format)
+			q, err := ev.Query(format)
 			if err != nil {
 				return fmt.Errorf("can't get query from binlog event: %v, event data: %#v", err, ev)
 			}
-			switch cat := getStatementCategory(sql); cat {
+			switch cat := getStatementCategory(q.SQL); cat {
 			case proto.BL_BEGIN:
 				if statements != nil {
 					// If this happened, it would be a legitimate error.
@@ -208,6 +272,7 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 				}
 				statements = make([]proto.Statement, 0, 10)
 				autocommit = false
+				charset = nil
 			case proto.BL_ROLLBACK:
 				// Rollbacks are possible under some circumstances. So, let's honor them
 				// by sending an empty transaction, which will contain the new binlog position.
@@ -218,21 +283,74 @@ func (bls *binlogConnStreamer) parseEvents(svc *sync2.ServiceContext, events <-c
 					return err
 				}
 			default: // BL_DDL, BL_DML, BL_SET, BL_UNRECOGNIZED
-				if db != "" && db != bls.dbname {
+				if q.Database != "" && q.Database != bls.dbname {
 					// Skip cross-db statements.
 					continue
 				}
+				if cat == proto.BL_DDL {
+					// The schema of any table might have changed.
+					bls.tableSchemas = make(map[string]*tableSchema)
+				}
 				statements = append(statements, proto.Statement{
 					Category: proto.BL_SET,
 					Sql:      []byte(fmt.Sprintf("SET TIMESTAMP=%d", ev.Timestamp())),
 				})
-				statements = append(statements, proto.Statement{Category: cat, Sql: sql})
+				if q.Charset != nil && (charset == nil || *q.Charset != *charset) {
+					// The statement must be applied and decoded in the
+					// character set it was written in.
+					charset = q.Charset
+					statements = append(statements, proto.Statement{
+						Category: proto.BL_SET,
+						Sql:      []byte(fmt.Sprintf("SET @@session.character_set_client=%d, @@session.collation_connection=%d, @@session.collation_server=%d", charset.Client, charset.Conn, charset.Server)),
+					})
+				}
+				statements = append(statements, proto.Statement{Category: cat, Sql: q.SQL})
 				if autocommit {
 					if err = commit(int64(ev.Timestamp())); err != nil {
 						return err
 					}
 				}
 			}
+		case ev.IsTableMap(): // TABLE_MAP_EVENT
+			tm, err := ev.TableMap(format)
+			if err != nil {
+				return fmt.Errorf("can't parse TABLE_MAP_EVENT: %v, event data: %#v", err, ev)
+			}
+			tableMaps[ev.TableID(format)] = tm
+		case ev.IsWriteRows(), ev.IsUpdateRows(), ev.IsDeleteRows(): // *_ROWS_EVENT
+			tableID := ev.TableID(format)
+			tm, ok := tableMaps[tableID]
+			if !ok {
+				return fmt.Errorf("got rows event for unknown table ID %v, event data: %#v", tableID, ev)
+			}
+			if tm.Database != "" && tm.Database != bls.dbname {
+				// Skip cross-db statements.
+				continue
+			}
+			rows, err := ev.Rows(format, tm)
+			if err != nil {
+				return fmt.Errorf("can't parse rows event: %v, event data: %#v", err, ev)
+			}
+			ts, err := bls.tableSchema(tm.Name)
+			if err != nil {
+				return fmt.Errorf("can't get schema of table %v: %v", tm.Name, err)
+			}
+			sqls, err := rowsEventStatements(ev, tm, ts, bls.keyspaceIdType, rows)
+			if err != nil {
+				return fmt.Errorf("can't convert rows event: %v, event data: %#v", err, ev)
+			}
+			statements = append(statements, proto.Statement{
+				Category: proto.BL_SET,
+				Sql:      []byte(fmt.Sprintf("SET TIMESTAMP=%d", ev.Timestamp())),
+			})
+			for _, sql := range sqls {
+				statements = append(statements, proto.Statement{Category: proto.BL_DML, Sql: sql})
+			}
+			if autocommit {
+				if err = commit(int64(ev.Timestamp())); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
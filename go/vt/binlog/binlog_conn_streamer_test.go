@@ -55,6 +55,7 @@ func TestBinlogConnStreamerParseEventsXID(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -97,6 +98,7 @@ func TestBinlogConnStreamerParseEventsCommit(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -428,6 +430,7 @@ func TestBinlogConnStreamerParseEventsRollback(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -469,6 +472,7 @@ func TestBinlogConnStreamerParseEventsDMLWithoutBegin(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -517,6 +521,7 @@ func TestBinlogConnStreamerParseEventsBeginWithoutCommit(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -567,6 +572,7 @@ func TestBinlogConnStreamerParseEventsSetInsertID(t *testing.T) {
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET INSERT_ID=101")},
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -646,6 +652,7 @@ func TestBinlogConnStreamerParseEventsOtherDB(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
@@ -689,6 +696,7 @@ func TestBinlogConnStreamerParseEventsOtherDBBegin(t *testing.T) {
 		proto.BinlogTransaction{
 			Statements: []proto.Statement{
 				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")},
 				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(eid, id) values (1, 1) /* _stream vt_a (eid id ) (1 1 ); */")},
 			},
 			Timestamp: 1407805592,
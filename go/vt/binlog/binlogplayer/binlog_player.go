@@ -76,8 +76,9 @@ type BinlogPlayer struct {
 	dbClient VtClient
 
 	// for key range base requests
-	keyspaceIdType key.KeyspaceIdType
-	keyRange       key.KeyRange
+	keyspaceIdType   key.KeyspaceIdType
+	keyRange         key.KeyRange
+	keyspaceIdColumn string
 
 	// for table base requests
 	tables []string
@@ -91,16 +92,19 @@ type BinlogPlayer struct {
 // NewBinlogPlayerKeyRange returns a new BinlogPlayer pointing at the server
 // replicating the provided keyrange, starting at the startPosition.GTID,
 // and updating _vt.blp_checkpoint with uid=startPosition.Uid.
+// keyspaceIdColumn is the sharding column, used by the server to filter
+// row based replication events.
 // If stopAtGTID != nil, it will stop when reaching that GTID.
-func NewBinlogPlayerKeyRange(dbClient VtClient, addr string, keyspaceIdType key.KeyspaceIdType, keyRange key.KeyRange, startPosition *proto.BlpPosition, stopAtGTID myproto.GTID, blplStats *BinlogPlayerStats) *BinlogPlayer {
+func NewBinlogPlayerKeyRange(dbClient VtClient, addr string, keyspaceIdType key.KeyspaceIdType, keyRange key.KeyRange, keyspaceIdColumn string, startPosition *proto.BlpPosition, stopAtGTID myproto.GTID, blplStats *BinlogPlayerStats) *BinlogPlayer {
 	return &BinlogPlayer{
-		addr:           addr,
-		dbClient:       dbClient,
-		keyspaceIdType: keyspaceIdType,
-		keyRange:       keyRange,
-		blpPos:         *startPosition,
-		stopAtGTID:     stopAtGTID,
-		blplStats:      blplStats,
+		addr:             addr,
+		dbClient:         dbClient,
+		keyspaceIdType:   keyspaceIdType,
+		keyRange:         keyRange,
+		keyspaceIdColumn: keyspaceIdColumn,
+		blpPos:           *startPosition,
+		stopAtGTID:       stopAtGTID,
+		blplStats:        blplStats,
 	}
 }
 
@@ -248,15 +252,10 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 		log.Infof("Will stop player when reaching %v", blp.stopAtGTID)
 	}
 
-	binlogPlayerClientFactory, ok := binlogPlayerClientFactories[*binlogPlayerProtocol]
-	if !ok {
-		return fmt.Errorf("no binlog player client factory named %v", *binlogPlayerProtocol)
-	}
-	blplClient := binlogPlayerClientFactory()
-	err := blplClient.Dial(blp.addr, *binlogPlayerConnTimeout)
+	blplClient, err := DialBinlogPlayerClient(blp.addr)
 	if err != nil {
-		log.Errorf("Error dialing binlog server: %v", err)
-		return fmt.Errorf("error dialing binlog server: %v", err)
+		log.Errorf("%v", err)
+		return err
 	}
 	defer blplClient.Close()
 
@@ -266,13 +265,16 @@ func (blp *BinlogPlayer) ApplyBinlogEvents(interrupted chan struct{}) error {
 		req := &proto.TablesRequest{
 			Tables:    blp.tables,
 			GTIDField: blp.blpPos.GTIDField,
+			BatchSize: *binlogPlayerBatchSize,
 		}
 		resp = blplClient.StreamTables(req, responseChan)
 	} else {
 		req := &proto.KeyRangeRequest{
-			KeyspaceIdType: blp.keyspaceIdType,
-			KeyRange:       blp.keyRange,
-			GTIDField:      blp.blpPos.GTIDField,
+			KeyspaceIdType:   blp.keyspaceIdType,
+			KeyRange:         blp.keyRange,
+			KeyspaceIdColumn: blp.keyspaceIdColumn,
+			GTIDField:        blp.blpPos.GTIDField,
+			BatchSize:        *binlogPlayerBatchSize,
 		}
 		resp = blplClient.StreamKeyRange(req, responseChan)
 	}
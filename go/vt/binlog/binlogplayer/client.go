@@ -6,6 +6,7 @@ package binlogplayer
 
 import (
 	"flag"
+	"fmt"
 	"time"
 
 	log "github.com/golang/glog"
@@ -18,6 +19,7 @@ This file contains the API and registration mechanism for binlog player client.
 
 var binlogPlayerProtocol = flag.String("binlog_player_protocol", "gorpc", "the protocol to download binlogs from a vttablet")
 var binlogPlayerConnTimeout = flag.Duration("binlog_player_conn_timeout", 5*time.Second, "binlog player connection timeout")
+var binlogPlayerBatchSize = flag.Int("binlog_player_batch_size", 0, "number of transactions to request per reply from the binlog server, 0 for one per reply (compatible with older servers)")
 
 // BinlogPlayerResponse is the return value for streaming events
 type BinlogPlayerResponse interface {
@@ -52,3 +54,17 @@ func RegisterBinlogPlayerClientFactory(name string, factory BinlogPlayerClientFa
 	}
 	binlogPlayerClientFactories[name] = factory
 }
+
+// DialBinlogPlayerClient creates a BinlogPlayerClient for the
+// protocol specified by binlog_player_protocol, and dials addr.
+func DialBinlogPlayerClient(addr string) (BinlogPlayerClient, error) {
+	factory, ok := binlogPlayerClientFactories[*binlogPlayerProtocol]
+	if !ok {
+		return nil, fmt.Errorf("no binlog player client factory named %v", *binlogPlayerProtocol)
+	}
+	client := factory()
+	if err := client.Dial(addr, *binlogPlayerConnTimeout); err != nil {
+		return nil, fmt.Errorf("error dialing binlog server: %v", err)
+	}
+	return client, nil
+}
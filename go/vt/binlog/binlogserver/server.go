@@ -0,0 +1,351 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package binlogserver serves the binlogs of a mysqld to MySQL replicas.
+//
+// It speaks enough of the MySQL protocol for replicas to point
+// CHANGE MASTER TO at it: each replica connection is relayed to the
+// local mysqld through a slave connection, once the replica is
+// authenticated. The queries that replicas run while connecting
+// (server_id, checksum and heartbeat settings...) are executed on that
+// connection, any other query is refused. The binlog dump commands are
+// forwarded, their events streamed back as they are. This way replicas
+// can be moved off the master, and kept replicating while it's under
+// maintenance.
+package binlogserver
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/mysql/mysqlconn"
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+)
+
+var (
+	connCount    = stats.NewInt("BinlogServerConnections")
+	dumpCount    = stats.NewInt("BinlogServerDumps")
+	relayedBytes = stats.NewInt("BinlogServerRelayedBytes")
+)
+
+// handshakeTimeout is how long replicas have to authenticate.
+var handshakeTimeout = 10 * time.Second
+
+// replicaQueries match the queries replicas run while connecting: they
+// read the variables of their master, and set the user variables of
+// their session that mysqld reads for the dump.
+var replicaQueries = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^\s*SELECT\s+(@@(GLOBAL\.)?\w+|@\w+|UNIX_TIMESTAMP\(\)|VERSION\(\))\s*$`),
+	regexp.MustCompile(`(?i)^\s*SET\s+@\w+\s*=\s*('[^'\\]*'|-?\d+|@@(GLOBAL\.)?\w+)\s*$`),
+	regexp.MustCompile(`(?i)^\s*SHOW\s+(GLOBAL\s+|SESSION\s+)?VARIABLES\s+LIKE\s+'\w+'\s*$`),
+}
+
+func isReplicaQuery(sql string) bool {
+	for _, re := range replicaQueries {
+		if re.MatchString(sql) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstream is the connection to mysqld a replica connection is relayed
+// to. It's implemented by mysqlctl.SlaveConnection.
+type upstream interface {
+	ExecuteFetch(query string, maxrows int, wantfields bool) (*proto.QueryResult, error)
+	SendCommand(command uint32, data []byte) error
+	ReadPacket() ([]byte, error)
+	ForceClose()
+	Close()
+}
+
+// Server accepts the connections of replicas, and relays them to mysqld.
+type Server struct {
+	user     string
+	password string
+	dial     func() (upstream, error)
+	// version returns the version of mysqld, which is announced
+	// in the handshake. It's only asked until it succeeds.
+	version func() (string, error)
+
+	versionMu     sync.Mutex
+	serverVersion string
+
+	listener net.Listener
+	nextID   sync2.AtomicUint32
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a Server relaying replicas to mysqld. Replicas
+// have to authenticate as user, with password.
+func NewServer(mysqld *mysqlctl.Mysqld, user, password string) *Server {
+	return newServer(func() (upstream, error) {
+		return mysqlctl.NewSlaveConnection(mysqld)
+	}, mysqld.ServerVersion, user, password)
+}
+
+func newServer(dial func() (upstream, error), version func() (string, error), user, password string) *Server {
+	return &Server{
+		user:     user,
+		password: password,
+		dial:     dial,
+		version:  version,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// ListenAndServe listens on port, and serves replicas until Close.
+func (s *Server) ListenAndServe(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	log.Infof("binlog server listening on port %v", port)
+	return s.Serve(l)
+}
+
+// Serve serves the replicas connecting to l, until Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.listener == nil
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops listening, closes the connections of the
+// replicas, and waits for their relays to end.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// handle serves the replica connected on conn.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	connCount.Add(1)
+	defer connCount.Add(-1)
+
+	// Until they're authenticated, replicas get nothing from
+	// mysqld, and can't hold the connection or send large packets.
+	pc := mysqlconn.NewConn(conn)
+	pc.MaxPayload = mysqlconn.MaxHandshakeSize
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := s.authenticate(pc, conn.RemoteAddr()); err != nil {
+		log.Warningf("binlog server: %v", err)
+		return
+	}
+	pc.MaxPayload = 0
+	conn.SetDeadline(time.Time{})
+
+	up, err := s.dial()
+	if err != nil {
+		log.Errorf("binlog server: can't connect to mysqld: %v", err)
+		pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "can't connect to mysqld: %v", err)
+		return
+	}
+	defer up.Close()
+	if err := pc.WriteOK(0, 0); err != nil {
+		log.Warningf("binlog server: can't reply to %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	for {
+		pc.Sequence = 0
+		data, err := pc.ReadPacket()
+		if err != nil || len(data) == 0 {
+			return
+		}
+		command, arg := data[0], data[1:]
+		switch command {
+		case mysqlconn.COM_QUIT:
+			return
+		case mysqlconn.COM_PING, mysqlconn.COM_INIT_DB:
+			err = pc.WriteOK(0, 0)
+		case mysqlconn.COM_REGISTER_SLAVE:
+			// Replicas register to show up in the SHOW SLAVE HOSTS
+			// of their master, which is us rather than mysqld.
+			err = pc.WriteOK(0, 0)
+		case mysqlconn.COM_QUERY:
+			err = s.query(pc, up, string(arg))
+		case mysqlconn.COM_BINLOG_DUMP, mysqlconn.COM_BINLOG_DUMP_GTID:
+			// The dump goes on until the connection is closed.
+			s.dump(pc, up, uint32(command), arg, conn)
+			return
+		default:
+			err = pc.WriteError(mysqlconn.ER_UNKNOWN_COM_ERROR, "unsupported command: %#x", command)
+		}
+		if err != nil {
+			log.Warningf("binlog server: can't reply to %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// getVersion returns the version of mysqld, which is only asked once.
+func (s *Server) getVersion() (string, error) {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	if s.serverVersion == "" {
+		version, err := s.version()
+		if err != nil {
+			return "", err
+		}
+		s.serverVersion = version
+	}
+	return s.serverVersion, nil
+}
+
+// authenticate runs the handshake of the replica, and checks its
+// credentials. The server version announced is the one of mysqld,
+// which replicas use to know the features of their master. The OK
+// reply is left to the caller.
+func (s *Server) authenticate(pc *mysqlconn.Conn, addr net.Addr) error {
+	version, err := s.getVersion()
+	if err != nil {
+		pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "can't get the version of mysqld: %v", err)
+		return fmt.Errorf("can't get the version of mysqld: %v", err)
+	}
+
+	salt, err := mysqlconn.NewSalt()
+	if err != nil {
+		return err
+	}
+	if err := pc.WritePacket(mysqlconn.HandshakePacket(version, s.nextID.Add(1), salt)); err != nil {
+		return fmt.Errorf("can't send handshake to %v: %v", addr, err)
+	}
+	data, err := pc.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("can't read handshake response of %v: %v", addr, err)
+	}
+	resp, err := mysqlconn.ParseHandshakeResponse(data)
+	if err != nil {
+		pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "%v", err)
+		return fmt.Errorf("bad handshake response from %v: %v", addr, err)
+	}
+	if resp.User != s.user || !bytes.Equal(resp.AuthResponse, mysqlconn.ScramblePassword(salt, s.password)) {
+		pc.WriteError(mysqlconn.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", resp.User)
+		return fmt.Errorf("access denied for user %v from %v", resp.User, addr)
+	}
+	return nil
+}
+
+// query runs a query of the replica on mysqld, and sends back the
+// result. Only the queries of replicas are run: the connection has
+// the privileges of the dba.
+func (s *Server) query(pc *mysqlconn.Conn, up upstream, sql string) error {
+	if !isReplicaQuery(sql) {
+		return pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "query not supported by the binlog server: %v", sql)
+	}
+	qr, err := up.ExecuteFetch(sql, 10000, true)
+	if err != nil {
+		if sqlErr, ok := err.(*mysql.SqlError); ok {
+			return pc.WriteError(sqlErr.Number(), "%v", sqlErr.Message)
+		}
+		return pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "%v", err)
+	}
+	return pc.WriteResult(qr)
+}
+
+// dump forwards a binlog dump command to mysqld, and relays the
+// packets of the events to the replica, until either side closes
+// its connection.
+func (s *Server) dump(pc *mysqlconn.Conn, up upstream, command uint32, arg []byte, conn net.Conn) {
+	addr := conn.RemoteAddr()
+	dumpCount.Add(1)
+	defer dumpCount.Add(-1)
+
+	// Replicas don't send anything during the dump, so the only thing
+	// we can read is the end of their connection. It's how we know we
+	// have to unblock the read of the next event, and stop the dump.
+	var mu sync.Mutex
+	finished := false
+	watcher := make(chan struct{})
+	go func() {
+		defer close(watcher)
+		pc.ReadByte()
+		mu.Lock()
+		if !finished {
+			up.ForceClose()
+		}
+		mu.Unlock()
+	}()
+	defer func() {
+		mu.Lock()
+		finished = true
+		mu.Unlock()
+		conn.Close()
+		<-watcher
+	}()
+
+	log.Infof("binlog server: starting binlog dump for %v", addr)
+	if err := up.SendCommand(command, arg); err != nil {
+		pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "%v", err)
+		log.Errorf("binlog server: can't start binlog dump for %v: %v", addr, err)
+		return
+	}
+	for {
+		buf, err := up.ReadPacket()
+		if err != nil {
+			// mysqld sent an error, or closed the connection.
+			if sqlErr, ok := err.(*mysql.SqlError); ok {
+				pc.WriteError(sqlErr.Number(), "%v", sqlErr.Message)
+			} else {
+				pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "%v", err)
+			}
+			log.Infof("binlog server: binlog dump for %v ended: %v", addr, err)
+			return
+		}
+		if err := pc.WritePacket(buf); err != nil {
+			log.Infof("binlog server: binlog dump for %v ended: %v", addr, err)
+			return
+		}
+		relayedBytes.Add(int64(len(buf)))
+		if len(buf) > 0 && buf[0] == 0xfe && len(buf) < 9 {
+			// EOF: mysqld has no more events to send.
+			log.Infof("binlog server: binlog dump for %v reached EOF", addr)
+			return
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlogserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql/mysqlconn"
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/sync2"
+)
+
+// fakeUpstream answers the queries with the results of its map, and
+// replies to binlog dumps with its packets, followed by an EOF.
+type fakeUpstream struct {
+	results  map[string]*proto.QueryResult
+	queries  []string
+	dials    sync2.AtomicInt32
+	commands chan []byte
+	packets  chan []byte
+	closed   chan bool
+}
+
+func newFakeUpstream(packets ...[]byte) *fakeUpstream {
+	fu := &fakeUpstream{
+		results: map[string]*proto.QueryResult{
+			"SELECT @@GLOBAL.SERVER_ID": &proto.QueryResult{
+				Fields: []proto.Field{{Name: "@@GLOBAL.SERVER_ID", Type: proto.VT_LONGLONG}},
+				Rows:   [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("62344"))}},
+			},
+		},
+		commands: make(chan []byte, 1),
+		packets:  make(chan []byte, len(packets)+1),
+		closed:   make(chan bool, 1),
+	}
+	for _, p := range packets {
+		fu.packets <- p
+	}
+	fu.packets <- []byte{0xfe, 0, 0, 2, 0}
+	return fu
+}
+
+func (fu *fakeUpstream) ExecuteFetch(query string, maxrows int, wantfields bool) (*proto.QueryResult, error) {
+	fu.queries = append(fu.queries, query)
+	if qr, ok := fu.results[query]; ok {
+		return qr, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %v", query)
+}
+
+func (fu *fakeUpstream) SendCommand(command uint32, data []byte) error {
+	fu.commands <- append([]byte{byte(command)}, data...)
+	return nil
+}
+
+func (fu *fakeUpstream) ReadPacket() ([]byte, error) {
+	return <-fu.packets, nil
+}
+
+func (fu *fakeUpstream) ForceClose() {}
+
+func (fu *fakeUpstream) Close() {
+	fu.closed <- true
+}
+
+// startServer serves fu on a local port, and returns a client connection.
+func startServer(t *testing.T, fu *fakeUpstream) (*Server, *mysqlconn.Conn) {
+	s := newServer(func() (upstream, error) {
+		fu.dials.Add(1)
+		return fu, nil
+	}, func() (string, error) {
+		return "5.6.17-log", nil
+	}, "vt_repl", "secret")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go s.Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	return s, mysqlconn.NewConn(conn)
+}
+
+// login reads the handshake of the server, and replies with the
+// credentials of user. It returns the reply of the server.
+func login(t *testing.T, pc *mysqlconn.Conn, user, password string) []byte {
+	data, err := pc.ReadPacket()
+	if err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	if data[0] != 10 {
+		t.Fatalf("unexpected protocol version: %v", data[0])
+	}
+	version, rest, _ := mysqlconn.ReadNulString(data[1:])
+	if version != "5.6.17-log" {
+		t.Errorf("server version = %v, want the version of mysqld", version)
+	}
+	// connection id, salt part 1, filler, capabilities, charset,
+	// status, capabilities, salt length, reserved, salt part 2.
+	salt := append(append([]byte(nil), rest[4:12]...), rest[31:43]...)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(mysqlconn.CLIENT_PROTOCOL_41|mysqlconn.CLIENT_SECURE_CONNECTION))
+	binary.Write(&buf, binary.LittleEndian, uint32(1<<24))
+	buf.WriteByte(mysqlconn.CharsetUTF8)
+	buf.Write(make([]byte, 23))
+	buf.WriteString(user)
+	buf.WriteByte(0)
+	scramble := mysqlconn.ScramblePassword(salt, password)
+	buf.WriteByte(byte(len(scramble)))
+	buf.Write(scramble)
+	if err := pc.WritePacket(buf.Bytes()); err != nil {
+		t.Fatalf("can't send handshake response: %v", err)
+	}
+	reply, err := pc.ReadPacket()
+	if err != nil {
+		t.Fatalf("can't read handshake reply: %v", err)
+	}
+	return reply
+}
+
+// command sends a command, and returns the first packet of the reply.
+func command(t *testing.T, pc *mysqlconn.Conn, command byte, arg []byte) []byte {
+	pc.Sequence = 0
+	if err := pc.WritePacket(append([]byte{command}, arg...)); err != nil {
+		t.Fatalf("can't send command %#x: %v", command, err)
+	}
+	reply, err := pc.ReadPacket()
+	if err != nil {
+		t.Fatalf("can't read reply of command %#x: %v", command, err)
+	}
+	return reply
+}
+
+func TestServerAccessDenied(t *testing.T) {
+	fu := newFakeUpstream()
+	s, pc := startServer(t, fu)
+	defer s.Close()
+
+	reply := login(t, pc, "vt_repl", "wrong")
+	if reply[0] != 0xff || binary.LittleEndian.Uint16(reply[1:3]) != mysqlconn.ER_ACCESS_DENIED_ERROR {
+		t.Errorf("login with a wrong password: got %v, want an access denied error", reply)
+	}
+	if _, err := pc.ReadPacket(); err == nil {
+		t.Errorf("connection still open after an access denied error")
+	}
+	if got := fu.dials.Get(); got != 0 {
+		t.Errorf("mysqld dialed %v times for a replica that failed to authenticate, want 0", got)
+	}
+}
+
+func TestServerHandshakeLimits(t *testing.T) {
+	fu := newFakeUpstream()
+	s, pc := startServer(t, fu)
+	defer s.Close()
+
+	// a handshake response larger than the limit is refused
+	if _, err := pc.ReadPacket(); err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	if err := pc.WritePacket(make([]byte, mysqlconn.MaxHandshakeSize+1)); err != nil {
+		t.Fatalf("can't send handshake response: %v", err)
+	}
+	if _, err := pc.ReadPacket(); err == nil {
+		t.Errorf("connection still open after a handshake response of %v bytes", mysqlconn.MaxHandshakeSize+1)
+	}
+
+	// a replica that doesn't authenticate in time is disconnected
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 10 * time.Millisecond
+	s, pc = startServer(t, fu)
+	defer s.Close()
+	if _, err := pc.ReadPacket(); err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	if _, err := pc.ReadPacket(); err == nil {
+		t.Errorf("connection still open after the handshake timeout")
+	}
+	if got := fu.dials.Get(); got != 0 {
+		t.Errorf("mysqld dialed %v times for replicas that failed to authenticate, want 0", got)
+	}
+}
+
+func TestServerQuery(t *testing.T) {
+	fu := newFakeUpstream()
+	s, pc := startServer(t, fu)
+	defer s.Close()
+
+	if reply := login(t, pc, "vt_repl", "secret"); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+	if reply := command(t, pc, mysqlconn.COM_REGISTER_SLAVE, []byte{1, 0, 0, 0}); reply[0] != 0x00 {
+		t.Errorf("COM_REGISTER_SLAVE: got %v, want OK", reply)
+	}
+
+	// A resultset: column count, column definition, EOF, row, EOF.
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("SELECT @@GLOBAL.SERVER_ID")); !reflect.DeepEqual(reply, []byte{1}) {
+		t.Fatalf("column count: got %v, want [1]", reply)
+	}
+	var packets [][]byte
+	for i := 0; i < 4; i++ {
+		p, err := pc.ReadPacket()
+		if err != nil {
+			t.Fatalf("can't read resultset: %v", err)
+		}
+		packets = append(packets, p)
+	}
+	if !bytes.Contains(packets[0], []byte("@@GLOBAL.SERVER_ID")) {
+		t.Errorf("column definition = %q, want the name of the field", packets[0])
+	}
+	if packets[1][0] != 0xfe || packets[3][0] != 0xfe {
+		t.Errorf("resultset = %v, want EOF packets around the rows", packets)
+	}
+	if want := []byte("\x0562344"); !bytes.Equal(packets[2], want) {
+		t.Errorf("row = %q, want %q", packets[2], want)
+	}
+
+	// The errors of mysqld are sent back.
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("SELECT @@GLOBAL.bad")); reply[0] != 0xff {
+		t.Errorf("bad query: got %v, want an error", reply)
+	}
+
+	// The queries that are not run by replicas are refused.
+	for _, sql := range []string{
+		"DROP DATABASE vt_test",
+		"SELECT * FROM mysql.user",
+		"SET GLOBAL read_only = 0",
+		"SET @a = 1; DROP DATABASE vt_test",
+	} {
+		if reply := command(t, pc, mysqlconn.COM_QUERY, []byte(sql)); reply[0] != 0xff {
+			t.Errorf("%v: got %v, want an error", sql, reply)
+		}
+	}
+	if want := []string{"SELECT @@GLOBAL.SERVER_ID", "SELECT @@GLOBAL.bad"}; !reflect.DeepEqual(fu.queries, want) {
+		t.Errorf("queries run on mysqld: got %v, want %v", fu.queries, want)
+	}
+	if reply := command(t, pc, 0x1b, nil); reply[0] != 0xff || binary.LittleEndian.Uint16(reply[1:3]) != mysqlconn.ER_UNKNOWN_COM_ERROR {
+		t.Errorf("unsupported command: got %v, want an unknown command error", reply)
+	}
+}
+
+func TestServerBinlogDump(t *testing.T) {
+	events := [][]byte{
+		{0x00, 1, 2, 3},
+		{0x00, 4, 5, 6, 7},
+	}
+	fu := newFakeUpstream(events...)
+	s, pc := startServer(t, fu)
+	defer s.Close()
+
+	if reply := login(t, pc, "vt_repl", "secret"); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+	dump := []byte{4, 0, 0, 0, 0, 0, 7, 0, 0, 0}
+	if got := command(t, pc, mysqlconn.COM_BINLOG_DUMP, dump); !bytes.Equal(got, events[0]) {
+		t.Errorf("first event = %v, want %v", got, events[0])
+	}
+	if got := <-fu.commands; !bytes.Equal(got, append([]byte{mysqlconn.COM_BINLOG_DUMP}, dump...)) {
+		t.Errorf("forwarded command = %v, want %v", got, dump)
+	}
+	got, err := pc.ReadPacket()
+	if err != nil || !bytes.Equal(got, events[1]) {
+		t.Errorf("second event = %v, %v, want %v", got, err, events[1])
+	}
+	if got, err := pc.ReadPacket(); err != nil || got[0] != 0xfe {
+		t.Errorf("end of dump = %v, %v, want EOF", got, err)
+	}
+	<-fu.closed
+}
+
+func TestIsReplicaQuery(t *testing.T) {
+	for _, sql := range []string{
+		"SELECT UNIX_TIMESTAMP()",
+		"SELECT @@GLOBAL.SERVER_ID",
+		"SELECT @@GLOBAL.SERVER_UUID",
+		"SELECT @@GLOBAL.COLLATION_SERVER",
+		"SELECT @master_binlog_checksum",
+		"SELECT @@GLOBAL.GTID_MODE",
+		"SET @master_heartbeat_period= 1799999979520",
+		"SET @master_binlog_checksum= @@global.binlog_checksum",
+		"SET @slave_uuid= '0b4f5ae2-3d0c-11e4-a2b8-0800270e0a65'",
+		"SET @mariadb_slave_capability=4",
+		"SET @slave_connect_state='0-1-100'",
+		"SHOW VARIABLES LIKE 'SERVER_ID'",
+	} {
+		if !isReplicaQuery(sql) {
+			t.Errorf("isReplicaQuery(%q) = false, want true", sql)
+		}
+	}
+	for _, sql := range []string{
+		"SELECT * FROM mysql.user",
+		"SELECT @@GLOBAL.SERVER_ID, (SELECT 1)",
+		"SET GLOBAL read_only = 0",
+		"SET @a = 'x\\'; DROP TABLE t; --'",
+		"SET @a = 1, GLOBAL read_only = 0",
+		"SHOW VARIABLES LIKE 'a'; DROP TABLE t",
+		"KILL 1",
+	} {
+		if isReplicaQuery(sql) {
+			t.Errorf("isReplicaQuery(%q) = true, want false", sql)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// ChangeEvent is the change-data-capture form of an update stream event,
+// as written in JSON by a JSONEventWriter.
+type ChangeEvent struct {
+	// Operation is INSERT, UPDATE or DELETE for the DML events, and the
+	// category of the other events: DDL, ERR, BEGIN, COMMIT or POS.
+	Operation string `json:"operation"`
+
+	// Table and PK are set for the DML events. PK has the primary key
+	// of each row changed, by column name.
+	Table string                   `json:"table,omitempty"`
+	PK    []map[string]interface{} `json:"pk,omitempty"`
+
+	// Sql is set for the DDL and ERR events.
+	Sql string `json:"sql,omitempty"`
+
+	// GTID is the encoded position of the COMMIT and POS events,
+	// where streams can be restarted.
+	GTID string `json:"gtid,omitempty"`
+
+	Timestamp     int64 `json:"timestamp"`
+	TransactionID int64 `json:"transaction_id,omitempty"`
+}
+
+// NewChangeEvent converts an update stream event to a ChangeEvent. The
+// operation of DML events is only known if they have their statement.
+func NewChangeEvent(event *proto.StreamEvent) *ChangeEvent {
+	ce := &ChangeEvent{
+		Operation:     event.Category,
+		GTID:          myproto.EncodeGTID(event.GTIDField.Value),
+		Timestamp:     event.Timestamp,
+		TransactionID: event.TransactionID,
+	}
+	switch event.Category {
+	case "DML":
+		if i := strings.IndexByte(event.Sql, ' '); i > 0 {
+			ce.Operation = strings.ToUpper(event.Sql[:i])
+		}
+		ce.Table = event.TableName
+		for _, row := range event.PKValues {
+			pk := make(map[string]interface{}, len(event.PKColNames))
+			for i, col := range event.PKColNames {
+				if i >= len(row) {
+					break
+				}
+				value := row[i]
+				// The event streamer has converted the strings to UTF-8.
+				if b, ok := value.([]byte); ok {
+					value = string(b)
+				}
+				pk[col] = value
+			}
+			ce.PK = append(ce.PK, pk)
+		}
+	case "DDL", "ERR":
+		ce.Sql = event.Sql
+	}
+	return ce
+}
+
+// JSONEventWriter writes update stream events as JSON ChangeEvents, one per
+// line. It's an EventSink. It flushes the writer at the end of each
+// transaction, if it's an http.Flusher.
+type JSONEventWriter struct {
+	w       io.Writer
+	encoder *json.Encoder
+	count   int64
+}
+
+// NewJSONEventWriter creates a JSONEventWriter writing to w.
+func NewJSONEventWriter(w io.Writer) *JSONEventWriter {
+	return &JSONEventWriter{w: w, encoder: json.NewEncoder(w)}
+}
+
+// Send implements EventSink.Send(). It has the signature of the update
+// stream callbacks.
+func (jw *JSONEventWriter) Send(event *proto.StreamEvent) error {
+	if err := jw.encoder.Encode(NewChangeEvent(event)); err != nil {
+		return err
+	}
+	jw.count++
+	if event.Category == "COMMIT" || event.Category == "POS" {
+		return jw.Flush()
+	}
+	return nil
+}
+
+// Flush implements EventSink.Flush().
+func (jw *JSONEventWriter) Flush() error {
+	if f, ok := jw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// serveChangeEvents streams the update stream over HTTP as JSON change
+// events, one per line, with the transaction markers. It starts at the
+// gtid parameter, as encoded in the events. The tables parameter, a
+// comma-separated list, restricts the DML events to these tables.
+func (updateStream *UpdateStream) serveChangeEvents(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	gtid, err := myproto.DecodeGTID(r.FormValue("gtid"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid gtid: %v", err), http.StatusBadRequest)
+		return
+	}
+	req := &proto.UpdateStreamRequest{
+		GTIDField:          myproto.GTIDField{Value: gtid},
+		TransactionMarkers: true,
+		DMLSql:             true,
+	}
+	if tables := r.FormValue("tables"); tables != "" {
+		req.Tables = strings.Split(tables, ",")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	jw := NewJSONEventWriter(w)
+	if err := updateStream.ServeUpdateStream(req, jw.Send); err != nil {
+		log.Warningf("change events stream for %v ended: %v", r.RemoteAddr, err)
+		if jw.count == 0 {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestNewChangeEvent(t *testing.T) {
+	gtid := myproto.MustParseGTID(blsMysqlFlavor, "20")
+	testcases := []struct {
+		event *proto.StreamEvent
+		want  *ChangeEvent
+	}{{
+		event: &proto.StreamEvent{
+			Category:      "DML",
+			TableName:     "vtocc_e",
+			PKColNames:    []string{"eid", "name"},
+			PKValues:      [][]interface{}{{int64(1), []byte("name")}, {uint64(2), []byte("x")}},
+			Sql:           "update vtocc_e set foo = 1 /* _stream vtocc_e (eid name ) (1 'bmFtZQ==' ) (2 'eA==' ); */",
+			Timestamp:     1,
+			TransactionID: 3,
+		},
+		want: &ChangeEvent{
+			Operation:     "UPDATE",
+			Table:         "vtocc_e",
+			PK:            []map[string]interface{}{{"eid": int64(1), "name": "name"}, {"eid": uint64(2), "name": "x"}},
+			Timestamp:     1,
+			TransactionID: 3,
+		},
+	}, {
+		// Without their statement, the operation of DMLs isn't known.
+		event: &proto.StreamEvent{
+			Category:   "DML",
+			TableName:  "vtocc_e",
+			PKColNames: []string{"eid"},
+			PKValues:   [][]interface{}{{int64(1)}},
+		},
+		want: &ChangeEvent{
+			Operation: "DML",
+			Table:     "vtocc_e",
+			PK:        []map[string]interface{}{{"eid": int64(1)}},
+		},
+	}, {
+		event: &proto.StreamEvent{Category: "DDL", Sql: "alter table vtocc_e", Timestamp: 1},
+		want:  &ChangeEvent{Operation: "DDL", Sql: "alter table vtocc_e", Timestamp: 1},
+	}, {
+		event: &proto.StreamEvent{Category: "COMMIT", GTIDField: myproto.GTIDField{Value: gtid}, TransactionID: 3},
+		want:  &ChangeEvent{Operation: "COMMIT", GTID: myproto.EncodeGTID(gtid), TransactionID: 3},
+	}}
+	for _, tc := range testcases {
+		if got := NewChangeEvent(tc.event); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("NewChangeEvent(%#v) = %#v, want %#v", tc.event, got, tc.want)
+		}
+	}
+}
+
+func TestJSONEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	jw := NewJSONEventWriter(&buf)
+	evs := &EventStreamer{sendEvent: jw.Send}
+	evs.SetTransactionMarkers()
+	evs.SetDMLSql()
+	trans := &proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{
+				Category: proto.BL_DML,
+				Sql:      []byte("insert into vtocc_a values (1, 1) /* _stream vtocc_a (eid id ) (1 1 ); */"),
+			},
+			{
+				Category: proto.BL_DML,
+				Sql:      []byte("delete from vtocc_e where eid = 2 /* _stream vtocc_e (eid name ) (2 'bmFtZQ==' ); */"),
+			},
+		},
+		Timestamp: 1,
+		GTIDField: myproto.GTIDField{Value: myproto.MustParseGTID(blsMysqlFlavor, "20")},
+	}
+	if err := evs.transactionToEvent(trans); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"operation":"BEGIN","timestamp":1,"transaction_id":1}
+{"operation":"INSERT","table":"vtocc_a","pk":[{"eid":1,"id":1}],"timestamp":1,"transaction_id":1}
+{"operation":"DELETE","table":"vtocc_e","pk":[{"eid":2,"name":"name"}],"timestamp":1,"transaction_id":1}
+{"operation":"COMMIT","gtid":"` + blsMysqlFlavor + `/20","timestamp":1,"transaction_id":1}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
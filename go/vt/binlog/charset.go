@@ -0,0 +1,72 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// latin1Collations are the IDs of the collations of latin1.
+var latin1Collations = map[int]bool{
+	5:  true, // latin1_german1_ci
+	8:  true, // latin1_swedish_ci
+	15: true, // latin1_danish_ci
+	31: true, // latin1_german2_ci
+	47: true, // latin1_bin
+	48: true, // latin1_general_ci
+	49: true, // latin1_general_cs
+	94: true, // latin1_spanish_ci
+}
+
+// cp1252 maps the bytes 0x80 to 0x9f of MySQL's latin1, which is cp1252
+// with its 5 undefined bytes mapped to the C1 controls. The other bytes
+// are the same as in iso-8859-1, which are their own code points.
+var cp1252 = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+// toUTF8 converts text written with the character_set_client collation ID
+// to UTF-8. Only latin1 is converted: utf8 and utf8mb4 are already UTF-8,
+// and binary strings, like the other character sets, are left as is.
+func toUTF8(collation int, text []byte) []byte {
+	if !latin1Collations[collation] || isASCII(text) {
+		return text
+	}
+	buf := make([]byte, 0, len(text)*2)
+	for _, b := range text {
+		r := rune(b)
+		if b >= 0x80 && b < 0xa0 {
+			r = cp1252[b-0x80]
+		}
+		var encoded [utf8.UTFMax]byte
+		n := utf8.EncodeRune(encoded[:], r)
+		buf = append(buf, encoded[:n]...)
+	}
+	return buf
+}
+
+func isASCII(text []byte) bool {
+	for _, b := range text {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCharsetClient returns the character_set_client collation ID of a
+// SET @@session.character_set_client=... statement of the binlogs.
+func parseCharsetClient(sql []byte) (int, error) {
+	value := sql[BINLOG_SET_CHARSET_LEN:]
+	if end := bytes.IndexByte(value, ','); end != -1 {
+		value = value[:end]
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(value)))
+}
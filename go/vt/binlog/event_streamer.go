@@ -22,6 +22,8 @@ var (
 	BINLOG_SET_TIMESTAMP_LEN = len(BINLOG_SET_TIMESTAMP)
 	BINLOG_SET_INSERT        = []byte("SET INSERT_ID=")
 	BINLOG_SET_INSERT_LEN    = len(BINLOG_SET_INSERT)
+	BINLOG_SET_CHARSET       = []byte("SET @@session.character_set_client=")
+	BINLOG_SET_CHARSET_LEN   = len(BINLOG_SET_CHARSET)
 	STREAM_COMMENT_START     = []byte("/* _stream ")
 )
 
@@ -36,6 +38,23 @@ type sendEventFunc func(event *proto.StreamEvent) error
 type EventStreamer struct {
 	bls       BinlogStreamer
 	sendEvent sendEventFunc
+
+	// tables, if not nil, are the only tables whose DML events are sent.
+	// The other DMLs are skipped before their _stream comment is parsed.
+	tables map[string]bool
+
+	// charset is the character_set_client collation ID of the statements,
+	// or 0 if the binlogs didn't say. Their strings are converted from it
+	// to UTF-8.
+	charset int
+
+	// transactionMarkers makes the events of each transaction go between
+	// a BEGIN and a COMMIT event, with the transactionID of the transaction.
+	transactionMarkers bool
+	transactionID      int64
+
+	// dmlSql makes the DML events carry their statement in Sql.
+	dmlSql bool
 }
 
 func NewEventStreamer(dbname string, mysqld *mysqlctl.Mysqld) *EventStreamer {
@@ -44,6 +63,31 @@ func NewEventStreamer(dbname string, mysqld *mysqlctl.Mysqld) *EventStreamer {
 	}
 }
 
+// SetTables restricts the DML events to the given tables. DDL, ERR and POS
+// events are still sent. It must be called before Stream.
+func (evs *EventStreamer) SetTables(tables []string) {
+	evs.tables = make(map[string]bool, len(tables))
+	for _, table := range tables {
+		evs.tables[table] = true
+	}
+}
+
+// SetTransactionMarkers surrounds the events of each transaction with BEGIN
+// and COMMIT events, so consumers can apply them atomically. All the events
+// get the TransactionID of their transaction, and the COMMIT events, which
+// have the GTID of the transaction, replace the POS events. It must be
+// called before Stream.
+func (evs *EventStreamer) SetTransactionMarkers() {
+	evs.transactionMarkers = true
+}
+
+// SetDMLSql makes the DML events carry their statement in Sql, like the
+// DDL events, for the consumers that need more than the primary keys.
+// It must be called before Stream.
+func (evs *EventStreamer) SetDMLSql() {
+	evs.dmlSql = true
+}
+
 func (evs *EventStreamer) Stream(gtid myproto.GTID, sendEvent sendEventFunc) error {
 	evs.sendEvent = sendEvent
 	return evs.bls.Stream(gtid, evs.transactionToEvent)
@@ -56,6 +100,21 @@ func (evs *EventStreamer) Stop() {
 func (evs *EventStreamer) transactionToEvent(trans *proto.BinlogTransaction) error {
 	var err error
 	var insertid int64
+	sendEvent := evs.sendEvent
+	if evs.transactionMarkers {
+		evs.transactionID++
+		sendEvent = func(event *proto.StreamEvent) error {
+			event.TransactionID = evs.transactionID
+			return evs.sendEvent(event)
+		}
+		beginEvent := &proto.StreamEvent{
+			Category:  "BEGIN",
+			Timestamp: trans.Timestamp,
+		}
+		if err = sendEvent(beginEvent); err != nil {
+			return err
+		}
+	}
 	for _, stmt := range trans.Statements {
 		switch stmt.Category {
 		case proto.BL_SET:
@@ -65,37 +124,50 @@ func (evs *EventStreamer) transactionToEvent(trans *proto.BinlogTransaction) err
 					binlogStreamerErrors.Add("EventStreamer", 1)
 					log.Errorf("%v: %s", err, stmt.Sql)
 				}
+			} else if bytes.HasPrefix(stmt.Sql, BINLOG_SET_CHARSET) {
+				evs.charset, err = parseCharsetClient(stmt.Sql)
+				if err != nil {
+					binlogStreamerErrors.Add("EventStreamer", 1)
+					log.Errorf("%v: %s", err, stmt.Sql)
+				}
 			}
 		case proto.BL_DML:
+			if evs.tables != nil {
+				if table, ok := streamCommentTable(stmt.Sql); ok && !evs.tables[table] {
+					continue
+				}
+			}
 			var dmlEvent *proto.StreamEvent
 			dmlEvent, insertid, err = evs.buildDMLEvent(stmt.Sql, insertid)
 			if err != nil {
 				log.Warningf("%v: %s", err, stmt.Sql)
 				dmlEvent = &proto.StreamEvent{
 					Category: "ERR",
-					Sql:      string(stmt.Sql),
+					Sql:      string(toUTF8(evs.charset, stmt.Sql)),
 				}
+			} else if evs.dmlSql {
+				dmlEvent.Sql = string(toUTF8(evs.charset, stmt.Sql))
 			}
 			dmlEvent.Timestamp = trans.Timestamp
-			if err = evs.sendEvent(dmlEvent); err != nil {
+			if err = sendEvent(dmlEvent); err != nil {
 				return err
 			}
 		case proto.BL_DDL:
 			ddlEvent := &proto.StreamEvent{
 				Category:  "DDL",
-				Sql:       string(stmt.Sql),
+				Sql:       string(toUTF8(evs.charset, stmt.Sql)),
 				Timestamp: trans.Timestamp,
 			}
-			if err = evs.sendEvent(ddlEvent); err != nil {
+			if err = sendEvent(ddlEvent); err != nil {
 				return err
 			}
 		case proto.BL_UNRECOGNIZED:
 			unrecognized := &proto.StreamEvent{
 				Category:  "ERR",
-				Sql:       string(stmt.Sql),
+				Sql:       string(toUTF8(evs.charset, stmt.Sql)),
 				Timestamp: trans.Timestamp,
 			}
-			if err = evs.sendEvent(unrecognized); err != nil {
+			if err = sendEvent(unrecognized); err != nil {
 				return err
 			}
 		default:
@@ -108,7 +180,10 @@ func (evs *EventStreamer) transactionToEvent(trans *proto.BinlogTransaction) err
 		GTIDField: trans.GTIDField,
 		Timestamp: trans.Timestamp,
 	}
-	if err = evs.sendEvent(posEvent); err != nil {
+	if evs.transactionMarkers {
+		posEvent.Category = "COMMIT"
+	}
+	if err = sendEvent(posEvent); err != nil {
 		return err
 	}
 	return nil
@@ -141,6 +216,12 @@ func (evs *EventStreamer) buildDMLEvent(sql []byte, insertid int64) (dmlEvent *p
 		if err != nil {
 			return nil, insertid, err
 		}
+		// String values are invalidation keys, so they must be UTF-8.
+		for i, v := range rowPk {
+			if b, ok := v.([]byte); ok {
+				rowPk[i] = toUTF8(evs.charset, b)
+			}
+		}
 		dmlEvent.PKValues = append(dmlEvent.PKValues, rowPk)
 	}
 	return dmlEvent, insertid, nil
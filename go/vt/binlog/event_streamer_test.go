@@ -108,19 +108,19 @@ func TestDMLEvent(t *testing.T) {
 		sendEvent: func(event *proto.StreamEvent) error {
 			switch event.Category {
 			case "DML":
-				want := `&{DML vtocc_e [eid id name] [[10 -1 [110 97 109 101]] [11 18446744073709551615 [110 97 109 101]]]  1 <nil>}`
+				want := `&{DML vtocc_e [eid id name] [[10 -1 [110 97 109 101]] [11 18446744073709551615 [110 97 109 101]]]  1 0 <nil>}`
 				got := fmt.Sprintf("%v", event)
 				if got != want {
 					t.Errorf("got \n%s, want \n%s", got, want)
 				}
 			case "ERR":
-				want := `&{ERR  [] [] query 1 <nil>}`
+				want := `&{ERR  [] [] query 1 0 <nil>}`
 				got := fmt.Sprintf("%v", event)
 				if got != want {
 					t.Errorf("got %s, want %s", got, want)
 				}
 			case "POS":
-				want := `&{POS  [] []  1 20}`
+				want := `&{POS  [] []  1 0 20}`
 				got := fmt.Sprintf("%v", event)
 				if got != want {
 					t.Errorf("got %s, want %s", got, want)
@@ -155,13 +155,13 @@ func TestDDLEvent(t *testing.T) {
 		sendEvent: func(event *proto.StreamEvent) error {
 			switch event.Category {
 			case "DDL":
-				want := `&{DDL  [] [] DDL 1 <nil>}`
+				want := `&{DDL  [] [] DDL 1 0 <nil>}`
 				got := fmt.Sprintf("%v", event)
 				if got != want {
 					t.Errorf("got %s, want %s", got, want)
 				}
 			case "POS":
-				want := `&{POS  [] []  1 20}`
+				want := `&{POS  [] []  1 0 20}`
 				got := fmt.Sprintf("%v", event)
 				if got != want {
 					t.Errorf("got %s, want %s", got, want)
@@ -177,3 +177,195 @@ func TestDDLEvent(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestEventTables(t *testing.T) {
+	var got []*proto.StreamEvent
+	evs := &EventStreamer{
+		sendEvent: func(event *proto.StreamEvent) error {
+			got = append(got, event)
+			return nil
+		},
+	}
+	evs.SetTables([]string{"vtocc_a"})
+	trans := &proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{
+				Category: proto.BL_DML,
+				Sql:      []byte("query /* _stream vtocc_e (eid id name ) (null 1 'bmFtZQ==' ); */"),
+			},
+			{
+				Category: proto.BL_DML,
+				Sql:      []byte("query /* _stream vtocc_a (eid id ) (1 1 ); */"),
+			},
+			{
+				Category: proto.BL_DDL,
+				Sql:      []byte("alter table vtocc_e"),
+			},
+		},
+		Timestamp: 1,
+	}
+	if err := evs.transactionToEvent(trans); err != nil {
+		t.Fatal(err)
+	}
+	want := []*proto.StreamEvent{
+		&proto.StreamEvent{
+			Category:   "DML",
+			TableName:  "vtocc_a",
+			PKColNames: []string{"eid", "id"},
+			PKValues:   [][]interface{}{[]interface{}{int64(1), int64(1)}},
+			Timestamp:  1,
+		},
+		&proto.StreamEvent{
+			Category:  "DDL",
+			Sql:       "alter table vtocc_e",
+			Timestamp: 1,
+		},
+		&proto.StreamEvent{
+			Category:  "POS",
+			Timestamp: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestEventTransactionMarkers(t *testing.T) {
+	var got []*proto.StreamEvent
+	evs := &EventStreamer{
+		sendEvent: func(event *proto.StreamEvent) error {
+			got = append(got, event)
+			return nil
+		},
+	}
+	evs.SetTransactionMarkers()
+	gtid := myproto.GTIDField{Value: myproto.MustParseGTID(blsMysqlFlavor, "20")}
+	transactions := []*proto.BinlogTransaction{
+		{
+			Statements: []proto.Statement{
+				{
+					Category: proto.BL_DML,
+					Sql:      []byte("query /* _stream vtocc_a (eid id ) (1 1 ); */"),
+				},
+				{
+					Category: proto.BL_DML,
+					Sql:      []byte("query /* _stream vtocc_a (eid id ) (2 1 ); */"),
+				},
+			},
+			Timestamp: 1,
+			GTIDField: gtid,
+		},
+		{
+			Timestamp: 2,
+		},
+	}
+	for _, trans := range transactions {
+		if err := evs.transactionToEvent(trans); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []*proto.StreamEvent{
+		&proto.StreamEvent{
+			Category:      "BEGIN",
+			Timestamp:     1,
+			TransactionID: 1,
+		},
+		&proto.StreamEvent{
+			Category:      "DML",
+			TableName:     "vtocc_a",
+			PKColNames:    []string{"eid", "id"},
+			PKValues:      [][]interface{}{[]interface{}{int64(1), int64(1)}},
+			Timestamp:     1,
+			TransactionID: 1,
+		},
+		&proto.StreamEvent{
+			Category:      "DML",
+			TableName:     "vtocc_a",
+			PKColNames:    []string{"eid", "id"},
+			PKValues:      [][]interface{}{[]interface{}{int64(2), int64(1)}},
+			Timestamp:     1,
+			TransactionID: 1,
+		},
+		&proto.StreamEvent{
+			Category:      "COMMIT",
+			Timestamp:     1,
+			TransactionID: 1,
+			GTIDField:     gtid,
+		},
+		&proto.StreamEvent{
+			Category:      "BEGIN",
+			Timestamp:     2,
+			TransactionID: 2,
+		},
+		&proto.StreamEvent{
+			Category:      "COMMIT",
+			Timestamp:     2,
+			TransactionID: 2,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestEventCharset(t *testing.T) {
+	var got []*proto.StreamEvent
+	evs := &EventStreamer{
+		sendEvent: func(event *proto.StreamEvent) error {
+			got = append(got, event)
+			return nil
+		},
+	}
+	trans := &proto.BinlogTransaction{
+		Statements: []proto.Statement{
+			{
+				Category: proto.BL_SET,
+				Sql:      []byte("SET @@session.character_set_client=8, @@session.collation_connection=8, @@session.collation_server=33"),
+			},
+			{
+				// 'é' in latin1
+				Category: proto.BL_DML,
+				Sql:      []byte("query /* _stream vtocc_e (name ) ('6Q==' ); */"),
+			},
+			{
+				Category: proto.BL_DDL,
+				Sql:      []byte("alter table vtocc_e comment '\x80'"),
+			},
+		},
+		Timestamp: 1,
+	}
+	if err := evs.transactionToEvent(trans); err != nil {
+		t.Fatal(err)
+	}
+	want := []*proto.StreamEvent{
+		&proto.StreamEvent{
+			Category:   "DML",
+			TableName:  "vtocc_e",
+			PKColNames: []string{"name"},
+			PKValues:   [][]interface{}{[]interface{}{[]byte("é")}},
+			Timestamp:  1,
+		},
+		&proto.StreamEvent{
+			Category:  "DDL",
+			Sql:       "alter table vtocc_e comment '€'",
+			Timestamp: 1,
+		},
+		&proto.StreamEvent{
+			Category:  "POS",
+			Timestamp: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+
+	// utf8 is kept as is.
+	trans.Statements[0].Sql = []byte("SET @@session.character_set_client=33, @@session.collation_connection=33, @@session.collation_server=33")
+	got = nil
+	if err := evs.transactionToEvent(trans); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xe9}; !reflect.DeepEqual(got[0].PKValues[0][0], want) {
+		t.Errorf("got: %#v, want: %#v", got[0].PKValues[0][0], want)
+	}
+}
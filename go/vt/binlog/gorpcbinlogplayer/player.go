@@ -37,18 +37,57 @@ func (client *GoRpcBinlogPlayerClient) Close() {
 	client.Client.Close()
 }
 
+// ServeUpdateStream uses the batched RPC if req.BatchSize is set.
 func (client *GoRpcBinlogPlayerClient) ServeUpdateStream(req *proto.UpdateStreamRequest, responseChan chan *proto.StreamEvent) binlogplayer.BinlogPlayerResponse {
-	resp := client.Client.StreamGo("UpdateStream.ServeUpdateStream", req, responseChan)
+	if req.BatchSize == 0 {
+		resp := client.Client.StreamGo("UpdateStream.ServeUpdateStream", req, responseChan)
+		return &GoRpcBinlogPlayerResponse{resp}
+	}
+	batchChan := make(chan *proto.StreamEventBatch)
+	resp := client.Client.StreamGo("UpdateStream.ServeUpdateStreamBatch", req, batchChan)
+	go func() {
+		for batch := range batchChan {
+			for _, event := range batch.Events {
+				responseChan <- event
+			}
+		}
+		close(responseChan)
+	}()
 	return &GoRpcBinlogPlayerResponse{resp}
 }
 
+// StreamKeyRange uses the batched RPC if req.BatchSize is set.
 func (client *GoRpcBinlogPlayerClient) StreamKeyRange(req *proto.KeyRangeRequest, responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
-	resp := client.Client.StreamGo("UpdateStream.StreamKeyRange", req, responseChan)
-	return &GoRpcBinlogPlayerResponse{resp}
+	if req.BatchSize == 0 {
+		resp := client.Client.StreamGo("UpdateStream.StreamKeyRange", req, responseChan)
+		return &GoRpcBinlogPlayerResponse{resp}
+	}
+	return client.streamTransactionBatches("UpdateStream.StreamKeyRangeBatch", req, responseChan)
 }
 
+// StreamTables uses the batched RPC if req.BatchSize is set.
 func (client *GoRpcBinlogPlayerClient) StreamTables(req *proto.TablesRequest, responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
-	resp := client.Client.StreamGo("UpdateStream.StreamTables", req, responseChan)
+	if req.BatchSize == 0 {
+		resp := client.Client.StreamGo("UpdateStream.StreamTables", req, responseChan)
+		return &GoRpcBinlogPlayerResponse{resp}
+	}
+	return client.streamTransactionBatches("UpdateStream.StreamTablesBatch", req, responseChan)
+}
+
+// streamTransactionBatches calls a batched RPC, and sends the
+// transactions of its batches to responseChan, which is closed at the
+// end of the stream like the channel of a non-batched RPC.
+func (client *GoRpcBinlogPlayerClient) streamTransactionBatches(method string, req interface{}, responseChan chan *proto.BinlogTransaction) binlogplayer.BinlogPlayerResponse {
+	batchChan := make(chan *proto.BinlogTransactionBatch)
+	resp := client.Client.StreamGo(method, req, batchChan)
+	go func() {
+		for batch := range batchChan {
+			for _, trans := range batch.Transactions {
+				responseChan <- trans
+			}
+		}
+		close(responseChan)
+	}()
 	return &GoRpcBinlogPlayerResponse{resp}
 }
 
@@ -32,6 +32,24 @@ func (server *UpdateStream) StreamTables(req *proto.TablesRequest, sendReply fun
 	})
 }
 
+func (server *UpdateStream) ServeUpdateStreamBatch(req *proto.UpdateStreamRequest, sendReply func(reply interface{}) error) (err error) {
+	return server.updateStream.ServeUpdateStreamBatch(req, func(reply *proto.StreamEventBatch) error {
+		return sendReply(reply)
+	})
+}
+
+func (server *UpdateStream) StreamKeyRangeBatch(req *proto.KeyRangeRequest, sendReply func(reply interface{}) error) (err error) {
+	return server.updateStream.StreamKeyRangeBatch(req, func(reply *proto.BinlogTransactionBatch) error {
+		return sendReply(reply)
+	})
+}
+
+func (server *UpdateStream) StreamTablesBatch(req *proto.TablesRequest, sendReply func(reply interface{}) error) (err error) {
+	return server.updateStream.StreamTablesBatch(req, func(reply *proto.BinlogTransactionBatch) error {
+		return sendReply(reply)
+	})
+}
+
 // registration mechanism
 
 func init() {
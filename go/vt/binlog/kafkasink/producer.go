@@ -0,0 +1,208 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kafkasink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Producer produces messages to a Kafka cluster. It finds the leaders of
+// the partitions with the metadata of the brokers, and waits for all the
+// in-sync replicas to have the messages. It's not safe for concurrent use.
+type Producer struct {
+	bootstrap []string
+	clientID  string
+	timeout   time.Duration
+
+	correlationID int32
+	// brokers has the addresses of the brokers, by node id.
+	brokers map[int32]string
+	conns   map[string]net.Conn
+	leaders map[topicPartition]int32
+}
+
+// NewProducer creates a Producer for the cluster of the bootstrap brokers
+// ("host:port"). timeout is the timeout of each request.
+func NewProducer(bootstrap []string, clientID string, timeout time.Duration) *Producer {
+	return &Producer{
+		bootstrap: bootstrap,
+		clientID:  clientID,
+		timeout:   timeout,
+		brokers:   make(map[int32]string),
+		conns:     make(map[string]net.Conn),
+		leaders:   make(map[topicPartition]int32),
+	}
+}
+
+// Produce produces messages, and returns once they're committed. The order
+// of the messages of each partition is kept. If it fails, some messages
+// may have been committed nonetheless.
+func (p *Producer) Produce(messages []*Message) error {
+	var leaders []int32
+	byLeader := make(map[int32][]*Message)
+	for _, m := range messages {
+		leader, err := p.leader(topicPartition{m.Topic, m.Partition})
+		if err != nil {
+			return err
+		}
+		if _, ok := byLeader[leader]; !ok {
+			leaders = append(leaders, leader)
+		}
+		byLeader[leader] = append(byLeader[leader], m)
+	}
+	for _, leader := range leaders {
+		if err := p.produce(leader, byLeader[leader]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to the brokers.
+func (p *Producer) Close() {
+	for addr, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, addr)
+	}
+}
+
+// produce sends the messages to the broker that leads their partitions.
+func (p *Producer) produce(leader int32, messages []*Message) error {
+	addr := p.brokers[leader]
+	p.correlationID++
+	req := encodeProduceRequest(p.correlationID, p.clientID, -1, int32(p.timeout/time.Millisecond), messages)
+	body, err := p.roundTrip(addr, req, p.correlationID)
+	if err != nil {
+		p.forgetLeader(leader)
+		return fmt.Errorf("can't produce to kafka broker %v: %v", addr, err)
+	}
+	errs, err := decodeProduceResponse(body)
+	if err != nil {
+		return fmt.Errorf("can't decode produce response of kafka broker %v: %v", addr, err)
+	}
+	if len(errs) > 0 {
+		// The leaders may have moved: look them up again next time.
+		p.forgetLeader(leader)
+		return fmt.Errorf("kafka broker %v failed to produce to %v/%v: error code %v", addr, errs[0].Topic, errs[0].Partition, errs[0].Err)
+	}
+	return nil
+}
+
+// leader returns the node id of the leader of a partition.
+func (p *Producer) leader(tp topicPartition) (int32, error) {
+	if leader, ok := p.leaders[tp]; ok {
+		return leader, nil
+	}
+	if err := p.refreshMetadata(tp.Topic); err != nil {
+		return 0, err
+	}
+	leader, ok := p.leaders[tp]
+	if !ok {
+		return 0, fmt.Errorf("no kafka leader for %v/%v", tp.Topic, tp.Partition)
+	}
+	return leader, nil
+}
+
+// forgetLeader forgets the partitions of a leader, and closes its connection.
+func (p *Producer) forgetLeader(leader int32) {
+	for tp, l := range p.leaders {
+		if l == leader {
+			delete(p.leaders, tp)
+		}
+	}
+	if conn, ok := p.conns[p.brokers[leader]]; ok {
+		conn.Close()
+		delete(p.conns, p.brokers[leader])
+	}
+}
+
+// refreshMetadata gets the brokers and the leaders of the partitions
+// of topic, from the first broker that answers.
+func (p *Producer) refreshMetadata(topic string) error {
+	addrs := append([]string(nil), p.bootstrap...)
+	for _, addr := range p.brokers {
+		addrs = append(addrs, addr)
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		p.correlationID++
+		body, err := p.roundTrip(addr, encodeMetadataRequest(p.correlationID, p.clientID, []string{topic}), p.correlationID)
+		if err != nil {
+			log.Warningf("can't get kafka metadata from %v: %v", addr, err)
+			lastErr = err
+			continue
+		}
+		resp, err := decodeMetadataResponse(body)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, b := range resp.Brokers {
+			p.brokers[b.NodeID] = net.JoinHostPort(b.Host, fmt.Sprint(b.Port))
+		}
+		for _, tm := range resp.Topics {
+			if tm.Err != errNone {
+				// Topics being created report LEADER_NOT_AVAILABLE.
+				return fmt.Errorf("kafka metadata error for topic %v: error code %v", tm.Topic, tm.Err)
+			}
+			for _, pm := range tm.Partitions {
+				if pm.Err == errNone && pm.Leader >= 0 {
+					p.leaders[topicPartition{tm.Topic, pm.Partition}] = pm.Leader
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("can't get kafka metadata for topic %v: %v", topic, lastErr)
+}
+
+// roundTrip sends a request to a broker, and returns the body of its
+// response. The connection is closed if it fails.
+func (p *Producer) roundTrip(addr string, req []byte, correlationID int32) ([]byte, error) {
+	conn, ok := p.conns[addr]
+	if !ok {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, p.timeout)
+		if err != nil {
+			return nil, err
+		}
+		p.conns[addr] = conn
+	}
+	body, err := roundTrip(conn, req, correlationID, p.timeout)
+	if err != nil {
+		conn.Close()
+		delete(p.conns, addr)
+	}
+	return body, err
+}
+
+func roundTrip(conn net.Conn, req []byte, correlationID int32, timeout time.Duration) ([]byte, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(header[:4]))
+	if got := int32(binary.BigEndian.Uint32(header[4:])); got != correlationID {
+		return nil, fmt.Errorf("unexpected correlation id: got %v, want %v", got, correlationID)
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("invalid response size: %v", size)
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
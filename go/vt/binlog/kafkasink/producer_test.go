@@ -0,0 +1,223 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kafkasink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+// fakeBroker is a single Kafka broker, the leader of all the partitions.
+type fakeBroker struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu sync.Mutex
+	// messages are the messages produced.
+	messages []*Message
+	// produceErr is the error code of the next produce request.
+	produceErr int16
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	fb := &fakeBroker{t: t, listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fb.serve(conn)
+		}
+	}()
+	return fb
+}
+
+func (fb *fakeBroker) addr() string {
+	return fb.listener.Addr().String()
+}
+
+func (fb *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &decoder{buf: req}
+		apiKey := d.int16()
+		d.int16() // api version
+		correlationID := d.int32()
+		d.string() // client id
+
+		e := &encoder{}
+		e.reserveInt32()
+		e.putInt32(correlationID)
+		switch apiKey {
+		case metadataKey:
+			fb.metadata(d, e)
+		case produceKey:
+			fb.produce(d, e)
+		default:
+			fb.t.Errorf("unexpected api key %v", apiKey)
+			return
+		}
+		if d.err != nil {
+			fb.t.Errorf("can't decode request: %v", d.err)
+			return
+		}
+		e.setInt32(0, int32(len(e.buf)-4))
+		if _, err := conn.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (fb *fakeBroker) metadata(d *decoder, e *encoder) {
+	host, port, _ := net.SplitHostPort(fb.addr())
+	portNum, _ := strconv.Atoi(port)
+	e.putInt32(1)
+	e.putInt32(1) // node id
+	e.putString(host)
+	e.putInt32(int32(portNum))
+
+	n := d.arrayLen()
+	e.putInt32(int32(n))
+	for i := 0; i < n; i++ {
+		e.putInt16(errNone)
+		e.putString(d.string())
+		e.putInt32(1)
+		e.putInt16(errNone)
+		e.putInt32(0) // partition
+		e.putInt32(1) // leader
+		e.putInt32(1) // replicas
+		e.putInt32(1)
+		e.putInt32(1) // isr
+		e.putInt32(1)
+	}
+}
+
+func (fb *fakeBroker) produce(d *decoder, e *encoder) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if acks := d.int16(); acks != -1 {
+		fb.t.Errorf("acks = %v, want -1", acks)
+	}
+	d.int32() // timeout
+	n := d.arrayLen()
+	e.putInt32(int32(n))
+	for i := 0; i < n; i++ {
+		topic := d.string()
+		e.putString(topic)
+		m := d.arrayLen()
+		e.putInt32(int32(m))
+		for j := 0; j < m; j++ {
+			partition := d.int32()
+			set := &decoder{buf: d.next(int(d.int32()))}
+			for len(set.buf) > 0 && set.err == nil {
+				set.int64() // offset
+				msg := &decoder{buf: set.next(int(set.int32()))}
+				crc := uint32(msg.int32())
+				if crc != crc32.ChecksumIEEE(msg.buf) {
+					fb.t.Errorf("invalid message crc")
+				}
+				msg.int8() // magic
+				msg.int8() // attributes
+				fb.messages = append(fb.messages, &Message{
+					Topic:     topic,
+					Partition: partition,
+					Key:       msg.bytes(),
+					Value:     msg.bytes(),
+				})
+			}
+			e.putInt32(partition)
+			e.putInt16(fb.produceErr)
+			e.putInt64(int64(len(fb.messages)))
+		}
+	}
+	fb.produceErr = errNone
+}
+
+func TestProducer(t *testing.T) {
+	fb := newFakeBroker(t)
+	defer fb.listener.Close()
+	p := NewProducer([]string{fb.addr()}, "test", 5*time.Second)
+	defer p.Close()
+
+	messages := []*Message{
+		{Topic: "a", Value: []byte("1")},
+		{Topic: "b", Key: []byte("k"), Value: []byte("2")},
+		{Topic: "a", Value: []byte("3")},
+	}
+	if err := p.Produce(messages); err != nil {
+		t.Fatalf("Produce(): %v", err)
+	}
+	want := []*Message{messages[0], messages[2], messages[1]}
+	if !reflect.DeepEqual(fb.messages, want) {
+		t.Errorf("produced %v, want %v", fb.messages, want)
+	}
+
+	// The errors of the broker fail the production.
+	fb.mu.Lock()
+	fb.produceErr = 6
+	fb.mu.Unlock()
+	if err := p.Produce(messages[:1]); err == nil {
+		t.Errorf("Produce() didn't fail with the broker")
+	}
+	if err := p.Produce(messages[:1]); err != nil {
+		t.Errorf("Produce() after a failure: %v", err)
+	}
+}
+
+func TestSink(t *testing.T) {
+	fb := newFakeBroker(t)
+	defer fb.listener.Close()
+	p := NewProducer([]string{fb.addr()}, "test", 5*time.Second)
+	defer p.Close()
+
+	sink := NewSink(p, TopicPerTable("vt.", ""))
+	events := []*proto.StreamEvent{
+		{Category: "DML", TableName: "vtocc_a", PKColNames: []string{"eid"}, PKValues: [][]interface{}{{int64(1)}}, Sql: "insert into vtocc_a"},
+		{Category: "POS"},
+	}
+	for _, event := range events {
+		if err := sink.Send(event); err != nil {
+			t.Fatalf("Send(): %v", err)
+		}
+	}
+	if len(fb.messages) != 0 {
+		t.Errorf("messages produced before Flush: %v", fb.messages)
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush(): %v", err)
+	}
+	// The POS event has no table, and there's no default topic.
+	want := []*Message{{
+		Topic: "vt.vtocc_a",
+		Key:   []byte(`{"table":"vtocc_a","pk":[{"eid":1}]}`),
+		Value: []byte(`{"operation":"INSERT","table":"vtocc_a","pk":[{"eid":1}],"timestamp":0}`),
+	}}
+	if !reflect.DeepEqual(fb.messages, want) {
+		t.Errorf("produced %v, want %v", fmt.Sprint(fb.messages), fmt.Sprint(want))
+	}
+}
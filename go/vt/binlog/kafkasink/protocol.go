@@ -0,0 +1,319 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kafkasink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// This file has the encoding of the parts of the Kafka 0.8 protocol
+// (version 0 of the APIs) used by the producer: the Metadata and
+// Produce requests and responses.
+
+// API keys of the requests.
+const (
+	produceKey  = 0
+	metadataKey = 3
+)
+
+// errNone is the error code of the successes.
+const errNone = 0
+
+// encoder builds the big-endian encoding of requests.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) putInt8(i int8) {
+	e.buf = append(e.buf, byte(i))
+}
+
+func (e *encoder) putInt16(i int16) {
+	e.buf = append(e.buf, byte(i>>8), byte(i))
+}
+
+func (e *encoder) putInt32(i int32) {
+	e.buf = append(e.buf, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+}
+
+func (e *encoder) putInt64(i int64) {
+	e.putInt32(int32(i >> 32))
+	e.putInt32(int32(i))
+}
+
+func (e *encoder) putString(s string) {
+	e.putInt16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// putBytes encodes b, with a length of -1 if it's nil.
+func (e *encoder) putBytes(b []byte) {
+	if b == nil {
+		e.putInt32(-1)
+		return
+	}
+	e.putInt32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// reserveInt32 reserves an int32, to be set later by setInt32.
+func (e *encoder) reserveInt32() int {
+	e.putInt32(0)
+	return len(e.buf) - 4
+}
+
+func (e *encoder) setInt32(offset int, i int32) {
+	binary.BigEndian.PutUint32(e.buf[offset:], uint32(i))
+}
+
+// decoder reads the big-endian encoding of responses. The first error
+// is kept, and the reads that follow it return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = fmt.Errorf("kafka response is too short")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n == -1 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// arrayLen reads the length of an array.
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if n < 0 || n > len(d.buf) {
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid kafka array length: %v", n)
+		}
+		return 0
+	}
+	return n
+}
+
+// requestHeader starts the encoding of a request. Its size is set
+// by finishRequest.
+func requestHeader(apiKey int16, correlationID int32, clientID string) *encoder {
+	e := &encoder{}
+	e.reserveInt32()
+	e.putInt16(apiKey)
+	e.putInt16(0) // api version
+	e.putInt32(correlationID)
+	e.putString(clientID)
+	return e
+}
+
+func finishRequest(e *encoder) []byte {
+	e.setInt32(0, int32(len(e.buf)-4))
+	return e.buf
+}
+
+// broker is a broker of a metadata response.
+type broker struct {
+	NodeID int32
+	Host   string
+	Port   int32
+}
+
+// partitionMetadata is the metadata of a partition.
+type partitionMetadata struct {
+	Err       int16
+	Partition int32
+	Leader    int32
+}
+
+// topicMetadata is the metadata of a topic.
+type topicMetadata struct {
+	Err        int16
+	Topic      string
+	Partitions []partitionMetadata
+}
+
+// metadataResponse is the decoded response of a Metadata request.
+type metadataResponse struct {
+	Brokers []broker
+	Topics  []topicMetadata
+}
+
+func encodeMetadataRequest(correlationID int32, clientID string, topics []string) []byte {
+	e := requestHeader(metadataKey, correlationID, clientID)
+	e.putInt32(int32(len(topics)))
+	for _, topic := range topics {
+		e.putString(topic)
+	}
+	return finishRequest(e)
+}
+
+// decodeMetadataResponse decodes the body of a metadata response,
+// after its correlation id.
+func decodeMetadataResponse(body []byte) (*metadataResponse, error) {
+	d := &decoder{buf: body}
+	resp := &metadataResponse{}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		resp.Brokers = append(resp.Brokers, broker{
+			NodeID: d.int32(),
+			Host:   d.string(),
+			Port:   d.int32(),
+		})
+	}
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		tm := topicMetadata{Err: d.int16(), Topic: d.string()}
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			pm := partitionMetadata{
+				Err:       d.int16(),
+				Partition: d.int32(),
+				Leader:    d.int32(),
+			}
+			// replicas and isr
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32()
+			}
+			for k, l := 0, d.arrayLen(); k < l; k++ {
+				d.int32()
+			}
+			tm.Partitions = append(tm.Partitions, pm)
+		}
+		resp.Topics = append(resp.Topics, tm)
+	}
+	return resp, d.err
+}
+
+// Message is a message to produce.
+type Message struct {
+	Topic     string
+	Partition int32
+	Key       []byte
+	Value     []byte
+}
+
+// topicPartition identifies a partition.
+type topicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// encodeProduceRequest encodes the messages of a Produce request, grouped
+// by partition. The order of the messages of each partition is kept.
+func encodeProduceRequest(correlationID int32, clientID string, acks int16, timeoutMs int32, messages []*Message) []byte {
+	e := requestHeader(produceKey, correlationID, clientID)
+	e.putInt16(acks)
+	e.putInt32(timeoutMs)
+
+	var topics []string
+	partitions := make(map[string][]int32)
+	sets := make(map[topicPartition][]*Message)
+	for _, m := range messages {
+		tp := topicPartition{m.Topic, m.Partition}
+		if _, ok := partitions[m.Topic]; !ok {
+			topics = append(topics, m.Topic)
+		}
+		if _, ok := sets[tp]; !ok {
+			partitions[m.Topic] = append(partitions[m.Topic], m.Partition)
+		}
+		sets[tp] = append(sets[tp], m)
+	}
+
+	e.putInt32(int32(len(topics)))
+	for _, topic := range topics {
+		e.putString(topic)
+		e.putInt32(int32(len(partitions[topic])))
+		for _, partition := range partitions[topic] {
+			e.putInt32(partition)
+			setSize := e.reserveInt32()
+			for _, m := range sets[topicPartition{topic, partition}] {
+				encodeMessage(e, m)
+			}
+			e.setInt32(setSize, int32(len(e.buf)-setSize-4))
+		}
+	}
+	return finishRequest(e)
+}
+
+// encodeMessage encodes a message of a message set.
+func encodeMessage(e *encoder, m *Message) {
+	e.putInt64(0) // offset, set by the broker
+	size := e.reserveInt32()
+	crc := e.reserveInt32()
+	e.putInt8(0) // magic
+	e.putInt8(0) // attributes: no compression
+	e.putBytes(m.Key)
+	e.putBytes(m.Value)
+	e.setInt32(size, int32(len(e.buf)-size-4))
+	e.setInt32(crc, int32(crc32.ChecksumIEEE(e.buf[crc+4:])))
+}
+
+// produceError is the error of a partition in a produce response.
+type produceError struct {
+	topicPartition
+	Err int16
+}
+
+// decodeProduceResponse decodes the body of a produce response, after
+// its correlation id, and returns the errors of the partitions.
+func decodeProduceResponse(body []byte) ([]produceError, error) {
+	d := &decoder{buf: body}
+	var errs []produceError
+	for i, n := 0, d.arrayLen(); i < n; i++ {
+		topic := d.string()
+		for j, m := 0, d.arrayLen(); j < m; j++ {
+			partition := d.int32()
+			code := d.int16()
+			d.int64() // offset
+			if code != errNone {
+				errs = append(errs, produceError{topicPartition{topic, partition}, code})
+			}
+		}
+	}
+	return errs, d.err
+}
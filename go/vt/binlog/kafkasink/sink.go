@@ -0,0 +1,100 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package kafkasink delivers the events of the update stream to Kafka.
+//
+// The events are produced as JSON binlog.ChangeEvents, to topics chosen
+// by a Router. Run with binlog.RunSink, the delivery is at-least-once:
+// the events of each transaction are committed to Kafka before its
+// position is checkpointed.
+package kafkasink
+
+import (
+	"encoding/json"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/binlog"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+var producedMessages = stats.NewCounters("KafkaSinkMessages")
+
+// Router returns the topic of an event, or "" to skip it.
+type Router func(event *binlog.ChangeEvent) string
+
+// SingleTopic routes all the events to topic.
+func SingleTopic(topic string) Router {
+	return func(event *binlog.ChangeEvent) string {
+		return topic
+	}
+}
+
+// TopicPerTable routes the DML events to a topic per table, named after
+// the table with prefix. The other events, which have no table, go to
+// defaultTopic, or are skipped if it's "".
+func TopicPerTable(prefix, defaultTopic string) Router {
+	return func(event *binlog.ChangeEvent) string {
+		if event.Table == "" {
+			return defaultTopic
+		}
+		return prefix + event.Table
+	}
+}
+
+// Sink is a binlog.EventSink that produces the events to Kafka.
+// The messages of all the topics go to their partition 0, so the
+// consumers of a topic see its events in order.
+type Sink struct {
+	producer *Producer
+	route    Router
+	pending  []*Message
+}
+
+// NewSink creates a Sink producing with producer, to the topics of route.
+func NewSink(producer *Producer, route Router) *Sink {
+	return &Sink{producer: producer, route: route}
+}
+
+// sinkKey is the key of the messages of DML events, so that the
+// topics can be compacted by row.
+type sinkKey struct {
+	Table string                   `json:"table"`
+	PK    []map[string]interface{} `json:"pk"`
+}
+
+// Send implements binlog.EventSink.Send(). The event is produced
+// at the next Flush.
+func (s *Sink) Send(event *proto.StreamEvent) error {
+	ce := binlog.NewChangeEvent(event)
+	topic := s.route(ce)
+	if topic == "" {
+		return nil
+	}
+	value, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+	var key []byte
+	if ce.Table != "" {
+		if key, err = json.Marshal(sinkKey{Table: ce.Table, PK: ce.PK}); err != nil {
+			return err
+		}
+	}
+	s.pending = append(s.pending, &Message{Topic: topic, Key: key, Value: value})
+	return nil
+}
+
+// Flush implements binlog.EventSink.Flush(). The events are dropped if
+// they can't be produced: the stream has to restart from its checkpoint.
+func (s *Sink) Flush() error {
+	pending := s.pending
+	s.pending = nil
+	if err := s.producer.Produce(pending); err != nil {
+		return err
+	}
+	for _, m := range pending {
+		producedMessages.Add(m.Topic, 1)
+	}
+	return nil
+}
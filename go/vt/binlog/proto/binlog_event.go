@@ -5,6 +5,7 @@
 package proto
 
 import (
+	"github.com/youtube/vitess/go/sqltypes"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
@@ -43,6 +44,14 @@ type BinlogEvent interface {
 	IsIntVar() bool
 	// IsRand returns true if this is a RAND_EVENT.
 	IsRand() bool
+	// IsTableMap returns true if this is a TABLE_MAP_EVENT.
+	IsTableMap() bool
+	// IsWriteRows returns true if this is a WRITE_ROWS_EVENT (v1 or v2).
+	IsWriteRows() bool
+	// IsUpdateRows returns true if this is an UPDATE_ROWS_EVENT (v1 or v2).
+	IsUpdateRows() bool
+	// IsDeleteRows returns true if this is a DELETE_ROWS_EVENT (v1 or v2).
+	IsDeleteRows() bool
 	// HasGTID returns true if this event contains a GTID. That could either be
 	// because it's a GTID_EVENT (MariaDB, MySQL 5.6), or because it is some
 	// arbitrary event type that has a GTID in the header (Google MySQL).
@@ -54,19 +63,36 @@ type BinlogEvent interface {
 	// Format returns a BinlogFormat struct based on the event data.
 	// This is only valid if IsFormatDescription() returns true.
 	Format() (BinlogFormat, error)
+	// StripChecksum verifies the checksum of the event, if the binlogs have
+	// them, and returns the event without it, along with the checksum.
+	// The other methods must only be called on the stripped event, since
+	// they don't expect a checksum at the end of the data.
+	StripChecksum(BinlogFormat) (ev BinlogEvent, checksum []byte, err error)
 	// GTID returns the GTID from the event.
 	// This is only valid if HasGTID() returns true.
 	GTID(BinlogFormat) (myproto.GTID, error)
-	// Query returns the database name (or "" if none) and SQL statement for a
-	// QUERY_EVENT.
+	// Query returns the database name (or "" if none), character set and SQL
+	// statement for a QUERY_EVENT.
 	// This is only valid if IsQuery() returns true.
-	Query(BinlogFormat) (db string, query []byte, err error)
+	Query(BinlogFormat) (Query, error)
 	// IntVar returns the name and value of the variable for an INTVAR_EVENT.
 	// This is only valid if IsIntVar() returns true.
 	IntVar(BinlogFormat) (string, uint64, error)
 	// Rand returns the two seed values for a RAND_EVENT.
 	// This is only valid if IsRand() returns true.
 	Rand(BinlogFormat) (uint64, uint64, error)
+	// TableID returns the table ID of a TABLE_MAP_EVENT or a rows event.
+	// This is only valid if IsTableMap() or one of the IsXxxRows() methods
+	// returns true.
+	TableID(BinlogFormat) uint64
+	// TableMap returns the table description of a TABLE_MAP_EVENT.
+	// This is only valid if IsTableMap() returns true.
+	TableMap(BinlogFormat) (*TableMap, error)
+	// Rows returns the row images of a WRITE_ROWS_EVENT, UPDATE_ROWS_EVENT
+	// or DELETE_ROWS_EVENT. The TableMap must be the one that was sent
+	// for the same TableID.
+	// This is only valid if one of the IsXxxRows() methods returns true.
+	Rows(BinlogFormat, *TableMap) (Rows, error)
 }
 
 // BinlogFormat contains relevant data from the FORMAT_DESCRIPTION_EVENT.
@@ -79,9 +105,75 @@ type BinlogFormat struct {
 	ServerVersion string
 	// HeaderLength is the size in bytes of event headers other than FORMAT_DESCRIPTION_EVENT.
 	HeaderLength byte
+	// ChecksumAlgorithm is the binlog_checksum of the server that wrote the
+	// events. It's BinlogChecksumAlgOff for servers that predate checksums.
+	ChecksumAlgorithm byte
 }
 
+// The checksum algorithms of the binlog events (binlog_checksum).
+const (
+	// BinlogChecksumAlgOff means the events have no checksum.
+	BinlogChecksumAlgOff = 0
+	// BinlogChecksumAlgCRC32 means the events end with their CRC32.
+	BinlogChecksumAlgCRC32 = 1
+	// BinlogChecksumAlgUndef means the algorithm is unknown, which the
+	// server only writes for events that have no checksum.
+	BinlogChecksumAlgUndef = 255
+)
+
 // IsZero returns true if the BinlogFormat has not been initialized.
 func (f BinlogFormat) IsZero() bool {
 	return f.FormatVersion == 0 && f.HeaderLength == 0
 }
+
+// Query contains the data of a QUERY_EVENT.
+type Query struct {
+	Database string
+	// Charset is nil if the event doesn't say which character set
+	// the statement was written in.
+	Charset *Charset
+	SQL     []byte
+}
+
+// Charset is the character set of the session that wrote a statement,
+// as the collation IDs of its character set variables.
+type Charset struct {
+	// Client is @@session.character_set_client.
+	Client int
+	// Conn is @@session.collation_connection.
+	Conn int
+	// Server is @@session.collation_server.
+	Server int
+}
+
+// TableMap describes a table, as sent in a TABLE_MAP_EVENT before the
+// rows events that affect it.
+type TableMap struct {
+	Database string
+	Name     string
+	// Types contains the MySQL type of each column (MYSQL_TYPE_xxx).
+	Types []byte
+	// Metadata contains the type-specific metadata of each column
+	// (max length, precision, ...). Its meaning depends on the type.
+	Metadata []uint16
+}
+
+// Rows contains the rows of a WRITE_ROWS_EVENT, UPDATE_ROWS_EVENT or
+// DELETE_ROWS_EVENT.
+type Rows struct {
+	// IdentifyColumns is set for UPDATE and DELETE. It tells which
+	// columns are present in the Identify images.
+	IdentifyColumns []bool
+	// DataColumns is set for WRITE and UPDATE. It tells which
+	// columns are present in the Data images.
+	DataColumns []bool
+	Rows        []Row
+}
+
+// Row is one row of a rows event. Identify is the before image, and
+// Data is the after image. Both have one value per column of the table,
+// but only the columns marked as present are meaningful.
+type Row struct {
+	Identify []sqltypes.Value
+	Data     []sqltypes.Value
+}
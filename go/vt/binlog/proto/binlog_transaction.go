@@ -53,3 +53,9 @@ func (s Statement) String() string {
 	}
 	return fmt.Sprintf("{%v: %#v}", s.Category, string(s.Sql))
 }
+
+// BinlogTransactionBatch is a batch of BinlogTransactions, sent in a
+// single reply when the client requests batches.
+type BinlogTransactionBatch struct {
+	Transactions []*BinlogTransaction
+}
@@ -82,6 +82,59 @@ func TestBinlogTransaction(t *testing.T) {
 	}
 }
 
+type reflectBinlogTransactionBatch struct {
+	Transactions []*reflectBinlogTransaction
+}
+
+func TestBinlogTransactionBatch(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectBinlogTransactionBatch{
+		Transactions: []*reflectBinlogTransaction{
+			{
+				Statements: []reflectStatement{{Category: 1, Sql: []byte("sql")}},
+				Timestamp:  456,
+			},
+			{
+				Statements: []reflectStatement{{Category: 2, Sql: []byte("commit")}},
+				Timestamp:  789,
+			},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := BinlogTransactionBatch{
+		Transactions: []*BinlogTransaction{
+			{
+				Statements: []Statement{{Category: 1, Sql: []byte("sql")}},
+				Timestamp:  456,
+			},
+			{
+				Statements: []Statement{{Category: 2, Sql: []byte("commit")}},
+				Timestamp:  789,
+			},
+		},
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	var unmarshalled BinlogTransactionBatch
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(custom, unmarshalled) {
+		t.Errorf("%#v != %#v", custom, unmarshalled)
+	}
+}
+
 func TestStatementString(t *testing.T) {
 	table := map[string]Statement{
 		`{BL_UNRECOGNIZED: "SQL"}`: Statement{Category: BL_UNRECOGNIZED, Sql: []byte("SQL")},
@@ -10,7 +10,8 @@ import (
 
 // StreamEvent represents one event for the update stream.
 type StreamEvent struct {
-	// Category can be "DML", "DDL", "ERR" or "POS"
+	// Category can be "DML", "DDL", "ERR" or "POS", or "BEGIN" and
+	// "COMMIT" when the transaction markers are requested.
 	Category string
 
 	// DML
@@ -18,12 +19,23 @@ type StreamEvent struct {
 	PKColNames []string
 	PKValues   [][]interface{}
 
-	// DDL or ERR
+	// DDL or ERR, and DML when their statements are requested
 	Sql string
 
 	// Timestamp is set for DML, DDL or ERR
 	Timestamp int64
 
-	// POS
+	// TransactionID is set for all the events when the transaction
+	// markers are requested. It's the sequence number of their
+	// transaction in the stream, starting at 1.
+	TransactionID int64
+
+	// POS or COMMIT
 	GTIDField myproto.GTIDField
 }
+
+// StreamEventBatch is a batch of StreamEvents, sent in a single reply
+// when the client requests batches.
+type StreamEventBatch struct {
+	Events []*StreamEvent
+}
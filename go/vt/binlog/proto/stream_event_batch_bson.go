@@ -0,0 +1,77 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes StreamEventBatch.
+func (streamEventBatch *StreamEventBatch) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	// []*StreamEvent
+	{
+		bson.EncodePrefix(buf, bson.Array, "Events")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v1 := range streamEventBatch.Events {
+			// *StreamEvent
+			if _v1 == nil {
+				bson.EncodePrefix(buf, bson.Null, bson.Itoa(_i))
+			} else {
+				(*_v1).MarshalBson(buf, bson.Itoa(_i))
+			}
+		}
+		lenWriter.Close()
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into StreamEventBatch.
+func (streamEventBatch *StreamEventBatch) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for StreamEventBatch", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Events":
+			// []*StreamEvent
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for streamEventBatch.Events", kind))
+				}
+				bson.Next(buf, 4)
+				streamEventBatch.Events = make([]*StreamEvent, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v1 *StreamEvent
+					// *StreamEvent
+					if kind != bson.Null {
+						_v1 = new(StreamEvent)
+						(*_v1).UnmarshalBson(buf, kind)
+					}
+					streamEventBatch.Events = append(streamEventBatch.Events, _v1)
+				}
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
@@ -49,6 +49,7 @@ func (streamEvent *StreamEvent) MarshalBson(buf *bytes2.ChunkedWriter, key strin
 	}
 	bson.EncodeString(buf, "Sql", streamEvent.Sql)
 	bson.EncodeInt64(buf, "Timestamp", streamEvent.Timestamp)
+	bson.EncodeInt64(buf, "TransactionID", streamEvent.TransactionID)
 	streamEvent.GTIDField.MarshalBson(buf, "GTIDField")
 
 	lenWriter.Close()
@@ -119,6 +120,8 @@ func (streamEvent *StreamEvent) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			streamEvent.Sql = bson.DecodeString(buf, kind)
 		case "Timestamp":
 			streamEvent.Timestamp = bson.DecodeInt64(buf, kind)
+		case "TransactionID":
+			streamEvent.TransactionID = bson.DecodeInt64(buf, kind)
 		case "GTIDField":
 			streamEvent.GTIDField.UnmarshalBson(buf, kind)
 		default:
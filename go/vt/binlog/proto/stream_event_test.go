@@ -13,24 +13,26 @@ import (
 )
 
 type reflectStreamEvent struct {
-	Category   string
-	TableName  string
-	PKColNames []string
-	PKValues   [][]interface{}
-	Sql        string
-	Timestamp  int64
-	GTIDField  myproto.GTIDField
+	Category      string
+	TableName     string
+	PKColNames    []string
+	PKValues      [][]interface{}
+	Sql           string
+	Timestamp     int64
+	TransactionID int64
+	GTIDField     myproto.GTIDField
 }
 
 type extraStreamEvent struct {
-	Extra      int
-	Category   string
-	TableName  string
-	PKColNames []string
-	PKValues   [][]interface{}
-	Sql        string
-	Timestamp  int64
-	GTIDField  myproto.GTIDField
+	Extra         int
+	Category      string
+	TableName     string
+	PKColNames    []string
+	PKValues      [][]interface{}
+	Sql           string
+	Timestamp     int64
+	TransactionID int64
+	GTIDField     myproto.GTIDField
 }
 
 func TestStreamEvent(t *testing.T) {
@@ -46,8 +48,9 @@ func TestStreamEvent(t *testing.T) {
 				[]byte("str6"), 2, uint64(0xfffffffffffffffe),
 			},
 		},
-		Sql:       "str7",
-		Timestamp: 3,
+		Sql:           "str7",
+		Timestamp:     3,
+		TransactionID: 4,
 	})
 	if err != nil {
 		t.Error(err)
@@ -66,8 +69,9 @@ func TestStreamEvent(t *testing.T) {
 				[]byte("str6"), 2, uint64(0xfffffffffffffffe),
 			},
 		},
-		Sql:       "str7",
-		Timestamp: 3,
+		Sql:           "str7",
+		Timestamp:     3,
+		TransactionID: 4,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
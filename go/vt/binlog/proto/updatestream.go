@@ -12,6 +12,17 @@ import (
 // UpdateStreamRequest is used to make a request for ServeUpdateStream.
 type UpdateStreamRequest struct {
 	GTIDField myproto.GTIDField
+	// Tables, if set, restricts the DML events to these tables.
+	Tables []string
+	// TransactionMarkers, if set, surrounds the events of each
+	// transaction with BEGIN and COMMIT events, and sets their
+	// TransactionID. COMMIT events replace the POS events.
+	TransactionMarkers bool
+	// DMLSql, if set, makes the DML events carry their statement in Sql.
+	DMLSql bool
+	// BatchSize is the maximum number of events per reply of the
+	// batched RPCs. The server may lower it.
+	BatchSize int
 }
 
 // KeyRangeRequest is used to make a request for StreamKeyRange.
@@ -19,10 +30,20 @@ type KeyRangeRequest struct {
 	GTIDField      myproto.GTIDField
 	KeyspaceIdType key.KeyspaceIdType
 	KeyRange       key.KeyRange
+	// KeyspaceIdColumn is the sharding column. If set, the statements of
+	// row based replication events get their keyspace_id from it, since
+	// they don't have the comments of the original statements.
+	KeyspaceIdColumn string
+	// BatchSize is the maximum number of transactions per reply of the
+	// batched RPCs. The server may lower it.
+	BatchSize int
 }
 
 // TablesRequest is used to make a request for StreamTables.
 type TablesRequest struct {
 	GTIDField myproto.GTIDField
 	Tables    []string
+	// BatchSize is the maximum number of transactions per reply of the
+	// batched RPCs. The server may lower it.
+	BatchSize int
 }
@@ -0,0 +1,194 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// replicaPollInterval is how often RemoteEventStreamer checks the
+// replication position of the local mysql while it's behind the stream.
+const replicaPollInterval = 10 * time.Millisecond
+
+var remoteStreamWaits = stats.NewTimings("RemoteEventStreamerWaits")
+
+// EventSource delivers StreamEvents. It's implemented by
+// EventStreamer, which reads the local binlogs, and by
+// RemoteEventStreamer, which reads the update stream of another tablet.
+type EventSource interface {
+	// Stream starts streaming events from a given GTID.
+	Stream(gtid myproto.GTID, sendEvent sendEventFunc) error
+
+	// Stop stops the currently executing Stream() call if there is one.
+	Stop()
+}
+
+// RemoteEventStreamer streams the events of the update stream
+// service of a remote tablet, usually the master. It's meant to be
+// used on replicas: the events of a transaction are delivered only
+// once the local mysql has replicated it, so they're never sent
+// ahead of the data they describe.
+type RemoteEventStreamer struct {
+	addr      string
+	mysqld    *mysqlctl.Mysqld
+	dmlSql    bool
+	batchSize int
+
+	// mu protects stopped and interrupted.
+	mu          sync.Mutex
+	stopped     bool
+	interrupted chan struct{}
+
+	// replicated is the last known replication position
+	// of the local mysql.
+	replicated myproto.GTID
+}
+
+// NewRemoteEventStreamer creates a RemoteEventStreamer that reads
+// the update stream served at addr, and waits for mysqld to catch up.
+// If mysqld is nil, the events are delivered as they're received.
+func NewRemoteEventStreamer(addr string, mysqld *mysqlctl.Mysqld) *RemoteEventStreamer {
+	return &RemoteEventStreamer{
+		addr:   addr,
+		mysqld: mysqld,
+	}
+}
+
+// SetDMLSql makes the DML events carry their statement in Sql.
+// It must be called before Stream.
+func (res *RemoteEventStreamer) SetDMLSql() {
+	res.dmlSql = true
+}
+
+// SetBatchSize makes the stream request up to batchSize events per
+// reply. It must be called before Stream.
+func (res *RemoteEventStreamer) SetBatchSize(batchSize int) {
+	res.batchSize = batchSize
+}
+
+// Stream streams the remote events from gtid. It returns nil if
+// it was stopped, and an error if the stream broke for any other reason,
+// in which case it can be called again.
+func (res *RemoteEventStreamer) Stream(gtid myproto.GTID, sendEvent sendEventFunc) error {
+	res.mu.Lock()
+	if res.stopped {
+		res.mu.Unlock()
+		return nil
+	}
+	interrupted := make(chan struct{})
+	res.interrupted = interrupted
+	res.mu.Unlock()
+
+	client, err := binlogplayer.DialBinlogPlayerClient(res.addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	responseChan := make(chan *proto.StreamEvent)
+	req := &proto.UpdateStreamRequest{
+		GTIDField: myproto.GTIDField{Value: gtid},
+		DMLSql:    res.dmlSql,
+		BatchSize: res.batchSize,
+	}
+	resp := client.ServeUpdateStream(req, responseChan)
+
+	// The events of a transaction are held until its POS event
+	// shows that the local mysql has replicated it.
+	var pending []*proto.StreamEvent
+	for {
+		select {
+		case event, ok := <-responseChan:
+			if !ok {
+				if resp.Error() != nil {
+					return fmt.Errorf("error received from ServeUpdateStream on %v: %v", res.addr, resp.Error())
+				}
+				return fmt.Errorf("update stream on %v ended", res.addr)
+			}
+			if event.Category != "POS" {
+				pending = append(pending, event)
+				continue
+			}
+			caughtUp, err := res.waitForReplica(event.GTIDField.Value, interrupted)
+			if err != nil {
+				return err
+			}
+			if !caughtUp {
+				return nil
+			}
+			for _, pendingEvent := range pending {
+				if err := sendEvent(pendingEvent); err != nil {
+					return err
+				}
+			}
+			pending = pending[:0]
+			if err := sendEvent(event); err != nil {
+				return err
+			}
+		case <-interrupted:
+			return nil
+		}
+	}
+}
+
+// Stop stops the currently executing Stream() call,
+// and prevents future ones from streaming.
+func (res *RemoteEventStreamer) Stop() {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	if res.stopped {
+		return
+	}
+	res.stopped = true
+	if res.interrupted != nil {
+		close(res.interrupted)
+	}
+}
+
+// waitForReplica waits until the local mysql has replicated gtid.
+// It returns false if the wait was interrupted.
+func (res *RemoteEventStreamer) waitForReplica(gtid myproto.GTID, interrupted chan struct{}) (bool, error) {
+	if gtid == nil || res.mysqld == nil {
+		return true, nil
+	}
+	if ok, err := res.hasReplicated(gtid); ok || err != nil {
+		return ok, err
+	}
+	defer remoteStreamWaits.Record("Replica", time.Now())
+	for {
+		rp, err := res.mysqld.SlaveStatus()
+		if err != nil {
+			return false, fmt.Errorf("can't get replication position: %v", err)
+		}
+		res.replicated = rp.MasterLogGTIDField.Value
+		if ok, err := res.hasReplicated(gtid); ok || err != nil {
+			return ok, err
+		}
+		select {
+		case <-interrupted:
+			return false, nil
+		case <-time.After(replicaPollInterval):
+		}
+	}
+}
+
+func (res *RemoteEventStreamer) hasReplicated(gtid myproto.GTID) (bool, error) {
+	if res.replicated == nil {
+		return false, nil
+	}
+	ok, err := myproto.AtLeast(res.replicated, gtid)
+	if err != nil {
+		return false, fmt.Errorf("can't compare replication position %v to %v: %v", res.replicated, gtid, err)
+	}
+	return ok, nil
+}
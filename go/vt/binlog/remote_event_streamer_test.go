@@ -0,0 +1,46 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestRemoteEventStreamerHasReplicated(t *testing.T) {
+	res := NewRemoteEventStreamer("", nil)
+	if ok, err := res.hasReplicated(myproto.GoogleGTID{GroupID: 5}); ok || err != nil {
+		t.Errorf("hasReplicated with unknown position: %v, %v, want false, nil", ok, err)
+	}
+	res.replicated = myproto.GoogleGTID{GroupID: 5}
+	testcases := []struct {
+		gtid myproto.GTID
+		want bool
+	}{
+		{myproto.GoogleGTID{GroupID: 4}, true},
+		{myproto.GoogleGTID{GroupID: 5}, true},
+		{myproto.GoogleGTID{GroupID: 6}, false},
+	}
+	for _, tcase := range testcases {
+		ok, err := res.hasReplicated(tcase.gtid)
+		if err != nil || ok != tcase.want {
+			t.Errorf("hasReplicated(%v): %v, %v, want %v", tcase.gtid, ok, err, tcase.want)
+		}
+	}
+}
+
+func TestRemoteEventStreamerStop(t *testing.T) {
+	res := NewRemoteEventStreamer("", nil)
+	res.Stop()
+	err := res.Stream(nil, func(event *proto.StreamEvent) error {
+		t.Errorf("unexpected event: %v", event)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Stream after Stop: %v, want nil", err)
+	}
+}
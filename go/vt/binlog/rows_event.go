@@ -0,0 +1,264 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+)
+
+// tableSchema is the part of a table schema that row based replication
+// events don't carry, and that we need to turn them back into statements.
+type tableSchema struct {
+	Columns   []string
+	PKColumns []int
+	Unsigned  []bool
+	// KeyspaceIdColumn is the index of the sharding column, or -1.
+	KeyspaceIdColumn int
+}
+
+// loadTableSchema reads the schema of a table from mysqld.
+func loadTableSchema(mysqld *mysqlctl.Mysqld, dbName, table string) (*tableSchema, error) {
+	columns, types, err := mysqld.GetColumnTypes(dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	pkColumns, err := mysqld.GetPrimaryKeyColumns(dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	ts := &tableSchema{
+		Columns:          columns,
+		PKColumns:        make([]int, 0, len(pkColumns)),
+		Unsigned:         make([]bool, len(types)),
+		KeyspaceIdColumn: -1,
+	}
+	for i, typ := range types {
+		ts.Unsigned[i] = strings.Contains(strings.ToLower(typ), "unsigned")
+	}
+	for _, pk := range pkColumns {
+		index := -1
+		for i, col := range columns {
+			if strings.EqualFold(col, pk) {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return nil, fmt.Errorf("primary key column %v not found in table %v", pk, table)
+		}
+		ts.PKColumns = append(ts.PKColumns, index)
+	}
+	return ts, nil
+}
+
+// rowsEventStatements converts the rows of a WRITE_ROWS_EVENT,
+// UPDATE_ROWS_EVENT or DELETE_ROWS_EVENT into one DML statement per row.
+// Each statement has a _stream comment with the primary key values, the
+// same way statement based replication does, so downstream consumers like
+// EventStreamer don't need to know what format the binlog was in.
+// For updates, both the old and the new primary key values are listed.
+// If the table has a sharding column, each statement also gets the keyspace_id
+// comment of the row, of type kit, so KeyRangeFilterFunc can filter it.
+func rowsEventStatements(ev proto.BinlogEvent, tm *proto.TableMap, ts *tableSchema, kit key.KeyspaceIdType, rows proto.Rows) ([][]byte, error) {
+	if len(ts.Columns) != len(tm.Types) {
+		return nil, fmt.Errorf("table %v has %d columns, but rows event has %d", tm.Name, len(ts.Columns), len(tm.Types))
+	}
+	result := make([][]byte, 0, len(rows.Rows))
+	for _, row := range rows.Rows {
+		identify := fixUnsigned(row.Identify, tm.Types, ts.Unsigned)
+		data := fixUnsigned(row.Data, tm.Types, ts.Unsigned)
+
+		buf := bytes.NewBuffer(make([]byte, 0, 256))
+		switch {
+		case ev.IsWriteRows():
+			fmt.Fprintf(buf, "insert into %v(", tm.Name)
+			writeColumnList(buf, ts.Columns, rows.DataColumns)
+			buf.WriteString(") values (")
+			writeValueList(buf, data, rows.DataColumns)
+			buf.WriteString(")")
+			writeKeyspaceIdComment(buf, ts, kit, data)
+			writeStreamComment(buf, tm.Name, ts, data)
+		case ev.IsUpdateRows():
+			fmt.Fprintf(buf, "update %v set ", tm.Name)
+			writeAssignments(buf, ts.Columns, data, rows.DataColumns)
+			buf.WriteString(" where ")
+			writeWhere(buf, ts, identify, rows.IdentifyColumns)
+			writeKeyspaceIdComment(buf, ts, kit, identify)
+			writeStreamComment(buf, tm.Name, ts, identify, data)
+		case ev.IsDeleteRows():
+			fmt.Fprintf(buf, "delete from %v where ", tm.Name)
+			writeWhere(buf, ts, identify, rows.IdentifyColumns)
+			writeKeyspaceIdComment(buf, ts, kit, identify)
+			writeStreamComment(buf, tm.Name, ts, identify)
+		default:
+			return nil, fmt.Errorf("not a rows event: %#v", ev)
+		}
+		result = append(result, buf.Bytes())
+	}
+	return result, nil
+}
+
+// fixUnsigned reinterprets the integer values of unsigned columns.
+// The binlog doesn't say which columns are unsigned, so they are always
+// decoded as signed values.
+func fixUnsigned(values []sqltypes.Value, types []byte, unsigned []bool) []sqltypes.Value {
+	if values == nil {
+		return nil
+	}
+	result := make([]sqltypes.Value, len(values))
+	for i, v := range values {
+		result[i] = v
+		if !unsigned[i] || !v.IsNumeric() {
+			continue
+		}
+		n, err := v.ParseInt64()
+		if err != nil || n >= 0 {
+			continue
+		}
+		var bits uint
+		switch types[i] {
+		case mproto.VT_TINY:
+			bits = 8
+		case mproto.VT_SHORT:
+			bits = 16
+		case mproto.VT_INT24:
+			bits = 24
+		case mproto.VT_LONG:
+			bits = 32
+		case mproto.VT_LONGLONG:
+			bits = 64
+		default:
+			continue
+		}
+		u := uint64(n)
+		if bits < 64 {
+			u &= 1<<bits - 1
+		}
+		result[i] = sqltypes.MakeNumeric(strconv.AppendUint(nil, u, 10))
+	}
+	return result
+}
+
+func writeColumnList(buf *bytes.Buffer, columns []string, present []bool) {
+	first := true
+	for i, col := range columns {
+		if !present[i] {
+			continue
+		}
+		if !first {
+			buf.WriteString(", ")
+		}
+		first = false
+		buf.WriteString(col)
+	}
+}
+
+func writeValueList(buf *bytes.Buffer, values []sqltypes.Value, present []bool) {
+	first := true
+	for i, v := range values {
+		if !present[i] {
+			continue
+		}
+		if !first {
+			buf.WriteString(", ")
+		}
+		first = false
+		v.EncodeSql(buf)
+	}
+}
+
+func writeAssignments(buf *bytes.Buffer, columns []string, values []sqltypes.Value, present []bool) {
+	first := true
+	for i, col := range columns {
+		if !present[i] {
+			continue
+		}
+		if !first {
+			buf.WriteString(", ")
+		}
+		first = false
+		buf.WriteString(col)
+		buf.WriteString("=")
+		values[i].EncodeSql(buf)
+	}
+}
+
+// writeWhere writes the where clause that identifies a row.
+// If the table has no primary key, all the present columns are used.
+func writeWhere(buf *bytes.Buffer, ts *tableSchema, identify []sqltypes.Value, present []bool) {
+	columns := ts.PKColumns
+	if len(columns) == 0 {
+		for i, p := range present {
+			if p {
+				columns = append(columns, i)
+			}
+		}
+	}
+	for i, col := range columns {
+		if i > 0 {
+			buf.WriteString(" and ")
+		}
+		buf.WriteString(ts.Columns[col])
+		if identify[col].IsNull() {
+			buf.WriteString(" is null")
+			continue
+		}
+		buf.WriteString("=")
+		identify[col].EncodeSql(buf)
+	}
+}
+
+// writeKeyspaceIdComment writes the keyspace_id comment that vtgate adds to
+// DMLs, with the sharding column value of the row image. It goes before the
+// _stream comment, which must be last. Rows that don't have the sharding
+// column, or have it null, don't get one.
+func writeKeyspaceIdComment(buf *bytes.Buffer, ts *tableSchema, kit key.KeyspaceIdType, image []sqltypes.Value) {
+	if ts.KeyspaceIdColumn == -1 || image == nil || image[ts.KeyspaceIdColumn].IsNull() {
+		return
+	}
+	value := image[ts.KeyspaceIdColumn].Raw()
+	buf.WriteByte(' ')
+	buf.Write(KEYSPACE_ID_COMMENT)
+	if kit == key.KIT_BYTES {
+		buf.WriteString(base64.StdEncoding.EncodeToString(value))
+	} else {
+		buf.Write(value)
+	}
+	buf.WriteString(" */")
+}
+
+// writeStreamComment writes a _stream comment with the primary key values
+// of each of the given row images. Tables without a primary key don't get
+// one, since there's nothing to invalidate by.
+func writeStreamComment(buf *bytes.Buffer, table string, ts *tableSchema, images ...[]sqltypes.Value) {
+	if len(ts.PKColumns) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, " /* _stream %v (", table)
+	for _, pk := range ts.PKColumns {
+		buf.WriteString(ts.Columns[pk])
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(")")
+	for _, image := range images {
+		buf.WriteString(" (")
+		for _, pk := range ts.PKColumns {
+			image[pk].EncodeAscii(buf)
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(")")
+	}
+	buf.WriteString("; */")
+}
@@ -0,0 +1,301 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// makeGoogleEvent builds a Google MySQL event with GroupID 0x0d.
+func makeGoogleEvent(typ byte, data []byte) []byte {
+	buf := make([]byte, 27, 27+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], 1407805592)
+	buf[4] = typ
+	binary.LittleEndian.PutUint32(buf[9:13], uint32(27+len(data)))
+	buf[19] = 0xd
+	return append(buf, data...)
+}
+
+var (
+	// table ID 0x12, vt_test_keyspace.vt_a (id bigint, name varchar(64), flag tinyint unsigned)
+	tableMapEvent = makeGoogleEvent(19, []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x10, 'v', 't', '_', 't', 'e', 's', 't', '_', 'k', 'e', 'y', 's', 'p', 'a', 'c', 'e', 0x0,
+		0x4, 'v', 't', '_', 'a', 0x0,
+		0x3, 0x8, 0xf, 0x1,
+		0x2, 0x40, 0x0,
+		0x6,
+	})
+	// table ID 0x13, other_database.vt_a
+	otherDBTableMapEvent = makeGoogleEvent(19, []byte{
+		0x13, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0xe, 'o', 't', 'h', 'e', 'r', '_', 'd', 'a', 't', 'a', 'b', 'a', 's', 'e', 0x0,
+		0x4, 'v', 't', '_', 'a', 0x0,
+		0x3, 0x8, 0xf, 0x1,
+		0x2, 0x40, 0x0,
+		0x6,
+	})
+	// two rows: (1, 'abc', 255) and (2, NULL, 5)
+	writeRowsEvent = makeGoogleEvent(30, []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x7,
+		0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 'a', 'b', 'c', 0xff,
+		0x2, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
+	})
+	// one row: (1, 'abc', 255) -> (3, 'd', 255)
+	updateRowsEvent = makeGoogleEvent(31, []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x7, 0x7,
+		0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 'a', 'b', 'c', 0xff,
+		0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 'd', 0xff,
+	})
+	// one row, only the id is present: (2)
+	deleteRowsEvent = makeGoogleEvent(32, []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x1,
+		0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	})
+	// same row as deleteRowsEvent, for table ID 0x13
+	otherDBDeleteRowsEvent = makeGoogleEvent(32, []byte{
+		0x13, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x1,
+		0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	})
+)
+
+func newRowsTestStreamer(loads *int) *binlogConnStreamer {
+	bls := newBinlogConnStreamer("vt_test_keyspace", nil).(*binlogConnStreamer)
+	bls.getTableSchema = func(table string) (*tableSchema, error) {
+		*loads++
+		return &tableSchema{
+			Columns:   []string{"id", "name", "flag"},
+			PKColumns: []int{0},
+			Unsigned:  []bool{false, false, true},
+		}, nil
+	}
+	return bls
+}
+
+func runParseEvents(t *testing.T, bls *binlogConnStreamer, input [][]byte) []proto.BinlogTransaction {
+	events := make(chan proto.BinlogEvent)
+	var got []proto.BinlogTransaction
+	sendTransaction := func(trans *proto.BinlogTransaction) error {
+		got = append(got, *trans)
+		return nil
+	}
+
+	go sendTestEvents(events, input)
+	bls.svm.Go(func(svc *sync2.ServiceContext) error {
+		return bls.parseEvents(svc, events, sendTransaction)
+	})
+	if err := bls.svm.Join(); err != ServerEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+	return got
+}
+
+func TestBinlogConnStreamerParseEventsRows(t *testing.T) {
+	input := [][]byte{
+		rotateEvent,
+		formatEvent,
+		beginEvent,
+		tableMapEvent,
+		writeRowsEvent,
+		tableMapEvent,
+		updateRowsEvent,
+		tableMapEvent,
+		deleteRowsEvent,
+		xidEvent,
+	}
+
+	loads := 0
+	bls := newRowsTestStreamer(&loads)
+
+	want := []proto.BinlogTransaction{
+		proto.BinlogTransaction{
+			Statements: []proto.Statement{
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(id, name, flag) values (1, 'abc', 255) /* _stream vt_a (id ) (1 ); */")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(id, name, flag) values (2, null, 5) /* _stream vt_a (id ) (2 ); */")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("update vt_a set id=3, name='d', flag=255 where id=1 /* _stream vt_a (id ) (1 ) (3 ); */")},
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("delete from vt_a where id=2 /* _stream vt_a (id ) (2 ); */")},
+			},
+			Timestamp: 1407805592,
+			GTIDField: myproto.GTIDField{
+				Value: myproto.GoogleGTID{GroupID: 0x0d}},
+		},
+	}
+	got := runParseEvents(t, bls, input)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("binlogConnStreamer.parseEvents(): got %v, want %v", got, want)
+	}
+	if loads != 1 {
+		t.Errorf("table schema loaded %v times, want 1", loads)
+	}
+}
+
+func TestBinlogConnStreamerParseEventsRowsOtherDB(t *testing.T) {
+	input := [][]byte{
+		rotateEvent,
+		formatEvent,
+		beginEvent,
+		otherDBTableMapEvent,
+		otherDBDeleteRowsEvent,
+		tableMapEvent,
+		deleteRowsEvent,
+		xidEvent,
+	}
+
+	loads := 0
+	bls := newRowsTestStreamer(&loads)
+
+	want := []proto.BinlogTransaction{
+		proto.BinlogTransaction{
+			Statements: []proto.Statement{
+				proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+				proto.Statement{Category: proto.BL_DML, Sql: []byte("delete from vt_a where id=2 /* _stream vt_a (id ) (2 ); */")},
+			},
+			Timestamp: 1407805592,
+			GTIDField: myproto.GTIDField{
+				Value: myproto.GoogleGTID{GroupID: 0x0d}},
+		},
+	}
+	got := runParseEvents(t, bls, input)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("binlogConnStreamer.parseEvents(): got %v, want %v", got, want)
+	}
+}
+
+func TestBinlogConnStreamerParseEventsRowsSchemaReload(t *testing.T) {
+	input := [][]byte{
+		rotateEvent,
+		formatEvent,
+		tableMapEvent,
+		deleteRowsEvent,
+		createEvent,
+		tableMapEvent,
+		deleteRowsEvent,
+	}
+
+	loads := 0
+	bls := newRowsTestStreamer(&loads)
+	runParseEvents(t, bls, input)
+	if loads != 2 {
+		t.Errorf("table schema loaded %v times, want 2", loads)
+	}
+}
+
+func TestBinlogConnStreamerParseEventsRowsUnknownTable(t *testing.T) {
+	input := [][]byte{
+		rotateEvent,
+		formatEvent,
+		beginEvent,
+		writeRowsEvent,
+		xidEvent,
+	}
+	events := make(chan proto.BinlogEvent)
+	sendTransaction := func(trans *proto.BinlogTransaction) error {
+		return nil
+	}
+
+	loads := 0
+	bls := newRowsTestStreamer(&loads)
+	go sendTestEvents(events, input)
+	bls.svm.Go(func(svc *sync2.ServiceContext) error {
+		return bls.parseEvents(svc, events, sendTransaction)
+	})
+	if err := bls.svm.Join(); err == nil || err == ServerEOF {
+		t.Errorf("expected error for rows event without table map, got %v", err)
+	}
+}
+
+func TestRowsEventStatementsNoPK(t *testing.T) {
+	ts := &tableSchema{
+		Columns:          []string{"id", "name", "flag"},
+		Unsigned:         []bool{false, false, false},
+		KeyspaceIdColumn: -1,
+	}
+	ev := mysqlctl.NewGoogleBinlogEvent(deleteRowsEvent)
+	format := proto.BinlogFormat{FormatVersion: 4, HeaderLength: 27}
+	tm, err := mysqlctl.NewGoogleBinlogEvent(tableMapEvent).TableMap(format)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows, err := ev.Rows(format, tm)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := rowsEventStatements(ev, tm, ts, key.KIT_UINT64, rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "delete from vt_a where id=2"
+	if len(got) != 1 || string(got[0]) != want {
+		t.Errorf("rowsEventStatements() = %q, want [%q]", got, want)
+	}
+}
+
+func TestBinlogConnStreamerParseEventsRowsKeyspaceId(t *testing.T) {
+	input := [][]byte{
+		rotateEvent,
+		formatEvent,
+		beginEvent,
+		tableMapEvent,
+		writeRowsEvent,
+		tableMapEvent,
+		updateRowsEvent,
+		tableMapEvent,
+		deleteRowsEvent,
+		xidEvent,
+	}
+
+	loads := 0
+	bls := newRowsTestStreamer(&loads)
+	bls.setKeyspaceIdColumn("FLAG", key.KIT_UINT64)
+
+	// Only the insert of flag=5 is in the key range: the other rows have
+	// flag=255, and the delete has no keyspace_id since its row image
+	// doesn't have the flag.
+	var got []proto.BinlogTransaction
+	sendTransaction := func(trans *proto.BinlogTransaction) error {
+		got = append(got, *trans)
+		return nil
+	}
+	kr := key.KeyRange{End: key.Uint64Key(10).KeyspaceId()}
+	f := KeyRangeFilterFunc(key.KIT_UINT64, kr, sendTransaction)
+
+	events := make(chan proto.BinlogEvent)
+	go sendTestEvents(events, input)
+	bls.svm.Go(func(svc *sync2.ServiceContext) error {
+		return bls.parseEvents(svc, events, f)
+	})
+	if err := bls.svm.Join(); err != ServerEOF {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []proto.Statement{
+		proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+		proto.Statement{Category: proto.BL_DML, Sql: []byte("insert into vt_a(id, name, flag) values (2, null, 5) /* EMD keyspace_id:5 */ /* _stream vt_a (id ) (2 ); */")},
+		proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+		proto.Statement{Category: proto.BL_SET, Sql: []byte("SET TIMESTAMP=1407805592")},
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Statements, want) {
+		t.Errorf("KeyRangeFilterFunc(parseEvents()): got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var sinkTransactions = stats.NewInt("EventSinkTransactions")
+
+// ErrNoCheckpoint is returned by RunSink when its Checkpointer has no
+// position to start from.
+var ErrNoCheckpoint = errors.New("no checkpoint to start the event sink from")
+
+// EventSink receives the events of an update stream, to deliver them
+// to a downstream system.
+type EventSink interface {
+	// Send queues an event for delivery.
+	Send(event *proto.StreamEvent) error
+
+	// Flush delivers the queued events. It's called at the end of
+	// each transaction: once it returns, the position of the
+	// transaction is checkpointed.
+	Flush() error
+}
+
+// Checkpointer persists the position of an EventSink, so it can resume
+// its stream after a restart.
+type Checkpointer interface {
+	// Load returns the last position saved, or nil if there's none.
+	Load() (myproto.GTID, error)
+
+	// Save saves a position.
+	Save(gtid myproto.GTID) error
+}
+
+// RunSink streams the events of source to sink, from the position of the
+// checkpointer, and checkpoints the position of the transactions once
+// sink has delivered them. The delivery is at-least-once: if the stream
+// breaks, the events after the last checkpoint are sent again when it's
+// run again.
+func RunSink(source EventSource, sink EventSink, checkpointer Checkpointer) error {
+	gtid, err := checkpointer.Load()
+	if err != nil {
+		return fmt.Errorf("can't load checkpoint: %v", err)
+	}
+	if gtid == nil {
+		return ErrNoCheckpoint
+	}
+	log.Infof("event sink starting @ %v", gtid)
+	return source.Stream(gtid, func(event *proto.StreamEvent) error {
+		if err := sink.Send(event); err != nil {
+			return err
+		}
+		if event.Category != "POS" && event.Category != "COMMIT" {
+			return nil
+		}
+		if err := sink.Flush(); err != nil {
+			return err
+		}
+		sinkTransactions.Add(1)
+		if event.GTIDField.Value == nil {
+			return nil
+		}
+		return checkpointer.Save(event.GTIDField.Value)
+	})
+}
+
+// StartCheckpointer is a Checkpointer that starts from Start until
+// Checkpointer has saved a position, for the first run of a sink.
+type StartCheckpointer struct {
+	Checkpointer
+	Start myproto.GTID
+}
+
+// Load implements Checkpointer.Load().
+func (sc StartCheckpointer) Load() (myproto.GTID, error) {
+	gtid, err := sc.Checkpointer.Load()
+	if gtid == nil && err == nil {
+		return sc.Start, nil
+	}
+	return gtid, err
+}
+
+// FileCheckpointer is a Checkpointer that saves the positions in a file,
+// in the encoded form of the GTIDs.
+type FileCheckpointer string
+
+// Load implements Checkpointer.Load().
+func (fc FileCheckpointer) Load() (myproto.GTID, error) {
+	data, err := ioutil.ReadFile(string(fc))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return myproto.DecodeGTID(strings.TrimSpace(string(data)))
+}
+
+// Save implements Checkpointer.Save(). The file is replaced
+// atomically, so a crash can't leave a partial position.
+func (fc FileCheckpointer) Save(gtid myproto.GTID) error {
+	tmp := string(fc) + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(myproto.EncodeGTID(gtid)+"\n"), 0664); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(fc))
+}
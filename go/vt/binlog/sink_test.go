@@ -0,0 +1,159 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// fakeEventSource streams its events, whatever the position.
+type fakeEventSource struct {
+	events []*proto.StreamEvent
+	start  myproto.GTID
+}
+
+func (fes *fakeEventSource) Stream(gtid myproto.GTID, sendEvent sendEventFunc) error {
+	fes.start = gtid
+	for _, event := range fes.events {
+		if err := sendEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fes *fakeEventSource) Stop() {}
+
+// fakeSink records the calls, and fails the flushes after failAfter.
+type fakeSink struct {
+	calls     []string
+	failAfter int
+}
+
+func (fs *fakeSink) Send(event *proto.StreamEvent) error {
+	fs.calls = append(fs.calls, "Send "+event.Category)
+	return nil
+}
+
+func (fs *fakeSink) Flush() error {
+	fs.calls = append(fs.calls, "Flush")
+	if fs.failAfter--; fs.failAfter < 0 {
+		return fmt.Errorf("flush failed")
+	}
+	return nil
+}
+
+type fakeCheckpointer struct {
+	saved []myproto.GTID
+}
+
+func (fc *fakeCheckpointer) Load() (myproto.GTID, error) {
+	if len(fc.saved) == 0 {
+		return nil, nil
+	}
+	return fc.saved[len(fc.saved)-1], nil
+}
+
+func (fc *fakeCheckpointer) Save(gtid myproto.GTID) error {
+	fc.saved = append(fc.saved, gtid)
+	return nil
+}
+
+func TestRunSink(t *testing.T) {
+	gtid1 := myproto.MustParseGTID(blsMysqlFlavor, "20")
+	gtid2 := myproto.MustParseGTID(blsMysqlFlavor, "21")
+	source := &fakeEventSource{
+		events: []*proto.StreamEvent{
+			{Category: "DML"},
+			{Category: "POS", GTIDField: myproto.GTIDField{Value: gtid1}},
+			{Category: "DDL"},
+			{Category: "POS", GTIDField: myproto.GTIDField{Value: gtid2}},
+		},
+	}
+	sink := &fakeSink{failAfter: 1}
+	checkpointer := &fakeCheckpointer{}
+
+	// The second transaction fails to flush, so it's not checkpointed.
+	start := StartCheckpointer{Checkpointer: checkpointer, Start: myproto.MustParseGTID(blsMysqlFlavor, "19")}
+	if err := RunSink(source, sink, start); err == nil {
+		t.Errorf("RunSink() didn't fail with the sink")
+	}
+	wantCalls := []string{"Send DML", "Send POS", "Flush", "Send DDL", "Send POS", "Flush"}
+	if !reflect.DeepEqual(sink.calls, wantCalls) {
+		t.Errorf("sink calls = %v, want %v", sink.calls, wantCalls)
+	}
+	if want := []myproto.GTID{gtid1}; !reflect.DeepEqual(checkpointer.saved, want) {
+		t.Errorf("checkpoints = %v, want %v", checkpointer.saved, want)
+	}
+
+	// The next run restarts from the checkpoint.
+	sink = &fakeSink{failAfter: 2}
+	if err := RunSink(source, sink, checkpointer); err != nil {
+		t.Errorf("RunSink(): %v", err)
+	}
+	if source.start != gtid1 {
+		t.Errorf("stream restarted from %v, want %v", source.start, gtid1)
+	}
+	if want := []myproto.GTID{gtid1, gtid1, gtid2}; !reflect.DeepEqual(checkpointer.saved, want) {
+		t.Errorf("checkpoints = %v, want %v", checkpointer.saved, want)
+	}
+}
+
+func TestRunSinkFirstRun(t *testing.T) {
+	source := &fakeEventSource{
+		events: []*proto.StreamEvent{
+			{Category: "DML"},
+			{Category: "POS", GTIDField: myproto.GTIDField{Value: myproto.MustParseGTID(blsMysqlFlavor, "21")}},
+		},
+	}
+
+	// Without a checkpoint, there's nowhere to start from.
+	if err := RunSink(source, &fakeSink{}, &fakeCheckpointer{}); err != ErrNoCheckpoint {
+		t.Errorf("RunSink() without checkpoint = %v, want ErrNoCheckpoint", err)
+	}
+
+	// The first run starts from the start position, the next ones
+	// from the checkpoint.
+	start := myproto.MustParseGTID(blsMysqlFlavor, "20")
+	checkpointer := &fakeCheckpointer{}
+	sc := StartCheckpointer{Checkpointer: checkpointer, Start: start}
+	if err := RunSink(source, &fakeSink{failAfter: 1}, sc); err != nil {
+		t.Errorf("RunSink(): %v", err)
+	}
+	if source.start != start {
+		t.Errorf("first run started from %v, want %v", source.start, start)
+	}
+	if gtid, err := sc.Load(); gtid != source.events[1].GTIDField.Value || err != nil {
+		t.Errorf("Load() after the first run = %v, %v, want %v", gtid, err, source.events[1].GTIDField.Value)
+	}
+}
+
+func TestFileCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fc := FileCheckpointer(path.Join(dir, "checkpoint"))
+
+	if gtid, err := fc.Load(); gtid != nil || err != nil {
+		t.Errorf("Load() without checkpoint = %v, %v, want nil, nil", gtid, err)
+	}
+	want := myproto.MustParseGTID(blsMysqlFlavor, "20")
+	if err := fc.Save(want); err != nil {
+		t.Fatalf("Save(): %v", err)
+	}
+	if got, err := fc.Load(); got != want || err != nil {
+		t.Errorf("Load() = %v, %v, want %v", got, err, want)
+	}
+}
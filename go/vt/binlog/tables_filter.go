@@ -29,20 +29,12 @@ func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransa
 				log.Warningf("Not forwarding DDL: %s", string(statement.Sql))
 				continue
 			case proto.BL_DML:
-				tableIndex := bytes.LastIndex(statement.Sql, STREAM_COMMENT)
-				if tableIndex == -1 {
+				tableName, ok := streamCommentTable(statement.Sql)
+				if !ok {
 					updateStreamErrors.Add("TablesStream", 1)
 					log.Errorf("Error parsing table name: %s", string(statement.Sql))
 					continue
 				}
-				tableStart := tableIndex + len(STREAM_COMMENT)
-				tableEnd := bytes.Index(statement.Sql[tableStart:], SPACE)
-				if tableEnd == -1 {
-					updateStreamErrors.Add("TablesStream", 1)
-					log.Errorf("Error parsing table name: %s", string(statement.Sql))
-					continue
-				}
-				tableName := string(statement.Sql[tableStart : tableStart+tableEnd])
 				for _, t := range tables {
 					if t == tableName {
 						filtered = append(filtered, statement)
@@ -64,3 +56,18 @@ func TablesFilterFunc(tables []string, sendReply sendTransactionFunc) sendTransa
 		return sendReply(reply)
 	}
 }
+
+// streamCommentTable returns the table name of the _stream comment of a DML,
+// without parsing the rest of the comment.
+func streamCommentTable(sql []byte) (string, bool) {
+	tableIndex := bytes.LastIndex(sql, STREAM_COMMENT)
+	if tableIndex == -1 {
+		return "", false
+	}
+	tableStart := tableIndex + len(STREAM_COMMENT)
+	tableEnd := bytes.Index(sql[tableStart:], SPACE)
+	if tableEnd == -1 {
+		return "", false
+	}
+	return string(sql[tableStart : tableStart+tableEnd]), true
+}
@@ -0,0 +1,166 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+var (
+	maxStreamBytesPerSec = flag.Int64("binlog_stream_max_bytes_per_sec", 0,
+		"Maximum rate of each update stream, in bytes of statements per second. 0 means no limit.")
+	maxStreamBatchSize = flag.Int("binlog_stream_max_batch_size", 100,
+		"Maximum number of events or transactions per reply of the batched update stream RPCs.")
+
+	streamThrottledTime = stats.NewTimings("UpdateStreamThrottled")
+)
+
+// batchFlushDelay is how long the batched streams hold a partial batch,
+// waiting for it to fill up.
+const batchFlushDelay = 10 * time.Millisecond
+
+// rateLimiter delays a stream so it stays under a rate of bytes per
+// second. A new stream, or one that was idle, may burst for up to a
+// second's worth of bytes.
+type rateLimiter struct {
+	name        string
+	bytesPerSec int64
+
+	start time.Time
+	sent  int64
+}
+
+// newRateLimiter creates a rateLimiter for bytesPerSec, which doesn't
+// limit anything if bytesPerSec is 0. name is the name of the stream
+// in the stats.
+func newRateLimiter(name string, bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{name: name, bytesPerSec: bytesPerSec, start: time.Now().Add(-time.Second)}
+}
+
+// wait accounts for n bytes, and sleeps until they can be sent.
+func (rl *rateLimiter) wait(n int) {
+	if rl.bytesPerSec <= 0 {
+		return
+	}
+	now := time.Now()
+	allowed := time.Duration(rl.sent * int64(time.Second) / rl.bytesPerSec)
+	if elapsed := now.Sub(rl.start); elapsed > allowed+time.Second {
+		// Don't let the idle time accumulate more than a second of credit.
+		rl.start = now.Add(-allowed - time.Second)
+	}
+	rl.sent += int64(n)
+	allowed = time.Duration(rl.sent * int64(time.Second) / rl.bytesPerSec)
+	if delay := allowed - now.Sub(rl.start); delay > 0 {
+		streamThrottledTime.Add(rl.name, delay)
+		time.Sleep(delay)
+	}
+}
+
+// transactionSize is the size of the statements of a transaction.
+func transactionSize(trans *proto.BinlogTransaction) int {
+	size := 0
+	for _, stmt := range trans.Statements {
+		size += len(stmt.Sql)
+	}
+	return size
+}
+
+// eventSize is the size of the statement of an event, or of its
+// table name and primary key values if it has no statement.
+func eventSize(event *proto.StreamEvent) int {
+	size := len(event.Sql) + len(event.TableName)
+	for _, pk := range event.PKValues {
+		for _, v := range pk {
+			switch v := v.(type) {
+			case []byte:
+				size += len(v)
+			case string:
+				size += len(v)
+			default:
+				size += 8
+			}
+		}
+	}
+	return size
+}
+
+// batchSize returns the batch size of a request, capped by
+// binlog_stream_max_batch_size.
+func batchSize(requested int) int {
+	if requested <= 0 || requested > *maxStreamBatchSize {
+		return *maxStreamBatchSize
+	}
+	return requested
+}
+
+// batcher groups the items of a stream into batches. A batch is sent
+// when it's full, or batchFlushDelay after its first item.
+type batcher struct {
+	maxSize int
+	// send sends the current batch. It's called with mu held.
+	send func() error
+
+	mu     sync.Mutex
+	size   int
+	timer  *time.Timer
+	err    error
+	closed bool
+}
+
+func newBatcher(maxSize int, send func() error) *batcher {
+	return &batcher{maxSize: maxSize, send: send}
+}
+
+// add adds an item to the current batch with appendItem, which is
+// called with the lock held. It returns the error of the last send.
+func (b *batcher) add(appendItem func()) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	appendItem()
+	b.size++
+	if b.size >= b.maxSize {
+		b.flushLocked()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(batchFlushDelay, b.timedFlush)
+	}
+	return b.err
+}
+
+func (b *batcher) timedFlush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.flushLocked()
+	}
+}
+
+func (b *batcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.size == 0 || b.err != nil {
+		return
+	}
+	b.size = 0
+	b.err = b.send()
+}
+
+// close sends the last batch. Nothing is sent after it returns.
+func (b *batcher) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+	b.closed = true
+	return b.err
+}
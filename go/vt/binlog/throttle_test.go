@@ -0,0 +1,108 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binlog
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter("test", 10000)
+	start := time.Now()
+	// The first second of bytes goes through.
+	rl.wait(10000)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("first wait took %v", elapsed)
+	}
+	// The next ones are delayed.
+	rl.wait(1000)
+	rl.wait(1000)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("waits took %v, want at least 200ms", elapsed)
+	}
+
+	// No limit.
+	rl = newRateLimiter("test", 0)
+	start = time.Now()
+	rl.wait(1 << 30)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("wait without limit took %v", elapsed)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	for requested, want := range map[int]int{0: 100, 10: 10, 100: 100, 1000: 100} {
+		if got := batchSize(requested); got != want {
+			t.Errorf("batchSize(%v) = %v, want %v", requested, got, want)
+		}
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]int
+	var batch []int
+	b := newBatcher(3, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, batch)
+		batch = nil
+		return nil
+	})
+	add := func(i int) {
+		if err := b.add(func() { batch = append(batch, i) }); err != nil {
+			t.Fatalf("add(): %v", err)
+		}
+	}
+
+	// Full batches are sent right away.
+	for i := 1; i <= 4; i++ {
+		add(i)
+	}
+	mu.Lock()
+	if want := [][]int{{1, 2, 3}}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	mu.Unlock()
+
+	// Partial batches are sent after a delay.
+	time.Sleep(5 * batchFlushDelay)
+	mu.Lock()
+	if want := [][]int{{1, 2, 3}, {4}}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	mu.Unlock()
+
+	// And on close.
+	add(5)
+	if err := b.close(); err != nil {
+		t.Fatalf("close(): %v", err)
+	}
+	time.Sleep(5 * batchFlushDelay)
+	mu.Lock()
+	if want := [][]int{{1, 2, 3}, {4}, {5}}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	mu.Unlock()
+}
+
+func TestBatcherError(t *testing.T) {
+	b := newBatcher(1, func() error {
+		return fmt.Errorf("send failed")
+	})
+	if err := b.add(func() {}); err == nil {
+		t.Errorf("add() didn't fail with the send")
+	}
+	if err := b.add(func() { t.Errorf("item added after a failed send") }); err == nil {
+		t.Errorf("add() after a failed send didn't fail")
+	}
+	if err := b.close(); err == nil {
+		t.Errorf("close() didn't return the send error")
+	}
+}
@@ -6,6 +6,7 @@ package binlog
 
 import (
 	"fmt"
+	"net/http"
 	"sync"
 
 	log "github.com/golang/glog"
@@ -106,6 +107,7 @@ func RegisterUpdateStreamService(mycnf *mysqlctl.Mycnf) {
 	stats.Publish("UpdateStreamState", stats.StringFunc(func() string {
 		return usStateNames[UpdateStreamRpcService.state.Get()]
 	}))
+	http.HandleFunc("/updatestream/json", UpdateStreamRpcService.serveChangeEvents)
 
 	// and register all the instances
 	for _, f := range RegisterUpdateStreamServices {
@@ -204,16 +206,27 @@ func (updateStream *UpdateStream) ServeUpdateStream(req *proto.UpdateStreamReque
 	log.Infof("ServeUpdateStream starting @ %#v", req.GTIDField.Value)
 
 	evs := NewEventStreamer(updateStream.dbname, updateStream.mysqld)
+	if len(req.Tables) > 0 {
+		evs.SetTables(req.Tables)
+	}
+	if req.TransactionMarkers {
+		evs.SetTransactionMarkers()
+	}
+	if req.DMLSql {
+		evs.SetDMLSql()
+	}
 	updateStream.streams.Add(evs)
 	defer updateStream.streams.Delete(evs)
 
 	// Calls cascade like this: BinlogStreamer->func(*proto.StreamEvent)->sendReply
+	rl := newRateLimiter("Updates", *maxStreamBytesPerSec)
 	return evs.Stream(req.GTIDField.Value, func(reply *proto.StreamEvent) error {
 		if reply.Category == "ERR" {
 			updateStreamErrors.Add("UpdateStream", 1)
 		} else {
 			updateStreamEvents.Add(reply.Category, 1)
 		}
+		rl.wait(eventSize(reply))
 		return sendReply(reply)
 	})
 }
@@ -240,13 +253,22 @@ func (updateStream *UpdateStream) StreamKeyRange(req *proto.KeyRangeRequest, sen
 	log.Infof("ServeUpdateStream starting @ %#v", req.GTIDField.Value)
 
 	bls := NewBinlogStreamer(updateStream.dbname, updateStream.mysqld)
+	if req.KeyspaceIdColumn != "" {
+		// Only the conn streamer understands row based replication, and
+		// needs the sharding column to filter it.
+		if cs, ok := bls.(*binlogConnStreamer); ok {
+			cs.setKeyspaceIdColumn(req.KeyspaceIdColumn, req.KeyspaceIdType)
+		}
+	}
 	updateStream.streams.Add(bls)
 	defer updateStream.streams.Delete(bls)
 
 	// Calls cascade like this: BinlogStreamer->KeyRangeFilterFunc->func(*proto.BinlogTransaction)->sendReply
+	rl := newRateLimiter("KeyRange", *maxStreamBytesPerSec)
 	f := KeyRangeFilterFunc(req.KeyspaceIdType, req.KeyRange, func(reply *proto.BinlogTransaction) error {
 		keyrangeStatements.Add(int64(len(reply.Statements)))
 		keyrangeTransactions.Add(1)
+		rl.wait(transactionSize(reply))
 		return sendReply(reply)
 	})
 	return bls.Stream(req.GTIDField.Value, f)
@@ -278,14 +300,70 @@ func (updateStream *UpdateStream) StreamTables(req *proto.TablesRequest, sendRep
 	defer updateStream.streams.Delete(bls)
 
 	// Calls cascade like this: BinlogStreamer->KeyRangeFilterFunc->func(*proto.BinlogTransaction)->sendReply
+	rl := newRateLimiter("Tables", *maxStreamBytesPerSec)
 	f := TablesFilterFunc(req.Tables, func(reply *proto.BinlogTransaction) error {
 		keyrangeStatements.Add(int64(len(reply.Statements)))
 		keyrangeTransactions.Add(1)
+		rl.wait(transactionSize(reply))
 		return sendReply(reply)
 	})
 	return bls.Stream(req.GTIDField.Value, f)
 }
 
+// ServeUpdateStreamBatch is ServeUpdateStream, with up to req.BatchSize
+// events per reply.
+func (updateStream *UpdateStream) ServeUpdateStreamBatch(req *proto.UpdateStreamRequest, sendReply func(reply *proto.StreamEventBatch) error) error {
+	batch := &proto.StreamEventBatch{}
+	b := newBatcher(batchSize(req.BatchSize), func() error {
+		reply := batch
+		batch = &proto.StreamEventBatch{}
+		return sendReply(reply)
+	})
+	err := updateStream.ServeUpdateStream(req, func(reply *proto.StreamEvent) error {
+		return b.add(func() { batch.Events = append(batch.Events, reply) })
+	})
+	if cerr := b.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// StreamKeyRangeBatch is StreamKeyRange, with up to req.BatchSize
+// transactions per reply.
+func (updateStream *UpdateStream) StreamKeyRangeBatch(req *proto.KeyRangeRequest, sendReply func(reply *proto.BinlogTransactionBatch) error) error {
+	send, b := transactionBatcher(req.BatchSize, sendReply)
+	err := updateStream.StreamKeyRange(req, send)
+	if cerr := b.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// StreamTablesBatch is StreamTables, with up to req.BatchSize
+// transactions per reply.
+func (updateStream *UpdateStream) StreamTablesBatch(req *proto.TablesRequest, sendReply func(reply *proto.BinlogTransactionBatch) error) error {
+	send, b := transactionBatcher(req.BatchSize, sendReply)
+	err := updateStream.StreamTables(req, send)
+	if cerr := b.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// transactionBatcher returns a function that batches the transactions
+// it's given, and the batcher to close at the end of the stream.
+func transactionBatcher(requestedSize int, sendReply func(reply *proto.BinlogTransactionBatch) error) (sendTransactionFunc, *batcher) {
+	batch := &proto.BinlogTransactionBatch{}
+	b := newBatcher(batchSize(requestedSize), func() error {
+		reply := batch
+		batch = &proto.BinlogTransactionBatch{}
+		return sendReply(reply)
+	})
+	return func(reply *proto.BinlogTransaction) error {
+		return b.add(func() { batch.Transactions = append(batch.Transactions, reply) })
+	}, b
+}
+
 func (updateStream *UpdateStream) getReplicationPosition() (myproto.GTID, error) {
 	updateStream.actionLock.Lock()
 	defer updateStream.actionLock.Unlock()
@@ -0,0 +1,173 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the remote tablet action code of consultopo.Server
+
+The actions of a tablet are keys under its action/ prefix, numbered
+in order with a counter. Their response is stored under the actionlog/
+prefix, with the same number. As the actions are in the datacenter of
+the cell of the tablet, the action paths start with the cell:
+  /<cell>/vt/tablets/<uid>/action/<number>
+*/
+
+// tabletActionPrefix returns the prefix of the actions of the tablet.
+func tabletActionPrefix(alias topo.TabletAlias) string {
+	return tabletPrefix(alias) + "action/"
+}
+
+// actionLogKey returns the key of the response of the action key.
+func actionLogKey(key string) string {
+	return strings.Replace(key, "/action/", "/actionlog/", 1)
+}
+
+// parseActionPath returns the tablet alias of the action path, and
+// the key of the action in the datacenter of the cell.
+func parseActionPath(actionPath string) (topo.TabletAlias, string, error) {
+	pathParts := strings.Split(actionPath, "/")
+	if len(pathParts) != 7 || pathParts[0] != "" || pathParts[2] != "vt" || pathParts[3] != "tablets" || pathParts[5] != "action" {
+		return topo.TabletAlias{}, "", fmt.Errorf("invalid action path: %v", actionPath)
+	}
+	alias, err := topo.ParseTabletAliasString(pathParts[1] + "-" + pathParts[4])
+	if err != nil {
+		return topo.TabletAlias{}, "", err
+	}
+	return alias, strings.Join(pathParts[2:], "/"), nil
+}
+
+// actionClient returns the client of the cell of the action path, and
+// the key of the action.
+func (cts *Server) actionClient(actionPath string) (Client, string, error) {
+	alias, key, err := parseActionPath(actionPath)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := cts.cellClient(alias.Cell)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, key, nil
+}
+
+// nextActionNumber increments the action counter of the tablet. The
+// numbers are never reused, so an old response can't be mistaken for
+// the response of a new action.
+func nextActionNumber(client Client, alias topo.TabletAlias) (uint64, error) {
+	key := tabletPrefix(alias) + "_ActionSeq"
+	for {
+		pair, _, err := client.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		// index 0 creates it
+		var number, index uint64
+		if pair != nil {
+			if number, err = strconv.ParseUint(string(pair.Value), 10, 64); err != nil {
+				return 0, fmt.Errorf("bad action counter %v: %v", key, err)
+			}
+			index = pair.ModifyIndex
+		}
+		number++
+		ok, err := client.CAS(key, []byte(strconv.FormatUint(number, 10)), index)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return number, nil
+		}
+		// someone else got it, try again
+	}
+}
+
+func (cts *Server) WriteTabletAction(tabletAlias topo.TabletAlias, contents string) (string, error) {
+	client, err := cts.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return "", err
+	}
+	number, err := nextActionNumber(client, tabletAlias)
+	if err != nil {
+		return "", err
+	}
+	// zero-padded so they sort in order
+	key := fmt.Sprintf("%v%020d", tabletActionPrefix(tabletAlias), number)
+	if err := client.Put(key, []byte(contents)); err != nil {
+		return "", err
+	}
+	return "/" + tabletAlias.Cell + "/" + key, nil
+}
+
+func (cts *Server) WaitForTabletAction(actionPath string, waitTime time.Duration, interrupted chan struct{}) (string, error) {
+	client, key, err := cts.actionClient(actionPath)
+	if err != nil {
+		return "", err
+	}
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+
+	logKey := actionLogKey(key)
+	for {
+		pair, index, err := client.Get(logKey)
+		if err != nil {
+			return "", fmt.Errorf("action err: %v %v", actionPath, err)
+		}
+		if pair != nil {
+			return string(pair.Value), nil
+		}
+
+		// wait for the response
+		stop := make(chan struct{})
+		waitErr := make(chan error, 1)
+		go func() {
+			_, err := client.Wait(logKey, index, false, stop)
+			waitErr <- err
+		}()
+
+		select {
+		case err := <-waitErr:
+			if err != nil {
+				log.Warningf("failed to wait for action response %v, trying again: %v", logKey, err)
+			}
+		case <-timer.C:
+			close(stop)
+			return "", topo.ErrTimeout
+		case <-interrupted:
+			close(stop)
+			return "", topo.ErrInterrupted
+		}
+	}
+}
+
+func (cts *Server) PurgeTabletActions(tabletAlias topo.TabletAlias, canBePurged func(data string) bool) error {
+	client, err := cts.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	pairs, _, err := client.List(tabletActionPrefix(tabletAlias))
+	if err != nil {
+		return err
+	}
+
+	// Purge newer items first so the action queues don't try to process something.
+	for i := len(pairs) - 1; i >= 0; i-- {
+		if !canBePurged(string(pairs[i].Value)) {
+			continue
+		}
+		if err := client.Delete(pairs[i].Key); err != nil {
+			return fmt.Errorf("PurgeTabletActions(%v) err: %v", tabletAlias, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the code to support the local agent process for consultopo.Server
+*/
+
+func (cts *Server) ValidateTabletActions(tabletAlias topo.TabletAlias) error {
+	// there are no directories, the actions only need the tablet
+	_, err := cts.GetTablet(tabletAlias)
+	return err
+}
+
+func (cts *Server) CreateTabletPidNode(tabletAlias topo.TabletAlias, contents string, done chan struct{}) error {
+	client, err := cts.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+
+	// the pid key is held by a session, deleted with it when the
+	// process dies, or when done is closed
+	key := tabletPrefix(tabletAlias) + "pid"
+	session, err := cts.newSession(client, "vt pid "+key)
+	if err != nil {
+		return err
+	}
+	ok, err := client.Acquire(key, []byte(contents), session)
+	if err == nil && !ok {
+		err = fmt.Errorf("pid node %v is held by another process", key)
+	}
+	if err != nil {
+		cts.destroySession(client, session)
+		return err
+	}
+
+	go func() {
+		<-done
+		if err := cts.destroySession(client, session); err != nil {
+			log.Warningf("cannot delete pid node %v: %v", key, err)
+		}
+	}()
+	return nil
+}
+
+func (cts *Server) ValidateTabletPidNode(tabletAlias topo.TabletAlias) error {
+	client, err := cts.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	_, err = get(client, tabletPrefix(tabletAlias)+"pid")
+	return err
+}
+
+func (cts *Server) GetSubprocessFlags() []string {
+	return []string{"-consul_global_addrs", *globalAddrs}
+}
+
+// handleActionQueue processes all pending actions, until one fails.
+// No error is returned for action failures. It returns the index to
+// wait for changes of the queue from.
+func (cts *Server) handleActionQueue(client Client, tabletAlias topo.TabletAlias, dispatchAction func(actionPath, data string) error) (uint64, error) {
+	pairs, index, err := client.List(tabletActionPrefix(tabletAlias))
+	if err != nil {
+		return 0, err
+	}
+	for _, pair := range pairs {
+		if err := dispatchAction("/"+tabletAlias.Cell+"/"+pair.Key, string(pair.Value)); err != nil {
+			break
+		}
+	}
+	return index, nil
+}
+
+func (cts *Server) ActionEventLoop(tabletAlias topo.TabletAlias, dispatchAction func(actionPath, data string) error, done chan struct{}) {
+	for {
+		client, err := cts.cellClient(tabletAlias.Cell)
+		if err != nil {
+			log.Warningf("cannot get the cell of %v, will try again in 5 seconds: %v", tabletAlias, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// Process any pending actions when we startup, before
+		// we start listening for events.
+		index, err := cts.handleActionQueue(client, tabletAlias, dispatchAction)
+		if err != nil {
+			log.Warningf("failed to read the action queue, will try again in 5 seconds: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// wait for a change of the queue
+		if _, err := client.Wait(tabletActionPrefix(tabletAlias), index, true, done); err != nil {
+			log.Warningf("failed to wait for the action queue, will try again in 5 seconds: %v", err)
+			time.Sleep(5 * time.Second)
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+func (cts *Server) ReadTabletActionPath(actionPath string) (topo.TabletAlias, string, int64, error) {
+	tabletAlias, key, err := parseActionPath(actionPath)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+	client, err := cts.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+
+	pair, err := get(client, key)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+	return tabletAlias, string(pair.Value), int64(pair.ModifyIndex), nil
+}
+
+func (cts *Server) UpdateTabletAction(actionPath, data string, version int64) error {
+	client, key, err := cts.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		_, err = update(client, key, data)
+		return err
+	}
+	ok, err := client.CAS(key, []byte(data), uint64(version))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return topo.ErrBadVersion
+	}
+	return nil
+}
+
+// StoreTabletActionResponse stores the data both in action and actionlog
+func (cts *Server) StoreTabletActionResponse(actionPath, data string) error {
+	client, key, err := cts.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	if _, err := update(client, key, data); err != nil {
+		return err
+	}
+	return client.Put(actionLogKey(key), []byte(data))
+}
+
+func (cts *Server) UnblockTabletAction(actionPath string) error {
+	client, key, err := cts.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	return client.Delete(key)
+}
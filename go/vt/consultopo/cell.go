@@ -0,0 +1,17 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+/*
+This file contains the cell management methods of consultopo.Server
+*/
+
+func (cts *Server) GetKnownCells() ([]string, error) {
+	keys, _, err := cts.globalClient().Keys(cellsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return childrenNames(cellsPrefix, keys, false), nil
+}
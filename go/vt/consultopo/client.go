@@ -0,0 +1,304 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+/*
+This file contains a minimal client for the Consul KV and session
+APIs, with only what consultopo.Server needs.
+*/
+
+// KVPair is a key of the Consul KV store.
+type KVPair struct {
+	Key         string
+	CreateIndex uint64
+	ModifyIndex uint64
+	LockIndex   uint64
+	Flags       uint64
+	Value       []byte
+	Session     string
+}
+
+// Client is the part of the Consul API used by consultopo.Server.
+// The keys don't start with a slash. The indexes returned with the
+// results are the index of the KV store, to pass to Wait.
+type Client interface {
+	// Get returns the pair of key, or nil if it doesn't exist.
+	Get(key string) (*KVPair, uint64, error)
+
+	// List returns the pairs of the keys starting with prefix.
+	List(prefix string) ([]*KVPair, uint64, error)
+
+	// Keys returns the keys right under prefix, and the prefixes
+	// of the keys further down, ending with a slash.
+	Keys(prefix string) ([]string, uint64, error)
+
+	// Put sets key.
+	Put(key string, value []byte) error
+
+	// CAS sets key if its ModifyIndex is index. Index 0 creates
+	// the key if it doesn't exist. Returns false if it wasn't set.
+	CAS(key string, value []byte, index uint64) (bool, error)
+
+	// Acquire sets key and locks it with the session, if no other
+	// session holds it. Returns false if it wasn't set.
+	Acquire(key string, value []byte, session string) (bool, error)
+
+	// Delete deletes key, it is not an error if it doesn't exist.
+	Delete(key string) error
+
+	// DeleteTree deletes the keys starting with prefix.
+	DeleteTree(prefix string) error
+
+	// DeleteCAS deletes key if its ModifyIndex is index. Returns
+	// false if it wasn't deleted.
+	DeleteCAS(key string, index uint64) (bool, error)
+
+	// Wait blocks until the index of key (or of the keys starting
+	// with key if prefix is set) is after index, and returns the
+	// new index. It can also return after a while without a
+	// change, or when stop is closed.
+	Wait(key string, index uint64, prefix bool, stop chan struct{}) (uint64, error)
+
+	// CreateSession creates a session that expires if it is not
+	// renewed within ttl. The keys it holds are deleted when it
+	// expires or is destroyed.
+	CreateSession(name string, ttl time.Duration) (string, error)
+
+	// RenewSession renews the session.
+	RenewSession(id string) error
+
+	// DestroySession destroys the session.
+	DestroySession(id string) error
+}
+
+// httpClient is the Client talking to Consul over http. The requests
+// go to the first address, and to the next ones if it is down.
+type httpClient struct {
+	addrs     []string
+	transport *http.Transport
+	// client is used for the requests, watcher for the blocking
+	// queries that last longer.
+	client  *http.Client
+	watcher *http.Client
+}
+
+// NewClient returns a Client for the Consul servers or agents at addrs
+// (like "http://localhost:8500").
+func NewClient(addrs []string) Client {
+	transport := &http.Transport{}
+	return &httpClient{
+		addrs:     addrs,
+		transport: transport,
+		client:    &http.Client{Transport: transport, Timeout: *consulTimeout},
+		watcher:   &http.Client{Transport: transport, Timeout: *consulWaitTime + *consulTimeout},
+	}
+}
+
+func (c *httpClient) Get(key string) (*KVPair, uint64, error) {
+	var pairs []*KVPair
+	index, err := c.doJSON("GET", "/v1/kv/"+key, nil, nil, &pairs)
+	if err != nil || len(pairs) == 0 {
+		return nil, index, err
+	}
+	return pairs[0], index, nil
+}
+
+func (c *httpClient) List(prefix string) ([]*KVPair, uint64, error) {
+	var pairs []*KVPair
+	index, err := c.doJSON("GET", "/v1/kv/"+prefix, url.Values{"recurse": {""}}, nil, &pairs)
+	return pairs, index, err
+}
+
+func (c *httpClient) Keys(prefix string) ([]string, uint64, error) {
+	var keys []string
+	index, err := c.doJSON("GET", "/v1/kv/"+prefix, url.Values{"keys": {""}, "separator": {"/"}}, nil, &keys)
+	return keys, index, err
+}
+
+func (c *httpClient) Put(key string, value []byte) error {
+	_, err := c.doBool("PUT", "/v1/kv/"+key, nil, value)
+	return err
+}
+
+func (c *httpClient) CAS(key string, value []byte, index uint64) (bool, error) {
+	return c.doBool("PUT", "/v1/kv/"+key, url.Values{"cas": {strconv.FormatUint(index, 10)}}, value)
+}
+
+func (c *httpClient) Acquire(key string, value []byte, session string) (bool, error) {
+	return c.doBool("PUT", "/v1/kv/"+key, url.Values{"acquire": {session}}, value)
+}
+
+func (c *httpClient) Delete(key string) error {
+	_, err := c.doBool("DELETE", "/v1/kv/"+key, nil, nil)
+	return err
+}
+
+func (c *httpClient) DeleteTree(prefix string) error {
+	_, err := c.doBool("DELETE", "/v1/kv/"+prefix, url.Values{"recurse": {""}}, nil)
+	return err
+}
+
+func (c *httpClient) DeleteCAS(key string, index uint64) (bool, error) {
+	return c.doBool("DELETE", "/v1/kv/"+key, url.Values{"cas": {strconv.FormatUint(index, 10)}}, nil)
+}
+
+func (c *httpClient) Wait(key string, index uint64, prefix bool, stop chan struct{}) (uint64, error) {
+	params := url.Values{
+		"index": {strconv.FormatUint(index, 10)},
+		"wait":  {fmt.Sprintf("%vs", int(consulWaitTime.Seconds()))},
+	}
+	if prefix {
+		params.Set("recurse", "")
+	}
+	resp, err := c.do("GET", "/v1/kv/"+key, params, nil, stop)
+	select {
+	case <-stop:
+		if err == nil {
+			resp.Body.Close()
+		}
+		return index, nil
+	default:
+	}
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return 0, fmt.Errorf("consul returned %v", resp.Status)
+	}
+	return consulIndex(resp), nil
+}
+
+func (c *httpClient) CreateSession(name string, ttl time.Duration) (string, error) {
+	body := fmt.Sprintf(`{"Name": %q, "TTL": "%vs", "Behavior": "delete"}`, name, int(ttl.Seconds()))
+	result := struct{ ID string }{}
+	if _, err := c.doJSON("PUT", "/v1/session/create", nil, []byte(body), &result); err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+func (c *httpClient) RenewSession(id string) error {
+	var result []interface{}
+	if _, err := c.doJSON("PUT", "/v1/session/renew/"+id, nil, nil, &result); err != nil {
+		return err
+	}
+	if len(result) == 0 {
+		return fmt.Errorf("session %v doesn't exist", id)
+	}
+	return nil
+}
+
+func (c *httpClient) DestroySession(id string) error {
+	_, err := c.doBool("PUT", "/v1/session/destroy/"+id, nil, nil)
+	return err
+}
+
+// consulIndex returns the X-Consul-Index of the response.
+func consulIndex(resp *http.Response) uint64 {
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return index
+}
+
+// doJSON sends the request and decodes the JSON response into result.
+// A missing key is not an error, result is left untouched.
+func (c *httpClient) doJSON(method, path string, params url.Values, body []byte, result interface{}) (uint64, error) {
+	resp, err := c.do(method, path, params, body, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/v1/kv/"):
+		return consulIndex(resp), nil
+	case resp.StatusCode != http.StatusOK:
+		return 0, fmt.Errorf("consul returned %v: %v", resp.Status, string(data))
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return 0, fmt.Errorf("bad consul response %v: %v", string(data), err)
+	}
+	return consulIndex(resp), nil
+}
+
+// doBool sends the request and returns its true / false response.
+func (c *httpClient) doBool(method, path string, params url.Values, body []byte) (bool, error) {
+	resp, err := c.do(method, path, params, body, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("consul returned %v: %v", resp.Status, string(data))
+	}
+	return strings.TrimSpace(string(data)) == "true", nil
+}
+
+// do sends the request to the first address that answers. If stop
+// is set, the request is a blocking query, cancelled when stop is
+// closed.
+func (c *httpClient) do(method, path string, params url.Values, body []byte, stop chan struct{}) (*http.Response, error) {
+	var lastErr error
+	for _, addr := range c.addrs {
+		u := strings.TrimRight(addr, "/") + path
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, u, reader)
+		if err != nil {
+			return nil, err
+		}
+
+		client := c.client
+		if stop != nil {
+			client = c.watcher
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-stop:
+					c.transport.CancelRequest(req)
+				case <-finished:
+				}
+			}()
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			// try the next server
+			log.Warningf("consul request to %v failed: %v", addr, err)
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no consul server available: %v", lastErr)
+}
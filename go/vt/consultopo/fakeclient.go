@@ -0,0 +1,243 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+This file contains an in-memory Client, for tests. Its sessions don't
+expire, they have to be destroyed.
+*/
+
+type fakeChange struct {
+	key   string
+	index uint64
+}
+
+type fakeClient struct {
+	mu       sync.Mutex
+	index    uint64
+	pairs    map[string]*KVPair
+	sessions map[string]bool
+	changes  []fakeChange
+	// changed is closed and replaced at every change
+	changed chan struct{}
+}
+
+// NewFakeClient returns an empty in-memory Client.
+func NewFakeClient() Client {
+	return &fakeClient{
+		pairs:    make(map[string]*KVPair),
+		sessions: make(map[string]bool),
+		changed:  make(chan struct{}),
+	}
+}
+
+// set stores the new value of key, or deletes it if value is nil.
+func (fc *fakeClient) set(key string, value []byte, session string) {
+	fc.index++
+	if value == nil {
+		delete(fc.pairs, key)
+	} else {
+		pair := &KVPair{Key: key, CreateIndex: fc.index, ModifyIndex: fc.index, Value: value, Session: session}
+		if old := fc.pairs[key]; old != nil {
+			pair.CreateIndex = old.CreateIndex
+			pair.LockIndex = old.LockIndex
+		}
+		if session != "" {
+			pair.LockIndex++
+		}
+		fc.pairs[key] = pair
+	}
+	fc.changes = append(fc.changes, fakeChange{key, fc.index})
+	close(fc.changed)
+	fc.changed = make(chan struct{})
+}
+
+func copyPair(pair *KVPair) *KVPair {
+	result := *pair
+	return &result
+}
+
+func (fc *fakeClient) Get(key string) (*KVPair, uint64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if pair := fc.pairs[key]; pair != nil {
+		return copyPair(pair), fc.index, nil
+	}
+	return nil, fc.index, nil
+}
+
+func (fc *fakeClient) List(prefix string) ([]*KVPair, uint64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	var result []*KVPair
+	for key, pair := range fc.pairs {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, copyPair(pair))
+		}
+	}
+	sort.Sort(pairsByKey(result))
+	return result, fc.index, nil
+}
+
+type pairsByKey []*KVPair
+
+func (p pairsByKey) Len() int           { return len(p) }
+func (p pairsByKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pairsByKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
+
+func (fc *fakeClient) Keys(prefix string) ([]string, uint64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	seen := make(map[string]bool)
+	var result []string
+	for key := range fc.pairs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], "/"); i >= 0 {
+			key = key[:len(prefix)+i+1]
+		}
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result, fc.index, nil
+}
+
+func (fc *fakeClient) Put(key string, value []byte) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	session := ""
+	if old := fc.pairs[key]; old != nil {
+		session = old.Session
+	}
+	fc.set(key, value, session)
+	return nil
+}
+
+func (fc *fakeClient) CAS(key string, value []byte, index uint64) (bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	old := fc.pairs[key]
+	switch {
+	case index == 0 && old != nil:
+		return false, nil
+	case index != 0 && (old == nil || old.ModifyIndex != index):
+		return false, nil
+	}
+	session := ""
+	if old != nil {
+		session = old.Session
+	}
+	fc.set(key, value, session)
+	return true, nil
+}
+
+func (fc *fakeClient) Acquire(key string, value []byte, session string) (bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if !fc.sessions[session] {
+		return false, fmt.Errorf("invalid session %v", session)
+	}
+	if old := fc.pairs[key]; old != nil && old.Session != "" && old.Session != session {
+		return false, nil
+	}
+	fc.set(key, value, session)
+	return true, nil
+}
+
+func (fc *fakeClient) Delete(key string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.pairs[key] != nil {
+		fc.set(key, nil, "")
+	}
+	return nil
+}
+
+func (fc *fakeClient) DeleteTree(prefix string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for key := range fc.pairs {
+		if strings.HasPrefix(key, prefix) {
+			fc.set(key, nil, "")
+		}
+	}
+	return nil
+}
+
+func (fc *fakeClient) DeleteCAS(key string, index uint64) (bool, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if old := fc.pairs[key]; old == nil || old.ModifyIndex != index {
+		return false, nil
+	}
+	fc.set(key, nil, "")
+	return true, nil
+}
+
+func (fc *fakeClient) Wait(key string, index uint64, prefix bool, stop chan struct{}) (uint64, error) {
+	for {
+		fc.mu.Lock()
+		for _, change := range fc.changes {
+			if change.index <= index {
+				continue
+			}
+			if change.key == key || (prefix && strings.HasPrefix(change.key, key)) {
+				fc.mu.Unlock()
+				return change.index, nil
+			}
+		}
+		changed := fc.changed
+		fc.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-stop:
+			return index, nil
+		}
+	}
+}
+
+func (fc *fakeClient) CreateSession(name string, ttl time.Duration) (string, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.index++
+	id := fmt.Sprintf("session-%v", fc.index)
+	fc.sessions[id] = true
+	return id, nil
+}
+
+func (fc *fakeClient) RenewSession(id string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if !fc.sessions[id] {
+		return fmt.Errorf("session %v doesn't exist", id)
+	}
+	return nil
+}
+
+func (fc *fakeClient) DestroySession(id string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.sessions, id)
+	// the keys it holds are deleted
+	for key, pair := range fc.pairs {
+		if pair.Session == id {
+			fc.set(key, nil, "")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the global records copies management code of
+consultopo.Server
+
+The copy of a keyspace is the vt/globalcopy/<keyspace> key of the
+datacenter of the cell.
+*/
+
+const (
+	globalCopyPrefix = "vt/globalcopy/"
+)
+
+func (cts *Server) UpdateGlobalCopy(cell, keyspace string, gc *topo.GlobalCopy) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return client.Put(globalCopyPrefix+keyspace, []byte(jscfg.ToJson(gc)))
+}
+
+func (cts *Server) GetGlobalCopy(cell, keyspace string) (*topo.GlobalCopy, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, globalCopyPrefix+keyspace)
+	if err != nil {
+		return nil, err
+	}
+	gc := &topo.GlobalCopy{}
+	if err := json.Unmarshal(pair.Value, gc); err != nil {
+		return nil, fmt.Errorf("GlobalCopy unmarshal failed: %v %v", string(pair.Value), err)
+	}
+	return gc, nil
+}
+
+func (cts *Server) GetGlobalCopyKeyspaces(cell string) ([]string, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := client.Keys(globalCopyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return childrenNames(globalCopyPrefix, keys, false), nil
+}
+
+func (cts *Server) DeleteGlobalCopy(cell, keyspace string) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return remove(client, globalCopyPrefix+keyspace)
+}
@@ -0,0 +1,89 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the Keyspace management code for consultopo.Server
+*/
+
+const (
+	globalKeyspacesPrefix = "vt/keyspaces/"
+)
+
+func keyspacePrefix(keyspace string) string {
+	return globalKeyspacesPrefix + keyspace + "/"
+}
+
+func shardsPrefix(keyspace string) string {
+	return keyspacePrefix(keyspace) + "shards/"
+}
+
+func (cts *Server) CreateKeyspace(keyspace string, value *topo.Keyspace) error {
+	if err := create(cts.globalClient(), keyspacePrefix(keyspace)+dataKey, jscfg.ToJson(value)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, value),
+		Status:       "created",
+	})
+	return nil
+}
+
+func (cts *Server) UpdateKeyspace(ki *topo.KeyspaceInfo) error {
+	if _, err := update(cts.globalClient(), keyspacePrefix(ki.KeyspaceName())+dataKey, jscfg.ToJson(ki.Keyspace)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *ki,
+		Status:       "updated",
+	})
+	return nil
+}
+
+func (cts *Server) GetKeyspace(keyspace string) (*topo.KeyspaceInfo, error) {
+	pair, err := get(cts.globalClient(), keyspacePrefix(keyspace)+dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &topo.Keyspace{}
+	if err = json.Unmarshal(pair.Value, k); err != nil {
+		return nil, fmt.Errorf("bad keyspace data %v", err)
+	}
+
+	return topo.NewKeyspaceInfo(keyspace, k), nil
+}
+
+func (cts *Server) GetKeyspaces() ([]string, error) {
+	keys, _, err := cts.globalClient().Keys(globalKeyspacesPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return childrenNames(globalKeyspacesPrefix, keys, true), nil
+}
+
+func (cts *Server) DeleteKeyspaceShards(keyspace string) error {
+	if err := cts.globalClient().DeleteTree(shardsPrefix(keyspace)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, nil),
+		Status:       "deleted all shards",
+	})
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the lock management code for consultopo.Server
+*/
+
+// lockForAction acquires the lock key of prefix with a new session,
+// waiting for the current holder to release it. The lock path is the
+// id of the session.
+func (cts *Server) lockForAction(client Client, prefix, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	key := prefix + lockKey
+	session, err := cts.newSession(client, "vt lock "+key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create action lock session: %v %v", key, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		ok, err := client.Acquire(key, []byte(contents), session)
+		if err != nil {
+			cts.destroySession(client, session)
+			return "", fmt.Errorf("failed to obtain action lock: %v %v", key, err)
+		}
+		if ok {
+			return session, nil
+		}
+
+		// wait for the lock to change
+		pair, index, err := client.Get(key)
+		if err != nil {
+			cts.destroySession(client, session)
+			return "", fmt.Errorf("failed to read action lock: %v %v", key, err)
+		}
+		if pair == nil || pair.Session == "" {
+			// just released
+			continue
+		}
+		stop := make(chan struct{})
+		waitErr := make(chan error, 1)
+		go func() {
+			_, err := client.Wait(key, index, false, stop)
+			waitErr <- err
+		}()
+
+		select {
+		case err := <-waitErr:
+			if err != nil {
+				log.Warningf("failed to wait for action lock %v, trying again: %v", key, err)
+			}
+			continue
+		case <-timer.C:
+			err = topo.ErrTimeout
+		case <-interrupted:
+			err = topo.ErrInterrupted
+		}
+		close(stop)
+		cts.destroySession(client, session)
+		log.Warningf("------ Most likely blocking action: %v\n%v", key, string(pair.Value))
+		return "", err
+	}
+}
+
+// unlockForAction releases the lock of prefix held by the session
+// lockPath. The lock key is deleted before the session is destroyed,
+// or Consul would prevent other sessions from acquiring it for the
+// lock-delay. Consul keys don't expire, so the results are only
+// logged.
+func (cts *Server) unlockForAction(client Client, prefix, lockPath, results string) error {
+	key := prefix + lockKey
+	pair, _, err := client.Get(key)
+	if err != nil {
+		return err
+	}
+	if pair == nil || pair.Session != lockPath {
+		return fmt.Errorf("action lock %v is not held by %v", key, lockPath)
+	}
+	if _, err := client.DeleteCAS(key, pair.ModifyIndex); err != nil {
+		return err
+	}
+	log.Infof("Released action lock %v: %v", key, results)
+	return cts.destroySession(client, lockPath)
+}
+
+func (cts *Server) LockKeyspaceForAction(keyspace, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	// the keyspace has to exist
+	if _, err := cts.GetKeyspace(keyspace); err != nil {
+		return "", err
+	}
+	return cts.lockForAction(cts.globalClient(), keyspacePrefix(keyspace), contents, timeout, interrupted)
+}
+
+func (cts *Server) UnlockKeyspaceForAction(keyspace, lockPath, results string) error {
+	return cts.unlockForAction(cts.globalClient(), keyspacePrefix(keyspace), lockPath, results)
+}
+
+func (cts *Server) LockShardForAction(keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	// the shard has to exist
+	if _, err := cts.GetShard(keyspace, shard); err != nil {
+		return "", err
+	}
+	return cts.lockForAction(cts.globalClient(), shardPrefix(keyspace, shard), contents, timeout, interrupted)
+}
+
+func (cts *Server) UnlockShardForAction(keyspace, shard, lockPath, results string) error {
+	return cts.unlockForAction(cts.globalClient(), shardPrefix(keyspace, shard), lockPath, results)
+}
+
+func (cts *Server) LockSrvShardForAction(cell, keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return "", err
+	}
+	return cts.lockForAction(client, srvShardPrefix(keyspace, shard), contents, timeout, interrupted)
+}
+
+func (cts *Server) UnlockSrvShardForAction(cell, keyspace, shard, lockPath, results string) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return cts.unlockForAction(client, srvShardPrefix(keyspace, shard), lockPath, results)
+}
+
+// getActionLock returns the lock of prefix, and the session that
+// holds it.
+func getActionLock(client Client, prefix string) (string, string, error) {
+	pair, err := get(client, prefix+lockKey)
+	if err != nil {
+		return "", "", err
+	}
+	if pair.Session == "" {
+		// released, but not deleted yet
+		return "", "", topo.ErrNoNode
+	}
+	return pair.Session, string(pair.Value), nil
+}
+
+func (cts *Server) GetKeyspaceActionLock(keyspace string) (string, string, error) {
+	return getActionLock(cts.globalClient(), keyspacePrefix(keyspace))
+}
+
+func (cts *Server) GetShardActionLock(keyspace, shard string) (string, string, error) {
+	return getActionLock(cts.globalClient(), shardPrefix(keyspace, shard))
+}
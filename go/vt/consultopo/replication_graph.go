@@ -0,0 +1,81 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the replication graph management code for consultopo.Server
+*/
+
+func shardReplicationKey(keyspace, shard string) string {
+	return "vt/replication/" + keyspace + "/" + shard
+}
+
+func (cts *Server) UpdateShardReplicationFields(cell, keyspace, shard string, update func(*topo.ShardReplication) error) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+
+	key := shardReplicationKey(keyspace, shard)
+	for {
+		sr := &topo.ShardReplication{}
+		pair, _, err := client.Get(key)
+		if err != nil {
+			return err
+		}
+		// index 0 creates it
+		var index uint64
+		if pair != nil {
+			if err := json.Unmarshal(pair.Value, sr); err != nil {
+				return fmt.Errorf("bad ShardReplication data %v", err)
+			}
+			index = pair.ModifyIndex
+		}
+
+		if err := update(sr); err != nil {
+			return err
+		}
+
+		ok, err := client.CAS(key, []byte(jscfg.ToJson(sr)), index)
+		if err != nil || ok {
+			return err
+		}
+		// someone else changed it, try again
+	}
+}
+
+func (cts *Server) GetShardReplication(cell, keyspace, shard string) (*topo.ShardReplicationInfo, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, shardReplicationKey(keyspace, shard))
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &topo.ShardReplication{}
+	if err = json.Unmarshal(pair.Value, sr); err != nil {
+		return nil, fmt.Errorf("bad ShardReplication data %v", err)
+	}
+
+	return topo.NewShardReplicationInfo(sr, cell, keyspace, shard), nil
+}
+
+func (cts *Server) DeleteShardReplication(cell, keyspace, shard string) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return remove(client, shardReplicationKey(keyspace, shard))
+}
@@ -0,0 +1,255 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package consultopo implements topo.Server with Consul.
+//
+// The keyspaces, shards and their locks are in the KV store of a
+// global Consul datacenter, the tablets, the replication graph and the
+// serving graph in the datacenter of each cell. The cells are
+// registered in the global KV store, with the comma separated
+// addresses of their Consul servers or agents:
+//
+//	curl -X PUT -d http://host1:8500,http://host2:8500 \
+//	    http://global:8500/v1/kv/vt/cells/<cell>
+//
+// The objects that have children store their data in a _Data key
+// under their prefix. The locks, and the pid keys of the tablets, are
+// held by sessions that are renewed while the process holds them, so
+// they are released if it dies.
+package consultopo
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	globalAddrs    = flag.String("consul_global_addrs", "", "comma separated addresses of the Consul servers or agents of the global datacenter, like http://host1:8500,http://host2:8500")
+	consulTimeout  = flag.Duration("consul_timeout", 10*time.Second, "timeout of the Consul requests, except the blocking queries")
+	consulWaitTime = flag.Duration("consul_wait_time", 30*time.Second, "longest time a Consul blocking query waits for a change")
+	sessionTTL     = flag.Duration("consul_session_ttl", 15*time.Second, "expiration of the Consul sessions of the locks and pid keys, renewed while they are held")
+)
+
+const (
+	// dataKey is the key of the data of a prefix
+	dataKey = "_Data"
+
+	// lockKey is the key of the action lock of a prefix
+	lockKey = "_Lock"
+
+	// cellsPrefix is the prefix of the cells, in the global KV store
+	cellsPrefix = "vt/cells/"
+)
+
+// Server is the Consul topo.Server implementation.
+type Server struct {
+	// newClient creates the clients of the datacenters
+	newClient func(addrs []string) Client
+
+	// mu protects global, cells and sessions
+	mu     sync.Mutex
+	global Client
+	cells  map[string]Client
+	// sessions has the renewal stop channel of the sessions
+	sessions map[string]chan struct{}
+}
+
+// NewServer can be used to create a custom Server (for tests for
+// instance) but it cannot change the globally registered one. The
+// clients are created with newClient, the global one the first time
+// it is used.
+func NewServer(newClient func(addrs []string) Client) *Server {
+	return &Server{
+		newClient: newClient,
+		cells:     make(map[string]Client),
+		sessions:  make(map[string]chan struct{}),
+	}
+}
+
+func init() {
+	topo.RegisterServer("consul", NewServer(NewClient))
+}
+
+func (cts *Server) Close() {
+}
+
+// splitAddrs parses a comma separated list of addresses.
+func splitAddrs(addrs string) []string {
+	result := make([]string, 0, 3)
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// globalClient returns the client of the global datacenter.
+func (cts *Server) globalClient() Client {
+	cts.mu.Lock()
+	defer cts.mu.Unlock()
+	if cts.global == nil {
+		cts.global = cts.newClient(splitAddrs(*globalAddrs))
+	}
+	return cts.global
+}
+
+// cellClient returns the client of the datacenter of cell, reading
+// its addresses from the global KV store. Returns topo.ErrNoNode for
+// an unknown cell.
+func (cts *Server) cellClient(cell string) (Client, error) {
+	cts.mu.Lock()
+	client, ok := cts.cells[cell]
+	cts.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	pair, _, err := cts.globalClient().Get(cellsPrefix + cell)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, topo.ErrNoNode
+	}
+
+	cts.mu.Lock()
+	defer cts.mu.Unlock()
+	if client, ok := cts.cells[cell]; ok {
+		return client, nil
+	}
+	client = cts.newClient(splitAddrs(string(pair.Value)))
+	cts.cells[cell] = client
+	return client, nil
+}
+
+// childrenNames returns the sorted names of the keys right under
+// prefix, as returned by Client.Keys. If dirs is set, only the
+// prefixes of keys further down are returned, otherwise only the keys.
+func childrenNames(prefix string, keys []string, dirs bool) []string {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		isDir := strings.HasSuffix(name, "/")
+		if name == "" || isDir != dirs {
+			continue
+		}
+		result = append(result, strings.TrimSuffix(name, "/"))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// create creates key, or returns topo.ErrNodeExists.
+func create(client Client, key string, value string) error {
+	ok, err := client.CAS(key, []byte(value), 0)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return topo.ErrNodeExists
+	}
+	return nil
+}
+
+// update sets the existing key, or returns topo.ErrNoNode.
+func update(client Client, key string, value string) (uint64, error) {
+	for {
+		pair, _, err := client.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if pair == nil {
+			return 0, topo.ErrNoNode
+		}
+		ok, err := client.CAS(key, []byte(value), pair.ModifyIndex)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			// the new index is only known by reading it back
+			pair, _, err = client.Get(key)
+			if err != nil || pair == nil {
+				return 0, err
+			}
+			return pair.ModifyIndex, nil
+		}
+		// someone else changed it, try again
+	}
+}
+
+// get returns the value of key, or topo.ErrNoNode.
+func get(client Client, key string) (*KVPair, error) {
+	pair, _, err := client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, topo.ErrNoNode
+	}
+	return pair, nil
+}
+
+// remove deletes the existing key, or returns topo.ErrNoNode.
+func remove(client Client, key string) error {
+	for {
+		pair, err := get(client, key)
+		if err != nil {
+			return err
+		}
+		ok, err := client.DeleteCAS(key, pair.ModifyIndex)
+		if err != nil || ok {
+			return err
+		}
+		// someone else changed it, try again
+	}
+}
+
+// newSession creates a session, and renews it until it is destroyed
+// by destroySession.
+func (cts *Server) newSession(client Client, name string) (string, error) {
+	id, err := client.CreateSession(name, *sessionTTL)
+	if err != nil {
+		return "", err
+	}
+	stop := make(chan struct{})
+	cts.mu.Lock()
+	cts.sessions[id] = stop
+	cts.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(*sessionTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := client.RenewSession(id); err != nil {
+					log.Warningf("cannot renew Consul session %v (%v): %v", id, name, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return id, nil
+}
+
+// destroySession stops renewing the session, and destroys it, which
+// deletes the keys it holds.
+func (cts *Server) destroySession(client Client, id string) error {
+	cts.mu.Lock()
+	stop, ok := cts.sessions[id]
+	delete(cts.sessions, id)
+	cts.mu.Unlock()
+	if ok {
+		close(stop)
+	}
+	return client.DestroySession(id)
+}
@@ -0,0 +1,213 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph management code of consultopo.Server
+*/
+
+const (
+	servingPrefix = "vt/ns/"
+)
+
+func srvKeyspacePrefix(keyspace string) string {
+	return servingPrefix + keyspace + "/"
+}
+
+func srvShardPrefix(keyspace, shard string) string {
+	return srvKeyspacePrefix(keyspace) + shard + "/"
+}
+
+func endPointsKey(keyspace, shard string, tabletType topo.TabletType) string {
+	return srvShardPrefix(keyspace, shard) + string(tabletType)
+}
+
+func (cts *Server) GetSrvTabletTypesPerShard(cell, keyspace, shard string) ([]topo.TabletType, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := client.Keys(srvShardPrefix(keyspace, shard))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, topo.ErrNoNode
+	}
+	children := childrenNames(srvShardPrefix(keyspace, shard), keys, false)
+	result := make([]topo.TabletType, 0, len(children))
+	for _, tt := range children {
+		// _Data and _Lock are not types
+		if strings.HasPrefix(tt, "_") {
+			continue
+		}
+		result = append(result, topo.TabletType(tt))
+	}
+	return result, nil
+}
+
+func (cts *Server) UpdateEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, addrs *topo.EndPoints) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return client.Put(endPointsKey(keyspace, shard, tabletType), []byte(jscfg.ToJson(addrs)))
+}
+
+func (cts *Server) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, endPointsKey(keyspace, shard, tabletType))
+	if err != nil {
+		return nil, err
+	}
+	result := &topo.EndPoints{}
+	if len(pair.Value) > 0 {
+		if err := json.Unmarshal(pair.Value, result); err != nil {
+			return nil, fmt.Errorf("EndPoints unmarshal failed: %v %v", string(pair.Value), err)
+		}
+	}
+	return result, nil
+}
+
+func (cts *Server) DeleteEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return remove(client, endPointsKey(keyspace, shard, tabletType))
+}
+
+func (cts *Server) UpdateSrvShard(cell, keyspace, shard string, srvShard *topo.SrvShard) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return client.Put(srvShardPrefix(keyspace, shard)+dataKey, []byte(jscfg.ToJson(srvShard)))
+}
+
+func (cts *Server) GetSrvShard(cell, keyspace, shard string) (*topo.SrvShard, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, srvShardPrefix(keyspace, shard)+dataKey)
+	if err != nil {
+		return nil, err
+	}
+	srvShard := topo.NewSrvShard(int64(pair.ModifyIndex))
+	if len(pair.Value) > 0 {
+		if err := json.Unmarshal(pair.Value, srvShard); err != nil {
+			return nil, fmt.Errorf("SrvShard unmarshal failed: %v %v", string(pair.Value), err)
+		}
+	}
+	return srvShard, nil
+}
+
+func (cts *Server) DeleteSrvShard(cell, keyspace, shard string) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return remove(client, srvShardPrefix(keyspace, shard)+dataKey)
+}
+
+func (cts *Server) UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return client.Put(srvKeyspacePrefix(keyspace)+dataKey, []byte(jscfg.ToJson(srvKeyspace)))
+}
+
+func (cts *Server) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, srvKeyspacePrefix(keyspace)+dataKey)
+	if err != nil {
+		return nil, err
+	}
+	srvKeyspace := topo.NewSrvKeyspace(int64(pair.ModifyIndex))
+	if len(pair.Value) > 0 {
+		if err := json.Unmarshal(pair.Value, srvKeyspace); err != nil {
+			return nil, fmt.Errorf("SrvKeyspace unmarshal failed: %v %v", string(pair.Value), err)
+		}
+	}
+	return srvKeyspace, nil
+}
+
+func (cts *Server) GetSrvKeyspaceNames(cell string) ([]string, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := client.Keys(servingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return childrenNames(servingPrefix, keys, true), nil
+}
+
+func (cts *Server) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, addr *topo.EndPoint) error {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return err
+	}
+
+	key := endPointsKey(keyspace, shard, tabletType)
+	for {
+		pair, _, err := client.Get(key)
+		if err != nil {
+			return err
+		}
+		if pair == nil {
+			// We haven't been placed in the serving graph
+			// yet, so don't update. Assume the next process
+			// that rebuilds the graph will get the updated
+			// tablet location.
+			return nil
+		}
+
+		addrs := topo.NewEndPoints()
+		if len(pair.Value) > 0 {
+			if err := json.Unmarshal(pair.Value, addrs); err != nil {
+				return fmt.Errorf("EndPoints unmarshal failed: %v %v", string(pair.Value), err)
+			}
+		}
+		foundTablet := false
+		for i, entry := range addrs.Entries {
+			if entry.Uid == addr.Uid {
+				foundTablet = true
+				if topo.EndPointEquality(&entry, addr) {
+					return nil
+				}
+				addrs.Entries[i] = *addr
+				break
+			}
+		}
+		if !foundTablet {
+			addrs.Entries = append(addrs.Entries, *addr)
+		}
+
+		ok, err := client.CAS(key, []byte(jscfg.ToJson(addrs)), pair.ModifyIndex)
+		if err != nil || ok {
+			return err
+		}
+		// someone else changed it, try again
+	}
+}
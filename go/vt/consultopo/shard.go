@@ -0,0 +1,98 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the shard management code for consultopo.Server
+*/
+
+func shardPrefix(keyspace, shard string) string {
+	return shardsPrefix(keyspace) + shard + "/"
+}
+
+func (cts *Server) CreateShard(keyspace, shard string, value *topo.Shard) error {
+	if err := create(cts.globalClient(), shardPrefix(keyspace, shard)+dataKey, jscfg.ToJson(value)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, value),
+		Status:    "created",
+	})
+	return nil
+}
+
+func (cts *Server) UpdateShard(si *topo.ShardInfo) error {
+	if _, err := update(cts.globalClient(), shardPrefix(si.Keyspace(), si.ShardName())+dataKey, jscfg.ToJson(si.Shard)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *si,
+		Status:    "updated",
+	})
+	return nil
+}
+
+func (cts *Server) ValidateShard(keyspace, shard string) error {
+	_, err := cts.GetShard(keyspace, shard)
+	return err
+}
+
+func (cts *Server) GetShard(keyspace, shard string) (*topo.ShardInfo, error) {
+	pair, err := get(cts.globalClient(), shardPrefix(keyspace, shard)+dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &topo.Shard{}
+	if err = json.Unmarshal(pair.Value, s); err != nil {
+		return nil, fmt.Errorf("bad shard data %v", err)
+	}
+
+	return topo.NewShardInfo(keyspace, shard, s), nil
+}
+
+func (cts *Server) GetShardCritical(keyspace, shard string) (*topo.ShardInfo, error) {
+	return cts.GetShard(keyspace, shard)
+}
+
+func (cts *Server) GetShardNames(keyspace string) ([]string, error) {
+	// there are no directories, check the keyspace exists
+	if _, err := cts.GetKeyspace(keyspace); err != nil {
+		return nil, err
+	}
+	keys, _, err := cts.globalClient().Keys(shardsPrefix(keyspace))
+	if err != nil {
+		return nil, err
+	}
+	return childrenNames(shardsPrefix(keyspace), keys, true), nil
+}
+
+func (cts *Server) DeleteShard(keyspace, shard string) error {
+	client := cts.globalClient()
+	if _, err := get(client, shardPrefix(keyspace, shard)+dataKey); err != nil {
+		return err
+	}
+	if err := client.DeleteTree(shardPrefix(keyspace, shard)); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, nil),
+		Status:    "deleted",
+	})
+	return nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the tablet management parts of consultopo.Server
+*/
+
+const (
+	tabletsPrefix = "vt/tablets/"
+)
+
+// tabletPrefix returns the prefix of the tablet, in its cell.
+func tabletPrefix(alias topo.TabletAlias) string {
+	return tabletsPrefix + alias.TabletUidStr() + "/"
+}
+
+func tabletFromJson(data []byte) (*topo.Tablet, error) {
+	t := &topo.Tablet{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (cts *Server) CreateTablet(tablet *topo.Tablet) error {
+	client, err := cts.cellClient(tablet.Alias.Cell)
+	if err != nil {
+		return err
+	}
+	if err := create(client, tabletPrefix(tablet.Alias)+dataKey, tablet.Json()); err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet,
+		Status: "created",
+	})
+	return nil
+}
+
+func (cts *Server) UpdateTablet(tablet *topo.TabletInfo, existingVersion int64) (int64, error) {
+	client, err := cts.cellClient(tablet.Alias.Cell)
+	if err != nil {
+		return 0, err
+	}
+
+	key := tabletPrefix(tablet.Alias) + dataKey
+	var newVersion uint64
+	if existingVersion < 0 {
+		newVersion, err = update(client, key, tablet.Json())
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		ok, err := client.CAS(key, []byte(tablet.Json()), uint64(existingVersion))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			if _, err := get(client, key); err != nil {
+				return 0, err
+			}
+			return 0, topo.ErrBadVersion
+		}
+		// the new version is only known by reading it back
+		pair, err := get(client, key)
+		if err != nil {
+			return 0, err
+		}
+		newVersion = pair.ModifyIndex
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet.Tablet,
+		Status: "updated",
+	})
+	return int64(newVersion), nil
+}
+
+func (cts *Server) UpdateTabletFields(tabletAlias topo.TabletAlias, update func(*topo.Tablet) error) error {
+	for {
+		ti, err := cts.GetTablet(tabletAlias)
+		if err != nil {
+			return err
+		}
+		if err := update(ti.Tablet); err != nil {
+			return err
+		}
+		_, err = cts.UpdateTablet(ti, ti.Version())
+		if err == topo.ErrBadVersion {
+			// someone else updated it, try again
+			continue
+		}
+		return err
+	}
+}
+
+func (cts *Server) DeleteTablet(alias topo.TabletAlias) error {
+	client, err := cts.cellClient(alias.Cell)
+	if err != nil {
+		return err
+	}
+
+	// We need to find out the keyspace and shard names because those are required
+	// in the TabletChange event.
+	ti, err := cts.GetTablet(alias)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteTree(tabletPrefix(alias)); err != nil {
+		return err
+	}
+
+	// We only want to copy the identity info for the tablet (alias, etc.).
+	// The rest has just been deleted, so it should be blank.
+	event.Dispatch(&events.TabletChange{
+		Tablet: topo.Tablet{
+			Alias:    ti.Tablet.Alias,
+			Keyspace: ti.Tablet.Keyspace,
+			Shard:    ti.Tablet.Shard,
+		},
+		Status: "deleted",
+	})
+	return nil
+}
+
+func (cts *Server) ValidateTablet(alias topo.TabletAlias) error {
+	_, err := cts.GetTablet(alias)
+	return err
+}
+
+func (cts *Server) GetTablet(alias topo.TabletAlias) (*topo.TabletInfo, error) {
+	client, err := cts.cellClient(alias.Cell)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := get(client, tabletPrefix(alias)+dataKey)
+	if err != nil {
+		return nil, err
+	}
+	tablet, err := tabletFromJson(pair.Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad tablet data %v", err)
+	}
+	return topo.NewTabletInfo(tablet, int64(pair.ModifyIndex)), nil
+}
+
+func (cts *Server) GetTabletsByCell(cell string) ([]topo.TabletAlias, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := client.Keys(tabletsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	children := childrenNames(tabletsPrefix, keys, true)
+	result := make([]topo.TabletAlias, len(children))
+	for i, child := range children {
+		result[i].Cell = cell
+		result[i].Uid, err = topo.ParseUid(child)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,33 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// NewTestServer returns a Server with in-memory clients, with the
+// given cells registered.
+func NewTestServer(t *testing.T, cells []string) topo.Server {
+	clients := map[string]Client{"global": NewFakeClient()}
+	ts := NewServer(func(addrs []string) Client {
+		if len(addrs) != 1 || clients[addrs[0]] == nil {
+			t.Fatalf("unknown test Consul datacenter: %v", addrs)
+		}
+		return clients[addrs[0]]
+	})
+	ts.global = clients["global"]
+
+	// the address of a cell is its name
+	for _, cell := range cells {
+		clients[cell] = NewFakeClient()
+		if err := ts.global.Put(cellsPrefix+cell, []byte(cell)); err != nil {
+			t.Fatalf("cannot register cell %v: %v", cell, err)
+		}
+	}
+	return ts
+}
@@ -0,0 +1,138 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consultopo
+
+import (
+	"encoding/json"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph watches of consultopo.Server,
+with blocking queries.
+*/
+
+// watchKey sends the pair of key, or nil if it doesn't exist, then
+// its new values as they change. The channel is closed when stop is
+// closed or the watch fails. The first read is done before it
+// returns.
+func watchKey(client Client, key string, stop chan struct{}) (<-chan *KVPair, error) {
+	first, index, err := client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *KVPair, 1)
+	result <- first
+	go func() {
+		defer close(result)
+		last := first
+		for {
+			newIndex, err := client.Wait(key, index, false, stop)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err != nil {
+				log.Warningf("cannot watch %v, stopping the watch: %v", key, err)
+				return
+			}
+			if newIndex == index {
+				// the blocking query timed out
+				continue
+			}
+			index = newIndex
+
+			pair, _, err := client.Get(key)
+			if err != nil {
+				log.Warningf("cannot read %v, stopping the watch: %v", key, err)
+				return
+			}
+			if (pair == nil && last == nil) || (pair != nil && last != nil && pair.ModifyIndex == last.ModifyIndex) {
+				continue
+			}
+			select {
+			case result <- pair:
+			case <-stop:
+				return
+			}
+			last = pair
+		}
+	}()
+	return result, nil
+}
+
+func (cts *Server) WatchSrvKeyspace(cell, keyspace string, stop chan struct{}) (<-chan *topo.SrvKeyspace, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	key := srvKeyspacePrefix(keyspace) + dataKey
+	pairs, err := watchKey(client, key, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.SrvKeyspace, 1)
+	go func() {
+		defer close(result)
+		for pair := range pairs {
+			var value *topo.SrvKeyspace
+			if pair != nil {
+				value = topo.NewSrvKeyspace(int64(pair.ModifyIndex))
+				if len(pair.Value) > 0 {
+					if err := json.Unmarshal(pair.Value, value); err != nil {
+						log.Warningf("SrvKeyspace unmarshal failed, stopping the watch of %v: %v %v", key, string(pair.Value), err)
+						return
+					}
+				}
+			}
+			select {
+			case result <- value:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return result, nil
+}
+
+func (cts *Server) WatchEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, stop chan struct{}) (<-chan *topo.EndPoints, error) {
+	client, err := cts.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	key := endPointsKey(keyspace, shard, tabletType)
+	pairs, err := watchKey(client, key, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.EndPoints, 1)
+	go func() {
+		defer close(result)
+		for pair := range pairs {
+			var value *topo.EndPoints
+			if pair != nil {
+				value = &topo.EndPoints{}
+				if len(pair.Value) > 0 {
+					if err := json.Unmarshal(pair.Value, value); err != nil {
+						log.Warningf("EndPoints unmarshal failed, stopping the watch of %v: %v %v", key, string(pair.Value), err)
+						return
+					}
+				}
+			}
+			select {
+			case result <- value:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return result, nil
+}
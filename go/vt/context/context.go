@@ -1,6 +1,9 @@
 package context
 
-import "html/template"
+import (
+	"html/template"
+	"sync"
+)
 
 // Context represents the context for SqlQuery RPC calls.
 type Context interface {
@@ -21,3 +24,27 @@ func (dc *DummyContext) GetRemoteAddr() string { return "DummyRemoteAddr" }
 func (dc *DummyContext) GetUsername() string   { return "DummyUsername" }
 func (dc *DummyContext) HTML() template.HTML   { return template.HTML("DummyContext") }
 func (dc *DummyContext) String() string        { return "DummyContext" }
+
+// WithCancel returns a Context like parent, and the function that
+// cancels it. The calls that support it, like the streaming queries
+// of the tablet connections, stop once their context is canceled.
+func WithCancel(parent Context) (Context, func()) {
+	ctx := &cancelContext{Context: parent, done: make(chan struct{})}
+	var once sync.Once
+	return ctx, func() { once.Do(func() { close(ctx.done) }) }
+}
+
+// cancelContext is a Context that can be canceled.
+type cancelContext struct {
+	Context
+	done chan struct{}
+}
+
+// Done returns a channel that is closed once ctx is canceled,
+// or nil if ctx can't be canceled.
+func Done(ctx Context) <-chan struct{} {
+	if cc, ok := ctx.(*cancelContext); ok {
+		return cc.done
+	}
+	return nil
+}
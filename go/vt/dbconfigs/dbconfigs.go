@@ -55,6 +55,7 @@ func registerConnFlags(connParams *mysql.ConnectionParams, name string, defaultP
 	flag.StringVar(&connParams.SslCaPath, "db-config-"+name+"-ssl-ca-path", defaultParams.SslCaPath, "db "+name+" connection ssl ca path")
 	flag.StringVar(&connParams.SslCert, "db-config-"+name+"-ssl-cert", defaultParams.SslCert, "db "+name+" connection ssl certificate")
 	flag.StringVar(&connParams.SslKey, "db-config-"+name+"-ssl-key", defaultParams.SslKey, "db "+name+" connection ssl key")
+	flag.StringVar(&connParams.SslCipher, "db-config-"+name+"-ssl-cipher", defaultParams.SslCipher, "db "+name+" connection ssl cipher list")
 
 }
 
@@ -70,10 +71,14 @@ func RegisterFlags() {
 
 // InitConnectionParams may overwrite the socket file,
 // and refresh the password to check that works.
+// Setting a certificate enables TLS for the connection.
 func InitConnectionParams(cp *mysql.ConnectionParams, socketFile string) error {
 	if socketFile != "" {
 		cp.UnixSocket = socketFile
 	}
+	if cp.SslCa != "" || cp.SslCaPath != "" || cp.SslCert != "" || cp.SslKey != "" {
+		cp.EnableSsl()
+	}
 	params := *cp
 	return refreshPassword(&params)
 }
@@ -211,6 +216,9 @@ func GetSubprocessFlags() []string {
 		if connParams.SslKey != "" {
 			cmd = append(cmd, "-db-config-"+name+"-ssl-key", connParams.SslKey)
 		}
+		if connParams.SslCipher != "" {
+			cmd = append(cmd, "-db-config-"+name+"-ssl-cipher", connParams.SslCipher)
+		}
 	}
 	f(&dbConfigs.App.ConnectionParams, "app")
 	if dbConfigs.App.Keyspace != "" {
@@ -48,7 +48,7 @@ func (dbc *DBConnection) ExecuteFetch(query string, maxrows int, wantfields bool
 }
 
 // ExecuteStreamFetch is part of PoolConnection interface.
-func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*proto.QueryResult) error, streamBufferSize int) error {
+func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*proto.QueryResult) error, streamBufferSize, streamBufferRows int) error {
 	start := time.Now()
 
 	err := dbc.Connection.ExecuteStreamFetch(query)
@@ -72,6 +72,7 @@ func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*proto.Q
 	for {
 		row, err := dbc.FetchNext()
 		if err != nil {
+			dbc.handleError(err)
 			return err
 		}
 		if row == nil {
@@ -82,7 +83,9 @@ func (dbc *DBConnection) ExecuteStreamFetch(query string, callback func(*proto.Q
 			byteCount += len(s.Raw())
 		}
 
-		if byteCount >= streamBufferSize {
+		// streamBufferRows caps the size of packets of
+		// small rows, 0 means no limit
+		if byteCount >= streamBufferSize || (streamBufferRows > 0 && len(qr.Rows) >= streamBufferRows) {
 			err = callback(qr)
 			if err != nil {
 				return err
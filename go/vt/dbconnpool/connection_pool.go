@@ -26,7 +26,7 @@ var (
 // PoolConnection is the interface implemented by users of this specialized pool.
 type PoolConnection interface {
 	ExecuteFetch(query string, maxrows int, wantfields bool) (*proto.QueryResult, error)
-	ExecuteStreamFetch(query string, callback func(*proto.QueryResult) error, streamBufferSize int) error
+	ExecuteStreamFetch(query string, callback func(*proto.QueryResult) error, streamBufferSize, streamBufferRows int) error
 	Id() int64
 	Close()
 	IsClosed() bool
@@ -42,13 +42,16 @@ type ConnectionPool struct {
 	mu          sync.Mutex
 	connections *pools.ResourcePool
 	capacity    int
+	// maxCap is the capacity up to which the pool can be
+	// grown while it's open. It's at least capacity.
+	maxCap      int
 	idleTimeout time.Duration
 }
 
 // NewConnectionPool creates a new ConnectionPool. The name is used
 // to publish stats only.
 func NewConnectionPool(name string, capacity int, idleTimeout time.Duration) *ConnectionPool {
-	cp := &ConnectionPool{capacity: capacity, idleTimeout: idleTimeout}
+	cp := &ConnectionPool{capacity: capacity, maxCap: capacity, idleTimeout: idleTimeout}
 	if name == "" {
 		return cp
 	}
@@ -58,6 +61,7 @@ func NewConnectionPool(name string, capacity int, idleTimeout time.Duration) *Co
 	stats.Publish(name+"WaitCount", stats.IntFunc(cp.WaitCount))
 	stats.Publish(name+"WaitTime", stats.DurationFunc(cp.WaitTime))
 	stats.Publish(name+"IdleTimeout", stats.DurationFunc(cp.IdleTimeout))
+	stats.Publish(name+"IdleClosed", stats.IntFunc(cp.IdleClosed))
 	return cp
 }
 
@@ -75,7 +79,7 @@ func (cp *ConnectionPool) Open(connFactory CreateConnectionFunc) {
 	f := func() (pools.Resource, error) {
 		return connFactory(cp)
 	}
-	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.capacity, cp.idleTimeout)
+	cp.connections = pools.NewResourcePool(f, cp.capacity, cp.maxCap, cp.idleTimeout)
 }
 
 // Close will close the pool and wait for connections to be returned before
@@ -130,7 +134,8 @@ func (cp *ConnectionPool) Put(conn PoolConnection) {
 	p.Put(conn)
 }
 
-// SetCapacity alters the size of the pool at runtime.
+// SetCapacity alters the size of the pool at runtime. While the
+// pool is open, it can't be grown beyond its max capacity.
 func (cp *ConnectionPool) SetCapacity(capacity int) (err error) {
 	cp.mu.Lock()
 	defer cp.mu.Unlock()
@@ -141,9 +146,24 @@ func (cp *ConnectionPool) SetCapacity(capacity int) (err error) {
 		}
 	}
 	cp.capacity = capacity
+	if cp.maxCap < capacity {
+		cp.maxCap = capacity
+	}
 	return nil
 }
 
+// SetMaxCapacity sets the capacity up to which SetCapacity can grow
+// the pool while it's open. It takes effect the next time the pool
+// is opened. It's never less than the capacity.
+func (cp *ConnectionPool) SetMaxCapacity(maxCap int) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.maxCap = maxCap
+	if cp.maxCap < cp.capacity {
+		cp.maxCap = cp.capacity
+	}
+}
+
 // SetIdleTimeout sets the idleTimeout on the pool.
 func (cp *ConnectionPool) SetIdleTimeout(idleTimeout time.Duration) {
 	cp.mu.Lock()
@@ -216,3 +236,13 @@ func (cp *ConnectionPool) IdleTimeout() time.Duration {
 	}
 	return p.IdleTimeout()
 }
+
+// IdleClosed returns the number of connections closed
+// because they were idle.
+func (cp *ConnectionPool) IdleClosed() int64 {
+	p := cp.pool()
+	if p == nil {
+		return 0
+	}
+	return p.IdleClosed()
+}
@@ -0,0 +1,142 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the remote tablet action code of etcdtopo.Server
+
+The actions of a tablet are keys created in order in its action
+directory. Their response is stored in the actionlog directory, under
+the same name. As the actions are in the cluster of the cell of the
+tablet, the action paths start with the cell:
+  /<cell>/vt/tablets/<uid>/action/<index>
+*/
+
+// tabletActionDir returns the action directory of the tablet.
+func tabletActionDir(alias topo.TabletAlias) string {
+	return path.Join(tabletDir(alias), "action")
+}
+
+// actionLogKey returns the key of the response of the action key.
+func actionLogKey(key string) string {
+	return strings.Replace(key, "/action/", "/actionlog/", 1)
+}
+
+// parseActionPath returns the tablet alias of the action path, and
+// the key of the action in the cluster of the cell.
+func parseActionPath(actionPath string) (topo.TabletAlias, string, error) {
+	pathParts := strings.Split(actionPath, "/")
+	if len(pathParts) != 7 || pathParts[0] != "" || pathParts[2] != "vt" || pathParts[3] != "tablets" || pathParts[5] != "action" {
+		return topo.TabletAlias{}, "", fmt.Errorf("invalid action path: %v", actionPath)
+	}
+	alias, err := topo.ParseTabletAliasString(pathParts[1] + "-" + pathParts[4])
+	if err != nil {
+		return topo.TabletAlias{}, "", err
+	}
+	return alias, "/" + strings.Join(pathParts[2:], "/"), nil
+}
+
+// actionClient returns the client of the cell of the action path, and
+// the key of the action.
+func (ets *Server) actionClient(actionPath string) (Client, string, error) {
+	alias, key, err := parseActionPath(actionPath)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := ets.cellClient(alias.Cell)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, key, nil
+}
+
+func (ets *Server) WriteTabletAction(tabletAlias topo.TabletAlias, contents string) (string, error) {
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.CreateInOrder(tabletActionDir(tabletAlias), contents, 0)
+	if err != nil {
+		return "", convertError(err)
+	}
+	return "/" + tabletAlias.Cell + resp.Node.Key, nil
+}
+
+func (ets *Server) WaitForTabletAction(actionPath string, waitTime time.Duration, interrupted chan struct{}) (string, error) {
+	client, key, err := ets.actionClient(actionPath)
+	if err != nil {
+		return "", err
+	}
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+
+	logKey := actionLogKey(key)
+	for {
+		resp, err := client.Get(logKey, false, false)
+		if err == nil {
+			return resp.Node.Value, nil
+		}
+		if !IsError(err, ErrorCodeKeyNotFound) {
+			return "", fmt.Errorf("action err: %v %v", actionPath, err)
+		}
+
+		// wait for the response, from after the failure
+		stop := make(chan struct{})
+		watchErr := make(chan error, 1)
+		go func(waitIndex uint64) {
+			_, err := client.Watch(logKey, waitIndex, false, stop)
+			watchErr <- err
+		}(err.(*Error).Index + 1)
+
+		select {
+		case err := <-watchErr:
+			if err != nil {
+				log.Warningf("failed to watch action response %v, trying again: %v", logKey, err)
+			}
+		case <-timer.C:
+			close(stop)
+			return "", topo.ErrTimeout
+		case <-interrupted:
+			close(stop)
+			return "", topo.ErrInterrupted
+		}
+	}
+}
+
+func (ets *Server) PurgeTabletActions(tabletAlias topo.TabletAlias, canBePurged func(data string) bool) error {
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Get(tabletActionDir(tabletAlias), true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Purge newer items first so the action queues don't try to process something.
+	for i := len(resp.Node.Nodes) - 1; i >= 0; i-- {
+		action := resp.Node.Nodes[i]
+		if action.Dir || !canBePurged(action.Value) {
+			continue
+		}
+		if _, err := client.Delete(action.Key, false); err != nil && !IsError(err, ErrorCodeKeyNotFound) {
+			return fmt.Errorf("PurgeTabletActions(%v) err: %v", tabletAlias, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"path"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the code to support the local agent process for etcdtopo.Server
+*/
+
+// pidTTL is the expiration of the pid key, refreshed by the process
+// a few times in that interval.
+const pidTTL = 30 * time.Second
+
+func (ets *Server) ValidateTabletActions(tabletAlias topo.TabletAlias) error {
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+
+	// Ensure that the action directory is there. There is no
+	// conflict creating it.
+	if _, err := client.CreateDir(tabletActionDir(tabletAlias)); err != nil && !IsError(err, ErrorCodeNodeExist) {
+		return err
+	}
+	return nil
+}
+
+func (ets *Server) CreateTabletPidNode(tabletAlias topo.TabletAlias, contents string, done chan struct{}) error {
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	key := path.Join(tabletDir(tabletAlias), "pid")
+	if _, err := client.Set(key, contents, uint64(pidTTL.Seconds())); err != nil {
+		return err
+	}
+
+	// refresh it until done is closed, then delete it
+	go func() {
+		ticker := time.NewTicker(pidTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := client.Set(key, contents, uint64(pidTTL.Seconds())); err != nil {
+					log.Warningf("cannot refresh pid node %v: %v", key, err)
+				}
+			case <-done:
+				if _, err := client.Delete(key, false); err != nil {
+					log.Warningf("cannot delete pid node %v: %v", key, err)
+				}
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (ets *Server) ValidateTabletPidNode(tabletAlias topo.TabletAlias) error {
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Get(path.Join(tabletDir(tabletAlias), "pid"), false, false)
+	return convertError(err)
+}
+
+func (ets *Server) GetSubprocessFlags() []string {
+	return []string{"-etcd_global_addrs", *globalAddrs}
+}
+
+// handleActionQueue processes all pending actions, until it can't
+// read one or one fails. No error is returned for action failures.
+// It returns the index to watch the action directory from.
+func (ets *Server) handleActionQueue(client Client, tabletAlias topo.TabletAlias, dispatchAction func(actionPath, data string) error) (uint64, error) {
+	resp, err := client.Get(tabletActionDir(tabletAlias), true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return err.(*Error).Index + 1, nil
+		}
+		return 0, err
+	}
+
+	for _, action := range resp.Node.Nodes {
+		if action.Dir {
+			continue
+		}
+		if err := dispatchAction("/"+tabletAlias.Cell+action.Key, action.Value); err != nil {
+			break
+		}
+	}
+	return resp.EtcdIndex + 1, nil
+}
+
+func (ets *Server) ActionEventLoop(tabletAlias topo.TabletAlias, dispatchAction func(actionPath, data string) error, done chan struct{}) {
+	for {
+		client, err := ets.cellClient(tabletAlias.Cell)
+		if err != nil {
+			log.Warningf("cannot get the cell of %v, will try again in 5 seconds: %v", tabletAlias, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// Process any pending actions when we startup, before
+		// we start listening for events.
+		waitIndex, err := ets.handleActionQueue(client, tabletAlias, dispatchAction)
+		if err != nil {
+			log.Warningf("failed to read the action queue, will try again in 5 seconds: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// wait for a change of the queue
+		resp, err := client.Watch(tabletActionDir(tabletAlias), waitIndex, true, done)
+		if err != nil {
+			log.Warningf("failed to watch the action queue, will try again in 5 seconds: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if resp == nil {
+			// done was closed
+			return
+		}
+	}
+}
+
+func (ets *Server) ReadTabletActionPath(actionPath string) (topo.TabletAlias, string, int64, error) {
+	tabletAlias, key, err := parseActionPath(actionPath)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+	client, err := ets.cellClient(tabletAlias.Cell)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+
+	resp, err := client.Get(key, false, false)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, convertError(err)
+	}
+	return tabletAlias, resp.Node.Value, int64(resp.Node.ModifiedIndex), nil
+}
+
+func (ets *Server) UpdateTabletAction(actionPath, data string, version int64) error {
+	client, key, err := ets.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		_, err = client.Update(key, data, 0)
+	} else {
+		_, err = client.CompareAndSwap(key, data, 0, uint64(version))
+	}
+	return convertError(err)
+}
+
+// StoreTabletActionResponse stores the data both in action and actionlog
+func (ets *Server) StoreTabletActionResponse(actionPath, data string) error {
+	client, key, err := ets.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Update(key, data, 0); err != nil {
+		return convertError(err)
+	}
+	_, err = client.Set(actionLogKey(key), data, uint64(actionLogTTL.Seconds()))
+	return convertError(err)
+}
+
+func (ets *Server) UnblockTabletAction(actionPath string) error {
+	client, key, err := ets.actionClient(actionPath)
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(key, false)
+	return convertError(err)
+}
@@ -0,0 +1,20 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+/*
+This file contains the cell management methods of etcdtopo.Server
+*/
+
+func (ets *Server) GetKnownCells() ([]string, error) {
+	resp, err := ets.globalClient().Get(cellsDir, true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return childrenNames(resp.Node, false), nil
+}
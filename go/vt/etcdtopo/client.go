@@ -0,0 +1,295 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+)
+
+/*
+This file contains a minimal client for the etcd v2 keys API, with
+only what etcdtopo.Server needs.
+*/
+
+// The etcd error codes etcdtopo.Server handles.
+const (
+	ErrorCodeKeyNotFound  = 100
+	ErrorCodeTestFailed   = 101
+	ErrorCodeNotFile      = 102
+	ErrorCodeNotDir       = 104
+	ErrorCodeNodeExist    = 105
+	ErrorCodeIndexCleared = 401
+)
+
+// Node is a key of etcd, or a directory.
+type Node struct {
+	Key           string  `json:"key"`
+	Value         string  `json:"value"`
+	Dir           bool    `json:"dir"`
+	Nodes         []*Node `json:"nodes"`
+	CreatedIndex  uint64  `json:"createdIndex"`
+	ModifiedIndex uint64  `json:"modifiedIndex"`
+	TTL           int64   `json:"ttl"`
+}
+
+// Response is the result of a request, or the event returned by a
+// watch.
+type Response struct {
+	Action   string `json:"action"`
+	Node     *Node  `json:"node"`
+	PrevNode *Node  `json:"prevNode"`
+
+	// EtcdIndex is the index of etcd when the request was served.
+	EtcdIndex uint64 `json:"-"`
+}
+
+// Error is an error returned by etcd.
+type Error struct {
+	ErrorCode int    `json:"errorCode"`
+	Message   string `json:"message"`
+	Cause     string `json:"cause"`
+	Index     uint64 `json:"index"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("etcd error %v: %v (%v) [%v]", e.ErrorCode, e.Message, e.Cause, e.Index)
+}
+
+// IsError returns true if err is an etcd error with the given code.
+func IsError(err error, code int) bool {
+	if e, ok := err.(*Error); ok {
+		return e.ErrorCode == code
+	}
+	return false
+}
+
+// Client is the part of the etcd API used by etcdtopo.Server. The
+// ttl are in seconds, 0 meaning no expiration. The indexes are the
+// ModifiedIndex of the nodes.
+type Client interface {
+	// Get returns the key, or the directory with its children
+	// (recursively if recursive is set, sorted if sorted is set).
+	Get(key string, sorted, recursive bool) (*Response, error)
+
+	// Create creates the key, failing with ErrorCodeNodeExist
+	// if it exists. The missing parent directories are created.
+	Create(key, value string, ttl uint64) (*Response, error)
+
+	// CreateDir creates the directory, failing with
+	// ErrorCodeNodeExist if it exists.
+	CreateDir(key string) (*Response, error)
+
+	// CreateInOrder creates a new key in the directory, named
+	// after the index of etcd, so the keys sort in creation order.
+	CreateInOrder(dir, value string, ttl uint64) (*Response, error)
+
+	// Set sets the key, creating it if needed.
+	Set(key, value string, ttl uint64) (*Response, error)
+
+	// Update sets the key, failing with ErrorCodeKeyNotFound if it
+	// doesn't exist.
+	Update(key, value string, ttl uint64) (*Response, error)
+
+	// CompareAndSwap sets the key if its index is prevIndex,
+	// failing with ErrorCodeTestFailed otherwise.
+	CompareAndSwap(key, value string, ttl uint64, prevIndex uint64) (*Response, error)
+
+	// Delete deletes the key, or the directory and everything in
+	// it if recursive is set.
+	Delete(key string, recursive bool) (*Response, error)
+
+	// CompareAndDelete deletes the key if its index is prevIndex,
+	// failing with ErrorCodeTestFailed otherwise.
+	CompareAndDelete(key string, prevIndex uint64) (*Response, error)
+
+	// Watch waits for the first change of the key (or of the keys
+	// under it if recursive is set) at or after waitIndex. It
+	// returns nil if stop is closed first.
+	Watch(key string, waitIndex uint64, recursive bool, stop chan struct{}) (*Response, error)
+}
+
+// httpClient is the Client talking to etcd over http. The requests
+// go to the first address, and to the next ones if it is down.
+type httpClient struct {
+	addrs     []string
+	transport *http.Transport
+	// client is used for the requests, watcher for the watches
+	// that don't time out.
+	client  *http.Client
+	watcher *http.Client
+}
+
+// NewClient returns a Client for the etcd cluster at addrs (like
+// "http://localhost:4001").
+func NewClient(addrs []string) Client {
+	transport := &http.Transport{}
+	return &httpClient{
+		addrs:     addrs,
+		transport: transport,
+		client:    &http.Client{Transport: transport, Timeout: *etcdTimeout},
+		watcher:   &http.Client{Transport: transport},
+	}
+}
+
+func (c *httpClient) Get(key string, sorted, recursive bool) (*Response, error) {
+	params := url.Values{}
+	if sorted {
+		params.Set("sorted", "true")
+	}
+	if recursive {
+		params.Set("recursive", "true")
+	}
+	return c.do("GET", key, params, nil, nil)
+}
+
+func (c *httpClient) Create(key, value string, ttl uint64) (*Response, error) {
+	form := valueForm(value, ttl)
+	form.Set("prevExist", "false")
+	return c.do("PUT", key, nil, form, nil)
+}
+
+func (c *httpClient) CreateDir(key string) (*Response, error) {
+	form := url.Values{}
+	form.Set("dir", "true")
+	form.Set("prevExist", "false")
+	return c.do("PUT", key, nil, form, nil)
+}
+
+func (c *httpClient) CreateInOrder(dir, value string, ttl uint64) (*Response, error) {
+	return c.do("POST", dir, nil, valueForm(value, ttl), nil)
+}
+
+func (c *httpClient) Set(key, value string, ttl uint64) (*Response, error) {
+	return c.do("PUT", key, nil, valueForm(value, ttl), nil)
+}
+
+func (c *httpClient) Update(key, value string, ttl uint64) (*Response, error) {
+	form := valueForm(value, ttl)
+	form.Set("prevExist", "true")
+	return c.do("PUT", key, nil, form, nil)
+}
+
+func (c *httpClient) CompareAndSwap(key, value string, ttl uint64, prevIndex uint64) (*Response, error) {
+	form := valueForm(value, ttl)
+	form.Set("prevIndex", strconv.FormatUint(prevIndex, 10))
+	return c.do("PUT", key, nil, form, nil)
+}
+
+func (c *httpClient) Delete(key string, recursive bool) (*Response, error) {
+	params := url.Values{}
+	if recursive {
+		params.Set("recursive", "true")
+	}
+	return c.do("DELETE", key, params, nil, nil)
+}
+
+func (c *httpClient) CompareAndDelete(key string, prevIndex uint64) (*Response, error) {
+	params := url.Values{}
+	params.Set("prevIndex", strconv.FormatUint(prevIndex, 10))
+	return c.do("DELETE", key, params, nil, nil)
+}
+
+func (c *httpClient) Watch(key string, waitIndex uint64, recursive bool, stop chan struct{}) (*Response, error) {
+	params := url.Values{}
+	params.Set("wait", "true")
+	params.Set("waitIndex", strconv.FormatUint(waitIndex, 10))
+	if recursive {
+		params.Set("recursive", "true")
+	}
+	resp, err := c.do("GET", key, params, nil, stop)
+	select {
+	case <-stop:
+		return nil, nil
+	default:
+	}
+	return resp, err
+}
+
+func valueForm(value string, ttl uint64) url.Values {
+	form := url.Values{}
+	form.Set("value", value)
+	if ttl > 0 {
+		form.Set("ttl", strconv.FormatUint(ttl, 10))
+	}
+	return form
+}
+
+// do sends the request to the first address that answers. If stop
+// is set, the request is a watch, cancelled when stop is closed.
+func (c *httpClient) do(method, key string, params, form url.Values, stop chan struct{}) (*Response, error) {
+	var lastErr error
+	for _, addr := range c.addrs {
+		u := strings.TrimRight(addr, "/") + "/v2/keys" + key
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+		var body string
+		if form != nil {
+			body = form.Encode()
+		}
+		req, err := http.NewRequest(method, u, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		client := c.client
+		if stop != nil {
+			client = c.watcher
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-stop:
+					c.transport.CancelRequest(req)
+				case <-finished:
+				}
+			}()
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			// try the next server
+			log.Warningf("etcd request to %v failed: %v", addr, err)
+			lastErr = err
+			continue
+		}
+		return decodeResponse(resp)
+	}
+	return nil, fmt.Errorf("no etcd server available: %v", lastErr)
+}
+
+func decodeResponse(resp *http.Response) (*Response, error) {
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		e := &Error{}
+		if err := json.Unmarshal(data, e); err != nil {
+			return nil, fmt.Errorf("etcd returned %v: %v", resp.Status, string(data))
+		}
+		return nil, e
+	}
+	result := &Response{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("bad etcd response %v: %v", string(data), err)
+	}
+	if index := resp.Header.Get("X-Etcd-Index"); index != "" {
+		result.EtcdIndex, _ = strconv.ParseUint(index, 10, 64)
+	}
+	return result, nil
+}
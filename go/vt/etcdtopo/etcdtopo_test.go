@@ -0,0 +1,154 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/test"
+)
+
+func TestKeyspace(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckKeyspace(t, ts)
+}
+
+func TestShard(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckShard(t, ts)
+}
+
+func TestTablet(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckTablet(t, ts)
+}
+
+func TestShardReplication(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckShardReplication(t, ts)
+}
+
+func TestServingGraph(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckServingGraph(t, ts)
+}
+
+func TestKeyspaceLock(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckKeyspaceLock(t, ts)
+}
+
+func TestShardLock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wait-based test in short mode.")
+	}
+
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckShardLock(t, ts)
+}
+
+func TestSrvShardLock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping wait-based test in short mode.")
+	}
+
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckSrvShardLock(t, ts)
+}
+
+func TestActionLockReader(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckActionLockReader(t, ts)
+}
+
+func TestLockRefresh(t *testing.T) {
+	defer func(ttl time.Duration) { *lockTTL = ttl }(*lockTTL)
+	*lockTTL = 30 * time.Millisecond
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	ets := ts.(*Server)
+	if err := ets.CreateKeyspace("test_keyspace", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	key := path.Join(keyspaceDir("test_keyspace"), lockKey)
+	modifiedIndex := func() uint64 {
+		resp, err := ets.global.Get(key, false, false)
+		if err != nil {
+			return 0
+		}
+		return resp.Node.ModifiedIndex
+	}
+
+	// the lock is refreshed while it's held
+	lockPath, err := ets.LockKeyspaceForAction("test_keyspace", "fake-content", time.Second, nil)
+	if err != nil {
+		t.Fatalf("LockKeyspaceForAction: %v", err)
+	}
+	index := modifiedIndex()
+	time.Sleep(*lockTTL)
+	if got := modifiedIndex(); got <= index {
+		t.Errorf("lock not refreshed: index %v, was %v", got, index)
+	}
+
+	// and it's not refreshed anymore once released
+	if err := ets.UnlockKeyspaceForAction("test_keyspace", lockPath, "fake-results"); err != nil {
+		t.Fatalf("UnlockKeyspaceForAction: %v", err)
+	}
+	time.Sleep(*lockTTL)
+	if got := modifiedIndex(); got != 0 {
+		t.Errorf("lock refreshed after unlock: index %v", got)
+	}
+	if len(ets.locks) != 0 {
+		t.Errorf("lock refreshers after unlock: %v", ets.locks)
+	}
+}
+
+func TestPid(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckPid(t, ts)
+}
+
+func TestActions(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckActions(t, ts)
+}
+
+func TestWatchSrvKeyspace(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckWatchSrvKeyspace(t, ts)
+}
+
+func TestWatchEndPoints(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckWatchEndPoints(t, ts)
+}
+
+func TestGlobalCopy(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckGlobalCopy(t, ts)
+}
+
+func TestVSchema(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckVSchema(t, ts)
+}
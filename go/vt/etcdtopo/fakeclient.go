@@ -0,0 +1,273 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+This file contains an in-memory Client, for tests. It keeps all the
+events for the watches, and doesn't expire the keys with a ttl.
+*/
+
+type fakeNode struct {
+	value         string
+	dir           bool
+	children      map[string]*fakeNode
+	createdIndex  uint64
+	modifiedIndex uint64
+	ttl           int64
+}
+
+type fakeClient struct {
+	mu     sync.Mutex
+	index  uint64
+	root   *fakeNode
+	events []*Response
+	// changed is closed and replaced at every change
+	changed chan struct{}
+}
+
+// NewFakeClient returns an empty in-memory Client.
+func NewFakeClient() Client {
+	return &fakeClient{
+		root:    &fakeNode{dir: true, children: make(map[string]*fakeNode)},
+		changed: make(chan struct{}),
+	}
+}
+
+func splitKey(key string) []string {
+	key = strings.Trim(path.Clean("/"+key), "/")
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "/")
+}
+
+func (fc *fakeClient) error(code int, message, key string) error {
+	return &Error{ErrorCode: code, Message: message, Cause: path.Clean("/" + key), Index: fc.index}
+}
+
+// lookup returns the node of key and its parent, or nil.
+func (fc *fakeClient) lookup(key string) (node, parent *fakeNode) {
+	node = fc.root
+	for _, part := range splitKey(key) {
+		if !node.dir {
+			return nil, nil
+		}
+		parent = node
+		node = node.children[part]
+		if node == nil {
+			return nil, parent
+		}
+	}
+	return node, parent
+}
+
+// parentDir returns the parent directory of key, creating the
+// missing directories.
+func (fc *fakeClient) parentDir(key string) (*fakeNode, error) {
+	parts := splitKey(key)
+	if len(parts) == 0 {
+		return nil, fc.error(ErrorCodeNotFile, "Not a file", key)
+	}
+	dir := fc.root
+	for _, part := range parts[:len(parts)-1] {
+		child := dir.children[part]
+		if child == nil {
+			child = &fakeNode{dir: true, children: make(map[string]*fakeNode), createdIndex: fc.index, modifiedIndex: fc.index}
+			dir.children[part] = child
+		}
+		if !child.dir {
+			return nil, fc.error(ErrorCodeNotDir, "Not a directory", key)
+		}
+		dir = child
+	}
+	return dir, nil
+}
+
+func toNode(key string, n *fakeNode, recursive, children bool) *Node {
+	result := &Node{
+		Key:           path.Clean("/" + key),
+		Value:         n.value,
+		Dir:           n.dir,
+		CreatedIndex:  n.createdIndex,
+		ModifiedIndex: n.modifiedIndex,
+		TTL:           n.ttl,
+	}
+	if n.dir && children {
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			result.Nodes = append(result.Nodes, toNode(path.Join(result.Key, name), n.children[name], recursive, recursive))
+		}
+	}
+	return result
+}
+
+// record adds the event and wakes up the watches. The node is
+// copied, as it can change.
+func (fc *fakeClient) record(action, key string, n, prev *fakeNode) *Response {
+	resp := &Response{
+		Action:    action,
+		Node:      toNode(key, n, false, false),
+		EtcdIndex: fc.index,
+	}
+	if prev != nil {
+		resp.PrevNode = toNode(key, prev, false, false)
+	}
+	fc.events = append(fc.events, resp)
+	close(fc.changed)
+	fc.changed = make(chan struct{})
+	return resp
+}
+
+func (fc *fakeClient) Get(key string, sorted, recursive bool) (*Response, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	n, _ := fc.lookup(key)
+	if n == nil {
+		return nil, fc.error(ErrorCodeKeyNotFound, "Key not found", key)
+	}
+	return &Response{Action: "get", Node: toNode(key, n, recursive, true), EtcdIndex: fc.index}, nil
+}
+
+func (fc *fakeClient) create(key, value string, dir bool, ttl uint64) (*Response, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	parent, err := fc.parentDir(key)
+	if err != nil {
+		return nil, err
+	}
+	parts := splitKey(key)
+	name := parts[len(parts)-1]
+	if parent.children[name] != nil {
+		return nil, fc.error(ErrorCodeNodeExist, "Key already exists", key)
+	}
+	fc.index++
+	n := &fakeNode{value: value, dir: dir, createdIndex: fc.index, modifiedIndex: fc.index, ttl: int64(ttl)}
+	if dir {
+		n.children = make(map[string]*fakeNode)
+	}
+	parent.children[name] = n
+	return fc.record("create", key, n, nil), nil
+}
+
+func (fc *fakeClient) Create(key, value string, ttl uint64) (*Response, error) {
+	return fc.create(key, value, false, ttl)
+}
+
+func (fc *fakeClient) CreateDir(key string) (*Response, error) {
+	return fc.create(key, "", true, 0)
+}
+
+func (fc *fakeClient) CreateInOrder(dir, value string, ttl uint64) (*Response, error) {
+	fc.mu.Lock()
+	name := fmt.Sprintf("%020d", fc.index+1)
+	fc.mu.Unlock()
+	return fc.create(path.Join(dir, name), value, false, ttl)
+}
+
+// set changes the value of key. If mustExist is set, it has to
+// exist, and if prevIndex is not 0, it has to be at that index.
+func (fc *fakeClient) set(action, key, value string, ttl uint64, mustExist bool, prevIndex uint64) (*Response, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	parent, err := fc.parentDir(key)
+	if err != nil {
+		return nil, err
+	}
+	parts := splitKey(key)
+	name := parts[len(parts)-1]
+	prev := parent.children[name]
+	if prev == nil && mustExist {
+		return nil, fc.error(ErrorCodeKeyNotFound, "Key not found", key)
+	}
+	if prev != nil && prev.dir {
+		return nil, fc.error(ErrorCodeNotFile, "Not a file", key)
+	}
+	if prevIndex != 0 && prev.modifiedIndex != prevIndex {
+		return nil, fc.error(ErrorCodeTestFailed, "Compare failed", fmt.Sprintf("[%v != %v]", prevIndex, prev.modifiedIndex))
+	}
+	fc.index++
+	n := &fakeNode{value: value, createdIndex: fc.index, modifiedIndex: fc.index, ttl: int64(ttl)}
+	if prev != nil {
+		n.createdIndex = prev.createdIndex
+	}
+	parent.children[name] = n
+	return fc.record(action, key, n, prev), nil
+}
+
+func (fc *fakeClient) Set(key, value string, ttl uint64) (*Response, error) {
+	return fc.set("set", key, value, ttl, false, 0)
+}
+
+func (fc *fakeClient) Update(key, value string, ttl uint64) (*Response, error) {
+	return fc.set("update", key, value, ttl, true, 0)
+}
+
+func (fc *fakeClient) CompareAndSwap(key, value string, ttl uint64, prevIndex uint64) (*Response, error) {
+	return fc.set("compareAndSwap", key, value, ttl, true, prevIndex)
+}
+
+func (fc *fakeClient) delete(action, key string, recursive bool, prevIndex uint64) (*Response, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	n, parent := fc.lookup(key)
+	if n == nil {
+		return nil, fc.error(ErrorCodeKeyNotFound, "Key not found", key)
+	}
+	if parent == nil || (n.dir && !recursive) {
+		return nil, fc.error(ErrorCodeNotFile, "Not a file", key)
+	}
+	if prevIndex != 0 && n.modifiedIndex != prevIndex {
+		return nil, fc.error(ErrorCodeTestFailed, "Compare failed", fmt.Sprintf("[%v != %v]", prevIndex, n.modifiedIndex))
+	}
+	parts := splitKey(key)
+	delete(parent.children, parts[len(parts)-1])
+	fc.index++
+	deleted := &fakeNode{dir: n.dir, createdIndex: n.createdIndex, modifiedIndex: fc.index}
+	return fc.record(action, key, deleted, n), nil
+}
+
+func (fc *fakeClient) Delete(key string, recursive bool) (*Response, error) {
+	return fc.delete("delete", key, recursive, 0)
+}
+
+func (fc *fakeClient) CompareAndDelete(key string, prevIndex uint64) (*Response, error) {
+	return fc.delete("compareAndDelete", key, false, prevIndex)
+}
+
+func (fc *fakeClient) Watch(key string, waitIndex uint64, recursive bool, stop chan struct{}) (*Response, error) {
+	key = path.Clean("/" + key)
+	for {
+		fc.mu.Lock()
+		for _, event := range fc.events {
+			if event.Node.ModifiedIndex < waitIndex {
+				continue
+			}
+			if event.Node.Key == key || (recursive && strings.HasPrefix(event.Node.Key, key+"/")) {
+				fc.mu.Unlock()
+				return event, nil
+			}
+		}
+		changed := fc.changed
+		fc.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-stop:
+			return nil, nil
+		}
+	}
+}
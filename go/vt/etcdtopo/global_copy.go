@@ -0,0 +1,79 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the global records copies management code of
+etcdtopo.Server
+
+The copy of a keyspace is the /vt/globalcopy/<keyspace> key of the
+cell.
+*/
+
+const (
+	globalCopyDir = "/vt/globalcopy"
+)
+
+func globalCopyKey(keyspace string) string {
+	return path.Join(globalCopyDir, keyspace)
+}
+
+func (ets *Server) UpdateGlobalCopy(cell, keyspace string, gc *topo.GlobalCopy) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(globalCopyKey(keyspace), jscfg.ToJson(gc), 0)
+	return convertError(err)
+}
+
+func (ets *Server) GetGlobalCopy(cell, keyspace string) (*topo.GlobalCopy, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(globalCopyKey(keyspace), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	gc := &topo.GlobalCopy{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), gc); err != nil {
+		return nil, fmt.Errorf("GlobalCopy unmarshal failed: %v %v", resp.Node.Value, err)
+	}
+	return gc, nil
+}
+
+func (ets *Server) GetGlobalCopyKeyspaces(cell string) ([]string, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(globalCopyDir, true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return childrenNames(resp.Node, false), nil
+}
+
+func (ets *Server) DeleteGlobalCopy(cell, keyspace string) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(globalCopyKey(keyspace), false)
+	return convertError(err)
+}
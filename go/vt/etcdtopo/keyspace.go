@@ -0,0 +1,99 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the Keyspace management code for etcdtopo.Server
+*/
+
+const (
+	globalKeyspacesDir = "/vt/keyspaces"
+)
+
+func keyspaceDir(keyspace string) string {
+	return path.Join(globalKeyspacesDir, keyspace)
+}
+
+func shardsDir(keyspace string) string {
+	return path.Join(globalKeyspacesDir, keyspace, "shards")
+}
+
+func (ets *Server) CreateKeyspace(keyspace string, value *topo.Keyspace) error {
+	client := ets.globalClient()
+	if _, err := client.Create(path.Join(keyspaceDir(keyspace), dataKey), jscfg.ToJson(value), 0); err != nil {
+		return convertError(err)
+	}
+
+	// so GetShardNames works before the first shard is created
+	if _, err := client.CreateDir(shardsDir(keyspace)); err != nil && !IsError(err, ErrorCodeNodeExist) {
+		return fmt.Errorf("error creating keyspace shards: %v", err)
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, value),
+		Status:       "created",
+	})
+	return nil
+}
+
+func (ets *Server) UpdateKeyspace(ki *topo.KeyspaceInfo) error {
+	if _, err := ets.globalClient().Update(path.Join(keyspaceDir(ki.KeyspaceName()), dataKey), jscfg.ToJson(ki.Keyspace), 0); err != nil {
+		return convertError(err)
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *ki,
+		Status:       "updated",
+	})
+	return nil
+}
+
+func (ets *Server) GetKeyspace(keyspace string) (*topo.KeyspaceInfo, error) {
+	resp, err := ets.globalClient().Get(path.Join(keyspaceDir(keyspace), dataKey), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	k := &topo.Keyspace{}
+	if err = json.Unmarshal([]byte(resp.Node.Value), k); err != nil {
+		return nil, fmt.Errorf("bad keyspace data %v", err)
+	}
+
+	return topo.NewKeyspaceInfo(keyspace, k), nil
+}
+
+func (ets *Server) GetKeyspaces() ([]string, error) {
+	resp, err := ets.globalClient().Get(globalKeyspacesDir, true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return childrenNames(resp.Node, true), nil
+}
+
+func (ets *Server) DeleteKeyspaceShards(keyspace string) error {
+	if _, err := ets.globalClient().Delete(shardsDir(keyspace), true); err != nil && !IsError(err, ErrorCodeKeyNotFound) {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, nil),
+		Status:       "deleted all shards",
+	})
+	return nil
+}
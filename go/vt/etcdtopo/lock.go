@@ -0,0 +1,216 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the lock management code for etcdtopo.Server
+*/
+
+// actionLogTTL is how long the results of the actions are kept.
+const actionLogTTL = 7 * 24 * time.Hour
+
+// lockForAction creates the lock key of dir, waiting for the current
+// holder to release it. The lock expires after lockTTL, in case the
+// process dies, so it's refreshed until unlockForAction. The lock
+// path is the creation index of the key.
+func (ets *Server) lockForAction(client Client, dir, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	key := path.Join(dir, lockKey)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		resp, err := client.Create(key, contents, uint64(lockTTL.Seconds()))
+		if err == nil {
+			ets.refreshLock(client, key, contents, resp.Node.ModifiedIndex)
+			return strconv.FormatUint(resp.Node.CreatedIndex, 10), nil
+		}
+		if !IsError(err, ErrorCodeNodeExist) {
+			return "", fmt.Errorf("failed to obtain action lock: %v %v", key, err)
+		}
+
+		// wait for the lock to change, from after the failure
+		stop := make(chan struct{})
+		watchErr := make(chan error, 1)
+		go func(waitIndex uint64) {
+			_, err := client.Watch(key, waitIndex, false, stop)
+			watchErr <- err
+		}(err.(*Error).Index + 1)
+
+		select {
+		case err := <-watchErr:
+			if err != nil {
+				log.Warningf("failed to watch action lock %v, trying again: %v", key, err)
+			}
+		case <-timer.C:
+			close(stop)
+			logBlockingAction(client, key)
+			return "", topo.ErrTimeout
+		case <-interrupted:
+			close(stop)
+			logBlockingAction(client, key)
+			return "", topo.ErrInterrupted
+		}
+	}
+}
+
+// lockRefresher refreshes the ttl of a held lock.
+type lockRefresher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// refreshLock refreshes the ttl of the lock key every lockTTL/3,
+// until stopRefreshingLock. The key is only refreshed if it wasn't
+// changed since, so a lock that expired isn't taken back.
+func (ets *Server) refreshLock(client Client, key, contents string, index uint64) {
+	lr := &lockRefresher{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	ets.mu.Lock()
+	ets.locks[key] = lr
+	ets.mu.Unlock()
+
+	go func() {
+		defer close(lr.done)
+		ticker := time.NewTicker(*lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				resp, err := client.CompareAndSwap(key, contents, uint64(lockTTL.Seconds()), index)
+				if err != nil {
+					log.Warningf("cannot refresh action lock %v: %v", key, err)
+					if IsError(err, ErrorCodeKeyNotFound) || IsError(err, ErrorCodeTestFailed) {
+						return
+					}
+					continue
+				}
+				index = resp.Node.ModifiedIndex
+			case <-lr.stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopRefreshingLock stops refreshing the lock key, and waits for
+// the current refresh.
+func (ets *Server) stopRefreshingLock(key string) {
+	ets.mu.Lock()
+	lr, ok := ets.locks[key]
+	delete(ets.locks, key)
+	ets.mu.Unlock()
+	if ok {
+		close(lr.stop)
+		<-lr.done
+	}
+}
+
+func logBlockingAction(client Client, key string) {
+	resp, err := client.Get(key, false, false)
+	if err != nil {
+		log.Warningf("Failed to get action lock %v (may have just ended): %v", key, err)
+		return
+	}
+	log.Warningf("------ Most likely blocking action: %v\n%v", key, resp.Node.Value)
+}
+
+// unlockForAction releases the lock of dir taken at lockPath, and
+// stores the results of the action in the actionlog of dir.
+func (ets *Server) unlockForAction(client Client, dir, lockPath, results string) error {
+	index, err := strconv.ParseUint(lockPath, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid lock path %v: %v", lockPath, err)
+	}
+	key := path.Join(dir, lockKey)
+	ets.stopRefreshingLock(key)
+
+	// the refreshes changed the index of the key, but not its
+	// creation index
+	resp, err := client.Get(key, false, false)
+	if err == nil && resp.Node.CreatedIndex != index {
+		err = fmt.Errorf("lock taken at %v", resp.Node.CreatedIndex)
+	}
+	if err == nil {
+		_, err = client.CompareAndDelete(key, resp.Node.ModifiedIndex)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release action lock %v at %v: %v", key, lockPath, err)
+	}
+	if _, err := client.CreateInOrder(path.Join(dir, "actionlog"), results, uint64(actionLogTTL.Seconds())); err != nil {
+		log.Warningf("Cannot store the results of the action of %v: %v", key, err)
+	}
+	return nil
+}
+
+func (ets *Server) LockKeyspaceForAction(keyspace, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	// the keyspace has to exist
+	if _, err := ets.GetKeyspace(keyspace); err != nil {
+		return "", err
+	}
+	return ets.lockForAction(ets.globalClient(), keyspaceDir(keyspace), contents, timeout, interrupted)
+}
+
+func (ets *Server) UnlockKeyspaceForAction(keyspace, lockPath, results string) error {
+	return ets.unlockForAction(ets.globalClient(), keyspaceDir(keyspace), lockPath, results)
+}
+
+func (ets *Server) LockShardForAction(keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	// the shard has to exist
+	if _, err := ets.GetShard(keyspace, shard); err != nil {
+		return "", err
+	}
+	return ets.lockForAction(ets.globalClient(), shardDir(keyspace, shard), contents, timeout, interrupted)
+}
+
+func (ets *Server) UnlockShardForAction(keyspace, shard, lockPath, results string) error {
+	return ets.unlockForAction(ets.globalClient(), shardDir(keyspace, shard), lockPath, results)
+}
+
+func (ets *Server) LockSrvShardForAction(cell, keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return "", err
+	}
+	return ets.lockForAction(client, srvShardDir(keyspace, shard), contents, timeout, interrupted)
+}
+
+func (ets *Server) UnlockSrvShardForAction(cell, keyspace, shard, lockPath, results string) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	return ets.unlockForAction(client, srvShardDir(keyspace, shard), lockPath, results)
+}
+
+// getActionLock returns the lock of dir, and its lock path.
+func getActionLock(client Client, dir string) (string, string, error) {
+	resp, err := client.Get(path.Join(dir, lockKey), false, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return "", "", topo.ErrNoNode
+		}
+		return "", "", err
+	}
+	return strconv.FormatUint(resp.Node.CreatedIndex, 10), resp.Node.Value, nil
+}
+
+func (ets *Server) GetKeyspaceActionLock(keyspace string) (string, string, error) {
+	return getActionLock(ets.globalClient(), keyspaceDir(keyspace))
+}
+
+func (ets *Server) GetShardActionLock(keyspace, shard string) (string, string, error) {
+	return getActionLock(ets.globalClient(), shardDir(keyspace, shard))
+}
@@ -0,0 +1,91 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the replication graph management code for etcdtopo.Server
+*/
+
+func shardReplicationKey(keyspace, shard string) string {
+	return path.Join("/vt/replication", keyspace, shard)
+}
+
+func (ets *Server) UpdateShardReplicationFields(cell, keyspace, shard string, update func(*topo.ShardReplication) error) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+
+	key := shardReplicationKey(keyspace, shard)
+	for {
+		sr := &topo.ShardReplication{}
+		var version uint64
+		resp, err := client.Get(key, false, false)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal([]byte(resp.Node.Value), sr); err != nil {
+				return fmt.Errorf("bad ShardReplication data %v", err)
+			}
+			version = resp.Node.ModifiedIndex
+		case IsError(err, ErrorCodeKeyNotFound):
+		default:
+			return err
+		}
+
+		if err := update(sr); err != nil {
+			return err
+		}
+
+		// create it, or update the version we read
+		if version == 0 {
+			_, err = client.Create(key, jscfg.ToJson(sr), 0)
+		} else {
+			_, err = client.CompareAndSwap(key, jscfg.ToJson(sr), 0, version)
+		}
+		if IsError(err, ErrorCodeNodeExist) || IsError(err, ErrorCodeTestFailed) || IsError(err, ErrorCodeKeyNotFound) {
+			// someone else changed it, try again
+			continue
+		}
+		return err
+	}
+}
+
+func (ets *Server) GetShardReplication(cell, keyspace, shard string) (*topo.ShardReplicationInfo, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(shardReplicationKey(keyspace, shard), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	sr := &topo.ShardReplication{}
+	if err = json.Unmarshal([]byte(resp.Node.Value), sr); err != nil {
+		return nil, fmt.Errorf("bad ShardReplication data %v", err)
+	}
+
+	return topo.NewShardReplicationInfo(sr, cell, keyspace, shard), nil
+}
+
+func (ets *Server) DeleteShardReplication(cell, keyspace, shard string) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Delete(shardReplicationKey(keyspace, shard), false); err != nil {
+		return convertError(err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package etcdtopo implements topo.Server with etcd.
+//
+// There is a global etcd cluster, for the keyspaces, shards and their
+// locks, and one etcd cluster per cell, for the tablets, the
+// replication graph and the serving graph. The cells are registered in
+// the global cluster, with the comma separated addresses of their
+// cluster:
+//
+//	etcdctl set /vt/cells/<cell> http://host1:4001,http://host2:4001
+//
+// etcd keys can't have data and children, so the objects that have
+// children store their data in a _Data key of their directory.
+package etcdtopo
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	globalAddrs = flag.String("etcd_global_addrs", "", "comma separated addresses of the global etcd cluster, like http://host1:4001,http://host2:4001")
+	etcdTimeout = flag.Duration("etcd_timeout", 10*time.Second, "timeout of the etcd requests, except the watches")
+	lockTTL     = flag.Duration("etcd_lock_ttl", 30*time.Second, "expiration of the etcd action locks, refreshed while they are held, so the locks of the processes that died are released")
+)
+
+const (
+	// dataKey is the key of the data of a directory
+	dataKey = "_Data"
+
+	// lockKey is the key of the action lock of a directory
+	lockKey = "_Lock"
+
+	// cellsDir is the directory of the cells, in the global cluster
+	cellsDir = "/vt/cells"
+)
+
+// Server is the etcd topo.Server implementation.
+type Server struct {
+	// newClient creates the clients of the clusters
+	newClient func(addrs []string) Client
+
+	// mu protects global, cells and locks
+	mu     sync.Mutex
+	global Client
+	cells  map[string]Client
+	// locks has the refreshers of the held action locks, by key
+	locks map[string]*lockRefresher
+}
+
+// NewServer can be used to create a custom Server (for tests for
+// instance) but it cannot change the globally registered one. The
+// clients are created with newClient, the global one the first time
+// it is used.
+func NewServer(newClient func(addrs []string) Client) *Server {
+	return &Server{
+		newClient: newClient,
+		cells:     make(map[string]Client),
+		locks:     make(map[string]*lockRefresher),
+	}
+}
+
+func init() {
+	topo.RegisterServer("etcd", NewServer(NewClient))
+}
+
+func (ets *Server) Close() {
+}
+
+// splitAddrs parses a comma separated list of addresses.
+func splitAddrs(addrs string) []string {
+	result := make([]string, 0, 3)
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// globalClient returns the client of the global cluster.
+func (ets *Server) globalClient() Client {
+	ets.mu.Lock()
+	defer ets.mu.Unlock()
+	if ets.global == nil {
+		ets.global = ets.newClient(splitAddrs(*globalAddrs))
+	}
+	return ets.global
+}
+
+// cellClient returns the client of the cluster of cell, reading its
+// addresses from the global cluster. Returns topo.ErrNoNode for an
+// unknown cell.
+func (ets *Server) cellClient(cell string) (Client, error) {
+	ets.mu.Lock()
+	client, ok := ets.cells[cell]
+	ets.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	resp, err := ets.globalClient().Get(cellsDir+"/"+cell, false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	ets.mu.Lock()
+	defer ets.mu.Unlock()
+	if client, ok := ets.cells[cell]; ok {
+		return client, nil
+	}
+	client = ets.newClient(splitAddrs(resp.Node.Value))
+	ets.cells[cell] = client
+	return client, nil
+}
+
+// convertError returns the topo error matching an etcd error.
+func convertError(err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return err
+	}
+	switch e.ErrorCode {
+	case ErrorCodeKeyNotFound:
+		return topo.ErrNoNode
+	case ErrorCodeNodeExist:
+		return topo.ErrNodeExists
+	case ErrorCodeTestFailed:
+		return topo.ErrBadVersion
+	}
+	return err
+}
+
+// childrenNames returns the sorted names of the children of node.
+// If dirs is set, only the directories are returned, otherwise only
+// the keys.
+func childrenNames(node *Node, dirs bool) []string {
+	result := make([]string, 0, len(node.Nodes))
+	for _, child := range node.Nodes {
+		if child.Dir != dirs {
+			continue
+		}
+		result = append(result, child.Key[strings.LastIndex(child.Key, "/")+1:])
+	}
+	sort.Strings(result)
+	return result
+}
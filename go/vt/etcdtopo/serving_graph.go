@@ -0,0 +1,223 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph management code of etcdtopo.Server
+*/
+
+const (
+	servingDir = "/vt/ns"
+)
+
+func srvKeyspaceDir(keyspace string) string {
+	return path.Join(servingDir, keyspace)
+}
+
+func srvShardDir(keyspace, shard string) string {
+	return path.Join(srvKeyspaceDir(keyspace), shard)
+}
+
+func endPointsKey(keyspace, shard string, tabletType topo.TabletType) string {
+	return path.Join(srvShardDir(keyspace, shard), string(tabletType))
+}
+
+func (ets *Server) GetSrvTabletTypesPerShard(cell, keyspace, shard string) ([]topo.TabletType, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(srvShardDir(keyspace, shard), true, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	children := childrenNames(resp.Node, false)
+	result := make([]topo.TabletType, 0, len(children))
+	for _, tt := range children {
+		// _Data and _Lock are not types
+		if strings.HasPrefix(tt, "_") {
+			continue
+		}
+		result = append(result, topo.TabletType(tt))
+	}
+	return result, nil
+}
+
+func (ets *Server) UpdateEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, addrs *topo.EndPoints) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(endPointsKey(keyspace, shard, tabletType), jscfg.ToJson(addrs), 0)
+	return convertError(err)
+}
+
+func (ets *Server) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(endPointsKey(keyspace, shard, tabletType), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	result := &topo.EndPoints{}
+	if len(resp.Node.Value) > 0 {
+		if err := json.Unmarshal([]byte(resp.Node.Value), result); err != nil {
+			return nil, fmt.Errorf("EndPoints unmarshal failed: %v %v", resp.Node.Value, err)
+		}
+	}
+	return result, nil
+}
+
+func (ets *Server) DeleteEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(endPointsKey(keyspace, shard, tabletType), false)
+	return convertError(err)
+}
+
+func (ets *Server) UpdateSrvShard(cell, keyspace, shard string, srvShard *topo.SrvShard) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(path.Join(srvShardDir(keyspace, shard), dataKey), jscfg.ToJson(srvShard), 0)
+	return convertError(err)
+}
+
+func (ets *Server) GetSrvShard(cell, keyspace, shard string) (*topo.SrvShard, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(path.Join(srvShardDir(keyspace, shard), dataKey), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	srvShard := topo.NewSrvShard(int64(resp.Node.ModifiedIndex))
+	if len(resp.Node.Value) > 0 {
+		if err := json.Unmarshal([]byte(resp.Node.Value), srvShard); err != nil {
+			return nil, fmt.Errorf("SrvShard unmarshal failed: %v %v", resp.Node.Value, err)
+		}
+	}
+	return srvShard, nil
+}
+
+func (ets *Server) DeleteSrvShard(cell, keyspace, shard string) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(path.Join(srvShardDir(keyspace, shard), dataKey), false)
+	return convertError(err)
+}
+
+func (ets *Server) UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+	_, err = client.Set(path.Join(srvKeyspaceDir(keyspace), dataKey), jscfg.ToJson(srvKeyspace), 0)
+	return convertError(err)
+}
+
+func (ets *Server) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(path.Join(srvKeyspaceDir(keyspace), dataKey), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	srvKeyspace := topo.NewSrvKeyspace(int64(resp.Node.ModifiedIndex))
+	if len(resp.Node.Value) > 0 {
+		if err := json.Unmarshal([]byte(resp.Node.Value), srvKeyspace); err != nil {
+			return nil, fmt.Errorf("SrvKeyspace unmarshal failed: %v %v", resp.Node.Value, err)
+		}
+	}
+	return srvKeyspace, nil
+}
+
+func (ets *Server) GetSrvKeyspaceNames(cell string) ([]string, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(servingDir, true, false)
+	if err != nil {
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return childrenNames(resp.Node, true), nil
+}
+
+func (ets *Server) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, addr *topo.EndPoint) error {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return err
+	}
+
+	key := endPointsKey(keyspace, shard, tabletType)
+	for {
+		resp, err := client.Get(key, false, false)
+		if err != nil {
+			if IsError(err, ErrorCodeKeyNotFound) {
+				// We haven't been placed in the serving graph
+				// yet, so don't update. Assume the next process
+				// that rebuilds the graph will get the updated
+				// tablet location.
+				return nil
+			}
+			return err
+		}
+
+		addrs := topo.NewEndPoints()
+		if len(resp.Node.Value) > 0 {
+			if err := json.Unmarshal([]byte(resp.Node.Value), addrs); err != nil {
+				return fmt.Errorf("EndPoints unmarshal failed: %v %v", resp.Node.Value, err)
+			}
+		}
+		foundTablet := false
+		for i, entry := range addrs.Entries {
+			if entry.Uid == addr.Uid {
+				foundTablet = true
+				if topo.EndPointEquality(&entry, addr) {
+					return nil
+				}
+				addrs.Entries[i] = *addr
+				break
+			}
+		}
+		if !foundTablet {
+			addrs.Entries = append(addrs.Entries, *addr)
+		}
+
+		_, err = client.CompareAndSwap(key, jscfg.ToJson(addrs), 0, resp.Node.ModifiedIndex)
+		if IsError(err, ErrorCodeTestFailed) {
+			// someone else changed it, try again
+			continue
+		}
+		if IsError(err, ErrorCodeKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the shard management code for etcdtopo.Server
+*/
+
+func shardDir(keyspace, shard string) string {
+	return path.Join(shardsDir(keyspace), shard)
+}
+
+func (ets *Server) CreateShard(keyspace, shard string, value *topo.Shard) error {
+	if _, err := ets.globalClient().Create(path.Join(shardDir(keyspace, shard), dataKey), jscfg.ToJson(value), 0); err != nil {
+		return convertError(err)
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, value),
+		Status:    "created",
+	})
+	return nil
+}
+
+func (ets *Server) UpdateShard(si *topo.ShardInfo) error {
+	if _, err := ets.globalClient().Update(path.Join(shardDir(si.Keyspace(), si.ShardName()), dataKey), jscfg.ToJson(si.Shard), 0); err != nil {
+		return convertError(err)
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *si,
+		Status:    "updated",
+	})
+	return nil
+}
+
+func (ets *Server) ValidateShard(keyspace, shard string) error {
+	_, err := ets.GetShard(keyspace, shard)
+	return err
+}
+
+func (ets *Server) GetShard(keyspace, shard string) (*topo.ShardInfo, error) {
+	resp, err := ets.globalClient().Get(path.Join(shardDir(keyspace, shard), dataKey), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	s := &topo.Shard{}
+	if err = json.Unmarshal([]byte(resp.Node.Value), s); err != nil {
+		return nil, fmt.Errorf("bad shard data %v", err)
+	}
+
+	return topo.NewShardInfo(keyspace, shard, s), nil
+}
+
+func (ets *Server) GetShardCritical(keyspace, shard string) (*topo.ShardInfo, error) {
+	return ets.GetShard(keyspace, shard)
+}
+
+func (ets *Server) GetShardNames(keyspace string) ([]string, error) {
+	resp, err := ets.globalClient().Get(shardsDir(keyspace), true, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return childrenNames(resp.Node, true), nil
+}
+
+func (ets *Server) DeleteShard(keyspace, shard string) error {
+	if _, err := ets.globalClient().Delete(shardDir(keyspace, shard), true); err != nil {
+		return convertError(err)
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, nil),
+		Status:    "deleted",
+	})
+	return nil
+}
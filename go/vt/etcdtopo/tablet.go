@@ -0,0 +1,167 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the tablet management parts of etcdtopo.Server
+*/
+
+const (
+	tabletsDir = "/vt/tablets"
+)
+
+// tabletDir returns the directory of the tablet, in its cell.
+func tabletDir(alias topo.TabletAlias) string {
+	return path.Join(tabletsDir, alias.TabletUidStr())
+}
+
+func tabletFromJson(data string) (*topo.Tablet, error) {
+	t := &topo.Tablet{}
+	if err := json.Unmarshal([]byte(data), t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (ets *Server) CreateTablet(tablet *topo.Tablet) error {
+	client, err := ets.cellClient(tablet.Alias.Cell)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Create(path.Join(tabletDir(tablet.Alias), dataKey), tablet.Json(), 0); err != nil {
+		return convertError(err)
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet,
+		Status: "created",
+	})
+	return nil
+}
+
+func (ets *Server) UpdateTablet(tablet *topo.TabletInfo, existingVersion int64) (int64, error) {
+	client, err := ets.cellClient(tablet.Alias.Cell)
+	if err != nil {
+		return 0, err
+	}
+
+	var resp *Response
+	key := path.Join(tabletDir(tablet.Alias), dataKey)
+	if existingVersion < 0 {
+		resp, err = client.Update(key, tablet.Json(), 0)
+	} else {
+		resp, err = client.CompareAndSwap(key, tablet.Json(), 0, uint64(existingVersion))
+	}
+	if err != nil {
+		return 0, convertError(err)
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet.Tablet,
+		Status: "updated",
+	})
+	return int64(resp.Node.ModifiedIndex), nil
+}
+
+func (ets *Server) UpdateTabletFields(tabletAlias topo.TabletAlias, update func(*topo.Tablet) error) error {
+	for {
+		ti, err := ets.GetTablet(tabletAlias)
+		if err != nil {
+			return err
+		}
+		if err := update(ti.Tablet); err != nil {
+			return err
+		}
+		_, err = ets.UpdateTablet(ti, ti.Version())
+		if err == topo.ErrBadVersion {
+			// someone else updated it, try again
+			continue
+		}
+		return err
+	}
+}
+
+func (ets *Server) DeleteTablet(alias topo.TabletAlias) error {
+	client, err := ets.cellClient(alias.Cell)
+	if err != nil {
+		return err
+	}
+
+	// We need to find out the keyspace and shard names because those are required
+	// in the TabletChange event.
+	ti, tiErr := ets.GetTablet(alias)
+
+	if _, err := client.Delete(tabletDir(alias), true); err != nil {
+		return convertError(err)
+	}
+
+	// Only try to log if we have the required information.
+	if tiErr == nil {
+		// We only want to copy the identity info for the tablet (alias, etc.).
+		// The rest has just been deleted, so it should be blank.
+		event.Dispatch(&events.TabletChange{
+			Tablet: topo.Tablet{
+				Alias:    ti.Tablet.Alias,
+				Keyspace: ti.Tablet.Keyspace,
+				Shard:    ti.Tablet.Shard,
+			},
+			Status: "deleted",
+		})
+	}
+	return nil
+}
+
+func (ets *Server) ValidateTablet(alias topo.TabletAlias) error {
+	_, err := ets.GetTablet(alias)
+	return err
+}
+
+func (ets *Server) GetTablet(alias topo.TabletAlias) (*topo.TabletInfo, error) {
+	client, err := ets.cellClient(alias.Cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(path.Join(tabletDir(alias), dataKey), false, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	tablet, err := tabletFromJson(resp.Node.Value)
+	if err != nil {
+		return nil, fmt.Errorf("bad tablet data %v", err)
+	}
+	return topo.NewTabletInfo(tablet, int64(resp.Node.ModifiedIndex)), nil
+}
+
+func (ets *Server) GetTabletsByCell(cell string) ([]topo.TabletAlias, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(tabletsDir, true, false)
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	children := childrenNames(resp.Node, true)
+	result := make([]topo.TabletAlias, len(children))
+	for i, child := range children {
+		result[i].Cell = cell
+		result[i].Uid, err = topo.ParseUid(child)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,32 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"path"
+)
+
+/*
+This file contains the VSchema management code for etcdtopo.Server
+
+The VSchema of a keyspace is at /vt/keyspaces/<keyspace>/vschema.
+*/
+
+func vschemaFilePath(keyspace string) string {
+	return path.Join(keyspaceDir(keyspace), "vschema")
+}
+
+func (ets *Server) SaveVSchema(keyspace, vschema string) error {
+	_, err := ets.globalClient().Set(vschemaFilePath(keyspace), vschema, 0)
+	return convertError(err)
+}
+
+func (ets *Server) GetVSchema(keyspace string) (string, error) {
+	resp, err := ets.globalClient().Get(vschemaFilePath(keyspace), false, false)
+	if err != nil {
+		return "", convertError(err)
+	}
+	return resp.Node.Value, nil
+}
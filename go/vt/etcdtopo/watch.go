@@ -0,0 +1,137 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package etcdtopo
+
+import (
+	"encoding/json"
+	"path"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph watches of etcdtopo.Server
+*/
+
+// watchKey sends the node of key, or nil if it doesn't exist, then
+// its new values as they change. The channel is closed when stop is
+// closed or the watch fails. The first read is done before it
+// returns.
+func watchKey(client Client, key string, stop chan struct{}) (<-chan *Node, error) {
+	var first *Node
+	var index uint64
+	resp, err := client.Get(key, false, false)
+	switch {
+	case err == nil:
+		first = resp.Node
+		index = resp.EtcdIndex
+	case IsError(err, ErrorCodeKeyNotFound):
+		index = err.(*Error).Index
+	default:
+		return nil, err
+	}
+
+	result := make(chan *Node, 1)
+	result <- first
+	go func() {
+		defer close(result)
+		for {
+			resp, err := client.Watch(key, index+1, false, stop)
+			if err != nil {
+				log.Warningf("cannot watch %v, stopping the watch: %v", key, err)
+				return
+			}
+			if resp == nil {
+				// stop was closed
+				return
+			}
+			index = resp.Node.ModifiedIndex
+
+			var node *Node
+			switch resp.Action {
+			case "delete", "compareAndDelete", "expire":
+			default:
+				node = resp.Node
+			}
+			select {
+			case result <- node:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return result, nil
+}
+
+func (ets *Server) WatchSrvKeyspace(cell, keyspace string, stop chan struct{}) (<-chan *topo.SrvKeyspace, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	key := path.Join(srvKeyspaceDir(keyspace), dataKey)
+	nodes, err := watchKey(client, key, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.SrvKeyspace, 1)
+	go func() {
+		defer close(result)
+		for node := range nodes {
+			var value *topo.SrvKeyspace
+			if node != nil {
+				value = topo.NewSrvKeyspace(int64(node.ModifiedIndex))
+				if len(node.Value) > 0 {
+					if err := json.Unmarshal([]byte(node.Value), value); err != nil {
+						log.Warningf("SrvKeyspace unmarshal failed, stopping the watch of %v: %v %v", key, node.Value, err)
+						return
+					}
+				}
+			}
+			select {
+			case result <- value:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return result, nil
+}
+
+func (ets *Server) WatchEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, stop chan struct{}) (<-chan *topo.EndPoints, error) {
+	client, err := ets.cellClient(cell)
+	if err != nil {
+		return nil, err
+	}
+	key := endPointsKey(keyspace, shard, tabletType)
+	nodes, err := watchKey(client, key, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.EndPoints, 1)
+	go func() {
+		defer close(result)
+		for node := range nodes {
+			var value *topo.EndPoints
+			if node != nil {
+				value = &topo.EndPoints{}
+				if len(node.Value) > 0 {
+					if err := json.Unmarshal([]byte(node.Value), value); err != nil {
+						log.Warningf("EndPoints unmarshal failed, stopping the watch of %v: %v %v", key, node.Value, err)
+						return
+					}
+				}
+			}
+			select {
+			case result <- value:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return result, nil
+}
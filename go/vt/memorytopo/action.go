@@ -0,0 +1,99 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the remote tablet action code of memorytopo.Server
+
+The actions of a tablet are nodes under its action directory, named
+with the zero-padded version they were created at, so they sort in
+order. Their response is stored in the actionlog directory, under the
+same name. The action path is the path of the node:
+  /<cell>/tablets/<uid>/action/<version>
+*/
+
+// actionLogPath returns the path of the response of the action path.
+func actionLogPath(actionPath string) string {
+	return strings.Replace(actionPath, "/action/", "/actionlog/", 1)
+}
+
+// parseActionPath returns the tablet alias of the action path.
+func parseActionPath(actionPath string) (topo.TabletAlias, error) {
+	pathParts := strings.Split(actionPath, "/")
+	if len(pathParts) != 6 || pathParts[0] != "" || pathParts[2] != "tablets" || pathParts[4] != "action" {
+		return topo.TabletAlias{}, fmt.Errorf("invalid action path: %v", actionPath)
+	}
+	return topo.ParseTabletAliasString(pathParts[1] + "-" + pathParts[3])
+}
+
+func (s *Server) WriteTabletAction(tabletAlias topo.TabletAlias, contents string) (string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	dir, err := s.tabletPath(tabletAlias, "action")
+	if err != nil {
+		return "", err
+	}
+	version := s.notify()
+	actionPath := fmt.Sprintf("%v/%020d", dir, version)
+	s.nodes[actionPath] = &node{contents: contents, version: version}
+	return actionPath, nil
+}
+
+func (s *Server) WaitForTabletAction(actionPath string, waitTime time.Duration, interrupted chan struct{}) (string, error) {
+	if _, err := parseActionPath(actionPath); err != nil {
+		return "", err
+	}
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+
+	logPath := actionLogPath(actionPath)
+	for {
+		s.lock()
+		n, ok := s.nodes[logPath]
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return n.contents, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return "", topo.ErrTimeout
+		case <-interrupted:
+			return "", topo.ErrInterrupted
+		}
+	}
+}
+
+func (s *Server) PurgeTabletActions(tabletAlias topo.TabletAlias, canBePurged func(data string) bool) error {
+	s.lock()
+	defer s.mu.Unlock()
+	dir, err := s.tabletPath(tabletAlias, "action")
+	if err != nil {
+		return err
+	}
+
+	// Purge newer items first so the action queues don't try to process something.
+	children := s.children(dir)
+	for i := len(children) - 1; i >= 0; i-- {
+		p := dir + "/" + children[i]
+		if !canBePurged(s.nodes[p].contents) {
+			continue
+		}
+		if err := s.remove(p); err != nil {
+			return fmt.Errorf("PurgeTabletActions(%v) err: %v", tabletAlias, err)
+		}
+	}
+	return nil
+}
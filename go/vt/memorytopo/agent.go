@@ -0,0 +1,149 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the code to support the local agent process for memorytopo.Server
+*/
+
+func (s *Server) ValidateTabletActions(tabletAlias topo.TabletAlias) error {
+	// there are no directories, the actions only need the tablet
+	_, err := s.GetTablet(tabletAlias)
+	return err
+}
+
+func (s *Server) CreateTabletPidNode(tabletAlias topo.TabletAlias, contents string, done chan struct{}) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.tabletPath(tabletAlias, "pid")
+	if err != nil {
+		return err
+	}
+	s.set(p, contents)
+
+	go func() {
+		<-done
+		s.lock()
+		defer s.mu.Unlock()
+		if err := s.remove(p); err != nil {
+			log.Warningf("cannot delete pid node %v: %v", p, err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) ValidateTabletPidNode(tabletAlias topo.TabletAlias) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.tabletPath(tabletAlias, "pid")
+	if err != nil {
+		return err
+	}
+	_, err = s.get(p)
+	return err
+}
+
+func (s *Server) GetSubprocessFlags() []string {
+	// the data is in this process only, there is nothing to
+	// pass to a subprocess
+	return nil
+}
+
+func (s *Server) ActionEventLoop(tabletAlias topo.TabletAlias, dispatchAction func(actionPath, data string) error, done chan struct{}) {
+	for {
+		s.lock()
+		dir, err := s.tabletPath(tabletAlias, "action")
+		if err != nil {
+			s.mu.Unlock()
+			log.Warningf("cannot get the action queue of %v, will try again in 5 seconds: %v", tabletAlias, err)
+			select {
+			case <-time.After(5 * time.Second):
+				continue
+			case <-done:
+				return
+			}
+		}
+		children := s.children(dir)
+		actions := make([]*node, len(children))
+		for i, child := range children {
+			actions[i] = s.nodes[dir+"/"+child]
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		// Process all pending actions, until one fails. No
+		// error is returned for action failures.
+		for i, action := range actions {
+			if err := dispatchAction(dir+"/"+children[i], action.contents); err != nil {
+				break
+			}
+		}
+
+		// wait for a change of the queue
+		select {
+		case <-changed:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *Server) ReadTabletActionPath(actionPath string) (topo.TabletAlias, string, int64, error) {
+	tabletAlias, err := parseActionPath(actionPath)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+
+	s.lock()
+	defer s.mu.Unlock()
+	n, err := s.get(actionPath)
+	if err != nil {
+		return topo.TabletAlias{}, "", 0, err
+	}
+	return tabletAlias, n.contents, n.version, nil
+}
+
+func (s *Server) UpdateTabletAction(actionPath, data string, version int64) error {
+	if _, err := parseActionPath(actionPath); err != nil {
+		return err
+	}
+
+	s.lock()
+	defer s.mu.Unlock()
+	_, err := s.update(actionPath, data, version)
+	return err
+}
+
+// StoreTabletActionResponse stores the data both in action and actionlog
+func (s *Server) StoreTabletActionResponse(actionPath, data string) error {
+	if _, err := parseActionPath(actionPath); err != nil {
+		return err
+	}
+
+	s.lock()
+	defer s.mu.Unlock()
+	if _, err := s.update(actionPath, data, -1); err != nil {
+		return err
+	}
+	s.set(actionLogPath(actionPath), data)
+	return nil
+}
+
+func (s *Server) UnblockTabletAction(actionPath string) error {
+	if _, err := parseActionPath(actionPath); err != nil {
+		return err
+	}
+
+	s.lock()
+	defer s.mu.Unlock()
+	return s.remove(actionPath)
+}
@@ -0,0 +1,70 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the global records copies management code of
+memorytopo.Server
+
+The copy of a keyspace is at /<cell>/globalcopy/<keyspace>.
+*/
+
+func (s *Server) UpdateGlobalCopy(cell, keyspace string, gc *topo.GlobalCopy) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "globalcopy", keyspace)
+	if err != nil {
+		return err
+	}
+	s.set(p, jscfg.ToJson(gc))
+	return nil
+}
+
+func (s *Server) GetGlobalCopy(cell, keyspace string) (*topo.GlobalCopy, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "globalcopy", keyspace)
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	gc := &topo.GlobalCopy{}
+	if err := json.Unmarshal([]byte(n.contents), gc); err != nil {
+		return nil, fmt.Errorf("GlobalCopy unmarshal failed: %v %v", n.contents, err)
+	}
+	return gc, nil
+}
+
+func (s *Server) GetGlobalCopyKeyspaces(cell string) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "globalcopy")
+	if err != nil {
+		return nil, err
+	}
+	return s.children(p), nil
+}
+
+func (s *Server) DeleteGlobalCopy(cell, keyspace string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "globalcopy", keyspace)
+	if err != nil {
+		return err
+	}
+	return s.remove(p)
+}
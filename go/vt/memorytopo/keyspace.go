@@ -0,0 +1,93 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the Keyspace management code for memorytopo.Server
+*/
+
+func keyspacePath(keyspace string) string {
+	return "/" + globalCell + "/keyspaces/" + keyspace
+}
+
+func shardsPath(keyspace string) string {
+	return keyspacePath(keyspace) + "/shards"
+}
+
+func (s *Server) CreateKeyspace(keyspace string, value *topo.Keyspace) error {
+	s.lock()
+	_, err := s.create(keyspacePath(keyspace), jscfg.ToJson(value))
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, value),
+		Status:       "created",
+	})
+	return nil
+}
+
+func (s *Server) UpdateKeyspace(ki *topo.KeyspaceInfo) error {
+	s.lock()
+	_, err := s.update(keyspacePath(ki.KeyspaceName()), jscfg.ToJson(ki.Keyspace), -1)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *ki,
+		Status:       "updated",
+	})
+	return nil
+}
+
+func (s *Server) GetKeyspace(keyspace string) (*topo.KeyspaceInfo, error) {
+	s.lock()
+	n, err := s.get(keyspacePath(keyspace))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &topo.Keyspace{}
+	if err := json.Unmarshal([]byte(n.contents), k); err != nil {
+		return nil, fmt.Errorf("bad keyspace data %v", err)
+	}
+	return topo.NewKeyspaceInfo(keyspace, k), nil
+}
+
+func (s *Server) GetKeyspaces() ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	return s.children("/" + globalCell + "/keyspaces"), nil
+}
+
+func (s *Server) DeleteKeyspaceShards(keyspace string) error {
+	s.lock()
+	err := s.removeTree(shardsPath(keyspace))
+	s.mu.Unlock()
+	if err != nil && err != topo.ErrNoNode {
+		return err
+	}
+
+	event.Dispatch(&events.KeyspaceChange{
+		KeyspaceInfo: *topo.NewKeyspaceInfo(keyspace, nil),
+		Status:       "deleted all shards",
+	})
+	return nil
+}
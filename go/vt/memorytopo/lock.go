@@ -0,0 +1,134 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the lock management code for memorytopo.Server
+
+The locks are kept apart from the nodes, by the path of the object
+they lock. The lock path is the version of the lock.
+*/
+
+// lockForAction takes the lock of path, waiting for the current
+// holder to release it. If mustExist is set, the node at path has to
+// exist. mu has to be held, and is released when it returns.
+func (s *Server) lockForAction(path string, mustExist bool, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	defer s.mu.Unlock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if mustExist {
+			if _, err := s.get(path); err != nil {
+				return "", err
+			}
+		}
+		l, ok := s.locks[path]
+		if !ok {
+			version := s.notify()
+			s.locks[path] = &node{contents: contents, version: version}
+			return strconv.FormatInt(version, 10), nil
+		}
+
+		// wait for a change
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+			s.mu.Lock()
+		case <-timer.C:
+			s.mu.Lock()
+			log.Warningf("------ Most likely blocking action: %v\n%v", path, l.contents)
+			return "", topo.ErrTimeout
+		case <-interrupted:
+			s.mu.Lock()
+			log.Warningf("------ Most likely blocking action: %v\n%v", path, l.contents)
+			return "", topo.ErrInterrupted
+		}
+	}
+}
+
+// unlockForAction releases the lock of path taken at lockPath.
+// mu has to be held, and is released when it returns.
+func (s *Server) unlockForAction(path, lockPath, results string) error {
+	defer s.mu.Unlock()
+	l, ok := s.locks[path]
+	if !ok || strconv.FormatInt(l.version, 10) != lockPath {
+		return fmt.Errorf("action lock %v is not held at %v", path, lockPath)
+	}
+	delete(s.locks, path)
+	s.notify()
+	log.V(6).Infof("released action lock %v, results: %v", path, results)
+	return nil
+}
+
+func (s *Server) LockKeyspaceForAction(keyspace, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	s.lock()
+	return s.lockForAction(keyspacePath(keyspace), true, contents, timeout, interrupted)
+}
+
+func (s *Server) UnlockKeyspaceForAction(keyspace, lockPath, results string) error {
+	s.lock()
+	return s.unlockForAction(keyspacePath(keyspace), lockPath, results)
+}
+
+func (s *Server) LockShardForAction(keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	s.lock()
+	return s.lockForAction(shardPath(keyspace, shard), true, contents, timeout, interrupted)
+}
+
+func (s *Server) UnlockShardForAction(keyspace, shard, lockPath, results string) error {
+	s.lock()
+	return s.unlockForAction(shardPath(keyspace, shard), lockPath, results)
+}
+
+func (s *Server) LockSrvShardForAction(cell, keyspace, shard, contents string, timeout time.Duration, interrupted chan struct{}) (string, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	return s.lockForAction(p, false, contents, timeout, interrupted)
+}
+
+func (s *Server) UnlockSrvShardForAction(cell, keyspace, shard, lockPath, results string) error {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	return s.unlockForAction(p, lockPath, results)
+}
+
+// getActionLock returns the lock of path. mu has to be held.
+func (s *Server) getActionLock(path string) (string, string, error) {
+	l, ok := s.locks[path]
+	if !ok {
+		return "", "", topo.ErrNoNode
+	}
+	return strconv.FormatInt(l.version, 10), l.contents, nil
+}
+
+func (s *Server) GetKeyspaceActionLock(keyspace string) (string, string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	return s.getActionLock(keyspacePath(keyspace))
+}
+
+func (s *Server) GetShardActionLock(keyspace, shard string) (string, string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	return s.getActionLock(shardPath(keyspace, shard))
+}
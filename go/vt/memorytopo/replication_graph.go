@@ -0,0 +1,69 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the replication graph management code for memorytopo.Server
+*/
+
+func (s *Server) UpdateShardReplicationFields(cell, keyspace, shard string, update func(*topo.ShardReplication) error) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "replication", keyspace, shard)
+	if err != nil {
+		return err
+	}
+
+	// the whole update is done under the lock, so there is no
+	// concurrent change to retry on
+	sr := &topo.ShardReplication{}
+	if n, err := s.get(p); err == nil {
+		if err := json.Unmarshal([]byte(n.contents), sr); err != nil {
+			return fmt.Errorf("bad ShardReplication data %v", err)
+		}
+	}
+	if err := update(sr); err != nil {
+		return err
+	}
+	s.set(p, jscfg.ToJson(sr))
+	return nil
+}
+
+func (s *Server) GetShardReplication(cell, keyspace, shard string) (*topo.ShardReplicationInfo, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "replication", keyspace, shard)
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &topo.ShardReplication{}
+	if err := json.Unmarshal([]byte(n.contents), sr); err != nil {
+		return nil, fmt.Errorf("bad ShardReplication data %v", err)
+	}
+	return topo.NewShardReplicationInfo(sr, cell, keyspace, shard), nil
+}
+
+func (s *Server) DeleteShardReplication(cell, keyspace, shard string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "replication", keyspace, shard)
+	if err != nil {
+		return err
+	}
+	return s.remove(p)
+}
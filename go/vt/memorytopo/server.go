@@ -0,0 +1,206 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package memorytopo implements topo.Server in memory, for tests and
+// single process setups that shouldn't depend on a lock server.
+//
+// The records are kept as JSON in a tree of nodes, the global ones
+// under /global, the ones of a cell under /<cell>. Each change gets a
+// new version, and wakes up the locks and the action loops waiting
+// for it. Nothing is shared with other processes: the vtaction
+// subprocesses of a tablet can't use it.
+package memorytopo
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var cellsFlag = flag.String("memorytopo_cells", "test", "comma separated cells of the registered in-memory topology server")
+
+const globalCell = "global"
+
+// node is a record of the tree.
+type node struct {
+	contents string
+	version  int64
+}
+
+// Server is the in-memory topo.Server implementation.
+type Server struct {
+	// cellsOnce reads the cells, from the flag for the
+	// registered server
+	cellsOnce sync.Once
+	cellsFunc func() []string
+
+	// mu protects all the fields below
+	mu      sync.Mutex
+	cells   map[string]bool
+	nodes   map[string]*node
+	locks   map[string]*node
+	version int64
+	// changed is closed and replaced at every change
+	changed chan struct{}
+}
+
+// NewServer returns an empty Server with the given cells.
+func NewServer(cells []string) *Server {
+	return newServer(func() []string { return cells })
+}
+
+func newServer(cellsFunc func() []string) *Server {
+	return &Server{
+		cellsFunc: cellsFunc,
+		nodes:     make(map[string]*node),
+		locks:     make(map[string]*node),
+		changed:   make(chan struct{}),
+	}
+}
+
+func init() {
+	topo.RegisterServer("memory", newServer(func() []string {
+		return strings.Split(*cellsFlag, ",")
+	}))
+}
+
+func (s *Server) Close() {
+}
+
+// lock locks mu, after reading the cells the first time.
+func (s *Server) lock() {
+	s.cellsOnce.Do(func() {
+		cells := make(map[string]bool)
+		for _, cell := range s.cellsFunc() {
+			if cell = strings.TrimSpace(cell); cell != "" {
+				cells[cell] = true
+			}
+		}
+		s.mu.Lock()
+		s.cells = cells
+		s.mu.Unlock()
+	})
+	s.mu.Lock()
+}
+
+func (s *Server) GetKnownCells() ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	result := make([]string, 0, len(s.cells))
+	for cell := range s.cells {
+		result = append(result, cell)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// cellPath returns the path of the elements under the root of the
+// cell, or topo.ErrNoNode for an unknown cell. mu has to be held.
+func (s *Server) cellPath(cell string, elements ...string) (string, error) {
+	if cell != globalCell && !s.cells[cell] {
+		return "", topo.ErrNoNode
+	}
+	return "/" + cell + "/" + strings.Join(elements, "/"), nil
+}
+
+// The methods below manipulate the tree, with mu held.
+
+// notify records a change, and returns its version.
+func (s *Server) notify() int64 {
+	s.version++
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return s.version
+}
+
+// get returns the node at path, or topo.ErrNoNode.
+func (s *Server) get(path string) (*node, error) {
+	n, ok := s.nodes[path]
+	if !ok {
+		return nil, topo.ErrNoNode
+	}
+	return n, nil
+}
+
+// create creates the node at path, or returns topo.ErrNodeExists.
+func (s *Server) create(path, contents string) (int64, error) {
+	if _, ok := s.nodes[path]; ok {
+		return 0, topo.ErrNodeExists
+	}
+	return s.set(path, contents), nil
+}
+
+// set creates or replaces the node at path.
+func (s *Server) set(path, contents string) int64 {
+	version := s.notify()
+	s.nodes[path] = &node{contents: contents, version: version}
+	return version
+}
+
+// update replaces the existing node at path, if its version is
+// version (or if version is -1). Returns topo.ErrNoNode or
+// topo.ErrBadVersion.
+func (s *Server) update(path, contents string, version int64) (int64, error) {
+	n, err := s.get(path)
+	if err != nil {
+		return 0, err
+	}
+	if version >= 0 && n.version != version {
+		return 0, topo.ErrBadVersion
+	}
+	return s.set(path, contents), nil
+}
+
+// remove deletes the node at path, or returns topo.ErrNoNode.
+func (s *Server) remove(path string) error {
+	if _, ok := s.nodes[path]; !ok {
+		return topo.ErrNoNode
+	}
+	delete(s.nodes, path)
+	s.notify()
+	return nil
+}
+
+// removeTree deletes the node at path and all the nodes under it.
+// Returns topo.ErrNoNode if there was none.
+func (s *Server) removeTree(path string) error {
+	found := false
+	for p := range s.nodes {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(s.nodes, p)
+			found = true
+		}
+	}
+	if !found {
+		return topo.ErrNoNode
+	}
+	s.notify()
+	return nil
+}
+
+// children returns the sorted names of the children of path, that
+// are either nodes or have nodes under them.
+func (s *Server) children(path string) []string {
+	prefix := path + "/"
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for p := range s.nodes {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name := p[len(prefix):]
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+		}
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
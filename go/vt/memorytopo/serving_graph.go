@@ -0,0 +1,200 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph management code of memorytopo.Server
+
+The SrvKeyspace of a keyspace is at /<cell>/ns/<keyspace>, the SrvShard
+of its shards right under it, and the EndPoints of the tablet types
+under the shards.
+*/
+
+func (s *Server) GetSrvTabletTypesPerShard(cell, keyspace, shard string) ([]topo.TabletType, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	var children []string
+	if err == nil {
+		children = s.children(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, topo.ErrNoNode
+	}
+
+	result := make([]topo.TabletType, len(children))
+	for i, tt := range children {
+		result[i] = topo.TabletType(tt)
+	}
+	return result, nil
+}
+
+func (s *Server) UpdateEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, addrs *topo.EndPoints) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard, string(tabletType))
+	if err != nil {
+		return err
+	}
+	s.set(p, jscfg.ToJson(addrs))
+	return nil
+}
+
+func (s *Server) GetEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard, string(tabletType))
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &topo.EndPoints{}
+	if err := json.Unmarshal([]byte(n.contents), result); err != nil {
+		return nil, fmt.Errorf("EndPoints unmarshal failed: %v %v", n.contents, err)
+	}
+	return result, nil
+}
+
+func (s *Server) DeleteEndPoints(cell, keyspace, shard string, tabletType topo.TabletType) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard, string(tabletType))
+	if err != nil {
+		return err
+	}
+	return s.remove(p)
+}
+
+func (s *Server) UpdateSrvShard(cell, keyspace, shard string, srvShard *topo.SrvShard) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	if err != nil {
+		return err
+	}
+	s.set(p, jscfg.ToJson(srvShard))
+	return nil
+}
+
+func (s *Server) GetSrvShard(cell, keyspace, shard string) (*topo.SrvShard, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	srvShard := topo.NewSrvShard(n.version)
+	if err := json.Unmarshal([]byte(n.contents), srvShard); err != nil {
+		return nil, fmt.Errorf("SrvShard unmarshal failed: %v %v", n.contents, err)
+	}
+	return srvShard, nil
+}
+
+func (s *Server) DeleteSrvShard(cell, keyspace, shard string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard)
+	if err != nil {
+		return err
+	}
+	return s.remove(p)
+}
+
+func (s *Server) UpdateSrvKeyspace(cell, keyspace string, srvKeyspace *topo.SrvKeyspace) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace)
+	if err != nil {
+		return err
+	}
+	s.set(p, jscfg.ToJson(srvKeyspace))
+	return nil
+}
+
+func (s *Server) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace)
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	srvKeyspace := topo.NewSrvKeyspace(n.version)
+	if err := json.Unmarshal([]byte(n.contents), srvKeyspace); err != nil {
+		return nil, fmt.Errorf("SrvKeyspace unmarshal failed: %v %v", n.contents, err)
+	}
+	return srvKeyspace, nil
+}
+
+func (s *Server) GetSrvKeyspaceNames(cell string) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns")
+	if err != nil {
+		return nil, err
+	}
+	return s.children(p), nil
+}
+
+func (s *Server) UpdateTabletEndpoint(cell, keyspace, shard string, tabletType topo.TabletType, addr *topo.EndPoint) error {
+	s.lock()
+	defer s.mu.Unlock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard, string(tabletType))
+	if err != nil {
+		return err
+	}
+	n, err := s.get(p)
+	if err != nil {
+		// We haven't been placed in the serving graph yet, so
+		// don't update. Assume the next process that rebuilds
+		// the graph will get the updated tablet location.
+		return nil
+	}
+
+	addrs := topo.NewEndPoints()
+	if err := json.Unmarshal([]byte(n.contents), addrs); err != nil {
+		return fmt.Errorf("EndPoints unmarshal failed: %v %v", n.contents, err)
+	}
+	foundTablet := false
+	for i, entry := range addrs.Entries {
+		if entry.Uid == addr.Uid {
+			foundTablet = true
+			if topo.EndPointEquality(&entry, addr) {
+				return nil
+			}
+			addrs.Entries[i] = *addr
+			break
+		}
+	}
+	if !foundTablet {
+		addrs.Entries = append(addrs.Entries, *addr)
+	}
+	s.set(p, jscfg.ToJson(addrs))
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the shard management code for memorytopo.Server
+*/
+
+func shardPath(keyspace, shard string) string {
+	return shardsPath(keyspace) + "/" + shard
+}
+
+func (s *Server) CreateShard(keyspace, shard string, value *topo.Shard) error {
+	s.lock()
+	_, err := s.create(shardPath(keyspace, shard), jscfg.ToJson(value))
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, value),
+		Status:    "created",
+	})
+	return nil
+}
+
+func (s *Server) UpdateShard(si *topo.ShardInfo) error {
+	s.lock()
+	_, err := s.update(shardPath(si.Keyspace(), si.ShardName()), jscfg.ToJson(si.Shard), -1)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *si,
+		Status:    "updated",
+	})
+	return nil
+}
+
+func (s *Server) ValidateShard(keyspace, shard string) error {
+	_, err := s.GetShard(keyspace, shard)
+	return err
+}
+
+func (s *Server) GetShard(keyspace, shard string) (*topo.ShardInfo, error) {
+	s.lock()
+	n, err := s.get(shardPath(keyspace, shard))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	value := &topo.Shard{}
+	if err := json.Unmarshal([]byte(n.contents), value); err != nil {
+		return nil, fmt.Errorf("bad shard data %v", err)
+	}
+	return topo.NewShardInfo(keyspace, shard, value), nil
+}
+
+func (s *Server) GetShardCritical(keyspace, shard string) (*topo.ShardInfo, error) {
+	return s.GetShard(keyspace, shard)
+}
+
+func (s *Server) GetShardNames(keyspace string) ([]string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	if _, err := s.get(keyspacePath(keyspace)); err != nil {
+		return nil, err
+	}
+	return s.children(shardsPath(keyspace)), nil
+}
+
+func (s *Server) DeleteShard(keyspace, shard string) error {
+	s.lock()
+	err := s.removeTree(shardPath(keyspace, shard))
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.ShardChange{
+		ShardInfo: *topo.NewShardInfo(keyspace, shard, nil),
+		Status:    "deleted",
+	})
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/youtube/vitess/go/event"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topo/events"
+)
+
+/*
+This file contains the tablet management parts of memorytopo.Server
+*/
+
+// tabletPath returns the path of the tablet. mu has to be held.
+func (s *Server) tabletPath(alias topo.TabletAlias, elements ...string) (string, error) {
+	return s.cellPath(alias.Cell, append([]string{"tablets", alias.TabletUidStr()}, elements...)...)
+}
+
+func (s *Server) CreateTablet(tablet *topo.Tablet) error {
+	s.lock()
+	p, err := s.tabletPath(tablet.Alias)
+	if err == nil {
+		_, err = s.create(p, tablet.Json())
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet,
+		Status: "created",
+	})
+	return nil
+}
+
+func (s *Server) UpdateTablet(tablet *topo.TabletInfo, existingVersion int64) (int64, error) {
+	s.lock()
+	p, err := s.tabletPath(tablet.Alias)
+	var version int64
+	if err == nil {
+		version, err = s.update(p, tablet.Json(), existingVersion)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	event.Dispatch(&events.TabletChange{
+		Tablet: *tablet.Tablet,
+		Status: "updated",
+	})
+	return version, nil
+}
+
+func (s *Server) UpdateTabletFields(tabletAlias topo.TabletAlias, update func(*topo.Tablet) error) error {
+	for {
+		ti, err := s.GetTablet(tabletAlias)
+		if err != nil {
+			return err
+		}
+		if err := update(ti.Tablet); err != nil {
+			return err
+		}
+		_, err = s.UpdateTablet(ti, ti.Version())
+		if err == topo.ErrBadVersion {
+			// someone else updated it, try again
+			continue
+		}
+		return err
+	}
+}
+
+func (s *Server) DeleteTablet(alias topo.TabletAlias) error {
+	// We need to find out the keyspace and shard names because those are required
+	// in the TabletChange event.
+	ti, tiErr := s.GetTablet(alias)
+
+	s.lock()
+	p, err := s.tabletPath(alias)
+	if err == nil {
+		err = s.removeTree(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Only try to log if we have the required information.
+	if tiErr == nil {
+		// We only want to copy the identity info for the tablet (alias, etc.).
+		// The rest has just been deleted, so it should be blank.
+		event.Dispatch(&events.TabletChange{
+			Tablet: topo.Tablet{
+				Alias:    ti.Tablet.Alias,
+				Keyspace: ti.Tablet.Keyspace,
+				Shard:    ti.Tablet.Shard,
+			},
+			Status: "deleted",
+		})
+	}
+	return nil
+}
+
+func (s *Server) ValidateTablet(alias topo.TabletAlias) error {
+	_, err := s.GetTablet(alias)
+	return err
+}
+
+func (s *Server) GetTablet(alias topo.TabletAlias) (*topo.TabletInfo, error) {
+	s.lock()
+	p, err := s.tabletPath(alias)
+	var n *node
+	if err == nil {
+		n, err = s.get(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tablet := &topo.Tablet{}
+	if err := json.Unmarshal([]byte(n.contents), tablet); err != nil {
+		return nil, fmt.Errorf("bad tablet data %v", err)
+	}
+	return topo.NewTabletInfo(tablet, n.version), nil
+}
+
+func (s *Server) GetTabletsByCell(cell string) ([]topo.TabletAlias, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "tablets")
+	var children []string
+	if err == nil {
+		children = s.children(p)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, topo.ErrNoNode
+	}
+
+	result := make([]topo.TabletAlias, len(children))
+	for i, child := range children {
+		result[i].Cell = cell
+		result[i].Uid, err = topo.ParseUid(child)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
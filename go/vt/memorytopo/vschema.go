@@ -0,0 +1,30 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+/*
+This file contains the VSchema management code for memorytopo.Server
+*/
+
+func vschemaPath(keyspace string) string {
+	return keyspacePath(keyspace) + "/vschema"
+}
+
+func (s *Server) SaveVSchema(keyspace, vschema string) error {
+	s.lock()
+	defer s.mu.Unlock()
+	s.set(vschemaPath(keyspace), vschema)
+	return nil
+}
+
+func (s *Server) GetVSchema(keyspace string) (string, error) {
+	s.lock()
+	defer s.mu.Unlock()
+	n, err := s.get(vschemaPath(keyspace))
+	if err != nil {
+		return "", err
+	}
+	return n.contents, nil
+}
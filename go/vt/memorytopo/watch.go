@@ -0,0 +1,108 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memorytopo
+
+import (
+	"encoding/json"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+/*
+This file contains the serving graph watches of memorytopo.Server
+*/
+
+// watch calls send with the node at path, or nil if it doesn't
+// exist, then again every time it changes, until stop is closed or
+// send returns false.
+func (s *Server) watch(path string, stop chan struct{}, send func(n *node) bool) {
+	var lastVersion int64 = -1
+	for {
+		s.lock()
+		n := s.nodes[path]
+		changed := s.changed
+		s.mu.Unlock()
+
+		var version int64
+		if n != nil {
+			version = n.version
+		}
+		if version != lastVersion {
+			if !send(n) {
+				return
+			}
+			lastVersion = version
+		}
+
+		select {
+		case <-changed:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Server) WatchSrvKeyspace(cell, keyspace string, stop chan struct{}) (<-chan *topo.SrvKeyspace, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.SrvKeyspace, 1)
+	go func() {
+		defer close(result)
+		s.watch(p, stop, func(n *node) bool {
+			var value *topo.SrvKeyspace
+			if n != nil {
+				value = topo.NewSrvKeyspace(n.version)
+				if err := json.Unmarshal([]byte(n.contents), value); err != nil {
+					log.Warningf("SrvKeyspace unmarshal failed, stopping the watch of %v: %v %v", p, n.contents, err)
+					return false
+				}
+			}
+			select {
+			case result <- value:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+	return result, nil
+}
+
+func (s *Server) WatchEndPoints(cell, keyspace, shard string, tabletType topo.TabletType, stop chan struct{}) (<-chan *topo.EndPoints, error) {
+	s.lock()
+	p, err := s.cellPath(cell, "ns", keyspace, shard, string(tabletType))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *topo.EndPoints, 1)
+	go func() {
+		defer close(result)
+		s.watch(p, stop, func(n *node) bool {
+			var value *topo.EndPoints
+			if n != nil {
+				value = &topo.EndPoints{}
+				if err := json.Unmarshal([]byte(n.contents), value); err != nil {
+					log.Warningf("EndPoints unmarshal failed, stopping the watch of %v: %v %v", p, n.contents, err)
+					return false
+				}
+			}
+			select {
+			case result <- value:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+	return result, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/hook"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// These methods deal with backing up a mysqld to a BackupStorage, and
+// restoring a mysqld from the latest backup in a BackupStorage.
+
+const (
+	// backupManifest is the name of the json file describing a
+	// backup. It is written last, so only complete backups have one.
+	backupManifest = "MANIFEST"
+)
+
+var (
+	// ErrNoBackup is returned by Restore when there is no complete
+	// backup to restore from.
+	ErrNoBackup = errors.New("no backup found")
+
+	backupEngineImplementation = flag.String("backup_engine_implementation", builtin, "which implementation to use for the backup method: builtin or xtrabackup")
+)
+
+// BackupManifest represents the backup. It lists all the files, and
+// the replication position at the time of the backup.
+type BackupManifest struct {
+	// BackupMethod is the name of the engine that took the backup.
+	// An empty value is the builtin engine.
+	BackupMethod string
+
+	// FileEntries contains all the files in the backup. File
+	// FileEntries[i] is stored as file "i" in the backup.
+	// Only used by the builtin engine.
+	FileEntries []FileEntry
+
+	// ReplicationPosition is the position of the backup, to start
+	// replication from after a restore. The xtrabackup engine only
+	// finds it during the restore.
+	ReplicationPosition proto.ReplicationPosition
+
+	// Time is when the backup completed. The data of the backup
+	// predates it.
+	Time time.Time
+}
+
+// Backup is the main entry point for a backup:
+// - uses the BackupStorage service to store a new backup
+// - uses the BackupEngine picked by backup_engine_implementation to
+//   copy the files of mysqld
+// - only writes the manifest once the backup is complete
+// The name should sort the backups of a bucket by date, oldest first.
+func (mysqld *Mysqld) Backup(bucket, name string, backupConcurrency int, hookExtraEnv map[string]string) error {
+	be, err := getBackupEngine(*backupEngineImplementation)
+	if err != nil {
+		return err
+	}
+
+	// start the backup with the BackupStorage
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	bh, err := bs.StartBackup(bucket, name)
+	if err != nil {
+		return fmt.Errorf("StartBackup failed: %v", err)
+	}
+
+	bm, err := be.ExecuteBackup(mysqld, bh, backupConcurrency, hookExtraEnv)
+	if err == nil {
+		bm.Time = time.Now()
+		err = writeBackupManifest(bh, bm)
+	}
+	if err != nil {
+		if abortErr := bh.AbortBackup(); abortErr != nil {
+			log.Errorf("failed to abort backup: %v", abortErr)
+		}
+		return err
+	}
+	return bh.EndBackup()
+}
+
+// writeBackupManifest writes bm as the MANIFEST of the backup. It is
+// also used for the manifests of the binlog backups.
+func writeBackupManifest(bh backupstorage.BackupHandle, bm interface{}) error {
+	wc, err := bh.AddFile(backupManifest)
+	if err != nil {
+		return fmt.Errorf("cannot add %v to backup: %v", backupManifest, err)
+	}
+	defer wc.Close()
+
+	data, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot JSON encode %v: %v", backupManifest, err)
+	}
+	if _, err := wc.Write(data); err != nil {
+		return fmt.Errorf("cannot write %v: %v", backupManifest, err)
+	}
+	return wc.Close()
+}
+
+func readBackupManifest(bh backupstorage.BackupHandle) (*BackupManifest, error) {
+	rc, err := bh.ReadFile(backupManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	bm := new(BackupManifest)
+	if err := json.NewDecoder(rc).Decode(bm); err != nil {
+		return nil, fmt.Errorf("cannot decode %v: %v", backupManifest, err)
+	}
+	return bm, nil
+}
+
+// Restore is the main entry point for backup restore. It finds the
+// latest complete backup of the bucket in the BackupStorage, replaces
+// the files of mysqld with it, and restarts mysqld. It returns the
+// replication position of the backup, or ErrNoBackup if there is no
+// backup to restore.
+func (mysqld *Mysqld) Restore(bucket string, restoreConcurrency int, hookExtraEnv map[string]string) (*proto.ReplicationPosition, error) {
+	bh, bm, err := findBackup(bucket, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mysqld.restoreBackup(bh, bm, restoreConcurrency, hookExtraEnv, nil)
+}
+
+// findBackup returns the most recent complete backup of the bucket
+// that is accepted by the filter, if any.
+func findBackup(bucket string, filter func(bh backupstorage.BackupHandle, bm *BackupManifest) bool) (backupstorage.BackupHandle, *BackupManifest, error) {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return nil, nil, err
+	}
+	bhs, err := bs.ListBackups(bucket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+	for i := len(bhs) - 1; i >= 0; i-- {
+		bm, err := readBackupManifest(bhs[i])
+		if err != nil {
+			log.Warningf("Possibly incomplete backup %v in bucket %v on BackupStorage: %v", bhs[i].Name(), bucket, err)
+			continue
+		}
+		if filter != nil && !filter(bhs[i], bm) {
+			continue
+		}
+		return bhs[i], bm, nil
+	}
+	return nil, nil, ErrNoBackup
+}
+
+// restoreBackup replaces the files of mysqld with the backup, and
+// restarts mysqld. If checkPosition is set, it validates the position
+// of the backup before the files are replaced. When it fails, mysqld
+// is restarted on its untouched files.
+func (mysqld *Mysqld) restoreBackup(bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, hookExtraEnv map[string]string, checkPosition func(*proto.ReplicationPosition) error) (*proto.ReplicationPosition, error) {
+	log.Infof("Restore: restoring backup %v of bucket %v", bh.Name(), bh.Bucket())
+	be, err := getBackupEngine(bm.BackupMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mysqld.ValidateCloneTarget(hookExtraEnv); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Restore: shutdown mysqld")
+	if err := mysqld.Shutdown(true, MysqlWaitTime); err != nil {
+		return nil, err
+	}
+
+	var checkErr error
+	check := checkPosition
+	if check != nil {
+		check = func(rp *proto.ReplicationPosition) error {
+			checkErr = checkPosition(rp)
+			return checkErr
+		}
+	}
+	rp, err := be.ExecuteRestore(mysqld, bh, bm, restoreConcurrency, check)
+	if err != nil {
+		if checkErr != nil {
+			log.Infof("Restore: backup rejected, restart mysqld")
+			if startErr := mysqld.Start(MysqlWaitTime); startErr != nil {
+				log.Errorf("Restore: cannot restart mysqld: %v", startErr)
+			}
+		}
+		return nil, err
+	}
+
+	log.Infof("Restore: restart mysqld")
+	if err := mysqld.Start(MysqlWaitTime); err != nil {
+		return nil, err
+	}
+
+	h := hook.NewSimpleHook("postflight_restore")
+	h.ExtraEnv = hookExtraEnv
+	if err := h.ExecuteOptional(); err != nil {
+		return nil, err
+	}
+
+	return rp, nil
+}
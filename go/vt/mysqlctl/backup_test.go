@@ -0,0 +1,156 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/filebackupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// createBackupFiles creates the files of a fake mysqld under root,
+// and returns the matching Mycnf.
+func createBackupFiles(t *testing.T, root string) *Mycnf {
+	cnf := &Mycnf{
+		DataDir:               path.Join(root, "data"),
+		InnodbDataHomeDir:     path.Join(root, "innodb", "data"),
+		InnodbLogGroupHomeDir: path.Join(root, "innodb", "logs"),
+	}
+	for _, dir := range []string{
+		cnf.InnodbDataHomeDir,
+		cnf.InnodbLogGroupHomeDir,
+		path.Join(cnf.DataDir, "vt_db"),
+		path.Join(cnf.DataDir, "vt_frm"),
+		path.Join(cnf.DataDir, "lost+found"),
+	} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatalf("failed to create directory %v: %v", dir, err)
+		}
+	}
+	for _, file := range []string{
+		path.Join(cnf.InnodbDataHomeDir, "ibdata1"),
+		path.Join(cnf.InnodbLogGroupHomeDir, "ib_logfile0"),
+		path.Join(cnf.DataDir, "vt_db", "db.opt"),
+		path.Join(cnf.DataDir, "vt_frm", "t1.frm"),
+		path.Join(cnf.DataDir, "vt_frm", "t1.ibd"),
+		path.Join(cnf.DataDir, "lost+found", "junk"),
+		path.Join(cnf.DataDir, "auto.cnf"),
+	} {
+		if err := ioutil.WriteFile(file, []byte("contents of "+path.Base(file)), 0660); err != nil {
+			t.Fatalf("failed to write file %v: %v", file, err)
+		}
+	}
+	return cnf
+}
+
+func TestFindFilesToBackup(t *testing.T) {
+	root, err := ioutil.TempDir("", "backuptest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+	cnf := createBackupFiles(t, root)
+
+	result, err := findFilesToBackup(cnf)
+	if err != nil {
+		t.Fatalf("findFilesToBackup failed: %v", err)
+	}
+	want := []FileEntry{
+		{Base: backupInnodbDataHomeDir, Name: "ibdata1"},
+		{Base: backupInnodbLogGroupHomeDir, Name: "ib_logfile0"},
+		{Base: backupData, Name: "vt_db/db.opt"},
+		{Base: backupData, Name: "vt_frm/t1.frm"},
+		{Base: backupData, Name: "vt_frm/t1.ibd"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("findFilesToBackup() = %#v, want %#v", result, want)
+	}
+}
+
+func TestBackupRestoreFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "backuptest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+	*filebackupstorage.FileBackupStorageRoot = path.Join(root, "backups")
+	fbs := &filebackupstorage.FileBackupStorage{}
+	cnf := createBackupFiles(t, path.Join(root, "source"))
+
+	// backup the files
+	fes, err := findFilesToBackup(cnf)
+	if err != nil {
+		t.Fatalf("findFilesToBackup failed: %v", err)
+	}
+	bh, err := fbs.StartBackup("keyspace/shard", "backup1")
+	if err != nil {
+		t.Fatalf("StartBackup failed: %v", err)
+	}
+	if err := backupFiles(cnf, bh, fes, 2); err != nil {
+		t.Fatalf("backupFiles failed: %v", err)
+	}
+	bm := &BackupManifest{
+		FileEntries: fes,
+		ReplicationPosition: proto.ReplicationPosition{
+			MasterLogFile:     "vt-bin.000001",
+			MasterLogPosition: 1194,
+		},
+	}
+	if err := writeBackupManifest(bh, bm); err != nil {
+		t.Fatalf("writeBackupManifest failed: %v", err)
+	}
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("EndBackup failed: %v", err)
+	}
+
+	// read the manifest back
+	bhs, err := fbs.ListBackups("keyspace/shard")
+	if err != nil || len(bhs) != 1 {
+		t.Fatalf("ListBackups returned wrong results: %v %v", bhs, err)
+	}
+	got, err := readBackupManifest(bhs[0])
+	if err != nil {
+		t.Fatalf("readBackupManifest failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, bm) {
+		t.Errorf("readBackupManifest() = %#v, want %#v", got, bm)
+	}
+
+	// restore the files somewhere else, and compare
+	restored := &Mycnf{
+		DataDir:               path.Join(root, "dest", "data"),
+		InnodbDataHomeDir:     path.Join(root, "dest", "innodb", "data"),
+		InnodbLogGroupHomeDir: path.Join(root, "dest", "innodb", "logs"),
+	}
+	if err := restoreFiles(restored, bhs[0], got.FileEntries, 2); err != nil {
+		t.Fatalf("restoreFiles failed: %v", err)
+	}
+	for _, fe := range fes {
+		source, _ := fe.path(cnf)
+		dest, _ := fe.path(restored)
+		want, err := ioutil.ReadFile(source)
+		if err != nil {
+			t.Fatalf("ReadFile(%v) failed: %v", source, err)
+		}
+		data, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatalf("ReadFile(%v) failed: %v", dest, err)
+		}
+		if string(data) != string(want) {
+			t.Errorf("restored %v = %q, want %q", fe.Name, data, want)
+		}
+	}
+
+	// a bad hash fails the restore
+	got.FileEntries[0].Hash = "00000000"
+	if err := restoreFiles(restored, bhs[0], got.FileEntries[:1], 1); err == nil {
+		t.Errorf("restoreFiles with a bad hash didn't fail")
+	}
+}
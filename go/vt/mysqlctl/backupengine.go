@@ -0,0 +1,51 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+const (
+	// the names of the backup engines, as stored in the manifests
+	builtin    = "builtin"
+	xtrabackup = "xtrabackup"
+)
+
+// BackupEngine is the interface to the backup engines, which copy
+// the files of a mysqld to a backup, and back.
+type BackupEngine interface {
+	// ExecuteBackup copies the files of mysqld to the backup, and
+	// returns the manifest describing them. mysqld must be in the
+	// same replication and read-only state when it returns.
+	ExecuteBackup(mysqld *Mysqld, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (*BackupManifest, error)
+
+	// ExecuteRestore replaces the files of the stopped mysqld with
+	// the ones of the backup, and returns the replication position
+	// to start from. If checkPosition is set, it is called with
+	// that position before any file of mysqld is touched, and its
+	// error aborts the restore.
+	ExecuteRestore(mysqld *Mysqld, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, checkPosition func(*proto.ReplicationPosition) error) (*proto.ReplicationPosition, error)
+}
+
+// backupEngines is the registry of BackupEngine implementations.
+var backupEngines = make(map[string]BackupEngine)
+
+// getBackupEngine returns the BackupEngine with the given name. An
+// empty name is the builtin engine, for the backups that predate
+// BackupManifest.BackupMethod.
+func getBackupEngine(name string) (BackupEngine, error) {
+	if name == "" {
+		name = builtin
+	}
+	be, ok := backupEngines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backup engine %v", name)
+	}
+	return be, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package backupstorage contains the interface of the backup storage
+// used by mysqlctl. The implementations are in the filebackupstorage,
+// s3backupstorage and gcsbackupstorage packages.
+package backupstorage
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	log "github.com/golang/glog"
+)
+
+var backupStorageImplementation = flag.String("backup_storage_implementation", "file", "which implementation to use for the backup storage feature: file, s3 or gcs")
+
+// BackupHandle describes an individual backup.
+type BackupHandle interface {
+	// Bucket is the location of the backup. Will contain keyspace/shard.
+	Bucket() string
+
+	// Name is the individual name of the backup. Will contain
+	// tabletAlias-timestamp.
+	Name() string
+
+	// AddFile opens a new file to be added to the backup.
+	// Only works for read-write backups (created by StartBackup).
+	// filename is guaranteed to only contain alphanumerical
+	// characters and hyphens.
+	// It should be thread safe, it is possible to call AddFile in
+	// multiple go routines once a backup has been started.
+	AddFile(filename string) (io.WriteCloser, error)
+
+	// EndBackup stops and closes a backup. The contents should be kept.
+	// Only works for read-write backups (created by StartBackup).
+	EndBackup() error
+
+	// AbortBackup stops a backup, and removes the contents that
+	// have been copied already. It is called if an error occurs
+	// while the backup is being taken, and the backup cannot be finished.
+	// Only works for read-write backups (created by StartBackup).
+	AbortBackup() error
+
+	// ReadFile starts reading a file from a backup.
+	// Only works for read-only backups (created by ListBackups).
+	ReadFile(filename string) (io.ReadCloser, error)
+}
+
+// BackupStorage is the interface to the storage system
+type BackupStorage interface {
+	// ListBackups returns all the backups in a bucket. The
+	// returned backups are read-only (ReadFile can be called, but
+	// AddFile/EndBackup/AbortBackup cannot), and sorted by Name,
+	// oldest first.
+	ListBackups(bucket string) ([]BackupHandle, error)
+
+	// StartBackup creates a new backup with the given name.
+	// If a backup with the same name already exists, it's an error.
+	// The returned backup is read-write
+	// (AddFile/EndBackup/AbortBackup can all be called, not ReadFile)
+	StartBackup(bucket, name string) (BackupHandle, error)
+
+	// RemoveBackup removes all the data associated with a backup.
+	// It will not appear in ListBackups after RemoveBackup succeeds.
+	RemoveBackup(bucket, name string) error
+}
+
+// backupStorageImpls is the registry of BackupStorage implementations.
+var backupStorageImpls = make(map[string]BackupStorage)
+
+// RegisterBackupStorage adds an implementation for a BackupStorage.
+// If an implementation with that name already exists, panics.
+// Call this in the 'init' function in your module.
+func RegisterBackupStorage(name string, bs BackupStorage) {
+	if backupStorageImpls[name] != nil {
+		panic(fmt.Errorf("Duplicate BackupStorage registration for %v", name))
+	}
+	backupStorageImpls[name] = bs
+}
+
+// GetBackupStorage returns 'our' BackupStorage, going down this list:
+// - If only one is registered, that's the one.
+// - If more than one are registered, use the
+//   'backup_storage_implementation' flag (which defaults to file).
+// - Then returns an error.
+func GetBackupStorage() (BackupStorage, error) {
+	if len(backupStorageImpls) == 1 {
+		for name, bs := range backupStorageImpls {
+			log.V(6).Infof("Using only BackupStorage: %v", name)
+			return bs, nil
+		}
+	}
+
+	bs, ok := backupStorageImpls[*backupStorageImplementation]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of BackupStorage named %v", *backupStorageImplementation)
+	}
+	log.V(6).Infof("Using BackupStorage: %v", *backupStorageImplementation)
+	return bs, nil
+}
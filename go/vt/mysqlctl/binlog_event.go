@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
+	"strings"
 
 	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
 )
@@ -126,6 +128,9 @@ func (ev binlogEvent) IsRand() bool {
 //   50        server version string, 0-padded but not necessarily 0-terminated
 //   4         timestamp (same as timestamp header field)
 //   1         header length
+//   p         (one per event type) event type header lengths
+//   1         (MySQL 5.6.1+, MariaDB 5.3+) checksum algorithm
+//   4         (MySQL 5.6.1+, MariaDB 5.3+) checksum
 func (ev binlogEvent) Format() (f blproto.BinlogFormat, err error) {
 	// FORMAT_DESCRIPTION_EVENT has a fixed header size of 19 because we have to
 	// read it before we know the header_length.
@@ -140,9 +145,59 @@ func (ev binlogEvent) Format() (f blproto.BinlogFormat, err error) {
 	if f.HeaderLength < 19 {
 		return f, fmt.Errorf("header length = %d, should be >= 19", f.HeaderLength)
 	}
+
+	// The servers that can write checksums always append the checksum algorithm
+	// and a checksum to FORMAT_DESCRIPTION_EVENT, even if binlog_checksum=NONE.
+	if serverSupportsChecksums(f.ServerVersion) {
+		if len(data) < 2+50+4+1+1+4 {
+			return f, fmt.Errorf("FORMAT_DESCRIPTION_EVENT is too short for checksum algorithm: %d bytes", len(data))
+		}
+		f.ChecksumAlgorithm = data[len(data)-1-4]
+	}
 	return f, nil
 }
 
+// serverSupportsChecksums returns true if the server version is at least
+// the first version that can write binlog checksums: MySQL 5.6.1, or
+// MariaDB 5.3.
+func serverSupportsChecksums(version string) bool {
+	min := [3]int{5, 6, 1}
+	if strings.Contains(version, "MariaDB") {
+		min = [3]int{5, 3, 0}
+	}
+	var v [3]int
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &v[0], &v[1], &v[2]); err != nil {
+		return false
+	}
+	for i := range v {
+		if v[i] != min[i] {
+			return v[i] > min[i]
+		}
+	}
+	return true
+}
+
+// stripChecksum partially implements BinlogEvent.StripChecksum(). It returns
+// the event without its checksum, which the flavors wrap in their own type.
+// The event_length field of the header still includes the checksum.
+func (ev binlogEvent) stripChecksum(f blproto.BinlogFormat) (binlogEvent, []byte, error) {
+	switch f.ChecksumAlgorithm {
+	case blproto.BinlogChecksumAlgOff, blproto.BinlogChecksumAlgUndef:
+		return ev, nil, nil
+	case blproto.BinlogChecksumAlgCRC32:
+		buf := ev.Bytes()
+		if len(buf) < 19+4 {
+			return ev, nil, fmt.Errorf("event is too short for CRC32 checksum: %d bytes", len(buf))
+		}
+		data, checksum := buf[:len(buf)-4], buf[len(buf)-4:]
+		if got, want := crc32.ChecksumIEEE(data), binary.LittleEndian.Uint32(checksum); got != want {
+			return ev, nil, fmt.Errorf("CRC32 checksum mismatch: computed %#x, event has %#x", got, want)
+		}
+		return binlogEvent(data), checksum, nil
+	}
+	return ev, nil, fmt.Errorf("unsupported checksum algorithm: %d", f.ChecksumAlgorithm)
+}
+
 // Query implements BinlogEvent.Query().
 //
 // Expected format (L = total length of event data):
@@ -155,7 +210,7 @@ func (ev binlogEvent) Format() (f blproto.BinlogFormat, err error) {
 //   Y         status vars block
 //   X+1       db_name + NULL terminator
 //   L-X-1-Y   SQL statement (no NULL terminator)
-func (ev binlogEvent) Query(f blproto.BinlogFormat) (string, []byte, error) {
+func (ev binlogEvent) Query(f blproto.BinlogFormat) (query blproto.Query, err error) {
 	data := ev.Bytes()[f.HeaderLength:]
 
 	// length of database name
@@ -168,9 +223,61 @@ func (ev binlogEvent) Query(f blproto.BinlogFormat) (string, []byte, error) {
 	// position of SQL query
 	sqlPos := dbPos + dbNameLen + 1 // +1 for NULL terminator
 	if sqlPos > len(data) {
-		return "", nil, fmt.Errorf("SQL query position = %v, which is outside buffer", sqlPos)
+		return query, fmt.Errorf("SQL query position = %v, which is outside buffer", sqlPos)
+	}
+	query.Charset = queryCharset(data[4+4+1+2+2 : dbPos])
+	query.Database = string(data[dbPos : dbPos+dbNameLen])
+	query.SQL = data[sqlPos:]
+	return query, nil
+}
+
+// queryStatusVarLengths are the lengths of the values of the QUERY_EVENT
+// status variables that precede Q_CHARSET_CODE, or -1 for the ones that
+// start with a length byte.
+//   http://dev.mysql.com/doc/internals/en/query-event.html
+var queryStatusVarLengths = map[byte]int{
+	0: 4,  // Q_FLAGS2_CODE
+	1: 8,  // Q_SQL_MODE_CODE
+	2: -1, // Q_CATALOG_CODE, followed by a NULL terminator
+	3: 4,  // Q_AUTO_INCREMENT
+	6: -1, // Q_CATALOG_NZ_CODE
+}
+
+// queryCharset returns the character set of the Q_CHARSET_CODE status
+// variable, or nil if there's none. The status variables have no common
+// format, so it gives up on the ones it doesn't know how to skip.
+func queryCharset(vars []byte) *blproto.Charset {
+	const Q_CHARSET_CODE = 4
+
+	for pos := 0; pos < len(vars); {
+		code := vars[pos]
+		pos++
+		if code == Q_CHARSET_CODE {
+			if pos+6 > len(vars) {
+				return nil
+			}
+			return &blproto.Charset{
+				Client: int(binary.LittleEndian.Uint16(vars[pos : pos+2])),
+				Conn:   int(binary.LittleEndian.Uint16(vars[pos+2 : pos+4])),
+				Server: int(binary.LittleEndian.Uint16(vars[pos+4 : pos+6])),
+			}
+		}
+		length, ok := queryStatusVarLengths[code]
+		if !ok {
+			return nil
+		}
+		if length == -1 {
+			if pos >= len(vars) {
+				return nil
+			}
+			length = 1 + int(vars[pos])
+			if code == 2 {
+				length++
+			}
+		}
+		pos += length
 	}
-	return string(data[dbPos : dbPos+dbNameLen]), data[sqlPos:], nil
+	return nil
 }
 
 // IntVar implements BinlogEvent.IntVar().
@@ -0,0 +1,597 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+// Binlog event type codes used by row based replication.
+const (
+	eventTableMap      = 19
+	eventWriteRowsV1   = 23
+	eventUpdateRowsV1  = 24
+	eventDeleteRowsV1  = 25
+	eventWriteRowsV2   = 30
+	eventUpdateRowsV2  = 31
+	eventDeleteRowsV2  = 32
+	typeTimestamp2     = 17
+	typeDatetime2      = 18
+	typeTime2          = 19
+	typeJSON           = 245
+	tableIDLength      = 6
+	rowsFlagsLength    = 2
+	rowsV2ExtraDataLen = 2
+)
+
+// IsTableMap implements BinlogEvent.IsTableMap().
+func (ev binlogEvent) IsTableMap() bool {
+	return ev.Type() == eventTableMap
+}
+
+// IsWriteRows implements BinlogEvent.IsWriteRows().
+func (ev binlogEvent) IsWriteRows() bool {
+	return ev.Type() == eventWriteRowsV1 || ev.Type() == eventWriteRowsV2
+}
+
+// IsUpdateRows implements BinlogEvent.IsUpdateRows().
+func (ev binlogEvent) IsUpdateRows() bool {
+	return ev.Type() == eventUpdateRowsV1 || ev.Type() == eventUpdateRowsV2
+}
+
+// IsDeleteRows implements BinlogEvent.IsDeleteRows().
+func (ev binlogEvent) IsDeleteRows() bool {
+	return ev.Type() == eventDeleteRowsV1 || ev.Type() == eventDeleteRowsV2
+}
+
+// TableID implements BinlogEvent.TableID().
+//
+// The table ID is the first field of the post-header for both
+// TABLE_MAP_EVENT and rows events. It is 6 bytes long for all
+// the server versions we support.
+func (ev binlogEvent) TableID(f blproto.BinlogFormat) uint64 {
+	data := ev.Bytes()[f.HeaderLength:]
+	var buf [8]byte
+	copy(buf[:], data[:tableIDLength])
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// TableMap implements BinlogEvent.TableMap().
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   6         table ID
+//   2         flags
+//   1         length of db name (X)
+//   X+1       db name + NULL terminator
+//   1         length of table name (Y)
+//   Y+1       table name + NULL terminator
+//   varint    number of columns (N)
+//   N         column types
+//   varint    length of metadata block
+//   ...       metadata block, variable length per column type
+//   (N+7)/8   nullable columns bitmap
+func (ev binlogEvent) TableMap(f blproto.BinlogFormat) (*blproto.TableMap, error) {
+	data := ev.Bytes()[f.HeaderLength:]
+	pos := tableIDLength + rowsFlagsLength
+
+	dbName, pos, err := readLengthPrefixedName(data, pos)
+	if err != nil {
+		return nil, fmt.Errorf("can't read db name: %v", err)
+	}
+	tableName, pos, err := readLengthPrefixedName(data, pos)
+	if err != nil {
+		return nil, fmt.Errorf("can't read table name: %v", err)
+	}
+
+	columnCount, pos, err := readPackedInt(data, pos)
+	if err != nil {
+		return nil, fmt.Errorf("can't read column count: %v", err)
+	}
+	if pos+int(columnCount) > len(data) {
+		return nil, fmt.Errorf("column types are outside buffer")
+	}
+	tm := &blproto.TableMap{
+		Database: dbName,
+		Name:     tableName,
+		Types:    data[pos : pos+int(columnCount)],
+		Metadata: make([]uint16, columnCount),
+	}
+	pos += int(columnCount)
+
+	metadataLen, pos, err := readPackedInt(data, pos)
+	if err != nil {
+		return nil, fmt.Errorf("can't read metadata length: %v", err)
+	}
+	end := pos + int(metadataLen)
+	if end > len(data) {
+		return nil, fmt.Errorf("metadata block is outside buffer")
+	}
+	for i, typ := range tm.Types {
+		switch typ {
+		case mproto.VT_FLOAT, mproto.VT_DOUBLE, mproto.VT_BLOB, mproto.VT_GEOMETRY,
+			typeJSON, typeTimestamp2, typeDatetime2, typeTime2:
+			// One byte of metadata.
+			if pos+1 > end {
+				return nil, fmt.Errorf("metadata for column %d is outside buffer", i)
+			}
+			tm.Metadata[i] = uint16(data[pos])
+			pos++
+		case mproto.VT_VARCHAR, mproto.VT_VAR_STRING, mproto.VT_BIT:
+			// Two bytes, little endian.
+			if pos+2 > end {
+				return nil, fmt.Errorf("metadata for column %d is outside buffer", i)
+			}
+			tm.Metadata[i] = binary.LittleEndian.Uint16(data[pos : pos+2])
+			pos += 2
+		case mproto.VT_NEWDECIMAL, mproto.VT_STRING, mproto.VT_ENUM, mproto.VT_SET:
+			// Two bytes, big endian: (precision, scale) or (real type, length).
+			if pos+2 > end {
+				return nil, fmt.Errorf("metadata for column %d is outside buffer", i)
+			}
+			tm.Metadata[i] = binary.BigEndian.Uint16(data[pos : pos+2])
+			pos += 2
+		}
+	}
+	return tm, nil
+}
+
+// Rows implements BinlogEvent.Rows().
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   6         table ID
+//   2         flags
+//   2         length of extra data, including itself (v2 only) (X)
+//   X-2       extra data (v2 only)
+//   varint    number of columns (N)
+//   (N+7)/8   columns present in the before image (identify) or after
+//             image (data) for WRITE and DELETE
+//   (N+7)/8   columns present in the after image (UPDATE only)
+//   ...       row images, until the end of the event. For UPDATE, each
+//             row has a before image followed by an after image. Each
+//             image has a bitmap of NULL columns, followed by the values
+//             of the present non-NULL columns.
+func (ev binlogEvent) Rows(f blproto.BinlogFormat, tm *blproto.TableMap) (blproto.Rows, error) {
+	var result blproto.Rows
+	data := ev.Bytes()[f.HeaderLength:]
+	pos := tableIDLength + rowsFlagsLength
+	switch ev.Type() {
+	case eventWriteRowsV2, eventUpdateRowsV2, eventDeleteRowsV2:
+		if pos+rowsV2ExtraDataLen > len(data) {
+			return result, fmt.Errorf("extra data length is outside buffer")
+		}
+		pos += int(binary.LittleEndian.Uint16(data[pos : pos+rowsV2ExtraDataLen]))
+	}
+
+	columnCount, pos, err := readPackedInt(data, pos)
+	if err != nil {
+		return result, fmt.Errorf("can't read column count: %v", err)
+	}
+	if int(columnCount) != len(tm.Types) {
+		return result, fmt.Errorf("rows event has %d columns, but table map for %s.%s has %d", columnCount, tm.Database, tm.Name, len(tm.Types))
+	}
+
+	hasIdentify := ev.IsUpdateRows() || ev.IsDeleteRows()
+	hasData := ev.IsWriteRows() || ev.IsUpdateRows()
+	if hasIdentify {
+		if result.IdentifyColumns, pos, err = readBitmap(data, pos, int(columnCount)); err != nil {
+			return result, err
+		}
+	}
+	if hasData {
+		if result.DataColumns, pos, err = readBitmap(data, pos, int(columnCount)); err != nil {
+			return result, err
+		}
+	}
+
+	for pos < len(data) {
+		var row blproto.Row
+		if hasIdentify {
+			if row.Identify, pos, err = readRowImage(data, pos, tm, result.IdentifyColumns); err != nil {
+				return result, fmt.Errorf("can't read before image of row %d: %v", len(result.Rows), err)
+			}
+		}
+		if hasData {
+			if row.Data, pos, err = readRowImage(data, pos, tm, result.DataColumns); err != nil {
+				return result, fmt.Errorf("can't read after image of row %d: %v", len(result.Rows), err)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// readLengthPrefixedName reads a 1-byte length, followed by a string of that
+// length and a NULL terminator.
+func readLengthPrefixedName(data []byte, pos int) (string, int, error) {
+	if pos >= len(data) {
+		return "", pos, fmt.Errorf("length is outside buffer")
+	}
+	length := int(data[pos])
+	pos++
+	if pos+length+1 > len(data) {
+		return "", pos, fmt.Errorf("name is outside buffer")
+	}
+	return string(data[pos : pos+length]), pos + length + 1, nil
+}
+
+// readPackedInt reads a length-encoded integer.
+// http://dev.mysql.com/doc/internals/en/integer.html#length-encoded-integer
+func readPackedInt(data []byte, pos int) (uint64, int, error) {
+	if pos >= len(data) {
+		return 0, pos, fmt.Errorf("packed int is outside buffer")
+	}
+	var size int
+	switch first := data[pos]; {
+	case first < 0xfb:
+		return uint64(first), pos + 1, nil
+	case first == 0xfc:
+		size = 2
+	case first == 0xfd:
+		size = 3
+	case first == 0xfe:
+		size = 8
+	default:
+		return 0, pos, fmt.Errorf("invalid packed int prefix: %#x", first)
+	}
+	pos++
+	if pos+size > len(data) {
+		return 0, pos, fmt.Errorf("packed int is outside buffer")
+	}
+	var buf [8]byte
+	copy(buf[:], data[pos:pos+size])
+	return binary.LittleEndian.Uint64(buf[:]), pos + size, nil
+}
+
+// readBitmap reads a bitmap of count bits.
+func readBitmap(data []byte, pos, count int) ([]bool, int, error) {
+	size := (count + 7) / 8
+	if pos+size > len(data) {
+		return nil, pos, fmt.Errorf("bitmap is outside buffer")
+	}
+	bitmap := make([]bool, count)
+	for i := range bitmap {
+		bitmap[i] = data[pos+i/8]&(1<<uint(i%8)) != 0
+	}
+	return bitmap, pos + size, nil
+}
+
+// readRowImage reads one row image. The NULL bitmap only has bits for the
+// present columns. Columns that are absent or NULL are left as NULL values.
+func readRowImage(data []byte, pos int, tm *blproto.TableMap, present []bool) ([]sqltypes.Value, int, error) {
+	presentCount := 0
+	for _, p := range present {
+		if p {
+			presentCount++
+		}
+	}
+	nulls, pos, err := readBitmap(data, pos, presentCount)
+	if err != nil {
+		return nil, pos, err
+	}
+	row := make([]sqltypes.Value, len(tm.Types))
+	n := 0
+	for i, p := range present {
+		if !p {
+			continue
+		}
+		isNull := nulls[n]
+		n++
+		if isNull {
+			continue
+		}
+		var size int
+		row[i], size, err = cellValue(data[pos:], tm.Types[i], tm.Metadata[i])
+		if err != nil {
+			return nil, pos, fmt.Errorf("column %d: %v", i, err)
+		}
+		pos += size
+	}
+	return row, pos, nil
+}
+
+// cellValue decodes one value of the given type from the front of data,
+// and returns it along with the number of bytes it used. Integers are
+// decoded as signed, since the binlog doesn't say whether a column is
+// unsigned. Temporal types are formatted the way MySQL prints them.
+func cellValue(data []byte, typ byte, metadata uint16) (sqltypes.Value, int, error) {
+	need := func(n int) error {
+		if n > len(data) {
+			return fmt.Errorf("value of type %d needs %d bytes, only %d left", typ, n, len(data))
+		}
+		return nil
+	}
+	numeric := func(v int64) sqltypes.Value {
+		return sqltypes.MakeNumeric(strconv.AppendInt(nil, v, 10))
+	}
+	str := func(s string) sqltypes.Value {
+		return sqltypes.MakeString([]byte(s))
+	}
+
+	switch typ {
+	case mproto.VT_TINY:
+		if err := need(1); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		return numeric(int64(int8(data[0]))), 1, nil
+	case mproto.VT_YEAR:
+		if err := need(1); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		if data[0] == 0 {
+			return numeric(0), 1, nil
+		}
+		return numeric(1900 + int64(data[0])), 1, nil
+	case mproto.VT_SHORT:
+		if err := need(2); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		return numeric(int64(int16(binary.LittleEndian.Uint16(data)))), 2, nil
+	case mproto.VT_INT24:
+		if err := need(3); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return numeric(int64(int32(v))), 3, nil
+	case mproto.VT_LONG:
+		if err := need(4); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		return numeric(int64(int32(binary.LittleEndian.Uint32(data)))), 4, nil
+	case mproto.VT_LONGLONG:
+		if err := need(8); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		return numeric(int64(binary.LittleEndian.Uint64(data))), 8, nil
+	case mproto.VT_FLOAT:
+		if err := need(4); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		return sqltypes.MakeFractional(strconv.AppendFloat(nil, float64(f), 'g', -1, 32)), 4, nil
+	case mproto.VT_DOUBLE:
+		if err := need(8); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return sqltypes.MakeFractional(strconv.AppendFloat(nil, f, 'g', -1, 64)), 8, nil
+	case mproto.VT_TIMESTAMP:
+		if err := need(4); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		t := time.Unix(int64(binary.LittleEndian.Uint32(data)), 0).UTC()
+		return str(t.Format("2006-01-02 15:04:05")), 4, nil
+	case typeTimestamp2:
+		size := 4 + fractionalSize(metadata)
+		if err := need(size); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		t := time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC()
+		return str(t.Format("2006-01-02 15:04:05") + fractional(data[4:size], metadata)), size, nil
+	case mproto.VT_DATE, mproto.VT_NEWDATE:
+		if err := need(3); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		return str(fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&0x0f, v&0x1f)), 3, nil
+	case mproto.VT_TIME:
+		if err := need(3); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		v := int32(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+		if v&0x800000 != 0 {
+			v |= -1 << 24
+		}
+		sign := ""
+		if v < 0 {
+			sign = "-"
+			v = -v
+		}
+		return str(fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v/100)%100, v%100)), 3, nil
+	case typeTime2:
+		size := 3 + fractionalSize(metadata)
+		if err := need(size); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		// The integer part is stored with an offset of 0x800000, to make
+		// negative values sort correctly.
+		v := int64(uint32(data[0])<<16|uint32(data[1])<<8|uint32(data[2])) - 0x800000
+		sign := ""
+		if v < 0 {
+			sign = "-"
+			v = -v
+		}
+		return str(fmt.Sprintf("%s%02d:%02d:%02d%s", sign, (v>>12)&0x3ff, (v>>6)&0x3f, v&0x3f, fractional(data[3:size], metadata))), size, nil
+	case mproto.VT_DATETIME:
+		if err := need(8); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		d, t := v/1000000, v%1000000
+		return str(fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", d/10000, (d/100)%100, d%100, t/10000, (t/100)%100, t%100)), 8, nil
+	case typeDatetime2:
+		size := 5 + fractionalSize(metadata)
+		if err := need(size); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		// 1 bit sign (always 1), 17 bits year*13+month, 5 bits day,
+		// 5 bits hour, 6 bits minute, 6 bits second.
+		v := uint64(data[0])<<32 | uint64(binary.BigEndian.Uint32(data[1:5]))
+		v -= 0x8000000000
+		ym := v >> 22
+		return str(fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d%s", ym/13, ym%13, (v>>17)&0x1f, (v>>12)&0x1f, (v>>6)&0x3f, v&0x3f, fractional(data[5:size], metadata))), size, nil
+	case mproto.VT_VARCHAR, mproto.VT_VAR_STRING:
+		// metadata is the max length in bytes.
+		return lengthPrefixedValue(data, typ, lengthPrefixSize(int(metadata)))
+	case mproto.VT_STRING, mproto.VT_ENUM, mproto.VT_SET:
+		// The real type and max length are packed in the metadata.
+		realType := byte(metadata >> 8)
+		switch realType {
+		case mproto.VT_ENUM:
+			size := int(metadata & 0xff)
+			if err := need(size); err != nil {
+				return sqltypes.Value{}, 0, err
+			}
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			return sqltypes.MakeNumeric(strconv.AppendUint(nil, v, 10)), size, nil
+		case mproto.VT_SET:
+			size := int(metadata & 0xff)
+			if err := need(size); err != nil {
+				return sqltypes.Value{}, 0, err
+			}
+			var v uint64
+			for i := size - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			return sqltypes.MakeNumeric(strconv.AppendUint(nil, v, 10)), size, nil
+		}
+		maxLength := int(((metadata >> 4) & 0x300) ^ 0x300 + metadata&0xff)
+		return lengthPrefixedValue(data, typ, lengthPrefixSize(maxLength))
+	case mproto.VT_BLOB, mproto.VT_GEOMETRY, typeJSON:
+		// metadata is the number of bytes of the length prefix.
+		return lengthPrefixedValue(data, typ, int(metadata))
+	case mproto.VT_BIT:
+		size := int(metadata>>8) + int((metadata&0xff+7)/8)
+		if err := need(size); err != nil {
+			return sqltypes.Value{}, 0, err
+		}
+		return sqltypes.MakeString(data[:size]), size, nil
+	case mproto.VT_NEWDECIMAL:
+		return decimalValue(data, int(metadata>>8), int(metadata&0xff))
+	}
+	return sqltypes.Value{}, 0, fmt.Errorf("unsupported column type %d", typ)
+}
+
+// lengthPrefixSize returns the size of the length prefix for a string
+// whose max length is maxLength.
+func lengthPrefixSize(maxLength int) int {
+	if maxLength > 255 {
+		return 2
+	}
+	return 1
+}
+
+// lengthPrefixedValue reads a little endian length of prefixSize bytes,
+// followed by that many bytes of data.
+func lengthPrefixedValue(data []byte, typ byte, prefixSize int) (sqltypes.Value, int, error) {
+	if prefixSize < 1 || prefixSize > 4 {
+		return sqltypes.Value{}, 0, fmt.Errorf("invalid length prefix size %d for type %d", prefixSize, typ)
+	}
+	if prefixSize > len(data) {
+		return sqltypes.Value{}, 0, fmt.Errorf("length of type %d is outside buffer", typ)
+	}
+	length := 0
+	for i := prefixSize - 1; i >= 0; i-- {
+		length = length<<8 | int(data[i])
+	}
+	end := prefixSize + length
+	if end > len(data) {
+		return sqltypes.Value{}, 0, fmt.Errorf("value of type %d needs %d bytes, only %d left", typ, end, len(data))
+	}
+	return sqltypes.MakeString(data[prefixSize:end]), end, nil
+}
+
+// fractionalSize returns the storage size of the fractional seconds of a
+// TIME2, DATETIME2 or TIMESTAMP2, given the fsp in the metadata.
+func fractionalSize(fsp uint16) int {
+	return int(fsp+1) / 2
+}
+
+// fractional formats the big endian fractional seconds in data with fsp
+// digits, including the leading dot. It returns "" if fsp is 0.
+func fractional(data []byte, fsp uint16) string {
+	if fsp == 0 {
+		return ""
+	}
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	// Each byte stores two digits, so odd fsp values have one extra digit.
+	digits := len(data) * 2
+	s := fmt.Sprintf("%0*d", digits, v)
+	return "." + s[:fsp]
+}
+
+// dig2bytes is the number of bytes used to store a given number of
+// decimal digits, for the leftover digits of a DECIMAL value.
+var dig2bytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decimalValue decodes a DECIMAL(precision, scale) value.
+// Digits are stored in groups of 9, as big endian 4 byte integers.
+// The leftover digits are stored in fewer bytes. The sign is stored
+// by flipping the high bit, and negative values have all bits inverted.
+func decimalValue(data []byte, precision, scale int) (sqltypes.Value, int, error) {
+	intg := precision - scale
+	intg0, intg0x := intg/9, intg%9
+	frac0, frac0x := scale/9, scale%9
+	size := intg0*4 + dig2bytes[intg0x] + frac0*4 + dig2bytes[frac0x]
+	if size > len(data) {
+		return sqltypes.Value{}, 0, fmt.Errorf("decimal(%d,%d) needs %d bytes, only %d left", precision, scale, size, len(data))
+	}
+	buf := make([]byte, size)
+	copy(buf, data[:size])
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+
+	pos := 0
+	readDigits := func(size int) uint32 {
+		var v uint32
+		for _, b := range buf[pos : pos+size] {
+			v = v<<8 | uint32(b)
+		}
+		pos += size
+		return v
+	}
+
+	var out bytes.Buffer
+	if negative {
+		out.WriteByte('-')
+	}
+	var intPart bytes.Buffer
+	if intg0x > 0 {
+		fmt.Fprintf(&intPart, "%d", readDigits(dig2bytes[intg0x]))
+	}
+	for i := 0; i < intg0; i++ {
+		fmt.Fprintf(&intPart, "%09d", readDigits(4))
+	}
+	intDigits := bytes.TrimLeft(intPart.Bytes(), "0")
+	if len(intDigits) == 0 {
+		out.WriteByte('0')
+	} else {
+		out.Write(intDigits)
+	}
+	if scale > 0 {
+		out.WriteByte('.')
+		for i := 0; i < frac0; i++ {
+			fmt.Fprintf(&out, "%09d", readDigits(4))
+		}
+		if frac0x > 0 {
+			fmt.Fprintf(&out, "%0*d", frac0x, readDigits(dig2bytes[frac0x]))
+		}
+	}
+	return sqltypes.MakeFractional(out.Bytes()), size, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+)
+
+var rowsTestFormat = blproto.BinlogFormat{FormatVersion: 4, HeaderLength: 27}
+
+// makeRowsTestEvent builds a Google MySQL event with the given type and data.
+func makeRowsTestEvent(typ byte, data []byte) binlogEvent {
+	buf := make([]byte, 27, 27+len(data))
+	binary.LittleEndian.PutUint32(buf[0:4], 1407805592)
+	buf[4] = typ
+	binary.LittleEndian.PutUint32(buf[9:13], uint32(27+len(data)))
+	buf[19] = 0xd
+	return binlogEvent(append(buf, data...))
+}
+
+var (
+	// table ID 0x12, vt_test.vt_a (id bigint, name varchar(64), flag tinyint)
+	rowsTestTableMap = []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x7, 'v', 't', '_', 't', 'e', 's', 't', 0x0,
+		0x4, 'v', 't', '_', 'a', 0x0,
+		0x3, mproto.VT_LONGLONG, mproto.VT_VARCHAR, mproto.VT_TINY,
+		0x2, 0x40, 0x0,
+		0x6,
+	}
+	// two rows: (1, 'abc', -1) and (2, NULL, 5)
+	rowsTestWriteRowsV2 = []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x7,
+		0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 'a', 'b', 'c', 0xff,
+		0x2, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
+	}
+	// one row: (1, 'abc', -1) -> (3, 'd', -1)
+	rowsTestUpdateRowsV1 = []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x3, 0x7, 0x7,
+		0x0, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x3, 'a', 'b', 'c', 0xff,
+		0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 'd', 0xff,
+	}
+	// one row, only the id is present: (2)
+	rowsTestDeleteRowsV2 = []byte{
+		0x12, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0,
+		0x2, 0x0,
+		0x3, 0x1,
+		0x0, 0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+	}
+)
+
+func TestBinlogEventIsTableMap(t *testing.T) {
+	input := makeRowsTestEvent(eventTableMap, rowsTestTableMap)
+	want := true
+	if got := input.IsTableMap(); got != want {
+		t.Errorf("%#v.IsTableMap() = %v, want %v", input, got, want)
+	}
+}
+
+func TestBinlogEventIsRows(t *testing.T) {
+	table := []struct {
+		typ                         byte
+		isWrite, isUpdate, isDelete bool
+	}{
+		{eventWriteRowsV1, true, false, false},
+		{eventWriteRowsV2, true, false, false},
+		{eventUpdateRowsV1, false, true, false},
+		{eventUpdateRowsV2, false, true, false},
+		{eventDeleteRowsV1, false, false, true},
+		{eventDeleteRowsV2, false, false, true},
+		{eventTableMap, false, false, false},
+	}
+	for _, tcase := range table {
+		input := makeRowsTestEvent(tcase.typ, nil)
+		if got := input.IsWriteRows(); got != tcase.isWrite {
+			t.Errorf("type %v: IsWriteRows() = %v, want %v", tcase.typ, got, tcase.isWrite)
+		}
+		if got := input.IsUpdateRows(); got != tcase.isUpdate {
+			t.Errorf("type %v: IsUpdateRows() = %v, want %v", tcase.typ, got, tcase.isUpdate)
+		}
+		if got := input.IsDeleteRows(); got != tcase.isDelete {
+			t.Errorf("type %v: IsDeleteRows() = %v, want %v", tcase.typ, got, tcase.isDelete)
+		}
+	}
+}
+
+func TestBinlogEventTableID(t *testing.T) {
+	input := makeRowsTestEvent(eventWriteRowsV2, rowsTestWriteRowsV2)
+	want := uint64(0x12)
+	if got := input.TableID(rowsTestFormat); got != want {
+		t.Errorf("%#v.TableID() = %v, want %v", input, got, want)
+	}
+}
+
+func TestBinlogEventTableMap(t *testing.T) {
+	input := makeRowsTestEvent(eventTableMap, rowsTestTableMap)
+	want := &blproto.TableMap{
+		Database: "vt_test",
+		Name:     "vt_a",
+		Types:    []byte{mproto.VT_LONGLONG, mproto.VT_VARCHAR, mproto.VT_TINY},
+		Metadata: []uint16{0, 64, 0},
+	}
+	got, err := input.TableMap(rowsTestFormat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%#v.TableMap() = %#v, want %#v", input, got, want)
+	}
+}
+
+func TestBinlogEventTableMapTruncated(t *testing.T) {
+	input := makeRowsTestEvent(eventTableMap, rowsTestTableMap[:28])
+	want := "metadata block is outside buffer"
+	_, err := input.TableMap(rowsTestFormat)
+	if err == nil || err.Error() != want {
+		t.Errorf("wrong error, got %#v, want %#v", err, want)
+	}
+}
+
+func rowsTestTableMapValue(t *testing.T) *blproto.TableMap {
+	tm, err := makeRowsTestEvent(eventTableMap, rowsTestTableMap).TableMap(rowsTestFormat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return tm
+}
+
+func TestBinlogEventWriteRows(t *testing.T) {
+	input := makeRowsTestEvent(eventWriteRowsV2, rowsTestWriteRowsV2)
+	want := blproto.Rows{
+		DataColumns: []bool{true, true, true},
+		Rows: []blproto.Row{
+			{Data: []sqltypes.Value{
+				sqltypes.MakeNumeric([]byte("1")),
+				sqltypes.MakeString([]byte("abc")),
+				sqltypes.MakeNumeric([]byte("-1")),
+			}},
+			{Data: []sqltypes.Value{
+				sqltypes.MakeNumeric([]byte("2")),
+				sqltypes.Value{},
+				sqltypes.MakeNumeric([]byte("5")),
+			}},
+		},
+	}
+	got, err := input.Rows(rowsTestFormat, rowsTestTableMapValue(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%#v.Rows() = %#v, want %#v", input, got, want)
+	}
+}
+
+func TestBinlogEventUpdateRows(t *testing.T) {
+	input := makeRowsTestEvent(eventUpdateRowsV1, rowsTestUpdateRowsV1)
+	want := blproto.Rows{
+		IdentifyColumns: []bool{true, true, true},
+		DataColumns:     []bool{true, true, true},
+		Rows: []blproto.Row{
+			{
+				Identify: []sqltypes.Value{
+					sqltypes.MakeNumeric([]byte("1")),
+					sqltypes.MakeString([]byte("abc")),
+					sqltypes.MakeNumeric([]byte("-1")),
+				},
+				Data: []sqltypes.Value{
+					sqltypes.MakeNumeric([]byte("3")),
+					sqltypes.MakeString([]byte("d")),
+					sqltypes.MakeNumeric([]byte("-1")),
+				},
+			},
+		},
+	}
+	got, err := input.Rows(rowsTestFormat, rowsTestTableMapValue(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%#v.Rows() = %#v, want %#v", input, got, want)
+	}
+}
+
+func TestBinlogEventDeleteRowsPartialImage(t *testing.T) {
+	input := makeRowsTestEvent(eventDeleteRowsV2, rowsTestDeleteRowsV2)
+	want := blproto.Rows{
+		IdentifyColumns: []bool{true, false, false},
+		Rows: []blproto.Row{
+			{Identify: []sqltypes.Value{
+				sqltypes.MakeNumeric([]byte("2")),
+				sqltypes.Value{},
+				sqltypes.Value{},
+			}},
+		},
+	}
+	got, err := input.Rows(rowsTestFormat, rowsTestTableMapValue(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%#v.Rows() = %#v, want %#v", input, got, want)
+	}
+}
+
+func TestBinlogEventRowsTruncated(t *testing.T) {
+	input := makeRowsTestEvent(eventWriteRowsV2, rowsTestWriteRowsV2[:len(rowsTestWriteRowsV2)-1])
+	_, err := input.Rows(rowsTestFormat, rowsTestTableMapValue(t))
+	if err == nil {
+		t.Errorf("expected error for truncated rows event")
+	}
+}
+
+func TestCellValue(t *testing.T) {
+	table := []struct {
+		typ      byte
+		metadata uint16
+		data     []byte
+		want     string
+	}{
+		{mproto.VT_SHORT, 0, []byte{0xfe, 0xff}, "-2"},
+		{mproto.VT_INT24, 0, []byte{0xff, 0xff, 0xff}, "-1"},
+		{mproto.VT_LONG, 0, []byte{0x2a, 0x0, 0x0, 0x0}, "42"},
+		{mproto.VT_YEAR, 0, []byte{114}, "2014"},
+		{mproto.VT_DOUBLE, 0, []byte{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf8, 0x3f}, "1.5"},
+		{mproto.VT_NEWDECIMAL, 10<<8 | 2, []byte{0x80, 0x0, 0x4, 0xd2, 0x38}, "1234.56"},
+		{mproto.VT_NEWDECIMAL, 10<<8 | 2, []byte{0x7f, 0xff, 0xfb, 0x2d, 0xc7}, "-1234.56"},
+		{mproto.VT_DATE, 0, []byte{0xc, 0xbd, 0xf}, "2014-08-12"},
+		{mproto.VT_TIMESTAMP, 0, []byte{0x98, 0x68, 0xe9, 0x53}, "2014-08-12 01:06:32"},
+		{typeTimestamp2, 3, []byte{0x53, 0xe9, 0x68, 0x98, 0x4, 0xce}, "2014-08-12 01:06:32.123"},
+		{typeDatetime2, 0, []byte{0x99, 0x93, 0x98, 0x10, 0x83}, "2014-08-12 01:02:03"},
+		{mproto.VT_BLOB, 2, []byte{0x2, 0x0, 'h', 'i'}, "hi"},
+		{mproto.VT_STRING, mproto.VT_STRING<<8 | 10, []byte{0x2, 'h', 'i'}, "hi"},
+		{mproto.VT_STRING, mproto.VT_ENUM<<8 | 1, []byte{0x2}, "2"},
+	}
+	for _, tcase := range table {
+		got, size, err := cellValue(tcase.data, tcase.typ, tcase.metadata)
+		if err != nil {
+			t.Errorf("cellValue(%v, %v, %v): unexpected error: %v", tcase.data, tcase.typ, tcase.metadata, err)
+			continue
+		}
+		if got.String() != tcase.want {
+			t.Errorf("cellValue(%v, %v, %v) = %v, want %v", tcase.data, tcase.typ, tcase.metadata, got.String(), tcase.want)
+		}
+		if size != len(tcase.data) {
+			t.Errorf("cellValue(%v, %v, %v) used %v bytes, want %v", tcase.data, tcase.typ, tcase.metadata, size, len(tcase.data))
+		}
+	}
+}
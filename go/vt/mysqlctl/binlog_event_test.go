@@ -5,6 +5,10 @@
 package mysqlctl
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
 	"testing"
 
 	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
@@ -237,14 +241,55 @@ eid bigint,
 id int,
 primary key(eid, id)
 ) Engine=InnoDB`
-	gotDB, gotbytes, err := input.Query(f)
-	gotSQL := string(gotbytes)
+	wantCharset := &blproto.Charset{Client: 8, Conn: 8, Server: 33}
+	got, err := input.Query(f)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 		return
 	}
-	if gotDB != wantDB || gotSQL != wantSQL {
-		t.Errorf("%#v.Query() = (%#v, %#v), want (%#v, %#v)", input, gotDB, gotSQL, wantDB, wantSQL)
+	gotSQL := string(got.SQL)
+	if got.Database != wantDB || gotSQL != wantSQL {
+		t.Errorf("%#v.Query() = (%#v, %#v), want (%#v, %#v)", input, got.Database, gotSQL, wantDB, wantSQL)
+	}
+	if !reflect.DeepEqual(got.Charset, wantCharset) {
+		t.Errorf("%#v.Query() charset = %#v, want %#v", input, got.Charset, wantCharset)
+	}
+}
+
+func TestQueryCharset(t *testing.T) {
+	table := []struct {
+		vars []byte
+		want *blproto.Charset
+	}{
+		{
+			vars: []byte{0x4, 0x21, 0x0, 0x8, 0x0, 0x53, 0x0},
+			want: &blproto.Charset{Client: 33, Conn: 8, Server: 83},
+		},
+		{
+			// Q_FLAGS2_CODE, Q_CATALOG_CODE and Q_AUTO_INCREMENT come first.
+			vars: []byte{0x0, 0x0, 0x0, 0x0, 0x40, 0x2, 0x3, 's', 't', 'd', 0x0, 0x3, 0x1, 0x0, 0x1, 0x0, 0x4, 0x8, 0x0, 0x8, 0x0, 0x8, 0x0},
+			want: &blproto.Charset{Client: 8, Conn: 8, Server: 8},
+		},
+		{
+			// no charset
+			vars: []byte{0x0, 0x0, 0x0, 0x0, 0x40},
+			want: nil,
+		},
+		{
+			// unknown status variable before the charset
+			vars: []byte{0x5, 0x3, 'U', 'T', 'C', 0x4, 0x8, 0x0, 0x8, 0x0, 0x8, 0x0},
+			want: nil,
+		},
+		{
+			// truncated charset
+			vars: []byte{0x4, 0x21, 0x0, 0x8},
+			want: nil,
+		},
+	}
+	for _, tcase := range table {
+		if got := queryCharset(tcase.vars); !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("queryCharset(%v) = %#v, want %#v", tcase.vars, got, tcase.want)
+		}
 	}
 }
 
@@ -261,7 +306,7 @@ func TestBinlogEventQueryBadLength(t *testing.T) {
 
 	input := binlogEvent(buf)
 	want := "SQL query position = 240, which is outside buffer"
-	_, _, err = input.Query(f)
+	_, err = input.Query(f)
 	if err == nil {
 		t.Errorf("expected error, got none")
 		return
@@ -333,3 +378,116 @@ func TestBinlogEventIntVarBadID(t *testing.T) {
 		t.Errorf("wrong error, got %#v, want %#v", got, want)
 	}
 }
+
+// withChecksum returns a copy of an event with a CRC32 checksum appended,
+// as written by a server with binlog_checksum=CRC32.
+func withChecksum(event []byte) []byte {
+	buf := make([]byte, len(event), len(event)+4)
+	copy(buf, event)
+	binary.LittleEndian.PutUint32(buf[9:9+4], uint32(len(event)+4))
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(buf))
+	return append(buf, checksum...)
+}
+
+func TestServerSupportsChecksums(t *testing.T) {
+	table := map[string]bool{
+		"5.1.63-google-log":             false,
+		"5.6.0-m4":                      false,
+		"5.6.1-m5":                      true,
+		"5.6.17-log":                    true,
+		"5.7.4-m14":                     true,
+		"5.2.14-MariaDB":                false,
+		"5.3.12-MariaDB":                true,
+		"10.0.13-MariaDB-1~precise-log": true,
+		"garbage":                       false,
+	}
+	for version, want := range table {
+		if got := serverSupportsChecksums(version); got != want {
+			t.Errorf("serverSupportsChecksums(%#v) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestBinlogEventFormatChecksum(t *testing.T) {
+	// Make a MySQL 5.6 FORMAT_DESCRIPTION_EVENT, which ends with the checksum
+	// algorithm and its own checksum.
+	buf := make([]byte, len(googleFormatEvent))
+	copy(buf, googleFormatEvent)
+	copy(buf[19+2:19+2+50], append([]byte("5.6.17-log"), make([]byte, 50)...))
+	buf = withChecksum(append(buf, blproto.BinlogChecksumAlgCRC32))
+
+	input := binlogEvent(buf)
+	want := blproto.BinlogFormat{
+		FormatVersion:     4,
+		ServerVersion:     "5.6.17-log",
+		HeaderLength:      27,
+		ChecksumAlgorithm: blproto.BinlogChecksumAlgCRC32,
+	}
+	got, err := input.Format()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("%#v.Format() = %v, want %v", input, got, want)
+	}
+}
+
+func TestBinlogEventStripChecksum(t *testing.T) {
+	f := blproto.BinlogFormat{HeaderLength: 27, ChecksumAlgorithm: blproto.BinlogChecksumAlgCRC32}
+	buf := withChecksum(googleXIDEvent)
+
+	input := binlogEvent(buf)
+	got, checksum, err := input.stripChecksum(f)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if want := buf[:len(buf)-4]; !bytes.Equal(got, want) {
+		t.Errorf("%#v.stripChecksum() = %#v, want %#v", input, got, want)
+	}
+	if want := buf[len(buf)-4:]; !bytes.Equal(checksum, want) {
+		t.Errorf("%#v.stripChecksum() checksum = %#v, want %#v", input, checksum, want)
+	}
+}
+
+func TestBinlogEventStripChecksumOff(t *testing.T) {
+	f := blproto.BinlogFormat{HeaderLength: 27, ChecksumAlgorithm: blproto.BinlogChecksumAlgOff}
+
+	input := binlogEvent(googleXIDEvent)
+	got, checksum, err := input.stripChecksum(f)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if !bytes.Equal(got, input) || checksum != nil {
+		t.Errorf("%#v.stripChecksum() = (%#v, %#v), want the event unchanged", input, got, checksum)
+	}
+}
+
+func TestBinlogEventStripChecksumMismatch(t *testing.T) {
+	f := blproto.BinlogFormat{HeaderLength: 27, ChecksumAlgorithm: blproto.BinlogChecksumAlgCRC32}
+	buf := withChecksum(googleXIDEvent)
+	buf[19+8] = 0x79 // mess up the XID
+
+	input := binlogEvent(buf)
+	_, _, err := input.stripChecksum(f)
+	if err == nil {
+		t.Errorf("expected error, got none")
+	}
+}
+
+func TestBinlogEventStripChecksumUnsupported(t *testing.T) {
+	f := blproto.BinlogFormat{HeaderLength: 27, ChecksumAlgorithm: 2}
+
+	input := binlogEvent(googleXIDEvent)
+	want := "unsupported checksum algorithm: 2"
+	_, _, err := input.stripChecksum(f)
+	if err == nil {
+		t.Errorf("expected error, got none")
+		return
+	}
+	if got := err.Error(); got != want {
+		t.Errorf("wrong error, got %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/cgzip"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// BuiltinBackupEngine encapsulates the logic of the builtin engine,
+// which shuts mysqld down and copies its files, each compressed in
+// its own file of the backup.
+type BuiltinBackupEngine struct {
+}
+
+const (
+	// the bases of the files, relative to the Mycnf directories
+	backupInnodbDataHomeDir     = "InnoDBData"
+	backupInnodbLogGroupHomeDir = "InnoDBLog"
+	backupData                  = "Data"
+)
+
+// FileEntry is one file to backup
+type FileEntry struct {
+	// Base is one of the backup* base constants
+	Base string
+
+	// Name is the file name, relative to Base
+	Name string
+
+	// Hash is the hash of the uncompressed file
+	Hash string
+}
+
+func (fe *FileEntry) path(cnf *Mycnf) (string, error) {
+	var root string
+	switch fe.Base {
+	case backupInnodbDataHomeDir:
+		root = cnf.InnodbDataHomeDir
+	case backupInnodbLogGroupHomeDir:
+		root = cnf.InnodbLogGroupHomeDir
+	case backupData:
+		root = cnf.DataDir
+	default:
+		return "", fmt.Errorf("unknown base: %v", fe.Base)
+	}
+	return path.Join(root, fe.Name), nil
+}
+
+// open attempts to open the file
+func (fe *FileEntry) open(cnf *Mycnf, readOnly bool) (*os.File, error) {
+	name, err := fe.path(cnf)
+	if err != nil {
+		return nil, err
+	}
+	if readOnly {
+		return os.Open(name)
+	}
+	dir := path.Dir(name)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("cannot create destination directory %v: %v", dir, err)
+	}
+	return os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0660)
+}
+
+// isDbDir returns true if the given directory contains a database.
+func isDbDir(p string) bool {
+	// Anything that has a db.opt file is a db directory,
+	// that includes empty databases.
+	if _, err := os.Stat(path.Join(p, "db.opt")); err == nil {
+		return true
+	}
+
+	// Look for at least one .frm file
+	fis, err := ioutil.ReadDir(p)
+	if err != nil {
+		return false
+	}
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".frm") {
+			return true
+		}
+	}
+	return false
+}
+
+// addDirectory adds the files of srcDir, with the given base, to fes.
+// If filter is not nil, only the files it accepts are added. The
+// names of the files are relative to srcDir, prefixed with dir.
+func addDirectory(fes []FileEntry, base, srcDir, dir string, filter func(name string) bool) ([]FileEntry, error) {
+	fis, err := ioutil.ReadDir(path.Join(srcDir, dir))
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || (filter != nil && !filter(fi.Name())) {
+			continue
+		}
+		fes = append(fes, FileEntry{
+			Base: base,
+			Name: path.Join(dir, fi.Name()),
+		})
+	}
+	return fes, nil
+}
+
+// addDatabases adds the files of all the databases in dataDir to fes,
+// with the backupData base.
+func addDatabases(fes []FileEntry, dataDir string) ([]FileEntry, error) {
+	fis, err := ioutil.ReadDir(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		p := path.Join(dataDir, fi.Name())
+
+		// If this is not a directory, try to eval it as a symlink.
+		if !fi.IsDir() {
+			if fi, err = os.Stat(p); err != nil || !fi.IsDir() {
+				continue
+			}
+		}
+
+		if isDbDir(p) {
+			fes, err = addDirectory(fes, backupData, dataDir, fi.Name(), nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return fes, nil
+}
+
+// findFilesToBackup returns the files of a stopped mysqld.
+func findFilesToBackup(cnf *Mycnf) ([]FileEntry, error) {
+	var err error
+	var result []FileEntry
+
+	// first add innodb files
+	result, err = addDirectory(result, backupInnodbDataHomeDir, cnf.InnodbDataHomeDir, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err = addDirectory(result, backupInnodbLogGroupHomeDir, cnf.InnodbLogGroupHomeDir, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// then add the databases
+	return addDatabases(result, cnf.DataDir)
+}
+
+// ExecuteBackup is part of the BackupEngine interface. It stops the
+// writes to get a consistent replication position, shuts mysqld down
+// while its files are copied, and restores the same replication and
+// read-only state afterwards.
+func (be *BuiltinBackupEngine) ExecuteBackup(mysqld *Mysqld, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (*BackupManifest, error) {
+	// save initial state so we can restore
+	slaveStartRequired := false
+	sourceIsMaster := false
+	slaveStatus, err := mysqld.slaveStatus()
+	if err == nil {
+		slaveStartRequired = (slaveStatus["Slave_IO_Running"] == "Yes" && slaveStatus["Slave_SQL_Running"] == "Yes")
+	} else if err == ErrNotSlave {
+		sourceIsMaster = true
+	} else {
+		// If we can't get any data, just fail.
+		return nil, err
+	}
+	readOnly, err := mysqld.IsReadOnly()
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop sources of writes so we can get a consistent replication position.
+	var replicationPosition *proto.ReplicationPosition
+	if sourceIsMaster {
+		if err := mysqld.SetReadOnly(true); err != nil {
+			return nil, err
+		}
+		replicationPosition, err = mysqld.MasterStatus()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := mysqld.StopSlave(hookExtraEnv); err != nil {
+			return nil, err
+		}
+		replicationPosition, err = mysqld.SlaveStatus()
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Infof("using replication position: %#v", replicationPosition)
+
+	// Send the files while mysqld is shut down.
+	if err := mysqld.Shutdown(true, MysqlWaitTime); err != nil {
+		return nil, err
+	}
+	fes, backupErr := findFilesToBackup(mysqld.config)
+	if backupErr == nil {
+		backupErr = backupFiles(mysqld.config, bh, fes, backupConcurrency)
+	}
+	if err := mysqld.SnapshotSourceEnd(slaveStartRequired, readOnly, false /*deleteSnapshot*/, hookExtraEnv); err != nil {
+		return nil, err
+	}
+	if backupErr != nil {
+		return nil, backupErr
+	}
+
+	return &BackupManifest{
+		BackupMethod:        builtin,
+		FileEntries:         fes,
+		ReplicationPosition: *replicationPosition,
+	}, nil
+}
+
+// backupFiles sends the files, compressed, to the backup, and fills
+// in their hashes.
+func backupFiles(cnf *Mycnf, bh backupstorage.BackupHandle, fes []FileEntry, backupConcurrency int) error {
+	sema := sync2.NewSemaphore(backupConcurrency, 0)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for i := range fes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// wait until we are ready to go, skip if we already
+			// encountered an error
+			sema.Acquire()
+			defer sema.Release()
+			if rec.HasErrors() {
+				return
+			}
+
+			rec.RecordError(backupFile(cnf, bh, &fes[i], fmt.Sprintf("%v", i)))
+		}(i)
+	}
+	wg.Wait()
+	return rec.Error()
+}
+
+func backupFile(cnf *Mycnf, bh backupstorage.BackupHandle, fe *FileEntry, name string) error {
+	// open the source file for reading
+	source, err := fe.open(cnf, true)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// open the destination file for writing, and a buffer
+	wc, err := bh.AddFile(name)
+	if err != nil {
+		return fmt.Errorf("cannot add file: %v", err)
+	}
+	defer wc.Close()
+	dst := bufio.NewWriterSize(wc, 2*1024*1024)
+
+	// create the hasher on the source, and the gzip compression
+	// filter on the destination
+	hasher := newHasher()
+	gzip, err := cgzip.NewWriterLevel(dst, cgzip.Z_BEST_SPEED)
+	if err != nil {
+		return fmt.Errorf("cannot create gziper: %v", err)
+	}
+
+	// copy from the source file to gzip to buffer to destination
+	if _, err := io.Copy(gzip, io.TeeReader(source, hasher)); err != nil {
+		return fmt.Errorf("cannot copy data: %v", err)
+	}
+
+	// close gzip to flush it, then the buffer and the destination
+	if err := gzip.Close(); err != nil {
+		return fmt.Errorf("cannot close gzip: %v", err)
+	}
+	if err := dst.Flush(); err != nil {
+		return fmt.Errorf("cannot flush dst: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("cannot close %v: %v", name, err)
+	}
+
+	fe.Hash = hasher.HashString()
+	return nil
+}
+
+// ExecuteRestore is part of the BackupEngine interface. It replaces
+// the innodb files and the databases of the stopped mysqld with the
+// files of the backup.
+func (be *BuiltinBackupEngine) ExecuteRestore(mysqld *Mysqld, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, checkPosition func(*proto.ReplicationPosition) error) (*proto.ReplicationPosition, error) {
+	if checkPosition != nil {
+		if err := checkPosition(&bm.ReplicationPosition); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("Restore: cleaning up the current files")
+	if err := be.cleanupForRestore(mysqld, bm.FileEntries); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Restore: copying %v files", len(bm.FileEntries))
+	if err := restoreFiles(mysqld.config, bh, bm.FileEntries, restoreConcurrency); err != nil {
+		return nil, err
+	}
+	return &bm.ReplicationPosition, nil
+}
+
+// cleanupForRestore removes the innodb files, and the directories of
+// the databases that are in the backup.
+func (be *BuiltinBackupEngine) cleanupForRestore(mysqld *Mysqld, fes []FileEntry) error {
+	cleanDirs := []string{mysqld.config.InnodbDataHomeDir, mysqld.config.InnodbLogGroupHomeDir}
+	seen := make(map[string]bool)
+	for _, fe := range fes {
+		if fe.Base != backupData {
+			continue
+		}
+		db := strings.Split(fe.Name, "/")[0]
+		if !seen[db] {
+			seen[db] = true
+			cleanDirs = append(cleanDirs, path.Join(mysqld.config.DataDir, db))
+		}
+	}
+
+	for _, dir := range cleanDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreFiles copies the files from the backup to their final
+// location, uncompressing them and checking their hashes.
+func restoreFiles(cnf *Mycnf, bh backupstorage.BackupHandle, fes []FileEntry, restoreConcurrency int) error {
+	sema := sync2.NewSemaphore(restoreConcurrency, 0)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for i := range fes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// wait until we are ready to go, skip if we already
+			// encountered an error
+			sema.Acquire()
+			defer sema.Release()
+			if rec.HasErrors() {
+				return
+			}
+
+			rec.RecordError(restoreFile(cnf, bh, &fes[i], fmt.Sprintf("%v", i)))
+		}(i)
+	}
+	wg.Wait()
+	return rec.Error()
+}
+
+func restoreFile(cnf *Mycnf, bh backupstorage.BackupHandle, fe *FileEntry, name string) error {
+	// open the source file for reading
+	source, err := bh.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// open the destination file for writing
+	dstFile, err := fe.open(cnf, false)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	// create a buffering output, and the hasher on it
+	dst := bufio.NewWriterSize(dstFile, 2*1024*1024)
+	hasher := newHasher()
+
+	// create the uncompresser
+	gz, err := cgzip.NewReader(source)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	// copy the data, and check the hash
+	if _, err := io.Copy(io.MultiWriter(dst, hasher), gz); err != nil {
+		return err
+	}
+	if hash := hasher.HashString(); hash != fe.Hash {
+		return fmt.Errorf("hash mismatch for %v, got %v expected %v", fe.Name, hash, fe.Hash)
+	}
+
+	// flush the buffer
+	if err := dst.Flush(); err != nil {
+		return err
+	}
+	return dstFile.Close()
+}
+
+func init() {
+	backupEngines[builtin] = &BuiltinBackupEngine{}
+}
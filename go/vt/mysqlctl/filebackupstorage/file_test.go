@@ -0,0 +1,183 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package filebackupstorage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// setupFileBackupStorage creates a temporary directory, and
+// returns a FileBackupStorage based on it
+func setupFileBackupStorage(t *testing.T) *FileBackupStorage {
+	root, err := ioutil.TempDir("", "fbstest")
+	if err != nil {
+		t.Fatalf("os.TempDir failed: %v", err)
+	}
+	*FileBackupStorageRoot = root
+	return &FileBackupStorage{}
+}
+
+// cleanupFileBackupStorage removes the entire directory
+func cleanupFileBackupStorage(fbs *FileBackupStorage) {
+	os.RemoveAll(*FileBackupStorageRoot)
+}
+
+func TestListBackups(t *testing.T) {
+	fbs := setupFileBackupStorage(t)
+	defer cleanupFileBackupStorage(fbs)
+
+	// verify we have no entry now
+	bucket := "keyspace/shard"
+	bhs, err := fbs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups on empty fbs failed: %v", err)
+	}
+	if len(bhs) != 0 {
+		t.Fatalf("ListBackups on empty fbs returned results: %#v", bhs)
+	}
+
+	// add one empty backup
+	firstBackup := "cell-0001-2014-10-15-10-00"
+	bh, err := fbs.StartBackup(bucket, firstBackup)
+	if err != nil {
+		t.Fatalf("fbs.StartBackup failed: %v", err)
+	}
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("bh.EndBackup failed: %v", err)
+	}
+
+	// verify we have one entry now
+	bhs, err = fbs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if len(bhs) != 1 ||
+		bhs[0].Bucket() != bucket ||
+		bhs[0].Name() != firstBackup {
+		t.Fatalf("ListBackups with one backup returned wrong results: %#v", bhs)
+	}
+
+	// add another one, with earlier date
+	secondBackup := "cell-0001-2014-10-14-10-00"
+	bh, err = fbs.StartBackup(bucket, secondBackup)
+	if err != nil {
+		t.Fatalf("fbs.StartBackup failed: %v", err)
+	}
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("bh.EndBackup failed: %v", err)
+	}
+
+	// verify we have two sorted entries now
+	bhs, err = fbs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups failed: %v", err)
+	}
+	if len(bhs) != 2 ||
+		bhs[0].Name() != secondBackup ||
+		bhs[1].Name() != firstBackup {
+		t.Fatalf("ListBackups with two backups returned wrong results: %#v", bhs)
+	}
+
+	// a backup with the same name can't be started
+	if _, err := fbs.StartBackup(bucket, firstBackup); err == nil {
+		t.Errorf("StartBackup with an existing name didn't fail")
+	}
+
+	// remove a backup, back to one
+	if err := fbs.RemoveBackup(bucket, secondBackup); err != nil {
+		t.Fatalf("RemoveBackup failed: %v", err)
+	}
+	bhs, err = fbs.ListBackups(bucket)
+	if err != nil {
+		t.Fatalf("ListBackups after deletion failed: %v", err)
+	}
+	if len(bhs) != 1 || bhs[0].Name() != firstBackup {
+		t.Fatalf("ListBackups after deletion returned wrong results: %#v", bhs)
+	}
+
+	// read-only backups can't be changed
+	if _, err := bhs[0].AddFile("toto"); err == nil {
+		t.Errorf("AddFile on read-only backup didn't fail")
+	}
+	if err := bhs[0].EndBackup(); err == nil {
+		t.Errorf("EndBackup on read-only backup didn't fail")
+	}
+	if err := bhs[0].AbortBackup(); err == nil {
+		t.Errorf("AbortBackup on read-only backup didn't fail")
+	}
+}
+
+func TestFileContents(t *testing.T) {
+	fbs := setupFileBackupStorage(t)
+	defer cleanupFileBackupStorage(fbs)
+
+	bucket := "keyspace/shard"
+	name := "cell-0001-2014-10-15-10-00"
+	filename1 := "file1"
+	contents1 := "contents of the first file"
+
+	// start a backup, add a file
+	bh, err := fbs.StartBackup(bucket, name)
+	if err != nil {
+		t.Fatalf("fbs.StartBackup failed: %v", err)
+	}
+	wc, err := bh.AddFile(filename1)
+	if err != nil {
+		t.Fatalf("bh.AddFile failed: %v", err)
+	}
+	if _, err := wc.Write([]byte(contents1)); err != nil {
+		t.Fatalf("wc.Write failed: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		t.Fatalf("wc.Close failed: %v", err)
+	}
+
+	// test we can't read back on read-write backup
+	if _, err := bh.ReadFile(filename1); err == nil {
+		t.Fatalf("bh.ReadFile on read-write backup didn't fail")
+	}
+
+	// and close
+	if err := bh.EndBackup(); err != nil {
+		t.Fatalf("bh.EndBackup failed: %v", err)
+	}
+
+	// re-read the file
+	bhs, err := fbs.ListBackups(bucket)
+	if err != nil || len(bhs) != 1 {
+		t.Fatalf("ListBackups returned wrong return: %v %v", err, bhs)
+	}
+	rc, err := bhs[0].ReadFile(filename1)
+	if err != nil {
+		t.Fatalf("bhs[0].ReadFile failed: %v", err)
+	}
+	buf := make([]byte, len(contents1)+10)
+	n, err := rc.Read(buf)
+	if (err != nil && err != io.EOF) || n != len(contents1) {
+		t.Fatalf("rc.Read returned wrong result: %v %#v", err, n)
+	}
+	rc.Close()
+}
+
+func TestAbortBackup(t *testing.T) {
+	fbs := setupFileBackupStorage(t)
+	defer cleanupFileBackupStorage(fbs)
+
+	bucket := "keyspace/shard"
+	bh, err := fbs.StartBackup(bucket, "cell-0001-2014-10-15-10-00")
+	if err != nil {
+		t.Fatalf("fbs.StartBackup failed: %v", err)
+	}
+	if err := bh.AbortBackup(); err != nil {
+		t.Fatalf("bh.AbortBackup failed: %v", err)
+	}
+	bhs, err := fbs.ListBackups(bucket)
+	if err != nil || len(bhs) != 0 {
+		t.Fatalf("ListBackups after abort returned wrong return: %v %v", err, bhs)
+	}
+}
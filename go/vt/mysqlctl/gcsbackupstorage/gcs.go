@@ -0,0 +1,311 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gcsbackupstorage implements the BackupStorage interface
+// for Google Cloud Storage, with its JSON API.
+//
+// The backups are stored in a single GCS bucket, as
+// <root>/<backup bucket>/<backup name>/<file>. The OAuth2 access
+// tokens come from the metadata server of the instance, for its
+// default service account.
+package gcsbackupstorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+var (
+	bucket    = flag.String("gcs_backup_storage_bucket", "", "Google Cloud Storage bucket to store the backups in")
+	root      = flag.String("gcs_backup_storage_root", "", "root prefix for all the backup objects in the Google Cloud Storage bucket")
+	endpoint  = flag.String("gcs_backup_storage_endpoint", "https://www.googleapis.com", "Google Cloud Storage JSON API endpoint")
+	tokenURL  = flag.String("gcs_backup_storage_token_url", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", "URL of the metadata server to get the access tokens from (empty for no authentication)")
+	chunkSize = flag.Int("gcs_backup_storage_chunk_size", 16*1024*1024, "size of the chunks of the resumable uploads, a multiple of 256KB")
+)
+
+// GCSBackupHandle implements BackupHandle for Google Cloud Storage.
+type GCSBackupHandle struct {
+	bs       *GCSBackupStorage
+	dir      string
+	name     string
+	readOnly bool
+}
+
+// Bucket is part of the BackupHandle interface
+func (bh *GCSBackupHandle) Bucket() string {
+	return bh.dir
+}
+
+// Name is part of the BackupHandle interface
+func (bh *GCSBackupHandle) Name() string {
+	return bh.name
+}
+
+// AddFile is part of the BackupHandle interface. The file is sent
+// in chunks of gcs_backup_storage_chunk_size bytes as it is written,
+// and completed by Close.
+func (bh *GCSBackupHandle) AddFile(filename string) (io.WriteCloser, error) {
+	if bh.readOnly {
+		return nil, fmt.Errorf("AddFile cannot be called on read-only backup")
+	}
+	return &gcsWriter{
+		bs:   bh.bs,
+		name: objectName(bh.dir, bh.name, filename),
+	}, nil
+}
+
+// EndBackup is part of the BackupHandle interface
+func (bh *GCSBackupHandle) EndBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("EndBackup cannot be called on read-only backup")
+	}
+	return nil
+}
+
+// AbortBackup is part of the BackupHandle interface
+func (bh *GCSBackupHandle) AbortBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("AbortBackup cannot be called on read-only backup")
+	}
+	return bh.bs.RemoveBackup(bh.dir, bh.name)
+}
+
+// ReadFile is part of the BackupHandle interface
+func (bh *GCSBackupHandle) ReadFile(filename string) (io.ReadCloser, error) {
+	if !bh.readOnly {
+		return nil, fmt.Errorf("ReadFile cannot be called on read-write backup")
+	}
+	resp, err := bh.bs.do("GET", objectURL(objectName(bh.dir, bh.name, filename))+"?alt=media", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GCSBackupStorage implements BackupStorage for Google Cloud Storage.
+type GCSBackupStorage struct {
+	client *http.Client
+
+	// mu protects the cached access token
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// ListBackups is part of the BackupStorage interface
+func (bs *GCSBackupStorage) ListBackups(dir string) ([]backupstorage.BackupHandle, error) {
+	prefix := objectName(dir) + "/"
+	prefixes, _, err := bs.list(prefix, "/", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]backupstorage.BackupHandle, 0, len(prefixes))
+	for _, p := range prefixes {
+		result = append(result, &GCSBackupHandle{
+			bs:       bs,
+			dir:      dir,
+			name:     strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"),
+			readOnly: true,
+		})
+	}
+	return result, nil
+}
+
+// StartBackup is part of the BackupStorage interface
+func (bs *GCSBackupStorage) StartBackup(dir, name string) (backupstorage.BackupHandle, error) {
+	// GCS has no directories, just check nothing uses the name yet
+	_, names, err := bs.list(objectName(dir, name)+"/", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		return nil, fmt.Errorf("backup %v/%v already exists", dir, name)
+	}
+
+	return &GCSBackupHandle{
+		bs:       bs,
+		dir:      dir,
+		name:     name,
+		readOnly: false,
+	}, nil
+}
+
+// RemoveBackup is part of the BackupStorage interface
+func (bs *GCSBackupStorage) RemoveBackup(dir, name string) error {
+	_, names, err := bs.list(objectName(dir, name)+"/", "", 0)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		resp, err := bs.do("DELETE", objectURL(n), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// objectName returns the name of an object in the GCS bucket.
+func objectName(parts ...string) string {
+	return path.Join(append([]string{*root}, parts...)...)
+}
+
+// escape encodes s for a path segment or a query parameter.
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// bucketURL returns the URL of the bucket in the JSON API.
+func bucketURL() string {
+	return fmt.Sprintf("%v/storage/v1/b/%v", *endpoint, escape(*bucket))
+}
+
+// objectURL returns the URL of an object in the JSON API.
+func objectURL(name string) string {
+	return bucketURL() + "/o/" + escape(name)
+}
+
+type listObjectsResult struct {
+	Prefixes []string `json:"prefixes"`
+	Items    []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// list returns the sorted prefixes and names of the objects that
+// start with prefix. If maxResults is not 0, it stops after one page
+// of at most maxResults results.
+func (bs *GCSBackupStorage) list(prefix, delimiter string, maxResults int) ([]string, []string, error) {
+	var prefixes, names []string
+	pageToken := ""
+	for {
+		u := bucketURL() + "/o?prefix=" + escape(prefix)
+		if delimiter != "" {
+			u += "&delimiter=" + escape(delimiter)
+		}
+		if maxResults != 0 {
+			u += fmt.Sprintf("&maxResults=%v", maxResults)
+		}
+		if pageToken != "" {
+			u += "&pageToken=" + escape(pageToken)
+		}
+		resp, err := bs.do("GET", u, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		result := listObjectsResult{}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode GCS list result: %v", err)
+		}
+		prefixes = append(prefixes, result.Prefixes...)
+		for _, item := range result.Items {
+			names = append(names, item.Name)
+		}
+		if result.NextPageToken == "" || maxResults != 0 {
+			break
+		}
+		pageToken = result.NextPageToken
+	}
+	sort.Strings(prefixes)
+	sort.Strings(names)
+	return prefixes, names, nil
+}
+
+// do sends an authenticated request. It returns an error if the
+// request doesn't succeed, or isn't an incomplete resumable upload.
+// The caller must close the body of the response.
+func (bs *GCSBackupStorage) do(method, u string, headers map[string]string, body []byte) (*http.Response, error) {
+	if *bucket == "" {
+		return nil, fmt.Errorf("gcs_backup_storage_bucket is not set")
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	token, err := bs.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if (resp.StatusCode < 200 || resp.StatusCode >= 300) && resp.StatusCode != statusResumeIncomplete {
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("GCS %v %v failed: %v %s", method, u, resp.Status, data)
+	}
+	return resp, nil
+}
+
+type tokenResult struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// accessToken returns the cached access token, or gets a new one from
+// the metadata server when it's about to expire.
+func (bs *GCSBackupStorage) accessToken() (string, error) {
+	if *tokenURL == "" {
+		return "", nil
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.token != "" && time.Now().Before(bs.tokenExpiry) {
+		return bs.token, nil
+	}
+
+	req, err := http.NewRequest("GET", *tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot get GCS access token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot get GCS access token: %v", resp.Status)
+	}
+	result := tokenResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("cannot decode GCS access token: %v", err)
+	}
+
+	// refresh the token a minute before it expires
+	bs.token = result.AccessToken
+	bs.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return bs.token, nil
+}
+
+func init() {
+	backupstorage.RegisterBackupStorage("gcs", &GCSBackupStorage{client: &http.Client{}})
+}
@@ -0,0 +1,227 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcsbackupstorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGCS is an in-memory Google Cloud Storage server, with just
+// what GCSBackupStorage uses, and a metadata server for the tokens.
+type fakeGCS struct {
+	t *testing.T
+
+	mu          sync.Mutex
+	objects     map[string][]byte
+	sessions    map[string]string
+	uploads     map[string][]byte
+	tokenServed int
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			f.t.Errorf("token request without Metadata-Flavor header")
+		}
+		f.tokenServed++
+		fmt.Fprintf(w, `{"access_token":"secret","expires_in":3600,"token_type":"Bearer"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		f.t.Errorf("request without token: %v %v", r.Method, r.URL)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/storage/v1/b/testbucket/o":
+		f.list(w, query.Get("prefix"), query.Get("delimiter"))
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/storage/v1/b/testbucket/o/"):
+		data, ok := f.objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/testbucket/o/")]
+		if !ok || query.Get("alt") != "media" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/storage/v1/b/testbucket/o/"):
+		delete(f.objects, strings.TrimPrefix(r.URL.Path, "/storage/v1/b/testbucket/o/"))
+	case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/testbucket/o" && query.Get("uploadType") == "media":
+		f.objects[query.Get("name")] = body
+	case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/testbucket/o" && query.Get("uploadType") == "resumable":
+		session := fmt.Sprintf("session%v", len(f.sessions)+1)
+		f.sessions[session] = query.Get("name")
+		w.Header().Set("Location", fmt.Sprintf("http://%v/session/%v", r.Host, session))
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/session/"):
+		session := strings.TrimPrefix(r.URL.Path, "/session/")
+		name, ok := f.sessions[session]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		var start, end int
+		var total string
+		contentRange := r.Header.Get("Content-Range")
+		if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+			if _, err := fmt.Sscanf(contentRange, "bytes */%s", &total); err != nil {
+				f.t.Errorf("bad Content-Range: %v", contentRange)
+			}
+		} else if start != len(f.uploads[session]) || end != start+len(body)-1 {
+			f.t.Errorf("bad Content-Range %v after %v bytes", contentRange, len(f.uploads[session]))
+		}
+		f.uploads[session] = append(f.uploads[session], body...)
+		if total == "*" {
+			w.WriteHeader(statusResumeIncomplete)
+			return
+		}
+		if total != fmt.Sprintf("%v", len(f.uploads[session])) {
+			f.t.Errorf("bad total size %v for %v bytes", total, len(f.uploads[session]))
+		}
+		f.objects[name] = f.uploads[session]
+		delete(f.sessions, session)
+		delete(f.uploads, session)
+	default:
+		f.t.Errorf("unexpected request: %v %v", r.Method, r.URL)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, prefix, delimiter string) {
+	result := listObjectsResult{}
+	prefixes := make(map[string]bool)
+	var names []string
+	for name := range f.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i != -1 {
+				prefixes[name[:len(prefix)+i+1]] = true
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for p := range prefixes {
+		result.Prefixes = append(result.Prefixes, p)
+	}
+	for _, name := range names {
+		result.Items = append(result.Items, struct {
+			Name string `json:"name"`
+		}{name})
+	}
+	json.NewEncoder(w).Encode(&result)
+}
+
+func TestGCSBackupStorage(t *testing.T) {
+	f := &fakeGCS{
+		t:        t,
+		objects:  make(map[string][]byte),
+		sessions: make(map[string]string),
+		uploads:  make(map[string][]byte),
+	}
+	server := httptest.NewServer(f)
+	defer server.Close()
+	*bucket = "testbucket"
+	*root = "backups"
+	*endpoint = server.URL
+	*tokenURL = server.URL + "/token"
+	*chunkSize = 10
+	bs := &GCSBackupStorage{client: &http.Client{}}
+
+	// no backup at first
+	bhs, err := bs.ListBackups("keyspace/shard")
+	if err != nil || len(bhs) != 0 {
+		t.Fatalf("ListBackups on empty storage returned wrong results: %v %v", bhs, err)
+	}
+
+	// write a small and two chunked files in two backups
+	contents := map[string]string{
+		"small": "0123",
+		"big":   "0123456789012345678901234",
+		"exact": "01234567890123456789",
+	}
+	for _, name := range []string{"backup2", "backup1"} {
+		bh, err := bs.StartBackup("keyspace/shard", name)
+		if err != nil {
+			t.Fatalf("StartBackup failed: %v", err)
+		}
+		for filename, data := range contents {
+			wc, err := bh.AddFile(filename)
+			if err != nil {
+				t.Fatalf("AddFile failed: %v", err)
+			}
+			for i := 0; i < len(data); i += 7 {
+				end := i + 7
+				if end > len(data) {
+					end = len(data)
+				}
+				if _, err := wc.Write([]byte(data[i:end])); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			if err := wc.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+		}
+		if err := bh.EndBackup(); err != nil {
+			t.Fatalf("EndBackup failed: %v", err)
+		}
+	}
+	if len(f.sessions) != 0 {
+		t.Errorf("resumable uploads not completed: %v", f.sessions)
+	}
+	if _, ok := f.objects["backups/keyspace/shard/backup1/big"]; !ok {
+		t.Errorf("object not stored with the right name: %v", f.objects)
+	}
+	if f.tokenServed != 1 {
+		t.Errorf("got %v access tokens, want 1", f.tokenServed)
+	}
+
+	// a backup with the same name can't be started
+	if _, err := bs.StartBackup("keyspace/shard", "backup1"); err == nil {
+		t.Errorf("StartBackup with an existing name didn't fail")
+	}
+
+	// list and read them back
+	bhs, err = bs.ListBackups("keyspace/shard")
+	if err != nil || len(bhs) != 2 || bhs[0].Name() != "backup1" || bhs[1].Name() != "backup2" || bhs[0].Bucket() != "keyspace/shard" {
+		t.Fatalf("ListBackups returned wrong results: %v %v", bhs, err)
+	}
+	for filename, want := range contents {
+		rc, err := bhs[0].ReadFile(filename)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(data) != want {
+			t.Errorf("ReadFile(%v) = %q, %v, want %q", filename, data, err, want)
+		}
+	}
+	if _, err := bhs[0].AddFile("other"); err == nil {
+		t.Errorf("AddFile on read-only backup didn't fail")
+	}
+
+	// remove one
+	if err := bs.RemoveBackup("keyspace/shard", "backup1"); err != nil {
+		t.Fatalf("RemoveBackup failed: %v", err)
+	}
+	bhs, err = bs.ListBackups("keyspace/shard")
+	if err != nil || len(bhs) != 1 || bhs[0].Name() != "backup2" {
+		t.Fatalf("ListBackups after RemoveBackup returned wrong results: %v %v", bhs, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gcsbackupstorage
+
+import (
+	"fmt"
+)
+
+// statusResumeIncomplete is returned by GCS for the chunks of a
+// resumable upload that are not the last one.
+const statusResumeIncomplete = 308
+
+// gcsWriter uploads an object as it is written. A small object is
+// sent with a single media upload on Close, a bigger one with a
+// resumable upload of gcs_backup_storage_chunk_size chunks.
+type gcsWriter struct {
+	bs   *GCSBackupStorage
+	name string
+
+	buf        []byte
+	sessionURL string
+	offset     int64
+	err        error
+}
+
+// Write is part of the io.Writer interface
+func (w *gcsWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) > *chunkSize {
+		// only send full chunks that are not the last one
+		if w.err = w.uploadChunk(w.buf[:*chunkSize], false); w.err != nil {
+			return 0, w.err
+		}
+		w.buf = append([]byte(nil), w.buf[*chunkSize:]...)
+	}
+	return len(p), nil
+}
+
+// Close is part of the io.Closer interface. It sends the rest of
+// the data, and completes the upload.
+func (w *gcsWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	// make sure a second Close doesn't upload again
+	w.err = fmt.Errorf("gcsWriter for %v is closed", w.name)
+
+	if w.sessionURL == "" {
+		u := fmt.Sprintf("%v/upload/storage/v1/b/%v/o?uploadType=media&name=%v", *endpoint, escape(*bucket), escape(w.name))
+		resp, err := w.bs.do("POST", u, map[string]string{"Content-Type": "application/octet-stream"}, w.buf)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return w.uploadChunk(w.buf, true)
+}
+
+// uploadChunk sends one chunk of a resumable upload, starting the
+// upload first if needed.
+func (w *gcsWriter) uploadChunk(data []byte, last bool) error {
+	if w.sessionURL == "" {
+		u := fmt.Sprintf("%v/upload/storage/v1/b/%v/o?uploadType=resumable&name=%v", *endpoint, escape(*bucket), escape(w.name))
+		resp, err := w.bs.do("POST", u, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		w.sessionURL = resp.Header.Get("Location")
+		if w.sessionURL == "" {
+			return fmt.Errorf("GCS resumable upload of %v has no session URL", w.name)
+		}
+	}
+
+	total := "*"
+	if last {
+		total = fmt.Sprintf("%v", w.offset+int64(len(data)))
+	}
+	contentRange := fmt.Sprintf("bytes %v-%v/%v", w.offset, w.offset+int64(len(data))-1, total)
+	if len(data) == 0 {
+		contentRange = fmt.Sprintf("bytes */%v", total)
+	}
+	resp, err := w.bs.do("PUT", w.sessionURL, map[string]string{"Content-Range": contentRange}, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if !last && resp.StatusCode != statusResumeIncomplete {
+		return fmt.Errorf("GCS resumable upload of %v ended early: %v", w.name, resp.Status)
+	}
+	if last && resp.StatusCode == statusResumeIncomplete {
+		return fmt.Errorf("GCS resumable upload of %v didn't complete", w.name)
+	}
+	w.offset += int64(len(data))
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"time"
+)
+
+// These methods deal with the replication heartbeat: the master
+// periodically writes its current time to the _vt.heartbeat table,
+// and the slaves compare the replicated value with their own time to
+// get their replication lag. Unlike Seconds_Behind_Master, it
+// accounts for the relay logs not being received yet, but it needs
+// the clocks to be synchronized.
+
+// WriteHeartbeat writes the heartbeat of the master with the given
+// tablet uid, at time now.
+func (mysqld *Mysqld) WriteHeartbeat(masterUid uint32, now time.Time) error {
+	return mysqld.ExecuteSuperQuery(fmt.Sprintf("INSERT INTO _vt.heartbeat (id, master_uid, time_created_ns) VALUES (1, %v, %v) ON DUPLICATE KEY UPDATE master_uid = VALUES(master_uid), time_created_ns = VALUES(time_created_ns)", masterUid, now.UnixNano()))
+}
+
+// ReadHeartbeat returns the last heartbeat that was replicated, with
+// the tablet uid of the master that wrote it.
+func (mysqld *Mysqld) ReadHeartbeat() (time.Time, uint32, error) {
+	qr, err := mysqld.fetchSuperQuery("SELECT master_uid, time_created_ns FROM _vt.heartbeat WHERE id = 1")
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if len(qr.Rows) != 1 {
+		return time.Time{}, 0, fmt.Errorf("no heartbeat")
+	}
+	masterUid, err := qr.Rows[0][0].ParseUint64()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	ns, err := qr.Rows[0][1].ParseUint64()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return time.Unix(0, int64(ns)), uint32(masterUid), nil
+}
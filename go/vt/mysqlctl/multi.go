@@ -0,0 +1,68 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/vt/concurrency"
+)
+
+// This file manages several mysqld instances on the same host. All
+// the directories and the socket of an instance are already derived
+// from its tablet uid, and its port is derived from it too.
+
+// MysqlPortForUid returns the port of the mysqld instance of a tablet,
+// when several instances share a host.
+func MysqlPortForUid(portBase int, uid uint32) (int, error) {
+	port := portBase + int(uid)
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid mysql port %v for tablet uid %v and port base %v", port, uid, portBase)
+	}
+	return port, nil
+}
+
+// NewMysqlds creates the Mysqld objects of the mysqld instances of the
+// given tablet uids. Each instance uses its own socket to connect, and
+// exports its stats with its uid in the name.
+// Close needs to be called on each result.
+func NewMysqlds(uids []uint32, portBase int, dba, repl *mysql.ConnectionParams) ([]*Mysqld, error) {
+	result := make([]*Mysqld, 0, len(uids))
+	for _, uid := range uids {
+		port, err := MysqlPortForUid(portBase, uid)
+		if err != nil {
+			for _, mysqld := range result {
+				mysqld.Close()
+			}
+			return nil, err
+		}
+		mycnf := NewMycnf(uid, port)
+		instanceDba := *dba
+		instanceDba.UnixSocket = mycnf.SocketFile
+		instanceRepl := *repl
+		result = append(result, NewMysqld(fmt.Sprintf("Dba%v", uid), mycnf, &instanceDba, &instanceRepl))
+	}
+	return result, nil
+}
+
+// ForAllMysqlds runs f on all the instances at the same time, and
+// returns all the errors.
+func ForAllMysqlds(mysqlds []*Mysqld, f func(*Mysqld) error) error {
+	wg := sync.WaitGroup{}
+	rec := concurrency.AllErrorRecorder{}
+	for _, mysqld := range mysqlds {
+		wg.Add(1)
+		go func(mysqld *Mysqld) {
+			defer wg.Done()
+			if err := f(mysqld); err != nil {
+				rec.RecordError(fmt.Errorf("mysqld %v: %v", mysqld.config.ServerId, err))
+			}
+		}(mysqld)
+	}
+	wg.Wait()
+	return rec.Error()
+}
@@ -0,0 +1,46 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+)
+
+func TestNewMysqlds(t *testing.T) {
+	if _, err := MysqlPortForUid(60000, 10000); err == nil {
+		t.Errorf("MysqlPortForUid with a port over 65535 didn't fail")
+	}
+
+	dba := dbconfigs.DefaultDBConfigs.Dba
+	repl := dbconfigs.DefaultDBConfigs.Repl
+	mysqlds, err := NewMysqlds([]uint32{101, 102}, 17000, &dba, &repl)
+	if err != nil {
+		t.Fatalf("NewMysqlds failed: %v", err)
+	}
+	for i, mysqld := range mysqlds {
+		defer mysqld.Close()
+		uid := uint32(101 + i)
+		if mysqld.config.ServerId != uid || mysqld.config.MysqlPort != 17000+int(uid) {
+			t.Errorf("instance %v has server id %v and port %v", i, mysqld.config.ServerId, mysqld.config.MysqlPort)
+		}
+		if mysqld.dba.UnixSocket != mysqld.config.SocketFile || !strings.Contains(mysqld.TabletDir, fmt.Sprintf("%010d", uid)) {
+			t.Errorf("instance %v uses socket %v and directory %v", i, mysqld.dba.UnixSocket, mysqld.TabletDir)
+		}
+	}
+
+	err = ForAllMysqlds(mysqlds, func(mysqld *Mysqld) error {
+		if mysqld.config.ServerId == 102 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "mysqld 102: failed") {
+		t.Errorf("ForAllMysqlds returned %v", err)
+	}
+}
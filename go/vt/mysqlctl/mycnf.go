@@ -88,6 +88,13 @@ type Mycnf struct {
 	// (unused by vt software for now)
 	SlaveLoadTmpDir string
 
+	// SslCa, SslCert and SslKey are the files mysqld uses to accept
+	// TLS connections, empty if it doesn't
+	// (unused by vt software for now)
+	SslCa   string
+	SslCert string
+	SslKey  string
+
 	mycnfMap map[string]string
 	path     string // the actual path that represents this mycnf
 }
@@ -173,5 +180,10 @@ func ReadMycnf(cnfFile string) (mycnf *Mycnf, err error) {
 	mycnf.MasterInfoFile = mycnf.lookupAndCheck("master-info-file")
 	mycnf.PidFile = mycnf.lookupAndCheck("pid-file")
 
+	// optional values
+	mycnf.SslCa = mycnf.mycnfMap["ssl-ca"]
+	mycnf.SslCert = mycnf.mycnfMap["ssl-cert"]
+	mycnf.SslKey = mycnf.mycnfMap["ssl-key"]
+
 	return mycnf, nil
 }
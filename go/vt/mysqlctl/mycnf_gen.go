@@ -8,14 +8,25 @@ package mysqlctl
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"path"
+	"strings"
 	"text/template"
 
 	"github.com/youtube/vitess/go/vt/env"
 )
 
+var (
+	mycnfTemplateOverrides = flag.String("mycnf_template_overrides", "", "comma separated list of my.cnf template files added last, their options replace the default ones")
+	mycnfIncludeDirs       = flag.String("mycnf_include_dirs", "", "comma separated list of directories the generated my.cnf includes with !includedir")
+
+	mysqlSslCa   = flag.String("mysql_ssl_ca", "", "CA file for the TLS connections to mysqld, in the generated my.cnf")
+	mysqlSslCert = flag.String("mysql_ssl_cert", "", "certificate file for the TLS connections to mysqld, in the generated my.cnf")
+	mysqlSslKey  = flag.String("mysql_ssl_key", "", "key file for the TLS connections to mysqld, in the generated my.cnf")
+)
+
 // This files handles the creation of Mycnf objects for the default 'vt'
 // file structure. These path are used by the mysqlctl commands.
 //
@@ -66,6 +77,9 @@ func NewMycnf(uid uint32, mysqlPort int) *Mycnf {
 	cnf.PidFile = path.Join(tabletDir, "mysql.pid")
 	cnf.TmpDir = path.Join(tabletDir, "tmp")
 	cnf.SlaveLoadTmpDir = cnf.TmpDir
+	cnf.SslCa = *mysqlSslCa
+	cnf.SslCert = *mysqlSslCert
+	cnf.SslKey = *mysqlSslKey
 	return cnf
 }
 
@@ -114,8 +128,19 @@ func (mycnf *Mycnf) makeMycnf(cnfFiles []string) (string, error) {
 		}
 		myTemplateSource.WriteString("## " + path + "\n")
 		myTemplateSource.Write(data)
+		myTemplateSource.WriteString("\n")
+	}
+	configData, err := mycnf.fillMycnfTemplate(myTemplateSource.String())
+	if err != nil {
+		return "", err
+	}
+	configData = mergeMycnf(configData)
+	if *mycnfIncludeDirs != "" {
+		for _, dir := range strings.Split(*mycnfIncludeDirs, ",") {
+			configData += "!includedir " + dir + "\n"
+		}
 	}
-	return mycnf.fillMycnfTemplate(myTemplateSource.String())
+	return configData, nil
 }
 
 // fillMycnfTemplate will fill in the passed in template with the values
@@ -132,3 +157,97 @@ func (mycnf *Mycnf) fillMycnfTemplate(tmplSrc string) (string, error) {
 	}
 	return mycnfData.String(), nil
 }
+
+// repeatableOptions can be set more than once, each value adds up.
+var repeatableOptions = map[string]bool{
+	"binlog-do-db":                true,
+	"binlog-ignore-db":            true,
+	"plugin-load-add":             true,
+	"replicate-do-db":             true,
+	"replicate-ignore-db":         true,
+	"replicate-do-table":          true,
+	"replicate-ignore-table":      true,
+	"replicate-wild-do-table":     true,
+	"replicate-wild-ignore-table": true,
+}
+
+// parseMycnfLine returns the section of a section header line, or the
+// key and value of an option line.
+func parseMycnfLine(line string) (section, key, value string) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == ';' || line[0] == '!' {
+		return "", "", ""
+	}
+	if line[0] == '[' {
+		return strings.Trim(line, "[]"), "", ""
+	}
+	parts := strings.SplitN(line, "=", 2)
+	key = normKey([]byte(parts[0]))
+	if len(parts) == 2 {
+		value = strings.TrimSpace(parts[1])
+	}
+	return "", key, value
+}
+
+// mergeMycnf only keeps the last value of the options that are set
+// more than once in a section, so the options of the template
+// overrides replace the default ones.
+func mergeMycnf(configData string) string {
+	lines := strings.Split(configData, "\n")
+	last := make(map[string]int)
+	section := ""
+	for i, line := range lines {
+		s, key, _ := parseMycnfLine(line)
+		switch {
+		case s != "":
+			section = s
+		case key != "" && !repeatableOptions[key]:
+			last[section+"/"+key] = i
+		}
+	}
+
+	result := make([]string, 0, len(lines))
+	section = ""
+	for i, line := range lines {
+		s, key, _ := parseMycnfLine(line)
+		if s != "" {
+			section = s
+		}
+		if key != "" && !repeatableOptions[key] && last[section+"/"+key] != i {
+			continue
+		}
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
+
+// parseMycnfOptions returns the options of each section of a my.cnf.
+func parseMycnfOptions(configData string) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	section := ""
+	for _, line := range strings.Split(configData, "\n") {
+		s, key, value := parseMycnfLine(line)
+		switch {
+		case s != "":
+			section = s
+		case key != "":
+			if result[section] == nil {
+				result[section] = make(map[string]string)
+			}
+			result[section][key] = value
+		}
+	}
+	return result
+}
+
+// includeDirs returns the directories a my.cnf includes.
+func includeDirs(configData string) []string {
+	var result []string
+	for _, line := range strings.Split(configData, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "!includedir") {
+			result = append(result, strings.TrimSpace(strings.TrimPrefix(line, "!includedir")))
+		}
+	}
+	return result
+}
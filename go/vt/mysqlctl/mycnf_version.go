@@ -0,0 +1,160 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	vtenv "github.com/youtube/vitess/go/vt/env"
+)
+
+// This file detects the version of mysqld, to adjust the defaults of
+// the generated my.cnf, and validates the result before mysqld starts.
+
+var mysqlVersion = flag.String("mysql_version", "", "version of mysqld, like 5.6.19 or 10.0.13-MariaDB (empty to run 'mysqld --version')")
+
+// MysqlVersion is the version of a mysqld binary.
+type MysqlVersion struct {
+	MariaDB bool
+	Major   int
+	Minor   int
+	Patch   int
+}
+
+func (v MysqlVersion) String() string {
+	result := fmt.Sprintf("%v.%v.%v", v.Major, v.Minor, v.Patch)
+	if v.MariaDB {
+		result += "-MariaDB"
+	}
+	return result
+}
+
+// atLeast returns true if the version is major.minor or later.
+func (v MysqlVersion) atLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// hasGTIDMode returns true if the version supports gtid_mode.
+func (v MysqlVersion) hasGTIDMode() bool {
+	return !v.MariaDB && v.atLeast(5, 6)
+}
+
+// hasBinlogChecksum returns true if the version supports binlog_checksum.
+func (v MysqlVersion) hasBinlogChecksum() bool {
+	return v.atLeast(5, 6) || (v.MariaDB && v.atLeast(5, 3))
+}
+
+// cnfFiles returns the template files with the defaults for the
+// version, relative to the vitess root.
+func (v MysqlVersion) cnfFiles() []string {
+	switch {
+	case v.MariaDB && v.atLeast(10, 0):
+		return []string{"config/mycnf/mariadb.cnf"}
+	case !v.MariaDB && v.atLeast(5, 6):
+		return []string{"config/mycnf/mysql56.cnf"}
+	}
+	return nil
+}
+
+var mysqlVersionRegexp = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)(\S*)`)
+
+// ParseMysqlVersion parses a version, or the output of
+// 'mysqld --version', like:
+//   mysqld  Ver 5.6.19-log for Linux on x86_64 (MySQL Community Server (GPL))
+//   mysqld  Ver 10.0.13-MariaDB-log for Linux on x86_64 (MariaDB Server)
+func ParseMysqlVersion(s string) (MysqlVersion, error) {
+	m := mysqlVersionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return MysqlVersion{}, fmt.Errorf("cannot find the mysqld version in: %v", s)
+	}
+	v := MysqlVersion{
+		MariaDB: strings.Contains(m[4], "MariaDB"),
+	}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// detectMysqlVersion returns the mysql_version flag if set, or the
+// version of the mysqld binary.
+func detectMysqlVersion() (MysqlVersion, error) {
+	if *mysqlVersion != "" {
+		return ParseMysqlVersion(*mysqlVersion)
+	}
+
+	dir, err := vtenv.VtMysqlRoot()
+	if err != nil {
+		return MysqlVersion{}, err
+	}
+	for _, name := range []string{"sbin/mysqld", "libexec/mysqld", "bin/mysqld"} {
+		name = path.Join(dir, name)
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		cmd := exec.Command(name, "--version")
+		cmd.Env = []string{"LD_LIBRARY_PATH=" + path.Join(dir, "lib/mysql")}
+		output, err := cmd.Output()
+		if err != nil {
+			return MysqlVersion{}, fmt.Errorf("%v --version failed: %v", name, err)
+		}
+		v, err := ParseMysqlVersion(string(output))
+		if err != nil {
+			return MysqlVersion{}, err
+		}
+		log.Infof("Detected mysqld version %v", v)
+		return v, nil
+	}
+	return MysqlVersion{}, fmt.Errorf("cannot find mysqld in %v", dir)
+}
+
+// validateMycnf checks the generated my.cnf has everything vitess
+// needs, and only options the version of mysqld supports.
+func validateMycnf(configData string, v MysqlVersion) error {
+	options := parseMycnfOptions(configData)["mysqld"]
+	if options == nil {
+		return fmt.Errorf("my.cnf has no [mysqld] section")
+	}
+
+	// the options ReadMycnf needs
+	for _, key := range []string{"server-id", "port", "datadir", "innodb-data-home-dir", "innodb-log-group-home-dir", "socket", "log-error", "slow-query-log-file", "relay-log", "relay-log-index", "relay-log-info-file", "log-bin", "master-info-file", "pid-file"} {
+		if options[key] == "" {
+			return fmt.Errorf("my.cnf has no value for %v", key)
+		}
+	}
+
+	if gtidMode, ok := options["gtid-mode"]; ok {
+		if !v.hasGTIDMode() {
+			return fmt.Errorf("my.cnf sets gtid_mode, which mysqld %v doesn't support", v)
+		}
+		if strings.ToUpper(gtidMode) == "ON" {
+			for _, key := range []string{"log-slave-updates", "enforce-gtid-consistency"} {
+				if _, ok := options[key]; !ok {
+					return fmt.Errorf("my.cnf sets gtid_mode = ON without %v", key)
+				}
+			}
+		}
+	}
+	for _, key := range []string{"binlog-checksum", "master-verify-checksum"} {
+		if _, ok := options[key]; ok && !v.hasBinlogChecksum() {
+			return fmt.Errorf("my.cnf sets %v, which mysqld %v doesn't support", key, v)
+		}
+	}
+
+	for _, dir := range includeDirs(configData) {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("my.cnf includes %v, which is not a directory", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMysqlVersion(t *testing.T) {
+	cases := map[string]MysqlVersion{
+		"mysqld  Ver 5.6.19-log for Linux on x86_64 (MySQL Community Server (GPL))": MysqlVersion{Major: 5, Minor: 6, Patch: 19},
+		"mysqld  Ver 10.0.13-MariaDB-log for Linux on x86_64 (MariaDB Server)":      MysqlVersion{MariaDB: true, Major: 10, Minor: 0, Patch: 13},
+		"5.1.63-google": MysqlVersion{Major: 5, Minor: 1, Patch: 63},
+	}
+	for input, want := range cases {
+		if got, err := ParseMysqlVersion(input); err != nil || got != want {
+			t.Errorf("ParseMysqlVersion(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseMysqlVersion("mysqld: unknown"); err == nil {
+		t.Errorf("ParseMysqlVersion with no version didn't fail")
+	}
+}
+
+func TestMergeMycnf(t *testing.T) {
+	input := `[mysqld]
+## default.cnf
+innodb_buffer_pool_size = 64M
+read-only
+replicate-ignore-db = a
+## overrides.cnf
+innodb-buffer-pool-size = 1G
+replicate-ignore-db = b
+[client]
+innodb_buffer_pool_size = 2M`
+	want := `[mysqld]
+## default.cnf
+read-only
+replicate-ignore-db = a
+## overrides.cnf
+innodb-buffer-pool-size = 1G
+replicate-ignore-db = b
+[client]
+innodb_buffer_pool_size = 2M`
+	if got := mergeMycnf(input); got != want {
+		t.Errorf("mergeMycnf() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateMycnf(t *testing.T) {
+	required := `[mysqld]
+server-id = 1
+port = 3306
+datadir = /vt/data
+innodb_data_home_dir = /vt/innodb/data
+innodb_log_group_home_dir = /vt/innodb/logs
+socket = /vt/mysql.sock
+log-error = /vt/error.log
+slow-query-log-file = /vt/slow-query.log
+relay-log = /vt/relay-logs/relay-bin
+relay-log-index = /vt/relay-logs/relay-bin.index
+relay-log-info-file = /vt/relay-logs/relay-log.info
+log-bin = /vt/bin-logs/bin
+master-info-file = /vt/master.info
+pid-file = /vt/mysql.pid
+log-slave-updates
+`
+	mysql55 := MysqlVersion{Major: 5, Minor: 5, Patch: 40}
+	mysql56 := MysqlVersion{Major: 5, Minor: 6, Patch: 19}
+	mariadb := MysqlVersion{MariaDB: true, Major: 10, Minor: 0, Patch: 13}
+	cases := []struct {
+		configData string
+		version    MysqlVersion
+		err        string
+	}{
+		{required, mysql55, ""},
+		{strings.Replace(required, "log-bin", "#log-bin", 1), mysql55, "no value for log-bin"},
+		{required + "gtid_mode = ON\nenforce-gtid-consistency\n", mysql56, ""},
+		{required + "gtid_mode = ON\n", mysql56, "without enforce-gtid-consistency"},
+		{required + "gtid_mode = ON\nenforce-gtid-consistency\n", mariadb, "doesn't support"},
+		{required + "binlog_checksum = CRC32\n", mariadb, ""},
+		{required + "binlog_checksum = CRC32\n", mysql55, "doesn't support"},
+		{required + "!includedir /nonexistent\n", mysql55, "not a directory"},
+	}
+	for _, c := range cases {
+		err := validateMycnf(c.configData, c.version)
+		if (c.err == "" && err != nil) || (c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err))) {
+			t.Errorf("validateMycnf(%v) with %v = %v, want %q", c.configData, c.version, err, c.err)
+		}
+	}
+}
@@ -6,6 +6,9 @@ package mysqlctl
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 // MysqlDaemon is the interface we use for abstracting Mysqld.
@@ -16,6 +19,15 @@ type MysqlDaemon interface {
 
 	// GetMysqlPort returns the current port mysql is listening on.
 	GetMysqlPort() (int, error)
+
+	// reparenting related methods
+	DemoteMaster() (*proto.ReplicationPosition, error)
+	PromoteSlave(waitPosition proto.GTID, waitTimeout time.Duration, hookExtraEnv map[string]string) (*proto.ReplicationPosition, error)
+	SetMaster(replicationState *proto.ReplicationState, waitPosition proto.GTID, waitTimeout time.Duration) error
+
+	// SetSemiSyncEnabled enables or disables the master and slave
+	// sides of semi-sync replication.
+	SetSemiSyncEnabled(master, slave bool) error
 }
 
 // FakeMysqlDaemon implements MysqlDaemon and allows the user to fake
@@ -27,6 +39,26 @@ type FakeMysqlDaemon struct {
 
 	// will be returned by GetMysqlPort(). Set to -1 to return an error.
 	MysqlPort int
+
+	// CurrentMasterPosition is returned by DemoteMaster and
+	// PromoteSlave.
+	CurrentMasterPosition proto.ReplicationPosition
+
+	// ReadOnly is set by DemoteMaster and cleared by PromoteSlave.
+	ReadOnly bool
+
+	// ReparentError, if set, is returned by DemoteMaster,
+	// PromoteSlave and SetMaster, which then don't change anything.
+	ReparentError error
+
+	// SemiSyncMasterEnabled and SemiSyncSlaveEnabled are set by
+	// SetSemiSyncEnabled.
+	SemiSyncMasterEnabled bool
+	SemiSyncSlaveEnabled  bool
+
+	// SemiSyncError, if set, is returned by SetSemiSyncEnabled, which
+	// then doesn't change anything, as when the plugins are missing.
+	SemiSyncError error
 }
 
 func (fmd *FakeMysqlDaemon) GetMasterAddr() (string, error) {
@@ -45,3 +77,39 @@ func (fmd *FakeMysqlDaemon) GetMysqlPort() (int, error) {
 	}
 	return fmd.MysqlPort, nil
 }
+
+func (fmd *FakeMysqlDaemon) DemoteMaster() (*proto.ReplicationPosition, error) {
+	if fmd.ReparentError != nil {
+		return nil, fmd.ReparentError
+	}
+	fmd.ReadOnly = true
+	rp := fmd.CurrentMasterPosition
+	return &rp, nil
+}
+
+func (fmd *FakeMysqlDaemon) PromoteSlave(waitPosition proto.GTID, waitTimeout time.Duration, hookExtraEnv map[string]string) (*proto.ReplicationPosition, error) {
+	if fmd.ReparentError != nil {
+		return nil, fmd.ReparentError
+	}
+	fmd.MasterAddr = ""
+	fmd.ReadOnly = false
+	rp := fmd.CurrentMasterPosition
+	return &rp, nil
+}
+
+func (fmd *FakeMysqlDaemon) SetMaster(replicationState *proto.ReplicationState, waitPosition proto.GTID, waitTimeout time.Duration) error {
+	if fmd.ReparentError != nil {
+		return fmd.ReparentError
+	}
+	fmd.MasterAddr = replicationState.MasterAddr()
+	return nil
+}
+
+func (fmd *FakeMysqlDaemon) SetSemiSyncEnabled(master, slave bool) error {
+	if fmd.SemiSyncError != nil {
+		return fmd.SemiSyncError
+	}
+	fmd.SemiSyncMasterEnabled = master
+	fmd.SemiSyncSlaveEnabled = slave
+	return nil
+}
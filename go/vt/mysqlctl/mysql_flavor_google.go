@@ -157,6 +157,12 @@ func (ev googleBinlogEvent) GTID(f blproto.BinlogFormat) (proto.GTID, error) {
 	return proto.GoogleGTID{GroupID: group_id}, nil
 }
 
+// StripChecksum implements BinlogEvent.StripChecksum().
+func (ev googleBinlogEvent) StripChecksum(f blproto.BinlogFormat) (blproto.BinlogEvent, []byte, error) {
+	stripped, checksum, err := ev.binlogEvent.stripChecksum(f)
+	return googleBinlogEvent{binlogEvent: stripped}, checksum, err
+}
+
 func init() {
 	mysqlFlavors[googleMysqlFlavorID] = &googleMysql51{}
 }
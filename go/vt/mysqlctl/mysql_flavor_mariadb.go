@@ -78,6 +78,10 @@ func (*mariaDB10) ParseGTID(s string) (proto.GTID, error) {
 func (*mariaDB10) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.GTID) error {
 	const COM_BINLOG_DUMP = 0x12
 
+	if err := conn.enableBinlogChecksum(); err != nil {
+		return fmt.Errorf("mariaDB10.SendBinlogDumpCommand: failed to enable binlog checksums: %v", err)
+	}
+
 	// MariaDB expects the slave to set the @slave_connect_state variable before
 	// issuing COM_BINLOG_DUMP if it wants to use GTID mode.
 	query := fmt.Sprintf("SET @slave_connect_state='%s'", startPos)
@@ -134,6 +138,12 @@ func (ev mariadbBinlogEvent) GTID(f blproto.BinlogFormat) (proto.GTID, error) {
 	}, nil
 }
 
+// StripChecksum implements BinlogEvent.StripChecksum().
+func (ev mariadbBinlogEvent) StripChecksum(f blproto.BinlogFormat) (blproto.BinlogEvent, []byte, error) {
+	stripped, checksum, err := ev.binlogEvent.stripChecksum(f)
+	return mariadbBinlogEvent{binlogEvent: stripped}, checksum, err
+}
+
 func init() {
 	mysqlFlavors[mariadbFlavorID] = &mariaDB10{}
 }
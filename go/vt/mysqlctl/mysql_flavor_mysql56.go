@@ -0,0 +1,172 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// mysql56 is the implementation of MysqlFlavor for MySQL 5.6,
+// with gtid_mode=ON. Its positions are GTID sets.
+type mysql56 struct {
+}
+
+const mysql56FlavorID = "MySQL56"
+
+// MasterStatus implements MysqlFlavor.MasterStatus
+//
+// The command looks like:
+// mysql> show master status\G
+// **************************** 1. row ***************************
+// File: vt-000001c6-bin.000003
+// Position: 106
+// Binlog_Do_DB:
+// Binlog_Ignore_DB:
+// Executed_Gtid_Set: 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5
+func (flavor *mysql56) MasterStatus(mysqld *Mysqld) (rp *proto.ReplicationPosition, err error) {
+	qr, err := mysqld.fetchSuperQuery("SHOW MASTER STATUS")
+	if err != nil {
+		return
+	}
+	if len(qr.Rows) != 1 {
+		return nil, ErrNotMaster
+	}
+	if len(qr.Rows[0]) < 5 {
+		return nil, fmt.Errorf("this db does not support GTID sets")
+	}
+	rp = &proto.ReplicationPosition{}
+	rp.MasterLogFile = qr.Rows[0][0].String()
+	utemp, err := qr.Rows[0][1].ParseUint64()
+	if err != nil {
+		return nil, err
+	}
+	rp.MasterLogPosition = uint(utemp)
+	rp.MasterLogGTIDField.Value, err = flavor.ParseGTID(qr.Rows[0][4].String())
+	if err != nil {
+		return nil, err
+	}
+
+	// On the master, the SQL position and IO position are at
+	// necessarily the same point.
+	rp.MasterLogFileIo = rp.MasterLogFile
+	rp.MasterLogPositionIo = rp.MasterLogPosition
+	return
+}
+
+// PromoteSlaveCommands implements MysqlFlavor.PromoteSlaveCommands
+func (*mysql56) PromoteSlaveCommands() []string {
+	return []string{
+		"RESET SLAVE",
+	}
+}
+
+// ParseGTID implements MysqlFlavor.ParseGTID().
+func (*mysql56) ParseGTID(s string) (proto.GTID, error) {
+	return proto.ParseGTID(mysql56FlavorID, s)
+}
+
+// SendBinlogDumpCommand implements MysqlFlavor.SendBinlogDumpCommand().
+func (*mysql56) SendBinlogDumpCommand(mysqld *Mysqld, conn *SlaveConnection, startPos proto.GTID) error {
+	const COM_BINLOG_DUMP_GTID = 0x1e
+
+	gtidSet, ok := startPos.(proto.Mysql56GTIDSet)
+	if !ok {
+		return fmt.Errorf("startPos isn't a MySQL 5.6 GTID set: %#v", startPos)
+	}
+
+	if err := conn.enableBinlogChecksum(); err != nil {
+		return fmt.Errorf("mysql56.SendBinlogDumpCommand: failed to enable binlog checksums: %v", err)
+	}
+
+	// Build the command.
+	buf := makeBinlogDumpGTIDCommand(0, conn.slaveID, gtidSet)
+	return conn.SendCommand(COM_BINLOG_DUMP_GTID, buf)
+}
+
+// makeBinlogDumpGTIDCommand builds the payload of a COM_BINLOG_DUMP_GTID
+// command, which starts the dump after the transactions of gtidSet.
+func makeBinlogDumpGTIDCommand(flags uint16, serverID uint32, gtidSet proto.Mysql56GTIDSet) []byte {
+	sidBlock := gtidSet.SIDBlock()
+	var buf bytes.Buffer
+	buf.Grow(2 + 4 + 4 + 8 + 4 + len(sidBlock))
+
+	// flags (2 bytes)
+	binary.Write(&buf, binary.LittleEndian, flags)
+	// server_id of slave (4 bytes)
+	binary.Write(&buf, binary.LittleEndian, serverID)
+	// binlog_name_info_size (4 bytes), with an empty binlog_name,
+	// since the GTID set selects the start position.
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	// binlog_pos (8 bytes), the first event after the header.
+	binary.Write(&buf, binary.LittleEndian, uint64(4))
+	// data_size (4 bytes) and data
+	binary.Write(&buf, binary.LittleEndian, uint32(len(sidBlock)))
+	buf.Write(sidBlock)
+
+	return buf.Bytes()
+}
+
+// MakeBinlogEvent implements MysqlFlavor.MakeBinlogEvent().
+func (*mysql56) MakeBinlogEvent(buf []byte) blproto.BinlogEvent {
+	return NewMysql56BinlogEvent(buf)
+}
+
+// mysql56BinlogEvent wraps a raw packet buffer and provides methods to examine
+// it by implementing blproto.BinlogEvent. Some methods are pulled in from
+// binlogEvent.
+type mysql56BinlogEvent struct {
+	binlogEvent
+}
+
+func NewMysql56BinlogEvent(buf []byte) blproto.BinlogEvent {
+	return mysql56BinlogEvent{binlogEvent: binlogEvent(buf)}
+}
+
+// HasGTID implements BinlogEvent.HasGTID().
+func (ev mysql56BinlogEvent) HasGTID(f blproto.BinlogFormat) bool {
+	// MySQL 5.6 provides GTIDs in a separate event type GTID_LOG_EVENT.
+	return ev.IsGTID()
+}
+
+// IsGTID implements BinlogEvent.IsGTID().
+func (ev mysql56BinlogEvent) IsGTID() bool {
+	return ev.Type() == 33
+}
+
+// GTID implements BinlogEvent.GTID().
+//
+// Expected format (L = total length of event data):
+//   # bytes   field
+//   1         flags
+//   16        SID (server UUID)
+//   8         GNO (sequence number, signed int)
+func (ev mysql56BinlogEvent) GTID(f blproto.BinlogFormat) (proto.GTID, error) {
+	data := ev.Bytes()[f.HeaderLength:]
+	if len(data) < 1+16+8 {
+		return nil, fmt.Errorf("MySQL 5.6 GTID event is too short: %v bytes", len(data))
+	}
+	var sid proto.SID
+	copy(sid[:], data[1:1+16])
+	gno := int64(binary.LittleEndian.Uint64(data[1+16 : 1+16+8]))
+	if gno < 1 {
+		return nil, fmt.Errorf("invalid MySQL 5.6 GNO %v", gno)
+	}
+	return proto.Mysql56GTID{Server: sid, Sequence: gno}, nil
+}
+
+// StripChecksum implements BinlogEvent.StripChecksum().
+func (ev mysql56BinlogEvent) StripChecksum(f blproto.BinlogFormat) (blproto.BinlogEvent, []byte, error) {
+	stripped, checksum, err := ev.binlogEvent.stripChecksum(f)
+	return mysql56BinlogEvent{binlogEvent: stripped}, checksum, err
+}
+
+func init() {
+	mysqlFlavors[mysql56FlavorID] = &mysql56{}
+}
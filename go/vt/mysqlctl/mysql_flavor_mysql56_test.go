@@ -0,0 +1,79 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"testing"
+
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	proto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// mysql56GTIDEvent is a GTID_LOG_EVENT for the transaction
+// 00010203-0405-0607-0809-0a0b0c0d0e0f:1234.
+var mysql56GTIDEvent = []byte{
+	// header: timestamp, type, server_id, length, next_pos, flags
+	0x58, 0x3f, 0x75, 0x53, 33, 1, 0, 0, 0, 44, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	// flags
+	0,
+	// SID
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	// GNO
+	0xd2, 0x04, 0, 0, 0, 0, 0, 0,
+}
+
+func TestMysql56BinlogEventGTID(t *testing.T) {
+	ev := (&mysql56{}).MakeBinlogEvent(mysql56GTIDEvent)
+	f := blproto.BinlogFormat{HeaderLength: 19}
+	if !ev.IsValid() || !ev.IsGTID() || !ev.HasGTID(f) {
+		t.Fatalf("%#v is not a valid GTID event", ev)
+	}
+	got, err := ev.GTID(f)
+	if err != nil {
+		t.Fatalf("GTID(): %v", err)
+	}
+	want := proto.MustParseGTID(mysql56FlavorID, "00010203-0405-0607-0809-0a0b0c0d0e0f:1234")
+	if c, err := want.TryCompare(got); err != nil || c != 0 {
+		t.Errorf("GTID() = %v, want %v", got, want)
+	}
+
+	// Other events don't have GTIDs.
+	buf := append([]byte(nil), mysql56GTIDEvent...)
+	buf[4] = 16 // XID_EVENT
+	if ev := NewMysql56BinlogEvent(buf); ev.IsGTID() || ev.HasGTID(f) {
+		t.Errorf("XID event has a GTID")
+	}
+	if _, err := NewMysql56BinlogEvent(mysql56GTIDEvent[:30]).GTID(f); err == nil {
+		t.Errorf("expected error for a truncated GTID event")
+	}
+}
+
+func TestMakeBinlogDumpGTIDCommand(t *testing.T) {
+	gtidSet := proto.MustParseGTID(mysql56FlavorID, "00010203-0405-0607-0809-0a0b0c0d0e0f:1-5").(proto.Mysql56GTIDSet)
+	want := []byte{
+		// flags
+		0, 0,
+		// server_id
+		7, 0, 0, 0,
+		// binlog_name_info_size
+		0, 0, 0, 0,
+		// binlog_pos
+		4, 0, 0, 0, 0, 0, 0, 0,
+		// data_size
+		48, 0, 0, 0,
+		// n_sids
+		1, 0, 0, 0, 0, 0, 0, 0,
+		// SID
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		// n_intervals, start, end
+		1, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0, 0, 0, 0, 0,
+		6, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if got := makeBinlogDumpGTIDCommand(0, 7, gtidSet); !bytes.Equal(got, want) {
+		t.Errorf("makeBinlogDumpGTIDCommand() = %v, want %v", got, want)
+	}
+}
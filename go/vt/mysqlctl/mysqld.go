@@ -245,7 +245,7 @@ func execCmd(name string, args, env []string, dir string) (cmd *exec.Cmd, err er
 
 // Init will create the default directory structure for the mysqld process,
 // generate / configure a my.cnf file, unpack a skeleton database,
-// and create some management tables.
+// create some management tables, and the users of mysql_users_file.
 func (mt *Mysqld) Init(mysqlWaitTime time.Duration) error {
 	log.Infof("mysqlctl.Init")
 	err := mt.createDirs()
@@ -259,6 +259,12 @@ func (mt *Mysqld) Init(mysqlWaitTime time.Duration) error {
 		return err
 	}
 
+	version, err := detectMysqlVersion()
+	if err != nil {
+		log.Errorf("%s", err.Error())
+		return err
+	}
+
 	hr := hook.NewSimpleHook("make_mycnf").Execute()
 
 	configData := ""
@@ -269,11 +275,20 @@ func (mt *Mysqld) Init(mysqlWaitTime time.Duration) error {
 			path.Join(root, "config/mycnf/master.cnf"),
 			path.Join(root, "config/mycnf/replica.cnf"),
 		}
+		for _, cnf := range version.cnfFiles() {
+			cnfTemplatePaths = append(cnfTemplatePaths, path.Join(root, cnf))
+		}
+		if mt.config.SslCa != "" || mt.config.SslCert != "" || mt.config.SslKey != "" {
+			cnfTemplatePaths = append(cnfTemplatePaths, path.Join(root, "config/mycnf/ssl.cnf"))
+		}
 
 		if extraCnf := os.Getenv("EXTRA_MY_CNF"); extraCnf != "" {
 			parts := strings.Split(extraCnf, ":")
 			cnfTemplatePaths = append(cnfTemplatePaths, parts...)
 		}
+		if *mycnfTemplateOverrides != "" {
+			cnfTemplatePaths = append(cnfTemplatePaths, strings.Split(*mycnfTemplateOverrides, ",")...)
+		}
 
 		configData, err = mt.config.makeMycnf(cnfTemplatePaths)
 	} else if hr.ExitStatus == hook.HOOK_SUCCESS {
@@ -282,6 +297,9 @@ func (mt *Mysqld) Init(mysqlWaitTime time.Duration) error {
 		err = fmt.Errorf("make_mycnf hook failed(%v): %v", hr.ExitStatus, hr.Stderr)
 	}
 
+	if err == nil {
+		err = validateMycnf(configData, version)
+	}
 	if err == nil {
 		err = ioutil.WriteFile(mt.config.path, []byte(configData), 0664)
 	}
@@ -302,23 +320,10 @@ func (mt *Mysqld) Init(mysqlWaitTime time.Duration) error {
 		log.Errorf("failed starting, check %v", mt.config.ErrorLogPath)
 		return err
 	}
-	schemaPath := path.Join(root, "data/bootstrap/_vt_schema.sql")
-	schema, err := ioutil.ReadFile(schemaPath)
-	if err != nil {
+	if err := mt.migrateSidecarDB(); err != nil {
 		return err
 	}
-
-	sqlCmds := make([]string, 0, 10)
-	log.Infof("initial schema: %v", string(schema))
-	for _, cmd := range strings.Split(string(schema), ";") {
-		cmd = strings.TrimSpace(cmd)
-		if cmd == "" {
-			continue
-		}
-		sqlCmds = append(sqlCmds, cmd)
-	}
-
-	return mt.ExecuteSuperQueryList(sqlCmds)
+	return mt.applyUsersFile()
 }
 
 func (mt *Mysqld) createDirs() error {
@@ -0,0 +1,280 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// These methods run an online schema change of a table, in the style
+// of pt-online-schema-change: the ALTER is applied to an empty ghost
+// table, triggers on the original table apply the changes to the
+// ghost table as they happen, the existing rows are copied in chunks
+// of primary key, and the tables are swapped with an atomic RENAME.
+//
+// Triggers are used rather than reading the changes from the binlogs,
+// as the binlogs are statement based, and don't have the values of
+// the modified rows.
+
+// OnlineSchemaChange describes an online schema change of a table.
+type OnlineSchemaChange struct {
+	DbName string
+	Table  string
+	Alter  string
+
+	// Columns are the columns of the table that are kept by the
+	// change, and copied to the ghost table.
+	Columns []string
+
+	// PrimaryKey are the primary key columns of the table, used
+	// to copy the rows in chunks. They have to be kept by the
+	// change.
+	PrimaryKey []string
+}
+
+// GhostTable returns the name of the table the change is applied to.
+func (osc *OnlineSchemaChange) GhostTable() string {
+	return "_" + osc.Table + "_gho"
+}
+
+// OldTable returns the name of the original table after the cut-over.
+func (osc *OnlineSchemaChange) OldTable() string {
+	return "_" + osc.Table + "_old"
+}
+
+func (osc *OnlineSchemaChange) triggerName(event string) string {
+	return "_" + osc.Table + "_" + event
+}
+
+func (osc *OnlineSchemaChange) qualified(table string) string {
+	return quoteIdentifier(osc.DbName) + "." + quoteIdentifier(table)
+}
+
+// quoteIdentifier quotes a database, table or column name, doubling
+// the backticks it contains.
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// columnList returns the columns, quoted and separated by commas,
+// each prefixed by prefix (like "NEW.").
+func columnList(prefix string, columns []string) string {
+	result := make([]string, len(columns))
+	for i, column := range columns {
+		result[i] = prefix + quoteIdentifier(column)
+	}
+	return strings.Join(result, ", ")
+}
+
+// rowTuple returns the SQL tuple of values.
+func rowTuple(values []sqltypes.Value) string {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		v.EncodeSql(buf)
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// triggerStatements returns the statements that create the triggers
+// applying the changes of the original table to the ghost table.
+func (osc *OnlineSchemaChange) triggerStatements() []string {
+	table := osc.qualified(osc.Table)
+	ghost := osc.qualified(osc.GhostTable())
+	columns := columnList("", osc.Columns)
+	newValues := columnList("NEW.", osc.Columns)
+	pk := "(" + columnList("", osc.PrimaryKey) + ")"
+	oldPK := "(" + columnList("OLD.", osc.PrimaryKey) + ")"
+
+	replace := fmt.Sprintf("REPLACE INTO %v (%v) VALUES (%v)", ghost, columns, newValues)
+	del := fmt.Sprintf("DELETE IGNORE FROM %v WHERE %v = %v", ghost, pk, oldPK)
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER %v AFTER INSERT ON %v FOR EACH ROW %v", osc.qualified(osc.triggerName("ins")), table, replace),
+		fmt.Sprintf("CREATE TRIGGER %v AFTER UPDATE ON %v FOR EACH ROW BEGIN %v; %v; END", osc.qualified(osc.triggerName("upd")), table, del, replace),
+		fmt.Sprintf("CREATE TRIGGER %v AFTER DELETE ON %v FOR EACH ROW %v", osc.qualified(osc.triggerName("del")), table, del),
+	}
+}
+
+// dropTriggerStatements returns the statements that drop the triggers.
+func (osc *OnlineSchemaChange) dropTriggerStatements() []string {
+	result := make([]string, 0, 3)
+	for _, event := range []string{"ins", "upd", "del"} {
+		result = append(result, fmt.Sprintf("DROP TRIGGER IF EXISTS %v", osc.qualified(osc.triggerName(event))))
+	}
+	return result
+}
+
+// chunkEndQuery returns the query that finds the primary key of the
+// last row of the chunk of chunkSize rows after lastPK (nil for the
+// first chunk).
+func (osc *OnlineSchemaChange) chunkEndQuery(lastPK []sqltypes.Value, chunkSize int) string {
+	pk := columnList("", osc.PrimaryKey)
+	where := ""
+	if lastPK != nil {
+		where = fmt.Sprintf(" WHERE (%v) > %v", pk, rowTuple(lastPK))
+	}
+	return fmt.Sprintf("SELECT %v FROM %v FORCE INDEX (PRIMARY)%v ORDER BY %v LIMIT 1 OFFSET %v", pk, osc.qualified(osc.Table), where, pk, chunkSize-1)
+}
+
+// copyChunkQuery returns the query that copies the rows after lastPK
+// (nil for the first chunk) up to endPK included (nil for the last
+// chunk) to the ghost table. The rows that were already written by
+// the triggers are newer, and kept.
+func (osc *OnlineSchemaChange) copyChunkQuery(lastPK, endPK []sqltypes.Value) string {
+	pk := columnList("", osc.PrimaryKey)
+	conditions := make([]string, 0, 2)
+	if lastPK != nil {
+		conditions = append(conditions, fmt.Sprintf("(%v) > %v", pk, rowTuple(lastPK)))
+	}
+	if endPK != nil {
+		conditions = append(conditions, fmt.Sprintf("(%v) <= %v", pk, rowTuple(endPK)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	columns := columnList("", osc.Columns)
+	return fmt.Sprintf("INSERT IGNORE INTO %v (%v) SELECT %v FROM %v FORCE INDEX (PRIMARY)%v LOCK IN SHARE MODE", osc.qualified(osc.GhostTable()), columns, columns, osc.qualified(osc.Table), where)
+}
+
+// cutOverStatement returns the statement that atomically swaps the
+// original and the ghost tables.
+func (osc *OnlineSchemaChange) cutOverStatement() string {
+	return fmt.Sprintf("RENAME TABLE %v TO %v, %v TO %v", osc.qualified(osc.Table), osc.qualified(osc.OldTable()), osc.qualified(osc.GhostTable()), osc.qualified(osc.Table))
+}
+
+// sharedColumns returns the columns of before that are still in after.
+func sharedColumns(before, after []string) []string {
+	afterMap := make(map[string]bool, len(after))
+	for _, column := range after {
+		afterMap[strings.ToLower(column)] = true
+	}
+	result := make([]string, 0, len(before))
+	for _, column := range before {
+		if afterMap[strings.ToLower(column)] {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// PrepareOnlineSchemaChange creates the ghost table of table in
+// dbName, applies alter (like "ADD COLUMN c INT") to it, and creates
+// the triggers. From then on, the changes to the table are applied to
+// the ghost table, and the rows can be copied with
+// CopyOnlineSchemaChangeChunk.
+func (mysqld *Mysqld) PrepareOnlineSchemaChange(dbName, table, alter string) (*OnlineSchemaChange, error) {
+	osc := &OnlineSchemaChange{
+		DbName: dbName,
+		Table:  table,
+		Alter:  alter,
+	}
+
+	var err error
+	osc.PrimaryKey, err = mysqld.GetPrimaryKeyColumns(dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(osc.PrimaryKey) == 0 {
+		return nil, fmt.Errorf("table %v has no primary key, cannot change it online", table)
+	}
+
+	ghost := osc.qualified(osc.GhostTable())
+	if err := mysqld.ExecuteSuperQueryList([]string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %v", ghost),
+		fmt.Sprintf("CREATE TABLE %v LIKE %v", ghost, osc.qualified(table)),
+		fmt.Sprintf("ALTER TABLE %v %v", ghost, alter),
+	}); err != nil {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, err
+	}
+
+	before, err := mysqld.GetColumns(dbName, table)
+	if err != nil {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, err
+	}
+	after, err := mysqld.GetColumns(dbName, osc.GhostTable())
+	if err != nil {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, err
+	}
+	osc.Columns = sharedColumns(before, after)
+	newPrimaryKey, err := mysqld.GetPrimaryKeyColumns(dbName, osc.GhostTable())
+	if err != nil {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, err
+	}
+	if strings.ToLower(strings.Join(newPrimaryKey, ",")) != strings.ToLower(strings.Join(osc.PrimaryKey, ",")) {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, fmt.Errorf("the primary key of %v cannot be changed online: %v != %v", table, newPrimaryKey, osc.PrimaryKey)
+	}
+
+	if err := mysqld.ExecuteSuperQueryList(osc.triggerStatements()); err != nil {
+		mysqld.CleanupOnlineSchemaChange(osc)
+		return nil, err
+	}
+	return osc, nil
+}
+
+// CopyOnlineSchemaChangeChunk copies the chunk of at most chunkSize
+// rows after lastPK (nil to start) to the ghost table. It returns the
+// primary key of the last row of the chunk, for the next call, or
+// nil if all the rows were copied, and the number of copied rows.
+func (mysqld *Mysqld) CopyOnlineSchemaChangeChunk(osc *OnlineSchemaChange, lastPK []sqltypes.Value, chunkSize int) ([]sqltypes.Value, int64, error) {
+	qr, err := mysqld.fetchSuperQuery(osc.chunkEndQuery(lastPK, chunkSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	var endPK []sqltypes.Value
+	if len(qr.Rows) == 1 {
+		endPK = qr.Rows[0]
+	}
+
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Recycle()
+	result, err := conn.ExecuteFetch(osc.copyChunkQuery(lastPK, endPK), 0, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return endPK, int64(result.RowsAffected), nil
+}
+
+// CutOverOnlineSchemaChange swaps the original and the ghost tables,
+// and drops the triggers and the original table.
+func (mysqld *Mysqld) CutOverOnlineSchemaChange(osc *OnlineSchemaChange) error {
+	if err := mysqld.ExecuteSuperQuery(osc.cutOverStatement()); err != nil {
+		return err
+	}
+
+	// the triggers were renamed with the original table, and
+	// nothing writes to it anymore
+	if err := mysqld.ExecuteSuperQueryList(append(osc.dropTriggerStatements(), fmt.Sprintf("DROP TABLE IF EXISTS %v", osc.qualified(osc.OldTable())))); err != nil {
+		return fmt.Errorf("the table was changed, but cannot clean up: %v", err)
+	}
+	return nil
+}
+
+// CleanupOnlineSchemaChange drops the triggers and the ghost table of
+// a change that was not cut over, leaving the original table as it is.
+func (mysqld *Mysqld) CleanupOnlineSchemaChange(osc *OnlineSchemaChange) error {
+	if err := mysqld.ExecuteSuperQueryList(append(osc.dropTriggerStatements(), fmt.Sprintf("DROP TABLE IF EXISTS %v", osc.qualified(osc.GhostTable())))); err != nil {
+		log.Warningf("cannot clean up online schema change of %v: %v", osc.Table, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestOnlineSchemaChangeQueries(t *testing.T) {
+	osc := &OnlineSchemaChange{
+		DbName:     "vt_db",
+		Table:      "t",
+		Columns:    []string{"id", "name"},
+		PrimaryKey: []string{"id"},
+	}
+
+	want := "SELECT `id` FROM `vt_db`.`t` FORCE INDEX (PRIMARY) ORDER BY `id` LIMIT 1 OFFSET 999"
+	if got := osc.chunkEndQuery(nil, 1000); got != want {
+		t.Errorf("chunkEndQuery(nil) = %v, want %v", got, want)
+	}
+	lastPK := []sqltypes.Value{sqltypes.MakeString([]byte("10"))}
+	want = "SELECT `id` FROM `vt_db`.`t` FORCE INDEX (PRIMARY) WHERE (`id`) > ('10') ORDER BY `id` LIMIT 1 OFFSET 999"
+	if got := osc.chunkEndQuery(lastPK, 1000); got != want {
+		t.Errorf("chunkEndQuery(10) = %v, want %v", got, want)
+	}
+
+	endPK := []sqltypes.Value{sqltypes.MakeString([]byte("20"))}
+	want = "INSERT IGNORE INTO `vt_db`.`_t_gho` (`id`, `name`) SELECT `id`, `name` FROM `vt_db`.`t` FORCE INDEX (PRIMARY) WHERE (`id`) > ('10') AND (`id`) <= ('20') LOCK IN SHARE MODE"
+	if got := osc.copyChunkQuery(lastPK, endPK); got != want {
+		t.Errorf("copyChunkQuery(10, 20) = %v, want %v", got, want)
+	}
+	want = "INSERT IGNORE INTO `vt_db`.`_t_gho` (`id`, `name`) SELECT `id`, `name` FROM `vt_db`.`t` FORCE INDEX (PRIMARY) LOCK IN SHARE MODE"
+	if got := osc.copyChunkQuery(nil, nil); got != want {
+		t.Errorf("copyChunkQuery(nil, nil) = %v, want %v", got, want)
+	}
+
+	wantTriggers := []string{
+		"CREATE TRIGGER `vt_db`.`_t_ins` AFTER INSERT ON `vt_db`.`t` FOR EACH ROW REPLACE INTO `vt_db`.`_t_gho` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`)",
+		"CREATE TRIGGER `vt_db`.`_t_upd` AFTER UPDATE ON `vt_db`.`t` FOR EACH ROW BEGIN DELETE IGNORE FROM `vt_db`.`_t_gho` WHERE (`id`) = (OLD.`id`); REPLACE INTO `vt_db`.`_t_gho` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`); END",
+		"CREATE TRIGGER `vt_db`.`_t_del` AFTER DELETE ON `vt_db`.`t` FOR EACH ROW DELETE IGNORE FROM `vt_db`.`_t_gho` WHERE (`id`) = (OLD.`id`)",
+	}
+	if got := osc.triggerStatements(); !reflect.DeepEqual(got, wantTriggers) {
+		t.Errorf("triggerStatements() = %v, want %v", got, wantTriggers)
+	}
+
+	want = "RENAME TABLE `vt_db`.`t` TO `vt_db`.`_t_old`, `vt_db`.`_t_gho` TO `vt_db`.`t`"
+	if got := osc.cutOverStatement(); got != want {
+		t.Errorf("cutOverStatement() = %v, want %v", got, want)
+	}
+}
+
+func TestOnlineSchemaChangeQuoting(t *testing.T) {
+	osc := &OnlineSchemaChange{
+		DbName:     "vt_db",
+		Table:      "a`b",
+		Columns:    []string{"id`"},
+		PrimaryKey: []string{"id`"},
+	}
+	want := "RENAME TABLE `vt_db`.`a``b` TO `vt_db`.`_a``b_old`, `vt_db`.`_a``b_gho` TO `vt_db`.`a``b`"
+	if got := osc.cutOverStatement(); got != want {
+		t.Errorf("cutOverStatement() = %v, want %v", got, want)
+	}
+	want = "SELECT `id``` FROM `vt_db`.`a``b` FORCE INDEX (PRIMARY) ORDER BY `id``` LIMIT 1 OFFSET 9"
+	if got := osc.chunkEndQuery(nil, 10); got != want {
+		t.Errorf("chunkEndQuery(nil) = %v, want %v", got, want)
+	}
+}
+
+func TestSharedColumns(t *testing.T) {
+	got := sharedColumns([]string{"id", "Name", "dropped"}, []string{"id", "name", "added"})
+	want := []string{"id", "Name"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sharedColumns() = %v, want %v", got, want)
+	}
+}
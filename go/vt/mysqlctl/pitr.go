@@ -0,0 +1,511 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/cgzip"
+	vtenv "github.com/youtube/vitess/go/vt/env"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// These methods deal with point-in-time recovery: the binlogs of a
+// master are saved to the BackupStorage next to its backups, and a
+// mysqld can be restored from a backup, then brought to a given time
+// or GTID by replaying the binlogs.
+
+const (
+	// binlogBucketSuffix is appended to the bucket of the backups
+	// to get the bucket of the binlog backups.
+	binlogBucketSuffix = ".binlogs"
+
+	// binlogFile is the name of the compressed binlog in a binlog
+	// backup, which is named after the binlog.
+	binlogFile = "binlog"
+)
+
+// BinlogManifest describes a binlog backup. It is written last, so
+// only complete binlog backups have one.
+type BinlogManifest struct {
+	// FileName is the name of the binlog file on the master.
+	FileName string
+}
+
+// RestorePoint is where a point-in-time recovery stops. At least one
+// of Time and GTID must be set.
+type RestorePoint struct {
+	// Time, if set, stops the recovery before the first binlog
+	// event at or after it.
+	Time time.Time
+
+	// GTID, if set, stops the recovery before the first
+	// transaction it doesn't include.
+	GTID proto.GTID
+}
+
+// binlogBucket returns the bucket of the binlog backups that go with
+// the backups of bucket.
+func binlogBucket(bucket string) string {
+	return bucket + binlogBucketSuffix
+}
+
+// BackupBinlogs saves the binlogs of mysqld to the BackupStorage, for
+// point-in-time recovery from the backups of the bucket. It rotates
+// the binlogs, and saves the closed ones that are not saved yet. It
+// should be run periodically on the master, as the backup positions
+// refer to its binlogs.
+func (mysqld *Mysqld) BackupBinlogs(bucket string) error {
+	if err := mysqld.ExecuteSuperQuery("FLUSH BINARY LOGS"); err != nil {
+		return err
+	}
+	qr, err := mysqld.fetchSuperQuery("SHOW BINARY LOGS")
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) == 0 {
+		return fmt.Errorf("no binlogs")
+	}
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	saved, err := listBinlogBackups(bs, bucket)
+	if err != nil {
+		return err
+	}
+
+	// the last binlog is the one mysqld writes to
+	dir := path.Dir(mysqld.config.BinLogPath)
+	for _, row := range qr.Rows[:len(qr.Rows)-1] {
+		name := row[0].String()
+		if _, ok := saved[name]; ok {
+			continue
+		}
+		log.Infof("BackupBinlogs: saving binlog %v", name)
+		if err := backupBinlog(bs, bucket, path.Join(dir, name)); err != nil {
+			return fmt.Errorf("cannot save binlog %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// listBinlogBackups returns the complete binlog backups of the
+// bucket, by name.
+func listBinlogBackups(bs backupstorage.BackupStorage, bucket string) (map[string]backupstorage.BackupHandle, error) {
+	bhs, err := bs.ListBackups(binlogBucket(bucket))
+	if err != nil {
+		return nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+	result := make(map[string]backupstorage.BackupHandle, len(bhs))
+	for _, bh := range bhs {
+		rc, err := bh.ReadFile(backupManifest)
+		if err != nil {
+			log.Warningf("Possibly incomplete binlog backup %v in bucket %v on BackupStorage: %v", bh.Name(), bucket, err)
+			continue
+		}
+		rc.Close()
+		result[bh.Name()] = bh
+	}
+	return result, nil
+}
+
+// backupBinlog saves one binlog file, compressed.
+func backupBinlog(bs backupstorage.BackupStorage, bucket, filename string) (err error) {
+	name := path.Base(filename)
+	bh, err := bs.StartBackup(binlogBucket(bucket), name)
+	if err != nil {
+		return fmt.Errorf("StartBackup failed: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			if abortErr := bh.AbortBackup(); abortErr != nil {
+				log.Errorf("failed to abort binlog backup: %v", abortErr)
+			}
+		}
+	}()
+
+	source, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// source -> gzip -> buffer -> backup file
+	wc, err := bh.AddFile(binlogFile)
+	if err != nil {
+		return fmt.Errorf("cannot add file: %v", err)
+	}
+	defer wc.Close()
+	dst := bufio.NewWriterSize(wc, 2*1024*1024)
+	gzip, err := cgzip.NewWriterLevel(dst, cgzip.Z_BEST_SPEED)
+	if err != nil {
+		return fmt.Errorf("cannot create gziper: %v", err)
+	}
+	if _, err := io.Copy(gzip, source); err != nil {
+		return fmt.Errorf("cannot copy data: %v", err)
+	}
+	if err := gzip.Close(); err != nil {
+		return fmt.Errorf("cannot close gzip: %v", err)
+	}
+	if err := dst.Flush(); err != nil {
+		return fmt.Errorf("cannot flush dst: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("cannot close %v: %v", binlogFile, err)
+	}
+
+	if err := writeBackupManifest(bh, &BinlogManifest{FileName: name}); err != nil {
+		return err
+	}
+	return bh.EndBackup()
+}
+
+// RestoreToPoint is the main entry point for point-in-time recovery.
+// It restores the latest backup of the bucket that precedes point,
+// then replays the binlogs from the position of the backup to point.
+// The binlogs are read from the mysqld at binlogSource (host:port)
+// if set, or from the binlog backups of the bucket otherwise. Either
+// way, they must be the binlogs the backup position refers to, i.e.
+// the ones of the master. Replication is not started, so mysqld
+// stays at point. The backup and the binlogs to replay are checked
+// before the files of mysqld are replaced.
+func (mysqld *Mysqld) RestoreToPoint(bucket string, restoreConcurrency int, hookExtraEnv map[string]string, point *RestorePoint, binlogSource string) error {
+	bh, bm, err := findRestoreBackup(bucket, point)
+	if err != nil {
+		return err
+	}
+
+	var binlogs []backupstorage.BackupHandle
+	rp, err := mysqld.restoreBackup(bh, bm, restoreConcurrency, hookExtraEnv, func(rp *proto.ReplicationPosition) error {
+		// the xtrabackup engine only knows the position now
+		if err := checkRestorePosition(bh.Name(), rp, point); err != nil {
+			return err
+		}
+		if binlogSource == "" {
+			binlogs, err = findBinlogsToReplay(bucket, rp.MasterLogFile)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	args := []string{fmt.Sprintf("--start-position=%v", rp.MasterLogPosition)}
+	if !point.Time.IsZero() {
+		// mysqlbinlog runs with TZ=UTC
+		args = append(args, "--stop-datetime="+point.Time.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if binlogSource != "" {
+		host, port, err := net.SplitHostPort(binlogSource)
+		if err != nil {
+			return err
+		}
+		args = append(args,
+			"--read-from-remote-server",
+			"--host="+host,
+			"--port="+port,
+			"--user="+mysqld.replParams.Uname,
+			"--to-last-log")
+		if mysqld.replParams.Pass != "" {
+			args = append(args, "--password="+mysqld.replParams.Pass)
+		}
+		args = append(args, rp.MasterLogFile)
+		log.Infof("RestoreToPoint: replaying binlogs from %v at %v:%v", binlogSource, rp.MasterLogFile, rp.MasterLogPosition)
+		return mysqld.replayBinlogs(args, point.GTID)
+	}
+
+	tmpDir, err := ioutil.TempDir(mysqld.TabletDir, "binlogs")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	files, err := restoreBinlogs(binlogs, tmpDir)
+	if err != nil {
+		return err
+	}
+	log.Infof("RestoreToPoint: replaying %v binlogs from the BackupStorage at %v:%v", len(files), rp.MasterLogFile, rp.MasterLogPosition)
+	return mysqld.replayBinlogs(append(args, files...), point.GTID)
+}
+
+// findRestoreBackup returns the latest complete backup of the bucket
+// that precedes point. The backups whose position is only known at
+// restore time, like the xtrabackup ones, are only checked against
+// the time of point.
+func findRestoreBackup(bucket string, point *RestorePoint) (backupstorage.BackupHandle, *BackupManifest, error) {
+	if point.Time.IsZero() && point.GTID == nil {
+		return nil, nil, fmt.Errorf("RestoreToPoint needs a time or a GTID to restore to")
+	}
+	return findBackup(bucket, func(bh backupstorage.BackupHandle, bm *BackupManifest) bool {
+		if !point.Time.IsZero() && (bm.Time.IsZero() || !bm.Time.Before(point.Time)) {
+			return false
+		}
+		if point.GTID == nil {
+			return true
+		}
+		included, err := proto.AtLeast(point.GTID, bm.ReplicationPosition.MasterLogGTIDField.Value)
+		if err != nil {
+			log.Warningf("Cannot compare position of backup %v to %v: %v", bh.Name(), point.GTID, err)
+			return false
+		}
+		return included
+	})
+}
+
+// checkRestorePosition checks that the position rp of the backup
+// named name precedes point, and that there are binlogs to replay
+// from it.
+func checkRestorePosition(name string, rp *proto.ReplicationPosition, point *RestorePoint) error {
+	if point.GTID != nil {
+		included, err := proto.AtLeast(point.GTID, rp.MasterLogGTIDField.Value)
+		if err != nil {
+			return err
+		}
+		if !included {
+			return fmt.Errorf("backup %v at position %v is past the restore point %v", name, rp.MasterLogGTIDField.Value, point.GTID)
+		}
+	}
+	if rp.MasterLogFile == "" {
+		return fmt.Errorf("backup %v has no binlog position to replay from", name)
+	}
+	return nil
+}
+
+// findBinlogsToReplay returns the saved binlogs of the bucket,
+// starting with first, in order.
+func findBinlogsToReplay(bucket, first string) ([]backupstorage.BackupHandle, error) {
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := listBinlogBackups(bs, bucket)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(saved))
+	for name := range saved {
+		names = append(names, name)
+	}
+	names, err = binlogsToReplay(names, first)
+	if err != nil {
+		return nil, err
+	}
+	bhs := make([]backupstorage.BackupHandle, len(names))
+	for i, name := range names {
+		bhs[i] = saved[name]
+	}
+	return bhs, nil
+}
+
+// restoreBinlogs copies the saved binlogs to dir. It returns their
+// paths, in order.
+func restoreBinlogs(bhs []backupstorage.BackupHandle, dir string) ([]string, error) {
+	files := make([]string, len(bhs))
+	for i, bh := range bhs {
+		files[i] = path.Join(dir, bh.Name())
+		if err := restoreBinlog(bh, files[i]); err != nil {
+			return nil, fmt.Errorf("cannot restore binlog %v: %v", bh.Name(), err)
+		}
+	}
+	return files, nil
+}
+
+// restoreBinlog uncompresses a saved binlog to filename.
+func restoreBinlog(bh backupstorage.BackupHandle, filename string) error {
+	rc, err := bh.ReadFile(binlogFile)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	gz, err := cgzip.NewReader(rc)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, gz); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// binlogsToReplay returns the binlog names, sorted, from first on. It
+// fails if first is missing, or if there is a gap in the sequence.
+func binlogsToReplay(names []string, first string) ([]string, error) {
+	base, seq, err := splitBinlogName(first)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := make(map[int]string)
+	for _, name := range names {
+		b, n, err := splitBinlogName(name)
+		if err != nil || b != base {
+			continue
+		}
+		byNumber[n] = name
+	}
+
+	var result []string
+	for n := seq; len(result) < len(byNumber); n++ {
+		name, ok := byNumber[n]
+		if !ok {
+			break
+		}
+		result = append(result, name)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("binlog %v is not in the BackupStorage", first)
+	}
+	for n := range byNumber {
+		if n >= seq+len(result) {
+			return nil, fmt.Errorf("binlogs are missing after %v in the BackupStorage", result[len(result)-1])
+		}
+	}
+	return result, nil
+}
+
+// splitBinlogName splits a binlog name like vt-bin.000003 in its base
+// name and sequence number.
+func splitBinlogName(name string) (string, int, error) {
+	i := strings.LastIndex(name, ".")
+	if i == -1 {
+		return "", 0, fmt.Errorf("invalid binlog name %v", name)
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid binlog name %v: %v", name, err)
+	}
+	return name[:i], n, nil
+}
+
+// replayBinlogs pipes the output of mysqlbinlog into mysql, stopping
+// before the first transaction not included in target, if set.
+func (mysqld *Mysqld) replayBinlogs(args []string, target proto.GTID) error {
+	dir, err := vtenv.VtMysqlRoot()
+	if err != nil {
+		return err
+	}
+	env := []string{
+		"LD_LIBRARY_PATH=" + path.Join(dir, "lib/mysql"),
+		"TZ=UTC",
+	}
+
+	mysqlbinlog := exec.Command(path.Join(dir, "bin/mysqlbinlog"), args...)
+	mysqlbinlog.Env = env
+	mysqlbinlogOutput := &bytes.Buffer{}
+	mysqlbinlog.Stderr = mysqlbinlogOutput
+	stdout, err := mysqlbinlog.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	mysql := exec.Command(path.Join(dir, "bin/mysql"), "-u", "vt_dba", "-S", mysqld.config.SocketFile)
+	mysql.Env = env
+	mysqlOutput := &bytes.Buffer{}
+	mysql.Stdout = mysqlOutput
+	mysql.Stderr = mysqlOutput
+	stdin, err := mysql.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := mysql.Start(); err != nil {
+		return err
+	}
+	if err := mysqlbinlog.Start(); err != nil {
+		stdin.Close()
+		mysql.Wait()
+		return err
+	}
+
+	stopped, filterErr := filterBinlogEvents(stdout, stdin, mysqld.flavor.ParseGTID, target)
+	stdin.Close()
+	if stopped || filterErr != nil {
+		mysqlbinlog.Process.Kill()
+	}
+	mysqlbinlogErr := mysqlbinlog.Wait()
+	mysqlErr := mysql.Wait()
+
+	if mysqlErr != nil {
+		return fmt.Errorf("mysql failed: %v, output: %s", mysqlErr, mysqlOutput.Bytes())
+	}
+	if filterErr != nil {
+		return filterErr
+	}
+	if mysqlbinlogErr != nil && !stopped {
+		return fmt.Errorf("mysqlbinlog failed: %v, output: %s", mysqlbinlogErr, mysqlbinlogOutput.Bytes())
+	}
+	return nil
+}
+
+// binlogGTIDRegexps find the GTID of the events in the output of
+// mysqlbinlog, for MariaDB, MySQL 5.6 and Google MySQL.
+var binlogGTIDRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`^#.*\sGTID (\d+-\d+-\d+)`),
+	regexp.MustCompile(`^SET @@SESSION.GTID_NEXT= '([^']+:\d+)'`),
+	regexp.MustCompile(`^#.*\sgroup_id ([0-9]+)`),
+}
+
+// filterBinlogEvents copies the output of mysqlbinlog from r to w,
+// until the first event of a transaction that is not included in
+// target. It returns true if it stopped there. A nil target copies
+// everything.
+func filterBinlogEvents(r io.Reader, w io.Writer, parseGTID func(string) (proto.GTID, error), target proto.GTID) (bool, error) {
+	br := bufio.NewReader(r)
+	for {
+		line, readErr := br.ReadString('\n')
+		if target != nil {
+			for _, re := range binlogGTIDRegexps {
+				m := re.FindStringSubmatch(line)
+				if m == nil {
+					continue
+				}
+				gtid, err := parseGTID(m[1])
+				if err != nil {
+					continue
+				}
+				included, err := proto.AtLeast(target, gtid)
+				if err != nil {
+					return false, err
+				}
+				if !included {
+					log.Infof("RestoreToPoint: stopping before transaction %v", gtid)
+					return true, nil
+				}
+				break
+			}
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return false, err
+		}
+		if readErr == io.EOF {
+			return false, nil
+		}
+		if readErr != nil {
+			return false, readErr
+		}
+	}
+}
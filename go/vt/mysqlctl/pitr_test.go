@@ -0,0 +1,233 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/filebackupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestBinlogsToReplay(t *testing.T) {
+	names := []string{"vt-bin.000004", "vt-bin.000002", "vt-bin.000003", "other.000003", "vt-bin.index"}
+	got, err := binlogsToReplay(names, "vt-bin.000003")
+	if want := []string{"vt-bin.000003", "vt-bin.000004"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("binlogsToReplay() = %v, %v, want %v", got, err, want)
+	}
+
+	if _, err := binlogsToReplay(names, "vt-bin.000001"); err == nil {
+		t.Errorf("binlogsToReplay with a missing first binlog didn't fail")
+	}
+	if _, err := binlogsToReplay([]string{"vt-bin.000002", "vt-bin.000004"}, "vt-bin.000002"); err == nil {
+		t.Errorf("binlogsToReplay with a gap didn't fail")
+	}
+	if _, err := binlogsToReplay(names, "vt-bin"); err == nil {
+		t.Errorf("binlogsToReplay with an invalid name didn't fail")
+	}
+}
+
+const mariadbBinlogOutput = `/*!40019 SET @@session.max_insert_delayed_threads=0*/;
+DELIMITER /*!*/;
+# at 1194
+#141231 12:00:00 server id 41983  end_log_pos 1232 	GTID 0-41983-5
+/*!100001 SET @@session.gtid_seq_no=5*//*!*/;
+BEGIN
+/*!*/;
+insert into t values (5)
+/*!*/;
+COMMIT/*!*/;
+# at 1400
+#141231 12:00:01 server id 41983  end_log_pos 1438 	GTID 0-41983-6
+/*!100001 SET @@session.gtid_seq_no=6*//*!*/;
+BEGIN
+/*!*/;
+insert into t values (6)
+/*!*/;
+COMMIT/*!*/;
+DELIMITER ;
+`
+
+func TestFilterBinlogEvents(t *testing.T) {
+	// no target copies everything
+	out := &bytes.Buffer{}
+	stopped, err := filterBinlogEvents(strings.NewReader(mariadbBinlogOutput), out, parseMariaGTID, nil)
+	if err != nil || stopped || out.String() != mariadbBinlogOutput {
+		t.Errorf("filterBinlogEvents without target returned wrong results: %v %v %q", stopped, err, out.String())
+	}
+
+	// stop after 0-41983-5
+	out.Reset()
+	stopped, err = filterBinlogEvents(strings.NewReader(mariadbBinlogOutput), out, parseMariaGTID, proto.MustParseGTID("MariaDB", "0-41983-5"))
+	if err != nil || !stopped {
+		t.Errorf("filterBinlogEvents didn't stop: %v %v", stopped, err)
+	}
+	want := mariadbBinlogOutput[:strings.Index(mariadbBinlogOutput, "#141231 12:00:01")]
+	if out.String() != want {
+		t.Errorf("filterBinlogEvents copied %q, want %q", out.String(), want)
+	}
+
+	// a target past the end copies everything
+	out.Reset()
+	stopped, err = filterBinlogEvents(strings.NewReader(mariadbBinlogOutput), out, parseMariaGTID, proto.MustParseGTID("MariaDB", "0-41983-10"))
+	if err != nil || stopped || out.String() != mariadbBinlogOutput {
+		t.Errorf("filterBinlogEvents with a later target returned wrong results: %v %v %q", stopped, err, out.String())
+	}
+}
+
+func TestBackupRestoreBinlogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "pitrtest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+	*filebackupstorage.FileBackupStorageRoot = path.Join(root, "backups")
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatalf("GetBackupStorage failed: %v", err)
+	}
+
+	// save two binlogs
+	if err := os.MkdirAll(path.Join(root, "binlogs"), os.ModePerm); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	for _, name := range []string{"vt-bin.000001", "vt-bin.000002"} {
+		filename := path.Join(root, "binlogs", name)
+		if err := ioutil.WriteFile(filename, []byte("contents of "+name), 0660); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := backupBinlog(bs, "keyspace/shard", filename); err != nil {
+			t.Fatalf("backupBinlog failed: %v", err)
+		}
+	}
+	saved, err := listBinlogBackups(bs, "keyspace/shard")
+	if err != nil || len(saved) != 2 {
+		t.Fatalf("listBinlogBackups returned wrong results: %v %v", saved, err)
+	}
+
+	// they don't show up as backups
+	if _, _, err := findBackup("keyspace/shard", nil); err != ErrNoBackup {
+		t.Errorf("findBackup returned %v, want ErrNoBackup", err)
+	}
+
+	// restore them
+	dest := path.Join(root, "dest")
+	if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	bhs, err := findBinlogsToReplay("keyspace/shard", "vt-bin.000002")
+	if err != nil || len(bhs) != 1 {
+		t.Fatalf("findBinlogsToReplay() = %v, %v, want 1 binlog", bhs, err)
+	}
+	if _, err := findBinlogsToReplay("keyspace/shard", "vt-bin.000003"); err == nil {
+		t.Errorf("findBinlogsToReplay with a missing first binlog didn't fail")
+	}
+	files, err := restoreBinlogs(bhs, dest)
+	if want := []string{path.Join(dest, "vt-bin.000002")}; err != nil || !reflect.DeepEqual(files, want) {
+		t.Fatalf("restoreBinlogs() = %v, %v, want %v", files, err, want)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil || string(data) != "contents of vt-bin.000002" {
+		t.Errorf("restored binlog has wrong contents: %q %v", data, err)
+	}
+}
+
+func TestFindRestoreBackup(t *testing.T) {
+	root, err := ioutil.TempDir("", "pitrtest")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+	*filebackupstorage.FileBackupStorageRoot = root
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatalf("GetBackupStorage failed: %v", err)
+	}
+
+	// two backups, at 0-41983-5 and 0-41983-10
+	start := time.Date(2014, 12, 31, 12, 0, 0, 0, time.UTC)
+	for i, seq := range []int{5, 10} {
+		bh, err := bs.StartBackup("keyspace/shard", fmt.Sprintf("backup%v", i))
+		if err != nil {
+			t.Fatalf("StartBackup failed: %v", err)
+		}
+		bm := &BackupManifest{
+			ReplicationPosition: proto.ReplicationPosition{
+				MasterLogFile:      "vt-bin.000001",
+				MasterLogGTIDField: proto.GTIDField{Value: proto.MustParseGTID("MariaDB", fmt.Sprintf("0-41983-%v", seq))},
+			},
+			Time: start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := writeBackupManifest(bh, bm); err != nil {
+			t.Fatalf("writeBackupManifest failed: %v", err)
+		}
+		if err := bh.EndBackup(); err != nil {
+			t.Fatalf("EndBackup failed: %v", err)
+		}
+	}
+
+	testcases := []struct {
+		desc  string
+		point *RestorePoint
+		want  string
+	}{
+		{"time only", &RestorePoint{Time: start.Add(30 * time.Minute)}, "backup0"},
+		{"later time only", &RestorePoint{Time: start.Add(2 * time.Hour)}, "backup1"},
+		{"GTID only", &RestorePoint{GTID: proto.MustParseGTID("MariaDB", "0-41983-7")}, "backup0"},
+		{"later GTID only", &RestorePoint{GTID: proto.MustParseGTID("MariaDB", "0-41983-12")}, "backup1"},
+		{"time and GTID", &RestorePoint{Time: start.Add(2 * time.Hour), GTID: proto.MustParseGTID("MariaDB", "0-41983-7")}, "backup0"},
+	}
+	for _, tc := range testcases {
+		bh, _, err := findRestoreBackup("keyspace/shard", tc.point)
+		if err != nil {
+			t.Errorf("findRestoreBackup(%v) failed: %v", tc.desc, err)
+			continue
+		}
+		if bh.Name() != tc.want {
+			t.Errorf("findRestoreBackup(%v) = %v, want %v", tc.desc, bh.Name(), tc.want)
+		}
+	}
+
+	// no backup precedes the point
+	for _, point := range []*RestorePoint{
+		{Time: start},
+		{GTID: proto.MustParseGTID("MariaDB", "0-41983-3")},
+	} {
+		if _, _, err := findRestoreBackup("keyspace/shard", point); err != ErrNoBackup {
+			t.Errorf("findRestoreBackup(%v) returned %v, want ErrNoBackup", point, err)
+		}
+	}
+	if _, _, err := findRestoreBackup("keyspace/shard", &RestorePoint{}); err == nil {
+		t.Errorf("findRestoreBackup without a time or a GTID didn't fail")
+	}
+}
+
+func TestCheckRestorePosition(t *testing.T) {
+	rp := &proto.ReplicationPosition{
+		MasterLogFile:      "vt-bin.000001",
+		MasterLogGTIDField: proto.GTIDField{Value: proto.MustParseGTID("MariaDB", "0-41983-10")},
+	}
+	if err := checkRestorePosition("backup", rp, &RestorePoint{Time: time.Now()}); err != nil {
+		t.Errorf("checkRestorePosition with a time only failed: %v", err)
+	}
+	if err := checkRestorePosition("backup", rp, &RestorePoint{GTID: proto.MustParseGTID("MariaDB", "0-41983-12")}); err != nil {
+		t.Errorf("checkRestorePosition with a later GTID failed: %v", err)
+	}
+	if err := checkRestorePosition("backup", rp, &RestorePoint{GTID: proto.MustParseGTID("MariaDB", "0-41983-7")}); err == nil {
+		t.Errorf("checkRestorePosition with an earlier GTID didn't fail")
+	}
+	if err := checkRestorePosition("backup", &proto.ReplicationPosition{}, &RestorePoint{Time: time.Now()}); err == nil {
+		t.Errorf("checkRestorePosition without a binlog position didn't fail")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+)
+
+var (
+	slowQueriesFound  = stats.NewInt("MysqlSlowQueriesFound")
+	mysqlQueryKills   = stats.NewInt("MysqlQueryKills")
+	mysqlKillFailures = stats.NewInt("MysqlKillFailures")
+)
+
+// Process is a running statement of information_schema.processlist.
+type Process struct {
+	Id      int64
+	User    string
+	Host    string
+	Db      string
+	Command string
+	Time    time.Duration
+	State   string
+	Info    string
+}
+
+// ProcessFilter selects the processes FindSlowQueries returns. The
+// empty fields don't filter. Idle connections, and the connection
+// running the query, are never returned.
+type ProcessFilter struct {
+	User    string
+	MinTime time.Duration
+	State   string
+}
+
+// Query returns the query that lists the processes matching the
+// filter, longest running first. It can be run remotely, the result
+// is parsed with ProcessesFromQueryResult.
+func (pf *ProcessFilter) Query() string {
+	conditions := []string{"command != 'Sleep'", "id != CONNECTION_ID()"}
+	if pf.User != "" {
+		conditions = append(conditions, "user = "+encodeString(pf.User))
+	}
+	if pf.MinTime > 0 {
+		conditions = append(conditions, fmt.Sprintf("time >= %v", int64(pf.MinTime.Seconds())))
+	}
+	if pf.State != "" {
+		conditions = append(conditions, "state = "+encodeString(pf.State))
+	}
+	return "SELECT id, user, host, db, command, time, state, info FROM information_schema.processlist WHERE " + strings.Join(conditions, " AND ") + " ORDER BY time DESC"
+}
+
+// ProcessesFromQueryResult parses the result of ProcessFilter.Query.
+func ProcessesFromQueryResult(qr *mproto.QueryResult) ([]Process, error) {
+	result := make([]Process, len(qr.Rows))
+	for i, row := range qr.Rows {
+		if len(row) != 8 {
+			return nil, fmt.Errorf("unexpected processlist row: %v", row)
+		}
+		id, err := row[0].ParseInt64()
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := row[5].ParseInt64()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = Process{
+			Id:      id,
+			User:    row[1].String(),
+			Host:    row[2].String(),
+			Db:      row[3].String(),
+			Command: row[4].String(),
+			Time:    time.Duration(seconds) * time.Second,
+			State:   row[6].String(),
+			Info:    row[7].String(),
+		}
+	}
+	return result, nil
+}
+
+// FindSlowQueries returns the processes matching filter, using conn.
+func FindSlowQueries(conn dbconnpool.PoolConnection, filter *ProcessFilter) ([]Process, error) {
+	qr, err := conn.ExecuteFetch(filter.Query(), 10000, false)
+	if err != nil {
+		return nil, err
+	}
+	processes, err := ProcessesFromQueryResult(qr)
+	if err != nil {
+		return nil, err
+	}
+	slowQueriesFound.Add(int64(len(processes)))
+	return processes, nil
+}
+
+// Fetcher executes the queries of KillQuery. It's implemented by
+// dbconnpool.PoolConnection, and can run the queries remotely.
+type Fetcher interface {
+	ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error)
+}
+
+// KillQuery kills the statement running on connection id using conn.
+// If connection is set, it kills the connection instead, which also
+// rolls back its transaction.
+func KillQuery(conn Fetcher, id int64, connection bool) error {
+	sql := fmt.Sprintf("KILL QUERY %d", id)
+	if connection {
+		sql = fmt.Sprintf("KILL %d", id)
+	}
+	if _, err := conn.ExecuteFetch(sql, 10000, false); err != nil {
+		mysqlKillFailures.Add(1)
+		return err
+	}
+	mysqlQueryKills.Add(1)
+	return nil
+}
+
+// FindSlowQueries returns the processes matching filter.
+func (mysqld *Mysqld) FindSlowQueries(filter *ProcessFilter) ([]Process, error) {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Recycle()
+	return FindSlowQueries(conn, filter)
+}
+
+// KillQuery kills the statement running on connection id, or the
+// connection itself if connection is set.
+func (mysqld *Mysqld) KillQuery(id int64, connection bool) error {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+	log.Infof("killing query %d", id)
+	return KillQuery(conn, id, connection)
+}
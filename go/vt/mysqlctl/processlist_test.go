@@ -0,0 +1,59 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestProcessFilterQuery(t *testing.T) {
+	filter := &ProcessFilter{}
+	want := "SELECT id, user, host, db, command, time, state, info FROM information_schema.processlist WHERE command != 'Sleep' AND id != CONNECTION_ID() ORDER BY time DESC"
+	if got := filter.Query(); got != want {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+
+	filter = &ProcessFilter{User: "vt_app", MinTime: 90 * time.Second, State: "Sending data"}
+	want = "SELECT id, user, host, db, command, time, state, info FROM information_schema.processlist WHERE command != 'Sleep' AND id != CONNECTION_ID() AND user = 'vt_app' AND time >= 90 AND state = 'Sending data' ORDER BY time DESC"
+	if got := filter.Query(); got != want {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
+
+func TestProcessesFromQueryResult(t *testing.T) {
+	s := func(v string) sqltypes.Value {
+		return sqltypes.MakeString([]byte(v))
+	}
+	n := func(v string) sqltypes.Value {
+		return sqltypes.MakeNumeric([]byte(v))
+	}
+	qr := &mproto.QueryResult{
+		Rows: [][]sqltypes.Value{
+			{n("12"), s("vt_app"), s("localhost"), s("vt_db"), s("Query"), n("42"), s("Sending data"), s("select * from t")},
+		},
+	}
+	got, err := ProcessesFromQueryResult(qr)
+	if err != nil {
+		t.Fatalf("ProcessesFromQueryResult failed: %v", err)
+	}
+	want := []Process{{
+		Id:      12,
+		User:    "vt_app",
+		Host:    "localhost",
+		Db:      "vt_db",
+		Command: "Query",
+		Time:    42 * time.Second,
+		State:   "Sending data",
+		Info:    "select * from t",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProcessesFromQueryResult() = %v, want %v", got, want)
+	}
+}
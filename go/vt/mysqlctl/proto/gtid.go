@@ -42,6 +42,31 @@ type GTID interface {
 	TryCompare(GTID) (int, error)
 }
 
+// GTIDSet is implemented by the GTIDs that are sets of transactions,
+// like the MySQL 5.6 ones. Their positions are the sets of all the
+// transactions executed up to them, while the binlog events only
+// carry the GTID of their own transaction.
+type GTIDSet interface {
+	GTID
+
+	// Contains returns true if the set contains all the
+	// transactions of the GTID, which can be a set.
+	Contains(GTID) bool
+
+	// AddGTID returns the set with the transactions of the GTID added.
+	AddGTID(GTID) GTIDSet
+}
+
+// AdvanceGTID returns the position after the transaction of gtid,
+// from the position pos. For GTID sets, it's pos with gtid added.
+// For the other flavors, it's gtid.
+func AdvanceGTID(pos, gtid GTID) GTID {
+	if set, ok := pos.(GTIDSet); ok {
+		return set.AddGTID(gtid)
+	}
+	return gtid
+}
+
 // gtidParsers maps flavor names to parser functions.
 var gtidParsers = make(map[string]func(string) (GTID, error))
 
@@ -0,0 +1,340 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const mysql56FlavorID = "MySQL56"
+
+// SID is the UUID of a MySQL 5.6 server, which identifies
+// the source of the transactions in the GTIDs.
+type SID [16]byte
+
+// ParseSID parses a SID in the UUID format.
+func ParseSID(s string) (sid SID, err error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return sid, fmt.Errorf("invalid MySQL 5.6 SID (%v): expecting UUID format", s)
+	}
+	// Drop the dashes so we can just check the error of Decode once.
+	b := make([]byte, 0, 32)
+	b = append(b, s[:8]...)
+	b = append(b, s[9:13]...)
+	b = append(b, s[14:18]...)
+	b = append(b, s[19:23]...)
+	b = append(b, s[24:]...)
+	if _, err := hex.Decode(sid[:], b); err != nil {
+		return sid, fmt.Errorf("invalid MySQL 5.6 SID (%v): %v", s, err)
+	}
+	return sid, nil
+}
+
+// String returns the SID in the UUID format.
+func (sid SID) String() string {
+	dst := []byte("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx")
+	hex.Encode(dst, sid[:4])
+	hex.Encode(dst[9:], sid[4:6])
+	hex.Encode(dst[14:], sid[6:8])
+	hex.Encode(dst[19:], sid[8:10])
+	hex.Encode(dst[24:], sid[10:16])
+	return string(dst)
+}
+
+// Mysql56GTID is the GTID of a single MySQL 5.6 transaction, as
+// found in the GTID events of the binlogs. The positions of MySQL
+// 5.6 are GTID sets: see Mysql56GTIDSet.
+type Mysql56GTID struct {
+	Server   SID
+	Sequence int64
+}
+
+// String implements GTID.String().
+func (gtid Mysql56GTID) String() string {
+	return fmt.Sprintf("%s:%d", gtid.Server, gtid.Sequence)
+}
+
+// Flavor implements GTID.Flavor().
+func (gtid Mysql56GTID) Flavor() string {
+	return mysql56FlavorID
+}
+
+// TryCompare implements GTID.TryCompare(). The GTID is compared as the
+// set of its single transaction.
+func (gtid Mysql56GTID) TryCompare(cmp GTID) (int, error) {
+	return gtid.set().TryCompare(cmp)
+}
+
+// set returns the GTID set of the single transaction of gtid.
+func (gtid Mysql56GTID) set() Mysql56GTIDSet {
+	set := make(gtidSet)
+	set.add(gtid.Server, interval{gtid.Sequence, gtid.Sequence})
+	return Mysql56GTIDSet(set.String())
+}
+
+// Mysql56GTIDSet is a MySQL 5.6 GTID set, like @@GLOBAL.gtid_executed:
+// the set of the transactions executed by a server, given as the
+// intervals of the sequence numbers of the transactions of each
+// source server, as in "SID:1-5:7-9,SID2:1-3". It's kept in its
+// canonical form, so GTID sets can be compared with ==.
+type Mysql56GTIDSet string
+
+// parseMysql56GTIDSet is registered as a parser for ParseGTID().
+func parseMysql56GTIDSet(s string) (GTID, error) {
+	set, err := parseGTIDSet(s)
+	if err != nil {
+		return nil, err
+	}
+	return Mysql56GTIDSet(set.String()), nil
+}
+
+// String implements GTID.String().
+func (gs Mysql56GTIDSet) String() string {
+	return string(gs)
+}
+
+// Flavor implements GTID.Flavor().
+func (gs Mysql56GTIDSet) Flavor() string {
+	return mysql56FlavorID
+}
+
+// TryCompare implements GTID.TryCompare(). A GTID set comes after
+// the sets it contains. Sets that don't contain one another can't
+// be compared: each has transactions the other doesn't have.
+func (gs Mysql56GTIDSet) TryCompare(cmp GTID) (int, error) {
+	other, err := mysql56Set(cmp)
+	if err != nil {
+		return 0, fmt.Errorf("can't compare GTID, wrong type: %#v.TryCompare(%#v)", gs, cmp)
+	}
+	a, b := gs.parsed(), other.parsed()
+	aContainsB, bContainsA := a.contains(b), b.contains(a)
+	switch {
+	case aContainsB && bContainsA:
+		return 0, nil
+	case bContainsA:
+		return -1, nil
+	case aContainsB:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("can't compare GTID, neither MySQL 5.6 GTID set contains the other: %v, %v", gs, other)
+}
+
+// Contains implements GTIDSet.Contains().
+func (gs Mysql56GTIDSet) Contains(cmp GTID) bool {
+	other, err := mysql56Set(cmp)
+	if err != nil {
+		return false
+	}
+	return gs.parsed().contains(other.parsed())
+}
+
+// AddGTID implements GTIDSet.AddGTID().
+func (gs Mysql56GTIDSet) AddGTID(gtid GTID) GTIDSet {
+	other, err := mysql56Set(gtid)
+	if err != nil {
+		return gs
+	}
+	set := gs.parsed()
+	for sid, intervals := range other.parsed() {
+		for _, iv := range intervals {
+			set.add(sid, iv)
+		}
+	}
+	return Mysql56GTIDSet(set.String())
+}
+
+// SIDBlock returns the GTID set in the binary format of the
+// COM_BINLOG_DUMP_GTID command:
+//   # bytes   field
+//   8         number of SIDs
+//   for each SID:
+//     16      SID
+//     8       number of intervals
+//     for each interval:
+//       8     start sequence number
+//       8     end sequence number, excluded
+func (gs Mysql56GTIDSet) SIDBlock() []byte {
+	set := gs.parsed()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint64(len(set)))
+	for _, sid := range set.sids() {
+		buf.Write(sid[:])
+		binary.Write(&buf, binary.LittleEndian, uint64(len(set[sid])))
+		for _, iv := range set[sid] {
+			binary.Write(&buf, binary.LittleEndian, iv.start)
+			binary.Write(&buf, binary.LittleEndian, iv.end+1)
+		}
+	}
+	return buf.Bytes()
+}
+
+// parsed returns the intervals of gs. It's in canonical form,
+// so it always parses.
+func (gs Mysql56GTIDSet) parsed() gtidSet {
+	set, err := parseGTIDSet(string(gs))
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// mysql56Set converts gtid to a Mysql56GTIDSet, if it's a MySQL 5.6 GTID.
+func mysql56Set(gtid GTID) (Mysql56GTIDSet, error) {
+	switch gtid := gtid.(type) {
+	case Mysql56GTIDSet:
+		return gtid, nil
+	case Mysql56GTID:
+		return gtid.set(), nil
+	}
+	return "", fmt.Errorf("not a MySQL 5.6 GTID: %#v", gtid)
+}
+
+// interval is an interval of sequence numbers. Both ends are included.
+type interval struct {
+	start, end int64
+}
+
+// gtidSet is the parsed form of a MySQL 5.6 GTID set: the sorted,
+// disjoint, non-adjacent intervals of sequence numbers of each SID.
+type gtidSet map[SID][]interval
+
+// parseGTIDSet parses a MySQL 5.6 GTID set. The intervals don't
+// need to be sorted or disjoint.
+func parseGTIDSet(s string) (gtidSet, error) {
+	set := make(gtidSet)
+	// gtid_executed has newlines after the commas.
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid MySQL 5.6 GTID set (%v): expecting SID:interval[:interval...]", s)
+		}
+		sid, err := ParseSID(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields[1:] {
+			iv, err := parseInterval(field)
+			if err != nil {
+				return nil, err
+			}
+			set.add(sid, iv)
+		}
+	}
+	return set, nil
+}
+
+// parseInterval parses an interval of sequence
+// numbers, "start-end" or "sequence".
+func parseInterval(s string) (iv interval, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if iv.start, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return iv, fmt.Errorf("invalid MySQL 5.6 GTID interval (%v): %v", s, err)
+	}
+	iv.end = iv.start
+	if len(parts) == 2 {
+		if iv.end, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return iv, fmt.Errorf("invalid MySQL 5.6 GTID interval (%v): %v", s, err)
+		}
+	}
+	if iv.start < 1 || iv.end < iv.start {
+		return iv, fmt.Errorf("invalid MySQL 5.6 GTID interval (%v): out of range", s)
+	}
+	return iv, nil
+}
+
+// add adds the interval iv to the intervals of sid.
+func (set gtidSet) add(sid SID, iv interval) {
+	intervals := append(set[sid], iv)
+	sort.Sort(byStart(intervals))
+	merged := intervals[:1]
+	for _, iv := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if iv.start > last.end+1 {
+			merged = append(merged, iv)
+			continue
+		}
+		if iv.end > last.end {
+			last.end = iv.end
+		}
+	}
+	set[sid] = merged
+}
+
+// contains returns true if set contains all the transactions of other.
+func (set gtidSet) contains(other gtidSet) bool {
+	for sid, intervals := range other {
+		for _, iv := range intervals {
+			if !containsInterval(set[sid], iv) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// containsInterval returns true if one of intervals contains iv.
+// It relies on intervals being disjoint and non-adjacent.
+func containsInterval(intervals []interval, iv interval) bool {
+	for _, candidate := range intervals {
+		if candidate.start <= iv.start && iv.end <= candidate.end {
+			return true
+		}
+	}
+	return false
+}
+
+// sids returns the SIDs of set, sorted.
+func (set gtidSet) sids() []SID {
+	sids := make([]SID, 0, len(set))
+	for sid := range set {
+		sids = append(sids, sid)
+	}
+	sort.Sort(bySID(sids))
+	return sids
+}
+
+// String returns the canonical form of the set: the SIDs are sorted,
+// and so are their intervals.
+func (set gtidSet) String() string {
+	var parts []string
+	for _, sid := range set.sids() {
+		part := sid.String()
+		for _, iv := range set[sid] {
+			if iv.start == iv.end {
+				part += fmt.Sprintf(":%d", iv.start)
+			} else {
+				part += fmt.Sprintf(":%d-%d", iv.start, iv.end)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+type byStart []interval
+
+func (s byStart) Len() int           { return len(s) }
+func (s byStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byStart) Less(i, j int) bool { return s[i].start < s[j].start }
+
+type bySID []SID
+
+func (s bySID) Len() int           { return len(s) }
+func (s bySID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySID) Less(i, j int) bool { return bytes.Compare(s[i][:], s[j][:]) < 0 }
+
+func init() {
+	gtidParsers[mysql56FlavorID] = parseMysql56GTIDSet
+}
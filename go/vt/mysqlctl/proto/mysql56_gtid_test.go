@@ -0,0 +1,175 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const (
+	sid1 = "00010203-0405-0607-0809-0a0b0c0d0e0f"
+	sid2 = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+)
+
+func TestParseSID(t *testing.T) {
+	sid, err := ParseSID(sid1)
+	if err != nil {
+		t.Fatalf("ParseSID(%v): %v", sid1, err)
+	}
+	want := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	if sid != want {
+		t.Errorf("ParseSID(%v) = %v, want %v", sid1, sid, want)
+	}
+	if got := sid.String(); got != sid1 {
+		t.Errorf("SID.String() = %v, want %v", got, sid1)
+	}
+	for _, input := range []string{"", "00010203-0405-0607-0809", "00010203x0405-0607-0809-0a0b0c0d0e0f", "0001020g-0405-0607-0809-0a0b0c0d0e0f"} {
+		if _, err := ParseSID(input); err == nil {
+			t.Errorf("ParseSID(%v): expected error", input)
+		}
+	}
+}
+
+func TestParseMysql56GTIDSet(t *testing.T) {
+	table := map[string]string{
+		"":                                     "",
+		sid1 + ":1-5":                          sid1 + ":1-5",
+		sid1 + ":7:1-5":                        sid1 + ":1-5:7",
+		sid1 + ":1-5:6-9:3":                    sid1 + ":1-9",
+		sid2 + ":4,\n" + sid1 + ":1-2":         sid1 + ":1-2," + sid2 + ":4",
+		sid1 + ":1-3," + sid1 + ":2-8:10-12":   sid1 + ":1-8:10-12",
+		strings.ToUpper(sid2) + ":1-10:20-100": sid2 + ":1-10:20-100",
+	}
+	for input, want := range table {
+		got, err := ParseGTID(mysql56FlavorID, input)
+		if err != nil {
+			t.Errorf("ParseGTID(%q): %v", input, err)
+			continue
+		}
+		if got != Mysql56GTIDSet(want) {
+			t.Errorf("ParseGTID(%q) = %#v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestParseInvalidMysql56GTIDSet(t *testing.T) {
+	table := map[string]string{
+		sid1:             "invalid MySQL 5.6 GTID set",
+		"1234:1-5":       "invalid MySQL 5.6 SID",
+		sid1 + ":x":      "invalid MySQL 5.6 GTID interval",
+		sid1 + ":1-x":    "invalid MySQL 5.6 GTID interval",
+		sid1 + ":5-3":    "invalid MySQL 5.6 GTID interval",
+		sid1 + ":0-3":    "invalid MySQL 5.6 GTID interval",
+		sid1 + ":1-3:-4": "invalid MySQL 5.6 GTID interval",
+	}
+	for input, want := range table {
+		_, err := parseMysql56GTIDSet(input)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parseMysql56GTIDSet(%q): %v, want %v", input, err, want)
+		}
+	}
+}
+
+func TestMysql56GTIDSetTryCompare(t *testing.T) {
+	set := MustParseGTID(mysql56FlavorID, sid1+":1-10,"+sid2+":1-5")
+	table := []struct {
+		cmp  GTID
+		want int
+	}{
+		{MustParseGTID(mysql56FlavorID, sid2+":1-5,"+sid1+":1-10"), 0},
+		{MustParseGTID(mysql56FlavorID, sid1+":1-9"), 1},
+		{MustParseGTID(mysql56FlavorID, sid1+":1-10,"+sid2+":1-6"), -1},
+		{Mysql56GTID{Server: mustParseSID(sid1), Sequence: 3}, 1},
+	}
+	for _, tcase := range table {
+		got, err := set.TryCompare(tcase.cmp)
+		if err != nil || got != tcase.want {
+			t.Errorf("%v.TryCompare(%v) = %v, %v, want %v", set, tcase.cmp, got, err, tcase.want)
+		}
+	}
+
+	// Sets that each have transactions the other doesn't have.
+	if _, err := set.TryCompare(MustParseGTID(mysql56FlavorID, sid1+":1-11")); err == nil {
+		t.Errorf("expected error comparing disjoint sets")
+	}
+	if _, err := set.TryCompare(GoogleGTID{GroupID: 41}); err == nil {
+		t.Errorf("expected error comparing to a Google GTID")
+	}
+}
+
+func TestMysql56GTIDSetContains(t *testing.T) {
+	set := MustParseGTID(mysql56FlavorID, sid1+":1-10:20-30").(Mysql56GTIDSet)
+	table := map[string]bool{
+		"":                         true,
+		sid1 + ":1-10":             true,
+		sid1 + ":5:25-30":          true,
+		sid1 + ":10-20":            false,
+		sid1 + ":1," + sid2 + ":1": false,
+	}
+	for input, want := range table {
+		if got := set.Contains(MustParseGTID(mysql56FlavorID, input)); got != want {
+			t.Errorf("%v.Contains(%q) = %v, want %v", set, input, got, want)
+		}
+	}
+	if got := set.Contains(Mysql56GTID{Server: mustParseSID(sid1), Sequence: 15}); got {
+		t.Errorf("%v.Contains(%v:15) = true, want false", set, sid1)
+	}
+}
+
+func TestAdvanceGTID(t *testing.T) {
+	var pos GTID = MustParseGTID(mysql56FlavorID, sid1+":1-10")
+	pos = AdvanceGTID(pos, Mysql56GTID{Server: mustParseSID(sid1), Sequence: 11})
+	pos = AdvanceGTID(pos, Mysql56GTID{Server: mustParseSID(sid2), Sequence: 1})
+	want := Mysql56GTIDSet(sid1 + ":1-11," + sid2 + ":1")
+	if pos != want {
+		t.Errorf("AdvanceGTID() = %v, want %v", pos, want)
+	}
+
+	// Other flavors just move to the new GTID.
+	if got := AdvanceGTID(GoogleGTID{GroupID: 1}, GoogleGTID{GroupID: 2}); got != (GoogleGTID{GroupID: 2}) {
+		t.Errorf("AdvanceGTID() = %v, want 2", got)
+	}
+}
+
+func TestMysql56GTIDSetSIDBlock(t *testing.T) {
+	set := MustParseGTID(mysql56FlavorID, sid1+":1-5:7").(Mysql56GTIDSet)
+	want := []byte{
+		1, 0, 0, 0, 0, 0, 0, 0,
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0, 0, 0, 0, 0,
+		6, 0, 0, 0, 0, 0, 0, 0,
+		7, 0, 0, 0, 0, 0, 0, 0,
+		8, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if got := set.SIDBlock(); !bytes.Equal(got, want) {
+		t.Errorf("SIDBlock() = %v, want %v", got, want)
+	}
+}
+
+func TestMysql56GTIDField(t *testing.T) {
+	gf := GTIDField{Value: MustParseGTID(mysql56FlavorID, sid1+":1-5")}
+	buf, err := gf.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	var got GTIDField
+	if err := got.UnmarshalJSON(buf); err != nil {
+		t.Fatalf("UnmarshalJSON(%s): %v", buf, err)
+	}
+	if got != gf {
+		t.Errorf("UnmarshalJSON(%s) = %v, want %v", buf, got, gf)
+	}
+}
+
+func mustParseSID(s string) SID {
+	sid, err := ParseSID(s)
+	if err != nil {
+		panic(err)
+	}
+	return sid
+}
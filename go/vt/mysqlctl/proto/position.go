@@ -0,0 +1,122 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const filePosFlavorID = "FilePos"
+
+// parseFilePosGTID is registered as a parser for ParseGTID().
+func parseFilePosGTID(s string) (GTID, error) {
+	i := strings.LastIndex(s, ":")
+	if i == -1 {
+		return nil, fmt.Errorf("invalid file position (%v): expecting file:offset", s)
+	}
+	pos, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file position offset (%v): %v", s[i+1:], err)
+	}
+	return FilePosGTID{File: s[:i], Pos: uint32(pos)}, nil
+}
+
+// FilePosGTID is a position in the binlogs of a given server, as a
+// binlog file name and an offset in that file. It can be used where a
+// GTID is expected, with the servers that have no GTIDs, but the
+// positions of different servers can't be compared.
+type FilePosGTID struct {
+	File string
+	Pos  uint32
+}
+
+// String implements GTID.String().
+func (gtid FilePosGTID) String() string {
+	return fmt.Sprintf("%s:%d", gtid.File, gtid.Pos)
+}
+
+// Flavor implements GTID.Flavor().
+func (gtid FilePosGTID) Flavor() string {
+	return filePosFlavorID
+}
+
+// TryCompare implements GTID.TryCompare(). The positions can only be
+// compared if their files have the same base name, like
+// "vt-0000041983-bin.000001" and "vt-0000041983-bin.000002".
+func (gtid FilePosGTID) TryCompare(cmp GTID) (int, error) {
+	other, ok := cmp.(FilePosGTID)
+	if !ok {
+		return 0, fmt.Errorf("can't compare GTID, wrong type: %#v.TryCompare(%#v)",
+			gtid, cmp)
+	}
+
+	base, index, err := splitBinlogFile(gtid.File)
+	if err != nil {
+		return 0, err
+	}
+	otherBase, otherIndex, err := splitBinlogFile(other.File)
+	if err != nil {
+		return 0, err
+	}
+	if base != otherBase {
+		return 0, fmt.Errorf("can't compare GTID, binlog files don't match: %v != %v", base, otherBase)
+	}
+
+	switch true {
+	case index < otherIndex:
+		return -1, nil
+	case index > otherIndex:
+		return 1, nil
+	case gtid.Pos < other.Pos:
+		return -1, nil
+	case gtid.Pos > other.Pos:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// splitBinlogFile splits a binlog file name into its base name and
+// its index.
+func splitBinlogFile(file string) (string, uint64, error) {
+	i := strings.LastIndex(file, ".")
+	if i == -1 {
+		return "", 0, fmt.Errorf("invalid binlog file name (%v): expecting base.index", file)
+	}
+	index, err := strconv.ParseUint(file[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid binlog file index (%v): %v", file[i+1:], err)
+	}
+	return file[:i], index, nil
+}
+
+// AtLeast returns true if the position pos includes all the
+// transactions up to target. A nil target is included in any
+// position, and a nil pos includes nothing else. For GTID sets, it
+// means that pos contains target. For the other flavors, it means
+// that pos is target or comes after it, so an error is returned if
+// they can't be compared.
+func AtLeast(pos, target GTID) (bool, error) {
+	if target == nil {
+		return true, nil
+	}
+	if pos == nil {
+		return false, nil
+	}
+	if set, ok := pos.(GTIDSet); ok {
+		return set.Contains(target), nil
+	}
+	cmp, err := pos.TryCompare(target)
+	if err != nil {
+		return false, err
+	}
+	return cmp >= 0, nil
+}
+
+func init() {
+	gtidParsers[filePosFlavorID] = parseFilePosGTID
+}
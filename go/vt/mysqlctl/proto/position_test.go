@@ -0,0 +1,104 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFilePosGTID(t *testing.T) {
+	input := "vt-0000041983-bin.000001:1194"
+	want := FilePosGTID{File: "vt-0000041983-bin.000001", Pos: 1194}
+
+	got, err := ParseGTID("FilePos", input)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if got.(FilePosGTID) != want {
+		t.Errorf("ParseGTID(%v) = %v, want %v", input, got, want)
+	}
+	if got.String() != input {
+		t.Errorf("%#v.String() = %v, want %v", got, got.String(), input)
+	}
+	if got, err := DecodeGTID(EncodeGTID(want)); err != nil || got != want {
+		t.Errorf("DecodeGTID(EncodeGTID(%v)) = %v, %v", want, got, err)
+	}
+}
+
+func TestParseInvalidFilePosGTID(t *testing.T) {
+	for input, want := range map[string]string{
+		"vt-bin.000001":    "invalid file position",
+		"vt-bin.000001:1x": "invalid file position offset",
+	} {
+		_, err := parseFilePosGTID(input)
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("parseFilePosGTID(%v) = %v, want %v", input, err, want)
+		}
+	}
+}
+
+func TestFilePosGTIDTryCompare(t *testing.T) {
+	gtid := FilePosGTID{File: "vt-bin.000002", Pos: 100}
+	table := []struct {
+		other GTID
+		want  int
+	}{
+		{FilePosGTID{File: "vt-bin.000002", Pos: 100}, 0},
+		{FilePosGTID{File: "vt-bin.000002", Pos: 99}, 1},
+		{FilePosGTID{File: "vt-bin.000002", Pos: 101}, -1},
+		{FilePosGTID{File: "vt-bin.000001", Pos: 1000}, 1},
+		{FilePosGTID{File: "vt-bin.000010", Pos: 4}, -1},
+	}
+	for _, tc := range table {
+		if got, err := gtid.TryCompare(tc.other); err != nil || got != tc.want {
+			t.Errorf("%v.TryCompare(%v) = %v, %v, want %v", gtid, tc.other, got, err, tc.want)
+		}
+	}
+
+	for _, other := range []GTID{
+		FilePosGTID{File: "other-bin.000002", Pos: 100},
+		FilePosGTID{File: "vt-bin", Pos: 100},
+		MariadbGTID{Domain: 1, Server: 2, Sequence: 3},
+	} {
+		if _, err := gtid.TryCompare(other); err == nil {
+			t.Errorf("%v.TryCompare(%v) didn't fail", gtid, other)
+		}
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	table := []struct {
+		pos, target GTID
+		want        bool
+	}{
+		{nil, nil, true},
+		{MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, nil, true},
+		{nil, MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, false},
+		{MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, true},
+		{MariadbGTID{Domain: 0, Server: 1, Sequence: 6}, MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, true},
+		{MariadbGTID{Domain: 0, Server: 1, Sequence: 4}, MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, false},
+		{FilePosGTID{File: "vt-bin.000002", Pos: 4}, FilePosGTID{File: "vt-bin.000001", Pos: 1000}, true},
+		{
+			Mysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:1-10"),
+			Mysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:5"),
+			true,
+		},
+		{
+			Mysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:1-10"),
+			Mysql56GTIDSet("00010203-0405-0607-0809-0a0b0c0d0e0f:11"),
+			false,
+		},
+	}
+	for _, tc := range table {
+		if got, err := AtLeast(tc.pos, tc.target); err != nil || got != tc.want {
+			t.Errorf("AtLeast(%v, %v) = %v, %v, want %v", tc.pos, tc.target, got, err, tc.want)
+		}
+	}
+
+	if _, err := AtLeast(MariadbGTID{Domain: 0, Server: 1, Sequence: 5}, FilePosGTID{File: "vt-bin.000001", Pos: 4}); err == nil {
+		t.Errorf("AtLeast() of different flavors didn't fail")
+	}
+}
@@ -53,6 +53,11 @@ func (rp *ReplicationPosition) MapKeyIo() string {
 	return fmt.Sprintf("%v:%d", rp.MasterLogFileIo, rp.MasterLogPositionIo)
 }
 
+// FilePos returns the SQL position as a file position.
+func (rp *ReplicationPosition) FilePos() FilePosGTID {
+	return FilePosGTID{File: rp.MasterLogFile, Pos: uint32(rp.MasterLogPosition)}
+}
+
 type ReplicationState struct {
 	// ReplicationPosition is not anonymous because the default json encoder has begun to fail here.
 	ReplicationPosition ReplicationPosition
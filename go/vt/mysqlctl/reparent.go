@@ -5,6 +5,7 @@
 package mysqlctl
 
 import (
+	"flag"
 	"fmt"
 	"time"
 
@@ -12,27 +13,122 @@ import (
 	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
-// if the master is still alive, then we need to demote it gracefully
-// make it read-only, flush the writes and get the position
+var demoteMasterLockWaitTimeout = flag.Duration("demote_master_lock_wait_timeout", 30*time.Second, "how long DemoteMaster waits for the running statements to flush the tables")
+
+// DemoteMaster gracefully demotes a master that is still alive: it
+// makes it read-only, flushes the writes, and returns the final
+// replication position for the slaves to catch up to. If the flush
+// fails, the master is made read-write again so it keeps serving.
 func (mysqld *Mysqld) DemoteMaster() (*proto.ReplicationPosition, error) {
-	// label as TYPE_REPLICA
-	mysqld.SetReadOnly(true)
-	cmds := []string{
-		"FLUSH TABLES WITH READ LOCK",
-		"UNLOCK TABLES",
+	if err := mysqld.SetReadOnly(true); err != nil {
+		return nil, err
 	}
-	if err := mysqld.ExecuteSuperQueryList(cmds); err != nil {
+
+	if err := mysqld.flushTables(); err != nil {
+		if rwErr := mysqld.SetReadOnly(false); rwErr != nil {
+			log.Errorf("DemoteMaster: cannot make master read-write again: %v", rwErr)
+		}
+		return nil, err
+	}
+	return mysqld.MasterStatus()
+}
+
+// flushTables flushes the writes of all the tables. FLUSH TABLES WITH
+// READ LOCK waits for the running statements, so it is bounded by
+// demote_master_lock_wait_timeout not to block the writes forever.
+func (mysqld *Mysqld) flushTables() error {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+
+	if _, err := conn.ExecuteFetch(fmt.Sprintf("SET SESSION lock_wait_timeout = %v", int(demoteMasterLockWaitTimeout.Seconds())), 10000, false); err != nil {
+		return err
+	}
+	defer func() {
+		// the connection goes back to the pool, restore the timeout
+		if _, err := conn.ExecuteFetch("SET SESSION lock_wait_timeout = DEFAULT", 10000, false); err != nil {
+			log.Warningf("cannot restore lock_wait_timeout, closing connection: %v", err)
+			conn.Close()
+		}
+	}()
+
+	for _, query := range []string{"FLUSH TABLES WITH READ LOCK", "UNLOCK TABLES"} {
+		log.Infof("exec %v", query)
+		if _, err := conn.ExecuteFetch(query, 10000, false); err != nil {
+			return fmt.Errorf("ExecuteFetch(%v) failed: %v", query, err)
+		}
+	}
+	return nil
+}
+
+// PromoteSlave changes a slave into a master: it waits for the slave
+// to reach waitPosition (usually returned by DemoteMaster on the old
+// master, nil not to wait), stops and resets replication, and enables
+// writes. It returns the position of the new master, to point the
+// other slaves at with SetMaster. If the slave can't be promoted, its
+// replication is restarted.
+func (mysqld *Mysqld) PromoteSlave(waitPosition proto.GTID, waitTimeout time.Duration, hookExtraEnv map[string]string) (*proto.ReplicationPosition, error) {
+	if waitPosition != nil {
+		if err := mysqld.WaitForPosition(waitPosition, waitTimeout); err != nil {
+			return nil, fmt.Errorf("PromoteSlave: slave didn't reach %v: %v", waitPosition, err)
+		}
+	}
+
+	if err := mysqld.StopSlave(hookExtraEnv); err != nil {
+		return nil, err
+	}
+	if err := mysqld.ExecuteSuperQueryList(mysqld.flavor.PromoteSlaveCommands()); err != nil {
+		if startErr := mysqld.StartSlave(hookExtraEnv); startErr != nil {
+			log.Errorf("PromoteSlave: cannot restart replication: %v", startErr)
+		}
+		return nil, err
+	}
+
+	// replication is gone, there is no going back from here
+	if err := mysqld.SetReadOnly(false); err != nil {
 		return nil, err
 	}
 	return mysqld.MasterStatus()
 }
 
+// SetMaster points replication to a new master, at the position in
+// replicationState (usually returned by PromoteSlave on the new
+// master), and waits for it to start. If waitPosition is set, it
+// first waits for the slave to reach it on its current master, so no
+// transaction is lost in a planned failover. It is also used to turn
+// a demoted master into a slave.
+func (mysqld *Mysqld) SetMaster(replicationState *proto.ReplicationState, waitPosition proto.GTID, waitTimeout time.Duration) error {
+	if waitPosition != nil {
+		if err := mysqld.WaitForPosition(waitPosition, waitTimeout); err != nil {
+			return fmt.Errorf("SetMaster: slave didn't reach %v: %v", waitPosition, err)
+		}
+	}
+
+	cmds, err := StartReplicationCommands(mysqld, replicationState)
+	if err != nil {
+		return err
+	}
+	if err := mysqld.ExecuteSuperQueryList(cmds); err != nil {
+		return err
+	}
+	if err := mysqld.WaitForSlaveStart(SlaveStartDeadline); err != nil {
+		return fmt.Errorf("SetMaster: replication from %v didn't start: %v", replicationState.MasterAddr(), err)
+	}
+	return nil
+}
+
+// PromoteSlaveForReparent changes a slave into a master for the
+// legacy reparent actions, and writes the rows slaves check when they
+// restart replication.
+//
 // setReadWrite: set the new master in read-write mode.
 //
 // replicationState: info slaves need to reparent themselves
 // waitPosition: slaves can wait for this position when restarting replication
 // timePromoted: this timestamp (unix nanoseconds) is inserted into _vt.replication_log to verify the replication config
-func (mysqld *Mysqld) PromoteSlave(setReadWrite bool, hookExtraEnv map[string]string) (replicationState *proto.ReplicationState, waitPosition *proto.ReplicationPosition, timePromoted int64, err error) {
+func (mysqld *Mysqld) PromoteSlaveForReparent(setReadWrite bool, hookExtraEnv map[string]string) (replicationState *proto.ReplicationState, waitPosition *proto.ReplicationPosition, timePromoted int64, err error) {
 	if err = mysqld.StopSlave(hookExtraEnv); err != nil {
 		return
 	}
@@ -111,7 +207,7 @@ func (mysqld *Mysqld) RestartSlave(replicationState *proto.ReplicationState, wai
 		return err
 	}
 
-	if err := mysqld.WaitMasterPos(waitPosition, 0); err != nil {
+	if err := mysqld.WaitForPosition(waitPosition.FilePos(), 0); err != nil {
 		return err
 	}
 
@@ -0,0 +1,337 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// fakeMysqldDB is the MySQL of the dba pool of a fake Mysqld: it
+// answers the queries with the results and errors it was given, an
+// empty result by default, and records them.
+type fakeMysqldDB struct {
+	mu      sync.Mutex
+	nextId  int64
+	results map[string]*mproto.QueryResult
+	errors  map[string]error
+	queries []string
+}
+
+func newFakeMysqldDB() *fakeMysqldDB {
+	return &fakeMysqldDB{
+		results: make(map[string]*mproto.QueryResult),
+		errors:  make(map[string]error),
+	}
+}
+
+// Queries returns the queries run since the last call.
+func (db *fakeMysqldDB) Queries() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	queries := db.queries
+	db.queries = nil
+	return queries
+}
+
+// newMysqld returns a Mysqld of flavor, whose dba pool connects to db.
+func (db *fakeMysqldDB) newMysqld(flavor MysqlFlavor) *Mysqld {
+	pool := dbconnpool.NewConnectionPool("", 2, time.Minute)
+	pool.Open(func(pool *dbconnpool.ConnectionPool) (dbconnpool.PoolConnection, error) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		db.nextId++
+		return &fakeMysqldConn{db: db, id: db.nextId, pool: pool}, nil
+	})
+	return &Mysqld{
+		flavor:     flavor,
+		dbaPool:    pool,
+		replParams: &mysql.ConnectionParams{Uname: "vt_repl", Pass: "secret"},
+	}
+}
+
+// fakeMysqldConn is a PoolConnection to a fakeMysqldDB.
+type fakeMysqldConn struct {
+	db     *fakeMysqldDB
+	id     int64
+	pool   *dbconnpool.ConnectionPool
+	closed bool
+}
+
+func (fc *fakeMysqldConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	fc.db.mu.Lock()
+	defer fc.db.mu.Unlock()
+	fc.db.queries = append(fc.db.queries, query)
+	if err := fc.db.errors[query]; err != nil {
+		return nil, err
+	}
+	if qr := fc.db.results[query]; qr != nil {
+		return qr, nil
+	}
+	return &mproto.QueryResult{}, nil
+}
+
+func (fc *fakeMysqldConn) ExecuteStreamFetch(query string, callback func(*mproto.QueryResult) error, streamBufferSize, streamBufferRows int) error {
+	return nil
+}
+
+func (fc *fakeMysqldConn) Id() int64      { return fc.id }
+func (fc *fakeMysqldConn) Close()         { fc.closed = true }
+func (fc *fakeMysqldConn) IsClosed() bool { return fc.closed }
+
+func (fc *fakeMysqldConn) Recycle() {
+	if fc.closed {
+		fc.pool.Put(nil)
+	} else {
+		fc.pool.Put(fc)
+	}
+}
+
+// fakeReparentFlavor reads the master position with SHOW MASTER
+// STATUS, and promotes slaves with RESET MASTER and RESET SLAVE.
+type fakeReparentFlavor struct {
+	fakeMysqlFlavor
+}
+
+func (fakeReparentFlavor) MasterStatus(mysqld *Mysqld) (*proto.ReplicationPosition, error) {
+	if _, err := mysqld.fetchSuperQuery("SHOW MASTER STATUS"); err != nil {
+		return nil, err
+	}
+	return &proto.ReplicationPosition{MasterLogFile: "vt-bin.000002", MasterLogPosition: 42}, nil
+}
+
+func (fakeReparentFlavor) PromoteSlaveCommands() []string {
+	return []string{"RESET MASTER", "RESET SLAVE"}
+}
+
+// masterPosWaitResult is the result of MASTER_POS_WAIT: the number of
+// events waited for, -1 on timeout.
+func masterPosWaitResult(value string) *mproto.QueryResult {
+	return &mproto.QueryResult{Rows: [][]sqltypes.Value{{sqltypes.MakeString([]byte(value))}}}
+}
+
+// runningSlaveStatus is the result of SHOW SLAVE STATUS on a slave
+// whose threads are running.
+func runningSlaveStatus() *mproto.QueryResult {
+	row := make([]sqltypes.Value, len(showSlaveStatusColumnNames))
+	for i, name := range showSlaveStatusColumnNames {
+		var value string
+		switch name {
+		case "Slave_IO_Running", "Slave_SQL_Running":
+			value = "Yes"
+		}
+		row[i] = sqltypes.MakeString([]byte(value))
+	}
+	return &mproto.QueryResult{Rows: [][]sqltypes.Value{row}}
+}
+
+func TestDemoteMaster(t *testing.T) {
+	db := newFakeMysqldDB()
+	mysqld := db.newMysqld(&fakeReparentFlavor{})
+	defer mysqld.Close()
+
+	pos, err := mysqld.DemoteMaster()
+	if err != nil {
+		t.Fatalf("DemoteMaster failed: %v", err)
+	}
+	if got, want := pos.MapKey(), "vt-bin.000002:42"; got != want {
+		t.Errorf("DemoteMaster() = %v, want %v", got, want)
+	}
+	want := []string{
+		"SET GLOBAL read_only = ON",
+		"SET SESSION lock_wait_timeout = 30",
+		"FLUSH TABLES WITH READ LOCK",
+		"UNLOCK TABLES",
+		"SET SESSION lock_wait_timeout = DEFAULT",
+		"SHOW MASTER STATUS",
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDemoteMasterFailures(t *testing.T) {
+	testCases := []struct {
+		failOn string
+		want   []string
+	}{
+		{
+			// nothing changed, nothing to undo
+			failOn: "SET GLOBAL read_only = ON",
+			want:   []string{"SET GLOBAL read_only = ON"},
+		},
+		{
+			// the master keeps serving
+			failOn: "FLUSH TABLES WITH READ LOCK",
+			want: []string{
+				"SET GLOBAL read_only = ON",
+				"SET SESSION lock_wait_timeout = 30",
+				"FLUSH TABLES WITH READ LOCK",
+				"SET SESSION lock_wait_timeout = DEFAULT",
+				"SET GLOBAL read_only = OFF",
+			},
+		},
+		{
+			// the flush is done, the master stays read-only
+			failOn: "SHOW MASTER STATUS",
+			want: []string{
+				"SET GLOBAL read_only = ON",
+				"SET SESSION lock_wait_timeout = 30",
+				"FLUSH TABLES WITH READ LOCK",
+				"UNLOCK TABLES",
+				"SET SESSION lock_wait_timeout = DEFAULT",
+				"SHOW MASTER STATUS",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		db := newFakeMysqldDB()
+		db.errors[tc.failOn] = fmt.Errorf("mysql is down")
+		mysqld := db.newMysqld(&fakeReparentFlavor{})
+
+		if _, err := mysqld.DemoteMaster(); err == nil || !strings.Contains(err.Error(), "mysql is down") {
+			t.Errorf("DemoteMaster failing on %v: %v, want mysql is down", tc.failOn, err)
+		}
+		if got := db.Queries(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("queries failing on %v:\n%v\nwant:\n%v", tc.failOn, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+		mysqld.Close()
+	}
+}
+
+func TestPromoteSlave(t *testing.T) {
+	db := newFakeMysqldDB()
+	db.results["SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)"] = masterPosWaitResult("3")
+	mysqld := db.newMysqld(&fakeReparentFlavor{})
+	defer mysqld.Close()
+
+	pos, err := mysqld.PromoteSlave(proto.FilePosGTID{File: "vt-bin.000001", Pos: 120}, 10*time.Second, nil)
+	if err != nil {
+		t.Fatalf("PromoteSlave failed: %v", err)
+	}
+	if got, want := pos.MapKey(), "vt-bin.000002:42"; got != want {
+		t.Errorf("PromoteSlave() = %v, want %v", got, want)
+	}
+	want := []string{
+		"SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)",
+		"STOP SLAVE",
+		"RESET MASTER",
+		"RESET SLAVE",
+		"SET GLOBAL read_only = OFF",
+		"SHOW MASTER STATUS",
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// without a position, it doesn't wait
+	if _, err := mysqld.PromoteSlave(nil, 0, nil); err != nil {
+		t.Fatalf("PromoteSlave failed: %v", err)
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want[1:], "\n"))
+	}
+}
+
+func TestPromoteSlaveFailures(t *testing.T) {
+	// the slave doesn't catch up: nothing changes
+	db := newFakeMysqldDB()
+	db.results["SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)"] = masterPosWaitResult("-1")
+	mysqld := db.newMysqld(&fakeReparentFlavor{})
+	_, err := mysqld.PromoteSlave(proto.FilePosGTID{File: "vt-bin.000001", Pos: 120}, 10*time.Second, nil)
+	if err == nil || !strings.Contains(err.Error(), "slave didn't reach") {
+		t.Errorf("PromoteSlave timing out: %v, want slave didn't reach", err)
+	}
+	want := []string{"SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)"}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	mysqld.Close()
+
+	// the promotion fails: replication is restarted
+	db = newFakeMysqldDB()
+	db.errors["RESET SLAVE"] = fmt.Errorf("mysql is down")
+	mysqld = db.newMysqld(&fakeReparentFlavor{})
+	if _, err := mysqld.PromoteSlave(nil, 0, nil); err == nil || !strings.Contains(err.Error(), "ExecuteFetch(RESET SLAVE) failed: mysql is down") {
+		t.Errorf("PromoteSlave failing on RESET SLAVE: %v", err)
+	}
+	want = []string{
+		"STOP SLAVE",
+		"RESET MASTER",
+		"RESET SLAVE",
+		"START SLAVE",
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	mysqld.Close()
+}
+
+func TestSetMaster(t *testing.T) {
+	db := newFakeMysqldDB()
+	db.results["SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)"] = masterPosWaitResult("0")
+	db.results["SHOW SLAVE STATUS"] = runningSlaveStatus()
+	mysqld := db.newMysqld(&fakeReparentFlavor{})
+	defer mysqld.Close()
+
+	replicationState, err := proto.NewReplicationState("newmaster:3306")
+	if err != nil {
+		t.Fatalf("NewReplicationState failed: %v", err)
+	}
+	replicationState.ReplicationPosition = proto.ReplicationPosition{MasterLogFile: "vt-bin.000002", MasterLogPosition: 42}
+	if err := mysqld.SetMaster(replicationState, proto.FilePosGTID{File: "vt-bin.000001", Pos: 120}, 10*time.Second); err != nil {
+		t.Fatalf("SetMaster failed: %v", err)
+	}
+	want := []string{
+		"SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)",
+		"STOP SLAVE",
+		"RESET SLAVE",
+		`CHANGE MASTER TO
+  MASTER_HOST = 'newmaster',
+  MASTER_PORT = 3306,
+  MASTER_USER = 'vt_repl',
+  MASTER_PASSWORD = 'secret',
+  MASTER_LOG_FILE = 'vt-bin.000002',
+  MASTER_LOG_POS = 42,
+  MASTER_CONNECT_RETRY = 10
+`,
+		"START SLAVE",
+		"SHOW SLAVE STATUS",
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the slave doesn't catch up on its old master: nothing changes
+	db.results["SELECT MASTER_POS_WAIT('vt-bin.000001', 120, 10)"] = masterPosWaitResult("-1")
+	err = mysqld.SetMaster(replicationState, proto.FilePosGTID{File: "vt-bin.000001", Pos: 120}, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "slave didn't reach") {
+		t.Errorf("SetMaster timing out: %v, want slave didn't reach", err)
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want[:1], "\n"))
+	}
+
+	// CHANGE MASTER fails: replication isn't started, and the
+	// error doesn't show the password
+	db.errors[want[3]] = fmt.Errorf("mysql is down")
+	err = mysqld.SetMaster(replicationState, nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "mysql is down") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("SetMaster failing on CHANGE MASTER: %v", err)
+	}
+	if got := db.Queries(); !reflect.DeepEqual(got, want[1:4]) {
+		t.Errorf("queries:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want[1:4], "\n"))
+	}
+}
@@ -81,6 +81,9 @@ func StartReplicationCommands(mysqld *Mysqld, replState *proto.ReplicationState)
 	if params.SslKey != "" {
 		cmc += ",\n  MASTER_SSL_KEY = '" + params.SslKey + "'"
 	}
+	if params.SslCipher != "" {
+		cmc += ",\n  MASTER_SSL_CIPHER = '" + params.SslCipher + "'"
+	}
 
 	return []string{
 		"STOP SLAVE",
@@ -183,6 +186,18 @@ func (mysqld *Mysqld) IsReadOnly() (bool, error) {
 	return false, nil
 }
 
+// ServerVersion returns the version of mysqld, as in SELECT VERSION().
+func (mysqld *Mysqld) ServerVersion() (string, error) {
+	qr, err := mysqld.fetchSuperQuery("SELECT VERSION()")
+	if err != nil {
+		return "", err
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) != 1 {
+		return "", errors.New("no version in mysql")
+	}
+	return qr.Rows[0][0].String(), nil
+}
+
 func (mysqld *Mysqld) SetReadOnly(on bool) error {
 	query := "SET GLOBAL read_only = "
 	if on {
@@ -295,26 +310,47 @@ func (mysqld *Mysqld) WaitMasterPos(rp *proto.ReplicationPosition, waitTimeout t
 	return nil
 }
 
-func (mysqld *Mysqld) WaitForMinimumReplicationPosition(targetGTID proto.GTID, waitTimeout time.Duration) (err error) {
+// waitPositionInterval is how often WaitForPosition checks the slave
+// position.
+const waitPositionInterval = 100 * time.Millisecond
+
+// WaitForPosition waits until the slave has applied all the
+// transactions up to pos. A waitTimeout of 0 means to wait forever.
+// File positions are waited for by MySQL with MASTER_POS_WAIT, the
+// other GTIDs by polling the slave status.
+func (mysqld *Mysqld) WaitForPosition(pos proto.GTID, waitTimeout time.Duration) error {
+	if filePos, ok := pos.(proto.FilePosGTID); ok {
+		return mysqld.WaitMasterPos(&proto.ReplicationPosition{
+			MasterLogFile:     filePos.File,
+			MasterLogPosition: uint(filePos.Pos),
+		}, waitTimeout)
+	}
+
 	// TODO(enisoc): Use MySQL "wait for gtid" commands instead of comparing GTIDs.
-	for remaining := waitTimeout; remaining > 0; remaining -= time.Second {
-		pos, err := mysqld.SlaveStatus()
+	var deadline time.Time
+	if waitTimeout > 0 {
+		deadline = time.Now().Add(waitTimeout)
+	}
+	for {
+		status, err := mysqld.SlaveStatus()
 		if err != nil {
 			return err
 		}
-
-		cmp, err := pos.MasterLogGTIDField.Value.TryCompare(targetGTID)
+		ok, err := proto.AtLeast(status.MasterLogGTIDField.Value, pos)
 		if err != nil {
 			return err
 		}
-		if cmp >= 0 { // pos.MasterLogGTIDField.Value >= targetGTID
+		if ok {
 			return nil
 		}
-
-		log.Infof("WaitForMinimumReplicationPosition got GTID %v, sleeping for 1s waiting for GTID %v", pos.MasterLogGTIDField, targetGTID)
-		time.Sleep(time.Second)
+		if status.SecondsBehindMaster == proto.InvalidLagSeconds {
+			return fmt.Errorf("WaitForPosition failed: replication stopped at %v, waiting for %v", status.MasterLogGTIDField, pos)
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("WaitForPosition failed: timed out at %v, waiting for %v", status.MasterLogGTIDField, pos)
+		}
+		time.Sleep(waitPositionInterval)
 	}
-	return fmt.Errorf("timed out waiting for GTID %v", targetGTID)
 }
 
 func (mysqld *Mysqld) SlaveStatus() (*proto.ReplicationPosition, error) {
@@ -653,13 +689,71 @@ func (mysqld *Mysqld) WaitBlpPos(bp *blproto.BlpPosition, waitTimeout time.Durat
 				return err
 			}
 		}
-		if gtid == bp.GTIDField.Value {
+		ok, err := proto.AtLeast(gtid, bp.GTIDField.Value)
+		if err != nil {
+			return err
+		}
+		if ok {
 			return nil
 		}
 
-		log.Infof("Sleeping 1 second waiting for binlog replication(%v) to catch up: %v != %v", bp.Uid, gtid, bp.GTIDField)
+		log.Infof("Sleeping 1 second waiting for binlog replication(%v) to catch up: %v < %v", bp.Uid, gtid, bp.GTIDField)
 		time.Sleep(1 * time.Second)
 	}
 
 	return fmt.Errorf("WaitBlpPos(%v) timed out", bp.Uid)
 }
+
+// The replication errors caused by corrupted relay logs, usually
+// after a crash of a slave that doesn't use crash safe replication.
+const (
+	errRelayLogRead  = "1594" // ER_SLAVE_RELAY_LOG_READ_FAILURE
+	errRelayLogWrite = "1595" // ER_SLAVE_RELAY_LOG_WRITE_FAILURE
+)
+
+// relayLogsCorrupted returns true if the replication threads of
+// slaveStatus stopped because of corrupted relay logs.
+func relayLogsCorrupted(slaveStatus map[string]string) bool {
+	return slaveStatus["Last_SQL_Errno"] == errRelayLogRead || slaveStatus["Last_IO_Errno"] == errRelayLogWrite
+}
+
+// RelayLogsCorrupted returns true if replication is stopped because
+// the relay logs are corrupted, and needs RepairRelayLogs.
+func (mysqld *Mysqld) RelayLogsCorrupted() (bool, error) {
+	fields, err := mysqld.slaveStatus()
+	if err != nil {
+		return false, err
+	}
+	return relayLogsCorrupted(fields), nil
+}
+
+// RepairRelayLogs discards the relay logs, and restarts replication
+// from the last position the SQL thread applied. The events after it
+// are downloaded again from the master.
+func (mysqld *Mysqld) RepairRelayLogs() error {
+	fields, err := mysqld.slaveStatus()
+	if err != nil {
+		return err
+	}
+	replicationState, err := proto.NewReplicationState(fields["Master_Host"] + ":" + fields["Master_Port"])
+	if err != nil {
+		return err
+	}
+	pos, err := strconv.ParseUint(fields["Exec_Master_Log_Pos"], 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid Exec_Master_Log_Pos %v: %v", fields["Exec_Master_Log_Pos"], err)
+	}
+	replicationState.ReplicationPosition.MasterLogFile = fields["Relay_Master_Log_File"]
+	replicationState.ReplicationPosition.MasterLogPosition = uint(pos)
+
+	log.Infof("Repairing relay logs, restarting replication from %v:%v", replicationState.ReplicationPosition.MasterLogFile, pos)
+	// RESET SLAVE deletes the relay logs
+	cmds, err := StartReplicationCommands(mysqld, replicationState)
+	if err != nil {
+		return err
+	}
+	if err := mysqld.ExecuteSuperQueryList(cmds); err != nil {
+		return err
+	}
+	return mysqld.WaitForSlaveStart(SlaveStartDeadline)
+}
@@ -5,7 +5,11 @@
 package mysqlctl
 
 import (
+	"strings"
 	"testing"
+
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 func testRedacted(t *testing.T, source, expected string) {
@@ -44,3 +48,42 @@ func TestRedactMasterPassword(t *testing.T) {
   MASTER_PASSWORD = 'AAA`, `CHANGE MASTER TO
   MASTER_PASSWORD = 'AAA`)
 }
+
+func TestStartReplicationCommandsSsl(t *testing.T) {
+	repl := &mysql.ConnectionParams{
+		Uname:     "vt_repl",
+		SslCa:     "/certs/ca.pem",
+		SslCipher: "DHE-RSA-AES256-SHA",
+	}
+	repl.EnableSsl()
+	mysqld := &Mysqld{replParams: repl}
+	cmds, err := StartReplicationCommands(mysqld, &proto.ReplicationState{MasterHost: "master", MasterPort: 3306})
+	if err != nil {
+		t.Fatalf("StartReplicationCommands failed: %v", err)
+	}
+	for _, want := range []string{"MASTER_SSL = 1", "MASTER_SSL_CA = '/certs/ca.pem'", "MASTER_SSL_CIPHER = 'DHE-RSA-AES256-SHA'"} {
+		if !strings.Contains(cmds[2], want) {
+			t.Errorf("CHANGE MASTER command doesn't have %v: %v", want, cmds[2])
+		}
+	}
+	if strings.Contains(cmds[2], "MASTER_SSL_KEY") {
+		t.Errorf("CHANGE MASTER command has an unset MASTER_SSL_KEY: %v", cmds[2])
+	}
+}
+
+func TestRelayLogsCorrupted(t *testing.T) {
+	table := []struct {
+		slaveStatus map[string]string
+		want        bool
+	}{
+		{map[string]string{"Last_IO_Errno": "0", "Last_SQL_Errno": "0"}, false},
+		{map[string]string{"Last_IO_Errno": "0", "Last_SQL_Errno": "1062"}, false},
+		{map[string]string{"Last_IO_Errno": "0", "Last_SQL_Errno": "1594"}, true},
+		{map[string]string{"Last_IO_Errno": "1595", "Last_SQL_Errno": "0"}, true},
+	}
+	for _, tt := range table {
+		if got := relayLogsCorrupted(tt.slaveStatus); got != tt.want {
+			t.Errorf("relayLogsCorrupted(%v) = %v, want %v", tt.slaveStatus, got, tt.want)
+		}
+	}
+}
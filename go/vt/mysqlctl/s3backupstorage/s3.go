@@ -0,0 +1,249 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package s3backupstorage implements the BackupStorage interface
+// for Amazon S3, or any server with an S3 compatible API.
+//
+// The backups are stored in a single S3 bucket, as
+// <root>/<backup bucket>/<backup name>/<file>. The AWS credentials are
+// read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// (optional) AWS_SESSION_TOKEN environment variables.
+package s3backupstorage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+var (
+	bucket   = flag.String("s3_backup_storage_bucket", "", "S3 bucket to store the backups in")
+	root     = flag.String("s3_backup_storage_root", "", "root prefix for all the backup objects in the S3 bucket")
+	region   = flag.String("s3_backup_aws_region", "us-east-1", "AWS region of the S3 bucket")
+	endpoint = flag.String("s3_backup_aws_endpoint", "", "S3 endpoint to use instead of the one of the region, like http://localhost:9000 for an S3 compatible server")
+	partSize = flag.Int("s3_backup_storage_part_size", 16*1024*1024, "size of the parts of the multipart uploads, at least 5MB")
+)
+
+// S3BackupHandle implements BackupHandle for S3.
+type S3BackupHandle struct {
+	bs       *S3BackupStorage
+	dir      string
+	name     string
+	readOnly bool
+}
+
+// Bucket is part of the BackupHandle interface
+func (bh *S3BackupHandle) Bucket() string {
+	return bh.dir
+}
+
+// Name is part of the BackupHandle interface
+func (bh *S3BackupHandle) Name() string {
+	return bh.name
+}
+
+// AddFile is part of the BackupHandle interface. The file is sent
+// in parts of s3_backup_storage_part_size bytes as it is written,
+// and completed by Close.
+func (bh *S3BackupHandle) AddFile(filename string) (io.WriteCloser, error) {
+	if bh.readOnly {
+		return nil, fmt.Errorf("AddFile cannot be called on read-only backup")
+	}
+	return &s3Writer{
+		bs:  bh.bs,
+		key: objectName(bh.dir, bh.name, filename),
+	}, nil
+}
+
+// EndBackup is part of the BackupHandle interface
+func (bh *S3BackupHandle) EndBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("EndBackup cannot be called on read-only backup")
+	}
+	return nil
+}
+
+// AbortBackup is part of the BackupHandle interface
+func (bh *S3BackupHandle) AbortBackup() error {
+	if bh.readOnly {
+		return fmt.Errorf("AbortBackup cannot be called on read-only backup")
+	}
+	return bh.bs.RemoveBackup(bh.dir, bh.name)
+}
+
+// ReadFile is part of the BackupHandle interface
+func (bh *S3BackupHandle) ReadFile(filename string) (io.ReadCloser, error) {
+	if !bh.readOnly {
+		return nil, fmt.Errorf("ReadFile cannot be called on read-write backup")
+	}
+	resp, err := bh.bs.do("GET", objectName(bh.dir, bh.name, filename), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// S3BackupStorage implements BackupStorage for S3.
+type S3BackupStorage struct {
+	client *http.Client
+}
+
+// ListBackups is part of the BackupStorage interface
+func (bs *S3BackupStorage) ListBackups(dir string) ([]backupstorage.BackupHandle, error) {
+	prefix := objectName(dir) + "/"
+	prefixes, _, err := bs.list(prefix, "/", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]backupstorage.BackupHandle, 0, len(prefixes))
+	for _, p := range prefixes {
+		result = append(result, &S3BackupHandle{
+			bs:       bs,
+			dir:      dir,
+			name:     strings.TrimSuffix(strings.TrimPrefix(p, prefix), "/"),
+			readOnly: true,
+		})
+	}
+	return result, nil
+}
+
+// StartBackup is part of the BackupStorage interface
+func (bs *S3BackupStorage) StartBackup(dir, name string) (backupstorage.BackupHandle, error) {
+	// S3 has no directories, just check nothing uses the name yet
+	_, keys, err := bs.list(objectName(dir, name)+"/", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		return nil, fmt.Errorf("backup %v/%v already exists", dir, name)
+	}
+
+	return &S3BackupHandle{
+		bs:       bs,
+		dir:      dir,
+		name:     name,
+		readOnly: false,
+	}, nil
+}
+
+// RemoveBackup is part of the BackupStorage interface
+func (bs *S3BackupStorage) RemoveBackup(dir, name string) error {
+	_, keys, err := bs.list(objectName(dir, name)+"/", "", 0)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		resp, err := bs.do("DELETE", key, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// objectName returns the key of an object in the S3 bucket.
+func objectName(parts ...string) string {
+	return path.Join(append([]string{*root}, parts...)...)
+}
+
+type listBucketResult struct {
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns the sorted common prefixes and keys of the objects
+// that start with prefix. If maxKeys is not 0, it stops after one
+// page of at most maxKeys results.
+func (bs *S3BackupStorage) list(prefix, delimiter string, maxKeys int) ([]string, []string, error) {
+	var prefixes, keys []string
+	query := map[string]string{
+		"list-type": "2",
+		"prefix":    prefix,
+	}
+	if delimiter != "" {
+		query["delimiter"] = delimiter
+	}
+	if maxKeys != 0 {
+		query["max-keys"] = fmt.Sprintf("%v", maxKeys)
+	}
+	for {
+		resp, err := bs.do("GET", "", query, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		result := listBucketResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode S3 list result: %v", err)
+		}
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated || maxKeys != 0 {
+			break
+		}
+		query["continuation-token"] = result.NextContinuationToken
+	}
+	sort.Strings(prefixes)
+	sort.Strings(keys)
+	return prefixes, keys, nil
+}
+
+// do sends a signed request for the object key, or for the bucket if
+// key is empty. It returns an error if the request doesn't succeed.
+// The caller must close the body of the response.
+func (bs *S3BackupStorage) do(method, key string, query map[string]string, body []byte) (*http.Response, error) {
+	if *bucket == "" {
+		return nil, fmt.Errorf("s3_backup_storage_bucket is not set")
+	}
+	host := *endpoint
+	if host == "" {
+		host = fmt.Sprintf("https://s3.%v.amazonaws.com", *region)
+	}
+	u := host + "/" + *bucket + "/" + escapePath(key)
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	signRequest(req, body)
+
+	resp, err := bs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %v %v failed: %v %s", method, key, resp.Status, data)
+	}
+	return resp, nil
+}
+
+func init() {
+	backupstorage.RegisterBackupStorage("s3", &S3BackupStorage{client: &http.Client{}})
+}
@@ -0,0 +1,140 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package s3backupstorage
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	log "github.com/golang/glog"
+)
+
+// s3Writer uploads an object as it is written. A small object is
+// sent with a single PUT on Close, a bigger one with a multipart
+// upload of s3_backup_storage_part_size parts.
+type s3Writer struct {
+	bs  *S3BackupStorage
+	key string
+
+	buf      []byte
+	uploadID string
+	parts    []completedPart
+	err      error
+}
+
+type initiateMultipartUploadResult struct {
+	UploadId string
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// Write is part of the io.Writer interface
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= *partSize {
+		if w.err = w.uploadPart(w.buf[:*partSize]); w.err != nil {
+			w.abort()
+			return 0, w.err
+		}
+		w.buf = append([]byte(nil), w.buf[*partSize:]...)
+	}
+	return len(p), nil
+}
+
+// Close is part of the io.Closer interface. It sends the rest of
+// the data, and completes the upload.
+func (w *s3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	// make sure a second Close doesn't upload again
+	w.err = fmt.Errorf("s3Writer for %v is closed", w.key)
+
+	if w.uploadID == "" {
+		resp, err := w.bs.do("PUT", w.key, nil, w.buf)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(w.buf); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	data, err := xml.Marshal(&completeMultipartUpload{Parts: w.parts})
+	if err != nil {
+		w.abort()
+		return err
+	}
+	resp, err := w.bs.do("POST", w.key, map[string]string{"uploadId": w.uploadID}, data)
+	if err != nil {
+		w.abort()
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// uploadPart sends one part of a multipart upload, starting the
+// upload first if needed.
+func (w *s3Writer) uploadPart(data []byte) error {
+	if w.uploadID == "" {
+		resp, err := w.bs.do("POST", w.key, map[string]string{"uploads": ""}, nil)
+		if err != nil {
+			return err
+		}
+		result := initiateMultipartUploadResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("cannot decode S3 multipart upload: %v", err)
+		}
+		w.uploadID = result.UploadId
+	}
+
+	partNumber := len(w.parts) + 1
+	resp, err := w.bs.do("PUT", w.key, map[string]string{
+		"partNumber": fmt.Sprintf("%v", partNumber),
+		"uploadId":   w.uploadID,
+	}, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, completedPart{
+		PartNumber: partNumber,
+		ETag:       resp.Header.Get("ETag"),
+	})
+	return nil
+}
+
+// abort cancels the multipart upload, if any, so S3 doesn't keep
+// its parts.
+func (w *s3Writer) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	resp, err := w.bs.do("DELETE", w.key, map[string]string{"uploadId": w.uploadID}, nil)
+	if err != nil {
+		log.Warningf("cannot abort S3 multipart upload of %v: %v", w.key, err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -189,6 +189,27 @@ func (mysqld *Mysqld) GetColumns(dbName, table string) ([]string, error) {
 
 }
 
+// GetColumnTypes returns the columns of table, in order, along with
+// their full column types (e.g. "int(10) unsigned").
+func (mysqld *Mysqld) GetColumnTypes(dbName, table string) (columns, types []string, err error) {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Recycle()
+	qr, err := conn.ExecuteFetch(fmt.Sprintf("select column_name, column_type from information_schema.columns where table_schema = '%v' and table_name = '%v' order by ordinal_position", dbName, table), 10000, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns = make([]string, len(qr.Rows))
+	types = make([]string, len(qr.Rows))
+	for i, row := range qr.Rows {
+		columns[i] = row[0].String()
+		types[i] = row[1].String()
+	}
+	return columns, types, nil
+}
+
 // GetPrimaryKeyColumns returns the primary key columns of table.
 func (mysqld *Mysqld) GetPrimaryKeyColumns(dbName, table string) ([]string, error) {
 	conn, err := mysqld.dbaPool.Get()
@@ -0,0 +1,116 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// These methods manage semi-sync replication. They need the
+// rpl_semi_sync_master and rpl_semi_sync_slave plugins to be loaded.
+// With semi-sync, a master only acknowledges a commit once a slave
+// has received it, so a failover to that slave loses no acknowledged
+// transaction.
+
+// SetSemiSyncEnabled enables or disables the master and slave sides
+// of semi-sync replication. A slave only starts or stops
+// acknowledging when its IO thread connects, so the IO thread is
+// restarted if it is running and the slave side changes.
+func (mysqld *Mysqld) SetSemiSyncEnabled(master, slave bool) error {
+	_, wasSlave, err := mysqld.SemiSyncEnabled()
+	if err != nil {
+		return err
+	}
+
+	cmds := []string{
+		fmt.Sprintf("SET GLOBAL rpl_semi_sync_master_enabled = %v", boolToOnOff(master)),
+		fmt.Sprintf("SET GLOBAL rpl_semi_sync_slave_enabled = %v", boolToOnOff(slave)),
+	}
+	if slave != wasSlave {
+		status, err := mysqld.slaveStatus()
+		switch err {
+		case nil:
+			if status["Slave_IO_Running"] == "Yes" {
+				cmds = append(cmds, "STOP SLAVE IO_THREAD", "START SLAVE IO_THREAD")
+			}
+		case ErrNotSlave:
+		default:
+			return err
+		}
+	}
+	return mysqld.ExecuteSuperQueryList(cmds)
+}
+
+// SemiSyncEnabled returns whether the master and slave sides of
+// semi-sync replication are enabled.
+func (mysqld *Mysqld) SemiSyncEnabled() (master, slave bool, err error) {
+	vars, err := mysqld.fetchVariables("SHOW VARIABLES LIKE 'rpl_semi_sync_%_enabled'")
+	if err != nil {
+		return false, false, err
+	}
+	masterValue, ok := vars["rpl_semi_sync_master_enabled"]
+	if !ok {
+		return false, false, fmt.Errorf("rpl_semi_sync_master plugin is not loaded")
+	}
+	slaveValue, ok := vars["rpl_semi_sync_slave_enabled"]
+	if !ok {
+		return false, false, fmt.Errorf("rpl_semi_sync_slave plugin is not loaded")
+	}
+	return masterValue == "ON", slaveValue == "ON", nil
+}
+
+// SemiSyncStatus returns whether semi-sync replication is in effect on
+// each side. The master side turns itself off when no slave
+// acknowledges a commit in time, until a slave catches up.
+func (mysqld *Mysqld) SemiSyncStatus() (master, slave bool, err error) {
+	vars, err := mysqld.fetchVariables("SHOW STATUS LIKE 'Rpl_semi_sync_%_status'")
+	if err != nil {
+		return false, false, err
+	}
+	return vars["Rpl_semi_sync_master_status"] == "ON", vars["Rpl_semi_sync_slave_status"] == "ON", nil
+}
+
+// SemiSyncClients returns how many semi-sync slaves are connected to
+// the master.
+func (mysqld *Mysqld) SemiSyncClients() (uint32, error) {
+	vars, err := mysqld.fetchVariables("SHOW STATUS LIKE 'Rpl_semi_sync_master_clients'")
+	if err != nil {
+		return 0, err
+	}
+	value, ok := vars["Rpl_semi_sync_master_clients"]
+	if !ok {
+		return 0, fmt.Errorf("rpl_semi_sync_master plugin is not loaded")
+	}
+	clients, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Rpl_semi_sync_master_clients %v: %v", value, err)
+	}
+	return uint32(clients), nil
+}
+
+// fetchVariables runs a SHOW VARIABLES or SHOW STATUS query, and
+// returns the values by name.
+func (mysqld *Mysqld) fetchVariables(query string) (map[string]string, error) {
+	qr, err := mysqld.fetchSuperQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Fields) != 2 {
+		return nil, fmt.Errorf("query %#v returned %d columns, expected 2", query, len(qr.Fields))
+	}
+	result := make(map[string]string, len(qr.Rows))
+	for _, row := range qr.Rows {
+		result[row[0].String()] = row[1].String()
+	}
+	return result, nil
+}
+
+func boolToOnOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
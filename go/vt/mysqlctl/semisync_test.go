@@ -0,0 +1,128 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+const showSemiSyncVariables = "SHOW VARIABLES LIKE 'rpl_semi_sync_%_enabled'"
+
+// variablesResult is the result of SHOW VARIABLES or SHOW STATUS for
+// name, value pairs.
+func variablesResult(pairs ...string) *mproto.QueryResult {
+	qr := &mproto.QueryResult{Fields: []mproto.Field{{Name: "Variable_name"}, {Name: "Value"}}}
+	for i := 0; i < len(pairs); i += 2 {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{
+			sqltypes.MakeString([]byte(pairs[i])),
+			sqltypes.MakeString([]byte(pairs[i+1])),
+		})
+	}
+	return qr
+}
+
+func TestSetSemiSyncEnabled(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		master, slave bool
+		slaveStatus   *mproto.QueryResult
+		want          []string
+	}{
+		{
+			desc:   "master",
+			master: true,
+			want: []string{
+				showSemiSyncVariables,
+				"SET GLOBAL rpl_semi_sync_master_enabled = ON",
+				"SET GLOBAL rpl_semi_sync_slave_enabled = OFF",
+			},
+		},
+		{
+			desc:        "replica, the IO thread reconnects to acknowledge",
+			slave:       true,
+			slaveStatus: runningSlaveStatus(),
+			want: []string{
+				showSemiSyncVariables,
+				"SHOW SLAVE STATUS",
+				"SET GLOBAL rpl_semi_sync_master_enabled = OFF",
+				"SET GLOBAL rpl_semi_sync_slave_enabled = ON",
+				"STOP SLAVE IO_THREAD",
+				"START SLAVE IO_THREAD",
+			},
+		},
+		{
+			desc:  "replica without replication",
+			slave: true,
+			want: []string{
+				showSemiSyncVariables,
+				"SHOW SLAVE STATUS",
+				"SET GLOBAL rpl_semi_sync_master_enabled = OFF",
+				"SET GLOBAL rpl_semi_sync_slave_enabled = ON",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		db := newFakeMysqldDB()
+		db.results[showSemiSyncVariables] = variablesResult("rpl_semi_sync_master_enabled", "OFF", "rpl_semi_sync_slave_enabled", "OFF")
+		if tc.slaveStatus != nil {
+			db.results["SHOW SLAVE STATUS"] = tc.slaveStatus
+		}
+		mysqld := db.newMysqld(&fakeMysqlFlavor{})
+
+		if err := mysqld.SetSemiSyncEnabled(tc.master, tc.slave); err != nil {
+			t.Errorf("%v: SetSemiSyncEnabled failed: %v", tc.desc, err)
+		}
+		if got := db.Queries(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: queries:\n%v\nwant:\n%v", tc.desc, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+		mysqld.Close()
+	}
+}
+
+func TestSemiSyncMissingPlugin(t *testing.T) {
+	db := newFakeMysqldDB()
+	db.results[showSemiSyncVariables] = variablesResult("rpl_semi_sync_master_enabled", "ON")
+	db.results["SHOW STATUS LIKE 'Rpl_semi_sync_master_clients'"] = variablesResult()
+	mysqld := db.newMysqld(&fakeMysqlFlavor{})
+	defer mysqld.Close()
+
+	if _, _, err := mysqld.SemiSyncEnabled(); err == nil || err.Error() != "rpl_semi_sync_slave plugin is not loaded" {
+		t.Errorf("SemiSyncEnabled without the slave plugin: %v", err)
+	}
+	db.Queries()
+
+	// nothing is set if a plugin is missing
+	if err := mysqld.SetSemiSyncEnabled(true, false); err == nil || err.Error() != "rpl_semi_sync_slave plugin is not loaded" {
+		t.Errorf("SetSemiSyncEnabled without the slave plugin: %v", err)
+	}
+	if got, want := db.Queries(), []string{showSemiSyncVariables}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	if _, err := mysqld.SemiSyncClients(); err == nil || err.Error() != "rpl_semi_sync_master plugin is not loaded" {
+		t.Errorf("SemiSyncClients without the master plugin: %v", err)
+	}
+}
+
+func TestSemiSyncStatus(t *testing.T) {
+	db := newFakeMysqldDB()
+	db.results["SHOW STATUS LIKE 'Rpl_semi_sync_%_status'"] = variablesResult("Rpl_semi_sync_master_status", "ON", "Rpl_semi_sync_slave_status", "OFF")
+	db.results["SHOW STATUS LIKE 'Rpl_semi_sync_master_clients'"] = variablesResult("Rpl_semi_sync_master_clients", "2")
+	mysqld := db.newMysqld(&fakeMysqlFlavor{})
+	defer mysqld.Close()
+
+	master, slave, err := mysqld.SemiSyncStatus()
+	if err != nil || !master || slave {
+		t.Errorf("SemiSyncStatus() = %v, %v, %v, want true, false", master, slave, err)
+	}
+	if clients, err := mysqld.SemiSyncClients(); err != nil || clients != 2 {
+		t.Errorf("SemiSyncClients() = %v, %v, want 2", clients, err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+)
+
+// These methods manage the _vt sidecar database, where vitess keeps
+// its own tables. Its schema is versioned: each change is a migration
+// with the next version number, recorded in _vt.schema_version once
+// applied. The migrations are only run on the master, the slaves get
+// them through replication. They are never changed once released,
+// new ones are appended.
+//
+// The first migration creates the tables that were created on demand
+// before, so it only uses IF NOT EXISTS.
+
+// sidecarMigration is one version of the _vt database.
+type sidecarMigration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// sidecarLockTimeout is how long a migration waits for the one that
+// is already running, from another tablet on the same mysqld.
+const sidecarLockTimeout = 30 * time.Second
+
+var sidecarMigrations = []sidecarMigration{
+	{1, "initial tables", append([]string{
+		`CREATE TABLE IF NOT EXISTS _vt.replication_log (
+  time_created_ns BIGINT PRIMARY KEY,
+  note VARCHAR(255))`,
+		`CREATE TABLE IF NOT EXISTS _vt.reparent_log (
+  time_created_ns BIGINT PRIMARY KEY,
+  last_position VARCHAR(255),
+  new_addr VARCHAR(255),
+  new_position VARCHAR(255),
+  wait_position VARCHAR(255),
+  INDEX (last_position))`,
+		`CREATE TABLE IF NOT EXISTS _vt.heartbeat (
+  id INT UNSIGNED NOT NULL,
+  master_uid INT UNSIGNED NOT NULL,
+  time_created_ns BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (id)) ENGINE=InnoDB`,
+		`CREATE TABLE IF NOT EXISTS _vt.redo_log_transaction (
+  dtid VARBINARY(512),
+  state BIGINT,
+  time_created BIGINT,
+  PRIMARY KEY (dtid)) ENGINE=InnoDB`,
+		`CREATE TABLE IF NOT EXISTS _vt.redo_log_statement (
+  dtid VARBINARY(512),
+  id BIGINT,
+  statement MEDIUMBLOB,
+  PRIMARY KEY (dtid, id)) ENGINE=InnoDB`,
+	}, binlogplayer.CreateBlpCheckpoint()...)},
+	{2, "distributed transaction records", []string{
+		`CREATE TABLE _vt.dt_state (
+  dtid VARBINARY(512),
+  state BIGINT,
+  time_created BIGINT,
+  PRIMARY KEY (dtid)) ENGINE=InnoDB`,
+		`CREATE TABLE _vt.dt_participant (
+  dtid VARBINARY(512),
+  id BIGINT,
+  keyspace VARCHAR(256),
+  shard VARCHAR(256),
+  PRIMARY KEY (dtid, id)) ENGINE=InnoDB`,
+	}},
+}
+
+// SidecarVersion returns the version of the _vt database this binary
+// migrates to.
+func SidecarVersion() int {
+	return sidecarMigrations[len(sidecarMigrations)-1].version
+}
+
+// InitSidecarDB creates or migrates the _vt database to
+// SidecarVersion. It does nothing on a read-only mysqld, which gets
+// the migrations from its master: applying them locally would break
+// replication when they are replicated.
+func (mysqld *Mysqld) InitSidecarDB() error {
+	readOnly, err := mysqld.IsReadOnly()
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		log.Infof("MySQL is read-only, not migrating the _vt database")
+		return nil
+	}
+	return mysqld.migrateSidecarDB()
+}
+
+// migrateSidecarDB applies the missing migrations, even on a
+// read-only mysqld.
+func (mysqld *Mysqld) migrateSidecarDB() error {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+
+	// tablets sharing a mysqld could migrate at the same time
+	qr, err := conn.ExecuteFetch(fmt.Sprintf("SELECT GET_LOCK('vt_sidecar_migration', %v)", int(sidecarLockTimeout.Seconds())), 1, false)
+	if err != nil {
+		return err
+	}
+	if len(qr.Rows) != 1 || qr.Rows[0][0].String() != "1" {
+		return fmt.Errorf("cannot lock the _vt database for migration, another one is running")
+	}
+	defer func() {
+		if _, err := conn.ExecuteFetch("SELECT RELEASE_LOCK('vt_sidecar_migration')", 1, false); err != nil {
+			log.Warningf("cannot release the _vt migration lock, closing connection: %v", err)
+			conn.Close()
+		}
+	}()
+
+	for _, sql := range []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		`CREATE TABLE IF NOT EXISTS _vt.schema_version (
+  version INT UNSIGNED NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  time_applied_ns BIGINT UNSIGNED NOT NULL,
+  PRIMARY KEY (version)) ENGINE=InnoDB`,
+	} {
+		if _, err := conn.ExecuteFetch(sql, 0, false); err != nil {
+			return fmt.Errorf("cannot create the _vt database: %v", err)
+		}
+	}
+
+	version, err := sidecarVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > SidecarVersion() {
+		return fmt.Errorf("the _vt database is at version %v, newer than version %v of this binary", version, SidecarVersion())
+	}
+	for _, migration := range sidecarMigrations {
+		if migration.version <= version {
+			continue
+		}
+		log.Infof("Migrating the _vt database to version %v: %v", migration.version, migration.name)
+		if err := applySidecarMigration(conn, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sidecarVersion returns the last version applied to the _vt database,
+// or 0 if it was just created.
+func sidecarVersion(conn dbconnpool.PoolConnection) (int, error) {
+	qr, err := conn.ExecuteFetch("SELECT MAX(version) FROM _vt.schema_version", 1, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(qr.Rows) != 1 || qr.Rows[0][0].IsNull() {
+		return 0, nil
+	}
+	version, err := qr.Rows[0][0].ParseInt64()
+	if err != nil {
+		return 0, err
+	}
+	return int(version), nil
+}
+
+// applySidecarMigration runs the statements of migration, and records
+// it. A migration that fails is tried again the next time.
+func applySidecarMigration(conn dbconnpool.PoolConnection, migration sidecarMigration) error {
+	for _, sql := range migration.statements {
+		if _, err := conn.ExecuteFetch(sql, 0, false); err != nil {
+			return fmt.Errorf("migration of the _vt database to version %v failed: %v: %v", migration.version, sql, err)
+		}
+	}
+	// the version may also be replicated from a master, when
+	// this mysqld was initialized on its own
+	sql := fmt.Sprintf("INSERT IGNORE INTO _vt.schema_version (version, name, time_applied_ns) VALUES (%v, %v, %v)", migration.version, encodeString(migration.name), time.Now().UnixNano())
+	if _, err := conn.ExecuteFetch(sql, 0, false); err != nil {
+		return fmt.Errorf("cannot record the migration of the _vt database to version %v: %v", migration.version, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"testing"
+)
+
+func TestSidecarMigrationVersions(t *testing.T) {
+	for i, migration := range sidecarMigrations {
+		if migration.version != i+1 {
+			t.Errorf("migration %v has version %v, want %v", migration.name, migration.version, i+1)
+		}
+		if len(migration.statements) == 0 {
+			t.Errorf("migration %v has no statement", migration.name)
+		}
+	}
+	if got, want := SidecarVersion(), len(sidecarMigrations); got != want {
+		t.Errorf("SidecarVersion() = %v, want %v", got, want)
+	}
+}
@@ -105,6 +105,15 @@ func (sc *SlaveConnection) StartBinlogDump(startPos proto.GTID) (<-chan blproto.
 	return eventChan, nil
 }
 
+// enableBinlogChecksum tells the master that the slave connection can handle
+// binlog checksums, by setting @master_binlog_checksum to the algorithm the
+// master uses. Otherwise, the master refuses to dump events that have
+// checksums. This is only for the flavors that support binlog_checksum.
+func (sc *SlaveConnection) enableBinlogChecksum() error {
+	_, err := sc.ExecuteFetch("SET @master_binlog_checksum = @@global.binlog_checksum", 0, false)
+	return err
+}
+
 // Close closes the slave connection, which also signals an ongoing dump
 // started with StartBinlogDump() to stop and close its BinlogEvent channel.
 // The ID for the slave connection is recycled back into the pool.
@@ -0,0 +1,170 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var snapshotLockWaitTimeout = flag.Duration("snapshot_lock_wait_timeout", 30*time.Second, "how long opening consistent snapshot connections waits for the running statements to flush the tables")
+
+// SnapshotConnections is a set of connections that all see the same
+// consistent snapshot of the database, taken at a known replication
+// position. Parallel copies of the chunks of tables can share them to
+// read a single point-in-time view, without stopping replication or
+// writes for longer than it takes to open them.
+//
+// Only InnoDB tables are consistent. The connections are in a
+// transaction, they should only be used to read.
+type SnapshotConnections struct {
+	// ReplicationPosition is the position of the snapshot: for a
+	// master its own position, for a slave the position on its
+	// master.
+	ReplicationPosition *proto.ReplicationPosition
+
+	// MasterAddr is the address of the server ReplicationPosition
+	// is on.
+	MasterAddr string
+
+	all   []dbconnpool.PoolConnection
+	conns chan dbconnpool.PoolConnection
+}
+
+// NewSnapshotConnections opens count connections sharing one
+// consistent snapshot. The writes are blocked with FLUSH TABLES WITH
+// READ LOCK while the position is read and the transactions are
+// started, so they all start at that position. count is capped below
+// the size of the dba pool, which needs connections left to take the
+// lock and read the position. Close needs to be called on the result.
+func (mysqld *Mysqld) NewSnapshotConnections(count int) (*SnapshotConnections, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid number of snapshot connections: %v", count)
+	}
+	// the read lock and the position queries need a connection each
+	if capacity := int(mysqld.dbaPool.Capacity()); count > capacity-2 {
+		if capacity < 3 {
+			return nil, fmt.Errorf("dba pool of size %v is too small for snapshot connections", capacity)
+		}
+		log.Infof("Capping %v snapshot connections to %v, below the dba pool size", count, capacity-2)
+		count = capacity - 2
+	}
+	sc := &SnapshotConnections{
+		all:   make([]dbconnpool.PoolConnection, 0, count),
+		conns: make(chan dbconnpool.PoolConnection, count),
+	}
+	for i := 0; i < count; i++ {
+		conn, err := mysqld.dbaPool.Get()
+		if err != nil {
+			sc.Close()
+			return nil, err
+		}
+		sc.all = append(sc.all, conn)
+		if _, err := conn.ExecuteFetch("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ", 10000, false); err != nil {
+			sc.Close()
+			return nil, err
+		}
+	}
+
+	if err := mysqld.startSnapshotTransactions(sc); err != nil {
+		sc.Close()
+		return nil, err
+	}
+	for _, conn := range sc.all {
+		sc.conns <- conn
+	}
+	log.Infof("Opened %v snapshot connections at %v", count, sc.ReplicationPosition.MapKey())
+	return sc, nil
+}
+
+// startSnapshotTransactions reads the replication position and starts
+// the transactions of sc while the writes are blocked.
+func (mysqld *Mysqld) startSnapshotTransactions(sc *SnapshotConnections) (err error) {
+	lockConn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return err
+	}
+	defer lockConn.Recycle()
+
+	if _, err := lockConn.ExecuteFetch(fmt.Sprintf("SET SESSION lock_wait_timeout = %v", int(snapshotLockWaitTimeout.Seconds())), 10000, false); err != nil {
+		return err
+	}
+	defer func() {
+		// the connection goes back to the pool, restore the timeout
+		if _, err := lockConn.ExecuteFetch("SET SESSION lock_wait_timeout = DEFAULT", 10000, false); err != nil {
+			log.Warningf("cannot restore lock_wait_timeout, closing connection: %v", err)
+			lockConn.Close()
+		}
+	}()
+
+	if _, err := lockConn.ExecuteFetch("FLUSH TABLES WITH READ LOCK", 10000, false); err != nil {
+		return err
+	}
+	defer func() {
+		if _, unlockErr := lockConn.ExecuteFetch("UNLOCK TABLES", 10000, false); unlockErr != nil {
+			log.Warningf("cannot unlock tables, closing connection: %v", unlockErr)
+			lockConn.Close()
+		}
+	}()
+
+	// the SQL thread of a slave is blocked too, so the position
+	// doesn't move
+	sc.ReplicationPosition, sc.MasterAddr, err = mysqld.getReplicationPositionForClones(false)
+	if err != nil {
+		return err
+	}
+	for _, conn := range sc.all {
+		if _, err := conn.ExecuteFetch("START TRANSACTION WITH CONSISTENT SNAPSHOT", 10000, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns one of the connections, waiting for one to be available.
+// Put needs to be called on the result.
+func (sc *SnapshotConnections) Get() dbconnpool.PoolConnection {
+	return <-sc.conns
+}
+
+// Put returns a connection from Get.
+func (sc *SnapshotConnections) Put(conn dbconnpool.PoolConnection) {
+	sc.conns <- conn
+}
+
+// ExecuteFetch runs query on one of the connections.
+func (sc *SnapshotConnections) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	conn := sc.Get()
+	defer sc.Put(conn)
+	return conn.ExecuteFetch(query, maxrows, wantfields)
+}
+
+// Close ends the transactions, and returns the connections to the
+// pool. All the connections need to have been returned with Put.
+func (sc *SnapshotConnections) Close() {
+	for _, conn := range sc.all {
+		releaseSnapshotConn(conn)
+	}
+	sc.all = nil
+}
+
+// releaseSnapshotConn ends the transaction of conn and restores the
+// isolation level it was given, before it goes back to the pool.
+func releaseSnapshotConn(conn dbconnpool.PoolConnection) {
+	for _, query := range []string{"ROLLBACK", "SET SESSION tx_isolation = DEFAULT"} {
+		if _, err := conn.ExecuteFetch(query, 10000, false); err != nil {
+			log.Warningf("cannot reset snapshot connection, closing it: %v", err)
+			conn.Close()
+			break
+		}
+	}
+	conn.Recycle()
+}
@@ -0,0 +1,213 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+)
+
+// fakeSnapshotConn is a PoolConnection that records the queries it
+// runs, and answers SHOW SLAVE STATUS as a slave of master:3306.
+type fakeSnapshotConn struct {
+	id      int64
+	closed  bool
+	pool    *dbconnpool.ConnectionPool
+	log     *fakeSnapshotLog
+	failOn  string
+	queries []string
+}
+
+// fakeSnapshotLog is shared by the connections of a pool.
+type fakeSnapshotLog struct {
+	mu     sync.Mutex
+	nextId int64
+	conns  []*fakeSnapshotConn
+}
+
+func (fc *fakeSnapshotConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	fc.log.mu.Lock()
+	defer fc.log.mu.Unlock()
+	fc.queries = append(fc.queries, query)
+	if query == fc.failOn {
+		return nil, &fakeSnapshotError{query}
+	}
+	if query != "SHOW SLAVE STATUS" {
+		return &mproto.QueryResult{}, nil
+	}
+	row := make([]sqltypes.Value, len(showSlaveStatusColumnNames))
+	for i, name := range showSlaveStatusColumnNames {
+		var value string
+		switch name {
+		case "Master_Host":
+			value = "master"
+		case "Master_Port":
+			value = "3306"
+		case "Relay_Master_Log_File":
+			value = "vt-bin.000001"
+		case "Exec_Master_Log_Pos":
+			value = "120"
+		}
+		row[i] = sqltypes.MakeString([]byte(value))
+	}
+	return &mproto.QueryResult{Rows: [][]sqltypes.Value{row}}, nil
+}
+
+func (fc *fakeSnapshotConn) ExecuteStreamFetch(query string, callback func(*mproto.QueryResult) error, streamBufferSize, streamBufferRows int) error {
+	return nil
+}
+
+func (fc *fakeSnapshotConn) Id() int64      { return fc.id }
+func (fc *fakeSnapshotConn) Close()         { fc.closed = true }
+func (fc *fakeSnapshotConn) IsClosed() bool { return fc.closed }
+
+func (fc *fakeSnapshotConn) Recycle() {
+	if fc.closed {
+		fc.pool.Put(nil)
+	} else {
+		fc.pool.Put(fc)
+	}
+}
+
+type fakeSnapshotError struct {
+	query string
+}
+
+func (e *fakeSnapshotError) Error() string { return "cannot run " + e.query }
+
+// newFakeSnapshotMysqld returns a Mysqld with a dba pool of size
+// capacity, whose connections fail on failOn.
+func newFakeSnapshotMysqld(capacity int, failOn string) (*Mysqld, *fakeSnapshotLog) {
+	log := &fakeSnapshotLog{}
+	pool := dbconnpool.NewConnectionPool("", capacity, time.Minute)
+	pool.Open(func(pool *dbconnpool.ConnectionPool) (dbconnpool.PoolConnection, error) {
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		log.nextId++
+		fc := &fakeSnapshotConn{id: log.nextId, pool: pool, log: log, failOn: failOn}
+		log.conns = append(log.conns, fc)
+		return fc, nil
+	})
+	return &Mysqld{flavor: &fakeMysqlFlavor{}, dbaPool: pool}, log
+}
+
+func TestSnapshotConnections(t *testing.T) {
+	mysqld, log := newFakeSnapshotMysqld(10, "")
+	defer mysqld.Close()
+
+	sc, err := mysqld.NewSnapshotConnections(3)
+	if err != nil {
+		t.Fatalf("NewSnapshotConnections failed: %v", err)
+	}
+	if got, want := sc.ReplicationPosition.MapKey(), "vt-bin.000001:120"; got != want {
+		t.Errorf("ReplicationPosition = %v, want %v", got, want)
+	}
+	if got, want := sc.MasterAddr, "master:3306"; got != want {
+		t.Errorf("MasterAddr = %v, want %v", got, want)
+	}
+	if _, err := sc.ExecuteFetch("select 1", 10, false); err != nil {
+		t.Errorf("ExecuteFetch failed: %v", err)
+	}
+	sc.Close()
+
+	if got := mysqld.dbaPool.Available(); got != 10 {
+		t.Errorf("Available() = %v, want 10", got)
+	}
+	var snapshotConns int
+	for _, fc := range log.conns {
+		if len(fc.queries) == 0 || fc.queries[0] != "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ" {
+			continue
+		}
+		snapshotConns++
+		want := []string{
+			"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			"START TRANSACTION WITH CONSISTENT SNAPSHOT",
+		}
+		got := fc.queries
+		if len(got) == 5 {
+			// the connection ExecuteFetch used
+			want = append(want, "select 1")
+		}
+		want = append(want, "ROLLBACK", "SET SESSION tx_isolation = DEFAULT")
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("queries of snapshot connection %v = %#v, want %#v", fc.id, got, want)
+		}
+		if fc.closed {
+			t.Errorf("snapshot connection %v was closed", fc.id)
+		}
+	}
+	if snapshotConns != 3 {
+		t.Errorf("got %v snapshot connections, want 3", snapshotConns)
+	}
+}
+
+func TestSnapshotConnectionsCapped(t *testing.T) {
+	mysqld, _ := newFakeSnapshotMysqld(4, "")
+	defer mysqld.Close()
+
+	// the pool needs connections left to take the read lock and
+	// read the position
+	sc, err := mysqld.NewSnapshotConnections(5)
+	if err != nil {
+		t.Fatalf("NewSnapshotConnections failed: %v", err)
+	}
+	if got := len(sc.all); got != 2 {
+		t.Errorf("got %v snapshot connections, want 2", got)
+	}
+	sc.Close()
+
+	mysqld, _ = newFakeSnapshotMysqld(2, "")
+	defer mysqld.Close()
+	if _, err := mysqld.NewSnapshotConnections(1); err == nil {
+		t.Errorf("NewSnapshotConnections with a dba pool of size 2 succeeded")
+	}
+	if _, err := mysqld.NewSnapshotConnections(0); err == nil {
+		t.Errorf("NewSnapshotConnections(0) succeeded")
+	}
+}
+
+func TestSnapshotConnectionsReset(t *testing.T) {
+	mysqld, log := newFakeSnapshotMysqld(10, "SET SESSION tx_isolation = DEFAULT")
+	defer mysqld.Close()
+
+	sc, err := mysqld.NewSnapshotConnections(2)
+	if err != nil {
+		t.Fatalf("NewSnapshotConnections failed: %v", err)
+	}
+	sc.Close()
+
+	// the connections whose session couldn't be reset don't go back
+	// to the pool
+	var closed int
+	for _, fc := range log.conns {
+		if fc.closed {
+			closed++
+		}
+	}
+	if closed != 2 {
+		t.Errorf("got %v closed connections, want 2", closed)
+	}
+	if got := mysqld.dbaPool.Available(); got != 10 {
+		t.Errorf("Available() = %v, want 10", got)
+	}
+}
+
+func TestSnapshotConnectionsStartFailure(t *testing.T) {
+	mysqld, _ := newFakeSnapshotMysqld(10, "START TRANSACTION WITH CONSISTENT SNAPSHOT")
+	defer mysqld.Close()
+
+	if _, err := mysqld.NewSnapshotConnections(2); err == nil {
+		t.Fatalf("NewSnapshotConnections succeeded")
+	}
+	if got := mysqld.dbaPool.Available(); got != 10 {
+		t.Errorf("Available() = %v, want 10", got)
+	}
+}
@@ -391,7 +391,7 @@ func (nhw *namedHasherWriter) SnapshotFiles() ([]SnapshotFile, error) {
 
 // dumpTableSplit will dump a table, and then split it according to keyspace_id
 // into multiple files.
-func (mysqld *Mysqld) dumpTableSplit(td proto.TableDefinition, dbName, keyName string, keyType key.KeyspaceIdType, mainCloneSourcePath string, cloneSourcePaths map[key.KeyRange]string, maximumFilesize uint64) (map[key.KeyRange][]SnapshotFile, error) {
+func (mysqld *Mysqld) dumpTableSplit(sc *SnapshotConnections, td proto.TableDefinition, dbName, keyName string, keyType key.KeyspaceIdType, mainCloneSourcePath string, cloneSourcePaths map[key.KeyRange]string, maximumFilesize uint64) (map[key.KeyRange][]SnapshotFile, error) {
 	filename := path.Join(mainCloneSourcePath, td.Name+".csv")
 	selectIntoOutfile := `SELECT {{.KeyspaceIdColumnName}}, {{.Columns}} INTO OUTFILE "{{.TableOutputPath}}" CHARACTER SET binary FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' FROM {{.TableName}}`
 	queryParams := map[string]string{
@@ -409,7 +409,7 @@ func (mysqld *Mysqld) dumpTableSplit(td proto.TableDefinition, dbName, keyName s
 	if err != nil {
 		return nil, err
 	}
-	if err := mysqld.ExecuteSuperQuery(sio); err != nil {
+	if _, err := sc.ExecuteFetch(sio, 0, false); err != nil {
 		return nil, err
 	}
 
@@ -468,7 +468,7 @@ func (mysqld *Mysqld) dumpTableSplit(td proto.TableDefinition, dbName, keyName s
 
 // dumpTableFull will dump the contents of a full table, and then
 // chunk it up in multiple compressed files.
-func (mysqld *Mysqld) dumpTableFull(td proto.TableDefinition, dbName, mainCloneSourcePath string, cloneSourcePath string, maximumFilesize uint64) ([]SnapshotFile, error) {
+func (mysqld *Mysqld) dumpTableFull(sc *SnapshotConnections, td proto.TableDefinition, dbName, mainCloneSourcePath string, cloneSourcePath string, maximumFilesize uint64) ([]SnapshotFile, error) {
 	filename := path.Join(mainCloneSourcePath, td.Name+".csv")
 	selectIntoOutfile := `SELECT {{.Columns}} INTO OUTFILE "{{.TableOutputPath}}" CHARACTER SET binary FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' FROM {{.TableName}}`
 	queryParams := map[string]string{
@@ -480,7 +480,7 @@ func (mysqld *Mysqld) dumpTableFull(td proto.TableDefinition, dbName, mainCloneS
 	if err != nil {
 		return nil, err
 	}
-	if err := mysqld.ExecuteSuperQuery(sio); err != nil {
+	if _, err := sc.ExecuteFetch(sio, 0, false); err != nil {
 		return nil, err
 	}
 
@@ -593,7 +593,13 @@ func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyN
 		err = replaceError(err, mysqld.restoreAfterSnapshot(slaveStartRequired, readOnly, hookExtraEnv))
 	}()
 
-	// dump the files in parallel with a pre-defined concurrency
+	// dump the files in parallel with a pre-defined concurrency, on
+	// connections sharing a consistent snapshot
+	sc, err := mysqld.NewSnapshotConnections(snapshotConcurrency)
+	if err != nil {
+		return
+	}
+	defer sc.Close()
 	datafiles := make([]map[key.KeyRange][]SnapshotFile, len(sd.TableDefinitions))
 	dumpTableWorker := func(i int) (err error) {
 		table := sd.TableDefinitions[i]
@@ -602,7 +608,7 @@ func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyN
 			return nil
 		}
 		if len(tables) > 0 {
-			sfs, err := mysqld.dumpTableFull(table, dbName, mainCloneSourcePath, cloneSourcePaths[key.KeyRange{}], maximumFilesize)
+			sfs, err := mysqld.dumpTableFull(sc, table, dbName, mainCloneSourcePath, cloneSourcePaths[key.KeyRange{}], maximumFilesize)
 			if err != nil {
 				return err
 			}
@@ -610,7 +616,7 @@ func (mysqld *Mysqld) CreateMultiSnapshot(keyRanges []key.KeyRange, dbName, keyN
 				key.KeyRange{}: sfs,
 			}
 		} else {
-			datafiles[i], err = mysqld.dumpTableSplit(table, dbName, keyName, keyType, mainCloneSourcePath, cloneSourcePaths, maximumFilesize)
+			datafiles[i], err = mysqld.dumpTableSplit(sc, table, dbName, keyName, keyType, mainCloneSourcePath, cloneSourcePaths, maximumFilesize)
 		}
 		return
 	}
@@ -0,0 +1,183 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+)
+
+var usersFile = flag.String("mysql_users_file", "", "JSON file with the list of MySQL users to create or update at init time (see UserConfig)")
+
+// UserConfig describes a MySQL user and the grants it should have.
+// A users file is a JSON list of them, like:
+//   [{"Name": "vt_app", "Password": "secret", "Grants": ["SELECT, INSERT ON *.*"]}]
+type UserConfig struct {
+	Name string
+
+	// Host defaults to localhost
+	Host string
+
+	// Password is not changed if empty
+	Password string
+
+	// Grants are the privileges and what they apply to, like
+	// "SELECT, INSERT ON *.*" or "ALL ON vt_test_keyspace.*"
+	Grants []string
+
+	// GrantOption allows the user to grant its privileges
+	GrantOption bool
+}
+
+// userStatements returns the statements that create or update a user.
+// GRANT creates the user if needed, and only adds privileges: the
+// extra privileges of an existing user are not revoked.
+func (u *UserConfig) userStatements() []string {
+	grants := u.Grants
+	if len(grants) == 0 {
+		// just create the user, or change its password
+		grants = []string{"USAGE ON *.*"}
+	}
+
+	host := u.Host
+	if host == "" {
+		host = "localhost"
+	}
+	suffix := fmt.Sprintf(" TO %v@%v", encodeString(u.Name), encodeString(host))
+	if u.Password != "" {
+		suffix += " IDENTIFIED BY " + encodeString(u.Password)
+	}
+	if u.GrantOption {
+		suffix += " WITH GRANT OPTION"
+	}
+
+	result := make([]string, len(grants))
+	for i, grant := range grants {
+		result[i] = "GRANT " + grant + suffix
+	}
+	return result
+}
+
+func encodeString(s string) string {
+	buf := bytes.NewBuffer(nil)
+	sqltypes.MakeString([]byte(s)).EncodeSql(buf)
+	return buf.String()
+}
+
+// DefaultUsers returns the users vitess needs, with the names and
+// passwords of the db configs. Only the dba and repl users have
+// administrative privileges, the app and filtered users only have
+// privileges on the keyspace databases, vt_<keyspace> or the db name
+// of the app config, and on the _vt database.
+func DefaultUsers(dbcfgs *dbconfigs.DBConfigs) []*UserConfig {
+	dbs := []string{"`vt\\_%`", "`_vt`"}
+	if dbcfgs.App.DbName != "" {
+		dbs = append(dbs, grantDatabase(dbcfgs.App.DbName))
+	}
+	onDbs := func(privileges string) []string {
+		grants := make([]string, len(dbs))
+		for i, db := range dbs {
+			grants[i] = privileges + " ON " + db + ".*"
+		}
+		return grants
+	}
+	return []*UserConfig{
+		&UserConfig{
+			Name:        dbcfgs.Dba.Uname,
+			Password:    dbcfgs.Dba.Pass,
+			Grants:      []string{"ALL ON *.*"},
+			GrantOption: true,
+		},
+		&UserConfig{
+			Name:     dbcfgs.App.Uname,
+			Password: dbcfgs.App.Pass,
+			Grants:   onDbs("SELECT, INSERT, UPDATE, DELETE, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE"),
+		},
+		&UserConfig{
+			Name:     dbcfgs.Filtered.Uname,
+			Password: dbcfgs.Filtered.Pass,
+			Grants:   onDbs("SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER"),
+		},
+		&UserConfig{
+			Name:     dbcfgs.Repl.Uname,
+			Password: dbcfgs.Repl.Pass,
+			Grants:   []string{"REPLICATION SLAVE ON *.*"},
+		},
+	}
+}
+
+// grantDatabase quotes a database name for GRANT, where _ and % are
+// wildcards.
+func grantDatabase(name string) string {
+	name = strings.Replace(name, "`", "``", -1)
+	name = strings.Replace(name, "_", "\\_", -1)
+	name = strings.Replace(name, "%", "\\%", -1)
+	return "`" + name + "`"
+}
+
+// ReadUsersFile reads a JSON list of UserConfig.
+func ReadUsersFile(filename string) ([]*UserConfig, error) {
+	var users []*UserConfig
+	if err := jscfg.ReadJson(filename, &users); err != nil {
+		return nil, err
+	}
+	for i, u := range users {
+		if u.Name == "" {
+			return nil, fmt.Errorf("user %v in %v has no Name", i, filename)
+		}
+	}
+	return users, nil
+}
+
+// ApplyUsers creates or updates the given users. The statements are
+// not written to the binlogs, so each instance manages its own users.
+func (mysqld *Mysqld) ApplyUsers(users []*UserConfig) error {
+	conn, err := mysqld.dbaPool.Get()
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+
+	if _, err := conn.ExecuteFetch("SET sql_log_bin = 0", 10000, false); err != nil {
+		return err
+	}
+	defer func() {
+		// the connection goes back to the pool, restore the binlogs
+		if _, err := conn.ExecuteFetch("SET sql_log_bin = 1", 10000, false); err != nil {
+			log.Warningf("cannot restore sql_log_bin, closing connection: %v", err)
+			conn.Close()
+		}
+	}()
+
+	for _, u := range users {
+		// the statements may contain a password, don't log them
+		log.Infof("applying grants for MySQL user %v: %v", u.Name, strings.Join(u.Grants, "; "))
+		for _, query := range u.userStatements() {
+			if _, err := conn.ExecuteFetch(query, 10000, false); err != nil {
+				return fmt.Errorf("cannot apply grants for MySQL user %v: %v", u.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyUsersFile applies the mysql_users_file if set.
+func (mysqld *Mysqld) applyUsersFile() error {
+	if *usersFile == "" {
+		return nil
+	}
+	users, err := ReadUsersFile(*usersFile)
+	if err != nil {
+		return err
+	}
+	return mysqld.ApplyUsers(users)
+}
@@ -0,0 +1,99 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/vt/dbconfigs"
+)
+
+func TestUserStatements(t *testing.T) {
+	cases := []struct {
+		user *UserConfig
+		want []string
+	}{
+		{
+			user: &UserConfig{Name: "vt_repl"},
+			want: []string{"GRANT USAGE ON *.* TO 'vt_repl'@'localhost'"},
+		},
+		{
+			user: &UserConfig{Name: "vt_app", Host: "%", Password: "it's", Grants: []string{"SELECT ON *.*", "ALL ON vt_test.*"}},
+			want: []string{
+				"GRANT SELECT ON *.* TO 'vt_app'@'%' IDENTIFIED BY 'it\\'s'",
+				"GRANT ALL ON vt_test.* TO 'vt_app'@'%' IDENTIFIED BY 'it\\'s'",
+			},
+		},
+		{
+			user: &UserConfig{Name: "vt_dba", Grants: []string{"ALL ON *.*"}, GrantOption: true},
+			want: []string{"GRANT ALL ON *.* TO 'vt_dba'@'localhost' WITH GRANT OPTION"},
+		},
+	}
+	for _, c := range cases {
+		if got := c.user.userStatements(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("userStatements(%#v) = %#v, want %#v", c.user, got, c.want)
+		}
+	}
+}
+
+func TestDefaultUsers(t *testing.T) {
+	dbcfgs := &dbconfigs.DBConfigs{
+		App:      dbconfigs.DBConfig{ConnectionParams: mysql.ConnectionParams{Uname: "vt_app", DbName: "my_db"}},
+		Dba:      mysql.ConnectionParams{Uname: "vt_dba"},
+		Filtered: mysql.ConnectionParams{Uname: "vt_filtered"},
+		Repl:     mysql.ConnectionParams{Uname: "vt_repl"},
+	}
+	want := map[string][]string{
+		"vt_dba": []string{"ALL ON *.*"},
+		"vt_app": []string{
+			"SELECT, INSERT, UPDATE, DELETE, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE ON `vt\\_%`.*",
+			"SELECT, INSERT, UPDATE, DELETE, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE ON `_vt`.*",
+			"SELECT, INSERT, UPDATE, DELETE, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE ON `my\\_db`.*",
+		},
+		"vt_filtered": []string{
+			"SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER ON `vt\\_%`.*",
+			"SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER ON `_vt`.*",
+			"SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, ALTER ON `my\\_db`.*",
+		},
+		"vt_repl": []string{"REPLICATION SLAVE ON *.*"},
+	}
+	users := DefaultUsers(dbcfgs)
+	if len(users) != len(want) {
+		t.Fatalf("DefaultUsers returned %v users, want %v", len(users), len(want))
+	}
+	for _, u := range users {
+		if !reflect.DeepEqual(u.Grants, want[u.Name]) {
+			t.Errorf("grants of %v = %#v, want %#v", u.Name, u.Grants, want[u.Name])
+		}
+		if u.GrantOption != (u.Name == "vt_dba") {
+			t.Errorf("grant option of %v = %v", u.Name, u.GrantOption)
+		}
+	}
+}
+
+func TestReadUsersFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "users")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`[{"Name": "vt_app", "Password": "secret", "Grants": ["SELECT ON *.*"]}, {"Host": "%"}]`)
+	f.Close()
+
+	if _, err := ReadUsersFile(f.Name()); err == nil {
+		t.Errorf("ReadUsersFile with a user without name didn't fail")
+	}
+
+	ioutil.WriteFile(f.Name(), []byte(`[{"Name": "vt_app", "Password": "secret", "Grants": ["SELECT ON *.*"]}]`), 0600)
+	users, err := ReadUsersFile(f.Name())
+	want := []*UserConfig{&UserConfig{Name: "vt_app", Password: "secret", Grants: []string{"SELECT ON *.*"}}}
+	if err != nil || !reflect.DeepEqual(users, want) {
+		t.Errorf("ReadUsersFile() = %v, %v, want %v", users, err, want)
+	}
+}
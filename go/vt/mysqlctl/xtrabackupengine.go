@@ -0,0 +1,299 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/cgzip"
+	"github.com/youtube/vitess/go/vt/mysqlctl/backupstorage"
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+var (
+	xtrabackupRootPath    = flag.String("xtrabackup_root_path", "", "directory of the xtrabackup and xbstream binaries (empty to find them in $PATH)")
+	xtrabackupBackupFlags = flag.String("xtrabackup_backup_flags", "", "additional flags for xtrabackup --backup, separated by spaces")
+)
+
+const (
+	// xbstreamFile is the only file of an xtrabackup backup: the
+	// compressed output of xtrabackup --stream=xbstream.
+	xbstreamFile = "xbstream"
+
+	// the files where xtrabackup records the replication position
+	xtrabackupBinlogInfo = "xtrabackup_binlog_info"
+	xtrabackupSlaveInfo  = "xtrabackup_slave_info"
+
+	// xtrabackupOutputTail is how much of the output of a failed
+	// xtrabackup command is kept in the error.
+	xtrabackupOutputTail = 4096
+)
+
+// XtrabackupEngine encapsulates the logic of the xtrabackup engine,
+// which takes hot backups with xtrabackup while mysqld keeps running
+// and replicating.
+type XtrabackupEngine struct {
+}
+
+// xtrabackupBinary returns the path of an xtrabackup binary.
+func xtrabackupBinary(name string) string {
+	if *xtrabackupRootPath == "" {
+		return name
+	}
+	return path.Join(*xtrabackupRootPath, name)
+}
+
+// runXtrabackupCommand runs a command, and returns the end of its
+// output in the error if it fails.
+func runXtrabackupCommand(cmd *exec.Cmd) error {
+	output := &bytes.Buffer{}
+	cmd.Stderr = output
+	if cmd.Stdout == nil {
+		cmd.Stdout = output
+	}
+	log.Infof("running %v", cmd.Args[:2])
+	if err := cmd.Run(); err != nil {
+		out := output.Bytes()
+		if len(out) > xtrabackupOutputTail {
+			out = out[len(out)-xtrabackupOutputTail:]
+		}
+		return fmt.Errorf("%v %v failed: %v, output: %s", cmd.Args[0], cmd.Args[1], err, out)
+	}
+	return nil
+}
+
+// ExecuteBackup is part of the BackupEngine interface. It streams the
+// output of xtrabackup, compressed, to the backup. The replication
+// position is recorded by xtrabackup in the stream, and only read
+// at restore time.
+func (be *XtrabackupEngine) ExecuteBackup(mysqld *Mysqld, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (*BackupManifest, error) {
+	_, err := mysqld.slaveStatus()
+	isSlave := err == nil
+	if err != nil && err != ErrNotSlave {
+		return nil, err
+	}
+
+	tmpDir, err := ioutil.TempDir(mysqld.TabletDir, "xtrabackup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{
+		"--defaults-file=" + mysqld.config.path,
+		"--backup",
+		"--stream=xbstream",
+		"--target-dir=" + tmpDir,
+		fmt.Sprintf("--parallel=%v", backupConcurrency),
+		"--socket=" + mysqld.config.SocketFile,
+		"--user=" + mysqld.dba.Uname,
+	}
+	if mysqld.dba.Pass != "" {
+		args = append(args, "--password="+mysqld.dba.Pass)
+	}
+	if isSlave {
+		// record the position on the master, not only ours
+		args = append(args, "--slave-info")
+	}
+	args = append(args, strings.Fields(*xtrabackupBackupFlags)...)
+
+	// xtrabackup -> gzip -> buffer -> backup file
+	wc, err := bh.AddFile(xbstreamFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot add file: %v", err)
+	}
+	defer wc.Close()
+	dst := bufio.NewWriterSize(wc, 2*1024*1024)
+	gzip, err := cgzip.NewWriterLevel(dst, cgzip.Z_BEST_SPEED)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gziper: %v", err)
+	}
+
+	cmd := exec.Command(xtrabackupBinary("xtrabackup"), args...)
+	cmd.Stdout = gzip
+	if err := runXtrabackupCommand(cmd); err != nil {
+		return nil, err
+	}
+
+	if err := gzip.Close(); err != nil {
+		return nil, fmt.Errorf("cannot close gzip: %v", err)
+	}
+	if err := dst.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot flush dst: %v", err)
+	}
+	if err := wc.Close(); err != nil {
+		return nil, fmt.Errorf("cannot close %v: %v", xbstreamFile, err)
+	}
+
+	return &BackupManifest{
+		BackupMethod: xtrabackup,
+	}, nil
+}
+
+// ExecuteRestore is part of the BackupEngine interface. It extracts
+// the stream in a temporary directory, prepares it, reads the
+// replication position, and moves the files in place.
+func (be *XtrabackupEngine) ExecuteRestore(mysqld *Mysqld, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, checkPosition func(*proto.ReplicationPosition) error) (*proto.ReplicationPosition, error) {
+	tmpDir, err := ioutil.TempDir(mysqld.TabletDir, "xtrabackup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// backup file -> gunzip -> xbstream
+	log.Infof("Restore: extracting the backup")
+	rc, err := bh.ReadFile(xbstreamFile)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	gz, err := cgzip.NewReader(rc)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	cmd := exec.Command(xtrabackupBinary("xbstream"), "-x", "-C", tmpDir, fmt.Sprintf("--parallel=%v", restoreConcurrency))
+	cmd.Stdin = gz
+	if err := runXtrabackupCommand(cmd); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Restore: preparing the backup")
+	cmd = exec.Command(xtrabackupBinary("xtrabackup"), "--defaults-file="+mysqld.config.path, "--prepare", "--target-dir="+tmpDir)
+	if err := runXtrabackupCommand(cmd); err != nil {
+		return nil, err
+	}
+
+	rp, err := findXtrabackupPosition(tmpDir, mysqld.flavor.ParseGTID)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Restore: using replication position: %#v", rp)
+	if checkPosition != nil {
+		if err := checkPosition(rp); err != nil {
+			return nil, err
+		}
+	}
+
+	// xtrabackup only moves the files to empty directories
+	log.Infof("Restore: moving the files in place")
+	for _, dir := range []string{mysqld.config.DataDir, mysqld.config.InnodbDataHomeDir, mysqld.config.InnodbLogGroupHomeDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			return nil, err
+		}
+	}
+	cmd = exec.Command(xtrabackupBinary("xtrabackup"), "--defaults-file="+mysqld.config.path, "--move-back", "--target-dir="+tmpDir)
+	if err := runXtrabackupCommand(cmd); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// findXtrabackupPosition reads the replication position of a
+// prepared backup. The position on the master, in
+// xtrabackup_slave_info, is used for a backup of a slave. Otherwise
+// the backup is from a master, and its own position is in
+// xtrabackup_binlog_info.
+func findXtrabackupPosition(dir string, parseGTID func(string) (proto.GTID, error)) (*proto.ReplicationPosition, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, xtrabackupSlaveInfo))
+	if err == nil && len(bytes.TrimSpace(data)) > 0 {
+		return parseXtrabackupSlaveInfo(string(data), parseGTID)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err = ioutil.ReadFile(path.Join(dir, xtrabackupBinlogInfo))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the replication position of the backup: %v", err)
+	}
+	return parseXtrabackupBinlogInfo(string(data), parseGTID)
+}
+
+var (
+	slaveInfoLogFile = regexp.MustCompile(`(?i)MASTER_LOG_FILE\s*=\s*'([^']*)'`)
+	slaveInfoLogPos  = regexp.MustCompile(`(?i)MASTER_LOG_POS\s*=\s*(\d+)`)
+	slaveInfoGTID    = regexp.MustCompile(`(?i)(?:gtid_purged|gtid_slave_pos)\s*=\s*'([^']*)'`)
+)
+
+// parseXtrabackupSlaveInfo parses the statements xtrabackup writes to
+// xtrabackup_slave_info, like:
+//   CHANGE MASTER TO MASTER_LOG_FILE='vt-bin.000003', MASTER_LOG_POS=1194
+// or, with GTIDs:
+//   SET GLOBAL gtid_slave_pos = '0-41983-5'; CHANGE MASTER TO master_use_gtid = slave_pos
+func parseXtrabackupSlaveInfo(data string, parseGTID func(string) (proto.GTID, error)) (*proto.ReplicationPosition, error) {
+	rp := &proto.ReplicationPosition{}
+	if m := slaveInfoLogFile.FindStringSubmatch(data); m != nil {
+		rp.MasterLogFile = m[1]
+		rp.MasterLogFileIo = m[1]
+	}
+	if m := slaveInfoLogPos.FindStringSubmatch(data); m != nil {
+		pos, err := strconv.ParseUint(m[1], 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid position in %v (%v): %v", xtrabackupSlaveInfo, data, err)
+		}
+		rp.MasterLogPosition = uint(pos)
+		rp.MasterLogPositionIo = uint(pos)
+	}
+	if m := slaveInfoGTID.FindStringSubmatch(data); m != nil {
+		gtid, err := parseGTID(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid GTID in %v (%v): %v", xtrabackupSlaveInfo, data, err)
+		}
+		rp.MasterLogGTIDField.Value = gtid
+	}
+	if rp.MasterLogFile == "" && rp.MasterLogGTIDField.Value == nil {
+		return nil, fmt.Errorf("no replication position in %v: %v", xtrabackupSlaveInfo, data)
+	}
+	return rp, nil
+}
+
+// parseXtrabackupBinlogInfo parses xtrabackup_binlog_info, which has
+// the binlog file, the position, and optionally the GTID, separated
+// by white spaces, like:
+//   vt-bin.000003	1194	0-41983-5
+func parseXtrabackupBinlogInfo(data string, parseGTID func(string) (proto.GTID, error)) (*proto.ReplicationPosition, error) {
+	fields := strings.Fields(data)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid %v: %v", xtrabackupBinlogInfo, data)
+	}
+	pos, err := strconv.ParseUint(fields[1], 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid position in %v (%v): %v", xtrabackupBinlogInfo, data, err)
+	}
+	rp := &proto.ReplicationPosition{
+		MasterLogFile:       fields[0],
+		MasterLogFileIo:     fields[0],
+		MasterLogPosition:   uint(pos),
+		MasterLogPositionIo: uint(pos),
+	}
+	if len(fields) > 2 {
+		// MySQL 5.6 GTID sets may be split on several lines
+		gtid, err := parseGTID(strings.Join(fields[2:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid GTID in %v (%v): %v", xtrabackupBinlogInfo, data, err)
+		}
+		rp.MasterLogGTIDField.Value = gtid
+	}
+	return rp, nil
+}
+
+func init() {
+	backupEngines[xtrabackup] = &XtrabackupEngine{}
+}
@@ -0,0 +1,95 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func parseMariaGTID(s string) (proto.GTID, error) {
+	return (&mariaDB10{}).ParseGTID(s)
+}
+
+func TestParseXtrabackupBinlogInfo(t *testing.T) {
+	rp, err := parseXtrabackupBinlogInfo("vt-bin.000003\t1194\t0-41983-5\n", parseMariaGTID)
+	if err != nil {
+		t.Fatalf("parseXtrabackupBinlogInfo failed: %v", err)
+	}
+	if rp.MasterLogFile != "vt-bin.000003" || rp.MasterLogPosition != 1194 || rp.MasterLogFileIo != "vt-bin.000003" || rp.MasterLogPositionIo != 1194 {
+		t.Errorf("wrong file position: %#v", rp)
+	}
+	if want := proto.MustParseGTID("MariaDB", "0-41983-5"); rp.MasterLogGTIDField.Value != want {
+		t.Errorf("got GTID %v, want %v", rp.MasterLogGTIDField.Value, want)
+	}
+
+	// no GTID
+	rp, err = parseXtrabackupBinlogInfo("vt-bin.000003\t1194\n", parseMariaGTID)
+	if err != nil || rp.MasterLogPosition != 1194 || rp.MasterLogGTIDField.Value != nil {
+		t.Errorf("parseXtrabackupBinlogInfo without GTID returned wrong results: %#v %v", rp, err)
+	}
+
+	for _, input := range []string{"", "vt-bin.000003", "vt-bin.000003\tabc", "vt-bin.000003\t1194\tnot-a-gtid"} {
+		if _, err := parseXtrabackupBinlogInfo(input, parseMariaGTID); err == nil {
+			t.Errorf("parseXtrabackupBinlogInfo(%q) didn't fail", input)
+		}
+	}
+}
+
+func TestParseXtrabackupSlaveInfo(t *testing.T) {
+	rp, err := parseXtrabackupSlaveInfo("CHANGE MASTER TO MASTER_LOG_FILE='vt-bin.000007', MASTER_LOG_POS=4321\n", parseMariaGTID)
+	if err != nil {
+		t.Fatalf("parseXtrabackupSlaveInfo failed: %v", err)
+	}
+	if rp.MasterLogFile != "vt-bin.000007" || rp.MasterLogPosition != 4321 || rp.MasterLogGTIDField.Value != nil {
+		t.Errorf("wrong position: %#v", rp)
+	}
+
+	rp, err = parseXtrabackupSlaveInfo("SET GLOBAL gtid_slave_pos = '0-41983-5';\nCHANGE MASTER TO master_use_gtid = slave_pos\n", parseMariaGTID)
+	if err != nil {
+		t.Fatalf("parseXtrabackupSlaveInfo failed: %v", err)
+	}
+	if want := proto.MustParseGTID("MariaDB", "0-41983-5"); rp.MasterLogGTIDField.Value != want {
+		t.Errorf("got GTID %v, want %v", rp.MasterLogGTIDField.Value, want)
+	}
+
+	if _, err := parseXtrabackupSlaveInfo("CHANGE MASTER TO master_auto_position = 1", parseMariaGTID); err == nil {
+		t.Errorf("parseXtrabackupSlaveInfo without position didn't fail")
+	}
+}
+
+func TestFindXtrabackupPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xtrabackup")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := findXtrabackupPosition(dir, parseMariaGTID); err == nil {
+		t.Errorf("findXtrabackupPosition without files didn't fail")
+	}
+
+	// a backup of a master only has its own position
+	if err := ioutil.WriteFile(path.Join(dir, xtrabackupBinlogInfo), []byte("vt-bin.000003\t1194\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	rp, err := findXtrabackupPosition(dir, parseMariaGTID)
+	if err != nil || rp.MasterLogFile != "vt-bin.000003" {
+		t.Errorf("findXtrabackupPosition returned wrong results: %#v %v", rp, err)
+	}
+
+	// a backup of a slave uses the position on its master
+	if err := ioutil.WriteFile(path.Join(dir, xtrabackupSlaveInfo), []byte("CHANGE MASTER TO MASTER_LOG_FILE='vt-bin.000007', MASTER_LOG_POS=4321\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	rp, err = findXtrabackupPosition(dir, parseMariaGTID)
+	if err != nil || rp.MasterLogFile != "vt-bin.000007" || rp.MasterLogPosition != 4321 {
+		t.Errorf("findXtrabackupPosition returned wrong results: %#v %v", rp, err)
+	}
+}
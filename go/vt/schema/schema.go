@@ -27,6 +27,13 @@ const (
 	CACHE_W    = 2
 )
 
+// Table types
+const (
+	TYPE_NORMAL   = 0
+	TYPE_SEQUENCE = 1
+	TYPE_MESSAGE  = 2
+)
+
 type TableColumn struct {
 	Name     string
 	Category int
@@ -40,6 +47,7 @@ type Table struct {
 	Indexes   []*Index
 	PKColumns []int
 	CacheType int
+	Type      int
 }
 
 func NewTable(name string) *Table {
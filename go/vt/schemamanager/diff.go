@@ -0,0 +1,216 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schemamanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+// tableDef is a parsed 'SHOW CREATE TABLE' output, like:
+//   CREATE TABLE `t` (
+//     `id` bigint(20) NOT NULL,
+//     PRIMARY KEY (`id`),
+//     KEY `by_msg` (`msg`)
+//   ) ENGINE=InnoDB DEFAULT CHARSET=utf8
+type tableDef struct {
+	name string
+
+	// columns in order, with their definitions by name
+	columns    []string
+	columnDefs map[string]string
+
+	// index definitions by name, PRIMARY for the primary key,
+	// FOREIGN <name> for the foreign keys
+	indexDefs map[string]string
+
+	options string
+}
+
+// parseTableDef parses the output of 'SHOW CREATE TABLE'.
+func parseTableDef(name, schema string) (*tableDef, error) {
+	lines := strings.Split(strings.TrimSpace(schema), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "CREATE TABLE ") || !strings.HasPrefix(lines[len(lines)-1], ")") {
+		return nil, fmt.Errorf("cannot parse the schema of table %v: %v", name, schema)
+	}
+
+	td := &tableDef{
+		name:       name,
+		columnDefs: make(map[string]string),
+		indexDefs:  make(map[string]string),
+		options:    strings.TrimSpace(strings.TrimPrefix(lines[len(lines)-1], ")")),
+	}
+	for _, line := range lines[1 : len(lines)-1] {
+		def := strings.TrimSuffix(strings.TrimSpace(line), ",")
+		switch {
+		case strings.HasPrefix(def, "`"):
+			column := quotedName(def)
+			td.columns = append(td.columns, column)
+			td.columnDefs[column] = def
+		case strings.HasPrefix(def, "PRIMARY KEY"):
+			td.indexDefs["PRIMARY"] = def
+		case strings.HasPrefix(def, "CONSTRAINT"):
+			td.indexDefs["FOREIGN "+quotedName(def)] = def
+		case strings.Contains(def, "KEY `"):
+			td.indexDefs[quotedName(def)] = def
+		default:
+			return nil, fmt.Errorf("cannot parse line of table %v: %v", name, line)
+		}
+	}
+	return td, nil
+}
+
+// quotedName returns the first back-quoted name of a definition.
+func quotedName(def string) string {
+	parts := strings.SplitN(def, "`", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// position returns where a column goes, after the column before it.
+func position(columns []string, i int) string {
+	if i == 0 {
+		return " FIRST"
+	}
+	return " AFTER `" + columns[i-1] + "`"
+}
+
+// diffTable returns the ALTER TABLE statement that changes the schema
+// of a table from one definition to the other, or "" if they're the
+// same.
+func diffTable(from, to *tableDef) string {
+	var clauses []string
+
+	// indexes first, so the columns they use can be dropped
+	var fromIndexes, toIndexes []string
+	for name := range from.indexDefs {
+		fromIndexes = append(fromIndexes, name)
+	}
+	for name := range to.indexDefs {
+		toIndexes = append(toIndexes, name)
+	}
+	sort.Strings(fromIndexes)
+	sort.Strings(toIndexes)
+	for _, name := range fromIndexes {
+		if to.indexDefs[name] == from.indexDefs[name] {
+			continue
+		}
+		switch {
+		case name == "PRIMARY":
+			clauses = append(clauses, "DROP PRIMARY KEY")
+		case strings.HasPrefix(name, "FOREIGN "):
+			clauses = append(clauses, "DROP FOREIGN KEY `"+strings.TrimPrefix(name, "FOREIGN ")+"`")
+		default:
+			clauses = append(clauses, "DROP INDEX `"+name+"`")
+		}
+	}
+
+	for _, column := range from.columns {
+		if _, ok := to.columnDefs[column]; !ok {
+			clauses = append(clauses, "DROP COLUMN `"+column+"`")
+		}
+	}
+
+	// the columns that stay keep their order, moving them only
+	// when the column before them changes
+	var kept []string
+	for _, column := range from.columns {
+		if _, ok := to.columnDefs[column]; ok {
+			kept = append(kept, column)
+		}
+	}
+	previous := make(map[string]string)
+	for i, column := range kept {
+		if i > 0 {
+			previous[column] = kept[i-1]
+		}
+	}
+	for i, column := range to.columns {
+		fromDef, ok := from.columnDefs[column]
+		if !ok {
+			clauses = append(clauses, "ADD COLUMN "+to.columnDefs[column]+position(to.columns, i))
+			continue
+		}
+		toPrevious := ""
+		for j := i - 1; j >= 0; j-- {
+			if _, ok := from.columnDefs[to.columns[j]]; ok {
+				toPrevious = to.columns[j]
+				break
+			}
+		}
+		if fromDef != to.columnDefs[column] || previous[column] != toPrevious {
+			clauses = append(clauses, "MODIFY COLUMN "+to.columnDefs[column]+position(to.columns, i))
+		}
+	}
+
+	for _, name := range toIndexes {
+		if to.indexDefs[name] != from.indexDefs[name] {
+			clauses = append(clauses, "ADD "+to.indexDefs[name])
+		}
+	}
+
+	if from.options != to.options {
+		clauses = append(clauses, to.options)
+	}
+
+	if len(clauses) == 0 {
+		return ""
+	}
+	return "ALTER TABLE `" + to.name + "` " + strings.Join(clauses, ", ")
+}
+
+// DiffSchemas returns the statements that change the tables of a
+// schema into the tables of another one. Like myproto.DiffSchema, it
+// skips the views.
+func DiffSchemas(from, to *myproto.SchemaDefinition) ([]string, error) {
+	fromTables := make(map[string]string)
+	toTables := make(map[string]string)
+	var names []string
+	for _, td := range from.TableDefinitions {
+		if td.Type == myproto.TABLE_BASE_TABLE {
+			fromTables[td.Name] = td.Schema
+			names = append(names, td.Name)
+		}
+	}
+	for _, td := range to.TableDefinitions {
+		if td.Type == myproto.TABLE_BASE_TABLE {
+			toTables[td.Name] = td.Schema
+			if _, ok := fromTables[td.Name]; !ok {
+				names = append(names, td.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var result []string
+	for _, name := range names {
+		fromSchema, inFrom := fromTables[name]
+		toSchema, inTo := toTables[name]
+		switch {
+		case !inFrom:
+			result = append(result, toSchema)
+		case !inTo:
+			result = append(result, "DROP TABLE `"+name+"`")
+		case fromSchema != toSchema:
+			fromDef, err := parseTableDef(name, fromSchema)
+			if err != nil {
+				return nil, err
+			}
+			toDef, err := parseTableDef(name, toSchema)
+			if err != nil {
+				return nil, err
+			}
+			if alter := diffTable(fromDef, toDef); alter != "" {
+				result = append(result, alter)
+			}
+		}
+	}
+	return result, nil
+}
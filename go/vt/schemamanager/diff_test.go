@@ -0,0 +1,98 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schemamanager
+
+import (
+	"reflect"
+	"testing"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+const fromTable = "CREATE TABLE `t` (\n" +
+	"  `id` bigint(20) NOT NULL,\n" +
+	"  `a` int(11) DEFAULT NULL,\n" +
+	"  `b` varchar(64) DEFAULT NULL,\n" +
+	"  `c` int(11) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `by_a` (`a`),\n" +
+	"  KEY `by_c` (`c`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+
+func TestDiffTable(t *testing.T) {
+	cases := []struct {
+		to   string
+		want string
+	}{
+		{fromTable, ""},
+		{
+			"CREATE TABLE `t` (\n" +
+				"  `id` bigint(20) NOT NULL,\n" +
+				"  `a` bigint(20) DEFAULT NULL,\n" +
+				"  `new` int(11) NOT NULL,\n" +
+				"  `b` varchar(64) DEFAULT NULL,\n" +
+				"  PRIMARY KEY (`id`),\n" +
+				"  KEY `by_a` (`a`,`b`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=latin1",
+			"ALTER TABLE `t` DROP INDEX `by_a`, DROP INDEX `by_c`, DROP COLUMN `c`, MODIFY COLUMN `a` bigint(20) DEFAULT NULL AFTER `id`, ADD COLUMN `new` int(11) NOT NULL AFTER `a`, ADD KEY `by_a` (`a`,`b`), ENGINE=InnoDB DEFAULT CHARSET=latin1",
+		},
+		{
+			"CREATE TABLE `t` (\n" +
+				"  `b` varchar(64) DEFAULT NULL,\n" +
+				"  `id` bigint(20) NOT NULL,\n" +
+				"  `a` int(11) DEFAULT NULL,\n" +
+				"  `c` int(11) DEFAULT NULL,\n" +
+				"  PRIMARY KEY (`id`,`a`),\n" +
+				"  KEY `by_a` (`a`),\n" +
+				"  KEY `by_c` (`c`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+			"ALTER TABLE `t` DROP PRIMARY KEY, MODIFY COLUMN `b` varchar(64) DEFAULT NULL FIRST, MODIFY COLUMN `id` bigint(20) NOT NULL AFTER `b`, MODIFY COLUMN `c` int(11) DEFAULT NULL AFTER `a`, ADD PRIMARY KEY (`id`,`a`)",
+		},
+	}
+	from, err := parseTableDef("t", fromTable)
+	if err != nil {
+		t.Fatalf("parseTableDef failed: %v", err)
+	}
+	for _, c := range cases {
+		to, err := parseTableDef("t", c.to)
+		if err != nil {
+			t.Fatalf("parseTableDef failed: %v", err)
+		}
+		if got := diffTable(from, to); got != c.want {
+			t.Errorf("diffTable to %v:\ngot:  %v\nwant: %v", c.to, got, c.want)
+		}
+	}
+
+	if _, err := parseTableDef("t", "CREATE VIEW `t` AS SELECT 1"); err == nil {
+		t.Errorf("parseTableDef on a view didn't fail")
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	from := &myproto.SchemaDefinition{
+		TableDefinitions: []myproto.TableDefinition{
+			{Name: "dropped", Schema: "CREATE TABLE `dropped` (\n  `id` int(11) NOT NULL\n) ENGINE=InnoDB", Type: myproto.TABLE_BASE_TABLE},
+			{Name: "same", Schema: "CREATE TABLE `same` (\n  `id` int(11) NOT NULL\n) ENGINE=InnoDB", Type: myproto.TABLE_BASE_TABLE},
+			{Name: "t", Schema: fromTable, Type: myproto.TABLE_BASE_TABLE},
+			{Name: "v", Schema: "CREATE VIEW `v` AS SELECT 1", Type: myproto.TABLE_VIEW},
+		},
+	}
+	to := &myproto.SchemaDefinition{
+		TableDefinitions: []myproto.TableDefinition{
+			{Name: "added", Schema: "CREATE TABLE `added` (\n  `id` int(11) NOT NULL\n) ENGINE=InnoDB", Type: myproto.TABLE_BASE_TABLE},
+			{Name: "same", Schema: "CREATE TABLE `same` (\n  `id` int(11) NOT NULL\n) ENGINE=InnoDB", Type: myproto.TABLE_BASE_TABLE},
+			{Name: "t", Schema: fromTable[:len(fromTable)-4] + "latin1", Type: myproto.TABLE_BASE_TABLE},
+		},
+	}
+	want := []string{
+		"CREATE TABLE `added` (\n  `id` int(11) NOT NULL\n) ENGINE=InnoDB",
+		"DROP TABLE `dropped`",
+		"ALTER TABLE `t` ENGINE=InnoDB DEFAULT CHARSET=latin1",
+	}
+	got, err := DiffSchemas(from, to)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffSchemas() = %#v, %v, want %#v", got, err, want)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package schemamanager captures the schema of all the shards of a
+// keyspace, diffs it with another snapshot or with the desired SQL,
+// and generates and applies the ALTER statements for each shard,
+// after validating them on a scratch database.
+package schemamanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/concurrency"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// Controller runs the schema actions on the tablets. It is
+// implemented by wrangler.Wrangler.
+type Controller interface {
+	GetSchema(tabletAlias topo.TabletAlias, tables, excludeTables []string, includeViews bool) (*myproto.SchemaDefinition, error)
+	PreflightSchema(tabletAlias topo.TabletAlias, change string) (*myproto.SchemaChangeResult, error)
+	ApplySchemaShard(keyspace, shard, change string, newParentTabletAlias topo.TabletAlias, simple, force bool) (*myproto.SchemaChangeResult, error)
+}
+
+// ShardSchema is the schema of the master of a shard.
+type ShardSchema struct {
+	MasterAlias topo.TabletAlias
+	Schema      *myproto.SchemaDefinition
+}
+
+// Snapshot is the schema of all the shards of a keyspace.
+type Snapshot struct {
+	Keyspace string
+	Shards   map[string]*ShardSchema
+}
+
+func (s *Snapshot) String() string {
+	return jscfg.ToJson(s)
+}
+
+// TakeSnapshot gets the schema of all the shard masters of a keyspace,
+// in parallel.
+func TakeSnapshot(ts topo.Server, ctrl Controller, keyspace string) (*Snapshot, error) {
+	shards, err := ts.GetShardNames(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("No shards in keyspace %v", keyspace)
+	}
+
+	snapshot := &Snapshot{
+		Keyspace: keyspace,
+		Shards:   make(map[string]*ShardSchema),
+	}
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	rec := concurrency.AllErrorRecorder{}
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			shardInfo, err := ts.GetShard(keyspace, shard)
+			if err != nil {
+				rec.RecordError(err)
+				return
+			}
+			sd, err := ctrl.GetSchema(shardInfo.MasterAlias, nil, nil, false)
+			if err != nil {
+				rec.RecordError(fmt.Errorf("cannot get schema of shard %v: %v", shard, err))
+				return
+			}
+			mu.Lock()
+			snapshot.Shards[shard] = &ShardSchema{
+				MasterAlias: shardInfo.MasterAlias,
+				Schema:      sd,
+			}
+			mu.Unlock()
+		}(shard)
+	}
+	wg.Wait()
+	if rec.HasErrors() {
+		return nil, rec.Error()
+	}
+	return snapshot, nil
+}
+
+// DesiredSchema returns the schema the SQL statements create, as
+// mysqld reports it, so it can be diffed with the actual schemas. The
+// statements run in the preflight database of the given tablet, after
+// its tables are dropped.
+func DesiredSchema(ctrl Controller, tabletAlias topo.TabletAlias, sql string) (*myproto.SchemaDefinition, error) {
+	sd, err := ctrl.GetSchema(tabletAlias, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	var change []string
+	for _, td := range sd.TableDefinitions {
+		change = append(change, "DROP TABLE `"+td.Name+"`")
+	}
+	change = append(change, sql)
+
+	scr, err := ctrl.PreflightSchema(tabletAlias, strings.Join(change, ";\n"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot run the desired SQL: %v", err)
+	}
+	return scr.AfterSchema, nil
+}
+
+// Plan is the list of statements to run on each shard of a keyspace.
+type Plan struct {
+	snapshot *Snapshot
+	targets  map[string]*myproto.SchemaDefinition
+
+	// Changes has the statements by shard name, for the shards
+	// that need them.
+	Changes map[string][]string
+}
+
+// MakePlan computes the statements that change the schema of each
+// shard of the snapshot into its target one. targets has the schema
+// of each shard, use SameTarget to use the same schema everywhere.
+func MakePlan(snapshot *Snapshot, targets map[string]*myproto.SchemaDefinition) (*Plan, error) {
+	plan := &Plan{
+		snapshot: snapshot,
+		targets:  targets,
+		Changes:  make(map[string][]string),
+	}
+	for shard, ss := range snapshot.Shards {
+		target, ok := targets[shard]
+		if !ok {
+			return nil, fmt.Errorf("no target schema for shard %v", shard)
+		}
+		statements, err := DiffSchemas(ss.Schema, target)
+		if err != nil {
+			return nil, fmt.Errorf("cannot diff schema of shard %v: %v", shard, err)
+		}
+		if len(statements) > 0 {
+			plan.Changes[shard] = statements
+		}
+	}
+	return plan, nil
+}
+
+// SameTarget returns targets for MakePlan with the same schema for
+// all the shards of a snapshot.
+func SameTarget(snapshot *Snapshot, sd *myproto.SchemaDefinition) map[string]*myproto.SchemaDefinition {
+	result := make(map[string]*myproto.SchemaDefinition)
+	for shard := range snapshot.Shards {
+		result[shard] = sd
+	}
+	return result
+}
+
+// shards returns the sorted names of the shards that need a change.
+func (plan *Plan) shards() []string {
+	var result []string
+	for shard := range plan.Changes {
+		result = append(result, shard)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (plan *Plan) String() string {
+	result := ""
+	for _, shard := range plan.shards() {
+		result += fmt.Sprintf("-- shard %v/%v\n%v;\n", plan.snapshot.Keyspace, shard, strings.Join(plan.Changes[shard], ";\n"))
+	}
+	return result
+}
+
+// Preflight runs the statements of each shard on the scratch database
+// of its master, and checks they result in the target schema.
+func (plan *Plan) Preflight(ctrl Controller) error {
+	rec := concurrency.AllErrorRecorder{}
+	for _, shard := range plan.shards() {
+		scr, err := ctrl.PreflightSchema(plan.snapshot.Shards[shard].MasterAlias, strings.Join(plan.Changes[shard], ";\n"))
+		if err != nil {
+			rec.RecordError(fmt.Errorf("preflight failed on shard %v: %v", shard, err))
+			continue
+		}
+
+		// the scratch database may not be created like the real one
+		target := *plan.targets[shard]
+		target.DatabaseSchema = scr.AfterSchema.DatabaseSchema
+		if diffs := myproto.DiffSchemaToArray("preflight", scr.AfterSchema, "target", &target); len(diffs) > 0 {
+			rec.RecordError(fmt.Errorf("preflight on shard %v doesn't result in the target schema: %v", shard, strings.Join(diffs, "\n")))
+		}
+	}
+	return rec.Error()
+}
+
+// Apply runs the statements of each shard with ApplySchemaShard, one
+// shard at a time. It stops at the first failure.
+func (plan *Plan) Apply(ctrl Controller, simple, force bool) error {
+	for _, shard := range plan.shards() {
+		log.Infof("Applying schema change on shard %v/%v", plan.snapshot.Keyspace, shard)
+		if _, err := ctrl.ApplySchemaShard(plan.snapshot.Keyspace, shard, strings.Join(plan.Changes[shard], ";\n"), topo.TabletAlias{}, simple, force); err != nil {
+			return fmt.Errorf("cannot apply schema change on shard %v: %v", shard, err)
+		}
+	}
+	return nil
+}
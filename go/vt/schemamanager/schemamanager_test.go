@@ -0,0 +1,89 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schemamanager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// fakeController preflights a change by returning its afterSchema,
+// and records the applied changes.
+type fakeController struct {
+	afterSchema *myproto.SchemaDefinition
+	preflights  []string
+	applied     []string
+}
+
+func (fc *fakeController) GetSchema(tabletAlias topo.TabletAlias, tables, excludeTables []string, includeViews bool) (*myproto.SchemaDefinition, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (fc *fakeController) PreflightSchema(tabletAlias topo.TabletAlias, change string) (*myproto.SchemaChangeResult, error) {
+	fc.preflights = append(fc.preflights, fmt.Sprintf("%v: %v", tabletAlias, change))
+	return &myproto.SchemaChangeResult{AfterSchema: fc.afterSchema}, nil
+}
+
+func (fc *fakeController) ApplySchemaShard(keyspace, shard, change string, newParentTabletAlias topo.TabletAlias, simple, force bool) (*myproto.SchemaChangeResult, error) {
+	fc.applied = append(fc.applied, fmt.Sprintf("%v/%v: %v", keyspace, shard, change))
+	return &myproto.SchemaChangeResult{}, nil
+}
+
+func table(name, column string) myproto.TableDefinition {
+	return myproto.TableDefinition{
+		Name:   name,
+		Schema: "CREATE TABLE `" + name + "` (\n  `" + column + "` int(11) NOT NULL\n) ENGINE=InnoDB",
+		Type:   myproto.TABLE_BASE_TABLE,
+	}
+}
+
+func TestPlan(t *testing.T) {
+	current := &myproto.SchemaDefinition{DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}`", TableDefinitions: []myproto.TableDefinition{table("t1", "id")}}
+	target := &myproto.SchemaDefinition{DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}`", TableDefinitions: []myproto.TableDefinition{table("t1", "id"), table("t2", "id")}}
+	snapshot := &Snapshot{
+		Keyspace: "ks",
+		Shards: map[string]*ShardSchema{
+			"-80": &ShardSchema{MasterAlias: topo.TabletAlias{Cell: "cell", Uid: 1}, Schema: current},
+			"80-": &ShardSchema{MasterAlias: topo.TabletAlias{Cell: "cell", Uid: 2}, Schema: target},
+		},
+	}
+
+	plan, err := MakePlan(snapshot, SameTarget(snapshot, target))
+	if err != nil {
+		t.Fatalf("MakePlan failed: %v", err)
+	}
+	if len(plan.Changes) != 1 || len(plan.Changes["-80"]) != 1 || !strings.HasPrefix(plan.Changes["-80"][0], "CREATE TABLE `t2`") {
+		t.Fatalf("MakePlan returned wrong changes: %v", plan.Changes)
+	}
+
+	// the preflight database doesn't have the target schema
+	fc := &fakeController{afterSchema: current}
+	if err := plan.Preflight(fc); err == nil || !strings.Contains(err.Error(), "extra table named t2") {
+		t.Errorf("Preflight with the wrong result returned %v", err)
+	}
+
+	fc.afterSchema = &myproto.SchemaDefinition{DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}` /* preflight */", TableDefinitions: target.TableDefinitions}
+	if err := plan.Preflight(fc); err != nil {
+		t.Errorf("Preflight failed: %v", err)
+	}
+	if len(fc.preflights) != 2 || !strings.HasPrefix(fc.preflights[1], "cell-0000000001: CREATE TABLE `t2`") {
+		t.Errorf("Preflight ran on the wrong tablets: %v", fc.preflights)
+	}
+
+	if err := plan.Apply(fc, true, false); err != nil {
+		t.Errorf("Apply failed: %v", err)
+	}
+	if len(fc.applied) != 1 || !strings.HasPrefix(fc.applied[0], "ks/-80: CREATE TABLE `t2`") {
+		t.Errorf("Apply applied the wrong changes: %v", fc.applied)
+	}
+
+	if _, err := MakePlan(snapshot, map[string]*myproto.SchemaDefinition{"-80": target}); err == nil {
+		t.Errorf("MakePlan with a missing target didn't fail")
+	}
+}
@@ -8,6 +8,7 @@ package sqlparser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/youtube/vitess/go/sqltypes"
 )
@@ -112,3 +113,26 @@ func StringIn(str string, values ...string) bool {
 	}
 	return false
 }
+
+// IsDML returns true if sql is an insert, update, delete or
+// replace, after its leading comments. It only looks at the first
+// keyword, so it's cheaper than a full parse.
+func IsDML(sql string) bool {
+	sql = strings.TrimSpace(sql)
+	for strings.HasPrefix(sql, "/*") {
+		end := strings.Index(sql, "*/")
+		if end == -1 {
+			return false
+		}
+		sql = strings.TrimSpace(sql[end+2:])
+	}
+	end := strings.IndexAny(sql, " \t\n\r(")
+	if end == -1 {
+		end = len(sql)
+	}
+	switch strings.ToLower(sql[:end]) {
+	case "insert", "update", "delete", "replace":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import "testing"
+
+func TestIsDML(t *testing.T) {
+	cases := map[string]bool{
+		"insert into a values(1)":                 true,
+		"  UPDATE a set b = 1":                    true,
+		"delete from a":                           true,
+		"replace into a values(1)":                true,
+		"/* comment */ insert into a values(1)":   true,
+		"/* a */ /* b */delete from a":            true,
+		"insert(a) values(1)":                     true,
+		"select * from a":                         false,
+		"select * from a where b = 'insert'":      false,
+		"begin":                                   false,
+		"/* unterminated insert into a values(1)": false,
+		"": false,
+	}
+	for sql, want := range cases {
+		if got := IsDML(sql); got != want {
+			t.Errorf("IsDML(%q): %v, want %v", sql, got, want)
+		}
+	}
+}
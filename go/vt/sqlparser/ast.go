@@ -5,6 +5,7 @@
 package sqlparser
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/youtube/vitess/go/sqltypes"
@@ -29,6 +30,9 @@ func Parse(sql string) (Statement, error) {
 	if yyParse(tokenizer) != 0 {
 		return nil, errors.New(tokenizer.LastError)
 	}
+	if ddl, ok := tokenizer.ParseTree.(*DDL); ok {
+		parseDDLSpec(sql, ddl)
+	}
 	return tokenizer.ParseTree, nil
 }
 
@@ -51,13 +55,17 @@ type Statement interface {
 	SQLNode
 }
 
-func (*Union) IStatement()  {}
-func (*Select) IStatement() {}
-func (*Insert) IStatement() {}
-func (*Update) IStatement() {}
-func (*Delete) IStatement() {}
-func (*Set) IStatement()    {}
-func (*DDL) IStatement()    {}
+func (*Union) IStatement()       {}
+func (*Select) IStatement()      {}
+func (*ParenSelect) IStatement() {}
+func (*Insert) IStatement()      {}
+func (*Update) IStatement()      {}
+func (*Delete) IStatement()      {}
+func (*Set) IStatement()         {}
+func (*DDL) IStatement()         {}
+func (*Savepoint) IStatement()   {}
+func (*Show) IStatement()        {}
+func (*Use) IStatement()         {}
 
 // SelectStatement any SELECT statement.
 type SelectStatement interface {
@@ -67,8 +75,9 @@ type SelectStatement interface {
 	SQLNode
 }
 
-func (*Select) ISelectStatement() {}
-func (*Union) ISelectStatement()  {}
+func (*Select) ISelectStatement()      {}
+func (*Union) ISelectStatement()       {}
+func (*ParenSelect) ISelectStatement() {}
 
 // Select represents a SELECT statement.
 type Select struct {
@@ -103,23 +112,38 @@ func (node *Select) Format(buf *TrackedBuffer) {
 		node.Limit, node.Lock)
 }
 
-// Union represents a UNION statement.
+// Union represents a UNION statement. OrderBy and Limit
+// apply to the result of the union.
 type Union struct {
 	Type        string
 	Left, Right SelectStatement
+	OrderBy     OrderBy
+	Limit       *Limit
 }
 
 // Union.Type
 const (
-	AST_UNION     = "union"
-	AST_UNION_ALL = "union all"
-	AST_SET_MINUS = "minus"
-	AST_EXCEPT    = "except"
-	AST_INTERSECT = "intersect"
+	AST_UNION          = "union"
+	AST_UNION_ALL      = "union all"
+	AST_UNION_DISTINCT = "union distinct"
+	AST_SET_MINUS      = "minus"
+	AST_EXCEPT         = "except"
+	AST_INTERSECT      = "intersect"
 )
 
 func (node *Union) Format(buf *TrackedBuffer) {
-	buf.Myprintf("%v %s %v", node.Left, node.Type, node.Right)
+	buf.Myprintf("%v %s %v%v%v", node.Left, node.Type, node.Right,
+		node.OrderBy, node.Limit)
+}
+
+// ParenSelect represents a parenthesized SELECT statement
+// used as an operand of a UNION.
+type ParenSelect struct {
+	Select SelectStatement
+}
+
+func (node *ParenSelect) Format(buf *TrackedBuffer) {
+	buf.Myprintf("(%v)", node.Select)
 }
 
 // Insert represents an INSERT statement.
@@ -143,9 +167,10 @@ type InsertRows interface {
 	SQLNode
 }
 
-func (*Select) IInsertRows() {}
-func (*Union) IInsertRows()  {}
-func (Values) IInsertRows()  {}
+func (*Select) IInsertRows()      {}
+func (*Union) IInsertRows()       {}
+func (*ParenSelect) IInsertRows() {}
+func (Values) IInsertRows()       {}
 
 // Update represents an UPDATE statement.
 type Update struct {
@@ -178,23 +203,82 @@ func (node *Delete) Format(buf *TrackedBuffer) {
 		node.Table, node.Where, node.OrderBy, node.Limit)
 }
 
-// Set represents a SET statement.
+// Set represents a SET statement. Scope is the scope of its
+// variables, if it's explicit. SET NAMES and SET CHARACTER SET
+// are represented by an expression named AST_NAMES or
+// AST_CHARSET whose value is the charset, which may be
+// followed by an expression named AST_COLLATE.
 type Set struct {
 	Comments Comments
+	Scope    string
 	Exprs    UpdateExprs
 }
 
+// Set.Scope
+const (
+	AST_SESSION = "session"
+	AST_GLOBAL  = "global"
+)
+
+// The names of the expressions of SET NAMES and SET CHARACTER SET.
+const (
+	AST_NAMES   = "names"
+	AST_CHARSET = "charset"
+	AST_COLLATE = "collate"
+)
+
+// setScope returns the scope named by word, or "" if there's none.
+func setScope(word []byte) string {
+	switch string(bytes.ToLower(word)) {
+	case AST_SESSION, "local":
+		return AST_SESSION
+	case AST_GLOBAL:
+		return AST_GLOBAL
+	}
+	return ""
+}
+
+// IsCharset returns true if node is a SET NAMES or a
+// SET CHARACTER SET.
+func (node *Set) IsCharset() bool {
+	if len(node.Exprs) == 0 || node.Exprs[0].Name.Qualifier != nil {
+		return false
+	}
+	name := string(node.Exprs[0].Name.Name)
+	return name == AST_NAMES || name == AST_CHARSET
+}
+
 func (node *Set) Format(buf *TrackedBuffer) {
-	buf.Myprintf("set %v%v", node.Comments, node.Exprs)
+	buf.Myprintf("set %v", node.Comments)
+	if node.Scope != "" {
+		buf.Myprintf("%s ", node.Scope)
+	}
+	if !node.IsCharset() {
+		buf.Myprintf("%v", node.Exprs)
+		return
+	}
+	for i, expr := range node.Exprs {
+		if i != 0 {
+			buf.Myprintf(" ")
+		}
+		buf.Myprintf("%s %v", expr.Name.Name, expr.Expr)
+	}
 }
 
 // DDL represents a CREATE, ALTER, DROP or RENAME statement.
 // Table is set for AST_ALTER, AST_DROP, AST_RENAME.
 // NewName is set for AST_ALTER, AST_CREATE, AST_RENAME.
+// TableSpec is set for a CREATE TABLE, and AlterSpecs for
+// an ALTER TABLE, CREATE INDEX or DROP INDEX, if they
+// could be parsed. Temporary is set for a CREATE or DROP
+// TEMPORARY TABLE.
 type DDL struct {
-	Action  string
-	Table   []byte
-	NewName []byte
+	Action     string
+	Table      []byte
+	NewName    []byte
+	TableSpec  *TableSpec
+	AlterSpecs AlterSpecs
+	Temporary  bool
 }
 
 const (
@@ -205,14 +289,155 @@ const (
 )
 
 func (node *DDL) Format(buf *TrackedBuffer) {
+	table := "table"
+	if node.Temporary {
+		table = "temporary table"
+	}
 	switch node.Action {
 	case AST_CREATE:
-		buf.Myprintf("%s table %s", node.Action, node.NewName)
+		buf.Myprintf("%s %s %s", node.Action, table, node.NewName)
 	case AST_RENAME:
-		buf.Myprintf("%s table %s %s", node.Action, node.Table, node.NewName)
+		buf.Myprintf("%s %s %s %s", node.Action, table, node.Table, node.NewName)
+	default:
+		buf.Myprintf("%s %s %s", node.Action, table, node.Table)
+	}
+}
+
+// Savepoint represents a SAVEPOINT, ROLLBACK TO SAVEPOINT
+// or RELEASE SAVEPOINT statement.
+type Savepoint struct {
+	Action string
+	Name   []byte
+}
+
+const (
+	AST_SAVEPOINT   = "savepoint"
+	AST_ROLLBACK_TO = "rollback to"
+	AST_RELEASE     = "release"
+)
+
+func (node *Savepoint) Format(buf *TrackedBuffer) {
+	if node.Action == AST_SAVEPOINT {
+		buf.Myprintf("savepoint ")
+	} else {
+		buf.Myprintf("%s savepoint ", node.Action)
+	}
+	escape(buf, node.Name)
+}
+
+// Show represents a SHOW TABLES, SHOW COLUMNS or SHOW VARIABLES
+// statement. Table is the table of SHOW COLUMNS, Database the
+// database of SHOW TABLES, and Scope the scope of SHOW VARIABLES.
+type Show struct {
+	Type     string
+	Full     bool
+	Scope    string
+	Table    *TableName
+	Database []byte
+	Filter   *ShowFilter
+}
+
+// Show.Type
+const (
+	AST_SHOW_TABLES    = "tables"
+	AST_SHOW_COLUMNS   = "columns"
+	AST_SHOW_VARIABLES = "variables"
+)
+
+// newShow creates a SHOW statement out of its words: the optional
+// modifier, FULL or a scope, the type, and the tables or databases
+// of its FROM or IN clauses.
+func newShow(modifier, typ []byte, from []*TableName, filter *ShowFilter) (*Show, error) {
+	show := &Show{Filter: filter}
+	switch string(typ) {
+	case AST_SHOW_TABLES:
+		show.Type = AST_SHOW_TABLES
+	case AST_SHOW_COLUMNS, "fields":
+		show.Type = AST_SHOW_COLUMNS
+	case AST_SHOW_VARIABLES:
+		show.Type = AST_SHOW_VARIABLES
+	default:
+		return nil, errors.New("expecting tables, columns or variables")
+	}
+	if modifier != nil {
+		if show.Type == AST_SHOW_VARIABLES {
+			show.Scope = setScope(modifier)
+		} else {
+			show.Full = string(modifier) == "full"
+		}
+		if show.Scope == "" && !show.Full {
+			return nil, errors.New("unexpected modifier")
+		}
+	}
+	switch show.Type {
+	case AST_SHOW_TABLES:
+		if len(from) > 1 || len(from) == 1 && from[0].Qualifier != nil {
+			return nil, errors.New("expecting a database")
+		}
+		if len(from) == 1 {
+			show.Database = from[0].Name
+		}
+	case AST_SHOW_COLUMNS:
+		if len(from) == 0 || len(from) > 2 || len(from) == 2 && from[1].Qualifier != nil {
+			return nil, errors.New("expecting a table")
+		}
+		show.Table = from[0]
+		if len(from) == 2 {
+			show.Table.Qualifier = from[1].Name
+		}
 	default:
-		buf.Myprintf("%s table %s", node.Action, node.Table)
+		if len(from) != 0 {
+			return nil, errors.New("unexpected from")
+		}
+	}
+	return show, nil
+}
+
+func (node *Show) Format(buf *TrackedBuffer) {
+	buf.Myprintf("show ")
+	if node.Full {
+		buf.Myprintf("full ")
+	}
+	if node.Scope != "" {
+		buf.Myprintf("%s ", node.Scope)
+	}
+	buf.Myprintf("%s", node.Type)
+	if node.Table != nil {
+		buf.Myprintf(" from %v", node.Table)
 	}
+	if node.Database != nil {
+		buf.Myprintf(" from ")
+		escape(buf, node.Database)
+	}
+	buf.Myprintf("%v", node.Filter)
+}
+
+// ShowFilter represents the LIKE or the WHERE clause
+// of a SHOW statement.
+type ShowFilter struct {
+	Like   []byte
+	Filter BoolExpr
+}
+
+func (node *ShowFilter) Format(buf *TrackedBuffer) {
+	if node == nil {
+		return
+	}
+	if node.Filter != nil {
+		buf.Myprintf(" where %v", node.Filter)
+		return
+	}
+	buf.Myprintf(" like %v", StrVal(node.Like))
+}
+
+// Use represents a USE statement.
+type Use struct {
+	DBName []byte
+}
+
+func (node *Use) Format(buf *TrackedBuffer) {
+	buf.Myprintf("use ")
+	escape(buf, node.DBName)
 }
 
 // Comments represents a list of comments.
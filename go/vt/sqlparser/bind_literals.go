@@ -0,0 +1,173 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// bind_literals.go replaces the literal values of a statement with
+// bind variables, so the statements that only differ by their values
+// have the same text, and can share a plan. Unlike Normalize, the
+// result is a valid statement.
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// BindLiterals replaces the string and integer literals of the
+// conditions, of the updated values and of the inserted rows of stmt
+// with bind variables named prefix1, prefix2..., and adds their values
+// to bindVars. The names already in bindVars are skipped. The select
+// list, GROUP BY, ORDER BY and LIMIT are kept as is: their literals
+// name the result columns, or refer to positions. The fractional
+// numbers are kept too, so they don't lose their precision.
+func BindLiterals(stmt Statement, bindVars map[string]interface{}, prefix string) {
+	nz := &normalizer{bindVars: bindVars, prefix: prefix}
+	switch stmt := stmt.(type) {
+	case SelectStatement:
+		nz.selectStatement(stmt)
+	case *Insert:
+		if values, ok := stmt.Rows.(Values); ok {
+			for _, tuple := range values {
+				nz.valExpr(tuple)
+			}
+		} else if sel, ok := stmt.Rows.(SelectStatement); ok {
+			nz.selectStatement(sel)
+		}
+		nz.updateExprs(UpdateExprs(stmt.OnDup))
+	case *Update:
+		nz.updateExprs(stmt.Exprs)
+		nz.where(stmt.Where)
+	case *Delete:
+		nz.where(stmt.Where)
+	}
+}
+
+// normalizer names the bind variables of BindLiterals.
+type normalizer struct {
+	bindVars map[string]interface{}
+	prefix   string
+	counter  int
+}
+
+// bindVar adds value to the bind variables and returns its argument.
+func (nz *normalizer) bindVar(value interface{}) ValArg {
+	for {
+		nz.counter++
+		name := fmt.Sprintf("%s%d", nz.prefix, nz.counter)
+		if _, ok := nz.bindVars[name]; !ok {
+			nz.bindVars[name] = value
+			return ValArg(":" + name)
+		}
+	}
+}
+
+func (nz *normalizer) selectStatement(stmt SelectStatement) {
+	switch stmt := stmt.(type) {
+	case *Select:
+		for _, expr := range stmt.From {
+			nz.tableExpr(expr)
+		}
+		nz.where(stmt.Where)
+		nz.where(stmt.Having)
+	case *Union:
+		nz.selectStatement(stmt.Left)
+		nz.selectStatement(stmt.Right)
+	case *ParenSelect:
+		nz.selectStatement(stmt.Select)
+	}
+}
+
+func (nz *normalizer) tableExpr(expr TableExpr) {
+	switch expr := expr.(type) {
+	case *AliasedTableExpr:
+		if subquery, ok := expr.Expr.(*Subquery); ok {
+			nz.selectStatement(subquery.Select)
+		}
+	case *ParenTableExpr:
+		nz.tableExpr(expr.Expr)
+	case *JoinTableExpr:
+		nz.tableExpr(expr.LeftExpr)
+		nz.tableExpr(expr.RightExpr)
+		if expr.On != nil {
+			nz.boolExpr(expr.On)
+		}
+	}
+}
+
+func (nz *normalizer) where(where *Where) {
+	if where != nil {
+		where.Expr = nz.boolExpr(where.Expr)
+	}
+}
+
+func (nz *normalizer) updateExprs(exprs UpdateExprs) {
+	for _, expr := range exprs {
+		expr.Expr = nz.valExpr(expr.Expr)
+	}
+}
+
+func (nz *normalizer) boolExpr(expr BoolExpr) BoolExpr {
+	switch expr := expr.(type) {
+	case *AndExpr:
+		expr.Left, expr.Right = nz.boolExpr(expr.Left), nz.boolExpr(expr.Right)
+	case *OrExpr:
+		expr.Left, expr.Right = nz.boolExpr(expr.Left), nz.boolExpr(expr.Right)
+	case *NotExpr:
+		expr.Expr = nz.boolExpr(expr.Expr)
+	case *ParenBoolExpr:
+		expr.Expr = nz.boolExpr(expr.Expr)
+	case *ComparisonExpr:
+		expr.Left, expr.Right = nz.valExpr(expr.Left), nz.valExpr(expr.Right)
+	case *RangeCond:
+		expr.Left, expr.From, expr.To = nz.valExpr(expr.Left), nz.valExpr(expr.From), nz.valExpr(expr.To)
+	case *NullCheck:
+		expr.Expr = nz.valExpr(expr.Expr)
+	case *ExistsExpr:
+		nz.selectStatement(expr.Subquery.Select)
+	}
+	return expr
+}
+
+func (nz *normalizer) valExpr(expr ValExpr) ValExpr {
+	switch expr := expr.(type) {
+	case StrVal:
+		return nz.bindVar([]byte(expr))
+	case NumVal:
+		if v, err := strconv.ParseInt(string(expr), 10, 64); err == nil {
+			return nz.bindVar(v)
+		}
+		if v, err := strconv.ParseUint(string(expr), 10, 64); err == nil {
+			return nz.bindVar(v)
+		}
+	case ValTuple:
+		for i := range expr {
+			expr[i] = nz.valExpr(expr[i])
+		}
+	case *Subquery:
+		nz.selectStatement(expr.Select)
+	case *BinaryExpr:
+		if left, ok := expr.Left.(ValExpr); ok {
+			expr.Left = nz.valExpr(left)
+		}
+		if right, ok := expr.Right.(ValExpr); ok {
+			expr.Right = nz.valExpr(right)
+		}
+	case *UnaryExpr:
+		if operand, ok := expr.Expr.(ValExpr); ok {
+			expr.Expr = nz.valExpr(operand)
+		}
+	case *CaseExpr:
+		if expr.Expr != nil {
+			expr.Expr = nz.valExpr(expr.Expr)
+		}
+		for _, when := range expr.Whens {
+			when.Cond = nz.boolExpr(when.Cond)
+			when.Val = nz.valExpr(when.Val)
+		}
+		if expr.Else != nil {
+			expr.Else = nz.valExpr(expr.Else)
+		}
+	}
+	return expr
+}
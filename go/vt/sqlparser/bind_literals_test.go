@@ -0,0 +1,60 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBindLiterals(t *testing.T) {
+	testcases := []struct {
+		in, out  string
+		bindVars map[string]interface{}
+	}{{
+		"select a, 1, 'b' from t where c = 'd' and e in (2, 3) group by 1 order by 2 limit 10",
+		"select a, 1, 'b' from t where c = :v1 and e in (:v2, :v3) group by 1 order by 2 asc limit 10",
+		map[string]interface{}{"v1": []byte("d"), "v2": int64(2), "v3": int64(3)},
+	}, {
+		"select * from t where a = :v1 and b between 1.5 and 18446744073709551615",
+		"select * from t where a = :v1 and b between 1.5 and :v2",
+		map[string]interface{}{"v1": "x", "v2": uint64(18446744073709551615)},
+	}, {
+		"select * from t join u on t.a = u.a and u.b = 4 where exists (select 1 from v where v.c = 'e')",
+		"select * from t join u on t.a = u.a and u.b = :v1 where exists (select 1 from v where v.c = :v2)",
+		map[string]interface{}{"v1": int64(4), "v2": []byte("e")},
+	}, {
+		"insert into t(a, b) values (1, 'c'), (-2, null) on duplicate key update b = 'd'",
+		"insert into t(a, b) values (:v1, :v2), (:v3, null) on duplicate key update b = :v4",
+		map[string]interface{}{"v1": int64(1), "v2": []byte("c"), "v3": int64(-2), "v4": []byte("d")},
+	}, {
+		"update t set a = a + 1 where b = 0x10 limit 5",
+		"update t set a = a+:v1 where b = 0x10 limit 5",
+		map[string]interface{}{"v1": int64(1)},
+	}, {
+		"delete from t where a = case when b = 1 then 'c' else 'd' end",
+		"delete from t where a = case when b = :v1 then :v2 else :v3 end",
+		map[string]interface{}{"v1": int64(1), "v2": []byte("c"), "v3": []byte("d")},
+	}}
+	for _, tc := range testcases {
+		stmt, err := Parse(tc.in)
+		if err != nil {
+			t.Errorf("Parse(%v): %v", tc.in, err)
+			continue
+		}
+		// The names of the bind variables of the query are skipped.
+		bindVars := make(map[string]interface{})
+		if v, ok := tc.bindVars["v1"].(string); ok {
+			bindVars["v1"] = v
+		}
+		BindLiterals(stmt, bindVars, "v")
+		if got := String(stmt); got != tc.out {
+			t.Errorf("BindLiterals(%v):\n%v, want\n%v", tc.in, got, tc.out)
+		}
+		if !reflect.DeepEqual(bindVars, tc.bindVars) {
+			t.Errorf("BindLiterals(%v) bind vars: %v, want %v", tc.in, bindVars, tc.bindVars)
+		}
+	}
+}
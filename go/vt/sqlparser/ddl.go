@@ -0,0 +1,552 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The grammar first recognizes the action and the tables of the DDLs.
+// The CREATE TABLE, ALTER TABLE, CREATE INDEX and DROP INDEX statements
+// are then parsed again with the rules of their definitions, into a
+// TableSpec or AlterSpecs. Statements that use something these rules
+// don't cover, like partitions or foreign keys in an ALTER, are left
+// without them: MySQL remains the judge of what is valid.
+
+// TableSpec describes the table of a CREATE TABLE statement.
+// Foreign keys and check constraints are skipped.
+type TableSpec struct {
+	Columns []*ColumnDefinition
+	Indexes []*IndexDefinition
+	Options []*TableOption
+}
+
+func (node *TableSpec) Format(buf *TrackedBuffer) {
+	buf.Myprintf("(")
+	prefix := ""
+	for _, col := range node.Columns {
+		buf.Myprintf("%s%v", prefix, col)
+		prefix = ", "
+	}
+	for _, idx := range node.Indexes {
+		buf.Myprintf("%s%v", prefix, idx)
+		prefix = ", "
+	}
+	buf.Myprintf(")")
+	for _, opt := range node.Options {
+		buf.Myprintf(" %v", opt)
+	}
+}
+
+// Column returns the definition of the column name, or nil.
+func (node *TableSpec) Column(name string) *ColumnDefinition {
+	if i := node.findColumn(name); i != -1 {
+		return node.Columns[i]
+	}
+	return nil
+}
+
+// Index returns the definition of the index name, or nil.
+// The primary key is named PRIMARY.
+func (node *TableSpec) Index(name string) *IndexDefinition {
+	if i := node.findIndex(name); i != -1 {
+		return node.Indexes[i]
+	}
+	return nil
+}
+
+func (node *TableSpec) findColumn(name string) int {
+	for i, col := range node.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (node *TableSpec) findIndex(name string) int {
+	for i, idx := range node.Indexes {
+		if strings.EqualFold(idx.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ColumnDefinition describes a column. Type is formatted like the
+// COLUMN_TYPE of information_schema.columns, e.g. "int(10) unsigned".
+// Default and OnUpdate are nil if not set.
+type ColumnDefinition struct {
+	Name          string
+	Type          string
+	Charset       string
+	Collate       string
+	NotNull       bool
+	Default       ValExpr
+	OnUpdate      ValExpr
+	Autoincrement bool
+	Comment       string
+}
+
+func (node *ColumnDefinition) Format(buf *TrackedBuffer) {
+	escape(buf, []byte(node.Name))
+	buf.Myprintf(" %s", node.Type)
+	if node.Charset != "" {
+		buf.Myprintf(" character set %s", node.Charset)
+	}
+	if node.Collate != "" {
+		buf.Myprintf(" collate %s", node.Collate)
+	}
+	if node.NotNull {
+		buf.Myprintf(" not null")
+	}
+	if node.Default != nil {
+		buf.Myprintf(" default %v", node.Default)
+	}
+	if node.OnUpdate != nil {
+		buf.Myprintf(" on update %v", node.OnUpdate)
+	}
+	if node.Autoincrement {
+		buf.Myprintf(" auto_increment")
+	}
+	if node.Comment != "" {
+		buf.Myprintf(" comment %v", StrVal(node.Comment))
+	}
+}
+
+// IndexDefinition describes an index. The primary key is named PRIMARY.
+type IndexDefinition struct {
+	Name    string
+	Type    string
+	Columns []*IndexColumn
+}
+
+// IndexDefinition.Type
+const (
+	AST_PRIMARY_KEY  = "primary key"
+	AST_UNIQUE_KEY   = "unique key"
+	AST_FULLTEXT_KEY = "fulltext key"
+	AST_SPATIAL_KEY  = "spatial key"
+	AST_KEY          = "key"
+)
+
+// PrimaryKeyName is the name of the primary key.
+const PrimaryKeyName = "PRIMARY"
+
+func (node *IndexDefinition) Format(buf *TrackedBuffer) {
+	buf.Myprintf("%s ", node.Type)
+	if node.Type != AST_PRIMARY_KEY && node.Name != "" {
+		escape(buf, []byte(node.Name))
+		buf.Myprintf(" ")
+	}
+	buf.Myprintf("(")
+	for i, col := range node.Columns {
+		if i != 0 {
+			buf.Myprintf(", ")
+		}
+		buf.Myprintf("%v", col)
+	}
+	buf.Myprintf(")")
+}
+
+// IndexColumn is a column of an index. Length is the
+// length of the indexed prefix, empty for the whole column.
+type IndexColumn struct {
+	Name   string
+	Length string
+}
+
+func (node *IndexColumn) Format(buf *TrackedBuffer) {
+	escape(buf, []byte(node.Name))
+	if node.Length != "" {
+		buf.Myprintf("(%s)", node.Length)
+	}
+}
+
+// TableOption is a table option, like engine=InnoDB. The names are
+// lower-cased, and the synonyms of charset are reduced to it. Value
+// is the SQL of the value: strings are quoted, and words lower-cased.
+type TableOption struct {
+	Name  string
+	Value string
+}
+
+func (node *TableOption) Format(buf *TrackedBuffer) {
+	buf.Myprintf("%s=%s", node.Name, node.Value)
+}
+
+// AlterSpec is a change of an ALTER TABLE statement. Column is
+// set for the column additions and modifications, Index for the
+// index additions, Options for the table options. Name is the
+// dropped column or index, or the changed column. First and After
+// are the position of an added or modified column.
+type AlterSpec struct {
+	Action  string
+	Column  *ColumnDefinition
+	Index   *IndexDefinition
+	Options []*TableOption
+	Name    string
+	First   bool
+	After   string
+}
+
+// AlterSpec.Action
+const (
+	AST_ADD_COLUMN    = "add column"
+	AST_DROP_COLUMN   = "drop column"
+	AST_MODIFY_COLUMN = "modify column"
+	AST_CHANGE_COLUMN = "change column"
+	AST_ADD_INDEX     = "add index"
+	AST_DROP_INDEX    = "drop index"
+	AST_TABLE_OPTIONS = "table options"
+)
+
+func (node *AlterSpec) Format(buf *TrackedBuffer) {
+	switch node.Action {
+	case AST_ADD_COLUMN, AST_MODIFY_COLUMN:
+		buf.Myprintf("%s %v", node.Action, node.Column)
+	case AST_CHANGE_COLUMN:
+		buf.Myprintf("%s ", node.Action)
+		escape(buf, []byte(node.Name))
+		buf.Myprintf(" %v", node.Column)
+	case AST_DROP_COLUMN:
+		buf.Myprintf("%s ", node.Action)
+		escape(buf, []byte(node.Name))
+	case AST_ADD_INDEX:
+		buf.Myprintf("add %v", node.Index)
+	case AST_DROP_INDEX:
+		if strings.EqualFold(node.Name, PrimaryKeyName) {
+			buf.Myprintf("drop primary key")
+		} else {
+			buf.Myprintf("%s ", node.Action)
+			escape(buf, []byte(node.Name))
+		}
+	case AST_TABLE_OPTIONS:
+		for i, opt := range node.Options {
+			if i != 0 {
+				buf.Myprintf(" ")
+			}
+			buf.Myprintf("%v", opt)
+		}
+	}
+	if node.First {
+		buf.Myprintf(" first")
+	} else if node.After != "" {
+		buf.Myprintf(" after ")
+		escape(buf, []byte(node.After))
+	}
+}
+
+// AlterSpecs represents the changes of an ALTER TABLE statement.
+type AlterSpecs []*AlterSpec
+
+func (node AlterSpecs) Format(buf *TrackedBuffer) {
+	var prefix string
+	for _, n := range node {
+		buf.Myprintf("%s%v", prefix, n)
+		prefix = ", "
+	}
+}
+
+// Alter returns the table spec that results from applying alters
+// to node, which is left unchanged. It returns an error if they
+// can't apply: an added column or index already exists, or a
+// changed or dropped one doesn't.
+func (node *TableSpec) Alter(alters AlterSpecs) (*TableSpec, error) {
+	spec := &TableSpec{
+		Columns: append([]*ColumnDefinition(nil), node.Columns...),
+		Indexes: append([]*IndexDefinition(nil), node.Indexes...),
+		Options: append([]*TableOption(nil), node.Options...),
+	}
+	for _, alter := range alters {
+		var err error
+		switch alter.Action {
+		case AST_ADD_COLUMN:
+			if spec.findColumn(alter.Column.Name) != -1 {
+				return nil, fmt.Errorf("duplicate column name %s", alter.Column.Name)
+			}
+			err = spec.placeColumn(alter.Column, len(spec.Columns), alter)
+		case AST_DROP_COLUMN:
+			i := spec.findColumn(alter.Name)
+			if i == -1 {
+				return nil, fmt.Errorf("unknown column %s", alter.Name)
+			}
+			spec.Columns = append(spec.Columns[:i:i], spec.Columns[i+1:]...)
+			spec.renameIndexColumn(alter.Name, "")
+		case AST_MODIFY_COLUMN, AST_CHANGE_COLUMN:
+			name := alter.Name
+			if alter.Action == AST_MODIFY_COLUMN {
+				name = alter.Column.Name
+			}
+			i := spec.findColumn(name)
+			if i == -1 {
+				return nil, fmt.Errorf("unknown column %s", name)
+			}
+			if j := spec.findColumn(alter.Column.Name); j != -1 && j != i {
+				return nil, fmt.Errorf("duplicate column name %s", alter.Column.Name)
+			}
+			spec.Columns = append(spec.Columns[:i:i], spec.Columns[i+1:]...)
+			err = spec.placeColumn(alter.Column, i, alter)
+			spec.renameIndexColumn(name, alter.Column.Name)
+		case AST_ADD_INDEX:
+			err = spec.addIndex(alter.Index)
+		case AST_DROP_INDEX:
+			i := spec.findIndex(alter.Name)
+			if i == -1 {
+				return nil, fmt.Errorf("unknown index %s", alter.Name)
+			}
+			spec.Indexes = append(spec.Indexes[:i:i], spec.Indexes[i+1:]...)
+		case AST_TABLE_OPTIONS:
+			for _, opt := range alter.Options {
+				spec.setOption(opt)
+			}
+		default:
+			err = fmt.Errorf("unknown alter action %s", alter.Action)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+// placeColumn inserts col at the position of alter, or at i if
+// alter doesn't have one.
+func (node *TableSpec) placeColumn(col *ColumnDefinition, i int, alter *AlterSpec) error {
+	switch {
+	case alter.First:
+		i = 0
+	case alter.After != "":
+		if i = node.findColumn(alter.After); i == -1 {
+			return fmt.Errorf("unknown column %s", alter.After)
+		}
+		i++
+	}
+	columns := make([]*ColumnDefinition, 0, len(node.Columns)+1)
+	columns = append(columns, node.Columns[:i]...)
+	columns = append(columns, col)
+	node.Columns = append(columns, node.Columns[i:]...)
+	return nil
+}
+
+// renameIndexColumn renames the column from in the indexes, or
+// removes it if to is empty. Indexes left without columns are dropped.
+func (node *TableSpec) renameIndexColumn(from, to string) {
+	indexes := node.Indexes[:0:0]
+	for _, idx := range node.Indexes {
+		var columns []*IndexColumn
+		changed := false
+		for _, col := range idx.Columns {
+			if !strings.EqualFold(col.Name, from) {
+				columns = append(columns, col)
+				continue
+			}
+			changed = true
+			if to != "" {
+				columns = append(columns, &IndexColumn{Name: to, Length: col.Length})
+			}
+		}
+		if changed {
+			if len(columns) == 0 {
+				continue
+			}
+			idx = &IndexDefinition{Name: idx.Name, Type: idx.Type, Columns: columns}
+		}
+		indexes = append(indexes, idx)
+	}
+	node.Indexes = indexes
+}
+
+// addIndex adds idx to the indexes. Like MySQL, it names an
+// unnamed index after its first column.
+func (node *TableSpec) addIndex(idx *IndexDefinition) error {
+	for _, col := range idx.Columns {
+		if node.findColumn(col.Name) == -1 {
+			return fmt.Errorf("unknown column %s in index", col.Name)
+		}
+	}
+	if idx.Type == AST_PRIMARY_KEY {
+		if node.findIndex(PrimaryKeyName) != -1 {
+			return fmt.Errorf("multiple primary key defined")
+		}
+		node.Indexes = append([]*IndexDefinition{idx}, node.Indexes...)
+		return nil
+	}
+	if idx.Name == "" {
+		named := *idx
+		named.Name = node.indexName(idx)
+		idx = &named
+	}
+	if node.findIndex(idx.Name) != -1 {
+		return fmt.Errorf("duplicate key name %s", idx.Name)
+	}
+	node.Indexes = append(node.Indexes, idx)
+	return nil
+}
+
+// indexName returns the name MySQL gives to the unnamed index idx.
+func (node *TableSpec) indexName(idx *IndexDefinition) string {
+	name := idx.Columns[0].Name
+	for i := 2; node.findIndex(name) != -1; i++ {
+		name = fmt.Sprintf("%s_%d", idx.Columns[0].Name, i)
+	}
+	return name
+}
+
+func (node *TableSpec) setOption(opt *TableOption) {
+	for i, o := range node.Options {
+		if o.Name == opt.Name {
+			node.Options[i] = opt
+			return
+		}
+	}
+	node.Options = append(node.Options, opt)
+}
+
+// DiffTables returns the changes that alter the table from into the
+// table to. The order of the columns and of the indexes is ignored.
+func DiffTables(from, to *TableSpec) AlterSpecs {
+	var alters AlterSpecs
+	for _, idx := range from.Indexes {
+		if other := to.Index(idx.Name); other == nil || String(other) != String(idx) {
+			alters = append(alters, &AlterSpec{Action: AST_DROP_INDEX, Name: idx.Name})
+		}
+	}
+	for _, col := range from.Columns {
+		if to.Column(col.Name) == nil {
+			alters = append(alters, &AlterSpec{Action: AST_DROP_COLUMN, Name: col.Name})
+		}
+	}
+	for _, col := range to.Columns {
+		other := from.Column(col.Name)
+		switch {
+		case other == nil:
+			alters = append(alters, &AlterSpec{Action: AST_ADD_COLUMN, Column: col})
+		case String(other) != String(col):
+			alters = append(alters, &AlterSpec{Action: AST_MODIFY_COLUMN, Column: col})
+		}
+	}
+	for _, idx := range to.Indexes {
+		if other := from.Index(idx.Name); other == nil || String(other) != String(idx) {
+			alters = append(alters, &AlterSpec{Action: AST_ADD_INDEX, Index: idx})
+		}
+	}
+	var options []*TableOption
+	for _, opt := range to.Options {
+		changed := true
+		for _, other := range from.Options {
+			if other.Name == opt.Name {
+				changed = other.Value != opt.Value
+				break
+			}
+		}
+		if changed {
+			options = append(options, opt)
+		}
+	}
+	if options != nil {
+		alters = append(alters, &AlterSpec{Action: AST_TABLE_OPTIONS, Options: options})
+	}
+	return alters
+}
+
+// parseDDLSpec sets the TableSpec or the AlterSpecs of ddl, the DDL
+// of sql, by parsing it again with the rules of the grammar for the
+// definitions. It leaves them nil if sql uses something they don't
+// cover.
+func parseDDLSpec(sql string, ddl *DDL) {
+	tokenizer := NewStringTokenizer(sql)
+	tokenizer.ddlSpec, tokenizer.ddlSpecStart = true, true
+	if yyParse(tokenizer) != 0 {
+		return
+	}
+	spec := tokenizer.ParseTree.(*DDL)
+	ddl.TableSpec, ddl.AlterSpecs = spec.TableSpec, spec.AlterSpecs
+}
+
+// columnSpec is a column definition being parsed, with
+// the indexes defined by its attributes.
+type columnSpec struct {
+	column  *ColumnDefinition
+	indexes []*IndexDefinition
+}
+
+// addIndex adds an index of typ on the column.
+func (cs *columnSpec) addIndex(typ string) {
+	name := PrimaryKeyName
+	if typ != AST_PRIMARY_KEY {
+		name = cs.column.Name
+	}
+	cs.indexes = append(cs.indexes, &IndexDefinition{
+		Name:    name,
+		Type:    typ,
+		Columns: []*IndexColumn{{Name: cs.column.Name}},
+	})
+}
+
+func (node *TableSpec) addColumn(cs *columnSpec) {
+	node.Columns = append(node.Columns, cs.column)
+	node.Indexes = append(node.Indexes, cs.indexes...)
+}
+
+// addIndexDefinition adds idx, unless it's nil for
+// a skipped foreign key or check constraint.
+func (node *TableSpec) addIndexDefinition(idx *IndexDefinition) {
+	if idx != nil {
+		node.Indexes = append(node.Indexes, idx)
+	}
+}
+
+// nameIndexes names the unnamed indexes like MySQL does.
+func (node *TableSpec) nameIndexes() {
+	for _, idx := range node.Indexes {
+		if idx.Name == "" {
+			idx.Name = node.indexName(idx)
+		}
+	}
+}
+
+// appendAlterSpecs appends more to alters. Consecutive table
+// options are merged into one AST_TABLE_OPTIONS.
+func appendAlterSpecs(alters AlterSpecs, more ...*AlterSpec) AlterSpecs {
+	for _, alter := range more {
+		if n := len(alters); n != 0 && alter.Action == AST_TABLE_OPTIONS && alters[n-1].Action == AST_TABLE_OPTIONS {
+			alters[n-1].Options = append(alters[n-1].Options, alter.Options...)
+			continue
+		}
+		alters = append(alters, alter)
+	}
+	return alters
+}
+
+// timeFuncs are the functions that can be the default of a
+// column without parentheses.
+var timeFuncs = map[string]bool{
+	"current_timestamp": true,
+	"localtime":         true,
+	"localtimestamp":    true,
+	"now":               true,
+}
+
+// tableOptions are the table options that are understood.
+var tableOptions = map[string]bool{
+	"auto_increment":     true,
+	"avg_row_length":     true,
+	"charset":            true,
+	"checksum":           true,
+	"collate":            true,
+	"comment":            true,
+	"delay_key_write":    true,
+	"engine":             true,
+	"key_block_size":     true,
+	"max_rows":           true,
+	"min_rows":           true,
+	"pack_keys":          true,
+	"row_format":         true,
+	"stats_auto_recalc":  true,
+	"stats_persistent":   true,
+	"stats_sample_pages": true,
+}
@@ -0,0 +1,209 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"testing"
+)
+
+func parseDDL(t *testing.T, sql string) *DDL {
+	stmt, err := Parse(sql)
+	if err != nil {
+		t.Fatalf("Parse(%v): %v", sql, err)
+	}
+	ddl, ok := stmt.(*DDL)
+	if !ok {
+		t.Fatalf("Parse(%v): %T, want *DDL", sql, stmt)
+	}
+	return ddl
+}
+
+func TestParseTableSpec(t *testing.T) {
+	testcases := []struct {
+		in, out string
+	}{{
+		"create table a (id int)",
+		"(id int)",
+	}, {
+		"create table if not exists `a` (\n" +
+			"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `name` varchar(255) CHARACTER SET utf8 COLLATE utf8_bin DEFAULT 'x''y' COMMENT 'the name',\n" +
+			"  `price` decimal(10,2) DEFAULT -1.5,\n" +
+			"  `kind` enum('a','b') NOT NULL DEFAULT 'a',\n" +
+			"  `key` int DEFAULT NULL,\n" +
+			"  `updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  UNIQUE KEY `name_idx` (`name`(10)),\n" +
+			"  KEY (`kind`, `price` DESC) USING BTREE,\n" +
+			"  CONSTRAINT `fk` FOREIGN KEY (`key`) REFERENCES `b` (`id`) ON DELETE CASCADE\n" +
+			") ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8 COMMENT='vtocc_nocache'",
+		"(id bigint(20) unsigned not null auto_increment, " +
+			"name varchar(255) character set utf8 collate utf8_bin default 'x\\'y' comment 'the name', " +
+			"price decimal(10,2) default -1.5, " +
+			"kind enum('a','b') not null default 'a', " +
+			"`key` int default null, " +
+			"updated timestamp not null default current_timestamp() on update current_timestamp(), " +
+			"primary key (id), unique key name_idx (name(10)), key kind (kind, price)) " +
+			"engine=innodb auto_increment=10 charset=utf8 comment='vtocc_nocache'",
+	}, {
+		"create table a (id int primary key, b int unique, c set('x'))",
+		"(id int, b int, c set('x'), primary key (id), unique key b (b))",
+	}, {
+		"create table a.b (comment int unique key, first binary(16) comment 'x', primary key using hash (comment));",
+		"(comment int, first binary(16) comment 'x', unique key comment (comment), primary key (comment))",
+	}}
+	for _, tc := range testcases {
+		ddl := parseDDL(t, tc.in)
+		if ddl.TableSpec == nil {
+			t.Errorf("Parse(%v): no table spec", tc.in)
+			continue
+		}
+		if got := String(ddl.TableSpec); got != tc.out {
+			t.Errorf("Parse(%v):\n%v, want\n%v", tc.in, got, tc.out)
+		}
+	}
+
+	// Statements that only the grammar understands.
+	for _, sql := range []string{
+		"create table a(abcd)",
+		"create table a like b",
+		"create table a (id int) partition by hash(id)",
+		"drop table a",
+	} {
+		if ddl := parseDDL(t, sql); ddl.TableSpec != nil || ddl.AlterSpecs != nil {
+			t.Errorf("Parse(%v): %v %v, want no spec", sql, ddl.TableSpec, ddl.AlterSpecs)
+		}
+	}
+}
+
+func TestParseAlterSpecs(t *testing.T) {
+	testcases := []struct {
+		in, out string
+	}{{
+		"alter table a add column b int not null default 0 after id",
+		"add column b int not null default 0 after id",
+	}, {
+		"alter table a add (b int, c text), drop column d, drop e",
+		"add column b int, add column c text, drop column d, drop column e",
+	}, {
+		"alter ignore table a modify b bigint first, change c d varchar(10) comment 'x'",
+		"modify column b bigint first, change column c d varchar(10) comment 'x'",
+	}, {
+		"alter table a add index b_idx (b), add unique (c), add primary key (id), drop index e, drop primary key",
+		"add key b_idx (b), add unique key (c), add primary key (id), drop index e, drop primary key",
+	}, {
+		"alter table a engine=InnoDB comment 'x', algorithm=inplace, lock=none",
+		"engine=innodb comment='x'",
+	}, {
+		"create unique index b_idx using btree on a (b, c(5))",
+		"add unique key b_idx (b, c(5))",
+	}, {
+		"drop index b_idx on a",
+		"drop index b_idx",
+	}}
+	for _, tc := range testcases {
+		ddl := parseDDL(t, tc.in)
+		if ddl.AlterSpecs == nil {
+			t.Errorf("Parse(%v): no alter specs", tc.in)
+			continue
+		}
+		if got := String(ddl.AlterSpecs); got != tc.out {
+			t.Errorf("Parse(%v):\n%v, want\n%v", tc.in, got, tc.out)
+		}
+	}
+
+	for _, sql := range []string{
+		"alter table a rename b",
+		"alter table a add foreign key (b) references c (d)",
+		"alter table a alter column b set default 1",
+		"alter table a convert to character set utf8",
+	} {
+		if ddl := parseDDL(t, sql); ddl.AlterSpecs != nil {
+			t.Errorf("Parse(%v): %v, want no alter specs", sql, String(ddl.AlterSpecs))
+		}
+	}
+}
+
+func TestTableSpecAlter(t *testing.T) {
+	spec := parseDDL(t, "create table a (id int, b int, c int, primary key (id), key bc (b, c)) engine=InnoDB").TableSpec
+	testcases := []struct {
+		alter, out, err string
+	}{{
+		"alter table a add d int after id, drop c, modify b bigint, comment 'x'",
+		"(id int, d int, b bigint, primary key (id), key bc (b)) engine=innodb comment='x'",
+		"",
+	}, {
+		"alter table a change b e int first, add key (e), add key (e), drop primary key",
+		"(e int, id int, c int, key bc (e, c), key e (e), key e_2 (e)) engine=innodb",
+		"",
+	}, {
+		"alter table a add b int",
+		"",
+		"duplicate column name b",
+	}, {
+		"alter table a drop column d",
+		"",
+		"unknown column d",
+	}, {
+		"alter table a change b c int",
+		"",
+		"duplicate column name c",
+	}, {
+		"alter table a add primary key (b)",
+		"",
+		"multiple primary key defined",
+	}, {
+		"alter table a add key bc (c)",
+		"",
+		"duplicate key name bc",
+	}, {
+		"alter table a add key (d)",
+		"",
+		"unknown column d in index",
+	}, {
+		"alter table a drop index d",
+		"",
+		"unknown index d",
+	}}
+	for _, tc := range testcases {
+		altered, err := spec.Alter(parseDDL(t, tc.alter).AlterSpecs)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("Alter(%v): %v, want %v", tc.alter, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Alter(%v): %v", tc.alter, err)
+			continue
+		}
+		if got := String(altered); got != tc.out {
+			t.Errorf("Alter(%v):\n%v, want\n%v", tc.alter, got, tc.out)
+		}
+	}
+	if got, want := String(spec), "(id int, b int, c int, primary key (id), key bc (b, c)) engine=innodb"; got != want {
+		t.Errorf("Alter changed the spec: %v, want %v", got, want)
+	}
+}
+
+func TestDiffTables(t *testing.T) {
+	from := parseDDL(t, "create table a (id int, b int, c int, primary key (id), key bc (b, c)) engine=InnoDB comment 'x'").TableSpec
+	to := parseDDL(t, "create table a (id bigint, b int, d text, primary key (id), key bc (b), key d (d(10))) engine=InnoDB comment 'y'").TableSpec
+	alters := DiffTables(from, to)
+	want := "drop index bc, drop column c, modify column id bigint, add column d text, add key bc (b), add key d (d(10)), comment='y'"
+	if got := String(alters); got != want {
+		t.Errorf("DiffTables:\n%v, want\n%v", got, want)
+	}
+	altered, err := from.Alter(alters)
+	if err != nil {
+		t.Fatalf("Alter: %v", err)
+	}
+	if got, want := String(altered), String(to); got != want {
+		t.Errorf("Alter(DiffTables):\n%v, want\n%v", got, want)
+	}
+	if alters := DiffTables(to, to); alters != nil {
+		t.Errorf("DiffTables(to, to): %v, want none", String(alters))
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// directives.go parses the query directives, which applications give
+// in comments like /*vt+ QUERY_TIMEOUT_MS=100 SKIP_ROWCACHE */.
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// DIRECTIVE_PREFIX starts the comments that contain directives.
+const DIRECTIVE_PREFIX = "/*vt+"
+
+const (
+	// DIRECTIVE_QUERY_TIMEOUT overrides the query timeout,
+	// in milliseconds.
+	DIRECTIVE_QUERY_TIMEOUT = "QUERY_TIMEOUT_MS"
+	// DIRECTIVE_SKIP_ROWCACHE reads the rows from MySQL
+	// instead of the rowcache.
+	DIRECTIVE_SKIP_ROWCACHE = "SKIP_ROWCACHE"
+	// DIRECTIVE_WORKLOAD is the kind of workload of the query,
+	// WORKLOAD_OLTP or WORKLOAD_OLAP.
+	DIRECTIVE_WORKLOAD = "WORKLOAD"
+	// DIRECTIVE_MAX_ROWS lowers the maximum number of rows
+	// of the result.
+	DIRECTIVE_MAX_ROWS = "MAX_ROWS"
+	// DIRECTIVE_PRIORITY lowers the priority of the query when
+	// MySQL is overloaded, PRIORITY_LOW, PRIORITY_NORMAL or
+	// PRIORITY_HIGH.
+	DIRECTIVE_PRIORITY = "PRIORITY"
+)
+
+const (
+	WORKLOAD_OLTP = "oltp"
+	WORKLOAD_OLAP = "olap"
+)
+
+const (
+	PRIORITY_LOW    = "low"
+	PRIORITY_NORMAL = "normal"
+	PRIORITY_HIGH   = "high"
+)
+
+// Directives are the directives of a query, by name. The directives
+// given without a value, like SKIP_ROWCACHE, are set to "true".
+type Directives map[string]string
+
+// ExtractDirectives returns the directives of the /*vt+ */ comments,
+// or nil if there are none. The later directives override the earlier
+// ones of the same name.
+func ExtractDirectives(comments Comments) Directives {
+	var directives Directives
+	for _, comment := range comments {
+		if !bytes.HasPrefix(comment, []byte(DIRECTIVE_PREFIX)) || !bytes.HasSuffix(comment, []byte("*/")) {
+			continue
+		}
+		if directives == nil {
+			directives = make(Directives)
+		}
+		body := string(comment[len(DIRECTIVE_PREFIX) : len(comment)-2])
+		for _, directive := range strings.Fields(body) {
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				directives[directive[:i]] = directive[i+1:]
+			} else {
+				directives[directive] = "true"
+			}
+		}
+	}
+	return directives
+}
+
+// GetDirectives returns the directives of the comments of statement,
+// or nil if there are none.
+func GetDirectives(statement Statement) Directives {
+	switch stmt := statement.(type) {
+	case *Select:
+		return ExtractDirectives(stmt.Comments)
+	case *Insert:
+		return ExtractDirectives(stmt.Comments)
+	case *Update:
+		return ExtractDirectives(stmt.Comments)
+	case *Delete:
+		return ExtractDirectives(stmt.Comments)
+	case *Set:
+		return ExtractDirectives(stmt.Comments)
+	}
+	return nil
+}
+
+// SplitComments returns the comments of sql, which is expected to
+// contain only comments and blanks, like the trailing comments of a
+// query. It stops at the first token that is not a comment.
+func SplitComments(sql string) Comments {
+	var comments Comments
+	tokenizer := NewStringTokenizer(sql)
+	for {
+		typ, val := tokenizer.Scan()
+		if typ != COMMENT {
+			return comments
+		}
+		comments = append(comments, val)
+	}
+}
+
+// IsSet returns true if the directive name is set to anything but
+// "false".
+func (d Directives) IsSet(name string) bool {
+	val, ok := d[name]
+	return ok && val != "false"
+}
+
+// GetInt returns the value of the integer directive name, or
+// defaultVal if it's not set.
+func (d Directives) GetInt(name string, defaultVal int64) (int64, error) {
+	val, ok := d[name]
+	if !ok {
+		return defaultVal, nil
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
@@ -0,0 +1,61 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetDirectives(t *testing.T) {
+	tcases := []struct {
+		input  string
+		output Directives
+	}{
+		{
+			"select * from a",
+			nil,
+		}, {
+			"select /* comment */ * from a",
+			nil,
+		}, {
+			"select /*vt+ QUERY_TIMEOUT_MS=100 SKIP_ROWCACHE */ * from a",
+			Directives{"QUERY_TIMEOUT_MS": "100", "SKIP_ROWCACHE": "true"},
+		}, {
+			"update /*vt+ MAX_ROWS=1 */ /*vt+ MAX_ROWS=2 */ a set b = 1",
+			Directives{"MAX_ROWS": "2"},
+		}, {
+			"delete /*vt+ WORKLOAD=olap */ from a",
+			Directives{"WORKLOAD": "olap"},
+		},
+	}
+	for _, tcase := range tcases {
+		statement, err := Parse(tcase.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tcase.input, err)
+			continue
+		}
+		if got := GetDirectives(statement); !reflect.DeepEqual(got, tcase.output) {
+			t.Errorf("GetDirectives(%q): %v, want %v", tcase.input, got, tcase.output)
+		}
+	}
+}
+
+func TestSplitComments(t *testing.T) {
+	got := ExtractDirectives(SplitComments(" /* a */ /*vt+ MAX_ROWS=10 */\n-- b\n"))
+	want := Directives{"MAX_ROWS": "10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractDirectives: %v, want %v", got, want)
+	}
+	if n, err := got.GetInt(DIRECTIVE_MAX_ROWS, 0); err != nil || n != 10 {
+		t.Errorf("GetInt: %d, %v, want 10", n, err)
+	}
+	if n, err := got.GetInt(DIRECTIVE_QUERY_TIMEOUT, 5); err != nil || n != 5 {
+		t.Errorf("GetInt of a missing directive: %d, %v, want 5", n, err)
+	}
+	if got.IsSet(DIRECTIVE_SKIP_ROWCACHE) {
+		t.Errorf("IsSet(%s): true, want false", DIRECTIVE_SKIP_ROWCACHE)
+	}
+}
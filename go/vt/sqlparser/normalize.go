@@ -0,0 +1,81 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// normalize.go computes the fingerprints of the statements: their
+// text without their values, so that the statements that only differ
+// by their values, by the number of values of their lists, or by the
+// names of their bind variables, can be grouped.
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// NormalizeStatement replaces the literals of stmt with bind variables
+// like BindLiterals does, and returns the fingerprint of stmt.
+func NormalizeStatement(stmt Statement, bindVars map[string]interface{}, prefix string) string {
+	BindLiterals(stmt, bindVars, prefix)
+	return Fingerprint(stmt)
+}
+
+// Fingerprint returns the text of stmt without its comments, and with
+// its literals and bind variables replaced by '?'. The lists of values
+// are collapsed to '(?)', and the inserted rows that have the same
+// fingerprint are only written once. Unlike the result of
+// BindLiterals, the fingerprint is not a valid statement.
+func Fingerprint(stmt Statement) string {
+	return fingerprintOf(stmt)
+}
+
+// FingerprintHash returns a stable hash of fingerprint, as 16
+// hexadecimal digits, to key the stats and the logs by.
+func FingerprintHash(fingerprint string) string {
+	h := fnv.New64a()
+	h.Write([]byte(fingerprint))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+func fingerprintOf(node SQLNode) string {
+	buf := NewTrackedBuffer(formatFingerprint)
+	buf.Myprintf("%v", node)
+	return buf.String()
+}
+
+// formatFingerprint is the TrackedBuffer callback of Fingerprint.
+func formatFingerprint(buf *TrackedBuffer, node SQLNode) {
+	switch node := node.(type) {
+	case Comments:
+	case StrVal, NumVal, ValArg:
+		buf.WriteString("?")
+	case ValTuple:
+		for _, expr := range node {
+			if !isFingerprintValue(expr) {
+				node.Format(buf)
+				return
+			}
+		}
+		buf.WriteString("(?)")
+	case Values:
+		prefix, last := "values ", ""
+		for _, row := range node {
+			if row := fingerprintOf(row); row != last {
+				buf.Myprintf("%s%s", prefix, row)
+				prefix, last = ", ", row
+			}
+		}
+	default:
+		node.Format(buf)
+	}
+}
+
+// isFingerprintValue returns true if the fingerprint of expr is '?'.
+func isFingerprintValue(expr ValExpr) bool {
+	switch expr.(type) {
+	case StrVal, NumVal, ValArg:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	testcases := []struct {
+		in  []string
+		out string
+	}{{
+		[]string{
+			"select /* trace 1 */ a, 'b' from t where c = 'd' and e in (1, 2, 3) limit 10",
+			"select a, 'x' from t where c = :c and e in (:e) limit 20",
+			"select a, 'b' from t where c = 'f' and e in (:v1, -4) limit :n",
+		},
+		"select a, ? from t where c = ? and e in (?) limit ?",
+	}, {
+		[]string{
+			"insert into t(a, b) values (1, 'c')",
+			"insert into t(a, b) values (1, 'c'), (:a, :b), (-2, 'd')",
+		},
+		"insert into t(a, b) values (?)",
+	}, {
+		[]string{
+			"insert into t(a, b) values (1, now()), (2, now()), (3, 'c')",
+		},
+		"insert into t(a, b) values (?, now()), (?)",
+	}, {
+		[]string{
+			"update t set a = a + 1 where b is null and c in (d, 2)",
+		},
+		"update t set a = a+? where b is null and c in (d, ?)",
+	}}
+	for _, tc := range testcases {
+		for _, sql := range tc.in {
+			stmt, err := Parse(sql)
+			if err != nil {
+				t.Errorf("Parse(%v): %v", sql, err)
+				continue
+			}
+			if got := Fingerprint(stmt); got != tc.out {
+				t.Errorf("Fingerprint(%v):\n%v, want\n%v", sql, got, tc.out)
+			}
+		}
+	}
+}
+
+func TestNormalizeStatement(t *testing.T) {
+	stmt, err := Parse("select * from t where a = 1 and b = 'c'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindVars := make(map[string]interface{})
+	fingerprint := NormalizeStatement(stmt, bindVars, "v")
+	if want := "select * from t where a = ? and b = ?"; fingerprint != want {
+		t.Errorf("NormalizeStatement: %v, want %v", fingerprint, want)
+	}
+	if got, want := String(stmt), "select * from t where a = :v1 and b = :v2"; got != want {
+		t.Errorf("NormalizeStatement query: %v, want %v", got, want)
+	}
+	if want := map[string]interface{}{"v1": int64(1), "v2": []byte("c")}; !reflect.DeepEqual(bindVars, want) {
+		t.Errorf("NormalizeStatement bind vars: %v, want %v", bindVars, want)
+	}
+
+	if got, want := FingerprintHash(fingerprint), FingerprintHash("select * from t where a = ? and b = ?"); got != want || len(got) != 16 {
+		t.Errorf("FingerprintHash: %v, want %v", got, want)
+	}
+	if FingerprintHash(fingerprint) == FingerprintHash("select * from t where a = ?") {
+		t.Errorf("FingerprintHash: same hash for different fingerprints")
+	}
+}
@@ -19,18 +19,22 @@ func ForceEOF(yylex interface{}) {
 }
 
 var (
-	SHARE        = []byte("share")
-	MODE         = []byte("mode")
-	IF_BYTES     = []byte("if")
-	VALUES_BYTES = []byte("values")
+	SHARE           = []byte("share")
+	MODE            = []byte("mode")
+	IF_BYTES        = []byte("if")
+	VALUES_BYTES    = []byte("values")
+	CHARACTER_BYTES = []byte("character")
+	WORK            = []byte("work")
+	TEMPORARY_BYTES = []byte("temporary")
 )
 
-//line sql.y:31
+//line sql.y:35
 type yySymType struct {
 	yys         int
 	empty       struct{}
 	statement   Statement
 	selStmt     SelectStatement
+	sel         *Select
 	byt         byte
 	bytes       []byte
 	bytes2      [][]byte
@@ -60,6 +64,18 @@ type yySymType struct {
 	insRows     InsertRows
 	updateExprs UpdateExprs
 	updateExpr  *UpdateExpr
+	tableNames  []*TableName
+	showFilter  *ShowFilter
+	tableSpec   *TableSpec
+	columnSpec  *columnSpec
+	columnDef   *ColumnDefinition
+	indexDef    *IndexDefinition
+	indexCols   []*IndexColumn
+	indexCol    *IndexColumn
+	tableOpts   []*TableOption
+	tableOpt    *TableOption
+	alterSpecs  AlterSpecs
+	alterSpec   *AlterSpec
 }
 
 const LEX_ERROR = 57346
@@ -89,55 +105,87 @@ const DESC = 57369
 const VALUES = 57370
 const INTO = 57371
 const DUPLICATE = 57372
-const KEY = 57373
-const DEFAULT = 57374
-const SET = 57375
-const LOCK = 57376
-const ID = 57377
-const STRING = 57378
-const NUMBER = 57379
-const VALUE_ARG = 57380
-const COMMENT = 57381
-const LE = 57382
-const GE = 57383
-const NE = 57384
-const NULL_SAFE_EQUAL = 57385
-const UNION = 57386
-const MINUS = 57387
-const EXCEPT = 57388
-const INTERSECT = 57389
-const JOIN = 57390
-const STRAIGHT_JOIN = 57391
-const LEFT = 57392
-const RIGHT = 57393
-const INNER = 57394
-const OUTER = 57395
-const CROSS = 57396
-const NATURAL = 57397
-const USE = 57398
-const FORCE = 57399
-const ON = 57400
-const AND = 57401
-const OR = 57402
-const NOT = 57403
-const UNARY = 57404
-const CASE = 57405
-const WHEN = 57406
-const THEN = 57407
-const ELSE = 57408
-const END = 57409
-const CREATE = 57410
-const ALTER = 57411
-const DROP = 57412
-const RENAME = 57413
-const TABLE = 57414
-const INDEX = 57415
-const VIEW = 57416
-const TO = 57417
-const IGNORE = 57418
-const IF = 57419
-const UNIQUE = 57420
-const USING = 57421
+const DEFAULT = 57373
+const SET = 57374
+const LOCK = 57375
+const ID = 57376
+const STRING = 57377
+const NUMBER = 57378
+const VALUE_ARG = 57379
+const COMMENT = 57380
+const LE = 57381
+const GE = 57382
+const NE = 57383
+const NULL_SAFE_EQUAL = 57384
+const LOWER_THAN_KEY = 57385
+const KEY = 57386
+const UNION = 57387
+const MINUS = 57388
+const EXCEPT = 57389
+const INTERSECT = 57390
+const JOIN = 57391
+const STRAIGHT_JOIN = 57392
+const LEFT = 57393
+const RIGHT = 57394
+const INNER = 57395
+const OUTER = 57396
+const CROSS = 57397
+const NATURAL = 57398
+const USE = 57399
+const FORCE = 57400
+const ON = 57401
+const AND = 57402
+const OR = 57403
+const NOT = 57404
+const UNARY = 57405
+const CASE = 57406
+const WHEN = 57407
+const THEN = 57408
+const ELSE = 57409
+const END = 57410
+const SAVEPOINT = 57411
+const ROLLBACK = 57412
+const RELEASE = 57413
+const CREATE = 57414
+const ALTER = 57415
+const DROP = 57416
+const RENAME = 57417
+const SHOW = 57418
+const TABLE = 57419
+const INDEX = 57420
+const VIEW = 57421
+const TO = 57422
+const IGNORE = 57423
+const IF = 57424
+const UNIQUE = 57425
+const USING = 57426
+const DDL_SPEC = 57427
+const PRIMARY = 57428
+const FULLTEXT = 57429
+const SPATIAL = 57430
+const CONSTRAINT = 57431
+const FOREIGN = 57432
+const CHECK = 57433
+const REFERENCES = 57434
+const ADD = 57435
+const COLUMN = 57436
+const MODIFY = 57437
+const CHANGE = 57438
+const FIRST = 57439
+const AFTER = 57440
+const ALGORITHM = 57441
+const UNSIGNED = 57442
+const ZEROFILL = 57443
+const SIGNED = 57444
+const BINARY = 57445
+const CHARACTER = 57446
+const CHARSET = 57447
+const COLLATE = 57448
+const AUTO_INCREMENT = 57449
+const COMMENT_KEYWORD = 57450
+const COLUMN_FORMAT = 57451
+const STORAGE = 57452
+const KEY_BLOCK_SIZE = 57453
 
 var yyToknames = []string{
 	"LEX_ERROR",
@@ -167,7 +215,6 @@ var yyToknames = []string{
 	"VALUES",
 	"INTO",
 	"DUPLICATE",
-	"KEY",
 	"DEFAULT",
 	"SET",
 	"LOCK",
@@ -185,6 +232,8 @@ var yyToknames = []string{
 	" <",
 	" >",
 	" ~",
+	"LOWER_THAN_KEY",
+	"KEY",
 	"UNION",
 	"MINUS",
 	"EXCEPT",
@@ -219,10 +268,14 @@ var yyToknames = []string{
 	"THEN",
 	"ELSE",
 	"END",
+	"SAVEPOINT",
+	"ROLLBACK",
+	"RELEASE",
 	"CREATE",
 	"ALTER",
 	"DROP",
 	"RENAME",
+	"SHOW",
 	"TABLE",
 	"INDEX",
 	"VIEW",
@@ -231,6 +284,33 @@ var yyToknames = []string{
 	"IF",
 	"UNIQUE",
 	"USING",
+	"DDL_SPEC",
+	"PRIMARY",
+	"FULLTEXT",
+	"SPATIAL",
+	"CONSTRAINT",
+	"FOREIGN",
+	"CHECK",
+	"REFERENCES",
+	"ADD",
+	"COLUMN",
+	"MODIFY",
+	"CHANGE",
+	"FIRST",
+	"AFTER",
+	"ALGORITHM",
+	"UNSIGNED",
+	"ZEROFILL",
+	"SIGNED",
+	"BINARY",
+	"CHARACTER",
+	"CHARSET",
+	"COLLATE",
+	"AUTO_INCREMENT",
+	"COMMENT_KEYWORD",
+	"COLUMN_FORMAT",
+	"STORAGE",
+	"KEY_BLOCK_SIZE",
 }
 var yyStatenames = []string{}
 
@@ -243,261 +323,490 @@ var yyExca = []int{
 	-1, 1,
 	1, -1,
 	-2, 0,
+	-1, 4,
+	1, 3,
+	-2, 19,
+	-1, 143,
+	44, 373,
+	-2, 30,
+	-1, 208,
+	1, 282,
+	65, 282,
+	-2, 19,
+	-1, 209,
+	1, 283,
+	65, 283,
+	-2, 20,
+	-1, 282,
+	50, 20,
+	51, 20,
+	52, 20,
+	53, 20,
+	-2, 287,
+	-1, 296,
+	49, 109,
+	93, 109,
+	98, 109,
+	101, 109,
+	102, 109,
+	103, 109,
+	105, 109,
+	106, 109,
+	-2, 183,
+	-1, 302,
+	1, 176,
+	54, 176,
+	128, 176,
+	-2, 152,
+	-1, 433,
+	50, 20,
+	51, 20,
+	52, 20,
+	53, 20,
+	-2, 248,
+	-1, 526,
+	1, 66,
+	128, 66,
+	-2, 152,
 }
 
-const yyNprod = 193
+const yyNprod = 375
 const yyPrivate = 57344
 
 var yyTokenNames []string
 var yyStates []string
 
-const yyLast = 531
+const yyLast = 970
 
 var yyAct = []int{
 
-	83, 275, 147, 342, 80, 74, 310, 149, 52, 91,
-	231, 185, 267, 222, 70, 165, 53, 351, 173, 351,
-	81, 66, 69, 150, 3, 58, 238, 242, 243, 244,
-	245, 246, 55, 247, 248, 60, 54, 219, 63, 86,
-	123, 124, 67, 112, 90, 43, 351, 96, 75, 321,
-	320, 118, 109, 273, 73, 87, 88, 89, 319, 353,
-	108, 352, 59, 78, 62, 292, 294, 94, 296, 116,
-	212, 118, 32, 120, 34, 118, 214, 37, 35, 38,
-	223, 151, 39, 146, 148, 152, 77, 301, 350, 253,
-	92, 93, 71, 300, 293, 272, 156, 97, 123, 124,
-	159, 55, 122, 105, 55, 54, 169, 168, 54, 163,
-	223, 95, 265, 262, 217, 101, 111, 260, 213, 107,
-	167, 75, 191, 169, 40, 41, 42, 189, 195, 193,
-	194, 200, 201, 190, 204, 205, 206, 207, 208, 209,
-	210, 211, 90, 202, 316, 96, 268, 196, 22, 23,
-	24, 25, 56, 87, 88, 89, 216, 75, 75, 170,
-	61, 153, 55, 55, 234, 94, 54, 229, 115, 183,
-	227, 166, 233, 318, 235, 123, 124, 218, 220, 230,
-	136, 137, 138, 317, 226, 203, 104, 286, 92, 93,
-	303, 284, 287, 179, 215, 97, 285, 189, 192, 252,
-	239, 255, 256, 134, 135, 136, 137, 138, 103, 95,
-	290, 289, 177, 288, 240, 180, 166, 259, 254, 268,
-	103, 214, 75, 22, 23, 24, 25, 236, 327, 266,
-	242, 243, 244, 245, 246, 264, 247, 248, 305, 86,
-	271, 274, 261, 117, 90, 12, 270, 96, 337, 336,
-	189, 189, 282, 283, 73, 87, 88, 89, 49, 103,
-	299, 188, 161, 78, 176, 178, 175, 94, 302, 335,
-	187, 153, 157, 162, 55, 188, 307, 155, 306, 308,
-	311, 154, 12, 98, 187, 65, 77, 118, 251, 61,
-	92, 93, 71, 121, 56, 297, 295, 97, 348, 279,
-	278, 322, 90, 182, 250, 96, 323, 99, 181, 61,
-	102, 95, 56, 87, 88, 89, 349, 324, 216, 164,
-	332, 153, 334, 333, 331, 94, 325, 113, 68, 339,
-	311, 312, 110, 341, 340, 106, 343, 343, 343, 55,
-	344, 345, 12, 54, 50, 64, 100, 346, 92, 93,
-	304, 48, 356, 12, 258, 97, 357, 86, 358, 355,
-	46, 197, 90, 198, 199, 96, 171, 114, 44, 95,
-	276, 315, 56, 87, 88, 89, 225, 277, 232, 86,
-	314, 78, 281, 166, 90, 94, 51, 96, 354, 338,
-	12, 27, 172, 33, 56, 87, 88, 89, 237, 12,
-	13, 14, 15, 78, 77, 174, 36, 94, 92, 93,
-	329, 330, 57, 228, 160, 97, 347, 328, 26, 126,
-	130, 128, 129, 309, 313, 280, 77, 16, 263, 95,
-	92, 93, 28, 29, 30, 31, 158, 97, 142, 143,
-	144, 145, 221, 139, 140, 141, 85, 82, 84, 269,
-	79, 95, 131, 132, 133, 134, 135, 136, 137, 138,
-	224, 125, 76, 291, 186, 127, 131, 132, 133, 134,
-	135, 136, 137, 138, 326, 241, 184, 17, 18, 20,
-	19, 131, 132, 133, 134, 135, 136, 137, 138, 131,
-	132, 133, 134, 135, 136, 137, 138, 298, 72, 249,
-	131, 132, 133, 134, 135, 136, 137, 138, 257, 119,
-	45, 131, 132, 133, 134, 135, 136, 137, 138, 21,
-	47, 11, 10, 9, 8, 7, 6, 5, 4, 2,
-	1,
+	372, 181, 677, 196, 636, 595, 392, 377, 406, 201,
+	596, 587, 292, 482, 246, 303, 178, 172, 626, 131,
+	280, 550, 555, 92, 533, 311, 210, 332, 61, 371,
+	204, 386, 484, 309, 69, 4, 189, 32, 74, 295,
+	367, 215, 168, 167, 140, 179, 382, 397, 91, 94,
+	159, 255, 256, 99, 255, 256, 101, 651, 86, 71,
+	654, 106, 612, 109, 93, 150, 630, 114, 621, 364,
+	32, 184, 621, 621, 384, 81, 188, 621, 621, 194,
+	118, 652, 108, 644, 653, 171, 185, 186, 187, 644,
+	644, 621, 94, 614, 176, 293, 600, 103, 192, 661,
+	149, 380, 556, 557, 378, 563, 564, 93, 374, 158,
+	250, 449, 619, 384, 230, 359, 197, 198, 197, 175,
+	471, 199, 470, 190, 191, 169, 250, 173, 104, 250,
+	195, 96, 398, 400, 401, 399, 402, 94, 411, 403,
+	94, 672, 55, 133, 222, 659, 650, 137, 193, 330,
+	649, 647, 212, 611, 361, 93, 646, 153, 107, 211,
+	223, 110, 645, 643, 620, 389, 613, 152, 208, 599,
+	209, 576, 252, 422, 423, 424, 425, 426, 362, 427,
+	428, 245, 380, 522, 448, 378, 220, 217, 379, 575,
+	49, 281, 164, 278, 279, 283, 54, 389, 55, 443,
+	574, 197, 441, 156, 306, 116, 472, 94, 94, 388,
+	288, 410, 226, 282, 389, 247, 98, 307, 310, 242,
+	243, 286, 314, 212, 241, 79, 117, 360, 105, 100,
+	211, 97, 327, 315, 322, 321, 95, 305, 56, 301,
+	324, 388, 32, 166, 67, 518, 523, 368, 48, 385,
+	51, 89, 318, 317, 52, 338, 222, 384, 388, 35,
+	36, 37, 282, 75, 323, 173, 474, 76, 77, 379,
+	477, 478, 342, 340, 341, 347, 348, 434, 351, 352,
+	353, 354, 355, 356, 357, 358, 336, 142, 291, 514,
+	516, 254, 375, 337, 325, 297, 72, 328, 58, 173,
+	173, 368, 75, 446, 343, 136, 76, 77, 394, 115,
+	255, 256, 255, 256, 296, 62, 298, 299, 395, 236,
+	300, 94, 515, 370, 147, 525, 383, 674, 363, 365,
+	571, 416, 312, 376, 148, 223, 212, 234, 414, 326,
+	237, 412, 139, 415, 387, 390, 391, 200, 404, 157,
+	349, 31, 18, 19, 20, 339, 57, 59, 60, 573,
+	436, 437, 432, 263, 264, 265, 266, 267, 268, 269,
+	270, 433, 572, 419, 512, 479, 440, 197, 21, 173,
+	480, 266, 267, 268, 269, 270, 447, 486, 487, 33,
+	435, 511, 489, 350, 233, 235, 232, 268, 269, 270,
+	490, 361, 491, 492, 488, 476, 508, 445, 442, 27,
+	510, 509, 475, 94, 319, 141, 319, 143, 144, 494,
+	310, 481, 407, 408, 500, 312, 119, 413, 498, 305,
+	28, 29, 30, 22, 23, 25, 24, 26, 405, 495,
+	381, 497, 138, 552, 393, 208, 3, 209, 504, 505,
+	506, 547, 580, 521, 216, 507, 249, 336, 336, 499,
+	142, 524, 543, 530, 531, 263, 264, 265, 266, 267,
+	268, 269, 270, 542, 544, 545, 216, 551, 496, 528,
+	485, 520, 527, 501, 263, 264, 265, 266, 267, 268,
+	269, 270, 39, 40, 41, 42, 374, 559, 420, 335,
+	565, 250, 123, 561, 121, 122, 125, 549, 334, 130,
+	670, 560, 124, 320, 128, 120, 127, 126, 129, 145,
+	319, 438, 633, 567, 263, 264, 265, 266, 267, 268,
+	269, 270, 134, 623, 31, 577, 618, 581, 617, 615,
+	578, 609, 579, 608, 422, 423, 424, 425, 426, 551,
+	427, 428, 607, 551, 584, 597, 31, 207, 598, 554,
+	590, 206, 553, 592, 546, 585, 225, 290, 94, 33,
+	591, 594, 205, 285, 593, 263, 264, 265, 266, 267,
+	268, 269, 270, 212, 601, 324, 284, 604, 603, 606,
+	211, 605, 31, 602, 33, 668, 610, 16, 589, 588,
+	639, 458, 583, 582, 616, 53, 679, 459, 678, 627,
+	627, 627, 663, 625, 624, 207, 597, 541, 597, 597,
+	431, 632, 597, 634, 635, 464, 631, 628, 629, 119,
+	33, 638, 637, 253, 597, 430, 80, 31, 483, 648,
+	536, 460, 78, 31, 457, 244, 657, 119, 62, 539,
+	534, 535, 658, 681, 660, 221, 144, 62, 665, 662,
+	664, 641, 197, 213, 666, 667, 335, 669, 519, 517,
+	418, 597, 213, 417, 465, 334, 671, 463, 642, 680,
+	248, 33, 43, 87, 240, 239, 238, 538, 537, 228,
+	219, 450, 451, 452, 453, 454, 455, 456, 461, 462,
+	466, 467, 45, 46, 47, 123, 214, 121, 122, 125,
+	154, 151, 130, 146, 68, 124, 111, 128, 120, 127,
+	126, 129, 102, 123, 90, 121, 122, 125, 66, 64,
+	130, 63, 529, 124, 493, 128, 120, 127, 126, 129,
+	184, 682, 135, 305, 409, 188, 84, 683, 194, 407,
+	408, 532, 439, 31, 171, 185, 186, 187, 344, 656,
+	345, 346, 227, 176, 155, 160, 163, 192, 184, 82,
+	83, 113, 202, 188, 570, 203, 194, 161, 132, 162,
+	569, 503, 213, 185, 186, 187, 655, 216, 175, 676,
+	675, 176, 190, 191, 169, 192, 184, 88, 566, 195,
+	540, 188, 44, 70, 194, 304, 673, 548, 31, 373,
+	213, 185, 186, 187, 558, 294, 175, 193, 562, 176,
+	190, 191, 396, 192, 302, 526, 622, 195, 188, 73,
+	473, 194, 586, 469, 468, 369, 289, 213, 185, 186,
+	187, 34, 229, 50, 175, 193, 225, 329, 190, 191,
+	192, 231, 165, 65, 218, 195, 188, 313, 640, 194,
+	308, 568, 502, 444, 287, 213, 185, 186, 187, 366,
+	183, 180, 182, 193, 225, 190, 191, 188, 192, 316,
+	194, 177, 195, 257, 174, 513, 213, 185, 186, 187,
+	333, 421, 331, 170, 429, 225, 224, 251, 112, 192,
+	193, 38, 85, 190, 191, 15, 14, 13, 12, 11,
+	195, 10, 9, 8, 258, 262, 260, 261, 7, 6,
+	5, 17, 2, 1, 190, 191, 0, 0, 193, 0,
+	0, 195, 274, 275, 276, 277, 0, 271, 272, 273,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 193,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 259, 263, 264, 265, 266, 267, 268, 269, 270,
 }
 var yyPact = []int{
 
-	394, -1000, -1000, 174, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -15, -12, -5,
-	37, 385, 351, -1000, -1000, -1000, 342, -1000, 322, 309,
-	377, 259, -67, -26, 254, -1000, -23, 254, -1000, 310,
-	-71, 254, -71, -1000, -1000, 219, -1000, 244, 309, 313,
-	39, 309, 167, -1000, 141, -1000, 27, 300, 52, 254,
-	-1000, -1000, 297, -1000, -47, 292, 347, 104, 254, 234,
-	-1000, -1000, 274, 26, 33, 398, -1000, 359, 337, -1000,
-	-1000, -1000, 117, 237, 233, -1000, 228, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, 117, -1000, 229,
-	259, 284, 373, 259, 117, 254, -1000, 346, -76, -1000,
-	180, -1000, 273, -1000, -1000, 268, -1000, 226, 219, -1000,
-	-1000, 254, 125, 359, 359, 117, 227, 340, 117, 117,
-	118, 117, 117, 117, 117, 117, 117, 117, 117, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, -1000, 398, -25, 23,
-	99, 398, -1000, 277, 19, 219, -1000, 385, 1, 413,
-	348, 259, 259, 206, -1000, 365, 359, -1000, 413, -1000,
-	-1000, -1000, 100, 254, -1000, -64, -1000, -1000, -1000, -1000,
-	-1000, -1000, -1000, -1000, 161, 176, 269, 240, 13, -1000,
-	-1000, -1000, -1000, -1000, -1000, 413, -1000, 227, 117, 117,
-	413, 443, -1000, 329, 132, 132, 132, 107, 107, -1000,
-	-1000, -1000, -1000, -1000, 117, -1000, 413, -1000, 22, 219,
-	18, 31, -1000, 359, 82, 227, 174, 155, 0, -1000,
-	365, 355, 363, 33, 265, -1000, -1000, 264, -1000, 371,
-	226, 226, -1000, -1000, 137, 133, 159, 157, 156, 3,
-	-1000, 261, -27, 260, -1000, 413, 432, 117, -1000, 413,
-	-1000, -2, -1000, 5, -1000, 117, 110, -1000, 320, 185,
-	-1000, -1000, -1000, 259, 355, -1000, 117, 117, -1000, -1000,
-	368, 357, 176, 80, -1000, 129, -1000, 119, -1000, -1000,
-	-1000, -1000, -30, -38, -39, -1000, -1000, -1000, 117, 413,
-	-1000, -1000, 413, 117, 286, 227, -1000, -1000, 421, 175,
-	-1000, 384, -1000, 365, 359, 117, 359, -1000, -1000, 225,
-	205, 204, 413, 413, 382, -1000, 117, 117, -1000, -1000,
-	-1000, 355, 33, 168, 33, 254, 254, 254, 259, 413,
-	-1000, 282, -7, -1000, -34, -36, 167, -1000, 381, 338,
-	-1000, 254, -1000, -1000, -1000, 254, -1000, 254, -1000,
+	346, -1000, -1000, 172, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, 442, -1000, -1000,
+	-1000, -1000, 156, 102, 146, 264, 623, 697, 695, 694,
+	160, -1000, -1000, 551, -69, 204, 46, 132, 551, 752,
+	-1000, -1000, -1000, 717, -1000, 649, 788, 690, 34, 139,
+	123, 623, -1000, 137, 623, -1000, 688, 31, 136, 623,
+	31, 623, -1000, -1000, -1000, 66, -1000, 682, 753, -60,
+	-1000, -1000, 34, 112, -1000, -1000, -1000, -1000, 134, 613,
+	-1000, 765, -1000, -1000, 649, 494, 710, 228, 649, 388,
+	383, -1000, -1000, 475, -1000, 679, 256, 34, 623, -1000,
+	677, -1000, 62, 676, 744, 31, 284, 623, 756, -1000,
+	159, -1000, 720, -1000, -1000, 613, 613, 613, 282, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, 757, 761, 529, -1000, 629, 672, 777, 629, 388,
+	656, 621, 623, 210, -1000, 831, -1000, 742, 655, 15,
+	-1000, 306, -1000, 652, -1000, -1000, 651, 650, -1000, -1000,
+	649, 649, 610, 776, 756, 646, -1000, 447, -1000, -1000,
+	614, 214, 246, 893, -1000, 776, 748, -1000, -1000, -1000,
+	852, 543, 530, -1000, 526, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, 852, 524, 211, -4, 206,
+	613, -1000, 852, 852, 267, 638, 629, 523, -1000, -1000,
+	466, -1000, 469, 210, -1000, 765, 776, -1000, -1000, 621,
+	-1000, -1000, -1000, 506, -1000, 803, -1000, -1000, -1000, 274,
+	623, -1000, 54, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, 246, 893, -1000, -1000, 465,
+	720, -1000, -1000, 623, 281, 776, 776, 852, 523, 737,
+	852, 852, 325, 852, 852, 852, 852, 852, 852, 852,
+	852, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -12,
+	100, 893, -1000, -1000, 51, 720, -1000, 167, 506, -1000,
+	392, 613, 268, 151, 386, -1000, 4, 148, -35, -35,
+	400, 400, 712, -1000, 13, -1000, -1000, 294, 384, -1000,
+	396, -1000, 714, 84, -1000, 360, 373, -1000, 765, 629,
+	852, 757, 246, -1000, 506, -1000, 639, -1000, -1000, 636,
+	-1000, 444, 489, 601, 632, 200, -1000, -1000, -1000, -1000,
+	-1000, -1000, 506, -1000, 523, 852, 852, 506, 455, -1000,
+	727, 309, 309, 309, 323, 323, -1000, -1000, -1000, -1000,
+	-1000, 852, -1000, 75, 720, 72, 221, -1000, 776, 57,
+	576, -1000, 88, 165, 613, -1000, 613, -1000, -1000, -1000,
+	-1000, 206, 595, -1000, -1000, 431, 613, 613, -1000, -1000,
+	613, 613, 151, -1000, 151, -1000, 400, -1000, 702, -1000,
+	-1000, -1000, -1000, -1000, 852, 852, -1000, -1000, -1000, 429,
+	587, 629, -1000, 523, 757, -1000, -1000, -1000, -1000, 770,
+	465, 465, -1000, -1000, 395, 351, 355, 336, 319, 226,
+	-1000, 635, 118, -1000, 634, -1000, 506, 415, 852, -1000,
+	506, -1000, 56, -1000, 163, -1000, 852, 244, -1000, 392,
+	-1000, -1000, -1000, -1000, 700, 151, 151, 726, -1000, 615,
+	793, -1000, 582, 424, -1000, 413, 151, 151, -1000, 521,
+	-1000, -1000, -1000, -1000, 402, 116, 613, 394, 519, -1000,
+	516, -1000, -10, 613, 576, -1000, -1000, -1000, -10, 613,
+	-1000, -1000, 70, -1000, 506, -1000, 791, 267, -1000, -1000,
+	-1000, -1000, 768, 760, 489, 265, -1000, 317, -1000, 304,
+	-1000, -1000, -1000, -1000, 107, 96, 78, -1000, -1000, -1000,
+	852, 506, -1000, -1000, 506, 852, 398, 576, -1000, 151,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, 567, 566, 511,
+	615, -1000, -1000, -1000, -1000, -1000, 563, -4, 613, -1000,
+	-4, -1000, 613, 776, 613, -1000, -1000, 613, 42, -1000,
+	-1000, -10, -1000, -1000, -1000, -1000, 629, -1000, 765, 776,
+	852, 776, -1000, -1000, 509, 500, 498, 506, 506, -1000,
+	712, -1000, -1000, -1000, 26, -1000, 39, -1000, -1000, -1000,
+	496, -4, 495, 493, -15, 37, -1000, 490, -1000, -1000,
+	613, -1000, 362, 757, 246, 347, 246, 623, 623, 623,
+	-1000, -1000, -61, -1000, 563, 613, 479, 613, 613, -1000,
+	-1000, 613, 723, 564, -1000, 645, 36, -1000, 35, 29,
+	-1000, -1000, 24, 613, 23, 19, -42, -1000, -1000, -67,
+	-1000, 779, 738, -1000, 623, -1000, -1000, -1000, 18, -1000,
+	-8, 151, 577, 400, -1000, -1000, 623, -1000, -42, -1000,
+	-42, 613, -1000, -1000, 559, 623, -42, 467, -1000, -1000,
+	613, 14, -1000, 262, 782, 574, 574, -1000, 619, 716,
+	-1000, -1000, -1000, -1000,
 }
 var yyPgo = []int{
 
-	0, 530, 529, 23, 528, 527, 526, 525, 524, 523,
-	522, 521, 418, 520, 519, 510, 22, 14, 509, 499,
-	498, 476, 11, 475, 464, 258, 463, 3, 15, 5,
-	462, 461, 460, 450, 2, 20, 7, 449, 448, 9,
-	447, 4, 446, 442, 13, 436, 428, 425, 424, 10,
-	423, 6, 417, 1, 416, 414, 413, 12, 8, 16,
-	285, 412, 406, 405, 398, 393, 392, 0, 52, 391,
+	0, 923, 922, 34, 921, 597, 920, 919, 918, 913,
+	912, 911, 909, 908, 907, 906, 905, 682, 902, 901,
+	898, 43, 42, 897, 894, 893, 892, 27, 891, 890,
+	58, 885, 18, 41, 17, 884, 883, 30, 881, 14,
+	45, 20, 879, 872, 36, 871, 16, 870, 869, 40,
+	864, 863, 862, 861, 19, 860, 33, 8, 9, 858,
+	857, 25, 26, 251, 854, 23, 48, 44, 82, 50,
+	853, 852, 97, 236, 605, 851, 847, 843, 842, 1,
+	841, 836, 835, 32, 13, 834, 833, 832, 11, 24,
+	29, 830, 829, 38, 21, 826, 5, 10, 825, 824,
+	15, 822, 818, 815, 39, 814, 22, 3, 0, 7,
+	809, 31, 807, 12, 4, 806, 2, 805, 46, 6,
+	803, 65, 802,
 }
 var yyR1 = []int{
 
-	0, 1, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 3, 3, 4, 4, 5, 6, 7, 8, 8,
-	8, 9, 9, 9, 10, 11, 11, 11, 69, 12,
-	13, 13, 14, 14, 14, 14, 14, 15, 15, 16,
-	16, 17, 17, 17, 20, 20, 18, 18, 18, 21,
-	21, 22, 22, 22, 22, 19, 19, 19, 23, 23,
-	23, 23, 23, 23, 23, 23, 23, 24, 24, 24,
-	25, 25, 26, 26, 26, 26, 27, 27, 28, 28,
-	29, 29, 29, 29, 29, 30, 30, 30, 30, 30,
-	30, 30, 30, 30, 30, 31, 31, 31, 31, 31,
-	31, 31, 32, 32, 37, 37, 35, 35, 39, 36,
-	36, 34, 34, 34, 34, 34, 34, 34, 34, 34,
-	34, 34, 34, 34, 34, 34, 34, 34, 38, 38,
-	40, 40, 40, 42, 45, 45, 43, 43, 44, 46,
-	46, 41, 41, 33, 33, 33, 33, 47, 47, 48,
-	48, 49, 49, 50, 50, 51, 52, 52, 52, 53,
-	53, 53, 54, 54, 54, 55, 55, 56, 56, 57,
-	57, 58, 58, 59, 60, 60, 61, 61, 62, 62,
-	63, 63, 63, 63, 63, 64, 64, 65, 65, 66,
-	66, 67, 68,
+	0, 1, 1, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 3, 3, 3, 5, 4,
+	4, 6, 6, 6, 7, 8, 9, 9, 9, 9,
+	67, 67, 64, 64, 14, 14, 68, 68, 68, 69,
+	69, 69, 15, 16, 16, 16, 70, 70, 71, 71,
+	10, 10, 10, 10, 11, 11, 11, 12, 13, 13,
+	13, 13, 80, 80, 80, 80, 81, 82, 82, 82,
+	82, 83, 83, 83, 83, 83, 83, 83, 83, 83,
+	83, 83, 83, 83, 83, 83, 83, 83, 83, 83,
+	83, 85, 85, 86, 86, 86, 87, 87, 88, 88,
+	89, 89, 89, 89, 89, 89, 89, 89, 90, 110,
+	110, 110, 91, 91, 91, 91, 91, 92, 92, 93,
+	93, 93, 111, 111, 112, 112, 94, 94, 113, 113,
+	96, 96, 97, 95, 95, 114, 114, 114, 114, 115,
+	115, 115, 116, 116, 116, 116, 98, 98, 98, 99,
+	99, 100, 117, 117, 101, 101, 101, 101, 101, 101,
+	101, 102, 102, 102, 103, 103, 104, 104, 104, 104,
+	104, 104, 104, 104, 104, 104, 104, 105, 105, 84,
+	106, 106, 106, 118, 118, 119, 119, 120, 120, 107,
+	107, 108, 108, 108, 108, 108, 108, 108, 108, 108,
+	108, 108, 108, 109, 109, 109, 122, 17, 18, 18,
+	19, 19, 19, 19, 19, 19, 20, 20, 21, 21,
+	22, 22, 22, 25, 25, 23, 23, 23, 26, 26,
+	27, 27, 27, 27, 24, 24, 24, 28, 28, 28,
+	28, 28, 28, 28, 28, 28, 29, 29, 29, 30,
+	30, 31, 31, 31, 31, 32, 32, 33, 33, 34,
+	34, 34, 34, 34, 35, 35, 35, 35, 35, 35,
+	35, 35, 35, 35, 36, 36, 36, 36, 36, 36,
+	36, 37, 37, 37, 42, 42, 40, 40, 44, 41,
+	41, 39, 39, 39, 39, 39, 39, 39, 39, 39,
+	39, 39, 39, 39, 39, 39, 39, 39, 43, 43,
+	45, 45, 45, 47, 50, 50, 48, 48, 49, 51,
+	51, 46, 46, 38, 38, 38, 38, 52, 52, 53,
+	53, 54, 54, 55, 55, 56, 57, 57, 57, 58,
+	58, 58, 59, 59, 59, 60, 60, 61, 61, 62,
+	62, 65, 63, 63, 66, 66, 72, 72, 73, 73,
+	74, 74, 75, 75, 75, 75, 75, 76, 76, 77,
+	77, 78, 78, 79, 121,
 }
 var yyR2 = []int{
 
-	0, 1, 1, 1, 1, 1, 1, 1, 1, 1,
-	1, 12, 3, 7, 7, 8, 7, 3, 5, 8,
-	4, 6, 7, 4, 5, 4, 5, 5, 0, 2,
-	0, 2, 1, 2, 1, 1, 1, 0, 1, 1,
-	3, 1, 2, 3, 1, 1, 0, 1, 2, 1,
-	3, 3, 3, 3, 5, 0, 1, 2, 1, 1,
-	2, 3, 2, 3, 2, 2, 2, 1, 3, 1,
-	1, 3, 0, 5, 5, 5, 1, 3, 0, 2,
-	1, 3, 3, 2, 3, 3, 3, 4, 3, 4,
-	5, 6, 3, 4, 2, 1, 1, 1, 1, 1,
-	1, 1, 2, 1, 1, 3, 3, 1, 3, 1,
+	0, 1, 3, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 3, 5, 12, 1,
+	1, 6, 9, 7, 8, 7, 3, 4, 5, 5,
+	1, 1, 0, 2, 4, 5, 0, 3, 3, 0,
+	2, 2, 2, 2, 5, 3, 0, 1, 0, 1,
+	5, 6, 8, 4, 6, 7, 4, 5, 4, 5,
+	5, 5, 5, 5, 11, 5, 4, 1, 1, 3,
+	3, 2, 2, 2, 2, 2, 4, 3, 3, 3,
+	2, 3, 4, 2, 3, 3, 2, 2, 3, 3,
+	3, 1, 4, 1, 1, 1, 1, 3, 1, 1,
+	1, 1, 1, 2, 2, 1, 3, 4, 2, 0,
+	1, 2, 7, 8, 7, 12, 4, 0, 1, 1,
+	1, 1, 1, 1, 0, 1, 0, 1, 0, 2,
+	1, 3, 3, 0, 3, 0, 3, 3, 4, 0,
+	4, 4, 1, 2, 2, 2, 0, 2, 3, 1,
+	2, 4, 0, 1, 1, 2, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 3, 4, 5, 2, 3,
+	3, 3, 4, 5, 3, 3, 1, 1, 3, 1,
+	0, 1, 2, 0, 1, 0, 1, 0, 1, 1,
+	3, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 0, 2, 0, 2,
+	1, 2, 2, 1, 1, 1, 0, 1, 1, 3,
+	1, 2, 3, 1, 1, 0, 1, 2, 1, 3,
+	3, 3, 3, 5, 0, 1, 2, 1, 1, 2,
+	3, 2, 3, 2, 2, 2, 1, 3, 1, 1,
+	3, 0, 5, 5, 5, 1, 3, 0, 2, 1,
+	3, 3, 2, 3, 3, 3, 4, 3, 4, 5,
+	6, 3, 4, 2, 1, 1, 1, 1, 1, 1,
+	1, 2, 1, 1, 1, 3, 3, 1, 3, 1,
 	3, 1, 1, 1, 3, 3, 3, 3, 3, 3,
 	3, 3, 2, 3, 4, 5, 4, 1, 1, 1,
 	1, 1, 1, 5, 0, 1, 1, 2, 4, 0,
 	2, 1, 3, 1, 1, 1, 1, 0, 3, 0,
 	2, 0, 3, 1, 3, 2, 0, 1, 1, 0,
-	2, 4, 0, 2, 4, 0, 3, 1, 3, 0,
-	5, 1, 3, 3, 0, 2, 0, 3, 0, 1,
-	1, 1, 1, 1, 1, 0, 1, 0, 1, 0,
-	2, 1, 0,
+	2, 4, 0, 2, 4, 1, 3, 0, 5, 1,
+	3, 3, 1, 3, 1, 3, 0, 2, 0, 3,
+	0, 1, 1, 1, 1, 1, 1, 0, 1, 0,
+	1, 0, 2, 1, 0,
 }
 var yyChk = []int{
 
-	-1000, -1, -2, -3, -4, -5, -6, -7, -8, -9,
-	-10, -11, 5, 6, 7, 8, 33, 83, 84, 86,
-	85, -14, 49, 50, 51, 52, -12, -69, -12, -12,
-	-12, -12, 87, -65, 89, 93, -62, 89, 91, 87,
-	87, 88, 89, -3, 17, -15, 18, -13, 29, -25,
-	35, 9, -58, -59, -41, -67, 35, -61, 92, 88,
-	-67, 35, 87, -67, 35, -60, 92, -67, -60, -16,
-	-17, 73, -20, 35, -29, -34, -30, 67, 44, -33,
-	-41, -35, -40, -67, -38, -42, 20, 36, 37, 38,
-	25, -39, 71, 72, 48, 92, 28, 78, 39, -25,
-	33, 76, -25, 53, 45, 76, 35, 67, -67, -68,
-	35, -68, 90, 35, 20, 64, -67, 9, 53, -18,
-	-67, 19, 76, 65, 66, -31, 21, 67, 23, 24,
-	22, 68, 69, 70, 71, 72, 73, 74, 75, 45,
-	46, 47, 40, 41, 42, 43, -29, -34, -29, -36,
-	-3, -34, -34, 44, 44, 44, -39, 44, -45, -34,
-	-55, 33, 44, -58, 35, -28, 10, -59, -34, -67,
-	-68, 20, -66, 94, -63, 86, 84, 32, 85, 13,
-	35, 35, 35, -68, -21, -22, -24, 44, 35, -39,
-	-17, -67, 73, -29, -29, -34, -35, 21, 23, 24,
-	-34, -34, 25, 67, -34, -34, -34, -34, -34, -34,
-	-34, -34, 95, 95, 53, 95, -34, 95, -16, 18,
-	-16, -43, -44, 79, -32, 28, -3, -58, -56, -41,
-	-28, -49, 13, -29, 64, -67, -68, -64, 90, -28,
-	53, -23, 54, 55, 56, 57, 58, 60, 61, -19,
-	35, 19, -22, 76, -35, -34, -34, 65, 25, -34,
-	95, -16, 95, -46, -44, 81, -29, -57, 64, -37,
-	-35, -57, 95, 53, -49, -53, 15, 14, 35, 35,
-	-47, 11, -22, -22, 54, 59, 54, 59, 54, 54,
-	54, -26, 62, 91, 63, 35, 95, 35, 65, -34,
-	95, 82, -34, 80, 30, 53, -41, -53, -34, -50,
-	-51, -34, -68, -48, 12, 14, 64, 54, 54, 88,
-	88, 88, -34, -34, 31, -35, 53, 53, -52, 26,
-	27, -49, -29, -36, -29, 44, 44, 44, 7, -34,
-	-51, -53, -27, -67, -27, -27, -58, -54, 16, 34,
-	95, 53, 95, 95, 7, 21, -67, -67, -67,
+	-1000, -1, -2, 100, -3, -6, -7, -8, -9, -10,
+	-11, -12, -13, -14, -15, -16, -5, -4, 6, 7,
+	8, 32, 87, 88, 90, 89, 91, 63, 84, 85,
+	86, 5, -44, 43, -80, 87, 88, 89, -19, 50,
+	51, 52, 53, -17, -122, -17, -17, -17, 92, 34,
+	-77, 94, 98, -74, 94, 96, 92, 92, 34, 93,
+	94, -79, 34, 34, 34, -70, 34, 84, -17, -3,
+	-120, 128, 92, -92, -93, 98, 102, 103, -74, 93,
+	-5, -44, 17, 18, 29, -18, -30, 34, 9, -63,
+	34, -66, -65, -46, -79, -73, 97, 92, 93, -79,
+	92, -79, 34, -72, 97, 92, -79, -72, -68, -79,
+	95, 34, -20, 18, 127, -73, 93, 92, -108, 34,
+	123, 112, 113, 110, 120, 114, 125, 124, 122, 126,
+	117, -54, 13, -30, 38, 32, 77, -30, 54, -63,
+	-67, 32, 77, 34, 35, 44, 34, 68, -73, -79,
+	-121, 34, -121, 95, 34, 20, -72, 65, -79, -69,
+	9, 21, 23, 10, -68, -71, 84, -21, -22, 74,
+	-25, 34, -34, -39, -35, 68, 43, -38, -46, -40,
+	-45, -79, -43, -47, 20, 35, 36, 37, 25, -44,
+	72, 73, 47, 97, 28, 79, -107, -108, -108, -107,
+	65, -58, 15, 14, -37, 43, 32, 28, -3, -44,
+	-62, -65, -46, 34, 34, -33, 10, -66, -64, 34,
+	-67, 34, -79, -39, 65, 43, -121, 20, 34, -78,
+	99, -75, 90, 88, 31, 89, 13, 34, 34, 34,
+	34, -121, -30, -30, 35, -34, -39, -69, 34, 9,
+	54, -23, -79, 19, 77, 66, 67, -36, 21, 68,
+	23, 24, 22, 69, 70, 71, 72, 73, 74, 75,
+	76, 44, 45, 46, 39, 40, 41, 42, -34, -34,
+	-41, -39, -44, -39, 43, 43, -44, -50, -39, -81,
+	43, 77, -113, 99, -103, -104, 108, 89, 110, 111,
+	114, 33, -99, -100, -117, 31, -107, -39, -55, -56,
+	-39, -61, 65, -60, -46, -62, -42, -40, -33, 54,
+	44, -54, -34, -67, -39, -121, 65, -79, -121, -76,
+	95, -26, -27, -29, 43, 34, -44, -22, -79, 74,
+	-34, -34, -39, -40, 21, 23, 24, -39, -39, 25,
+	68, -39, -39, -39, -39, -39, -39, -39, -39, 127,
+	127, 54, 127, -21, 18, -21, -48, -49, 80, -82,
+	-83, -90, -108, -110, 104, -108, 65, -109, 34, 118,
+	31, 54, -118, -90, 109, 101, -111, -118, 93, 49,
+	-118, -118, -119, 44, -119, -100, -101, 34, 119, 122,
+	120, 121, 123, 126, 54, 54, -57, 26, 27, 30,
+	127, 54, -61, 54, -54, -65, -58, 34, 34, -33,
+	54, -28, 55, 56, 57, 58, 59, 61, 62, -24,
+	34, 19, -27, -44, 77, -40, -39, -39, 66, 25,
+	-39, 127, -21, 127, -51, -49, 82, -34, 127, 54,
+	115, 116, 117, 118, 119, 120, 121, 68, 25, 31,
+	65, 122, 123, 101, 49, 98, 124, 125, -85, -86,
+	34, 32, 118, -91, 101, -93, -111, 105, 106, -108,
+	-107, -104, -84, 43, -83, 49, -108, -108, -84, -108,
+	-109, -109, -119, 32, -39, -56, 49, -37, -46, -40,
+	-58, -121, -52, 11, -27, -27, 55, 60, 55, 60,
+	55, 55, 55, -31, 63, 96, 64, 34, 127, 34,
+	66, -39, 127, 83, -39, 81, -98, -83, -90, 32,
+	-109, -109, 25, -89, 35, 36, 25, 73, 72, 34,
+	7, 35, 49, 49, -109, -109, 43, 49, -112, -111,
+	-94, -108, 49, 43, 43, -106, 112, 113, -105, -84,
+	-106, -84, -102, 35, 36, -109, 7, -61, -53, 12,
+	14, 65, 55, 55, 93, 93, 93, -39, -39, -100,
+	54, -109, 36, 36, 43, -89, -87, -88, 36, 35,
+	-113, -94, -113, -94, -34, -96, -97, -108, -108, 127,
+	54, -106, -62, -54, -34, -41, -34, 43, 43, 43,
+	-100, 127, 36, 127, 54, 43, -113, 43, 43, 127,
+	127, 54, -95, 43, -84, -58, -32, -79, -32, -32,
+	127, -88, -96, 43, -96, -96, -114, -97, -57, 36,
+	-59, 16, 33, 127, 54, 127, 127, 127, -96, 127,
+	127, 99, 123, 126, 127, 7, 21, -79, -114, 127,
+	-114, 107, -109, 35, -119, -79, -114, -107, 36, -79,
+	43, -96, 127, -115, 65, 8, 7, -116, 34, 32,
+	-116, 34, 25, 31,
 }
 var yyDef = []int{
 
-	0, -2, 1, 2, 3, 4, 5, 6, 7, 8,
-	9, 10, 28, 28, 28, 28, 28, 187, 178, 0,
-	0, 0, 32, 34, 35, 36, 37, 30, 0, 0,
-	0, 0, 176, 0, 0, 188, 0, 0, 179, 0,
-	174, 0, 174, 12, 33, 0, 38, 29, 0, 0,
-	70, 0, 17, 171, 0, 141, 191, 0, 0, 0,
-	192, 191, 0, 192, 0, 0, 0, 0, 0, 0,
-	39, 41, 46, 191, 44, 45, 80, 0, 0, 111,
-	112, 113, 0, 141, 0, 127, 0, 143, 144, 145,
-	146, 107, 130, 131, 132, 128, 129, 134, 31, 165,
-	0, 0, 78, 0, 0, 0, 192, 0, 189, 20,
-	0, 23, 0, 25, 175, 0, 192, 0, 0, 42,
-	47, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 95,
-	96, 97, 98, 99, 100, 101, 83, 0, 0, 0,
-	0, 109, 122, 0, 0, 0, 94, 0, 0, 135,
-	0, 0, 0, 78, 71, 151, 0, 172, 173, 142,
-	18, 177, 0, 0, 192, 185, 180, 181, 182, 183,
-	184, 24, 26, 27, 78, 49, 55, 0, 67, 69,
-	40, 48, 43, 81, 82, 85, 86, 0, 0, 0,
-	88, 0, 92, 0, 114, 115, 116, 117, 118, 119,
-	120, 121, 84, 106, 0, 108, 109, 123, 0, 0,
-	0, 139, 136, 0, 169, 0, 103, 169, 0, 167,
-	151, 159, 0, 79, 0, 190, 21, 0, 186, 147,
-	0, 0, 58, 59, 0, 0, 0, 0, 0, 72,
-	56, 0, 0, 0, 87, 89, 0, 0, 93, 110,
-	124, 0, 126, 0, 137, 0, 0, 13, 0, 102,
-	104, 14, 166, 0, 159, 16, 0, 0, 192, 22,
-	149, 0, 50, 53, 60, 0, 62, 0, 64, 65,
-	66, 51, 0, 0, 0, 57, 52, 68, 0, 90,
-	125, 133, 140, 0, 0, 0, 168, 15, 160, 152,
-	153, 156, 19, 151, 0, 0, 0, 61, 63, 0,
-	0, 0, 91, 138, 0, 105, 0, 0, 155, 157,
-	158, 159, 150, 148, 54, 0, 0, 0, 0, 161,
-	154, 162, 0, 76, 0, 0, 170, 11, 0, 0,
-	73, 0, 74, 75, 163, 0, 77, 0, 164,
+	0, -2, 1, 0, -2, 4, 5, 6, 7, 8,
+	9, 10, 11, 12, 13, 14, 15, 0, 206, 206,
+	206, 206, 369, 360, 0, 0, 0, 0, 0, 46,
+	0, 206, 20, 0, 187, 117, 360, 0, 0, 210,
+	213, 214, 215, 0, 208, 0, 0, 0, 358, 0,
+	0, 0, 370, 0, 0, 361, 0, 356, 0, 0,
+	356, 36, 373, 42, 43, 0, 47, 0, 216, 19,
+	2, 188, 358, 0, 118, 119, 120, 121, 0, 0,
+	16, 331, 211, 212, 0, 207, 0, 249, 0, 26,
+	373, 352, 354, 0, 321, 0, 0, 358, 0, 374,
+	0, 374, 0, 0, 0, 356, 0, 0, 39, 36,
+	48, 45, 0, 217, 288, 0, 0, 0, 0, 191,
+	192, 193, 194, 195, 196, 197, 198, 199, 200, 201,
+	202, 339, 0, 0, 209, 0, 0, 257, 0, 27,
+	32, 0, 0, -2, 31, 0, 374, 0, 0, 371,
+	53, 0, 56, 0, 58, 357, 0, 0, 374, 34,
+	0, 0, 0, 0, 39, 0, 49, 0, 218, 220,
+	225, 373, 223, 224, 259, 0, 0, 291, 292, 293,
+	0, 321, 0, 307, 0, 323, 324, 325, 326, 287,
+	310, 311, 312, 308, 309, 314, 0, 189, 128, 152,
+	0, 17, 0, 0, 347, 0, 0, 0, -2, -2,
+	257, 349, 0, 373, 250, 331, 0, 353, 28, 0,
+	29, 30, 322, 351, 355, 0, 50, 359, 374, 0,
+	0, 374, 367, 362, 363, 364, 365, 366, 57, 59,
+	60, 61, 37, 38, 40, 41, 0, 35, 44, 0,
+	0, 221, 226, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 274, 275, 276, 277, 278, 279, 280, 262, 0,
+	0, 289, -2, 302, 0, 0, 273, 0, 315, 62,
+	109, 0, 0, 0, 63, 164, -2, 183, 183, 183,
+	185, 185, -2, 149, 0, 153, 65, 340, 332, 333,
+	336, 21, 0, 0, 345, 347, 281, 284, 331, 0,
+	0, 339, 258, 33, 289, 51, 0, 372, 54, 0,
+	368, 257, 228, 234, 0, 246, 248, 219, 227, 222,
+	260, 261, 264, 265, 0, 0, 0, 267, 0, 271,
+	0, 294, 295, 296, 297, 298, 299, 300, 301, 263,
+	286, 0, 303, 0, 0, 0, 319, 316, 0, 0,
+	67, 68, 0, 0, 110, 190, 0, 129, 203, 204,
+	205, 152, 0, 168, 184, 0, 0, 0, 122, 123,
+	0, 0, 0, 186, 0, 150, 185, 154, 0, 156,
+	157, 158, 159, 160, 0, 0, 335, 337, 338, 0,
+	0, 0, 23, 0, 339, 350, 25, 374, 55, 327,
+	0, 0, 237, 238, 0, 0, 0, 0, 0, 251,
+	235, 0, 0, -2, 0, 266, 268, 0, 0, 272,
+	290, 304, 0, 306, 0, 317, 0, 0, 146, 109,
+	72, 73, 74, 75, 0, 0, 0, 0, 80, 0,
+	0, 83, 0, 0, 86, 87, 0, 0, 71, 91,
+	93, 94, 95, 108, 0, 124, 126, 0, 0, 111,
+	0, 165, 180, 0, 179, 169, 170, 171, 180, 0,
+	174, 175, 0, 155, 341, 334, 0, 347, 346, 285,
+	24, 52, 329, 0, 229, 232, 239, 0, 241, 0,
+	243, 244, 245, 230, 0, 0, 0, 236, 231, 247,
+	0, 269, 305, 313, 320, 0, -2, 69, 70, 0,
+	77, 78, 79, 81, 100, 101, 102, 0, 0, 105,
+	0, 84, 85, 88, 89, 90, 0, 128, 126, 125,
+	128, 127, 126, 0, 0, 166, 181, 0, 0, 177,
+	172, 180, 151, 161, 162, 163, 0, 22, 331, 0,
+	0, 0, 240, 242, 0, 0, 0, 270, 318, 147,
+	152, 76, 103, 104, 0, 82, 0, 96, 98, 99,
+	0, 128, 0, 0, 0, 0, 130, 133, 182, 167,
+	0, 173, 348, 339, 330, 328, 233, 0, 0, 0,
+	148, 106, 0, 92, 0, 0, 0, 0, 0, 116,
+	135, 0, 336, 0, 178, 342, 0, 255, 0, 0,
+	107, 97, 0, 0, 0, 0, 64, 131, 132, 0,
+	18, 0, 0, 252, 0, 253, 254, 135, 0, 135,
+	0, 0, 0, 185, 134, 343, 0, 256, 112, 135,
+	114, 0, 136, 137, 0, 0, 113, 0, 138, 344,
+	0, 0, 139, 115, 0, 0, 0, 140, 142, 0,
+	141, 143, 144, 145,
 }
 var yyTok1 = []int{
 
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 75, 68, 3,
-	44, 95, 73, 71, 53, 72, 76, 74, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 76, 69, 3,
+	43, 127, 74, 72, 54, 73, 77, 75, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 128,
+	45, 44, 46, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	46, 45, 47, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 71, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 70, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 69, 3, 48,
+	3, 3, 3, 3, 70, 3, 47,
 }
 var yyTok2 = []int{
 
@@ -505,10 +814,13 @@ var yyTok2 = []int{
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
 	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
-	42, 43, 49, 50, 51, 52, 54, 55, 56, 57,
+	42, 48, 49, 50, 51, 52, 53, 55, 56, 57,
 	58, 59, 60, 61, 62, 63, 64, 65, 66, 67,
-	77, 78, 79, 80, 81, 82, 83, 84, 85, 86,
-	87, 88, 89, 90, 91, 92, 93, 94,
+	68, 78, 79, 80, 81, 82, 83, 84, 85, 86,
+	87, 88, 89, 90, 91, 92, 93, 94, 95, 96,
+	97, 98, 99, 100, 101, 102, 103, 104, 105, 106,
+	107, 108, 109, 110, 111, 112, 113, 114, 115, 116,
+	117, 118, 119, 120, 121, 122, 123, 124, 125, 126,
 }
 var yyTok3 = []int{
 	0,
@@ -740,17 +1052,20 @@ yydefault:
 	switch yynt {
 
 	case 1:
-		//line sql.y:146
+		//line sql.y:202
 		{
 			SetParseTree(yylex, yyS[yypt-0].statement)
 		}
 	case 2:
-		//line sql.y:152
+		//line sql.y:206
 		{
-			yyVAL.statement = yyS[yypt-0].selStmt
+			SetParseTree(yylex, yyS[yypt-1].statement)
 		}
 	case 3:
-		yyVAL.statement = yyS[yypt-0].statement
+		//line sql.y:212
+		{
+			yyVAL.statement = yyS[yypt-0].selStmt
+		}
 	case 4:
 		yyVAL.statement = yyS[yypt-0].statement
 	case 5:
@@ -766,569 +1081,1512 @@ yydefault:
 	case 10:
 		yyVAL.statement = yyS[yypt-0].statement
 	case 11:
-		//line sql.y:166
-		{
-			yyVAL.selStmt = &Select{Comments: Comments(yyS[yypt-10].bytes2), Distinct: yyS[yypt-9].str, SelectExprs: yyS[yypt-8].selectExprs, From: yyS[yypt-6].tableExprs, Where: NewWhere(AST_WHERE, yyS[yypt-5].boolExpr), GroupBy: GroupBy(yyS[yypt-4].valExprs), Having: NewWhere(AST_HAVING, yyS[yypt-3].boolExpr), OrderBy: yyS[yypt-2].orderBy, Limit: yyS[yypt-1].limit, Lock: yyS[yypt-0].str}
-		}
+		yyVAL.statement = yyS[yypt-0].statement
 	case 12:
-		//line sql.y:170
-		{
-			yyVAL.selStmt = &Union{Type: yyS[yypt-1].str, Left: yyS[yypt-2].selStmt, Right: yyS[yypt-0].selStmt}
-		}
+		yyVAL.statement = yyS[yypt-0].statement
 	case 13:
-		//line sql.y:176
-		{
-			yyVAL.statement = &Insert{Comments: Comments(yyS[yypt-5].bytes2), Table: yyS[yypt-3].tableName, Columns: yyS[yypt-2].columns, Rows: yyS[yypt-1].insRows, OnDup: OnDup(yyS[yypt-0].updateExprs)}
-		}
+		yyVAL.statement = yyS[yypt-0].statement
 	case 14:
-		//line sql.y:180
-		{
-			cols := make(Columns, 0, len(yyS[yypt-1].updateExprs))
-			vals := make(ValTuple, 0, len(yyS[yypt-1].updateExprs))
-			for _, col := range yyS[yypt-1].updateExprs {
-				cols = append(cols, &NonStarExpr{Expr: col.Name})
-				vals = append(vals, col.Expr)
-			}
-			yyVAL.statement = &Insert{Comments: Comments(yyS[yypt-5].bytes2), Table: yyS[yypt-3].tableName, Columns: cols, Rows: Values{vals}, OnDup: OnDup(yyS[yypt-0].updateExprs)}
-		}
+		yyVAL.statement = yyS[yypt-0].statement
 	case 15:
-		//line sql.y:192
+		//line sql.y:229
 		{
-			yyVAL.statement = &Update{Comments: Comments(yyS[yypt-6].bytes2), Table: yyS[yypt-5].tableName, Exprs: yyS[yypt-3].updateExprs, Where: NewWhere(AST_WHERE, yyS[yypt-2].boolExpr), OrderBy: yyS[yypt-1].orderBy, Limit: yyS[yypt-0].limit}
+			yyVAL.selStmt = yyS[yypt-0].sel
 		}
 	case 16:
-		//line sql.y:198
+		//line sql.y:233
 		{
-			yyVAL.statement = &Delete{Comments: Comments(yyS[yypt-5].bytes2), Table: yyS[yypt-3].tableName, Where: NewWhere(AST_WHERE, yyS[yypt-2].boolExpr), OrderBy: yyS[yypt-1].orderBy, Limit: yyS[yypt-0].limit}
+			// The ORDER BY and LIMIT of the last select apply to the whole union.
+			union := &Union{Type: yyS[yypt-1].str, Left: yyS[yypt-2].selStmt, Right: yyS[yypt-0].sel}
+			if sel := yyS[yypt-0].sel; sel.Lock == "" {
+				union.OrderBy, union.Limit = sel.OrderBy, sel.Limit
+				sel.OrderBy, sel.Limit = nil, nil
+			}
+			yyVAL.selStmt = union
 		}
 	case 17:
-		//line sql.y:204
+		//line sql.y:243
 		{
-			yyVAL.statement = &Set{Comments: Comments(yyS[yypt-1].bytes2), Exprs: yyS[yypt-0].updateExprs}
+			yyVAL.selStmt = &Union{Type: yyS[yypt-3].str, Left: yyS[yypt-4].selStmt, Right: &ParenSelect{Select: yyS[yypt-2].subquery.Select}, OrderBy: yyS[yypt-1].orderBy, Limit: yyS[yypt-0].limit}
 		}
 	case 18:
-		//line sql.y:210
+		//line sql.y:249
 		{
-			yyVAL.statement = &DDL{Action: AST_CREATE, NewName: yyS[yypt-1].bytes}
+			yyVAL.sel = &Select{Comments: Comments(yyS[yypt-10].bytes2), Distinct: yyS[yypt-9].str, SelectExprs: yyS[yypt-8].selectExprs, From: yyS[yypt-6].tableExprs, Where: NewWhere(AST_WHERE, yyS[yypt-5].boolExpr), GroupBy: GroupBy(yyS[yypt-4].valExprs), Having: NewWhere(AST_HAVING, yyS[yypt-3].boolExpr), OrderBy: yyS[yypt-2].orderBy, Limit: yyS[yypt-1].limit, Lock: yyS[yypt-0].str}
 		}
 	case 19:
-		//line sql.y:214
+		//line sql.y:255
 		{
-			// Change this to an alter statement
-			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-1].bytes, NewName: yyS[yypt-1].bytes}
+			yyVAL.selStmt = yyS[yypt-0].selStmt
 		}
 	case 20:
-		//line sql.y:219
+		//line sql.y:259
 		{
-			yyVAL.statement = &DDL{Action: AST_CREATE, NewName: yyS[yypt-1].bytes}
+			yyVAL.selStmt = &ParenSelect{Select: yyS[yypt-0].subquery.Select}
 		}
 	case 21:
-		//line sql.y:225
+		//line sql.y:265
 		{
-			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-2].bytes, NewName: yyS[yypt-2].bytes}
+			yyVAL.statement = &Insert{Comments: Comments(yyS[yypt-4].bytes2), Table: yyS[yypt-2].tableName, Rows: yyS[yypt-1].insRows, OnDup: OnDup(yyS[yypt-0].updateExprs)}
 		}
 	case 22:
-		//line sql.y:229
+		//line sql.y:269
 		{
-			// Change this to a rename statement
-			yyVAL.statement = &DDL{Action: AST_RENAME, Table: yyS[yypt-3].bytes, NewName: yyS[yypt-0].bytes}
+			yyVAL.statement = &Insert{Comments: Comments(yyS[yypt-7].bytes2), Table: yyS[yypt-5].tableName, Columns: yyS[yypt-3].columns, Rows: yyS[yypt-1].insRows, OnDup: OnDup(yyS[yypt-0].updateExprs)}
 		}
 	case 23:
-		//line sql.y:234
+		//line sql.y:273
 		{
-			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-1].bytes, NewName: yyS[yypt-1].bytes}
+			cols := make(Columns, 0, len(yyS[yypt-1].updateExprs))
+			vals := make(ValTuple, 0, len(yyS[yypt-1].updateExprs))
+			for _, col := range yyS[yypt-1].updateExprs {
+				cols = append(cols, &NonStarExpr{Expr: col.Name})
+				vals = append(vals, col.Expr)
+			}
+			yyVAL.statement = &Insert{Comments: Comments(yyS[yypt-5].bytes2), Table: yyS[yypt-3].tableName, Columns: cols, Rows: Values{vals}, OnDup: OnDup(yyS[yypt-0].updateExprs)}
 		}
 	case 24:
-		//line sql.y:240
+		//line sql.y:285
 		{
-			yyVAL.statement = &DDL{Action: AST_RENAME, Table: yyS[yypt-2].bytes, NewName: yyS[yypt-0].bytes}
+			yyVAL.statement = &Update{Comments: Comments(yyS[yypt-6].bytes2), Table: yyS[yypt-5].tableName, Exprs: yyS[yypt-3].updateExprs, Where: NewWhere(AST_WHERE, yyS[yypt-2].boolExpr), OrderBy: yyS[yypt-1].orderBy, Limit: yyS[yypt-0].limit}
 		}
 	case 25:
-		//line sql.y:246
+		//line sql.y:291
 		{
-			yyVAL.statement = &DDL{Action: AST_DROP, Table: yyS[yypt-0].bytes}
+			yyVAL.statement = &Delete{Comments: Comments(yyS[yypt-5].bytes2), Table: yyS[yypt-3].tableName, Where: NewWhere(AST_WHERE, yyS[yypt-2].boolExpr), OrderBy: yyS[yypt-1].orderBy, Limit: yyS[yypt-0].limit}
 		}
 	case 26:
-		//line sql.y:250
+		//line sql.y:297
 		{
-			// Change this to an alter statement
-			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-0].bytes, NewName: yyS[yypt-0].bytes}
+			yyVAL.statement = &Set{Comments: Comments(yyS[yypt-1].bytes2), Exprs: yyS[yypt-0].updateExprs}
 		}
 	case 27:
-		//line sql.y:255
+		//line sql.y:301
 		{
-			yyVAL.statement = &DDL{Action: AST_DROP, Table: yyS[yypt-1].bytes}
+			scope := setScope(yyS[yypt-1].bytes)
+			if scope == "" {
+				yylex.Error("expecting session or global")
+				return 1
+			}
+			yyVAL.statement = &Set{Comments: Comments(yyS[yypt-2].bytes2), Scope: scope, Exprs: yyS[yypt-0].updateExprs}
 		}
 	case 28:
-		//line sql.y:260
-		{
-			SetAllowComments(yylex, true)
+		//line sql.y:310
+		{
+			var name string
+			switch string(bytes.ToLower(yyS[yypt-2].bytes)) {
+			case AST_NAMES:
+				name = AST_NAMES
+			case AST_CHARSET:
+				name = AST_CHARSET
+			default:
+				yylex.Error("expecting names or charset")
+				return 1
+			}
+			charset := &UpdateExpr{Name: &ColName{Name: []byte(name)}, Expr: StrVal(yyS[yypt-1].bytes)}
+			yyVAL.statement = &Set{Comments: Comments(yyS[yypt-3].bytes2), Exprs: append(UpdateExprs{charset}, yyS[yypt-0].updateExprs...)}
 		}
 	case 29:
-		//line sql.y:264
+		//line sql.y:325
 		{
-			yyVAL.bytes2 = yyS[yypt-0].bytes2
-			SetAllowComments(yylex, false)
+			if !bytes.Equal(bytes.ToLower(yyS[yypt-2].bytes), CHARACTER_BYTES) {
+				yylex.Error("expecting character")
+				return 1
+			}
+			charset := &UpdateExpr{Name: &ColName{Name: []byte(AST_CHARSET)}, Expr: StrVal(yyS[yypt-0].bytes)}
+			yyVAL.statement = &Set{Comments: Comments(yyS[yypt-3].bytes2), Exprs: UpdateExprs{charset}}
 		}
 	case 30:
-		//line sql.y:270
-		{
-			yyVAL.bytes2 = nil
-		}
+		yyVAL.bytes = yyS[yypt-0].bytes
 	case 31:
-		//line sql.y:274
-		{
-			yyVAL.bytes2 = append(yyS[yypt-1].bytes2, yyS[yypt-0].bytes)
-		}
+		yyVAL.bytes = yyS[yypt-0].bytes
 	case 32:
-		//line sql.y:280
+		//line sql.y:339
 		{
-			yyVAL.str = AST_UNION
+			yyVAL.updateExprs = nil
 		}
 	case 33:
-		//line sql.y:284
+		//line sql.y:343
 		{
-			yyVAL.str = AST_UNION_ALL
+			if !bytes.Equal(bytes.ToLower(yyS[yypt-1].bytes), []byte(AST_COLLATE)) {
+				yylex.Error("expecting collate")
+				return 1
+			}
+			yyVAL.updateExprs = UpdateExprs{&UpdateExpr{Name: &ColName{Name: []byte(AST_COLLATE)}, Expr: StrVal(yyS[yypt-0].bytes)}}
 		}
 	case 34:
-		//line sql.y:288
+		//line sql.y:353
 		{
-			yyVAL.str = AST_SET_MINUS
+			show, err := newShow(nil, yyS[yypt-2].bytes, yyS[yypt-1].tableNames, yyS[yypt-0].showFilter)
+			if err != nil {
+				yylex.Error(err.Error())
+				return 1
+			}
+			yyVAL.statement = show
 		}
 	case 35:
-		//line sql.y:292
+		//line sql.y:362
 		{
-			yyVAL.str = AST_EXCEPT
+			show, err := newShow(yyS[yypt-3].bytes, yyS[yypt-2].bytes, yyS[yypt-1].tableNames, yyS[yypt-0].showFilter)
+			if err != nil {
+				yylex.Error(err.Error())
+				return 1
+			}
+			yyVAL.statement = show
 		}
 	case 36:
-		//line sql.y:296
+		//line sql.y:372
 		{
-			yyVAL.str = AST_INTERSECT
+			yyVAL.tableNames = nil
 		}
 	case 37:
-		//line sql.y:301
+		//line sql.y:376
 		{
-			yyVAL.str = ""
+			yyVAL.tableNames = append(yyS[yypt-2].tableNames, yyS[yypt-0].tableName)
 		}
 	case 38:
-		//line sql.y:305
+		//line sql.y:380
 		{
-			yyVAL.str = AST_DISTINCT
+			yyVAL.tableNames = append(yyS[yypt-2].tableNames, yyS[yypt-0].tableName)
 		}
 	case 39:
-		//line sql.y:311
+		//line sql.y:385
 		{
-			yyVAL.selectExprs = SelectExprs{yyS[yypt-0].selectExpr}
+			yyVAL.showFilter = nil
 		}
 	case 40:
-		//line sql.y:315
+		//line sql.y:389
 		{
-			yyVAL.selectExprs = append(yyVAL.selectExprs, yyS[yypt-0].selectExpr)
+			yyVAL.showFilter = &ShowFilter{Like: yyS[yypt-0].bytes}
 		}
 	case 41:
-		//line sql.y:321
+		//line sql.y:393
 		{
-			yyVAL.selectExpr = &StarExpr{}
+			yyVAL.showFilter = &ShowFilter{Filter: yyS[yypt-0].boolExpr}
 		}
 	case 42:
-		//line sql.y:325
+		//line sql.y:399
 		{
-			yyVAL.selectExpr = &NonStarExpr{Expr: yyS[yypt-1].expr, As: yyS[yypt-0].bytes}
+			yyVAL.statement = &Use{DBName: yyS[yypt-0].bytes}
 		}
 	case 43:
-		//line sql.y:329
+		//line sql.y:405
 		{
-			yyVAL.selectExpr = &StarExpr{TableName: yyS[yypt-2].bytes}
+			yyVAL.statement = &Savepoint{Action: AST_SAVEPOINT, Name: yyS[yypt-0].bytes}
 		}
 	case 44:
-		//line sql.y:335
+		//line sql.y:409
 		{
-			yyVAL.expr = yyS[yypt-0].boolExpr
+			yyVAL.statement = &Savepoint{Action: AST_ROLLBACK_TO, Name: yyS[yypt-0].bytes}
 		}
 	case 45:
-		//line sql.y:339
+		//line sql.y:413
 		{
-			yyVAL.expr = yyS[yypt-0].valExpr
+			yyVAL.statement = &Savepoint{Action: AST_RELEASE, Name: yyS[yypt-0].bytes}
 		}
 	case 46:
-		//line sql.y:344
+		//line sql.y:418
 		{
-			yyVAL.bytes = nil
 		}
 	case 47:
-		//line sql.y:348
+		//line sql.y:420
 		{
-			yyVAL.bytes = yyS[yypt-0].bytes
+			if !bytes.Equal(bytes.ToLower(yyS[yypt-0].bytes), WORK) {
+				yylex.Error("expecting work")
+				return 1
+			}
 		}
 	case 48:
-		//line sql.y:352
+		//line sql.y:428
 		{
-			yyVAL.bytes = yyS[yypt-0].bytes
 		}
 	case 49:
-		//line sql.y:358
+		//line sql.y:430
 		{
-			yyVAL.tableExprs = TableExprs{yyS[yypt-0].tableExpr}
 		}
 	case 50:
-		//line sql.y:362
+		//line sql.y:434
 		{
-			yyVAL.tableExprs = append(yyVAL.tableExprs, yyS[yypt-0].tableExpr)
+			yyVAL.statement = &DDL{Action: AST_CREATE, NewName: yyS[yypt-1].bytes}
 		}
 	case 51:
-		//line sql.y:368
+		//line sql.y:438
 		{
-			yyVAL.tableExpr = &AliasedTableExpr{Expr: yyS[yypt-2].smTableExpr, As: yyS[yypt-1].bytes, Hints: yyS[yypt-0].indexHints}
+			if !bytes.Equal(bytes.ToLower(yyS[yypt-4].bytes), TEMPORARY_BYTES) {
+				yylex.Error("expecting temporary")
+				return 1
+			}
+			yyVAL.statement = &DDL{Action: AST_CREATE, NewName: yyS[yypt-1].bytes, Temporary: true}
 		}
 	case 52:
-		//line sql.y:372
+		//line sql.y:446
 		{
-			yyVAL.tableExpr = &ParenTableExpr{Expr: yyS[yypt-1].tableExpr}
+			// Change this to an alter statement
+			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-1].bytes, NewName: yyS[yypt-1].bytes}
 		}
 	case 53:
-		//line sql.y:376
+		//line sql.y:451
 		{
-			yyVAL.tableExpr = &JoinTableExpr{LeftExpr: yyS[yypt-2].tableExpr, Join: yyS[yypt-1].str, RightExpr: yyS[yypt-0].tableExpr}
+			yyVAL.statement = &DDL{Action: AST_CREATE, NewName: yyS[yypt-1].bytes}
 		}
 	case 54:
-		//line sql.y:380
+		//line sql.y:457
 		{
-			yyVAL.tableExpr = &JoinTableExpr{LeftExpr: yyS[yypt-4].tableExpr, Join: yyS[yypt-3].str, RightExpr: yyS[yypt-2].tableExpr, On: yyS[yypt-0].boolExpr}
+			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-2].bytes, NewName: yyS[yypt-2].bytes}
 		}
 	case 55:
-		//line sql.y:385
+		//line sql.y:461
 		{
-			yyVAL.bytes = nil
+			// Change this to a rename statement
+			yyVAL.statement = &DDL{Action: AST_RENAME, Table: yyS[yypt-3].bytes, NewName: yyS[yypt-0].bytes}
 		}
 	case 56:
-		//line sql.y:389
+		//line sql.y:466
 		{
-			yyVAL.bytes = yyS[yypt-0].bytes
+			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-1].bytes, NewName: yyS[yypt-1].bytes}
 		}
 	case 57:
-		//line sql.y:393
+		//line sql.y:472
 		{
-			yyVAL.bytes = yyS[yypt-0].bytes
+			yyVAL.statement = &DDL{Action: AST_RENAME, Table: yyS[yypt-2].bytes, NewName: yyS[yypt-0].bytes}
 		}
 	case 58:
-		//line sql.y:399
+		//line sql.y:478
 		{
-			yyVAL.str = AST_JOIN
+			yyVAL.statement = &DDL{Action: AST_DROP, Table: yyS[yypt-0].bytes}
 		}
 	case 59:
-		//line sql.y:403
+		//line sql.y:482
 		{
-			yyVAL.str = AST_STRAIGHT_JOIN
+			if !bytes.Equal(bytes.ToLower(yyS[yypt-3].bytes), TEMPORARY_BYTES) {
+				yylex.Error("expecting temporary")
+				return 1
+			}
+			yyVAL.statement = &DDL{Action: AST_DROP, Table: yyS[yypt-0].bytes, Temporary: true}
 		}
 	case 60:
-		//line sql.y:407
+		//line sql.y:490
 		{
-			yyVAL.str = AST_LEFT_JOIN
+			// Change this to an alter statement
+			yyVAL.statement = &DDL{Action: AST_ALTER, Table: yyS[yypt-0].bytes, NewName: yyS[yypt-0].bytes}
 		}
 	case 61:
-		//line sql.y:411
+		//line sql.y:495
 		{
-			yyVAL.str = AST_LEFT_JOIN
+			yyVAL.statement = &DDL{Action: AST_DROP, Table: yyS[yypt-1].bytes}
 		}
 	case 62:
-		//line sql.y:415
+		//line sql.y:501
 		{
-			yyVAL.str = AST_RIGHT_JOIN
+			yyVAL.statement = &DDL{Action: AST_CREATE, TableSpec: yyS[yypt-0].tableSpec}
 		}
 	case 63:
-		//line sql.y:419
+		//line sql.y:505
 		{
-			yyVAL.str = AST_RIGHT_JOIN
+			yyVAL.statement = &DDL{Action: AST_ALTER, AlterSpecs: yyS[yypt-0].alterSpecs}
 		}
 	case 64:
-		//line sql.y:423
+		//line sql.y:509
 		{
-			yyVAL.str = AST_JOIN
+			idx := &IndexDefinition{Name: string(yyS[yypt-7].bytes), Type: yyS[yypt-9].str, Columns: yyS[yypt-2].indexCols}
+			yyVAL.statement = &DDL{Action: AST_ALTER, AlterSpecs: AlterSpecs{{Action: AST_ADD_INDEX, Index: idx}}}
 		}
 	case 65:
-		//line sql.y:427
+		//line sql.y:514
 		{
-			yyVAL.str = AST_CROSS_JOIN
+			yyVAL.statement = &DDL{Action: AST_ALTER, AlterSpecs: AlterSpecs{{Action: AST_DROP_INDEX, Name: string(yyS[yypt-2].bytes)}}}
 		}
 	case 66:
-		//line sql.y:431
+		//line sql.y:520
 		{
-			yyVAL.str = AST_NATURAL_JOIN
+			yyVAL.tableSpec = yyS[yypt-2].tableSpec
+			yyVAL.tableSpec.Options = yyS[yypt-0].tableOpts
+			yyVAL.tableSpec.nameIndexes()
 		}
 	case 67:
-		//line sql.y:437
+		//line sql.y:528
 		{
-			yyVAL.smTableExpr = &TableName{Name: yyS[yypt-0].bytes}
+			yyVAL.tableSpec = &TableSpec{}
+			yyVAL.tableSpec.addColumn(yyS[yypt-0].columnSpec)
 		}
 	case 68:
-		//line sql.y:441
+		//line sql.y:533
 		{
-			yyVAL.smTableExpr = &TableName{Qualifier: yyS[yypt-2].bytes, Name: yyS[yypt-0].bytes}
+			yyVAL.tableSpec = &TableSpec{}
+			yyVAL.tableSpec.addIndexDefinition(yyS[yypt-0].indexDef)
 		}
 	case 69:
-		//line sql.y:445
+		//line sql.y:538
 		{
-			yyVAL.smTableExpr = yyS[yypt-0].subquery
+			yyVAL.tableSpec = yyS[yypt-2].tableSpec
+			yyVAL.tableSpec.addColumn(yyS[yypt-0].columnSpec)
 		}
 	case 70:
-		//line sql.y:451
+		//line sql.y:543
 		{
-			yyVAL.tableName = &TableName{Name: yyS[yypt-0].bytes}
+			yyVAL.tableSpec = yyS[yypt-2].tableSpec
+			yyVAL.tableSpec.addIndexDefinition(yyS[yypt-0].indexDef)
 		}
 	case 71:
-		//line sql.y:455
+		//line sql.y:550
 		{
-			yyVAL.tableName = &TableName{Qualifier: yyS[yypt-2].bytes, Name: yyS[yypt-0].bytes}
+			yyVAL.columnSpec = &columnSpec{column: &ColumnDefinition{Name: string(yyS[yypt-1].bytes), Type: yyS[yypt-0].str}}
 		}
 	case 72:
-		//line sql.y:460
+		//line sql.y:554
 		{
-			yyVAL.indexHints = nil
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.column.Type += " unsigned"
 		}
 	case 73:
-		//line sql.y:464
+		//line sql.y:559
 		{
-			yyVAL.indexHints = &IndexHints{Type: AST_USE, Indexes: yyS[yypt-1].bytes2}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.column.Type += " zerofill"
 		}
 	case 74:
-		//line sql.y:468
+		//line sql.y:564
 		{
-			yyVAL.indexHints = &IndexHints{Type: AST_IGNORE, Indexes: yyS[yypt-1].bytes2}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
 		}
 	case 75:
-		//line sql.y:472
+		//line sql.y:568
 		{
-			yyVAL.indexHints = &IndexHints{Type: AST_FORCE, Indexes: yyS[yypt-1].bytes2}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.column.Type += " binary"
 		}
 	case 76:
-		//line sql.y:478
+		//line sql.y:573
 		{
-			yyVAL.bytes2 = [][]byte{yyS[yypt-0].bytes}
+			yyVAL.columnSpec = yyS[yypt-3].columnSpec
+			yyVAL.columnSpec.column.Charset = yyS[yypt-0].str
 		}
 	case 77:
-		//line sql.y:482
+		//line sql.y:578
 		{
-			yyVAL.bytes2 = append(yyS[yypt-2].bytes2, yyS[yypt-0].bytes)
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.column.Charset = yyS[yypt-0].str
 		}
 	case 78:
-		//line sql.y:487
+		//line sql.y:583
 		{
-			yyVAL.boolExpr = nil
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.column.Collate = yyS[yypt-0].str
 		}
 	case 79:
-		//line sql.y:491
+		//line sql.y:588
 		{
-			yyVAL.boolExpr = yyS[yypt-0].boolExpr
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.column.NotNull = true
 		}
 	case 80:
-		yyVAL.boolExpr = yyS[yypt-0].boolExpr
+		//line sql.y:593
+		{
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.column.NotNull = false
+		}
 	case 81:
-		//line sql.y:498
+		//line sql.y:598
 		{
-			yyVAL.boolExpr = &AndExpr{Left: yyS[yypt-2].boolExpr, Right: yyS[yypt-0].boolExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.column.Default = yyS[yypt-0].valExpr
 		}
 	case 82:
-		//line sql.y:502
+		//line sql.y:603
 		{
-			yyVAL.boolExpr = &OrExpr{Left: yyS[yypt-2].boolExpr, Right: yyS[yypt-0].boolExpr}
+			yyVAL.columnSpec = yyS[yypt-3].columnSpec
+			yyVAL.columnSpec.column.OnUpdate = yyS[yypt-0].valExpr
 		}
 	case 83:
-		//line sql.y:506
+		//line sql.y:608
 		{
-			yyVAL.boolExpr = &NotExpr{Expr: yyS[yypt-0].boolExpr}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.column.Autoincrement = true
 		}
 	case 84:
-		//line sql.y:510
+		//line sql.y:613
 		{
-			yyVAL.boolExpr = &ParenBoolExpr{Expr: yyS[yypt-1].boolExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.column.Comment = string(yyS[yypt-0].bytes)
 		}
 	case 85:
-		//line sql.y:516
+		//line sql.y:618
 		{
-			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: yyS[yypt-1].str, Right: yyS[yypt-0].valExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.addIndex(AST_PRIMARY_KEY)
 		}
 	case 86:
-		//line sql.y:520
+		//line sql.y:623
 		{
-			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: AST_IN, Right: yyS[yypt-0].tuple}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.addIndex(AST_PRIMARY_KEY)
 		}
 	case 87:
-		//line sql.y:524
+		//line sql.y:628
 		{
-			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-3].valExpr, Operator: AST_NOT_IN, Right: yyS[yypt-0].tuple}
+			yyVAL.columnSpec = yyS[yypt-1].columnSpec
+			yyVAL.columnSpec.addIndex(AST_UNIQUE_KEY)
 		}
 	case 88:
-		//line sql.y:528
+		//line sql.y:633
 		{
-			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: AST_LIKE, Right: yyS[yypt-0].valExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
+			yyVAL.columnSpec.addIndex(AST_UNIQUE_KEY)
 		}
 	case 89:
-		//line sql.y:532
+		//line sql.y:638
 		{
-			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-3].valExpr, Operator: AST_NOT_LIKE, Right: yyS[yypt-0].valExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
 		}
 	case 90:
-		//line sql.y:536
+		//line sql.y:642
 		{
-			yyVAL.boolExpr = &RangeCond{Left: yyS[yypt-4].valExpr, Operator: AST_BETWEEN, From: yyS[yypt-2].valExpr, To: yyS[yypt-0].valExpr}
+			yyVAL.columnSpec = yyS[yypt-2].columnSpec
 		}
 	case 91:
-		//line sql.y:540
+		//line sql.y:648
 		{
-			yyVAL.boolExpr = &RangeCond{Left: yyS[yypt-5].valExpr, Operator: AST_NOT_BETWEEN, From: yyS[yypt-2].valExpr, To: yyS[yypt-0].valExpr}
+			yyVAL.str = yyS[yypt-0].str
 		}
 	case 92:
-		//line sql.y:544
+		//line sql.y:652
 		{
-			yyVAL.boolExpr = &NullCheck{Operator: AST_IS_NULL, Expr: yyS[yypt-2].valExpr}
+			yyVAL.str = yyS[yypt-3].str + "(" + yyS[yypt-1].str + ")"
 		}
 	case 93:
-		//line sql.y:548
+		//line sql.y:658
 		{
-			yyVAL.boolExpr = &NullCheck{Operator: AST_IS_NOT_NULL, Expr: yyS[yypt-3].valExpr}
+			yyVAL.str = string(bytes.ToLower(yyS[yypt-0].bytes))
 		}
 	case 94:
-		//line sql.y:552
+		//line sql.y:662
 		{
-			yyVAL.boolExpr = &ExistsExpr{Subquery: yyS[yypt-0].subquery}
+			yyVAL.str = "set"
 		}
 	case 95:
-		//line sql.y:558
+		//line sql.y:666
 		{
-			yyVAL.str = AST_EQ
+			yyVAL.str = "binary"
 		}
 	case 96:
-		//line sql.y:562
+		//line sql.y:672
 		{
-			yyVAL.str = AST_LT
+			yyVAL.str = yyS[yypt-0].str
 		}
 	case 97:
-		//line sql.y:566
+		//line sql.y:676
 		{
-			yyVAL.str = AST_GT
+			yyVAL.str = yyS[yypt-2].str + "," + yyS[yypt-0].str
 		}
 	case 98:
-		//line sql.y:570
+		//line sql.y:682
 		{
-			yyVAL.str = AST_LE
+			yyVAL.str = string(yyS[yypt-0].bytes)
 		}
 	case 99:
-		//line sql.y:574
+		//line sql.y:686
 		{
-			yyVAL.str = AST_GE
+			yyVAL.str = String(StrVal(yyS[yypt-0].bytes))
 		}
 	case 100:
-		//line sql.y:578
+		//line sql.y:692
 		{
-			yyVAL.str = AST_NE
+			yyVAL.valExpr = StrVal(yyS[yypt-0].bytes)
 		}
 	case 101:
-		//line sql.y:582
+		//line sql.y:696
 		{
-			yyVAL.str = AST_NSE
+			yyVAL.valExpr = NumVal(yyS[yypt-0].bytes)
 		}
 	case 102:
-		//line sql.y:588
+		//line sql.y:700
 		{
-			yyVAL.insRows = yyS[yypt-0].values
+			yyVAL.valExpr = &NullVal{}
 		}
 	case 103:
-		//line sql.y:592
+		//line sql.y:704
 		{
-			yyVAL.insRows = yyS[yypt-0].selStmt
+			yyVAL.valExpr = append(NumVal("-"), yyS[yypt-0].bytes...)
 		}
 	case 104:
-		//line sql.y:598
+		//line sql.y:708
 		{
-			yyVAL.values = Values{yyS[yypt-0].tuple}
+			yyVAL.valExpr = NumVal(yyS[yypt-0].bytes)
 		}
 	case 105:
-		//line sql.y:602
+		//line sql.y:712
 		{
-			yyVAL.values = append(yyS[yypt-2].values, yyS[yypt-0].tuple)
+			// Functions like current_timestamp can go without parentheses.
+			name := bytes.ToLower(yyS[yypt-0].bytes)
+			if timeFuncs[string(name)] {
+				yyVAL.valExpr = &FuncExpr{Name: name}
+			} else {
+				yyVAL.valExpr = &ColName{Name: name}
+			}
 		}
 	case 106:
-		//line sql.y:608
+		//line sql.y:722
 		{
-			yyVAL.tuple = ValTuple(yyS[yypt-1].valExprs)
+			yyVAL.valExpr = &FuncExpr{Name: bytes.ToLower(yyS[yypt-2].bytes)}
 		}
 	case 107:
-		//line sql.y:612
+		//line sql.y:726
 		{
-			yyVAL.tuple = yyS[yypt-0].subquery
+			yyVAL.valExpr = &FuncExpr{Name: bytes.ToLower(yyS[yypt-3].bytes)}
 		}
 	case 108:
-		//line sql.y:618
+		//line sql.y:732
 		{
-			yyVAL.subquery = &Subquery{yyS[yypt-1].selStmt}
+			yyVAL.indexDef = yyS[yypt-0].indexDef
 		}
 	case 109:
-		//line sql.y:624
+		//line sql.y:737
 		{
-			yyVAL.valExprs = ValExprs{yyS[yypt-0].valExpr}
+			yyVAL.empty = struct{}{}
 		}
 	case 110:
-		//line sql.y:628
+		//line sql.y:739
 		{
-			yyVAL.valExprs = append(yyS[yypt-2].valExprs, yyS[yypt-0].valExpr)
+			yyVAL.empty = struct{}{}
 		}
 	case 111:
-		//line sql.y:634
+		//line sql.y:741
 		{
-			yyVAL.valExpr = yyS[yypt-0].valExpr
+			yyVAL.empty = struct{}{}
 		}
 	case 112:
-		//line sql.y:638
+		//line sql.y:745
 		{
-			yyVAL.valExpr = yyS[yypt-0].colName
+			yyVAL.indexDef = &IndexDefinition{Name: PrimaryKeyName, Type: AST_PRIMARY_KEY, Columns: yyS[yypt-2].indexCols}
 		}
 	case 113:
-		//line sql.y:642
+		//line sql.y:749
 		{
-			yyVAL.valExpr = yyS[yypt-0].tuple
+			yyVAL.indexDef = &IndexDefinition{Name: yyS[yypt-5].str, Type: yyS[yypt-7].str, Columns: yyS[yypt-2].indexCols}
 		}
 	case 114:
-		//line sql.y:646
+		//line sql.y:753
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITAND, Right: yyS[yypt-0].valExpr}
+			yyVAL.indexDef = &IndexDefinition{Name: yyS[yypt-5].str, Type: AST_KEY, Columns: yyS[yypt-2].indexCols}
 		}
 	case 115:
-		//line sql.y:650
+		//line sql.y:757
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITOR, Right: yyS[yypt-0].valExpr}
+			// Foreign keys are skipped.
+			yyVAL.indexDef = nil
 		}
 	case 116:
-		//line sql.y:654
+		//line sql.y:762
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITXOR, Right: yyS[yypt-0].valExpr}
+			// Check constraints are skipped.
+			yyVAL.indexDef = nil
 		}
 	case 117:
-		//line sql.y:658
+		//line sql.y:768
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_PLUS, Right: yyS[yypt-0].valExpr}
+			yyVAL.str = AST_KEY
 		}
 	case 118:
-		//line sql.y:662
+		//line sql.y:772
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_MINUS, Right: yyS[yypt-0].valExpr}
+			yyVAL.str = yyS[yypt-0].str
 		}
 	case 119:
-		//line sql.y:666
+		//line sql.y:778
 		{
-			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_MULT, Right: yyS[yypt-0].valExpr}
+			yyVAL.str = AST_UNIQUE_KEY
 		}
 	case 120:
-		//line sql.y:670
+		//line sql.y:782
+		{
+			yyVAL.str = AST_FULLTEXT_KEY
+		}
+	case 121:
+		//line sql.y:786
+		{
+			yyVAL.str = AST_SPATIAL_KEY
+		}
+	case 122:
+		//line sql.y:792
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 123:
+		//line sql.y:794
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 124:
+		//line sql.y:797
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 125:
+		//line sql.y:799
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 126:
+		//line sql.y:802
+		{
+			yyVAL.str = ""
+		}
+	case 127:
+		//line sql.y:806
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 128:
+		//line sql.y:811
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 129:
+		//line sql.y:813
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 130:
+		//line sql.y:817
+		{
+			yyVAL.indexCols = []*IndexColumn{yyS[yypt-0].indexCol}
+		}
+	case 131:
+		//line sql.y:821
+		{
+			yyVAL.indexCols = append(yyS[yypt-2].indexCols, yyS[yypt-0].indexCol)
+		}
+	case 132:
+		//line sql.y:827
+		{
+			yyVAL.indexCol = &IndexColumn{Name: string(yyS[yypt-2].bytes), Length: yyS[yypt-1].str}
+		}
+	case 133:
+		//line sql.y:832
+		{
+			yyVAL.str = ""
+		}
+	case 134:
+		//line sql.y:836
+		{
+			yyVAL.str = string(yyS[yypt-1].bytes)
+		}
+	case 135:
+		//line sql.y:841
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 136:
+		//line sql.y:843
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 137:
+		//line sql.y:845
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 138:
+		//line sql.y:847
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 139:
+		//line sql.y:850
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 140:
+		//line sql.y:852
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 141:
+		//line sql.y:854
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 142:
+		//line sql.y:858
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 143:
+		//line sql.y:860
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 144:
+		//line sql.y:862
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 145:
+		//line sql.y:864
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 146:
+		//line sql.y:867
+		{
+			yyVAL.tableOpts = nil
+		}
+	case 147:
+		//line sql.y:871
+		{
+			yyVAL.tableOpts = append(yyS[yypt-1].tableOpts, yyS[yypt-0].tableOpt)
+		}
+	case 148:
+		//line sql.y:875
+		{
+			yyVAL.tableOpts = append(yyS[yypt-2].tableOpts, yyS[yypt-0].tableOpt)
+		}
+	case 149:
+		//line sql.y:881
+		{
+			yyVAL.tableOpts = []*TableOption{yyS[yypt-0].tableOpt}
+		}
+	case 150:
+		//line sql.y:885
+		{
+			yyVAL.tableOpts = append(yyS[yypt-1].tableOpts, yyS[yypt-0].tableOpt)
+		}
+	case 151:
+		//line sql.y:891
+		{
+			yyVAL.tableOpt = &TableOption{Name: yyS[yypt-2].str, Value: yyS[yypt-0].str}
+		}
+	case 152:
+		//line sql.y:896
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 153:
+		//line sql.y:898
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 154:
+		//line sql.y:902
+		{
+			yyVAL.str = string(bytes.ToLower(yyS[yypt-0].bytes))
+			if !tableOptions[yyVAL.str] {
+				yylex.Error("unknown table option")
+				return 1
+			}
+		}
+	case 155:
+		//line sql.y:910
+		{
+			yyVAL.str = "charset"
+		}
+	case 156:
+		//line sql.y:914
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 157:
+		//line sql.y:918
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 158:
+		//line sql.y:922
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 159:
+		//line sql.y:926
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 160:
+		//line sql.y:930
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 161:
+		//line sql.y:936
+		{
+			yyVAL.str = String(StrVal(yyS[yypt-0].bytes))
+		}
+	case 162:
+		//line sql.y:940
+		{
+			yyVAL.str = string(yyS[yypt-0].bytes)
+		}
+	case 163:
+		//line sql.y:944
+		{
+			yyVAL.str = yyS[yypt-0].str
+		}
+	case 164:
+		//line sql.y:950
+		{
+			yyVAL.alterSpecs = appendAlterSpecs(nil, yyS[yypt-0].alterSpecs...)
+		}
+	case 165:
+		//line sql.y:954
+		{
+			yyVAL.alterSpecs = appendAlterSpecs(yyS[yypt-2].alterSpecs, yyS[yypt-0].alterSpecs...)
+		}
+	case 166:
+		//line sql.y:960
+		{
+			yyS[yypt-0].alterSpec.Action, yyS[yypt-0].alterSpec.Column = AST_ADD_COLUMN, yyS[yypt-1].columnDef
+			yyVAL.alterSpecs = AlterSpecs{yyS[yypt-0].alterSpec}
+		}
+	case 167:
+		//line sql.y:965
+		{
+			yyVAL.alterSpecs = yyS[yypt-1].alterSpecs
+		}
+	case 168:
+		//line sql.y:969
+		{
+			if yyS[yypt-0].indexDef == nil {
+				yylex.Error("foreign keys and checks are not supported in an alter")
+				return 1
+			}
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_ADD_INDEX, Index: yyS[yypt-0].indexDef}}
+		}
+	case 169:
+		//line sql.y:977
+		{
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_DROP_INDEX, Name: PrimaryKeyName}}
+		}
+	case 170:
+		//line sql.y:981
+		{
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_DROP_INDEX, Name: string(yyS[yypt-0].bytes)}}
+		}
+	case 171:
+		//line sql.y:985
+		{
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_DROP_COLUMN, Name: string(yyS[yypt-0].bytes)}}
+		}
+	case 172:
+		//line sql.y:989
+		{
+			yyS[yypt-0].alterSpec.Action, yyS[yypt-0].alterSpec.Column = AST_MODIFY_COLUMN, yyS[yypt-1].columnDef
+			yyVAL.alterSpecs = AlterSpecs{yyS[yypt-0].alterSpec}
+		}
+	case 173:
+		//line sql.y:994
+		{
+			yyS[yypt-0].alterSpec.Action, yyS[yypt-0].alterSpec.Column, yyS[yypt-0].alterSpec.Name = AST_CHANGE_COLUMN, yyS[yypt-1].columnDef, string(yyS[yypt-2].bytes)
+			yyVAL.alterSpecs = AlterSpecs{yyS[yypt-0].alterSpec}
+		}
+	case 174:
+		//line sql.y:999
+		{
+			// It only affects how the table is altered.
+			yyVAL.alterSpecs = nil
+		}
+	case 175:
+		//line sql.y:1004
+		{
+			// It only affects how the table is altered.
+			yyVAL.alterSpecs = nil
+		}
+	case 176:
+		//line sql.y:1009
+		{
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_TABLE_OPTIONS, Options: yyS[yypt-0].tableOpts}}
+		}
+	case 177:
+		//line sql.y:1015
+		{
+			yyVAL.alterSpecs = AlterSpecs{{Action: AST_ADD_COLUMN, Column: yyS[yypt-0].columnDef}}
+		}
+	case 178:
+		//line sql.y:1019
+		{
+			yyVAL.alterSpecs = append(yyS[yypt-2].alterSpecs, &AlterSpec{Action: AST_ADD_COLUMN, Column: yyS[yypt-0].columnDef})
+		}
+	case 179:
+		//line sql.y:1025
+		{
+			if yyS[yypt-0].columnSpec.indexes != nil {
+				yylex.Error("column indexes are not supported in an alter")
+				return 1
+			}
+			yyVAL.columnDef = yyS[yypt-0].columnSpec.column
+		}
+	case 180:
+		//line sql.y:1034
+		{
+			yyVAL.alterSpec = &AlterSpec{}
+		}
+	case 181:
+		//line sql.y:1038
+		{
+			yyVAL.alterSpec = &AlterSpec{First: true}
+		}
+	case 182:
+		//line sql.y:1042
+		{
+			yyVAL.alterSpec = &AlterSpec{After: string(yyS[yypt-0].bytes)}
+		}
+	case 183:
+		//line sql.y:1047
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 184:
+		//line sql.y:1049
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 185:
+		//line sql.y:1052
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 186:
+		//line sql.y:1054
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 187:
+		//line sql.y:1057
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 188:
+		//line sql.y:1059
+		{
+			yyVAL.empty = struct{}{}
+		}
+	case 189:
+		//line sql.y:1063
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 190:
+		//line sql.y:1067
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 191:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 192:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 193:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 194:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 195:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 196:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 197:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 198:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 199:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 200:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 201:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 202:
+		yyVAL.bytes = yyS[yypt-0].bytes
+	case 203:
+		//line sql.y:1090
+		{
+			yyVAL.str = string(bytes.ToLower(yyS[yypt-0].bytes))
+		}
+	case 204:
+		//line sql.y:1094
+		{
+			yyVAL.str = "binary"
+		}
+	case 205:
+		//line sql.y:1098
+		{
+			yyVAL.str = "default"
+		}
+	case 206:
+		//line sql.y:1103
+		{
+			SetAllowComments(yylex, true)
+		}
+	case 207:
+		//line sql.y:1107
+		{
+			yyVAL.bytes2 = yyS[yypt-0].bytes2
+			SetAllowComments(yylex, false)
+		}
+	case 208:
+		//line sql.y:1113
+		{
+			yyVAL.bytes2 = nil
+		}
+	case 209:
+		//line sql.y:1117
+		{
+			yyVAL.bytes2 = append(yyS[yypt-1].bytes2, yyS[yypt-0].bytes)
+		}
+	case 210:
+		//line sql.y:1123
+		{
+			yyVAL.str = AST_UNION
+		}
+	case 211:
+		//line sql.y:1127
+		{
+			yyVAL.str = AST_UNION_ALL
+		}
+	case 212:
+		//line sql.y:1131
+		{
+			yyVAL.str = AST_UNION_DISTINCT
+		}
+	case 213:
+		//line sql.y:1135
+		{
+			yyVAL.str = AST_SET_MINUS
+		}
+	case 214:
+		//line sql.y:1139
+		{
+			yyVAL.str = AST_EXCEPT
+		}
+	case 215:
+		//line sql.y:1143
+		{
+			yyVAL.str = AST_INTERSECT
+		}
+	case 216:
+		//line sql.y:1148
+		{
+			yyVAL.str = ""
+		}
+	case 217:
+		//line sql.y:1152
+		{
+			yyVAL.str = AST_DISTINCT
+		}
+	case 218:
+		//line sql.y:1158
+		{
+			yyVAL.selectExprs = SelectExprs{yyS[yypt-0].selectExpr}
+		}
+	case 219:
+		//line sql.y:1162
+		{
+			yyVAL.selectExprs = append(yyVAL.selectExprs, yyS[yypt-0].selectExpr)
+		}
+	case 220:
+		//line sql.y:1168
+		{
+			yyVAL.selectExpr = &StarExpr{}
+		}
+	case 221:
+		//line sql.y:1172
+		{
+			yyVAL.selectExpr = &NonStarExpr{Expr: yyS[yypt-1].expr, As: yyS[yypt-0].bytes}
+		}
+	case 222:
+		//line sql.y:1176
+		{
+			yyVAL.selectExpr = &StarExpr{TableName: yyS[yypt-2].bytes}
+		}
+	case 223:
+		//line sql.y:1182
+		{
+			yyVAL.expr = yyS[yypt-0].boolExpr
+		}
+	case 224:
+		//line sql.y:1186
+		{
+			yyVAL.expr = yyS[yypt-0].valExpr
+		}
+	case 225:
+		//line sql.y:1191
+		{
+			yyVAL.bytes = nil
+		}
+	case 226:
+		//line sql.y:1195
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 227:
+		//line sql.y:1199
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 228:
+		//line sql.y:1205
+		{
+			yyVAL.tableExprs = TableExprs{yyS[yypt-0].tableExpr}
+		}
+	case 229:
+		//line sql.y:1209
+		{
+			yyVAL.tableExprs = append(yyVAL.tableExprs, yyS[yypt-0].tableExpr)
+		}
+	case 230:
+		//line sql.y:1215
+		{
+			yyVAL.tableExpr = &AliasedTableExpr{Expr: yyS[yypt-2].smTableExpr, As: yyS[yypt-1].bytes, Hints: yyS[yypt-0].indexHints}
+		}
+	case 231:
+		//line sql.y:1219
+		{
+			yyVAL.tableExpr = &ParenTableExpr{Expr: yyS[yypt-1].tableExpr}
+		}
+	case 232:
+		//line sql.y:1223
+		{
+			yyVAL.tableExpr = &JoinTableExpr{LeftExpr: yyS[yypt-2].tableExpr, Join: yyS[yypt-1].str, RightExpr: yyS[yypt-0].tableExpr}
+		}
+	case 233:
+		//line sql.y:1227
+		{
+			yyVAL.tableExpr = &JoinTableExpr{LeftExpr: yyS[yypt-4].tableExpr, Join: yyS[yypt-3].str, RightExpr: yyS[yypt-2].tableExpr, On: yyS[yypt-0].boolExpr}
+		}
+	case 234:
+		//line sql.y:1232
+		{
+			yyVAL.bytes = nil
+		}
+	case 235:
+		//line sql.y:1236
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 236:
+		//line sql.y:1240
+		{
+			yyVAL.bytes = yyS[yypt-0].bytes
+		}
+	case 237:
+		//line sql.y:1246
+		{
+			yyVAL.str = AST_JOIN
+		}
+	case 238:
+		//line sql.y:1250
+		{
+			yyVAL.str = AST_STRAIGHT_JOIN
+		}
+	case 239:
+		//line sql.y:1254
+		{
+			yyVAL.str = AST_LEFT_JOIN
+		}
+	case 240:
+		//line sql.y:1258
+		{
+			yyVAL.str = AST_LEFT_JOIN
+		}
+	case 241:
+		//line sql.y:1262
+		{
+			yyVAL.str = AST_RIGHT_JOIN
+		}
+	case 242:
+		//line sql.y:1266
+		{
+			yyVAL.str = AST_RIGHT_JOIN
+		}
+	case 243:
+		//line sql.y:1270
+		{
+			yyVAL.str = AST_JOIN
+		}
+	case 244:
+		//line sql.y:1274
+		{
+			yyVAL.str = AST_CROSS_JOIN
+		}
+	case 245:
+		//line sql.y:1278
+		{
+			yyVAL.str = AST_NATURAL_JOIN
+		}
+	case 246:
+		//line sql.y:1284
+		{
+			yyVAL.smTableExpr = &TableName{Name: yyS[yypt-0].bytes}
+		}
+	case 247:
+		//line sql.y:1288
+		{
+			yyVAL.smTableExpr = &TableName{Qualifier: yyS[yypt-2].bytes, Name: yyS[yypt-0].bytes}
+		}
+	case 248:
+		//line sql.y:1292
+		{
+			yyVAL.smTableExpr = yyS[yypt-0].subquery
+		}
+	case 249:
+		//line sql.y:1298
+		{
+			yyVAL.tableName = &TableName{Name: yyS[yypt-0].bytes}
+		}
+	case 250:
+		//line sql.y:1302
+		{
+			yyVAL.tableName = &TableName{Qualifier: yyS[yypt-2].bytes, Name: yyS[yypt-0].bytes}
+		}
+	case 251:
+		//line sql.y:1307
+		{
+			yyVAL.indexHints = nil
+		}
+	case 252:
+		//line sql.y:1311
+		{
+			yyVAL.indexHints = &IndexHints{Type: AST_USE, Indexes: yyS[yypt-1].bytes2}
+		}
+	case 253:
+		//line sql.y:1315
+		{
+			yyVAL.indexHints = &IndexHints{Type: AST_IGNORE, Indexes: yyS[yypt-1].bytes2}
+		}
+	case 254:
+		//line sql.y:1319
+		{
+			yyVAL.indexHints = &IndexHints{Type: AST_FORCE, Indexes: yyS[yypt-1].bytes2}
+		}
+	case 255:
+		//line sql.y:1325
+		{
+			yyVAL.bytes2 = [][]byte{yyS[yypt-0].bytes}
+		}
+	case 256:
+		//line sql.y:1329
+		{
+			yyVAL.bytes2 = append(yyS[yypt-2].bytes2, yyS[yypt-0].bytes)
+		}
+	case 257:
+		//line sql.y:1334
+		{
+			yyVAL.boolExpr = nil
+		}
+	case 258:
+		//line sql.y:1338
+		{
+			yyVAL.boolExpr = yyS[yypt-0].boolExpr
+		}
+	case 259:
+		yyVAL.boolExpr = yyS[yypt-0].boolExpr
+	case 260:
+		//line sql.y:1345
+		{
+			yyVAL.boolExpr = &AndExpr{Left: yyS[yypt-2].boolExpr, Right: yyS[yypt-0].boolExpr}
+		}
+	case 261:
+		//line sql.y:1349
+		{
+			yyVAL.boolExpr = &OrExpr{Left: yyS[yypt-2].boolExpr, Right: yyS[yypt-0].boolExpr}
+		}
+	case 262:
+		//line sql.y:1353
+		{
+			yyVAL.boolExpr = &NotExpr{Expr: yyS[yypt-0].boolExpr}
+		}
+	case 263:
+		//line sql.y:1357
+		{
+			yyVAL.boolExpr = &ParenBoolExpr{Expr: yyS[yypt-1].boolExpr}
+		}
+	case 264:
+		//line sql.y:1363
+		{
+			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: yyS[yypt-1].str, Right: yyS[yypt-0].valExpr}
+		}
+	case 265:
+		//line sql.y:1367
+		{
+			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: AST_IN, Right: yyS[yypt-0].tuple}
+		}
+	case 266:
+		//line sql.y:1371
+		{
+			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-3].valExpr, Operator: AST_NOT_IN, Right: yyS[yypt-0].tuple}
+		}
+	case 267:
+		//line sql.y:1375
+		{
+			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-2].valExpr, Operator: AST_LIKE, Right: yyS[yypt-0].valExpr}
+		}
+	case 268:
+		//line sql.y:1379
+		{
+			yyVAL.boolExpr = &ComparisonExpr{Left: yyS[yypt-3].valExpr, Operator: AST_NOT_LIKE, Right: yyS[yypt-0].valExpr}
+		}
+	case 269:
+		//line sql.y:1383
+		{
+			yyVAL.boolExpr = &RangeCond{Left: yyS[yypt-4].valExpr, Operator: AST_BETWEEN, From: yyS[yypt-2].valExpr, To: yyS[yypt-0].valExpr}
+		}
+	case 270:
+		//line sql.y:1387
+		{
+			yyVAL.boolExpr = &RangeCond{Left: yyS[yypt-5].valExpr, Operator: AST_NOT_BETWEEN, From: yyS[yypt-2].valExpr, To: yyS[yypt-0].valExpr}
+		}
+	case 271:
+		//line sql.y:1391
+		{
+			yyVAL.boolExpr = &NullCheck{Operator: AST_IS_NULL, Expr: yyS[yypt-2].valExpr}
+		}
+	case 272:
+		//line sql.y:1395
+		{
+			yyVAL.boolExpr = &NullCheck{Operator: AST_IS_NOT_NULL, Expr: yyS[yypt-3].valExpr}
+		}
+	case 273:
+		//line sql.y:1399
+		{
+			yyVAL.boolExpr = &ExistsExpr{Subquery: yyS[yypt-0].subquery}
+		}
+	case 274:
+		//line sql.y:1405
+		{
+			yyVAL.str = AST_EQ
+		}
+	case 275:
+		//line sql.y:1409
+		{
+			yyVAL.str = AST_LT
+		}
+	case 276:
+		//line sql.y:1413
+		{
+			yyVAL.str = AST_GT
+		}
+	case 277:
+		//line sql.y:1417
+		{
+			yyVAL.str = AST_LE
+		}
+	case 278:
+		//line sql.y:1421
+		{
+			yyVAL.str = AST_GE
+		}
+	case 279:
+		//line sql.y:1425
+		{
+			yyVAL.str = AST_NE
+		}
+	case 280:
+		//line sql.y:1429
+		{
+			yyVAL.str = AST_NSE
+		}
+	case 281:
+		//line sql.y:1435
+		{
+			yyVAL.insRows = yyS[yypt-0].values
+		}
+	case 282:
+		//line sql.y:1439
+		{
+			yyVAL.insRows = yyS[yypt-0].selStmt
+		}
+	case 283:
+		//line sql.y:1443
+		{
+			yyVAL.insRows = &ParenSelect{Select: yyS[yypt-0].subquery.Select}
+		}
+	case 284:
+		//line sql.y:1449
+		{
+			yyVAL.values = Values{yyS[yypt-0].tuple}
+		}
+	case 285:
+		//line sql.y:1453
+		{
+			yyVAL.values = append(yyS[yypt-2].values, yyS[yypt-0].tuple)
+		}
+	case 286:
+		//line sql.y:1459
+		{
+			yyVAL.tuple = ValTuple(yyS[yypt-1].valExprs)
+		}
+	case 287:
+		//line sql.y:1463
+		{
+			yyVAL.tuple = yyS[yypt-0].subquery
+		}
+	case 288:
+		//line sql.y:1469
+		{
+			yyVAL.subquery = &Subquery{yyS[yypt-1].selStmt}
+		}
+	case 289:
+		//line sql.y:1475
+		{
+			yyVAL.valExprs = ValExprs{yyS[yypt-0].valExpr}
+		}
+	case 290:
+		//line sql.y:1479
+		{
+			yyVAL.valExprs = append(yyS[yypt-2].valExprs, yyS[yypt-0].valExpr)
+		}
+	case 291:
+		//line sql.y:1485
+		{
+			yyVAL.valExpr = yyS[yypt-0].valExpr
+		}
+	case 292:
+		//line sql.y:1489
+		{
+			yyVAL.valExpr = yyS[yypt-0].colName
+		}
+	case 293:
+		//line sql.y:1493
+		{
+			yyVAL.valExpr = yyS[yypt-0].tuple
+		}
+	case 294:
+		//line sql.y:1497
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITAND, Right: yyS[yypt-0].valExpr}
+		}
+	case 295:
+		//line sql.y:1501
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITOR, Right: yyS[yypt-0].valExpr}
+		}
+	case 296:
+		//line sql.y:1505
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_BITXOR, Right: yyS[yypt-0].valExpr}
+		}
+	case 297:
+		//line sql.y:1509
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_PLUS, Right: yyS[yypt-0].valExpr}
+		}
+	case 298:
+		//line sql.y:1513
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_MINUS, Right: yyS[yypt-0].valExpr}
+		}
+	case 299:
+		//line sql.y:1517
+		{
+			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_MULT, Right: yyS[yypt-0].valExpr}
+		}
+	case 300:
+		//line sql.y:1521
 		{
 			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_DIV, Right: yyS[yypt-0].valExpr}
 		}
-	case 121:
-		//line sql.y:674
+	case 301:
+		//line sql.y:1525
 		{
 			yyVAL.valExpr = &BinaryExpr{Left: yyS[yypt-2].valExpr, Operator: AST_MOD, Right: yyS[yypt-0].valExpr}
 		}
-	case 122:
-		//line sql.y:678
+	case 302:
+		//line sql.y:1529
 		{
 			if num, ok := yyS[yypt-0].valExpr.(NumVal); ok {
 				switch yyS[yypt-1].byt {
@@ -1343,213 +2601,213 @@ yydefault:
 				yyVAL.valExpr = &UnaryExpr{Operator: yyS[yypt-1].byt, Expr: yyS[yypt-0].valExpr}
 			}
 		}
-	case 123:
-		//line sql.y:693
+	case 303:
+		//line sql.y:1544
 		{
 			yyVAL.valExpr = &FuncExpr{Name: yyS[yypt-2].bytes}
 		}
-	case 124:
-		//line sql.y:697
+	case 304:
+		//line sql.y:1548
 		{
 			yyVAL.valExpr = &FuncExpr{Name: yyS[yypt-3].bytes, Exprs: yyS[yypt-1].selectExprs}
 		}
-	case 125:
-		//line sql.y:701
+	case 305:
+		//line sql.y:1552
 		{
 			yyVAL.valExpr = &FuncExpr{Name: yyS[yypt-4].bytes, Distinct: true, Exprs: yyS[yypt-1].selectExprs}
 		}
-	case 126:
-		//line sql.y:705
+	case 306:
+		//line sql.y:1556
 		{
 			yyVAL.valExpr = &FuncExpr{Name: yyS[yypt-3].bytes, Exprs: yyS[yypt-1].selectExprs}
 		}
-	case 127:
-		//line sql.y:709
+	case 307:
+		//line sql.y:1560
 		{
 			yyVAL.valExpr = yyS[yypt-0].caseExpr
 		}
-	case 128:
-		//line sql.y:715
+	case 308:
+		//line sql.y:1566
 		{
 			yyVAL.bytes = IF_BYTES
 		}
-	case 129:
-		//line sql.y:719
+	case 309:
+		//line sql.y:1570
 		{
 			yyVAL.bytes = VALUES_BYTES
 		}
-	case 130:
-		//line sql.y:725
+	case 310:
+		//line sql.y:1576
 		{
 			yyVAL.byt = AST_UPLUS
 		}
-	case 131:
-		//line sql.y:729
+	case 311:
+		//line sql.y:1580
 		{
 			yyVAL.byt = AST_UMINUS
 		}
-	case 132:
-		//line sql.y:733
+	case 312:
+		//line sql.y:1584
 		{
 			yyVAL.byt = AST_TILDA
 		}
-	case 133:
-		//line sql.y:739
+	case 313:
+		//line sql.y:1590
 		{
 			yyVAL.caseExpr = &CaseExpr{Expr: yyS[yypt-3].valExpr, Whens: yyS[yypt-2].whens, Else: yyS[yypt-1].valExpr}
 		}
-	case 134:
-		//line sql.y:744
+	case 314:
+		//line sql.y:1595
 		{
 			yyVAL.valExpr = nil
 		}
-	case 135:
-		//line sql.y:748
+	case 315:
+		//line sql.y:1599
 		{
 			yyVAL.valExpr = yyS[yypt-0].valExpr
 		}
-	case 136:
-		//line sql.y:754
+	case 316:
+		//line sql.y:1605
 		{
 			yyVAL.whens = []*When{yyS[yypt-0].when}
 		}
-	case 137:
-		//line sql.y:758
+	case 317:
+		//line sql.y:1609
 		{
 			yyVAL.whens = append(yyS[yypt-1].whens, yyS[yypt-0].when)
 		}
-	case 138:
-		//line sql.y:764
+	case 318:
+		//line sql.y:1615
 		{
 			yyVAL.when = &When{Cond: yyS[yypt-2].boolExpr, Val: yyS[yypt-0].valExpr}
 		}
-	case 139:
-		//line sql.y:769
+	case 319:
+		//line sql.y:1620
 		{
 			yyVAL.valExpr = nil
 		}
-	case 140:
-		//line sql.y:773
+	case 320:
+		//line sql.y:1624
 		{
 			yyVAL.valExpr = yyS[yypt-0].valExpr
 		}
-	case 141:
-		//line sql.y:779
+	case 321:
+		//line sql.y:1630
 		{
 			yyVAL.colName = &ColName{Name: yyS[yypt-0].bytes}
 		}
-	case 142:
-		//line sql.y:783
+	case 322:
+		//line sql.y:1634
 		{
 			yyVAL.colName = &ColName{Qualifier: yyS[yypt-2].bytes, Name: yyS[yypt-0].bytes}
 		}
-	case 143:
-		//line sql.y:789
+	case 323:
+		//line sql.y:1640
 		{
 			yyVAL.valExpr = StrVal(yyS[yypt-0].bytes)
 		}
-	case 144:
-		//line sql.y:793
+	case 324:
+		//line sql.y:1644
 		{
 			yyVAL.valExpr = NumVal(yyS[yypt-0].bytes)
 		}
-	case 145:
-		//line sql.y:797
+	case 325:
+		//line sql.y:1648
 		{
 			yyVAL.valExpr = ValArg(yyS[yypt-0].bytes)
 		}
-	case 146:
-		//line sql.y:801
+	case 326:
+		//line sql.y:1652
 		{
 			yyVAL.valExpr = &NullVal{}
 		}
-	case 147:
-		//line sql.y:806
+	case 327:
+		//line sql.y:1657
 		{
 			yyVAL.valExprs = nil
 		}
-	case 148:
-		//line sql.y:810
+	case 328:
+		//line sql.y:1661
 		{
 			yyVAL.valExprs = yyS[yypt-0].valExprs
 		}
-	case 149:
-		//line sql.y:815
+	case 329:
+		//line sql.y:1666
 		{
 			yyVAL.boolExpr = nil
 		}
-	case 150:
-		//line sql.y:819
+	case 330:
+		//line sql.y:1670
 		{
 			yyVAL.boolExpr = yyS[yypt-0].boolExpr
 		}
-	case 151:
-		//line sql.y:824
+	case 331:
+		//line sql.y:1675
 		{
 			yyVAL.orderBy = nil
 		}
-	case 152:
-		//line sql.y:828
+	case 332:
+		//line sql.y:1679
 		{
 			yyVAL.orderBy = yyS[yypt-0].orderBy
 		}
-	case 153:
-		//line sql.y:834
+	case 333:
+		//line sql.y:1685
 		{
 			yyVAL.orderBy = OrderBy{yyS[yypt-0].order}
 		}
-	case 154:
-		//line sql.y:838
+	case 334:
+		//line sql.y:1689
 		{
 			yyVAL.orderBy = append(yyS[yypt-2].orderBy, yyS[yypt-0].order)
 		}
-	case 155:
-		//line sql.y:844
+	case 335:
+		//line sql.y:1695
 		{
 			yyVAL.order = &Order{Expr: yyS[yypt-1].valExpr, Direction: yyS[yypt-0].str}
 		}
-	case 156:
-		//line sql.y:849
+	case 336:
+		//line sql.y:1700
 		{
 			yyVAL.str = AST_ASC
 		}
-	case 157:
-		//line sql.y:853
+	case 337:
+		//line sql.y:1704
 		{
 			yyVAL.str = AST_ASC
 		}
-	case 158:
-		//line sql.y:857
+	case 338:
+		//line sql.y:1708
 		{
 			yyVAL.str = AST_DESC
 		}
-	case 159:
-		//line sql.y:862
+	case 339:
+		//line sql.y:1713
 		{
 			yyVAL.limit = nil
 		}
-	case 160:
-		//line sql.y:866
+	case 340:
+		//line sql.y:1717
 		{
 			yyVAL.limit = &Limit{Rowcount: yyS[yypt-0].valExpr}
 		}
-	case 161:
-		//line sql.y:870
+	case 341:
+		//line sql.y:1721
 		{
 			yyVAL.limit = &Limit{Offset: yyS[yypt-2].valExpr, Rowcount: yyS[yypt-0].valExpr}
 		}
-	case 162:
-		//line sql.y:875
+	case 342:
+		//line sql.y:1726
 		{
 			yyVAL.str = ""
 		}
-	case 163:
-		//line sql.y:879
+	case 343:
+		//line sql.y:1730
 		{
 			yyVAL.str = AST_FOR_UPDATE
 		}
-	case 164:
-		//line sql.y:883
+	case 344:
+		//line sql.y:1734
 		{
 			if !bytes.Equal(yyS[yypt-1].bytes, SHARE) {
 				yylex.Error("expecting share")
@@ -1561,143 +2819,150 @@ yydefault:
 			}
 			yyVAL.str = AST_SHARE_MODE
 		}
-	case 165:
-		//line sql.y:896
-		{
-			yyVAL.columns = nil
-		}
-	case 166:
-		//line sql.y:900
-		{
-			yyVAL.columns = yyS[yypt-1].columns
-		}
-	case 167:
-		//line sql.y:906
+	case 345:
+		//line sql.y:1748
 		{
 			yyVAL.columns = Columns{&NonStarExpr{Expr: yyS[yypt-0].colName}}
 		}
-	case 168:
-		//line sql.y:910
+	case 346:
+		//line sql.y:1752
 		{
 			yyVAL.columns = append(yyVAL.columns, &NonStarExpr{Expr: yyS[yypt-0].colName})
 		}
-	case 169:
-		//line sql.y:915
+	case 347:
+		//line sql.y:1757
 		{
 			yyVAL.updateExprs = nil
 		}
-	case 170:
-		//line sql.y:919
+	case 348:
+		//line sql.y:1761
 		{
 			yyVAL.updateExprs = yyS[yypt-0].updateExprs
 		}
-	case 171:
-		//line sql.y:925
+	case 349:
+		//line sql.y:1767
 		{
 			yyVAL.updateExprs = UpdateExprs{yyS[yypt-0].updateExpr}
 		}
-	case 172:
-		//line sql.y:929
+	case 350:
+		//line sql.y:1771
 		{
 			yyVAL.updateExprs = append(yyS[yypt-2].updateExprs, yyS[yypt-0].updateExpr)
 		}
-	case 173:
-		//line sql.y:935
+	case 351:
+		//line sql.y:1777
 		{
 			yyVAL.updateExpr = &UpdateExpr{Name: yyS[yypt-2].colName, Expr: yyS[yypt-0].valExpr}
 		}
-	case 174:
-		//line sql.y:940
+	case 352:
+		//line sql.y:1783
+		{
+			yyVAL.updateExprs = UpdateExprs{yyS[yypt-0].updateExpr}
+		}
+	case 353:
+		//line sql.y:1787
+		{
+			yyVAL.updateExprs = append(yyS[yypt-2].updateExprs, yyS[yypt-0].updateExpr)
+		}
+	case 354:
+		yyVAL.updateExpr = yyS[yypt-0].updateExpr
+	case 355:
+		//line sql.y:1794
+		{
+			yyVAL.updateExpr = &UpdateExpr{Name: yyS[yypt-2].colName, Expr: StrVal("on")}
+		}
+	case 356:
+		//line sql.y:1799
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 175:
-		//line sql.y:942
+	case 357:
+		//line sql.y:1801
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 176:
-		//line sql.y:945
+	case 358:
+		//line sql.y:1804
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 177:
-		//line sql.y:947
+	case 359:
+		//line sql.y:1806
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 178:
-		//line sql.y:950
+	case 360:
+		//line sql.y:1809
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 179:
-		//line sql.y:952
+	case 361:
+		//line sql.y:1811
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 180:
-		//line sql.y:956
+	case 362:
+		//line sql.y:1815
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 181:
-		//line sql.y:958
+	case 363:
+		//line sql.y:1817
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 182:
-		//line sql.y:960
+	case 364:
+		//line sql.y:1819
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 183:
-		//line sql.y:962
+	case 365:
+		//line sql.y:1821
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 184:
-		//line sql.y:964
+	case 366:
+		//line sql.y:1823
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 185:
-		//line sql.y:967
+	case 367:
+		//line sql.y:1826
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 186:
-		//line sql.y:969
+	case 368:
+		//line sql.y:1828
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 187:
-		//line sql.y:972
+	case 369:
+		//line sql.y:1831
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 188:
-		//line sql.y:974
+	case 370:
+		//line sql.y:1833
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 189:
-		//line sql.y:977
+	case 371:
+		//line sql.y:1836
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 190:
-		//line sql.y:979
+	case 372:
+		//line sql.y:1838
 		{
 			yyVAL.empty = struct{}{}
 		}
-	case 191:
-		//line sql.y:983
+	case 373:
+		//line sql.y:1842
 		{
 			yyVAL.bytes = bytes.ToLower(yyS[yypt-0].bytes)
 		}
-	case 192:
-		//line sql.y:988
+	case 374:
+		//line sql.y:1847
 		{
 			ForceEOF(yylex)
 		}
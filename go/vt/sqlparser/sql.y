@@ -19,11 +19,15 @@ func ForceEOF(yylex interface{}) {
   yylex.(*Tokenizer).ForceEOF = true
 }
 
+
 var (
-  SHARE =        []byte("share")
-  MODE  =        []byte("mode")
-  IF_BYTES =     []byte("if")
-  VALUES_BYTES = []byte("values")
+  SHARE =           []byte("share")
+  MODE  =           []byte("mode")
+  IF_BYTES =        []byte("if")
+  VALUES_BYTES =    []byte("values")
+  CHARACTER_BYTES = []byte("character")
+  WORK =            []byte("work")
+  TEMPORARY_BYTES = []byte("temporary")
 )
 
 %}
@@ -32,6 +36,7 @@ var (
   empty       struct{}
   statement   Statement
   selStmt     SelectStatement
+  sel         *Select
   byt         byte
   bytes       []byte
   bytes2      [][]byte
@@ -61,15 +66,31 @@ var (
   insRows     InsertRows
   updateExprs UpdateExprs
   updateExpr  *UpdateExpr
+  tableNames  []*TableName
+  showFilter  *ShowFilter
+  tableSpec   *TableSpec
+  columnSpec  *columnSpec
+  columnDef   *ColumnDefinition
+  indexDef    *IndexDefinition
+  indexCols   []*IndexColumn
+  indexCol    *IndexColumn
+  tableOpts   []*TableOption
+  tableOpt    *TableOption
+  alterSpecs  AlterSpecs
+  alterSpec   *AlterSpec
 }
 
 %token LEX_ERROR
 %token <empty> SELECT INSERT UPDATE DELETE FROM WHERE GROUP HAVING ORDER BY LIMIT FOR
-%token <empty> ALL DISTINCT AS EXISTS IN IS LIKE BETWEEN NULL ASC DESC VALUES INTO DUPLICATE KEY DEFAULT SET LOCK
+%token <empty> ALL DISTINCT AS EXISTS IN IS LIKE BETWEEN NULL ASC DESC VALUES INTO DUPLICATE DEFAULT SET LOCK
 %token <bytes> ID STRING NUMBER VALUE_ARG COMMENT
 %token <empty> LE GE NE NULL_SAFE_EQUAL
 %token <empty> '(' '=' '<' '>' '~'
 
+// A UNIQUE column attribute followed by KEY is a UNIQUE KEY.
+%nonassoc <empty> LOWER_THAN_KEY
+%nonassoc <empty> KEY
+
 %left <empty> UNION MINUS EXCEPT INTERSECT
 %left <empty> ','
 %left <empty> JOIN STRAIGHT_JOIN LEFT RIGHT INNER OUTER CROSS NATURAL USE FORCE
@@ -84,16 +105,29 @@ var (
 %right <empty> CASE, WHEN, THEN, ELSE
 %left <empty> END
 
+// Savepoint Tokens
+%token <empty> SAVEPOINT ROLLBACK RELEASE
+
 // DDL Tokens
-%token <empty> CREATE ALTER DROP RENAME
+%token <empty> CREATE ALTER DROP RENAME SHOW
 %token <empty> TABLE INDEX VIEW TO IGNORE IF UNIQUE USING
 
+// DDL Spec Tokens, only recognized when the tokenizer parses the
+// definitions of a DDL, after a leading DDL_SPEC.
+%token <empty> DDL_SPEC
+%token <bytes> PRIMARY FULLTEXT SPATIAL CONSTRAINT FOREIGN CHECK REFERENCES
+%token <bytes> ADD COLUMN MODIFY CHANGE FIRST AFTER ALGORITHM
+%token <bytes> UNSIGNED ZEROFILL SIGNED BINARY CHARACTER CHARSET COLLATE
+%token <bytes> AUTO_INCREMENT COMMENT_KEYWORD COLUMN_FORMAT STORAGE KEY_BLOCK_SIZE
+
 %start any_command
 
 %type <statement> command
-%type <selStmt> select_statement
+%type <selStmt> select_statement union_lhs
+%type <sel> base_select
 %type <statement> insert_statement update_statement delete_statement set_statement
 %type <statement> create_statement alter_statement rename_statement drop_statement
+%type <statement> show_statement use_statement savepoint_statement
 %type <bytes2> comment_opt comment_list
 %type <str> union_op
 %type <str> distinct_opt
@@ -131,12 +165,34 @@ var (
 %type <str> asc_desc_opt
 %type <limit> limit_opt
 %type <str> lock_opt
-%type <columns> column_list_opt column_list
+%type <columns> column_list
 %type <updateExprs> on_dup_opt
-%type <updateExprs> update_list
-%type <updateExpr> update_expression
-%type <empty> exists_opt not_exists_opt ignore_opt non_rename_operation to_opt constraint_opt using_opt
+%type <updateExprs> update_list set_list collate_opt
+%type <updateExpr> update_expression set_expression
+%type <bytes> charset_value
+%type <tableNames> show_from_list
+%type <showFilter> show_filter_opt
+%type <empty> work_opt savepoint_opt exists_opt not_exists_opt ignore_opt non_rename_operation to_opt constraint_opt using_opt
 %type <bytes> sql_id
+%type <statement> ddl_spec_statement
+%type <tableSpec> table_spec table_element_list
+%type <columnSpec> column_definition
+%type <columnDef> alter_column_definition
+%type <str> column_type column_type_name column_type_args column_type_arg
+%type <valExpr> default_value
+%type <indexDef> index_definition index_body
+%type <str> index_kind unique_index_kind index_name_opt index_length_opt
+%type <indexCols> index_column_list
+%type <indexCol> index_column
+%type <tableOpts> table_option_list table_options
+%type <tableOpt> table_option
+%type <str> table_option_name table_option_value
+%type <alterSpecs> alter_spec_list alter_spec alter_column_list
+%type <alterSpec> column_position
+%type <bytes> table_id ddl_name
+%type <str> ddl_word
+%type <empty> ddl_constraint_opt index_or_key index_or_key_opt index_using_opt index_option_list
+%type <empty> reference_option_list reference_action default_opt column_opt eq_opt semicolon_opt
 %type <empty> force_eof
 
 %%
@@ -146,6 +202,10 @@ any_command:
   {
     SetParseTree(yylex, $1)
   }
+| DDL_SPEC ddl_spec_statement semicolon_opt
+  {
+    SetParseTree(yylex, $2)
+  }
 
 command:
   select_statement
@@ -160,21 +220,54 @@ command:
 | alter_statement
 | rename_statement
 | drop_statement
+| show_statement
+| use_statement
+| savepoint_statement
 
 select_statement:
+  base_select
+  {
+    $$ = $1
+  }
+| union_lhs union_op base_select
+  {
+    // The ORDER BY and LIMIT of the last select apply to the whole union.
+    union := &Union{Type: $2, Left: $1, Right: $3}
+    if sel := $3; sel.Lock == "" {
+      union.OrderBy, union.Limit = sel.OrderBy, sel.Limit
+      sel.OrderBy, sel.Limit = nil, nil
+    }
+    $$ = union
+  }
+| union_lhs union_op subquery order_by_opt limit_opt
+  {
+    $$ = &Union{Type: $2, Left: $1, Right: &ParenSelect{Select: $3.Select}, OrderBy: $4, Limit: $5}
+  }
+
+base_select:
   SELECT comment_opt distinct_opt select_expression_list FROM table_expression_list where_expression_opt group_by_opt having_opt order_by_opt limit_opt lock_opt
   {
     $$ = &Select{Comments: Comments($2), Distinct: $3, SelectExprs: $4, From: $6, Where: NewWhere(AST_WHERE, $7), GroupBy: GroupBy($8), Having: NewWhere(AST_HAVING, $9), OrderBy: $10, Limit: $11, Lock: $12}
   }
-| select_statement union_op select_statement %prec UNION
+
+union_lhs:
+  select_statement
   {
-    $$ = &Union{Type: $2, Left: $1, Right: $3}
+    $$ = $1
+  }
+| subquery
+  {
+    $$ = &ParenSelect{Select: $1.Select}
   }
 
 insert_statement:
-  INSERT comment_opt INTO dml_table_expression column_list_opt row_list on_dup_opt
+  INSERT comment_opt INTO dml_table_expression row_list on_dup_opt
+  {
+    $$ = &Insert{Comments: Comments($2), Table: $4, Rows: $5, OnDup: OnDup($6)}
+  }
+| INSERT comment_opt INTO dml_table_expression '(' column_list ')' row_list on_dup_opt
   {
-    $$ = &Insert{Comments: Comments($2), Table: $4, Columns: $5, Rows: $6, OnDup: OnDup($7)}
+    $$ = &Insert{Comments: Comments($2), Table: $4, Columns: $6, Rows: $8, OnDup: OnDup($9)}
   }
 | INSERT comment_opt INTO dml_table_expression SET update_list on_dup_opt
   {
@@ -200,16 +293,155 @@ delete_statement:
   }
 
 set_statement:
-  SET comment_opt update_list
+  SET comment_opt set_list
   {
     $$ = &Set{Comments: Comments($2), Exprs: $3}
   }
+| SET comment_opt ID set_list
+  {
+    scope := setScope($3)
+    if scope == "" {
+      yylex.Error("expecting session or global")
+      return 1
+    }
+    $$ = &Set{Comments: Comments($2), Scope: scope, Exprs: $4}
+  }
+| SET comment_opt ID charset_value collate_opt
+  {
+    var name string
+    switch string(bytes.ToLower($3)) {
+    case AST_NAMES:
+      name = AST_NAMES
+    case AST_CHARSET:
+      name = AST_CHARSET
+    default:
+      yylex.Error("expecting names or charset")
+      return 1
+    }
+    charset := &UpdateExpr{Name: &ColName{Name: []byte(name)}, Expr: StrVal($4)}
+    $$ = &Set{Comments: Comments($2), Exprs: append(UpdateExprs{charset}, $5...)}
+  }
+| SET comment_opt ID SET charset_value
+  {
+    if !bytes.Equal(bytes.ToLower($3), CHARACTER_BYTES) {
+      yylex.Error("expecting character")
+      return 1
+    }
+    charset := &UpdateExpr{Name: &ColName{Name: []byte(AST_CHARSET)}, Expr: StrVal($5)}
+    $$ = &Set{Comments: Comments($2), Exprs: UpdateExprs{charset}}
+  }
+
+charset_value:
+  ID
+| STRING
+
+collate_opt:
+  {
+    $$ = nil
+  }
+| ID charset_value
+  {
+    if !bytes.Equal(bytes.ToLower($1), []byte(AST_COLLATE)) {
+      yylex.Error("expecting collate")
+      return 1
+    }
+    $$ = UpdateExprs{&UpdateExpr{Name: &ColName{Name: []byte(AST_COLLATE)}, Expr: StrVal($2)}}
+  }
+
+show_statement:
+  SHOW sql_id show_from_list show_filter_opt
+  {
+    show, err := newShow(nil, $2, $3, $4)
+    if err != nil {
+      yylex.Error(err.Error())
+      return 1
+    }
+    $$ = show
+  }
+| SHOW sql_id sql_id show_from_list show_filter_opt
+  {
+    show, err := newShow($2, $3, $4, $5)
+    if err != nil {
+      yylex.Error(err.Error())
+      return 1
+    }
+    $$ = show
+  }
+
+show_from_list:
+  {
+    $$ = nil
+  }
+| show_from_list FROM dml_table_expression
+  {
+    $$ = append($1, $3)
+  }
+| show_from_list IN dml_table_expression
+  {
+    $$ = append($1, $3)
+  }
+
+show_filter_opt:
+  {
+    $$ = nil
+  }
+| LIKE STRING
+  {
+    $$ = &ShowFilter{Like: $2}
+  }
+| WHERE boolean_expression
+  {
+    $$ = &ShowFilter{Filter: $2}
+  }
+
+use_statement:
+  USE ID
+  {
+    $$ = &Use{DBName: $2}
+  }
+
+savepoint_statement:
+  SAVEPOINT ID
+  {
+    $$ = &Savepoint{Action: AST_SAVEPOINT, Name: $2}
+  }
+| ROLLBACK work_opt TO savepoint_opt ID
+  {
+    $$ = &Savepoint{Action: AST_ROLLBACK_TO, Name: $5}
+  }
+| RELEASE SAVEPOINT ID
+  {
+    $$ = &Savepoint{Action: AST_RELEASE, Name: $3}
+  }
+
+work_opt:
+  {}
+| ID
+  {
+    if !bytes.Equal(bytes.ToLower($1), WORK) {
+      yylex.Error("expecting work")
+      return 1
+    }
+  }
+
+savepoint_opt:
+  {}
+| SAVEPOINT
+  {}
 
 create_statement:
   CREATE TABLE not_exists_opt ID force_eof
   {
     $$ = &DDL{Action: AST_CREATE, NewName: $4}
   }
+| CREATE ID TABLE not_exists_opt ID force_eof
+  {
+    if !bytes.Equal(bytes.ToLower($2), TEMPORARY_BYTES) {
+      yylex.Error("expecting temporary")
+      return 1
+    }
+    $$ = &DDL{Action: AST_CREATE, NewName: $5, Temporary: true}
+  }
 | CREATE constraint_opt INDEX sql_id using_opt ON ID force_eof
   {
     // Change this to an alter statement
@@ -246,6 +478,14 @@ drop_statement:
   {
     $$ = &DDL{Action: AST_DROP, Table: $4}
   }
+| DROP ID TABLE exists_opt ID
+  {
+    if !bytes.Equal(bytes.ToLower($2), TEMPORARY_BYTES) {
+      yylex.Error("expecting temporary")
+      return 1
+    }
+    $$ = &DDL{Action: AST_DROP, Table: $5, Temporary: true}
+  }
 | DROP INDEX sql_id ON ID
   {
     // Change this to an alter statement
@@ -256,6 +496,609 @@ drop_statement:
     $$ = &DDL{Action: AST_DROP, Table: $4}
   }
 
+ddl_spec_statement:
+  CREATE TABLE not_exists_opt table_id table_spec
+  {
+    $$ = &DDL{Action: AST_CREATE, TableSpec: $5}
+  }
+| ALTER ignore_opt TABLE table_id alter_spec_list
+  {
+    $$ = &DDL{Action: AST_ALTER, AlterSpecs: $5}
+  }
+| CREATE index_kind INDEX ddl_name index_using_opt ON table_id '(' index_column_list ')' index_option_list
+  {
+    idx := &IndexDefinition{Name: string($4), Type: $2, Columns: $9}
+    $$ = &DDL{Action: AST_ALTER, AlterSpecs: AlterSpecs{{Action: AST_ADD_INDEX, Index: idx}}}
+  }
+| DROP INDEX ddl_name ON table_id
+  {
+    $$ = &DDL{Action: AST_ALTER, AlterSpecs: AlterSpecs{{Action: AST_DROP_INDEX, Name: string($3)}}}
+  }
+
+table_spec:
+  '(' table_element_list ')' table_option_list
+  {
+    $$ = $2
+    $$.Options = $4
+    $$.nameIndexes()
+  }
+
+table_element_list:
+  column_definition
+  {
+    $$ = &TableSpec{}
+    $$.addColumn($1)
+  }
+| index_definition
+  {
+    $$ = &TableSpec{}
+    $$.addIndexDefinition($1)
+  }
+| table_element_list ',' column_definition
+  {
+    $$ = $1
+    $$.addColumn($3)
+  }
+| table_element_list ',' index_definition
+  {
+    $$ = $1
+    $$.addIndexDefinition($3)
+  }
+
+column_definition:
+  ddl_name column_type
+  {
+    $$ = &columnSpec{column: &ColumnDefinition{Name: string($1), Type: $2}}
+  }
+| column_definition UNSIGNED
+  {
+    $$ = $1
+    $$.column.Type += " unsigned"
+  }
+| column_definition ZEROFILL
+  {
+    $$ = $1
+    $$.column.Type += " zerofill"
+  }
+| column_definition SIGNED
+  {
+    $$ = $1
+  }
+| column_definition BINARY
+  {
+    $$ = $1
+    $$.column.Type += " binary"
+  }
+| column_definition CHARACTER SET ddl_word
+  {
+    $$ = $1
+    $$.column.Charset = $4
+  }
+| column_definition CHARSET ddl_word
+  {
+    $$ = $1
+    $$.column.Charset = $3
+  }
+| column_definition COLLATE ddl_word
+  {
+    $$ = $1
+    $$.column.Collate = $3
+  }
+| column_definition NOT NULL
+  {
+    $$ = $1
+    $$.column.NotNull = true
+  }
+| column_definition NULL
+  {
+    $$ = $1
+    $$.column.NotNull = false
+  }
+| column_definition DEFAULT default_value
+  {
+    $$ = $1
+    $$.column.Default = $3
+  }
+| column_definition ON UPDATE default_value
+  {
+    $$ = $1
+    $$.column.OnUpdate = $4
+  }
+| column_definition AUTO_INCREMENT
+  {
+    $$ = $1
+    $$.column.Autoincrement = true
+  }
+| column_definition COMMENT_KEYWORD STRING
+  {
+    $$ = $1
+    $$.column.Comment = string($3)
+  }
+| column_definition PRIMARY KEY
+  {
+    $$ = $1
+    $$.addIndex(AST_PRIMARY_KEY)
+  }
+| column_definition KEY
+  {
+    $$ = $1
+    $$.addIndex(AST_PRIMARY_KEY)
+  }
+| column_definition UNIQUE %prec LOWER_THAN_KEY
+  {
+    $$ = $1
+    $$.addIndex(AST_UNIQUE_KEY)
+  }
+| column_definition UNIQUE KEY
+  {
+    $$ = $1
+    $$.addIndex(AST_UNIQUE_KEY)
+  }
+| column_definition COLUMN_FORMAT ddl_word
+  {
+    $$ = $1
+  }
+| column_definition STORAGE ddl_word
+  {
+    $$ = $1
+  }
+
+column_type:
+  column_type_name
+  {
+    $$ = $1
+  }
+| column_type_name '(' column_type_args ')'
+  {
+    $$ = $1 + "(" + $3 + ")"
+  }
+
+column_type_name:
+  ID
+  {
+    $$ = string(bytes.ToLower($1))
+  }
+| SET
+  {
+    $$ = "set"
+  }
+| BINARY
+  {
+    $$ = "binary"
+  }
+
+column_type_args:
+  column_type_arg
+  {
+    $$ = $1
+  }
+| column_type_args ',' column_type_arg
+  {
+    $$ = $1 + "," + $3
+  }
+
+column_type_arg:
+  NUMBER
+  {
+    $$ = string($1)
+  }
+| STRING
+  {
+    $$ = String(StrVal($1))
+  }
+
+default_value:
+  STRING
+  {
+    $$ = StrVal($1)
+  }
+| NUMBER
+  {
+    $$ = NumVal($1)
+  }
+| NULL
+  {
+    $$ = &NullVal{}
+  }
+| '-' NUMBER
+  {
+    $$ = append(NumVal("-"), $2...)
+  }
+| '+' NUMBER
+  {
+    $$ = NumVal($2)
+  }
+| ID
+  {
+    // Functions like current_timestamp can go without parentheses.
+    name := bytes.ToLower($1)
+    if timeFuncs[string(name)] {
+      $$ = &FuncExpr{Name: name}
+    } else {
+      $$ = &ColName{Name: name}
+    }
+  }
+| ID '(' ')'
+  {
+    $$ = &FuncExpr{Name: bytes.ToLower($1)}
+  }
+| ID '(' NUMBER ')'
+  {
+    $$ = &FuncExpr{Name: bytes.ToLower($1)}
+  }
+
+index_definition:
+  ddl_constraint_opt index_body
+  {
+    $$ = $2
+  }
+
+ddl_constraint_opt:
+  { $$ = struct{}{} }
+| CONSTRAINT
+  { $$ = struct{}{} }
+| CONSTRAINT ddl_name
+  { $$ = struct{}{} }
+
+index_body:
+  PRIMARY KEY index_using_opt '(' index_column_list ')' index_option_list
+  {
+    $$ = &IndexDefinition{Name: PrimaryKeyName, Type: AST_PRIMARY_KEY, Columns: $5}
+  }
+| unique_index_kind index_or_key_opt index_name_opt index_using_opt '(' index_column_list ')' index_option_list
+  {
+    $$ = &IndexDefinition{Name: $3, Type: $1, Columns: $6}
+  }
+| index_or_key index_name_opt index_using_opt '(' index_column_list ')' index_option_list
+  {
+    $$ = &IndexDefinition{Name: $2, Type: AST_KEY, Columns: $5}
+  }
+| FOREIGN KEY index_name_opt '(' index_column_list ')' REFERENCES table_id '(' index_column_list ')' reference_option_list
+  {
+    // Foreign keys are skipped.
+    $$ = nil
+  }
+| CHECK '(' boolean_expression ')'
+  {
+    // Check constraints are skipped.
+    $$ = nil
+  }
+
+index_kind:
+  {
+    $$ = AST_KEY
+  }
+| unique_index_kind
+  {
+    $$ = $1
+  }
+
+unique_index_kind:
+  UNIQUE
+  {
+    $$ = AST_UNIQUE_KEY
+  }
+| FULLTEXT
+  {
+    $$ = AST_FULLTEXT_KEY
+  }
+| SPATIAL
+  {
+    $$ = AST_SPATIAL_KEY
+  }
+
+index_or_key:
+  INDEX
+  { $$ = struct{}{} }
+| KEY
+  { $$ = struct{}{} }
+
+index_or_key_opt:
+  { $$ = struct{}{} }
+| index_or_key
+  { $$ = struct{}{} }
+
+index_name_opt:
+  {
+    $$ = ""
+  }
+| ddl_name
+  {
+    $$ = string($1)
+  }
+
+index_using_opt:
+  { $$ = struct{}{} }
+| USING ddl_word
+  { $$ = struct{}{} }
+
+index_column_list:
+  index_column
+  {
+    $$ = []*IndexColumn{$1}
+  }
+| index_column_list ',' index_column
+  {
+    $$ = append($1, $3)
+  }
+
+index_column:
+  ddl_name index_length_opt asc_desc_opt
+  {
+    $$ = &IndexColumn{Name: string($1), Length: $2}
+  }
+
+index_length_opt:
+  {
+    $$ = ""
+  }
+| '(' NUMBER ')'
+  {
+    $$ = string($2)
+  }
+
+index_option_list:
+  { $$ = struct{}{} }
+| index_option_list USING ddl_word
+  { $$ = struct{}{} }
+| index_option_list COMMENT_KEYWORD STRING
+  { $$ = struct{}{} }
+| index_option_list KEY_BLOCK_SIZE eq_opt NUMBER
+  { $$ = struct{}{} }
+
+reference_option_list:
+  { $$ = struct{}{} }
+| reference_option_list ON DELETE reference_action
+  { $$ = struct{}{} }
+| reference_option_list ON UPDATE reference_action
+  { $$ = struct{}{} }
+
+reference_action:
+  ID
+  { $$ = struct{}{} }
+| ID ID
+  { $$ = struct{}{} }
+| SET NULL
+  { $$ = struct{}{} }
+| SET DEFAULT
+  { $$ = struct{}{} }
+
+table_option_list:
+  {
+    $$ = nil
+  }
+| table_option_list table_option
+  {
+    $$ = append($1, $2)
+  }
+| table_option_list ',' table_option
+  {
+    $$ = append($1, $3)
+  }
+
+table_options:
+  table_option
+  {
+    $$ = []*TableOption{$1}
+  }
+| table_options table_option
+  {
+    $$ = append($1, $2)
+  }
+
+table_option:
+  default_opt table_option_name eq_opt table_option_value
+  {
+    $$ = &TableOption{Name: $2, Value: $4}
+  }
+
+default_opt:
+  { $$ = struct{}{} }
+| DEFAULT
+  { $$ = struct{}{} }
+
+table_option_name:
+  ID
+  {
+    $$ = string(bytes.ToLower($1))
+    if !tableOptions[$$] {
+      yylex.Error("unknown table option")
+      return 1
+    }
+  }
+| CHARACTER SET
+  {
+    $$ = "charset"
+  }
+| AUTO_INCREMENT
+  {
+    $$ = string($1)
+  }
+| CHARSET
+  {
+    $$ = string($1)
+  }
+| COLLATE
+  {
+    $$ = string($1)
+  }
+| COMMENT_KEYWORD
+  {
+    $$ = string($1)
+  }
+| KEY_BLOCK_SIZE
+  {
+    $$ = string($1)
+  }
+
+table_option_value:
+  STRING
+  {
+    $$ = String(StrVal($1))
+  }
+| NUMBER
+  {
+    $$ = string($1)
+  }
+| ddl_word
+  {
+    $$ = $1
+  }
+
+alter_spec_list:
+  alter_spec
+  {
+    $$ = appendAlterSpecs(nil, $1...)
+  }
+| alter_spec_list ',' alter_spec
+  {
+    $$ = appendAlterSpecs($1, $3...)
+  }
+
+alter_spec:
+  ADD column_opt alter_column_definition column_position
+  {
+    $4.Action, $4.Column = AST_ADD_COLUMN, $3
+    $$ = AlterSpecs{$4}
+  }
+| ADD column_opt '(' alter_column_list ')'
+  {
+    $$ = $4
+  }
+| ADD index_definition
+  {
+    if $2 == nil {
+      yylex.Error("foreign keys and checks are not supported in an alter")
+      return 1
+    }
+    $$ = AlterSpecs{{Action: AST_ADD_INDEX, Index: $2}}
+  }
+| DROP PRIMARY KEY
+  {
+    $$ = AlterSpecs{{Action: AST_DROP_INDEX, Name: PrimaryKeyName}}
+  }
+| DROP index_or_key ddl_name
+  {
+    $$ = AlterSpecs{{Action: AST_DROP_INDEX, Name: string($3)}}
+  }
+| DROP column_opt ddl_name
+  {
+    $$ = AlterSpecs{{Action: AST_DROP_COLUMN, Name: string($3)}}
+  }
+| MODIFY column_opt alter_column_definition column_position
+  {
+    $4.Action, $4.Column = AST_MODIFY_COLUMN, $3
+    $$ = AlterSpecs{$4}
+  }
+| CHANGE column_opt ddl_name alter_column_definition column_position
+  {
+    $5.Action, $5.Column, $5.Name = AST_CHANGE_COLUMN, $4, string($3)
+    $$ = AlterSpecs{$5}
+  }
+| ALGORITHM eq_opt ddl_word
+  {
+    // It only affects how the table is altered.
+    $$ = nil
+  }
+| LOCK eq_opt ddl_word
+  {
+    // It only affects how the table is altered.
+    $$ = nil
+  }
+| table_options
+  {
+    $$ = AlterSpecs{{Action: AST_TABLE_OPTIONS, Options: $1}}
+  }
+
+alter_column_list:
+  alter_column_definition
+  {
+    $$ = AlterSpecs{{Action: AST_ADD_COLUMN, Column: $1}}
+  }
+| alter_column_list ',' alter_column_definition
+  {
+    $$ = append($1, &AlterSpec{Action: AST_ADD_COLUMN, Column: $3})
+  }
+
+alter_column_definition:
+  column_definition
+  {
+    if $1.indexes != nil {
+      yylex.Error("column indexes are not supported in an alter")
+      return 1
+    }
+    $$ = $1.column
+  }
+
+column_position:
+  {
+    $$ = &AlterSpec{}
+  }
+| FIRST
+  {
+    $$ = &AlterSpec{First: true}
+  }
+| AFTER ddl_name
+  {
+    $$ = &AlterSpec{After: string($2)}
+  }
+
+column_opt:
+  { $$ = struct{}{} }
+| COLUMN
+  { $$ = struct{}{} }
+
+eq_opt:
+  { $$ = struct{}{} }
+| '='
+  { $$ = struct{}{} }
+
+semicolon_opt:
+  { $$ = struct{}{} }
+| ';'
+  { $$ = struct{}{} }
+
+table_id:
+  ddl_name
+  {
+    $$ = $1
+  }
+| ddl_name '.' ddl_name
+  {
+    $$ = $3
+  }
+
+// ddl_name is an identifier of a DDL spec. The keywords of the
+// specs that MySQL doesn't reserve can be names too.
+ddl_name:
+  ID
+| COMMENT_KEYWORD
+| FIRST
+| AFTER
+| MODIFY
+| CHARSET
+| ALGORITHM
+| STORAGE
+| COLUMN_FORMAT
+| AUTO_INCREMENT
+| KEY_BLOCK_SIZE
+| SIGNED
+
+// ddl_word is a lower-cased word, like the value of an option.
+ddl_word:
+  ID
+  {
+    $$ = string(bytes.ToLower($1))
+  }
+| BINARY
+  {
+    $$ = "binary"
+  }
+| DEFAULT
+  {
+    $$ = "default"
+  }
+
 comment_opt:
   {
     SetAllowComments(yylex, true)
@@ -284,6 +1127,10 @@ union_op:
   {
     $$ = AST_UNION_ALL
   }
+| UNION DISTINCT
+  {
+    $$ = AST_UNION_DISTINCT
+  }
 | MINUS
   {
     $$ = AST_SET_MINUS
@@ -592,6 +1439,10 @@ row_list:
   {
     $$ = $1
   }
+| subquery
+  {
+    $$ = &ParenSelect{Select: $1.Select}
+  }
 
 tuple_list:
   tuple
@@ -892,15 +1743,6 @@ lock_opt:
     $$ = AST_SHARE_MODE
   }
 
-column_list_opt:
-  {
-    $$ = nil
-  }
-| '(' column_list ')'
-  {
-    $$ = $2
-  }
-
 column_list:
   column_name
   {
@@ -936,6 +1778,23 @@ update_expression:
     $$ = &UpdateExpr{Name: $1, Expr: $3} 
   }
 
+set_list:
+  set_expression
+  {
+    $$ = UpdateExprs{$1}
+  }
+| set_list ',' set_expression
+  {
+    $$ = append($1, $3)
+  }
+
+set_expression:
+  update_expression
+| column_name '=' ON
+  {
+    $$ = &UpdateExpr{Name: $1, Expr: StrVal("on")}
+  }
+
 exists_opt:
   { $$ = struct{}{} }
 | IF EXISTS
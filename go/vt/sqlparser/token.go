@@ -26,6 +26,11 @@ type Tokenizer struct {
 	LastError     string
 	posVarIndex   int
 	ParseTree     Statement
+
+	// ddlSpec makes the tokenizer recognize the keywords of the
+	// definitions of a DDL, after a leading DDL_SPEC.
+	ddlSpec      bool
+	ddlSpecStart bool
 }
 
 // NewStringTokenizer creates a new Tokenizer for the
@@ -104,11 +109,53 @@ var keywords = map[string]int{
 	"if":     IF,
 	"unique": UNIQUE,
 	"using":  USING,
+	"show":   SHOW,
+
+	"savepoint": SAVEPOINT,
+	"rollback":  ROLLBACK,
+	"release":   RELEASE,
+}
+
+// ddlKeywords are the keywords of the definitions of a DDL. They're
+// only keywords when the tokenizer parses them.
+var ddlKeywords = map[string]int{
+	"primary":    PRIMARY,
+	"fulltext":   FULLTEXT,
+	"spatial":    SPATIAL,
+	"constraint": CONSTRAINT,
+	"foreign":    FOREIGN,
+	"check":      CHECK,
+	"references": REFERENCES,
+
+	"add":       ADD,
+	"column":    COLUMN,
+	"modify":    MODIFY,
+	"change":    CHANGE,
+	"first":     FIRST,
+	"after":     AFTER,
+	"algorithm": ALGORITHM,
+
+	"unsigned":       UNSIGNED,
+	"zerofill":       ZEROFILL,
+	"signed":         SIGNED,
+	"binary":         BINARY,
+	"character":      CHARACTER,
+	"charset":        CHARSET,
+	"collate":        COLLATE,
+	"auto_increment": AUTO_INCREMENT,
+	"comment":        COMMENT_KEYWORD,
+	"column_format":  COLUMN_FORMAT,
+	"storage":        STORAGE,
+	"key_block_size": KEY_BLOCK_SIZE,
 }
 
 // Lex returns the next token form the Tokenizer.
 // This function is used by go yacc.
 func (tkn *Tokenizer) Lex(lval *yySymType) int {
+	if tkn.ddlSpecStart {
+		tkn.ddlSpecStart = false
+		return DDL_SPEC
+	}
 	typ, val := tkn.Scan()
 	for typ == COMMENT {
 		if tkn.AllowComments {
@@ -119,6 +166,10 @@ func (tkn *Tokenizer) Lex(lval *yySymType) int {
 	switch typ {
 	case ID, STRING, NUMBER, VALUE_ARG, COMMENT:
 		lval.bytes = val
+	default:
+		if tkn.ddlSpec {
+			lval.bytes = val
+		}
 	}
 	tkn.errorToken = val
 	return typ
@@ -248,6 +299,11 @@ func (tkn *Tokenizer) scanIdentifier() (int, []byte) {
 	if keywordId, found := keywords[string(lowered)]; found {
 		return keywordId, lowered
 	}
+	if tkn.ddlSpec {
+		if keywordId, found := ddlKeywords[string(lowered)]; found {
+			return keywordId, lowered
+		}
+	}
 	return ID, buffer.Bytes()
 }
 
@@ -427,3 +483,62 @@ func digitVal(ch uint16) int {
 func isDigit(ch uint16) bool {
 	return '0' <= ch && ch <= '9'
 }
+
+// Normalize returns sql with its string and number literals
+// replaced by '?', so that queries that only differ by their
+// values are the same. Everything else, including the spacing and
+// the comments, is preserved. If sql can't be tokenized, the rest
+// of it is kept as is.
+func Normalize(sql string) string {
+	normalized, _ := normalize(sql)
+	return normalized
+}
+
+// RedactedSql is what Redact returns for the SQL it can't normalize.
+const RedactedSql = "<redacted: query could not be normalized>"
+
+// Redact is like Normalize, but returns RedactedSql if sql can't be
+// tokenized, so that none of its values are ever returned.
+func Redact(sql string) string {
+	normalized, ok := normalize(sql)
+	if !ok {
+		return RedactedSql
+	}
+	return normalized
+}
+
+// normalize returns the normalized sql, and false if it
+// couldn't be tokenized.
+func normalize(sql string) (string, bool) {
+	tkn := NewStringTokenizer(sql)
+	buf := bytes.NewBuffer(make([]byte, 0, len(sql)))
+	prev := 0
+	tkn.next()
+	for {
+		tkn.skipBlank()
+		// lastChar is at Position-1.
+		start := tkn.Position - 1
+		typ, _ := tkn.Scan()
+		if typ == 0 {
+			break
+		}
+		if typ == LEX_ERROR {
+			buf.WriteString(sql[prev:])
+			return buf.String(), false
+		}
+		end := tkn.Position - 1
+		if end > len(sql) {
+			end = len(sql)
+		}
+		buf.WriteString(sql[prev:start])
+		switch typ {
+		case STRING, NUMBER:
+			buf.WriteByte('?')
+		default:
+			buf.WriteString(sql[start:end])
+		}
+		prev = end
+	}
+	buf.WriteString(sql[prev:])
+	return buf.String(), true
+}
@@ -0,0 +1,49 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tcases := []struct {
+		input, output string
+	}{
+		{
+			"select * from a where id = 2",
+			"select * from a where id = ?",
+		}, {
+			"select * from a where id = :id",
+			"select * from a where id = :id",
+		}, {
+			"select  a1, 'b''c' from t2\n where x in (1.5, \"y\", -3) limit 10",
+			"select  a1, ? from t2\n where x in (?, ?, -?) limit ?",
+		}, {
+			"update a set b = 'it\\'s' /* keep 1 */ where c = .5",
+			"update a set b = ? /* keep 1 */ where c = ?",
+		}, {
+			"select `1` from a where b = 'unterminated",
+			"select `1` from a where b = 'unterminated",
+		}, {
+			"",
+			"",
+		},
+	}
+	for _, tcase := range tcases {
+		if got := Normalize(tcase.input); got != tcase.output {
+			t.Errorf("Normalize(%q): %q, want %q", tcase.input, got, tcase.output)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	if got, want := Redact("select * from a where id = 2"), "select * from a where id = ?"; got != want {
+		t.Errorf("Redact: %q, want %q", got, want)
+	}
+	if got := Redact("select `1` from a where b = 'unterminated"); got != RedactedSql {
+		t.Errorf("Redact(unterminated): %q, want %q", got, RedactedSql)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+// walk.go traverses the AST, so the code that looks for or replaces
+// some nodes doesn't need to know about all the others. The DDL,
+// Savepoint and Use statements, the comments, the index hints and the
+// names of the tables and of the columns are leaves.
+
+import "reflect"
+
+// Visit is the function called by Walk for each node. If it returns
+// false, the children of the node are skipped. If it returns an error,
+// the walk stops.
+type Visit func(node SQLNode) (kontinue bool, err error)
+
+// Walk calls visit for each of nodes and their descendants, parents
+// first. It returns the first error of visit.
+func Walk(visit Visit, nodes ...SQLNode) error {
+	var err error
+	pre := func(c *Cursor) bool {
+		if err != nil {
+			return false
+		}
+		var kontinue bool
+		kontinue, err = visit(c.Node())
+		return kontinue && err == nil
+	}
+	for _, node := range nodes {
+		Rewrite(node, pre, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyFunc is the function called by Rewrite for each node.
+type ApplyFunc func(cursor *Cursor) bool
+
+// Rewrite traverses node and its descendants, calling pre before
+// visiting the children of each node, and post after. If pre returns
+// false, the children of the node and post are skipped. If post
+// returns false, the traversal stops. pre and post can be nil. They
+// can replace the current node with Cursor.Replace: the children of
+// the node that replaced it are then visited. Rewrite returns node,
+// or the node that replaced it.
+func Rewrite(node SQLNode, pre, post ApplyFunc) SQLNode {
+	a := &application{pre: pre, post: post}
+	a.apply(nil, "", -1, node, func(n SQLNode) { node = n })
+	return node
+}
+
+// Cursor describes the node visited by Rewrite, and where it is.
+type Cursor struct {
+	parent   SQLNode
+	name     string
+	index    int
+	node     SQLNode
+	path     []SQLNode
+	replacer func(SQLNode)
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() SQLNode {
+	return c.node
+}
+
+// Parent returns the parent of the current node, nil for the root.
+func (c *Cursor) Parent() SQLNode {
+	return c.parent
+}
+
+// Name returns the name of the field of the parent that holds the
+// current node, like "Where", or "" for the root and for the
+// elements of lists.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index returns the position of the current node in its parent if the
+// parent is a list, -1 otherwise.
+func (c *Cursor) Index() int {
+	return c.index
+}
+
+// Path returns the ancestors of the current node, from the root to
+// its parent. It must not be modified, and is only valid during the
+// calls for the current node.
+func (c *Cursor) Path() []SQLNode {
+	return c.path
+}
+
+// Replace replaces the current node with n in its parent. It panics
+// if the parent can't hold n, like a ValExpr replaced by a TableExpr.
+func (c *Cursor) Replace(n SQLNode) {
+	c.replacer(n)
+	c.node = n
+}
+
+// application is a traversal of Rewrite.
+type application struct {
+	pre, post ApplyFunc
+	path      []SQLNode
+	stopped   bool
+}
+
+func (a *application) apply(parent SQLNode, name string, index int, node SQLNode, replacer func(SQLNode)) {
+	if a.stopped || isNilNode(node) {
+		return
+	}
+	c := &Cursor{parent: parent, name: name, index: index, node: node, path: a.path, replacer: replacer}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+	a.path = append(a.path, c.node)
+	a.applyChildren(c.node)
+	a.path = a.path[:len(a.path)-1]
+	if a.post != nil && !a.post(c) {
+		a.stopped = true
+	}
+}
+
+// isNilNode returns true for the missing optional nodes,
+// like a nil *Where.
+func isNilNode(node SQLNode) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	switch v.Kind() {
+	case reflect.Ptr:
+		return v.IsNil()
+	case reflect.Slice:
+		// StrVal, NumVal and ValArg are values even if empty.
+		return v.IsNil() && v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+func (a *application) applyChildren(node SQLNode) {
+	switch n := node.(type) {
+	case *Select:
+		a.apply(n, "Comments", -1, n.Comments, func(x SQLNode) { n.Comments = x.(Comments) })
+		a.apply(n, "SelectExprs", -1, n.SelectExprs, func(x SQLNode) { n.SelectExprs = x.(SelectExprs) })
+		a.apply(n, "From", -1, n.From, func(x SQLNode) { n.From = x.(TableExprs) })
+		a.apply(n, "Where", -1, n.Where, func(x SQLNode) { n.Where = x.(*Where) })
+		a.apply(n, "GroupBy", -1, n.GroupBy, func(x SQLNode) { n.GroupBy = x.(GroupBy) })
+		a.apply(n, "Having", -1, n.Having, func(x SQLNode) { n.Having = x.(*Where) })
+		a.apply(n, "OrderBy", -1, n.OrderBy, func(x SQLNode) { n.OrderBy = x.(OrderBy) })
+		a.apply(n, "Limit", -1, n.Limit, func(x SQLNode) { n.Limit = x.(*Limit) })
+	case *Union:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(SelectStatement) })
+		a.apply(n, "Right", -1, n.Right, func(x SQLNode) { n.Right = x.(SelectStatement) })
+		a.apply(n, "OrderBy", -1, n.OrderBy, func(x SQLNode) { n.OrderBy = x.(OrderBy) })
+		a.apply(n, "Limit", -1, n.Limit, func(x SQLNode) { n.Limit = x.(*Limit) })
+	case *ParenSelect:
+		a.apply(n, "Select", -1, n.Select, func(x SQLNode) { n.Select = x.(SelectStatement) })
+	case *Insert:
+		a.apply(n, "Comments", -1, n.Comments, func(x SQLNode) { n.Comments = x.(Comments) })
+		a.apply(n, "Table", -1, n.Table, func(x SQLNode) { n.Table = x.(*TableName) })
+		a.apply(n, "Columns", -1, n.Columns, func(x SQLNode) { n.Columns = x.(Columns) })
+		a.apply(n, "Rows", -1, n.Rows, func(x SQLNode) { n.Rows = x.(InsertRows) })
+		a.apply(n, "OnDup", -1, n.OnDup, func(x SQLNode) { n.OnDup = x.(OnDup) })
+	case *Update:
+		a.apply(n, "Comments", -1, n.Comments, func(x SQLNode) { n.Comments = x.(Comments) })
+		a.apply(n, "Table", -1, n.Table, func(x SQLNode) { n.Table = x.(*TableName) })
+		a.apply(n, "Exprs", -1, n.Exprs, func(x SQLNode) { n.Exprs = x.(UpdateExprs) })
+		a.apply(n, "Where", -1, n.Where, func(x SQLNode) { n.Where = x.(*Where) })
+		a.apply(n, "OrderBy", -1, n.OrderBy, func(x SQLNode) { n.OrderBy = x.(OrderBy) })
+		a.apply(n, "Limit", -1, n.Limit, func(x SQLNode) { n.Limit = x.(*Limit) })
+	case *Delete:
+		a.apply(n, "Comments", -1, n.Comments, func(x SQLNode) { n.Comments = x.(Comments) })
+		a.apply(n, "Table", -1, n.Table, func(x SQLNode) { n.Table = x.(*TableName) })
+		a.apply(n, "Where", -1, n.Where, func(x SQLNode) { n.Where = x.(*Where) })
+		a.apply(n, "OrderBy", -1, n.OrderBy, func(x SQLNode) { n.OrderBy = x.(OrderBy) })
+		a.apply(n, "Limit", -1, n.Limit, func(x SQLNode) { n.Limit = x.(*Limit) })
+	case *Set:
+		a.apply(n, "Comments", -1, n.Comments, func(x SQLNode) { n.Comments = x.(Comments) })
+		a.apply(n, "Exprs", -1, n.Exprs, func(x SQLNode) { n.Exprs = x.(UpdateExprs) })
+	case *Show:
+		a.apply(n, "Table", -1, n.Table, func(x SQLNode) { n.Table = x.(*TableName) })
+		a.apply(n, "Filter", -1, n.Filter, func(x SQLNode) { n.Filter = x.(*ShowFilter) })
+	case *ShowFilter:
+		a.apply(n, "Filter", -1, n.Filter, func(x SQLNode) { n.Filter = x.(BoolExpr) })
+	case SelectExprs:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(SelectExpr) })
+		}
+	case Columns:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(SelectExpr) })
+		}
+	case *NonStarExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(Expr) })
+	case TableExprs:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(TableExpr) })
+		}
+	case *AliasedTableExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(SimpleTableExpr) })
+		a.apply(n, "Hints", -1, n.Hints, func(x SQLNode) { n.Hints = x.(*IndexHints) })
+	case *ParenTableExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(TableExpr) })
+	case *JoinTableExpr:
+		a.apply(n, "LeftExpr", -1, n.LeftExpr, func(x SQLNode) { n.LeftExpr = x.(TableExpr) })
+		a.apply(n, "RightExpr", -1, n.RightExpr, func(x SQLNode) { n.RightExpr = x.(TableExpr) })
+		a.apply(n, "On", -1, n.On, func(x SQLNode) { n.On = x.(BoolExpr) })
+	case *Where:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(BoolExpr) })
+	case *AndExpr:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(BoolExpr) })
+		a.apply(n, "Right", -1, n.Right, func(x SQLNode) { n.Right = x.(BoolExpr) })
+	case *OrExpr:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(BoolExpr) })
+		a.apply(n, "Right", -1, n.Right, func(x SQLNode) { n.Right = x.(BoolExpr) })
+	case *NotExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(BoolExpr) })
+	case *ParenBoolExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(BoolExpr) })
+	case *ComparisonExpr:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(ValExpr) })
+		a.apply(n, "Right", -1, n.Right, func(x SQLNode) { n.Right = x.(ValExpr) })
+	case *RangeCond:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(ValExpr) })
+		a.apply(n, "From", -1, n.From, func(x SQLNode) { n.From = x.(ValExpr) })
+		a.apply(n, "To", -1, n.To, func(x SQLNode) { n.To = x.(ValExpr) })
+	case *NullCheck:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(ValExpr) })
+	case *ExistsExpr:
+		a.apply(n, "Subquery", -1, n.Subquery, func(x SQLNode) { n.Subquery = x.(*Subquery) })
+	case ValTuple:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(ValExpr) })
+		}
+	case ValExprs:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(ValExpr) })
+		}
+	case *Subquery:
+		a.apply(n, "Select", -1, n.Select, func(x SQLNode) { n.Select = x.(SelectStatement) })
+	case *BinaryExpr:
+		a.apply(n, "Left", -1, n.Left, func(x SQLNode) { n.Left = x.(Expr) })
+		a.apply(n, "Right", -1, n.Right, func(x SQLNode) { n.Right = x.(Expr) })
+	case *UnaryExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(Expr) })
+	case *FuncExpr:
+		a.apply(n, "Exprs", -1, n.Exprs, func(x SQLNode) { n.Exprs = x.(SelectExprs) })
+	case *CaseExpr:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(ValExpr) })
+		for i := range n.Whens {
+			i := i
+			a.apply(n, "Whens", i, n.Whens[i], func(x SQLNode) { n.Whens[i] = x.(*When) })
+		}
+		a.apply(n, "Else", -1, n.Else, func(x SQLNode) { n.Else = x.(ValExpr) })
+	case *When:
+		a.apply(n, "Cond", -1, n.Cond, func(x SQLNode) { n.Cond = x.(BoolExpr) })
+		a.apply(n, "Val", -1, n.Val, func(x SQLNode) { n.Val = x.(ValExpr) })
+	case Values:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(Tuple) })
+		}
+	case GroupBy:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(ValExpr) })
+		}
+	case OrderBy:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(*Order) })
+		}
+	case *Order:
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(ValExpr) })
+	case *Limit:
+		a.apply(n, "Offset", -1, n.Offset, func(x SQLNode) { n.Offset = x.(ValExpr) })
+		a.apply(n, "Rowcount", -1, n.Rowcount, func(x SQLNode) { n.Rowcount = x.(ValExpr) })
+	case UpdateExprs:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(*UpdateExpr) })
+		}
+	case OnDup:
+		for i := range n {
+			i := i
+			a.apply(n, "", i, n[i], func(x SQLNode) { n[i] = x.(*UpdateExpr) })
+		}
+	case *UpdateExpr:
+		a.apply(n, "Name", -1, n.Name, func(x SQLNode) { n.Name = x.(*ColName) })
+		a.apply(n, "Expr", -1, n.Expr, func(x SQLNode) { n.Expr = x.(ValExpr) })
+	}
+}
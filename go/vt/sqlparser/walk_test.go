@@ -0,0 +1,126 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlparser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	stmt, err := Parse("select a, count(*) from t join u on t.id = u.id where b in (select c from v) and d = 1 order by e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var columns []string
+	visit := func(node SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *ColName:
+			columns = append(columns, String(node))
+		case *Subquery:
+			// The columns of the subquery are skipped.
+			return false, nil
+		}
+		return true, nil
+	}
+	if err := Walk(visit, stmt); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if got, want := strings.Join(columns, " "), "a t.id u.id b d e"; got != want {
+		t.Errorf("Walk columns: %v, want %v", got, want)
+	}
+
+	columns = nil
+	visit = func(node SQLNode) (bool, error) {
+		if col, ok := node.(*ColName); ok {
+			if string(col.Name) == "b" {
+				return false, errors.New("column b")
+			}
+			columns = append(columns, String(col))
+		}
+		return true, nil
+	}
+	if err := Walk(visit, stmt); err == nil || err.Error() != "column b" {
+		t.Errorf("Walk: %v, want column b", err)
+	}
+	if got, want := strings.Join(columns, " "), "a t.id u.id"; got != want {
+		t.Errorf("Walk columns before the error: %v, want %v", got, want)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	stmt, err := Parse("select a from t where b = :b and c in (select d from u) limit :n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Qualify the tables, and replace the bind variables of the
+	// outer query.
+	var paths []string
+	pre := func(c *Cursor) bool {
+		switch node := c.Node().(type) {
+		case *TableName:
+			node.Qualifier = []byte("ks")
+		case ValArg:
+			var names []string
+			for _, parent := range c.Path() {
+				names = append(names, fmt.Sprintf("%T", parent))
+			}
+			paths = append(paths, fmt.Sprintf("%s %s.%s", node, strings.Join(names, "/"), c.Name()))
+			c.Replace(NumVal("1"))
+		}
+		return true
+	}
+	if got := Rewrite(stmt, pre, nil); got != stmt {
+		t.Errorf("Rewrite: %v, want the statement", got)
+	}
+	if got, want := String(stmt), "select a from ks.t where b = 1 and c in (select d from ks.u) limit 1"; got != want {
+		t.Errorf("Rewrite:\n%v, want\n%v", got, want)
+	}
+	want := []string{
+		":b *sqlparser.Select/*sqlparser.Where/*sqlparser.AndExpr/*sqlparser.ComparisonExpr.Right",
+		":n *sqlparser.Select/*sqlparser.Limit.Rowcount",
+	}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("Rewrite paths:\n%v, want\n%v", paths, want)
+	}
+
+	// Replace the root, and the elements of a list.
+	post := func(c *Cursor) bool {
+		switch node := c.Node().(type) {
+		case *NonStarExpr:
+			if c.Index() != 0 {
+				t.Errorf("Rewrite index of %v: %v, want 0", String(node), c.Index())
+			}
+			if _, ok := c.Parent().(SelectExprs); !ok {
+				t.Errorf("Rewrite parent of %v: %T, want SelectExprs", String(node), c.Parent())
+			}
+			c.Replace(&StarExpr{})
+		case *Select:
+			if c.Parent() == nil {
+				c.Replace(&ParenSelect{Select: node})
+			}
+		}
+		return true
+	}
+	if got, want := String(Rewrite(stmt, nil, post)), "(select * from ks.t where b = 1 and c in (select * from ks.u) limit 1)"; got != want {
+		t.Errorf("Rewrite:\n%v, want\n%v", got, want)
+	}
+
+	// Stop at the first column.
+	var columns []string
+	post = func(c *Cursor) bool {
+		if col, ok := c.Node().(*ColName); ok {
+			columns = append(columns, String(col))
+			return false
+		}
+		return true
+	}
+	Rewrite(stmt, nil, post)
+	if got, want := strings.Join(columns, " "), "b"; got != want {
+		t.Errorf("Rewrite columns: %v, want %v", got, want)
+	}
+}
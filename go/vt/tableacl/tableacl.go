@@ -7,6 +7,7 @@ import (
 	"log"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // ACL is an interface for Access Control List
@@ -15,7 +16,12 @@ type ACL interface {
 	IsMember(principal string) bool
 }
 
-var tableAcl map[*regexp.Regexp]map[Role]ACL
+var (
+	// mu protects tableAcl and aclConfigFile
+	mu            sync.RWMutex
+	tableAcl      map[*regexp.Regexp]map[Role]ACL
+	aclConfigFile string
+)
 
 // Init initiates table ACLs
 func Init(configFile string) {
@@ -23,10 +29,39 @@ func Init(configFile string) {
 	if err != nil {
 		log.Fatalf("unable to read tableACL config file: %v", err)
 	}
-	tableAcl, err = load(config)
+	acl, err := load(config)
 	if err != nil {
 		log.Fatalf("tableACL initialization error: %v", err)
 	}
+	mu.Lock()
+	defer mu.Unlock()
+	tableAcl = acl
+	aclConfigFile = configFile
+}
+
+// Reload reads the config file passed to Init again, and replaces
+// the table ACLs with its contents. The current ACLs are kept if
+// the file cannot be read or parsed.
+func Reload() error {
+	mu.RLock()
+	configFile := aclConfigFile
+	mu.RUnlock()
+	if configFile == "" {
+		return fmt.Errorf("tableACL was not initialized from a config file")
+	}
+	config, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("unable to read tableACL config file: %v", err)
+	}
+	acl, err := load(config)
+	if err != nil {
+		return fmt.Errorf("tableACL reload error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	tableAcl = acl
+	log.Printf("tableACL reloaded from %v", configFile)
+	return nil
 }
 
 // load loads configurations from a JSON byte array
@@ -79,6 +114,8 @@ func load(config []byte) (map[*regexp.Regexp]map[Role]ACL, error) {
 // Authorized returns the list of entities who have at least the
 // minimum specified Role on a table
 func Authorized(table string, minRole Role) ACL {
+	mu.RLock()
+	defer mu.RUnlock()
 	if tableAcl == nil {
 		// No ACLs, allow all access
 		return all()
@@ -5,6 +5,8 @@
 package tableacl
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/youtube/vitess/go/vt/context"
@@ -71,6 +73,42 @@ func TestAllUserWriteAccess(t *testing.T) {
 	checkAccess(configData, "table1", WRITER, t, true)
 }
 
+func TestReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "tableacl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	writeConfig := func(config string) {
+		if err := ioutil.WriteFile(f.Name(), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"table[0-9]+":{"Reader":"u1"}}`)
+	Init(f.Name())
+	if Authorized("table1", READER).IsMember(currentUser()) {
+		t.Errorf("want no access before reload")
+	}
+
+	writeConfig(`{"table[0-9]+":{"Reader":"` + currentUser() + `"}}`)
+	if err := Reload(); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	if !Authorized("table1", READER).IsMember(currentUser()) {
+		t.Errorf("want access after reload")
+	}
+
+	// An invalid config must not replace the current one.
+	writeConfig(`{"table(1":{"READER":"u1"}}`)
+	if err := Reload(); err == nil {
+		t.Errorf("want reload error, got none")
+	}
+	if !Authorized("table1", READER).IsMember(currentUser()) {
+		t.Errorf("want access after failed reload")
+	}
+}
+
 func checkLoad(configData []byte, valid bool, t *testing.T) {
 	var err error
 	tableAcl, err = load(configData)
@@ -38,6 +38,7 @@ const (
 	TABLET_ACTION_SET_RDWR               = "SetReadWrite"
 	TABLET_ACTION_CHANGE_TYPE            = "ChangeType"
 	TABLET_ACTION_SET_BLACKLISTED_TABLES = "SetBlacklistedTables"
+	TABLET_ACTION_SET_QUERY_RULES        = "SetQueryRules"
 
 	TABLET_ACTION_DEMOTE_MASTER = "DemoteMaster"
 	TABLET_ACTION_PROMOTE_SLAVE = "PromoteSlave"
@@ -149,6 +150,13 @@ type ActionNode struct {
 	State      ActionState
 	Pid        int // only != 0 if State == ACTION_STATE_RUNNING
 
+	// HostName, UserName and Time tell who started the action, and
+	// when. For the keyspace and shard actions, they describe the
+	// holder of the lock.
+	HostName string
+	UserName string
+	Time     time.Time
+
 	// do not serialize the next fields
 	// path in topology server representing this action
 	Path  string      `json:"-"`
@@ -241,7 +249,8 @@ func ActionNodeFromJson(data, path string) (*ActionNode, error) {
 
 	case SRV_SHARD_ACTION_REBUILD:
 
-	case TABLET_ACTION_SET_BLACKLISTED_TABLES, TABLET_ACTION_GET_SCHEMA,
+	case TABLET_ACTION_SET_BLACKLISTED_TABLES, TABLET_ACTION_SET_QUERY_RULES,
+		TABLET_ACTION_GET_SCHEMA,
 		TABLET_ACTION_RELOAD_SCHEMA, TABLET_ACTION_EXECUTE_FETCH,
 		TABLET_ACTION_GET_PERMISSIONS,
 		TABLET_ACTION_SLAVE_POSITION, TABLET_ACTION_WAIT_SLAVE_POSITION,
@@ -297,10 +306,12 @@ func (n *ActionNode) ToJson() string {
 	return result
 }
 
-// SetGuid will set the ActionGuid field for the action node
-// and return the action node.
+// SetGuid will set the ActionGuid field for the action node, with
+// the HostName, UserName and Time it is made of, and return the
+// action node.
 func (n *ActionNode) SetGuid() *ActionNode {
-	now := time.Now().Format(time.RFC3339)
+	n.Time = time.Now()
+	now := n.Time.Format(time.RFC3339)
 	username := "unknown"
 	if u, err := user.Current(); err == nil {
 		username = u.Username
@@ -310,6 +321,8 @@ func (n *ActionNode) SetGuid() *ActionNode {
 		hostname = h
 	}
 	n.ActionGuid = fmt.Sprintf("%v-%v-%v", now, username, hostname)
+	n.HostName = hostname
+	n.UserName = username
 	return n
 }
 
@@ -8,6 +8,7 @@ package actionnode
 // topology server.
 
 import (
+	"fmt"
 	"time"
 
 	log "github.com/golang/glog"
@@ -24,7 +25,12 @@ var (
 // UnlockKeyspace should be called if this returns no error.
 func (n *ActionNode) LockKeyspace(ts topo.Server, keyspace string, lockTimeout time.Duration, interrupted chan struct{}) (lockPath string, err error) {
 	log.Infof("Locking keyspace %v for action %v", keyspace, n.Action)
-	return ts.LockKeyspaceForAction(keyspace, n.ToJson(), lockTimeout, interrupted)
+	lockPath, err = ts.LockKeyspaceForAction(keyspace, n.ToJson(), lockTimeout, interrupted)
+	if err == topo.ErrTimeout {
+		holder, _ := ReadKeyspaceLock(ts, keyspace)
+		err = &LockContentionError{What: "keyspace " + keyspace, Holder: holder}
+	}
+	return lockPath, err
 }
 
 // UnlockKeyspace unlocks a previously locked keyspace.
@@ -54,7 +60,12 @@ func (n *ActionNode) UnlockKeyspace(ts topo.Server, keyspace string, lockPath st
 // UnlockShard should be called if this returns no error.
 func (n *ActionNode) LockShard(ts topo.Server, keyspace, shard string, lockTimeout time.Duration, interrupted chan struct{}) (lockPath string, err error) {
 	log.Infof("Locking shard %v/%v for action %v", keyspace, shard, n.Action)
-	return ts.LockShardForAction(keyspace, shard, n.ToJson(), lockTimeout, interrupted)
+	lockPath, err = ts.LockShardForAction(keyspace, shard, n.ToJson(), lockTimeout, interrupted)
+	if err == topo.ErrTimeout {
+		holder, _ := ReadShardLock(ts, keyspace, shard)
+		err = &LockContentionError{What: "shard " + keyspace + "/" + shard, Holder: holder}
+	}
+	return lockPath, err
 }
 
 // UnlockShard unlocks a previously locked shard.
@@ -109,3 +120,124 @@ func (n *ActionNode) UnlockSrvShard(ts topo.Server, cell, keyspace, shard string
 	}
 	return err
 }
+
+// ActionLock describes the action lock held on a keyspace or shard.
+type ActionLock struct {
+	// LockPath is what UnlockKeyspaceForAction and
+	// UnlockShardForAction need to release the lock
+	LockPath string
+
+	// Contents is the raw contents of the lock, and Node the
+	// ActionNode decoded from it, nil if it can't be decoded
+	Contents string
+	Node     *ActionNode
+}
+
+func newActionLock(lockPath, contents string) *ActionLock {
+	node, err := ActionNodeFromJson(contents, lockPath)
+	if err != nil {
+		log.Warningf("bad action lock data: %v %#v", err, contents)
+		node = nil
+	}
+	return &ActionLock{LockPath: lockPath, Contents: contents, Node: node}
+}
+
+// Age returns how long the lock has been held, or 0 if it is unknown.
+func (l *ActionLock) Age() time.Duration {
+	if l.Node == nil || l.Node.Time.IsZero() {
+		return 0
+	}
+	return time.Now().Sub(l.Node.Time)
+}
+
+// String describes the holder of the lock.
+func (l *ActionLock) String() string {
+	if l.Node == nil {
+		return fmt.Sprintf("unknown action (lock path %v): %v", l.LockPath, l.Contents)
+	}
+	if l.Node.Time.IsZero() {
+		return fmt.Sprintf("action %v (guid %v, lock path %v)", l.Node.Action, l.Node.ActionGuid, l.LockPath)
+	}
+	return fmt.Sprintf("action %v by %v@%v since %v (%v ago, lock path %v)", l.Node.Action, l.Node.UserName, l.Node.HostName, l.Node.Time.Format(time.RFC3339), l.Age()/time.Second*time.Second, l.LockPath)
+}
+
+// LockContentionError is returned by LockKeyspace and LockShard when
+// the lock timeout expires while another action holds the lock.
+type LockContentionError struct {
+	// What is the locked object, like "shard ks/-80"
+	What string
+
+	// Holder is the lock that was held, nil if it was released
+	// in the meantime or can't be read
+	Holder *ActionLock
+}
+
+func (e *LockContentionError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("cannot lock %v: %v", e.What, topo.ErrTimeout)
+	}
+	return fmt.Sprintf("cannot lock %v: %v, held by %v", e.What, topo.ErrTimeout, e.Holder)
+}
+
+// lockReader returns the topo.ActionLockReader of ts.
+func lockReader(ts topo.Server) (topo.ActionLockReader, error) {
+	reader, ok := ts.(topo.ActionLockReader)
+	if !ok {
+		return nil, fmt.Errorf("the topology server %T cannot read the action locks", ts)
+	}
+	return reader, nil
+}
+
+// ReadKeyspaceLock returns the lock held on the keyspace, or
+// topo.ErrNoNode if it isn't locked.
+func ReadKeyspaceLock(ts topo.Server, keyspace string) (*ActionLock, error) {
+	reader, err := lockReader(ts)
+	if err != nil {
+		return nil, err
+	}
+	lockPath, contents, err := reader.GetKeyspaceActionLock(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	return newActionLock(lockPath, contents), nil
+}
+
+// ReadShardLock returns the lock held on the shard, or topo.ErrNoNode
+// if it isn't locked.
+func ReadShardLock(ts topo.Server, keyspace, shard string) (*ActionLock, error) {
+	reader, err := lockReader(ts)
+	if err != nil {
+		return nil, err
+	}
+	lockPath, contents, err := reader.GetShardActionLock(keyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	return newActionLock(lockPath, contents), nil
+}
+
+// forceUnlockResults returns the results stored when a lock is
+// forcibly released.
+func forceUnlockResults(l *ActionLock, reason string) string {
+	n := l.Node
+	if n == nil {
+		n = &ActionNode{}
+	}
+	n.Error = "action lock forcibly released: " + reason
+	n.State = ACTION_STATE_FAILED
+	return n.ToJson()
+}
+
+// ForceUnlockKeyspace releases a lock held on the keyspace, as read
+// by ReadKeyspaceLock. The holder of the lock will fail to release it.
+func ForceUnlockKeyspace(ts topo.Server, keyspace string, l *ActionLock, reason string) error {
+	log.Warningf("Forcibly unlocking keyspace %v, held by %v: %v", keyspace, l, reason)
+	return ts.UnlockKeyspaceForAction(keyspace, l.LockPath, forceUnlockResults(l, reason))
+}
+
+// ForceUnlockShard releases a lock held on the shard, as read by
+// ReadShardLock. The holder of the lock will fail to release it.
+func ForceUnlockShard(ts topo.Server, keyspace, shard string, l *ActionLock, reason string) error {
+	log.Warningf("Forcibly unlocking shard %v/%v, held by %v: %v", keyspace, shard, l, reason)
+	return ts.UnlockShardForAction(keyspace, shard, l.LockPath, forceUnlockResults(l, reason))
+}
@@ -0,0 +1,74 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actionnode
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/memorytopo"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestShardLockContention(t *testing.T) {
+	ts := memorytopo.NewServer([]string{"test"})
+	if err := ts.CreateKeyspace("test_keyspace", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+
+	if _, err := ReadShardLock(ts, "test_keyspace", "0"); err != topo.ErrNoNode {
+		t.Fatalf("ReadShardLock(not locked): %v", err)
+	}
+
+	holder := RebuildShard()
+	lockPath, err := holder.LockShard(ts, "test_keyspace", "0", DefaultLockTimeout, nil)
+	if err != nil {
+		t.Fatalf("LockShard: %v", err)
+	}
+
+	// another action times out, and is told who holds the lock
+	_, err = CheckShard().LockShard(ts, "test_keyspace", "0", time.Second/10, nil)
+	lce, ok := err.(*LockContentionError)
+	if !ok {
+		t.Fatalf("LockShard(again): want a LockContentionError, got %v", err)
+	}
+	if lce.Holder == nil || lce.Holder.Node == nil || lce.Holder.Node.Action != SHARD_ACTION_REBUILD || lce.Holder.Node.ActionGuid != holder.ActionGuid {
+		t.Errorf("LockShard(again): bad holder %v", lce.Holder)
+	}
+	if !strings.Contains(err.Error(), SHARD_ACTION_REBUILD) {
+		t.Errorf("LockShard(again): the error doesn't name the holder: %v", err)
+	}
+
+	// force the lock out
+	l, err := ReadShardLock(ts, "test_keyspace", "0")
+	if err != nil {
+		t.Fatalf("ReadShardLock: %v", err)
+	}
+	if l.LockPath != lockPath || l.Node.UserName != holder.UserName || l.Node.HostName != holder.HostName {
+		t.Errorf("ReadShardLock: bad lock %v", l)
+	}
+	if err := ForceUnlockShard(ts, "test_keyspace", "0", l, "test"); err != nil {
+		t.Fatalf("ForceUnlockShard: %v", err)
+	}
+	if _, err := ReadShardLock(ts, "test_keyspace", "0"); err != topo.ErrNoNode {
+		t.Errorf("ReadShardLock(forced): %v", err)
+	}
+
+	// the holder can't release it anymore, and the lock can be taken
+	if err := holder.UnlockShard(ts, "test_keyspace", "0", lockPath, nil); err == nil {
+		t.Errorf("UnlockShard(forced) worked")
+	}
+	n := CheckShard()
+	if lockPath, err = n.LockShard(ts, "test_keyspace", "0", time.Second, nil); err != nil {
+		t.Fatalf("LockShard(forced): %v", err)
+	}
+	if err := n.UnlockShard(ts, "test_keyspace", "0", lockPath, nil); err != nil {
+		t.Errorf("UnlockShard: %v", err)
+	}
+}
@@ -215,6 +215,7 @@ func (ta *TabletActor) dispatchAction(actionNode *actionnode.ActionNode) (err er
 		err = ta.snapshotSourceEnd(actionNode)
 
 	case actionnode.TABLET_ACTION_SET_BLACKLISTED_TABLES,
+		actionnode.TABLET_ACTION_SET_QUERY_RULES,
 		actionnode.TABLET_ACTION_GET_SCHEMA,
 		actionnode.TABLET_ACTION_RELOAD_SCHEMA,
 		actionnode.TABLET_ACTION_GET_PERMISSIONS,
@@ -310,7 +311,7 @@ func (ta *TabletActor) promoteSlave(actionNode *actionnode.ActionNode) error {
 
 	// Perform the action.
 	rsd := &actionnode.RestartSlaveData{Parent: tablet.Alias, Force: (tablet.Parent.Uid == topo.NO_TABLET)}
-	rsd.ReplicationState, rsd.WaitPosition, rsd.TimePromoted, err = ta.mysqld.PromoteSlave(false, ta.hookExtraEnv())
+	rsd.ReplicationState, rsd.WaitPosition, rsd.TimePromoted, err = ta.mysqld.PromoteSlaveForReparent(false, ta.hookExtraEnv())
 	if err != nil {
 		return err
 	}
@@ -870,6 +871,18 @@ func SetBlacklistedTables(ts topo.Server, tabletAlias topo.TabletAlias, tables [
 	return topo.UpdateTablet(ts, tablet)
 }
 
+// SetQueryRules stores the dynamic query rules in the tablet record.
+// The query service picks them up through the change callback.
+func SetQueryRules(ts topo.Server, tabletAlias topo.TabletAlias, rules string) error {
+	tablet, err := ts.GetTablet(tabletAlias)
+	if err != nil {
+		return err
+	}
+
+	tablet.QueryRules = rules
+	return topo.UpdateTablet(ts, tablet)
+}
+
 // ChecktabletMysqlPort will check the mysql port for the tablet is good,
 // and if not will try to update it
 func CheckTabletMysqlPort(ts topo.Server, mysqlDaemon mysqlctl.MysqlDaemon, tablet *topo.TabletInfo) *topo.TabletInfo {
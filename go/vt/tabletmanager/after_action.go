@@ -109,6 +109,20 @@ func (agent *ActionAgent) createQueryRules(tablet *topo.Tablet) (qrs *tabletserv
 	return qrs, nil
 }
 
+// setQueryRules parses the JSON query rules from the tablet record and
+// installs them in the query service. Invalid rules are logged and
+// the previous ones are kept.
+func (agent *ActionAgent) setQueryRules(rules string) {
+	qrs := tabletserver.NewQueryRules()
+	if rules != "" {
+		if err := qrs.UnmarshalJSON([]byte(rules)); err != nil {
+			log.Errorf("Cannot parse query rules from the tablet record: %v", err)
+			return
+		}
+	}
+	tabletserver.SetDynamicQueryRules(tabletserver.QR_SOURCE_TOPO, qrs)
+}
+
 func (agent *ActionAgent) disallowQueries() {
 	tabletserver.DisallowQueries()
 }
@@ -121,9 +135,10 @@ func (agent *ActionAgent) changeCallback(oldTablet, newTablet topo.Tablet) {
 	var shardInfo *topo.ShardInfo
 	var keyspaceInfo *topo.KeyspaceInfo
 	if newTablet.Type == topo.TYPE_MASTER {
-		// read the shard to get SourceShards
+		// read the shard to get SourceShards, from its copy
+		// in our cell if the global topology is not available
 		var err error
-		shardInfo, err = agent.TopoServer.GetShard(newTablet.Keyspace, newTablet.Shard)
+		shardInfo, _, err = topo.GetShardOrCopy(agent.TopoServer, newTablet.Alias.Cell, newTablet.Keyspace, newTablet.Shard)
 		if err != nil {
 			log.Errorf("Cannot read shard for this tablet %v: %v", newTablet.Alias, err)
 		} else {
@@ -131,7 +146,7 @@ func (agent *ActionAgent) changeCallback(oldTablet, newTablet topo.Tablet) {
 		}
 
 		// read the keyspace to get ShardingColumnType
-		keyspaceInfo, err = agent.TopoServer.GetKeyspace(newTablet.Keyspace)
+		keyspaceInfo, _, err = topo.GetKeyspaceOrCopy(agent.TopoServer, newTablet.Alias.Cell, newTablet.Keyspace)
 		switch err {
 		case nil:
 			// continue
@@ -173,6 +188,15 @@ func (agent *ActionAgent) changeCallback(oldTablet, newTablet topo.Tablet) {
 		binlog.DisableUpdateStreamService()
 	}
 
+	// The dynamic query rules don't need a restart of the query service.
+	if newTablet.QueryRules != oldTablet.QueryRules {
+		agent.setQueryRules(newTablet.QueryRules)
+	}
+
+	if newTablet.Type != oldTablet.Type {
+		fixSemiSync(agent.Mysqld, newTablet.Type)
+	}
+
 	statsType.Set(string(newTablet.Type))
 	statsKeyspace.Set(newTablet.Keyspace)
 	statsShard.Set(newTablet.Shard)
@@ -142,6 +142,7 @@ func NewActionAgent(
 	// Start the binlog player services, not playing at start.
 	agent.BinlogPlayerMap = NewBinlogPlayerMap(topoServer, &dbcfgs.Filtered, mysqld)
 	RegisterBinlogPlayerMap(agent.BinlogPlayerMap)
+	registerSemiSyncStats(mysqld)
 
 	// try to figure out the mysql port
 	mysqlPort := mycnf.MysqlPort
@@ -161,9 +162,24 @@ func NewActionAgent(
 	// register the RPC services from the agent
 	agent.registerQueryService()
 
+	// restore from backup in the background if needed
+	if *restoreFromBackup {
+		go func() {
+			if err := agent.RestoreFromBackup(); err != nil {
+				log.Errorf("RestoreFromBackup failed: %v", err)
+			}
+		}()
+	}
+
 	// start health check if needed
 	agent.initHeathCheck()
 
+	// start the replication heartbeat if needed
+	agent.initHeartbeat()
+
+	// serve the online schema changes
+	agent.initOnlineDDL()
+
 	return agent, nil
 }
 
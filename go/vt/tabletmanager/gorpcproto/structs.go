@@ -37,6 +37,10 @@ type SetBlacklistedTablesArgs struct {
 	Tables []string
 }
 
+type SetQueryRulesArgs struct {
+	Rules string
+}
+
 type WaitSlavePositionArgs struct {
 	ReplicationPosition myproto.ReplicationPosition
 	WaitTimeout         time.Duration // pass in zero to wait indefinitely
@@ -101,6 +101,11 @@ func (client *GoRpcTabletManagerConn) SetBlacklistedTables(tablet *topo.TabletIn
 	return client.rpcCallTablet(tablet, actionnode.TABLET_ACTION_SET_BLACKLISTED_TABLES, &gorpcproto.SetBlacklistedTablesArgs{Tables: tables}, &noOutput, waitTime)
 }
 
+func (client *GoRpcTabletManagerConn) SetQueryRules(tablet *topo.TabletInfo, rules string, waitTime time.Duration) error {
+	var noOutput rpc.UnusedResponse
+	return client.rpcCallTablet(tablet, actionnode.TABLET_ACTION_SET_QUERY_RULES, &gorpcproto.SetQueryRulesArgs{Rules: rules}, &noOutput, waitTime)
+}
+
 func (client *GoRpcTabletManagerConn) ReloadSchema(tablet *topo.TabletInfo, waitTime time.Duration) error {
 	var noOutput rpc.UnusedResponse
 	return client.rpcCallTablet(tablet, actionnode.TABLET_ACTION_RELOAD_SCHEMA, "", &noOutput, waitTime)
@@ -17,6 +17,7 @@ import (
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actor"
 	"github.com/youtube/vitess/go/vt/tabletmanager/gorpcproto"
+	"github.com/youtube/vitess/go/vt/tabletserver"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/topotools"
 )
@@ -80,6 +81,18 @@ func (tm *TabletManager) SetBlacklistedTables(context *rpcproto.Context, args *g
 	})
 }
 
+func (tm *TabletManager) SetQueryRules(context *rpcproto.Context, args *gorpcproto.SetQueryRulesArgs, reply *rpc.UnusedResponse) error {
+	return tm.agent.RpcWrapLockAction(context.RemoteAddr, actionnode.TABLET_ACTION_SET_QUERY_RULES, args, reply, func() error {
+		// reject invalid rules before they reach the topology
+		if args.Rules != "" {
+			if err := tabletserver.NewQueryRules().UnmarshalJSON([]byte(args.Rules)); err != nil {
+				return fmt.Errorf("invalid query rules: %v", err)
+			}
+		}
+		return actor.SetQueryRules(tm.agent.TopoServer, tm.agent.TabletAlias, args.Rules)
+	})
+}
+
 func (tm *TabletManager) ReloadSchema(context *rpcproto.Context, args *rpc.UnusedRequest, reply *rpc.UnusedResponse) error {
 	return tm.agent.RpcWrapLockActionSchema(context.RemoteAddr, actionnode.TABLET_ACTION_RELOAD_SCHEMA, args, reply, func() error {
 		// no-op, the framework will force the schema reload
@@ -143,7 +156,7 @@ func (tm *TabletManager) StopSlave(context *rpcproto.Context, args *rpc.UnusedRe
 
 func (tm *TabletManager) StopSlaveMinimum(context *rpcproto.Context, args *gorpcproto.StopSlaveMinimumArgs, reply *myproto.ReplicationPosition) error {
 	return tm.agent.RpcWrapLock(context.RemoteAddr, actionnode.TABLET_ACTION_STOP_SLAVE_MINIMUM, args, reply, func() error {
-		if err := tm.agent.Mysqld.WaitForMinimumReplicationPosition(args.GTIDField.Value, args.WaitTime); err != nil {
+		if err := tm.agent.Mysqld.WaitForPosition(args.GTIDField.Value, args.WaitTime); err != nil {
 			return err
 		}
 		if err := tm.agent.Mysqld.StopSlave(map[string]string{"TABLET_ALIAS": tm.agent.TabletAlias.String()}); err != nil {
@@ -15,9 +15,11 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/timer"
 	"github.com/youtube/vitess/go/vt/health"
 	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
 	"github.com/youtube/vitess/go/vt/servenv"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/topo"
@@ -28,6 +30,9 @@ var (
 	healthCheckInterval = flag.Duration("health_check_interval", 20*time.Second, "Interval between health checks")
 	targetTabletType    = flag.String("target_tablet_type", "", "The tablet type we are thriving to be when healthy. When not healthy, we'll go to spare.")
 	lockTimeout         = flag.Duration("lock_timeout", actionnode.DefaultLockTimeout, "lock time for wrangler/topo operations")
+	repairRelayLogs     = flag.Bool("repair_relay_logs", false, "if set, the health check restarts the replication of slaves stopped by corrupted relay logs, from the last applied position")
+
+	relayLogRepairs = stats.NewInt("RelayLogRepairs")
 )
 
 // HealthRecord records one run of the health checker
@@ -102,6 +107,11 @@ func (agent *ActionAgent) runHealthCheck(targetTabletType topo.TabletType, lockT
 	tablet := agent._tablet
 	agent.mutex.Unlock()
 
+	// repair the relay logs of a slave that crashed
+	if *repairRelayLogs && tablet.Type != topo.TYPE_MASTER {
+		agent.repairRelayLogsIfNeeded()
+	}
+
 	// run the health check
 	typeForHealthCheck := targetTabletType
 	if tablet.Type == topo.TYPE_MASTER {
@@ -179,6 +189,27 @@ func (agent *ActionAgent) runHealthCheck(targetTabletType topo.TabletType, lockT
 	agent.afterAction("healthcheck", false /* reloadSchema */)
 }
 
+// repairRelayLogsIfNeeded restarts replication if it was stopped by
+// corrupted relay logs.
+func (agent *ActionAgent) repairRelayLogsIfNeeded() {
+	corrupted, err := agent.Mysqld.RelayLogsCorrupted()
+	if err != nil {
+		if err != mysqlctl.ErrNotSlave {
+			log.Warningf("Cannot check the relay logs: %v", err)
+		}
+		return
+	}
+	if !corrupted {
+		return
+	}
+	log.Warningf("Replication stopped because of corrupted relay logs, repairing them")
+	if err := agent.Mysqld.RepairRelayLogs(); err != nil {
+		log.Errorf("Cannot repair the relay logs: %v", err)
+		return
+	}
+	relayLogRepairs.Add(1)
+}
+
 // terminateHealthChecks is called when we enter lame duck mode.
 // We will clean up our state, and shut down query service.
 // We only do something if we are in targetTabletType state, and then
@@ -0,0 +1,135 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the replication heartbeat. It is enabled by
+// passing a heartbeat_interval command line parameter. The master then
+// writes a heartbeat at that interval, and the slaves read it to
+// compute their replication lag.
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/health"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	heartbeatInterval = flag.Duration("heartbeat_interval", 0, "if set, the master writes a heartbeat at this interval, and the slaves compute their replication lag from it (needs synchronized clocks)")
+
+	heartbeatWrites      = stats.NewInt("HeartbeatWrites")
+	heartbeatWriteErrors = stats.NewInt("HeartbeatWriteErrors")
+	heartbeatReads       = stats.NewInt("HeartbeatReads")
+	heartbeatReadErrors  = stats.NewInt("HeartbeatReadErrors")
+	heartbeatLag         = stats.NewDuration("HeartbeatReplicationLag")
+)
+
+// IsRunningHeartbeat returns true if the replication heartbeat is
+// enabled.
+func (agent *ActionAgent) IsRunningHeartbeat() bool {
+	return *heartbeatInterval > 0
+}
+
+func (agent *ActionAgent) initHeartbeat() {
+	if !agent.IsRunningHeartbeat() {
+		return
+	}
+
+	log.Infof("Starting replication heartbeat every %v", *heartbeatInterval)
+	t := timer.NewTimer(*heartbeatInterval)
+	servenv.OnTerm(func() {
+		log.Info("Stopping replication heartbeat timer")
+		t.Stop()
+	})
+
+	// the _vt database is migrated by the first master that writes
+	// to it, if the query service didn't do it yet
+	tableCreated := false
+	t.Start(func() {
+		agent.mutex.Lock()
+		tablet := agent._tablet
+		agent.mutex.Unlock()
+
+		switch {
+		case tablet.Type == topo.TYPE_MASTER:
+			if !tableCreated {
+				if err := agent.Mysqld.InitSidecarDB(); err != nil {
+					log.Warningf("Cannot create heartbeat table: %v", err)
+					heartbeatWriteErrors.Add(1)
+					return
+				}
+				tableCreated = true
+			}
+			if err := agent.Mysqld.WriteHeartbeat(tablet.Alias.Uid, time.Now()); err != nil {
+				log.Warningf("Cannot write heartbeat: %v", err)
+				heartbeatWriteErrors.Add(1)
+				return
+			}
+			heartbeatWrites.Add(1)
+		case topo.IsSlaveType(tablet.Type):
+			if _, err := agent.readHeartbeatLag(); err != nil {
+				log.Warningf("Cannot read heartbeat: %v", err)
+			}
+		}
+	})
+}
+
+// readHeartbeatLag returns the replication lag from the last
+// heartbeat, and exports it.
+func (agent *ActionAgent) readHeartbeatLag() (time.Duration, error) {
+	written, _, err := agent.Mysqld.ReadHeartbeat()
+	if err != nil {
+		heartbeatReadErrors.Add(1)
+		return 0, err
+	}
+	heartbeatReads.Add(1)
+
+	// a skewed clock can put the heartbeat in the future
+	lag := time.Now().Sub(written)
+	if lag < 0 {
+		lag = 0
+	}
+	heartbeatLag.Set(lag)
+	return lag, nil
+}
+
+// heartbeatReplicationLag implements health.Reporter
+type heartbeatReplicationLag struct {
+	readLag    func() (time.Duration, error)
+	allowedLag time.Duration
+}
+
+func (hrl *heartbeatReplicationLag) Report(typ topo.TabletType) (status map[string]string, err error) {
+	if !topo.IsSlaveType(typ) {
+		return nil, nil
+	}
+
+	lag, err := hrl.readLag()
+	if err != nil {
+		return nil, err
+	}
+	if lag > hrl.allowedLag {
+		return map[string]string{health.ReplicationLag: health.ReplicationLagHigh}, nil
+	}
+	return nil, nil
+}
+
+func (hrl *heartbeatReplicationLag) HTMLName() template.HTML {
+	return template.HTML(fmt.Sprintf("HeartbeatReplicationLag(allowedLag=%v)", hrl.allowedLag))
+}
+
+// HeartbeatReplicationLag returns a reporter that reports the
+// replication lag computed from the heartbeat, so the heartbeat must
+// be running. It uses the key "replication_lag".
+func (agent *ActionAgent) HeartbeatReplicationLag(allowedLag time.Duration) health.Reporter {
+	return &heartbeatReplicationLag{agent.readHeartbeatLag, allowedLag}
+}
@@ -0,0 +1,41 @@
+package tabletmanager
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/health"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestHeartbeatReplicationLag(t *testing.T) {
+	var lag time.Duration
+	var readErr error
+	hrl := &heartbeatReplicationLag{
+		readLag:    func() (time.Duration, error) { return lag, readErr },
+		allowedLag: 10 * time.Second,
+	}
+
+	cases := []struct {
+		typ    topo.TabletType
+		lag    time.Duration
+		err    error
+		status map[string]string
+		fails  bool
+	}{
+		{typ: topo.TYPE_REPLICA, lag: time.Second},
+		{typ: topo.TYPE_REPLICA, lag: time.Minute, status: map[string]string{health.ReplicationLag: health.ReplicationLagHigh}},
+		{typ: topo.TYPE_RDONLY, err: errors.New("no heartbeat"), fails: true},
+		// the master doesn't read the heartbeat
+		{typ: topo.TYPE_MASTER, lag: time.Minute, err: errors.New("no heartbeat")},
+	}
+	for _, c := range cases {
+		lag, readErr = c.lag, c.err
+		status, err := hrl.Report(c.typ)
+		if (err != nil) != c.fails || !reflect.DeepEqual(status, c.status) {
+			t.Errorf("Report(%v) with lag %v and error %v = %v, %v", c.typ, c.lag, c.err, status, err)
+		}
+	}
+}
@@ -97,6 +97,10 @@ func (ai *ActionInitiator) SetBlacklistedTables(tablet *topo.TabletInfo, tables
 	return ai.rpc.SetBlacklistedTables(tablet, tables, waitTime)
 }
 
+func (ai *ActionInitiator) SetQueryRules(tablet *topo.TabletInfo, rules string, waitTime time.Duration) error {
+	return ai.rpc.SetQueryRules(tablet, rules, waitTime)
+}
+
 func (ai *ActionInitiator) SetReadOnly(tabletAlias topo.TabletAlias) (actionPath string, err error) {
 	return ai.writeTabletAction(tabletAlias, &actionnode.ActionNode{Action: actionnode.TABLET_ACTION_SET_RDONLY})
 }
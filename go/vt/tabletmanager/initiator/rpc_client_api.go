@@ -41,6 +41,10 @@ type TabletManagerConn interface {
 	// blacklisted tables list
 	SetBlacklistedTables(tablet *topo.TabletInfo, tables []string, waitTime time.Duration) error
 
+	// SetQueryRules asks the remote tablet to change its dynamic
+	// query rules (a JSON list, empty to clear them)
+	SetQueryRules(tablet *topo.TabletInfo, rules string, waitTime time.Duration) error
+
 	// ReloadSchema asks the remote tablet to reload its schema
 	ReloadSchema(tablet *topo.TabletInfo, waitTime time.Duration) error
 
@@ -0,0 +1,269 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+// This file handles the online schema changes. They run on the
+// master, one at a time, and are controlled over http:
+//   POST /debug/online_ddl/start with table=t&alter=ADD+COLUMN+c+INT
+//   POST /debug/online_ddl/cancel
+//   /debug/online_ddl returns the status of the last change.
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/tabletserver"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	onlineDDLChunkSize     = flag.Int("online_ddl_chunk_size", 1000, "number of rows copied at a time by the online schema changes")
+	onlineDDLChunkInterval = flag.Duration("online_ddl_chunk_interval", 100*time.Millisecond, "pause between the chunks copied by the online schema changes, to throttle them")
+
+	onlineDDLRowsCopied = stats.NewInt("OnlineDDLRowsCopied")
+	onlineDDLChunks     = stats.NewInt("OnlineDDLChunks")
+	onlineDDLCompleted  = stats.NewInt("OnlineDDLCompleted")
+	onlineDDLFailed     = stats.NewInt("OnlineDDLFailed")
+	onlineDDLState      = stats.NewString("OnlineDDLState")
+)
+
+// The states of an online schema change
+const (
+	OnlineDDLRunning   = "running"
+	OnlineDDLCutOver   = "cutting over"
+	OnlineDDLComplete  = "complete"
+	OnlineDDLFailed    = "failed"
+	OnlineDDLCancelled = "cancelled"
+)
+
+// OnlineDDLStatus is the status of an online schema change.
+type OnlineDDLStatus struct {
+	Table      string
+	Alter      string
+	State      string
+	Error      string
+	RowsCopied int64
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// onlineDDL tracks the online schema change of the agent.
+type onlineDDL struct {
+	mu     sync.Mutex
+	status OnlineDDLStatus
+	cancel chan struct{}
+}
+
+func (od *onlineDDL) setState(state string, err error) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.status.State = state
+	if err != nil {
+		od.status.Error = err.Error()
+	}
+	if state != OnlineDDLRunning && state != OnlineDDLCutOver {
+		od.status.EndTime = time.Now()
+	}
+	onlineDDLState.Set(state)
+}
+
+func (od *onlineDDL) addRows(rows int64) {
+	od.mu.Lock()
+	defer od.mu.Unlock()
+	od.status.RowsCopied += rows
+}
+
+func (od *onlineDDL) running() bool {
+	return od.status.State == OnlineDDLRunning || od.status.State == OnlineDDLCutOver
+}
+
+var (
+	// onlineDDLMutex protects currentOnlineDDL
+	onlineDDLMutex   sync.Mutex
+	currentOnlineDDL *onlineDDL
+)
+
+// StartOnlineSchemaChange starts the online schema change of table,
+// with alter (like "ADD COLUMN c INT"), in the background. Only one
+// change can run at a time, and only on the master.
+func (agent *ActionAgent) StartOnlineSchemaChange(table, alter string) error {
+	tablet := agent.Tablet()
+	if tablet.Type != topo.TYPE_MASTER {
+		return fmt.Errorf("online schema changes run on the master, not on a %v tablet", tablet.Type)
+	}
+
+	onlineDDLMutex.Lock()
+	defer onlineDDLMutex.Unlock()
+	if currentOnlineDDL != nil {
+		currentOnlineDDL.mu.Lock()
+		running := currentOnlineDDL.running()
+		currentOnlineDDL.mu.Unlock()
+		if running {
+			return fmt.Errorf("an online schema change of %v is already running", currentOnlineDDL.status.Table)
+		}
+	}
+
+	od := &onlineDDL{
+		status: OnlineDDLStatus{
+			Table:     table,
+			Alter:     alter,
+			State:     OnlineDDLRunning,
+			StartTime: time.Now(),
+		},
+		cancel: make(chan struct{}),
+	}
+	currentOnlineDDL = od
+	onlineDDLState.Set(OnlineDDLRunning)
+	go agent.runOnlineSchemaChange(od, tablet.DbName())
+	return nil
+}
+
+// CancelOnlineSchemaChange cancels the running online schema change.
+// It can't be cancelled once it is cutting over.
+func (agent *ActionAgent) CancelOnlineSchemaChange() error {
+	onlineDDLMutex.Lock()
+	defer onlineDDLMutex.Unlock()
+	if currentOnlineDDL == nil {
+		return fmt.Errorf("no online schema change")
+	}
+	currentOnlineDDL.mu.Lock()
+	defer currentOnlineDDL.mu.Unlock()
+	if currentOnlineDDL.status.State != OnlineDDLRunning {
+		return fmt.Errorf("the online schema change of %v is %v", currentOnlineDDL.status.Table, currentOnlineDDL.status.State)
+	}
+	select {
+	case <-currentOnlineDDL.cancel:
+	default:
+		close(currentOnlineDDL.cancel)
+	}
+	return nil
+}
+
+// OnlineSchemaChangeStatus returns the status of the last online
+// schema change, or nil if there was none.
+func (agent *ActionAgent) OnlineSchemaChangeStatus() *OnlineDDLStatus {
+	onlineDDLMutex.Lock()
+	defer onlineDDLMutex.Unlock()
+	if currentOnlineDDL == nil {
+		return nil
+	}
+	currentOnlineDDL.mu.Lock()
+	defer currentOnlineDDL.mu.Unlock()
+	status := currentOnlineDDL.status
+	return &status
+}
+
+func (agent *ActionAgent) runOnlineSchemaChange(od *onlineDDL, dbName string) {
+	table, alter := od.status.Table, od.status.Alter
+	log.Infof("Starting online schema change of %v: %v", table, alter)
+	osc, err := agent.Mysqld.PrepareOnlineSchemaChange(dbName, table, alter)
+	if err != nil {
+		log.Errorf("Online schema change of %v failed: %v", table, err)
+		onlineDDLFailed.Add(1)
+		od.setState(OnlineDDLFailed, err)
+		return
+	}
+
+	var lastPK []sqltypes.Value
+	for {
+		select {
+		case <-od.cancel:
+			log.Infof("Online schema change of %v cancelled", table)
+			agent.Mysqld.CleanupOnlineSchemaChange(osc)
+			od.setState(OnlineDDLCancelled, nil)
+			return
+		default:
+		}
+
+		var rows int64
+		lastPK, rows, err = agent.Mysqld.CopyOnlineSchemaChangeChunk(osc, lastPK, *onlineDDLChunkSize)
+		if err != nil {
+			log.Errorf("Online schema change of %v failed to copy rows: %v", table, err)
+			agent.Mysqld.CleanupOnlineSchemaChange(osc)
+			onlineDDLFailed.Add(1)
+			od.setState(OnlineDDLFailed, err)
+			return
+		}
+		od.addRows(rows)
+		onlineDDLRowsCopied.Add(rows)
+		onlineDDLChunks.Add(1)
+		if lastPK == nil {
+			break
+		}
+
+		select {
+		case <-od.cancel:
+		case <-time.After(*onlineDDLChunkInterval):
+		}
+	}
+
+	od.setState(OnlineDDLCutOver, nil)
+	if err := agent.Mysqld.CutOverOnlineSchemaChange(osc); err != nil {
+		log.Errorf("Online schema change of %v failed to cut over: %v", table, err)
+		onlineDDLFailed.Add(1)
+		od.setState(OnlineDDLFailed, err)
+		return
+	}
+	// The queries on the table must be planned with its new schema.
+	tabletserver.ReloadSchema()
+	log.Infof("Online schema change of %v complete", table)
+	onlineDDLCompleted.Add(1)
+	od.setState(OnlineDDLComplete, nil)
+}
+
+func (agent *ActionAgent) initOnlineDDL() {
+	http.HandleFunc("/debug/online_ddl", func(w http.ResponseWriter, r *http.Request) {
+		if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jscfg.ToJson(agent.OnlineSchemaChangeStatus())))
+	})
+	http.HandleFunc("/debug/online_ddl/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		table := r.FormValue("table")
+		alter := r.FormValue("alter")
+		if table == "" || alter == "" {
+			http.Error(w, "table and alter are required", http.StatusBadRequest)
+			return
+		}
+		if err := agent.StartOnlineSchemaChange(table, alter); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("started\n"))
+	})
+	http.HandleFunc("/debug/online_ddl/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+			acl.SendError(w, err)
+			return
+		}
+		if err := agent.CancelOnlineSchemaChange(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("cancelled\n"))
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"flag"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/hook"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
+)
+
+// This file handles the initial backup restore upon startup.
+// It is only enabled if restore_from_backup is set.
+
+var (
+	restoreFromBackup  = flag.Bool("restore_from_backup", false, "(init restore parameter) will check BackupStorage for a recent backup at startup and start there")
+	restoreConcurrency = flag.Int("restore_concurrency", 4, "(init restore parameter) how many concurrent files to restore at once")
+)
+
+// RestoreFromBackup is the main entry point for backup restore.
+// It takes the action lock so no RPC interferes.
+//
+// The tablet must be idle, with its keyspace and shard set. If there
+// is a backup for its shard, the tablet is restored from it, starts
+// replicating from the shard master, and becomes a spare.
+func (agent *ActionAgent) RestoreFromBackup() error {
+	agent.actionMutex.Lock()
+	defer agent.actionMutex.Unlock()
+
+	tablet := agent.Tablet()
+	if tablet.Type != topo.TYPE_IDLE {
+		return fmt.Errorf("expected idle type, not %v: %v", tablet.Type, agent.TabletAlias)
+	}
+	if tablet.Keyspace == "" || tablet.Shard == "" {
+		return fmt.Errorf("cannot restore tablet %v without keyspace and shard", agent.TabletAlias)
+	}
+
+	// find the shard master to replicate from
+	si, err := agent.TopoServer.GetShard(tablet.Keyspace, tablet.Shard)
+	if err != nil {
+		return err
+	}
+	if si.MasterAlias.IsZero() {
+		return fmt.Errorf("no master in shard %v/%v to replicate from", tablet.Keyspace, tablet.Shard)
+	}
+	master, err := agent.TopoServer.GetTablet(si.MasterAlias)
+	if err != nil {
+		return err
+	}
+
+	// do the restore
+	bucket := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
+	hookExtraEnv := map[string]string{"TABLET_ALIAS": agent.TabletAlias.String()}
+	rp, err := agent.Mysqld.Restore(bucket, *restoreConcurrency, hookExtraEnv)
+	if err == mysqlctl.ErrNoBackup {
+		log.Infof("No backup to restore for %v, starting up empty", bucket)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot restore backup of %v: %v", bucket, err)
+	}
+
+	// start replicating from the master
+	rs, err := myproto.NewReplicationState(master.MysqlIpAddr())
+	if err != nil {
+		return err
+	}
+	rs.ReplicationPosition = *rp
+	cmds, err := mysqlctl.StartReplicationCommands(agent.Mysqld, rs)
+	if err != nil {
+		return err
+	}
+	if err := agent.Mysqld.ExecuteSuperQueryList(cmds); err != nil {
+		return fmt.Errorf("failed to start replication: %v", err)
+	}
+
+	// run the optional preflight_assigned hook, and add the
+	// tablet to the replication graph as a spare
+	hk := hook.NewSimpleHook("preflight_assigned")
+	topotools.ConfigureTabletHook(hk, agent.TabletAlias)
+	if err := hk.ExecuteOptional(); err != nil {
+		return err
+	}
+	ti, err := agent.TopoServer.GetTablet(agent.TabletAlias)
+	if err != nil {
+		return err
+	}
+	ti.Parent = si.MasterAlias
+	ti.Type = topo.TYPE_SPARE
+	if err := topo.UpdateTablet(agent.TopoServer, ti); err != nil {
+		return err
+	}
+	if err := topo.CreateTabletReplicationData(agent.TopoServer, ti.Tablet); err != nil {
+		return err
+	}
+
+	// now refresh our state
+	agent.afterAction("RestoreFromBackup", false /*reloadSchema*/)
+	return nil
+}
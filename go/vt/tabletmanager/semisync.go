@@ -0,0 +1,68 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"flag"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var enableSemiSync = flag.Bool("enable_semi_sync", false, "enable semi-sync replication: the master waits for a replica to receive each transaction before acknowledging it (needs the semisync plugins loaded in mysqld)")
+
+// fixSemiSync enables the side of semi-sync replication that goes
+// with the tablet type: the master waits for acknowledgements, and
+// only the replicas, which can become master, send them.
+func fixSemiSync(mysqlDaemon mysqlctl.MysqlDaemon, tabletType topo.TabletType) {
+	if !*enableSemiSync {
+		return
+	}
+
+	var err error
+	switch tabletType {
+	case topo.TYPE_MASTER:
+		err = mysqlDaemon.SetSemiSyncEnabled(true, false)
+	case topo.TYPE_REPLICA:
+		err = mysqlDaemon.SetSemiSyncEnabled(false, true)
+	default:
+		err = mysqlDaemon.SetSemiSyncEnabled(false, false)
+	}
+	if err != nil {
+		log.Errorf("Cannot set semi-sync replication for tablet type %v: %v", tabletType, err)
+	}
+}
+
+// registerSemiSyncStats exports the semi-sync replication status of
+// mysqld, if semi-sync is enabled.
+func registerSemiSyncStats(mysqld *mysqlctl.Mysqld) {
+	if !*enableSemiSync {
+		return
+	}
+
+	stats.Publish("SemiSyncMasterStatus", stats.IntFunc(func() int64 {
+		master, _, err := mysqld.SemiSyncStatus()
+		if err != nil || !master {
+			return 0
+		}
+		return 1
+	}))
+	stats.Publish("SemiSyncSlaveStatus", stats.IntFunc(func() int64 {
+		_, slave, err := mysqld.SemiSyncStatus()
+		if err != nil || !slave {
+			return 0
+		}
+		return 1
+	}))
+	stats.Publish("SemiSyncMasterClients", stats.IntFunc(func() int64 {
+		clients, err := mysqld.SemiSyncClients()
+		if err != nil {
+			return 0
+		}
+		return int64(clients)
+	}))
+}
@@ -0,0 +1,51 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletmanager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func TestFixSemiSync(t *testing.T) {
+	defer func(enabled bool) { *enableSemiSync = enabled }(*enableSemiSync)
+	*enableSemiSync = true
+
+	cases := []struct {
+		tabletType    topo.TabletType
+		master, slave bool
+	}{
+		{topo.TYPE_MASTER, true, false},
+		{topo.TYPE_REPLICA, false, true},
+		{topo.TYPE_RDONLY, false, false},
+		{topo.TYPE_SPARE, false, false},
+	}
+	for _, c := range cases {
+		// start from the opposite, to see both sides change
+		fmd := &mysqlctl.FakeMysqlDaemon{SemiSyncMasterEnabled: !c.master, SemiSyncSlaveEnabled: !c.slave}
+		fixSemiSync(fmd, c.tabletType)
+		if fmd.SemiSyncMasterEnabled != c.master || fmd.SemiSyncSlaveEnabled != c.slave {
+			t.Errorf("fixSemiSync(%v): master %v, slave %v, want %v, %v", c.tabletType, fmd.SemiSyncMasterEnabled, fmd.SemiSyncSlaveEnabled, c.master, c.slave)
+		}
+	}
+
+	// without the plugins, the error is only logged
+	fmd := &mysqlctl.FakeMysqlDaemon{SemiSyncError: fmt.Errorf("rpl_semi_sync_master plugin is not loaded")}
+	fixSemiSync(fmd, topo.TYPE_MASTER)
+	if fmd.SemiSyncMasterEnabled {
+		t.Errorf("fixSemiSync without the plugins enabled the master side")
+	}
+
+	// semi-sync is left alone unless enabled
+	*enableSemiSync = false
+	fmd = &mysqlctl.FakeMysqlDaemon{}
+	fixSemiSync(fmd, topo.TYPE_MASTER)
+	if fmd.SemiSyncMasterEnabled {
+		t.Errorf("fixSemiSync with -enable_semi_sync=false enabled the master side")
+	}
+}
@@ -18,6 +18,7 @@ type ActivePool struct {
 	pool       *pools.Numbered
 	timeout    sync2.AtomicDuration
 	ticks      *timer.Timer
+	deadlines  *deadlineTimer
 	connKiller *ConnectionKiller
 }
 
@@ -28,6 +29,7 @@ func NewActivePool(name string, queryTimeout time.Duration, connKiller *Connecti
 		ticks:      timer.NewTimer(queryTimeout / 10),
 		connKiller: connKiller,
 	}
+	ap.deadlines = newDeadlineTimer(ap.ticks)
 	stats.Publish(name+"Size", stats.IntFunc(ap.pool.Size))
 	stats.Publish(
 		name+"Timeout",
@@ -42,18 +44,58 @@ func (ap *ActivePool) Open() {
 
 func (ap *ActivePool) Close() {
 	ap.ticks.Stop()
+	ap.deadlines.Stop()
 	ap.pool = pools.NewNumbered()
 }
 
+// activeQuery is what ActivePool tracks for each running query.
+// A zero timeout means the query is subject to the pool timeout,
+// which also caps the timeout of the query.
+type activeQuery struct {
+	connID  int64
+	timeout time.Duration
+}
+
 func (ap *ActivePool) killOutdatedQueries() {
 	defer logError()
-	for _, v := range ap.pool.GetOutdated(time.Duration(ap.Timeout()), "for abort") {
-		ap.connKiller.Kill(v.(int64))
+	defaultTimeout := ap.Timeout()
+	next := earliestDeadline{now: time.Now()}
+	isOutdated := func(val interface{}, age time.Duration) bool {
+		timeout := val.(*activeQuery).timeout
+		if timeout == 0 {
+			return defaultTimeout > 0 && age >= defaultTimeout
+		}
+		return next.add(age, effectiveTimeout(timeout, defaultTimeout))
+	}
+	for _, v := range ap.pool.GetOutdatedFunc(isOutdated, "for abort") {
+		ap.connKiller.Kill(v.(*activeQuery).connID)
+	}
+	if !next.earliest.IsZero() {
+		ap.deadlines.Schedule(next.earliest)
 	}
 }
 
-func (ap *ActivePool) Put(id int64) {
-	ap.pool.Register(id, id)
+// KillAll kills all the running queries, when the query
+// service stops, and returns their number.
+func (ap *ActivePool) KillAll() int {
+	vals := ap.pool.GetOutdated(time.Duration(0), "for shutdown")
+	for _, v := range vals {
+		killStats.Add("ShutdownQueries", 1)
+		ap.connKiller.Kill(v.(*activeQuery).connID)
+	}
+	return len(vals)
+}
+
+// Put registers the query running on connection id. If timeout is
+// non-zero, it overrides the pool timeout for that query, up to the
+// pool timeout.
+func (ap *ActivePool) Put(id int64, timeout time.Duration) {
+	ap.pool.Register(id, &activeQuery{connID: id, timeout: timeout})
+	if timeout > 0 {
+		// The ticks are paced by the pool timeout, which could
+		// be longer or disabled. Make sure we check on time.
+		ap.deadlines.Schedule(time.Now().Add(effectiveTimeout(timeout, ap.Timeout())))
+	}
 }
 
 func (ap *ActivePool) Remove(id int64) {
@@ -7,16 +7,21 @@ package tabletserver
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/pools"
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/streamlog"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/context"
 	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 /* Function naming convention:
@@ -44,11 +49,29 @@ const (
 )
 
 type ActiveTxPool struct {
-	pool    *pools.Numbered
-	lastId  sync2.AtomicInt64
-	timeout sync2.AtomicDuration
-	ticks   *timer.Timer
-	txStats *stats.Timings
+	pool      *pools.Numbered
+	lastId    sync2.AtomicInt64
+	timeout   sync2.AtomicDuration
+	ticks     *timer.Timer
+	deadlines *deadlineTimer
+	txStats   *stats.Timings
+	// recordRedo makes the transactions record their DMLs,
+	// for the redo log of two-phase commit.
+	recordRedo bool
+
+	// rowsMu protects rows, the rows held in the serializer by
+	// each open transaction, released when it ends. They're not
+	// kept in the TxConnection so that a transaction can wait for
+	// rows before its connection is taken from the pool.
+	rowsMu sync.Mutex
+	rows   map[int64]*txRows
+}
+
+// txRows are the rows held by a transaction, and its timeout.
+type txRows struct {
+	timeout    time.Duration
+	serializer *TxSerializer
+	held       map[string]bool
 }
 
 func NewActiveTxPool(name string, timeout time.Duration) *ActiveTxPool {
@@ -58,7 +81,9 @@ func NewActiveTxPool(name string, timeout time.Duration) *ActiveTxPool {
 		timeout: sync2.AtomicDuration(timeout),
 		ticks:   timer.NewTimer(timeout / 10),
 		txStats: stats.NewTimings("Transactions"),
+		rows:    make(map[int64]*txRows),
 	}
+	axp.deadlines = newDeadlineTimer(axp.ticks)
 	stats.Publish(name+"Size", stats.IntFunc(axp.pool.Size))
 	stats.Publish(
 		name+"Timeout",
@@ -74,6 +99,7 @@ func (axp *ActiveTxPool) Open() {
 
 func (axp *ActiveTxPool) Close() {
 	axp.ticks.Stop()
+	axp.deadlines.Stop()
 	for _, v := range axp.pool.GetOutdated(time.Duration(0), "for closing") {
 		conn := v.(*TxConnection)
 		log.Warningf("killing transaction for shutdown: %s", conn.Format(nil))
@@ -87,24 +113,62 @@ func (axp *ActiveTxPool) WaitForEmpty() {
 	axp.pool.WaitForEmpty()
 }
 
+// KillAll rolls back the transactions that are not in use,
+// when the query service stops, and returns their number.
+func (axp *ActiveTxPool) KillAll() int {
+	vals := axp.pool.GetOutdated(time.Duration(0), "for shutdown")
+	for _, v := range vals {
+		conn := v.(*TxConnection)
+		log.Warningf("killing transaction for shutdown: %s", conn.Format(nil))
+		killStats.Add("ShutdownTransactions", 1)
+		conn.Close()
+		conn.discard(TX_KILL)
+	}
+	return len(vals)
+}
+
 func (axp *ActiveTxPool) TransactionKiller() {
 	defer logError()
-	for _, v := range axp.pool.GetOutdated(time.Duration(axp.Timeout()), "for rollback") {
+	defaultTimeout := axp.Timeout()
+	next := earliestDeadline{now: time.Now()}
+	isOutdated := func(val interface{}, age time.Duration) bool {
+		timeout := val.(*TxConnection).Timeout
+		if timeout == 0 {
+			return defaultTimeout > 0 && age >= defaultTimeout
+		}
+		return next.add(age, effectiveTimeout(timeout, defaultTimeout))
+	}
+	for _, v := range axp.pool.GetOutdatedFunc(isOutdated, "for rollback") {
 		conn := v.(*TxConnection)
 		log.Warningf("killing transaction: %s", conn.Format(nil))
 		killStats.Add("Transactions", 1)
 		conn.Close()
 		conn.discard(TX_KILL)
 	}
+	if !next.earliest.IsZero() {
+		axp.deadlines.Schedule(next.earliest)
+	}
 }
 
-func (axp *ActiveTxPool) SafeBegin(conn dbconnpool.PoolConnection) (transactionId int64, err error) {
+// SafeBegin begins a transaction on conn for caller. If timeout is
+// non-zero, it overrides the pool timeout for that transaction, up
+// to the pool timeout.
+func (axp *ActiveTxPool) SafeBegin(conn dbconnpool.PoolConnection, caller context.Context, timeout time.Duration) (transactionId int64, err error) {
 	defer handleError(&err, nil)
 	if _, err := conn.ExecuteFetch(BEGIN, 1, false); err != nil {
 		panic(NewTabletErrorSql(FAIL, err))
 	}
 	transactionId = axp.lastId.Add(1)
-	axp.pool.Register(transactionId, newTxConnection(conn, transactionId, axp))
+	txc := newTxConnection(conn, transactionId, axp)
+	txc.Caller = caller
+	txc.Timeout = timeout
+	axp.rowsMu.Lock()
+	axp.rows[transactionId] = &txRows{timeout: timeout}
+	axp.rowsMu.Unlock()
+	axp.pool.Register(transactionId, txc)
+	if timeout > 0 {
+		axp.deadlines.Schedule(time.Now().Add(effectiveTimeout(timeout, axp.Timeout())))
+	}
 	return transactionId, nil
 }
 
@@ -139,6 +203,135 @@ func (axp *ActiveTxPool) Get(transactionId int64) (conn *TxConnection) {
 	return v.(*TxConnection)
 }
 
+// LockRows holds the rows identified by keys, in table, in serializer
+// until the end of the transaction. It waits for the rows held by the
+// other transactions without using the transaction, and at most for
+// as long as the transaction can live. The rows are locked in the
+// order of their keys, so that transactions locking the same rows
+// can't deadlock. The rows already held by the transaction are
+// skipped.
+func (axp *ActiveTxPool) LockRows(transactionId int64, serializer *TxSerializer, table string, keys []string) error {
+	axp.rowsMu.Lock()
+	rows, ok := axp.rows[transactionId]
+	axp.rowsMu.Unlock()
+	if !ok {
+		return NewTabletError(NOT_IN_TX, "Transaction %d: not found", transactionId)
+	}
+	timeout := effectiveTimeout(rows.timeout, axp.Timeout())
+
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i > 0 && key == keys[i-1] {
+			continue
+		}
+		axp.rowsMu.Lock()
+		held := rows.held[key]
+		axp.rowsMu.Unlock()
+		if held {
+			continue
+		}
+		if err := serializer.Lock(table, key, timeout); err != nil {
+			return err
+		}
+		axp.rowsMu.Lock()
+		_, ok := axp.rows[transactionId]
+		if ok {
+			if rows.held == nil {
+				rows.held = make(map[string]bool)
+			}
+			rows.serializer = serializer
+			rows.held[key] = true
+		}
+		axp.rowsMu.Unlock()
+		if !ok {
+			// The transaction ended while it was waiting.
+			serializer.Unlock(key)
+			return NewTabletError(NOT_IN_TX, "Transaction %d: ended while waiting for a row of %s", transactionId, table)
+		}
+	}
+	return nil
+}
+
+// releaseRows releases the rows held by the transaction.
+func (axp *ActiveTxPool) releaseRows(transactionId int64) {
+	axp.rowsMu.Lock()
+	rows := axp.rows[transactionId]
+	delete(axp.rows, transactionId)
+	axp.rowsMu.Unlock()
+	if rows == nil {
+		return
+	}
+	for key := range rows.held {
+		rows.serializer.Unlock(key)
+	}
+}
+
+// Kill rolls back a transaction that is not in use,
+// like when it exceeds its timeout.
+func (axp *ActiveTxPool) Kill(transactionId int64) error {
+	v, err := axp.pool.Get(transactionId, "for kill")
+	if err != nil {
+		return fmt.Errorf("transaction %d: %v", transactionId, err)
+	}
+	conn := v.(*TxConnection)
+	log.Warningf("killing transaction on request: %s", conn.Format(nil))
+	killStats.Add("Transactions", 1)
+	conn.Close()
+	conn.discard(TX_KILL)
+	return nil
+}
+
+// TxDetail is a snapshot of an open transaction, for reporting.
+type TxDetail struct {
+	TransactionID int64
+	Caller        string
+	StartTime     time.Time
+	Duration      time.Duration
+	Timeout       time.Duration
+	// State is the purpose the transaction is used for,
+	// or "idle".
+	State   string
+	Queries []string
+}
+
+type byTxStartTime []TxDetail
+
+func (a byTxStartTime) Len() int           { return len(a) }
+func (a byTxStartTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byTxStartTime) Less(i, j int) bool { return a[i].StartTime.Before(a[j].StartTime) }
+
+// GetTxDetails returns the open transactions sorted by start time.
+func (axp *ActiveTxPool) GetTxDetails() []TxDetail {
+	vals, purposes := axp.pool.GetAll()
+	now := time.Now()
+	details := make([]TxDetail, 0, len(vals))
+	for i, v := range vals {
+		txc := v.(*TxConnection)
+		detail := TxDetail{
+			TransactionID: txc.TransactionID,
+			StartTime:     txc.StartTime,
+			Duration:      now.Sub(txc.StartTime),
+			Timeout:       txc.Timeout,
+			Caller:        txc.caller(),
+			State:         purposes[i],
+			Queries:       txc.queries(),
+		}
+		if detail.Timeout == 0 {
+			detail.Timeout = axp.Timeout()
+		}
+		if detail.State == "" {
+			detail.State = "idle"
+		}
+		if dtid := txc.preparedAs(); dtid != "" {
+			detail.State = "prepared as " + dtid
+		}
+		details = append(details, detail)
+	}
+	sort.Sort(byTxStartTime(details))
+	return details
+}
+
 func (axp *ActiveTxPool) Timeout() time.Duration {
 	return axp.timeout.Get()
 }
@@ -160,13 +353,35 @@ func (axp *ActiveTxPool) Stats() (size int64, timeout time.Duration) {
 type TxConnection struct {
 	dbconnpool.PoolConnection
 	TransactionID int64
-	pool          *ActiveTxPool
-	inUse         bool
-	StartTime     time.Time
-	EndTime       time.Time
-	dirtyTables   map[string]DirtyKeys
-	Queries       []string
-	Conclusion    string
+	// Caller is the context of the client that began the transaction.
+	Caller    context.Context
+	pool      *ActiveTxPool
+	inUse     bool
+	StartTime time.Time
+	EndTime   time.Time
+	// Timeout, if non-zero, overrides the pool timeout.
+	Timeout     time.Duration
+	dirtyTables map[string]DirtyKeys
+	// mu protects Queries, which are reported while
+	// the transaction is open, dtid, redo and savepoints.
+	mu         sync.Mutex
+	Queries    []string
+	Conclusion string
+	// redo are the DMLs of the transaction, recorded if the
+	// pool records them. dtid is the id of the distributed
+	// transaction it was prepared for, if any.
+	redo []string
+	dtid string
+	// savepoints are the savepoints of the transaction,
+	// in the order they were set.
+	savepoints []savepoint
+}
+
+// savepoint is a savepoint of a transaction. redo is the number
+// of redo statements recorded when it was set.
+type savepoint struct {
+	name string
+	redo int
 }
 
 func newTxConnection(conn dbconnpool.PoolConnection, transactionId int64, pool *ActiveTxPool) *TxConnection {
@@ -197,14 +412,84 @@ func (txc *TxConnection) Recycle() {
 	}
 }
 
+// ExecuteFetch executes query in the transaction, and records it
+// in the redo statements if it's a DML and the pool records them.
+func (txc *TxConnection) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	qr, err := txc.PoolConnection.ExecuteFetch(query, maxrows, wantfields)
+	if err == nil && txc.pool.recordRedo && sqlparser.IsDML(query) {
+		txc.mu.Lock()
+		txc.redo = append(txc.redo, query)
+		txc.mu.Unlock()
+	}
+	return qr, err
+}
+
+// SetSavepoint records that the savepoint name was set. Like in
+// MySQL, it replaces any savepoint of the same name.
+func (txc *TxConnection) SetSavepoint(name string) {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	if i := txc.findSavepoint(name); i >= 0 {
+		txc.savepoints = append(txc.savepoints[:i], txc.savepoints[i+1:]...)
+	}
+	txc.savepoints = append(txc.savepoints, savepoint{name: name, redo: len(txc.redo)})
+}
+
+// RollbackToSavepoint records that the transaction was rolled back
+// to the savepoint name: the redo statements recorded since, and the
+// savepoints set after it, are dropped.
+func (txc *TxConnection) RollbackToSavepoint(name string) {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	i := txc.findSavepoint(name)
+	if i < 0 {
+		return
+	}
+	txc.redo = txc.redo[:txc.savepoints[i].redo]
+	txc.savepoints = txc.savepoints[:i+1]
+}
+
+// ReleaseSavepoint records that the savepoint name was released,
+// with the savepoints set after it.
+func (txc *TxConnection) ReleaseSavepoint(name string) {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	if i := txc.findSavepoint(name); i >= 0 {
+		txc.savepoints = txc.savepoints[:i]
+	}
+}
+
+// findSavepoint returns the index of the savepoint name, or -1.
+// Savepoint names are case insensitive. txc.mu must be held.
+func (txc *TxConnection) findSavepoint(name string) int {
+	for i, sp := range txc.savepoints {
+		if strings.EqualFold(sp.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
 func (txc *TxConnection) RecordQuery(query string) {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
 	txc.Queries = append(txc.Queries, query)
 }
 
+// queries returns a copy of the queries of the transaction so far.
+func (txc *TxConnection) queries() []string {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	queries := make([]string, len(txc.Queries))
+	copy(queries, txc.Queries)
+	return queries
+}
+
 func (txc *TxConnection) discard(conclusion string) {
 	txc.Conclusion = conclusion
 	txc.EndTime = time.Now()
 	txc.pool.pool.Unregister(txc.TransactionID)
+	txc.pool.releaseRows(txc.TransactionID)
 	txc.PoolConnection.Recycle()
 	// Ensure PoolConnection won't be accessed after Recycle.
 	txc.PoolConnection = nil
@@ -213,16 +498,49 @@ func (txc *TxConnection) discard(conclusion string) {
 
 func (txc *TxConnection) Format(params url.Values) string {
 	return fmt.Sprintf(
-		"%v\t%v\t%v\t%.6f\t%v\t%v\t\n",
+		"%v\t%v\t%v\t%.6f\t%v\t%v\t%v\t\n",
 		txc.TransactionID,
 		txc.StartTime.Format(time.StampMicro),
 		txc.EndTime.Format(time.StampMicro),
 		txc.EndTime.Sub(txc.StartTime).Seconds(),
 		txc.Conclusion,
 		strings.Join(txc.Queries, ";"),
+		txc.caller(),
 	)
 }
 
+// preparedAs returns the id of the distributed
+// transaction txc was prepared for, if any.
+func (txc *TxConnection) preparedAs() string {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	return txc.dtid
+}
+
+// redoStatements returns a copy of the redo statements
+// of the transaction so far.
+func (txc *TxConnection) redoStatements() []string {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	redo := make([]string, len(txc.redo))
+	copy(redo, txc.redo)
+	return redo
+}
+
+func (txc *TxConnection) setPrepared(dtid string) {
+	txc.mu.Lock()
+	defer txc.mu.Unlock()
+	txc.dtid = dtid
+}
+
+// caller returns the caller of the transaction, for logging.
+func (txc *TxConnection) caller() string {
+	if txc.Caller == nil {
+		return ""
+	}
+	return txc.Caller.String()
+}
+
 type DirtyKeys map[string]bool
 
 // Delete just keeps track of what needs to be deleted
@@ -0,0 +1,99 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSavepoints(t *testing.T) {
+	txc := &TxConnection{TransactionID: 1}
+	txc.redo = []string{"insert 1"}
+	txc.SetSavepoint("a")
+	txc.redo = append(txc.redo, "insert 2")
+	txc.SetSavepoint("b")
+	txc.redo = append(txc.redo, "insert 3")
+	txc.SetSavepoint("c")
+
+	txc.RollbackToSavepoint("B")
+	if want := []string{"insert 1", "insert 2"}; !reflect.DeepEqual(txc.redo, want) {
+		t.Errorf("redo after rollback to b: %v, want %v", txc.redo, want)
+	}
+	if i := txc.findSavepoint("c"); i != -1 {
+		t.Errorf("savepoint c was not dropped by the rollback to b")
+	}
+	if i := txc.findSavepoint("b"); i != 1 {
+		t.Errorf("savepoint b: %d, want 1", i)
+	}
+
+	// Setting a savepoint again moves it.
+	txc.SetSavepoint("a")
+	txc.redo = append(txc.redo, "insert 4")
+	txc.RollbackToSavepoint("a")
+	if want := []string{"insert 1", "insert 2"}; !reflect.DeepEqual(txc.redo, want) {
+		t.Errorf("redo after rollback to a: %v, want %v", txc.redo, want)
+	}
+
+	txc.ReleaseSavepoint("b")
+	if len(txc.savepoints) != 0 {
+		t.Errorf("savepoints after release of b: %v, want none", txc.savepoints)
+	}
+	// Unknown savepoints are ignored: MySQL fails them.
+	txc.RollbackToSavepoint("a")
+	if len(txc.redo) != 2 {
+		t.Errorf("redo after rollback to an unknown savepoint: %v", txc.redo)
+	}
+}
+
+func TestLockRows(t *testing.T) {
+	ts := NewTxSerializer("", 10)
+	axp := &ActiveTxPool{rows: map[int64]*txRows{
+		1: {},
+		2: {timeout: 10 * time.Millisecond},
+		3: {},
+	}}
+
+	// Duplicate keys are locked once.
+	if err := axp.LockRows(1, ts, "t", []string{"t.2", "t.1", "t.2"}); err != nil {
+		t.Fatalf("LockRows: %v", err)
+	}
+	if want := map[string]bool{"t.1": true, "t.2": true}; !reflect.DeepEqual(axp.rows[1].held, want) {
+		t.Errorf("held rows: %v, want %v", axp.rows[1].held, want)
+	}
+	// The rows already held are skipped.
+	if err := axp.LockRows(1, ts, "t", []string{"t.1"}); err != nil {
+		t.Errorf("LockRows of a held row: %v", err)
+	}
+	// The wait is bounded by the timeout of the transaction.
+	if err := axp.LockRows(2, ts, "t", []string{"t.1"}); err == nil {
+		t.Errorf("LockRows of a row held by another transaction did not time out")
+	}
+	axp.releaseRows(1)
+	if err := axp.LockRows(2, ts, "t", []string{"t.1"}); err != nil {
+		t.Errorf("LockRows of a released row: %v", err)
+	}
+
+	// A transaction that ends while waiting doesn't keep the row.
+	locked := make(chan error)
+	go func() {
+		locked <- axp.LockRows(3, ts, "t", []string{"t.1"})
+	}()
+	for ts.waits.Counts()["t"] != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	axp.releaseRows(3)
+	axp.releaseRows(2)
+	if err := <-locked; err == nil {
+		t.Errorf("LockRows of an ended transaction: nil, want error")
+	}
+	if err := axp.LockRows(3, ts, "t", []string{"t.1"}); err == nil {
+		t.Errorf("LockRows of an unknown transaction: nil, want error")
+	}
+	if rows := ts.rows(); rows != 0 {
+		t.Errorf("rows: %v, want 0", rows)
+	}
+}
@@ -36,6 +36,10 @@ type CachePool struct {
 	DeleteExpiry   uint64
 	memcacheStats  *MemcacheStats
 	mu             sync.Mutex
+
+	// Checksum makes RowCache store the CRC32 of every row,
+	// and verify it when the row is read.
+	Checksum bool
 }
 
 // Cache re-exposes memcache.Connection
@@ -0,0 +1,171 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+)
+
+var (
+	// callerQueries and callerErrors are the per-caller query
+	// counts, latencies and errors, by effective caller and method.
+	callerQueries *stats.MultiTimings
+	callerErrors  *stats.MultiCounters
+)
+
+// recordCallerStats records the request of logStats in the
+// per-caller stats. It must be deferred before the handling of
+// the errors of the request, so it runs after it.
+func recordCallerStats(logStats *SQLQueryStats, err *error) {
+	names := []string{logStats.EffectiveCaller(), logStats.Method}
+	callerQueries.Add(names, logStats.TotalTime())
+	if *err != nil {
+		callerErrors.Add(names, 1)
+	}
+}
+
+// maxCallers is the number of callers CallerQuotas tracks
+// separately. The effective caller is sent by the clients, so the
+// queries of the other callers share the quotas of otherCallers.
+const (
+	maxCallers   = 1000
+	otherCallers = "other"
+)
+
+// CallerQuotas limits the queries that each effective caller can run
+// at the same time, and per second, so one misbehaving service can't
+// starve the others on a shared tablet. Queries over the quotas fail
+// with QUOTA_EXCEEDED instead of waiting.
+type CallerQuotas struct {
+	// maxConcurrency and maxQPS are the limits of every caller.
+	// 0 means unlimited.
+	maxConcurrency sync2.AtomicInt64
+	maxQPS         sync2.AtomicInt64
+
+	mu      sync.Mutex
+	callers map[string]*callerQuota
+	// maxCallers is the size limit of callers.
+	maxCallers int
+	// pruned is the last second at which the idle
+	// callers were removed.
+	pruned int64
+
+	// rejections counts the queries rejected, per caller.
+	rejections *stats.Counters
+}
+
+// callerQuota is the usage of one caller.
+type callerQuota struct {
+	// inFlight is the number of queries running.
+	inFlight int64
+	// count is the number of queries started during
+	// second, a unix time.
+	second int64
+	count  int64
+}
+
+// NewCallerQuotas creates a new CallerQuotas. If name is empty,
+// its stats are not exported.
+func NewCallerQuotas(name string, maxConcurrency, maxQPS int) *CallerQuotas {
+	cq := &CallerQuotas{
+		maxConcurrency: sync2.AtomicInt64(maxConcurrency),
+		maxQPS:         sync2.AtomicInt64(maxQPS),
+		callers:        make(map[string]*callerQuota),
+		maxCallers:     maxCallers,
+		rejections:     stats.NewCounters(""),
+	}
+	if name != "" {
+		stats.Publish(name+"Rejections", cq.rejections)
+		stats.Publish(name+"MaxConcurrency", stats.IntFunc(cq.maxConcurrency.Get))
+		stats.Publish(name+"MaxQPS", stats.IntFunc(cq.maxQPS.Get))
+	}
+	return cq
+}
+
+// SetMaxConcurrency changes the number of queries each caller can
+// run at the same time. 0 means unlimited.
+func (cq *CallerQuotas) SetMaxConcurrency(max int) {
+	cq.maxConcurrency.Set(int64(max))
+}
+
+// SetMaxQPS changes the number of queries each caller can start
+// per second. 0 means unlimited.
+func (cq *CallerQuotas) SetMaxQPS(max int) {
+	cq.maxQPS.Set(int64(max))
+}
+
+// Acquire counts a query of caller against its quotas, and returns
+// the name it's counted under: caller, or otherCallers if too many
+// callers are already tracked. It fails if that name is over one of
+// the quotas. Every successful Acquire must be followed by a Release
+// of the name.
+func (cq *CallerQuotas) Acquire(caller string) (string, error) {
+	now := time.Now().Unix()
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+	if cq.pruned != now {
+		cq.prune(now)
+	}
+	q, ok := cq.callers[caller]
+	if !ok {
+		if len(cq.callers) >= cq.maxCallers {
+			caller = otherCallers
+			q, ok = cq.callers[caller]
+		}
+		if !ok {
+			q = &callerQuota{}
+			cq.callers[caller] = q
+		}
+	}
+	if q.second != now {
+		q.second = now
+		q.count = 0
+	}
+	if max := cq.maxConcurrency.Get(); max > 0 && q.inFlight >= max {
+		cq.rejections.Add(caller, 1)
+		return "", NewTabletError(QUOTA_EXCEEDED, "%s has %d queries running, the limit is %d", caller, q.inFlight, max)
+	}
+	if max := cq.maxQPS.Get(); max > 0 && q.count >= max {
+		cq.rejections.Add(caller, 1)
+		return "", NewTabletError(QUOTA_EXCEEDED, "%s started %d queries this second, the limit is %d", caller, q.count, max)
+	}
+	q.inFlight++
+	q.count++
+	return caller, nil
+}
+
+// Release ends a query counted under name by a successful Acquire.
+func (cq *CallerQuotas) Release(name string) {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+	if q, ok := cq.callers[name]; ok {
+		q.inFlight--
+	}
+}
+
+// prune removes the callers that have no query running,
+// and did not start any during the current second.
+func (cq *CallerQuotas) prune(now int64) {
+	for caller, q := range cq.callers {
+		if q.inFlight == 0 && q.second != now {
+			delete(cq.callers, caller)
+		}
+	}
+	cq.pruned = now
+}
+
+// inFlight returns the number of queries caller is running.
+func (cq *CallerQuotas) inFlight(caller string) int64 {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+	if q, ok := cq.callers[caller]; ok {
+		return q.inFlight
+	}
+	return 0
+}
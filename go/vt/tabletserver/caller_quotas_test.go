@@ -0,0 +1,106 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+func TestCallerQuotasConcurrency(t *testing.T) {
+	cq := NewCallerQuotas("", 2, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := cq.Acquire("a"); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+	_, err := cq.Acquire("a")
+	if terr, ok := err.(*TabletError); !ok || terr.ErrorType != QUOTA_EXCEEDED {
+		t.Errorf("Acquire over the concurrency quota: %v, want quota_exceeded", err)
+	}
+	if cq.rejections.Counts()["a"] != 1 {
+		t.Errorf("rejections: %v, want 1 for a", cq.rejections.Counts())
+	}
+	// Other callers are independent.
+	if _, err := cq.Acquire("b"); err != nil {
+		t.Errorf("Acquire of another caller: %v", err)
+	}
+	cq.Release("b")
+
+	cq.Release("a")
+	if _, err := cq.Acquire("a"); err != nil {
+		t.Errorf("Acquire after Release: %v", err)
+	}
+	cq.Release("a")
+	cq.Release("a")
+	if n := cq.inFlight("a"); n != 0 {
+		t.Errorf("inFlight: %d, want 0", n)
+	}
+
+	cq.SetMaxConcurrency(0)
+	for i := 0; i < 10; i++ {
+		if _, err := cq.Acquire("a"); err != nil {
+			t.Fatalf("Acquire without quota: %v", err)
+		}
+	}
+}
+
+func TestCallerQuotasQPS(t *testing.T) {
+	cq := NewCallerQuotas("", 0, 3)
+	for i := 0; i < 3; i++ {
+		if _, err := cq.Acquire("a"); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+		cq.Release("a")
+	}
+	// The count is reset every second: the next queries
+	// fail unless the test starts a new second.
+	for i := 0; i < 100; i++ {
+		if _, err := cq.Acquire("a"); err != nil {
+			return
+		}
+		cq.Release("a")
+	}
+	t.Errorf("Acquire never exceeded the QPS quota")
+}
+
+func TestCallerQuotasMaxCallers(t *testing.T) {
+	cq := NewCallerQuotas("", 1, 0)
+	cq.maxCallers = 2
+	for _, caller := range []string{"a", "b"} {
+		if name, err := cq.Acquire(caller); err != nil || name != caller {
+			t.Fatalf("Acquire(%v) = %v, %v, want %v", caller, name, err, caller)
+		}
+	}
+	// The next callers share the quotas of otherCallers.
+	if name, err := cq.Acquire("c"); err != nil || name != otherCallers {
+		t.Fatalf("Acquire(c) = %v, %v, want %v", name, err, otherCallers)
+	}
+	if _, err := cq.Acquire("d"); err == nil {
+		t.Errorf("Acquire(d) succeeded while c uses the concurrency quota of %v", otherCallers)
+	}
+	if cq.rejections.Counts()[otherCallers] != 1 {
+		t.Errorf("rejections: %v, want 1 for %v", cq.rejections.Counts(), otherCallers)
+	}
+	cq.Release(otherCallers)
+	if n := cq.inFlight(otherCallers); n != 0 {
+		t.Errorf("inFlight: %d, want 0", n)
+	}
+	if len(cq.callers) != 3 {
+		t.Errorf("callers: %v, want a, b and %v", cq.callers, otherCallers)
+	}
+}
+
+func TestEffectiveCaller(t *testing.T) {
+	logStats := newSqlQueryStats("Execute", &context.DummyContext{})
+	if got, want := logStats.EffectiveCaller(), logStats.ImmediateCaller(); got != want {
+		t.Errorf("EffectiveCaller without caller id: %q, want %q", got, want)
+	}
+	logStats.callerID = "service"
+	if got := logStats.EffectiveCaller(); got != "service" {
+		t.Errorf("EffectiveCaller: %q, want service", got)
+	}
+}
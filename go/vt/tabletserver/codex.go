@@ -164,6 +164,24 @@ func buildKey(row []sqltypes.Value) (key string) {
 	return buf.String()
 }
 
+// uniquePKRows returns pkRows without the rows that have the same key
+// as a previous one, and the keys of the rows it returns.
+func uniquePKRows(pkRows [][]sqltypes.Value) (unique [][]sqltypes.Value, keys []string) {
+	unique = make([][]sqltypes.Value, 0, len(pkRows))
+	keys = make([]string, 0, len(pkRows))
+	seen := make(map[string]bool, len(pkRows))
+	for _, pk := range pkRows {
+		key := buildKey(pk)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, pk)
+		keys = append(keys, key)
+	}
+	return unique, keys
+}
+
 func buildStreamComment(tableInfo *TableInfo, pkValueList [][]sqltypes.Value, secondaryList [][]sqltypes.Value) []byte {
 	buf := bytes.NewBuffer(make([]byte, 0, 256))
 	fmt.Fprintf(buf, " /* _stream %s (", tableInfo.Name)
@@ -127,6 +127,32 @@ func TestBuildSecondaryList(t *testing.T) {
 	}
 }
 
+func TestUniquePKRows(t *testing.T) {
+	one, _ := sqltypes.BuildValue(1)
+	two, _ := sqltypes.BuildValue(2)
+	abc, _ := sqltypes.BuildValue("abc")
+	pkRows := [][]sqltypes.Value{
+		{one, abc},
+		{two, abc},
+		{one, abc},
+		{one, two},
+		{two, abc},
+	}
+	got, keys := uniquePKRows(pkRows)
+	want := [][]sqltypes.Value{
+		{one, abc},
+		{two, abc},
+		{one, two},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uniquePKRows: got %v, want %v", got, want)
+	}
+	wantKeys := []string{buildKey(want[0]), buildKey(want[1]), buildKey(want[2])}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("uniquePKRows keys: got %v, want %v", keys, wantKeys)
+	}
+}
+
 func TestBuildStreamComment(t *testing.T) {
 	pk1 := "pk1"
 	pk2 := "pk2"
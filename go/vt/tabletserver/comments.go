@@ -5,11 +5,19 @@
 package tabletserver
 
 import (
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
 const TRAILING_COMMENT = "_trailingComment"
 
+// BATCH_DIRECTIVE in the trailing comments of a select
+// runs it in the batch pool, like the Batch field of the query.
+const BATCH_DIRECTIVE = "vt_batch"
+
 type matchtracker struct {
 	query string
 	index int
@@ -30,6 +38,60 @@ func stripTrailing(query *proto.Query) {
 	}
 }
 
+// hasBatchDirective returns true if the trailing comments stripped
+// by stripTrailing contain BATCH_DIRECTIVE.
+func hasBatchDirective(bindVars map[string]interface{}) bool {
+	comment, ok := bindVars[TRAILING_COMMENT].(string)
+	return ok && strings.Contains(comment, BATCH_DIRECTIVE)
+}
+
+// applyDirectives applies to the request of logStats the directives
+// of its plan, and those of the trailing comments stripped by
+// stripTrailing, which take precedence. It returns true if the query
+// must run in the batch pool.
+func applyDirectives(logStats *SQLQueryStats, planDirectives sqlparser.Directives, bindVars map[string]interface{}) (batch bool) {
+	directives := planDirectives
+	if comment, ok := bindVars[TRAILING_COMMENT].(string); ok && strings.Contains(comment, sqlparser.DIRECTIVE_PREFIX) {
+		directives = make(sqlparser.Directives)
+		for name, val := range planDirectives {
+			directives[name] = val
+		}
+		for name, val := range sqlparser.ExtractDirectives(sqlparser.SplitComments(comment)) {
+			directives[name] = val
+		}
+	}
+	if directives == nil {
+		return false
+	}
+	timeout, err := directives.GetInt(sqlparser.DIRECTIVE_QUERY_TIMEOUT, 0)
+	if err != nil || timeout < 0 {
+		panic(NewTabletError(FAIL, "invalid %s directive: %s", sqlparser.DIRECTIVE_QUERY_TIMEOUT, directives[sqlparser.DIRECTIVE_QUERY_TIMEOUT]))
+	}
+	if timeout > 0 {
+		logStats.queryTimeout = time.Duration(timeout) * time.Millisecond
+	}
+	maxRows, err := directives.GetInt(sqlparser.DIRECTIVE_MAX_ROWS, 0)
+	if err != nil || maxRows < 0 {
+		panic(NewTabletError(FAIL, "invalid %s directive: %s", sqlparser.DIRECTIVE_MAX_ROWS, directives[sqlparser.DIRECTIVE_MAX_ROWS]))
+	}
+	logStats.maxRows = maxRows
+	logStats.skipRowcache = directives.IsSet(sqlparser.DIRECTIVE_SKIP_ROWCACHE)
+	switch priority := strings.ToLower(directives[sqlparser.DIRECTIVE_PRIORITY]); priority {
+	case "", sqlparser.PRIORITY_LOW, sqlparser.PRIORITY_NORMAL, sqlparser.PRIORITY_HIGH:
+		logStats.priority = priority
+	default:
+		panic(NewTabletError(FAIL, "invalid %s directive: %s", sqlparser.DIRECTIVE_PRIORITY, priority))
+	}
+	switch workload := directives[sqlparser.DIRECTIVE_WORKLOAD]; strings.ToLower(workload) {
+	case "", sqlparser.WORKLOAD_OLTP:
+		return false
+	case sqlparser.WORKLOAD_OLAP:
+		return true
+	default:
+		panic(NewTabletError(FAIL, "invalid %s directive: %s", sqlparser.DIRECTIVE_WORKLOAD, workload))
+	}
+}
+
 // restoreTrailing undoes work done by stripTrailing
 func restoreTrailing(sql []byte, bindVars map[string]interface{}) []byte {
 	if ytcomment, ok := bindVars[TRAILING_COMMENT]; ok {
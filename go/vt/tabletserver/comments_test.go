@@ -7,7 +7,10 @@ package tabletserver
 import (
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
@@ -85,3 +88,57 @@ func TestComments(t *testing.T) {
 		}
 	}
 }
+
+func TestBatchDirective(t *testing.T) {
+	for input, want := range map[string]bool{
+		"select * from a":                            false,
+		"select * from a /* vt_batch */":             true,
+		"select * from a /* foo */ /* vt_batch */":   true,
+		"select * from a where b = 'vt_batch'":       false,
+		"select * from a /* vt_batch */ where b = 1": false,
+	} {
+		query := proto.Query{
+			Sql:           input,
+			BindVariables: make(map[string]interface{}),
+		}
+		stripTrailing(&query)
+		if got := hasBatchDirective(query.BindVariables); got != want {
+			t.Errorf("hasBatchDirective(%q): %v, want %v", input, got, want)
+		}
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	query := proto.Query{
+		Sql:           "select * from a /*vt+ MAX_ROWS=5 WORKLOAD=OLAP */",
+		BindVariables: make(map[string]interface{}),
+	}
+	stripTrailing(&query)
+	planDirectives := sqlparser.Directives{"MAX_ROWS": "10", "QUERY_TIMEOUT_MS": "100", "SKIP_ROWCACHE": "true", "PRIORITY": "LOW"}
+	logStats := newSqlQueryStats("Execute", &context.DummyContext{})
+	if batch := applyDirectives(logStats, planDirectives, query.BindVariables); !batch {
+		t.Errorf("applyDirectives with WORKLOAD=OLAP: false, want true")
+	}
+	if logStats.maxRows != 5 {
+		t.Errorf("maxRows: %d, want 5 from the trailing comment", logStats.maxRows)
+	}
+	if logStats.queryTimeout != 100*time.Millisecond {
+		t.Errorf("queryTimeout: %v, want 100ms", logStats.queryTimeout)
+	}
+	if !logStats.skipRowcache {
+		t.Errorf("skipRowcache: false, want true")
+	}
+	if logStats.priority != "low" {
+		t.Errorf("priority: %q, want low", logStats.priority)
+	}
+	if planDirectives["MAX_ROWS"] != "10" {
+		t.Errorf("plan directives were changed: %v", planDirectives)
+	}
+
+	defer func() {
+		if x := recover(); x == nil {
+			t.Errorf("applyDirectives with an invalid MAX_ROWS did not fail")
+		}
+	}()
+	applyDirectives(logStats, sqlparser.Directives{"MAX_ROWS": "many"}, map[string]interface{}{})
+}
@@ -1,11 +1,11 @@
 package tabletserver
 
 import (
-	"fmt"
 	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
 )
 
 // ConnectionKiller is used for killing MySQL connections
@@ -36,9 +36,8 @@ func (ck *ConnectionKiller) Kill(connID int64) error {
 	log.Infof("killing query %d", connID)
 	killConn := getOrPanic(ck.connPool)
 	defer killConn.Recycle()
-	sql := fmt.Sprintf("kill %d", connID)
-	var err error
-	if _, err = killConn.ExecuteFetch(sql, 10000, false); err != nil {
+	err := mysqlctl.KillQuery(killConn, connID, true /*connection*/)
+	if err != nil {
 		log.Errorf("Could not kill query %d: %v", connID, err)
 	}
 	return err
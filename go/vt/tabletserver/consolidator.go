@@ -14,6 +14,9 @@ import (
 	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/cache"
 	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
 )
 
 var (
@@ -21,20 +24,38 @@ var (
 )
 
 // Consolidator consolidates duplicate queries from executing simulaneously
-// and shares results between them.
+// and shares results between them. Queries are duplicates if their
+// final SQL, with the bind variables substituted, is the same. Only
+// the selects that run outside of transactions are consolidated.
 type Consolidator struct {
 	mu             sync.Mutex
 	queries        map[string]*Result
 	consolidations *cache.LRUCache
+	// waits counts the queries that waited for a duplicate
+	// instead of going to MySQL.
+	waits sync2.AtomicInt64
 }
 
-// NewConsolidator creates a new Consolidator
-func NewConsolidator() *Consolidator {
+// NewConsolidator creates a new Consolidator. If name is empty,
+// its stats are not exported.
+func NewConsolidator(name string) *Consolidator {
 	co := &Consolidator{queries: make(map[string]*Result), consolidations: cache.NewLRUCache(1000)}
+	if name != "" {
+		stats.Publish(name+"Waits", stats.IntFunc(co.waits.Get))
+		stats.Publish(name+"Queries", stats.IntFunc(co.length))
+	}
 	http.Handle("/debug/consolidations", co)
 	return co
 }
 
+// length returns the number of queries being executed
+// that duplicates can wait for.
+func (co *Consolidator) length() int64 {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return int64(len(co.queries))
+}
+
 // Result is a wrapper for QueryResult of a query.
 type Result struct {
 	executing    sync.RWMutex
@@ -100,6 +121,7 @@ func (rs *Result) Broadcast() {
 // Wait waits for the original query to complete execution. Wait should
 // be invoked for duplicate queries.
 func (rs *Result) Wait() {
+	rs.consolidator.waits.Add(1)
 	rs.consolidator.record(rs.sql)
 	defer waitStats.Record("Consolidations", time.Now())
 	rs.executing.RLock()
@@ -122,3 +144,56 @@ func (cc *ccount) Set(n int64) {
 func (cc *ccount) Get() int64 {
 	return atomic.LoadInt64((*int64)(cc))
 }
+
+// FillConsolidator consolidates the concurrent rowcache fills
+// of the same row, so only one of them reads it from the db.
+type FillConsolidator struct {
+	mu    sync.Mutex
+	fills map[string]*Fill
+}
+
+// NewFillConsolidator creates a new FillConsolidator.
+func NewFillConsolidator() *FillConsolidator {
+	return &FillConsolidator{fills: make(map[string]*Fill)}
+}
+
+// Fill is the result of reading a row for the rowcache.
+// Row is nil if the row doesn't exist.
+type Fill struct {
+	executing sync.RWMutex
+	fc        *FillConsolidator
+	key       string
+	Row       []sqltypes.Value
+	Err       error
+}
+
+// Create adds key to the rows being filled and acquires a lock
+// on its Fill if it is not already present. If the row is already
+// being filled, Create returns false.
+func (fc *FillConsolidator) Create(key string) (f *Fill, created bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if f, ok := fc.fills[key]; ok {
+		return f, false
+	}
+	// Preset the error, for the same reason as Consolidator.Create.
+	f = &Fill{fc: fc, key: key, Err: waitError}
+	f.executing.Lock()
+	fc.fills[key] = f
+	return f, true
+}
+
+// Broadcast removes the fill from the current fills and releases
+// the lock on it. Broadcast should be invoked when the row was read.
+func (f *Fill) Broadcast() {
+	f.fc.mu.Lock()
+	defer f.fc.mu.Unlock()
+	delete(f.fc.fills, f.key)
+	f.executing.Unlock()
+}
+
+// Wait waits for the original fill to complete.
+func (f *Fill) Wait() {
+	defer waitStats.Record("RowcacheFills", time.Now())
+	f.executing.RLock()
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
 )
 
 func TestConsolidator(t *testing.T) {
@@ -29,6 +30,12 @@ func TestConsolidator(t *testing.T) {
 	if orig.Result.InsertId != dup.Result.InsertId {
 		t.Errorf("failed to share the result")
 	}
+	if waits := qe.consolidator.waits.Get(); waits != 1 {
+		t.Errorf("waits: %d, want 1", waits)
+	}
+	if n := qe.consolidator.length(); n != 0 {
+		t.Errorf("length after Broadcast: %d, want 0", n)
+	}
 
 	// Running the query again should add a new entry since the original
 	// query execution completed
@@ -36,4 +43,37 @@ func TestConsolidator(t *testing.T) {
 	if !added {
 		t.Errorf("expected consolidator to register a new entry")
 	}
+
+	testFillConsolidator(t, qe.fills)
+}
+
+func testFillConsolidator(t *testing.T, fc *FillConsolidator) {
+	key := "vtocc_cached.1"
+	orig, added := fc.Create(key)
+	if !added {
+		t.Errorf("expected fill consolidator to register a new entry")
+	}
+	dup, added := fc.Create(key)
+	if added {
+		t.Errorf("did not expect fill consolidator to register a new entry")
+	}
+	if dup.Err == nil {
+		t.Errorf("expected a waiting fill to fail until it's broadcast")
+	}
+
+	go func() {
+		orig.Row = []sqltypes.Value{sqltypes.MakeString([]byte("1"))}
+		orig.Err = nil
+		orig.Broadcast()
+	}()
+	dup.Wait()
+
+	if dup.Err != nil || len(dup.Row) != 1 || dup.Row[0].String() != "1" {
+		t.Errorf("failed to share the row: %v, %v", dup.Row, dup.Err)
+	}
+
+	_, added = fc.Create(key)
+	if !added {
+		t.Errorf("expected fill consolidator to register a new entry")
+	}
 }
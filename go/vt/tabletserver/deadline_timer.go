@@ -0,0 +1,94 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/timer"
+)
+
+// deadlineTimer triggers ticks at the earliest deadline it was given,
+// with a single timer, for the queries and transactions whose timeout
+// is shorter than the interval of ticks. Once triggered, the caller
+// schedules its next earliest deadline again.
+type deadlineTimer struct {
+	ticks *timer.Timer
+
+	mu    sync.Mutex
+	timer *time.Timer
+	// next is the deadline timer fires at, or zero if it's stopped.
+	next time.Time
+}
+
+func newDeadlineTimer(ticks *timer.Timer) *deadlineTimer {
+	return &deadlineTimer{ticks: ticks}
+}
+
+// Schedule makes the timer trigger ticks at deadline, unless it's
+// already scheduled to trigger them before.
+func (dt *deadlineTimer) Schedule(deadline time.Time) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if !dt.next.IsZero() && !deadline.Before(dt.next) {
+		return
+	}
+	dt.next = deadline
+	if dt.timer == nil {
+		dt.timer = time.AfterFunc(deadline.Sub(time.Now()), dt.fire)
+	} else {
+		dt.timer.Reset(deadline.Sub(time.Now()))
+	}
+}
+
+// Stop cancels the scheduled deadline.
+func (dt *deadlineTimer) Stop() {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if dt.timer != nil {
+		dt.timer.Stop()
+	}
+	dt.next = time.Time{}
+}
+
+func (dt *deadlineTimer) fire() {
+	dt.mu.Lock()
+	dt.next = time.Time{}
+	dt.mu.Unlock()
+	dt.ticks.Trigger()
+}
+
+// effectiveTimeout returns the timeout of a query or transaction: its
+// own timeout, capped by the timeout of its pool, or the timeout of
+// its pool if it has none. Zero means it has no timeout.
+func effectiveTimeout(timeout, poolTimeout time.Duration) time.Duration {
+	if timeout == 0 || (poolTimeout > 0 && timeout > poolTimeout) {
+		return poolTimeout
+	}
+	return timeout
+}
+
+// earliestDeadline tracks the earliest deadline of the queries or
+// transactions a killer pass didn't kill.
+type earliestDeadline struct {
+	now      time.Time
+	earliest time.Time
+}
+
+// add records the deadline of a query or transaction of age and
+// timeout, and returns true if it was reached.
+func (ed *earliestDeadline) add(age, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+	if age >= timeout {
+		return true
+	}
+	if deadline := ed.now.Add(timeout - age); ed.earliest.IsZero() || deadline.Before(ed.earliest) {
+		ed.earliest = deadline
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+)
+
+func TestDeadlineTimer(t *testing.T) {
+	var count sync2.AtomicInt64
+	ticks := timer.NewTimer(0)
+	ticks.Start(func() { count.Add(1) })
+	defer ticks.Stop()
+	dt := newDeadlineTimer(ticks)
+
+	// A later deadline doesn't delay the earliest one.
+	start := time.Now()
+	dt.Schedule(start.Add(time.Hour))
+	dt.Schedule(start.Add(10 * time.Millisecond))
+	dt.Schedule(start.Add(time.Minute))
+	for count.Get() == 0 {
+		if time.Now().Sub(start) > 5*time.Second {
+			t.Fatalf("the deadline didn't trigger the ticks")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Now().Sub(start); elapsed < 10*time.Millisecond {
+		t.Errorf("the ticks triggered after %v, want 10ms", elapsed)
+	}
+
+	// Once triggered, the timer is rescheduled by the next deadline.
+	dt.Schedule(time.Now().Add(10 * time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	if got := count.Get(); got != 2 {
+		t.Errorf("count: %d, want 2", got)
+	}
+
+	dt.Schedule(time.Now().Add(10 * time.Millisecond))
+	dt.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if got := count.Get(); got != 2 {
+		t.Errorf("count after Stop: %d, want 2", got)
+	}
+}
+
+func TestEffectiveTimeout(t *testing.T) {
+	testcases := []struct {
+		timeout, poolTimeout, want time.Duration
+	}{
+		{0, 0, 0},
+		{0, time.Second, time.Second},
+		{time.Millisecond, time.Second, time.Millisecond},
+		{time.Minute, time.Second, time.Second},
+		{time.Minute, 0, time.Minute},
+	}
+	for _, tc := range testcases {
+		if got := effectiveTimeout(tc.timeout, tc.poolTimeout); got != tc.want {
+			t.Errorf("effectiveTimeout(%v, %v): %v, want %v", tc.timeout, tc.poolTimeout, got, tc.want)
+		}
+	}
+}
+
+func TestEarliestDeadline(t *testing.T) {
+	now := time.Now()
+	next := earliestDeadline{now: now}
+	if !next.add(time.Second, time.Second) {
+		t.Errorf("add of a reached deadline: false, want true")
+	}
+	if next.add(time.Second, 0) || next.add(time.Second, 3*time.Second) || next.add(0, 5*time.Second) {
+		t.Errorf("add of an unreached deadline: true, want false")
+	}
+	if want := now.Add(2 * time.Second); !next.earliest.Equal(want) {
+		t.Errorf("earliest: %v, want %v", next.earliest, want)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+)
+
+// fakeDB is the MySQL of the fake connections of its pools: it
+// answers their queries with the results, errors and delays it was
+// given, an empty result by default, and records them.
+type fakeDB struct {
+	mu      sync.Mutex
+	nextID  int64
+	results map[string]*mproto.QueryResult
+	errors  map[string]error
+	delays  map[string]time.Duration
+	queries []string
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		results: make(map[string]*mproto.QueryResult),
+		errors:  make(map[string]error),
+		delays:  make(map[string]time.Duration),
+	}
+}
+
+// AddQuery makes query return qr.
+func (db *fakeDB) AddQuery(query string, qr *mproto.QueryResult) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.results[query] = qr
+}
+
+// AddError makes query fail with err.
+func (db *fakeDB) AddError(query string, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.errors[query] = err
+}
+
+// AddDelay makes query run for delay.
+func (db *fakeDB) AddDelay(query string, delay time.Duration) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.delays[query] = delay
+}
+
+// Queries returns the queries run since the last call.
+func (db *fakeDB) Queries() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	queries := db.queries
+	db.queries = nil
+	return queries
+}
+
+// newPool returns an open pool of capacity connections to db.
+func (db *fakeDB) newPool(capacity int) *dbconnpool.ConnectionPool {
+	pool := dbconnpool.NewConnectionPool("", capacity, time.Minute)
+	pool.Open(func(pool *dbconnpool.ConnectionPool) (dbconnpool.PoolConnection, error) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		db.nextID++
+		return &fakeDBConn{db: db, id: db.nextID, pool: pool}, nil
+	})
+	return pool
+}
+
+// fakeDBConn is a PoolConnection to a fakeDB.
+type fakeDBConn struct {
+	db     *fakeDB
+	id     int64
+	pool   *dbconnpool.ConnectionPool
+	closed bool
+}
+
+func (fc *fakeDBConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	fc.db.mu.Lock()
+	fc.db.queries = append(fc.db.queries, query)
+	qr, err, delay := fc.db.results[query], fc.db.errors[query], fc.db.delays[query]
+	fc.db.mu.Unlock()
+	time.Sleep(delay)
+	if err != nil {
+		return nil, err
+	}
+	if qr == nil {
+		return &mproto.QueryResult{}, nil
+	}
+	if len(qr.Rows) > maxrows {
+		return nil, mysql.NewSqlError(0, "Row count exceeded %d", maxrows)
+	}
+	return qr, nil
+}
+
+func (fc *fakeDBConn) ExecuteStreamFetch(query string, callback func(*mproto.QueryResult) error, streamBufferSize, streamBufferRows int) error {
+	qr, err := fc.ExecuteFetch(query, 1<<31, true)
+	if err != nil {
+		return err
+	}
+	return callback(qr)
+}
+
+func (fc *fakeDBConn) Id() int64      { return fc.id }
+func (fc *fakeDBConn) Close()         { fc.closed = true }
+func (fc *fakeDBConn) IsClosed() bool { return fc.closed }
+
+func (fc *fakeDBConn) Recycle() {
+	if fc.closed {
+		fc.pool.Put(nil)
+	} else {
+		fc.pool.Put(fc)
+	}
+}
@@ -46,6 +46,98 @@ func (sq *SqlQuery) ExecuteBatch(ctx *rpcproto.Context, queryList *proto.QueryLi
 	return sq.server.ExecuteBatch(ctx, queryList, reply)
 }
 
+func (sq *SqlQuery) Prepare(ctx *rpcproto.Context, request *proto.PrepareRequest, reply *proto.PreparedStatement) error {
+	return sq.server.Prepare(ctx, request, reply)
+}
+
+func (sq *SqlQuery) ReserveConnection(ctx *rpcproto.Context, session *proto.Session, reply *proto.ReservedSession) error {
+	return sq.server.ReserveConnection(ctx, session, reply)
+}
+
+func (sq *SqlQuery) ReleaseConnection(ctx *rpcproto.Context, request *proto.ReservedSession, noOutput *string) error {
+	return sq.server.ReleaseConnection(ctx, request)
+}
+
+func (sq *SqlQuery) ExplainQuery(ctx *rpcproto.Context, request *proto.ExplainRequest, reply *proto.QueryExplanation) error {
+	return sq.server.ExplainQuery(ctx, request, reply)
+}
+
+func (sq *SqlQuery) ExecutePrepared(ctx *rpcproto.Context, query *proto.PreparedQuery, reply *mproto.QueryResult) error {
+	return sq.server.ExecutePrepared(ctx, query, reply)
+}
+
+func (sq *SqlQuery) ClosePrepared(ctx *rpcproto.Context, statement *proto.PreparedStatement, noOutput *string) error {
+	return sq.server.ClosePrepared(ctx, statement)
+}
+
+func (sq *SqlQuery) PrepareTransaction(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.PrepareTransaction(ctx, request)
+}
+
+func (sq *SqlQuery) CommitPrepared(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.CommitPrepared(ctx, request)
+}
+
+func (sq *SqlQuery) RollbackPrepared(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.RollbackPrepared(ctx, request)
+}
+
+func (sq *SqlQuery) CreateTransaction(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.CreateTransaction(ctx, request)
+}
+
+func (sq *SqlQuery) StartCommit(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.StartCommit(ctx, request)
+}
+
+func (sq *SqlQuery) SetRollback(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.SetRollback(ctx, request)
+}
+
+func (sq *SqlQuery) ConcludeTransaction(ctx *rpcproto.Context, request *proto.TwoPCRequest, noOutput *string) error {
+	return sq.server.ConcludeTransaction(ctx, request)
+}
+
+func (sq *SqlQuery) ReadAbandoned(ctx *rpcproto.Context, request *proto.AbandonedRequest, reply *proto.AbandonedResult) error {
+	return sq.server.ReadAbandoned(ctx, request, reply)
+}
+
+func (sq *SqlQuery) ReplicationPosition(ctx *rpcproto.Context, session *proto.Session, reply *proto.ReplicationPositionResult) error {
+	return sq.server.ReplicationPosition(ctx, session, reply)
+}
+
+func (sq *SqlQuery) NextVal(ctx *rpcproto.Context, request *proto.NextValRequest, reply *proto.NextValResult) error {
+	return sq.server.NextVal(ctx, request, reply)
+}
+
+func (sq *SqlQuery) MessageStream(ctx *rpcproto.Context, request *proto.MessageStreamRequest, sendReply func(reply interface{}) error) error {
+	return sq.server.MessageStream(ctx, request, func(reply *mproto.QueryResult) error {
+		return sendReply(reply)
+	})
+}
+
+func (sq *SqlQuery) MessageAck(ctx *rpcproto.Context, request *proto.MessageAckRequest, reply *proto.MessageAckResult) error {
+	return sq.server.MessageAck(ctx, request, reply)
+}
+
+func (sq *SqlQuery) StreamHealth(ctx *rpcproto.Context, noInput *string, sendReply func(reply interface{}) error) error {
+	return sq.server.StreamHealth(ctx, func(reply *proto.HealthStats) error {
+		return sendReply(reply)
+	})
+}
+
+func (sq *SqlQuery) GetQueryPlans(ctx *rpcproto.Context, request *proto.QueryPlanRequest, reply *proto.QueryPlanList) error {
+	return sq.server.GetQueryPlans(ctx, request, reply)
+}
+
+func (sq *SqlQuery) EvictQueryPlan(ctx *rpcproto.Context, request *proto.QueryPlanRequest, noOutput *string) error {
+	return sq.server.EvictQueryPlan(ctx, request)
+}
+
+func (sq *SqlQuery) ClearQueryPlans(ctx *rpcproto.Context, noInput *string, noOutput *string) error {
+	return sq.server.ClearQueryPlans(ctx)
+}
+
 func init() {
 	tabletserver.SqlQueryRegisterFunctions = append(tabletserver.SqlQueryRegisterFunctions, func(sq *tabletserver.SqlQuery) {
 		rpcwrap.RegisterAuthenticated(&SqlQuery{sq})
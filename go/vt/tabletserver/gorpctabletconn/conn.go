@@ -16,6 +16,7 @@ import (
 	"github.com/youtube/vitess/go/rpcplus"
 	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
 	"github.com/youtube/vitess/go/vt/context"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/rpc"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
@@ -36,30 +37,16 @@ func init() {
 type TabletBson struct {
 	mu        sync.RWMutex
 	endPoint  topo.EndPoint
+	timeout   time.Duration
 	rpcClient *rpcplus.Client
 	sessionID int64
 }
 
 // DialTablet creates and initializes TabletBson.
 func DialTablet(context context.Context, endPoint topo.EndPoint, keyspace, shard string, timeout time.Duration) (tabletconn.TabletConn, error) {
-	var addr string
-	var config *tls.Config
-	if *tabletBsonEncrypted {
-		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vts"])
-		config = &tls.Config{}
-		config.InsecureSkipVerify = true
-	} else {
-		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vtocc"])
-	}
-
-	conn := &TabletBson{endPoint: endPoint}
+	conn := &TabletBson{endPoint: endPoint, timeout: timeout}
 	var err error
-	if *tabletBsonUsername != "" {
-		conn.rpcClient, err = bsonrpc.DialAuthHTTP("tcp", addr, *tabletBsonUsername, *tabletBsonPassword, timeout, config)
-	} else {
-		conn.rpcClient, err = bsonrpc.DialHTTP("tcp", addr, timeout, config)
-	}
-	if err != nil {
+	if conn.rpcClient, err = dial(endPoint, timeout); err != nil {
 		return nil, tabletError(err)
 	}
 
@@ -72,6 +59,23 @@ func DialTablet(context context.Context, endPoint topo.EndPoint, keyspace, shard
 	return conn, nil
 }
 
+// dial opens an rpc connection to the tablet of endPoint.
+func dial(endPoint topo.EndPoint, timeout time.Duration) (*rpcplus.Client, error) {
+	var addr string
+	var config *tls.Config
+	if *tabletBsonEncrypted {
+		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vts"])
+		config = &tls.Config{}
+		config.InsecureSkipVerify = true
+	} else {
+		addr = fmt.Sprintf("%v:%v", endPoint.Host, endPoint.NamedPortMap["_vtocc"])
+	}
+	if *tabletBsonUsername != "" {
+		return bsonrpc.DialAuthHTTP("tcp", addr, *tabletBsonUsername, *tabletBsonPassword, timeout, config)
+	}
+	return bsonrpc.DialHTTP("tcp", addr, timeout, config)
+}
+
 // Execute sends the query to VTTablet.
 func (conn *TabletBson) Execute(context context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*mproto.QueryResult, error) {
 	conn.mu.RLock()
@@ -113,8 +117,10 @@ func (conn *TabletBson) ExecuteBatch(context context.Context, queries []tproto.B
 	return qrs, nil
 }
 
-// StreamExecute starts a streaming query to VTTablet.
-func (conn *TabletBson) StreamExecute(context context.Context, query string, bindVars map[string]interface{}, transactionID int64) (<-chan *mproto.QueryResult, tabletconn.ErrFunc) {
+// StreamExecute starts a streaming query to VTTablet. If context can
+// be canceled, the query is streamed on its own rpc connection, which
+// is closed when context is canceled: the tablet then stops the query.
+func (conn *TabletBson) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (<-chan *mproto.QueryResult, tabletconn.ErrFunc) {
 	conn.mu.RLock()
 	defer conn.mu.RUnlock()
 	if conn.rpcClient == nil {
@@ -129,11 +135,65 @@ func (conn *TabletBson) StreamExecute(context context.Context, query string, bin
 		TransactionId: transactionID,
 		SessionId:     conn.sessionID,
 	}
+	rpcClient := conn.rpcClient
+	done := context.Done(ctx)
+	if done != nil {
+		var err error
+		if rpcClient, err = dial(conn.endPoint, conn.timeout); err != nil {
+			sr := make(chan *mproto.QueryResult, 1)
+			close(sr)
+			return sr, func() error { return tabletError(err) }
+		}
+	}
 	sr := make(chan *mproto.QueryResult, 10)
-	c := conn.rpcClient.StreamGo("SqlQuery.StreamExecute", req, sr)
+	if done == nil {
+		c := rpcClient.StreamGo("SqlQuery.StreamExecute", req, sr)
+		return sr, func() error { return tabletError(c.Error) }
+	}
+	results := make(chan *mproto.QueryResult, 10)
+	c := rpcClient.StreamGo("SqlQuery.StreamExecute", req, results)
+	go func() {
+		defer close(sr)
+		defer rpcClient.Close()
+		for {
+			select {
+			case qr, ok := <-results:
+				if !ok {
+					return
+				}
+				select {
+				case sr <- qr:
+					continue
+				case <-done:
+				}
+			case <-done:
+			}
+			// The rpc client must not block on the results
+			// until it's closed.
+			rpcClient.Close()
+			for _ = range results {
+			}
+			return
+		}
+	}()
 	return sr, func() error { return tabletError(c.Error) }
 }
 
+// StreamHealth starts streaming the health of VTTablet.
+func (conn *TabletBson) StreamHealth(context context.Context) (<-chan *tproto.HealthStats, tabletconn.ErrFunc) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.rpcClient == nil {
+		hs := make(chan *tproto.HealthStats, 1)
+		close(hs)
+		return hs, func() error { return tabletconn.CONN_CLOSED }
+	}
+
+	hs := make(chan *tproto.HealthStats, 10)
+	c := conn.rpcClient.StreamGo("SqlQuery.StreamHealth", "", hs)
+	return hs, func() error { return tabletError(c.Error) }
+}
+
 // Begin starts a transaction.
 func (conn *TabletBson) Begin(context context.Context) (transactionID int64, err error) {
 	conn.mu.RLock()
@@ -182,6 +242,103 @@ func (conn *TabletBson) Rollback(context context.Context, transactionID int64) e
 	return tabletError(conn.rpcClient.Call("SqlQuery.Rollback", req, &noOutput))
 }
 
+// PrepareTransaction prepares the ongoing transaction for the
+// distributed transaction dtid.
+func (conn *TabletBson) PrepareTransaction(context context.Context, transactionID int64, dtid string) error {
+	return conn.twoPC("SqlQuery.PrepareTransaction", transactionID, dtid)
+}
+
+// CommitPrepared commits the transaction prepared for dtid.
+func (conn *TabletBson) CommitPrepared(context context.Context, dtid string) error {
+	return conn.twoPC("SqlQuery.CommitPrepared", 0, dtid)
+}
+
+// RollbackPrepared rolls back the transaction prepared for dtid.
+func (conn *TabletBson) RollbackPrepared(context context.Context, dtid string) error {
+	return conn.twoPC("SqlQuery.RollbackPrepared", 0, dtid)
+}
+
+// CreateTransaction saves the transaction record of dtid.
+func (conn *TabletBson) CreateTransaction(context context.Context, dtid string, participants []tproto.TwoPCParticipant) error {
+	return conn.twoPCRequest("SqlQuery.CreateTransaction", &tproto.TwoPCRequest{
+		Dtid:         dtid,
+		Participants: participants,
+	})
+}
+
+// StartCommit records the decision to commit dtid, and commits the
+// ongoing transaction with it.
+func (conn *TabletBson) StartCommit(context context.Context, transactionID int64, dtid string) error {
+	return conn.twoPC("SqlQuery.StartCommit", transactionID, dtid)
+}
+
+// SetRollback records the decision to roll back dtid.
+func (conn *TabletBson) SetRollback(context context.Context, dtid string) error {
+	return conn.twoPC("SqlQuery.SetRollback", 0, dtid)
+}
+
+// ConcludeTransaction deletes the transaction record of dtid.
+func (conn *TabletBson) ConcludeTransaction(context context.Context, dtid string) error {
+	return conn.twoPC("SqlQuery.ConcludeTransaction", 0, dtid)
+}
+
+// ReadAbandoned returns the transaction records older than age.
+func (conn *TabletBson) ReadAbandoned(context context.Context, age time.Duration) ([]tproto.DistributedTransaction, error) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.rpcClient == nil {
+		return nil, tabletconn.CONN_CLOSED
+	}
+
+	req := &tproto.AbandonedRequest{
+		SessionId: conn.sessionID,
+		Age:       int64(age),
+	}
+	var reply tproto.AbandonedResult
+	if err := conn.rpcClient.Call("SqlQuery.ReadAbandoned", req, &reply); err != nil {
+		return nil, tabletError(err)
+	}
+	return reply.Transactions, nil
+}
+
+func (conn *TabletBson) twoPC(method string, transactionID int64, dtid string) error {
+	return conn.twoPCRequest(method, &tproto.TwoPCRequest{
+		Dtid:          dtid,
+		TransactionId: transactionID,
+	})
+}
+
+// twoPCRequest sends req, in the session of the connection.
+func (conn *TabletBson) twoPCRequest(method string, req *tproto.TwoPCRequest) error {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.rpcClient == nil {
+		return tabletconn.CONN_CLOSED
+	}
+
+	req.SessionId = conn.sessionID
+	var noOutput rpc.UnusedResponse
+	return tabletError(conn.rpcClient.Call(method, req, &noOutput))
+}
+
+// ReplicationPosition returns the replication position of the tablet.
+func (conn *TabletBson) ReplicationPosition(context context.Context) (myproto.GTID, error) {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.rpcClient == nil {
+		return nil, tabletconn.CONN_CLOSED
+	}
+
+	req := &tproto.Session{
+		SessionId: conn.sessionID,
+	}
+	var reply tproto.ReplicationPositionResult
+	if err := conn.rpcClient.Call("SqlQuery.ReplicationPosition", req, &reply); err != nil {
+		return nil, tabletError(err)
+	}
+	return reply.Position.Value, nil
+}
+
 // Close closes underlying bsonrpc.
 func (conn *TabletBson) Close() {
 	conn.mu.Lock()
@@ -217,6 +374,12 @@ func tabletError(err error) error {
 			code = tabletconn.ERR_TX_POOL_FULL
 		case strings.HasPrefix(errStr, "not_in_tx"):
 			code = tabletconn.ERR_NOT_IN_TX
+		case strings.HasPrefix(errStr, "permission_denied"):
+			code = tabletconn.ERR_PERMISSION_DENIED
+		case strings.HasPrefix(errStr, "result_too_large"):
+			code = tabletconn.ERR_RESULT_TOO_LARGE
+		case strings.HasPrefix(errStr, "quota_exceeded"):
+			code = tabletconn.ERR_QUOTA_EXCEEDED
 		default:
 			code = tabletconn.ERR_NORMAL
 		}
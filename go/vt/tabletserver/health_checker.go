@@ -0,0 +1,247 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+const healthzURL = "/healthz"
+
+// HealthChecker periodically checks the health of the tablet: whether
+// the query service is serving, whether MySQL is reachable, whether
+// its replication is running and how far behind it is, and whether
+// the rowcache can be read. The last result is served on /healthz,
+// and sent to the StreamHealth subscribers every time it's computed,
+// so load balancers and vtgates can stop sending traffic to sick
+// tablets.
+type HealthChecker struct {
+	sq    *SqlQuery
+	ticks *timer.Timer
+	// maxLag is the replication lag in seconds above which
+	// slaves are unhealthy. 0 means no limit.
+	maxLag sync2.AtomicInt64
+
+	// mysqld is nil until the query service is first started.
+	// last is the result of the last check, and receivers are
+	// the channels of the subscribers.
+	mu        sync.Mutex
+	mysqld    *mysqlctl.Mysqld
+	last      *proto.HealthStats
+	receivers []chan *proto.HealthStats
+	closed    bool
+}
+
+// NewHealthChecker creates a new HealthChecker for sq, which checks
+// every interval once opened. If name is empty, its stats are not
+// exported.
+func NewHealthChecker(name string, sq *SqlQuery, interval time.Duration, maxLag int64) *HealthChecker {
+	hc := &HealthChecker{
+		sq:    sq,
+		ticks: timer.NewTimer(interval),
+		last:  &proto.HealthStats{Error: "not checked yet"},
+	}
+	hc.maxLag.Set(maxLag)
+	if name != "" {
+		stats.Publish(name+"Healthy", stats.IntFunc(func() int64 {
+			if hc.Last().Healthy {
+				return 1
+			}
+			return 0
+		}))
+		stats.Publish(name+"SecondsBehindMaster", stats.IntFunc(func() int64 {
+			return hc.Last().SecondsBehindMaster
+		}))
+		stats.Publish(name+"MaxLag", stats.IntFunc(hc.maxLag.Get))
+	}
+	return hc
+}
+
+// Open starts the periodic checks, with a first one right away.
+func (hc *HealthChecker) Open() {
+	hc.ticks.Start(hc.check)
+	hc.trigger()
+}
+
+// Close stops the checks, and ends the streams of the subscribers.
+func (hc *HealthChecker) Close() {
+	hc.ticks.Stop()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.closed = true
+	for _, receiver := range hc.receivers {
+		close(receiver)
+	}
+	hc.receivers = nil
+}
+
+// trigger runs a check without waiting for the next tick. It
+// doesn't wait for the check, so it can be called by the state
+// transitions of the query service.
+func (hc *HealthChecker) trigger() {
+	hc.ticks.TriggerAfter(0)
+}
+
+// setMysqld sets the MySQL daemon to check.
+func (hc *HealthChecker) setMysqld(mysqld *mysqlctl.Mysqld) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.mysqld = mysqld
+}
+
+// Last returns the result of the last check.
+func (hc *HealthChecker) Last() *proto.HealthStats {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.last
+}
+
+func (hc *HealthChecker) check() {
+	defer logError()
+	hs, err := hc.probe()
+	judgeHealth(hs, err, hc.maxLag.Get())
+	hc.publish(hs)
+}
+
+// probe collects the health of the tablet. It returns an error
+// if MySQL can't be queried.
+func (hc *HealthChecker) probe() (*proto.HealthStats, error) {
+	hs := &proto.HealthStats{
+		Serving:         hc.sq.state.Get() == SERVING,
+		RowcacheHealthy: hc.sq.qe.rowcacheHealthy(),
+		Time:            time.Now().UnixNano(),
+	}
+	hc.mu.Lock()
+	mysqld := hc.mysqld
+	hc.mu.Unlock()
+	if mysqld == nil {
+		return hs, errors.New("MySQL is not configured yet")
+	}
+	rp, err := mysqld.SlaveStatus()
+	switch err {
+	case nil:
+		hs.MysqlReachable = true
+		hs.IsSlave = true
+		if rp.SecondsBehindMaster != myproto.InvalidLagSeconds {
+			hs.ReplicationRunning = true
+			hs.SecondsBehindMaster = int64(rp.SecondsBehindMaster)
+		}
+	case mysqlctl.ErrNotSlave:
+		hs.MysqlReachable = true
+	default:
+		return hs, err
+	}
+	return hs, nil
+}
+
+// judgeHealth sets hs.Healthy, or hs.Error to the first reason why
+// the tablet is not healthy. err is the error of the MySQL probe.
+func judgeHealth(hs *proto.HealthStats, err error, maxLag int64) {
+	switch {
+	case err != nil:
+		hs.Error = fmt.Sprintf("MySQL is not reachable: %v", err)
+	case !hs.Serving:
+		hs.Error = "query service is not serving"
+	case hs.IsSlave && !hs.ReplicationRunning:
+		hs.Error = "replication is not running"
+	case hs.IsSlave && maxLag != 0 && hs.SecondsBehindMaster > maxLag:
+		hs.Error = fmt.Sprintf("replication lag %ds is over %ds", hs.SecondsBehindMaster, maxLag)
+	case !hs.RowcacheHealthy:
+		hs.Error = "rowcache is not healthy"
+	default:
+		hs.Healthy = true
+	}
+}
+
+// publish makes hs the last result, and sends it to the subscribers.
+func (hc *HealthChecker) publish(hs *proto.HealthStats) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hs.Healthy != hc.last.Healthy {
+		if hs.Healthy {
+			log.Infof("Tablet is healthy")
+		} else {
+			log.Warningf("Tablet is not healthy: %s", hs.Error)
+		}
+	}
+	hc.last = hs
+	for _, receiver := range hc.receivers {
+		// Slow subscribers miss the results they have no room for.
+		select {
+		case receiver <- hs:
+		default:
+		}
+	}
+}
+
+// StreamHealth sends the last result to sendReply, then every new
+// one, until sendReply fails or the checker is closed.
+func (hc *HealthChecker) StreamHealth(sendReply func(*proto.HealthStats) error) {
+	receiver, last := hc.subscribe()
+	defer hc.unsubscribe(receiver)
+	if err := sendReply(last); err != nil {
+		return
+	}
+	for hs := range receiver {
+		if err := sendReply(hs); err != nil {
+			return
+		}
+	}
+}
+
+func (hc *HealthChecker) subscribe() (chan *proto.HealthStats, *proto.HealthStats) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.closed {
+		panic(NewTabletError(RETRY, "Health checks are stopped"))
+	}
+	receiver := make(chan *proto.HealthStats, 1)
+	hc.receivers = append(hc.receivers, receiver)
+	return receiver, hc.last
+}
+
+// unsubscribe removes receiver, unless
+// the checker already closed it.
+func (hc *HealthChecker) unsubscribe(receiver chan *proto.HealthStats) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for i, rcv := range hc.receivers {
+		if rcv == receiver {
+			hc.receivers = append(hc.receivers[:i], hc.receivers[i+1:]...)
+			close(receiver)
+			return
+		}
+	}
+}
+
+// ServeHTTP serves /healthz: it answers ok if the tablet is healthy,
+// and fails with 503 otherwise.
+func (hc *HealthChecker) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.MONITORING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	response.Header().Set("Content-Type", "text/plain")
+	hs := hc.Last()
+	if !hs.Healthy {
+		response.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(response, "not ok: %s\n", hs.Error)
+		return
+	}
+	response.Write([]byte("ok\n"))
+}
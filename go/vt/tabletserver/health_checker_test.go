@@ -0,0 +1,103 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+func TestJudgeHealth(t *testing.T) {
+	tcases := []struct {
+		stats proto.HealthStats
+		err   error
+		want  string
+	}{{
+		stats: proto.HealthStats{Serving: true, RowcacheHealthy: true},
+		want:  "",
+	}, {
+		stats: proto.HealthStats{Serving: true, RowcacheHealthy: true},
+		err:   errors.New("no connection"),
+		want:  "MySQL is not reachable: no connection",
+	}, {
+		stats: proto.HealthStats{RowcacheHealthy: true},
+		want:  "query service is not serving",
+	}, {
+		stats: proto.HealthStats{Serving: true, RowcacheHealthy: true, IsSlave: true},
+		want:  "replication is not running",
+	}, {
+		stats: proto.HealthStats{Serving: true, RowcacheHealthy: true, IsSlave: true, ReplicationRunning: true, SecondsBehindMaster: 11},
+		want:  "replication lag 11s is over 10s",
+	}, {
+		stats: proto.HealthStats{Serving: true, RowcacheHealthy: true, IsSlave: true, ReplicationRunning: true, SecondsBehindMaster: 10},
+		want:  "",
+	}, {
+		stats: proto.HealthStats{Serving: true},
+		want:  "rowcache is not healthy",
+	}}
+	for _, tcase := range tcases {
+		hs := tcase.stats
+		judgeHealth(&hs, tcase.err, 10)
+		if hs.Error != tcase.want || hs.Healthy != (tcase.want == "") {
+			t.Errorf("judgeHealth(%+v): healthy %v, error %q, want %q", tcase.stats, hs.Healthy, hs.Error, tcase.want)
+		}
+	}
+}
+
+func TestStreamHealth(t *testing.T) {
+	hc := NewHealthChecker("", nil, 0, 0)
+	results := make(chan *proto.HealthStats)
+	done := make(chan bool)
+	go func() {
+		hc.StreamHealth(func(hs *proto.HealthStats) error {
+			results <- hs
+			return nil
+		})
+		close(done)
+	}()
+	if hs := <-results; hs.Healthy || hs.Error != "not checked yet" {
+		t.Errorf("first result: %+v, want the initial one", hs)
+	}
+	// Wait for the subscription before publishing.
+	for {
+		hc.mu.Lock()
+		subscribed := len(hc.receivers) == 1
+		hc.mu.Unlock()
+		if subscribed {
+			break
+		}
+	}
+	hc.publish(&proto.HealthStats{Healthy: true})
+	if hs := <-results; !hs.Healthy {
+		t.Errorf("second result: %+v, want healthy", hs)
+	}
+	hc.Close()
+	<-done
+	if len(hc.receivers) != 0 {
+		t.Errorf("receivers: %d, want 0", len(hc.receivers))
+	}
+}
+
+func TestServeHealthz(t *testing.T) {
+	hc := NewHealthChecker("", nil, 0, 0)
+	request, _ := http.NewRequest("GET", healthzURL, nil)
+	response := httptest.NewRecorder()
+	hc.ServeHTTP(response, request)
+	if response.Code != http.StatusServiceUnavailable || !strings.HasPrefix(response.Body.String(), "not ok: not checked yet") {
+		t.Errorf("before the first check: %d %q, want 503 not ok", response.Code, response.Body.String())
+	}
+
+	hc.publish(&proto.HealthStats{Healthy: true})
+	response = httptest.NewRecorder()
+	hc.ServeHTTP(response, request)
+	if response.Code != http.StatusOK || response.Body.String() != "ok\n" {
+		t.Errorf("when healthy: %d %q, want 200 ok", response.Code, response.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+)
+
+// invalidationLimiter limits the rate at which the invalidator
+// deletes rowcache keys, so that bulk changes don't starve the
+// read traffic of memcache. Keys are reserved ahead of time: the
+// backlog is the number of keys that were reserved, but whose time
+// slot has not come yet.
+type invalidationLimiter struct {
+	// keyDelay is the minimum time between two deletes.
+	keyDelay time.Duration
+	// maxBacklog is the number of keys above which
+	// reservations are refused.
+	maxBacklog int64
+
+	mu   sync.Mutex
+	next time.Time
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newInvalidationLimiter creates an invalidationLimiter for rate
+// keys per second, with a backlog of up to maxBacklog keys.
+// It returns nil if rate is not positive, which means no limit.
+func newInvalidationLimiter(rate, maxBacklog int64) *invalidationLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &invalidationLimiter{
+		keyDelay:   time.Second / time.Duration(rate),
+		maxBacklog: maxBacklog,
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+}
+
+// wait waits until n keys can be deleted without exceeding the rate.
+// If that would grow the backlog beyond maxBacklog, it returns false
+// immediately, and the caller should flush the table instead.
+// A non-positive maxBacklog allows an unbounded backlog.
+func (il *invalidationLimiter) wait(n int) bool {
+	il.mu.Lock()
+	now := il.now()
+	if il.next.Before(now) {
+		il.next = now
+	}
+	backlog := int64(il.next.Sub(now)/il.keyDelay) + int64(n)
+	if il.maxBacklog > 0 && backlog > il.maxBacklog {
+		il.mu.Unlock()
+		return false
+	}
+	delay := il.next.Sub(now)
+	il.next = il.next.Add(time.Duration(n) * il.keyDelay)
+	il.mu.Unlock()
+
+	if delay > 0 {
+		il.sleep(delay)
+	}
+	return true
+}
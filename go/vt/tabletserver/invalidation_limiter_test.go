@@ -0,0 +1,43 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvalidationLimiter(t *testing.T) {
+	if il := newInvalidationLimiter(0, 10); il != nil {
+		t.Errorf("newInvalidationLimiter(0): %v, want nil", il)
+	}
+
+	now := time.Unix(1000, 0)
+	var slept time.Duration
+	il := newInvalidationLimiter(100, 50)
+	il.now = func() time.Time { return now }
+	il.sleep = func(d time.Duration) { slept += d }
+
+	// The first keys go through immediately, and push back the next ones.
+	if !il.wait(20) || slept != 0 {
+		t.Errorf("wait(20): slept %v, want 0", slept)
+	}
+	if !il.wait(10) || slept != 200*time.Millisecond {
+		t.Errorf("wait(10): slept %v, want 200ms", slept)
+	}
+	// The backlog is 30 keys: 25 more would exceed 50.
+	if il.wait(25) {
+		t.Errorf("wait(25) with a backlog of 30 succeeded, want failure")
+	}
+	if slept != 200*time.Millisecond {
+		t.Errorf("failed wait slept %v", slept-200*time.Millisecond)
+	}
+	// Once the time has passed, the backlog is gone.
+	now = now.Add(time.Second)
+	slept = 0
+	if !il.wait(50) || slept != 0 {
+		t.Errorf("wait(50) after a second: slept %v, want 0", slept)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+const (
+	// threadsRunningQuery and historyLengthQuery read the load
+	// signals of MySQL.
+	threadsRunningQuery = "show global status like 'Threads_running'"
+	historyLengthQuery  = "select count from information_schema.innodb_metrics where name = 'trx_rseg_history_len'"
+)
+
+// loadSignal is a measure of the load of MySQL, and its threshold.
+// A threshold of 0 disables the signal.
+type loadSignal struct {
+	name      string
+	value     int64
+	threshold int64
+}
+
+// overloadLevel returns 0 if all the signals are within their
+// thresholds, 1 if one is over, and 2 if one is over twice its
+// threshold, with the signal that decided it.
+func overloadLevel(signals []loadSignal) (level int, reason string) {
+	for _, signal := range signals {
+		if signal.threshold == 0 || signal.value <= signal.threshold {
+			continue
+		}
+		l := 1
+		if signal.value > 2*signal.threshold {
+			l = 2
+		}
+		if l > level {
+			level = l
+			reason = fmt.Sprintf("%s is %d, over %d", signal.name, signal.value, signal.threshold)
+		}
+	}
+	return level, reason
+}
+
+// LoadThrottler sheds queries while MySQL is overloaded. Every check
+// interval, it reads the number of running threads and the length of
+// the InnoDB history list from MySQL, and the replication lag from
+// the health checker, and compares them to their thresholds. While
+// a signal is over its threshold, the low priority queries wait for
+// the load to drop, up to the max wait, and fail with RETRY after it.
+// While a signal is over twice its threshold, the normal priority
+// queries also fail, right away. High priority queries are never
+// throttled.
+//
+// The priority of a query is the one of its effective caller, low
+// for the low priority callers and normal for the others. A PRIORITY
+// directive can only lower it, so the clients can't skip the
+// throttling: PRIORITY=high has no effect. Queries in transactions
+// are not throttled, so the locks they hold are released sooner.
+type LoadThrottler struct {
+	qe    *QueryEngine
+	ticks *timer.Timer
+	// lag returns the replication lag in seconds. It's
+	// set once the health checker is created.
+	lag func() int64
+
+	maxThreadsRunning sync2.AtomicInt64
+	maxHistoryLength  sync2.AtomicInt64
+	maxLag            sync2.AtomicInt64
+	maxWait           sync2.AtomicDuration
+
+	// level and reason are the result of the last check.
+	// changed is closed by every check, to wake up the
+	// waiting queries.
+	mu                 sync.Mutex
+	level              int
+	reason             string
+	changed            chan struct{}
+	lowPriorityCallers map[string]bool
+
+	waiting   sync2.AtomicInt64
+	throttled *stats.Counters
+}
+
+// NewLoadThrottler creates a new LoadThrottler. If name is empty,
+// its stats are not exported.
+func NewLoadThrottler(name string, qe *QueryEngine, config Config) *LoadThrottler {
+	lt := &LoadThrottler{
+		qe:        qe,
+		ticks:     timer.NewTimer(time.Duration(config.ThrottlerCheckInterval * 1e9)),
+		lag:       func() int64 { return 0 },
+		changed:   make(chan struct{}),
+		throttled: stats.NewCounters(""),
+	}
+	lt.maxThreadsRunning.Set(int64(config.ThrottlerMaxThreadsRunning))
+	lt.maxHistoryLength.Set(int64(config.ThrottlerMaxHistoryLength))
+	lt.maxLag.Set(int64(config.ThrottlerMaxLag))
+	lt.maxWait.Set(time.Duration(config.ThrottlerMaxWait * 1e9))
+	lt.SetLowPriorityCallers(config.ThrottlerLowPriorityCallers)
+	if name != "" {
+		stats.Publish(name+"Throttled", lt.throttled)
+		stats.Publish(name+"Waiting", stats.IntFunc(lt.waiting.Get))
+		stats.Publish(name+"OverloadLevel", stats.IntFunc(func() int64 {
+			lt.mu.Lock()
+			defer lt.mu.Unlock()
+			return int64(lt.level)
+		}))
+		stats.Publish(name+"MaxThreadsRunning", stats.IntFunc(lt.maxThreadsRunning.Get))
+		stats.Publish(name+"MaxHistoryLength", stats.IntFunc(lt.maxHistoryLength.Get))
+		stats.Publish(name+"MaxLag", stats.IntFunc(lt.maxLag.Get))
+		stats.Publish(name+"MaxWait", stats.DurationFunc(lt.maxWait.Get))
+	}
+	return lt
+}
+
+// SetLowPriorityCallers changes the low priority callers, a
+// comma-separated list of effective callers.
+func (lt *LoadThrottler) SetLowPriorityCallers(callers string) {
+	lowPriorityCallers := make(map[string]bool)
+	for _, caller := range strings.Split(callers, ",") {
+		if caller = strings.TrimSpace(caller); caller != "" {
+			lowPriorityCallers[caller] = true
+		}
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.lowPriorityCallers = lowPriorityCallers
+}
+
+// Open starts the periodic checks of the load of MySQL.
+func (lt *LoadThrottler) Open() {
+	lt.ticks.Start(lt.check)
+}
+
+// Close stops the checks, and stops throttling.
+func (lt *LoadThrottler) Close() {
+	lt.ticks.Stop()
+	lt.setLevel(0, "")
+}
+
+func (lt *LoadThrottler) enabled() bool {
+	return lt.maxThreadsRunning.Get() != 0 || lt.maxHistoryLength.Get() != 0 || lt.maxLag.Get() != 0
+}
+
+func (lt *LoadThrottler) check() {
+	level, reason := 0, ""
+	// Don't throttle if the signals can't be read.
+	defer func() { lt.setLevel(level, reason) }()
+	defer logError()
+	if lt.enabled() {
+		level, reason = overloadLevel(lt.readSignals())
+	}
+}
+
+// readSignals reads the enabled load signals.
+func (lt *LoadThrottler) readSignals() (signals []loadSignal) {
+	if max := lt.maxLag.Get(); max != 0 {
+		signals = append(signals, loadSignal{"replication lag", lt.lag(), max})
+	}
+	maxThreadsRunning := lt.maxThreadsRunning.Get()
+	maxHistoryLength := lt.maxHistoryLength.Get()
+	if maxThreadsRunning == 0 && maxHistoryLength == 0 {
+		return signals
+	}
+	conn := getOrPanic(lt.qe.connPool)
+	defer conn.Recycle()
+	if maxThreadsRunning != 0 {
+		// The rows of show status are (Variable_name, Value).
+		signals = append(signals, loadSignal{"threads_running", fetchInt(conn, threadsRunningQuery, 1), maxThreadsRunning})
+	}
+	if maxHistoryLength != 0 {
+		signals = append(signals, loadSignal{"history list length", fetchInt(conn, historyLengthQuery, 0), maxHistoryLength})
+	}
+	return signals
+}
+
+// fetchInt returns the integer in the column col
+// of the single row of the result of sql.
+func fetchInt(conn dbconnpool.PoolConnection, sql string, col int) int64 {
+	qr, err := conn.ExecuteFetch(sql, 1, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	if len(qr.Rows) != 1 || len(qr.Rows[0]) <= col {
+		panic(NewTabletError(FAIL, "unexpected result for %s: %v", sql, qr.Rows))
+	}
+	val, err := strconv.ParseInt(qr.Rows[0][col].String(), 10, 64)
+	if err != nil {
+		panic(NewTabletError(FAIL, "unexpected result for %s: %v", sql, err))
+	}
+	return val
+}
+
+// setLevel records the result of a check, and
+// wakes up the waiting queries.
+func (lt *LoadThrottler) setLevel(level int, reason string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if level != lt.level {
+		if level == 0 {
+			log.Infof("MySQL is not overloaded anymore, not throttling")
+		} else {
+			log.Warningf("MySQL is overloaded (level %d), throttling: %s", level, reason)
+		}
+	}
+	lt.level = level
+	lt.reason = reason
+	close(lt.changed)
+	lt.changed = make(chan struct{})
+}
+
+// priorityRanks orders the priorities.
+var priorityRanks = map[string]int{
+	sqlparser.PRIORITY_LOW:    0,
+	sqlparser.PRIORITY_NORMAL: 1,
+	sqlparser.PRIORITY_HIGH:   2,
+}
+
+// priority returns the priority of the request of logStats: the
+// priority of its caller, or the one of its directives if it's lower.
+func (lt *LoadThrottler) priority(logStats *SQLQueryStats) string {
+	priority := sqlparser.PRIORITY_NORMAL
+	lt.mu.Lock()
+	if lt.lowPriorityCallers[logStats.EffectiveCaller()] {
+		priority = sqlparser.PRIORITY_LOW
+	}
+	lt.mu.Unlock()
+	if logStats.priority != "" && priorityRanks[logStats.priority] < priorityRanks[priority] {
+		priority = logStats.priority
+	}
+	return priority
+}
+
+// Throttle returns when the request of logStats can run, and
+// panics with RETRY if it must be shed.
+func (lt *LoadThrottler) Throttle(logStats *SQLQueryStats) {
+	priority := lt.priority(logStats)
+	if priority == sqlparser.PRIORITY_HIGH {
+		return
+	}
+	var deadline time.Time
+	for {
+		lt.mu.Lock()
+		level, reason, changed := lt.level, lt.reason, lt.changed
+		lt.mu.Unlock()
+		if level == 0 || (priority == sqlparser.PRIORITY_NORMAL && level < 2) {
+			return
+		}
+		if priority == sqlparser.PRIORITY_LOW && level < 2 {
+			if deadline.IsZero() {
+				deadline = time.Now().Add(lt.maxWait.Get())
+				lt.waiting.Add(1)
+				defer lt.waiting.Add(-1)
+				defer waitStats.Record("Throttle", time.Now())
+			}
+			if remaining := deadline.Sub(time.Now()); remaining > 0 {
+				select {
+				case <-changed:
+				case <-time.After(remaining):
+				}
+				continue
+			}
+		}
+		lt.throttled.Add(priority, 1)
+		panic(NewTabletError(RETRY, "Query throttled, MySQL is overloaded: %s", reason))
+	}
+}
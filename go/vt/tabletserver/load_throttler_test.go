@@ -0,0 +1,108 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+func TestOverloadLevel(t *testing.T) {
+	tcases := []struct {
+		signals []loadSignal
+		level   int
+		reason  string
+	}{{
+		signals: nil,
+		level:   0,
+	}, {
+		signals: []loadSignal{{"threads_running", 100, 0}, {"replication lag", 10, 10}},
+		level:   0,
+	}, {
+		signals: []loadSignal{{"threads_running", 11, 10}, {"replication lag", 1, 10}},
+		level:   1,
+		reason:  "threads_running is 11, over 10",
+	}, {
+		signals: []loadSignal{{"threads_running", 11, 10}, {"replication lag", 21, 10}},
+		level:   2,
+		reason:  "replication lag is 21, over 10",
+	}}
+	for _, tcase := range tcases {
+		level, reason := overloadLevel(tcase.signals)
+		if level != tcase.level || reason != tcase.reason {
+			t.Errorf("overloadLevel(%v): %d, %q, want %d, %q", tcase.signals, level, reason, tcase.level, tcase.reason)
+		}
+	}
+}
+
+// throttle returns the error of lt.Throttle for logStats, or nil.
+func throttle(lt *LoadThrottler, logStats *SQLQueryStats) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = x.(*TabletError)
+		}
+	}()
+	lt.Throttle(logStats)
+	return nil
+}
+
+func TestLoadThrottlerPriorities(t *testing.T) {
+	lt := NewLoadThrottler("", nil, Config{ThrottlerMaxWait: 0.01, ThrottlerLowPriorityCallers: "batch, report"})
+	logStats := func(priority, caller string) *SQLQueryStats {
+		logStats := newSqlQueryStats("Execute", &context.DummyContext{})
+		logStats.priority = priority
+		logStats.callerID = caller
+		return logStats
+	}
+
+	lt.setLevel(1, "threads_running is 11, over 10")
+	if err := throttle(lt, logStats("", "")); err != nil {
+		t.Errorf("normal priority at level 1: %v", err)
+	}
+	err := throttle(lt, logStats("", "report"))
+	if terr, ok := err.(*TabletError); !ok || terr.ErrorType != RETRY {
+		t.Errorf("low priority caller at level 1: %v, want retry", err)
+	}
+	// Directives can't raise the priority of a caller.
+	err = throttle(lt, logStats("high", "report"))
+	if terr, ok := err.(*TabletError); !ok || terr.ErrorType != RETRY {
+		t.Errorf("low priority caller with a high priority directive at level 1: %v, want retry", err)
+	}
+	if n := lt.throttled.Counts()["low"]; n != 2 {
+		t.Errorf("throttled low: %d, want 2", n)
+	}
+	err = throttle(lt, logStats("low", ""))
+	if terr, ok := err.(*TabletError); !ok || terr.ErrorType != RETRY {
+		t.Errorf("low priority directive at level 1: %v, want retry", err)
+	}
+
+	lt.setLevel(2, "threads_running is 21, over 10")
+	if err := throttle(lt, logStats("normal", "")); err == nil {
+		t.Errorf("normal priority at level 2 was not throttled")
+	}
+	if err := throttle(lt, logStats("high", "")); err == nil {
+		t.Errorf("high priority directive at level 2 was not throttled")
+	}
+
+	// Low priority queries wait for the load to drop.
+	lt.setLevel(1, "threads_running is 11, over 10")
+	lt.maxWait.Set(10 * time.Second)
+	done := make(chan error)
+	go func() {
+		done <- throttle(lt, logStats("low", ""))
+	}()
+	for lt.waiting.Get() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	lt.setLevel(0, "")
+	if err := <-done; err != nil {
+		t.Errorf("low priority after the load dropped: %v", err)
+	}
+	if n := lt.waiting.Get(); n != 0 {
+		t.Errorf("waiting: %d, want 0", n)
+	}
+}
@@ -183,6 +183,18 @@ func (s *MemcacheStats) Close() {
 	s.items.clear()
 }
 
+// MainStats returns a copy of the main memcache stats.
+func (s *MemcacheStats) MainStats() map[string]string {
+	s.main.mu.Lock()
+	defer s.main.mu.Unlock()
+	s.updateMainStats()
+	result := make(map[string]string, len(s.main.stats))
+	for k, v := range s.main.stats {
+		result[k] = v
+	}
+	return result
+}
+
 func (s *MemcacheStats) updateMainStats() {
 	if time.Now().Sub(s.main.lastQuery) <= interval {
 		return
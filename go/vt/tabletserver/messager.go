@@ -0,0 +1,408 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/schema"
+	"github.com/youtube/vitess/go/vt/tableacl"
+	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+)
+
+// MessageInfo is the configuration of a message table. A message
+// table is commented as vitess_message, followed by its options,
+// in seconds:
+//
+//	create table my_messages(
+//	  id bigint,
+//	  time_next bigint,
+//	  epoch bigint,
+//	  time_created bigint,
+//	  time_acked bigint,
+//	  message varbinary(1024),
+//	  primary key(id),
+//	  index next_idx(time_next)
+//	) comment 'vitess_message,vt_ack_wait=30,vt_purge_after=86400,vt_batch_size=10,vt_poll_interval=1'
+type MessageInfo struct {
+	// AckWait is how long a sent message waits for its ack
+	// before it's sent again. It doubles at every attempt.
+	AckWait time.Duration
+	// PurgeAfter is how long acked messages are kept.
+	PurgeAfter time.Duration
+	// BatchSize is the maximum number of messages
+	// sent to a subscriber at once.
+	BatchSize int
+	// PollInterval is how often the table is read
+	// for the messages to send.
+	PollInterval time.Duration
+}
+
+var defaultMessageInfo = MessageInfo{
+	AckWait:      30 * time.Second,
+	PurgeAfter:   24 * time.Hour,
+	BatchSize:    10,
+	PollInterval: 1 * time.Second,
+}
+
+const (
+	// messageMaxBackoff caps the ack wait
+	// of a message to AckWait << messageMaxBackoff.
+	messageMaxBackoff = 6
+	// Acked messages are deleted by batches
+	// of messagePurgeBatch, every messagePurgeInterval.
+	messagePurgeBatch    = 500
+	messagePurgeInterval = time.Minute
+)
+
+func parseMessageInfo(comment string) (*MessageInfo, error) {
+	info := defaultMessageInfo
+	for _, option := range strings.Split(comment, ",") {
+		option = strings.TrimSpace(option)
+		if !strings.HasPrefix(option, "vt_") {
+			continue
+		}
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid option %s", option)
+		}
+		val, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || val <= 0 {
+			return nil, fmt.Errorf("invalid value for %s: %s", kv[0], kv[1])
+		}
+		switch kv[0] {
+		case "vt_ack_wait":
+			info.AckWait = time.Duration(val * 1e9)
+		case "vt_purge_after":
+			info.PurgeAfter = time.Duration(val * 1e9)
+		case "vt_batch_size":
+			info.BatchSize = int(val)
+		case "vt_poll_interval":
+			info.PollInterval = time.Duration(val * 1e9)
+		default:
+			return nil, fmt.Errorf("unknown option %s", kv[0])
+		}
+	}
+	return &info, nil
+}
+
+// MessageEngine sends the messages of the message tables to their
+// subscribers.
+//
+// Messages are inserted by the applications, usually in the
+// transaction of the change they announce, with an epoch of 0, and
+// a time_next in nanoseconds, which is when they should be sent: 0
+// sends them right away. Every poll interval, the messages whose
+// time_next is past are sent by batches to the subscribers of the
+// table, and their time_next is pushed back by the ack wait. The
+// subscribers ack the messages they processed, which sets their
+// time_acked. The other ones are sent again, possibly to another
+// subscriber: messages are sent at least once. Acked messages are
+// deleted after the purge delay.
+//
+// Messages are only sent by masters.
+type MessageEngine struct {
+	qe    *QueryEngine
+	stats *stats.MultiCounters
+
+	mu       sync.Mutex
+	isOpen   bool
+	managers map[string]*messageManager
+}
+
+// NewMessageEngine creates a new MessageEngine. If name is empty,
+// its stats are not exported.
+func NewMessageEngine(name string, qe *QueryEngine) *MessageEngine {
+	return &MessageEngine{
+		qe:       qe,
+		stats:    stats.NewMultiCounters(name, []string{"Table", "Event"}),
+		managers: make(map[string]*messageManager),
+	}
+}
+
+// Open starts sending the messages of the message tables,
+// unless MySQL is read-only.
+func (me *MessageEngine) Open() {
+	conn := getOrPanic(me.qe.connPool)
+	defer conn.Recycle()
+	if isReadOnly(conn) {
+		log.Infof("MySQL is read-only, not sending messages")
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.isOpen = true
+	for _, table := range me.qe.schemaInfo.GetSchema() {
+		if table.Type == schema.TYPE_MESSAGE {
+			me.getLocked(table.Name)
+		}
+	}
+}
+
+// Close stops sending messages, and ends the streams of
+// the subscribers. It can be called more than once.
+func (me *MessageEngine) Close() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.isOpen = false
+	for _, mm := range me.managers {
+		mm.close()
+	}
+	me.managers = make(map[string]*messageManager)
+}
+
+// get returns the manager of the message table name. Managers of
+// the tables created after Open are started by their first use.
+func (me *MessageEngine) get(name string) *messageManager {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.getLocked(name)
+}
+
+func (me *MessageEngine) getLocked(name string) *messageManager {
+	if !me.isOpen {
+		panic(NewTabletError(FAIL, "Messages are only sent by masters that are serving"))
+	}
+	if mm, ok := me.managers[name]; ok {
+		return mm
+	}
+	tableInfo := me.qe.schemaInfo.GetTable(name)
+	if tableInfo == nil || tableInfo.Type != schema.TYPE_MESSAGE {
+		panic(NewTabletError(FAIL, "%s is not a message table", name))
+	}
+	mm := newMessageManager(me, tableInfo)
+	me.managers[name] = mm
+	return mm
+}
+
+// MessageStream sends the messages of the message table
+// name to sendReply, until the query service stops.
+func (qe *QueryEngine) MessageStream(logStats *SQLQueryStats, name string, sendReply func(*mproto.QueryResult) error) {
+	logStats.PlanType = "MESSAGE_STREAM"
+	logStats.OriginalSql = name
+	authorized := tableacl.Authorized(name, planbuilder.PLAN_PASS_SELECT.MinRole())
+	qe.checkTableAcl(name, planbuilder.PLAN_PASS_SELECT, authorized, logStats.context.GetUsername())
+
+	mm := qe.messager.get(name)
+	receiver := mm.subscribe()
+	defer mm.unsubscribe(receiver)
+	for qr := range receiver {
+		if err := sendReply(qr); err != nil {
+			// The messages will be sent again after their ack wait.
+			return
+		}
+	}
+}
+
+// MessageAck acks the messages ids of the message table
+// name, and returns the number of messages that were not
+// acked yet.
+func (qe *QueryEngine) MessageAck(logStats *SQLQueryStats, name string, ids []string) int64 {
+	defer queryStats.Record("MESSAGE_ACK", time.Now())
+	logStats.PlanType = "MESSAGE_ACK"
+	logStats.OriginalSql = name
+	authorized := tableacl.Authorized(name, planbuilder.PLAN_DML_PK.MinRole())
+	qe.checkTableAcl(name, planbuilder.PLAN_DML_PK, authorized, logStats.context.GetUsername())
+
+	qe.messager.get(name)
+	if len(ids) == 0 {
+		return 0
+	}
+	values := make([]sqltypes.Value, len(ids))
+	for i, id := range ids {
+		values[i] = sqltypes.MakeString([]byte(id))
+	}
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	sql := fmt.Sprintf("update %s set time_acked = %d, time_next = null where id in (%s) and time_acked is null", name, time.Now().UnixNano(), encodeValueList(values))
+	qr, err := qe.executeSql(logStats, conn, sql, false)
+	if err != nil {
+		panic(err)
+	}
+	qe.messager.stats.Add([]string{name, "Acked"}, int64(qr.RowsAffected))
+	return int64(qr.RowsAffected)
+}
+
+// messageManager sends the messages of a message table.
+type messageManager struct {
+	me         *MessageEngine
+	name       string
+	info       *MessageInfo
+	pollTicks  *timer.Timer
+	purgeTicks *timer.Timer
+
+	// receivers are the channels of the subscribers.
+	// next is the receiver of the next batch.
+	mu        sync.Mutex
+	receivers []chan *mproto.QueryResult
+	next      int
+	closed    bool
+}
+
+func newMessageManager(me *MessageEngine, tableInfo *TableInfo) *messageManager {
+	mm := &messageManager{
+		me:         me,
+		name:       tableInfo.Name,
+		info:       tableInfo.Message,
+		pollTicks:  timer.NewTimer(tableInfo.Message.PollInterval),
+		purgeTicks: timer.NewTimer(messagePurgeInterval),
+	}
+	mm.pollTicks.Start(mm.poll)
+	mm.purgeTicks.Start(mm.purge)
+	return mm
+}
+
+func (mm *messageManager) close() {
+	// Stop waits for the running poll, which needs mu.
+	mm.pollTicks.Stop()
+	mm.purgeTicks.Stop()
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	mm.closed = true
+	for _, receiver := range mm.receivers {
+		close(receiver)
+	}
+	mm.receivers = nil
+}
+
+func (mm *messageManager) subscribe() chan *mproto.QueryResult {
+	receiver := make(chan *mproto.QueryResult, 1)
+	mm.mu.Lock()
+	if mm.closed {
+		mm.mu.Unlock()
+		panic(NewTabletError(RETRY, "Messages of %s are not sent anymore", mm.name))
+	}
+	mm.receivers = append(mm.receivers, receiver)
+	mm.mu.Unlock()
+	// Don't make the first subscriber wait for the poll interval.
+	mm.pollTicks.Trigger()
+	return receiver
+}
+
+// unsubscribe removes receiver, unless
+// the manager already closed it.
+func (mm *messageManager) unsubscribe(receiver chan *mproto.QueryResult) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	for i, rcv := range mm.receivers {
+		if rcv == receiver {
+			mm.receivers = append(mm.receivers[:i], mm.receivers[i+1:]...)
+			close(receiver)
+			return
+		}
+	}
+}
+
+func (mm *messageManager) receiverCount() int {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return len(mm.receivers)
+}
+
+// send gives qr to the next receiver that has room for it, and
+// returns false if none has.
+func (mm *messageManager) send(qr *mproto.QueryResult) bool {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	for i := 0; i < len(mm.receivers); i++ {
+		receiver := mm.receivers[mm.next%len(mm.receivers)]
+		mm.next++
+		select {
+		case receiver <- qr:
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// poll sends the messages that are due, a batch per receiver.
+func (mm *messageManager) poll() {
+	defer logError()
+	receivers := mm.receiverCount()
+	if receivers == 0 {
+		return
+	}
+	conn := getOrPanic(mm.me.qe.connPool)
+	defer conn.Recycle()
+	now := time.Now().UnixNano()
+	limit := receivers * mm.info.BatchSize
+	sql := fmt.Sprintf("select id, message from %s where time_next <= %d and time_acked is null order by time_next limit %d", mm.name, now, limit)
+	qr, err := conn.ExecuteFetch(sql, limit, true)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	if len(qr.Rows) == 0 {
+		return
+	}
+
+	// Postpone the messages before sending them,
+	// so the next poll doesn't send them again.
+	ids := make([]sqltypes.Value, len(qr.Rows))
+	for i, row := range qr.Rows {
+		ids[i] = row[0]
+	}
+	sql = fmt.Sprintf("update %s set time_next = %d + (%d << least(epoch, %d)), epoch = epoch + 1 where id in (%s) and time_acked is null", mm.name, now, mm.info.AckWait.Nanoseconds(), messageMaxBackoff, encodeValueList(ids))
+	if _, err := conn.ExecuteFetch(sql, 1, false); err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	for start := 0; start < len(qr.Rows); start += mm.info.BatchSize {
+		end := start + mm.info.BatchSize
+		if end > len(qr.Rows) {
+			end = len(qr.Rows)
+		}
+		batch := &mproto.QueryResult{
+			Fields:       qr.Fields,
+			Rows:         qr.Rows[start:end],
+			RowsAffected: uint64(end - start),
+		}
+		// Messages that can't be sent are sent again
+		// after their ack wait.
+		if !mm.send(batch) {
+			break
+		}
+		mm.me.stats.Add([]string{mm.name, "Sent"}, int64(end-start))
+	}
+}
+
+// purge deletes the acked messages older than the purge delay.
+func (mm *messageManager) purge() {
+	defer logError()
+	conn := getOrPanic(mm.me.qe.connPool)
+	defer conn.Recycle()
+	before := time.Now().Add(-mm.info.PurgeAfter).UnixNano()
+	sql := fmt.Sprintf("delete from %s where time_acked < %d limit %d", mm.name, before, messagePurgeBatch)
+	for {
+		qr, err := conn.ExecuteFetch(sql, 1, false)
+		if err != nil {
+			panic(NewTabletErrorSql(FAIL, err))
+		}
+		mm.me.stats.Add([]string{mm.name, "Purged"}, int64(qr.RowsAffected))
+		if qr.RowsAffected < messagePurgeBatch {
+			return
+		}
+	}
+}
+
+func encodeValueList(values []sqltypes.Value) string {
+	buf := bytes.NewBuffer(nil)
+	for i, value := range values {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		value.EncodeSql(buf)
+	}
+	return buf.String()
+}
@@ -0,0 +1,98 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+func TestParseMessageInfo(t *testing.T) {
+	info, err := parseMessageInfo("vitess_message")
+	if err != nil {
+		t.Fatalf("parseMessageInfo: %v", err)
+	}
+	if *info != defaultMessageInfo {
+		t.Errorf("parseMessageInfo without options: %+v, want %+v", *info, defaultMessageInfo)
+	}
+
+	info, err = parseMessageInfo("vitess_message, vt_ack_wait=0.5,vt_purge_after=60,vt_batch_size=3,vt_poll_interval=2")
+	if err != nil {
+		t.Fatalf("parseMessageInfo: %v", err)
+	}
+	want := MessageInfo{
+		AckWait:      500 * time.Millisecond,
+		PurgeAfter:   time.Minute,
+		BatchSize:    3,
+		PollInterval: 2 * time.Second,
+	}
+	if *info != want {
+		t.Errorf("parseMessageInfo: %+v, want %+v", *info, want)
+	}
+
+	for _, comment := range []string{
+		"vitess_message,vt_ack_wait",
+		"vitess_message,vt_ack_wait=a",
+		"vitess_message,vt_batch_size=0",
+		"vitess_message,vt_unknown=1",
+	} {
+		if _, err := parseMessageInfo(comment); err == nil {
+			t.Errorf("parseMessageInfo(%s) did not fail", comment)
+		}
+	}
+}
+
+func TestMessageManagerSend(t *testing.T) {
+	mm := &messageManager{name: "msg"}
+	qr := &mproto.QueryResult{}
+	if mm.send(qr) {
+		t.Errorf("send without receivers succeeded")
+	}
+	mm.receivers = []chan *mproto.QueryResult{
+		make(chan *mproto.QueryResult, 1),
+		make(chan *mproto.QueryResult, 1),
+	}
+	r1, r2 := mm.receivers[0], mm.receivers[1]
+	// Batches go round robin, to the receivers that have room.
+	for i := 0; i < 2; i++ {
+		if !mm.send(qr) {
+			t.Errorf("send %d failed", i)
+		}
+	}
+	if len(r1) != 1 || len(r2) != 1 {
+		t.Errorf("receivers got %d and %d batches, want 1 and 1", len(r1), len(r2))
+	}
+	if mm.send(qr) {
+		t.Errorf("send to full receivers succeeded")
+	}
+	<-r2
+	if !mm.send(qr) || len(r2) != 1 {
+		t.Errorf("send did not go to the receiver that has room")
+	}
+
+	mm.unsubscribe(r1)
+	if _, ok := <-r1; !ok {
+		t.Errorf("unsubscribe lost the batch of the receiver")
+	}
+	if _, ok := <-r1; ok {
+		t.Errorf("unsubscribe did not close the receiver")
+	}
+	if count := mm.receiverCount(); count != 1 {
+		t.Errorf("receiverCount: %d, want 1", count)
+	}
+}
+
+func TestEncodeValueList(t *testing.T) {
+	values := []sqltypes.Value{
+		sqltypes.MakeNumeric([]byte("1")),
+		sqltypes.MakeString([]byte("a'b")),
+	}
+	if got, want := encodeValueList(values), "1, 'a\\'b'"; got != want {
+		t.Errorf("encodeValueList: %s, want %s", got, want)
+	}
+}
@@ -10,6 +10,32 @@ type DDLPlan struct {
 	Action    string
 	TableName string
 	NewName   string
+	// AlterSpecs is the parsed list of changes of an alter, if it
+	// could be parsed.
+	AlterSpecs sqlparser.AlterSpecs
+	// Temporary is set for the DDLs of temporary tables.
+	Temporary bool
+}
+
+// SchemaChanged returns false if the ddl is an alter that only changes
+// table options that are not part of the table schema, in which case
+// the table does not need to be reloaded.
+func (plan *DDLPlan) SchemaChanged() bool {
+	if plan.Action != sqlparser.AST_ALTER || plan.AlterSpecs == nil {
+		return true
+	}
+	for _, spec := range plan.AlterSpecs {
+		if spec.Action != sqlparser.AST_TABLE_OPTIONS {
+			return true
+		}
+		for _, option := range spec.Options {
+			// The table comment decides the cache type.
+			if option.Name == "comment" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func DDLParse(sql string) (plan *DDLPlan) {
@@ -22,9 +48,11 @@ func DDLParse(sql string) (plan *DDLPlan) {
 		return &DDLPlan{Action: ""}
 	}
 	return &DDLPlan{
-		Action:    stmt.Action,
-		TableName: string(stmt.Table),
-		NewName:   string(stmt.NewName),
+		Action:     stmt.Action,
+		TableName:  string(stmt.Table),
+		NewName:    string(stmt.NewName),
+		AlterSpecs: stmt.AlterSpecs,
+		Temporary:  stmt.Temporary,
 	}
 }
 
@@ -47,6 +47,9 @@ func analyzeUpdate(upd *sqlparser.Update, getTable TableGetter) (plan *ExecPlan,
 	plan.PlanId = PLAN_DML_SUBQUERY
 	plan.OuterQuery = GenerateUpdateOuterQuery(upd, tableInfo.Indexes[0])
 	plan.Subquery = GenerateUpdateSubquery(upd, tableInfo)
+	if upd.OrderBy == nil && upd.Limit == nil && plan.SecondaryPKValues == nil {
+		plan.ChunkQuery, plan.NextChunkQuery = GenerateChunkQueries(tableInfo.Indexes[0], &sqlparser.AliasedTableExpr{Expr: upd.Table}, upd.Where)
+	}
 
 	conditions := analyzeWhere(upd.Where)
 	if conditions == nil {
@@ -94,6 +97,9 @@ func analyzeDelete(del *sqlparser.Delete, getTable TableGetter) (plan *ExecPlan,
 	plan.PlanId = PLAN_DML_SUBQUERY
 	plan.OuterQuery = GenerateDeleteOuterQuery(del, tableInfo.Indexes[0])
 	plan.Subquery = GenerateDeleteSubquery(del, tableInfo)
+	if del.OrderBy == nil && del.Limit == nil {
+		plan.ChunkQuery, plan.NextChunkQuery = GenerateChunkQueries(tableInfo.Indexes[0], &sqlparser.AliasedTableExpr{Expr: del.Table}, del.Where)
+	}
 
 	conditions := analyzeWhere(del.Where)
 	if conditions == nil {
@@ -138,6 +144,22 @@ func analyzeSet(set *sqlparser.Set) (plan *ExecPlan) {
 	return plan
 }
 
+func analyzeSavepoint(savepoint *sqlparser.Savepoint) (plan *ExecPlan) {
+	plan = &ExecPlan{
+		FullQuery:     GenerateFullQuery(savepoint),
+		SavepointName: string(savepoint.Name),
+	}
+	switch savepoint.Action {
+	case sqlparser.AST_ROLLBACK_TO:
+		plan.PlanId = PLAN_ROLLBACK_SAVEPOINT
+	case sqlparser.AST_RELEASE:
+		plan.PlanId = PLAN_RELEASE_SAVEPOINT
+	default:
+		plan.PlanId = PLAN_SAVEPOINT
+	}
+	return plan
+}
+
 func analyzeUpdateExpressions(exprs sqlparser.UpdateExprs, pkIndex *schema.Index) (pkValues []interface{}, err error) {
 	for _, expr := range exprs {
 		index := pkIndex.FindColumn(sqlparser.GetColName(expr.Name))
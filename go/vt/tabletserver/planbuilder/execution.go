@@ -16,6 +16,8 @@ import (
 var (
 	TooComplex = errors.New("Complex")
 	execLimit  = &sqlparser.Limit{Rowcount: sqlparser.ValArg(":_vtMaxResultSize")}
+	chunkLimit = &sqlparser.Limit{Rowcount: sqlparser.ValArg(":_vtChunkSize")}
+	lockLimit  = sqlparser.ValArg(":_vtLockLimit")
 )
 
 // ExecPlan is built for selects and DMLs.
@@ -36,11 +38,22 @@ type ExecPlan struct {
 
 	// For PK plans, only OuterQuery is set.
 	// For SUBQUERY plans, Subquery is also set.
-	// IndexUsed is set only for PLAN_SELECT_SUBQUERY
+	// IndexUsed is set only for PLAN_SELECT_SUBQUERY and PLAN_SELECT_LOCK
 	OuterQuery *sqlparser.ParsedQuery
 	Subquery   *sqlparser.ParsedQuery
 	IndexUsed  string
 
+	// For PLAN_UPSERT_PK, OuterQuery is the insert, and UpsertQuery
+	// the update by pk executed if the pk already exists.
+	UpsertQuery *sqlparser.ParsedQuery
+
+	// For DMLs without order by or limit that don't change
+	// the pk, ChunkQuery and NextChunkQuery select the pks to
+	// change by chunks, for PLAN_DML_SUBQUERY executed outside
+	// of a transaction.
+	ChunkQuery     *sqlparser.ParsedQuery
+	NextChunkQuery *sqlparser.ParsedQuery
+
 	// For selects, columns to be returned
 	// For PLAN_INSERT_SUBQUERY, columns to be inserted
 	ColumnNumbers []int
@@ -59,6 +72,21 @@ type ExecPlan struct {
 	// PLAN_SET
 	SetKey   string
 	SetValue interface{}
+
+	// PLAN_SAVEPOINT, PLAN_ROLLBACK_SAVEPOINT, PLAN_RELEASE_SAVEPOINT
+	SavepointName string
+
+	// PLAN_NEXTVAL: number of values to allocate, nil for 1
+	NextValCount interface{}
+
+	// PLAN_SELECT_LOCK: row count of the limit clause of the query,
+	// nil if there's none. FullQuery limits the rows to
+	// :_vtLockLimit instead, which is the lower of this row count
+	// and of the maximum result size.
+	LockLimit interface{}
+
+	// Directives of the comments of the query, nil if none
+	Directives sqlparser.Directives
 }
 
 func (node *ExecPlan) setTableInfo(tableName string, getTable TableGetter) (*schema.Table, error) {
@@ -81,6 +109,7 @@ func GetExecPlan(sql string, getTable TableGetter) (plan *ExecPlan, err error) {
 	if err != nil {
 		return nil, err
 	}
+	plan.Directives = sqlparser.GetDirectives(statement)
 	if plan.PlanId == PLAN_PASS_DML {
 		log.Warningf("PASS_DML: %s", sql)
 	}
@@ -94,8 +123,9 @@ func GetStreamExecPlan(sql string, getTable TableGetter) (plan *ExecPlan, err er
 	}
 
 	plan = &ExecPlan{
-		PlanId:    PLAN_PASS_SELECT,
-		FullQuery: GenerateFullQuery(statement),
+		PlanId:     PLAN_PASS_SELECT,
+		FullQuery:  GenerateFullQuery(statement),
+		Directives: sqlparser.GetDirectives(statement),
 	}
 
 	switch stmt := statement.(type) {
@@ -108,6 +138,8 @@ func GetStreamExecPlan(sql string, getTable TableGetter) (plan *ExecPlan, err er
 			plan.setTableInfo(tableName, getTable)
 		}
 
+	case *sqlparser.Show:
+		plan.TableName = showTableName(stmt, getTable)
 	case *sqlparser.Union:
 		// pass
 	default:
@@ -117,6 +149,36 @@ func GetStreamExecPlan(sql string, getTable TableGetter) (plan *ExecPlan, err er
 	return plan, nil
 }
 
+// GetPassthroughPlan returns the plan that passes sql through to
+// MySQL as is. It's for the selects and DMLs of the tables that are
+// not in the schema, like the temporary tables of the reserved
+// connections.
+func GetPassthroughPlan(sql string) (plan *ExecPlan, err error) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	plan = &ExecPlan{
+		FullQuery:  GenerateFullQuery(statement),
+		Reason:     REASON_TABLE,
+		Directives: sqlparser.GetDirectives(statement),
+	}
+	switch stmt := statement.(type) {
+	case *sqlparser.Select:
+		plan.PlanId = PLAN_PASS_SELECT
+		if stmt.Lock != "" {
+			plan.Reason = REASON_LOCK
+		}
+	case *sqlparser.Union:
+		plan.PlanId = PLAN_PASS_SELECT
+	case *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+		plan.PlanId = PLAN_PASS_DML
+	default:
+		return nil, fmt.Errorf("'%v' can't be passed through", sqlparser.String(statement))
+	}
+	return plan, nil
+}
+
 func analyzeSQL(statement sqlparser.Statement, getTable TableGetter) (plan *ExecPlan, err error) {
 	switch stmt := statement.(type) {
 	case *sqlparser.Union:
@@ -138,6 +200,34 @@ func analyzeSQL(statement sqlparser.Statement, getTable TableGetter) (plan *Exec
 		return analyzeSet(stmt), nil
 	case *sqlparser.DDL:
 		return analyzeDDL(stmt, getTable), nil
+	case *sqlparser.Savepoint:
+		return analyzeSavepoint(stmt), nil
+	case *sqlparser.Show:
+		return &ExecPlan{
+			PlanId:    PLAN_PASS_SELECT,
+			TableName: showTableName(stmt, getTable),
+			FullQuery: GenerateFullQuery(stmt),
+		}, nil
+	case *sqlparser.Use:
+		return nil, errors.New("use not allowed: the database of the tablet can't be changed")
 	}
 	return nil, errors.New("invalid SQL")
 }
+
+// showTableName returns the table of a show statement, like SHOW
+// COLUMNS FROM, so the table ACLs and query rules apply to it. Like
+// for DDLs, it's empty if the table is not in the schema.
+func showTableName(show *sqlparser.Show, getTable TableGetter) string {
+	if show.Table == nil {
+		return ""
+	}
+	tableName := sqlparser.GetTableName(show.Table)
+	if tableName == "" {
+		return ""
+	}
+	tableInfo, ok := getTable(tableName)
+	if !ok {
+		return ""
+	}
+	return tableInfo.Name
+}
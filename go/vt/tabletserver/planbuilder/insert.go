@@ -36,13 +36,15 @@ func analyzeInsert(ins *sqlparser.Insert, getTable TableGetter) (plan *ExecPlan,
 	pkColumnNumbers := getInsertPKColumns(ins.Columns, tableInfo)
 
 	if ins.OnDup != nil {
-		// Upserts are not safe for statement based replication:
-		// http://bugs.mysql.com/bug.php?id=58637
-		plan.Reason = REASON_UPSERT
-		return plan, nil
+		return analyzeUpsert(ins, plan, tableInfo, pkColumnNumbers)
 	}
 
 	if sel, ok := ins.Rows.(sqlparser.SelectStatement); ok {
+		if len(ins.Columns) != 0 {
+			if count := selectExprCount(sel); count != -1 && count != len(ins.Columns) {
+				return nil, errors.New("column count doesn't match value count")
+			}
+		}
 		plan.PlanId = PLAN_INSERT_SUBQUERY
 		plan.OuterQuery = GenerateInsertOuterQuery(ins)
 		plan.Subquery = GenerateSelectLimitQuery(sel)
@@ -65,6 +67,9 @@ func analyzeInsert(ins *sqlparser.Insert, getTable TableGetter) (plan *ExecPlan,
 
 	// If it's not a sqlparser.SelectStatement, it's Values.
 	rowList := ins.Rows.(sqlparser.Values)
+	if err := validateInsertRows(ins.Columns, rowList); err != nil {
+		return nil, err
+	}
 	pkValues, err := getInsertPKValues(pkColumnNumbers, rowList, tableInfo)
 	if err != nil {
 		return nil, err
@@ -77,6 +82,99 @@ func analyzeInsert(ins *sqlparser.Insert, getTable TableGetter) (plan *ExecPlan,
 	return plan, nil
 }
 
+// analyzeUpsert builds the plan of an insert with an on duplicate key
+// update clause. Upserts are not safe for statement based replication
+// (http://bugs.mysql.com/bug.php?id=58637), so a PLAN_UPSERT_PK runs
+// them as an insert and, if the pk already exists, as an update of
+// that pk. This requires a single row whose pk is known, and an
+// update that doesn't change the pk.
+func analyzeUpsert(ins *sqlparser.Insert, plan *ExecPlan, tableInfo *schema.Table, pkColumnNumbers []int) (*ExecPlan, error) {
+	plan.Reason = REASON_UPSERT
+	rowList, ok := ins.Rows.(sqlparser.Values)
+	if !ok || len(rowList) != 1 {
+		return plan, nil
+	}
+	pkValues, err := getInsertPKValues(pkColumnNumbers, rowList, tableInfo)
+	if err != nil {
+		return nil, err
+	}
+	if pkValues == nil {
+		return plan, nil
+	}
+	pkIndex := tableInfo.Indexes[0]
+	for _, expr := range ins.OnDup {
+		if pkIndex.FindColumn(sqlparser.GetColName(expr.Name)) != -1 {
+			plan.Reason = REASON_PK_CHANGE
+			return plan, nil
+		}
+	}
+	var columns []string
+	if len(ins.Columns) == 0 {
+		for _, column := range tableInfo.Columns {
+			columns = append(columns, column.Name)
+		}
+	} else {
+		for _, column := range ins.Columns {
+			columns = append(columns, sqlparser.GetColName(column.(*sqlparser.NonStarExpr).Expr))
+		}
+	}
+	upsertQuery := GenerateUpsertQuery(ins, columns, rowList[0].(sqlparser.ValTuple), pkIndex)
+	if upsertQuery == nil {
+		return plan, nil
+	}
+	plan.PlanId = PLAN_UPSERT_PK
+	plan.Reason = REASON_DEFAULT
+	plan.OuterQuery = GenerateFullQuery(&sqlparser.Insert{
+		Comments: ins.Comments,
+		Table:    ins.Table,
+		Columns:  ins.Columns,
+		Rows:     ins.Rows,
+	})
+	plan.UpsertQuery = upsertQuery
+	plan.PKValues = pkValues
+	return plan, nil
+}
+
+// selectExprCount returns the number of columns a select statement
+// returns, or -1 if it can't be known without the schema.
+func selectExprCount(sel sqlparser.SelectStatement) int {
+	switch sel := sel.(type) {
+	case *sqlparser.Select:
+		for _, expr := range sel.SelectExprs {
+			if _, ok := expr.(*sqlparser.StarExpr); ok {
+				return -1
+			}
+		}
+		return len(sel.SelectExprs)
+	case *sqlparser.Union:
+		return selectExprCount(sel.Left)
+	case *sqlparser.ParenSelect:
+		return selectExprCount(sel.Select)
+	}
+	return -1
+}
+
+// validateInsertRows verifies that all the rows of a multi-row insert
+// have as many values as there are columns, or as the first row if
+// the columns are not listed. MySQL would fail such inserts anyway,
+// but only after the pks of the other rows were used.
+func validateInsertRows(columns sqlparser.Columns, rowList sqlparser.Values) error {
+	count := len(columns)
+	for i, row := range rowList {
+		tuple, ok := row.(sqlparser.ValTuple)
+		if !ok {
+			return errors.New("row subquery not supported for inserts")
+		}
+		if count == 0 && i == 0 {
+			count = len(tuple)
+		}
+		if len(tuple) != count {
+			return errors.New("column count doesn't match value count")
+		}
+	}
+	return nil
+}
+
 func getInsertPKColumns(columns sqlparser.Columns, tableInfo *schema.Table) (pkColumnNumbers []int) {
 	if len(columns) == 0 {
 		return tableInfo.PKColumns
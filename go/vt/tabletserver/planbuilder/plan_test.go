@@ -123,6 +123,43 @@ func TestDDLPlan(t *testing.T) {
 		matchString(t, tcase.lineno, expected["Action"], plan.Action)
 		matchString(t, tcase.lineno, expected["TableName"], plan.TableName)
 		matchString(t, tcase.lineno, expected["NewName"], plan.NewName)
+		if changed, ok := expected["SchemaChanged"]; ok && changed.(bool) != plan.SchemaChanged() {
+			t.Errorf("Line %d: expected SchemaChanged: %v, received %v", tcase.lineno, changed, plan.SchemaChanged())
+		}
+		if temporary, _ := expected["Temporary"].(bool); temporary != plan.Temporary {
+			t.Errorf("Line %d: expected Temporary: %v, received %v", tcase.lineno, temporary, plan.Temporary)
+		}
+	}
+}
+
+func TestPassthroughPlan(t *testing.T) {
+	cases := []struct {
+		sql    string
+		planID PlanType
+		reason ReasonType
+		query  string
+	}{
+		{"select * from t", PLAN_PASS_SELECT, REASON_TABLE, "select * from t"},
+		{"select * from t for update", PLAN_PASS_SELECT, REASON_LOCK, "select * from t for update"},
+		{"select a from t union select a from u", PLAN_PASS_SELECT, REASON_TABLE, "select a from t union select a from u"},
+		{"insert into t values (:a)", PLAN_PASS_DML, REASON_TABLE, "insert into t values (:a)"},
+		{"update t set a = 1", PLAN_PASS_DML, REASON_TABLE, "update t set a = 1"},
+		{"delete from t", PLAN_PASS_DML, REASON_TABLE, "delete from t"},
+	}
+	for _, c := range cases {
+		plan, err := GetPassthroughPlan(c.sql)
+		if err != nil {
+			t.Errorf("GetPassthroughPlan(%q): %v", c.sql, err)
+			continue
+		}
+		if plan.PlanId != c.planID || plan.Reason != c.reason || plan.FullQuery.Query != c.query {
+			t.Errorf("GetPassthroughPlan(%q) = %v, %v, %q, want %v, %v, %q", c.sql, plan.PlanId, plan.Reason, plan.FullQuery.Query, c.planID, c.reason, c.query)
+		}
+	}
+	for _, sql := range []string{"create table t", "set a = 1", "select"} {
+		if _, err := GetPassthroughPlan(sql); err == nil {
+			t.Errorf("GetPassthroughPlan(%q) succeeded", sql)
+		}
 	}
 }
 
@@ -40,6 +40,20 @@ const (
 	PLAN_SET
 	// PLAN_DDL is for DDL statements
 	PLAN_DDL
+	// PLAN_NEXTVAL is for selects of nextval() from sequence tables
+	PLAN_NEXTVAL
+	// PLAN_SAVEPOINT is for SAVEPOINT statements
+	PLAN_SAVEPOINT
+	// PLAN_ROLLBACK_SAVEPOINT is for ROLLBACK TO SAVEPOINT statements
+	PLAN_ROLLBACK_SAVEPOINT
+	// PLAN_RELEASE_SAVEPOINT is for RELEASE SAVEPOINT statements
+	PLAN_RELEASE_SAVEPOINT
+	// PLAN_SELECT_LOCK is a locking select, FOR UPDATE or LOCK IN
+	// SHARE MODE, whose where clause uses an index
+	PLAN_SELECT_LOCK
+	// PLAN_UPSERT_PK is a single row insert ... on duplicate key
+	// update, where the PK value is supplied with the query
+	PLAN_UPSERT_PK
 	NumPlans
 )
 
@@ -56,6 +70,12 @@ var planName = []string{
 	"INSERT_SUBQUERY",
 	"SET",
 	"DDL",
+	"NEXTVAL",
+	"SAVEPOINT",
+	"ROLLBACK_SAVEPOINT",
+	"RELEASE_SAVEPOINT",
+	"SELECT_LOCK",
+	"UPSERT_PK",
 }
 
 func (pt PlanType) String() string {
@@ -75,7 +95,7 @@ func PlanByName(s string) (pt PlanType, ok bool) {
 }
 
 func (pt PlanType) IsSelect() bool {
-	return pt == PLAN_PASS_SELECT || pt == PLAN_PK_EQUAL || pt == PLAN_PK_IN || pt == PLAN_SELECT_SUBQUERY
+	return pt == PLAN_PASS_SELECT || pt == PLAN_PK_EQUAL || pt == PLAN_PK_IN || pt == PLAN_SELECT_SUBQUERY || pt == PLAN_SELECT_LOCK
 }
 
 func (pt PlanType) MarshalJSON() ([]byte, error) {
@@ -88,17 +108,23 @@ func (pt PlanType) MinRole() tableacl.Role {
 }
 
 var tableAclRoles = map[PlanType]tableacl.Role{
-	PLAN_PASS_SELECT:     tableacl.READER,
-	PLAN_PK_EQUAL:        tableacl.READER,
-	PLAN_PK_IN:           tableacl.READER,
-	PLAN_SELECT_SUBQUERY: tableacl.READER,
-	PLAN_SET:             tableacl.READER,
-	PLAN_PASS_DML:        tableacl.WRITER,
-	PLAN_DML_PK:          tableacl.WRITER,
-	PLAN_DML_SUBQUERY:    tableacl.WRITER,
-	PLAN_INSERT_PK:       tableacl.WRITER,
-	PLAN_INSERT_SUBQUERY: tableacl.WRITER,
-	PLAN_DDL:             tableacl.ADMIN,
+	PLAN_PASS_SELECT:        tableacl.READER,
+	PLAN_PK_EQUAL:           tableacl.READER,
+	PLAN_PK_IN:              tableacl.READER,
+	PLAN_SELECT_SUBQUERY:    tableacl.READER,
+	PLAN_SET:                tableacl.READER,
+	PLAN_PASS_DML:           tableacl.WRITER,
+	PLAN_DML_PK:             tableacl.WRITER,
+	PLAN_DML_SUBQUERY:       tableacl.WRITER,
+	PLAN_INSERT_PK:          tableacl.WRITER,
+	PLAN_INSERT_SUBQUERY:    tableacl.WRITER,
+	PLAN_DDL:                tableacl.ADMIN,
+	PLAN_NEXTVAL:            tableacl.WRITER,
+	PLAN_SAVEPOINT:          tableacl.READER,
+	PLAN_ROLLBACK_SAVEPOINT: tableacl.READER,
+	PLAN_RELEASE_SAVEPOINT:  tableacl.READER,
+	PLAN_SELECT_LOCK:        tableacl.READER,
+	PLAN_UPSERT_PK:          tableacl.WRITER,
 }
 
 type ReasonType int
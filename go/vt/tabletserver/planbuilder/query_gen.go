@@ -7,6 +7,7 @@ package planbuilder
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/youtube/vitess/go/vt/schema"
 	"github.com/youtube/vitess/go/vt/sqlparser"
@@ -35,6 +36,8 @@ func FormatImpossible(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
 	switch node := node.(type) {
 	case *sqlparser.Select:
 		buf.Myprintf("select %v from %v where 1 != 1", node.SelectExprs, node.From)
+	case *sqlparser.Union:
+		buf.Myprintf("%v %s %v", node.Left, node.Type, node.Right)
 	case *sqlparser.JoinTableExpr:
 		if node.Join == sqlparser.AST_LEFT_JOIN || node.Join == sqlparser.AST_RIGHT_JOIN {
 			// ON clause is requried
@@ -49,15 +52,24 @@ func FormatImpossible(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
 
 func GenerateSelectLimitQuery(selStmt sqlparser.SelectStatement) *sqlparser.ParsedQuery {
 	buf := sqlparser.NewTrackedBuffer(nil)
-	sel, ok := selStmt.(*sqlparser.Select)
-	if ok {
-		limit := sel.Limit
-		if limit == nil {
+	switch sel := selStmt.(type) {
+	case *sqlparser.Select:
+		if sel.Limit == nil {
 			sel.Limit = execLimit
 			defer func() {
 				sel.Limit = nil
 			}()
 		}
+	case *sqlparser.Union:
+		// The limit of a union applies to all its rows.
+		if sel.Limit == nil {
+			sel.Limit = execLimit
+			defer func() {
+				sel.Limit = nil
+			}()
+		}
+	case *sqlparser.ParenSelect:
+		return GenerateSelectLimitQuery(sel.Select)
 	}
 	buf.Myprintf("%v", selStmt)
 	return buf.ParsedQuery()
@@ -94,6 +106,41 @@ func GenerateInsertOuterQuery(ins *sqlparser.Insert) *sqlparser.ParsedQuery {
 	return buf.ParsedQuery()
 }
 
+// GenerateUpsertQuery generates the update by pk of the row that an
+// upsert of the single row of values could not insert, from its on
+// duplicate key update clause. The values(col) functions are replaced
+// by the values of the row. It returns nil if a function refers to a
+// column that is not in columns, the columns of the row.
+func GenerateUpsertQuery(ins *sqlparser.Insert, columns []string, row sqlparser.ValTuple, pkIndex *schema.Index) *sqlparser.ParsedQuery {
+	ok := true
+	buf := sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+		funcExpr, isFunc := node.(*sqlparser.FuncExpr)
+		if !isFunc || !strings.EqualFold(string(funcExpr.Name), "values") {
+			node.Format(buf)
+			return
+		}
+		if len(funcExpr.Exprs) == 1 {
+			if arg, isExpr := funcExpr.Exprs[0].(*sqlparser.NonStarExpr); isExpr {
+				name := sqlparser.GetColName(arg.Expr)
+				for i, column := range columns {
+					if name != "" && strings.EqualFold(column, name) && i < len(row) {
+						buf.Myprintf("%v", row[i])
+						return
+					}
+				}
+			}
+		}
+		ok = false
+		node.Format(buf)
+	})
+	buf.Myprintf("update %v%v set %v where ", ins.Comments, ins.Table, sqlparser.UpdateExprs(ins.OnDup))
+	generatePKWhere(buf, pkIndex)
+	if !ok {
+		return nil
+	}
+	return buf.ParsedQuery()
+}
+
 func GenerateUpdateOuterQuery(upd *sqlparser.Update, pkIndex *schema.Index) *sqlparser.ParsedQuery {
 	buf := sqlparser.NewTrackedBuffer(nil)
 	buf.Myprintf("update %v%v set %v where ", upd.Comments, upd.Table, upd.Exprs)
@@ -175,6 +222,39 @@ func GenerateSubquery(columns []string, table *sqlparser.AliasedTableExpr, where
 	return buf.ParsedQuery()
 }
 
+// GenerateChunkQueries generates the queries that select, in pk order,
+// the pks of the rows of a DML by chunks of :_vtChunkSize rows. first
+// selects the first chunk, and next the chunk after the pk passed as
+// list variables.
+func GenerateChunkQueries(pkIndex *schema.Index, table *sqlparser.AliasedTableExpr, where *sqlparser.Where) (first, next *sqlparser.ParsedQuery) {
+	columns := strings.Join(pkIndex.Columns, ", ")
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("select %s from %v%v", columns, table, where)
+	generateChunkLimit(buf, columns)
+	first = buf.ParsedQuery()
+
+	buf = sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("select %s from %v where ", columns, table)
+	if where != nil {
+		buf.Myprintf("(%v) and ", where.Expr)
+	}
+	buf.Myprintf("(%s) > (", columns)
+	for i := 0; i < len(pkIndex.Columns); i++ {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.Myprintf("%a", strconv.FormatInt(int64(i), 10))
+	}
+	buf.WriteString(")")
+	generateChunkLimit(buf, columns)
+	next = buf.ParsedQuery()
+	return first, next
+}
+
+func generateChunkLimit(buf *sqlparser.TrackedBuffer, columns string) {
+	buf.Myprintf(" order by %s%v%s", columns, chunkLimit, sqlparser.AST_FOR_UPDATE)
+}
+
 func writeColumnList(buf *sqlparser.TrackedBuffer, columns []schema.TableColumn) {
 	i := 0
 	for i = 0; i < len(columns)-1; i++ {
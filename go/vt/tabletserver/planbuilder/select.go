@@ -6,12 +6,17 @@ package planbuilder
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/youtube/vitess/go/vt/schema"
 	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 func analyzeSelect(sel *sqlparser.Select, getTable TableGetter) (plan *ExecPlan, err error) {
+	if plan, err = analyzeNextVal(sel, getTable); plan != nil || err != nil {
+		return plan, err
+	}
+
 	// Default plan
 	plan = &ExecPlan{
 		PlanId:     PLAN_PASS_SELECT,
@@ -41,10 +46,9 @@ func analyzeSelect(sel *sqlparser.Select, getTable TableGetter) (plan *ExecPlan,
 		return nil, err
 	}
 
-	// Don't improve the plan if the select is locking the row
+	// Locking selects can't use the rowcache
 	if sel.Lock != "" {
-		plan.Reason = REASON_LOCK
-		return plan, nil
+		return analyzeSelectLock(sel, plan, tableInfo), nil
 	}
 
 	// Further improvements possible only if table is row-cached
@@ -167,6 +171,42 @@ func analyzeFrom(tableExprs sqlparser.TableExprs) (tablename string, hasHints bo
 	return sqlparser.GetTableName(node.Expr), node.Hints != nil
 }
 
+// analyzeSelectLock builds the plan of a locking select. It's a
+// PLAN_SELECT_LOCK only if its where clause uses an index, so that
+// MySQL doesn't lock the rows of a full table scan. Its limit
+// clause is rewritten, because MySQL locks the rows it returns
+// before the size of the result is checked.
+func analyzeSelectLock(sel *sqlparser.Select, plan *ExecPlan, tableInfo *schema.Table) *ExecPlan {
+	plan.Reason = REASON_LOCK
+	conditions := analyzeWhere(sel.Where)
+	if conditions == nil {
+		return plan
+	}
+	plan.IndexUsed = getIndexMatch(conditions, tableInfo.Indexes)
+	if plan.IndexUsed == "" {
+		return plan
+	}
+
+	limit := &sqlparser.Limit{Rowcount: lockLimit}
+	if sel.Limit != nil {
+		if !sqlparser.IsValue(sel.Limit.Rowcount) {
+			return plan
+		}
+		rowcount, err := sqlparser.AsInterface(sel.Limit.Rowcount)
+		if err != nil {
+			return plan
+		}
+		plan.LockLimit = rowcount
+		limit.Offset = sel.Limit.Offset
+	}
+	saved := sel.Limit
+	sel.Limit = limit
+	plan.FullQuery = GenerateFullQuery(sel)
+	sel.Limit = saved
+	plan.PlanId = PLAN_SELECT_LOCK
+	return plan
+}
+
 func analyzeWhere(node *sqlparser.Where) (conditions []sqlparser.BoolExpr) {
 	if node == nil {
 		return nil
@@ -217,3 +257,53 @@ func analyzeBoolean(node sqlparser.BoolExpr) (conditions []sqlparser.BoolExpr) {
 	}
 	return nil
 }
+
+// analyzeNextVal returns a PLAN_NEXTVAL plan if sel is
+// "select nextval([count]) from table", and nil otherwise.
+// table must be a sequence table.
+func analyzeNextVal(sel *sqlparser.Select, getTable TableGetter) (plan *ExecPlan, err error) {
+	if len(sel.SelectExprs) != 1 {
+		return nil, nil
+	}
+	expr, ok := sel.SelectExprs[0].(*sqlparser.NonStarExpr)
+	if !ok {
+		return nil, nil
+	}
+	fun, ok := expr.Expr.(*sqlparser.FuncExpr)
+	if !ok || strings.ToLower(string(fun.Name)) != "nextval" {
+		return nil, nil
+	}
+	tableName, _ := analyzeFrom(sel.From)
+	if tableName == "" {
+		return nil, nil
+	}
+	plan = &ExecPlan{PlanId: PLAN_NEXTVAL}
+	tableInfo, err := plan.setTableInfo(tableName, getTable)
+	if err != nil {
+		return nil, err
+	}
+	if tableInfo.Type != schema.TYPE_SEQUENCE {
+		return nil, fmt.Errorf("%s is not a sequence table", tableName)
+	}
+	if sel.Where != nil || sel.OrderBy != nil || sel.Limit != nil || sel.Lock != "" || sel.Distinct != "" || sel.GroupBy != nil || sel.Having != nil {
+		return nil, fmt.Errorf("nextval does not allow clauses")
+	}
+	switch len(fun.Exprs) {
+	case 0:
+		return plan, nil
+	case 1:
+		countExpr, ok := fun.Exprs[0].(*sqlparser.NonStarExpr)
+		if !ok {
+			return nil, fmt.Errorf("invalid count for nextval")
+		}
+		count, ok := countExpr.Expr.(sqlparser.ValExpr)
+		if !ok || !sqlparser.IsValue(count) {
+			return nil, fmt.Errorf("invalid count for nextval")
+		}
+		if plan.NextValCount, err = sqlparser.AsInterface(count); err != nil {
+			return nil, err
+		}
+		return plan, nil
+	}
+	return nil, fmt.Errorf("too many arguments for nextval")
+}
@@ -0,0 +1,129 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+// PreparedStatements is the registry of the statements prepared by
+// the clients. A prepared statement holds the plan of its query, so
+// its executions don't parse the query or look it up in the query
+// plan cache, and don't depend on the plan staying in that cache.
+// The query sent to MySQL is still generated from the plan and the
+// bind variables for each execution: the rowcache needs the values,
+// and the mysql package only speaks the text protocol.
+//
+// A statement belongs to the client that prepared it, in its session:
+// like reserved connections, only that client can execute or close
+// it. Statements are dropped when the query service stops serving,
+// like the sessions they were prepared in.
+type PreparedStatements struct {
+	// maxSize is the maximum number of prepared statements,
+	// which protects the server from clients that never close them.
+	maxSize sync2.AtomicInt64
+
+	mu         sync.Mutex
+	statements map[int64]*preparedStatement
+	lastId     int64
+}
+
+type preparedStatement struct {
+	// sql is the query without its trailing comments,
+	// which are in comment.
+	sql     string
+	comment string
+
+	// sessionID and caller are the session and the
+	// context of the client that prepared the statement.
+	sessionID int64
+	caller    context.Context
+
+	// plan was built for the plan generation of SchemaInfo
+	// in generation. It's rebuilt when that changes.
+	mu         sync.Mutex
+	plan       *ExecPlan
+	generation int64
+}
+
+// NewPreparedStatements creates a new PreparedStatements. If name is
+// empty, its stats are not exported.
+func NewPreparedStatements(name string, maxSize int) *PreparedStatements {
+	ps := &PreparedStatements{
+		maxSize:    sync2.AtomicInt64(maxSize),
+		statements: make(map[int64]*preparedStatement),
+	}
+	if name != "" {
+		stats.Publish(name, stats.IntFunc(ps.Length))
+		stats.Publish(name+"MaxSize", stats.IntFunc(ps.maxSize.Get))
+	}
+	return ps
+}
+
+// SetMaxSize changes the maximum number of prepared statements.
+// Existing statements are kept.
+func (ps *PreparedStatements) SetMaxSize(size int) {
+	ps.maxSize.Set(int64(size))
+}
+
+// Length returns the number of prepared statements.
+func (ps *PreparedStatements) Length() int64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return int64(len(ps.statements))
+}
+
+// add registers a new statement and returns its id.
+func (ps *PreparedStatements) add(stmt *preparedStatement) int64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if int64(len(ps.statements)) >= ps.maxSize.Get() {
+		panic(NewTabletError(FAIL, "Too many prepared statements: %d", len(ps.statements)))
+	}
+	ps.lastId++
+	ps.statements[ps.lastId] = stmt
+	return ps.lastId
+}
+
+// get returns the statement id. It panics if there's none, or if
+// caller didn't prepare it in session sessionID.
+func (ps *PreparedStatements) get(id, sessionID int64, caller context.Context) *preparedStatement {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.owned(id, sessionID, caller)
+}
+
+// remove drops the statement id. Like get, it panics if there's none,
+// or if caller didn't prepare it in session sessionID.
+func (ps *PreparedStatements) remove(id, sessionID int64, caller context.Context) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.owned(id, sessionID, caller)
+	delete(ps.statements, id)
+}
+
+// owned returns the statement id of caller in session sessionID.
+// ps.mu must be held.
+func (ps *PreparedStatements) owned(id, sessionID int64, caller context.Context) *preparedStatement {
+	stmt, ok := ps.statements[id]
+	if !ok {
+		panic(NewTabletError(FAIL, "Prepared statement %d not found", id))
+	}
+	if stmt.sessionID != sessionID || !sameClient(stmt.caller, caller) {
+		panic(NewTabletError(FAIL, "Prepared statement %d: not prepared by this client", id))
+	}
+	return stmt
+}
+
+// clear drops all the statements.
+func (ps *PreparedStatements) clear() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.statements = make(map[int64]*preparedStatement)
+}
@@ -0,0 +1,68 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+)
+
+func expectTabletError(t *testing.T, name string, f func()) {
+	defer func() {
+		if _, ok := recover().(*TabletError); !ok {
+			t.Errorf("%s did not fail with a TabletError", name)
+		}
+	}()
+	f()
+}
+
+func TestPreparedStatements(t *testing.T) {
+	ps := NewPreparedStatements("", 2)
+	owner := &fakeContext{remoteAddr: "10.0.0.1:1234", username: "alice"}
+	id1 := ps.add(&preparedStatement{sql: "select 1", sessionID: 1, caller: owner})
+	id2 := ps.add(&preparedStatement{sql: "select 2", sessionID: 1, caller: owner})
+	if id1 == id2 {
+		t.Errorf("ids of different statements: %d, %d", id1, id2)
+	}
+	if stmt := ps.get(id2, 1, owner); stmt.sql != "select 2" {
+		t.Errorf("get(%d): %s, want select 2", id2, stmt.sql)
+	}
+	expectTabletError(t, "add beyond the max size", func() {
+		ps.add(&preparedStatement{sql: "select 3", sessionID: 1, caller: owner})
+	})
+
+	// only the owner, in its session, can use a statement
+	other := &fakeContext{remoteAddr: "10.0.0.2:1234", username: "alice"}
+	expectTabletError(t, "get by another client", func() {
+		ps.get(id1, 1, other)
+	})
+	expectTabletError(t, "get in another session", func() {
+		ps.get(id1, 2, owner)
+	})
+	expectTabletError(t, "remove by another client", func() {
+		ps.remove(id1, 1, other)
+	})
+	if length := ps.Length(); length != 2 {
+		t.Errorf("Length after a remove by another client: %d, want 2", length)
+	}
+
+	ps.remove(id1, 1, owner)
+	if length := ps.Length(); length != 1 {
+		t.Errorf("Length: %d, want 1", length)
+	}
+	expectTabletError(t, "get of a removed statement", func() {
+		ps.get(id1, 1, owner)
+	})
+	expectTabletError(t, "remove of a removed statement", func() {
+		ps.remove(id1, 1, owner)
+	})
+	if id3 := ps.add(&preparedStatement{sql: "select 3", sessionID: 1, caller: owner}); id3 == id1 {
+		t.Errorf("id of a removed statement reused: %d", id3)
+	}
+
+	ps.clear()
+	if length := ps.Length(); length != 0 {
+		t.Errorf("Length after clear: %d, want 0", length)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/youtube/vitess/go/bson"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 type reflectQuery struct {
@@ -15,6 +16,11 @@ type reflectQuery struct {
 	BindVariables map[string]interface{}
 	SessionId     int64
 	TransactionId int64
+	MinGTIDField  myproto.GTIDField
+	Timeout       int64
+	Batch         bool
+	CallerId      string
+	ReservedId    int64
 }
 
 type extraQuery struct {
@@ -23,6 +29,11 @@ type extraQuery struct {
 	BindVariables map[string]interface{}
 	SessionId     int64
 	TransactionId int64
+	MinGTIDField  myproto.GTIDField
+	Timeout       int64
+	Batch         bool
+	CallerId      string
+	ReservedId    int64
 }
 
 func TestQuery(t *testing.T) {
@@ -31,6 +42,11 @@ func TestQuery(t *testing.T) {
 		BindVariables: map[string]interface{}{"val": int64(1)},
 		SessionId:     2,
 		TransactionId: 1,
+		MinGTIDField:  myproto.GTIDField{Value: myproto.GoogleGTID{GroupID: 41}},
+		Timeout:       1000,
+		Batch:         true,
+		CallerId:      "user",
+		ReservedId:    3,
 	})
 	if err != nil {
 		t.Error(err)
@@ -42,6 +58,11 @@ func TestQuery(t *testing.T) {
 		BindVariables: map[string]interface{}{"val": int64(1)},
 		SessionId:     2,
 		TransactionId: 1,
+		MinGTIDField:  myproto.GTIDField{Value: myproto.GoogleGTID{GroupID: 41}},
+		Timeout:       1000,
+		Batch:         true,
+		CallerId:      "user",
+		ReservedId:    3,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -66,6 +87,18 @@ func TestQuery(t *testing.T) {
 	if custom.SessionId != unmarshalled.SessionId {
 		t.Errorf("want %v, got %v", custom.SessionId, unmarshalled.SessionId)
 	}
+	if custom.MinGTIDField != unmarshalled.MinGTIDField {
+		t.Errorf("want %v, got %v", custom.MinGTIDField, unmarshalled.MinGTIDField)
+	}
+	if custom.Timeout != unmarshalled.Timeout {
+		t.Errorf("want %v, got %v", custom.Timeout, unmarshalled.Timeout)
+	}
+	if custom.Batch != unmarshalled.Batch {
+		t.Errorf("want %v, got %v", custom.Batch, unmarshalled.Batch)
+	}
+	if custom.ReservedId != unmarshalled.ReservedId {
+		t.Errorf("want %v, got %v", custom.ReservedId, unmarshalled.ReservedId)
+	}
 	if custom.BindVariables["val"].(int64) != unmarshalled.BindVariables["val"].(int64) {
 		t.Errorf("want %v, got %v", custom.BindVariables["val"], unmarshalled.BindVariables["val"])
 	}
@@ -83,18 +116,21 @@ func TestQuery(t *testing.T) {
 type reflectSession struct {
 	SessionId     int64
 	TransactionId int64
+	Timeout       int64
 }
 
 type extraSession struct {
 	Extra         int
 	SessionId     int64
 	TransactionId int64
+	Timeout       int64
 }
 
 func TestSession(t *testing.T) {
 	reflected, err := bson.Marshal(&reflectSession{
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       1000,
 	})
 	if err != nil {
 		t.Error(err)
@@ -104,6 +140,7 @@ func TestSession(t *testing.T) {
 	custom := Session{
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       1000,
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -193,6 +230,8 @@ type reflectQueryList struct {
 	Queries       []BoundQuery
 	SessionId     int64
 	TransactionId int64
+	Timeout       int64
+	CallerId      string
 }
 
 type extraQueryList struct {
@@ -200,6 +239,8 @@ type extraQueryList struct {
 	Queries       []BoundQuery
 	SessionId     int64
 	TransactionId int64
+	Timeout       int64
+	CallerId      string
 }
 
 func TestQueryList(t *testing.T) {
@@ -210,6 +251,8 @@ func TestQueryList(t *testing.T) {
 		}},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       1000,
+		CallerId:      "user",
 	})
 	if err != nil {
 		t.Error(err)
@@ -223,6 +266,8 @@ func TestQueryList(t *testing.T) {
 		}},
 		SessionId:     2,
 		TransactionId: 1,
+		Timeout:       1000,
+		CallerId:      "user",
 	}
 	encoded, err := bson.Marshal(&custom)
 	if err != nil {
@@ -244,6 +289,9 @@ func TestQueryList(t *testing.T) {
 	if custom.SessionId != unmarshalled.SessionId {
 		t.Errorf("want %v, got %v", custom.SessionId, unmarshalled.SessionId)
 	}
+	if custom.Timeout != unmarshalled.Timeout {
+		t.Errorf("want %v, got %v", custom.Timeout, unmarshalled.Timeout)
+	}
 	if custom.Queries[0].Sql != unmarshalled.Queries[0].Sql {
 		t.Errorf("want %v, got %v", custom.Queries[0].Sql, unmarshalled.Queries[0].Sql)
 	}
@@ -260,3 +308,84 @@ func TestQueryList(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+type reflectPreparedQuery struct {
+	StatementId   int64
+	BindVariables map[string]interface{}
+	SessionId     int64
+	TransactionId int64
+	Timeout       int64
+	CallerId      string
+}
+
+type extraPreparedQuery struct {
+	Extra         int
+	StatementId   int64
+	BindVariables map[string]interface{}
+	SessionId     int64
+	TransactionId int64
+	Timeout       int64
+	CallerId      string
+}
+
+func TestPreparedQuery(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectPreparedQuery{
+		StatementId:   3,
+		BindVariables: map[string]interface{}{"val": int64(1)},
+		SessionId:     2,
+		TransactionId: 1,
+		Timeout:       1000,
+		CallerId:      "user",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := PreparedQuery{
+		StatementId:   3,
+		BindVariables: map[string]interface{}{"val": int64(1)},
+		SessionId:     2,
+		TransactionId: 1,
+		Timeout:       1000,
+		CallerId:      "user",
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%#v, got\n%#v", want, got)
+	}
+
+	var unmarshalled PreparedQuery
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if custom.StatementId != unmarshalled.StatementId {
+		t.Errorf("want %v, got %v", custom.StatementId, unmarshalled.StatementId)
+	}
+	if custom.BindVariables["val"].(int64) != unmarshalled.BindVariables["val"].(int64) {
+		t.Errorf("want %v, got %v", custom.BindVariables["val"], unmarshalled.BindVariables["val"])
+	}
+	if custom.SessionId != unmarshalled.SessionId {
+		t.Errorf("want %v, got %v", custom.SessionId, unmarshalled.SessionId)
+	}
+	if custom.TransactionId != unmarshalled.TransactionId {
+		t.Errorf("want %v, got %v", custom.TransactionId, unmarshalled.TransactionId)
+	}
+	if custom.Timeout != unmarshalled.Timeout {
+		t.Errorf("want %v, got %v", custom.Timeout, unmarshalled.Timeout)
+	}
+
+	extra, err := bson.Marshal(&extraPreparedQuery{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = bson.Unmarshal(extra, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes PreparedQuery.
+func (preparedQuery *PreparedQuery) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeInt64(buf, "StatementId", preparedQuery.StatementId)
+	// map[string]interface{}
+	{
+		bson.EncodePrefix(buf, bson.Object, "BindVariables")
+		lenWriter := bson.NewLenWriter(buf)
+		for _k, _v1 := range preparedQuery.BindVariables {
+			bson.EncodeInterface(buf, _k, _v1)
+		}
+		lenWriter.Close()
+	}
+	bson.EncodeInt64(buf, "SessionId", preparedQuery.SessionId)
+	bson.EncodeInt64(buf, "TransactionId", preparedQuery.TransactionId)
+	bson.EncodeInt64(buf, "Timeout", preparedQuery.Timeout)
+	bson.EncodeString(buf, "CallerId", preparedQuery.CallerId)
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into PreparedQuery.
+func (preparedQuery *PreparedQuery) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for PreparedQuery", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "StatementId":
+			preparedQuery.StatementId = bson.DecodeInt64(buf, kind)
+		case "BindVariables":
+			// map[string]interface{}
+			if kind != bson.Null {
+				if kind != bson.Object {
+					panic(bson.NewBsonError("unexpected kind %v for preparedQuery.BindVariables", kind))
+				}
+				bson.Next(buf, 4)
+				preparedQuery.BindVariables = make(map[string]interface{})
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					_k := bson.ReadCString(buf)
+					var _v1 interface{}
+					_v1 = bson.DecodeInterface(buf, kind)
+					preparedQuery.BindVariables[_k] = _v1
+				}
+			}
+		case "SessionId":
+			preparedQuery.SessionId = bson.DecodeInt64(buf, kind)
+		case "TransactionId":
+			preparedQuery.TransactionId = bson.DecodeInt64(buf, kind)
+		case "Timeout":
+			preparedQuery.Timeout = bson.DecodeInt64(buf, kind)
+		case "CallerId":
+			preparedQuery.CallerId = bson.DecodeString(buf, kind)
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
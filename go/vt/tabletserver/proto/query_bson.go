@@ -31,6 +31,11 @@ func (query *Query) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 	}
 	bson.EncodeInt64(buf, "SessionId", query.SessionId)
 	bson.EncodeInt64(buf, "TransactionId", query.TransactionId)
+	query.MinGTIDField.MarshalBson(buf, "MinGTIDField")
+	bson.EncodeInt64(buf, "Timeout", query.Timeout)
+	bson.EncodeBool(buf, "Batch", query.Batch)
+	bson.EncodeString(buf, "CallerId", query.CallerId)
+	bson.EncodeInt64(buf, "ReservedId", query.ReservedId)
 
 	lenWriter.Close()
 }
@@ -70,6 +75,16 @@ func (query *Query) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			query.SessionId = bson.DecodeInt64(buf, kind)
 		case "TransactionId":
 			query.TransactionId = bson.DecodeInt64(buf, kind)
+		case "MinGTIDField":
+			query.MinGTIDField.UnmarshalBson(buf, kind)
+		case "Timeout":
+			query.Timeout = bson.DecodeInt64(buf, kind)
+		case "Batch":
+			query.Batch = bson.DecodeBool(buf, kind)
+		case "CallerId":
+			query.CallerId = bson.DecodeString(buf, kind)
+		case "ReservedId":
+			query.ReservedId = bson.DecodeInt64(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
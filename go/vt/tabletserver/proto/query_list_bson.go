@@ -30,6 +30,8 @@ func (queryList *QueryList) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 	}
 	bson.EncodeInt64(buf, "SessionId", queryList.SessionId)
 	bson.EncodeInt64(buf, "TransactionId", queryList.TransactionId)
+	bson.EncodeInt64(buf, "Timeout", queryList.Timeout)
+	bson.EncodeString(buf, "CallerId", queryList.CallerId)
 
 	lenWriter.Close()
 }
@@ -67,6 +69,10 @@ func (queryList *QueryList) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			queryList.SessionId = bson.DecodeInt64(buf, kind)
 		case "TransactionId":
 			queryList.TransactionId = bson.DecodeInt64(buf, kind)
+		case "Timeout":
+			queryList.Timeout = bson.DecodeInt64(buf, kind)
+		case "CallerId":
+			queryList.CallerId = bson.DecodeString(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -21,6 +21,7 @@ func (session *Session) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 
 	bson.EncodeInt64(buf, "SessionId", session.SessionId)
 	bson.EncodeInt64(buf, "TransactionId", session.TransactionId)
+	bson.EncodeInt64(buf, "Timeout", session.Timeout)
 
 	lenWriter.Close()
 }
@@ -43,6 +44,8 @@ func (session *Session) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 			session.SessionId = bson.DecodeInt64(buf, kind)
 		case "TransactionId":
 			session.TransactionId = bson.DecodeInt64(buf, kind)
+		case "Timeout":
+			session.Timeout = bson.DecodeInt64(buf, kind)
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/youtube/vitess/go/bytes2"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
 type SessionParams struct {
@@ -25,6 +26,26 @@ type Query struct {
 	BindVariables map[string]interface{}
 	SessionId     int64
 	TransactionId int64
+	// MinGTIDField, if set, makes the query ignore the rowcache
+	// entries that were filled before that position. Clients can
+	// pass the position of their last write to read their writes.
+	MinGTIDField myproto.GTIDField
+	// Timeout, if non-zero, overrides the server's query timeout.
+	// The query is killed in MySQL when it runs for longer.
+	// It's in nanoseconds.
+	Timeout int64
+	// Batch, if set, runs the query in the batch pool, which
+	// has its own limits. It's meant for long analytics scans,
+	// so they can't exhaust the pool of the regular traffic.
+	Batch bool
+	// CallerId, if set, is the effective caller of the query: the
+	// user the authenticated client sends the query on behalf of.
+	// Stats and quotas are per effective caller.
+	CallerId string
+	// ReservedId, if set, runs the query on the connection
+	// reserved by ReserveConnection, which keeps the session
+	// state, like the variables set by earlier queries.
+	ReservedId int64
 }
 
 // String prints a readable version of Query, and also truncates
@@ -63,6 +84,11 @@ type QueryList struct {
 	Queries       []BoundQuery
 	SessionId     int64
 	TransactionId int64
+	// Timeout, if non-zero, overrides the server's query timeout
+	// for each query of the list, in nanoseconds.
+	Timeout int64
+	// CallerId is the effective caller of the queries, like in Query.
+	CallerId string
 }
 
 type QueryResultList struct {
@@ -72,8 +98,202 @@ type QueryResultList struct {
 type Session struct {
 	SessionId     int64
 	TransactionId int64
+	// Timeout, if non-zero, overrides the server's transaction
+	// timeout for the transaction started by Begin, in nanoseconds.
+	Timeout int64
 }
 
 type TransactionInfo struct {
 	TransactionId int64
 }
+
+// QueryPlanRequest selects a plan of the query plan cache by its query.
+type QueryPlanRequest struct {
+	Sql string
+}
+
+// QueryPlan describes a plan of the query plan cache, and the
+// stats of the queries that used it. Times are in nanoseconds.
+type QueryPlan struct {
+	Sql        string
+	PlanType   string
+	Reason     string
+	Table      string
+	QueryCount int64
+	Time       int64
+	RowCount   int64
+	ErrorCount int64
+	AvgTime    int64
+	AvgRows    int64
+}
+
+type QueryPlanList struct {
+	Plans []QueryPlan
+}
+
+// ExplainRequest is the query to explain, without bind variables.
+type ExplainRequest struct {
+	Sql       string
+	SessionId int64
+}
+
+// QueryExplanation is the plan the tablet builds for a query, which
+// it explains without executing the query. The queries are the ones
+// sent to MySQL, before the bind variables are substituted.
+type QueryExplanation struct {
+	PlanType   string
+	Reason     string
+	Table      string
+	IndexUsed  string
+	FieldQuery string
+	FullQuery  string
+	OuterQuery string
+	Subquery   string
+	// Rowcache is "read" if the rows are served by the rowcache,
+	// "invalidate" if the rows changed by the query are invalidated
+	// in the rowcache, and "none" otherwise.
+	Rowcache string
+	// Rules are the names of the query rules that apply to the query.
+	Rules []string
+}
+
+// PrepareRequest is the query to prepare, without bind variables.
+type PrepareRequest struct {
+	Sql       string
+	SessionId int64
+}
+
+// PreparedStatement identifies a prepared statement, in the
+// session it was prepared in.
+type PreparedStatement struct {
+	StatementId int64
+	SessionId   int64
+}
+
+// PreparedQuery executes a prepared statement with its
+// bind variables. The other fields are the ones of Query.
+type PreparedQuery struct {
+	StatementId   int64
+	BindVariables map[string]interface{}
+	SessionId     int64
+	TransactionId int64
+	Timeout       int64
+	CallerId      string
+}
+
+// NextValRequest allocates Count consecutive values
+// of the sequence table Sequence.
+type NextValRequest struct {
+	Sequence  string
+	Count     int64
+	SessionId int64
+}
+
+// NextValResult is the first of the values allocated by NextVal.
+type NextValResult struct {
+	Value int64
+}
+
+// ReservedSession identifies a connection reserved by ReserveConnection.
+// It's released by ReleaseConnection.
+type ReservedSession struct {
+	SessionId  int64
+	ReservedId int64
+}
+
+// TwoPCRequest is the request of the two-phase commit RPCs.
+// TransactionId is only used by PrepareTransaction and StartCommit,
+// Participants by CreateTransaction.
+type TwoPCRequest struct {
+	Dtid          string
+	SessionId     int64
+	TransactionId int64
+	Participants  []TwoPCParticipant
+}
+
+// TwoPCParticipant is a shard taking part in a distributed
+// transaction.
+type TwoPCParticipant struct {
+	Keyspace string
+	Shard    string
+}
+
+// The states of a distributed transaction in the transaction record
+// kept by its first shard, the metadata manager. The commit decision
+// is DT_STATE_COMMIT or DT_STATE_ROLLBACK.
+const (
+	DT_STATE_PREPARE  = 1
+	DT_STATE_COMMIT   = 2
+	DT_STATE_ROLLBACK = 3
+)
+
+// DistributedTransaction is the transaction record of a distributed
+// transaction, with the participants other than the metadata
+// manager. TimeCreated is in nanoseconds.
+type DistributedTransaction struct {
+	Dtid         string
+	State        int64
+	TimeCreated  int64
+	Participants []TwoPCParticipant
+}
+
+// AbandonedRequest asks for the distributed transactions created
+// more than Age nanoseconds ago, and still not concluded.
+type AbandonedRequest struct {
+	SessionId int64
+	Age       int64
+}
+
+// AbandonedResult is the result of ReadAbandoned.
+type AbandonedResult struct {
+	Transactions []DistributedTransaction
+}
+
+// ReplicationPositionResult is the result of ReplicationPosition:
+// the position up to which the tablet's MySQL applied transactions.
+type ReplicationPositionResult struct {
+	Position myproto.GTIDField
+}
+
+// MessageStreamRequest subscribes to the messages
+// of the message table Name.
+type MessageStreamRequest struct {
+	Name      string
+	SessionId int64
+}
+
+// MessageAckRequest acks the messages Ids of the message table Name.
+type MessageAckRequest struct {
+	Name      string
+	Ids       []string
+	SessionId int64
+}
+
+// MessageAckResult is the number of messages acked by MessageAck.
+type MessageAckResult struct {
+	Count int64
+}
+
+// HealthStats is the result of a health check of the tablet,
+// streamed by StreamHealth.
+type HealthStats struct {
+	// Healthy is true if the tablet can take traffic.
+	// Otherwise, Error explains why not.
+	Healthy bool
+	Error   string
+	// Serving is true if the query service is serving.
+	Serving bool
+	// MysqlReachable is true if the last check could query MySQL.
+	MysqlReachable bool
+	// IsSlave is true if MySQL replicates from a master.
+	// ReplicationRunning and SecondsBehindMaster are only
+	// set for slaves.
+	IsSlave             bool
+	ReplicationRunning  bool
+	SecondsBehindMaster int64
+	// RowcacheHealthy is false if the rowcache is enabled but its
+	// invalidator is not running, or too far behind to be read.
+	RowcacheHealthy bool
+	// Time is when the check ran, in nanoseconds since the epoch.
+	Time int64
+}
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
@@ -516,6 +517,44 @@ func TestAction(t *testing.T) {
 	}
 }
 
+func TestThrottle(t *testing.T) {
+	qrs := NewQueryRules()
+	qr1 := NewQueryRule("rule 1", "r1", QR_THROTTLE)
+	qr1.SetMaxQPS(2)
+	qr1.AddTableCond("a")
+	qrs.Add(qr1)
+	now := time.Now()
+	qr1.throttler.now = func() time.Time { return now }
+
+	// Copies share the rate
+	qrs = qrs.filterByPlan("select * from a", planbuilder.PLAN_PASS_SELECT, "a")
+	qrs2 := qrs.Copy()
+	for i, want := range []Action{QR_CONTINUE, QR_CONTINUE, QR_THROTTLE} {
+		action, _ := qrs2.getAction("123", "user", nil)
+		if action != want {
+			t.Errorf("query %d: want %v, got %v", i, want, action)
+		}
+	}
+	action, desc := qrs.getAction("123", "user", nil)
+	if action != QR_THROTTLE {
+		t.Errorf("want THROTTLE, got %v", action)
+	}
+	if desc != "rule 1" {
+		t.Errorf("want rule 1, got %s", desc)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if action, _ := qrs.getAction("123", "user", nil); action != QR_CONTINUE {
+		t.Errorf("want CONTINUE, got %v", action)
+	}
+
+	// A throttle rule without rate lets nothing through
+	qrs = NewQueryRules()
+	qrs.Add(NewQueryRule("rule 2", "r2", QR_THROTTLE))
+	if action, _ := qrs.getAction("123", "user", nil); action != QR_THROTTLE {
+		t.Errorf("want THROTTLE, got %v", action)
+	}
+}
+
 var jsondata = `[{
 	"Description": "desc1",
 	"Name": "name1",
@@ -630,6 +669,47 @@ func TestImport(t *testing.T) {
 	}
 }
 
+func TestExport(t *testing.T) {
+	qrs := NewQueryRules()
+	if err := qrs.UnmarshalJSON([]byte(jsondata)); err != nil {
+		t.Fatalf("Unexpected: %v", err)
+	}
+	qr := NewQueryRule("desc3", "name3", QR_THROTTLE)
+	qr.SetMaxQPS(10)
+	qr.AddBindVarCond("a", false, true, QR_MATCH, "a.*")
+	qr.AddBindVarCond("b", false, true, QR_NOTIN, key.KeyRange{Start: "1", End: "2"})
+	qr.AddBindVarCond("c", false, true, QR_LT, int64(-1))
+	qr.AddBindVarCond("d", false, true, QR_GE, "d")
+	qrs.Add(qr)
+	exported, err := qrs.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Unexpected: %v", err)
+	}
+
+	qrs2 := NewQueryRules()
+	if err := qrs2.UnmarshalJSON(exported); err != nil {
+		t.Fatalf("Unexpected: %v for %s", err, exported)
+	}
+	reexported, err := qrs2.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Unexpected: %v", err)
+	}
+	if string(exported) != string(reexported) {
+		t.Errorf("want\n%s\ngot\n%s", exported, reexported)
+	}
+	if qrs2.rules[0].query.String() != "^query$" {
+		t.Errorf("want ^query$, got %s", qrs2.rules[0].query)
+	}
+	if qrs2.rules[2].act != QR_THROTTLE || qrs2.rules[2].maxQPS != 10 {
+		t.Errorf("want THROTTLE at 10 QPS, got %v at %d", qrs2.rules[2].act, qrs2.rules[2].maxQPS)
+	}
+
+	exported, err = NewQueryRules().MarshalJSON()
+	if err != nil || string(exported) != "[]" {
+		t.Errorf("want [], got %s, %v", exported, err)
+	}
+}
+
 type ValidJSONCase struct {
 	input string
 	op    Operator
@@ -772,6 +852,9 @@ var invalidjsons = []InvalidJSONCase{
 	{`[{"BindVarConds": [{"Name": "a", "OnAbsent": true, "OnMismatch": true, "Operator": "NOMATCH", "Value": "["}]}]`, "processing [: error parsing regexp: missing closing ]: `[$`"},
 	{`[{"Action": 1 }]`, "want string for Action"},
 	{`[{"Action": "foo" }]`, "invalid Action foo"},
+	{`[{"MaxQPS": "a" }]`, "want positive integer for MaxQPS"},
+	{`[{"MaxQPS": 1.5 }]`, "want positive integer for MaxQPS"},
+	{`[{"Name": "a", "Action": "THROTTLE" }]`, "MaxQPS missing for THROTTLE rule a"},
 }
 
 func TestInvalidJSON(t *testing.T) {
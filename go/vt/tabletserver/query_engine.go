@@ -6,10 +6,15 @@ package tabletserver
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/acl"
 	"github.com/youtube/vitess/go/hack"
+	"github.com/youtube/vitess/go/mysql"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
@@ -18,6 +23,7 @@ import (
 	"github.com/youtube/vitess/go/vt/dbconnpool"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/schema"
 	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tableacl"
@@ -27,6 +33,7 @@ import (
 
 const (
 	MAX_RESULT_NAME                = "_vtMaxResultSize"
+	LOCK_LIMIT_NAME                = "_vtLockLimit"
 	ROWCACHE_INVALIDATION_POSITION = "ROWCACHE_INVALIDATION_POSITION"
 
 	// SPOT_CHECK_MULTIPLIER determines the precision of the
@@ -41,7 +48,8 @@ const (
 //
 // WaitForTxEmpty: There should be no more new calls to Begin
 // once this function is called. This will return when there
-// are no more pending transactions.
+// are no more pending transactions, or when the ones left
+// after the grace period are killed.
 //
 // Close: There should be no more pending queries when this
 // function is called.
@@ -58,21 +66,70 @@ type QueryEngine struct {
 	connPool       *dbconnpool.ConnectionPool
 	streamConnPool *dbconnpool.ConnectionPool
 	txPool         *dbconnpool.ConnectionPool
+	batchConnPool  *dbconnpool.ConnectionPool
+	// reservedConnPool holds the connections that can be
+	// reserved for the session state of the clients.
+	reservedConnPool *dbconnpool.ConnectionPool
 
 	// Services
-	activeTxPool *ActiveTxPool
-	activePool   *ActivePool
-	consolidator *Consolidator
-	invalidator  *RowcacheInvalidator
-	streamQList  *QueryList
-	connKiller   *ConnectionKiller
+	activeTxPool  *ActiveTxPool
+	reservedPool  *ReservedPool
+	activePool    *ActivePool
+	consolidator  *Consolidator
+	fills         *FillConsolidator
+	invalidator   *RowcacheInvalidator
+	warmer        *RowcacheWarmer
+	streamQList   *QueryList
+	connKiller    *ConnectionKiller
+	txSerializer  *TxSerializer
+	prepared      *PreparedStatements
+	twoPC         *TwoPC
+	messager      *MessageEngine
+	callerQuotas  *CallerQuotas
+	loadThrottler *LoadThrottler
 
 	// Vars
 	spotCheckFreq    sync2.AtomicInt64
 	strictMode       sync2.AtomicInt64
 	maxResultSize    sync2.AtomicInt64
+	maxResultBytes   sync2.AtomicInt64
 	streamBufferSize sync2.AtomicInt64
+	streamBufferRows sync2.AtomicInt64
 	strictTableAcl   bool
+	twoPCEnabled     bool
+
+	// shutdownGracePeriod is how long the transactions and
+	// queries are waited for when the query service stops,
+	// before they're killed. 0 means forever.
+	shutdownGracePeriod sync2.AtomicDuration
+
+	// dmlChunkSize is the number of rows changed per transaction
+	// by the DMLs executed outside of a transaction. 0 disallows
+	// those DMLs. dmlChunkPause is the pause between the chunks.
+	dmlChunkSize  sync2.AtomicInt64
+	dmlChunkPause sync2.AtomicDuration
+
+	// maxLockRows is the maximum number of rows of the locking
+	// selects. 0 means only maxResultSize applies.
+	maxLockRows sync2.AtomicInt64
+
+	// maxDeadlockRetries and maxLockWaitRetries are the number of
+	// times the chunks of the autocommit DMLs are retried when they
+	// fail with a deadlock or a lock wait timeout. 0 disables them.
+	maxDeadlockRetries sync2.AtomicInt64
+	maxLockWaitRetries sync2.AtomicInt64
+
+	// batchMaxResultSize is the limit of the queries that run in
+	// batchConnPool. batchActivePool tracks them with the batch
+	// query timeout, which isn't capped by the one of activePool.
+	batchMaxResultSize sync2.AtomicInt64
+	batchActivePool    *ActivePool
+
+	// rowcacheMaxLag is the invalidator lag in seconds above which
+	// reads bypass the rowcache. 0 disables the check.
+	// rowcacheBypassed is 1 while reads are bypassing the rowcache.
+	rowcacheMaxLag   sync2.AtomicInt64
+	rowcacheBypassed sync2.AtomicInt64
 
 	// loggers
 	accessCheckerLogger *logutil.ThrottledLogger
@@ -83,6 +140,9 @@ type compiledPlan struct {
 	*ExecPlan
 	BindVars      map[string]interface{}
 	TransactionID int64
+	// MinGTID, if set, is the oldest fill position
+	// of the rowcache entries the query can use.
+	MinGTID myproto.GTID
 }
 
 // stats are globals to allow anybody to set them
@@ -91,11 +151,15 @@ var (
 	queryStats     *stats.Timings
 	waitStats      *stats.Timings
 	killStats      *stats.Counters
+	dmlChunkStats  *stats.Counters
+	lockRetryStats *stats.MultiCounters
 	infoErrors     *stats.Counters
 	errorStats     *stats.Counters
 	internalErrors *stats.Counters
 	resultStats    *stats.Histogram
 	spotCheckCount *stats.Int
+	bypassCount    *stats.Int
+	staleRowCount  *stats.Int
 	QPSRates       *stats.Rates
 )
 
@@ -121,28 +185,58 @@ func getOrPanic(pool *dbconnpool.ConnectionPool) dbconnpool.PoolConnection {
 	panic(NewTabletErrorSql(FATAL, err))
 }
 
+// isReadOnly returns true if MySQL is read-only,
+// which means the tablet is not a master.
+func isReadOnly(conn dbconnpool.PoolConnection) bool {
+	qr, err := conn.ExecuteFetch("select @@global.read_only", 1, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FATAL, err))
+	}
+	return len(qr.Rows) == 1 && qr.Rows[0][0].String() != "0"
+}
+
 // NewQueryEngine creates a new QueryEngine.
 // This is a singleton class.
 // You must call this only once.
 func NewQueryEngine(config Config) *QueryEngine {
 	qe := &QueryEngine{}
-	qe.schemaInfo = NewSchemaInfo(config.QueryCacheSize, time.Duration(config.SchemaReloadTime*1e9), time.Duration(config.IdleTimeout*1e9))
+	qe.schemaInfo = NewSchemaInfo(config.QueryCacheSize, time.Duration(config.SchemaReloadTime*1e9), time.Duration(config.IdleTimeout*1e9), config.RowcacheOptIn)
 
 	mysqlStats = stats.NewTimings("Mysql")
 
 	// Pools
 	qe.cachePool = NewCachePool("Rowcache", config.RowCache, time.Duration(config.QueryTimeout*1e9), time.Duration(config.IdleTimeout*1e9))
+	qe.cachePool.Checksum = config.RowcacheChecksum
 	qe.connPool = dbconnpool.NewConnectionPool("ConnPool", config.PoolSize, time.Duration(config.IdleTimeout*1e9))
 	qe.streamConnPool = dbconnpool.NewConnectionPool("StreamConnPool", config.StreamPoolSize, time.Duration(config.IdleTimeout*1e9))
 	qe.txPool = dbconnpool.NewConnectionPool("TransactionPool", config.TransactionCap, time.Duration(config.IdleTimeout*1e9)) // connections in pool has to be > transactionCap
+	qe.batchConnPool = dbconnpool.NewConnectionPool("BatchConnPool", config.BatchPoolSize, time.Duration(config.IdleTimeout*1e9))
+	qe.reservedConnPool = dbconnpool.NewConnectionPool("ReservedConnPool", config.ReservedPoolSize, time.Duration(config.IdleTimeout*1e9))
+	qe.connPool.SetMaxCapacity(config.MaxPoolSize)
+	qe.streamConnPool.SetMaxCapacity(config.MaxStreamPoolSize)
+	qe.txPool.SetMaxCapacity(config.MaxTransactionCap)
 
 	// Services
 	qe.activeTxPool = NewActiveTxPool("ActiveTransactionPool", time.Duration(config.TransactionTimeout*1e9))
+	qe.reservedPool = NewReservedPool("ReservedPool", time.Duration(config.ReservedIdleTimeout*1e9))
 	qe.connKiller = NewConnectionKiller(1, time.Duration(config.IdleTimeout*1e9))
 	qe.activePool = NewActivePool("ActivePool", time.Duration(config.QueryTimeout*1e9), qe.connKiller)
-	qe.consolidator = NewConsolidator()
-	qe.invalidator = NewRowcacheInvalidator(qe)
+	batchQueryTimeout := config.BatchQueryTimeout
+	if batchQueryTimeout == 0 {
+		batchQueryTimeout = config.QueryTimeout
+	}
+	qe.batchActivePool = NewActivePool("BatchActivePool", time.Duration(batchQueryTimeout*1e9), qe.connKiller)
+	qe.consolidator = NewConsolidator("Consolidator")
+	qe.fills = NewFillConsolidator()
+	qe.invalidator = NewRowcacheInvalidator(qe, config)
+	qe.warmer = NewRowcacheWarmer(qe)
 	qe.streamQList = NewQueryList(qe.connKiller)
+	qe.txSerializer = NewTxSerializer("TxSerializer", config.HotRowQueueSize)
+	qe.prepared = NewPreparedStatements("PreparedStatements", config.MaxPreparedStatements)
+	qe.twoPC = NewTwoPC("PreparedTransactions")
+	qe.messager = NewMessageEngine("Messages", qe)
+	qe.callerQuotas = NewCallerQuotas("CallerQuota", config.CallerMaxConcurrency, config.CallerMaxQPS)
+	qe.loadThrottler = NewLoadThrottler("LoadThrottler", qe, config)
 
 	// Vars
 	qe.spotCheckFreq = sync2.AtomicInt64(config.SpotCheckRatio * SPOT_CHECK_MULTIPLIER)
@@ -150,28 +244,70 @@ func NewQueryEngine(config Config) *QueryEngine {
 		qe.strictMode.Set(1)
 	}
 	qe.strictTableAcl = config.StrictTableAcl
+	qe.twoPCEnabled = config.TwoPCEnable
+	qe.activeTxPool.recordRedo = config.TwoPCEnable
 	qe.maxResultSize = sync2.AtomicInt64(config.MaxResultSize)
+	qe.maxResultBytes = sync2.AtomicInt64(config.MaxResultBytes)
 	qe.streamBufferSize = sync2.AtomicInt64(config.StreamBufferSize)
+	qe.streamBufferRows = sync2.AtomicInt64(config.StreamBufferRows)
+	qe.batchMaxResultSize = sync2.AtomicInt64(config.BatchMaxResultSize)
+	qe.rowcacheMaxLag = sync2.AtomicInt64(config.RowcacheMaxLag)
+	qe.shutdownGracePeriod = sync2.AtomicDuration(config.ShutdownGracePeriod * 1e9)
+	qe.dmlChunkSize = sync2.AtomicInt64(config.DMLChunkSize)
+	qe.dmlChunkPause = sync2.AtomicDuration(config.DMLChunkPause * 1e9)
+	qe.maxLockRows = sync2.AtomicInt64(config.MaxLockRows)
+	qe.maxDeadlockRetries = sync2.AtomicInt64(config.MaxDeadlockRetries)
+	qe.maxLockWaitRetries = sync2.AtomicInt64(config.MaxLockWaitRetries)
 
 	// loggers
 	qe.accessCheckerLogger = logutil.NewThrottledLogger("accessChecker", 1*time.Second)
 
 	// Stats
 	stats.Publish("MaxResultSize", stats.IntFunc(qe.maxResultSize.Get))
+	stats.Publish("MaxResultBytes", stats.IntFunc(qe.maxResultBytes.Get))
 	stats.Publish("StreamBufferSize", stats.IntFunc(qe.streamBufferSize.Get))
+	stats.Publish("StreamBufferRows", stats.IntFunc(qe.streamBufferRows.Get))
+	stats.Publish("BatchMaxResultSize", stats.IntFunc(qe.batchMaxResultSize.Get))
+	stats.Publish("BatchQueryTimeout", stats.DurationFunc(qe.batchActivePool.Timeout))
+	stats.Publish("RowcacheMaxLagSeconds", stats.IntFunc(qe.rowcacheMaxLag.Get))
+	stats.Publish("RowcacheBypassed", stats.IntFunc(qe.rowcacheBypassed.Get))
+	stats.Publish("ShutdownGracePeriod", stats.DurationFunc(qe.shutdownGracePeriod.Get))
+	stats.Publish("DMLChunkSize", stats.IntFunc(qe.dmlChunkSize.Get))
+	stats.Publish("DMLChunkPause", stats.DurationFunc(qe.dmlChunkPause.Get))
+	stats.Publish("MaxLockRows", stats.IntFunc(qe.maxLockRows.Get))
+	stats.Publish("MaxDeadlockRetries", stats.IntFunc(qe.maxDeadlockRetries.Get))
+	stats.Publish("MaxLockWaitRetries", stats.IntFunc(qe.maxLockWaitRetries.Get))
 	queryStats = stats.NewTimings("Queries")
 	QPSRates = stats.NewRates("QPS", queryStats, 15, 60*time.Second)
 	waitStats = stats.NewTimings("Waits")
 	killStats = stats.NewCounters("Kills")
+	dmlChunkStats = stats.NewCounters("DMLChunks")
+	lockRetryStats = stats.NewMultiCounters("LockRetries", []string{"Table", "Error"})
 	infoErrors = stats.NewCounters("InfoErrors")
 	errorStats = stats.NewCounters("Errors")
 	internalErrors = stats.NewCounters("InternalErrors")
 	resultStats = stats.NewHistogram("Results", resultBuckets)
+	callerQueries = stats.NewMultiTimings("CallerQueries", []string{"Caller", "Method"})
+	callerErrors = stats.NewMultiCounters("CallerErrors", []string{"Caller", "Method"})
+	_ = stats.NewMultiCountersFunc("QueryLatencyPercentilesNs", []string{"Plan", "Percentile"}, func() map[string]int64 {
+		return timingsPercentiles(queryStats)
+	})
+	tableQueries = stats.NewMultiTimings("TableQueries", []string{"Table", "Plan"})
+	_ = stats.NewMultiCountersFunc("TableQueryLatencyPercentilesNs", []string{"Table", "Plan", "Percentile"}, func() map[string]int64 {
+		return timingsPercentiles(&tableQueries.Timings)
+	})
+	tableErrors = stats.NewCounters("TableErrors")
+	TableErrorRates = stats.NewRates("TableErrorRates", tableErrors, 15, 60*time.Second)
 	stats.Publish("RowcacheSpotCheckRatio", stats.FloatFunc(func() float64 {
 		return float64(qe.spotCheckFreq.Get()) / SPOT_CHECK_MULTIPLIER
 	}))
 	spotCheckCount = stats.NewInt("RowcacheSpotCheckCount")
+	bypassCount = stats.NewInt("RowcacheBypassCount")
+	staleRowCount = stats.NewInt("RowcacheStaleRows")
 
+	http.HandleFunc(rowcacheStatusURL, qe.serveRowcacheStatus)
+	http.HandleFunc("/debug/tableacl/reload", qe.serveTableAclReload)
+	http.HandleFunc("/debug/pools", qe.servePools)
 	return qe
 }
 
@@ -196,6 +332,14 @@ func (qe *QueryEngine) Open(dbconfig *dbconfigs.DBConfig, schemaOverrides []Sche
 		log.Infof("rowcache is not enabled")
 	}
 
+	// the _vt tables are migrated by the master, and
+	// replicated to the slaves
+	if mysqld != nil {
+		if err := mysqld.InitSidecarDB(); err != nil {
+			panic(NewTabletError(FATAL, "cannot migrate the _vt database: %v", err))
+		}
+	}
+
 	start := time.Now()
 	// schemaInfo depends on cachePool. Every table that has a rowcache
 	// points to the cachePool.
@@ -212,16 +356,81 @@ func (qe *QueryEngine) Open(dbconfig *dbconfigs.DBConfig, schemaOverrides []Sche
 	qe.connPool.Open(connFactory)
 	qe.streamConnPool.Open(connFactory)
 	qe.txPool.Open(connFactory)
+	qe.batchConnPool.Open(connFactory)
+	qe.reservedConnPool.Open(connFactory)
 	qe.activeTxPool.Open()
+	qe.reservedPool.Open()
 	qe.connKiller.Open(connFactory)
 	qe.activePool.Open()
+	qe.batchActivePool.Open()
+
+	// The resolver needs the pools to resurrect
+	// the prepared transactions.
+	if qe.twoPCEnabled {
+		qe.twoPC.open()
+		qe.openTwoPC()
+	}
+	qe.messager.Open()
+	qe.loadThrottler.Open()
+
+	// The warmer fills the rowcache in the background
+	// using connPool, which is now open.
+	if dbconfig.EnableRowcache {
+		qe.warmer.Open(schemaOverrides)
+	}
 }
 
 // WaitForTxEmpty must be called before calling Close.
 // Before calling WaitForTxEmpty, you must ensure that there
-// will be no more calls to Begin.
-func (qe *QueryEngine) WaitForTxEmpty() {
-	qe.activeTxPool.WaitForEmpty()
+// will be no more calls to Begin. The prepared transactions
+// don't wait: they are rolled back, and resurrected from the
+// redo log when the QueryEngine is opened again.
+// If gracePeriod is non-zero, the transactions still open after
+// it are killed: their running queries are killed, and they are
+// rolled back. WaitForTxEmpty returns the number of transactions
+// and queries it killed.
+func (qe *QueryEngine) WaitForTxEmpty(gracePeriod time.Duration) (txKilled, queriesKilled int) {
+	qe.twoPC.close()
+	done := make(chan struct{})
+	go func() {
+		qe.activeTxPool.WaitForEmpty()
+		close(done)
+	}()
+	waitOrKill(done, gracePeriod, func() {
+		queriesKilled += qe.activePool.KillAll()
+		queriesKilled += qe.batchActivePool.KillAll()
+		txKilled += qe.activeTxPool.KillAll()
+	})
+	return txKilled, queriesKilled
+}
+
+// drainKillInterval is how often waitOrKill kills what's left
+// once the grace period is over.
+const drainKillInterval = 100 * time.Millisecond
+
+// waitOrKill waits until done is closed. If gracePeriod is non-zero
+// and done is still open after it, kill is called repeatedly until
+// done is closed.
+func waitOrKill(done chan struct{}, gracePeriod time.Duration, kill func()) {
+	var expired <-chan time.Time
+	if gracePeriod > 0 {
+		t := time.NewTimer(gracePeriod)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-done:
+		return
+	case <-expired:
+	}
+	for {
+		kill()
+		select {
+		case <-done:
+			return
+		case <-time.After(drainKillInterval):
+		}
+	}
 }
 
 // Close must be called to shut down QueryEngine.
@@ -229,20 +438,30 @@ func (qe *QueryEngine) WaitForTxEmpty() {
 // before calling Close.
 func (qe *QueryEngine) Close() {
 	// Close in reverse order of Open.
+	qe.warmer.Close()
+	qe.loadThrottler.Close()
+	qe.messager.Close()
+	qe.batchActivePool.Close()
 	qe.activePool.Close()
 	qe.connKiller.Close()
+	qe.twoPC.close()
+	qe.reservedPool.Close()
 	qe.activeTxPool.Close()
+	qe.reservedConnPool.Close()
+	qe.batchConnPool.Close()
 	qe.txPool.Close()
 	qe.streamConnPool.Close()
 	qe.connPool.Close()
 	qe.invalidator.Close()
 	qe.schemaInfo.Close()
 	qe.cachePool.Close()
+	qe.prepared.clear()
 	qe.dbconfig = nil
 }
 
-// Begin begins a transaction.
-func (qe *QueryEngine) Begin(logStats *SQLQueryStats) int64 {
+// Begin begins a transaction. If timeout is non-zero, it overrides
+// the transaction timeout for that transaction.
+func (qe *QueryEngine) Begin(logStats *SQLQueryStats, timeout time.Duration) int64 {
 	defer queryStats.Record("BEGIN", time.Now())
 
 	conn, err := qe.txPool.TryGet()
@@ -255,7 +474,7 @@ func (qe *QueryEngine) Begin(logStats *SQLQueryStats) int64 {
 	if conn == nil {
 		panic(NewTabletError(TX_POOL_FULL, "Transaction pool connection limit exceeded"))
 	}
-	transactionID, err := qe.activeTxPool.SafeBegin(conn)
+	transactionID, err := qe.activeTxPool.SafeBegin(conn, logStats.context, timeout)
 	if err != nil {
 		conn.Recycle()
 		panic(err)
@@ -263,6 +482,32 @@ func (qe *QueryEngine) Begin(logStats *SQLQueryStats) int64 {
 	return transactionID
 }
 
+// ReserveConnection reserves a connection for the session state of
+// the client, and returns its id. The queries executed with that id
+// run on the connection, until it's released or reclaimed when idle.
+func (qe *QueryEngine) ReserveConnection(logStats *SQLQueryStats, sessionID int64) int64 {
+	defer queryStats.Record("RESERVE", time.Now())
+
+	conn, err := qe.reservedConnPool.TryGet()
+	if err == dbconnpool.CONN_POOL_CLOSED_ERR {
+		panic(connPoolClosedErr)
+	}
+	if err != nil {
+		panic(NewTabletErrorSql(FATAL, err))
+	}
+	if conn == nil {
+		panic(NewTabletError(RETRY, "Reserved pool connection limit exceeded"))
+	}
+	return qe.reservedPool.Reserve(conn, sessionID, logStats.context)
+}
+
+// ReleaseConnection releases the reserved connection reservedID.
+// The connection is closed, so its session state is not reused.
+func (qe *QueryEngine) ReleaseConnection(logStats *SQLQueryStats, sessionID, reservedID int64) {
+	defer queryStats.Record("RELEASE", time.Now())
+	qe.reservedPool.Release(reservedID, sessionID, logStats.context)
+}
+
 // Commit commits the specified transaction.
 func (qe *QueryEngine) Commit(logStats *SQLQueryStats, transactionID int64) {
 	defer queryStats.Record("COMMIT", time.Now())
@@ -303,13 +548,120 @@ func (qe *QueryEngine) Execute(logStats *SQLQueryStats, query *proto.Query) (rep
 	logStats.BindVariables = query.BindVariables
 	// cheap hack: strip trailing comment into a special bind var
 	stripTrailing(query)
-	basePlan := qe.schemaInfo.GetPlan(logStats, query.Sql)
+	return qe.execWithReload(logStats, query, func() *ExecPlan {
+		if query.ReservedId != 0 {
+			return qe.schemaInfo.GetReservedPlan(logStats, query.Sql)
+		}
+		return qe.schemaInfo.GetPlan(logStats, query.Sql)
+	})
+}
+
+// Prepare builds the plan of sql, and registers it as a prepared
+// statement of the caller in session sessionID. It returns the id
+// of the statement.
+func (qe *QueryEngine) Prepare(logStats *SQLQueryStats, sessionID int64, sql string) int64 {
+	query := &proto.Query{Sql: sql, BindVariables: make(map[string]interface{})}
+	stripTrailing(query)
+	logStats.OriginalSql = query.Sql
+	logStats.PlanType = "PREPARE"
+	stmt := &preparedStatement{sql: query.Sql, sessionID: sessionID, caller: logStats.context}
+	stmt.comment, _ = query.BindVariables[TRAILING_COMMENT].(string)
+	// Get the generation first: if the plan becomes stale
+	// before we're done, it'll be rebuilt.
+	stmt.generation = qe.schemaInfo.planGeneration.Get()
+	stmt.plan = qe.schemaInfo.GetPlan(logStats, stmt.sql)
+	return qe.prepared.add(stmt)
+}
+
+// ExplainQuery returns the plan of sql, without executing it.
+// Like for the execution, the trailing comments are ignored.
+func (qe *QueryEngine) ExplainQuery(logStats *SQLQueryStats, sql string) proto.QueryExplanation {
+	query := &proto.Query{Sql: sql, BindVariables: make(map[string]interface{})}
+	stripTrailing(query)
+	logStats.OriginalSql = query.Sql
+	logStats.PlanType = "EXPLAIN"
+	return qe.schemaInfo.ExplainQuery(query.Sql)
+}
+
+// ExecutePrepared executes a prepared statement. Only the
+// caller that prepared it, in the same session, can execute it.
+func (qe *QueryEngine) ExecutePrepared(logStats *SQLQueryStats, preparedQuery *proto.PreparedQuery) (reply *mproto.QueryResult) {
+	stmt := qe.prepared.get(preparedQuery.StatementId, preparedQuery.SessionId, logStats.context)
+	query := &proto.Query{
+		Sql:           stmt.sql,
+		BindVariables: preparedQuery.BindVariables,
+		SessionId:     preparedQuery.SessionId,
+		TransactionId: preparedQuery.TransactionId,
+		Timeout:       preparedQuery.Timeout,
+	}
+	if query.BindVariables == nil {
+		query.BindVariables = make(map[string]interface{})
+	}
+	if stmt.comment != "" {
+		query.BindVariables[TRAILING_COMMENT] = stmt.comment
+	}
+	logStats.BindVariables = query.BindVariables
+	return qe.execWithReload(logStats, query, func() *ExecPlan {
+		return qe.preparedPlan(logStats, stmt)
+	})
+}
+
+// ClosePrepared drops a prepared statement. Like for
+// ExecutePrepared, the caller must be the one that prepared it.
+func (qe *QueryEngine) ClosePrepared(logStats *SQLQueryStats, sessionID, statementId int64) {
+	qe.prepared.remove(statementId, sessionID, logStats.context)
+}
+
+// preparedPlan returns the plan of stmt, after rebuilding
+// it if it became stale.
+func (qe *QueryEngine) preparedPlan(logStats *SQLQueryStats, stmt *preparedStatement) *ExecPlan {
+	stmt.mu.Lock()
+	defer stmt.mu.Unlock()
+	if generation := qe.schemaInfo.planGeneration.Get(); generation != stmt.generation {
+		stmt.plan = qe.schemaInfo.GetPlan(logStats, stmt.sql)
+		stmt.generation = generation
+	}
+	return stmt.plan
+}
+
+// execWithReload executes query with the plan returned by getPlan.
+// If MySQL fails it because the table of the plan changed, like
+// after an ALTER that was not seen yet, the table is reloaded and
+// the query executed once more, with a new plan.
+func (qe *QueryEngine) execWithReload(logStats *SQLQueryStats, query *proto.Query, getPlan func() *ExecPlan) *mproto.QueryResult {
+	if reply, ok := qe.tryExecPlan(logStats, query, getPlan()); ok {
+		return reply
+	}
+	return qe.execPlan(logStats, query, getPlan())
+}
+
+// tryExecPlan executes query with basePlan. It returns false instead
+// of failing if the error is a schema error, and the table of the
+// plan was reloaded.
+func (qe *QueryEngine) tryExecPlan(logStats *SQLQueryStats, query *proto.Query, basePlan *ExecPlan) (reply *mproto.QueryResult, ok bool) {
+	defer func() {
+		if x := recover(); x != nil {
+			terr, isTabletError := x.(*TabletError)
+			if !isTabletError || !isSchemaError(terr) || basePlan.TableName == "" || !qe.schemaInfo.ReloadTable(basePlan.TableName) {
+				panic(x)
+			}
+			log.Infof("Retrying query after reloading %s: %v", basePlan.TableName, terr)
+		}
+	}()
+	return qe.execPlan(logStats, query, basePlan), true
+}
+
+// execPlan executes query, with basePlan as its plan.
+// Trailing comments must have already been stripped.
+func (qe *QueryEngine) execPlan(logStats *SQLQueryStats, query *proto.Query, basePlan *ExecPlan) (reply *mproto.QueryResult) {
 	planName := basePlan.PlanId.String()
 	logStats.PlanType = planName
 	logStats.OriginalSql = query.Sql
+	logStats.fingerprint = basePlan.Fingerprint
 	defer func(start time.Time) {
 		duration := time.Now().Sub(start)
 		queryStats.Add(planName, duration)
+		recordTableStats(basePlan.TableName, planName, duration, reply == nil)
 		if reply == nil {
 			basePlan.AddStats(1, duration, 0, 1)
 		} else {
@@ -324,11 +676,16 @@ func (qe *QueryEngine) Execute(logStats *SQLQueryStats, query *proto.Query) (rep
 		panic(NewTabletError(FAIL, "Query disallowed due to rule: %s", desc))
 	case QR_FAIL_RETRY:
 		panic(NewTabletError(RETRY, "Query disallowed due to rule: %s", desc))
+	case QR_THROTTLE:
+		panic(NewTabletError(FAIL, "Query throttled due to rule: %s", desc))
 	}
 
 	qe.checkTableAcl(basePlan.TableName, basePlan.PlanId, basePlan.Authorized, logStats.context.GetUsername())
 
 	if basePlan.PlanId == planbuilder.PLAN_DDL {
+		if query.ReservedId != 0 {
+			return qe.execReservedDDL(logStats, query)
+		}
 		return qe.execDDL(logStats, query.Sql)
 	}
 
@@ -337,8 +694,21 @@ func (qe *QueryEngine) Execute(logStats *SQLQueryStats, query *proto.Query) (rep
 		ExecPlan:      basePlan,
 		BindVars:      query.BindVariables,
 		TransactionID: query.TransactionId,
-	}
-	if query.TransactionId != 0 {
+		MinGTID:       query.MinGTIDField.Value,
+	}
+	logStats.table = plan.TableInfo
+	olap := applyDirectives(logStats, plan.Directives, plan.BindVars)
+	if query.TransactionId == 0 {
+		qe.loadThrottler.Throttle(logStats)
+	}
+	if query.ReservedId != 0 {
+		reply = qe.execReserved(logStats, query, plan)
+	} else if query.TransactionId != 0 {
+		// Wait for the rows held by the other transactions
+		// before taking the connection of the transaction.
+		if plan.PlanId == planbuilder.PLAN_DML_PK || plan.PlanId == planbuilder.PLAN_UPSERT_PK {
+			qe.serializeDMLPK(query.TransactionId, plan)
+		}
 		// Need upfront connection for DMLs and transactions
 		conn := qe.activeTxPool.Get(query.TransactionId)
 		defer conn.Recycle()
@@ -359,11 +729,22 @@ func (qe *QueryEngine) Execute(logStats *SQLQueryStats, query *proto.Query) (rep
 			reply = qe.execInsertSubquery(logStats, conn, plan, invalidator)
 		case planbuilder.PLAN_DML_PK:
 			reply = qe.execDMLPK(logStats, conn, plan, invalidator)
+		case planbuilder.PLAN_UPSERT_PK:
+			reply = qe.execUpsertPK(logStats, conn, plan, invalidator)
 		case planbuilder.PLAN_DML_SUBQUERY:
 			reply = qe.execDMLSubquery(logStats, conn, plan, invalidator)
+		case planbuilder.PLAN_NEXTVAL:
+			// Sequences are not part of the transaction.
+			reply = qe.execNextVal(logStats, plan)
+		case planbuilder.PLAN_SAVEPOINT, planbuilder.PLAN_ROLLBACK_SAVEPOINT, planbuilder.PLAN_RELEASE_SAVEPOINT:
+			reply = qe.execSavepoint(logStats, conn, plan)
+		case planbuilder.PLAN_SELECT_LOCK:
+			reply = qe.execSelectLock(logStats, conn, plan)
 		default: // select or set in a transaction, just count as select
 			reply = qe.execDirect(logStats, plan, conn)
 		}
+	} else if plan.PlanId.IsSelect() && (query.Batch || olap || hasBatchDirective(query.BindVariables)) {
+		reply = qe.execBatch(logStats, plan)
 	} else {
 		switch plan.PlanId {
 		case planbuilder.PLAN_PASS_SELECT:
@@ -371,24 +752,36 @@ func (qe *QueryEngine) Execute(logStats *SQLQueryStats, query *proto.Query) (rep
 				panic(NewTabletError(FAIL, "Disallowed outside transaction"))
 			}
 			reply = qe.execSelect(logStats, plan)
+		case planbuilder.PLAN_SELECT_LOCK:
+			panic(NewTabletError(FAIL, "Disallowed outside transaction"))
 		case planbuilder.PLAN_PK_EQUAL:
 			reply = qe.execPKEqual(logStats, plan)
 		case planbuilder.PLAN_PK_IN:
 			reply = qe.execPKIN(logStats, plan)
 		case planbuilder.PLAN_SELECT_SUBQUERY:
 			reply = qe.execSubquery(logStats, plan)
+		case planbuilder.PLAN_NEXTVAL:
+			reply = qe.execNextVal(logStats, plan)
 		case planbuilder.PLAN_SET:
 			waitingForConnectionStart := time.Now()
 			conn := getOrPanic(qe.connPool)
 			logStats.WaitingForConnection += time.Now().Sub(waitingForConnectionStart)
 			defer conn.Recycle()
 			reply = qe.execSet(logStats, conn, plan)
+		case planbuilder.PLAN_SAVEPOINT, planbuilder.PLAN_ROLLBACK_SAVEPOINT, planbuilder.PLAN_RELEASE_SAVEPOINT:
+			panic(NewTabletError(NOT_IN_TX, "Savepoints not allowed outside of transactions"))
+		case planbuilder.PLAN_DML_SUBQUERY:
+			if qe.dmlChunkSize.Get() == 0 || plan.ChunkQuery == nil {
+				panic(NewTabletError(NOT_IN_TX, "DMLs not allowed outside of transactions"))
+			}
+			reply = qe.execDMLChunks(logStats, plan)
 		default:
 			panic(NewTabletError(NOT_IN_TX, "DMLs not allowed outside of transactions"))
 		}
 	}
+	logStats.RowsAffected = int(reply.RowsAffected)
 	if plan.PlanId.IsSelect() {
-		logStats.RowsAffected = int(reply.RowsAffected)
+		qe.checkResultSize(logStats, reply)
 		resultStats.Add(int64(reply.RowsAffected))
 		logStats.Rows = reply.Rows
 	}
@@ -407,6 +800,9 @@ func (qe *QueryEngine) StreamExecute(logStats *SQLQueryStats, query *proto.Query
 	// cheap hack: strip trailing comment into a special bind var
 	stripTrailing(query)
 
+	if query.ReservedId != 0 {
+		panic(NewTabletError(FAIL, "Streaming queries not allowed on reserved connections"))
+	}
 	plan := qe.schemaInfo.GetStreamPlan(query.Sql)
 	logStats.PlanType = "SELECT_STREAM"
 	logStats.OriginalSql = query.Sql
@@ -414,6 +810,9 @@ func (qe *QueryEngine) StreamExecute(logStats *SQLQueryStats, query *proto.Query
 
 	authorized := tableacl.Authorized(plan.TableName, plan.PlanId.MinRole())
 	qe.checkTableAcl(plan.TableName, plan.PlanId, authorized, logStats.context.GetUsername())
+	// Streaming queries already run in their own pool.
+	applyDirectives(logStats, plan.Directives, query.BindVariables)
+	qe.loadThrottler.Throttle(logStats)
 
 	// does the real work: first get a connection
 	waitingForConnectionStart := time.Now()
@@ -425,21 +824,121 @@ func (qe *QueryEngine) StreamExecute(logStats *SQLQueryStats, query *proto.Query
 	qe.streamQList.Add(qd)
 	defer qe.streamQList.Remove(qd)
 
+	// If the client goes away, the rest of the result would still
+	// have to be read from MySQL to discard it. Kill the query
+	// instead, and don't reuse its connection.
+	clientGone := false
+	defer func() {
+		if clientGone {
+			conn.Close()
+		}
+	}()
+
 	// then let's stream! Wrap callback function to return an
 	// error on query termination to stop further streaming
-	qe.fullStreamFetch(logStats, conn, plan.FullQuery, query.BindVariables, nil, nil, sendReply)
+	qe.fullStreamFetch(logStats, conn, plan.FullQuery, query.BindVariables, nil, nil, func(reply *mproto.QueryResult) error {
+		err := sendReply(reply)
+		if err != nil && !clientGone {
+			clientGone = true
+			infoErrors.Add("StreamClientGone", 1)
+			qe.streamQList.Terminate(qd.connID)
+		}
+		return err
+	})
 }
 
 func (qe *QueryEngine) checkTableAcl(table string, planId planbuilder.PlanType, authorized tableacl.ACL, user string) {
 	if !authorized.IsMember(user) {
 		err := fmt.Sprintf("table acl error: %v cannot run %v on table %v", user, planId, table)
 		if qe.strictTableAcl {
-			panic(NewTabletError(FAIL, err))
+			panic(NewTabletError(PERMISSION_DENIED, err))
 		}
 		qe.accessCheckerLogger.Errorf(err)
 	}
 }
 
+// ReloadTableAcl reloads the table ACLs from their config file.
+// Cached plans are cleared because they hold the ACLs that were
+// in effect when they were built.
+func (qe *QueryEngine) ReloadTableAcl() error {
+	if err := tableacl.Reload(); err != nil {
+		return NewTabletError(FAIL, "%v", err)
+	}
+	qe.schemaInfo.ClearQueryPlans()
+	return nil
+}
+
+// serveTableAclReload reloads the table ACLs without restarting.
+func (qe *QueryEngine) serveTableAclReload(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	if err := qe.ReloadTableAcl(); err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response.Write([]byte("Table ACLs reloaded\n"))
+}
+
+// servePools changes the capacity and the idle timeout of a
+// connection pool at runtime, like the vt_pool_size and
+// vt_idle_timeout variables:
+//
+//	/debug/pools?pool=conn&capacity=32&idle_timeout=1m
+//
+// The pool is conn, stream, transaction or batch. Shrinking
+// a pool waits for the connections in use to be returned. The
+// changes have to be POSTed, a GET only returns the stats of the
+// pool.
+func (qe *QueryEngine) servePools(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	if request.Method != "POST" && (request.FormValue("capacity") != "" || request.FormValue("idle_timeout") != "") {
+		response.Header().Set("Allow", "POST")
+		http.Error(response, "pools can only be changed by a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var pool *dbconnpool.ConnectionPool
+	switch request.FormValue("pool") {
+	case "conn":
+		pool = qe.connPool
+	case "stream":
+		pool = qe.streamConnPool
+	case "transaction":
+		pool = qe.txPool
+	case "batch":
+		pool = qe.batchConnPool
+	case "reserved":
+		pool = qe.reservedConnPool
+	default:
+		http.Error(response, "pool must be conn, stream, transaction, batch or reserved", http.StatusBadRequest)
+		return
+	}
+	if v := request.FormValue("capacity"); v != "" {
+		capacity, err := strconv.Atoi(v)
+		if err == nil {
+			err = pool.SetCapacity(capacity)
+		}
+		if err != nil {
+			http.Error(response, fmt.Sprintf("invalid capacity %s: %v", v, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := request.FormValue("idle_timeout"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			http.Error(response, fmt.Sprintf("invalid idle_timeout %s", v), http.StatusBadRequest)
+			return
+		}
+		pool.SetIdleTimeout(timeout)
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Write([]byte(pool.StatsJSON()))
+}
+
 // InvalidateForDml performs rowcache invalidations for the dml.
 func (qe *QueryEngine) InvalidateForDml(table string, keys []string) {
 	if qe.cachePool.IsClosed() {
@@ -463,12 +962,33 @@ func (qe *QueryEngine) InvalidateForDml(table string, keys []string) {
 	tableInfo.invalidations.Add(invalidations)
 }
 
+// FlushTableCache invalidates all the cached rows of a table.
+func (qe *QueryEngine) FlushTableCache(table string) {
+	if qe.cachePool.IsClosed() {
+		return
+	}
+	tableInfo := qe.schemaInfo.GetTable(table)
+	if tableInfo == nil {
+		panic(NewTabletError(FAIL, "Table %s not found", table))
+	}
+	if tableInfo.CacheType == schema.CACHE_NONE {
+		return
+	}
+	tableInfo.Cache.Flush()
+}
+
 // InvalidateForDDL performs schema and rowcache changes for the ddl.
 func (qe *QueryEngine) InvalidateForDDL(ddl string) {
 	ddlPlan := planbuilder.DDLParse(ddl)
 	if ddlPlan.Action == "" {
 		panic(NewTabletError(FAIL, "DDL is not understood"))
 	}
+	if ddlPlan.Temporary {
+		panic(NewTabletError(FAIL, "Temporary tables are only allowed on reserved connections"))
+	}
+	if !ddlPlan.SchemaChanged() {
+		return
+	}
 	qe.schemaInfo.DropTable(ddlPlan.TableName)
 	if ddlPlan.Action != sqlparser.AST_DROP { // CREATE, ALTER, RENAME
 		qe.schemaInfo.CreateTable(ddlPlan.NewName)
@@ -531,10 +1051,13 @@ func (qe *QueryEngine) execDDL(logStats *SQLQueryStats, ddl string) *mproto.Quer
 	if ddlPlan.Action == "" {
 		panic(NewTabletError(FAIL, "DDL is not understood"))
 	}
+	if ddlPlan.Temporary {
+		panic(NewTabletError(FAIL, "Temporary tables are only allowed on reserved connections"))
+	}
 
 	// Stolen from Begin
 	conn := getOrPanic(qe.txPool)
-	txid, err := qe.activeTxPool.SafeBegin(conn)
+	txid, err := qe.activeTxPool.SafeBegin(conn, logStats.context, 0)
 	if err != nil {
 		conn.Recycle()
 		panic(err)
@@ -550,6 +1073,9 @@ func (qe *QueryEngine) execDDL(logStats *SQLQueryStats, ddl string) *mproto.Quer
 		panic(NewTabletErrorSql(FAIL, err))
 	}
 
+	if !ddlPlan.SchemaChanged() {
+		return result
+	}
 	qe.schemaInfo.DropTable(ddlPlan.TableName)
 	if ddlPlan.Action != sqlparser.AST_DROP { // CREATE, ALTER, RENAME
 		qe.schemaInfo.CreateTable(ddlPlan.NewName)
@@ -557,6 +1083,25 @@ func (qe *QueryEngine) execDDL(logStats *SQLQueryStats, ddl string) *mproto.Quer
 	return result
 }
 
+// execReservedDDL runs a DDL on the reserved connection of query.
+// Only the temporary tables of the connection can be created or
+// dropped, they're not part of the schema.
+func (qe *QueryEngine) execReservedDDL(logStats *SQLQueryStats, query *proto.Query) *mproto.QueryResult {
+	if !planbuilder.DDLParse(query.Sql).Temporary {
+		panic(NewTabletError(FAIL, "DDLs not allowed on reserved connections, except for temporary tables"))
+	}
+	if query.TransactionId != 0 {
+		panic(NewTabletError(FAIL, "Transactions not allowed on reserved connections"))
+	}
+	conn := qe.reservedPool.Get(query.ReservedId, query.SessionId, logStats.context)
+	defer conn.Recycle()
+	result, err := qe.executeSql(logStats, conn, query.Sql, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	return result
+}
+
 //-----------------------------------------------
 // Execution
 
@@ -581,13 +1126,24 @@ func (qe *QueryEngine) execPKEqual(logStats *SQLQueryStats, plan *compiledPlan)
 }
 
 func (qe *QueryEngine) fetchOne(logStats *SQLQueryStats, plan *compiledPlan, pk []sqltypes.Value) (row []sqltypes.Value) {
+	if logStats.skipRowcache || qe.mustBypassRowcache() {
+		bypassCount.Add(1)
+		resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, pk)
+		if len(resultFromdb.Rows) == 0 {
+			return nil
+		}
+		return resultFromdb.Rows[0]
+	}
 	logStats.QuerySources |= QUERY_SOURCE_ROWCACHE
 	tableInfo := plan.TableInfo
 	keys := make([]string, 1)
 	keys[0] = buildKey(pk)
+	// The position must be read before the rows, so the rows
+	// we cache are at least as recent as their GTID.
+	gtid := qe.invalidator.GetGTID()
 	rcresults := tableInfo.Cache.Get(keys)
 	rcresult := rcresults[keys[0]]
-	if rcresult.Row != nil {
+	if plan.isHit(rcresult) {
 		if qe.mustVerify() {
 			qe.spotCheck(logStats, plan, rcresult, pk)
 		}
@@ -595,19 +1151,134 @@ func (qe *QueryEngine) fetchOne(logStats *SQLQueryStats, plan *compiledPlan, pk
 		tableInfo.hits.Add(1)
 		return rcresult.Row
 	}
-	resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, pk)
-	if len(resultFromdb.Rows) == 0 {
+	row, found := qe.fillOne(logStats, plan, pk, keys[0], rcresult.Cas, gtid)
+	if !found {
 		logStats.CacheAbsent++
 		tableInfo.absent.Add(1)
 		return nil
 	}
-	row = resultFromdb.Rows[0]
-	tableInfo.Cache.Set(keys[0], row, rcresult.Cas)
 	logStats.CacheMisses++
 	tableInfo.misses.Add(1)
 	return row
 }
 
+func fillKey(tableInfo *TableInfo, key string) string {
+	return tableInfo.Name + "." + key
+}
+
+// fillOne reads the row for pk from the db and caches it. If the
+// row is already being read by another query, it waits for its result.
+func (qe *QueryEngine) fillOne(logStats *SQLQueryStats, plan *compiledPlan, pk []sqltypes.Value, key string, cas uint64, gtid myproto.GTID) (row []sqltypes.Value, found bool) {
+	tableInfo := plan.TableInfo
+	fill, created := qe.fills.Create(fillKey(tableInfo, key))
+	if created {
+		defer fill.Broadcast()
+	} else {
+		fill.Wait()
+		if fill.Err == nil {
+			return fill.Row, fill.Row != nil
+		}
+		// The other fill failed. Read the row ourselves.
+	}
+	resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, pk)
+	if len(resultFromdb.Rows) == 0 {
+		if created {
+			fill.Err = nil
+		}
+		return nil, false
+	}
+	row = resultFromdb.Rows[0]
+	tableInfo.Cache.Set(key, row, cas, gtid)
+	if created {
+		fill.Row, fill.Err = row, nil
+	}
+	return row, true
+}
+
+// fillMulti reads the rows for pks from the db and caches them.
+// Rows that are already being read by other queries are not read
+// again: fillMulti waits for their result instead. pks must not
+// have duplicates, or fillMulti would wait for its own fills.
+func (qe *QueryEngine) fillMulti(logStats *SQLQueryStats, plan *compiledPlan, pks []sqltypes.Value, rcresults map[string]RCResult, gtid myproto.GTID) (rows [][]sqltypes.Value) {
+	owned := make(map[string]*Fill)
+	ownedPKs := make([]sqltypes.Value, 0, len(pks))
+	var waits []*Fill
+	var waitPKs []sqltypes.Value
+	for _, pk := range pks {
+		key := buildKey([]sqltypes.Value{pk})
+		fill, created := qe.fills.Create(fillKey(plan.TableInfo, key))
+		if created {
+			owned[key] = fill
+			ownedPKs = append(ownedPKs, pk)
+		} else {
+			waits = append(waits, fill)
+			waitPKs = append(waitPKs, pk)
+		}
+	}
+	// Owned rows must be filled before waiting for the other
+	// queries, which may themselves be waiting for them.
+	if len(ownedPKs) != 0 {
+		rows = qe.fillRows(logStats, plan, ownedPKs, owned, rcresults, gtid)
+	}
+	var failedPKs []sqltypes.Value
+	for i, fill := range waits {
+		fill.Wait()
+		if fill.Err != nil {
+			failedPKs = append(failedPKs, waitPKs[i])
+			continue
+		}
+		if fill.Row != nil {
+			rows = append(rows, fill.Row)
+		}
+	}
+	if len(failedPKs) != 0 {
+		rows = append(rows, qe.fillRows(logStats, plan, failedPKs, nil, rcresults, gtid)...)
+	}
+	return rows
+}
+
+// fillRows reads the rows for pks from the db, caches them,
+// and broadcasts them to the queries waiting on owned.
+func (qe *QueryEngine) fillRows(logStats *SQLQueryStats, plan *compiledPlan, pks []sqltypes.Value, owned map[string]*Fill, rcresults map[string]RCResult, gtid myproto.GTID) [][]sqltypes.Value {
+	defer func() {
+		for _, fill := range owned {
+			fill.Broadcast()
+		}
+	}()
+	tableInfo := plan.TableInfo
+	resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, pks)
+	for _, row := range resultFromdb.Rows {
+		key := buildKey(applyFilter(tableInfo.PKColumns, row))
+		tableInfo.Cache.Set(key, row, rcresults[key].Cas, gtid)
+		if fill := owned[key]; fill != nil {
+			fill.Row = row
+		}
+	}
+	for _, fill := range owned {
+		fill.Err = nil
+	}
+	return resultFromdb.Rows
+}
+
+// isHit returns true if rcresult has a row that the plan can use.
+func (plan *compiledPlan) isHit(rcresult RCResult) bool {
+	if rcresult.Row == nil {
+		return false
+	}
+	if plan.isStale(rcresult) {
+		staleRowCount.Add(1)
+		return false
+	}
+	return true
+}
+
+// isStale returns true if rcresult was filled before plan.MinGTID.
+// Rows without a GTID, or with a GTID that can't be compared, are stale.
+func (plan *compiledPlan) isStale(rcresult RCResult) bool {
+	ok, err := myproto.AtLeast(rcresult.GTID, plan.MinGTID)
+	return err != nil || !ok
+}
+
 func (qe *QueryEngine) execPKIN(logStats *SQLQueryStats, plan *compiledPlan) (result *mproto.QueryResult) {
 	pkRows, err := buildINValueList(plan.TableInfo, plan.PKValues, plan.BindVars)
 	if err != nil {
@@ -630,20 +1301,35 @@ func (qe *QueryEngine) fetchMulti(logStats *SQLQueryStats, plan *compiledPlan, p
 		panic("unexpected")
 	}
 
-	tableInfo := plan.TableInfo
-	keys := make([]string, len(pkRows))
-	for i, pk := range pkRows {
-		keys[i] = buildKey(pk)
+	result.Fields = plan.Fields
+	if logStats.skipRowcache || qe.mustBypassRowcache() {
+		bypassCount.Add(int64(len(pkRows)))
+		pkValues := make([]sqltypes.Value, len(pkRows))
+		for i, pk := range pkRows {
+			pkValues[i] = pk[0]
+		}
+		resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, pkValues)
+		result.Rows = make([][]sqltypes.Value, 0, len(resultFromdb.Rows))
+		for _, row := range resultFromdb.Rows {
+			result.Rows = append(result.Rows, applyFilter(plan.ColumnNumbers, row))
+		}
+		result.RowsAffected = uint64(len(result.Rows))
+		return result
 	}
+
+	tableInfo := plan.TableInfo
+	// Like MySQL, a pk repeated in the list only returns its row once,
+	// and it's not filled twice.
+	pkRows, keys := uniquePKRows(pkRows)
+	gtid := qe.invalidator.GetGTID()
 	rcresults := tableInfo.Cache.Get(keys)
 
-	result.Fields = plan.Fields
 	rows := make([][]sqltypes.Value, 0, len(pkRows))
 	missingRows := make([]sqltypes.Value, 0, len(pkRows))
 	var hits, absent, misses int64
 	for i, pk := range pkRows {
 		rcresult := rcresults[keys[i]]
-		if rcresult.Row != nil {
+		if plan.isHit(rcresult) {
 			if qe.mustVerify() {
 				qe.spotCheck(logStats, plan, rcresult, pk)
 			}
@@ -654,13 +1340,11 @@ func (qe *QueryEngine) fetchMulti(logStats *SQLQueryStats, plan *compiledPlan, p
 		}
 	}
 	if len(missingRows) != 0 {
-		resultFromdb := qe.qFetch(logStats, plan.OuterQuery, plan.BindVars, missingRows)
-		misses = int64(len(resultFromdb.Rows))
+		filled := qe.fillMulti(logStats, plan, missingRows, rcresults, gtid)
+		misses = int64(len(filled))
 		absent = int64(len(pkRows)) - hits - misses
-		for _, row := range resultFromdb.Rows {
+		for _, row := range filled {
 			rows = append(rows, applyFilter(plan.ColumnNumbers, row))
-			key := buildKey(applyFilter(plan.TableInfo.PKColumns, row))
-			tableInfo.Cache.Set(key, row, rcresults[key].Cas)
 		}
 	}
 
@@ -678,6 +1362,25 @@ func (qe *QueryEngine) fetchMulti(logStats *SQLQueryStats, plan *compiledPlan, p
 	return result
 }
 
+// mustBypassRowcache returns true if the invalidator is lagging
+// by more than rowcacheMaxLag. Rows would then be read from, and
+// stored into the rowcache before their invalidations are applied,
+// so reads are served from MySQL until the lag recovers.
+func (qe *QueryEngine) mustBypassRowcache() bool {
+	maxLag := qe.rowcacheMaxLag.Get()
+	lag := qe.invalidator.lagSeconds.Get()
+	if maxLag > 0 && lag > maxLag {
+		if qe.rowcacheBypassed.CompareAndSwap(0, 1) {
+			log.Warningf("Rowcache invalidator lag is %ds, bypassing rowcache for reads", lag)
+		}
+		return true
+	}
+	if qe.rowcacheBypassed.CompareAndSwap(1, 0) {
+		log.Infof("Rowcache invalidator lag is %ds, resuming rowcache reads", lag)
+	}
+	return false
+}
+
 func (qe *QueryEngine) mustVerify() bool {
 	return (Rand() % SPOT_CHECK_MULTIPLIER) < qe.spotCheckFreq.Get()
 }
@@ -723,6 +1426,73 @@ func (qe *QueryEngine) execDirect(logStats *SQLQueryStats, plan *compiledPlan, c
 	return
 }
 
+// execReserved runs plan on the reserved connection of query. The
+// session state of the connection can change the result of the
+// selects, so they bypass the rowcache and the consolidator. The
+// DMLs run as is, in autocommit mode, so they can't change the rows
+// of the cached tables, whose rowcache they wouldn't invalidate.
+func (qe *QueryEngine) execReserved(logStats *SQLQueryStats, query *proto.Query, plan *compiledPlan) (result *mproto.QueryResult) {
+	if query.TransactionId != 0 {
+		panic(NewTabletError(FAIL, "Transactions not allowed on reserved connections"))
+	}
+	switch plan.PlanId {
+	case planbuilder.PLAN_PASS_DML, planbuilder.PLAN_DML_PK, planbuilder.PLAN_DML_SUBQUERY,
+		planbuilder.PLAN_INSERT_PK, planbuilder.PLAN_INSERT_SUBQUERY, planbuilder.PLAN_UPSERT_PK:
+		if plan.TableInfo != nil && plan.TableInfo.CacheType != schema.CACHE_NONE {
+			panic(NewTabletError(FAIL, "DMLs of cached tables not allowed on reserved connections"))
+		}
+	case planbuilder.PLAN_SAVEPOINT, planbuilder.PLAN_ROLLBACK_SAVEPOINT, planbuilder.PLAN_RELEASE_SAVEPOINT:
+		panic(NewTabletError(FAIL, "Savepoints not allowed on reserved connections"))
+	}
+	conn := qe.reservedPool.Get(query.ReservedId, query.SessionId, logStats.context)
+	defer conn.Recycle()
+	switch plan.PlanId {
+	case planbuilder.PLAN_SET:
+		return qe.execSet(logStats, conn, plan)
+	case planbuilder.PLAN_NEXTVAL:
+		return qe.execNextVal(logStats, plan)
+	case planbuilder.PLAN_SELECT_LOCK:
+		panic(NewTabletError(FAIL, "Disallowed outside transaction"))
+	case planbuilder.PLAN_PASS_SELECT:
+		if plan.Reason == planbuilder.REASON_LOCK {
+			panic(NewTabletError(FAIL, "Disallowed outside transaction"))
+		}
+		return qe.execDirect(logStats, plan, conn)
+	case planbuilder.PLAN_PK_EQUAL, planbuilder.PLAN_PK_IN, planbuilder.PLAN_SELECT_SUBQUERY:
+		return qe.execDirect(logStats, plan, conn)
+	case planbuilder.PLAN_PASS_DML, planbuilder.PLAN_DML_PK, planbuilder.PLAN_DML_SUBQUERY,
+		planbuilder.PLAN_INSERT_PK, planbuilder.PLAN_INSERT_SUBQUERY, planbuilder.PLAN_UPSERT_PK:
+		return qe.directFetch(logStats, conn, plan.FullQuery, plan.BindVars, nil, nil)
+	}
+	panic(NewTabletError(FAIL, "%v not allowed on reserved connections", plan.PlanId))
+}
+
+// execSelectLock runs a locking select in the transaction of conn.
+// maxLockRows, if set, lowers the maximum number of rows of the result.
+// The query asks MySQL for one row more than that at most, so that it
+// doesn't lock the rows of a result that is too large.
+func (qe *QueryEngine) execSelectLock(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, plan *compiledPlan) (result *mproto.QueryResult) {
+	if limit := qe.maxLockRows.Get(); limit != 0 && (logStats.maxRows == 0 || limit < logStats.maxRows) {
+		logStats.maxRows = limit
+	}
+	limit := qe.resultLimit(logStats) + 1
+	if plan.LockLimit != nil {
+		val, err := resolveValue(&schema.TableColumn{Category: schema.CAT_NUMBER}, plan.LockLimit, plan.BindVars)
+		if err != nil {
+			panic(err)
+		}
+		rowcount, err := strconv.ParseInt(val.String(), 10, 64)
+		if err != nil {
+			panic(NewTabletError(FAIL, "invalid limit: %v", err))
+		}
+		if rowcount < limit {
+			limit = rowcount
+		}
+	}
+	plan.BindVars[LOCK_LIMIT_NAME] = limit
+	return qe.execDirect(logStats, plan, conn)
+}
+
 // execSelect sends a query to mysql only if another identical query is not running. Otherwise, it waits and
 // reuses the result. If the plan is missng field info, it sends the query to mysql requesting full info.
 func (qe *QueryEngine) execSelect(logStats *SQLQueryStats, plan *compiledPlan) (result *mproto.QueryResult) {
@@ -739,6 +1509,21 @@ func (qe *QueryEngine) execSelect(logStats *SQLQueryStats, plan *compiledPlan) (
 	return
 }
 
+// execBatch runs a select in the batch pool, with the batch limits.
+// It bypasses the rowcache and the consolidator: batch queries are
+// not expected to be frequent or identical.
+func (qe *QueryEngine) execBatch(logStats *SQLQueryStats, plan *compiledPlan) (result *mproto.QueryResult) {
+	if plan.Reason == planbuilder.REASON_LOCK {
+		panic(NewTabletError(FAIL, "Disallowed outside transaction"))
+	}
+	logStats.batch = true
+	waitingForConnectionStart := time.Now()
+	conn := getOrPanic(qe.batchConnPool)
+	logStats.WaitingForConnection += time.Now().Sub(waitingForConnectionStart)
+	defer conn.Recycle()
+	return qe.fullFetch(logStats, conn, plan.FullQuery, plan.BindVars, nil, nil)
+}
+
 func (qe *QueryEngine) execInsertPK(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, plan *compiledPlan, invalidator CacheInvalidator) (result *mproto.QueryResult) {
 	pkRows, err := buildValueList(plan.TableInfo, plan.PKValues, plan.BindVars)
 	if err != nil {
@@ -800,6 +1585,54 @@ func (qe *QueryEngine) execDMLPK(logStats *SQLQueryStats, conn dbconnpool.PoolCo
 	return result
 }
 
+// execUpsertPK executes a PLAN_UPSERT_PK as an insert and, if the pk
+// already exists, as an update of that pk, which must be invalidated.
+// Duplicates on other unique keys fail like they would for an insert.
+func (qe *QueryEngine) execUpsertPK(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, plan *compiledPlan, invalidator CacheInvalidator) (result *mproto.QueryResult) {
+	pkRows, err := buildValueList(plan.TableInfo, plan.PKValues, plan.BindVars)
+	if err != nil {
+		panic(err)
+	}
+	bsc := buildStreamComment(plan.TableInfo, pkRows, nil)
+	sql := qe.generateFinalSql(logStats, plan.OuterQuery, plan.BindVars, nil, bsc)
+	result, err = qe.executeSql(logStats, conn, sql, false)
+	if err == nil {
+		return result
+	}
+	terr, ok := err.(*TabletError)
+	if !ok || terr.SqlError != mysql.DUP_ENTRY || !strings.Contains(terr.Message, "for key 'PRIMARY'") {
+		panic(err)
+	}
+	result = qe.directFetch(logStats, conn, plan.UpsertQuery, plan.BindVars, pkRows[0], bsc)
+	if invalidator != nil {
+		invalidator.Delete(buildKey(pkRows[0]))
+	}
+	// Like MySQL, count the update of an existing row as 2 rows.
+	if result.RowsAffected == 1 {
+		result.RowsAffected = 2
+	}
+	return result
+}
+
+// serializeDMLPK makes the transaction wait for the other transactions
+// that updated the same rows, if hot row protection is enabled.
+func (qe *QueryEngine) serializeDMLPK(transactionId int64, plan *compiledPlan) {
+	if !qe.txSerializer.Enabled() {
+		return
+	}
+	pkRows, err := buildValueList(plan.TableInfo, plan.PKValues, plan.BindVars)
+	if err != nil {
+		panic(err)
+	}
+	keys := make([]string, len(pkRows))
+	for i, pk := range pkRows {
+		keys[i] = plan.TableName + "." + buildKey(pk)
+	}
+	if err := qe.activeTxPool.LockRows(transactionId, qe.txSerializer, plan.TableName, keys); err != nil {
+		panic(err)
+	}
+}
+
 func (qe *QueryEngine) execDMLSubquery(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, plan *compiledPlan, invalidator CacheInvalidator) (result *mproto.QueryResult) {
 	innerResult := qe.directFetch(logStats, conn, plan.Subquery, plan.BindVars, nil, nil)
 	// no need to validate innerResult
@@ -829,6 +1662,130 @@ func (qe *QueryEngine) execDMLPKRows(logStats *SQLQueryStats, conn dbconnpool.Po
 	return &mproto.QueryResult{RowsAffected: rowsAffected}
 }
 
+// execDMLChunks executes a PLAN_DML_SUBQUERY outside of a transaction.
+// The rows are changed by chunks of dmlChunkSize rows in pk order, each
+// chunk in its own transaction, with a pause of dmlChunkPause between
+// the chunks. This keeps the replication events small and the rows
+// locked briefly, but the DML is not atomic: if a chunk fails, the
+// previous ones stay committed.
+func (qe *QueryEngine) execDMLChunks(logStats *SQLQueryStats, plan *compiledPlan) (result *mproto.QueryResult) {
+	chunkSize := qe.dmlChunkSize.Get()
+	var lastPK []sqltypes.Value
+	rowsAffected := uint64(0)
+	for {
+		pkRows, affected := qe.execDMLChunkWithRetries(logStats, plan, lastPK, chunkSize)
+		dmlChunkStats.Add(plan.TableName, 1)
+		rowsAffected += affected
+		if int64(len(pkRows)) < chunkSize {
+			return &mproto.QueryResult{RowsAffected: rowsAffected}
+		}
+		lastPK = pkRows[len(pkRows)-1]
+		time.Sleep(qe.dmlChunkPause.Get())
+	}
+}
+
+// execDMLChunkWithRetries runs execDMLChunk again when it fails with
+// a deadlock or a lock wait timeout, up to the retry limits. The chunk
+// is rolled back when it fails, so it's safe to run it again.
+func (qe *QueryEngine) execDMLChunkWithRetries(logStats *SQLQueryStats, plan *compiledPlan, lastPK []sqltypes.Value, chunkSize int64) (pkRows [][]sqltypes.Value, rowsAffected uint64) {
+	for attempt := int64(1); ; attempt++ {
+		if pkRows, rowsAffected, ok := qe.tryDMLChunk(logStats, plan, lastPK, chunkSize, attempt); ok {
+			return pkRows, rowsAffected
+		}
+	}
+}
+
+// tryDMLChunk runs execDMLChunk. It returns ok false if
+// the chunk failed with a lock error that can be retried.
+func (qe *QueryEngine) tryDMLChunk(logStats *SQLQueryStats, plan *compiledPlan, lastPK []sqltypes.Value, chunkSize, attempt int64) (pkRows [][]sqltypes.Value, rowsAffected uint64, ok bool) {
+	defer func() {
+		if x := recover(); x != nil {
+			if !qe.canRetryLockError(plan, x, attempt) {
+				panic(x)
+			}
+		}
+	}()
+	pkRows, rowsAffected = qe.execDMLChunk(logStats, plan, lastPK, chunkSize)
+	return pkRows, rowsAffected, true
+}
+
+// canRetryLockError returns true if x, the error of the attempt-th
+// run of a DML on the table of plan, is a lock error that can be
+// retried. The retries, and the errors that run out of retries,
+// are counted by table and error.
+func (qe *QueryEngine) canRetryLockError(plan *compiledPlan, x interface{}, attempt int64) bool {
+	terr, ok := x.(*TabletError)
+	if !ok || plan.TableInfo == nil || plan.TableInfo.noLockRetries {
+		return false
+	}
+	var name string
+	var maxRetries int64
+	switch terr.SqlError {
+	case mysql.LOCK_DEADLOCK:
+		name, maxRetries = "Deadlock", qe.maxDeadlockRetries.Get()
+	case mysql.LOCK_WAIT_TIMEOUT:
+		name, maxRetries = "LockWaitTimeout", qe.maxLockWaitRetries.Get()
+	default:
+		return false
+	}
+	if attempt > maxRetries {
+		if maxRetries != 0 {
+			lockRetryStats.Add([]string{plan.TableName, name + "Exhausted"}, 1)
+		}
+		return false
+	}
+	log.Infof("retrying %s of %s, attempt %d: %v", plan.Query, plan.TableName, attempt, terr)
+	lockRetryStats.Add([]string{plan.TableName, name}, 1)
+	return true
+}
+
+// execDMLChunk changes the chunk of rows after lastPK, or the first
+// one if lastPK is nil, in a new transaction. It returns the pks of
+// the chunk.
+func (qe *QueryEngine) execDMLChunk(logStats *SQLQueryStats, plan *compiledPlan, lastPK []sqltypes.Value, chunkSize int64) (pkRows [][]sqltypes.Value, rowsAffected uint64) {
+	transactionID := qe.Begin(logStats, 0)
+	pkRows, rowsAffected = func() ([][]sqltypes.Value, uint64) {
+		defer func() {
+			if x := recover(); x != nil {
+				qe.Rollback(logStats, transactionID)
+				panic(x)
+			}
+		}()
+		conn := qe.activeTxPool.Get(transactionID)
+		defer conn.Recycle()
+		conn.RecordQuery(plan.Query)
+		var invalidator CacheInvalidator
+		if plan.TableInfo.CacheType != schema.CACHE_NONE {
+			invalidator = conn.DirtyKeys(plan.TableName)
+		}
+		chunkQuery := plan.ChunkQuery
+		if lastPK != nil {
+			chunkQuery = plan.NextChunkQuery
+		}
+		plan.BindVars["_vtChunkSize"] = chunkSize
+		innerResult := qe.directFetch(logStats, conn, chunkQuery, plan.BindVars, lastPK, nil)
+		return innerResult.Rows, qe.execDMLPKRows(logStats, conn, plan, innerResult.Rows, invalidator).RowsAffected
+	}()
+	qe.Commit(logStats, transactionID)
+	return pkRows, rowsAffected
+}
+
+// execSavepoint executes a savepoint statement in the transaction
+// of conn, and keeps track of the savepoints, so that the redo
+// statements undone by a rollback to a savepoint are dropped.
+func (qe *QueryEngine) execSavepoint(logStats *SQLQueryStats, conn *TxConnection, plan *compiledPlan) (result *mproto.QueryResult) {
+	result = qe.directFetch(logStats, conn, plan.FullQuery, plan.BindVars, nil, nil)
+	switch plan.PlanId {
+	case planbuilder.PLAN_SAVEPOINT:
+		conn.SetSavepoint(plan.SavepointName)
+	case planbuilder.PLAN_ROLLBACK_SAVEPOINT:
+		conn.RollbackToSavepoint(plan.SavepointName)
+	case planbuilder.PLAN_RELEASE_SAVEPOINT:
+		conn.ReleaseSavepoint(plan.SavepointName)
+	}
+	return result
+}
+
 func (qe *QueryEngine) execSet(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, plan *compiledPlan) (result *mproto.QueryResult) {
 	switch plan.SetKey {
 	case "vt_pool_size":
@@ -849,24 +1806,100 @@ func (qe *QueryEngine) execSet(logStats *SQLQueryStats, conn dbconnpool.PoolConn
 			panic(NewTabletError(FAIL, "max result size out of range %v", val))
 		}
 		qe.maxResultSize.Set(val)
+	case "vt_max_result_bytes":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "max result bytes out of range %v", val))
+		}
+		qe.maxResultBytes.Set(val)
+	case "vt_caller_max_concurrency":
+		qe.callerQuotas.SetMaxConcurrency(int(getInt64(plan.SetValue)))
+	case "vt_caller_max_qps":
+		qe.callerQuotas.SetMaxQPS(int(getInt64(plan.SetValue)))
+	case "vt_max_prepared_statements":
+		qe.prepared.SetMaxSize(int(getInt64(plan.SetValue)))
 	case "vt_stream_buffer_size":
 		val := getInt64(plan.SetValue)
 		if val < 1024 {
 			panic(NewTabletError(FAIL, "stream buffer size out of range %v", val))
 		}
 		qe.streamBufferSize.Set(val)
+	case "vt_stream_buffer_rows":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "stream buffer rows out of range %v", val))
+		}
+		qe.streamBufferRows.Set(val)
+	case "vt_batch_pool_size":
+		qe.batchConnPool.SetCapacity(int(getInt64(plan.SetValue)))
+	case "vt_reserved_pool_size":
+		qe.reservedConnPool.SetCapacity(int(getInt64(plan.SetValue)))
+	case "vt_reserved_idle_timeout":
+		qe.reservedPool.SetIdleTimeout(getDuration(plan.SetValue))
+	case "vt_batch_max_result_size":
+		val := getInt64(plan.SetValue)
+		if val < 1 {
+			panic(NewTabletError(FAIL, "batch max result size out of range %v", val))
+		}
+		qe.batchMaxResultSize.Set(val)
+	case "vt_batch_query_timeout":
+		timeout := getDuration(plan.SetValue)
+		if timeout == 0 {
+			timeout = qe.activePool.Timeout()
+		}
+		qe.batchActivePool.SetTimeout(timeout)
 	case "vt_query_timeout":
 		qe.activePool.SetTimeout(getDuration(plan.SetValue))
+	case "vt_shutdown_grace_period":
+		qe.shutdownGracePeriod.Set(getDuration(plan.SetValue))
+	case "vt_dml_chunk_size":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "dml chunk size out of range %v", val))
+		}
+		qe.dmlChunkSize.Set(val)
+	case "vt_dml_chunk_pause":
+		qe.dmlChunkPause.Set(getDuration(plan.SetValue))
+	case "vt_throttler_max_threads_running":
+		qe.loadThrottler.maxThreadsRunning.Set(getInt64(plan.SetValue))
+	case "vt_throttler_max_history_length":
+		qe.loadThrottler.maxHistoryLength.Set(getInt64(plan.SetValue))
+	case "vt_throttler_max_lag":
+		qe.loadThrottler.maxLag.Set(getInt64(plan.SetValue))
+	case "vt_throttler_max_wait":
+		qe.loadThrottler.maxWait.Set(getDuration(plan.SetValue))
+	case "vt_max_lock_rows":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "max lock rows out of range %v", val))
+		}
+		qe.maxLockRows.Set(val)
+	case "vt_max_deadlock_retries":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "max deadlock retries out of range %v", val))
+		}
+		qe.maxDeadlockRetries.Set(val)
+	case "vt_max_lock_wait_retries":
+		val := getInt64(plan.SetValue)
+		if val < 0 {
+			panic(NewTabletError(FAIL, "max lock wait retries out of range %v", val))
+		}
+		qe.maxLockWaitRetries.Set(val)
 	case "vt_idle_timeout":
 		t := getDuration(plan.SetValue)
 		qe.connPool.SetIdleTimeout(t)
 		qe.streamConnPool.SetIdleTimeout(t)
 		qe.txPool.SetIdleTimeout(t)
+		qe.batchConnPool.SetIdleTimeout(t)
+		qe.reservedConnPool.SetIdleTimeout(t)
 		qe.connKiller.SetIdleTimeout(t)
 	case "vt_spot_check_ratio":
 		qe.spotCheckFreq.Set(int64(getFloat64(plan.SetValue) * SPOT_CHECK_MULTIPLIER))
 	case "vt_strict_mode":
 		qe.strictMode.Set(getInt64(plan.SetValue))
+	case "vt_rowcache_max_lag":
+		qe.rowcacheMaxLag.Set(getInt64(plan.SetValue))
 	default:
 		return qe.directFetch(logStats, conn, plan.FullQuery, plan.BindVars, nil, nil)
 	}
@@ -895,7 +1928,7 @@ func getDuration(v interface{}) time.Duration {
 }
 
 func (qe *QueryEngine) qFetch(logStats *SQLQueryStats, parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value) (result *mproto.QueryResult) {
-	sql := qe.generateFinalSql(parsedQuery, bindVars, listVars, nil)
+	sql := qe.generateFinalSql(logStats, parsedQuery, bindVars, listVars, nil)
 	q, ok := qe.consolidator.Create(string(sql))
 	if ok {
 		defer q.Broadcast()
@@ -919,7 +1952,7 @@ func (qe *QueryEngine) qFetch(logStats *SQLQueryStats, parsedQuery *sqlparser.Pa
 }
 
 func (qe *QueryEngine) directFetch(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value, buildStreamComment []byte) (result *mproto.QueryResult) {
-	sql := qe.generateFinalSql(parsedQuery, bindVars, listVars, buildStreamComment)
+	sql := qe.generateFinalSql(logStats, parsedQuery, bindVars, listVars, buildStreamComment)
 	result, err := qe.executeSql(logStats, conn, sql, false)
 	if err != nil {
 		panic(err)
@@ -929,7 +1962,7 @@ func (qe *QueryEngine) directFetch(logStats *SQLQueryStats, conn dbconnpool.Pool
 
 // fullFetch also fetches field info
 func (qe *QueryEngine) fullFetch(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value, buildStreamComment []byte) (result *mproto.QueryResult) {
-	sql := qe.generateFinalSql(parsedQuery, bindVars, listVars, buildStreamComment)
+	sql := qe.generateFinalSql(logStats, parsedQuery, bindVars, listVars, buildStreamComment)
 	result, err := qe.executeSql(logStats, conn, sql, true)
 	if err != nil {
 		panic(err)
@@ -938,12 +1971,12 @@ func (qe *QueryEngine) fullFetch(logStats *SQLQueryStats, conn dbconnpool.PoolCo
 }
 
 func (qe *QueryEngine) fullStreamFetch(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value, buildStreamComment []byte, callback func(*mproto.QueryResult) error) {
-	sql := qe.generateFinalSql(parsedQuery, bindVars, listVars, buildStreamComment)
+	sql := qe.generateFinalSql(logStats, parsedQuery, bindVars, listVars, buildStreamComment)
 	qe.executeStreamSql(logStats, conn, sql, callback)
 }
 
-func (qe *QueryEngine) generateFinalSql(parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value, buildStreamComment []byte) string {
-	bindVars[MAX_RESULT_NAME] = qe.maxResultSize.Get() + 1
+func (qe *QueryEngine) generateFinalSql(logStats *SQLQueryStats, parsedQuery *sqlparser.ParsedQuery, bindVars map[string]interface{}, listVars []sqltypes.Value, buildStreamComment []byte) string {
+	bindVars[MAX_RESULT_NAME] = qe.resultLimit(logStats) + 1
 	sql, err := parsedQuery.GenerateQuery(bindVars, listVars)
 	if err != nil {
 		panic(NewTabletError(FAIL, "%s", err))
@@ -956,10 +1989,66 @@ func (qe *QueryEngine) generateFinalSql(parsedQuery *sqlparser.ParsedQuery, bind
 	return hack.String(sql)
 }
 
+// resultLimit returns the maximum number of rows of the results
+// of the request, which depends on the pool it runs in, on the
+// schema override of its table, and on its MAX_ROWS directive.
+func (qe *QueryEngine) resultLimit(logStats *SQLQueryStats) int64 {
+	limit := qe.maxResultSize.Get()
+	if logStats.batch {
+		limit = qe.batchMaxResultSize.Get()
+	} else if logStats.table != nil && logStats.table.maxResultSize != 0 {
+		limit = logStats.table.maxResultSize
+	}
+	if logStats.maxRows != 0 && logStats.maxRows < limit {
+		return logStats.maxRows
+	}
+	return limit
+}
+
+// resultBytesLimit returns the maximum size in bytes of the values
+// of the results of the request. 0 means no limit. Batch requests
+// are only limited in rows.
+func (qe *QueryEngine) resultBytesLimit(logStats *SQLQueryStats) int64 {
+	if logStats.batch {
+		return 0
+	}
+	if logStats.table != nil && logStats.table.maxResultBytes != 0 {
+		return logStats.table.maxResultBytes
+	}
+	return qe.maxResultBytes.Get()
+}
+
+// checkResultSize fails with RESULT_TOO_LARGE if result exceeds the
+// limits of the request. MySQL results are already limited in rows
+// by executeSql, but results served by the rowcache are not.
+func (qe *QueryEngine) checkResultSize(logStats *SQLQueryStats, result *mproto.QueryResult) {
+	if limit := qe.resultLimit(logStats); int64(len(result.Rows)) > limit {
+		panic(NewTabletError(RESULT_TOO_LARGE, "Row count exceeded %d", limit))
+	}
+	limit := qe.resultBytesLimit(logStats)
+	if limit == 0 {
+		return
+	}
+	size := int64(0)
+	for _, row := range result.Rows {
+		for _, val := range row {
+			size += int64(len(val.Raw()))
+		}
+		if size > limit {
+			panic(NewTabletError(RESULT_TOO_LARGE, "Result bytes exceeded %d", limit))
+		}
+	}
+}
+
 func (qe *QueryEngine) executeSql(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, sql string, wantfields bool) (*mproto.QueryResult, error) {
+	// The batch queries have their own timeout.
+	activePool := qe.activePool
+	if logStats.batch {
+		activePool = qe.batchActivePool
+	}
 	connid := conn.Id()
-	qe.activePool.Put(connid)
-	defer qe.activePool.Remove(connid)
+	activePool.Put(connid, logStats.queryTimeout)
+	defer activePool.Remove(connid)
 
 	logStats.QuerySources |= QUERY_SOURCE_MYSQL
 	logStats.NumberOfQueries++
@@ -969,21 +2058,32 @@ func (qe *QueryEngine) executeSql(logStats *SQLQueryStats, conn dbconnpool.PoolC
 	// conn.ExecuteFetch because that would require changing the
 	// PoolConnection interface. Same applies to executeStreamSql.
 	fetchStart := time.Now()
-	result, err := conn.ExecuteFetch(sql, int(qe.maxResultSize.Get()), wantfields)
+	limit := qe.resultLimit(logStats)
+	result, err := conn.ExecuteFetch(sql, int(limit), wantfields)
 	logStats.MysqlResponseTime += time.Now().Sub(fetchStart)
 
 	if err != nil {
+		if isRowCountExceeded(err) {
+			return nil, NewTabletError(RESULT_TOO_LARGE, "Row count exceeded %d", limit)
+		}
 		return nil, NewTabletErrorSql(FAIL, err)
 	}
 	return result, nil
 }
 
 func (qe *QueryEngine) executeStreamSql(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, sql string, callback func(*mproto.QueryResult) error) {
+	// Streaming queries are not subject to the pool timeout,
+	// only to the one the caller explicitly asked for.
+	if logStats.queryTimeout > 0 {
+		connid := conn.Id()
+		qe.activePool.Put(connid, logStats.queryTimeout)
+		defer qe.activePool.Remove(connid)
+	}
 	logStats.QuerySources |= QUERY_SOURCE_MYSQL
 	logStats.NumberOfQueries++
 	logStats.AddRewrittenSql(sql)
 	fetchStart := time.Now()
-	err := conn.ExecuteStreamFetch(sql, callback, int(qe.streamBufferSize.Get()))
+	err := conn.ExecuteStreamFetch(sql, callback, int(qe.streamBufferSize.Get()), int(qe.streamBufferRows.Get()))
 	logStats.MysqlResponseTime += time.Now().Sub(fetchStart)
 	if err != nil {
 		panic(NewTabletErrorSql(FAIL, err))
@@ -0,0 +1,384 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/pools"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/schema"
+	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+)
+
+func TestMustBypassRowcache(t *testing.T) {
+	qe := &QueryEngine{invalidator: &RowcacheInvalidator{}}
+	table := []struct {
+		maxLag, lag int64
+		want        bool
+	}{
+		{maxLag: 0, lag: 100, want: false},
+		{maxLag: 10, lag: 5, want: false},
+		{maxLag: 10, lag: 11, want: true},
+		{maxLag: 10, lag: 12, want: true},
+		{maxLag: 10, lag: 10, want: false},
+		{maxLag: 10, lag: 11, want: true},
+		{maxLag: 0, lag: 11, want: false},
+	}
+	for _, tcase := range table {
+		qe.rowcacheMaxLag.Set(tcase.maxLag)
+		qe.invalidator.lagSeconds.Set(tcase.lag)
+		if got := qe.mustBypassRowcache(); got != tcase.want {
+			t.Errorf("max lag %d, lag %d: mustBypassRowcache() = %v, want %v", tcase.maxLag, tcase.lag, got, tcase.want)
+		}
+		wantBypassed := int64(0)
+		if tcase.want {
+			wantBypassed = 1
+		}
+		if got := qe.rowcacheBypassed.Get(); got != wantBypassed {
+			t.Errorf("max lag %d, lag %d: rowcacheBypassed = %d, want %d", tcase.maxLag, tcase.lag, got, wantBypassed)
+		}
+	}
+}
+
+func TestCheckResultSize(t *testing.T) {
+	qe := &QueryEngine{}
+	qe.maxResultSize.Set(2)
+	qe.maxResultBytes.Set(6)
+	row := []sqltypes.Value{sqltypes.MakeString([]byte("abc"))}
+	table := []struct {
+		rows        int
+		tableSize   int64
+		tableBytes  int64
+		batch       bool
+		wantFailure bool
+	}{
+		{rows: 2},
+		{rows: 3, wantFailure: true},
+		{rows: 3, tableSize: 3, wantFailure: true},
+		{rows: 3, tableSize: 3, tableBytes: 9},
+		{rows: 2, tableBytes: 5, wantFailure: true},
+		{rows: 3, batch: true},
+		{rows: 4, batch: true, wantFailure: true},
+	}
+	qe.batchMaxResultSize.Set(3)
+	for i, tcase := range table {
+		logStats := &SQLQueryStats{
+			table: &TableInfo{maxResultSize: tcase.tableSize, maxResultBytes: tcase.tableBytes},
+			batch: tcase.batch,
+		}
+		result := &mproto.QueryResult{}
+		for j := 0; j < tcase.rows; j++ {
+			result.Rows = append(result.Rows, row)
+		}
+		failed := func() (failed bool) {
+			defer func() {
+				if x := recover(); x != nil {
+					if terr, ok := x.(*TabletError); !ok || terr.ErrorType != RESULT_TOO_LARGE {
+						t.Errorf("case %d: got %v, want a RESULT_TOO_LARGE error", i, x)
+					}
+					failed = true
+				}
+			}()
+			qe.checkResultSize(logStats, result)
+			return false
+		}()
+		if failed != tcase.wantFailure {
+			t.Errorf("case %d: checkResultSize failed: %v, want %v", i, failed, tcase.wantFailure)
+		}
+	}
+}
+
+func TestBatchQueryTimeout(t *testing.T) {
+	killStats = stats.NewCounters("")
+	db := newFakeDB()
+	db.AddDelay("select sleep(0.1)", 100*time.Millisecond)
+	connKiller := &ConnectionKiller{connPool: db.newPool(1)}
+	qe := &QueryEngine{
+		activePool:      NewActivePool("TestBatchQueryTimeoutActivePool", 20*time.Millisecond, connKiller),
+		batchActivePool: NewActivePool("TestBatchQueryTimeoutBatchActivePool", time.Second, connKiller),
+	}
+	qe.maxResultSize.Set(10)
+	qe.batchMaxResultSize.Set(10)
+	qe.activePool.Open()
+	defer qe.activePool.Close()
+	qe.batchActivePool.Open()
+	defer qe.batchActivePool.Close()
+	pool := db.newPool(1)
+	defer pool.Close()
+
+	// A batch query runs longer than the query timeout, but not
+	// longer than the batch query timeout: it's not killed.
+	conn := getOrPanic(pool)
+	if _, err := qe.executeSql(&SQLQueryStats{batch: true}, conn, "select sleep(0.1)", false); err != nil {
+		t.Errorf("batch query: %v", err)
+	}
+	conn.Recycle()
+	if got, want := db.Queries(), []string{"select sleep(0.1)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batch query: got queries %v, want %v", got, want)
+	}
+
+	// The same query is killed outside of the batch pool.
+	conn = getOrPanic(pool)
+	qe.executeSql(&SQLQueryStats{}, conn, "select sleep(0.1)", false)
+	conn.Recycle()
+	if got, want := db.Queries(), []string{"select sleep(0.1)", fmt.Sprintf("KILL %d", conn.Id())}; !reflect.DeepEqual(got, want) {
+		t.Errorf("regular query: got queries %v, want %v", got, want)
+	}
+}
+
+func TestServePools(t *testing.T) {
+	db := newFakeDB()
+	qe := &QueryEngine{connPool: db.newPool(3)}
+	defer qe.connPool.Close()
+
+	// a GET only returns the stats
+	for _, path := range []string{"/debug/pools?pool=conn", "/debug/pools?pool=conn&capacity=1&idle_timeout=1s"} {
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		qe.servePools(response, request)
+		if got := qe.connPool.Capacity(); got != 3 {
+			t.Errorf("GET %v: capacity = %v, want 3", path, got)
+		}
+	}
+	request, _ := http.NewRequest("GET", "/debug/pools?pool=conn&capacity=1", nil)
+	response := httptest.NewRecorder()
+	qe.servePools(response, request)
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET with a capacity: got code %v, want %v", response.Code, http.StatusMethodNotAllowed)
+	}
+
+	form := url.Values{"pool": {"conn"}, "capacity": {"2"}, "idle_timeout": {"1s"}}
+	request, _ = http.NewRequest("POST", "/debug/pools", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	qe.servePools(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("POST: got code %v, want %v", response.Code, http.StatusOK)
+	}
+	if got := qe.connPool.Capacity(); got != 2 {
+		t.Errorf("POST: capacity = %v, want 2", got)
+	}
+	if got := qe.connPool.IdleTimeout(); got != time.Second {
+		t.Errorf("POST: idle timeout = %v, want 1s", got)
+	}
+}
+
+func TestWaitOrKill(t *testing.T) {
+	// Without a grace period, nothing is killed.
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	kills := 0
+	waitOrKill(done, 0, func() { kills++ })
+	if kills != 0 {
+		t.Errorf("kills without grace period: %d, want 0", kills)
+	}
+
+	// What's left after the grace period is killed
+	// until it's done.
+	done = make(chan struct{})
+	waitOrKill(done, time.Millisecond, func() {
+		kills++
+		if kills == 2 {
+			close(done)
+		}
+	})
+	if kills != 2 {
+		t.Errorf("kills after the grace period: %d, want 2", kills)
+	}
+}
+
+func TestCanRetryLockError(t *testing.T) {
+	saved := lockRetryStats
+	defer func() { lockRetryStats = saved }()
+	lockRetryStats = stats.NewMultiCounters("", []string{"Table", "Error"})
+
+	qe := &QueryEngine{}
+	qe.maxDeadlockRetries.Set(2)
+	plan := &compiledPlan{ExecPlan: &ExecPlan{ExecPlan: &planbuilder.ExecPlan{TableName: "a"}, TableInfo: &TableInfo{}}}
+	deadlock := &TabletError{ErrorType: FAIL, SqlError: mysql.LOCK_DEADLOCK}
+	lockWait := &TabletError{ErrorType: FAIL, SqlError: mysql.LOCK_WAIT_TIMEOUT}
+	table := []struct {
+		err     interface{}
+		attempt int64
+		want    bool
+	}{
+		{err: deadlock, attempt: 1, want: true},
+		{err: deadlock, attempt: 2, want: true},
+		{err: deadlock, attempt: 3, want: false},
+		{err: lockWait, attempt: 1, want: false},
+		{err: &TabletError{ErrorType: FAIL, SqlError: mysql.DUP_ENTRY}, attempt: 1, want: false},
+		{err: "not a tablet error", attempt: 1, want: false},
+	}
+	for _, tcase := range table {
+		if got := qe.canRetryLockError(plan, tcase.err, tcase.attempt); got != tcase.want {
+			t.Errorf("canRetryLockError(%v, %d): %v, want %v", tcase.err, tcase.attempt, got, tcase.want)
+		}
+	}
+	want := map[string]int64{"a.Deadlock": 2, "a.DeadlockExhausted": 1}
+	if got := lockRetryStats.Counts(); len(got) != len(want) || got["a.Deadlock"] != 2 || got["a.DeadlockExhausted"] != 1 {
+		t.Errorf("LockRetries: %v, want %v", got, want)
+	}
+
+	qe.maxLockWaitRetries.Set(1)
+	if !qe.canRetryLockError(plan, lockWait, 1) {
+		t.Errorf("lock wait timeout was not retried")
+	}
+	plan.TableInfo.noLockRetries = true
+	if qe.canRetryLockError(plan, deadlock, 1) {
+		t.Errorf("deadlock of a table without retries was retried")
+	}
+}
+
+// newSequenceQueryEngine returns a QueryEngine whose transactions
+// run on db, and the sequence table my_seq.
+func newSequenceQueryEngine(db *fakeDB, name string) (*QueryEngine, *TableInfo) {
+	qe := &QueryEngine{
+		txPool:       db.newPool(1),
+		activeTxPool: &ActiveTxPool{pool: pools.NewNumbered(), txStats: stats.NewTimings(""), rows: make(map[int64]*txRows)},
+		activePool:   NewActivePool(name+"ActivePool", time.Second, &ConnectionKiller{connPool: db.newPool(1)}),
+	}
+	qe.maxResultSize.Set(10)
+	qe.activePool.Open()
+	tableInfo := &TableInfo{Table: &schema.Table{Name: "my_seq", Type: schema.TYPE_SEQUENCE}, Sequence: &Sequence{}}
+	return qe, tableInfo
+}
+
+// sequenceRow is the result of the select of the sequence row.
+func sequenceRow(nextID, cache string) *mproto.QueryResult {
+	return &mproto.QueryResult{Rows: [][]sqltypes.Value{{
+		sqltypes.MakeNumeric([]byte(nextID)),
+		sqltypes.MakeNumeric([]byte(cache)),
+	}}}
+}
+
+// tryNextVal returns the error nextVal panics with, if any.
+func tryNextVal(qe *QueryEngine, tableInfo *TableInfo, count int64) (val int64, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = x.(error)
+		}
+	}()
+	logStats := newSqlQueryStats("Execute", &context.DummyContext{})
+	return qe.nextVal(logStats, tableInfo, count), nil
+}
+
+func TestNextValCache(t *testing.T) {
+	db := newFakeDB()
+	const selectSeq = "select next_id, cache from my_seq where id = 0 for update"
+	db.AddQuery(selectSeq, sequenceRow("1", "3"))
+	qe, tableInfo := newSequenceQueryEngine(db, "TestNextValCache")
+	defer qe.activePool.Close()
+
+	// The first value reserves a block of cache values.
+	if val, err := tryNextVal(qe, tableInfo, 1); err != nil || val != 1 {
+		t.Errorf("nextVal: %v, %v, want 1", val, err)
+	}
+	want := []string{"begin", selectSeq, "update my_seq set next_id = 4 where id = 0", "commit"}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	// The next ones come from the cache.
+	for _, wantVal := range []int64{2, 3} {
+		if val, err := tryNextVal(qe, tableInfo, 1); err != nil || val != wantVal {
+			t.Errorf("nextVal: %v, %v, want %v", val, err, wantVal)
+		}
+	}
+	if got := db.Queries(); len(got) != 0 {
+		t.Errorf("queries from the cache: %v, want none", got)
+	}
+
+	// Once the cache is exhausted, the next block is reserved. It
+	// starts after the previous one, even if next_id went back.
+	if val, err := tryNextVal(qe, tableInfo, 1); err != nil || val != 4 {
+		t.Errorf("nextVal: %v, %v, want 4", val, err)
+	}
+	want = []string{"begin", selectSeq, "update my_seq set next_id = 7 where id = 0", "commit"}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	// More values than left in the cache reserve whole blocks.
+	db.AddQuery(selectSeq, sequenceRow("7", "3"))
+	if val, err := tryNextVal(qe, tableInfo, 4); err != nil || val != 7 {
+		t.Errorf("nextVal(4): %v, %v, want 7", val, err)
+	}
+	want = []string{"begin", selectSeq, "update my_seq set next_id = 13 where id = 0", "commit"}
+	if got := db.Queries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+	if val, err := tryNextVal(qe, tableInfo, 2); err != nil || val != 11 {
+		t.Errorf("nextVal(2): %v, %v, want 11", val, err)
+	}
+	if val, err := tryNextVal(qe, tableInfo, 0); err == nil {
+		t.Errorf("nextVal(0): %v, want an error", val)
+	}
+}
+
+func TestNextValErrors(t *testing.T) {
+	db := newFakeDB()
+	const selectSeq = "select next_id, cache from my_seq where id = 0 for update"
+	qe, tableInfo := newSequenceQueryEngine(db, "TestNextValErrors")
+	defer qe.activePool.Close()
+
+	// Without the sequence row, nothing is reserved.
+	if _, err := tryNextVal(qe, tableInfo, 1); err == nil || !strings.Contains(err.Error(), "sequence table my_seq has no row with id 0") {
+		t.Errorf("nextVal without a row: %v", err)
+	}
+	if got, want := db.Queries(), []string{"begin", selectSeq, "rollback"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	// An invalid cache is refused.
+	db.AddQuery(selectSeq, sequenceRow("1", "0"))
+	if _, err := tryNextVal(qe, tableInfo, 1); err == nil || !strings.Contains(err.Error(), "invalid cache in sequence table my_seq") {
+		t.Errorf("nextVal with a zero cache: %v", err)
+	}
+	if got, want := db.Queries(), []string{"begin", selectSeq, "rollback"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	// If the update fails, the block isn't used.
+	db.AddQuery(selectSeq, sequenceRow("1", "3"))
+	db.AddError("update my_seq set next_id = 4 where id = 0", fmt.Errorf("lock wait timeout"))
+	if _, err := tryNextVal(qe, tableInfo, 1); err == nil || !strings.Contains(err.Error(), "lock wait timeout") {
+		t.Errorf("nextVal with a failed update: %v", err)
+	}
+	if got, want := db.Queries(), []string{"begin", selectSeq, "update my_seq set next_id = 4 where id = 0", "rollback"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queries: %v, want %v", got, want)
+	}
+
+	// Nor if the commit fails.
+	db.AddError("update my_seq set next_id = 4 where id = 0", nil)
+	db.AddError("commit", fmt.Errorf("connection lost"))
+	if _, err := tryNextVal(qe, tableInfo, 1); err == nil || !strings.Contains(err.Error(), "connection lost") {
+		t.Errorf("nextVal with a failed commit: %v", err)
+	}
+	db.Queries()
+	if tableInfo.Sequence.lastVal != 0 {
+		t.Errorf("lastVal after a failed commit: %v, want 0", tableInfo.Sequence.lastVal)
+	}
+
+	// The next call reserves the block again.
+	db.AddError("commit", nil)
+	if val, err := tryNextVal(qe, tableInfo, 1); err != nil || val != 1 {
+		t.Errorf("nextVal: %v, %v, want 1", val, err)
+	}
+}
@@ -9,11 +9,22 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/youtube/vitess/go/vt/key"
 	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
 )
 
+// Sources of the query rules. The static rules are the ones the query
+// service is started with. The other sources push rules at runtime.
+const (
+	QR_SOURCE_STATIC = "static"
+	QR_SOURCE_HTTP   = "http"
+	QR_SOURCE_TOPO   = "topo"
+)
+
 //-----------------------------------------------
 
 // QueryRules is used to store and execute rules for the tabletserver.
@@ -87,6 +98,21 @@ func (qrs *QueryRules) UnmarshalJSON(data []byte) (err error) {
 	return nil
 }
 
+// Append appends the rules of otherqrs to qrs. The rules
+// are not copied.
+func (qrs *QueryRules) Append(otherqrs *QueryRules) {
+	qrs.rules = append(qrs.rules, otherqrs.rules...)
+}
+
+// MarshalJSON encodes QueryRules in the format accepted
+// by UnmarshalJSON.
+func (qrs *QueryRules) MarshalJSON() ([]byte, error) {
+	if qrs.rules == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(qrs.rules)
+}
+
 // filterByPlan creates a new QueryRules by prefiltering on the query and planId. This allows
 // us to create query plan specific QueryRules out of the original QueryRules. In the new rules,
 // query, plans and tableNames predicates are empty.
@@ -139,6 +165,12 @@ type QueryRule struct {
 
 	// Action to be performed on trigger
 	act Action
+
+	// maxQPS is the rate allowed by a QR_THROTTLE rule. The
+	// throttler is shared by all copies of the rule, so that
+	// the rate applies to all the plans the rule matches.
+	maxQPS    int64
+	throttler *ruleThrottler
 }
 
 // NewQueryRule creates a new QueryRule.
@@ -156,6 +188,8 @@ func (qr *QueryRule) Copy() (newqr *QueryRule) {
 		user:        qr.user,
 		query:       qr.query,
 		act:         qr.act,
+		maxQPS:      qr.maxQPS,
+		throttler:   qr.throttler,
 	}
 	if qr.plans != nil {
 		newqr.plans = make([]planbuilder.PlanType, len(qr.plans))
@@ -172,6 +206,14 @@ func (qr *QueryRule) Copy() (newqr *QueryRule) {
 	return newqr
 }
 
+// SetMaxQPS sets the rate of queries a QR_THROTTLE rule lets
+// through. The queries in excess are failed. A QR_THROTTLE rule
+// with no rate fails all the queries it matches.
+func (qr *QueryRule) SetMaxQPS(maxQPS int64) {
+	qr.maxQPS = maxQPS
+	qr.throttler = newRuleThrottler(maxQPS)
+}
+
 // SetIPCond adds a regular expression condition for the client IP.
 // It has to be a full match (not substring).
 func (qr *QueryRule) SetIPCond(pattern string) (err error) {
@@ -211,6 +253,11 @@ func makeExact(pattern string) string {
 	return fmt.Sprintf("^%s$", pattern)
 }
 
+// unmakeExact returns the pattern that was passed to makeExact.
+func unmakeExact(re *regexp.Regexp) string {
+	return strings.TrimSuffix(strings.TrimPrefix(re.String(), "^"), "$")
+}
+
 // AddBindVarCond adds a bind variable restriction to the QueryRule.
 // All bind var conditions have to be satisfied for the QueryRule
 // to be a match.
@@ -308,9 +355,48 @@ func (qr *QueryRule) getAction(ip, user string, bindVars map[string]interface{})
 			return QR_CONTINUE
 		}
 	}
+	if qr.act == QR_THROTTLE && qr.throttler.allow() {
+		return QR_CONTINUE
+	}
 	return qr.act
 }
 
+// MarshalJSON encodes a QueryRule in the format accepted
+// by buildQueryRule.
+func (qr *QueryRule) MarshalJSON() ([]byte, error) {
+	ruleInfo := map[string]interface{}{
+		"Name":        qr.Name,
+		"Description": qr.Description,
+		"Action":      qr.act.String(),
+	}
+	if qr.requestIP != nil {
+		ruleInfo["RequestIP"] = unmakeExact(qr.requestIP)
+	}
+	if qr.user != nil {
+		ruleInfo["User"] = unmakeExact(qr.user)
+	}
+	if qr.query != nil {
+		ruleInfo["Query"] = unmakeExact(qr.query)
+	}
+	if qr.plans != nil {
+		plans := make([]string, 0, len(qr.plans))
+		for _, p := range qr.plans {
+			plans = append(plans, p.String())
+		}
+		ruleInfo["Plans"] = plans
+	}
+	if qr.tableNames != nil {
+		ruleInfo["TableNames"] = qr.tableNames
+	}
+	if qr.bindVarConds != nil {
+		ruleInfo["BindVarConds"] = qr.bindVarConds
+	}
+	if qr.act == QR_THROTTLE {
+		ruleInfo["MaxQPS"] = qr.maxQPS
+	}
+	return json.Marshal(ruleInfo)
+}
+
 func reMatch(re *regexp.Regexp, val string) bool {
 	return re == nil || re.MatchString(val)
 }
@@ -361,8 +447,20 @@ const (
 	QR_CONTINUE = Action(iota)
 	QR_FAIL
 	QR_FAIL_RETRY
+	QR_THROTTLE
 )
 
+var actionName = map[Action]string{
+	QR_CONTINUE:   "CONTINUE",
+	QR_FAIL:       "FAIL",
+	QR_FAIL_RETRY: "FAIL_RETRY",
+	QR_THROTTLE:   "THROTTLE",
+}
+
+func (act Action) String() string {
+	return actionName[act]
+}
+
 // BindVarCond represents a bind var condition.
 type BindVarCond struct {
 	name       string
@@ -372,6 +470,42 @@ type BindVarCond struct {
 	value      bvcValue
 }
 
+// MarshalJSON encodes a BindVarCond in the format accepted
+// by buildBindVarCondition.
+func (bvc BindVarCond) MarshalJSON() ([]byte, error) {
+	condInfo := map[string]interface{}{
+		"Name":     bvc.name,
+		"OnAbsent": bvc.onAbsent,
+	}
+	if bvc.op == QR_NOOP {
+		condInfo["Operator"] = "NOOP"
+		return json.Marshal(condInfo)
+	}
+	condInfo["OnMismatch"] = bvc.onMismatch
+	opname := opnames[bvc.op]
+	switch v := bvc.value.(type) {
+	case bvcuint64:
+		condInfo["Operator"] = "U" + opname
+		condInfo["Value"] = strconv.FormatUint(uint64(v), 10)
+	case bvcint64:
+		condInfo["Operator"] = "I" + opname
+		condInfo["Value"] = strconv.FormatInt(int64(v), 10)
+	case bvcstring:
+		condInfo["Operator"] = "S" + opname
+		condInfo["Value"] = string(v)
+	case bvcre:
+		condInfo["Operator"] = opname
+		condInfo["Value"] = unmakeExact(v.re)
+	case bvcKeyRange:
+		condInfo["Operator"] = opname
+		condInfo["Value"] = map[string]string{
+			"Start": string(v.Start),
+			"End":   string(v.End),
+		}
+	}
+	return json.Marshal(condInfo)
+}
+
 // Operator represents the list of operators.
 type Operator int
 
@@ -415,6 +549,65 @@ var opmap = map[string]Operator{
 	"NOTIN":   QR_NOTIN,
 }
 
+// opnames are the names of the operators, without
+// the type prefix of the comparison operators.
+var opnames = map[Operator]string{
+	QR_NOOP:    "NOOP",
+	QR_EQ:      "EQ",
+	QR_NE:      "NE",
+	QR_LT:      "LT",
+	QR_GE:      "GE",
+	QR_GT:      "GT",
+	QR_LE:      "LE",
+	QR_MATCH:   "MATCH",
+	QR_NOMATCH: "NOMATCH",
+	QR_IN:      "IN",
+	QR_NOTIN:   "NOTIN",
+}
+
+// ruleThrottler lets through at most maxQPS queries per second,
+// with bursts of up to one second worth of queries.
+type ruleThrottler struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is the time at which the next query is due
+	// if the queries came at exactly maxQPS.
+	next time.Time
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func newRuleThrottler(maxQPS int64) *ruleThrottler {
+	if maxQPS <= 0 {
+		return nil
+	}
+	return &ruleThrottler{
+		interval: time.Second / time.Duration(maxQPS),
+		now:      time.Now,
+	}
+}
+
+// allow returns true if one more query can go through.
+// A nil ruleThrottler allows nothing.
+func (rt *ruleThrottler) allow() bool {
+	if rt == nil {
+		return false
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	now := rt.now()
+	if rt.next.Before(now) {
+		rt.next = now
+	}
+	if rt.next.Sub(now) >= time.Second {
+		return false
+	}
+	rt.next = rt.next.Add(rt.interval)
+	return true
+}
+
 const (
 	QR_OK = iota
 	QR_MISMATCH
@@ -694,6 +887,12 @@ func buildQueryRule(ruleInfo map[string]interface{}) (qr *QueryRule, err error)
 			if !ok {
 				return nil, NewTabletError(FAIL, "want string for %s", k)
 			}
+		case "MaxQPS":
+			fv, ok := v.(float64)
+			if !ok || fv != float64(int64(fv)) || fv <= 0 {
+				return nil, NewTabletError(FAIL, "want positive integer for %s", k)
+			}
+			qr.SetMaxQPS(int64(fv))
 		case "Plans", "BindVarConds", "TableNames":
 			lv, ok = v.([]interface{})
 			if !ok {
@@ -760,11 +959,16 @@ func buildQueryRule(ruleInfo map[string]interface{}) (qr *QueryRule, err error)
 				qr.act = QR_FAIL
 			case "FAIL_RETRY":
 				qr.act = QR_FAIL_RETRY
+			case "THROTTLE":
+				qr.act = QR_THROTTLE
 			default:
 				return nil, NewTabletError(FAIL, "invalid Action %s", sv)
 			}
 		}
 	}
+	if qr.act == QR_THROTTLE && qr.maxQPS == 0 {
+		return nil, NewTabletError(FAIL, "MaxQPS missing for THROTTLE rule %s", qr.Name)
+	}
 	return qr, nil
 }
 
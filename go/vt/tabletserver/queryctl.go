@@ -23,18 +23,28 @@ import (
 )
 
 var (
-	queryLogHandler = flag.String("query-log-stream-handler", "/debug/querylog", "URL handler for streaming queries log")
-	txLogHandler    = flag.String("transaction-log-stream-handler", "/debug/txlog", "URL handler for streaming transactions log")
-	customRules     = flag.String("customrules", "", "custom query rules file")
+	queryLogHandler        = flag.String("query-log-stream-handler", "/debug/querylog", "URL handler for streaming queries log")
+	slowQueryLogHandler    = flag.String("slow-query-log-stream-handler", "/debug/querylog/slow", "URL handler for streaming the log of the queries slower than a threshold")
+	txLogHandler           = flag.String("transaction-log-stream-handler", "/debug/txlog", "URL handler for streaming transactions log")
+	invalidationLogHandler = flag.String("invalidation-log-stream-handler", "/debug/invalidationlog", "URL handler for streaming the rowcache invalidations of the dry-run mode")
+	customRules            = flag.String("customrules", "", "custom query rules file")
 )
 
 func init() {
 	flag.IntVar(&qsConfig.PoolSize, "queryserver-config-pool-size", DefaultQsConfig.PoolSize, "query server pool size")
 	flag.IntVar(&qsConfig.StreamPoolSize, "queryserver-config-stream-pool-size", DefaultQsConfig.StreamPoolSize, "query server stream pool size")
 	flag.IntVar(&qsConfig.TransactionCap, "queryserver-config-transaction-cap", DefaultQsConfig.TransactionCap, "query server transaction cap")
+	flag.IntVar(&qsConfig.MaxPoolSize, "queryserver-config-max-pool-size", DefaultQsConfig.MaxPoolSize, "query server max pool size, the size up to which the pool can be grown at runtime, 0 means the pool size")
+	flag.IntVar(&qsConfig.MaxStreamPoolSize, "queryserver-config-max-stream-pool-size", DefaultQsConfig.MaxStreamPoolSize, "query server max stream pool size, the size up to which the stream pool can be grown at runtime, 0 means the stream pool size")
+	flag.IntVar(&qsConfig.MaxTransactionCap, "queryserver-config-max-transaction-cap", DefaultQsConfig.MaxTransactionCap, "query server max transaction cap, the cap up to which the transaction pool can be grown at runtime, 0 means the transaction cap")
 	flag.Float64Var(&qsConfig.TransactionTimeout, "queryserver-config-transaction-timeout", DefaultQsConfig.TransactionTimeout, "query server transaction timeout")
 	flag.IntVar(&qsConfig.MaxResultSize, "queryserver-config-max-result-size", DefaultQsConfig.MaxResultSize, "query server max result size")
+	flag.IntVar(&qsConfig.MaxResultBytes, "queryserver-config-max-result-bytes", DefaultQsConfig.MaxResultBytes, "query server max result bytes, the maximum size of the values returned by a query, 0 means no limit")
 	flag.IntVar(&qsConfig.StreamBufferSize, "queryserver-config-stream-buffer-size", DefaultQsConfig.StreamBufferSize, "query server stream buffer size")
+	flag.IntVar(&qsConfig.StreamBufferRows, "queryserver-config-stream-buffer-rows", DefaultQsConfig.StreamBufferRows, "query server stream buffer rows, the maximum number of rows per streamed packet, 0 means no limit")
+	flag.IntVar(&qsConfig.BatchPoolSize, "queryserver-config-batch-pool-size", DefaultQsConfig.BatchPoolSize, "query server batch pool size, the pool used by the selects that request it for long analytics scans")
+	flag.IntVar(&qsConfig.BatchMaxResultSize, "queryserver-config-batch-max-result-size", DefaultQsConfig.BatchMaxResultSize, "query server max result size of the queries of the batch pool")
+	flag.Float64Var(&qsConfig.BatchQueryTimeout, "queryserver-config-batch-query-timeout", DefaultQsConfig.BatchQueryTimeout, "query server query timeout of the queries of the batch pool, 0 means the regular query timeout")
 	flag.IntVar(&qsConfig.QueryCacheSize, "queryserver-config-query-cache-size", DefaultQsConfig.QueryCacheSize, "query server query cache size")
 	flag.Float64Var(&qsConfig.SchemaReloadTime, "queryserver-config-schema-reload-time", DefaultQsConfig.SchemaReloadTime, "query server schema reload time")
 	flag.Float64Var(&qsConfig.QueryTimeout, "queryserver-config-query-timeout", DefaultQsConfig.QueryTimeout, "query server query timeout")
@@ -42,6 +52,35 @@ func init() {
 	flag.Float64Var(&qsConfig.SpotCheckRatio, "queryserver-config-spot-check-ratio", DefaultQsConfig.SpotCheckRatio, "query server rowcache spot check frequency")
 	flag.BoolVar(&qsConfig.StrictMode, "queryserver-config-strict-mode", DefaultQsConfig.StrictMode, "allow only predictable DMLs and enforces MySQL's STRICT_TRANS_TABLES")
 	flag.BoolVar(&qsConfig.StrictTableAcl, "queryserver-config-strict-table-acl", DefaultQsConfig.StrictTableAcl, "only allow queries that pass table acl checks")
+	flag.IntVar(&qsConfig.InvalidatorConcurrency, "queryserver-config-invalidator-concurrency", DefaultQsConfig.InvalidatorConcurrency, "number of rowcache invalidation workers, events are distributed to workers by table")
+	flag.IntVar(&qsConfig.RowcacheMaxLag, "queryserver-config-rowcache-max-lag", DefaultQsConfig.RowcacheMaxLag, "invalidator lag in seconds above which reads bypass the rowcache, 0 disables")
+	flag.BoolVar(&qsConfig.RowcacheOptIn, "queryserver-config-rowcache-opt-in", DefaultQsConfig.RowcacheOptIn, "cache only the tables that have a cache entry in the schema override")
+	flag.BoolVar(&qsConfig.RowcacheChecksum, "queryserver-config-rowcache-checksum", DefaultQsConfig.RowcacheChecksum, "store a CRC32 with every rowcache entry, and treat entries that fail it as misses")
+	flag.IntVar(&qsConfig.InvalidatorMaxRate, "queryserver-config-invalidator-max-rate", DefaultQsConfig.InvalidatorMaxRate, "maximum number of rowcache keys deleted per second by the invalidator, 0 means unlimited")
+	flag.IntVar(&qsConfig.InvalidatorMaxBacklog, "queryserver-config-invalidator-max-backlog", DefaultQsConfig.InvalidatorMaxBacklog, "number of rate limited invalidation keys above which the invalidator flushes the rowcache of the table instead, 0 means unlimited")
+	flag.StringVar(&qsConfig.InvalidatorStreamAddr, "queryserver-config-invalidator-stream-addr", DefaultQsConfig.InvalidatorStreamAddr, "address of a vttablet, usually the master, whose update stream the rowcache invalidator reads instead of the local binlogs")
+	flag.IntVar(&qsConfig.MaxPreparedStatements, "queryserver-config-max-prepared-statements", DefaultQsConfig.MaxPreparedStatements, "query server max prepared statements, the maximum number of statements prepared and not closed by the clients")
+	flag.BoolVar(&qsConfig.TwoPCEnable, "queryserver-config-twopc-enable", DefaultQsConfig.TwoPCEnable, "make the tablet a participant of two-phase commits, with a redo log in the _vt database")
+	flag.IntVar(&qsConfig.CallerMaxConcurrency, "queryserver-config-caller-max-concurrency", DefaultQsConfig.CallerMaxConcurrency, "maximum number of queries each effective caller can run at the same time, 0 means no limit")
+	flag.IntVar(&qsConfig.CallerMaxQPS, "queryserver-config-caller-max-qps", DefaultQsConfig.CallerMaxQPS, "maximum number of queries each effective caller can start per second, 0 means no limit")
+	flag.Float64Var(&qsConfig.ShutdownGracePeriod, "queryserver-config-shutdown-grace-period", DefaultQsConfig.ShutdownGracePeriod, "how long the query service waits for the transactions and queries to finish when it stops serving, before killing them, 0 means forever")
+	flag.IntVar(&qsConfig.DMLChunkSize, "queryserver-config-dml-chunk-size", DefaultQsConfig.DMLChunkSize, "number of rows per transaction of the DMLs without a pk where clause sent outside of a transaction, which are executed by chunks of rows in pk order, 0 disallows them")
+	flag.Float64Var(&qsConfig.DMLChunkPause, "queryserver-config-dml-chunk-pause", DefaultQsConfig.DMLChunkPause, "pause in seconds between the chunks of the DMLs executed outside of a transaction")
+	flag.IntVar(&qsConfig.MaxDeadlockRetries, "queryserver-config-max-deadlock-retries", DefaultQsConfig.MaxDeadlockRetries, "number of times the chunks of the DMLs sent outside of a transaction are retried when they fail with a deadlock, 0 disables the retries")
+	flag.IntVar(&qsConfig.MaxLockWaitRetries, "queryserver-config-max-lock-wait-retries", DefaultQsConfig.MaxLockWaitRetries, "number of times the chunks of the DMLs sent outside of a transaction are retried when they fail with a lock wait timeout, 0 disables the retries")
+	flag.IntVar(&qsConfig.MaxLockRows, "queryserver-config-max-lock-rows", DefaultQsConfig.MaxLockRows, "maximum number of rows of the selects that lock rows in a transaction, FOR UPDATE or LOCK IN SHARE MODE, 0 means only the max result size applies")
+	flag.IntVar(&qsConfig.ReservedPoolSize, "queryserver-config-reserved-pool-size", DefaultQsConfig.ReservedPoolSize, "query server reserved pool size, the maximum number of connections reserved for the session state of the clients")
+	flag.Float64Var(&qsConfig.ReservedIdleTimeout, "queryserver-config-reserved-idle-timeout", DefaultQsConfig.ReservedIdleTimeout, "time in seconds after which the idle reserved connections are reclaimed, and their session state lost")
+	flag.Float64Var(&qsConfig.HealthCheckInterval, "queryserver-config-health-check-interval", DefaultQsConfig.HealthCheckInterval, "interval in seconds between the health checks of the tablet, served on /healthz and streamed by StreamHealth")
+	flag.IntVar(&qsConfig.HealthMaxLag, "queryserver-config-health-max-lag", DefaultQsConfig.HealthMaxLag, "replication lag in seconds above which a slave is not healthy, 0 means no limit")
+	flag.Float64Var(&qsConfig.ThrottlerCheckInterval, "queryserver-config-throttler-check-interval", DefaultQsConfig.ThrottlerCheckInterval, "interval in seconds between the checks of the load of MySQL by the throttler")
+	flag.IntVar(&qsConfig.ThrottlerMaxThreadsRunning, "queryserver-config-throttler-max-threads-running", DefaultQsConfig.ThrottlerMaxThreadsRunning, "number of running MySQL threads above which the low priority queries are throttled, and above twice which the normal priority ones are, 0 disables the signal")
+	flag.IntVar(&qsConfig.ThrottlerMaxHistoryLength, "queryserver-config-throttler-max-history-length", DefaultQsConfig.ThrottlerMaxHistoryLength, "InnoDB history list length above which queries are throttled, 0 disables the signal")
+	flag.IntVar(&qsConfig.ThrottlerMaxLag, "queryserver-config-throttler-max-lag", DefaultQsConfig.ThrottlerMaxLag, "replication lag in seconds above which queries are throttled, 0 disables the signal")
+	flag.Float64Var(&qsConfig.ThrottlerMaxWait, "queryserver-config-throttler-max-wait", DefaultQsConfig.ThrottlerMaxWait, "how long in seconds the throttled low priority queries wait for the load of MySQL to drop before failing")
+	flag.StringVar(&qsConfig.ThrottlerLowPriorityCallers, "queryserver-config-throttler-low-priority-callers", DefaultQsConfig.ThrottlerLowPriorityCallers, "comma-separated list of the effective callers whose queries are low priority, their PRIORITY directives can't raise it")
+	flag.IntVar(&qsConfig.HotRowQueueSize, "queryserver-config-hot-row-queue-size", DefaultQsConfig.HotRowQueueSize, "number of transactions that can wait to update the same row, transactions beyond that fail. Transactions updating the same row are serialized only if this is positive")
+	flag.BoolVar(&qsConfig.InvalidatorDryRun, "queryserver-config-invalidator-dry-run", DefaultQsConfig.InvalidatorDryRun, "log rowcache invalidations to the invalidation log stream instead of applying them")
 	flag.StringVar(&qsConfig.RowCache.Binary, "rowcache-bin", DefaultQsConfig.RowCache.Binary, "rowcache binary file")
 	flag.IntVar(&qsConfig.RowCache.Memory, "rowcache-memory", DefaultQsConfig.RowCache.Memory, "rowcache max memory usage in MB")
 	flag.StringVar(&qsConfig.RowCache.Socket, "rowcache-socket", DefaultQsConfig.RowCache.Socket, "rowcache socket path to listen on")
@@ -90,20 +129,58 @@ func (c *RowCacheConfig) GetSubprocessFlags() []string {
 }
 
 type Config struct {
-	PoolSize           int
-	StreamPoolSize     int
-	TransactionCap     int
-	TransactionTimeout float64
-	MaxResultSize      int
-	StreamBufferSize   int
-	QueryCacheSize     int
-	SchemaReloadTime   float64
-	QueryTimeout       float64
-	IdleTimeout        float64
-	RowCache           RowCacheConfig
-	SpotCheckRatio     float64
-	StrictMode         bool
-	StrictTableAcl     bool
+	PoolSize               int
+	StreamPoolSize         int
+	TransactionCap         int
+	MaxPoolSize            int
+	MaxStreamPoolSize      int
+	MaxTransactionCap      int
+	TransactionTimeout     float64
+	MaxResultSize          int
+	MaxResultBytes         int
+	StreamBufferSize       int
+	StreamBufferRows       int
+	QueryCacheSize         int
+	SchemaReloadTime       float64
+	QueryTimeout           float64
+	IdleTimeout            float64
+	RowCache               RowCacheConfig
+	SpotCheckRatio         float64
+	StrictMode             bool
+	StrictTableAcl         bool
+	InvalidatorConcurrency int
+	InvalidatorDryRun      bool
+	RowcacheMaxLag         int
+	RowcacheOptIn          bool
+	InvalidatorStreamAddr  string
+	RowcacheChecksum       bool
+	InvalidatorMaxRate     int
+	InvalidatorMaxBacklog  int
+	HotRowQueueSize        int
+	BatchPoolSize          int
+	BatchMaxResultSize     int
+	BatchQueryTimeout      float64
+	MaxPreparedStatements  int
+	TwoPCEnable            bool
+	CallerMaxConcurrency   int
+	CallerMaxQPS           int
+	ShutdownGracePeriod    float64
+	DMLChunkSize           int
+	DMLChunkPause          float64
+	MaxLockRows            int
+	MaxDeadlockRetries     int
+	MaxLockWaitRetries     int
+	ReservedPoolSize       int
+	ReservedIdleTimeout    float64
+	HealthCheckInterval    float64
+	HealthMaxLag           int
+
+	ThrottlerCheckInterval      float64
+	ThrottlerMaxThreadsRunning  int
+	ThrottlerMaxHistoryLength   int
+	ThrottlerMaxLag             int
+	ThrottlerMaxWait            float64
+	ThrottlerLowPriorityCallers string
 }
 
 // DefaultQSConfig is the default value for the query service config.
@@ -115,20 +192,58 @@ type Config struct {
 // great (the overhead makes the final packets on the wire about twice
 // bigger than this).
 var DefaultQsConfig = Config{
-	PoolSize:           16,
-	StreamPoolSize:     750,
-	TransactionCap:     20,
-	TransactionTimeout: 30,
-	MaxResultSize:      10000,
-	QueryCacheSize:     5000,
-	SchemaReloadTime:   30 * 60,
-	QueryTimeout:       0,
-	IdleTimeout:        30 * 60,
-	StreamBufferSize:   32 * 1024,
-	RowCache:           RowCacheConfig{Memory: -1, TcpPort: -1, Connections: -1, Threads: -1},
-	SpotCheckRatio:     0,
-	StrictMode:         true,
-	StrictTableAcl:     false,
+	PoolSize:               16,
+	StreamPoolSize:         750,
+	TransactionCap:         20,
+	MaxPoolSize:            0,
+	MaxStreamPoolSize:      0,
+	MaxTransactionCap:      0,
+	TransactionTimeout:     30,
+	MaxResultSize:          10000,
+	MaxResultBytes:         64 * 1024 * 1024,
+	QueryCacheSize:         5000,
+	SchemaReloadTime:       30 * 60,
+	QueryTimeout:           0,
+	IdleTimeout:            30 * 60,
+	StreamBufferSize:       32 * 1024,
+	StreamBufferRows:       0,
+	RowCache:               RowCacheConfig{Memory: -1, TcpPort: -1, Connections: -1, Threads: -1},
+	SpotCheckRatio:         0,
+	StrictMode:             true,
+	StrictTableAcl:         false,
+	InvalidatorConcurrency: 1,
+	InvalidatorDryRun:      false,
+	RowcacheMaxLag:         0,
+	RowcacheOptIn:          false,
+	InvalidatorStreamAddr:  "",
+	RowcacheChecksum:       false,
+	InvalidatorMaxRate:     0,
+	InvalidatorMaxBacklog:  10000,
+	HotRowQueueSize:        0,
+	BatchPoolSize:          4,
+	BatchMaxResultSize:     1000000,
+	BatchQueryTimeout:      60 * 60,
+	MaxPreparedStatements:  10000,
+	TwoPCEnable:            false,
+	CallerMaxConcurrency:   0,
+	CallerMaxQPS:           0,
+	ShutdownGracePeriod:    0,
+	DMLChunkSize:           0,
+	DMLChunkPause:          0,
+	MaxLockRows:            0,
+	MaxDeadlockRetries:     3,
+	MaxLockWaitRetries:     0,
+	ReservedPoolSize:       10,
+	ReservedIdleTimeout:    10 * 60,
+	HealthCheckInterval:    5,
+	HealthMaxLag:           30,
+
+	ThrottlerCheckInterval:      1,
+	ThrottlerMaxThreadsRunning:  0,
+	ThrottlerMaxHistoryLength:   0,
+	ThrottlerMaxLag:             0,
+	ThrottlerMaxWait:            1,
+	ThrottlerLowPriorityCallers: "",
 }
 
 var qsConfig Config
@@ -151,6 +266,8 @@ func RegisterQueryService() {
 		f(SqlQueryRpcService)
 	}
 	http.HandleFunc("/debug/health", healthCheck)
+	http.Handle(healthzURL, SqlQueryRpcService.healthChecker)
+	SqlQueryRpcService.healthChecker.Open()
 }
 
 // AllowQueries can take an indefinite amount of time to return because
@@ -189,6 +306,12 @@ func GetQueryRules() (qrs *QueryRules) {
 	return SqlQueryRpcService.qe.schemaInfo.GetRules()
 }
 
+// SetDynamicQueryRules replaces the rules pushed by source. They take
+// effect immediately, and are kept when the query service restarts.
+func SetDynamicQueryRules(source string, qrs *QueryRules) {
+	SqlQueryRpcService.qe.schemaInfo.SetDynamicRules(source, qrs)
+}
+
 // IsHealthy returns nil if the query service is healthy (able to
 // connect to the database and serving traffic) or an error explaining
 // the unhealthiness otherwise.
@@ -230,7 +353,9 @@ func buildFmter(logger *streamlog.StreamLogger) func(url.Values, interface{}) st
 // necessary config files. It also starts any relevant streaming logs.
 func InitQueryService() {
 	SqlQueryLogger.ServeLogs(*queryLogHandler, buildFmter(SqlQueryLogger))
+	SqlQueryLogger.ServeLogs(*slowQueryLogHandler, slowQueryFmter(buildFmter(SqlQueryLogger)))
 	TxLogger.ServeLogs(*txLogHandler, buildFmter(TxLogger))
+	InvalidationLogger.ServeLogs(*invalidationLogHandler, buildFmter(InvalidationLogger))
 	RegisterQueryService()
 }
 
@@ -0,0 +1,192 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/pools"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+)
+
+// ReservedPool holds the connections reserved for the session state
+// of clients: the variables they SET stay on their own connection,
+// instead of leaking into the connections of the other clients.
+// Reserved connections are closed when they're released, so their
+// state is never reused, and reclaimed when they're idle for longer
+// than the idle timeout.
+type ReservedPool struct {
+	pool        *pools.Numbered
+	lastId      sync2.AtomicInt64
+	idleTimeout sync2.AtomicDuration
+	ticks       *timer.Timer
+	// endStats counts the reserved connections
+	// by how they ended.
+	endStats *stats.Counters
+}
+
+// NewReservedPool creates a new ReservedPool. If name is
+// empty, its stats are not exported.
+func NewReservedPool(name string, idleTimeout time.Duration) *ReservedPool {
+	rp := &ReservedPool{
+		pool:     pools.NewNumbered(),
+		lastId:   sync2.AtomicInt64(time.Now().UnixNano()),
+		ticks:    timer.NewTimer(idleTimeout / 10),
+		endStats: stats.NewCounters(""),
+	}
+	rp.idleTimeout.Set(idleTimeout)
+	if name != "" {
+		stats.Publish(name+"Size", stats.IntFunc(rp.pool.Size))
+		stats.Publish(name+"IdleTimeout", stats.DurationFunc(rp.idleTimeout.Get))
+		stats.Publish(name+"Ended", rp.endStats)
+	}
+	return rp
+}
+
+// Open starts the reclamation of the idle connections.
+func (rp *ReservedPool) Open() {
+	rp.ticks.Start(rp.ReclaimIdle)
+}
+
+// Close stops the reclamation, and closes the
+// reserved connections that are not in use.
+func (rp *ReservedPool) Close() {
+	rp.ticks.Stop()
+	for _, v := range rp.pool.GetOutdated(time.Duration(0), "for closing") {
+		rc := v.(*ReservedConnection)
+		log.Infof("closing reserved connection %d for shutdown", rc.ReservedID)
+		rc.discard("Shutdown")
+	}
+}
+
+// ReclaimIdle closes the reserved connections that
+// have been idle for longer than the idle timeout.
+func (rp *ReservedPool) ReclaimIdle() {
+	defer logError()
+	idleTimeout := rp.idleTimeout.Get()
+	if idleTimeout <= 0 {
+		return
+	}
+	for _, v := range rp.pool.GetIdle(idleTimeout, "for reclamation") {
+		rc := v.(*ReservedConnection)
+		log.Infof("reclaiming idle reserved connection %d of %s", rc.ReservedID, rc.caller())
+		rc.discard("Reclaimed")
+	}
+}
+
+// Reserve reserves conn for caller in session sessionID, and
+// returns its id.
+func (rp *ReservedPool) Reserve(conn dbconnpool.PoolConnection, sessionID int64, caller context.Context) int64 {
+	reservedID := rp.lastId.Add(1)
+	rc := &ReservedConnection{
+		PoolConnection: conn,
+		ReservedID:     reservedID,
+		SessionID:      sessionID,
+		Caller:         caller,
+		pool:           rp,
+		StartTime:      time.Now(),
+	}
+	rp.pool.Register(reservedID, rc)
+	return reservedID
+}
+
+// Get returns the reserved connection reservedID, locked for a
+// query. Only the caller that reserved it, in the same session,
+// can use it. You must call Recycle on it once done.
+func (rp *ReservedPool) Get(reservedID, sessionID int64, caller context.Context) *ReservedConnection {
+	return rp.get(reservedID, sessionID, caller, "for query")
+}
+
+// Release closes the reserved connection reservedID. Like Get, it
+// fails if caller and sessionID are not the ones it was reserved by.
+func (rp *ReservedPool) Release(reservedID, sessionID int64, caller context.Context) {
+	rp.get(reservedID, sessionID, caller, "for release").discard("Released")
+}
+
+func (rp *ReservedPool) get(reservedID, sessionID int64, caller context.Context, purpose string) *ReservedConnection {
+	v, err := rp.pool.Get(reservedID, purpose)
+	if err != nil {
+		panic(NewTabletError(FAIL, "Reserved connection %d: %v", reservedID, err))
+	}
+	rc := v.(*ReservedConnection)
+	if rc.SessionID != sessionID || !sameClient(rc.Caller, caller) {
+		rp.pool.Put(reservedID)
+		panic(NewTabletError(FAIL, "Reserved connection %d: not reserved by this client", reservedID))
+	}
+	return rc
+}
+
+// sameClient returns true if the contexts a and b are
+// the ones of the same user, on the same connection.
+func sameClient(a, b context.Context) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.GetUsername() == b.GetUsername() && a.GetRemoteAddr() == b.GetRemoteAddr()
+}
+
+// IdleTimeout returns the time after which idle
+// reserved connections are reclaimed.
+func (rp *ReservedPool) IdleTimeout() time.Duration {
+	return rp.idleTimeout.Get()
+}
+
+// SetIdleTimeout changes the idle timeout.
+func (rp *ReservedPool) SetIdleTimeout(idleTimeout time.Duration) {
+	rp.idleTimeout.Set(idleTimeout)
+	rp.ticks.SetInterval(idleTimeout / 10)
+}
+
+// Size returns the number of reserved connections.
+func (rp *ReservedPool) Size() int64 {
+	return rp.pool.Size()
+}
+
+// ReservedConnection is a connection reserved for the session
+// state of a client.
+type ReservedConnection struct {
+	dbconnpool.PoolConnection
+	ReservedID int64
+	// SessionID and Caller are the session and the
+	// context of the client that reserved the connection.
+	SessionID int64
+	Caller    context.Context
+	pool      *ReservedPool
+	StartTime time.Time
+}
+
+// Recycle makes the reserved connection available for the
+// next query of its client, unless the connection was closed.
+func (rc *ReservedConnection) Recycle() {
+	if rc.IsClosed() {
+		rc.discard("Closed")
+	} else {
+		rc.pool.pool.Put(rc.ReservedID)
+	}
+}
+
+// discard unreserves the connection, and closes it before putting
+// it back in its pool, so its session state doesn't leak.
+func (rc *ReservedConnection) discard(reason string) {
+	rc.pool.pool.Unregister(rc.ReservedID)
+	rc.pool.endStats.Add(reason, 1)
+	rc.PoolConnection.Close()
+	rc.PoolConnection.Recycle()
+	// Ensure PoolConnection won't be accessed after Recycle.
+	rc.PoolConnection = nil
+}
+
+// caller returns the caller of the reserved connection, for logging.
+func (rc *ReservedConnection) caller() string {
+	if rc.Caller == nil {
+		return ""
+	}
+	return rc.Caller.String()
+}
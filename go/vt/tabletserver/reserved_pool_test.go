@@ -0,0 +1,154 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"html/template"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+// fakeReservedConn is a PoolConnection that
+// records whether it was closed and recycled.
+type fakeReservedConn struct {
+	closed, recycled bool
+}
+
+func (fc *fakeReservedConn) ExecuteFetch(query string, maxrows int, wantfields bool) (*proto.QueryResult, error) {
+	return &proto.QueryResult{}, nil
+}
+
+func (fc *fakeReservedConn) ExecuteStreamFetch(query string, callback func(*proto.QueryResult) error, streamBufferSize, streamBufferRows int) error {
+	return nil
+}
+
+func (fc *fakeReservedConn) Id() int64      { return 1 }
+func (fc *fakeReservedConn) Close()         { fc.closed = true }
+func (fc *fakeReservedConn) IsClosed() bool { return fc.closed }
+func (fc *fakeReservedConn) Recycle()       { fc.recycled = true }
+
+// fakeContext is the context of a client.
+type fakeContext struct {
+	remoteAddr, username string
+}
+
+func (fc *fakeContext) GetRemoteAddr() string { return fc.remoteAddr }
+func (fc *fakeContext) GetUsername() string   { return fc.username }
+func (fc *fakeContext) HTML() template.HTML   { return template.HTML(fc.String()) }
+func (fc *fakeContext) String() string        { return fc.username + "@" + fc.remoteAddr }
+
+// reservedError returns the error of f, or nil.
+func reservedError(f func()) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = x.(*TabletError)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestReservedPool(t *testing.T) {
+	rp := NewReservedPool("", time.Hour)
+	fc := &fakeReservedConn{}
+	id := rp.Reserve(fc, 1, nil)
+	if rp.Size() != 1 {
+		t.Errorf("Size: %d, want 1", rp.Size())
+	}
+
+	rc := rp.Get(id, 1, nil)
+	if err := reservedError(func() { rp.Get(id, 1, nil) }); err == nil {
+		t.Errorf("Get of a reserved connection in use succeeded")
+	}
+	rc.Recycle()
+	if fc.recycled {
+		t.Errorf("connection went back to its pool before it was released")
+	}
+	rp.Get(id, 1, nil).Recycle()
+
+	rp.Release(id, 1, nil)
+	if !fc.closed || !fc.recycled {
+		t.Errorf("released connection: closed %v, recycled %v, want both", fc.closed, fc.recycled)
+	}
+	if err := reservedError(func() { rp.Get(id, 1, nil) }); err == nil {
+		t.Errorf("Get of a released connection succeeded")
+	}
+	if n := rp.endStats.Counts()["Released"]; n != 1 {
+		t.Errorf("Released: %d, want 1", n)
+	}
+
+	// A connection closed by a query is not reserved anymore.
+	fc = &fakeReservedConn{}
+	id = rp.Reserve(fc, 1, nil)
+	rc = rp.Get(id, 1, nil)
+	fc.Close()
+	rc.Recycle()
+	if rp.Size() != 0 || !fc.recycled {
+		t.Errorf("closed connection: size %d, recycled %v, want 0, true", rp.Size(), fc.recycled)
+	}
+}
+
+func TestReservedPoolOwner(t *testing.T) {
+	rp := NewReservedPool("", time.Hour)
+	fc := &fakeReservedConn{}
+	owner := &fakeContext{remoteAddr: "1.2.3.4:5", username: "a"}
+	id := rp.Reserve(fc, 1, owner)
+
+	others := []struct {
+		sessionID int64
+		caller    context.Context
+	}{
+		{2, owner},
+		{1, nil},
+		{1, &fakeContext{remoteAddr: "1.2.3.4:5", username: "b"}},
+		{1, &fakeContext{remoteAddr: "1.2.3.4:6", username: "a"}},
+	}
+	want := fmt.Sprintf("error: Reserved connection %d: not reserved by this client", id)
+	for _, other := range others {
+		if err := reservedError(func() { rp.Get(id, other.sessionID, other.caller) }); err == nil || err.Error() != want {
+			t.Errorf("Get(%d, %v): %v, want %v", other.sessionID, other.caller, err, want)
+		}
+		if err := reservedError(func() { rp.Release(id, other.sessionID, other.caller) }); err == nil || err.Error() != want {
+			t.Errorf("Release(%d, %v): %v, want %v", other.sessionID, other.caller, err, want)
+		}
+	}
+	if fc.closed {
+		t.Errorf("connection closed by another client")
+	}
+
+	rp.Get(id, 1, &fakeContext{remoteAddr: "1.2.3.4:5", username: "a"}).Recycle()
+	rp.Release(id, 1, owner)
+	if !fc.closed {
+		t.Errorf("connection not closed by its owner")
+	}
+}
+
+func TestReservedPoolReclaimIdle(t *testing.T) {
+	rp := NewReservedPool("", time.Hour)
+	idle := &fakeReservedConn{}
+	rp.Reserve(idle, 1, nil)
+	inUse := &fakeReservedConn{}
+	rc := rp.Get(rp.Reserve(inUse, 1, nil), 1, nil)
+
+	rp.SetIdleTimeout(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	rp.ReclaimIdle()
+	if !idle.closed || inUse.closed {
+		t.Errorf("reclaimed: idle %v, in use %v, want true, false", idle.closed, inUse.closed)
+	}
+	if n := rp.endStats.Counts()["Reclaimed"]; n != 1 {
+		t.Errorf("Reclaimed: %d, want 1", n)
+	}
+
+	rc.Recycle()
+	rp.Close()
+	if !inUse.closed || rp.Size() != 0 {
+		t.Errorf("after Close: closed %v, size %d, want true, 0", inUse.closed, rp.Size())
+	}
+}
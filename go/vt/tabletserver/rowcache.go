@@ -6,53 +6,110 @@ package tabletserver
 
 import (
 	"encoding/binary"
+	"hash/crc32"
 	"strconv"
+	"sync"
 	"time"
 
+	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/schema"
 )
 
 var cacheStats = stats.NewTimings("Rowcache")
 
+// cacheCorruptions counts the cached rows that failed their checksum.
+var cacheCorruptions = stats.NewInt("RowcacheCorruptions")
+
 var pack = binary.BigEndian
 
 const (
 	RC_DELETED = 1
 
+	// RC_CHECKSUM marks rows that are prefixed with the CRC32 of their encoding.
+	RC_CHECKSUM = 2
+
+	// RC_GTID marks rows that are prefixed with the GTID they were read at.
+	RC_GTID = 4
+
 	// MAX_KEY_LEN is a value less than memcache's limit of 250.
 	MAX_KEY_LEN = 200
 
-	// MAX_DATA_LEN prevents large rows from being inserted in rowcache.
+	// MAX_DATA_LEN is the default limit that prevents large rows
+	// from being inserted in rowcache.
 	MAX_DATA_LEN = 8000
 )
 
 type RowCache struct {
 	tableInfo *TableInfo
-	prefix    string
 	cachePool *CachePool
+	// ttl is the memcache expiry of the cached rows.
+	ttl uint64
+	// maxDataLen prevents rows larger than it from being cached.
+	maxDataLen int
+
+	// mu protects prefix and flushTime, which are changed by Flush.
+	mu        sync.Mutex
+	prefix    string
+	flushTime time.Time
 }
 
 type RCResult struct {
-	Row []sqltypes.Value
-	Cas uint64
+	Row  []sqltypes.Value
+	Cas  uint64
+	GTID myproto.GTID
 }
 
 func NewRowCache(tableInfo *TableInfo, cachePool *CachePool) *RowCache {
-	prefix := strconv.FormatInt(cachePool.maxPrefix.Add(1), 36) + "."
-	return &RowCache{tableInfo, prefix, cachePool}
+	return &RowCache{
+		tableInfo:  tableInfo,
+		prefix:     newPrefix(cachePool),
+		cachePool:  cachePool,
+		maxDataLen: MAX_DATA_LEN,
+	}
+}
+
+func newPrefix(cachePool *CachePool) string {
+	return strconv.FormatInt(cachePool.maxPrefix.Add(1), 36) + "."
+}
+
+// Flush invalidates all the rows of the cache by switching
+// to a new prefix. Like deleted rows, the cache doesn't accept new
+// rows for DeleteExpiry seconds, because they may have been read
+// from the db before the change that caused the flush.
+func (rc *RowCache) Flush() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.prefix = newPrefix(rc.cachePool)
+	rc.flushTime = time.Now()
+}
+
+func (rc *RowCache) getPrefix() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.prefix
+}
+
+// recentlyFlushed returns true if the cache was flushed
+// less than DeleteExpiry seconds ago.
+func (rc *RowCache) recentlyFlushed() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return time.Now().Sub(rc.flushTime) < time.Duration(rc.cachePool.DeleteExpiry)*time.Second
 }
 
 func (rc *RowCache) Get(keys []string) (results map[string]RCResult) {
+	prefix := rc.getPrefix()
 	mkeys := make([]string, 0, len(keys))
 	for _, key := range keys {
 		if len(key) > MAX_KEY_LEN {
 			continue
 		}
-		mkeys = append(mkeys, rc.prefix+key)
+		mkeys = append(mkeys, prefix+key)
 	}
-	prefixlen := len(rc.prefix)
+	prefixlen := len(prefix)
 	conn := rc.cachePool.Get()
 	defer conn.Recycle()
 
@@ -71,35 +128,66 @@ func (rc *RowCache) Get(keys []string) (results map[string]RCResult) {
 			results[mcresult.Key[prefixlen:]] = RCResult{Cas: mcresult.Cas}
 			continue
 		}
-		row := rc.decodeRow(mcresult.Value)
+		b := mcresult.Value
+		if mcresult.Flags&RC_CHECKSUM != 0 {
+			if b = verifyChecksum(b); b == nil {
+				// Treat the row as a miss. It will be refilled from the db.
+				cacheCorruptions.Add(1)
+				log.Warningf("Checksum mismatch for %s, deleting it", mcresult.Key)
+				if _, err := conn.Delete(mcresult.Key); err != nil {
+					conn.Close()
+					panic(NewTabletError(FATAL, "%s", err))
+				}
+				continue
+			}
+		}
+		var gtid myproto.GTID
+		if mcresult.Flags&RC_GTID != 0 {
+			if gtid, b = decodeGTID(b); b == nil {
+				panic(NewTabletError(FAIL, "Corrupt GTID for %s", mcresult.Key))
+			}
+		}
+		row := rc.decodeRow(b)
 		if row == nil {
 			panic(NewTabletError(FAIL, "Corrupt data for %s", mcresult.Key))
 		}
-		results[mcresult.Key[prefixlen:]] = RCResult{Row: row, Cas: mcresult.Cas}
+		results[mcresult.Key[prefixlen:]] = RCResult{Row: row, Cas: mcresult.Cas, GTID: gtid}
 	}
 	return
 }
 
-func (rc *RowCache) Set(key string, row []sqltypes.Value, cas uint64) {
-	if len(key) > MAX_KEY_LEN {
+// Set caches row under key. gtid, if not nil, is the invalidator
+// position from before row was read from the db. It's returned with
+// the row by Get.
+func (rc *RowCache) Set(key string, row []sqltypes.Value, cas uint64, gtid myproto.GTID) {
+	if len(key) > MAX_KEY_LEN || rc.recentlyFlushed() {
 		return
 	}
 	b := rc.encodeRow(row)
 	if b == nil {
 		return
 	}
+	var flags uint16
+	if gtid != nil {
+		b = encodeGTID(gtid, b)
+		flags |= RC_GTID
+	}
+	if rc.cachePool.Checksum {
+		b = addChecksum(b)
+		flags |= RC_CHECKSUM
+	}
 	conn := rc.cachePool.Get()
 	defer conn.Recycle()
-	mkey := rc.prefix + key
+	mkey := rc.getPrefix() + key
 
 	var err error
 	if cas == 0 {
 		// Either caller didn't find the value at all
 		// or they didn't look for it in the first place.
-		_, err = conn.Add(mkey, 0, 0, b)
+		_, err = conn.Add(mkey, flags, rc.ttl, b)
 	} else {
 		// Caller is trying to update a row that recently changed.
-		_, err = conn.Cas(mkey, 0, 0, b, cas)
+		_, err = conn.Cas(mkey, flags, rc.ttl, b, cas)
 	}
 	if err != nil {
 		conn.Close()
@@ -113,7 +201,7 @@ func (rc *RowCache) Delete(key string) {
 	}
 	conn := rc.cachePool.Get()
 	defer conn.Recycle()
-	mkey := rc.prefix + key
+	mkey := rc.getPrefix() + key
 
 	_, err := conn.Set(mkey, RC_DELETED, rc.cachePool.DeleteExpiry, nil)
 	if err != nil {
@@ -126,7 +214,7 @@ func (rc *RowCache) encodeRow(row []sqltypes.Value) (b []byte) {
 	length := 0
 	for _, v := range row {
 		length += len(v.Raw())
-		if length > MAX_DATA_LEN {
+		if length > rc.maxDataLen {
 			return nil
 		}
 	}
@@ -145,6 +233,54 @@ func (rc *RowCache) encodeRow(row []sqltypes.Value) (b []byte) {
 	return b
 }
 
+// addChecksum prefixes b with its CRC32.
+func addChecksum(b []byte) []byte {
+	cb := make([]byte, 4+len(b))
+	pack.PutUint32(cb, crc32.ChecksumIEEE(b))
+	copy(cb[4:], b)
+	return cb
+}
+
+// verifyChecksum returns the data of a value created by addChecksum,
+// or nil if the checksum doesn't match.
+func verifyChecksum(cb []byte) []byte {
+	if len(cb) < 8 {
+		return nil
+	}
+	b := cb[4:]
+	if pack.Uint32(cb) != crc32.ChecksumIEEE(b) {
+		return nil
+	}
+	return b
+}
+
+// encodeGTID prefixes b with the length and the encoding of gtid.
+func encodeGTID(gtid myproto.GTID, b []byte) []byte {
+	encoded := myproto.EncodeGTID(gtid)
+	gb := make([]byte, 2+len(encoded)+len(b))
+	pack.PutUint16(gb, uint16(len(encoded)))
+	copy(gb[2:], encoded)
+	copy(gb[2+len(encoded):], b)
+	return gb
+}
+
+// decodeGTID returns the GTID and the data of a value created
+// by encodeGTID. It returns a nil data if the value is corrupt.
+func decodeGTID(gb []byte) (myproto.GTID, []byte) {
+	if len(gb) < 2 {
+		return nil, nil
+	}
+	length := int(pack.Uint16(gb))
+	if len(gb) < 2+length {
+		return nil, nil
+	}
+	gtid, err := myproto.DecodeGTID(string(gb[2 : 2+length]))
+	if err != nil {
+		return nil, nil
+	}
+	return gtid, gb[2+length:]
+}
+
 func (rc *RowCache) decodeRow(b []byte) (row []sqltypes.Value) {
 	rowlen := pack.Uint32(b)
 	data := b[4+rowlen*4:]
@@ -6,12 +6,17 @@ package tabletserver
 
 import (
 	"fmt"
+	"hash/crc32"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/history"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/streamlog"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/tb"
 	"github.com/youtube/vitess/go/vt/binlog"
@@ -20,6 +25,15 @@ import (
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 )
 
+// InvalidationLogger receives an InvalidationRecord for every event
+// the RowcacheInvalidator would apply while it runs in dry-run mode.
+// Call InvalidationLogger.ServeLogs in your main program to enable logging.
+var InvalidationLogger = streamlog.New("Invalidation", 50)
+
+// invalidationFlushes counts, per table, the rowcache flushes
+// caused by an invalidation backlog.
+var invalidationFlushes = stats.NewCounters("RowcacheInvalidationFlushes")
+
 // RowcacheInvalidator runs the service to invalidate
 // the rowcache based on binlog events.
 type RowcacheInvalidator struct {
@@ -30,10 +44,41 @@ type RowcacheInvalidator struct {
 	mu         sync.Mutex
 	dbname     string
 	mysqld     *mysqlctl.Mysqld
-	evs        *binlog.EventStreamer
+	evs        binlog.EventSource
 	lagSeconds sync2.AtomicInt64
 	gtid       myproto.GTID
 	gtidMutex  sync.RWMutex
+
+	// concurrency is the number of invalidation workers.
+	concurrency int
+	workers     *invalidationWorkers
+
+	// dryRun makes the invalidator log what it would invalidate
+	// to InvalidationLogger instead of touching the rowcache.
+	dryRun bool
+
+	// streamAddr, if set, is the address of the update stream
+	// the invalidator reads from, instead of the local binlogs.
+	streamAddr string
+
+	// limiter, if set, limits the rate of deletes.
+	limiter *invalidationLimiter
+
+	// recentErrors keeps the last invalidation errors,
+	// as invalidationError records.
+	recentErrors *history.History
+}
+
+// invalidationErrorHistory is the number of
+// invalidation errors kept in recentErrors.
+const invalidationErrorHistory = 20
+
+// invalidationError describes an event that
+// the invalidator failed to process.
+type invalidationError struct {
+	Time  time.Time
+	Event string
+	Error string
 }
 
 func (rci *RowcacheInvalidator) GetGTID() myproto.GTID {
@@ -57,18 +102,59 @@ func (rci *RowcacheInvalidator) SetGTID(gtid myproto.GTID) {
 }
 
 // NewRowcacheInvalidator creates a new RowcacheInvalidator.
+// config.InvalidatorConcurrency is the number of workers that
+// process DML events in parallel. Events for a given table are
+// always processed by the same worker, in binlog order.
+// If config.InvalidatorDryRun is set, events are only sent to
+// InvalidationLogger.
+// If config.InvalidatorStreamAddr is set, events are read from the
+// update stream of that tablet, usually the master, rather than from
+// the local binlogs.
+// config.InvalidatorMaxRate limits the keys deleted per second. Tables
+// whose invalidations would exceed a backlog of config.InvalidatorMaxBacklog
+// keys are flushed instead.
 // Just like QueryEngine, this is a singleton class.
 // You must call this only once.
-func NewRowcacheInvalidator(qe *QueryEngine) *RowcacheInvalidator {
-	rci := &RowcacheInvalidator{qe: qe}
+func NewRowcacheInvalidator(qe *QueryEngine, config Config) *RowcacheInvalidator {
+	concurrency := config.InvalidatorConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	rci := &RowcacheInvalidator{
+		qe:           qe,
+		concurrency:  concurrency,
+		dryRun:       config.InvalidatorDryRun,
+		streamAddr:   config.InvalidatorStreamAddr,
+		limiter:      newInvalidationLimiter(int64(config.InvalidatorMaxRate), int64(config.InvalidatorMaxBacklog)),
+		recentErrors: history.New(invalidationErrorHistory),
+	}
 	stats.Publish("RowcacheInvalidatorState", stats.StringFunc(rci.svm.StateName))
 	stats.Publish("RowcacheInvalidatorPosition", stats.StringFunc(rci.GetGTIDString))
 	stats.Publish("RowcacheInvalidatorLagSeconds", stats.IntFunc(rci.lagSeconds.Get))
+	stats.Publish("RowcacheInvalidatorConcurrency", stats.IntFunc(func() int64 {
+		return int64(rci.concurrency)
+	}))
+	stats.Publish("RowcacheInvalidatorMaxRate", stats.IntFunc(func() int64 {
+		return int64(config.InvalidatorMaxRate)
+	}))
+	stats.Publish("RowcacheInvalidatorStreamAddr", stats.StringFunc(func() string {
+		return rci.streamAddr
+	}))
+	stats.Publish("RowcacheInvalidatorDryRun", stats.IntFunc(func() int64 {
+		if rci.dryRun {
+			return 1
+		}
+		return 0
+	}))
 	return rci
 }
 
 // Open runs the invalidation loop.
 func (rci *RowcacheInvalidator) Open(dbname string, mysqld *mysqlctl.Mysqld) {
+	if rci.streamAddr != "" {
+		rci.openRemote(dbname, mysqld)
+		return
+	}
 	rp, err := mysqld.MasterStatus()
 	if err != nil {
 		panic(NewTabletError(FATAL, "Rowcache invalidator aborting: cannot determine replication position: %v", err))
@@ -77,12 +163,38 @@ func (rci *RowcacheInvalidator) Open(dbname string, mysqld *mysqlctl.Mysqld) {
 		panic(NewTabletError(FATAL, "Rowcache invalidator aborting: binlog path not specified"))
 	}
 
-	ok := rci.svm.Go(func(_ *sync2.ServiceContext) error {
+	ok := rci.start(dbname, mysqld, binlog.NewEventStreamer(dbname, mysqld), rp.MasterLogGTIDField.Value)
+	if ok {
+		log.Infof("Rowcache invalidator starting, dbname: %s, path: %s, logfile: %s, position: %d, concurrency: %d, dry run: %v", dbname, mysqld.Cnf().BinLogPath, rp.MasterLogFile, rp.MasterLogPosition, rci.concurrency, rci.dryRun)
+	} else {
+		log.Infof("Rowcache invalidator already running")
+	}
+}
+
+// openRemote runs the invalidation loop on the update stream
+// at streamAddr. The stream starts at the position the local
+// mysql has replicated up to.
+func (rci *RowcacheInvalidator) openRemote(dbname string, mysqld *mysqlctl.Mysqld) {
+	rp, err := mysqld.SlaveStatus()
+	if err != nil {
+		panic(NewTabletError(FATAL, "Rowcache invalidator aborting: cannot determine replication position: %v", err))
+	}
+
+	ok := rci.start(dbname, mysqld, binlog.NewRemoteEventStreamer(rci.streamAddr, mysqld), rp.MasterLogGTIDField.Value)
+	if ok {
+		log.Infof("Rowcache invalidator starting, dbname: %s, update stream: %s, position: %v, concurrency: %d, dry run: %v", dbname, rci.streamAddr, rp.MasterLogGTIDField, rci.concurrency, rci.dryRun)
+	} else {
+		log.Infof("Rowcache invalidator already running")
+	}
+}
+
+func (rci *RowcacheInvalidator) start(dbname string, mysqld *mysqlctl.Mysqld, evs binlog.EventSource, gtid myproto.GTID) bool {
+	return rci.svm.Go(func(_ *sync2.ServiceContext) error {
 		rci.mu.Lock()
 		rci.dbname = dbname
 		rci.mysqld = mysqld
-		rci.evs = binlog.NewEventStreamer(dbname, mysqld)
-		rci.SetGTID(rp.MasterLogGTIDField.Value)
+		rci.evs = evs
+		rci.SetGTID(gtid)
 		rci.mu.Unlock()
 
 		rci.run()
@@ -92,11 +204,6 @@ func (rci *RowcacheInvalidator) Open(dbname string, mysqld *mysqlctl.Mysqld) {
 		rci.mu.Unlock()
 		return nil
 	})
-	if ok {
-		log.Infof("Rowcache invalidator starting, dbname: %s, path: %s, logfile: %s, position: %d", dbname, mysqld.Cnf().BinLogPath, rp.MasterLogFile, rp.MasterLogPosition)
-	} else {
-		log.Infof("Rowcache invalidator already running")
-	}
 }
 
 // Close terminates the invalidation loop. It returns only of the
@@ -128,8 +235,13 @@ func (rci *RowcacheInvalidator) run() {
 					inner = fmt.Errorf("%v: uncaught panic:\n%s", x, tb.Stack(4))
 				}
 			}()
+			// The workers are restarted on every retry. Stopping them
+			// waits for all dispatched events to be processed, which
+			// guarantees that GetGTID is a safe restart point.
+			rci.workers = newInvalidationWorkers(rci.concurrency, rci.processEvent)
+			defer rci.workers.stop()
 			return rci.evs.Stream(rci.GetGTID(), func(reply *blproto.StreamEvent) error {
-				rci.processEvent(reply)
+				rci.dispatchEvent(reply)
 				return nil
 			})
 		}()
@@ -138,39 +250,95 @@ func (rci *RowcacheInvalidator) run() {
 		}
 		log.Errorf("binlog.ServeUpdateStream returned err '%v', retrying in 1 second.", err.Error())
 		internalErrors.Add("Invalidation", 1)
+		rci.recordError(nil, err)
 		time.Sleep(1 * time.Second)
 	}
 	log.Infof("Rowcache invalidator stopped")
 }
 
-func handleInvalidationError(event *blproto.StreamEvent) {
+// dispatchEvent sends DML events to the worker responsible for
+// their table. POS events are broadcast to all workers, and are
+// applied only after every event that precedes them has been
+// processed. DDL and ERR events can affect any table. So, they're
+// processed inline after all outstanding events are drained.
+func (rci *RowcacheInvalidator) dispatchEvent(event *blproto.StreamEvent) {
+	switch event.Category {
+	case "DML":
+		rci.workers.dispatch(event)
+	case "POS":
+		rci.workers.broadcast(event)
+	default:
+		rci.workers.drain()
+		rci.processEvent(event)
+	}
+}
+
+func (rci *RowcacheInvalidator) handleInvalidationError(event *blproto.StreamEvent) {
 	if x := recover(); x != nil {
 		terr, ok := x.(*TabletError)
 		if !ok {
 			log.Errorf("Uncaught panic for %+v:\n%v\n%s", event, x, tb.Stack(4))
 			internalErrors.Add("Panic", 1)
+			rci.recordError(event, fmt.Errorf("uncaught panic: %v", x))
 			return
 		}
 		log.Errorf("%v: %+v", terr, event)
 		internalErrors.Add("Invalidation", 1)
+		rci.recordError(event, terr)
+	}
+}
+
+// recordError adds err to the recent errors. event can be nil
+// if the error is not specific to an event.
+func (rci *RowcacheInvalidator) recordError(event *blproto.StreamEvent, err error) {
+	if rci.recentErrors == nil {
+		return
+	}
+	ie := invalidationError{Time: time.Now(), Error: err.Error()}
+	if event != nil {
+		ie.Event = fmt.Sprintf("%+v", *event)
+	}
+	rci.recentErrors.Add(ie)
+}
+
+// getRecentErrors returns the last invalidation errors,
+// most recent first.
+func (rci *RowcacheInvalidator) getRecentErrors() []invalidationError {
+	if rci.recentErrors == nil {
+		return nil
 	}
+	records := rci.recentErrors.Records()
+	errs := make([]invalidationError, len(records))
+	for i, r := range records {
+		errs[i] = r.(invalidationError)
+	}
+	return errs
 }
 
 func (rci *RowcacheInvalidator) processEvent(event *blproto.StreamEvent) {
-	defer handleInvalidationError(event)
+	defer rci.handleInvalidationError(event)
 	switch event.Category {
 	case "DDL":
+		if rci.dryRun {
+			rci.logInvalidation(event, nil)
+			break
+		}
 		log.Infof("DDL invalidation: %s", event.Sql)
 		rci.qe.InvalidateForDDL(event.Sql)
 	case "DML":
 		rci.handleDmlEvent(event)
 	case "ERR":
+		if rci.dryRun {
+			rci.logInvalidation(event, nil)
+			break
+		}
 		rci.qe.InvalidateForUnrecognized(event.Sql)
 	case "POS":
 		rci.SetGTID(event.GTIDField.Value)
 	default:
 		log.Errorf("unknown event: %#v", event)
 		internalErrors.Add("Invalidation", 1)
+		rci.recordError(event, fmt.Errorf("unknown event category %q", event.Category))
 		return
 	}
 	rci.lagSeconds.Set(time.Now().Unix() - event.Timestamp)
@@ -187,6 +355,7 @@ func (rci *RowcacheInvalidator) handleDmlEvent(event *blproto.StreamEvent) {
 			if err != nil {
 				log.Errorf("Error building invalidation key for %#v: '%v'", event, err)
 				internalErrors.Add("Invalidation", 1)
+				rci.recordError(event, err)
 				return
 			}
 			sqlTypeKeys = append(sqlTypeKeys, key)
@@ -196,5 +365,158 @@ func (rci *RowcacheInvalidator) handleDmlEvent(event *blproto.StreamEvent) {
 			keys = append(keys, invalidateKey)
 		}
 	}
+	if rci.dryRun {
+		rci.logInvalidation(event, keys)
+		return
+	}
+	if rci.limiter != nil && !rci.limiter.wait(len(keys)) {
+		log.Infof("Invalidation backlog exceeded, flushing the rowcache of %s", table)
+		invalidationFlushes.Add(table, 1)
+		rci.qe.FlushTableCache(table)
+		return
+	}
 	rci.qe.InvalidateForDml(table, keys)
 }
+
+// logInvalidation sends what would be invalidated for event
+// to InvalidationLogger.
+func (rci *RowcacheInvalidator) logInvalidation(event *blproto.StreamEvent, keys []string) {
+	InvalidationLogger.Send(&InvalidationRecord{
+		Time:      time.Now(),
+		Category:  event.Category,
+		TableName: event.TableName,
+		PKValues:  event.PKValues,
+		Keys:      keys,
+		Sql:       event.Sql,
+		GTID:      rci.GetGTIDString(),
+	})
+}
+
+// InvalidationRecord describes an event that the RowcacheInvalidator
+// would have applied to the rowcache in dry-run mode.
+type InvalidationRecord struct {
+	Time     time.Time
+	Category string
+
+	// DML
+	TableName string
+	PKValues  [][]interface{}
+	Keys      []string
+
+	// DDL or ERR
+	Sql string
+
+	// GTID is the position of the last transaction that
+	// completed before the event.
+	GTID string
+}
+
+// Format returns a tab separated list of the logged fields.
+func (ir *InvalidationRecord) Format(params url.Values) string {
+	return fmt.Sprintf(
+		"%v\t%v\t%v\t%v\t%v\t%v\t%q\t\n",
+		ir.Time.Format(time.StampMicro),
+		ir.GTID,
+		ir.Category,
+		ir.TableName,
+		ir.PKValues,
+		strings.Join(ir.Keys, ","),
+		ir.Sql,
+	)
+}
+
+// invalidationQueueSize is the number of events that can be
+// queued up for each invalidation worker.
+const invalidationQueueSize = 1000
+
+// invalidationWorkers is a pool of goroutines that process
+// invalidation events in parallel. Events are assigned to
+// workers by hashing their table name, which preserves the
+// per-table ordering of the binlog.
+type invalidationWorkers struct {
+	queues  []chan invalidationItem
+	wg      sync.WaitGroup
+	process func(*blproto.StreamEvent)
+}
+
+// invalidationItem is either an event to process for one table,
+// or a marker that must be seen by all workers.
+type invalidationItem struct {
+	event  *blproto.StreamEvent
+	marker *invalidationMarker
+}
+
+// invalidationMarker is sent to every worker. The last worker to
+// reach it processes its event (if any) and closes done. Since each
+// worker processes its queue in order, all events dispatched before
+// the marker are processed by then.
+type invalidationMarker struct {
+	event   *blproto.StreamEvent
+	pending sync2.AtomicInt64
+	done    chan struct{}
+}
+
+func newInvalidationWorkers(concurrency int, process func(*blproto.StreamEvent)) *invalidationWorkers {
+	iw := &invalidationWorkers{
+		queues:  make([]chan invalidationItem, concurrency),
+		process: process,
+	}
+	for i := range iw.queues {
+		iw.queues[i] = make(chan invalidationItem, invalidationQueueSize)
+		iw.wg.Add(1)
+		go iw.run(iw.queues[i])
+	}
+	return iw
+}
+
+func (iw *invalidationWorkers) run(queue chan invalidationItem) {
+	defer iw.wg.Done()
+	for item := range queue {
+		if item.marker == nil {
+			iw.process(item.event)
+			continue
+		}
+		if item.marker.pending.Add(-1) != 0 {
+			continue
+		}
+		if item.marker.event != nil {
+			iw.process(item.marker.event)
+		}
+		close(item.marker.done)
+	}
+}
+
+// dispatch queues the event to the worker that owns its table.
+func (iw *invalidationWorkers) dispatch(event *blproto.StreamEvent) {
+	i := crc32.ChecksumIEEE([]byte(event.TableName)) % uint32(len(iw.queues))
+	iw.queues[i] <- invalidationItem{event: event}
+}
+
+// broadcast queues a marker for the event to all workers. The event
+// is processed once all previously dispatched events are done.
+// broadcast returns the marker's done channel.
+func (iw *invalidationWorkers) broadcast(event *blproto.StreamEvent) <-chan struct{} {
+	marker := &invalidationMarker{
+		event: event,
+		done:  make(chan struct{}),
+	}
+	marker.pending.Set(int64(len(iw.queues)))
+	for _, queue := range iw.queues {
+		queue <- invalidationItem{marker: marker}
+	}
+	return marker.done
+}
+
+// drain waits for all dispatched events to be processed.
+func (iw *invalidationWorkers) drain() {
+	<-iw.broadcast(nil)
+}
+
+// stop waits for all dispatched events to be processed and
+// terminates the workers.
+func (iw *invalidationWorkers) stop() {
+	for _, queue := range iw.queues {
+		close(queue)
+	}
+	iw.wg.Wait()
+}
@@ -0,0 +1,106 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestInvalidationWorkersOrder(t *testing.T) {
+	var mu sync.Mutex
+	processed := make(map[string][]int64)
+	var positions []int64
+	iw := newInvalidationWorkers(4, func(event *blproto.StreamEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch event.Category {
+		case "DML":
+			processed[event.TableName] = append(processed[event.TableName], event.Timestamp)
+		case "POS":
+			// All DMLs that precede the position must be done.
+			// DMLs that follow it may also be done.
+			count := 0
+			for _, ts := range processed {
+				count += len(ts)
+			}
+			if int64(count) < event.Timestamp {
+				t.Errorf("POS %d processed after %d DMLs", event.Timestamp, count)
+			}
+			positions = append(positions, event.Timestamp)
+		}
+	})
+
+	dmls := int64(0)
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			iw.dispatch(&blproto.StreamEvent{
+				Category:  "DML",
+				TableName: fmt.Sprintf("t%d", j),
+				Timestamp: int64(i),
+			})
+			dmls++
+		}
+		iw.broadcast(&blproto.StreamEvent{Category: "POS", Timestamp: dmls})
+	}
+	iw.drain()
+
+	mu.Lock()
+	if len(positions) != 100 {
+		t.Errorf("got %d positions, want 100", len(positions))
+	}
+	for i, pos := range positions {
+		if pos != int64(i+1)*10 {
+			t.Errorf("positions[%d] = %d, want %d", i, pos, (i+1)*10)
+		}
+	}
+	for table, ts := range processed {
+		for i, v := range ts {
+			if v != int64(i) {
+				t.Errorf("%s: event %d has timestamp %d, out of order", table, i, v)
+			}
+		}
+	}
+	mu.Unlock()
+	iw.stop()
+}
+
+func TestInvalidatorDryRun(t *testing.T) {
+	// qe is nil: any attempt to touch the rowcache would panic,
+	// and show up as an internal error instead of a record.
+	rci := &RowcacheInvalidator{dryRun: true}
+	rci.SetGTID(myproto.GoogleGTID{GroupID: 41})
+
+	ch := InvalidationLogger.Subscribe()
+	defer InvalidationLogger.Unsubscribe(ch)
+
+	rci.processEvent(&blproto.StreamEvent{
+		Category:   "DML",
+		TableName:  "vtocc_cached",
+		PKColNames: []string{"eid", "name"},
+		PKValues:   [][]interface{}{{int64(1), []byte("foo")}},
+	})
+	record := (<-ch).(*InvalidationRecord)
+	if record.Category != "DML" || record.TableName != "vtocc_cached" {
+		t.Errorf("got %+v, want a DML record for vtocc_cached", record)
+	}
+	if want := []string{"1.'Zm9v'"}; !reflect.DeepEqual(record.Keys, want) {
+		t.Errorf("got keys %v, want %v", record.Keys, want)
+	}
+	if want := "41"; record.GTID != want {
+		t.Errorf("got GTID %v, want %v", record.GTID, want)
+	}
+
+	rci.processEvent(&blproto.StreamEvent{Category: "DDL", Sql: "alter table vtocc_cached comment 'a'"})
+	record = (<-ch).(*InvalidationRecord)
+	if record.Category != "DDL" || record.Sql != "alter table vtocc_cached comment 'a'" {
+		t.Errorf("got %+v, want the DDL record", record)
+	}
+}
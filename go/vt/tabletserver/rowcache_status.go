@@ -0,0 +1,63 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/sync2"
+)
+
+const rowcacheStatusURL = "/debug/rowcache"
+
+// rowcacheStatus summarizes the health of the rowcache
+// and of its invalidator.
+type rowcacheStatus struct {
+	InvalidatorState string
+	GTID             string
+	LagSeconds       int64
+	Tables           map[string]tableCacheStats
+	Memcache         map[string]string
+	RecentErrors     []invalidationError
+}
+
+func (qe *QueryEngine) rowcacheStatus() *rowcacheStatus {
+	status := &rowcacheStatus{
+		InvalidatorState: qe.invalidator.svm.StateName(),
+		GTID:             qe.invalidator.GetGTIDString(),
+		LagSeconds:       qe.invalidator.lagSeconds.Get(),
+		Tables:           qe.schemaInfo.getTableCacheStats(),
+		RecentErrors:     qe.invalidator.getRecentErrors(),
+	}
+	if !qe.cachePool.IsClosed() && qe.cachePool.memcacheStats != nil {
+		status.Memcache = qe.cachePool.memcacheStats.MainStats()
+	}
+	return status
+}
+
+// rowcacheHealthy returns false if the rowcache is enabled, but can't
+// be read because its invalidator is stopped, or too far behind.
+func (qe *QueryEngine) rowcacheHealthy() bool {
+	if qe.cachePool.IsClosed() {
+		return true
+	}
+	return qe.invalidator.svm.State() == sync2.SERVICE_RUNNING && qe.rowcacheBypassed.Get() == 0
+}
+
+func (qe *QueryEngine) serveRowcacheStatus(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.MONITORING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	b, err := json.MarshalIndent(qe.rowcacheStatus(), "", "  ")
+	if err != nil {
+		response.Write([]byte(err.Error()))
+		return
+	}
+	response.Write(b)
+}
@@ -0,0 +1,58 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/youtube/vitess/go/history"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/schema"
+)
+
+func TestServeRowcacheStatus(t *testing.T) {
+	cached := &TableInfo{Table: &schema.Table{Name: "vtocc_cached", CacheType: schema.CACHE_RW}}
+	cached.hits.Set(3)
+	cached.misses.Set(2)
+	cached.invalidations.Set(1)
+	qe := &QueryEngine{
+		schemaInfo: &SchemaInfo{tables: map[string]*TableInfo{
+			"vtocc_cached":  cached,
+			"vtocc_nocache": &TableInfo{Table: &schema.Table{Name: "vtocc_nocache", CacheType: schema.CACHE_NONE}},
+		}},
+		cachePool:   &CachePool{},
+		invalidator: &RowcacheInvalidator{recentErrors: history.New(invalidationErrorHistory)},
+	}
+	qe.invalidator.SetGTID(myproto.GoogleGTID{GroupID: 41})
+	qe.invalidator.lagSeconds.Set(7)
+	qe.invalidator.recordError(&blproto.StreamEvent{Category: "DML", TableName: "vtocc_cached"}, fmt.Errorf("bad key"))
+
+	request, _ := http.NewRequest("GET", rowcacheStatusURL, nil)
+	response := httptest.NewRecorder()
+	qe.serveRowcacheStatus(response, request)
+
+	var got rowcacheStatus
+	if err := json.Unmarshal(response.Body.Bytes(), &got); err != nil {
+		t.Fatalf("can't decode %s: %v", response.Body.String(), err)
+	}
+	if got.GTID != "41" || got.LagSeconds != 7 {
+		t.Errorf("got GTID %v, lag %v, want 41, 7", got.GTID, got.LagSeconds)
+	}
+	want := tableCacheStats{Hits: 3, Misses: 2, Invalidations: 1}
+	if len(got.Tables) != 1 || got.Tables["vtocc_cached"] != want {
+		t.Errorf("got tables %+v, want only vtocc_cached: %+v", got.Tables, want)
+	}
+	if got.Memcache != nil {
+		t.Errorf("got memcache stats %v for a closed cache pool", got.Memcache)
+	}
+	if len(got.RecentErrors) != 1 || got.RecentErrors[0].Error != "bad key" {
+		t.Errorf("got recent errors %+v, want one 'bad key' error", got.RecentErrors)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+)
+
+func TestChecksum(t *testing.T) {
+	b := []byte("encoded row")
+	cb := addChecksum(b)
+	if got := verifyChecksum(cb); !bytes.Equal(got, b) {
+		t.Errorf("verifyChecksum: %q, want %q", got, b)
+	}
+	cb[6] ^= 0x10
+	if got := verifyChecksum(cb); got != nil {
+		t.Errorf("verifyChecksum of corrupt value: %q, want nil", got)
+	}
+	if got := verifyChecksum(cb[:3]); got != nil {
+		t.Errorf("verifyChecksum of short value: %q, want nil", got)
+	}
+}
+
+func TestRowCacheFlush(t *testing.T) {
+	cachePool := &CachePool{DeleteExpiry: 60}
+	rc := NewRowCache(nil, cachePool)
+	prefix := rc.getPrefix()
+	if rc.recentlyFlushed() {
+		t.Errorf("new cache is recently flushed")
+	}
+	rc.Flush()
+	if rc.getPrefix() == prefix {
+		t.Errorf("prefix %s didn't change after Flush", prefix)
+	}
+	if !rc.recentlyFlushed() {
+		t.Errorf("cache is not recently flushed after Flush")
+	}
+}
+
+func TestEncodeGTID(t *testing.T) {
+	gtid := myproto.GoogleGTID{GroupID: 41}
+	gb := encodeGTID(gtid, []byte("row"))
+	got, b := decodeGTID(gb)
+	if got != gtid || string(b) != "row" {
+		t.Errorf("decodeGTID: %v, %q, want %v, \"row\"", got, b, gtid)
+	}
+	if _, b := decodeGTID(gb[:3]); b != nil {
+		t.Errorf("decodeGTID of truncated value: %q, want nil", b)
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	row := []sqltypes.Value{sqltypes.MakeString([]byte("a"))}
+	testcases := []struct {
+		min, filled myproto.GTID
+		stale       bool
+	}{
+		{nil, nil, false},
+		{nil, myproto.GoogleGTID{GroupID: 1}, false},
+		{myproto.GoogleGTID{GroupID: 5}, nil, true},
+		{myproto.GoogleGTID{GroupID: 5}, myproto.GoogleGTID{GroupID: 4}, true},
+		{myproto.GoogleGTID{GroupID: 5}, myproto.GoogleGTID{GroupID: 5}, false},
+		{myproto.GoogleGTID{GroupID: 5}, myproto.GoogleGTID{GroupID: 6}, false},
+	}
+	for _, tcase := range testcases {
+		plan := &compiledPlan{MinGTID: tcase.min}
+		if got := plan.isStale(RCResult{Row: row, GTID: tcase.filled}); got != tcase.stale {
+			t.Errorf("isStale(min %v, filled %v): %v, want %v", tcase.min, tcase.filled, got, tcase.stale)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+
+	log "github.com/golang/glog"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/schema"
+)
+
+// RowcacheWarmer primes the rowcache of the tables that
+// have a WarmQuery in their cache override. It runs once
+// in the background every time the QueryEngine is opened,
+// so a tablet doesn't start serving with a cold cache.
+type RowcacheWarmer struct {
+	qe         *QueryEngine
+	svm        sync2.ServiceManager
+	warmedRows sync2.AtomicInt64
+}
+
+// NewRowcacheWarmer creates a new RowcacheWarmer.
+// Just like QueryEngine, this is a singleton class.
+// You must call this only once.
+func NewRowcacheWarmer(qe *QueryEngine) *RowcacheWarmer {
+	rcw := &RowcacheWarmer{qe: qe}
+	stats.Publish("RowcacheWarmerState", stats.StringFunc(rcw.svm.StateName))
+	stats.Publish("RowcacheWarmedRows", stats.IntFunc(rcw.warmedRows.Get))
+	return rcw
+}
+
+// Open starts warming the rowcache using the warm queries
+// of schemaOverrides. It returns immediately.
+func (rcw *RowcacheWarmer) Open(schemaOverrides []SchemaOverride) {
+	var overrides []SchemaOverride
+	for _, override := range schemaOverrides {
+		if override.Cache != nil && override.Cache.WarmQuery != "" {
+			overrides = append(overrides, override)
+		}
+	}
+	if len(overrides) == 0 {
+		return
+	}
+	rcw.svm.Go(func(svc *sync2.ServiceContext) error {
+		for _, override := range overrides {
+			if !svc.IsRunning() {
+				break
+			}
+			rcw.warmTable(svc, override.Name, override.Cache.WarmQuery)
+		}
+		return nil
+	})
+}
+
+// Close stops the warming if it's still running.
+func (rcw *RowcacheWarmer) Close() {
+	rcw.svm.Stop()
+}
+
+func (rcw *RowcacheWarmer) warmTable(svc *sync2.ServiceContext, tableName, query string) {
+	defer logError()
+	tableInfo := rcw.qe.schemaInfo.GetTable(tableName)
+	if tableInfo == nil || tableInfo.CacheType != schema.CACHE_RW {
+		log.Warningf("Table %s has no rowcache, not warming it", tableName)
+		return
+	}
+
+	conn := getOrPanic(rcw.qe.connPool)
+	defer conn.Recycle()
+	gtid := rcw.qe.invalidator.GetGTID()
+	qr, err := conn.ExecuteFetch(query, int(rcw.qe.maxResultSize.Get()), true)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	if err := validateWarmFields(tableInfo, qr.Fields); err != nil {
+		panic(NewTabletError(FAIL, "Warm query for %s: %v", tableName, err))
+	}
+
+	var count int64
+	for _, row := range qr.Rows {
+		if !svc.IsRunning() {
+			break
+		}
+		key := buildKey(applyFilter(tableInfo.PKColumns, row))
+		if key == "" {
+			continue
+		}
+		// Set adds the row only if it's not in the cache yet,
+		// which keeps invalidations that happen during the warming.
+		tableInfo.Cache.Set(key, row, 0, gtid)
+		count++
+	}
+	rcw.warmedRows.Add(count)
+	log.Infof("Warmed rowcache of %s with %d rows", tableName, count)
+}
+
+// validateWarmFields verifies that a warm query returns
+// the full rows of the table, with the columns in table order.
+func validateWarmFields(tableInfo *TableInfo, fields []mproto.Field) error {
+	if len(fields) != len(tableInfo.Columns) {
+		return fmt.Errorf("got %d columns, want %d", len(fields), len(tableInfo.Columns))
+	}
+	for i, field := range fields {
+		if field.Name != tableInfo.Columns[i].Name {
+			return fmt.Errorf("column %d is %s, want %s", i, field.Name, tableInfo.Columns[i].Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/schema"
+)
+
+func TestValidateWarmFields(t *testing.T) {
+	tableInfo := &TableInfo{Table: schema.NewTable("vtocc_cached1")}
+	tableInfo.AddColumn("eid", "bigint", sqltypes.NULL, "")
+	tableInfo.AddColumn("name", "varchar(128)", sqltypes.NULL, "")
+
+	testcases := []struct {
+		fields []string
+		ok     bool
+	}{
+		{[]string{"eid", "name"}, true},
+		{[]string{"eid"}, false},
+		{[]string{"name", "eid"}, false},
+	}
+	for _, tcase := range testcases {
+		fields := make([]mproto.Field, len(tcase.fields))
+		for i, name := range tcase.fields {
+			fields[i].Name = name
+		}
+		err := validateWarmFields(tableInfo, fields)
+		if (err == nil) != tcase.ok {
+			t.Errorf("validateWarmFields(%v): %v, want ok: %v", tcase.fields, err, tcase.ok)
+		}
+	}
+}
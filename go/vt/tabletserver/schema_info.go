@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -19,23 +21,50 @@ import (
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/timer"
 	"github.com/youtube/vitess/go/vt/dbconnpool"
 	"github.com/youtube/vitess/go/vt/schema"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 	"github.com/youtube/vitess/go/vt/tableacl"
 	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
 )
 
 const base_show_tables = "select table_name, table_type, unix_timestamp(create_time), table_comment from information_schema.tables where table_schema = database()"
 
 const maxTableCount = 10000
 
+// showTableQuery returns the query of base_show_tables
+// restricted to tableName.
+func showTableQuery(tableName string) string {
+	buf := bytes.NewBufferString(base_show_tables)
+	buf.WriteString(" and table_name = ")
+	sqltypes.MakeString([]byte(tableName)).EncodeSql(buf)
+	return buf.String()
+}
+
+// schemaReloadInvalidations counts, per table, the rowcache
+// invalidations caused by a schema reload.
+var schemaReloadInvalidations = stats.NewCounters("SchemaReloadInvalidations")
+
+// tableReloads counts, per table, the reloads triggered
+// by queries that failed because of a schema change.
+var tableReloads = stats.NewCounters("SchemaErrorReloads")
+
+// tableReloadInterval is the minimum time between two reloads
+// of a table triggered by failed queries.
+const tableReloadInterval = 1 * time.Second
+
 type ExecPlan struct {
 	*planbuilder.ExecPlan
 	TableInfo  *TableInfo
 	Fields     []mproto.Field
 	Rules      *QueryRules
 	Authorized tableacl.ACL
+	// Fingerprint is the hash of the fingerprint of the query,
+	// computed once for the logs and the stats of its executions.
+	Fingerprint string
 
 	mu         sync.Mutex
 	QueryCount int64
@@ -70,10 +99,26 @@ func (ep *ExecPlan) Stats() (queryCount int64, duration time.Duration, rowCount,
 type SchemaOverride struct {
 	Name      string
 	PKColumns []string
-	Cache     *struct {
+	// MaxResultSize and MaxResultBytes, if set, override the
+	// limits of the query service for the selects of the table.
+	MaxResultSize  int64
+	MaxResultBytes int64
+	// NoLockRetries, if set, disables the retries of the autocommit
+	// DMLs of the table that fail with a deadlock or a lock wait
+	// timeout, for tables whose DMLs must not run twice.
+	NoLockRetries bool
+	Cache         *struct {
 		Type   string
 		Prefix string
 		Table  string
+		// TTL is the expiry in seconds of the cached rows. 0 means no expiry.
+		TTL uint64
+		// MaxRowSize is the largest row in bytes that will be cached.
+		// 0 means MAX_DATA_LEN.
+		MaxRowSize int
+		// WarmQuery, if set, is run when the tablet starts serving
+		// to prime the rowcache. It must return full rows of the table.
+		WarmQuery string
 	}
 }
 
@@ -89,16 +134,32 @@ type SchemaInfo struct {
 	reloadTime     time.Duration
 	lastChange     time.Time
 	ticks          *timer.Timer
+	// dynamicRules are the rules pushed at runtime, by source.
+	// Unlike rules, they survive a restart of the query service.
+	dynamicRules map[string]*QueryRules
+	// rowcacheOptIn restricts the rowcache to tables
+	// that have a cache override.
+	rowcacheOptIn bool
+	// planGeneration changes every time plans are removed from
+	// the query plan cache for being stale, so the plans held
+	// outside of it, by prepared statements, can be rebuilt.
+	planGeneration sync2.AtomicInt64
+	// lastTableReloads are the times of the last reloads
+	// done by ReloadTable, by table.
+	lastTableReloads map[string]time.Time
 }
 
-func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout time.Duration) *SchemaInfo {
+func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout time.Duration, rowcacheOptIn bool) *SchemaInfo {
 	si := &SchemaInfo{
-		queryCacheSize: queryCacheSize,
-		queries:        cache.NewLRUCache(int64(queryCacheSize)),
-		rules:          NewQueryRules(),
-		connPool:       dbconnpool.NewConnectionPool("", 2, idleTimeout),
-		reloadTime:     reloadTime,
-		ticks:          timer.NewTimer(reloadTime),
+		rowcacheOptIn:    rowcacheOptIn,
+		queryCacheSize:   queryCacheSize,
+		queries:          cache.NewLRUCache(int64(queryCacheSize)),
+		rules:            NewQueryRules(),
+		dynamicRules:     make(map[string]*QueryRules),
+		lastTableReloads: make(map[string]time.Time),
+		connPool:         dbconnpool.NewConnectionPool("", 2, idleTimeout),
+		reloadTime:       reloadTime,
+		ticks:            timer.NewTimer(reloadTime),
 	}
 	stats.Publish("QueryCacheLength", stats.IntFunc(si.queries.Length))
 	stats.Publish("QueryCacheSize", stats.IntFunc(si.queries.Size))
@@ -106,6 +167,12 @@ func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout tim
 	stats.Publish("QueryCacheOldest", stats.StringFunc(func() string {
 		return fmt.Sprintf("%v", si.queries.Oldest())
 	}))
+	stats.Publish("RowcacheOptIn", stats.IntFunc(func() int64 {
+		if si.rowcacheOptIn {
+			return 1
+		}
+		return 0
+	}))
 	stats.Publish("SchemaReloadTime", stats.DurationFunc(func() time.Duration {
 		return si.reloadTime
 	}))
@@ -119,6 +186,9 @@ func NewSchemaInfo(queryCacheSize int, reloadTime time.Duration, idleTimeout tim
 	http.Handle("/debug/query_stats", si)
 	http.Handle("/debug/table_stats", si)
 	http.Handle("/debug/schema", si)
+	http.HandleFunc("/debug/schema/reload", si.serveReload)
+	http.HandleFunc("/debug/query_plans/evict", si.serveEvictQueryPlan)
+	http.HandleFunc("/debug/query_rules", si.serveQueryRules)
 	return si
 }
 
@@ -157,12 +227,15 @@ func (si *SchemaInfo) Open(connFactory dbconnpool.CreateConnectionFunc, schemaOv
 		}
 		si.tables[tableName] = tableInfo
 	}
-	if schemaOverrides != nil {
-		si.overrides = schemaOverrides
-		si.override()
+	si.overrides = schemaOverrides
+	if si.rowcacheOptIn {
+		for tableName, tableInfo := range si.tables {
+			si.optOut(tableInfo, tableName)
+		}
 	}
+	si.override()
 	// Clear is not really needed. Doing it for good measure.
-	si.queries.Clear()
+	si.clearQueries()
 	si.rules = qrs.Copy()
 	si.ticks.Start(func() { si.Reload() })
 }
@@ -181,6 +254,22 @@ func (si *SchemaInfo) updateLastChange(createTime sqltypes.Value) {
 	}
 }
 
+// optOut disables the rowcache for a table that doesn't have
+// a cache override. It's used when rowcacheOptIn is set.
+func (si *SchemaInfo) optOut(tableInfo *TableInfo, tableName string) {
+	if tableInfo.CacheType == schema.CACHE_NONE {
+		return
+	}
+	for _, o := range si.overrides {
+		if o.Name == tableName && o.Cache != nil {
+			return
+		}
+	}
+	log.Infof("Table %s has no cache override. Will not be cached.", tableName)
+	tableInfo.CacheType = schema.CACHE_NONE
+	tableInfo.Cache = nil
+}
+
 func (si *SchemaInfo) override() {
 	for _, override := range si.overrides {
 		table, ok := si.tables[override.Name]
@@ -194,10 +283,19 @@ func (si *SchemaInfo) override() {
 				continue
 			}
 		}
-		if si.cachePool.IsClosed() || override.Cache == nil {
+		table.maxResultSize = override.MaxResultSize
+		table.maxResultBytes = override.MaxResultBytes
+		table.noLockRetries = override.NoLockRetries
+		if si.cachePool.IsClosed() || override.Cache == nil || table.Type != schema.TYPE_NORMAL {
 			continue
 		}
 		switch override.Cache.Type {
+		case "":
+			// Keep the cache type, but apply the cache options.
+		case "NONE":
+			table.CacheType = schema.CACHE_NONE
+			table.Cache = nil
+			continue
 		case "RW":
 			table.CacheType = schema.CACHE_RW
 			table.Cache = NewRowCache(table, si.cachePool)
@@ -217,8 +315,16 @@ func (si *SchemaInfo) override() {
 				continue
 			}
 			table.Cache = totable.Cache
+			continue
 		default:
 			log.Warningf("Ignoring cache override: %v", override)
+			continue
+		}
+		if table.CacheType == schema.CACHE_RW && table.Cache != nil {
+			table.Cache.ttl = override.Cache.TTL
+			if override.Cache.MaxRowSize != 0 {
+				table.Cache.maxDataLen = override.Cache.MaxRowSize
+			}
 		}
 	}
 }
@@ -228,32 +334,105 @@ func (si *SchemaInfo) Close() {
 	si.connPool.Close()
 	si.tables = nil
 	si.overrides = nil
-	si.queries.Clear()
+	si.clearQueries()
 	si.rules = NewQueryRules()
 }
 
+// Reload reloads the tables that were created or altered since the
+// last load, and forgets the ones that were dropped. Cached tables
+// whose columns changed without a change of create_time, which happens
+// with some in-place ALTERs, are also reloaded. Reloading a cached table
+// gives it a new rowcache prefix, which invalidates all its cached rows.
+// This covers schema changes that were applied out of band, and
+// were therefore not seen by the rowcache invalidator.
 func (si *SchemaInfo) Reload() {
 	defer logError()
 	conn := getOrPanic(si.connPool)
 	defer conn.Recycle()
-	tables, err := conn.ExecuteFetch(fmt.Sprintf("%s and unix_timestamp(create_time) > %v", base_show_tables, si.lastChange.Unix()), maxTableCount, false)
+	tables, err := conn.ExecuteFetch(base_show_tables, maxTableCount, false)
 	if err != nil {
 		log.Warningf("Could not get table list for reload: %v", err)
 		return
 	}
 	log.Infof("Reloading schema")
+	lastChange := si.lastChange.Unix()
+	found := make(map[string]bool, len(tables.Rows))
 	for _, row := range tables.Rows {
 		tableName := row[0].String()
+		found[tableName] = true
 		si.updateLastChange(row[2])
-		log.Infof("Reloading: %s", tableName)
 		si.mu.Lock()
-		_, ok := si.tables[tableName]
+		tableInfo, ok := si.tables[tableName]
 		si.mu.Unlock()
+		if ok && !createdAfter(row[2], lastChange) && !si.columnsChanged(conn, tableInfo) {
+			continue
+		}
+		log.Infof("Reloading: %s", tableName)
 		if ok {
+			if tableInfo.CacheType != schema.CACHE_NONE {
+				schemaReloadInvalidations.Add(tableName, 1)
+			}
 			si.DropTable(tableName)
 		}
 		si.createTable(conn, tableName)
 	}
+	for _, tableName := range si.droppedTables(found) {
+		log.Infof("Table %s was dropped", tableName)
+		si.DropTable(tableName)
+	}
+}
+
+func createdAfter(createTime sqltypes.Value, lastChange int64) bool {
+	if createTime.IsNull() {
+		return false
+	}
+	t, err := strconv.ParseInt(createTime.String(), 10, 64)
+	if err != nil {
+		return false
+	}
+	return t > lastChange
+}
+
+// columnsChanged returns true if the columns of a cached
+// table don't match the ones currently in the database.
+func (si *SchemaInfo) columnsChanged(conn dbconnpool.PoolConnection, tableInfo *TableInfo) bool {
+	if tableInfo.CacheType == schema.CACHE_NONE {
+		return false
+	}
+	current := &TableInfo{Table: schema.NewTable(tableInfo.Name)}
+	if err := current.fetchColumns(conn); err != nil {
+		log.Warningf("Could not fetch columns of %s for reload: %v", tableInfo.Name, err)
+		return false
+	}
+	return !sameColumns(tableInfo.Columns, current.Columns)
+}
+
+func sameColumns(a, b []schema.TableColumn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Category != b[i].Category {
+			return false
+		}
+	}
+	return true
+}
+
+// droppedTables returns the tables of si that are not in found.
+func (si *SchemaInfo) droppedTables(found map[string]bool) []string {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	var dropped []string
+	for tableName := range si.tables {
+		if tableName == "dual" || tableName == "DUAL" {
+			continue
+		}
+		if !found[tableName] {
+			dropped = append(dropped, tableName)
+		}
+	}
+	return dropped
 }
 
 // safe to call this if Close has been called, as si.ticks will be stopped
@@ -269,7 +448,7 @@ func (si *SchemaInfo) CreateTable(tableName string) {
 }
 
 func (si *SchemaInfo) createTable(conn dbconnpool.PoolConnection, tableName string) {
-	tables, err := conn.ExecuteFetch(fmt.Sprintf("%s and table_name = '%s'", base_show_tables, tableName), 1, false)
+	tables, err := conn.ExecuteFetch(showTableQuery(tableName), 1, false)
 	if err != nil {
 		panic(NewTabletError(FAIL, "Error fetching table %s: %v", tableName, err))
 	}
@@ -287,10 +466,13 @@ func (si *SchemaInfo) createTable(conn dbconnpool.PoolConnection, tableName stri
 	if err != nil {
 		panic(NewTabletError(FATAL, "Could not get load table %s: %v", tableName, err))
 	}
+	if si.rowcacheOptIn {
+		si.optOut(tableInfo, tableName)
+	}
 	if tableInfo.CacheType == schema.CACHE_NONE {
 		log.Infof("Initialized table: %s", tableName)
 	} else {
-		log.Infof("Initialized cached table: %s", tableInfo.Cache.prefix)
+		log.Infof("Initialized cached table: %s", tableInfo.Cache.getPrefix())
 	}
 	si.mu.Lock()
 	defer si.mu.Unlock()
@@ -308,35 +490,130 @@ func (si *SchemaInfo) createTable(conn dbconnpool.PoolConnection, tableName stri
 	}
 }
 
+// ReloadTable reloads tableName, or forgets it if it was dropped, so
+// that a query that failed because of a schema change can be retried.
+// It returns false if it already reloaded the table less than
+// tableReloadInterval ago, which limits the reloads caused by queries
+// that keep failing.
+func (si *SchemaInfo) ReloadTable(tableName string) bool {
+	si.mu.Lock()
+	now := time.Now()
+	if now.Sub(si.lastTableReloads[tableName]) < tableReloadInterval {
+		si.mu.Unlock()
+		return false
+	}
+	for name, last := range si.lastTableReloads {
+		if now.Sub(last) >= tableReloadInterval {
+			delete(si.lastTableReloads, name)
+		}
+	}
+	si.lastTableReloads[tableName] = now
+	tableInfo, ok := si.tables[tableName]
+	si.mu.Unlock()
+
+	conn := getOrPanic(si.connPool)
+	defer conn.Recycle()
+	tables, err := conn.ExecuteFetch(showTableQuery(tableName), 1, false)
+	if err != nil {
+		panic(NewTabletError(FAIL, "Error fetching table %s: %v", tableName, err))
+	}
+	if !ok && len(tables.Rows) == 0 {
+		return false
+	}
+	log.Infof("Reloading %s after a schema error", tableName)
+	tableReloads.Add(tableName, 1)
+	if ok {
+		if tableInfo.CacheType != schema.CACHE_NONE {
+			schemaReloadInvalidations.Add(tableName, 1)
+		}
+		si.DropTable(tableName)
+	}
+	if len(tables.Rows) != 0 {
+		si.createTable(conn, tableName)
+	}
+	return true
+}
+
 func (si *SchemaInfo) DropTable(tableName string) {
 	si.mu.Lock()
 	defer si.mu.Unlock()
 	delete(si.tables, tableName)
-	si.queries.Clear()
+	si.clearQueries()
 	log.Infof("Table %s forgotten", tableName)
 }
 
-func (si *SchemaInfo) GetPlan(logStats *SQLQueryStats, sql string) (plan *ExecPlan) {
+// GetPlan returns the plan of sql. If the plan can't be built because
+// a table of the query is not in the schema, the table is reloaded,
+// and the plan built again: the table may have been created since
+// the schema was loaded.
+func (si *SchemaInfo) GetPlan(logStats *SQLQueryStats, sql string) *ExecPlan {
+	plan, missingTable, err := si.getPlan(logStats, sql)
+	if err != nil && missingTable != "" && si.ReloadTable(missingTable) {
+		plan, _, err = si.getPlan(logStats, sql)
+	}
+	if err != nil {
+		panic(NewTabletError(FAIL, "%s", err))
+	}
+	return plan
+}
+
+// GetReservedPlan is GetPlan for the queries of the reserved
+// connections. Their temporary tables are not in the schema, so the
+// selects and DMLs of the tables that can't be found are passed
+// through to MySQL, with plans that are not cached.
+func (si *SchemaInfo) GetReservedPlan(logStats *SQLQueryStats, sql string) *ExecPlan {
+	plan, missingTable, err := si.getPlan(logStats, sql)
+	if err != nil && missingTable != "" {
+		if si.ReloadTable(missingTable) {
+			plan, _, err = si.getPlan(logStats, sql)
+		} else {
+			plan, err = si.passthroughPlan(sql)
+		}
+	}
+	if err != nil {
+		panic(NewTabletError(FAIL, "%s", err))
+	}
+	return plan
+}
+
+// passthroughPlan returns the plan that passes sql through to MySQL.
+func (si *SchemaInfo) passthroughPlan(sql string) (*ExecPlan, error) {
+	splan, err := planbuilder.GetPassthroughPlan(sql)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ExecPlan{ExecPlan: splan, Fingerprint: fingerprintSql(sql)}
+	si.mu.Lock()
+	plan.Rules = si.filterRules(sql, plan.PlanId, "")
+	si.mu.Unlock()
+	plan.Authorized = tableacl.Authorized("", plan.PlanId.MinRole())
+	return plan, nil
+}
+
+// getPlan returns the plan of sql, or the error of the plan builder
+// with the table it didn't find in the schema, if any.
+func (si *SchemaInfo) getPlan(logStats *SQLQueryStats, sql string) (plan *ExecPlan, missingTable string, err error) {
 	si.mu.Lock()
 	defer si.mu.Unlock()
 	if plan := si.getQuery(sql); plan != nil {
-		return plan
+		return plan, "", nil
 	}
 
 	var tableInfo *TableInfo
-	GetTable := func(tableName string) (table *schema.Table, ok bool) {
-		tableInfo, ok = si.tables[tableName]
+	GetTable := func(name string) (table *schema.Table, ok bool) {
+		tableInfo, ok = si.tables[name]
 		if !ok {
+			missingTable = name
 			return nil, false
 		}
 		return tableInfo.Table, true
 	}
 	splan, err := planbuilder.GetExecPlan(sql, GetTable)
 	if err != nil {
-		panic(NewTabletError(FAIL, "%s", err))
+		return nil, missingTable, err
 	}
-	plan = &ExecPlan{ExecPlan: splan, TableInfo: tableInfo}
-	plan.Rules = si.rules.filterByPlan(sql, plan.PlanId, plan.TableName)
+	plan = &ExecPlan{ExecPlan: splan, TableInfo: tableInfo, Fingerprint: fingerprintSql(sql)}
+	plan.Rules = si.filterRules(sql, plan.PlanId, plan.TableName)
 	plan.Authorized = tableacl.Authorized(plan.TableName, plan.PlanId.MinRole())
 	if plan.PlanId.IsSelect() {
 		if plan.FieldQuery == nil {
@@ -350,15 +627,74 @@ func (si *SchemaInfo) GetPlan(logStats *SQLQueryStats, sql string) (plan *ExecPl
 			logStats.NumberOfQueries += 1
 			logStats.AddRewrittenSql(sql)
 			if err != nil {
-				panic(NewTabletError(FAIL, "Error fetching fields: %v", err))
+				return nil, "", fmt.Errorf("Error fetching fields: %v", err)
 			}
 			plan.Fields = r.Fields
 		}
 	} else if plan.PlanId == planbuilder.PLAN_DDL || plan.PlanId == planbuilder.PLAN_SET {
-		return plan
+		return plan, "", nil
 	}
 	si.queries.Set(sql, plan)
-	return plan
+	return plan, "", nil
+}
+
+// filterRules returns the static and dynamic
+// rules that apply to the plan of sql.
+func (si *SchemaInfo) filterRules(sql string, planId planbuilder.PlanType, tableName string) *QueryRules {
+	rules := si.rules.filterByPlan(sql, planId, tableName)
+	for _, source := range si.dynamicRuleSources() {
+		rules.Append(si.dynamicRules[source].filterByPlan(sql, planId, tableName))
+	}
+	return rules
+}
+
+// ExplainQuery returns the plan of sql. Unlike GetPlan, it doesn't
+// query MySQL, and doesn't add the plan to the query plan cache.
+func (si *SchemaInfo) ExplainQuery(sql string) proto.QueryExplanation {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	var tableInfo *TableInfo
+	GetTable := func(name string) (table *schema.Table, ok bool) {
+		tableInfo, ok = si.tables[name]
+		if !ok {
+			return nil, false
+		}
+		return tableInfo.Table, true
+	}
+	plan, err := planbuilder.GetExecPlan(sql, GetTable)
+	if err != nil {
+		panic(NewTabletError(FAIL, "%s", err))
+	}
+	explanation := proto.QueryExplanation{
+		PlanType:   plan.PlanId.String(),
+		Reason:     plan.Reason.String(),
+		Table:      plan.TableName,
+		IndexUsed:  plan.IndexUsed,
+		FieldQuery: parsedQueryString(plan.FieldQuery),
+		FullQuery:  parsedQueryString(plan.FullQuery),
+		OuterQuery: parsedQueryString(plan.OuterQuery),
+		Subquery:   parsedQueryString(plan.Subquery),
+		Rowcache:   "none",
+	}
+	switch plan.PlanId {
+	case planbuilder.PLAN_PK_EQUAL, planbuilder.PLAN_PK_IN, planbuilder.PLAN_SELECT_SUBQUERY:
+		explanation.Rowcache = "read"
+	case planbuilder.PLAN_DML_PK, planbuilder.PLAN_DML_SUBQUERY, planbuilder.PLAN_UPSERT_PK:
+		if tableInfo != nil && tableInfo.CacheType != schema.CACHE_NONE {
+			explanation.Rowcache = "invalidate"
+		}
+	}
+	for _, rule := range si.filterRules(sql, plan.PlanId, plan.TableName).rules {
+		explanation.Rules = append(explanation.Rules, rule.Name)
+	}
+	return explanation
+}
+
+func parsedQueryString(pq *sqlparser.ParsedQuery) string {
+	if pq == nil {
+		return ""
+	}
+	return pq.Query
 }
 
 // GetStreamPlan is similar to GetPlan, but doesn't use the cache
@@ -382,7 +718,7 @@ func (si *SchemaInfo) SetRules(qrs *QueryRules) {
 	si.mu.Lock()
 	defer si.mu.Unlock()
 	si.rules = qrs.Copy()
-	si.queries.Clear()
+	si.clearQueries()
 }
 
 func (si *SchemaInfo) GetRules() (qrs *QueryRules) {
@@ -391,6 +727,41 @@ func (si *SchemaInfo) GetRules() (qrs *QueryRules) {
 	return si.rules.Copy()
 }
 
+// SetDynamicRules replaces the rules pushed by source, and
+// clears the plans built with the previous ones. An empty
+// qrs removes the rules of source.
+func (si *SchemaInfo) SetDynamicRules(source string, qrs *QueryRules) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if len(qrs.rules) == 0 {
+		delete(si.dynamicRules, source)
+	} else {
+		si.dynamicRules[source] = qrs.Copy()
+	}
+	si.clearQueries()
+}
+
+// GetDynamicRules returns the rules pushed by source.
+func (si *SchemaInfo) GetDynamicRules(source string) (qrs *QueryRules) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	if qrs, ok := si.dynamicRules[source]; ok {
+		return qrs.Copy()
+	}
+	return NewQueryRules()
+}
+
+// dynamicRuleSources returns the sources of the dynamic rules
+// in the order their rules are applied.
+func (si *SchemaInfo) dynamicRuleSources() []string {
+	sources := make([]string, 0, len(si.dynamicRules))
+	for source := range si.dynamicRules {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
 func (si *SchemaInfo) GetTable(tableName string) *TableInfo {
 	si.mu.Lock()
 	defer si.mu.Unlock()
@@ -414,6 +785,64 @@ func (si *SchemaInfo) getQuery(sql string) *ExecPlan {
 	return nil
 }
 
+// GetQueryPlans returns the plans of the query plan cache,
+// from the most recently used to the least recently used.
+func (si *SchemaInfo) GetQueryPlans() []proto.QueryPlan {
+	items := si.queries.Items()
+	plans := make([]proto.QueryPlan, 0, len(items))
+	for _, item := range items {
+		plans = append(plans, newQueryPlan(item.Key, item.Value.(*ExecPlan)))
+	}
+	return plans
+}
+
+// GetQueryPlan returns the cached plan of sql, if there is one.
+// Unlike the execution of sql, it doesn't refresh the plan in the cache.
+func (si *SchemaInfo) GetQueryPlan(sql string) (plan proto.QueryPlan, ok bool) {
+	cacheResult, ok := si.queries.Peek(sql)
+	if !ok {
+		return plan, false
+	}
+	return newQueryPlan(sql, cacheResult.(*ExecPlan)), true
+}
+
+// EvictQueryPlan removes the plan of sql from the query plan cache,
+// so it gets rebuilt the next time sql is executed. It returns false
+// if sql had no plan.
+func (si *SchemaInfo) EvictQueryPlan(sql string) bool {
+	si.planGeneration.Add(1)
+	return si.queries.Delete(sql)
+}
+
+// ClearQueryPlans empties the query plan cache.
+func (si *SchemaInfo) ClearQueryPlans() {
+	si.clearQueries()
+}
+
+// clearQueries empties the query plan cache, and makes
+// the prepared statements rebuild their plans.
+func (si *SchemaInfo) clearQueries() {
+	si.queries.Clear()
+	si.planGeneration.Add(1)
+}
+
+func newQueryPlan(sql string, plan *ExecPlan) proto.QueryPlan {
+	qp := proto.QueryPlan{
+		Sql:      sql,
+		PlanType: plan.PlanId.String(),
+		Reason:   plan.Reason.String(),
+		Table:    plan.TableName,
+	}
+	var duration time.Duration
+	qp.QueryCount, duration, qp.RowCount, qp.ErrorCount = plan.Stats()
+	qp.Time = int64(duration)
+	if qp.QueryCount != 0 {
+		qp.AvgTime = qp.Time / qp.QueryCount
+		qp.AvgRows = qp.RowCount / qp.QueryCount
+	}
+	return qp
+}
+
 func (si *SchemaInfo) SetQueryCacheSize(size int) {
 	if size <= 0 {
 		panic(NewTabletError(FAIL, "cache size %v out of range", size))
@@ -443,6 +872,26 @@ func (si *SchemaInfo) getTableStats() map[string]int64 {
 	return tstats
 }
 
+// tableCacheStats contains the rowcache counters of a table.
+type tableCacheStats struct {
+	Hits, Absent, Misses, Invalidations int64
+}
+
+// getTableCacheStats returns the rowcache counters of all cached tables.
+func (si *SchemaInfo) getTableCacheStats() map[string]tableCacheStats {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	tstats := make(map[string]tableCacheStats)
+	for k, v := range si.tables {
+		if v.CacheType != schema.CACHE_NONE {
+			var ts tableCacheStats
+			ts.Hits, ts.Absent, ts.Misses, ts.Invalidations = v.Stats()
+			tstats[k] = ts
+		}
+	}
+	return tstats
+}
+
 func (si *SchemaInfo) getTableInvalidations() map[string]int64 {
 	si.mu.Lock()
 	defer si.mu.Unlock()
@@ -507,14 +956,135 @@ func (si *SchemaInfo) getQueryStats(f queryStatsFunc) map[string]int64 {
 	return qstats
 }
 
+// perQueryStats are the stats of the queries of a fingerprint. Query,
+// Table and Plan are the ones of the first of its queries in the
+// query plan cache.
 type perQueryStats struct {
-	Query      string
-	Table      string
-	Plan       planbuilder.PlanType
-	QueryCount int64
-	Time       time.Duration
-	RowCount   int64
-	ErrorCount int64
+	Query       string
+	Fingerprint string
+	Table       string
+	Plan        planbuilder.PlanType
+	QueryCount  int64
+	Time        time.Duration
+	RowCount    int64
+	ErrorCount  int64
+}
+
+// fingerprintStats returns the stats of the plans of the query plan
+// cache, aggregated by fingerprint.
+func (si *SchemaInfo) fingerprintStats() []perQueryStats {
+	keys := si.queries.Keys()
+	qstats := make([]perQueryStats, 0, len(keys))
+	indexes := make(map[string]int)
+	for _, v := range keys {
+		plan := si.getQuery(v)
+		if plan == nil {
+			continue
+		}
+		i, ok := indexes[plan.Fingerprint]
+		if !ok {
+			i = len(qstats)
+			indexes[plan.Fingerprint] = i
+			qstats = append(qstats, perQueryStats{
+				Query:       unicoded(v),
+				Fingerprint: plan.Fingerprint,
+				Table:       plan.TableName,
+				Plan:        plan.PlanId,
+			})
+		}
+		queryCount, duration, rowCount, errorCount := plan.Stats()
+		qstats[i].QueryCount += queryCount
+		qstats[i].Time += duration
+		qstats[i].RowCount += rowCount
+		qstats[i].ErrorCount += errorCount
+	}
+	return qstats
+}
+
+// serveReload triggers an asynchronous schema reload.
+func (si *SchemaInfo) serveReload(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	si.triggerReload()
+	response.Write([]byte("Schema reload triggered\n"))
+}
+
+// serveQueryRules shows the query rules in effect, by source.
+// A POST replaces the rules of the http source with the JSON
+// rules of the request body.
+func (si *SchemaInfo) serveQueryRules(response http.ResponseWriter, request *http.Request) {
+	if request.Method == "POST" {
+		if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+			acl.SendError(response, err)
+			return
+		}
+		data, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		qrs := NewQueryRules()
+		if err := qrs.UnmarshalJSON(data); err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+		si.SetDynamicRules(QR_SOURCE_HTTP, qrs)
+		response.Write([]byte("Query rules updated\n"))
+		return
+	}
+	if err := acl.CheckAccessHTTP(request, acl.DEBUGGING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	si.mu.Lock()
+	rulesBySource := map[string]*QueryRules{QR_SOURCE_STATIC: si.rules.Copy()}
+	for source, qrs := range si.dynamicRules {
+		rulesBySource[source] = qrs.Copy()
+	}
+	si.mu.Unlock()
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if b, err := json.MarshalIndent(rulesBySource, "", "  "); err != nil {
+		response.Write([]byte(err.Error()))
+	} else {
+		response.Write(b)
+	}
+}
+
+// queryPlanStatus is the description of a plan
+// served by /debug/query_plans.
+type queryPlanStatus struct {
+	proto.QueryPlan
+	Plan *planbuilder.ExecPlan
+}
+
+// serveEvictQueryPlan evicts the plan of the query passed as
+// the query parameter, or all plans if there's none. It only accepts
+// POST requests, so the eviction can't be triggered by following a
+// link.
+func (si *SchemaInfo) serveEvictQueryPlan(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	if request.Method != "POST" {
+		response.Header().Set("Allow", "POST")
+		http.Error(response, "query plans can only be evicted by a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	sql := request.FormValue("query")
+	if sql == "" {
+		si.ClearQueryPlans()
+		response.Write([]byte("Query plan cache cleared\n"))
+		return
+	}
+	if !si.EvictQueryPlan(sql) {
+		response.WriteHeader(http.StatusNotFound)
+		response.Write([]byte("Query plan not found\n"))
+		return
+	}
+	response.Write([]byte("Query plan evicted\n"))
 }
 
 func (si *SchemaInfo) ServeHTTP(response http.ResponseWriter, request *http.Request) {
@@ -523,35 +1093,24 @@ func (si *SchemaInfo) ServeHTTP(response http.ResponseWriter, request *http.Requ
 		return
 	}
 	if request.URL.Path == "/debug/query_plans" {
-		keys := si.queries.Keys()
-		response.Header().Set("Content-Type", "text/plain")
-		response.Write([]byte(fmt.Sprintf("Length: %d\n", len(keys))))
-		for _, v := range keys {
-			response.Write([]byte(fmt.Sprintf("%#v\n", v)))
-			if plan := si.getQuery(v); plan != nil {
-				if b, err := json.MarshalIndent(plan.ExecPlan, "", "  "); err != nil {
-					response.Write([]byte(err.Error()))
-				} else {
-					response.Write(b)
-				}
-				response.Write(([]byte)("\n\n"))
-			}
+		items := si.queries.Items()
+		response.Header().Set("Content-Type", "application/json; charset=utf-8")
+		plans := make([]queryPlanStatus, 0, len(items))
+		for _, item := range items {
+			plan := item.Value.(*ExecPlan)
+			plans = append(plans, queryPlanStatus{
+				QueryPlan: newQueryPlan(unicoded(item.Key), plan),
+				Plan:      plan.ExecPlan,
+			})
+		}
+		if b, err := json.MarshalIndent(plans, "", "  "); err != nil {
+			response.Write([]byte(err.Error()))
+		} else {
+			response.Write(b)
 		}
 	} else if request.URL.Path == "/debug/query_stats" {
-		keys := si.queries.Keys()
 		response.Header().Set("Content-Type", "application/json; charset=utf-8")
-		qstats := make([]perQueryStats, 0, len(keys))
-		for _, v := range keys {
-			if plan := si.getQuery(v); plan != nil {
-				var pqstats perQueryStats
-				pqstats.Query = unicoded(v)
-				pqstats.Table = plan.TableName
-				pqstats.Plan = plan.PlanId
-				pqstats.QueryCount, pqstats.Time, pqstats.RowCount, pqstats.ErrorCount = plan.Stats()
-				qstats = append(qstats, pqstats)
-			}
-		}
-		if b, err := json.MarshalIndent(qstats, "", "  "); err != nil {
+		if b, err := json.MarshalIndent(si.fingerprintStats(), "", "  "); err != nil {
 			response.Write([]byte(err.Error()))
 		} else {
 			response.Write(b)
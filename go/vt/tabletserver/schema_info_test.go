@@ -0,0 +1,329 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/cache"
+	"github.com/youtube/vitess/go/mysql"
+	"github.com/youtube/vitess/go/pools"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/schema"
+	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+)
+
+func newCachedTableInfo(name string, cachePool *CachePool) *TableInfo {
+	ti := &TableInfo{Table: schema.NewTable(name)}
+	ti.CacheType = schema.CACHE_RW
+	ti.Cache = NewRowCache(ti, cachePool)
+	return ti
+}
+
+func TestRowcacheOverrides(t *testing.T) {
+	cachePool := &CachePool{pool: pools.NewResourcePool(nil, 1, 1, 0)}
+	si := &SchemaInfo{
+		tables: map[string]*TableInfo{
+			"vtocc_ttl":     newCachedTableInfo("vtocc_ttl", cachePool),
+			"vtocc_none":    newCachedTableInfo("vtocc_none", cachePool),
+			"vtocc_default": newCachedTableInfo("vtocc_default", cachePool),
+			"vtocc_other":   newCachedTableInfo("vtocc_other", cachePool),
+		},
+		cachePool:     cachePool,
+		rowcacheOptIn: true,
+	}
+	err := json.Unmarshal([]byte(`[
+		{"Name": "vtocc_ttl", "Cache": {"Type": "RW", "TTL": 60, "MaxRowSize": 100}},
+		{"Name": "vtocc_none", "Cache": {"Type": "NONE"}},
+		{"Name": "vtocc_default", "Cache": {}}
+	]`), &si.overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, ti := range si.tables {
+		si.optOut(ti, name)
+	}
+	si.override()
+
+	ttl := si.tables["vtocc_ttl"]
+	if ttl.CacheType != schema.CACHE_RW || ttl.Cache.ttl != 60 || ttl.Cache.maxDataLen != 100 {
+		t.Errorf("vtocc_ttl: got %v, %+v, want RW with ttl 60 and max row size 100", ttl.CacheType, ttl.Cache)
+	}
+	def := si.tables["vtocc_default"]
+	if def.CacheType != schema.CACHE_RW || def.Cache.ttl != 0 || def.Cache.maxDataLen != MAX_DATA_LEN {
+		t.Errorf("vtocc_default: got %v, %+v, want RW with default options", def.CacheType, def.Cache)
+	}
+	for _, name := range []string{"vtocc_none", "vtocc_other"} {
+		if ti := si.tables[name]; ti.CacheType != schema.CACHE_NONE || ti.Cache != nil {
+			t.Errorf("%s: got %v, want no cache", name, ti.CacheType)
+		}
+	}
+}
+
+func TestEncodeRowMaxDataLen(t *testing.T) {
+	rc := &RowCache{maxDataLen: 4}
+	if b := rc.encodeRow([]sqltypes.Value{sqltypes.MakeString([]byte("ab")), sqltypes.MakeString([]byte("cd"))}); b == nil {
+		t.Errorf("row of 4 bytes was not encoded")
+	}
+	if b := rc.encodeRow([]sqltypes.Value{sqltypes.MakeString([]byte("ab")), sqltypes.MakeString([]byte("cde"))}); b != nil {
+		t.Errorf("row of 5 bytes was encoded: %v", b)
+	}
+}
+
+func TestSameColumns(t *testing.T) {
+	columns := []schema.TableColumn{{Name: "eid", Category: schema.CAT_NUMBER}, {Name: "name", Category: schema.CAT_OTHER}}
+	testcases := []struct {
+		other []schema.TableColumn
+		same  bool
+	}{
+		{[]schema.TableColumn{{Name: "eid", Category: schema.CAT_NUMBER}, {Name: "name", Category: schema.CAT_OTHER}}, true},
+		{[]schema.TableColumn{{Name: "eid", Category: schema.CAT_NUMBER}}, false},
+		{[]schema.TableColumn{{Name: "eid", Category: schema.CAT_NUMBER}, {Name: "name", Category: schema.CAT_VARBINARY}}, false},
+		{[]schema.TableColumn{{Name: "eid", Category: schema.CAT_NUMBER}, {Name: "foo", Category: schema.CAT_OTHER}}, false},
+	}
+	for _, tcase := range testcases {
+		if got := sameColumns(columns, tcase.other); got != tcase.same {
+			t.Errorf("sameColumns(%v): %v, want %v", tcase.other, got, tcase.same)
+		}
+	}
+}
+
+func TestDroppedTables(t *testing.T) {
+	si := &SchemaInfo{tables: map[string]*TableInfo{
+		"dual":       &TableInfo{Table: schema.NewTable("dual")},
+		"vtocc_kept": &TableInfo{Table: schema.NewTable("vtocc_kept")},
+		"vtocc_gone": &TableInfo{Table: schema.NewTable("vtocc_gone")},
+	}}
+	got := si.droppedTables(map[string]bool{"vtocc_kept": true})
+	if len(got) != 1 || got[0] != "vtocc_gone" {
+		t.Errorf("droppedTables: %v, want [vtocc_gone]", got)
+	}
+}
+
+func TestQueryPlans(t *testing.T) {
+	si := &SchemaInfo{queries: cache.NewLRUCache(10)}
+	pkPlan := &ExecPlan{ExecPlan: &planbuilder.ExecPlan{PlanId: planbuilder.PLAN_PK_EQUAL, TableName: "vtocc_cached"}}
+	pkPlan.AddStats(2, 10, 4, 1)
+	si.queries.Set("select pk", pkPlan)
+	si.queries.Set("select all", &ExecPlan{ExecPlan: &planbuilder.ExecPlan{PlanId: planbuilder.PLAN_PASS_SELECT}})
+
+	plans := si.GetQueryPlans()
+	if len(plans) != 2 || plans[0].Sql != "select all" || plans[1].Sql != "select pk" {
+		t.Fatalf("got plans %+v, want select all and select pk", plans)
+	}
+	got, ok := si.GetQueryPlan("select pk")
+	if !ok {
+		t.Fatalf("no plan for select pk")
+	}
+	if got.PlanType != "PK_EQUAL" || got.Table != "vtocc_cached" || got.AvgTime != 5 || got.AvgRows != 2 || got.ErrorCount != 1 {
+		t.Errorf("got plan %+v, want a PK_EQUAL plan of vtocc_cached with its stats", got)
+	}
+	// Inspecting a plan doesn't make it recently used.
+	if plans := si.GetQueryPlans(); plans[0].Sql != "select all" {
+		t.Errorf("got most recent plan %s, want select all", plans[0].Sql)
+	}
+
+	if !si.EvictQueryPlan("select pk") {
+		t.Errorf("EvictQueryPlan(select pk) = false, want true")
+	}
+	if _, ok := si.GetQueryPlan("select pk"); ok {
+		t.Errorf("select pk still has a plan after eviction")
+	}
+	if si.EvictQueryPlan("select pk") {
+		t.Errorf("EvictQueryPlan(select pk) = true for an evicted plan")
+	}
+	si.ClearQueryPlans()
+	if plans := si.GetQueryPlans(); len(plans) != 0 {
+		t.Errorf("got plans %+v after clearing the cache", plans)
+	}
+}
+
+func TestServeEvictQueryPlan(t *testing.T) {
+	si := &SchemaInfo{queries: cache.NewLRUCache(10)}
+	si.queries.Set("select pk", &ExecPlan{ExecPlan: &planbuilder.ExecPlan{PlanId: planbuilder.PLAN_PK_EQUAL}})
+
+	// a GET doesn't evict
+	request, _ := http.NewRequest("GET", "/debug/query_plans/evict?query=select+pk", nil)
+	response := httptest.NewRecorder()
+	si.serveEvictQueryPlan(response, request)
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got code %v, want %v", response.Code, http.StatusMethodNotAllowed)
+	}
+	if _, ok := si.GetQueryPlan("select pk"); !ok {
+		t.Errorf("GET evicted the plan of select pk")
+	}
+
+	form := url.Values{"query": {"select pk"}}
+	request, _ = http.NewRequest("POST", "/debug/query_plans/evict", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	si.serveEvictQueryPlan(response, request)
+	if response.Code != http.StatusOK {
+		t.Errorf("POST: got code %v, want %v", response.Code, http.StatusOK)
+	}
+	if _, ok := si.GetQueryPlan("select pk"); ok {
+		t.Errorf("POST didn't evict the plan of select pk")
+	}
+}
+
+func TestFingerprintStats(t *testing.T) {
+	si := &SchemaInfo{queries: cache.NewLRUCache(10)}
+	for _, tcase := range []struct {
+		sql   string
+		count int64
+	}{
+		{"select * from a where id = 1", 1},
+		{"select * from a where id = 2", 2},
+		{"select * from b", 4},
+	} {
+		plan := &ExecPlan{
+			ExecPlan:    &planbuilder.ExecPlan{PlanId: planbuilder.PLAN_PASS_SELECT},
+			Fingerprint: fingerprintSql(tcase.sql),
+		}
+		plan.AddStats(tcase.count, time.Duration(tcase.count), tcase.count, 0)
+		si.queries.Set(tcase.sql, plan)
+	}
+
+	qstats := si.fingerprintStats()
+	if len(qstats) != 2 {
+		t.Fatalf("got stats %+v, want the stats of 2 fingerprints", qstats)
+	}
+	counts := make(map[string]int64)
+	for _, pqstats := range qstats {
+		counts[pqstats.Fingerprint] = pqstats.QueryCount
+	}
+	if got := counts[fingerprintSql("select * from a where id = 3")]; got != 3 {
+		t.Errorf("query count of the fingerprint of a: %v, want 3", got)
+	}
+	if got := counts[fingerprintSql("select * from b")]; got != 4 {
+		t.Errorf("query count of the fingerprint of b: %v, want 4", got)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	cachePool := &CachePool{pool: pools.NewResourcePool(nil, 1, 1, 0)}
+	ti := newCachedTableInfo("vtocc_cached", cachePool)
+	ti.AddColumn("eid", "int", sqltypes.Value{}, "")
+	ti.AddColumn("name", "varchar", sqltypes.Value{}, "")
+	ti.AddIndex("PRIMARY").AddColumn("eid", 0)
+	ti.Indexes[0].DataColumns = []string{"eid", "name"}
+	ti.PKColumns = []int{0}
+	si := &SchemaInfo{
+		queries:      cache.NewLRUCache(10),
+		tables:       map[string]*TableInfo{"vtocc_cached": ti},
+		rules:        NewQueryRules(),
+		dynamicRules: make(map[string]*QueryRules),
+	}
+	qrs := NewQueryRules()
+	qrs.Add(NewQueryRule("no deletes", "r1", QR_FAIL))
+	qrs.rules[0].AddPlanCond(planbuilder.PLAN_DML_PK)
+	si.SetDynamicRules(QR_SOURCE_HTTP, qrs)
+
+	got := si.ExplainQuery("select eid, name from vtocc_cached where eid = 1")
+	if got.PlanType != "PK_EQUAL" || got.Table != "vtocc_cached" || got.Rowcache != "read" || got.Rules != nil {
+		t.Errorf("pk select: got %+v, want a PK_EQUAL plan that reads the rowcache", got)
+	}
+	got = si.ExplainQuery("delete from vtocc_cached where eid = 1")
+	if got.PlanType != "DML_PK" || got.Rowcache != "invalidate" || len(got.Rules) != 1 || got.Rules[0] != "r1" {
+		t.Errorf("pk delete: got %+v, want a DML_PK plan that invalidates the rowcache, with rule r1", got)
+	}
+	if want := "delete from vtocc_cached where eid = 1"; got.OuterQuery != want {
+		t.Errorf("pk delete: got outer query %q, want %q", got.OuterQuery, want)
+	}
+	if plans := si.GetQueryPlans(); len(plans) != 0 {
+		t.Errorf("got plans %+v after explaining queries, want none", plans)
+	}
+}
+
+func TestDynamicRules(t *testing.T) {
+	si := &SchemaInfo{queries: cache.NewLRUCache(10), dynamicRules: make(map[string]*QueryRules)}
+	si.queries.Set("select all", &ExecPlan{ExecPlan: &planbuilder.ExecPlan{PlanId: planbuilder.PLAN_PASS_SELECT}})
+
+	qrs := NewQueryRules()
+	qrs.Add(NewQueryRule("rule 1", "r1", QR_FAIL))
+	si.SetDynamicRules(QR_SOURCE_TOPO, qrs)
+	si.SetDynamicRules(QR_SOURCE_HTTP, qrs)
+	if plans := si.GetQueryPlans(); len(plans) != 0 {
+		t.Errorf("got plans %+v after setting rules", plans)
+	}
+	// Later changes to qrs don't affect the pushed rules.
+	qrs.Add(NewQueryRule("rule 2", "r2", QR_FAIL))
+	if got := si.GetDynamicRules(QR_SOURCE_TOPO); len(got.rules) != 1 || got.rules[0].Name != "r1" {
+		t.Errorf("got topo rules %+v, want r1", got.rules)
+	}
+	if got := si.dynamicRuleSources(); len(got) != 2 || got[0] != QR_SOURCE_HTTP || got[1] != QR_SOURCE_TOPO {
+		t.Errorf("got sources %v, want [http topo]", got)
+	}
+
+	si.SetDynamicRules(QR_SOURCE_HTTP, NewQueryRules())
+	if got := si.dynamicRuleSources(); len(got) != 1 || got[0] != QR_SOURCE_TOPO {
+		t.Errorf("got sources %v, want [topo]", got)
+	}
+	if got := si.GetDynamicRules(QR_SOURCE_HTTP); len(got.rules) != 0 {
+		t.Errorf("got http rules %+v, want none", got.rules)
+	}
+}
+
+func TestReloadTableInterval(t *testing.T) {
+	si := &SchemaInfo{
+		lastTableReloads: map[string]time.Time{"vtocc_a": time.Now()},
+	}
+	// A table reloaded less than tableReloadInterval ago is not
+	// reloaded, which doesn't need a connection.
+	if si.ReloadTable("vtocc_a") {
+		t.Errorf("ReloadTable of a table that was just reloaded succeeded")
+	}
+}
+
+func TestShowTableQuery(t *testing.T) {
+	want := base_show_tables + " and table_name = 'a\\'b'"
+	if got := showTableQuery("a'b"); got != want {
+		t.Errorf("showTableQuery: %v, want %v", got, want)
+	}
+}
+
+func TestGetPlanMissingTable(t *testing.T) {
+	si := &SchemaInfo{
+		queries: cache.NewLRUCache(10),
+		tables:  map[string]*TableInfo{},
+	}
+	testcases := []struct {
+		sql, missing string
+	}{
+		{"select * from vtocc_a", "vtocc_a"},
+		{"insert into vtocc_b values (1)", "vtocc_b"},
+		{"select * from", ""},
+	}
+	for _, tc := range testcases {
+		_, missing, err := si.getPlan(newSqlQueryStats("test", nil), tc.sql)
+		if err == nil || missing != tc.missing {
+			t.Errorf("getPlan(%v): %v, %v, want %v and an error", tc.sql, missing, err, tc.missing)
+		}
+	}
+}
+
+func TestIsSchemaError(t *testing.T) {
+	testcases := []struct {
+		err    *TabletError
+		schema bool
+	}{
+		{&TabletError{SqlError: mysql.NO_SUCH_TABLE}, true},
+		{&TabletError{SqlError: mysql.BAD_FIELD_ERROR}, true},
+		{&TabletError{SqlError: mysql.WRONG_VALUE_COUNT_ON_ROW}, true},
+		{&TabletError{SqlError: mysql.DUP_ENTRY}, false},
+		{NewTabletError(FAIL, "table vtocc_a not found in schema"), false},
+	}
+	for _, tc := range testcases {
+		if got := isSchemaError(tc.err); got != tc.schema {
+			t.Errorf("isSchemaError(%v): %v, want %v", tc.err, got, tc.schema)
+		}
+	}
+}
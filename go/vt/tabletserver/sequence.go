@@ -0,0 +1,141 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/schema"
+	"github.com/youtube/vitess/go/vt/tableacl"
+	"github.com/youtube/vitess/go/vt/tabletserver/planbuilder"
+)
+
+// Sequence allocates the values of a sequence table. A sequence
+// table is commented as vitess_sequence, and has a single row, with
+// an id of 0. Its next_id column is the first value that was not
+// handed out, and its cache column the number of values reserved
+// at a time:
+//
+//	create table my_seq(id int, next_id bigint, cache bigint, primary key(id)) comment 'vitess_sequence'
+//	insert into my_seq(id, next_id, cache) values(0, 1, 1000)
+//
+// Values are reserved by blocks of cache values, so most allocations
+// don't go to MySQL. The values left in a block are lost when the
+// tablet restarts: the values are increasing, but not contiguous.
+type Sequence struct {
+	mu sync.Mutex
+	// nextVal is the next value to hand out,
+	// and lastVal the end of the reserved block.
+	nextVal, lastVal int64
+}
+
+// execNextVal executes a PLAN_NEXTVAL plan. The result is the
+// first of the allocated values, which are consecutive.
+func (qe *QueryEngine) execNextVal(logStats *SQLQueryStats, plan *compiledPlan) *mproto.QueryResult {
+	count := int64(1)
+	if plan.NextValCount != nil {
+		val, err := resolveValue(&schema.TableColumn{Category: schema.CAT_NUMBER}, plan.NextValCount, plan.BindVars)
+		if err != nil {
+			panic(err)
+		}
+		if count, err = strconv.ParseInt(val.String(), 10, 64); err != nil {
+			panic(NewTabletError(FAIL, "invalid count for nextval: %v", err))
+		}
+	}
+	first := qe.nextVal(logStats, plan.TableInfo, count)
+	return &mproto.QueryResult{
+		Fields:       []mproto.Field{{Name: "nextval", Type: mproto.VT_LONGLONG}},
+		Rows:         [][]sqltypes.Value{{sqltypes.MakeNumeric(strconv.AppendInt(nil, first, 10))}},
+		RowsAffected: 1,
+	}
+}
+
+// NextVal allocates count consecutive values of the sequence
+// table, and returns the first one.
+func (qe *QueryEngine) NextVal(logStats *SQLQueryStats, table string, count int64) int64 {
+	logStats.PlanType = planbuilder.PLAN_NEXTVAL.String()
+	tableInfo := qe.schemaInfo.GetTable(table)
+	if tableInfo == nil || tableInfo.Type != schema.TYPE_SEQUENCE {
+		panic(NewTabletError(FAIL, "%s is not a sequence table", table))
+	}
+	authorized := tableacl.Authorized(table, planbuilder.PLAN_NEXTVAL.MinRole())
+	qe.checkTableAcl(table, planbuilder.PLAN_NEXTVAL, authorized, logStats.context.GetUsername())
+	return qe.nextVal(logStats, tableInfo, count)
+}
+
+func (qe *QueryEngine) nextVal(logStats *SQLQueryStats, tableInfo *TableInfo, count int64) int64 {
+	if count < 1 {
+		panic(NewTabletError(FAIL, "invalid count for nextval: %d", count))
+	}
+	seq := tableInfo.Sequence
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	if seq.nextVal+count > seq.lastVal {
+		seq.nextVal, seq.lastVal = qe.reserveSequence(logStats, tableInfo, count, seq.lastVal)
+	}
+	val := seq.nextVal
+	seq.nextVal += count
+	return val
+}
+
+// reserveSequence reserves a new block of at least count values
+// in the sequence table, after minVal, the end of the previous block.
+func (qe *QueryEngine) reserveSequence(logStats *SQLQueryStats, tableInfo *TableInfo, count, minVal int64) (nextVal, lastVal int64) {
+	conn := getOrPanic(qe.txPool)
+	txid, err := qe.activeTxPool.SafeBegin(conn, logStats.context, 0)
+	if err != nil {
+		conn.Recycle()
+		panic(err)
+	}
+	func() {
+		// The transaction is rolled back if the update fails. If the
+		// commit fails, SafeCommit has already ended it.
+		defer func() {
+			if x := recover(); x != nil {
+				qe.activeTxPool.Rollback(txid)
+				panic(x)
+			}
+		}()
+		nextVal, lastVal = qe.updateSequence(logStats, txid, tableInfo, count, minVal)
+	}()
+	if _, err := qe.activeTxPool.SafeCommit(txid); err != nil {
+		panic(err)
+	}
+	return nextVal, lastVal
+}
+
+func (qe *QueryEngine) updateSequence(logStats *SQLQueryStats, txid int64, tableInfo *TableInfo, count, minVal int64) (nextVal, lastVal int64) {
+	conn := qe.activeTxPool.Get(txid)
+	defer conn.Recycle()
+	qr, err := qe.executeSql(logStats, conn, fmt.Sprintf("select next_id, cache from %s where id = 0 for update", tableInfo.Name), false)
+	if err != nil {
+		panic(err)
+	}
+	if len(qr.Rows) != 1 {
+		panic(NewTabletError(FAIL, "sequence table %s has no row with id 0", tableInfo.Name))
+	}
+	nextVal, err = strconv.ParseInt(qr.Rows[0][0].String(), 10, 64)
+	if err != nil {
+		panic(NewTabletError(FAIL, "invalid next_id in sequence table %s: %v", tableInfo.Name, err))
+	}
+	cache, err := strconv.ParseInt(qr.Rows[0][1].String(), 10, 64)
+	if err != nil || cache < 1 {
+		panic(NewTabletError(FAIL, "invalid cache in sequence table %s: %s", tableInfo.Name, qr.Rows[0][1].String()))
+	}
+	// Values never go back, even if next_id was lowered.
+	if nextVal < minVal {
+		nextVal = minVal
+	}
+	// Reserve whole blocks.
+	lastVal = nextVal + (count+cache-1)/cache*cache
+	if _, err = qe.executeSql(logStats, conn, fmt.Sprintf("update %s set next_id = %d where id = 0", tableInfo.Name, lastVal), false); err != nil {
+		panic(err)
+	}
+	return nextVal, lastVal
+}
@@ -74,10 +74,11 @@ type SqlQuery struct {
 	requests sync.WaitGroup
 	state    sync2.AtomicInt64
 
-	qe        *QueryEngine
-	sessionId int64
-	dbconfig  *dbconfigs.DBConfig
-	mysqld    *mysqlctl.Mysqld
+	qe            *QueryEngine
+	healthChecker *HealthChecker
+	sessionId     int64
+	dbconfig      *dbconfigs.DBConfig
+	mysqld        *mysqlctl.Mysqld
 }
 
 // NewSqlQuery creates an instance of SqlQuery. Only one instance
@@ -85,6 +86,10 @@ type SqlQuery struct {
 func NewSqlQuery(config Config) *SqlQuery {
 	sq := &SqlQuery{}
 	sq.qe = NewQueryEngine(config)
+	sq.healthChecker = NewHealthChecker("HealthCheck", sq, time.Duration(config.HealthCheckInterval*1e9), int64(config.HealthMaxLag))
+	sq.qe.loadThrottler.lag = func() int64 {
+		return sq.healthChecker.Last().SecondsBehindMaster
+	}
 	stats.PublishJSONFunc("Voltron", sq.statsJSON)
 	stats.Publish("TabletState", stats.IntFunc(sq.state.Get))
 	stats.Publish("TabletStateName", stats.StringFunc(sq.GetState))
@@ -101,6 +106,7 @@ func (sq *SqlQuery) GetState() string {
 func (sq *SqlQuery) setState(state int64) {
 	log.Infof("SqlQuery state: %v -> %v", sq.GetState(), stateName[state])
 	sq.state.Set(state)
+	sq.healthChecker.trigger()
 }
 
 // allowQueries starts the query service.
@@ -152,6 +158,7 @@ func (sq *SqlQuery) allowQueries(dbconfig *dbconfigs.DBConfig, schemaOverrides [
 	sq.qe.Open(dbconfig, schemaOverrides, qrs, mysqld)
 	sq.dbconfig = dbconfig
 	sq.mysqld = mysqld
+	sq.healthChecker.setMysqld(mysqld)
 	sq.sessionId = Rand()
 	log.Infof("Session id: %d", sq.sessionId)
 	return nil
@@ -166,6 +173,9 @@ func (sq *SqlQuery) allowQueries(dbconfig *dbconfigs.DBConfig, schemaOverrides [
 // queries to complete. In this state no new requests are allowed.
 // Once all queries are done, it shuts down the query engine
 // and marks the state as NOT_SERVING.
+// If the shutdown grace period is set, the transactions and
+// queries still running after it are killed, and reported in
+// the logs.
 func (sq *SqlQuery) disallowQueries() {
 	// SERVING -> SHUTTING_TX
 	sq.mu.Lock()
@@ -175,8 +185,10 @@ func (sq *SqlQuery) disallowQueries() {
 	}
 	sq.setState(SHUTTING_TX)
 	sq.mu.Unlock()
+	gracePeriod := sq.qe.shutdownGracePeriod.Get()
+	deadline := time.Now().Add(gracePeriod)
 	// Don't hold lock while waiting.
-	sq.qe.WaitForTxEmpty()
+	txKilled, queriesKilled := sq.qe.WaitForTxEmpty(gracePeriod)
 
 	// SHUTTING_TX -> SHUTTING_QUERIES
 	sq.mu.Lock()
@@ -184,8 +196,28 @@ func (sq *SqlQuery) disallowQueries() {
 	sq.mu.Unlock()
 	// Terminate all streaming queries
 	sq.qe.streamQList.TerminateAll()
+	// End the message streams.
+	sq.qe.messager.Close()
 	// Don't hold lock while waiting.
-	sq.requests.Wait()
+	done := make(chan struct{})
+	go func() {
+		sq.requests.Wait()
+		close(done)
+	}()
+	if gracePeriod > 0 {
+		// What's left of the grace period, but
+		// never 0, which means forever.
+		gracePeriod = deadline.Sub(time.Now())
+		if gracePeriod <= 0 {
+			gracePeriod = time.Nanosecond
+		}
+	}
+	waitOrKill(done, gracePeriod, func() {
+		queriesKilled += sq.qe.activePool.KillAll()
+	})
+	if txKilled != 0 || queriesKilled != 0 {
+		log.Warningf("Shutdown grace period of %v expired: killed %d transactions and %d queries", sq.qe.shutdownGracePeriod.Get(), txKilled, queriesKilled)
+	}
 
 	// SHUTTING_QUERIES -> NOT_SERVING
 	sq.mu.Lock()
@@ -232,7 +264,7 @@ func (sq *SqlQuery) Begin(context context.Context, session *proto.Session, txInf
 		return NewTabletError(RETRY, "Invalid session Id %v", session.SessionId)
 	}
 
-	txInfo.TransactionId = sq.qe.Begin(logStats)
+	txInfo.TransactionId = sq.qe.Begin(logStats, time.Duration(session.Timeout))
 	logStats.TransactionID = txInfo.TransactionId
 	return nil
 }
@@ -297,6 +329,179 @@ func (sq *SqlQuery) Rollback(context context.Context, session *proto.Session) (e
 	return nil
 }
 
+// PrepareTransaction prepares the transaction request.TransactionId
+// for the distributed transaction request.Dtid.
+func (sq *SqlQuery) PrepareTransaction(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("PrepareTransaction", context)
+	logStats.OriginalSql = "prepare " + request.Dtid
+	logStats.TransactionID = request.TransactionId
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.PrepareTransaction(logStats, request.TransactionId, request.Dtid)
+	return nil
+}
+
+// CommitPrepared commits the transaction prepared for request.Dtid.
+func (sq *SqlQuery) CommitPrepared(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("CommitPrepared", context)
+	logStats.OriginalSql = "commit prepared " + request.Dtid
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.CommitPrepared(logStats, request.Dtid)
+	return nil
+}
+
+// RollbackPrepared rolls back the transaction prepared for request.Dtid.
+func (sq *SqlQuery) RollbackPrepared(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("RollbackPrepared", context)
+	logStats.OriginalSql = "rollback prepared " + request.Dtid
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.RollbackPrepared(logStats, request.Dtid)
+	return nil
+}
+
+// CreateTransaction saves the transaction record of request.Dtid,
+// with its request.Participants.
+func (sq *SqlQuery) CreateTransaction(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("CreateTransaction", context)
+	logStats.OriginalSql = "create transaction " + request.Dtid
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.CreateTransaction(logStats, request.Dtid, request.Participants)
+	return nil
+}
+
+// StartCommit records the decision to commit request.Dtid, and commits
+// the transaction request.TransactionId with it.
+func (sq *SqlQuery) StartCommit(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("StartCommit", context)
+	logStats.OriginalSql = "start commit " + request.Dtid
+	logStats.TransactionID = request.TransactionId
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.StartCommit(logStats, request.TransactionId, request.Dtid)
+	return nil
+}
+
+// SetRollback records the decision to roll back request.Dtid.
+func (sq *SqlQuery) SetRollback(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("SetRollback", context)
+	logStats.OriginalSql = "set rollback " + request.Dtid
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.SetRollback(logStats, request.Dtid)
+	return nil
+}
+
+// ConcludeTransaction deletes the transaction record of request.Dtid.
+func (sq *SqlQuery) ConcludeTransaction(context context.Context, request *proto.TwoPCRequest) (err error) {
+	logStats := newSqlQueryStats("ConcludeTransaction", context)
+	logStats.OriginalSql = "conclude transaction " + request.Dtid
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.ConcludeTransaction(logStats, request.Dtid)
+	return nil
+}
+
+// ReadAbandoned returns the transaction records older than
+// request.Age, whose coordinator is presumed gone.
+func (sq *SqlQuery) ReadAbandoned(context context.Context, request *proto.AbandonedRequest, reply *proto.AbandonedResult) (err error) {
+	logStats := newSqlQueryStats("ReadAbandoned", context)
+	logStats.OriginalSql = "read abandoned"
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	reply.Transactions = sq.qe.ReadAbandoned(logStats, time.Duration(request.Age))
+	return nil
+}
+
+// ReplicationPosition returns the position up to which MySQL applied
+// transactions: the master position on a master, the executed
+// position on a slave. vtgate compares them for read-after-write
+// consistency.
+func (sq *SqlQuery) ReplicationPosition(context context.Context, session *proto.Session, reply *proto.ReplicationPositionResult) (err error) {
+	logStats := newSqlQueryStats("ReplicationPosition", context)
+	if err = sq.startRequest(session.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	rp, err := sq.mysqld.SlaveStatus()
+	if err == mysqlctl.ErrNotSlave {
+		rp, err = sq.mysqld.MasterStatus()
+	}
+	if err != nil {
+		panic(NewTabletError(FAIL, "cannot read the replication position: %v", err))
+	}
+	reply.Position = rp.MasterLogGTIDField
+	return nil
+}
+
+// ReserveConnection reserves a connection for the session state of
+// the client, like its user variables and SET statements. The queries
+// executed with reply.ReservedId run on that connection.
+func (sq *SqlQuery) ReserveConnection(context context.Context, session *proto.Session, reply *proto.ReservedSession) (err error) {
+	logStats := newSqlQueryStats("ReserveConnection", context)
+	logStats.OriginalSql = "reserve"
+	if err = sq.startRequest(session.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	reply.SessionId = session.SessionId
+	reply.ReservedId = sq.qe.ReserveConnection(logStats, session.SessionId)
+	return nil
+}
+
+// ReleaseConnection releases the reserved connection
+// request.ReservedId, and discards its session state.
+func (sq *SqlQuery) ReleaseConnection(context context.Context, request *proto.ReservedSession) (err error) {
+	logStats := newSqlQueryStats("ReleaseConnection", context)
+	logStats.OriginalSql = "release"
+	if err = sq.startRequest(request.SessionId, true); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+
+	sq.qe.ReleaseConnection(logStats, request.SessionId, request.ReservedId)
+	return nil
+}
+
 // handleExecError handles panics during query execution and sets
 // the supplied error return value.
 func handleExecError(query *proto.Query, err *error, logStats *SQLQueryStats) {
@@ -314,7 +519,7 @@ func handleExecError(query *proto.Query, err *error, logStats *SQLQueryStats) {
 		*err = terr
 		terr.RecordStats()
 		// suppress these errors in logs
-		if terr.ErrorType == RETRY || terr.ErrorType == TX_POOL_FULL || terr.SqlError == mysql.DUP_ENTRY {
+		if terr.ErrorType == RETRY || terr.ErrorType == TX_POOL_FULL || terr.ErrorType == QUOTA_EXCEEDED || terr.SqlError == mysql.DUP_ENTRY {
 			return
 		}
 		if terr.ErrorType == FATAL {
@@ -325,16 +530,31 @@ func handleExecError(query *proto.Query, err *error, logStats *SQLQueryStats) {
 	}
 }
 
+// acquireCallerQuota counts the request of logStats against the
+// quotas of its effective caller, and returns the function that
+// releases it. It panics if the caller is over its quotas.
+func (sq *SqlQuery) acquireCallerQuota(logStats *SQLQueryStats) func() {
+	name, err := sq.qe.callerQuotas.Acquire(logStats.EffectiveCaller())
+	if err != nil {
+		panic(err)
+	}
+	return func() { sq.qe.callerQuotas.Release(name) }
+}
+
 // Execute executes the query and returns the result as response.
 func (sq *SqlQuery) Execute(context context.Context, query *proto.Query, reply *mproto.QueryResult) (err error) {
 	logStats := newSqlQueryStats("Execute", context)
 	logStats.TransactionID = query.TransactionId
+	logStats.queryTimeout = time.Duration(query.Timeout)
+	logStats.callerID = query.CallerId
 	allowShutdown := (query.TransactionId != 0)
 	if err = sq.startRequest(query.SessionId, allowShutdown); err != nil {
 		return err
 	}
 	defer sq.endRequest()
+	defer recordCallerStats(logStats, &err)
 	defer handleExecError(query, &err, logStats)
+	defer sq.acquireCallerQuota(logStats)()
 
 	*reply = *sq.qe.Execute(logStats, query)
 	return nil
@@ -350,11 +570,15 @@ func (sq *SqlQuery) StreamExecute(context context.Context, query *proto.Query, s
 	}
 
 	logStats := newSqlQueryStats("StreamExecute", context)
+	logStats.queryTimeout = time.Duration(query.Timeout)
+	logStats.callerID = query.CallerId
 	if err = sq.startRequest(query.SessionId, false); err != nil {
 		return err
 	}
 	defer sq.endRequest()
+	defer recordCallerStats(logStats, &err)
 	defer handleExecError(query, &err, logStats)
+	defer sq.acquireCallerQuota(logStats)()
 	sq.qe.StreamExecute(logStats, query, sendReply)
 	return nil
 }
@@ -410,6 +634,8 @@ func (sq *SqlQuery) ExecuteBatch(context context.Context, queryList *proto.Query
 				BindVariables: bound.BindVariables,
 				TransactionId: session.TransactionId,
 				SessionId:     session.SessionId,
+				Timeout:       queryList.Timeout,
+				CallerId:      queryList.CallerId,
 			}
 			var localReply mproto.QueryResult
 			if err = sq.Execute(context, &query, &localReply); err != nil {
@@ -428,6 +654,141 @@ func (sq *SqlQuery) ExecuteBatch(context context.Context, queryList *proto.Query
 	return nil
 }
 
+// Prepare builds the plan of request.Sql and registers it as a
+// prepared statement, which can be executed by ExecutePrepared
+// until it's closed by ClosePrepared.
+func (sq *SqlQuery) Prepare(context context.Context, request *proto.PrepareRequest, reply *proto.PreparedStatement) (err error) {
+	logStats := newSqlQueryStats("Prepare", context)
+	if err = sq.startRequest(request.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+	reply.StatementId = sq.qe.Prepare(logStats, request.SessionId, request.Sql)
+	reply.SessionId = request.SessionId
+	return nil
+}
+
+// ExplainQuery returns the plan of request.Sql, without executing
+// it, so developers can check how their queries will be treated.
+func (sq *SqlQuery) ExplainQuery(context context.Context, request *proto.ExplainRequest, reply *proto.QueryExplanation) (err error) {
+	logStats := newSqlQueryStats("ExplainQuery", context)
+	if err = sq.startRequest(request.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+	*reply = sq.qe.ExplainQuery(logStats, request.Sql)
+	return nil
+}
+
+// ExecutePrepared executes a prepared statement and returns
+// the result as response.
+func (sq *SqlQuery) ExecutePrepared(context context.Context, query *proto.PreparedQuery, reply *mproto.QueryResult) (err error) {
+	logStats := newSqlQueryStats("ExecutePrepared", context)
+	logStats.TransactionID = query.TransactionId
+	logStats.queryTimeout = time.Duration(query.Timeout)
+	logStats.callerID = query.CallerId
+	allowShutdown := (query.TransactionId != 0)
+	if err = sq.startRequest(query.SessionId, allowShutdown); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer recordCallerStats(logStats, &err)
+	defer handleError(&err, logStats)
+	defer sq.acquireCallerQuota(logStats)()
+	*reply = *sq.qe.ExecutePrepared(logStats, query)
+	return nil
+}
+
+// ClosePrepared drops a prepared statement.
+func (sq *SqlQuery) ClosePrepared(context context.Context, statement *proto.PreparedStatement) (err error) {
+	logStats := newSqlQueryStats("ClosePrepared", context)
+	defer handleError(&err, nil)
+	sq.qe.ClosePrepared(logStats, statement.SessionId, statement.StatementId)
+	return nil
+}
+
+// NextVal allocates request.Count consecutive values of the sequence
+// table request.Sequence, and returns the first one. Like "select
+// nextval(count) from sequence", but without the query.
+func (sq *SqlQuery) NextVal(context context.Context, request *proto.NextValRequest, reply *proto.NextValResult) (err error) {
+	logStats := newSqlQueryStats("NextVal", context)
+	logStats.OriginalSql = request.Sequence
+	if err = sq.startRequest(request.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+	reply.Value = sq.qe.NextVal(logStats, request.Sequence, request.Count)
+	return nil
+}
+
+// MessageStream streams the messages of the message table
+// request.Name, until the query service stops.
+func (sq *SqlQuery) MessageStream(context context.Context, request *proto.MessageStreamRequest, sendReply func(*mproto.QueryResult) error) (err error) {
+	logStats := newSqlQueryStats("MessageStream", context)
+	if err = sq.startRequest(request.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+	sq.qe.MessageStream(logStats, request.Name, sendReply)
+	return nil
+}
+
+// MessageAck acks the messages request.Ids of the message table
+// request.Name.
+func (sq *SqlQuery) MessageAck(context context.Context, request *proto.MessageAckRequest, reply *proto.MessageAckResult) (err error) {
+	logStats := newSqlQueryStats("MessageAck", context)
+	if err = sq.startRequest(request.SessionId, false); err != nil {
+		return err
+	}
+	defer sq.endRequest()
+	defer handleError(&err, logStats)
+	reply.Count = sq.qe.MessageAck(logStats, request.Name, request.Ids)
+	return nil
+}
+
+// StreamHealth streams the results of the health checks of the
+// tablet, starting with the last one. It works in every state, so
+// the subscribers see when the tablet stops serving.
+func (sq *SqlQuery) StreamHealth(context context.Context, sendReply func(*proto.HealthStats) error) (err error) {
+	logStats := newSqlQueryStats("StreamHealth", context)
+	defer handleError(&err, logStats)
+	sq.healthChecker.StreamHealth(sendReply)
+	return nil
+}
+
+// GetQueryPlans returns the plans of the query plan cache. If
+// request.Sql is set, only the plan of that query is returned.
+func (sq *SqlQuery) GetQueryPlans(context context.Context, request *proto.QueryPlanRequest, reply *proto.QueryPlanList) (err error) {
+	if request.Sql == "" {
+		reply.Plans = sq.qe.schemaInfo.GetQueryPlans()
+		return nil
+	}
+	plan, ok := sq.qe.schemaInfo.GetQueryPlan(request.Sql)
+	if !ok {
+		return NewTabletError(FAIL, "Query plan not found: %s", request.Sql)
+	}
+	reply.Plans = []proto.QueryPlan{plan}
+	return nil
+}
+
+// EvictQueryPlan removes the plan of request.Sql from the query plan cache.
+func (sq *SqlQuery) EvictQueryPlan(context context.Context, request *proto.QueryPlanRequest) (err error) {
+	if !sq.qe.schemaInfo.EvictQueryPlan(request.Sql) {
+		return NewTabletError(FAIL, "Query plan not found: %s", request.Sql)
+	}
+	return nil
+}
+
+// ClearQueryPlans empties the query plan cache.
+func (sq *SqlQuery) ClearQueryPlans(context context.Context) (err error) {
+	sq.qe.schemaInfo.ClearQueryPlans()
+	return nil
+}
+
 // statsJSON is used to export SqlQuery status variables into expvar.
 func (sq *SqlQuery) statsJSON() string {
 	buf := bytes.NewBuffer(make([]byte, 0, 128))
@@ -439,10 +800,13 @@ func (sq *SqlQuery) statsJSON() string {
 	fmt.Fprintf(buf, "\n \"ConnPool\": %v,", sq.qe.connPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"StreamConnPool\": %v,", sq.qe.streamConnPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"TxPool\": %v,", sq.qe.txPool.StatsJSON())
+	fmt.Fprintf(buf, "\n \"BatchConnPool\": %v,", sq.qe.batchConnPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"ActiveTxPool\": %v,", sq.qe.activeTxPool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"ActivePool\": %v,", sq.qe.activePool.StatsJSON())
 	fmt.Fprintf(buf, "\n \"MaxResultSize\": %v,", sq.qe.maxResultSize.Get())
-	fmt.Fprintf(buf, "\n \"StreamBufferSize\": %v", sq.qe.streamBufferSize.Get())
+	fmt.Fprintf(buf, "\n \"MaxResultBytes\": %v,", sq.qe.maxResultBytes.Get())
+	fmt.Fprintf(buf, "\n \"StreamBufferSize\": %v,", sq.qe.streamBufferSize.Get())
+	fmt.Fprintf(buf, "\n \"StreamBufferRows\": %v", sq.qe.streamBufferRows.Get())
 	fmt.Fprintf(buf, "\n}")
 	return buf.String()
 }
@@ -6,9 +6,11 @@ package tabletserver
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
 	"net/url"
+	"reflect"
 	"strings"
 	"time"
 
@@ -16,10 +18,16 @@ import (
 	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/streamlog"
 	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/sqlparser"
 )
 
 var SqlQueryLogger = streamlog.New("SqlQuery", 50)
 
+var (
+	redactQueryLog     = flag.Bool("redact-query-log", false, "don't show the values of the queries in the query logs: the SQL is normalized, and only the types of the bind variables are shown")
+	slowQueryThreshold = flag.Duration("slow-query-threshold", time.Second, "default duration above which queries are shown in the slow query log, can be changed with the threshold parameter of the log URL")
+)
+
 const (
 	QUERY_SOURCE_ROWCACHE = 1 << iota
 	QUERY_SOURCE_CONSOLIDATOR
@@ -46,6 +54,27 @@ type SQLQueryStats struct {
 	Rows                 [][]sqltypes.Value
 	TransactionID        int64
 	context              context.Context
+	// queryTimeout, if non-zero, overrides the query timeout
+	// for the MySQL queries issued on behalf of the request.
+	queryTimeout time.Duration
+	// batch is set for the requests that run in the batch pool.
+	batch bool
+	// maxRows, if non-zero, lowers the maximum number of rows
+	// of the result of the request.
+	maxRows int64
+	// skipRowcache is set for the requests that must read
+	// their rows from MySQL.
+	skipRowcache bool
+	// priority is the priority of the request when MySQL is
+	// overloaded, set by its directives. It can only lower the
+	// priority of its caller, empty means the same.
+	priority string
+	// table is the table of the plan, if any.
+	table *TableInfo
+	// callerID is the effective caller sent by the client, if any.
+	callerID string
+	// fingerprint is the fingerprint hash of the plan, if any.
+	fingerprint string
 }
 
 func newSqlQueryStats(methodName string, context context.Context) *SQLQueryStats {
@@ -113,6 +142,32 @@ func (stats *SQLQueryStats) FmtBindVariables(full bool) string {
 			}
 		}
 	}
+	return stats.marshalBindVariables(out)
+}
+
+// redactedBindVariables is like FmtBindVariables, but never reports
+// a value: only the type of every bind variable, with the length of
+// the strings, byte slices and lists.
+func (stats *SQLQueryStats) redactedBindVariables() string {
+	out := make(map[string]interface{})
+	for k, v := range stats.BindVariables {
+		switch val := v.(type) {
+		case string:
+			out[k] = fmt.Sprintf("string %v", len(val))
+		case []byte:
+			out[k] = fmt.Sprintf("bytes %v", len(val))
+		default:
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+				out[k] = fmt.Sprintf("list %v", rv.Len())
+			} else {
+				out[k] = fmt.Sprintf("%T", v)
+			}
+		}
+	}
+	return stats.marshalBindVariables(out)
+}
+
+func (stats *SQLQueryStats) marshalBindVariables(out map[string]interface{}) string {
 	b, err := json.Marshal(out)
 	if err != nil {
 		log.Warningf("could not marshal %q", stats.BindVariables)
@@ -153,15 +208,90 @@ func (log *SQLQueryStats) Username() string {
 	return log.context.GetUsername()
 }
 
+// ImmediateCaller returns the authenticated user that sent
+// the request.
+func (log *SQLQueryStats) ImmediateCaller() string {
+	return log.Username()
+}
+
+// EffectiveCaller returns the caller the request is executed for:
+// the caller id sent by the client, or the immediate caller if
+// there is none. Per-caller stats and quotas use it.
+func (log *SQLQueryStats) EffectiveCaller() string {
+	if log.callerID != "" {
+		return log.callerID
+	}
+	return log.ImmediateCaller()
+}
+
 func (log *SQLQueryStats) ContextHTML() template.HTML {
 	return log.context.HTML()
 }
 
+// NormalizedSql returns the original SQL with the values replaced
+// by '?', so queries that only differ by their values can be grouped.
+func (stats *SQLQueryStats) NormalizedSql() string {
+	return sqlparser.Normalize(stats.OriginalSql)
+}
+
+// Fingerprint returns the hash of the fingerprint of the original SQL,
+// so the logs of queries that only differ by their values can be
+// deduplicated. It's the one computed with the plan of the query, or
+// the hash of the normalized SQL if the query has no plan, so that
+// logging never parses the query.
+func (stats *SQLQueryStats) Fingerprint() string {
+	if stats.fingerprint != "" {
+		return stats.fingerprint
+	}
+	return sqlparser.FingerprintHash(sqlparser.Normalize(stats.OriginalSql))
+}
+
+// fingerprintSql returns the hash of the fingerprint of sql, or of its
+// normalized form if it can't be parsed. It parses sql: it's computed
+// once per plan.
+func fingerprintSql(sql string) string {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return sqlparser.FingerprintHash(sqlparser.Normalize(sql))
+	}
+	return sqlparser.FingerprintHash(sqlparser.Fingerprint(stmt))
+}
+
+// LoggedSql returns the SQL to show in the query logs: the
+// redacted SQL if -redact-query-log is set, the original otherwise.
+func (stats *SQLQueryStats) LoggedSql() string {
+	if *redactQueryLog {
+		return sqlparser.Redact(stats.OriginalSql)
+	}
+	return stats.OriginalSql
+}
+
+// redactedRewrittenSql is like RewrittenSql, with the values
+// of the statements redacted.
+func (stats *SQLQueryStats) redactedRewrittenSql() string {
+	redacted := make([]string, len(stats.rewrittenSqls))
+	for i, sql := range stats.rewrittenSqls {
+		redacted[i] = sqlparser.Redact(sql)
+	}
+	return strings.Join(redacted, "; ")
+}
+
 // String returns a tab separated list of logged fields.
+// If -redact-query-log is set, the SQL is redacted, only the
+// types of the bind variables are shown, and the full parameter
+// is ignored.
 func (log *SQLQueryStats) Format(params url.Values) string {
 	_, fullBindParams := params["full"]
+	rewrittenSql := log.RewrittenSql()
+	bindVariables := log.FmtBindVariables(fullBindParams)
+	normalizedSql := log.NormalizedSql()
+	if *redactQueryLog {
+		rewrittenSql = log.redactedRewrittenSql()
+		bindVariables = log.redactedBindVariables()
+		normalizedSql = log.LoggedSql()
+	}
 	return fmt.Sprintf(
-		"%v\t%v\t%v\t%v\t%v\t%.6f\t%v\t%q\t%v\t%v\t%q\t%v\t%.6f\t%.6f\t%v\t%v\t%v\t%v\t%v\t\n",
+		"%v\t%v\t%v\t%v\t%v\t%.6f\t%v\t%q\t%v\t%v\t%q\t%v\t%.6f\t%.6f\t%v\t%v\t%v\t%v\t%v\t%v\t%q\t%v\t%v\t\n",
 		log.Method,
 		log.RemoteAddr(),
 		log.Username(),
@@ -169,10 +299,10 @@ func (log *SQLQueryStats) Format(params url.Values) string {
 		log.EndTime.Format(time.StampMicro),
 		log.TotalTime().Seconds(),
 		log.PlanType,
-		log.OriginalSql,
-		log.FmtBindVariables(fullBindParams),
+		log.LoggedSql(),
+		bindVariables,
 		log.NumberOfQueries,
-		log.RewrittenSql(),
+		rewrittenSql,
 		log.FmtQuerySources(),
 		log.MysqlResponseTime.Seconds(),
 		log.WaitingForConnection.Seconds(),
@@ -180,5 +310,24 @@ func (log *SQLQueryStats) Format(params url.Values) string {
 		log.CacheHits,
 		log.CacheMisses,
 		log.CacheAbsent,
-		log.CacheInvalidations)
+		log.CacheInvalidations,
+		log.RowsAffected,
+		normalizedSql,
+		log.EffectiveCaller(),
+		log.Fingerprint())
+}
+
+// slowQueryFmter formats only the queries that took longer than the
+// threshold parameter (a duration like "500ms"), or -slow-query-threshold.
+func slowQueryFmter(fmter func(url.Values, interface{}) string) func(url.Values, interface{}) string {
+	return func(params url.Values, val interface{}) string {
+		threshold := *slowQueryThreshold
+		if t, err := time.ParseDuration(params.Get("threshold")); err == nil {
+			threshold = t
+		}
+		if stats, ok := val.(*SQLQueryStats); ok && stats.TotalTime() < threshold {
+			return ""
+		}
+		return fmter(params, val)
+	}
 }
@@ -0,0 +1,79 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestSQLQueryStatsFormat(t *testing.T) {
+	logStats := newSqlQueryStats("Execute", &context.DummyContext{})
+	logStats.OriginalSql = "select * from a where b = 'secret'"
+	logStats.AddRewrittenSql("select * from a where b = 'secret' limit 10001")
+	logStats.BindVariables = map[string]interface{}{
+		"c": "secret",
+		"d": int64(12345),
+		"e": []byte("secret"),
+		"f": []interface{}{int64(67890), "secret"},
+	}
+	logStats.RowsAffected = 3
+	logStats.EndTime = logStats.StartTime.Add(2 * time.Second)
+
+	full := url.Values{"full": []string{"true"}}
+	got := logStats.Format(full)
+	fields := strings.Split(got, "\t")
+	if fields[19] != "3" || fields[20] != `"select * from a where b = ?"` {
+		t.Errorf("rows and normalized sql: got %q", got)
+	}
+	if want := sqlparser.FingerprintHash("select * from a where b = ?"); fields[22] != want {
+		t.Errorf("fingerprint: got %q, want %q", fields[22], want)
+	}
+	if !strings.Contains(got, "secret") {
+		t.Errorf("full log doesn't contain the values: %q", got)
+	}
+	// the fingerprint of the plan is used when there's one
+	logStats.fingerprint = "0123456789abcdef"
+	if fields := strings.Split(logStats.Format(full), "\t"); fields[22] != "0123456789abcdef" {
+		t.Errorf("fingerprint of the plan: got %q, want 0123456789abcdef", fields[22])
+	}
+	logStats.fingerprint = ""
+
+	*redactQueryLog = true
+	defer func() { *redactQueryLog = false }()
+	got = logStats.Format(full)
+	for _, value := range []string{"secret", "12345", "67890"} {
+		if strings.Contains(got, value) {
+			t.Errorf("redacted log contains the value %v: %q", value, got)
+		}
+	}
+	fields = strings.Split(got, "\t")
+	if want := `{"c":"string 6","d":"int64","e":"bytes 6","f":"list 2"}`; fields[8] != want {
+		t.Errorf("redacted bind variables: got %q, want %q", fields[8], want)
+	}
+
+	logStats.OriginalSql = "select * from a where b = 'secret"
+	got = logStats.Format(full)
+	if strings.Contains(got, "secret") {
+		t.Errorf("redacted log of an unnormalizable query contains the values: %q", got)
+	}
+	if fields = strings.Split(got, "\t"); fields[7] != fmt.Sprintf("%q", sqlparser.RedactedSql) {
+		t.Errorf("redacted unnormalizable query: got %v, want %q", fields[7], sqlparser.RedactedSql)
+	}
+
+	fmter := slowQueryFmter(func(url.Values, interface{}) string { return "logged" })
+	if got := fmter(url.Values{}, logStats); got != "logged" {
+		t.Errorf("2s query with the default threshold: got %q, want logged", got)
+	}
+	if got := fmter(url.Values{"threshold": []string{"3s"}}, logStats); got != "" {
+		t.Errorf("2s query with a 3s threshold: got %q, want nothing", got)
+	}
+}
@@ -19,6 +19,17 @@ import (
 type TableInfo struct {
 	*schema.Table
 	Cache *RowCache
+	// Sequence allocates the values of sequence tables.
+	Sequence *Sequence
+	// Message is the configuration of message tables.
+	Message *MessageInfo
+	// maxResultSize and maxResultBytes are the result limits
+	// set by the schema override of the table. 0 means the
+	// limits of the query service.
+	maxResultSize, maxResultBytes int64
+	// noLockRetries disables the retries of the autocommit
+	// DMLs of the table that fail on lock errors.
+	noLockRetries bool
 	// stats updated by sqlquery.go
 	hits, absent, misses, invalidations sync2.AtomicInt64
 }
@@ -28,6 +39,8 @@ func NewTableInfo(conn dbconnpool.PoolConnection, tableName string, tableType st
 	if err != nil {
 		return nil, err
 	}
+	ti.initSequence(comment)
+	ti.initMessage(comment)
 	ti.initRowCache(conn, tableType, createTime, comment, cachePool)
 	return ti, nil
 }
@@ -122,11 +135,54 @@ func (ti *TableInfo) fetchIndexes(conn dbconnpool.PoolConnection) error {
 	return nil
 }
 
+func (ti *TableInfo) initSequence(comment string) {
+	if !strings.Contains(comment, "vitess_sequence") {
+		return
+	}
+	for _, col := range []string{"id", "next_id", "cache"} {
+		if ti.FindColumn(col) == -1 {
+			log.Warningf("Sequence table %s has no %s column. Will not be used as sequence.", ti.Name, col)
+			return
+		}
+	}
+	ti.Type = schema.TYPE_SEQUENCE
+	ti.Sequence = &Sequence{}
+}
+
+func (ti *TableInfo) initMessage(comment string) {
+	if !strings.Contains(comment, "vitess_message") {
+		return
+	}
+	for _, col := range []string{"id", "time_next", "epoch", "time_created", "time_acked", "message"} {
+		if ti.FindColumn(col) == -1 {
+			log.Warningf("Message table %s has no %s column. Will not be used as message table.", ti.Name, col)
+			return
+		}
+	}
+	info, err := parseMessageInfo(comment)
+	if err != nil {
+		log.Warningf("Message table %s: %v. Will not be used as message table.", ti.Name, err)
+		return
+	}
+	ti.Type = schema.TYPE_MESSAGE
+	ti.Message = info
+}
+
 func (ti *TableInfo) initRowCache(conn dbconnpool.PoolConnection, tableType string, createTime sqltypes.Value, comment string, cachePool *CachePool) {
 	if cachePool.IsClosed() {
 		return
 	}
 
+	if ti.Type == schema.TYPE_SEQUENCE {
+		log.Infof("%s is a sequence table. Will not be cached.", ti.Name)
+		return
+	}
+
+	if ti.Type == schema.TYPE_MESSAGE {
+		log.Infof("%s is a message table. Will not be cached.", ti.Name)
+		return
+	}
+
 	if strings.Contains(comment, "vtocc_nocache") {
 		log.Infof("%s commented as vtocc_nocache. Will not be cached.", ti.Name)
 		return
@@ -0,0 +1,52 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+var (
+	// tableQueries and tableErrors are the per-table query
+	// latencies, by table and plan, and errors, by table.
+	tableQueries *stats.MultiTimings
+	tableErrors  *stats.Counters
+	// TableErrorRates are the per-table error rates.
+	TableErrorRates *stats.Rates
+)
+
+// latencyPercentiles are the percentiles of the query
+// latencies that are published for the dashboards.
+var latencyPercentiles = []float64{50, 95, 99}
+
+// recordTableStats records a query of plan on table that took
+// duration, and failed if failed is set. Queries without a
+// table, like joins, are recorded under Join.
+func recordTableStats(table, plan string, duration time.Duration, failed bool) {
+	if table == "" {
+		table = "Join"
+	}
+	tableQueries.Add([]string{table, plan}, duration)
+	if failed {
+		tableErrors.Add(table, 1)
+	}
+}
+
+// timingsPercentiles returns the latencyPercentiles of the
+// histograms of t, in nanoseconds, by histogram name and
+// percentile (p50, p95 and p99). The percentiles are upper
+// bounds: the cutoffs of the buckets they fall in.
+func timingsPercentiles(t *stats.Timings) map[string]int64 {
+	percentiles := make(map[string]int64)
+	for name, hist := range t.Histograms() {
+		for _, p := range latencyPercentiles {
+			percentiles[fmt.Sprintf("%s.p%v", name, p)] = hist.Percentile(p)
+		}
+	}
+	return percentiles
+}
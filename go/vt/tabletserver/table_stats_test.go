@@ -0,0 +1,50 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+)
+
+func TestRecordTableStats(t *testing.T) {
+	savedQueries, savedErrors := tableQueries, tableErrors
+	defer func() { tableQueries, tableErrors = savedQueries, savedErrors }()
+	tableQueries = stats.NewMultiTimings("", []string{"Table", "Plan"})
+	tableErrors = stats.NewCounters("")
+
+	for i := 0; i < 99; i++ {
+		recordTableStats("a", "PK_EQUAL", time.Millisecond, false)
+	}
+	recordTableStats("a", "PK_EQUAL", time.Second, true)
+	recordTableStats("", "PASS_SELECT", time.Millisecond, true)
+
+	percentiles := timingsPercentiles(&tableQueries.Timings)
+	want := map[string]int64{
+		"a.PK_EQUAL.p50":       int64(time.Millisecond),
+		"a.PK_EQUAL.p95":       int64(time.Millisecond),
+		"a.PK_EQUAL.p99":       int64(time.Millisecond),
+		"Join.PASS_SELECT.p50": int64(time.Millisecond),
+		"Join.PASS_SELECT.p95": int64(time.Millisecond),
+		"Join.PASS_SELECT.p99": int64(time.Millisecond),
+	}
+	if len(percentiles) != len(want) {
+		t.Errorf("percentiles: %v, want %v", percentiles, want)
+	}
+	for k, v := range want {
+		if percentiles[k] != v {
+			t.Errorf("percentiles[%s]: %d, want %d", k, percentiles[k], v)
+		}
+	}
+	recordTableStats("a", "PK_EQUAL", time.Second, false)
+	if p := timingsPercentiles(&tableQueries.Timings)["a.PK_EQUAL.p99"]; p != int64(time.Second) {
+		t.Errorf("p99 after 2 slow queries: %d, want %d", p, int64(time.Second))
+	}
+	if counts := tableErrors.Counts(); counts["a"] != 1 || counts["Join"] != 1 {
+		t.Errorf("table errors: %v, want a:1 Join:1", counts)
+	}
+}
@@ -19,6 +19,13 @@ const (
 	FATAL
 	TX_POOL_FULL
 	NOT_IN_TX
+	PERMISSION_DENIED
+	// RESULT_TOO_LARGE means the result exceeded the
+	// max result size or bytes: the query did not fail.
+	RESULT_TOO_LARGE
+	// QUOTA_EXCEEDED means the effective caller of the
+	// query is over its concurrency or QPS quota.
+	QUOTA_EXCEEDED
 )
 
 type TabletError struct {
@@ -57,6 +64,24 @@ func NewTabletErrorSql(errorType int, err error) *TabletError {
 	}
 }
 
+// isRowCountExceeded returns true if err is the error returned
+// by ExecuteFetch for results with more rows than maxrows.
+// Unlike MySQL errors, it has no error number.
+func isRowCountExceeded(err error) bool {
+	sqlErr, ok := err.(hasNumber)
+	return ok && sqlErr.Number() == 0 && strings.HasPrefix(err.Error(), "Row count exceeded")
+}
+
+// isSchemaError returns true if te is a MySQL error that
+// means the schema of the table is not the one we know.
+func isSchemaError(te *TabletError) bool {
+	switch te.SqlError {
+	case mysql.NO_SUCH_TABLE, mysql.BAD_FIELD_ERROR, mysql.WRONG_VALUE_COUNT_ON_ROW:
+		return true
+	}
+	return false
+}
+
 func (te *TabletError) Error() string {
 	format := "error: %s"
 	switch te.ErrorType {
@@ -68,6 +93,12 @@ func (te *TabletError) Error() string {
 		format = "tx_pool_full: %s"
 	case NOT_IN_TX:
 		format = "not_in_tx: %s"
+	case PERMISSION_DENIED:
+		format = "permission_denied: %s"
+	case RESULT_TOO_LARGE:
+		format = "result_too_large: %s"
+	case QUOTA_EXCEEDED:
+		format = "quota_exceeded: %s"
 	}
 	return fmt.Sprintf(format, te.Message)
 }
@@ -82,6 +113,12 @@ func (te *TabletError) RecordStats() {
 		errorStats.Add("TxPoolFull", 1)
 	case NOT_IN_TX:
 		errorStats.Add("NotInTx", 1)
+	case PERMISSION_DENIED:
+		errorStats.Add("PermissionDenied", 1)
+	case RESULT_TOO_LARGE:
+		errorStats.Add("ResultTooLarge", 1)
+	case QUOTA_EXCEEDED:
+		errorStats.Add("QuotaExceeded", 1)
 	default:
 		switch te.SqlError {
 		case mysql.DUP_ENTRY:
@@ -108,7 +145,7 @@ func handleError(err *error, logStats *SQLQueryStats) {
 		}
 		*err = terr
 		terr.RecordStats()
-		if terr.ErrorType == RETRY { // Retry errors are too spammy
+		if terr.ErrorType == RETRY || terr.ErrorType == QUOTA_EXCEEDED { // these errors are too spammy
 			return
 		}
 		log.Errorf("%v", terr)
@@ -11,6 +11,7 @@ import (
 	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/context"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -21,6 +22,9 @@ const (
 	ERR_FATAL
 	ERR_TX_POOL_FULL
 	ERR_NOT_IN_TX
+	ERR_PERMISSION_DENIED
+	ERR_RESULT_TOO_LARGE
+	ERR_QUOTA_EXCEEDED
 )
 
 const (
@@ -75,6 +79,10 @@ type TabletConn interface {
 	Commit(context context.Context, transactionId int64) error
 	Rollback(context context.Context, transactionId int64) error
 
+	// StreamHealth streams the results of the health checks of
+	// vttablet, until the connection is closed.
+	StreamHealth(context context.Context) (<-chan *tproto.HealthStats, ErrFunc)
+
 	// Close must be called for releasing resources.
 	Close()
 
@@ -84,6 +92,47 @@ type TabletConn interface {
 
 type ErrFunc func() error
 
+// TwoPCConn is implemented by the TabletConn whose vttablet can take
+// part in two-phase commits, see tabletserver.TwoPC.
+type TwoPCConn interface {
+	// PrepareTransaction prepares the transaction for the
+	// distributed transaction dtid. It can then only be resolved
+	// by CommitPrepared or RollbackPrepared.
+	PrepareTransaction(context context.Context, transactionId int64, dtid string) error
+
+	// CommitPrepared commits the transaction prepared for dtid.
+	CommitPrepared(context context.Context, dtid string) error
+
+	// RollbackPrepared rolls back the transaction prepared for dtid.
+	RollbackPrepared(context context.Context, dtid string) error
+
+	// CreateTransaction makes the tablet the metadata manager of
+	// dtid, by saving its transaction record with the other
+	// participants.
+	CreateTransaction(context context.Context, dtid string, participants []tproto.TwoPCParticipant) error
+
+	// StartCommit records the decision to commit dtid, and
+	// commits the transaction of the metadata manager with it.
+	StartCommit(context context.Context, transactionId int64, dtid string) error
+
+	// SetRollback records the decision to roll back dtid.
+	SetRollback(context context.Context, dtid string) error
+
+	// ConcludeTransaction deletes the transaction record of dtid.
+	ConcludeTransaction(context context.Context, dtid string) error
+
+	// ReadAbandoned returns the transaction records older than age.
+	ReadAbandoned(context context.Context, age time.Duration) ([]tproto.DistributedTransaction, error)
+}
+
+// PositionConn is implemented by the TabletConn whose vttablet can
+// report its replication position, for read-after-write consistency.
+type PositionConn interface {
+	// ReplicationPosition returns the position up to which the
+	// tablet applied transactions.
+	ReplicationPosition(context context.Context) (myproto.GTID, error)
+}
+
 var dialers = make(map[string]TabletDialer)
 
 // RegisterDialer is meant to be used by TabletDialer implementations
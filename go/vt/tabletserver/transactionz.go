@@ -0,0 +1,135 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/youtube/vitess/go/acl"
+)
+
+var (
+	transactionzHeader = []byte(`<thead>
+		<tr>
+			<th>Transaction id</th>
+			<th>Caller</th>
+			<th>Start</th>
+			<th>Duration</th>
+			<th>Timeout</th>
+			<th>State</th>
+			<th>Statements</th>
+			<th>Kill</th>
+		</tr>
+        </thead>
+	`)
+	transactionzTmpl = template.Must(template.New("example").Funcs(txlogzFuncMap).Parse(`
+		<tr>
+			<td>{{.TransactionID}}</td>
+			<td>{{.Caller}}</td>
+			<td>{{.StartTime | stampMicro}}</td>
+			<td>{{.Duration}}</td>
+			<td>{{.Timeout}}</td>
+			<td>{{.State}}</td>
+			<td>
+				{{ range .Queries }}
+					{{.}}<br>
+				{{ end}}
+			</td>
+			<td>
+				<form method='post' action='/debug/transactions/kill'>
+					<input type='hidden' name='transactionID' value='{{.TransactionID}}'>
+					<input type='submit' value='Kill'>
+				</form>
+			</td>
+		</tr>
+	`))
+)
+
+func init() {
+	http.HandleFunc("/debug/transactions", transactionzHandler)
+	http.HandleFunc("/debug/transactions/kill", transactionzKillHandler)
+}
+
+// transactionzHandler lists the open transactions, as
+// an HTML table, or as JSON if format=json.
+func transactionzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.DEBUGGING); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("cannot parse form: %s", err), http.StatusInternalServerError)
+		return
+	}
+	txPool := activeTxPool()
+	if txPool == nil {
+		http.Error(w, "query service is not running", http.StatusServiceUnavailable)
+		return
+	}
+	details := txPool.GetTxDetails()
+	if r.FormValue("format") == "json" {
+		js, err := json.Marshal(details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+		return
+	}
+	startHTMLTable(w)
+	defer endHTMLTable(w)
+	w.Write(transactionzHeader)
+	for i := range details {
+		transactionzTmpl.Execute(w, details[i])
+	}
+}
+
+// transactionzKillHandler rolls back the transaction
+// transactionID, if it's not in use. It only accepts POST
+// requests, so the kill can't be triggered by following a link.
+func transactionzKillHandler(w http.ResponseWriter, r *http.Request) {
+	if err := acl.CheckAccessHTTP(r, acl.ADMIN); err != nil {
+		acl.SendError(w, err)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "transactions can only be killed by a POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, fmt.Sprintf("cannot parse form: %s", err), http.StatusInternalServerError)
+		return
+	}
+	transactionID, err := strconv.ParseInt(r.FormValue("transactionID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid transactionID", http.StatusInternalServerError)
+		return
+	}
+	txPool := activeTxPool()
+	if txPool == nil {
+		http.Error(w, "query service is not running", http.StatusServiceUnavailable)
+		return
+	}
+	if err := txPool.Kill(transactionID); err != nil {
+		http.Error(w, fmt.Sprintf("error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/debug/transactions", http.StatusSeeOther)
+}
+
+// activeTxPool returns the transaction pool of the query
+// service, or nil if it's not set up.
+func activeTxPool() *ActiveTxPool {
+	if SqlQueryRpcService == nil || SqlQueryRpcService.qe == nil {
+		return nil
+	}
+	return SqlQueryRpcService.qe.activeTxPool
+}
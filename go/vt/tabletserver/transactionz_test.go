@@ -0,0 +1,40 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTransactionzKillHandler(t *testing.T) {
+	// a GET doesn't kill
+	request, _ := http.NewRequest("GET", "/debug/transactions/kill?transactionID=1", nil)
+	response := httptest.NewRecorder()
+	transactionzKillHandler(response, request)
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got code %v, want %v", response.Code, http.StatusMethodNotAllowed)
+	}
+
+	// without a query service, there's nothing to kill
+	form := url.Values{"transactionID": {"1"}}
+	request, _ = http.NewRequest("POST", "/debug/transactions/kill", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response = httptest.NewRecorder()
+	transactionzKillHandler(response, request)
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST: got code %v, want %v", response.Code, http.StatusServiceUnavailable)
+	}
+
+	request, _ = http.NewRequest("GET", "/debug/transactions", nil)
+	response = httptest.NewRecorder()
+	transactionzHandler(response, request)
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("list: got code %v, want %v", response.Code, http.StatusServiceUnavailable)
+	}
+}
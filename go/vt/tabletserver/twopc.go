@@ -0,0 +1,490 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/dbconnpool"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// TwoPC makes the tablet a participant of two-phase commits. The
+// coordinator prepares the transaction of every participant under
+// the id of the distributed transaction (dtid), and then commits or
+// rolls back all of them.
+//
+// A prepared transaction stays open in MySQL, out of reach of the
+// transaction killer and of the clients, until it's resolved. Its
+// DMLs are also saved in a redo log, in the _vt database, so it can
+// be resurrected if MySQL or the tablet goes away: when the query
+// service starts on a master, the resolver replays the redo log of
+// every transaction that is still prepared into a new transaction,
+// and prepares it again. If a replay fails, the transaction is
+// rolled back and marked as failed in the redo log, for a human to
+// look at.
+//
+// Statements are replayed as they were sent to MySQL, so they must
+// give the same result when they are run again, which they do if
+// they depend only on the rows locked by the transaction. Prepared
+// transactions are rolled back when the query service stops, and
+// resurrected when it's back.
+//
+// The tablet of the first shard of a distributed transaction is its
+// metadata manager: it keeps the transaction record, in the _vt
+// database, which lists the other participants and holds the commit
+// decision. The coordinator creates the record before preparing the
+// participants, and the decision to commit is recorded in the
+// transaction of the metadata manager itself, when it's committed by
+// StartCommit. So if the coordinator goes away, the resolver of vtgate
+// finds the record, and commits or rolls back the participants
+// according to it.
+type TwoPC struct {
+	mu sync.Mutex
+	// prepared are the prepared transactions, by dtid. They stay
+	// registered in the active transaction pool, but checked out,
+	// until they are resolved.
+	prepared map[string]*TxConnection
+	closed   bool
+}
+
+// The states of a transaction in the redo log.
+const (
+	REDO_STATE_FAILED   = 0
+	REDO_STATE_PREPARED = 1
+)
+
+// redoMaxRows is the maximum number of rows read from the redo log.
+const redoMaxRows = 1 << 20
+
+// NewTwoPC creates a new TwoPC. If name is empty,
+// its stats are not exported.
+func NewTwoPC(name string) *TwoPC {
+	tpc := &TwoPC{prepared: make(map[string]*TxConnection)}
+	if name != "" {
+		stats.Publish(name, stats.IntFunc(tpc.Length))
+	}
+	return tpc
+}
+
+// Length returns the number of prepared transactions.
+func (tpc *TwoPC) Length() int64 {
+	tpc.mu.Lock()
+	defer tpc.mu.Unlock()
+	return int64(len(tpc.prepared))
+}
+
+// open allows new prepared transactions.
+func (tpc *TwoPC) open() {
+	tpc.mu.Lock()
+	defer tpc.mu.Unlock()
+	tpc.closed = false
+}
+
+// add registers conn as prepared for dtid.
+func (tpc *TwoPC) add(dtid string, conn *TxConnection) {
+	tpc.mu.Lock()
+	defer tpc.mu.Unlock()
+	if tpc.closed {
+		panic(NewTabletError(RETRY, "Cannot prepare %s: the query service is shutting down", dtid))
+	}
+	if _, ok := tpc.prepared[dtid]; ok {
+		panic(NewTabletError(FAIL, "Distributed transaction %s is already prepared", dtid))
+	}
+	tpc.prepared[dtid] = conn
+}
+
+// take unregisters and returns the transaction prepared for dtid, or
+// nil if there's none.
+func (tpc *TwoPC) take(dtid string) *TxConnection {
+	tpc.mu.Lock()
+	defer tpc.mu.Unlock()
+	conn := tpc.prepared[dtid]
+	delete(tpc.prepared, dtid)
+	return conn
+}
+
+// close rolls back all the prepared transactions, and refuses new
+// ones. Their redo log is kept.
+func (tpc *TwoPC) close() {
+	tpc.mu.Lock()
+	defer tpc.mu.Unlock()
+	tpc.closed = true
+	for dtid, conn := range tpc.prepared {
+		log.Infof("rolling back prepared transaction %s for shutdown", dtid)
+		conn.Close()
+		conn.discard(TX_CLOSE)
+	}
+	tpc.prepared = make(map[string]*TxConnection)
+}
+
+// PrepareTransaction prepares the transaction transactionID for the
+// distributed transaction dtid: its DMLs are saved in the redo log,
+// and it can then only be committed or rolled back by CommitPrepared
+// or RollbackPrepared.
+func (qe *QueryEngine) PrepareTransaction(logStats *SQLQueryStats, transactionID int64, dtid string) {
+	defer queryStats.Record("PREPARE", time.Now())
+	qe.checkTwoPC()
+	conn := qe.activeTxPool.Get(transactionID)
+	prepared := false
+	defer func() {
+		if !prepared {
+			conn.Recycle()
+		}
+	}()
+	qe.twoPC.add(dtid, conn)
+	defer func() {
+		if !prepared {
+			qe.twoPC.take(dtid)
+		}
+	}()
+	qe.writeRedoLog(logStats, dtid, conn.redoStatements())
+	// conn is not put back in the pool, which makes
+	// it invisible to the clients and the killer.
+	conn.setPrepared(dtid)
+	prepared = true
+}
+
+// CommitPrepared commits the transaction prepared for dtid, and
+// deletes its redo log. If the commit fails, the transaction is
+// resurrected from the redo log, and the commit can be retried. It
+// succeeds if dtid has no redo log, because it was committed
+// already, so the resolver can commit it again.
+func (qe *QueryEngine) CommitPrepared(logStats *SQLQueryStats, dtid string) {
+	defer queryStats.Record("COMMIT_PREPARED", time.Now())
+	qe.checkTwoPC()
+	conn := qe.twoPC.take(dtid)
+	if conn == nil {
+		if qe.redoLogExists(logStats, dtid) {
+			panic(NewTabletError(NOT_IN_TX, "Distributed transaction %s is not prepared", dtid))
+		}
+		return
+	}
+	logStats.TransactionID = conn.TransactionID
+	err := func() (err error) {
+		defer conn.discard(TX_COMMIT)
+		qe.activeTxPool.txStats.Add("Completed", time.Now().Sub(conn.StartTime))
+		for _, sql := range deleteRedoLog(dtid) {
+			if _, err := qe.executeSql(logStats, conn, sql, false); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+		if _, err := conn.ExecuteFetch(COMMIT, 1, false); err != nil {
+			conn.Close()
+			return NewTabletErrorSql(FAIL, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		internalErrors.Add("TwoPCCommit", 1)
+		log.Errorf("Commit of prepared transaction %s failed, resurrecting it: %v", dtid, err)
+		qe.resolveTransaction(dtid)
+		panic(err)
+	}
+	qe.invalidateRows(logStats, conn.dirtyTables)
+}
+
+// RollbackPrepared deletes the redo log of dtid, and rolls back its
+// prepared transaction, if any. It succeeds if dtid isn't prepared,
+// so it can be retried. Transactions that were not prepared yet are
+// rolled back with Rollback.
+func (qe *QueryEngine) RollbackPrepared(logStats *SQLQueryStats, dtid string) {
+	defer queryStats.Record("ROLLBACK_PREPARED", time.Now())
+	qe.checkTwoPC()
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	qe.execRedoTransaction(logStats, conn, deleteRedoLog(dtid))
+
+	txc := qe.twoPC.take(dtid)
+	if txc == nil {
+		return
+	}
+	logStats.TransactionID = txc.TransactionID
+	defer txc.discard(TX_ROLLBACK)
+	qe.activeTxPool.txStats.Add("Aborted", time.Now().Sub(txc.StartTime))
+	if _, err := txc.ExecuteFetch(ROLLBACK, 1, false); err != nil {
+		txc.Close()
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+}
+
+// CreateTransaction makes the tablet the metadata manager of dtid: it
+// saves the transaction record of dtid, in the prepare state, with
+// its other participants.
+func (qe *QueryEngine) CreateTransaction(logStats *SQLQueryStats, dtid string, participants []proto.TwoPCParticipant) {
+	defer queryStats.Record("CREATE_TRANSACTION", time.Now())
+	qe.checkTwoPC()
+	value := encodeRedoValue(dtid)
+	queries := []string{fmt.Sprintf("insert into _vt.dt_state(dtid, state, time_created) values(%s, %d, %d)", value, proto.DT_STATE_PREPARE, time.Now().UnixNano())}
+	if len(participants) != 0 {
+		buf := bytes.NewBuffer(nil)
+		buf.WriteString("insert into _vt.dt_participant(dtid, id, keyspace, shard) values")
+		for i, participant := range participants {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "(%s, %d, %s, %s)", value, i+1, encodeRedoValue(participant.Keyspace), encodeRedoValue(participant.Shard))
+		}
+		queries = append(queries, buf.String())
+	}
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	qe.execRedoTransaction(logStats, conn, queries)
+}
+
+// StartCommit records the decision to commit dtid in the transaction
+// transactionID of the metadata manager, and commits it: the decision
+// is durable once StartCommit succeeds. It fails if the decision to
+// roll back dtid was recorded first, and transactionID is then rolled
+// back.
+func (qe *QueryEngine) StartCommit(logStats *SQLQueryStats, transactionID int64, dtid string) {
+	defer queryStats.Record("START_COMMIT", time.Now())
+	qe.checkTwoPC()
+	conn := qe.activeTxPool.Get(transactionID)
+	sql := fmt.Sprintf("update _vt.dt_state set state = %d where dtid = %s and state = %d", proto.DT_STATE_COMMIT, encodeRedoValue(dtid), proto.DT_STATE_PREPARE)
+	qr, err := qe.executeSql(logStats, conn, sql, false)
+	conn.Recycle()
+	if err == nil && qr.RowsAffected != 1 {
+		err = NewTabletError(FAIL, "Distributed transaction %s is not in the prepare state", dtid)
+	}
+	if err != nil {
+		qe.activeTxPool.Rollback(transactionID)
+		panic(err)
+	}
+	qe.Commit(logStats, transactionID)
+}
+
+// SetRollback records the decision to roll back dtid. It fails if the
+// decision to commit it was recorded first. The transaction of the
+// metadata manager is rolled back with Rollback.
+func (qe *QueryEngine) SetRollback(logStats *SQLQueryStats, dtid string) {
+	defer queryStats.Record("SET_ROLLBACK", time.Now())
+	qe.checkTwoPC()
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	value := encodeRedoValue(dtid)
+	sql := fmt.Sprintf("update _vt.dt_state set state = %d where dtid = %s and state = %d", proto.DT_STATE_ROLLBACK, value, proto.DT_STATE_PREPARE)
+	if _, err := qe.executeSql(logStats, conn, sql, false); err != nil {
+		panic(err)
+	}
+	qr, err := qe.executeSql(logStats, conn, "select state from _vt.dt_state where dtid = "+value, false)
+	if err != nil {
+		panic(err)
+	}
+	if len(qr.Rows) == 1 && qr.Rows[0][0].String() == fmt.Sprintf("%d", proto.DT_STATE_COMMIT) {
+		panic(NewTabletError(FAIL, "Distributed transaction %s is already committed", dtid))
+	}
+}
+
+// ConcludeTransaction deletes the transaction record of dtid, once all
+// its participants are resolved.
+func (qe *QueryEngine) ConcludeTransaction(logStats *SQLQueryStats, dtid string) {
+	defer queryStats.Record("CONCLUDE_TRANSACTION", time.Now())
+	qe.checkTwoPC()
+	value := encodeRedoValue(dtid)
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	qe.execRedoTransaction(logStats, conn, []string{
+		"delete from _vt.dt_participant where dtid = " + value,
+		"delete from _vt.dt_state where dtid = " + value,
+	})
+}
+
+// ReadAbandoned returns the transaction records created more than age
+// ago, whose coordinator is presumed gone.
+func (qe *QueryEngine) ReadAbandoned(logStats *SQLQueryStats, age time.Duration) []proto.DistributedTransaction {
+	defer queryStats.Record("READ_ABANDONED", time.Now())
+	qe.checkTwoPC()
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	sql := fmt.Sprintf("select t.dtid, t.state, t.time_created, p.keyspace, p.shard from _vt.dt_state as t join _vt.dt_participant as p on t.dtid = p.dtid where t.time_created < %d order by t.dtid, p.id", time.Now().Add(-age).UnixNano())
+	qr, err := conn.ExecuteFetch(sql, redoMaxRows, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FAIL, err))
+	}
+	transactions, err := parseTransactions(qr.Rows)
+	if err != nil {
+		panic(NewTabletError(FAIL, "Invalid transaction record: %v", err))
+	}
+	return transactions
+}
+
+// parseTransactions builds the transaction records from the rows of
+// ReadAbandoned, one per participant.
+func parseTransactions(rows [][]sqltypes.Value) ([]proto.DistributedTransaction, error) {
+	var transactions []proto.DistributedTransaction
+	for _, row := range rows {
+		dtid := row[0].String()
+		if len(transactions) == 0 || transactions[len(transactions)-1].Dtid != dtid {
+			state, err := row[1].ParseInt64()
+			if err != nil {
+				return nil, err
+			}
+			timeCreated, err := row[2].ParseInt64()
+			if err != nil {
+				return nil, err
+			}
+			transactions = append(transactions, proto.DistributedTransaction{
+				Dtid:        dtid,
+				State:       state,
+				TimeCreated: timeCreated,
+			})
+		}
+		dt := &transactions[len(transactions)-1]
+		dt.Participants = append(dt.Participants, proto.TwoPCParticipant{
+			Keyspace: row[3].String(),
+			Shard:    row[4].String(),
+		})
+	}
+	return transactions, nil
+}
+
+func (qe *QueryEngine) checkTwoPC() {
+	if !qe.twoPCEnabled {
+		panic(NewTabletError(FAIL, "Two-phase commit is not enabled"))
+	}
+}
+
+// writeRedoLog saves the statements of dtid in the redo log.
+func (qe *QueryEngine) writeRedoLog(logStats *SQLQueryStats, dtid string, statements []string) {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "insert into _vt.redo_log_transaction(dtid, state, time_created) values(%s, %d, %d)", encodeRedoValue(dtid), REDO_STATE_PREPARED, time.Now().UnixNano())
+	queries := []string{buf.String()}
+	if len(statements) != 0 {
+		buf = bytes.NewBuffer(nil)
+		buf.WriteString("insert into _vt.redo_log_statement(dtid, id, statement) values")
+		for i, statement := range statements {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			fmt.Fprintf(buf, "(%s, %d, %s)", encodeRedoValue(dtid), i+1, encodeRedoValue(statement))
+		}
+		queries = append(queries, buf.String())
+	}
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	qe.execRedoTransaction(logStats, conn, queries)
+}
+
+// execRedoTransaction executes queries in a transaction of their own.
+func (qe *QueryEngine) execRedoTransaction(logStats *SQLQueryStats, conn dbconnpool.PoolConnection, queries []string) {
+	if _, err := qe.executeSql(logStats, conn, BEGIN, false); err != nil {
+		panic(err)
+	}
+	for _, sql := range append(queries, COMMIT) {
+		if _, err := qe.executeSql(logStats, conn, sql, false); err != nil {
+			conn.ExecuteFetch(ROLLBACK, 1, false)
+			panic(err)
+		}
+	}
+}
+
+// redoLogExists returns true if dtid has a redo log, prepared or
+// failed.
+func (qe *QueryEngine) redoLogExists(logStats *SQLQueryStats, dtid string) bool {
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	qr, err := qe.executeSql(logStats, conn, "select state from _vt.redo_log_transaction where dtid = "+encodeRedoValue(dtid), false)
+	if err != nil {
+		panic(err)
+	}
+	return len(qr.Rows) != 0
+}
+
+func deleteRedoLog(dtid string) []string {
+	value := encodeRedoValue(dtid)
+	return []string{
+		"delete from _vt.redo_log_statement where dtid = " + value,
+		"delete from _vt.redo_log_transaction where dtid = " + value,
+	}
+}
+
+func encodeRedoValue(value string) string {
+	buf := bytes.NewBuffer(nil)
+	sqltypes.MakeString([]byte(value)).EncodeSql(buf)
+	return buf.String()
+}
+
+// openTwoPC resurrects the prepared transactions of the redo log.
+// It does nothing on a read-only MySQL, where the redo log is
+// replicated from the master.
+func (qe *QueryEngine) openTwoPC() {
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	if isReadOnly(conn) {
+		log.Infof("MySQL is read-only, not resolving prepared transactions")
+		return
+	}
+	qr, err := conn.ExecuteFetch(fmt.Sprintf("select dtid from _vt.redo_log_transaction where state = %d", REDO_STATE_PREPARED), redoMaxRows, false)
+	if err != nil {
+		panic(NewTabletErrorSql(FATAL, err))
+	}
+	for _, row := range qr.Rows {
+		qe.resolveTransaction(row[0].String())
+	}
+	log.Infof("Resolved %d prepared transactions", len(qr.Rows))
+}
+
+// resolveTransaction replays the redo log of dtid in a new
+// transaction, which is prepared for dtid. If that fails, dtid
+// is marked as failed in the redo log.
+func (qe *QueryEngine) resolveTransaction(dtid string) {
+	defer logError()
+	conn := getOrPanic(qe.txPool)
+	transactionID, err := qe.activeTxPool.SafeBegin(conn, nil, 0)
+	if err != nil {
+		conn.Recycle()
+		panic(err)
+	}
+	txc := qe.activeTxPool.Get(transactionID)
+	if err := replayRedoLog(txc, dtid); err != nil {
+		log.Errorf("Could not resolve prepared transaction %s, marking it as failed: %v", dtid, err)
+		internalErrors.Add("TwoPCResolve", 1)
+		txc.Recycle()
+		qe.activeTxPool.Rollback(transactionID)
+		qe.failRedoLog(dtid)
+		return
+	}
+	defer func() {
+		// add fails if the query service is shutting down.
+		if x := recover(); x != nil {
+			txc.Recycle()
+			qe.activeTxPool.Rollback(transactionID)
+			panic(x)
+		}
+	}()
+	qe.twoPC.add(dtid, txc)
+	txc.setPrepared(dtid)
+	log.Infof("Resurrected prepared transaction %s as %d", dtid, transactionID)
+}
+
+func replayRedoLog(txc *TxConnection, dtid string) error {
+	qr, err := txc.ExecuteFetch("select statement from _vt.redo_log_statement where dtid = "+encodeRedoValue(dtid)+" order by id", redoMaxRows, false)
+	if err != nil {
+		return err
+	}
+	for _, row := range qr.Rows {
+		if _, err := txc.ExecuteFetch(row[0].String(), 1, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (qe *QueryEngine) failRedoLog(dtid string) {
+	conn := getOrPanic(qe.connPool)
+	defer conn.Recycle()
+	sql := fmt.Sprintf("update _vt.redo_log_transaction set state = %d where dtid = %s", REDO_STATE_FAILED, encodeRedoValue(dtid))
+	if _, err := conn.ExecuteFetch(sql, 1, false); err != nil {
+		log.Errorf("Could not mark prepared transaction %s as failed: %v", dtid, err)
+	}
+}
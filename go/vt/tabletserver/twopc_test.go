@@ -0,0 +1,87 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+func TestTwoPC(t *testing.T) {
+	tpc := NewTwoPC("")
+	conn := &TxConnection{TransactionID: 1}
+	tpc.add("dtid1", conn)
+	expectTabletError(t, "add of a prepared dtid", func() {
+		tpc.add("dtid1", &TxConnection{TransactionID: 2})
+	})
+	if length := tpc.Length(); length != 1 {
+		t.Errorf("Length: %d, want 1", length)
+	}
+	if got := tpc.take("dtid1"); got != conn {
+		t.Errorf("take(dtid1): %v, want %v", got, conn)
+	}
+	if got := tpc.take("dtid1"); got != nil {
+		t.Errorf("take of a taken dtid: %v, want nil", got)
+	}
+
+	tpc.close()
+	expectTabletError(t, "add after close", func() {
+		tpc.add("dtid2", conn)
+	})
+	tpc.open()
+	tpc.add("dtid2", conn)
+}
+
+func TestEncodeRedoValue(t *testing.T) {
+	got := encodeRedoValue("insert into a values('b')")
+	want := "'insert into a values(\\'b\\')'"
+	if got != want {
+		t.Errorf("encodeRedoValue: %s, want %s", got, want)
+	}
+}
+
+func TestParseTransactions(t *testing.T) {
+	row := func(dtid, state, timeCreated, keyspace, shard string) []sqltypes.Value {
+		return []sqltypes.Value{
+			sqltypes.MakeString([]byte(dtid)),
+			sqltypes.MakeNumeric([]byte(state)),
+			sqltypes.MakeNumeric([]byte(timeCreated)),
+			sqltypes.MakeString([]byte(keyspace)),
+			sqltypes.MakeString([]byte(shard)),
+		}
+	}
+	got, err := parseTransactions([][]sqltypes.Value{
+		row("a", "2", "10", "ks", "-80"),
+		row("a", "2", "10", "ks", "80-"),
+		row("b", "1", "20", "other", "0"),
+	})
+	if err != nil {
+		t.Fatalf("parseTransactions: %v", err)
+	}
+	want := []proto.DistributedTransaction{{
+		Dtid:        "a",
+		State:       proto.DT_STATE_COMMIT,
+		TimeCreated: 10,
+		Participants: []proto.TwoPCParticipant{
+			{Keyspace: "ks", Shard: "-80"},
+			{Keyspace: "ks", Shard: "80-"},
+		},
+	}, {
+		Dtid:         "b",
+		State:        proto.DT_STATE_PREPARE,
+		TimeCreated:  20,
+		Participants: []proto.TwoPCParticipant{{Keyspace: "other", Shard: "0"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTransactions: got %+v, want %+v", got, want)
+	}
+
+	if _, err := parseTransactions([][]sqltypes.Value{row("a", "x", "10", "ks", "0")}); err == nil {
+		t.Errorf("parseTransactions with an invalid state: got no error")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+)
+
+// TxSerializer serializes the transactions that update the same row.
+// Without it, thousands of transactions hammering a single hot row
+// (like a counter) all grab a transaction connection and pile up
+// in MySQL waiting for the row lock, until they fail with lock wait
+// timeouts. With it, only one of them at a time runs the DML on a
+// given row, and the others wait in a queue of bounded size, without
+// holding the row lock in MySQL.
+//
+// A row is held by a transaction until it ends, like the MySQL lock.
+type TxSerializer struct {
+	// maxQueueSize is the number of transactions that can wait
+	// for a row. 0 disables the serializer.
+	maxQueueSize sync2.AtomicInt64
+
+	mu     sync.Mutex
+	queues map[string]*txQueue
+
+	// waits counts the DMLs that had to wait, per table.
+	// queueExceeded counts the DMLs rejected because the queue
+	// was full, per table.
+	waits         *stats.Counters
+	queueExceeded *stats.Counters
+}
+
+// txQueue is the queue of transactions for one row.
+type txQueue struct {
+	// size is the number of transactions holding
+	// or waiting for the row.
+	size int64
+	// lock has a capacity of one, and is full while
+	// the row is held.
+	lock chan struct{}
+}
+
+// NewTxSerializer creates a new TxSerializer. If name is empty,
+// its stats are not exported.
+func NewTxSerializer(name string, maxQueueSize int) *TxSerializer {
+	ts := &TxSerializer{
+		maxQueueSize:  sync2.AtomicInt64(maxQueueSize),
+		queues:        make(map[string]*txQueue),
+		waits:         stats.NewCounters(""),
+		queueExceeded: stats.NewCounters(""),
+	}
+	if name != "" {
+		stats.Publish(name+"Waits", ts.waits)
+		stats.Publish(name+"QueueExceeded", ts.queueExceeded)
+		stats.Publish(name+"MaxQueueSize", stats.IntFunc(ts.maxQueueSize.Get))
+		stats.Publish(name+"Rows", stats.IntFunc(ts.rows))
+	}
+	return ts
+}
+
+// Enabled returns true if transactions are serialized.
+func (ts *TxSerializer) Enabled() bool {
+	return ts.maxQueueSize.Get() > 0
+}
+
+// SetMaxQueueSize changes the number of transactions that can wait
+// for a row. 0 disables the serializer for new DMLs.
+func (ts *TxSerializer) SetMaxQueueSize(size int) {
+	ts.maxQueueSize.Set(int64(size))
+}
+
+// Lock waits until the row identified by key, in table, is not held
+// by any other transaction, and holds it. It fails if too many
+// transactions are already waiting for the row, or if the row is
+// still held after timeout. A zero timeout waits forever.
+// Every successful Lock must be followed by an Unlock.
+func (ts *TxSerializer) Lock(table, key string, timeout time.Duration) error {
+	ts.mu.Lock()
+	q, ok := ts.queues[key]
+	if !ok {
+		q = &txQueue{lock: make(chan struct{}, 1)}
+		ts.queues[key] = q
+	}
+	// The holder of the row is not waiting.
+	if q.size > 0 && q.size-1 >= ts.maxQueueSize.Get() {
+		ts.mu.Unlock()
+		ts.queueExceeded.Add(table, 1)
+		return NewTabletError(FAIL, "hot row protection: too many transactions waiting for the same row of %s", table)
+	}
+	q.size++
+	ts.mu.Unlock()
+
+	select {
+	case q.lock <- struct{}{}:
+		return nil
+	default:
+	}
+
+	ts.waits.Add(table, 1)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case q.lock <- struct{}{}:
+		return nil
+	case <-expired:
+		ts.release(key, q)
+		return NewTabletError(FAIL, "hot row protection: timed out waiting for a row of %s", table)
+	}
+}
+
+// Unlock releases a row held by a successful Lock.
+func (ts *TxSerializer) Unlock(key string) {
+	ts.mu.Lock()
+	q, ok := ts.queues[key]
+	ts.mu.Unlock()
+	if !ok {
+		return
+	}
+	<-q.lock
+	ts.release(key, q)
+}
+
+func (ts *TxSerializer) release(key string, q *txQueue) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	q.size--
+	if q.size == 0 {
+		delete(ts.queues, key)
+	}
+}
+
+// rows returns the number of rows that are held or waited for.
+func (ts *TxSerializer) rows() int64 {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return int64(len(ts.queues))
+}
@@ -0,0 +1,66 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tabletserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTxSerializer(t *testing.T) {
+	ts := NewTxSerializer("", 1)
+	if !ts.Enabled() {
+		t.Errorf("serializer with a queue size of 1 is not enabled")
+	}
+
+	if err := ts.Lock("t1", "t1.1", 0); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	// Other rows are independent.
+	if err := ts.Lock("t1", "t1.2", 0); err != nil {
+		t.Fatalf("Lock of another row: %v", err)
+	}
+	ts.Unlock("t1.2")
+
+	// The second transaction waits for the first one.
+	locked := make(chan error)
+	go func() {
+		locked <- ts.Lock("t1", "t1.1", 0)
+	}()
+	for ts.waits.Counts()["t1"] != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-locked:
+		t.Fatalf("Lock of a held row returned %v, want wait", err)
+	default:
+	}
+
+	// The queue is full.
+	err := ts.Lock("t1", "t1.1", 0)
+	if err == nil || ts.queueExceeded.Counts()["t1"] != 1 {
+		t.Errorf("Lock with a full queue: %v, want error", err)
+	}
+
+	ts.Unlock("t1.1")
+	if err := <-locked; err != nil {
+		t.Errorf("Lock after Unlock: %v", err)
+	}
+
+	// Waiting is bounded by the timeout.
+	err = ts.Lock("t1", "t1.1", 10*time.Millisecond)
+	if err == nil {
+		t.Errorf("Lock of a held row did not time out")
+	}
+	ts.Unlock("t1.1")
+	if rows := ts.rows(); rows != 0 {
+		t.Errorf("rows: %v, want 0", rows)
+	}
+
+	ts.SetMaxQueueSize(0)
+	if ts.Enabled() {
+		t.Errorf("serializer with a queue size of 0 is enabled")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// GlobalCopy is the copy of the global records of a keyspace, the
+// keyspace and its shards, kept in a cell. It is read instead of the
+// global records when the global topology is not available.
+type GlobalCopy struct {
+	Keyspace *Keyspace
+	Shards   map[string]*Shard
+
+	// Refreshed is when the copy was made from the global records.
+	Refreshed time.Time
+}
+
+// Age returns how long ago the copy was made.
+func (gc *GlobalCopy) Age() time.Duration {
+	return time.Now().Sub(gc.Refreshed)
+}
+
+// GlobalCopyServer is implemented by the Server implementations that
+// can keep, in each cell, a read-only copy of the global records.
+// The copies are made by topotools.CopyGlobalRecords, and read by
+// GetKeyspaceOrCopy and GetShardOrCopy.
+type GlobalCopyServer interface {
+	// UpdateGlobalCopy writes the copy of a keyspace in a cell.
+	UpdateGlobalCopy(cell, keyspace string, gc *GlobalCopy) error
+
+	// GetGlobalCopy reads the copy of a keyspace in a cell, or
+	// returns ErrNoNode.
+	GetGlobalCopy(cell, keyspace string) (*GlobalCopy, error)
+
+	// GetGlobalCopyKeyspaces returns the keyspaces that have a
+	// copy in a cell.
+	GetGlobalCopyKeyspaces(cell string) ([]string, error)
+
+	// DeleteGlobalCopy deletes the copy of a keyspace in a cell,
+	// or returns ErrNoNode.
+	DeleteGlobalCopy(cell, keyspace string) error
+}
+
+// getGlobalCopy returns the copy of the keyspace in cell, if ts keeps
+// copies and there is one.
+func getGlobalCopy(ts Server, cell, keyspace string) (*GlobalCopy, bool) {
+	gcs, ok := ts.(GlobalCopyServer)
+	if !ok || cell == "" {
+		return nil, false
+	}
+	gc, err := gcs.GetGlobalCopy(cell, keyspace)
+	if err != nil {
+		if err != ErrNoNode {
+			log.Warningf("cannot read the copy of the global records of keyspace %v in cell %v: %v", keyspace, cell, err)
+		}
+		return nil, false
+	}
+	return gc, true
+}
+
+// GetKeyspaceOrCopy reads a keyspace from the global topology. If it
+// can't (for another reason than it doesn't exist), it reads it from
+// its copy in cell instead, and also returns the age of the copy.
+func GetKeyspaceOrCopy(ts Server, cell, keyspace string) (*KeyspaceInfo, time.Duration, error) {
+	ki, err := ts.GetKeyspace(keyspace)
+	if err == nil || err == ErrNoNode {
+		return ki, 0, err
+	}
+	gc, ok := getGlobalCopy(ts, cell, keyspace)
+	if !ok || gc.Keyspace == nil {
+		return nil, 0, err
+	}
+	log.Warningf("cannot read keyspace %v (%v), using its copy in cell %v from %v ago", keyspace, err, cell, gc.Age())
+	return NewKeyspaceInfo(keyspace, gc.Keyspace), gc.Age(), nil
+}
+
+// GetShardOrCopy reads a shard from the global topology. If it can't
+// (for another reason than it doesn't exist), it reads it from its
+// copy in cell instead, and also returns the age of the copy.
+func GetShardOrCopy(ts Server, cell, keyspace, shard string) (*ShardInfo, time.Duration, error) {
+	si, err := ts.GetShard(keyspace, shard)
+	if err == nil || err == ErrNoNode {
+		return si, 0, err
+	}
+	gc, ok := getGlobalCopy(ts, cell, keyspace)
+	if !ok {
+		return nil, 0, err
+	}
+	value, ok := gc.Shards[shard]
+	if !ok {
+		return nil, 0, err
+	}
+	log.Warningf("cannot read shard %v/%v (%v), using its copy in cell %v from %v ago", keyspace, shard, err, cell, gc.Age())
+	return NewShardInfo(keyspace, shard, value), gc.Age(), nil
+}
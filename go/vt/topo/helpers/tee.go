@@ -739,3 +739,23 @@ func (tee *Tee) UnblockTabletAction(actionPath string) error {
 	}
 	return tee.primary.UnblockTabletAction(actionPath)
 }
+
+//
+// VSchema management.
+//
+
+func (tee *Tee) SaveVSchema(keyspace, vschema string) error {
+	if err := topo.SaveVSchema(tee.primary, keyspace, vschema); err != nil {
+		return err
+	}
+
+	if err := topo.SaveVSchema(tee.secondary, keyspace, vschema); err != nil {
+		// not critical enough to fail
+		log.Warningf("secondary.SaveVSchema(%v) failed: %v", keyspace, err)
+	}
+	return nil
+}
+
+func (tee *Tee) GetVSchema(keyspace string) (string, error) {
+	return topo.GetVSchema(tee.readFrom, keyspace)
+}
@@ -0,0 +1,26 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+// ActionLockReader is implemented by the Server implementations that
+// can read the action lock held on a keyspace or a shard, to show
+// who holds it. The lock path they return can be passed to
+// UnlockKeyspaceForAction or UnlockShardForAction to release a lock
+// whose holder is stuck.
+//
+// The locks of the processes that die are released by the Server
+// implementations (as ephemeral nodes, with a TTL or a session), but
+// a live process can still hold a lock for too long.
+type ActionLockReader interface {
+	// GetKeyspaceActionLock returns the lock path and the contents
+	// of the action lock held on the keyspace, or ErrNoNode if it
+	// isn't locked.
+	GetKeyspaceActionLock(keyspace string) (lockPath, contents string, err error)
+
+	// GetShardActionLock returns the lock path and the contents of
+	// the action lock held on the shard, or ErrNoNode if it isn't
+	// locked.
+	GetShardActionLock(keyspace, shard string) (lockPath, contents string, err error)
+}
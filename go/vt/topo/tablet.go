@@ -367,6 +367,11 @@ type Tablet struct {
 	// BlacklistedTables is a list of tables we're not going to serve
 	// data for. This is used in vertical splits.
 	BlacklistedTables []string
+
+	// QueryRules is a JSON list of query rules, in the same format
+	// as the -customrules file. They are applied by the query service
+	// without restarting it.
+	QueryRules string
 }
 
 // ValidatePortmap returns an error if the tablet's portmap doesn't
@@ -0,0 +1,70 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckGlobalCopy(t *testing.T, ts topo.Server) {
+	gcs, ok := ts.(topo.GlobalCopyServer)
+	if !ok {
+		t.Fatalf("%T is not a topo.GlobalCopyServer", ts)
+	}
+	cell := getLocalCell(t, ts)
+
+	if _, err := gcs.GetGlobalCopy(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetGlobalCopy(not there): %v", err)
+	}
+	if keyspaces, err := gcs.GetGlobalCopyKeyspaces(cell); err != nil || len(keyspaces) != 0 {
+		t.Errorf("GetGlobalCopyKeyspaces(empty): %v %v", keyspaces, err)
+	}
+
+	refreshed := time.Date(2014, 10, 1, 12, 0, 0, 0, time.UTC)
+	gc := &topo.GlobalCopy{
+		Keyspace: &topo.Keyspace{ShardingColumnName: "user_id"},
+		Shards: map[string]*topo.Shard{
+			"-80": &topo.Shard{MasterAlias: topo.TabletAlias{Cell: cell, Uid: 1}},
+			"80-": &topo.Shard{MasterAlias: topo.TabletAlias{Cell: cell, Uid: 2}},
+		},
+		Refreshed: refreshed,
+	}
+	if err := gcs.UpdateGlobalCopy(cell, "test_keyspace", gc); err != nil {
+		t.Fatalf("UpdateGlobalCopy: %v", err)
+	}
+	got, err := gcs.GetGlobalCopy(cell, "test_keyspace")
+	if err != nil {
+		t.Fatalf("GetGlobalCopy: %v", err)
+	}
+	if got.Keyspace == nil || got.Keyspace.ShardingColumnName != "user_id" || len(got.Shards) != 2 || got.Shards["80-"].MasterAlias.Uid != 2 || !got.Refreshed.Equal(refreshed) {
+		t.Errorf("GetGlobalCopy: bad copy %#v", got)
+	}
+
+	// update it
+	delete(gc.Shards, "80-")
+	gc.Refreshed = refreshed.Add(time.Minute)
+	if err := gcs.UpdateGlobalCopy(cell, "test_keyspace", gc); err != nil {
+		t.Fatalf("UpdateGlobalCopy(again): %v", err)
+	}
+	if got, err := gcs.GetGlobalCopy(cell, "test_keyspace"); err != nil || len(got.Shards) != 1 || !got.Refreshed.Equal(gc.Refreshed) {
+		t.Errorf("GetGlobalCopy(updated): %#v %v", got, err)
+	}
+	if keyspaces, err := gcs.GetGlobalCopyKeyspaces(cell); err != nil || len(keyspaces) != 1 || keyspaces[0] != "test_keyspace" {
+		t.Errorf("GetGlobalCopyKeyspaces: %v %v", keyspaces, err)
+	}
+
+	if err := gcs.DeleteGlobalCopy(cell, "test_keyspace"); err != nil {
+		t.Errorf("DeleteGlobalCopy: %v", err)
+	}
+	if err := gcs.DeleteGlobalCopy(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("DeleteGlobalCopy(again): %v", err)
+	}
+	if _, err := gcs.GetGlobalCopy(cell, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetGlobalCopy(deleted): %v", err)
+	}
+}
@@ -139,3 +139,72 @@ func CheckSrvShardLock(t *testing.T, ts topo.Server) {
 	}
 
 }
+
+func CheckActionLockReader(t *testing.T, ts topo.Server) {
+	reader, ok := ts.(topo.ActionLockReader)
+	if !ok {
+		t.Fatalf("%T is not a topo.ActionLockReader", ts)
+	}
+	if err := ts.CreateKeyspace("test_keyspace", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := topo.CreateShard(ts, "test_keyspace", "10-20"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+
+	// not locked yet
+	if _, _, err := reader.GetKeyspaceActionLock("test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetKeyspaceActionLock(not locked): %v", err)
+	}
+	if _, _, err := reader.GetShardActionLock("test_keyspace", "10-20"); err != topo.ErrNoNode {
+		t.Errorf("GetShardActionLock(not locked): %v", err)
+	}
+
+	// lock the keyspace, read it, and release it with what we read
+	interrupted := make(chan struct{})
+	lockPath, err := ts.LockKeyspaceForAction("test_keyspace", "fake-content", 5*time.Second, interrupted)
+	if err != nil {
+		t.Fatalf("LockKeyspaceForAction: %v", err)
+	}
+	readPath, contents, err := reader.GetKeyspaceActionLock("test_keyspace")
+	if err != nil {
+		t.Fatalf("GetKeyspaceActionLock: %v", err)
+	}
+	if readPath != lockPath || contents != "fake-content" {
+		t.Errorf("GetKeyspaceActionLock: got %v %v, want %v fake-content", readPath, contents, lockPath)
+	}
+	if err := ts.UnlockKeyspaceForAction("test_keyspace", readPath, "fake-results"); err != nil {
+		t.Errorf("UnlockKeyspaceForAction(read path): %v", err)
+	}
+	if _, _, err := reader.GetKeyspaceActionLock("test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetKeyspaceActionLock(released): %v", err)
+	}
+
+	// same with the shard
+	lockPath, err = ts.LockShardForAction("test_keyspace", "10-20", "fake-content", 5*time.Second, interrupted)
+	if err != nil {
+		t.Fatalf("LockShardForAction: %v", err)
+	}
+	readPath, contents, err = reader.GetShardActionLock("test_keyspace", "10-20")
+	if err != nil {
+		t.Fatalf("GetShardActionLock: %v", err)
+	}
+	if readPath != lockPath || contents != "fake-content" {
+		t.Errorf("GetShardActionLock: got %v %v, want %v fake-content", readPath, contents, lockPath)
+	}
+	if err := ts.UnlockShardForAction("test_keyspace", "10-20", readPath, "fake-results"); err != nil {
+		t.Errorf("UnlockShardForAction(read path): %v", err)
+	}
+	if _, _, err := reader.GetShardActionLock("test_keyspace", "10-20"); err != topo.ErrNoNode {
+		t.Errorf("GetShardActionLock(released): %v", err)
+	}
+
+	// the lock can be taken again
+	lockPath, err = ts.LockShardForAction("test_keyspace", "10-20", "fake-content", time.Second, interrupted)
+	if err != nil {
+		t.Fatalf("LockShardForAction(again): %v", err)
+	}
+	if err := ts.UnlockShardForAction("test_keyspace", "10-20", lockPath, "fake-results"); err != nil {
+		t.Errorf("UnlockShardForAction(again): %v", err)
+	}
+}
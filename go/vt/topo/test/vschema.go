@@ -0,0 +1,30 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func CheckVSchema(t *testing.T, ts topo.Server) {
+	if _, err := topo.GetVSchema(ts, "test_keyspace"); err != topo.ErrNoNode {
+		t.Errorf("GetVSchema(not there): %v", err)
+	}
+
+	for _, vschema := range []string{`{"Sharded": false}`, `{"Sharded": true}`} {
+		if err := topo.SaveVSchema(ts, "test_keyspace", vschema); err != nil {
+			t.Fatalf("SaveVSchema: %v", err)
+		}
+		got, err := topo.GetVSchema(ts, "test_keyspace")
+		if err != nil {
+			t.Fatalf("GetVSchema: %v", err)
+		}
+		if got != vschema {
+			t.Errorf("GetVSchema: got %v, want %v", got, vschema)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// package test contains utilities to test topo.Server
+// implementations. If you are testing your implementation, you will
+// want to call CheckAll in your test method. For an example, look at
+// the tests in github.com/youtube/vitess/go/vt/zktopo.
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// waitForValue returns the next value sent on a watch channel, or
+// fails the test after a while.
+func waitForValue(t *testing.T, name string, values <-chan interface{}) interface{} {
+	select {
+	case value, ok := <-values:
+		if !ok {
+			t.Fatalf("%v: watch closed", name)
+		}
+		return value
+	case <-time.After(30 * time.Second):
+		t.Fatalf("%v: timed out waiting for a value", name)
+	}
+	return nil
+}
+
+func CheckWatchSrvKeyspace(t *testing.T, ts topo.Server) {
+	cell := getLocalCell(t, ts)
+	stop := make(chan struct{})
+	watch, err := topo.WatchSrvKeyspace(ts, cell, "test_keyspace", stop)
+	if err != nil {
+		t.Fatalf("WatchSrvKeyspace: %v", err)
+	}
+	values := make(chan interface{})
+	go func() {
+		for value := range watch {
+			values <- value
+		}
+		close(values)
+	}()
+
+	// the first value is nil, it doesn't exist yet
+	if value := waitForValue(t, "WatchSrvKeyspace(first)", values).(*topo.SrvKeyspace); value != nil {
+		t.Errorf("WatchSrvKeyspace(first): want nil, got %v", value)
+	}
+
+	// create it, we get it
+	srvKeyspace := &topo.SrvKeyspace{ShardingColumnName: "video_id"}
+	if err := ts.UpdateSrvKeyspace(cell, "test_keyspace", srvKeyspace); err != nil {
+		t.Fatalf("UpdateSrvKeyspace(1): %v", err)
+	}
+	if value := waitForValue(t, "WatchSrvKeyspace(created)", values).(*topo.SrvKeyspace); value == nil || value.ShardingColumnName != "video_id" {
+		t.Errorf("WatchSrvKeyspace(created): bad value %v", value)
+	}
+
+	// update it, we get the new value
+	srvKeyspace.ShardingColumnName = "user_id"
+	if err := ts.UpdateSrvKeyspace(cell, "test_keyspace", srvKeyspace); err != nil {
+		t.Fatalf("UpdateSrvKeyspace(2): %v", err)
+	}
+	if value := waitForValue(t, "WatchSrvKeyspace(updated)", values).(*topo.SrvKeyspace); value == nil || value.ShardingColumnName != "user_id" {
+		t.Errorf("WatchSrvKeyspace(updated): bad value %v", value)
+	}
+
+	// stop it, the channel is closed
+	close(stop)
+	for _ = range values {
+	}
+}
+
+func CheckWatchEndPoints(t *testing.T, ts topo.Server) {
+	cell := getLocalCell(t, ts)
+	stop := make(chan struct{})
+	watch, err := topo.WatchEndPoints(ts, cell, "test_keyspace", "-10", topo.TYPE_MASTER, stop)
+	if err != nil {
+		t.Fatalf("WatchEndPoints: %v", err)
+	}
+	values := make(chan interface{})
+	go func() {
+		for value := range watch {
+			values <- value
+		}
+		close(values)
+	}()
+
+	// the first value is nil, it doesn't exist yet
+	if value := waitForValue(t, "WatchEndPoints(first)", values).(*topo.EndPoints); value != nil {
+		t.Errorf("WatchEndPoints(first): want nil, got %v", value)
+	}
+
+	// create it, we get it
+	endPoints := &topo.EndPoints{
+		Entries: []topo.EndPoint{
+			topo.EndPoint{
+				Uid:          1,
+				Host:         "host1",
+				NamedPortMap: map[string]int{"_vt": 1234},
+			},
+		},
+	}
+	if err := ts.UpdateEndPoints(cell, "test_keyspace", "-10", topo.TYPE_MASTER, endPoints); err != nil {
+		t.Fatalf("UpdateEndPoints: %v", err)
+	}
+	if value := waitForValue(t, "WatchEndPoints(created)", values).(*topo.EndPoints); value == nil || len(value.Entries) != 1 || value.Entries[0].Host != "host1" {
+		t.Errorf("WatchEndPoints(created): bad value %v", value)
+	}
+
+	// delete it, we get nil
+	if err := ts.DeleteEndPoints(cell, "test_keyspace", "-10", topo.TYPE_MASTER); err != nil {
+		t.Fatalf("DeleteEndPoints: %v", err)
+	}
+	if value := waitForValue(t, "WatchEndPoints(deleted)", values).(*topo.EndPoints); value != nil {
+		t.Errorf("WatchEndPoints(deleted): want nil, got %v", value)
+	}
+
+	// stop it, the channel is closed
+	close(stop)
+	for _ = range values {
+	}
+}
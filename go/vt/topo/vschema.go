@@ -0,0 +1,41 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"fmt"
+)
+
+// VSchemaServer is implemented by the Server implementations that can
+// store the VSchema of keyspaces: the JSON description of how their
+// tables are sharded, see the vtgate/vindexes package. The topology
+// doesn't interpret it.
+type VSchemaServer interface {
+	// SaveVSchema writes the VSchema of a keyspace.
+	SaveVSchema(keyspace, vschema string) error
+
+	// GetVSchema reads the VSchema of a keyspace, or returns
+	// ErrNoNode if it has none.
+	GetVSchema(keyspace string) (string, error)
+}
+
+// SaveVSchema writes the VSchema of a keyspace, if ts can store it.
+func SaveVSchema(ts Server, keyspace, vschema string) error {
+	vss, ok := ts.(VSchemaServer)
+	if !ok {
+		return fmt.Errorf("topology server %T cannot store a VSchema", ts)
+	}
+	return vss.SaveVSchema(keyspace, vschema)
+}
+
+// GetVSchema reads the VSchema of a keyspace. It returns ErrNoNode if
+// the keyspace has none.
+func GetVSchema(ts Server, keyspace string) (string, error) {
+	vss, ok := ts.(VSchemaServer)
+	if !ok {
+		return "", fmt.Errorf("topology server %T cannot store a VSchema", ts)
+	}
+	return vss.GetVSchema(keyspace)
+}
@@ -0,0 +1,123 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topo
+
+import (
+	"flag"
+	"reflect"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+var watchPollInterval = flag.Duration("topo_watch_poll_interval", 5*time.Second, "how often the serving graph is read to watch it, with the topology servers that can't notify of its changes")
+
+// SrvGraphWatcher is implemented by the Server implementations that
+// can notify of the changes of the serving graph. The other ones are
+// polled by WatchSrvKeyspace and WatchEndPoints.
+//
+// The watches send the current value first, then the new values as
+// they change, nil if the record doesn't exist. The channel is
+// closed when stop is closed, or if the watch fails, when the
+// caller has to start another watch. The error is only returned if
+// the watch can't be started.
+type SrvGraphWatcher interface {
+	// WatchSrvKeyspace watches the SrvKeyspace of a cell and keyspace.
+	WatchSrvKeyspace(cell, keyspace string, stop chan struct{}) (<-chan *SrvKeyspace, error)
+
+	// WatchEndPoints watches the EndPoints of a cell, keyspace,
+	// shard and tablet type.
+	WatchEndPoints(cell, keyspace, shard string, tabletType TabletType, stop chan struct{}) (<-chan *EndPoints, error)
+}
+
+// WatchSrvKeyspace watches the SrvKeyspace of a cell and keyspace,
+// as described in SrvGraphWatcher.
+func WatchSrvKeyspace(ts Server, cell, keyspace string, stop chan struct{}) (<-chan *SrvKeyspace, error) {
+	if watcher, ok := ts.(SrvGraphWatcher); ok {
+		return watcher.WatchSrvKeyspace(cell, keyspace, stop)
+	}
+
+	get := func() (interface{}, error) {
+		value, err := ts.GetSrvKeyspace(cell, keyspace)
+		if err == ErrNoNode {
+			return (*SrvKeyspace)(nil), nil
+		}
+		return value, err
+	}
+	first, err := get()
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan *SrvKeyspace, 1)
+	result <- first.(*SrvKeyspace)
+	go pollSrvGraph(first, get, func(value interface{}) bool {
+		select {
+		case result <- value.(*SrvKeyspace):
+			return true
+		case <-stop:
+			return false
+		}
+	}, stop, func() { close(result) })
+	return result, nil
+}
+
+// WatchEndPoints watches the EndPoints of a cell, keyspace, shard and
+// tablet type, as described in SrvGraphWatcher.
+func WatchEndPoints(ts Server, cell, keyspace, shard string, tabletType TabletType, stop chan struct{}) (<-chan *EndPoints, error) {
+	if watcher, ok := ts.(SrvGraphWatcher); ok {
+		return watcher.WatchEndPoints(cell, keyspace, shard, tabletType, stop)
+	}
+
+	get := func() (interface{}, error) {
+		value, err := ts.GetEndPoints(cell, keyspace, shard, tabletType)
+		if err == ErrNoNode {
+			return (*EndPoints)(nil), nil
+		}
+		return value, err
+	}
+	first, err := get()
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan *EndPoints, 1)
+	result <- first.(*EndPoints)
+	go pollSrvGraph(first, get, func(value interface{}) bool {
+		select {
+		case result <- value.(*EndPoints):
+			return true
+		case <-stop:
+			return false
+		}
+	}, stop, func() { close(result) })
+	return result, nil
+}
+
+// pollSrvGraph reads a record of the serving graph every
+// watchPollInterval, and sends it when it is different from the
+// last one, until stop is closed or a read fails.
+func pollSrvGraph(last interface{}, get func() (interface{}, error), send func(interface{}) bool, stop chan struct{}, done func()) {
+	defer done()
+	ticker := time.NewTicker(*watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		value, err := get()
+		if err != nil {
+			log.Warningf("cannot poll the serving graph, stopping the watch: %v", err)
+			return
+		}
+		if reflect.DeepEqual(value, last) {
+			continue
+		}
+		if !send(value) {
+			return
+		}
+		last = value
+	}
+}
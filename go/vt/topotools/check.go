@@ -0,0 +1,406 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools
+
+// This file contains the topology consistency checks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// Problem is an inconsistency found by CheckTopology.
+type Problem struct {
+	// Object is the record with the problem: a keyspace, a
+	// keyspace/shard, a tablet alias, or a cell/keyspace/shard
+	// for the serving graph of a shard in a cell.
+	Object string
+
+	// Description says what is wrong.
+	Description string
+
+	// Fix repairs the problem. It is nil if there is no safe way
+	// to do it without an operator, like for a bad master that
+	// needs a reparent.
+	Fix func() error
+}
+
+func (p *Problem) String() string {
+	if p.Fix == nil {
+		return fmt.Sprintf("%v: %v", p.Object, p.Description)
+	}
+	return fmt.Sprintf("%v: %v (fixable)", p.Object, p.Description)
+}
+
+// topologyChecker accumulates the problems found by CheckTopology.
+type topologyChecker struct {
+	log         logutil.Logger
+	ts          topo.Server
+	timeout     time.Duration
+	interrupted chan struct{}
+
+	// tablets has all the tablets of all the cells
+	tablets  map[topo.TabletAlias]*topo.TabletInfo
+	problems []*Problem
+}
+
+func (tc *topologyChecker) report(object string, fix func() error, format string, args ...interface{}) {
+	tc.problems = append(tc.problems, &Problem{
+		Object:      object,
+		Description: fmt.Sprintf(format, args...),
+		Fix:         fix,
+	})
+}
+
+// CheckTopology walks the keyspaces (all of them if keyspaces is
+// empty), their shards, the tablets of all the cells, the replication
+// graph and the serving graph, and returns the inconsistencies it
+// finds: orphaned tablets, bad masters, missing or stale replication
+// and serving graph entries. The problems are returned in the order
+// they have to be fixed in, as the serving graph is rebuilt from the
+// replication graph. The error is only returned if the topology can't
+// be read.
+//
+// timeout and interrupted are used to lock the serving graph when
+// the fixes rebuild it.
+func CheckTopology(log logutil.Logger, ts topo.Server, keyspaces []string, timeout time.Duration, interrupted chan struct{}) ([]*Problem, error) {
+	tc := &topologyChecker{
+		log:         log,
+		ts:          ts,
+		timeout:     timeout,
+		interrupted: interrupted,
+		tablets:     make(map[topo.TabletAlias]*topo.TabletInfo),
+	}
+
+	checkAll := len(keyspaces) == 0
+	if checkAll {
+		var err error
+		if keyspaces, err = ts.GetKeyspaces(); err != nil {
+			return nil, fmt.Errorf("GetKeyspaces failed: %v", err)
+		}
+	}
+
+	// read all the tablets
+	cells, err := ts.GetKnownCells()
+	if err != nil {
+		return nil, fmt.Errorf("GetKnownCells failed: %v", err)
+	}
+	for _, cell := range cells {
+		aliases, err := ts.GetTabletsByCell(cell)
+		if err != nil && err != topo.ErrNoNode {
+			return nil, fmt.Errorf("GetTabletsByCell(%v) failed: %v", cell, err)
+		}
+		tablets, err := topo.GetTabletMap(ts, aliases)
+		if err != nil && err != topo.ErrPartialResult {
+			return nil, fmt.Errorf("GetTabletMap in cell %v failed: %v", cell, err)
+		}
+		for alias, ti := range tablets {
+			tc.tablets[alias] = ti
+		}
+	}
+
+	// check the keyspaces, and find the tablets of the shards
+	// that don't exist
+	shardsPerKeyspace := make(map[string]map[string]*topo.ShardInfo)
+	for _, keyspace := range keyspaces {
+		shards, err := topo.FindAllShardsInKeyspace(ts, keyspace)
+		if err != nil {
+			return nil, fmt.Errorf("FindAllShardsInKeyspace(%v) failed: %v", keyspace, err)
+		}
+		shardsPerKeyspace[keyspace] = shards
+		if err := tc.checkKeyspace(keyspace, shards); err != nil {
+			return nil, err
+		}
+	}
+	for _, alias := range sortedAliases(tc.tablets) {
+		ti := tc.tablets[alias]
+		if !ti.IsAssigned() {
+			continue
+		}
+		shards, ok := shardsPerKeyspace[ti.Keyspace]
+		if !ok {
+			if checkAll {
+				tc.report(alias.String(), nil, "orphaned %v tablet, its keyspace %v doesn't exist", ti.Type, ti.Keyspace)
+			}
+			continue
+		}
+		if _, ok := shards[ti.Shard]; !ok {
+			tc.report(alias.String(), nil, "orphaned %v tablet, its shard %v/%v doesn't exist", ti.Type, ti.Keyspace, ti.Shard)
+		}
+	}
+	return tc.problems, nil
+}
+
+func (tc *topologyChecker) checkKeyspace(keyspace string, shards map[string]*topo.ShardInfo) error {
+	shardNames := make([]string, 0, len(shards))
+	for shard := range shards {
+		shardNames = append(shardNames, shard)
+	}
+	sort.Strings(shardNames)
+
+	cells := make(map[string]bool)
+	for _, shard := range shardNames {
+		si := shards[shard]
+		tc.checkMaster(si)
+		for _, cell := range si.Cells {
+			cells[cell] = true
+			if err := tc.checkReplicationGraph(si, cell); err != nil {
+				return err
+			}
+		}
+		for _, cell := range si.Cells {
+			if err := tc.checkServingGraph(si, cell); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the SrvKeyspace is only rebuilt with a keyspace lock, it is
+	// not fixed here
+	for _, cell := range sortedCells(cells) {
+		if _, err := tc.ts.GetSrvKeyspace(cell, keyspace); err != nil {
+			if err != topo.ErrNoNode {
+				return fmt.Errorf("GetSrvKeyspace(%v, %v) failed: %v", cell, keyspace, err)
+			}
+			tc.report(cell+"/"+keyspace, nil, "missing SrvKeyspace, run RebuildKeyspaceGraph")
+		}
+	}
+	return nil
+}
+
+// shardTablets returns the tablets of the shard in cell, sorted.
+func (tc *topologyChecker) shardTablets(si *topo.ShardInfo, cell string) []*topo.TabletInfo {
+	var result []*topo.TabletInfo
+	for _, alias := range sortedAliases(tc.tablets) {
+		ti := tc.tablets[alias]
+		if ti.Keyspace == si.Keyspace() && ti.Shard == si.ShardName() && (cell == "" || alias.Cell == cell) {
+			result = append(result, ti)
+		}
+	}
+	return result
+}
+
+// checkMaster checks the master of the shard is a master tablet, and
+// that it is the only one. It needs a reparent to be fixed.
+func (tc *topologyChecker) checkMaster(si *topo.ShardInfo) {
+	name := si.Keyspace() + "/" + si.ShardName()
+	if si.MasterAlias.IsZero() {
+		tc.report(name, nil, "shard has no master")
+	} else if ti, ok := tc.tablets[si.MasterAlias]; !ok {
+		tc.report(name, nil, "master %v doesn't exist", si.MasterAlias)
+	} else if ti.Type != topo.TYPE_MASTER || ti.Keyspace != si.Keyspace() || ti.Shard != si.ShardName() {
+		tc.report(name, nil, "master %v is a %v tablet of %v/%v", si.MasterAlias, ti.Type, ti.Keyspace, ti.Shard)
+	}
+
+	for _, ti := range tc.shardTablets(si, "") {
+		if ti.Type == topo.TYPE_MASTER && ti.Alias != si.MasterAlias {
+			tc.report(ti.Alias.String(), nil, "master tablet, but the master of shard %v is %v", name, si.MasterAlias)
+		}
+		if !si.HasCell(ti.Alias.Cell) && ti.IsInReplicationGraph() {
+			tc.report(ti.Alias.String(), nil, "in cell %v, which is not a cell of shard %v", ti.Alias.Cell, name)
+		}
+	}
+}
+
+// checkReplicationGraph checks the ShardReplication of the shard in
+// cell has all the tablets of the shard, and only them.
+func (tc *topologyChecker) checkReplicationGraph(si *topo.ShardInfo, cell string) error {
+	keyspace, shard := si.Keyspace(), si.ShardName()
+	name := cell + "/" + keyspace + "/" + shard
+	links := make(map[topo.TabletAlias]topo.ReplicationLink)
+	sri, err := tc.ts.GetShardReplication(cell, keyspace, shard)
+	switch err {
+	case nil:
+		for _, link := range sri.ReplicationLinks {
+			links[link.TabletAlias] = link
+		}
+	case topo.ErrNoNode:
+	default:
+		return fmt.Errorf("GetShardReplication(%v) failed: %v", name, err)
+	}
+
+	remove := func(alias topo.TabletAlias) func() error {
+		return func() error {
+			return topo.RemoveShardReplicationRecord(tc.ts, keyspace, shard, alias)
+		}
+	}
+	for _, alias := range sortedLinks(links) {
+		ti, ok := tc.tablets[alias]
+		switch {
+		case !ok:
+			tc.report(name, remove(alias), "replication graph has tablet %v, which doesn't exist", alias)
+		case ti.Type == topo.TYPE_SCRAP:
+			tc.report(name, remove(alias), "replication graph has tablet %v, which is scrapped", alias)
+		case ti.Keyspace != keyspace || ti.Shard != shard:
+			tc.report(name, remove(alias), "replication graph has tablet %v, which belongs to %v/%v", alias, ti.Keyspace, ti.Shard)
+		}
+	}
+
+	// the masters are not always in the replication graph, the
+	// slaves have to be
+	for _, ti := range tc.shardTablets(si, cell) {
+		if !ti.IsInReplicationGraph() || ti.Type == topo.TYPE_MASTER {
+			continue
+		}
+		link, ok := links[ti.Alias]
+		if ok && link.Parent == ti.Parent {
+			continue
+		}
+		alias, parent := ti.Alias, ti.Parent
+		fix := func() error {
+			return topo.AddShardReplicationRecord(tc.ts, keyspace, shard, alias, parent)
+		}
+		if ok {
+			tc.report(ti.Alias.String(), fix, "has parent %v, but %v in the replication graph", ti.Parent, link.Parent)
+		} else {
+			tc.report(ti.Alias.String(), fix, "%v tablet missing from the replication graph", ti.Type)
+		}
+	}
+	return nil
+}
+
+// checkServingGraph checks the SrvShard and EndPoints of the shard in
+// cell match its serving tablets. They are fixed by rebuilding the
+// serving graph of the shard in that cell.
+func (tc *topologyChecker) checkServingGraph(si *topo.ShardInfo, cell string) error {
+	keyspace, shard := si.Keyspace(), si.ShardName()
+	name := cell + "/" + keyspace + "/" + shard
+	var issues []string
+
+	if _, err := tc.ts.GetSrvShard(cell, keyspace, shard); err != nil {
+		if err != topo.ErrNoNode {
+			return fmt.Errorf("GetSrvShard(%v) failed: %v", name, err)
+		}
+		issues = append(issues, "missing SrvShard")
+	}
+
+	// the uids that should be served, per type
+	expected := make(map[topo.TabletType]map[uint32]bool)
+	for _, ti := range tc.shardTablets(si, cell) {
+		if !ti.IsInReplicationGraph() || !ti.IsInServingGraph() {
+			continue
+		}
+		if ti.Type == topo.TYPE_MASTER && ti.Alias != si.MasterAlias {
+			// only the master of the shard is served
+			continue
+		}
+		if _, err := ti.EndPoint(); err != nil {
+			// RebuildShard skips them too
+			continue
+		}
+		if expected[ti.Type] == nil {
+			expected[ti.Type] = make(map[uint32]bool)
+		}
+		expected[ti.Type][ti.Alias.Uid] = true
+	}
+
+	tabletTypes, err := tc.ts.GetSrvTabletTypesPerShard(cell, keyspace, shard)
+	if err != nil && err != topo.ErrNoNode {
+		return fmt.Errorf("GetSrvTabletTypesPerShard(%v) failed: %v", name, err)
+	}
+	served := make(map[topo.TabletType]bool)
+	for _, tabletType := range tabletTypes {
+		served[tabletType] = true
+		endPoints, err := tc.ts.GetEndPoints(cell, keyspace, shard, tabletType)
+		if err != nil {
+			if err != topo.ErrNoNode {
+				return fmt.Errorf("GetEndPoints(%v, %v) failed: %v", name, tabletType, err)
+			}
+			continue
+		}
+		uids := expected[tabletType]
+		seen := make(map[uint32]bool)
+		for _, entry := range endPoints.Entries {
+			seen[entry.Uid] = true
+			if !uids[entry.Uid] {
+				issues = append(issues, fmt.Sprintf("stale %v entry %v", tabletType, entry.Uid))
+			}
+		}
+		for _, uid := range sortedUids(uids) {
+			if !seen[uid] {
+				issues = append(issues, fmt.Sprintf("missing %v entry %v", tabletType, uid))
+			}
+		}
+	}
+	for tabletType, uids := range expected {
+		if !served[tabletType] {
+			issues = append(issues, fmt.Sprintf("missing %v EndPoints for %v tablets", tabletType, len(uids)))
+		}
+	}
+
+	if len(issues) > 0 {
+		sort.Strings(issues)
+		tc.report(name, func() error {
+			return RebuildShard(tc.log, tc.ts, keyspace, shard, []string{cell}, tc.timeout, tc.interrupted)
+		}, "serving graph out of date: %v", strings.Join(issues, ", "))
+	}
+	return nil
+}
+
+func sortedAliases(tablets map[topo.TabletAlias]*topo.TabletInfo) []topo.TabletAlias {
+	result := make(topo.TabletAliasList, 0, len(tablets))
+	for alias := range tablets {
+		result = append(result, alias)
+	}
+	sort.Sort(result)
+	return result
+}
+
+func sortedLinks(links map[topo.TabletAlias]topo.ReplicationLink) []topo.TabletAlias {
+	result := make(topo.TabletAliasList, 0, len(links))
+	for alias := range links {
+		result = append(result, alias)
+	}
+	sort.Sort(result)
+	return result
+}
+
+func sortedCells(cells map[string]bool) []string {
+	result := make([]string, 0, len(cells))
+	for cell := range cells {
+		result = append(result, cell)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sortedUids(uids map[uint32]bool) []uint32 {
+	result := make([]uint32, 0, len(uids))
+	for uid := range uids {
+		result = append(result, uid)
+	}
+	sort.Sort(uint32Slice(result))
+	return result
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// FixProblems applies the fixes of the problems that have one, in
+// order, and returns the problems that are left: the ones without a
+// fix, and the ones whose fix failed.
+func FixProblems(log logutil.Logger, problems []*Problem) []*Problem {
+	var left []*Problem
+	for _, p := range problems {
+		if p.Fix == nil {
+			left = append(left, p)
+			continue
+		}
+		log.Infof("Fixing %v", p)
+		if err := p.Fix(); err != nil {
+			log.Warningf("Cannot fix %v: %v", p, err)
+			left = append(left, p)
+		}
+	}
+	return left
+}
@@ -0,0 +1,134 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/memorytopo"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+func checkTablet(uid uint32, parent uint32, keyspace, shard string, tabletType topo.TabletType) *topo.Tablet {
+	tablet := &topo.Tablet{
+		Alias:    topo.TabletAlias{Cell: "test", Uid: uid},
+		Hostname: "host",
+		IPAddr:   "1.2.3.4",
+		Portmap:  map[string]int{"vt": 1000 + int(uid), "mysql": 2000 + int(uid)},
+		Keyspace: keyspace,
+		Shard:    shard,
+		Type:     tabletType,
+	}
+	if parent != 0 {
+		tablet.Parent = topo.TabletAlias{Cell: "test", Uid: parent}
+	}
+	return tablet
+}
+
+// newCheckedTopology returns a consistent topology: a keyspace with a
+// shard, its master and a replica, and its serving graph.
+func newCheckedTopology(t *testing.T) topo.Server {
+	ts := memorytopo.NewServer([]string{"test"})
+	if err := ts.CreateKeyspace("test_keyspace", &topo.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	if err := topo.CreateShard(ts, "test_keyspace", "0"); err != nil {
+		t.Fatalf("CreateShard: %v", err)
+	}
+	si, err := ts.GetShard("test_keyspace", "0")
+	if err != nil {
+		t.Fatalf("GetShard: %v", err)
+	}
+	si.MasterAlias = topo.TabletAlias{Cell: "test", Uid: 1}
+	si.Cells = []string{"test"}
+	if err := ts.UpdateShard(si); err != nil {
+		t.Fatalf("UpdateShard: %v", err)
+	}
+	for _, tablet := range []*topo.Tablet{
+		checkTablet(1, 0, "test_keyspace", "0", topo.TYPE_MASTER),
+		checkTablet(2, 1, "test_keyspace", "0", topo.TYPE_REPLICA),
+	} {
+		if err := topo.CreateTablet(ts, tablet); err != nil {
+			t.Fatalf("CreateTablet: %v", err)
+		}
+	}
+	if err := RebuildShard(logutil.NewConsoleLogger(), ts, "test_keyspace", "0", []string{"test"}, time.Second, nil); err != nil {
+		t.Fatalf("RebuildShard: %v", err)
+	}
+	if err := ts.UpdateSrvKeyspace("test", "test_keyspace", &topo.SrvKeyspace{}); err != nil {
+		t.Fatalf("UpdateSrvKeyspace: %v", err)
+	}
+	return ts
+}
+
+func checkTopology(t *testing.T, ts topo.Server) []*Problem {
+	problems, err := CheckTopology(logutil.NewConsoleLogger(), ts, nil, time.Second, nil)
+	if err != nil {
+		t.Fatalf("CheckTopology: %v", err)
+	}
+	return problems
+}
+
+func TestCheckTopologyConsistent(t *testing.T) {
+	ts := newCheckedTopology(t)
+	if problems := checkTopology(t, ts); len(problems) != 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+}
+
+func TestCheckTopologyProblems(t *testing.T) {
+	ts := newCheckedTopology(t)
+
+	// an orphaned tablet, a second master, a replica missing from
+	// the replication graph and the serving graph, and a stale
+	// replication graph entry
+	for _, tablet := range []*topo.Tablet{
+		checkTablet(3, 0, "test_keyspace", "80-", topo.TYPE_REPLICA),
+		checkTablet(4, 0, "test_keyspace", "0", topo.TYPE_MASTER),
+	} {
+		if err := ts.CreateTablet(tablet); err != nil {
+			t.Fatalf("CreateTablet: %v", err)
+		}
+	}
+	if err := ts.CreateTablet(checkTablet(5, 1, "test_keyspace", "0", topo.TYPE_REPLICA)); err != nil {
+		t.Fatalf("CreateTablet: %v", err)
+	}
+	if err := topo.AddShardReplicationRecord(ts, "test_keyspace", "0", topo.TabletAlias{Cell: "test", Uid: 6}, topo.TabletAlias{Cell: "test", Uid: 1}); err != nil {
+		t.Fatalf("AddShardReplicationRecord: %v", err)
+	}
+
+	problems := checkTopology(t, ts)
+	want := []string{
+		"test-0000000004: master tablet, but the master of shard test_keyspace/0 is test-0000000001",
+		"test/test_keyspace/0: replication graph has tablet test-0000000006, which doesn't exist (fixable)",
+		"test-0000000005: replica tablet missing from the replication graph (fixable)",
+		"test/test_keyspace/0: serving graph out of date: missing replica entry 5 (fixable)",
+		"test-0000000003: orphaned replica tablet, its shard test_keyspace/80- doesn't exist",
+	}
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got problems:\n%v\nwant:\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the fixable ones are fixed, in order
+	left := FixProblems(logutil.NewConsoleLogger(), problems)
+	if len(left) != 2 {
+		t.Errorf("FixProblems left %v", left)
+	}
+	problems = checkTopology(t, ts)
+	if len(problems) != 2 || problems[0].Object != "test-0000000004" || problems[1].Object != "test-0000000003" {
+		t.Errorf("problems after the fixes: %v", problems)
+	}
+	endPoints, err := ts.GetEndPoints("test", "test_keyspace", "0", topo.TYPE_REPLICA)
+	if err != nil || len(endPoints.Entries) != 2 {
+		t.Errorf("GetEndPoints after the fixes: %v %v", endPoints, err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools
+
+// This file contains the copy of the global records into the cells
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/concurrency"
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// CopyGlobalRecords copies the global records of all the keyspaces,
+// the keyspace and its shards, into the cells (all the known cells if
+// cells is empty), see topo.GlobalCopy. The copies of the keyspaces
+// that don't exist any more are deleted. All the global records are
+// read first: if that fails, the existing copies are left alone, and
+// get older.
+func CopyGlobalRecords(log logutil.Logger, ts topo.Server, cells []string) error {
+	gcs, ok := ts.(topo.GlobalCopyServer)
+	if !ok {
+		return fmt.Errorf("the topology server %T cannot keep copies of the global records", ts)
+	}
+
+	var err error
+	if len(cells) == 0 {
+		if cells, err = ts.GetKnownCells(); err != nil {
+			return fmt.Errorf("GetKnownCells failed: %v", err)
+		}
+	}
+
+	// read all the global records
+	keyspaces, err := ts.GetKeyspaces()
+	if err != nil {
+		return fmt.Errorf("GetKeyspaces failed: %v", err)
+	}
+	now := time.Now()
+	copies := make(map[string]*topo.GlobalCopy, len(keyspaces))
+	for _, keyspace := range keyspaces {
+		ki, err := ts.GetKeyspace(keyspace)
+		if err != nil {
+			return fmt.Errorf("GetKeyspace(%v) failed: %v", keyspace, err)
+		}
+		shards, err := topo.FindAllShardsInKeyspace(ts, keyspace)
+		if err != nil {
+			return fmt.Errorf("FindAllShardsInKeyspace(%v) failed: %v", keyspace, err)
+		}
+		gc := &topo.GlobalCopy{
+			Keyspace:  ki.Keyspace,
+			Shards:    make(map[string]*topo.Shard, len(shards)),
+			Refreshed: now,
+		}
+		for shard, si := range shards {
+			gc.Shards[shard] = si.Shard
+		}
+		copies[keyspace] = gc
+	}
+
+	// and write them to the cells
+	rec := concurrency.AllErrorRecorder{}
+	for _, cell := range cells {
+		for keyspace, gc := range copies {
+			if err := gcs.UpdateGlobalCopy(cell, keyspace, gc); err != nil {
+				rec.RecordError(fmt.Errorf("UpdateGlobalCopy(%v, %v) failed: %v", cell, keyspace, err))
+			}
+		}
+
+		existing, err := gcs.GetGlobalCopyKeyspaces(cell)
+		if err != nil {
+			rec.RecordError(fmt.Errorf("GetGlobalCopyKeyspaces(%v) failed: %v", cell, err))
+			continue
+		}
+		for _, keyspace := range existing {
+			if _, ok := copies[keyspace]; ok {
+				continue
+			}
+			log.Infof("Deleting the copy of keyspace %v in cell %v, it doesn't exist any more", keyspace, cell)
+			if err := gcs.DeleteGlobalCopy(cell, keyspace); err != nil && err != topo.ErrNoNode {
+				rec.RecordError(fmt.Errorf("DeleteGlobalCopy(%v, %v) failed: %v", cell, keyspace, err))
+			}
+		}
+	}
+	return rec.Error()
+}
+
+// CopyGlobalRecordsLoop runs CopyGlobalRecords every interval, until
+// stop is closed.
+func CopyGlobalRecordsLoop(log logutil.Logger, ts topo.Server, cells []string, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := CopyGlobalRecords(log, ts, cells); err != nil {
+			log.Warningf("Cannot copy the global records to the cells: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
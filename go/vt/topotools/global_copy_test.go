@@ -0,0 +1,81 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package topotools
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/youtube/vitess/go/vt/logutil"
+	"github.com/youtube/vitess/go/vt/memorytopo"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var errGlobalDown = errors.New("global topology is down")
+
+// globalDownServer fails to read the global keyspaces and shards.
+type globalDownServer struct {
+	*memorytopo.Server
+}
+
+func (s globalDownServer) GetKeyspace(keyspace string) (*topo.KeyspaceInfo, error) {
+	return nil, errGlobalDown
+}
+
+func (s globalDownServer) GetShard(keyspace, shard string) (*topo.ShardInfo, error) {
+	return nil, errGlobalDown
+}
+
+func TestCopyGlobalRecords(t *testing.T) {
+	ts := memorytopo.NewServer([]string{"cell1", "cell2"})
+	if err := ts.CreateKeyspace("test_keyspace", &topo.Keyspace{ShardingColumnName: "user_id"}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	for _, shard := range []string{"-80", "80-"} {
+		if err := topo.CreateShard(ts, "test_keyspace", shard); err != nil {
+			t.Fatalf("CreateShard: %v", err)
+		}
+	}
+	// the copy of a keyspace that is gone
+	if err := ts.UpdateGlobalCopy("cell1", "old_keyspace", &topo.GlobalCopy{}); err != nil {
+		t.Fatalf("UpdateGlobalCopy: %v", err)
+	}
+
+	if err := CopyGlobalRecords(logutil.NewConsoleLogger(), ts, nil); err != nil {
+		t.Fatalf("CopyGlobalRecords: %v", err)
+	}
+	for _, cell := range []string{"cell1", "cell2"} {
+		keyspaces, err := ts.GetGlobalCopyKeyspaces(cell)
+		if err != nil || len(keyspaces) != 1 || keyspaces[0] != "test_keyspace" {
+			t.Errorf("GetGlobalCopyKeyspaces(%v): %v %v", cell, keyspaces, err)
+		}
+	}
+
+	// with the global topology up, the global records are read
+	ki, age, err := topo.GetKeyspaceOrCopy(ts, "cell1", "test_keyspace")
+	if err != nil || age != 0 || ki.ShardingColumnName != "user_id" {
+		t.Errorf("GetKeyspaceOrCopy(up): %v %v %v", ki, age, err)
+	}
+	if _, _, err := topo.GetShardOrCopy(ts, "cell1", "test_keyspace", "c0-"); err != topo.ErrNoNode {
+		t.Errorf("GetShardOrCopy(up, unknown shard): %v", err)
+	}
+
+	// with the global topology down, the copies are read
+	down := globalDownServer{ts}
+	ki, age, err = topo.GetKeyspaceOrCopy(down, "cell2", "test_keyspace")
+	if err != nil || age <= 0 || ki.KeyspaceName() != "test_keyspace" || ki.ShardingColumnName != "user_id" {
+		t.Errorf("GetKeyspaceOrCopy(down): %v %v %v", ki, age, err)
+	}
+	si, age, err := topo.GetShardOrCopy(down, "cell2", "test_keyspace", "80-")
+	if err != nil || age <= 0 || si.ShardName() != "80-" || string(si.KeyRange.Start.Hex()) != "80" {
+		t.Errorf("GetShardOrCopy(down): %v %v %v", si, age, err)
+	}
+	if _, _, err := topo.GetShardOrCopy(down, "cell2", "test_keyspace", "c0-"); err != errGlobalDown {
+		t.Errorf("GetShardOrCopy(down, unknown shard): %v", err)
+	}
+	if _, _, err := topo.GetKeyspaceOrCopy(down, "", "test_keyspace"); err != errGlobalDown {
+		t.Errorf("GetKeyspaceOrCopy(down, no cell): %v", err)
+	}
+}
@@ -12,18 +12,24 @@ import (
 	"net"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/flagutil"
 	"github.com/youtube/vitess/go/jscfg"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/vt/client2"
 	hk "github.com/youtube/vitess/go/vt/hook"
 	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
 	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/schemamanager"
 	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
 	"github.com/youtube/vitess/go/vt/wrangler"
 )
 
@@ -73,6 +79,9 @@ var commands = []commandGroup{
 			command{"SetBlacklistedTables", commandSetBlacklistedTables,
 				"[<tablet alias|zk tablet path>] [table1,table2,...]",
 				"Sets the list of blacklisted tables for a tablet. Use no tables to clear the list."},
+			command{"SetQueryRules", commandSetQueryRules,
+				"<tablet alias|zk tablet path> [rules json]",
+				"Sets the dynamic query rules for a tablet, as a JSON list of rules. Use no rules to clear them."},
 			command{"ChangeSlaveType", commandChangeSlaveType,
 				"[-force] [-dry-run] <tablet alias|zk tablet path> <tablet type>",
 				"Change the db type for this tablet if possible. This is mostly for arranging replicas - it will not convert a master.\n" +
@@ -121,6 +130,12 @@ var commands = []commandGroup{
 			command{"ExecuteFetch", commandExecuteFetch,
 				"[--max_rows=10000] [--want_fields] [--disable_binlogs] <tablet alias|zk tablet path> <sql command>",
 				"Runs the given sql command as a DBA on the remote tablet"},
+			command{"FindSlowQueries", commandFindSlowQueries,
+				"[-user=] [-min_time=0] [-state=] <tablet alias|zk tablet path>",
+				"Lists the statements running in mysqld on the tablet, longest running first."},
+			command{"KillQuery", commandKillQuery,
+				"[-connection] <tablet alias|zk tablet path> <process id>",
+				"Kills a statement running in mysqld on the tablet, or its whole connection with -connection."},
 		},
 	},
 	commandGroup{
@@ -192,6 +207,12 @@ var commands = []commandGroup{
 			command{"MigrateServedFrom", commandMigrateServedFrom,
 				"[-reverse] [-skip-rebuild] <destination keyspace/shard|zk destination shard path> <served type>",
 				"Makes the destination keyspace/shard serve the given type. Will also rebuild the serving graph."},
+			command{"ApplyVSchema", commandApplyVSchema,
+				"{-vschema=<json> || -vschema-file=<filename>} <keyspace|zk keyspace path>",
+				"Validates and saves the VSchema of the keyspace, which describes how its tables are sharded."},
+			command{"GetVSchema", commandGetVSchema,
+				"<keyspace|zk keyspace path>",
+				"Outputs the json VSchema of the keyspace to stdout."},
 		},
 	},
 	commandGroup{
@@ -205,6 +226,12 @@ var commands = []commandGroup{
 			command{"Validate", commandValidate,
 				"[-ping-tablets]",
 				"Validate all nodes reachable from global replication graph and all tablets in all discoverable cells are consistent."},
+			command{"ValidateTopology", commandValidateTopology,
+				"[-fix] [<keyspace|zk keyspace path> ...]",
+				"Check the topology records of the keyspaces (all of them by default) are consistent: orphaned tablets, bad masters, missing or stale replication and serving graph entries. With -fix, the problems that can be fixed safely are."},
+			command{"CopyGlobalRecords", commandCopyGlobalRecords,
+				"[<cell> ...]",
+				"Copy the global keyspace and shard records into the cells (all of them by default), where they are read when the global topology is not available. vtctld does it periodically with -global_copy_interval."},
 			command{"RebuildReplicationGraph", commandRebuildReplicationGraph,
 				"<cell1|zk local vt path1>,<cell2|zk local vt path2>... <keyspace1>,<keyspace2>,...",
 				"HIDDEN This takes the Thor's hammer approach of recovery and should only be used in emergencies.  cell1,cell2,... are the canonical source of data for the system. This function uses that canonical data to recover the replication graph, at which point further auditing with Validate can reveal any remaining issues."},
@@ -214,6 +241,12 @@ var commands = []commandGroup{
 			command{"ListTablets", commandListTablets,
 				"<tablet alias|zk tablet path> ...",
 				"List specified tablets in an awk-friendly way."},
+			command{"ListLocks", commandListLocks,
+				"<keyspace|zk keyspace path|keyspace/shard|zk shard path> ...",
+				"List the action locks held on the keyspaces and their shards, or on the shards, with the action, owner and start time of their holder."},
+			command{"ForceUnlock", commandForceUnlock,
+				"[-older_than=<duration>] <keyspace|zk keyspace path|keyspace/shard|zk shard path> ...",
+				"Forcibly release the action locks held on the keyspaces and their shards, or on the shards, for longer than -older_than. Only use it when the holder of a lock is stuck: it will fail to release it, and its changes may be partial."},
 		},
 	},
 	commandGroup{
@@ -242,6 +275,12 @@ var commands = []commandGroup{
 			command{"ApplySchemaKeyspace", commandApplySchemaKeyspace,
 				"[-force] {-sql=<sql> || -sql-file=<filename>} [-simple] <keyspace|zk keyspace path>",
 				"Apply the schema change to the specified keyspace. If simple is specified, we just apply on the live masters. Otherwise we will need to do the shell game on each shard. So we will apply the schema change to every single slave (running in parallel on all shards, but on one host at a time in a given shard). We will not reparent at the end, so the masters won't be touched at all. Using the force flag will cause a bunch of checks to be ignored, use with care."},
+			command{"SnapshotSchemaKeyspace", commandSnapshotSchemaKeyspace,
+				"<keyspace|zk keyspace path>",
+				"Display the schema of all the shard masters of the keyspace, to be used later with ApplySchemaDiff."},
+			command{"ApplySchemaDiff", commandApplySchemaDiff,
+				"[-force] {-sql=<sql> || -sql-file=<filename> || -snapshot-file=<filename>} [-simple] [-dry-run] <keyspace|zk keyspace path>",
+				"Diff the schema of each shard with the desired one, and apply the resulting ALTER statements with ApplySchemaShard, after validating them on the masters. The desired schema is either the CREATE statements in the sql, or a snapshot from SnapshotSchemaKeyspace. With dry-run, only display the statements."},
 
 			command{"ValidateVersionShard", commandValidateVersionShard,
 				"<keyspace/shard|zk shard path>",
@@ -805,6 +844,29 @@ func commandSetBlacklistedTables(wr *wrangler.Wrangler, subFlags *flag.FlagSet,
 	return "", wr.ActionInitiator().SetBlacklistedTables(ti, tables, wr.ActionTimeout())
 }
 
+func commandSetQueryRules(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 && subFlags.NArg() != 2 {
+		return "", fmt.Errorf("action SetQueryRules requires <tablet alias|zk tablet path> [rules json]")
+	}
+
+	tabletAlias, err := tabletParamToTabletAlias(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	var rules string
+	if subFlags.NArg() == 2 {
+		rules = subFlags.Arg(1)
+	}
+	ti, err := wr.TopoServer().GetTablet(tabletAlias)
+	if err != nil {
+		return "", fmt.Errorf("failed reading tablet %v: %v", tabletAlias, err)
+	}
+	return "", wr.ActionInitiator().SetQueryRules(ti, rules, wr.ActionTimeout())
+}
+
 func commandChangeSlaveType(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	force := subFlags.Bool("force", false, "will change the type in zookeeper, and not run hooks")
 	dryRun := subFlags.Bool("dry-run", false, "just list the proposed change")
@@ -1110,6 +1172,63 @@ func commandExecuteFetch(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []s
 	return "", err
 }
 
+func commandFindSlowQueries(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	user := subFlags.String("user", "", "only list the statements of this MySQL user")
+	minTime := subFlags.Duration("min_time", 0, "only list the statements running for at least this long")
+	state := subFlags.String("state", "", "only list the statements in this state")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 {
+		return "", fmt.Errorf("action FindSlowQueries requires <tablet alias|zk tablet path>")
+	}
+
+	alias, err := tabletParamToTabletAlias(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	filter := &mysqlctl.ProcessFilter{User: *user, MinTime: *minTime, State: *state}
+	qr, err := wr.ExecuteFetch(alias, filter.Query(), 10000, false, false)
+	if err != nil {
+		return "", err
+	}
+	processes, err := mysqlctl.ProcessesFromQueryResult(qr)
+	if err == nil {
+		fmt.Println(jscfg.ToJson(processes))
+	}
+	return "", err
+}
+
+func commandKillQuery(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	connection := subFlags.Bool("connection", false, "kill the connection, rolling back its transaction, not only the statement")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 2 {
+		return "", fmt.Errorf("action KillQuery requires <tablet alias|zk tablet path> <process id>")
+	}
+
+	alias, err := tabletParamToTabletAlias(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	id, err := strconv.ParseInt(subFlags.Arg(1), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid process id %v: %v", subFlags.Arg(1), err)
+	}
+	return "", mysqlctl.KillQuery(&tabletFetcher{wr, alias}, id, *connection)
+}
+
+// tabletFetcher executes the queries of mysqlctl.KillQuery on a tablet.
+type tabletFetcher struct {
+	wr    *wrangler.Wrangler
+	alias topo.TabletAlias
+}
+
+func (tf *tabletFetcher) ExecuteFetch(query string, maxrows int, wantfields bool) (*mproto.QueryResult, error) {
+	return tf.wr.ExecuteFetch(tf.alias, query, maxrows, wantfields, false)
+}
+
 func commandExecuteHook(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	if err := subFlags.Parse(args); err != nil {
 		return "", err
@@ -1506,6 +1625,56 @@ func commandGetKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return "", err
 }
 
+func commandApplyVSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	vschema := subFlags.String("vschema", "", "VSchema")
+	vschemaFile := subFlags.String("vschema-file", "", "file containing the VSchema")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 {
+		return "", fmt.Errorf("action ApplyVSchema requires <keyspace|zk keyspace path>")
+	}
+
+	keyspace, err := keyspaceParamToKeyspace(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	data, err := getFileParam(*vschema, *vschemaFile, "vschema")
+	if err != nil {
+		return "", err
+	}
+	kf, err := vindexes.ParseKeyspaceFormal(data)
+	if err != nil {
+		return "", err
+	}
+	if _, err := vindexes.BuildVSchema(map[string]*vindexes.KeyspaceFormal{keyspace: kf}); err != nil {
+		return "", err
+	}
+	if _, err := wr.TopoServer().GetKeyspace(keyspace); err != nil {
+		return "", fmt.Errorf("cannot read keyspace %v: %v", keyspace, err)
+	}
+	return "", topo.SaveVSchema(wr.TopoServer(), keyspace, data)
+}
+
+func commandGetVSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 {
+		return "", fmt.Errorf("action GetVSchema requires <keyspace|zk keyspace path>")
+	}
+
+	keyspace, err := keyspaceParamToKeyspace(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	vschema, err := topo.GetVSchema(wr.TopoServer(), keyspace)
+	if err == nil {
+		fmt.Println(vschema)
+	}
+	return "", err
+}
+
 func commandSetKeyspaceShardingInfo(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	force := subFlags.Bool("force", false, "will update the fields even if they're already set, use with care")
 	if err := subFlags.Parse(args); err != nil {
@@ -1678,6 +1847,39 @@ func commandValidate(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []strin
 	return "", wr.Validate(*pingTablets)
 }
 
+func commandValidateTopology(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	fix := subFlags.Bool("fix", false, "fix the problems that can be fixed safely")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+
+	var keyspaces []string
+	if subFlags.NArg() > 0 {
+		var err error
+		if keyspaces, err = keyspaceParamsToKeyspaces(wr, subFlags.Args()); err != nil {
+			return "", err
+		}
+	}
+	problems, err := wr.CheckTopology(keyspaces, *fix)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return "", fmt.Errorf("%v topology problems found", len(problems))
+	}
+	return "", nil
+}
+
+func commandCopyGlobalRecords(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	return "", topotools.CopyGlobalRecords(wr.Logger(), wr.TopoServer(), subFlags.Args())
+}
+
 func commandRebuildReplicationGraph(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	// This is sort of a nuclear option.
 	if err := subFlags.Parse(args); err != nil {
@@ -1746,6 +1948,120 @@ func commandListTablets(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []st
 	return "", dumpTablets(wr.TopoServer(), aliases)
 }
 
+// lockTarget is a keyspace, or a shard if shard is set, as locked by
+// the actions.
+type lockTarget struct {
+	keyspace string
+	shard    string
+}
+
+func (lt lockTarget) String() string {
+	if lt.shard == "" {
+		return lt.keyspace
+	}
+	return lt.keyspace + "/" + lt.shard
+}
+
+func (lt lockTarget) readLock(ts topo.Server) (*actionnode.ActionLock, error) {
+	if lt.shard == "" {
+		return actionnode.ReadKeyspaceLock(ts, lt.keyspace)
+	}
+	return actionnode.ReadShardLock(ts, lt.keyspace, lt.shard)
+}
+
+func (lt lockTarget) forceUnlock(ts topo.Server, l *actionnode.ActionLock, reason string) error {
+	if lt.shard == "" {
+		return actionnode.ForceUnlockKeyspace(ts, lt.keyspace, l, reason)
+	}
+	return actionnode.ForceUnlockShard(ts, lt.keyspace, lt.shard, l, reason)
+}
+
+// lockParamsToTargets returns the shards of the params, and the
+// keyspaces of the params followed by their shards.
+func lockParamsToTargets(ts topo.Server, params []string) ([]lockTarget, error) {
+	var result []lockTarget
+	for _, param := range params {
+		if keyspace, shard, err := shardParamToKeyspaceShard(param); err == nil {
+			result = append(result, lockTarget{keyspace, shard})
+			continue
+		}
+		keyspace, err := keyspaceParamToKeyspace(param)
+		if err != nil {
+			return nil, err
+		}
+		shards, err := ts.GetShardNames(keyspace)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the shards of keyspace %v: %v", keyspace, err)
+		}
+		result = append(result, lockTarget{keyspace: keyspace})
+		for _, shard := range shards {
+			result = append(result, lockTarget{keyspace, shard})
+		}
+	}
+	return result, nil
+}
+
+func commandListLocks(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() == 0 {
+		return "", fmt.Errorf("action ListLocks requires <keyspace|zk keyspace path|keyspace/shard|zk shard path> ...")
+	}
+
+	targets, err := lockParamsToTargets(wr.TopoServer(), subFlags.Args())
+	if err != nil {
+		return "", err
+	}
+	for _, target := range targets {
+		l, err := target.readLock(wr.TopoServer())
+		switch err {
+		case nil:
+			fmt.Printf("%v %v\n", target, l)
+		case topo.ErrNoNode:
+			// not locked
+		default:
+			return "", fmt.Errorf("cannot read the lock of %v: %v", target, err)
+		}
+	}
+	return "", nil
+}
+
+func commandForceUnlock(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	olderThan := subFlags.Duration("older_than", 0, "only release the locks held for longer than this")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() == 0 {
+		return "", fmt.Errorf("action ForceUnlock requires <keyspace|zk keyspace path|keyspace/shard|zk shard path> ...")
+	}
+
+	targets, err := lockParamsToTargets(wr.TopoServer(), subFlags.Args())
+	if err != nil {
+		return "", err
+	}
+	for _, target := range targets {
+		l, err := target.readLock(wr.TopoServer())
+		switch err {
+		case nil:
+		case topo.ErrNoNode:
+			continue
+		default:
+			return "", fmt.Errorf("cannot read the lock of %v: %v", target, err)
+		}
+		if *olderThan > 0 && l.Age() < *olderThan {
+			// the age of the locks of the older actions is unknown
+			log.Infof("Keeping the lock of %v, held by %v", target, l)
+			continue
+		}
+		if err := target.forceUnlock(wr.TopoServer(), l, "ForceUnlock from vtctl"); err != nil {
+			return "", fmt.Errorf("cannot release the lock of %v: %v", target, err)
+		}
+		fmt.Printf("%v released, was held by %v\n", target, l)
+	}
+	return "", nil
+}
+
 func commandGetSchema(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	tables := subFlags.String("tables", "", "comma separated list of regexps for tables to gather schema information for")
 	excludeTables := subFlags.String("exclude_tables", "", "comma separated list of regexps for tables to exclude")
@@ -1976,6 +2292,100 @@ func commandApplySchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, a
 	return "", err
 }
 
+func commandSnapshotSchemaKeyspace(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 {
+		return "", fmt.Errorf("action SnapshotSchemaKeyspace requires <keyspace|zk keyspace path>")
+	}
+
+	keyspace, err := keyspaceParamToKeyspace(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	snapshot, err := schemamanager.TakeSnapshot(wr.TopoServer(), wr, keyspace)
+	if err == nil {
+		fmt.Println(snapshot.String())
+	}
+	return "", err
+}
+
+func commandApplySchemaDiff(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
+	force := subFlags.Bool("force", false, "will apply the schema even if preflight schema doesn't match")
+	sql := subFlags.String("sql", "", "CREATE statements of the desired schema")
+	sqlFile := subFlags.String("sql-file", "", "file containing the CREATE statements of the desired schema")
+	snapshotFile := subFlags.String("snapshot-file", "", "file containing the desired schema snapshot")
+	simple := subFlags.Bool("simple", false, "just apply change on master and let replication do the rest")
+	dryRun := subFlags.Bool("dry-run", false, "only display the statements for each shard")
+	if err := subFlags.Parse(args); err != nil {
+		return "", err
+	}
+	if subFlags.NArg() != 1 {
+		return "", fmt.Errorf("action ApplySchemaDiff requires <keyspace|zk keyspace path>")
+	}
+
+	keyspace, err := keyspaceParamToKeyspace(subFlags.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	snapshot, err := schemamanager.TakeSnapshot(wr.TopoServer(), wr, keyspace)
+	if err != nil {
+		return "", err
+	}
+
+	var targets map[string]*myproto.SchemaDefinition
+	if *snapshotFile != "" {
+		if *sql != "" || *sqlFile != "" {
+			return "", fmt.Errorf("action ApplySchemaDiff requires only one of sql, sql-file or snapshot-file")
+		}
+		desired := &schemamanager.Snapshot{}
+		if err := jscfg.ReadJson(*snapshotFile, desired); err != nil {
+			return "", err
+		}
+		targets = make(map[string]*myproto.SchemaDefinition)
+		for shard, ss := range desired.Shards {
+			targets[shard] = ss.Schema
+		}
+	} else {
+		change, err := getFileParam(*sql, *sqlFile, "sql")
+		if err != nil {
+			return "", err
+		}
+		// any master can run the desired SQL in its preflight database
+		var masterAlias topo.TabletAlias
+		for _, ss := range snapshot.Shards {
+			masterAlias = ss.MasterAlias
+			break
+		}
+		sd, err := schemamanager.DesiredSchema(wr, masterAlias, change)
+		if err != nil {
+			return "", err
+		}
+		targets = schemamanager.SameTarget(snapshot, sd)
+	}
+
+	plan, err := schemamanager.MakePlan(snapshot, targets)
+	if err != nil {
+		return "", err
+	}
+	if len(plan.Changes) == 0 {
+		log.Infof("All the shards already have the desired schema")
+		return "", nil
+	}
+	if *dryRun {
+		fmt.Print(plan.String())
+		return "", nil
+	}
+	if err := plan.Preflight(wr); err != nil {
+		if !*force {
+			return "", err
+		}
+		log.Warningf("Preflight failed, applying anyway: %v", err)
+	}
+	return "", plan.Apply(wr, *simple, *force)
+}
+
 func commandValidateVersionShard(wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) (string, error) {
 	if err := subFlags.Parse(args); err != nil {
 		return "", err
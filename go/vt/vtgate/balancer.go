@@ -25,6 +25,10 @@ type Balancer struct {
 	index        int
 	getEndPoints GetEndPointsFunc
 	retryDelay   time.Duration
+
+	// stale is set when a node is marked down, so the next Get
+	// re-resolves the end points before picking one.
+	stale bool
 }
 
 type addressStatus struct {
@@ -49,15 +53,21 @@ func NewBalancer(getEndPoints GetEndPointsFunc, retryDelay time.Duration) *Balan
 // If it finds an address that was down for longer than retryDelay,
 // it refreshes the list of addresses and returns the next available
 // node. If all addresses are marked down, it waits and retries.
-// If a refresh fails, it returns an error.
+// After a mark down, it refreshes the list first, so a replaced
+// tablet is picked up right away. If a refresh fails, it returns an
+// error, unless it still has addresses to fall back to.
 func (blc *Balancer) Get() (endPoint topo.EndPoint, err error) {
 	blc.mu.Lock()
 	defer blc.mu.Unlock()
 
-	if len(blc.addressNodes) == 0 {
+	if len(blc.addressNodes) == 0 || blc.stale {
+		blc.stale = false
 		err = blc.refresh()
 		if err != nil {
-			return topo.EndPoint{}, err
+			if len(blc.addressNodes) == 0 {
+				return topo.EndPoint{}, err
+			}
+			log.Warningf("Cannot refresh end points, keeping the current ones: %v", err)
 		}
 	}
 
@@ -94,6 +104,7 @@ func (blc *Balancer) MarkDown(uid uint32, reason string) {
 	if index := findAddrNode(blc.addressNodes, uid); index != -1 {
 		log.Infof("Marking down %v at %+v (%v)", uid, blc.addressNodes[index].endPoint, reason)
 		blc.addressNodes[index].timeRetry = time.Now().Add(blc.retryDelay)
+		blc.stale = true
 	}
 }
 
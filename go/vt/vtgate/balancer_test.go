@@ -235,3 +235,26 @@ func TestRefresh(t *testing.T) {
 		t.Errorf("want 12, got %v", port_new)
 	}
 }
+
+func TestMarkDownRefresh(t *testing.T) {
+	b := NewBalancer(endPoints3, RETRY_DELAY)
+	addr, _ := b.Get()
+	start := counter
+	b.MarkDown(addr.Uid, "")
+	b.Get()
+	// A mark down re-resolves the end points on the next Get.
+	if counter != start+1 {
+		t.Errorf("want %v, got %v", start+1, counter)
+	}
+	b.Get()
+	if counter != start+1 {
+		t.Errorf("want %v, got %v", start+1, counter)
+	}
+
+	// If the refresh fails, the current end points are still used.
+	b.getEndPoints = endPointsError
+	b.MarkDown(addr.Uid, "")
+	if _, err := b.Get(); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
+	"github.com/youtube/vitess/go/vt/context"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// The transaction modes, they decide how the transactions spanning
+// several shards are committed.
+const (
+	// TX_BEST_EFFORT commits the shards one after the other, in the
+	// order they joined the transaction, and rolls back the others
+	// after the first failure.
+	TX_BEST_EFFORT = "best_effort"
+
+	// TX_TWOPC prepares the transactions of all the shards, and
+	// only commits them if they are all prepared. It falls back to
+	// TX_BEST_EFFORT if a tablet doesn't support two-phase commits.
+	TX_TWOPC = "twopc"
+)
+
+var (
+	transactionMode = flag.String("transaction_mode", TX_BEST_EFFORT, "how the transactions spanning several shards are committed: "+TX_BEST_EFFORT+" or "+TX_TWOPC)
+
+	twoPCAbandonAge      = flag.Duration("twopc_abandon_age", 5*time.Minute, "in "+TX_TWOPC+" mode, age after which a distributed transaction is presumed abandoned by its vtgate, and resolved")
+	twoPCResolveInterval = flag.Duration("twopc_resolve_interval", 1*time.Minute, "in "+TX_TWOPC+" mode, interval at which the abandoned distributed transactions are looked for")
+
+	commitCounts  = stats.NewMultiCounters("VtgateCommitCount", []string{"Mode", "Result"})
+	resolveCounts = stats.NewCounters("VtgateTwoPCResolveCount")
+
+	dtidCounter sync2.AtomicInt64
+	dtidPrefix  string
+)
+
+func init() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "vtgate"
+	}
+	dtidPrefix = fmt.Sprintf("%v:%v", hostname, time.Now().UnixNano())
+}
+
+// newDtid returns a new distributed transaction id, unique across
+// vtgates.
+func newDtid() string {
+	return fmt.Sprintf("%v:%v", dtidPrefix, dtidCounter.Add(1))
+}
+
+// CommitError is returned when a transaction spanning several shards
+// was committed on some of them only, or not resolved on some of
+// them. When nothing was committed, the error of the failed shard is
+// returned instead.
+type CommitError struct {
+	// Dtid is the distributed transaction id, in TX_TWOPC mode.
+	Dtid string
+
+	Committed []*proto.ShardSession
+
+	// Failed is the shard whose commit failed, Err its error.
+	Failed *proto.ShardSession
+	Err    error
+
+	// RolledBack are the shards rolled back after the failure.
+	// The rollback failed for RollbackFailed.
+	RolledBack     []*proto.ShardSession
+	RollbackFailed []*proto.ShardSession
+
+	// Unresolved are the shards whose prepared transaction could
+	// be neither committed nor rolled back, in TX_TWOPC mode. The
+	// tablets keep them prepared, and the watchdog of a vtgate
+	// commits or rolls them back after -twopc_abandon_age,
+	// according to the transaction record of the first shard.
+	Unresolved []*proto.ShardSession
+}
+
+func shardNames(shardSessions []*proto.ShardSession) string {
+	names := make([]string, len(shardSessions))
+	for i, shardSession := range shardSessions {
+		names[i] = shardSession.Keyspace + "/" + shardSession.Shard
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+func (e *CommitError) Error() string {
+	var parts []string
+	if e.Dtid != "" {
+		parts = append(parts, fmt.Sprintf("distributed transaction %v", e.Dtid))
+	}
+	parts = append(parts, fmt.Sprintf("partial commit: committed on %v", shardNames(e.Committed)))
+	if e.Failed != nil {
+		parts = append(parts, fmt.Sprintf("failed on %v/%v: %v", e.Failed.Keyspace, e.Failed.Shard, e.Err))
+	}
+	if len(e.RolledBack) > 0 {
+		parts = append(parts, fmt.Sprintf("rolled back on %v", shardNames(e.RolledBack)))
+	}
+	if len(e.RollbackFailed) > 0 {
+		parts = append(parts, fmt.Sprintf("rollback failed on %v", shardNames(e.RollbackFailed)))
+	}
+	if len(e.Unresolved) > 0 {
+		parts = append(parts, fmt.Sprintf("prepared but not committed yet on %v", shardNames(e.Unresolved)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// commit commits the transaction of the shard sessions, according
+// to the transaction mode.
+func (stc *ScatterConn) commit(context context.Context, shardSessions []*proto.ShardSession) error {
+	if stc.transactionMode == TX_TWOPC && len(shardSessions) > 1 {
+		sdcs := stc.shardSessionConns(context, shardSessions)
+		supported := true
+		for _, sdc := range sdcs {
+			if !sdc.SupportsTwoPC(context) {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			return stc.commitTwoPC(context, shardSessions, sdcs)
+		}
+		log.Warningf("two-phase commit not supported by all the tablets of %v, committing in best effort mode", shardNames(shardSessions))
+		commitCounts.Add([]string{TX_TWOPC, "Unsupported"}, 1)
+	}
+	return stc.commitBestEffort(context, shardSessions)
+}
+
+func (stc *ScatterConn) shardSessionConns(context context.Context, shardSessions []*proto.ShardSession) []*ShardConn {
+	sdcs := make([]*ShardConn, len(shardSessions))
+	for i, shardSession := range shardSessions {
+		sdcs[i] = stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
+	}
+	return sdcs
+}
+
+// commitBestEffort commits the shards in order, and rolls back the
+// others after the first failure.
+func (stc *ScatterConn) commitBestEffort(context context.Context, shardSessions []*proto.ShardSession) error {
+	sdcs := stc.shardSessionConns(context, shardSessions)
+	for i, shardSession := range shardSessions {
+		err := sdcs[i].Commit(context, shardSession.TransactionId)
+		if err == nil {
+			continue
+		}
+		commitErr := &CommitError{
+			Committed: shardSessions[:i],
+			Failed:    shardSession,
+			Err:       err,
+		}
+		for j := i + 1; j < len(shardSessions); j++ {
+			if rbErr := sdcs[j].Rollback(context, shardSessions[j].TransactionId); rbErr != nil {
+				log.Warningf("cannot roll back %v/%v after a failed commit: %v", shardSessions[j].Keyspace, shardSessions[j].Shard, rbErr)
+				commitErr.RollbackFailed = append(commitErr.RollbackFailed, shardSessions[j])
+				continue
+			}
+			commitErr.RolledBack = append(commitErr.RolledBack, shardSessions[j])
+		}
+		if i == 0 {
+			commitCounts.Add([]string{TX_BEST_EFFORT, "Failed"}, 1)
+			return err
+		}
+		commitCounts.Add([]string{TX_BEST_EFFORT, "Partial"}, 1)
+		log.Errorf("%v", commitErr)
+		return commitErr
+	}
+	commitCounts.Add([]string{TX_BEST_EFFORT, "Committed"}, 1)
+	return nil
+}
+
+// commitTwoPC commits the shards with a two-phase commit. The first
+// shard is the metadata manager: it keeps the transaction record of
+// dtid, which lists the other shards, the participants. The record is
+// created before the participants are prepared, and the decision to
+// commit is recorded when the transaction of the first shard is
+// committed. Then the participants are committed, and the record is
+// deleted. If vtgate goes away in the middle, the record is left
+// behind, and the watchdog resolves the participants according to it,
+// see resolveAbandoned.
+func (stc *ScatterConn) commitTwoPC(context context.Context, shardSessions []*proto.ShardSession, sdcs []*ShardConn) error {
+	dtid := newDtid()
+	mm, participants := shardSessions[0], shardSessions[1:]
+	records := make([]tproto.TwoPCParticipant, len(participants))
+	for i, participant := range participants {
+		records[i] = tproto.TwoPCParticipant{Keyspace: participant.Keyspace, Shard: participant.Shard}
+	}
+	if err := sdcs[0].CreateTransaction(context, dtid, records); err != nil {
+		// The record may exist anyway, the watchdog deletes it.
+		for i, shardSession := range shardSessions {
+			if rbErr := sdcs[i].Rollback(context, shardSession.TransactionId); rbErr != nil {
+				log.Warningf("cannot roll back %v/%v of distributed transaction %v: %v", shardSession.Keyspace, shardSession.Shard, dtid, rbErr)
+			}
+		}
+		commitCounts.Add([]string{TX_TWOPC, "Failed"}, 1)
+		return fmt.Errorf("distributed transaction %v rolled back, cannot create its transaction record on %v/%v: %v", dtid, mm.Keyspace, mm.Shard, err)
+	}
+
+	for i := 1; i < len(shardSessions); i++ {
+		shardSession := shardSessions[i]
+		err := sdcs[i].PrepareTransaction(context, shardSession.TransactionId, dtid)
+		if err == nil {
+			continue
+		}
+		stc.rollbackTwoPC(context, dtid, shardSessions, sdcs, i)
+		commitCounts.Add([]string{TX_TWOPC, "Failed"}, 1)
+		return fmt.Errorf("distributed transaction %v rolled back, cannot prepare %v/%v: %v", dtid, shardSession.Keyspace, shardSession.Shard, err)
+	}
+
+	// The decision to commit is durable once the transaction of
+	// the metadata manager is committed. If that fails, it's not
+	// known whether it was committed, the watchdog decides.
+	if err := sdcs[0].StartCommit(context, mm.TransactionId, dtid); err != nil {
+		commitErr := &CommitError{
+			Dtid:       dtid,
+			Failed:     mm,
+			Err:        err,
+			Unresolved: participants,
+		}
+		commitCounts.Add([]string{TX_TWOPC, "Unresolved"}, 1)
+		log.Errorf("%v", commitErr)
+		return commitErr
+	}
+
+	commitErr := &CommitError{Dtid: dtid, Committed: []*proto.ShardSession{mm}}
+	for i, shardSession := range participants {
+		if err := sdcs[i+1].CommitPrepared(context, dtid); err != nil {
+			log.Warningf("cannot commit %v/%v of distributed transaction %v: %v", shardSession.Keyspace, shardSession.Shard, dtid, err)
+			commitErr.Unresolved = append(commitErr.Unresolved, shardSession)
+			continue
+		}
+		commitErr.Committed = append(commitErr.Committed, shardSession)
+	}
+	if len(commitErr.Unresolved) > 0 {
+		commitCounts.Add([]string{TX_TWOPC, "Unresolved"}, 1)
+		log.Errorf("%v", commitErr)
+		return commitErr
+	}
+	if err := sdcs[0].ConcludeTransaction(context, dtid); err != nil {
+		log.Warningf("cannot conclude distributed transaction %v, the watchdog will: %v", dtid, err)
+	}
+	commitCounts.Add([]string{TX_TWOPC, "Committed"}, 1)
+	return nil
+}
+
+// rollbackTwoPC rolls back dtid after the participant failed could
+// not be prepared. The transaction record is concluded if everything is
+// rolled back, and left to the watchdog otherwise.
+func (stc *ScatterConn) rollbackTwoPC(context context.Context, dtid string, shardSessions []*proto.ShardSession, sdcs []*ShardConn, failed int) {
+	resolved := true
+	if err := sdcs[0].SetRollback(context, dtid); err != nil {
+		log.Warningf("cannot record the rollback of distributed transaction %v: %v", dtid, err)
+		resolved = false
+	}
+	for j, shardSession := range shardSessions {
+		var rbErr error
+		switch {
+		case j == 0 || j > failed:
+			rbErr = sdcs[j].Rollback(context, shardSession.TransactionId)
+		case j < failed:
+			rbErr = sdcs[j].RollbackPrepared(context, dtid)
+		default:
+			// The failed shard may have prepared its
+			// transaction anyway, e.g. if the call timed
+			// out, so it's rolled back both ways. Rollback
+			// fails if it was prepared.
+			rbErr = sdcs[j].RollbackPrepared(context, dtid)
+			sdcs[j].Rollback(context, shardSession.TransactionId)
+		}
+		if rbErr != nil {
+			log.Warningf("cannot roll back %v/%v of distributed transaction %v: %v", shardSession.Keyspace, shardSession.Shard, dtid, rbErr)
+			if j != 0 && j <= failed {
+				resolved = false
+			}
+		}
+	}
+	if !resolved {
+		return
+	}
+	if err := sdcs[0].ConcludeTransaction(context, dtid); err != nil {
+		log.Warningf("cannot conclude distributed transaction %v, the watchdog will: %v", dtid, err)
+	}
+}
+
+// startTwoPCWatchdog resolves the abandoned distributed transactions
+// every -twopc_resolve_interval.
+func (stc *ScatterConn) startTwoPCWatchdog() {
+	stc.twoPCWatchdog = timer.NewTimer(*twoPCResolveInterval)
+	stc.twoPCWatchdog.Start(func() {
+		stc.resolveAbandoned(&context.DummyContext{}, *twoPCAbandonAge)
+	})
+}
+
+// resolveAbandoned resolves the distributed transactions older than
+// age, whose vtgate is presumed gone, on the masters of the cell.
+func (stc *ScatterConn) resolveAbandoned(context context.Context, age time.Duration) {
+	keyspaces, err := stc.toposerv.GetSrvKeyspaceNames(context, stc.cell)
+	if err != nil {
+		log.Warningf("cannot list the keyspaces to resolve distributed transactions: %v", err)
+		return
+	}
+	for _, keyspace := range keyspaces {
+		srvKeyspace, err := stc.toposerv.GetSrvKeyspace(context, stc.cell, keyspace)
+		if err != nil {
+			log.Warningf("cannot list the shards of %v to resolve distributed transactions: %v", keyspace, err)
+			continue
+		}
+		partition, ok := srvKeyspace.Partitions[topo.TYPE_MASTER]
+		if !ok {
+			continue
+		}
+		for _, srvShard := range partition.Shards {
+			stc.resolveShard(context, keyspace, srvShard.ShardName(), age)
+		}
+	}
+}
+
+// resolveShard resolves the distributed transactions older than age
+// whose metadata manager is keyspace/shard.
+func (stc *ScatterConn) resolveShard(context context.Context, keyspace, shard string, age time.Duration) {
+	mm := stc.getConnection(context, keyspace, shard, topo.TYPE_MASTER)
+	if !mm.SupportsTwoPC(context) {
+		return
+	}
+	transactions, err := mm.ReadAbandoned(context, age)
+	if err != nil {
+		log.Warningf("cannot read the abandoned distributed transactions of %v/%v: %v", keyspace, shard, err)
+		return
+	}
+	for _, dt := range transactions {
+		stc.resolveTransaction(context, mm, dt)
+	}
+}
+
+// resolveTransaction commits or rolls back the participants of dt,
+// according to its decision. A transaction without a decision is
+// rolled back. The transaction record is concluded if they are all
+// resolved, and the next run tries again otherwise.
+func (stc *ScatterConn) resolveTransaction(context context.Context, mm *ShardConn, dt tproto.DistributedTransaction) {
+	decision := "Commit"
+	switch dt.State {
+	case tproto.DT_STATE_PREPARE:
+		// The rollback is not recorded if the coordinator
+		// recorded the commit in the meantime.
+		if err := mm.SetRollback(context, dt.Dtid); err != nil {
+			log.Warningf("cannot roll back abandoned distributed transaction %v: %v", dt.Dtid, err)
+			return
+		}
+		decision = "Rollback"
+	case tproto.DT_STATE_ROLLBACK:
+		decision = "Rollback"
+	}
+	log.Infof("resolving abandoned distributed transaction %v: %v", dt.Dtid, decision)
+	resolved := true
+	for _, participant := range dt.Participants {
+		sdc := stc.getConnection(context, participant.Keyspace, participant.Shard, topo.TYPE_MASTER)
+		var err error
+		if decision == "Commit" {
+			err = sdc.CommitPrepared(context, dt.Dtid)
+		} else {
+			err = sdc.RollbackPrepared(context, dt.Dtid)
+		}
+		if err != nil {
+			log.Warningf("cannot resolve %v/%v of abandoned distributed transaction %v: %v", participant.Keyspace, participant.Shard, dt.Dtid, err)
+			resolved = false
+		}
+	}
+	if !resolved {
+		resolveCounts.Add("Failed", 1)
+		return
+	}
+	if err := mm.ConcludeTransaction(context, dt.Dtid); err != nil {
+		log.Warningf("cannot conclude abandoned distributed transaction %v: %v", dt.Dtid, err)
+		resolveCounts.Add("Failed", 1)
+		return
+	}
+	resolveCounts.Add(decision, 1)
+}
@@ -0,0 +1,393 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// This file uses the sandbox_test framework.
+
+// twoPCConn is a sandboxConn supporting two-phase commits, which
+// records the two-phase commit calls, and keeps the transaction
+// records in memory. If disabled is set, its tablet has them
+// disabled. The coordinator hangs forever when it makes the call
+// crashOn, as if vtgate was killed, and crashed is closed.
+type twoPCConn struct {
+	*sandboxConn
+
+	mu                 sync.Mutex
+	disabled           bool
+	failPrepare        bool
+	failCommitPrepared bool
+	crashOn            string
+	crashed            chan struct{}
+	calls              []string
+	dts                map[string]*tproto.DistributedTransaction
+}
+
+func (tc *twoPCConn) call(call string, fail bool) error {
+	tc.mu.Lock()
+	tc.calls = append(tc.calls, call)
+	crash := call == tc.crashOn
+	if crash {
+		tc.crashOn = ""
+	}
+	tc.mu.Unlock()
+	if crash {
+		close(tc.crashed)
+		select {}
+	}
+	if fail {
+		return &tabletconn.ServerError{Code: tabletconn.ERR_NORMAL, Err: "error: " + call}
+	}
+	return nil
+}
+
+// setState moves the record of dtid from the prepare state to state.
+func (tc *twoPCConn) setState(dtid string, state int64) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	dt, ok := tc.dts[dtid]
+	if !ok {
+		return nil
+	}
+	if dt.State != tproto.DT_STATE_PREPARE && dt.State != state {
+		return &tabletconn.ServerError{Code: tabletconn.ERR_NORMAL, Err: fmt.Sprintf("error: %v in state %v", dtid, dt.State)}
+	}
+	dt.State = state
+	return nil
+}
+
+func (tc *twoPCConn) CreateTransaction(context context.Context, dtid string, participants []tproto.TwoPCParticipant) error {
+	if err := tc.call("create", false); err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.dts == nil {
+		tc.dts = make(map[string]*tproto.DistributedTransaction)
+	}
+	tc.dts[dtid] = &tproto.DistributedTransaction{Dtid: dtid, State: tproto.DT_STATE_PREPARE, Participants: participants}
+	return nil
+}
+
+func (tc *twoPCConn) StartCommit(context context.Context, transactionId int64, dtid string) error {
+	if err := tc.call("start", false); err != nil {
+		return err
+	}
+	return tc.setState(dtid, tproto.DT_STATE_COMMIT)
+}
+
+func (tc *twoPCConn) SetRollback(context context.Context, dtid string) error {
+	if err := tc.call("setrollback", false); err != nil {
+		return err
+	}
+	return tc.setState(dtid, tproto.DT_STATE_ROLLBACK)
+}
+
+func (tc *twoPCConn) ConcludeTransaction(context context.Context, dtid string) error {
+	if err := tc.call("conclude", false); err != nil {
+		return err
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	delete(tc.dts, dtid)
+	return nil
+}
+
+func (tc *twoPCConn) ReadAbandoned(context context.Context, age time.Duration) ([]tproto.DistributedTransaction, error) {
+	if err := tc.call("read", false); err != nil {
+		return nil, err
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	var transactions []tproto.DistributedTransaction
+	for _, dt := range tc.dts {
+		transactions = append(transactions, *dt)
+	}
+	return transactions, nil
+}
+
+// state returns the state of the record of dtid, 0 if there's none.
+func (tc *twoPCConn) state(dtid string) int64 {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if dt, ok := tc.dts[dtid]; ok {
+		return dt.State
+	}
+	return 0
+}
+
+// checkTwoPCCalls checks the two-phase commit calls made to conns
+// since the last check.
+func checkTwoPCCalls(t *testing.T, conns []*twoPCConn, want ...string) {
+	for i, tc := range conns {
+		tc.mu.Lock()
+		got := strings.Join(tc.calls, ",")
+		tc.calls = nil
+		tc.mu.Unlock()
+		if got != want[i] {
+			t.Errorf("shard %v: got calls %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func (tc *twoPCConn) PrepareTransaction(context context.Context, transactionId int64, dtid string) error {
+	return tc.call("prepare", tc.failPrepare)
+}
+
+func (tc *twoPCConn) CommitPrepared(context context.Context, dtid string) error {
+	return tc.call("commit", tc.failCommitPrepared)
+}
+
+func (tc *twoPCConn) RollbackPrepared(context context.Context, dtid string) error {
+	if dtid == "" {
+		return tc.call("probe", tc.disabled)
+	}
+	return tc.call("rollback", false)
+}
+
+// beginShards starts a transaction on shards 0 to n-1, in order.
+func beginShards(t *testing.T, stc *ScatterConn, keyspace string, n int) *SafeSession {
+	session := NewSafeSession(&proto.Session{InTransaction: true})
+	for i := 0; i < n; i++ {
+		if _, err := stc.Execute(&context.DummyContext{}, "query", nil, keyspace, []string{fmt.Sprintf("%v", i)}, "", session); err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+	}
+	return session
+}
+
+func TestCommitBestEffort(t *testing.T) {
+	s := createSandbox("TestCommitBestEffort")
+	var sbcs []*sandboxConn
+	for i := 0; i < 3; i++ {
+		sbc := &sandboxConn{}
+		s.MapTestConn(fmt.Sprintf("%v", i), sbc)
+		sbcs = append(sbcs, sbc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, time.Second)
+
+	// the second shard fails, the first one is committed and the
+	// last one rolled back
+	session := beginShards(t, stc, "TestCommitBestEffort", 3)
+	sbcs[1].mustFailServer = 1
+	err := stc.Commit(&context.DummyContext{}, session)
+	commitErr, ok := err.(*CommitError)
+	if !ok {
+		t.Fatalf("Commit: got %v, want a CommitError", err)
+	}
+	if len(commitErr.Committed) != 1 || commitErr.Committed[0].Shard != "0" || commitErr.Failed.Shard != "1" || len(commitErr.RolledBack) != 1 || commitErr.RolledBack[0].Shard != "2" {
+		t.Errorf("Commit: got %+v", commitErr)
+	}
+	want := "partial commit: committed on [TestCommitBestEffort/0], failed on TestCommitBestEffort/1: error: err, shard, host: TestCommitBestEffort.1., {Uid:1 Host:1 NamedPortMap:map[vt:1] Health:map[]}, rolled back on [TestCommitBestEffort/2]"
+	if err.Error() != want {
+		t.Errorf("Commit: got\n%v, want\n%v", err, want)
+	}
+	if sbcs[2].RollbackCount.Get() != 1 || sbcs[2].CommitCount.Get() != 0 {
+		t.Errorf("shard 2: %v commits, %v rollbacks", sbcs[2].CommitCount.Get(), sbcs[2].RollbackCount.Get())
+	}
+	if session.InTransaction() || session.ShardSessions != nil {
+		t.Errorf("session not reset: %v", session.Session)
+	}
+
+	// the first shard fails, nothing is committed and the shard
+	// error is returned as is
+	session = beginShards(t, stc, "TestCommitBestEffort", 3)
+	sbcs[0].mustFailServer = 1
+	err = stc.Commit(&context.DummyContext{}, session)
+	if _, ok := err.(*ShardConnError); !ok {
+		t.Errorf("Commit: got %v, want a ShardConnError", err)
+	}
+}
+
+func TestCommitTwoPC(t *testing.T) {
+	s := createSandbox("TestCommitTwoPC")
+	var conns []*twoPCConn
+	for i := 0; i < 3; i++ {
+		tc := &twoPCConn{sandboxConn: &sandboxConn{}}
+		s.MapTestConn(fmt.Sprintf("%v", i), tc)
+		conns = append(conns, tc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, time.Second)
+	stc.transactionMode = TX_TWOPC
+
+	// the tablets are asked once if they support two-phase
+	// commits. The first shard keeps the transaction record, the
+	// others are prepared, the first one commits with the decision
+	// and the others are committed.
+	session := beginShards(t, stc, "TestCommitTwoPC", 3)
+	if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+		t.Errorf("Commit: %v", err)
+	}
+	checkTwoPCCalls(t, conns, "probe,create,start,conclude", "probe,prepare,commit", "probe,prepare,commit")
+
+	// the second shard can't be prepared: the rollback is
+	// recorded, the first and the last transactions are rolled
+	// back. The second one is rolled back both ways, in case it
+	// was prepared anyway.
+	session = beginShards(t, stc, "TestCommitTwoPC", 3)
+	conns[1].failPrepare = true
+	err := stc.Commit(&context.DummyContext{}, session)
+	if err == nil || !strings.Contains(err.Error(), "rolled back, cannot prepare TestCommitTwoPC/1") {
+		t.Errorf("Commit: got %v", err)
+	}
+	checkTwoPCCalls(t, conns, "create,setrollback,conclude", "prepare,rollback", "")
+	for i, tc := range conns {
+		if tc.RollbackCount.Get() != 1 {
+			t.Errorf("shard %v not rolled back", i)
+		}
+	}
+	conns[1].failPrepare = false
+
+	// the commit of the last shard fails: it's unresolved, and
+	// the watchdog commits it
+	session = beginShards(t, stc, "TestCommitTwoPC", 3)
+	conns[2].failCommitPrepared = true
+	err = stc.Commit(&context.DummyContext{}, session)
+	commitErr, ok := err.(*CommitError)
+	if !ok {
+		t.Fatalf("Commit: got %v, want a CommitError", err)
+	}
+	if commitErr.Dtid == "" || len(commitErr.Committed) != 2 || len(commitErr.Unresolved) != 1 || commitErr.Unresolved[0].Shard != "2" {
+		t.Errorf("Commit: got %+v", commitErr)
+	}
+	checkTwoPCCalls(t, conns, "create,start", "prepare,commit", "prepare,commit")
+	conns[2].failCommitPrepared = false
+	stc.resolveShard(&context.DummyContext{}, "TestCommitTwoPC", "0", 0)
+	checkTwoPCCalls(t, conns, "probe,read,conclude", "commit", "commit")
+	if got := conns[0].state(commitErr.Dtid); got != 0 {
+		t.Errorf("transaction record not concluded: state %v", got)
+	}
+
+	// a single shard is committed directly
+	session = beginShards(t, stc, "TestCommitTwoPC", 1)
+	if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+		t.Errorf("Commit: %v", err)
+	}
+	checkTwoPCCalls(t, conns, "", "", "")
+	if conns[0].CommitCount.Get() != 1 {
+		t.Errorf("shard 0: got %v commits, want 1", conns[0].CommitCount.Get())
+	}
+}
+
+func TestCommitTwoPCUnsupported(t *testing.T) {
+	s := createSandbox("TestCommitTwoPCUnsupported")
+	tc := &twoPCConn{sandboxConn: &sandboxConn{}}
+	s.MapTestConn("0", tc)
+	sbc := &sandboxConn{}
+	s.MapTestConn("1", sbc)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, time.Second)
+	stc.transactionMode = TX_TWOPC
+
+	// shard 1 can't take part in two-phase commits
+	session := beginShards(t, stc, "TestCommitTwoPCUnsupported", 2)
+	if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+		t.Errorf("Commit: %v", err)
+	}
+	if strings.Join(tc.calls, ",") != "probe" || tc.CommitCount.Get() != 1 || sbc.CommitCount.Get() != 1 {
+		t.Errorf("not committed in best effort mode: %v %v %v", tc.calls, tc.CommitCount.Get(), sbc.CommitCount.Get())
+	}
+}
+
+func TestCommitTwoPCDisabled(t *testing.T) {
+	s := createSandbox("TestCommitTwoPCDisabled")
+	var conns []*twoPCConn
+	for i := 0; i < 2; i++ {
+		tc := &twoPCConn{sandboxConn: &sandboxConn{}, disabled: i == 1}
+		s.MapTestConn(fmt.Sprintf("%v", i), tc)
+		conns = append(conns, tc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, time.Second)
+	stc.transactionMode = TX_TWOPC
+
+	// the tablet of shard 1 has two-phase commits disabled, which
+	// is only asked once
+	for i := 0; i < 2; i++ {
+		session := beginShards(t, stc, "TestCommitTwoPCDisabled", 2)
+		if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+			t.Errorf("Commit: %v", err)
+		}
+	}
+	for i, tc := range conns {
+		if got := strings.Join(tc.calls, ","); got != "probe" || tc.CommitCount.Get() != 2 {
+			t.Errorf("shard %v: got calls %q and %v commits, want a probe and 2 commits in best effort mode", i, got, tc.CommitCount.Get())
+		}
+	}
+}
+
+func TestCommitTwoPCCoordinatorCrash(t *testing.T) {
+	s := createSandbox("TestCommitTwoPCCoordinatorCrash")
+	var conns []*twoPCConn
+	for i := 0; i < 3; i++ {
+		tc := &twoPCConn{sandboxConn: &sandboxConn{}}
+		s.MapTestConn(fmt.Sprintf("%v", i), tc)
+		conns = append(conns, tc)
+	}
+	// the calls don't time out, the coordinator stays killed
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, time.Hour)
+	stc.transactionMode = TX_TWOPC
+	// crash commits a transaction on the 3 shards, until the
+	// coordinator is killed on its call crashOn to shard, and
+	// returns the dtid it left behind.
+	crash := func(shard int, crashOn string) string {
+		session := beginShards(t, stc, "TestCommitTwoPCCoordinatorCrash", 3)
+		conns[shard].mu.Lock()
+		conns[shard].crashOn = crashOn
+		conns[shard].crashed = make(chan struct{})
+		conns[shard].mu.Unlock()
+		go func() {
+			stc.Commit(&context.DummyContext{}, session)
+			t.Errorf("Commit returned, want the coordinator killed on %v", crashOn)
+		}()
+		<-conns[shard].crashed
+		transactions, err := conns[0].ReadAbandoned(&context.DummyContext{}, 0)
+		if err != nil || len(transactions) != 1 {
+			t.Fatalf("ReadAbandoned: got %v, %v, want one transaction", transactions, err)
+		}
+		return transactions[0].Dtid
+	}
+
+	// killed after the decision to commit: the shards that were
+	// not committed yet are committed by the watchdog
+	dtid := crash(2, "commit")
+	checkTwoPCCalls(t, conns, "probe,create,start,read", "probe,prepare,commit", "probe,prepare,commit")
+	if got := conns[0].state(dtid); got != tproto.DT_STATE_COMMIT {
+		t.Errorf("state of %v: got %v, want %v", dtid, got, tproto.DT_STATE_COMMIT)
+	}
+	stc.resolveShard(&context.DummyContext{}, "TestCommitTwoPCCoordinatorCrash", "0", 0)
+	checkTwoPCCalls(t, conns, "probe,read,conclude", "commit", "commit")
+	if got := conns[0].state(dtid); got != 0 {
+		t.Errorf("transaction record of %v not concluded: state %v", dtid, got)
+	}
+
+	// killed before the decision: the watchdog records the
+	// rollback, and rolls back the prepared shards
+	dtid = crash(2, "prepare")
+	checkTwoPCCalls(t, conns, "create,read", "prepare", "prepare")
+	stc.resolveShard(&context.DummyContext{}, "TestCommitTwoPCCoordinatorCrash", "0", 0)
+	checkTwoPCCalls(t, conns, "read,setrollback,conclude", "rollback", "rollback")
+	if got := conns[0].state(dtid); got != 0 {
+		t.Errorf("transaction record of %v not concluded: state %v", dtid, got)
+	}
+
+	// the commit decision wins over a late rollback
+	conns[0].dts = map[string]*tproto.DistributedTransaction{
+		"late": {Dtid: "late", State: tproto.DT_STATE_COMMIT},
+	}
+	if err := conns[0].SetRollback(&context.DummyContext{}, "late"); err == nil {
+		t.Errorf("SetRollback of a committed transaction: got no error")
+	}
+}
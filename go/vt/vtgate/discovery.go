@@ -0,0 +1,415 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/vt/context"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+var (
+	tabletDiscovery          = flag.Bool("tablet_discovery", false, "pick the tablets to send queries to by their health, streamed from each tablet, instead of at random")
+	discoveryCells           = flag.String("discovery_cells", "", "comma separated list of other cells whose tablets are used, in that order, when no tablet of the local cell can serve")
+	discoveryRefreshInterval = flag.Duration("discovery_refresh_interval", 5*time.Second, "how often the tablet discovery reads the serving graph again")
+	discoveryMaxLag          = flag.Duration("discovery_max_replication_lag", 30*time.Second, "replicas further behind their master are only used when no other tablet can serve")
+)
+
+const (
+	// healthStaleAfter is how long the last health stats of a tablet
+	// are trusted. After that, its health is unknown.
+	healthStaleAfter = time.Minute
+
+	// errorHalfLife is how fast the errors of a tablet are forgotten.
+	errorHalfLife = time.Minute
+)
+
+// Health classes of the tablets, the lower the better. A tablet is
+// only picked if no tablet of a better class can serve.
+const (
+	healthClassHealthy = iota
+	healthClassUnknown
+	healthClassLagging
+	healthClassDown
+)
+
+// TabletDiscovery keeps track of the tablets of the shards vtgate
+// sends queries to: it reads their end points from the serving graph
+// of the local cell (and of the discovery_cells) every refresh
+// interval, and streams the health of each tablet. It then picks the
+// tablet for a query by tablet type, health, cell, replication lag
+// and recent error rate.
+type TabletDiscovery struct {
+	serv            SrvTopoServer
+	cells           []string // the local cell first
+	refreshInterval time.Duration
+	maxLag          time.Duration
+	retryDelay      time.Duration
+	timeout         time.Duration
+	dialer          tabletconn.TabletDialer
+
+	mu      sync.Mutex
+	targets map[string]*discoveryTarget
+	done    chan struct{}
+}
+
+// NewTabletDiscovery returns a TabletDiscovery for the tablets of cell,
+// and of otherCells when no tablet of cell can serve. retryDelay is
+// how long a tablet that failed is not used, and how long we wait
+// before streaming its health again.
+func NewTabletDiscovery(serv SrvTopoServer, cell string, otherCells []string, refreshInterval, maxLag, retryDelay, timeout time.Duration) *TabletDiscovery {
+	return &TabletDiscovery{
+		serv:            serv,
+		cells:           append([]string{cell}, otherCells...),
+		refreshInterval: refreshInterval,
+		maxLag:          maxLag,
+		retryDelay:      retryDelay,
+		timeout:         timeout,
+		dialer:          tabletconn.GetDialer(),
+		targets:         make(map[string]*discoveryTarget),
+		done:            make(chan struct{}),
+	}
+}
+
+// newTabletDiscoveryFromFlags returns the TabletDiscovery configured
+// by the command line flags, or nil if it is not enabled.
+func newTabletDiscoveryFromFlags(serv SrvTopoServer, cell string, retryDelay, timeout time.Duration) *TabletDiscovery {
+	if !*tabletDiscovery {
+		return nil
+	}
+	var otherCells []string
+	if *discoveryCells != "" {
+		otherCells = strings.Split(*discoveryCells, ",")
+	}
+	return NewTabletDiscovery(serv, cell, otherCells, *discoveryRefreshInterval, *discoveryMaxLag, retryDelay, timeout)
+}
+
+// picker returns the endPointPicker for a shard and tablet type. The
+// first call for a target starts tracking its tablets.
+func (td *TabletDiscovery) picker(keyspace, shard string, tabletType topo.TabletType) endPointPicker {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	key := fmt.Sprintf("%s.%s.%s", keyspace, shard, tabletType)
+	target, ok := td.targets[key]
+	if !ok {
+		target = &discoveryTarget{
+			td:         td,
+			keyspace:   keyspace,
+			shard:      shard,
+			tabletType: tabletType,
+			tablets:    make(map[string]*tabletHealth),
+			refreshed:  make(chan struct{}),
+		}
+		td.targets[key] = target
+		go target.refreshLoop()
+	}
+	return target
+}
+
+// Close stops tracking the tablets.
+func (td *TabletDiscovery) Close() {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	select {
+	case <-td.done:
+	default:
+		close(td.done)
+	}
+}
+
+// HealthyTabletCount returns how many tablets are healthy per
+// keyspace/shard/dbtype.
+func (td *TabletDiscovery) HealthyTabletCount() map[string]int64 {
+	td.mu.Lock()
+	targets := make(map[string]*discoveryTarget, len(td.targets))
+	for key, target := range td.targets {
+		targets[key] = target
+	}
+	td.mu.Unlock()
+
+	result := make(map[string]int64)
+	now := time.Now()
+	for key, target := range targets {
+		target.mu.Lock()
+		for _, th := range target.tablets {
+			if th.class(now, target.td.maxLag) == healthClassHealthy {
+				result[key]++
+			}
+		}
+		target.mu.Unlock()
+	}
+	return result
+}
+
+// discoveryTarget is the set of tablets of a keyspace, shard and
+// tablet type. It implements endPointPicker.
+type discoveryTarget struct {
+	td         *TabletDiscovery
+	keyspace   string
+	shard      string
+	tabletType topo.TabletType
+
+	// refreshed is closed after the first refresh.
+	refreshed chan struct{}
+
+	mu         sync.Mutex
+	tablets    map[string]*tabletHealth // keyed by cell and uid
+	refreshErr error
+}
+
+// tabletHealth is what we know about a tablet.
+type tabletHealth struct {
+	cellRank int // the index of its cell in TabletDiscovery.cells
+	endPoint topo.EndPoint
+
+	// the last health stats, or the error of the health stream.
+	stats     *tproto.HealthStats
+	statsTime time.Time
+	streamErr error
+
+	// errorScore is the number of recent errors, decaying with
+	// errorHalfLife since errorTime.
+	errorScore float64
+	errorTime  time.Time
+	downUntil  time.Time
+
+	// done is closed when the tablet leaves the serving graph.
+	done chan struct{}
+}
+
+// class returns the health class of a tablet.
+func (th *tabletHealth) class(now time.Time, maxLag time.Duration) int {
+	switch {
+	case now.Before(th.downUntil):
+		return healthClassDown
+	case th.stats == nil || th.streamErr != nil || now.Sub(th.statsTime) > healthStaleAfter:
+		return healthClassUnknown
+	case !th.stats.Healthy || !th.stats.Serving:
+		return healthClassDown
+	case th.stats.IsSlave && (!th.stats.ReplicationRunning || time.Duration(th.stats.SecondsBehindMaster)*time.Second > maxLag):
+		return healthClassLagging
+	}
+	return healthClassHealthy
+}
+
+// errors returns the decayed error score of a tablet.
+func (th *tabletHealth) errors(now time.Time) float64 {
+	if th.errorScore == 0 {
+		return 0
+	}
+	return th.errorScore * math.Pow(0.5, float64(now.Sub(th.errorTime))/float64(errorHalfLife))
+}
+
+func tabletKey(cell string, uid uint32) string {
+	return fmt.Sprintf("%v-%v", cell, uid)
+}
+
+// refreshLoop reads the end points of the target from the serving
+// graph every refresh interval.
+func (dt *discoveryTarget) refreshLoop() {
+	dt.refresh()
+	close(dt.refreshed)
+	for {
+		select {
+		case <-dt.td.done:
+			dt.mu.Lock()
+			for key, th := range dt.tablets {
+				close(th.done)
+				delete(dt.tablets, key)
+			}
+			dt.mu.Unlock()
+			return
+		case <-time.After(dt.td.refreshInterval):
+			dt.refresh()
+		}
+	}
+}
+
+// refresh reads the end points of the target in all cells, starts
+// streaming the health of the new tablets, and forgets the ones that
+// went away.
+func (dt *discoveryTarget) refresh() {
+	ctx := &context.DummyContext{}
+	seen := make(map[string]bool)
+	var lastErr error
+	for cellRank, cell := range dt.td.cells {
+		endPoints, err := dt.td.serv.GetEndPoints(ctx, cell, dt.keyspace, dt.shard, dt.tabletType)
+		if err != nil {
+			// Other cells may not have tablets of this type,
+			// so only the errors of the local cell matter.
+			if cellRank == 0 {
+				lastErr = err
+				log.Warningf("tablet discovery: cannot read end points for %v/%v/%v in cell %v: %v", dt.keyspace, dt.shard, dt.tabletType, cell, err)
+			}
+			continue
+		}
+
+		dt.mu.Lock()
+		for _, endPoint := range endPoints.Entries {
+			key := tabletKey(cell, endPoint.Uid)
+			seen[key] = true
+			if th, ok := dt.tablets[key]; ok {
+				th.endPoint = endPoint
+				continue
+			}
+			th := &tabletHealth{
+				cellRank: cellRank,
+				endPoint: endPoint,
+				done:     make(chan struct{}),
+			}
+			dt.tablets[key] = th
+			go dt.streamHealth(th)
+		}
+		dt.mu.Unlock()
+	}
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if lastErr != nil && len(seen) == 0 {
+		// keep what we know, the serving graph may be
+		// temporarily unavailable
+		dt.refreshErr = lastErr
+		return
+	}
+	dt.refreshErr = nil
+	for key, th := range dt.tablets {
+		if !seen[key] {
+			close(th.done)
+			delete(dt.tablets, key)
+		}
+	}
+}
+
+// streamHealth streams the health of a tablet, until it leaves the
+// serving graph.
+func (dt *discoveryTarget) streamHealth(th *tabletHealth) {
+	ctx := &context.DummyContext{}
+	for {
+		dt.mu.Lock()
+		endPoint := th.endPoint
+		dt.mu.Unlock()
+
+		conn, err := dt.td.dialer(ctx, endPoint, dt.keyspace, dt.shard, dt.td.timeout)
+		if err == nil {
+			// close the connection to stop the stream when
+			// the tablet goes away
+			streamDone := make(chan struct{})
+			go func() {
+				select {
+				case <-th.done:
+					conn.Close()
+				case <-streamDone:
+				}
+			}()
+
+			stream, errFunc := conn.StreamHealth(ctx)
+			for stats := range stream {
+				dt.mu.Lock()
+				th.stats = stats
+				th.statsTime = time.Now()
+				th.streamErr = nil
+				dt.mu.Unlock()
+			}
+			err = errFunc()
+			if err == nil {
+				err = fmt.Errorf("health stream ended")
+			}
+			close(streamDone)
+			conn.Close()
+		}
+
+		select {
+		case <-th.done:
+			return
+		default:
+		}
+		log.Infof("tablet discovery: health stream of %v/%v/%v tablet %v failed: %v", dt.keyspace, dt.shard, dt.tabletType, endPoint.Uid, err)
+		dt.mu.Lock()
+		th.streamErr = err
+		dt.mu.Unlock()
+
+		select {
+		case <-th.done:
+			return
+		case <-time.After(dt.td.retryDelay):
+		}
+	}
+}
+
+// Get is part of the endPointPicker interface. It returns a tablet of
+// the best health class, preferring the closest cell, and then the
+// tablets with the fewest recent errors. Ties are broken at random.
+func (dt *discoveryTarget) Get() (topo.EndPoint, error) {
+	<-dt.refreshed
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	now := time.Now()
+	var best []*tabletHealth
+	bestClass, bestCellRank := healthClassDown, 0
+	for _, th := range dt.tablets {
+		class := th.class(now, dt.td.maxLag)
+		if class == healthClassDown {
+			continue
+		}
+		switch {
+		case class < bestClass, class == bestClass && th.cellRank < bestCellRank:
+			best = []*tabletHealth{th}
+			bestClass, bestCellRank = class, th.cellRank
+		case class == bestClass && th.cellRank == bestCellRank:
+			best = append(best, th)
+		}
+	}
+	if len(best) == 0 {
+		if dt.refreshErr != nil {
+			return topo.EndPoint{}, fmt.Errorf("endpoints fetch error: %v", dt.refreshErr)
+		}
+		return topo.EndPoint{}, fmt.Errorf("no healthy tablet for %v/%v/%v", dt.keyspace, dt.shard, dt.tabletType)
+	}
+
+	// Only keep the tablets with about as few recent errors as the
+	// best one: a tablet that failed comes back in the rotation
+	// after errorHalfLife.
+	minErrors := math.MaxFloat64
+	for _, th := range best {
+		if e := th.errors(now); e < minErrors {
+			minErrors = e
+		}
+	}
+	candidates := best[:0]
+	for _, th := range best {
+		if th.errors(now) <= minErrors+0.5 {
+			candidates = append(candidates, th)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))].endPoint, nil
+}
+
+// MarkDown is part of the endPointPicker interface. The tablet is not
+// used for retryDelay, and the error counts against it afterwards.
+func (dt *discoveryTarget) MarkDown(uid uint32, reason string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	now := time.Now()
+	for _, th := range dt.tablets {
+		if th.endPoint.Uid != uid {
+			continue
+		}
+		log.Infof("Marking down %v at %+v (%v)", uid, th.endPoint, reason)
+		th.errorScore = th.errors(now) + 1
+		th.errorTime = now
+		th.downUntil = now.Add(dt.td.retryDelay)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// discoveryTopo serves the end points of one shard, per cell.
+type discoveryTopo struct {
+	sandboxTopo
+	endPoints map[string][]uint32
+}
+
+func (dt *discoveryTopo) GetEndPoints(context context.Context, cell, keyspace, shard string, tabletType topo.TabletType) (*topo.EndPoints, error) {
+	uids, ok := dt.endPoints[cell]
+	if !ok {
+		return nil, fmt.Errorf("no end points in cell %v", cell)
+	}
+	endPoints := &topo.EndPoints{}
+	for _, uid := range uids {
+		endPoints.Entries = append(endPoints.Entries, topo.EndPoint{Uid: uid, Host: fmt.Sprintf("host%v", uid)})
+	}
+	return endPoints, nil
+}
+
+// healthConns streams the health stats sent on their channel.
+type healthConns struct {
+	mu      sync.Mutex
+	streams map[uint32]chan *tproto.HealthStats
+}
+
+type healthConn struct {
+	*sandboxConn
+	stream chan *tproto.HealthStats
+}
+
+func (hc *healthConn) StreamHealth(context context.Context) (<-chan *tproto.HealthStats, tabletconn.ErrFunc) {
+	return hc.stream, func() error { return nil }
+}
+
+func (hc *healthConn) Close() {}
+
+func (hcs *healthConns) dial(context context.Context, endPoint topo.EndPoint, keyspace, shard string, timeout time.Duration) (tabletconn.TabletConn, error) {
+	return &healthConn{&sandboxConn{endPoint: endPoint}, hcs.stream(endPoint.Uid)}, nil
+}
+
+func (hcs *healthConns) stream(uid uint32) chan *tproto.HealthStats {
+	hcs.mu.Lock()
+	defer hcs.mu.Unlock()
+	if hcs.streams[uid] == nil {
+		hcs.streams[uid] = make(chan *tproto.HealthStats, 10)
+	}
+	return hcs.streams[uid]
+}
+
+func healthy() *tproto.HealthStats {
+	return &tproto.HealthStats{Healthy: true, Serving: true, IsSlave: true, ReplicationRunning: true}
+}
+
+// waitForClass waits until the tablet uid of the target is in the
+// given health class.
+func waitForClass(t *testing.T, picker endPointPicker, uid uint32, class int) {
+	dt := picker.(*discoveryTarget)
+	<-dt.refreshed
+	for i := 0; i < 100; i++ {
+		dt.mu.Lock()
+		for _, th := range dt.tablets {
+			if th.endPoint.Uid == uid && th.class(time.Now(), dt.td.maxLag) == class {
+				dt.mu.Unlock()
+				return
+			}
+		}
+		dt.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("tablet %v never got in health class %v", uid, class)
+}
+
+func checkPicks(t *testing.T, picker endPointPicker, want uint32) {
+	for i := 0; i < 10; i++ {
+		endPoint, err := picker.Get()
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if endPoint.Uid != want {
+			t.Fatalf("Get: got tablet %v, want %v", endPoint.Uid, want)
+		}
+	}
+}
+
+func TestTabletDiscovery(t *testing.T) {
+	serv := &discoveryTopo{endPoints: map[string][]uint32{
+		"local":  []uint32{1, 2, 3},
+		"remote": []uint32{11},
+	}}
+	hcs := &healthConns{streams: make(map[uint32]chan *tproto.HealthStats)}
+	td := NewTabletDiscovery(serv, "local", []string{"remote"}, time.Hour, 10*time.Second, 50*time.Millisecond, time.Second)
+	td.dialer = hcs.dial
+	defer td.Close()
+
+	// tablet 1 is healthy, 2 is lagging, 3 is not serving, and the
+	// remote tablet is healthy
+	lagging := healthy()
+	lagging.SecondsBehindMaster = 60
+	hcs.stream(1) <- healthy()
+	hcs.stream(2) <- lagging
+	hcs.stream(3) <- &tproto.HealthStats{Error: "not serving"}
+	hcs.stream(11) <- healthy()
+
+	picker := td.picker("ks", "0", topo.TYPE_REPLICA)
+	waitForClass(t, picker, 1, healthClassHealthy)
+	waitForClass(t, picker, 2, healthClassLagging)
+	waitForClass(t, picker, 3, healthClassDown)
+	waitForClass(t, picker, 11, healthClassHealthy)
+
+	// the healthy local tablet wins
+	checkPicks(t, picker, 1)
+	if count := td.HealthyTabletCount(); count["ks.0.replica"] != 2 {
+		t.Errorf("HealthyTabletCount: %v", count)
+	}
+
+	// then the healthy remote one
+	picker.MarkDown(1, "test")
+	checkPicks(t, picker, 11)
+
+	// then the lagging local one
+	picker.MarkDown(11, "test")
+	checkPicks(t, picker, 2)
+
+	// once they are back, the local tablet is picked again
+	hcs.stream(2) <- healthy()
+	waitForClass(t, picker, 1, healthClassHealthy)
+	waitForClass(t, picker, 2, healthClassHealthy)
+
+	// but the tablet without errors is preferred
+	checkPicks(t, picker, 2)
+
+	// no tablet can serve
+	for _, uid := range []uint32{1, 2, 11} {
+		picker.MarkDown(uid, "test")
+	}
+	if endPoint, err := picker.Get(); err == nil {
+		t.Errorf("Get: got %v with all tablets down", endPoint)
+	}
+}
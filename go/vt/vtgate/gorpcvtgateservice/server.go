@@ -33,6 +33,10 @@ func (vtg *VTGate) ExecuteEntityIds(ctx *rpcproto.Context, query *proto.EntityId
 	return vtg.server.ExecuteEntityIds(ctx, query, reply)
 }
 
+func (vtg *VTGate) ExecuteColumnValues(ctx *rpcproto.Context, query *proto.ColumnValuesQuery, reply *proto.QueryResult) error {
+	return vtg.server.ExecuteColumnValues(ctx, query, reply)
+}
+
 func (vtg *VTGate) ExecuteBatchShard(ctx *rpcproto.Context, batchQuery *proto.BatchQueryShard, reply *proto.QueryResultList) error {
 	return vtg.server.ExecuteBatchShard(ctx, batchQuery, reply)
 }
@@ -41,6 +45,10 @@ func (vtg *VTGate) ExecuteBatchKeyspaceIds(ctx *rpcproto.Context, batchQuery *pr
 	return vtg.server.ExecuteBatchKeyspaceIds(ctx, batchQuery, reply)
 }
 
+func (vtg *VTGate) ExecuteBatchKeyRanges(ctx *rpcproto.Context, batchQuery *proto.KeyRangeBatchQuery, reply *proto.QueryResultList) error {
+	return vtg.server.ExecuteBatchKeyRanges(ctx, batchQuery, reply)
+}
+
 func (vtg *VTGate) StreamExecuteShard(ctx *rpcproto.Context, query *proto.QueryShard, sendReply func(interface{}) error) error {
 	return vtg.server.StreamExecuteShard(ctx, query, func(value *proto.QueryResult) error {
 		return sendReply(value)
@@ -63,8 +71,12 @@ func (vtg *VTGate) Begin(ctx *rpcproto.Context, noInput *rpc.UnusedRequest, outS
 	return vtg.server.Begin(ctx, outSession)
 }
 
-func (vtg *VTGate) Commit(ctx *rpcproto.Context, inSession *proto.Session, noOutput *rpc.UnusedResponse) error {
-	return vtg.server.Commit(ctx, inSession)
+// Commit replies with the session, whose positions are updated for
+// read-after-write.
+func (vtg *VTGate) Commit(ctx *rpcproto.Context, inSession *proto.Session, outSession *proto.Session) error {
+	err := vtg.server.Commit(ctx, inSession)
+	*outSession = *inSession
+	return err
 }
 
 func (vtg *VTGate) Rollback(ctx *rpcproto.Context, inSession *proto.Session, noOutput *rpc.UnusedResponse) error {
@@ -0,0 +1,505 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
+)
+
+// This file contains the joins of two tables of different keyspaces,
+// like a sharded table and an unsharded one. The keyspaces of the
+// tables come from the VSchema. The driving query reads the rows of
+// the left table, then the distinct values of its join column are sent
+// in batches to the right table: in one query if its keyspace is
+// unsharded, or to the shards the values map to through the vindex of
+// the join column if it is sharded. vtgate joins the rows.
+//
+// Only the simple joins are supported: two tables, one equality
+// between their columns in the ON clause, qualified columns, and WHERE
+// conditions that each read one of the tables. The right table of a
+// LEFT JOIN can't have WHERE conditions: sent to its query, they
+// would filter its rows before the join instead of the joined rows,
+// and keep the left rows they should drop. The LIMIT applies to the
+// joined rows. DISTINCT, GROUP BY, HAVING, ORDER BY and the
+// aggregates would need all the rows, they are not supported.
+//
+// vtgate matches the rows on the raw bytes of their join values, not
+// with the collations and conversions of MySQL: 'abc' doesn't match
+// 'ABC', and a string '01' doesn't match a number 1. The join columns
+// must have the same type and the same representation in both tables,
+// like the integer ids joins are usually on.
+
+var (
+	joinBatchSize = flag.Int("join_batch_size", 100, "number of values of the join column vtgate sends per query to the second table of a cross-keyspace join")
+	joinMaxRows   = flag.Int("join_max_rows", 10000, "maximum number of rows vtgate reads from each table of a cross-keyspace join, and returns")
+)
+
+// joinArgPrefix starts the names of the bind variables of the join
+// values sent to an unsharded table.
+const joinArgPrefix = "vtg_join"
+
+// joinTable is a table of a cross-keyspace join.
+type joinTable struct {
+	table *vindexes.Table
+
+	// name qualifies the columns of the table in the query.
+	name string
+
+	// sel reads the columns of the table the join returns, followed
+	// by its join column.
+	sel *sqlparser.Select
+
+	// column is the join column.
+	column *sqlparser.ColName
+}
+
+// joinColumn is a column of the joined rows: the column index of the
+// rows of the left or right table.
+type joinColumn struct {
+	right bool
+	index int
+}
+
+// joinPlan is the plan of a join of tables of different keyspaces.
+type joinPlan struct {
+	left, right *joinTable
+
+	// outer is true for a LEFT JOIN.
+	outer bool
+
+	columns []joinColumn
+	limit   *sqlparser.Limit
+}
+
+// planJoin returns the plan of sql if it joins tables of different
+// keyspaces, or nil if it doesn't.
+func planJoin(vschema *vindexes.VSchema, sql string) (*joinPlan, error) {
+	if vschema == nil || len(vschema.Keyspaces) < 2 || !strings.Contains(strings.ToLower(sql), "join") {
+		return nil, nil
+	}
+	// The queries that don't parse are left to the tablets.
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, nil
+	}
+	sel, ok := statement.(*sqlparser.Select)
+	if !ok || len(sel.From) != 1 {
+		return nil, nil
+	}
+	join, ok := sel.From[0].(*sqlparser.JoinTableExpr)
+	if !ok {
+		return nil, nil
+	}
+	left := newJoinTable(vschema, join.LeftExpr)
+	right := newJoinTable(vschema, join.RightExpr)
+	if left == nil || right == nil || left.table.Keyspace == right.table.Keyspace {
+		return nil, nil
+	}
+
+	jp := &joinPlan{left: left, right: right, limit: sel.Limit}
+	switch join.Join {
+	case sqlparser.AST_JOIN, sqlparser.AST_STRAIGHT_JOIN:
+	case sqlparser.AST_LEFT_JOIN:
+		jp.outer = true
+	default:
+		return nil, fmt.Errorf("cross-keyspace join: %v is not supported", join.Join)
+	}
+	switch {
+	case sel.Distinct != "":
+		return nil, fmt.Errorf("cross-keyspace join: distinct is not supported")
+	case len(sel.GroupBy) > 0 || sel.Having != nil:
+		return nil, fmt.Errorf("cross-keyspace join: group by is not supported")
+	case len(sel.OrderBy) > 0:
+		return nil, fmt.Errorf("cross-keyspace join: order by is not supported")
+	case sel.Lock != "":
+		return nil, fmt.Errorf("cross-keyspace join: locks are not supported")
+	}
+	if err := jp.planOn(join.On); err != nil {
+		return nil, err
+	}
+	for _, expr := range sel.SelectExprs {
+		nonStar, ok := expr.(*sqlparser.NonStarExpr)
+		if !ok {
+			return nil, fmt.Errorf("cross-keyspace join: %v is not supported, the columns must be listed", sqlparser.String(expr))
+		}
+		if funcExpr, ok := nonStar.Expr.(*sqlparser.FuncExpr); ok {
+			if name := strings.ToLower(string(funcExpr.Name)); aggregates[name] || unsupportedAggregates[name] {
+				return nil, fmt.Errorf("cross-keyspace join: aggregate %v is not supported", sqlparser.String(funcExpr))
+			}
+		}
+		jt, err := jp.tableOf(nonStar.Expr)
+		if err != nil {
+			return nil, err
+		}
+		jp.columns = append(jp.columns, joinColumn{right: jt == right, index: len(jt.sel.SelectExprs)})
+		jt.sel.SelectExprs = append(jt.sel.SelectExprs, nonStar)
+	}
+	if sel.Where != nil {
+		for _, cond := range splitAnd(sel.Where.Expr, nil) {
+			jt, err := jp.tableOf(cond)
+			if err != nil {
+				return nil, err
+			}
+			if jp.outer && jt == jp.right {
+				return nil, fmt.Errorf("cross-keyspace join: %v reads the right table of a left join, it is not supported", sqlparser.String(cond))
+			}
+			jt.sel = addCondition(jt.sel, cond)
+		}
+	}
+	for _, jt := range []*joinTable{left, right} {
+		jt.sel.Comments = sel.Comments
+		jt.sel.SelectExprs = append(jt.sel.SelectExprs, &sqlparser.NonStarExpr{Expr: jt.column})
+	}
+	return jp, nil
+}
+
+// newJoinTable returns the table of expr, or nil if it's not a table
+// of the VSchema.
+func newJoinTable(vschema *vindexes.VSchema, expr sqlparser.TableExpr) *joinTable {
+	aliased, ok := expr.(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return nil
+	}
+	tableName, ok := aliased.Expr.(*sqlparser.TableName)
+	if !ok {
+		return nil
+	}
+	table, err := vschema.FindTable(string(tableName.Name))
+	if err != nil {
+		return nil
+	}
+	jt := &joinTable{
+		table: table,
+		name:  string(tableName.Name),
+		sel:   &sqlparser.Select{From: sqlparser.TableExprs{aliased}},
+	}
+	if aliased.As != nil {
+		jt.name = string(aliased.As)
+	}
+	return jt
+}
+
+// planOn finds the join columns in the ON clause, which must compare
+// a column of each table.
+func (jp *joinPlan) planOn(on sqlparser.BoolExpr) error {
+	if paren, ok := on.(*sqlparser.ParenBoolExpr); ok {
+		on = paren.Expr
+	}
+	comparison, ok := on.(*sqlparser.ComparisonExpr)
+	if !ok || comparison.Operator != sqlparser.AST_EQ {
+		return fmt.Errorf("cross-keyspace join: the on clause must compare a column of each table")
+	}
+	for _, pair := range [][2]sqlparser.ValExpr{{comparison.Left, comparison.Right}, {comparison.Right, comparison.Left}} {
+		left, ok := pair[0].(*sqlparser.ColName)
+		if !ok || string(left.Qualifier) != jp.left.name {
+			continue
+		}
+		right, ok := pair[1].(*sqlparser.ColName)
+		if !ok || string(right.Qualifier) != jp.right.name {
+			continue
+		}
+		jp.left.column, jp.right.column = left, right
+		return nil
+	}
+	return fmt.Errorf("cross-keyspace join: the on clause must compare a column of each table")
+}
+
+// tableOf returns the table whose columns node reads. The expressions
+// without columns are read from the left table.
+func (jp *joinPlan) tableOf(node sqlparser.SQLNode) (*joinTable, error) {
+	var tables [2]bool
+	if err := jp.findTables(node, &tables); err != nil {
+		return nil, err
+	}
+	switch {
+	case tables[0] && tables[1]:
+		return nil, fmt.Errorf("cross-keyspace join: %v reads columns of both tables", sqlparser.String(node))
+	case tables[1]:
+		return jp.right, nil
+	}
+	return jp.left, nil
+}
+
+// findTables flags the tables whose columns node reads.
+func (jp *joinPlan) findTables(node sqlparser.SQLNode, tables *[2]bool) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.ColName:
+			switch string(node.Qualifier) {
+			case jp.left.name:
+				tables[0] = true
+			case jp.right.name:
+				tables[1] = true
+			case "":
+				return false, fmt.Errorf("cross-keyspace join: column %s must be qualified by its table", node.Name)
+			default:
+				return false, fmt.Errorf("cross-keyspace join: unknown table %s", node.Qualifier)
+			}
+		case *sqlparser.Subquery, *sqlparser.ExistsExpr:
+			return false, fmt.Errorf("cross-keyspace join: subqueries are not supported")
+		}
+		return true, nil
+	}, node)
+}
+
+// splitAnd appends the conditions of the AND expression cond to conds.
+func splitAnd(cond sqlparser.BoolExpr, conds []sqlparser.BoolExpr) []sqlparser.BoolExpr {
+	if and, ok := cond.(*sqlparser.AndExpr); ok {
+		return splitAnd(and.Right, splitAnd(and.Left, conds))
+	}
+	return append(conds, cond)
+}
+
+// addCondition returns a copy of sel with cond added to its WHERE.
+func addCondition(sel *sqlparser.Select, cond sqlparser.BoolExpr) *sqlparser.Select {
+	result := *sel
+	if sel.Where != nil {
+		cond = &sqlparser.AndExpr{Left: sel.Where.Expr, Right: cond}
+	}
+	result.Where = &sqlparser.Where{Type: sqlparser.AST_WHERE, Expr: cond}
+	return &result
+}
+
+// joinBindValue returns the bind variable of a value of a join column.
+func joinBindValue(v sqltypes.Value) interface{} {
+	if v.IsNumeric() {
+		if n, err := v.ParseInt64(); err == nil {
+			return n
+		}
+		if n, err := v.ParseUint64(); err == nil {
+			return n
+		}
+	}
+	return v.Raw()
+}
+
+// executeJoin executes the join with the bind variables, tablet type
+// and session of query.
+func (res *Resolver) executeJoin(context context.Context, vschema *vindexes.VSchema, jp *joinPlan, query *proto.KeyRangeQuery) (*mproto.QueryResult, error) {
+	var offset, rowcount int64
+	if jp.limit != nil {
+		var err error
+		if jp.limit.Offset != nil {
+			if offset, err = limitValue(jp.limit.Offset, query.BindVariables); err != nil {
+				return nil, err
+			}
+		}
+		if rowcount, err = limitValue(jp.limit.Rowcount, query.BindVariables); err != nil {
+			return nil, err
+		}
+	}
+
+	left, err := res.executeJoinTable(context, jp.left.table, jp.left.sel, query.BindVariables, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(left.Rows) > *joinMaxRows {
+		return nil, fmt.Errorf("cross-keyspace join: table %v returned more than %v rows", jp.left.table.Name, *joinMaxRows)
+	}
+	leftIndex := len(jp.left.sel.SelectExprs) - 1
+	var values []interface{}
+	seen := make(map[string]bool)
+	for _, row := range left.Rows {
+		if len(row) <= leftIndex {
+			return nil, fmt.Errorf("cross-keyspace join: table %v returned %v values for %v columns", jp.left.table.Name, len(row), leftIndex+1)
+		}
+		v := row[leftIndex]
+		if v.IsNull() || seen[string(v.Raw())] {
+			continue
+		}
+		seen[string(v.Raw())] = true
+		values = append(values, joinBindValue(v))
+	}
+
+	// The rows of the right table are indexed by their join value.
+	rightIndex := len(jp.right.sel.SelectExprs) - 1
+	var rightFields []mproto.Field
+	fetched := false
+	matches := make(map[string][][]sqltypes.Value)
+	count := 0
+	for start := 0; start < len(values); start += *joinBatchSize {
+		end := start + *joinBatchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		qr, err := res.executeJoinBatch(context, vschema, jp.right, values[start:end], query)
+		if err != nil {
+			return nil, err
+		}
+		if qr == nil {
+			continue
+		}
+		rightFields, fetched = qr.Fields, true
+		if count += len(qr.Rows); count > *joinMaxRows {
+			return nil, fmt.Errorf("cross-keyspace join: table %v returned more than %v rows", jp.right.table.Name, *joinMaxRows)
+		}
+		for _, row := range qr.Rows {
+			if len(row) <= rightIndex {
+				return nil, fmt.Errorf("cross-keyspace join: table %v returned %v values for %v columns", jp.right.table.Name, len(row), rightIndex+1)
+			}
+			k := string(row[rightIndex].Raw())
+			matches[k] = append(matches[k], row)
+		}
+	}
+	if !fetched {
+		// No value was sent to the right table, its fields are
+		// read with a query that returns no rows.
+		never := &sqlparser.ComparisonExpr{Operator: sqlparser.AST_NE, Left: sqlparser.NumVal("1"), Right: sqlparser.NumVal("1")}
+		qr, err := res.executeJoinTable(context, jp.right.table, addCondition(jp.right.sel, never), query.BindVariables, query)
+		if err != nil {
+			return nil, err
+		}
+		rightFields = qr.Fields
+	}
+
+	result := new(mproto.QueryResult)
+	for _, col := range jp.columns {
+		fields := left.Fields
+		if col.right {
+			fields = rightFields
+		}
+		if col.index >= len(fields) {
+			return nil, fmt.Errorf("cross-keyspace join: missing field %v", col.index)
+		}
+		result.Fields = append(result.Fields, fields[col.index])
+	}
+	end := int64(-1)
+	if jp.limit != nil {
+		end = offset + rowcount
+	}
+	for _, leftRow := range left.Rows {
+		var rightRows [][]sqltypes.Value
+		if v := leftRow[leftIndex]; !v.IsNull() {
+			rightRows = matches[string(v.Raw())]
+		}
+		if len(rightRows) == 0 {
+			if !jp.outer {
+				continue
+			}
+			rightRows = [][]sqltypes.Value{nil}
+		}
+		for _, rightRow := range rightRows {
+			if int64(len(result.Rows)) == end {
+				break
+			}
+			row := make([]sqltypes.Value, len(jp.columns))
+			for i, col := range jp.columns {
+				switch {
+				case !col.right:
+					row[i] = leftRow[col.index]
+				case rightRow != nil:
+					row[i] = rightRow[col.index]
+				}
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		if len(result.Rows) > *joinMaxRows {
+			return nil, fmt.Errorf("cross-keyspace join: more than %v joined rows", *joinMaxRows)
+		}
+	}
+	if jp.limit != nil {
+		if offset > int64(len(result.Rows)) {
+			offset = int64(len(result.Rows))
+		}
+		result.Rows = result.Rows[offset:]
+	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// executeJoinTable sends sel to all the shards of the keyspace of
+// table.
+func (res *Resolver) executeJoinTable(context context.Context, table *vindexes.Table, sel *sqlparser.Select, bindVars map[string]interface{}, query *proto.KeyRangeQuery) (*mproto.QueryResult, error) {
+	return res.ExecuteKeyRanges(context, &proto.KeyRangeQuery{
+		Sql:           sqlparser.String(sel),
+		BindVariables: bindVars,
+		Keyspace:      table.Keyspace.Name,
+		KeyRanges:     []key.KeyRange{{}},
+		TabletType:    query.TabletType,
+		Session:       query.Session,
+	})
+}
+
+// executeJoinBatch reads the rows of the right table of a join with
+// the given join values. It returns nil if no shard has them.
+func (res *Resolver) executeJoinBatch(context context.Context, vschema *vindexes.VSchema, right *joinTable, values []interface{}, query *proto.KeyRangeQuery) (*mproto.QueryResult, error) {
+	if !right.table.Keyspace.Sharded {
+		bindVars := make(map[string]interface{}, len(query.BindVariables)+len(values))
+		for k, v := range query.BindVariables {
+			bindVars[k] = v
+		}
+		args := make(sqlparser.ValTuple, len(values))
+		for i, v := range values {
+			name := fmt.Sprintf("%s%d", joinArgPrefix, i)
+			bindVars[name] = v
+			args[i] = sqlparser.ValArg(":" + name)
+		}
+		in := &sqlparser.ComparisonExpr{Operator: sqlparser.AST_IN, Left: right.column, Right: args}
+		return res.executeJoinTable(context, right.table, addCondition(right.sel, in), bindVars, query)
+	}
+
+	column := string(right.column.Name)
+	cursor := &vindexCursor{res: res, context: context, vschema: vschema, query: query}
+	ksids, err := right.table.MapColumn(cursor, column, values)
+	if err != nil {
+		return nil, fmt.Errorf("cross-keyspace join: %v", err)
+	}
+	var entityIds []proto.EntityId
+	for i, v := range values {
+		for _, ksid := range ksids[i] {
+			entityIds = append(entityIds, proto.EntityId{ExternalID: v, KeyspaceID: ksid})
+		}
+	}
+	if len(entityIds) == 0 {
+		return nil, nil
+	}
+	return res.ExecuteEntityIds(context, &proto.EntityIdsQuery{
+		Sql:               sqlparser.String(right.sel),
+		BindVariables:     query.BindVariables,
+		Keyspace:          right.table.Keyspace.Name,
+		EntityColumnName:  column,
+		EntityKeyspaceIDs: entityIds,
+		TabletType:        query.TabletType,
+		Session:           query.Session,
+	})
+}
+
+// vindexCursor is the VCursor of the vindexes vtgate maps: it sends
+// their queries to the keyspace of the table they read, with the
+// tablet type and session of query.
+type vindexCursor struct {
+	res     *Resolver
+	context context.Context
+	vschema *vindexes.VSchema
+	query   *proto.KeyRangeQuery
+}
+
+// Execute is part of the vindexes.VCursor interface.
+func (vc *vindexCursor) Execute(query *tproto.BoundQuery) (*mproto.QueryResult, error) {
+	statement, err := sqlparser.Parse(query.Sql)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := statement.(*sqlparser.Select)
+	if !ok || len(sel.From) != 1 {
+		return nil, fmt.Errorf("unsupported vindex query %v", query.Sql)
+	}
+	jt := newJoinTable(vc.vschema, sel.From[0])
+	if jt == nil {
+		return nil, fmt.Errorf("the table of vindex query %v is not in the VSchema", query.Sql)
+	}
+	return vc.res.executeJoinTable(vc.context, jt.table, sel, query.BindVariables, vc.query)
+}
@@ -0,0 +1,353 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
+)
+
+// This file uses the sandbox_test framework.
+
+// joinConn answers the queries with a function, and records them.
+type joinConn struct {
+	*sandboxConn
+	execute func(query string, bindVars map[string]interface{}) *mproto.QueryResult
+	mu      sync.Mutex
+	queries []string
+}
+
+func newJoinConn(execute func(query string, bindVars map[string]interface{}) *mproto.QueryResult) *joinConn {
+	return &joinConn{sandboxConn: &sandboxConn{}, execute: execute}
+}
+
+func (jc *joinConn) Execute(context context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*mproto.QueryResult, error) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	jc.queries = append(jc.queries, query)
+	return jc.execute(query, bindVars), nil
+}
+
+// tableRows returns the columns of the select list of the queries,
+// of the rows with the value of one of the bind variables, or of all
+// of them if there's none.
+func tableRows(fields []mproto.Field, rows ...[]string) func(string, map[string]interface{}) *mproto.QueryResult {
+	index := make(map[string]int)
+	for i, field := range fields {
+		index[field.Name] = i
+	}
+	return func(query string, bindVars map[string]interface{}) *mproto.QueryResult {
+		statement, err := sqlparser.Parse(query)
+		if err != nil {
+			panic(err)
+		}
+		var columns []int
+		var selected []mproto.Field
+		for _, expr := range statement.(*sqlparser.Select).SelectExprs {
+			col := expr.(*sqlparser.NonStarExpr).Expr.(*sqlparser.ColName)
+			columns = append(columns, index[string(col.Name)])
+			selected = append(selected, fields[index[string(col.Name)]])
+		}
+		if strings.Contains(query, "1 != 1") {
+			return makeResult(selected)
+		}
+		values := make(map[string]bool)
+		for _, v := range bindVars {
+			if b, ok := v.([]byte); ok {
+				values[string(b)] = true
+			} else {
+				values[fmt.Sprint(v)] = true
+			}
+		}
+		var result [][]string
+		for _, row := range rows {
+			if len(values) > 0 && !hasValue(row, values) {
+				continue
+			}
+			var values []string
+			for _, i := range columns {
+				values = append(values, row[i])
+			}
+			result = append(result, values)
+		}
+		return makeResult(selected, result...)
+	}
+}
+
+func hasValue(row []string, values map[string]bool) bool {
+	for _, v := range row {
+		if values[v] {
+			return true
+		}
+	}
+	return false
+}
+
+func newJoinVSchema(t *testing.T, user, main string) *vindexes.VSchema {
+	vschema, err := vindexes.BuildVSchema(map[string]*vindexes.KeyspaceFormal{
+		user: {
+			Sharded: true,
+			Vindexes: map[string]vindexes.VindexFormal{
+				"user_index": {Type: "hash"},
+				"name_user_index": {
+					Type:   "lookup_hash",
+					Params: map[string]interface{}{"Table": "name_user_idx", "From": "name", "To": "user_id"},
+				},
+			},
+			Tables: map[string]vindexes.TableFormal{
+				"user": {ColVindexes: []vindexes.ColVindexFormal{{Col: "id", Name: "user_index"}, {Col: "name", Name: "name_user_index"}}},
+			},
+		},
+		main: {
+			Tables: map[string]vindexes.TableFormal{
+				"main":          {},
+				"name_user_idx": {},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("BuildVSchema: %v", err)
+	}
+	return vschema
+}
+
+func TestPlanJoin(t *testing.T) {
+	vschema := newJoinVSchema(t, "TestPlanJoinUser", "TestPlanJoinMain")
+	testCases := []struct {
+		sql         string
+		left, right string
+		err         string
+	}{{
+		sql:   "select u.id, m.name, u.a + 1 from user as u join main as m on u.main_id = m.id where u.id = 1 and (m.x = 2 or m.y = 3)",
+		left:  "select u.id, u.a+1, u.main_id from user as u where u.id = 1",
+		right: "select m.name, m.id from main as m where (m.x = 2 or m.y = 3)",
+	}, {
+		sql:   "select /* comment */ m.name from main as m left join user on user.id = m.user_id limit 10",
+		left:  "select /* comment */ m.name, m.user_id from main as m",
+		right: "select /* comment */ user.id from user",
+	}, {
+		sql: "select u.id from user as u",
+	}, {
+		sql: "select u.id from user as u join user_extra as e on u.id = e.user_id",
+	}, {
+		sql: "select * from user as u join main as m on u.main_id = m.id",
+		err: "cross-keyspace join: * is not supported, the columns must be listed",
+	}, {
+		sql: "select u.id from user as u join main as m on u.main_id = m.id order by u.id",
+		err: "cross-keyspace join: order by is not supported",
+	}, {
+		sql: "select count(u.id) from user as u join main as m on u.main_id = m.id",
+		err: "cross-keyspace join: aggregate count(u.id) is not supported",
+	}, {
+		sql: "select id from user as u join main as m on u.main_id = m.id",
+		err: "cross-keyspace join: column id must be qualified by its table",
+	}, {
+		sql: "select u.id from user as u join main as m on u.main_id > m.id",
+		err: "cross-keyspace join: the on clause must compare a column of each table",
+	}, {
+		sql: "select u.id from user as u join main as m on u.main_id = m.id where u.a = m.b",
+		err: "cross-keyspace join: u.a = m.b reads columns of both tables",
+	}, {
+		sql: "select u.id from user as u join main as m on u.main_id = m.id where u.a in (select 1 from dual)",
+		err: "cross-keyspace join: subqueries are not supported",
+	}, {
+		sql:   "select m.name from main as m left join user as u on u.id = m.user_id where m.x = 5",
+		left:  "select m.name, m.user_id from main as m where m.x = 5",
+		right: "select u.id from user as u",
+	}, {
+		sql: "select m.name from main as m left join user as u on u.id = m.user_id where u.b is null",
+		err: "cross-keyspace join: u.b is null reads the right table of a left join, it is not supported",
+	}, {
+		sql: "select m.name from main as m left join user as u on u.id = m.user_id where m.x = 1 and u.x = 5",
+		err: "cross-keyspace join: u.x = 5 reads the right table of a left join, it is not supported",
+	}}
+	for _, tcase := range testCases {
+		jp, err := planJoin(vschema, tcase.sql)
+		if tcase.err != "" {
+			if err == nil || err.Error() != tcase.err {
+				t.Errorf("planJoin(%v): %v, want %v", tcase.sql, err, tcase.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("planJoin(%v): %v", tcase.sql, err)
+			continue
+		}
+		if tcase.left == "" {
+			if jp != nil {
+				t.Errorf("planJoin(%v): %+v, want nil", tcase.sql, jp)
+			}
+			continue
+		}
+		if jp == nil {
+			t.Errorf("planJoin(%v): nil", tcase.sql)
+			continue
+		}
+		if got := sqlparser.String(jp.left.sel); got != tcase.left {
+			t.Errorf("planJoin(%v): left query %v, want %v", tcase.sql, got, tcase.left)
+		}
+		if got := sqlparser.String(jp.right.sel); got != tcase.right {
+			t.Errorf("planJoin(%v): right query %v, want %v", tcase.sql, got, tcase.right)
+		}
+	}
+}
+
+func TestResolverExecuteJoinUnsharded(t *testing.T) {
+	defer func(size, max int) {
+		*joinBatchSize, *joinMaxRows = size, max
+	}(*joinBatchSize, *joinMaxRows)
+	vschema := newJoinVSchema(t, "TestJoinUnshardedUser", "TestJoinUnshardedMain")
+
+	user := createSandbox("TestJoinUnshardedUser")
+	user.ShardSpec = "-80-"
+	userFields := []mproto.Field{{"id", mproto.VT_LONGLONG}, {"main_id", mproto.VT_LONGLONG}}
+	user.MapTestConn("-80", newJoinConn(tableRows(userFields, []string{"1", "10"}, []string{"2", "20"}, []string{"3", "10"}, []string{"4", "NULL"})))
+	user.MapTestConn("80-", newJoinConn(tableRows(userFields)))
+	main := createSandbox("TestJoinUnshardedMain")
+	main.ShardSpec = "-"
+	mainConn := newJoinConn(tableRows([]mproto.Field{{"name", mproto.VT_VAR_STRING}, {"id", mproto.VT_LONGLONG}}, []string{"a", "10"}, []string{"c", "30"}))
+	main.MapTestConn("-", mainConn)
+	res := NewResolver(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 1*time.Millisecond)
+
+	execute := func(sql string) (*mproto.QueryResult, error) {
+		jp, err := planJoin(vschema, sql)
+		if err != nil || jp == nil {
+			t.Fatalf("planJoin(%v): %v %v", sql, jp, err)
+		}
+		mainConn.queries = nil
+		return res.executeJoin(&context.DummyContext{}, vschema, jp, &proto.KeyRangeQuery{Sql: sql, TabletType: topo.TYPE_MASTER})
+	}
+
+	*joinBatchSize = 1
+	qr, err := execute("select u.id, m.name from user as u left join main as m on u.main_id = m.id")
+	if err != nil {
+		t.Fatalf("executeJoin: %v", err)
+	}
+	if got, want := resultString(qr), "1,a;2,NULL;3,a;4,NULL"; got != want {
+		t.Errorf("executeJoin: got %v, want %v", got, want)
+	}
+	if len(qr.Fields) != 2 || qr.Fields[0].Name != "id" || qr.Fields[1].Name != "name" || qr.RowsAffected != 4 {
+		t.Errorf("executeJoin: %+v", qr)
+	}
+	if len(mainConn.queries) != 2 || mainConn.queries[0] != "select m.name, m.id from main as m where m.id in (:vtg_join0)" {
+		t.Errorf("main queries: %v", mainConn.queries)
+	}
+
+	*joinBatchSize = 100
+	qr, err = execute("select u.id, m.name from user as u join main as m on u.main_id = m.id limit 1, 5")
+	if err != nil {
+		t.Fatalf("executeJoin: %v", err)
+	}
+	if got, want := resultString(qr), "3,a"; got != want {
+		t.Errorf("executeJoin: got %v, want %v", got, want)
+	}
+	if len(mainConn.queries) != 1 || mainConn.queries[0] != "select m.name, m.id from main as m where m.id in (:vtg_join0, :vtg_join1)" {
+		t.Errorf("main queries: %v", mainConn.queries)
+	}
+
+	// The fields of the right table are read even if no value is
+	// sent to it.
+	qr, err = execute("select u.id, m.name from user as u left join main as m on u.id = m.id where u.id = 4")
+	if err != nil {
+		t.Fatalf("executeJoin: %v", err)
+	}
+	if len(qr.Fields) != 2 || qr.Fields[1].Name != "name" {
+		t.Errorf("executeJoin: %+v", qr)
+	}
+
+	*joinMaxRows = 3
+	if _, err := execute("select u.id, m.name from user as u join main as m on u.main_id = m.id"); err == nil || !strings.Contains(err.Error(), "more than 3 rows") {
+		t.Errorf("executeJoin: %v, want more than 3 rows", err)
+	}
+}
+
+func TestResolverExecuteJoinSharded(t *testing.T) {
+	vschema := newJoinVSchema(t, "TestJoinShardedUser", "TestJoinShardedMain")
+
+	user := createSandbox("TestJoinShardedUser")
+	user.ShardSpec = "-80-"
+	// Both shards have all the rows, each row is returned by the
+	// shard its id maps to.
+	userRows := tableRows([]mproto.Field{{"id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}, []string{"1", "x"}, []string{"2", "y"})
+	userConns := []*joinConn{newJoinConn(userRows), newJoinConn(userRows)}
+	user.MapTestConn("-80", userConns[0])
+	user.MapTestConn("80-", userConns[1])
+	main := createSandbox("TestJoinShardedMain")
+	main.ShardSpec = "-"
+	mainRows := tableRows([]mproto.Field{{"x", mproto.VT_VAR_STRING}, {"user_id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}, []string{"a", "1", "y"}, []string{"b", "2", "z"}, []string{"c", "99", "x"})
+	lookupRows := tableRows([]mproto.Field{{"user_id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}, []string{"2", "y"}, []string{"1", "x"})
+	main.MapTestConn("-", newJoinConn(func(query string, bindVars map[string]interface{}) *mproto.QueryResult {
+		if strings.Contains(query, "name_user_idx") {
+			return lookupRows(query, bindVars)
+		}
+		return mainRows(query, bindVars)
+	}))
+	res := NewResolver(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 1*time.Millisecond)
+
+	testCases := []struct {
+		sql, want string
+	}{{
+		sql:  "select m.x, u.name from main as m join user as u on m.user_id = u.id",
+		want: "a,x;b,y",
+	}, {
+		sql:  "select m.x, u.id from main as m join user as u on u.name = m.name",
+		want: "a,2;c,1",
+	}}
+	for _, tcase := range testCases {
+		jp, err := planJoin(vschema, tcase.sql)
+		if err != nil || jp == nil {
+			t.Fatalf("planJoin(%v): %v %v", tcase.sql, jp, err)
+		}
+		for _, uc := range userConns {
+			uc.queries = nil
+		}
+		qr, err := res.executeJoin(&context.DummyContext{}, vschema, jp, &proto.KeyRangeQuery{Sql: tcase.sql, TabletType: topo.TYPE_MASTER})
+		if err != nil {
+			t.Fatalf("executeJoin(%v): %v", tcase.sql, err)
+		}
+		if got := resultString(qr); got != tcase.want {
+			t.Errorf("executeJoin(%v): got %v, want %v", tcase.sql, got, tcase.want)
+		}
+		// The users are read from the shards their id maps to,
+		// with no scatter.
+		for _, uc := range userConns {
+			for _, query := range uc.queries {
+				if !strings.Contains(query, " in (") {
+					t.Errorf("executeJoin(%v): user query %v", tcase.sql, query)
+				}
+			}
+		}
+	}
+
+	// The joins are executed by VTGate.ExecuteKeyRanges.
+	defer func(vschema *vindexes.VSchema) {
+		RpcVTGate.vschema = vschema
+	}(RpcVTGate.vschema)
+	RpcVTGate.vschema = vschema
+	reply := new(proto.QueryResult)
+	q := &proto.KeyRangeQuery{
+		Sql:        testCases[0].sql,
+		Keyspace:   "TestJoinShardedMain",
+		KeyRanges:  []key.KeyRange{{}},
+		TabletType: topo.TYPE_MASTER,
+	}
+	if err := RpcVTGate.ExecuteKeyRanges(&context.DummyContext{}, q, reply); err != nil || reply.Error != "" {
+		t.Fatalf("ExecuteKeyRanges: %v %v", err, reply.Error)
+	}
+	if got := resultString(reply.Result); got != testCases[0].want {
+		t.Errorf("ExecuteKeyRanges: got %v, want %v", got, testCases[0].want)
+	}
+}
@@ -0,0 +1,700 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mysqlserver serves vtgate to MySQL clients.
+//
+// It speaks the MySQL client/server protocol, so existing clients,
+// drivers and ORMs can use vtgate without a Vitess client library.
+// The database of the connection is the target of its queries:
+//
+//	keyspace[:shard][@tablet_type]
+//
+// The queries go to the shard if there's one, or else to all the
+// shards of the keyspace, on the tablets of the type (master by
+// default). BEGIN, COMMIT and ROLLBACK drive the vtgate transactions,
+// and SET AUTOCOMMIT is emulated with them: once it's off, the queries
+// outside of a transaction start one. The other SET statements are
+// accepted but ignored. SHOW statements go to a single shard, since
+// all the shards of a keyspace have the same schema. Prepared
+// statements are supported, their params are sent as bind variables.
+package mysqlserver
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/mysql/mysqlconn"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/key"
+	"github.com/youtube/vitess/go/vt/servenv"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// serverVersion is the version announced to the clients, some of
+// them use it to know the features of the server.
+const serverVersion = "5.5.10-vtgate"
+
+var (
+	port     = flag.Int("mysql_server_port", 0, "port to serve the MySQL protocol on (0 to disable)")
+	user     = flag.String("mysql_server_user", "vt_app", "user the MySQL clients authenticate as")
+	password = flag.String("mysql_server_password", "", "password the MySQL clients authenticate with, required if -mysql_server_port is set")
+
+	readAfterWrite = flag.Bool("mysql_server_read_after_write", false, "if set, the reads of the MySQL clients on replicas see their previous commits")
+
+	connCount     = stats.NewInt("MysqlServerConnections")
+	commandCounts = stats.NewCounters("MysqlServerCommandCounts")
+
+	errnoRegexp = regexp.MustCompile(`\(errno (\d+)\)`)
+
+	// handshakeTimeout is how long clients have to authenticate.
+	handshakeTimeout = 10 * time.Second
+)
+
+// Executor runs the queries of the clients, it's implemented by
+// vtgate.VTGate.
+type Executor interface {
+	ExecuteShard(context context.Context, query *proto.QueryShard, reply *proto.QueryResult) error
+	ExecuteKeyRanges(context context.Context, query *proto.KeyRangeQuery, reply *proto.QueryResult) error
+	Begin(context context.Context, outSession *proto.Session) error
+	Commit(context context.Context, inSession *proto.Session) error
+	Rollback(context context.Context, inSession *proto.Session) error
+}
+
+// Server accepts the connections of MySQL clients, and runs their
+// queries with an Executor.
+type Server struct {
+	executor Executor
+	user     string
+	password string
+
+	listener net.Listener
+	nextID   sync2.AtomicUint32
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a Server running the queries with executor.
+// Clients have to authenticate as user, with password.
+func NewServer(executor Executor, user, password string) *Server {
+	return &Server{
+		executor: executor,
+		user:     user,
+		password: password,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// ListenAndServe listens on port, and serves clients until Close.
+func (s *Server) ListenAndServe(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	log.Infof("mysql server listening on port %v", port)
+	return s.Serve(l)
+}
+
+// Serve serves the clients connecting to l, until Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.listener == nil
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops listening, closes the connections of the clients,
+// and waits for their transactions to be rolled back.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// clientContext is the context of the queries of a client.
+type clientContext struct {
+	remoteAddr string
+	username   string
+}
+
+func (cc *clientContext) GetRemoteAddr() string { return cc.remoteAddr }
+func (cc *clientContext) GetUsername() string   { return cc.username }
+func (cc *clientContext) HTML() template.HTML {
+	return template.HTML(template.HTMLEscapeString(cc.String()))
+}
+func (cc *clientContext) String() string {
+	return fmt.Sprintf("mysql client %v@%v", cc.username, cc.remoteAddr)
+}
+
+// clientConn is the state of a client connection.
+type clientConn struct {
+	server  *Server
+	pc      *mysqlconn.Conn
+	context *clientContext
+
+	// The target of the queries.
+	keyspace   string
+	shard      string
+	tabletType topo.TabletType
+
+	session *proto.Session
+	// autocommit is false after SET AUTOCOMMIT=0.
+	autocommit bool
+
+	stmts      map[uint32]*preparedStmt
+	nextStmtID uint32
+}
+
+// preparedStmt is a prepared statement, whose params were replaced
+// by the bind variables v1, v2...
+type preparedStmt struct {
+	*mysqlconn.Stmt
+	sql string
+}
+
+// handle serves the client connected on conn.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	connCount.Add(1)
+	defer connCount.Add(-1)
+
+	c := &clientConn{
+		server:     s,
+		pc:         mysqlconn.NewConn(conn),
+		context:    &clientContext{remoteAddr: conn.RemoteAddr().String()},
+		tabletType: topo.TYPE_MASTER,
+		session:    &proto.Session{ReadAfterWrite: *readAfterWrite},
+		autocommit: true,
+		stmts:      make(map[uint32]*preparedStmt),
+	}
+	// Until they're authenticated, clients can't hold the connection
+	// or send large packets.
+	c.pc.MaxPayload = mysqlconn.MaxHandshakeSize
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	if err := s.authenticate(c); err != nil {
+		log.Warningf("mysql server: %v", err)
+		return
+	}
+	c.pc.MaxPayload = 0
+	conn.SetReadDeadline(time.Time{})
+	defer c.rollbackOnClose()
+
+	for {
+		c.pc.Sequence = 0
+		data, err := c.pc.ReadPacket()
+		if err != nil || len(data) == 0 {
+			return
+		}
+		command, arg := data[0], data[1:]
+		switch command {
+		case mysqlconn.COM_QUIT:
+			return
+		case mysqlconn.COM_PING:
+			err = c.pc.WriteOK(0, 0)
+		case mysqlconn.COM_INIT_DB:
+			err = c.useDatabase(string(arg))
+		case mysqlconn.COM_QUERY:
+			commandCounts.Add("Query", 1)
+			err = c.query(string(arg))
+		case mysqlconn.COM_STMT_PREPARE:
+			commandCounts.Add("Prepare", 1)
+			err = c.prepare(string(arg))
+		case mysqlconn.COM_STMT_EXECUTE:
+			commandCounts.Add("Execute", 1)
+			err = c.executeStmt(arg)
+		case mysqlconn.COM_STMT_SEND_LONG_DATA:
+			// There's no reply, the errors are reported by the
+			// execution.
+			c.sendLongData(arg)
+		case mysqlconn.COM_STMT_CLOSE:
+			// There's no reply either.
+			if id, err := mysqlconn.StmtID(arg); err == nil {
+				delete(c.stmts, id)
+			}
+		case mysqlconn.COM_STMT_RESET:
+			err = c.resetStmt(arg)
+		default:
+			err = c.pc.WriteError(mysqlconn.ER_UNKNOWN_COM_ERROR, "unsupported command: %#x", command)
+		}
+		if err != nil {
+			log.Warningf("mysql server: can't reply to %v: %v", c.context.remoteAddr, err)
+			return
+		}
+	}
+}
+
+// authenticate runs the handshake of the client, checks its
+// credentials, and selects its database.
+func (s *Server) authenticate(c *clientConn) error {
+	salt, err := mysqlconn.NewSalt()
+	if err != nil {
+		return err
+	}
+	if err := c.pc.WritePacket(mysqlconn.HandshakePacket(serverVersion, s.nextID.Add(1), salt)); err != nil {
+		return fmt.Errorf("can't send handshake to %v: %v", c.context.remoteAddr, err)
+	}
+	data, err := c.pc.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("can't read handshake response of %v: %v", c.context.remoteAddr, err)
+	}
+	resp, err := mysqlconn.ParseHandshakeResponse(data)
+	if err != nil {
+		c.pc.WriteError(mysqlconn.ER_UNKNOWN_ERROR, "%v", err)
+		return fmt.Errorf("bad handshake response from %v: %v", c.context.remoteAddr, err)
+	}
+	if resp.User != s.user || !bytes.Equal(resp.AuthResponse, mysqlconn.ScramblePassword(salt, s.password)) {
+		c.pc.WriteError(mysqlconn.ER_ACCESS_DENIED_ERROR, "Access denied for user '%v'", resp.User)
+		return fmt.Errorf("access denied for user %v from %v", resp.User, c.context.remoteAddr)
+	}
+	c.context.username = resp.User
+	if resp.Database != "" {
+		if err := c.setTarget(resp.Database); err != nil {
+			c.pc.WriteError(mysqlconn.ER_BAD_DB_ERROR, "%v", err)
+			return fmt.Errorf("bad database from %v: %v", c.context.remoteAddr, err)
+		}
+	}
+	return c.pc.WriteOK(0, 0)
+}
+
+// setTarget parses a database name, keyspace[:shard][@tablet_type],
+// and makes it the target of the queries.
+func (c *clientConn) setTarget(database string) error {
+	keyspace, tabletType := database, topo.TYPE_MASTER
+	if i := strings.IndexByte(database, '@'); i >= 0 {
+		keyspace, tabletType = database[:i], topo.TabletType(database[i+1:])
+		if !topo.IsInServingGraph(tabletType) {
+			return fmt.Errorf("Unknown database '%v': invalid tablet type %v", database, tabletType)
+		}
+	}
+	shard := ""
+	if i := strings.IndexByte(keyspace, ':'); i >= 0 {
+		keyspace, shard = keyspace[:i], keyspace[i+1:]
+		if shard == "" {
+			return fmt.Errorf("Unknown database '%v': empty shard", database)
+		}
+	}
+	if keyspace == "" {
+		return fmt.Errorf("Unknown database '%v': empty keyspace", database)
+	}
+	c.keyspace, c.shard, c.tabletType = keyspace, shard, tabletType
+	return nil
+}
+
+// useDatabase changes the target of the queries, for COM_INIT_DB
+// and USE.
+func (c *clientConn) useDatabase(database string) error {
+	if err := c.setTarget(strings.Trim(database, "`")); err != nil {
+		return c.pc.WriteError(mysqlconn.ER_BAD_DB_ERROR, "%v", err)
+	}
+	return c.pc.WriteOK(0, 0)
+}
+
+// Kinds of statements.
+const (
+	stmtOther = iota
+	stmtBegin
+	stmtCommit
+	stmtRollback
+	stmtUse
+	stmtSet
+	stmtShow
+)
+
+// classify returns the kind of statement of sql, and the database of
+// USE statements.
+func classify(sql string) (int, string) {
+	words := strings.Fields(strings.TrimRight(strings.TrimSpace(sql), "; \t\n"))
+	if len(words) == 0 {
+		return stmtOther, ""
+	}
+	switch strings.ToLower(strings.Join(words, " ")) {
+	case "begin", "begin work", "start transaction":
+		return stmtBegin, ""
+	case "commit", "commit work":
+		return stmtCommit, ""
+	case "rollback", "rollback work":
+		return stmtRollback, ""
+	}
+	switch strings.ToLower(words[0]) {
+	case "use":
+		if len(words) == 2 {
+			return stmtUse, words[1]
+		}
+	case "set":
+		return stmtSet, ""
+	case "show":
+		return stmtShow, ""
+	}
+	return stmtOther, ""
+}
+
+// query runs a COM_QUERY, and sends back its result.
+func (c *clientConn) query(sql string) error {
+	kind, database := classify(sql)
+	var err error
+	switch kind {
+	case stmtUse:
+		return c.useDatabase(database)
+	case stmtSet:
+		err = c.set(sql)
+	case stmtBegin:
+		err = c.begin()
+	case stmtCommit:
+		err = c.commit()
+	case stmtRollback:
+		err = c.rollback()
+	default:
+		var qr *mproto.QueryResult
+		if qr, err = c.execute(sql, nil, kind == stmtShow); err == nil {
+			return c.pc.WriteResult(qr)
+		}
+	}
+	if err != nil {
+		return c.writeError(err)
+	}
+	return c.pc.WriteOK(0, 0)
+}
+
+// execute runs a query on the target of the connection, in its
+// transaction if there's one. Without autocommit, it starts one
+// first. If oneShard is set and the target is a keyspace, the query
+// only goes to its first shard.
+func (c *clientConn) execute(sql string, bindVariables map[string]interface{}, oneShard bool) (*mproto.QueryResult, error) {
+	if c.keyspace == "" {
+		return nil, &clientError{mysqlconn.ER_NO_DB_ERROR, "No database selected"}
+	}
+	if !c.autocommit && !c.session.InTransaction {
+		if err := c.begin(); err != nil {
+			return nil, err
+		}
+	}
+	keyRange := key.KeyRange{}
+	if oneShard {
+		// The first shard is the one holding the smallest keyspace id.
+		keyRange.End = key.KeyspaceId("\x00")
+	}
+	reply := new(proto.QueryResult)
+	var err error
+	if c.shard != "" {
+		err = c.server.executor.ExecuteShard(c.context, &proto.QueryShard{
+			Sql:           sql,
+			BindVariables: bindVariables,
+			Keyspace:      c.keyspace,
+			Shards:        []string{c.shard},
+			TabletType:    c.tabletType,
+			Session:       c.session,
+		}, reply)
+	} else {
+		err = c.server.executor.ExecuteKeyRanges(c.context, &proto.KeyRangeQuery{
+			Sql:           sql,
+			BindVariables: bindVariables,
+			Keyspace:      c.keyspace,
+			KeyRanges:     []key.KeyRange{keyRange},
+			TabletType:    c.tabletType,
+			Session:       c.session,
+		}, reply)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reply.Session != nil {
+		c.session = reply.Session
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%v", reply.Error)
+	}
+	return reply.Result, nil
+}
+
+// begin starts a transaction. Like mysqld, it commits the current
+// one first.
+func (c *clientConn) begin() error {
+	if c.session.InTransaction {
+		if err := c.commit(); err != nil {
+			return err
+		}
+	}
+	err := c.server.executor.Begin(c.context, c.session)
+	c.updateStatus()
+	return err
+}
+
+func (c *clientConn) commit() error {
+	if !c.session.InTransaction {
+		return nil
+	}
+	err := c.server.executor.Commit(c.context, c.session)
+	c.endTransaction()
+	c.updateStatus()
+	return err
+}
+
+func (c *clientConn) rollback() error {
+	if !c.session.InTransaction {
+		return nil
+	}
+	err := c.server.executor.Rollback(c.context, c.session)
+	c.endTransaction()
+	c.updateStatus()
+	return err
+}
+
+// endTransaction starts a new session, which keeps the positions
+// of read-after-write.
+func (c *clientConn) endTransaction() {
+	c.session = &proto.Session{
+		ReadAfterWrite: c.session.ReadAfterWrite,
+		ShardPositions: c.session.ShardPositions,
+	}
+}
+
+// rollbackOnClose rolls back the transaction left open by a client.
+func (c *clientConn) rollbackOnClose() {
+	if err := c.rollback(); err != nil {
+		log.Warningf("mysql server: can't roll back the transaction of %v: %v", c.context.remoteAddr, err)
+	}
+}
+
+// updateStatus announces the transactions and the autocommit mode
+// in the replies.
+func (c *clientConn) updateStatus() {
+	if c.session.InTransaction {
+		c.pc.Status |= mysqlconn.SERVER_STATUS_IN_TRANS
+	} else {
+		c.pc.Status &^= mysqlconn.SERVER_STATUS_IN_TRANS
+	}
+	if c.autocommit {
+		c.pc.Status |= mysqlconn.SERVER_STATUS_AUTOCOMMIT
+	} else {
+		c.pc.Status &^= mysqlconn.SERVER_STATUS_AUTOCOMMIT
+	}
+}
+
+// set runs a SET statement. Only the session autocommit is emulated,
+// the other variables, and the statements that can't be parsed, are
+// ignored. Like mysqld, turning autocommit on commits the current
+// transaction.
+func (c *clientConn) set(sql string) error {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil
+	}
+	set, ok := stmt.(*sqlparser.Set)
+	if !ok || set.Scope == sqlparser.AST_GLOBAL || set.IsCharset() {
+		return nil
+	}
+	for _, expr := range set.Exprs {
+		if !isAutocommit(expr.Name) {
+			continue
+		}
+		on, ok := boolValue(expr.Expr)
+		if !ok {
+			return &clientError{mysqlconn.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("Variable 'autocommit' can't be set to the value of '%v'", sqlparser.String(expr.Expr))}
+		}
+		if on && !c.autocommit {
+			if err := c.commit(); err != nil {
+				return err
+			}
+		}
+		c.autocommit = on
+	}
+	c.updateStatus()
+	return nil
+}
+
+// isAutocommit returns true if name is the session autocommit:
+// autocommit, @@autocommit, @@session.autocommit or
+// @@local.autocommit.
+func isAutocommit(name *sqlparser.ColName) bool {
+	switch strings.ToLower(string(name.Qualifier)) {
+	case "":
+		n := strings.ToLower(string(name.Name))
+		return n == "autocommit" || n == "@@autocommit"
+	case "@@session", "@@local":
+		return strings.ToLower(string(name.Name)) == "autocommit"
+	}
+	return false
+}
+
+// boolValue returns the value of a boolean variable: 1, 0, on, off,
+// true or false.
+func boolValue(expr sqlparser.ValExpr) (value bool, ok bool) {
+	var s string
+	switch expr := expr.(type) {
+	case sqlparser.NumVal:
+		s = string(expr)
+	case sqlparser.StrVal:
+		s = string(expr)
+	case *sqlparser.ColName:
+		if expr.Qualifier != nil {
+			return false, false
+		}
+		s = string(expr.Name)
+	default:
+		return false, false
+	}
+	switch strings.ToLower(s) {
+	case "1", "on", "true":
+		return true, true
+	case "0", "off", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// prepare runs a COM_STMT_PREPARE. The query isn't checked until it's
+// executed.
+func (c *clientConn) prepare(sql string) error {
+	sql, numParams := mysqlconn.ReplaceParams(sql, func(i int) string {
+		return fmt.Sprintf(":v%d", i+1)
+	})
+	c.nextStmtID++
+	stmt := &preparedStmt{
+		Stmt: &mysqlconn.Stmt{ID: c.nextStmtID, NumParams: numParams},
+		sql:  sql,
+	}
+	c.stmts[stmt.ID] = stmt
+	return c.pc.WritePrepareOK(stmt.Stmt)
+}
+
+// findStmt returns the prepared statement of a statement command.
+func (c *clientConn) findStmt(arg []byte) (*preparedStmt, error) {
+	id, err := mysqlconn.StmtID(arg)
+	if err != nil {
+		return nil, err
+	}
+	stmt, ok := c.stmts[id]
+	if !ok {
+		return nil, &clientError{mysqlconn.ER_UNKNOWN_STMT_HANDLER, fmt.Sprintf("Unknown prepared statement handler (%v) given to mysqld_stmt_execute", id)}
+	}
+	return stmt, nil
+}
+
+// executeStmt runs a COM_STMT_EXECUTE, and sends back its result as a
+// binary resultset.
+func (c *clientConn) executeStmt(arg []byte) error {
+	stmt, err := c.findStmt(arg)
+	if err != nil {
+		return c.writeError(err)
+	}
+	values, err := stmt.ParseExecute(arg)
+	if err != nil {
+		return c.writeError(err)
+	}
+	var bindVariables map[string]interface{}
+	if len(values) > 0 {
+		bindVariables = make(map[string]interface{}, len(values))
+		for i, value := range values {
+			bindVariables[fmt.Sprintf("v%d", i+1)] = value
+		}
+	}
+	qr, err := c.execute(stmt.sql, bindVariables, false)
+	if err != nil {
+		return c.writeError(err)
+	}
+	return c.pc.WriteBinaryResult(qr)
+}
+
+func (c *clientConn) sendLongData(arg []byte) {
+	stmt, err := c.findStmt(arg)
+	if err == nil {
+		err = stmt.AppendLongData(arg)
+	}
+	if err != nil {
+		log.Warningf("mysql server: bad COM_STMT_SEND_LONG_DATA from %v: %v", c.context.remoteAddr, err)
+	}
+}
+
+func (c *clientConn) resetStmt(arg []byte) error {
+	stmt, err := c.findStmt(arg)
+	if err != nil {
+		return c.writeError(err)
+	}
+	stmt.Reset()
+	return c.pc.WriteOK(0, 0)
+}
+
+// clientError is an error with its MySQL error number.
+type clientError struct {
+	num     int
+	message string
+}
+
+func (e *clientError) Error() string {
+	return e.message
+}
+
+// writeError sends err to the client. Its error number is the one of
+// mysqld if it comes from there.
+func (c *clientConn) writeError(err error) error {
+	num := mysqlconn.ER_UNKNOWN_ERROR
+	if ce, ok := err.(*clientError); ok {
+		num = ce.num
+	} else if m := errnoRegexp.FindStringSubmatch(err.Error()); m != nil {
+		num, _ = strconv.Atoi(m[1])
+	}
+	return c.pc.WriteError(num, "%v", err)
+}
+
+func init() {
+	vtgate.RegisterVTGates = append(vtgate.RegisterVTGates, func(vtGate *vtgate.VTGate) {
+		if *port == 0 {
+			return
+		}
+		if *password == "" {
+			log.Fatalf("-mysql_server_password is required with -mysql_server_port")
+		}
+		server := NewServer(vtGate, *user, *password)
+		go func() {
+			if err := server.ListenAndServe(*port); err != nil {
+				log.Fatalf("mysql server failed: %v", err)
+			}
+		}()
+		servenv.OnTerm(server.Close)
+	})
+}
@@ -0,0 +1,483 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mysqlserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/mysql/mysqlconn"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// fakeExecutor records the queries, and answers them with a single
+// row, or with an error for the queries containing "bad".
+type fakeExecutor struct {
+	queries   chan interface{}
+	commits   chan *proto.Session
+	rollbacks chan *proto.Session
+}
+
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{
+		queries:   make(chan interface{}, 10),
+		commits:   make(chan *proto.Session, 10),
+		rollbacks: make(chan *proto.Session, 10),
+	}
+}
+
+func (fe *fakeExecutor) reply(sql string, session *proto.Session, reply *proto.QueryResult) {
+	reply.Session = session
+	if bytes.Contains([]byte(sql), []byte("bad")) {
+		reply.Error = "bad query (errno 1064)"
+		return
+	}
+	if session.InTransaction {
+		session.ShardSessions = append(session.ShardSessions, &proto.ShardSession{Keyspace: "ks", Shard: "0", TransactionId: 1})
+	}
+	reply.Result = &mproto.QueryResult{
+		Fields: []mproto.Field{{Name: "id", Type: mproto.VT_LONGLONG}},
+		Rows:   [][]sqltypes.Value{{sqltypes.MakeNumeric([]byte("42"))}},
+	}
+}
+
+func (fe *fakeExecutor) ExecuteShard(context context.Context, query *proto.QueryShard, reply *proto.QueryResult) error {
+	fe.queries <- query
+	fe.reply(query.Sql, query.Session, reply)
+	return nil
+}
+
+func (fe *fakeExecutor) ExecuteKeyRanges(context context.Context, query *proto.KeyRangeQuery, reply *proto.QueryResult) error {
+	fe.queries <- query
+	fe.reply(query.Sql, query.Session, reply)
+	return nil
+}
+
+func (fe *fakeExecutor) Begin(context context.Context, outSession *proto.Session) error {
+	outSession.InTransaction = true
+	return nil
+}
+
+func (fe *fakeExecutor) Commit(context context.Context, inSession *proto.Session) error {
+	fe.commits <- inSession
+	return nil
+}
+
+func (fe *fakeExecutor) Rollback(context context.Context, inSession *proto.Session) error {
+	fe.rollbacks <- inSession
+	return nil
+}
+
+// startServer serves fe on a local port, and returns a client connection.
+func startServer(t *testing.T, fe *fakeExecutor) (*Server, *mysqlconn.Conn) {
+	s := NewServer(fe, "vt_app", "secret")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go s.Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	return s, mysqlconn.NewConn(conn)
+}
+
+// login reads the handshake of the server, and replies with the
+// credentials of user and the database. It returns the reply of the
+// server.
+func login(t *testing.T, pc *mysqlconn.Conn, user, password, database string) []byte {
+	data, err := pc.ReadPacket()
+	if err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	version, rest, _ := mysqlconn.ReadNulString(data[1:])
+	if version != serverVersion {
+		t.Errorf("server version = %v, want %v", version, serverVersion)
+	}
+	salt := append(append([]byte(nil), rest[4:12]...), rest[31:43]...)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(mysqlconn.CLIENT_PROTOCOL_41|mysqlconn.CLIENT_SECURE_CONNECTION|mysqlconn.CLIENT_CONNECT_WITH_DB))
+	binary.Write(&buf, binary.LittleEndian, uint32(1<<24))
+	buf.WriteByte(mysqlconn.CharsetUTF8)
+	buf.Write(make([]byte, 23))
+	buf.WriteString(user)
+	buf.WriteByte(0)
+	scramble := mysqlconn.ScramblePassword(salt, password)
+	buf.WriteByte(byte(len(scramble)))
+	buf.Write(scramble)
+	buf.WriteString(database)
+	buf.WriteByte(0)
+	if err := pc.WritePacket(buf.Bytes()); err != nil {
+		t.Fatalf("can't send handshake response: %v", err)
+	}
+	reply, err := pc.ReadPacket()
+	if err != nil {
+		t.Fatalf("can't read handshake reply: %v", err)
+	}
+	return reply
+}
+
+// command sends a command, and returns the packets of the reply: one
+// packet for OK and ERR, all of them for resultsets.
+func command(t *testing.T, pc *mysqlconn.Conn, command byte, arg []byte) [][]byte {
+	pc.Sequence = 0
+	if err := pc.WritePacket(append([]byte{command}, arg...)); err != nil {
+		t.Fatalf("can't send command %#x: %v", command, err)
+	}
+	var packets [][]byte
+	eofs := 0
+	for {
+		p, err := pc.ReadPacket()
+		if err != nil {
+			t.Fatalf("can't read reply of command %#x: %v", command, err)
+		}
+		packets = append(packets, p)
+		if len(packets) == 1 && (p[0] == 0x00 || p[0] == 0xff) {
+			return packets
+		}
+		if p[0] == 0xfe && len(p) < 9 {
+			if eofs++; eofs == 2 {
+				return packets
+			}
+		}
+	}
+}
+
+// errorNumber returns the error number of an ERR packet, or 0.
+func errorNumber(packet []byte) int {
+	if packet[0] != 0xff {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(packet[1:3]))
+}
+
+// okStatus returns the status flags of an OK packet.
+func okStatus(t *testing.T, packet []byte) uint16 {
+	if packet[0] != 0x00 {
+		t.Fatalf("got %v, want OK", packet)
+	}
+	return binary.LittleEndian.Uint16(packet[3:5])
+}
+
+func TestAccessDenied(t *testing.T) {
+	s, pc := startServer(t, newFakeExecutor())
+	defer s.Close()
+	if reply := login(t, pc, "vt_app", "wrong", ""); errorNumber(reply) != mysqlconn.ER_ACCESS_DENIED_ERROR {
+		t.Errorf("login with a wrong password: got %v, want an access denied error", reply)
+	}
+}
+
+func TestHandshakeLimits(t *testing.T) {
+	s, pc := startServer(t, newFakeExecutor())
+	defer s.Close()
+
+	// a handshake response larger than the limit is refused
+	if _, err := pc.ReadPacket(); err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	if err := pc.WritePacket(make([]byte, mysqlconn.MaxHandshakeSize+1)); err != nil {
+		t.Fatalf("can't send handshake response: %v", err)
+	}
+	if _, err := pc.ReadPacket(); err == nil {
+		t.Errorf("connection still open after a handshake response of %v bytes", mysqlconn.MaxHandshakeSize+1)
+	}
+
+	// a client that doesn't authenticate in time is disconnected
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 10 * time.Millisecond
+	s, pc = startServer(t, newFakeExecutor())
+	defer s.Close()
+	if _, err := pc.ReadPacket(); err != nil {
+		t.Fatalf("can't read handshake: %v", err)
+	}
+	if _, err := pc.ReadPacket(); err == nil {
+		t.Errorf("connection still open after the handshake timeout")
+	}
+}
+
+func TestBadDatabase(t *testing.T) {
+	s, pc := startServer(t, newFakeExecutor())
+	defer s.Close()
+	if reply := login(t, pc, "vt_app", "secret", "ks@nosuchtype"); errorNumber(reply) != mysqlconn.ER_BAD_DB_ERROR {
+		t.Errorf("login with a bad database: got %v, want a bad database error", reply)
+	}
+}
+
+func TestSetTarget(t *testing.T) {
+	testcases := []struct {
+		database, keyspace, shard string
+		tabletType                topo.TabletType
+	}{
+		{"ks", "ks", "", topo.TYPE_MASTER},
+		{"ks:-80", "ks", "-80", topo.TYPE_MASTER},
+		{"ks@replica", "ks", "", topo.TYPE_REPLICA},
+		{"ks:0@rdonly", "ks", "0", topo.TYPE_RDONLY},
+	}
+	for _, tc := range testcases {
+		c := &clientConn{}
+		if err := c.setTarget(tc.database); err != nil {
+			t.Errorf("setTarget(%v): %v", tc.database, err)
+			continue
+		}
+		if c.keyspace != tc.keyspace || c.shard != tc.shard || c.tabletType != tc.tabletType {
+			t.Errorf("setTarget(%v) = %v, %v, %v", tc.database, c.keyspace, c.shard, c.tabletType)
+		}
+	}
+	for _, database := range []string{"", ":0", "ks:", "ks@spare"} {
+		if err := (&clientConn{}).setTarget(database); err == nil {
+			t.Errorf("setTarget(%v) succeeded", database)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	testcases := []struct {
+		sql      string
+		kind     int
+		database string
+	}{
+		{"BEGIN", stmtBegin, ""},
+		{" start  transaction; ", stmtBegin, ""},
+		{"commit", stmtCommit, ""},
+		{"ROLLBACK WORK", stmtRollback, ""},
+		{"use ks:0", stmtUse, "ks:0"},
+		{"SET NAMES utf8", stmtSet, ""},
+		{"show tables", stmtShow, ""},
+		{"select * from t", stmtOther, ""},
+		{"rollback to savepoint a", stmtOther, ""},
+	}
+	for _, tc := range testcases {
+		kind, database := classify(tc.sql)
+		if kind != tc.kind || database != tc.database {
+			t.Errorf("classify(%q) = %v, %v, want %v, %v", tc.sql, kind, database, tc.kind, tc.database)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	fe := newFakeExecutor()
+	s, pc := startServer(t, fe)
+	defer s.Close()
+	if reply := login(t, pc, "vt_app", "secret", ""); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("select id from t")); errorNumber(reply[0]) != mysqlconn.ER_NO_DB_ERROR {
+		t.Errorf("query without a database: got %v, want a no database error", reply)
+	}
+
+	// Without a shard, the queries go to the whole keyspace.
+	if reply := command(t, pc, mysqlconn.COM_INIT_DB, []byte("ks@replica")); reply[0][0] != 0x00 {
+		t.Fatalf("COM_INIT_DB: got %v, want OK", reply)
+	}
+	reply := command(t, pc, mysqlconn.COM_QUERY, []byte("select id from t"))
+	if len(reply) != 5 || !reflect.DeepEqual(reply[0], []byte{1}) || !bytes.Equal(reply[3], []byte("\x0242")) {
+		t.Errorf("resultset = %q", reply)
+	}
+	query, ok := (<-fe.queries).(*proto.KeyRangeQuery)
+	if !ok || query.Keyspace != "ks" || query.TabletType != topo.TYPE_REPLICA || len(query.KeyRanges) != 1 || query.KeyRanges[0].IsPartial() {
+		t.Errorf("query = %#v, want a query on the keyspace", query)
+	}
+
+	// The SHOW statements only go to the first shard.
+	command(t, pc, mysqlconn.COM_QUERY, []byte("show tables"))
+	if query, ok := (<-fe.queries).(*proto.KeyRangeQuery); !ok || len(query.KeyRanges) != 1 || !query.KeyRanges[0].IsPartial() || query.KeyRanges[0].Start != "" {
+		t.Errorf("query = %#v, want a query on the first shard", query)
+	}
+
+	// With a shard, they go to the shard.
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("use `ks:-80`")); reply[0][0] != 0x00 {
+		t.Fatalf("use: got %v, want OK", reply)
+	}
+	command(t, pc, mysqlconn.COM_QUERY, []byte("select id from t"))
+	if query, ok := (<-fe.queries).(*proto.QueryShard); !ok || query.Keyspace != "ks" || !reflect.DeepEqual(query.Shards, []string{"-80"}) || query.TabletType != topo.TYPE_MASTER {
+		t.Errorf("query = %#v, want a query on the shard", query)
+	}
+
+	// The errors of mysqld keep their number.
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("select bad")); errorNumber(reply[0]) != 1064 {
+		t.Errorf("bad query: got %q, want error 1064", reply)
+	}
+	<-fe.queries
+
+	// The SET statements other than autocommit are ignored.
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("set names utf8")); reply[0][0] != 0x00 {
+		t.Errorf("set: got %v, want OK", reply)
+	}
+	if reply := command(t, pc, 0x1b, nil); errorNumber(reply[0]) != mysqlconn.ER_UNKNOWN_COM_ERROR {
+		t.Errorf("unsupported command: got %v, want an unknown command error", reply)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	fe := newFakeExecutor()
+	s, pc := startServer(t, fe)
+	if reply := login(t, pc, "vt_app", "secret", "ks:0"); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+
+	reply := command(t, pc, mysqlconn.COM_QUERY, []byte("begin"))
+	if okStatus(t, reply[0])&mysqlconn.SERVER_STATUS_IN_TRANS == 0 {
+		t.Errorf("begin: status not in transaction")
+	}
+	command(t, pc, mysqlconn.COM_QUERY, []byte("insert into t values (1)"))
+	if query := (<-fe.queries).(*proto.QueryShard); !query.Session.InTransaction {
+		t.Errorf("query not in the transaction: %v", query.Session)
+	}
+	reply = command(t, pc, mysqlconn.COM_QUERY, []byte("commit"))
+	if okStatus(t, reply[0])&mysqlconn.SERVER_STATUS_IN_TRANS != 0 {
+		t.Errorf("commit: status still in transaction")
+	}
+	if session := <-fe.commits; len(session.ShardSessions) != 1 {
+		t.Errorf("committed session = %v, want the shard session of the insert", session)
+	}
+
+	// The transactions left open are rolled back.
+	command(t, pc, mysqlconn.COM_QUERY, []byte("begin"))
+	command(t, pc, mysqlconn.COM_QUERY, []byte("insert into t values (2)"))
+	<-fe.queries
+	s.Close()
+	if session := <-fe.rollbacks; len(session.ShardSessions) != 1 {
+		t.Errorf("rolled back session = %v, want the shard session of the insert", session)
+	}
+}
+
+func TestAutocommit(t *testing.T) {
+	fe := newFakeExecutor()
+	s, pc := startServer(t, fe)
+	defer s.Close()
+	if reply := login(t, pc, "vt_app", "secret", "ks:0"); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+
+	reply := command(t, pc, mysqlconn.COM_QUERY, []byte("set autocommit = 0"))
+	if okStatus(t, reply[0])&mysqlconn.SERVER_STATUS_AUTOCOMMIT != 0 {
+		t.Errorf("set autocommit = 0: status still in autocommit")
+	}
+	// The queries start a transaction, and stay in it.
+	for _, sql := range []string{"insert into t values (1)", "insert into t values (2)"} {
+		command(t, pc, mysqlconn.COM_QUERY, []byte(sql))
+		if query := (<-fe.queries).(*proto.QueryShard); !query.Session.InTransaction {
+			t.Errorf("%v: query not in a transaction", sql)
+		}
+	}
+	command(t, pc, mysqlconn.COM_QUERY, []byte("commit"))
+	if session := <-fe.commits; len(session.ShardSessions) != 2 {
+		t.Errorf("committed session = %v, want the shard sessions of the inserts", session)
+	}
+
+	// Turning autocommit back on commits the current transaction.
+	command(t, pc, mysqlconn.COM_QUERY, []byte("insert into t values (3)"))
+	<-fe.queries
+	reply = command(t, pc, mysqlconn.COM_QUERY, []byte("SET @@session.autocommit = ON"))
+	if status := okStatus(t, reply[0]); status&mysqlconn.SERVER_STATUS_AUTOCOMMIT == 0 || status&mysqlconn.SERVER_STATUS_IN_TRANS != 0 {
+		t.Errorf("set autocommit = on: status %#x, want autocommit", status)
+	}
+	if session := <-fe.commits; len(session.ShardSessions) != 1 {
+		t.Errorf("committed session = %v, want the shard session of the insert", session)
+	}
+	command(t, pc, mysqlconn.COM_QUERY, []byte("insert into t values (4)"))
+	if query := (<-fe.queries).(*proto.QueryShard); query.Session.InTransaction {
+		t.Errorf("query in a transaction with autocommit")
+	}
+
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("set autocommit = 2")); errorNumber(reply[0]) != mysqlconn.ER_WRONG_VALUE_FOR_VAR {
+		t.Errorf("set autocommit = 2: got %v, want a wrong value error", reply)
+	}
+	if reply := command(t, pc, mysqlconn.COM_QUERY, []byte("set global autocommit = 0")); okStatus(t, reply[0])&mysqlconn.SERVER_STATUS_AUTOCOMMIT == 0 {
+		t.Errorf("set global autocommit = 0: status not in autocommit")
+	}
+}
+
+func TestBoolValue(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"1", true, false},
+		{"0", false, false},
+		{"ON", true, false},
+		{"off", false, false},
+		{"TRUE", true, false},
+		{"false", false, false},
+		{"'true'", true, false},
+		{"2", false, true},
+		{"yes", false, true},
+		{"a.true", false, true},
+	}
+	for _, tcase := range cases {
+		sql := "set autocommit = " + tcase.value
+		stmt, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatalf("Parse(%v) failed: %v", sql, err)
+		}
+		got, ok := boolValue(stmt.(*sqlparser.Set).Exprs[0].Expr)
+		if ok == tcase.wantErr || got != tcase.want {
+			t.Errorf("boolValue(%v) = %v, %v, want %v, %v", tcase.value, got, ok, tcase.want, !tcase.wantErr)
+		}
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	fe := newFakeExecutor()
+	s, pc := startServer(t, fe)
+	defer s.Close()
+	if reply := login(t, pc, "vt_app", "secret", "ks:0"); reply[0] != 0x00 {
+		t.Fatalf("login: got %v, want OK", reply)
+	}
+
+	// The reply has the definitions of the 2 params.
+	reply := command(t, pc, mysqlconn.COM_STMT_PREPARE, []byte("select id from t where a = ? and b = '?' and c = ?"))
+	if reply[0][0] != 0x00 || binary.LittleEndian.Uint16(reply[0][7:9]) != 2 {
+		t.Fatalf("COM_STMT_PREPARE: got %v, want OK with 2 params", reply[0])
+	}
+	stmtID := reply[0][1:5]
+	for i := 0; i < 3; i++ {
+		if _, err := pc.ReadPacket(); err != nil {
+			t.Fatalf("can't read param definitions: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(stmtID)
+	buf.Write([]byte{0, 1, 0, 0, 0}) // flags, iteration count
+	buf.WriteByte(0x02)              // the second param is NULL
+	buf.WriteByte(1)
+	buf.Write([]byte{mproto.VT_LONGLONG, 0, mproto.VT_NULL, 0})
+	binary.Write(&buf, binary.LittleEndian, int64(5))
+	reply = command(t, pc, mysqlconn.COM_STMT_EXECUTE, buf.Bytes())
+	row := append([]byte{0, 0}, 42, 0, 0, 0, 0, 0, 0, 0)
+	if len(reply) != 5 || !bytes.Equal(reply[3], row) {
+		t.Errorf("binary resultset = %v, want row %v", reply, row)
+	}
+	query := (<-fe.queries).(*proto.QueryShard)
+	if want := "select id from t where a = :v1 and b = '?' and c = :v2"; query.Sql != want {
+		t.Errorf("query = %v, want %v", query.Sql, want)
+	}
+	if want := map[string]interface{}{"v1": int64(5), "v2": nil}; !reflect.DeepEqual(query.BindVariables, want) {
+		t.Errorf("bind variables = %v, want %v", query.BindVariables, want)
+	}
+
+	// Closed statements can't be executed.
+	pc.Sequence = 0
+	if err := pc.WritePacket(append([]byte{mysqlconn.COM_STMT_CLOSE}, stmtID...)); err != nil {
+		t.Fatalf("can't send COM_STMT_CLOSE: %v", err)
+	}
+	if reply := command(t, pc, mysqlconn.COM_STMT_EXECUTE, buf.Bytes()); errorNumber(reply[0]) != mysqlconn.ER_UNKNOWN_STMT_HANDLER {
+		t.Errorf("execution of a closed statement: got %v, want an unknown statement error", reply)
+	}
+}
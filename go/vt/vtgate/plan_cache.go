@@ -0,0 +1,168 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+
+	"github.com/youtube/vitess/go/acl"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// This file contains the cache of the plans of the queries sent to
+// several shards, keyed by keyspace and query. With -normalize_queries,
+// the literals of the queries are replaced with bind variables first,
+// so the queries that only differ by their values share a plan, and
+// the tablets get the same query text.
+
+var (
+	planCacheSize    = flag.Int("plan_cache_size", 5000, "number of scatter query plans vtgate caches")
+	normalizeQueries = flag.Bool("normalize_queries", false, "replace the literals of the queries sent to several shards with bind variables, so the queries that only differ by their values share a plan")
+
+	planCacheCounts = stats.NewCounters("VtgatePlanCacheCounts")
+)
+
+// normalizedPrefix starts the names of the bind variables of the
+// normalized queries.
+const normalizedPrefix = "vtg"
+
+// cachedPlan is the plan of a query sent to several shards.
+type cachedPlan struct {
+	// query is the query to send to the shards if their results
+	// can just be concatenated.
+	query string
+
+	// ss is the plan to merge the results, nil if they can just
+	// be concatenated. It may not be bound yet.
+	ss *scatterSelect
+
+	// fingerprint is the hash of the fingerprint of the query, shared
+	// by the plans of the queries that only differ by their values.
+	fingerprint string
+}
+
+// Size is part of the cache.Value interface.
+func (*cachedPlan) Size() int {
+	return 1
+}
+
+// planScatter returns the plan of a query sent to several shards of
+// keyspace, with the query and the bind variables to send to them.
+func (stc *ScatterConn) planScatter(keyspace, sql string, bindVars map[string]interface{}) (*scatterSelect, string, map[string]interface{}, error) {
+	var statement sqlparser.Statement
+	var fingerprint string
+	parsed := false
+	if *normalizeQueries {
+		var err error
+		if statement, err = sqlparser.Parse(sql); err == nil {
+			normalized := make(map[string]interface{}, len(bindVars))
+			for k, v := range bindVars {
+				normalized[k] = v
+			}
+			fingerprint = sqlparser.NormalizeStatement(statement, normalized, normalizedPrefix)
+			sql, bindVars = sqlparser.String(statement), normalized
+		}
+		parsed = true
+	}
+
+	key := keyspace + ":" + sql
+	var plan *cachedPlan
+	if v, ok := stc.plans.Get(key); ok {
+		planCacheCounts.Add("Hit", 1)
+		plan = v.(*cachedPlan)
+	} else {
+		planCacheCounts.Add("Miss", 1)
+		if !parsed {
+			statement, _ = sqlparser.Parse(sql)
+		}
+		plan = &cachedPlan{query: sql}
+		if statement != nil {
+			if fingerprint == "" {
+				fingerprint = sqlparser.Fingerprint(statement)
+			}
+			plan.fingerprint = sqlparser.FingerprintHash(fingerprint)
+			var err error
+			if plan.ss, err = planScatterSelect(statement); err != nil {
+				return nil, "", nil, err
+			}
+		}
+		stc.plans.Set(key, plan)
+	}
+	if plan.ss == nil {
+		return nil, plan.query, bindVars, nil
+	}
+	ss, err := plan.ss.bind(bindVars)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return ss, ss.query, bindVars, nil
+}
+
+// EvictPlan evicts the plan of sql for keyspace. It returns false if
+// there was no such plan. sql must be normalized if the queries are.
+func (stc *ScatterConn) EvictPlan(keyspace, sql string) bool {
+	return stc.plans.Delete(keyspace + ":" + sql)
+}
+
+// ClearPlans empties the plan cache.
+func (stc *ScatterConn) ClearPlans() {
+	stc.plans.Clear()
+}
+
+// planStatus is the description of a plan served by /debug/vtgate_plans.
+type planStatus struct {
+	Key         string
+	Query       string
+	Fingerprint string
+	Merge       bool
+}
+
+// servePlans lists the cached plans.
+func (stc *ScatterConn) servePlans(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.DEBUGGING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	items := stc.plans.Items()
+	plans := make([]planStatus, 0, len(items))
+	for _, item := range items {
+		plan := item.Value.(*cachedPlan)
+		status := planStatus{Key: item.Key, Query: plan.query, Fingerprint: plan.fingerprint, Merge: plan.ss != nil}
+		if plan.ss != nil && plan.ss.query != "" {
+			status.Query = plan.ss.query
+		}
+		plans = append(plans, status)
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if b, err := json.MarshalIndent(plans, "", "  "); err != nil {
+		response.Write([]byte(err.Error()))
+	} else {
+		response.Write(b)
+	}
+}
+
+// serveEvictPlan evicts the plan of the keyspace and query passed as
+// parameters, or all plans if there's no query.
+func (stc *ScatterConn) serveEvictPlan(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.ADMIN); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	sql := request.FormValue("query")
+	if sql == "" {
+		stc.ClearPlans()
+		response.Write([]byte("Plan cache cleared\n"))
+		return
+	}
+	if !stc.EvictPlan(request.FormValue("keyspace"), sql) {
+		response.WriteHeader(http.StatusNotFound)
+		response.Write([]byte("Plan not found\n"))
+		return
+	}
+	response.Write([]byte("Plan evicted\n"))
+}
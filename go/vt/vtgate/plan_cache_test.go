@@ -0,0 +1,82 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+func TestScatterConnPlanCache(t *testing.T) {
+	s := createSandbox("TestScatterConnPlanCache")
+	fields := []mproto.Field{{"id", mproto.VT_LONGLONG}}
+	var conns []*queryConn
+	for _, shard := range []string{"0", "1"} {
+		qc := &queryConn{
+			sandboxConn: &sandboxConn{},
+			qr:          makeResult(fields, []string{"1"}, []string{"2"}),
+		}
+		s.MapTestConn(shard, qc)
+		conns = append(conns, qc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+	shards := []string{"0", "1"}
+
+	hits, misses := planCacheCounts.Counts()["Hit"], planCacheCounts.Counts()["Miss"]
+	for _, n := range []int64{1, 3} {
+		qr, err := stc.Execute(&context.DummyContext{}, "select id from t order by id limit :n", map[string]interface{}{"n": n}, "TestScatterConnPlanCache", shards, "", nil)
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		if int64(len(qr.Rows)) != n {
+			t.Errorf("Execute(limit %v): %v rows", n, len(qr.Rows))
+		}
+	}
+	if got := planCacheCounts.Counts()["Hit"] - hits; got != 1 {
+		t.Errorf("plan cache hits: %v, want 1", got)
+	}
+	if got := planCacheCounts.Counts()["Miss"] - misses; got != 1 {
+		t.Errorf("plan cache misses: %v, want 1", got)
+	}
+	// The limit is bound for each query.
+	if got := conns[0].queries; len(got) != 2 || got[0] != "select id from t order by id asc limit 1" || got[1] != "select id from t order by id asc limit 3" {
+		t.Errorf("shard queries: %v", got)
+	}
+
+	if !stc.EvictPlan("TestScatterConnPlanCache", "select id from t order by id limit :n") {
+		t.Errorf("EvictPlan: plan not found")
+	}
+	if stc.EvictPlan("TestScatterConnPlanCache", "select id from t order by id limit :n") {
+		t.Errorf("EvictPlan: plan still found")
+	}
+
+	*normalizeQueries = true
+	defer func() { *normalizeQueries = false }()
+	conns[0].queries = nil
+	for _, sql := range []string{"select id from t where name = 'a'", "select id from t where name = 'b'"} {
+		if _, err := stc.Execute(&context.DummyContext{}, sql, map[string]interface{}{"vtg1": 1}, "TestScatterConnPlanCache", shards, "", nil); err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+	}
+	if got := conns[0].queries; len(got) != 2 || got[0] != "select id from t where name = :vtg2" || got[1] != got[0] {
+		t.Errorf("normalized shard queries: %v", got)
+	}
+	if got := stc.plans.Keys(); len(got) != 1 || got[0] != "TestScatterConnPlanCache:select id from t where name = :vtg2" {
+		t.Errorf("plan cache keys: %v", got)
+	}
+	v, _ := stc.plans.Get("TestScatterConnPlanCache:select id from t where name = :vtg2")
+	if got, want := v.(*cachedPlan).fingerprint, sqlparser.FingerprintHash("select id from t where name = ?"); got != want {
+		t.Errorf("plan fingerprint: %v, want %v", got, want)
+	}
+
+	stc.ClearPlans()
+	if got := stc.plans.Length(); got != 0 {
+		t.Errorf("plan cache length after ClearPlans: %v", got)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+)
+
+// MarshalBson bson-encodes ColumnValuesQuery.
+func (columnValuesQuery *ColumnValuesQuery) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	bson.EncodeString(buf, "Sql", columnValuesQuery.Sql)
+	// map[string]interface{}
+	{
+		bson.EncodePrefix(buf, bson.Object, "BindVariables")
+		lenWriter := bson.NewLenWriter(buf)
+		for _k, _v1 := range columnValuesQuery.BindVariables {
+			bson.EncodeInterface(buf, _k, _v1)
+		}
+		lenWriter.Close()
+	}
+	bson.EncodeString(buf, "Table", columnValuesQuery.Table)
+	bson.EncodeString(buf, "ColumnName", columnValuesQuery.ColumnName)
+	// []interface{}
+	{
+		bson.EncodePrefix(buf, bson.Array, "ColumnValues")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v2 := range columnValuesQuery.ColumnValues {
+			bson.EncodeInterface(buf, bson.Itoa(_i), _v2)
+		}
+		lenWriter.Close()
+	}
+	columnValuesQuery.TabletType.MarshalBson(buf, "TabletType")
+	// *Session
+	if columnValuesQuery.Session == nil {
+		bson.EncodePrefix(buf, bson.Null, "Session")
+	} else {
+		(*columnValuesQuery.Session).MarshalBson(buf, "Session")
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into ColumnValuesQuery.
+func (columnValuesQuery *ColumnValuesQuery) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for ColumnValuesQuery", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Sql":
+			columnValuesQuery.Sql = bson.DecodeString(buf, kind)
+		case "BindVariables":
+			// map[string]interface{}
+			if kind != bson.Null {
+				if kind != bson.Object {
+					panic(bson.NewBsonError("unexpected kind %v for columnValuesQuery.BindVariables", kind))
+				}
+				bson.Next(buf, 4)
+				columnValuesQuery.BindVariables = make(map[string]interface{})
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					_k := bson.ReadCString(buf)
+					var _v1 interface{}
+					_v1 = bson.DecodeInterface(buf, kind)
+					columnValuesQuery.BindVariables[_k] = _v1
+				}
+			}
+		case "Table":
+			columnValuesQuery.Table = bson.DecodeString(buf, kind)
+		case "ColumnName":
+			columnValuesQuery.ColumnName = bson.DecodeString(buf, kind)
+		case "ColumnValues":
+			// []interface{}
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for columnValuesQuery.ColumnValues", kind))
+				}
+				bson.Next(buf, 4)
+				columnValuesQuery.ColumnValues = make([]interface{}, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v2 interface{}
+					_v2 = bson.DecodeInterface(buf, kind)
+					columnValuesQuery.ColumnValues = append(columnValuesQuery.ColumnValues, _v2)
+				}
+			}
+		case "TabletType":
+			columnValuesQuery.TabletType.UnmarshalBson(buf, kind)
+		case "Session":
+			// *Session
+			if kind != bson.Null {
+				columnValuesQuery.Session = new(Session)
+				(*columnValuesQuery.Session).UnmarshalBson(buf, kind)
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
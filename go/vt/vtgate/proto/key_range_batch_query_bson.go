@@ -0,0 +1,112 @@
+// Copyright 2012, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package proto
+
+// DO NOT EDIT.
+// FILE GENERATED BY BSONGEN.
+
+import (
+	"bytes"
+
+	"github.com/youtube/vitess/go/bson"
+	"github.com/youtube/vitess/go/bytes2"
+	kproto "github.com/youtube/vitess/go/vt/key"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// MarshalBson bson-encodes KeyRangeBatchQuery.
+func (keyRangeBatchQuery *KeyRangeBatchQuery) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
+	bson.EncodeOptionalPrefix(buf, bson.Object, key)
+	lenWriter := bson.NewLenWriter(buf)
+
+	// []tproto.BoundQuery
+	{
+		bson.EncodePrefix(buf, bson.Array, "Queries")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v1 := range keyRangeBatchQuery.Queries {
+			_v1.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
+	bson.EncodeString(buf, "Keyspace", keyRangeBatchQuery.Keyspace)
+	// []kproto.KeyRange
+	{
+		bson.EncodePrefix(buf, bson.Array, "KeyRanges")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v2 := range keyRangeBatchQuery.KeyRanges {
+			_v2.MarshalBson(buf, bson.Itoa(_i))
+		}
+		lenWriter.Close()
+	}
+	keyRangeBatchQuery.TabletType.MarshalBson(buf, "TabletType")
+	// *Session
+	if keyRangeBatchQuery.Session == nil {
+		bson.EncodePrefix(buf, bson.Null, "Session")
+	} else {
+		(*keyRangeBatchQuery.Session).MarshalBson(buf, "Session")
+	}
+
+	lenWriter.Close()
+}
+
+// UnmarshalBson bson-decodes into KeyRangeBatchQuery.
+func (keyRangeBatchQuery *KeyRangeBatchQuery) UnmarshalBson(buf *bytes.Buffer, kind byte) {
+	switch kind {
+	case bson.EOO, bson.Object:
+		// valid
+	case bson.Null:
+		return
+	default:
+		panic(bson.NewBsonError("unexpected kind %v for KeyRangeBatchQuery", kind))
+	}
+	bson.Next(buf, 4)
+
+	for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+		switch bson.ReadCString(buf) {
+		case "Queries":
+			// []tproto.BoundQuery
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for keyRangeBatchQuery.Queries", kind))
+				}
+				bson.Next(buf, 4)
+				keyRangeBatchQuery.Queries = make([]tproto.BoundQuery, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v1 tproto.BoundQuery
+					_v1.UnmarshalBson(buf, kind)
+					keyRangeBatchQuery.Queries = append(keyRangeBatchQuery.Queries, _v1)
+				}
+			}
+		case "Keyspace":
+			keyRangeBatchQuery.Keyspace = bson.DecodeString(buf, kind)
+		case "KeyRanges":
+			// []kproto.KeyRange
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for keyRangeBatchQuery.KeyRanges", kind))
+				}
+				bson.Next(buf, 4)
+				keyRangeBatchQuery.KeyRanges = make([]kproto.KeyRange, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v2 kproto.KeyRange
+					_v2.UnmarshalBson(buf, kind)
+					keyRangeBatchQuery.KeyRanges = append(keyRangeBatchQuery.KeyRanges, _v2)
+				}
+			}
+		case "TabletType":
+			keyRangeBatchQuery.TabletType.UnmarshalBson(buf, kind)
+		case "Session":
+			// *Session
+			if kind != bson.Null {
+				keyRangeBatchQuery.Session = new(Session)
+				(*keyRangeBatchQuery.Session).UnmarshalBson(buf, kind)
+			}
+		default:
+			bson.Skip(buf, kind)
+		}
+	}
+}
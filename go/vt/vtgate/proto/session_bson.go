@@ -34,6 +34,21 @@ func (session *Session) MarshalBson(buf *bytes2.ChunkedWriter, key string) {
 		}
 		lenWriter.Close()
 	}
+	bson.EncodeBool(buf, "ReadAfterWrite", session.ReadAfterWrite)
+	// []*ShardPosition
+	{
+		bson.EncodePrefix(buf, bson.Array, "ShardPositions")
+		lenWriter := bson.NewLenWriter(buf)
+		for _i, _v2 := range session.ShardPositions {
+			// *ShardPosition
+			if _v2 == nil {
+				bson.EncodePrefix(buf, bson.Null, bson.Itoa(_i))
+			} else {
+				(*_v2).MarshalBson(buf, bson.Itoa(_i))
+			}
+		}
+		lenWriter.Close()
+	}
 
 	lenWriter.Close()
 }
@@ -73,6 +88,27 @@ func (session *Session) UnmarshalBson(buf *bytes.Buffer, kind byte) {
 					session.ShardSessions = append(session.ShardSessions, _v1)
 				}
 			}
+		case "ReadAfterWrite":
+			session.ReadAfterWrite = bson.DecodeBool(buf, kind)
+		case "ShardPositions":
+			// []*ShardPosition
+			if kind != bson.Null {
+				if kind != bson.Array {
+					panic(bson.NewBsonError("unexpected kind %v for session.ShardPositions", kind))
+				}
+				bson.Next(buf, 4)
+				session.ShardPositions = make([]*ShardPosition, 0, 8)
+				for kind := bson.NextByte(buf); kind != bson.EOO; kind = bson.NextByte(buf) {
+					bson.SkipIndex(buf)
+					var _v2 *ShardPosition
+					// *ShardPosition
+					if kind != bson.Null {
+						_v2 = new(ShardPosition)
+						(*_v2).UnmarshalBson(buf, kind)
+					}
+					session.ShardPositions = append(session.ShardPositions, _v2)
+				}
+			}
 		default:
 			bson.Skip(buf, kind)
 		}
@@ -9,6 +9,7 @@ import (
 
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	kproto "github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -16,13 +17,18 @@ import (
 // Session represents the session state. It keeps track of
 // the shards on which transactions are in progress, along
 // with the corresponding tranaction ids.
+// If ReadAfterWrite is set, the master positions reached by the
+// commits are kept in ShardPositions, and the reads on replicas
+// that are behind them go to the master instead.
 type Session struct {
-	InTransaction bool
-	ShardSessions []*ShardSession
+	InTransaction  bool
+	ShardSessions  []*ShardSession
+	ReadAfterWrite bool
+	ShardPositions []*ShardPosition
 }
 
 func (session *Session) String() string {
-	return fmt.Sprintf("InTransaction: %v, ShardSession: %+v", session.InTransaction, session.ShardSessions)
+	return fmt.Sprintf("InTransaction: %v, ShardSession: %+v, ReadAfterWrite: %v, ShardPositions: %+v", session.InTransaction, session.ShardSessions, session.ReadAfterWrite, session.ShardPositions)
 }
 
 // ShardSession represents the session state for a shard.
@@ -37,6 +43,19 @@ func (shardSession *ShardSession) String() string {
 	return fmt.Sprintf("Keyspace: %v, Shard: %v, TabletType: %v, TransactionId: %v", shardSession.Keyspace, shardSession.Shard, shardSession.TabletType, shardSession.TransactionId)
 }
 
+// ShardPosition is the master position of a shard after the last
+// commit of a session. A nil Position means it is unknown, and the
+// shard is read from the master.
+type ShardPosition struct {
+	Keyspace string
+	Shard    string
+	Position myproto.GTIDField
+}
+
+func (shardPosition *ShardPosition) String() string {
+	return fmt.Sprintf("Keyspace: %v, Shard: %v, Position: %v", shardPosition.Keyspace, shardPosition.Shard, shardPosition.Position)
+}
+
 // QueryShard represents a query request for the
 // specified list of shards.
 type QueryShard struct {
@@ -87,6 +106,19 @@ type EntityIdsQuery struct {
 	Session           *Session
 }
 
+// ColumnValuesQuery represents a query request for the rows of Table
+// with the values ColumnValues in ColumnName. The shards of the rows
+// are found with the vindex of the column in the VSchema.
+type ColumnValuesQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Table         string
+	ColumnName    string
+	ColumnValues  []interface{}
+	TabletType    topo.TabletType
+	Session       *Session
+}
+
 // QueryResult is mproto.QueryResult+Session (for now).
 type QueryResult struct {
 	Result  *mproto.QueryResult
@@ -114,6 +146,16 @@ type KeyspaceIdBatchQuery struct {
 	Session     *Session
 }
 
+// KeyRangeBatchQuery represents a batch query request
+// for the specified key ranges.
+type KeyRangeBatchQuery struct {
+	Queries    []tproto.BoundQuery
+	Keyspace   string
+	KeyRanges  []kproto.KeyRange
+	TabletType topo.TabletType
+	Session    *Session
+}
+
 // QueryResultList is mproto.QueryResultList+Session
 type QueryResultList struct {
 	List    []mproto.QueryResult
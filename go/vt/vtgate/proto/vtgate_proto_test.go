@@ -12,6 +12,7 @@ import (
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/sqltypes"
 	kproto "github.com/youtube/vitess/go/vt/key"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 )
@@ -29,11 +30,19 @@ var commonSession = Session{
 		TabletType:    topo.TabletType("master"),
 		TransactionId: 2,
 	}},
+	ReadAfterWrite: true,
+	ShardPositions: []*ShardPosition{{
+		Keyspace: "b",
+		Shard:    "1",
+		Position: myproto.GTIDField{Value: myproto.MustParseGTID("MariaDB", "0-1-123")},
+	}},
 }
 
 type reflectSession struct {
-	InTransaction bool
-	ShardSessions []*ShardSession
+	InTransaction  bool
+	ShardSessions  []*ShardSession
+	ReadAfterWrite bool
+	ShardPositions []*ShardPosition
 }
 
 type extraSession struct {
@@ -56,6 +65,12 @@ func TestSession(t *testing.T) {
 			TabletType:    topo.TabletType("master"),
 			TransactionId: 2,
 		}},
+		ReadAfterWrite: true,
+		ShardPositions: []*ShardPosition{{
+			Keyspace: "b",
+			Shard:    "1",
+			Position: myproto.GTIDField{Value: myproto.MustParseGTID("MariaDB", "0-1-123")},
+		}},
 	})
 	if err != nil {
 		t.Error(err)
@@ -163,7 +178,7 @@ func TestQueryShard(t *testing.T) {
 func TestQueryResult(t *testing.T) {
 	// We can't do the reflection test because bson
 	// doesn't do it correctly for embedded fields.
-	want := "|\x01\x00\x00" +
+	want := "\xeb\x01\x00\x00" +
 		"\x03Result\x00\x85\x00\x00\x00" +
 		"\x04Fields\x00*\x00\x00\x00" +
 		"\x030\x00\"\x00\x00\x00" +
@@ -176,7 +191,7 @@ func TestQueryResult(t *testing.T) {
 		"\x050\x00\x01\x00\x00\x00" +
 		"\x001\x051\x00\x02\x00\x00\x00\x00aa" +
 		"\x00\x00\x00" +
-		"\x03Session\x00\xd0\x00\x00\x00" +
+		"\x03Session\x00?\x01\x00\x00" +
 		"\bInTransaction\x00\x01" +
 		"\x04ShardSessions\x00\xac\x00\x00\x00" +
 		"\x030\x00Q\x00\x00\x00" +
@@ -190,7 +205,15 @@ func TestQueryResult(t *testing.T) {
 		"\x05Shard\x00\x01\x00\x00\x00\x001" +
 		"\x05TabletType\x00\x06\x00\x00\x00\x00master" +
 		"\x12TransactionId\x00\x02\x00\x00\x00\x00\x00\x00\x00" +
-		"\x00\x00\x00" +
+		"\x00\x00" +
+		"\bReadAfterWrite\x00\x01" +
+		"\x04ShardPositions\x00N\x00\x00\x00" +
+		"\x030\x00F\x00\x00\x00" +
+		"\x05Keyspace\x00\x01\x00\x00\x00\x00b" +
+		"\x05Shard\x00\x01\x00\x00\x00\x001" +
+		"\x03Position\x00\x1a\x00\x00\x00" +
+		"\x05MariaDB\x00\a\x00\x00\x00\x000-1-123" +
+		"\x00\x00\x00\x00" +
 		"\x05Error\x00\x05\x00\x00\x00\x00error" +
 		"\x00"
 
@@ -255,19 +278,7 @@ func TestBatchQueryShard(t *testing.T) {
 		}},
 		Keyspace: "keyspace",
 		Shards:   []string{"shard1", "shard2"},
-		Session: &Session{InTransaction: true,
-			ShardSessions: []*ShardSession{{
-				Keyspace:      "a",
-				Shard:         "0",
-				TabletType:    topo.TabletType("replica"),
-				TransactionId: 1,
-			}, {
-				Keyspace:      "b",
-				Shard:         "1",
-				TabletType:    topo.TabletType("master"),
-				TransactionId: 2,
-			}},
-		},
+		Session:  &commonSession,
 	})
 	if err != nil {
 		t.Error(err)
@@ -543,6 +554,80 @@ func TestKeyRangeQuery(t *testing.T) {
 	}
 }
 
+type reflectColumnValuesQuery struct {
+	Sql           string
+	BindVariables map[string]interface{}
+	Table         string
+	ColumnName    string
+	ColumnValues  []interface{}
+	TabletType    topo.TabletType
+	Session       *Session
+}
+
+type extraColumnValuesQuery struct {
+	Extra         int
+	Sql           string
+	BindVariables map[string]interface{}
+	Table         string
+	ColumnName    string
+	ColumnValues  []interface{}
+	TabletType    topo.TabletType
+	Session       *Session
+}
+
+func TestColumnValuesQuery(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectColumnValuesQuery{
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"val": int64(1)},
+		Table:         "table",
+		ColumnName:    "id",
+		ColumnValues:  []interface{}{int64(1), []byte("a")},
+		TabletType:    "replica",
+		Session:       &commonSession,
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := ColumnValuesQuery{
+		Sql:           "query",
+		BindVariables: map[string]interface{}{"val": int64(1)},
+		Table:         "table",
+		ColumnName:    "id",
+		ColumnValues:  []interface{}{int64(1), []byte("a")},
+		TabletType:    "replica",
+		Session:       &commonSession,
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%+v, got\n%+v", want, got)
+	}
+
+	var unmarshalled ColumnValuesQuery
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(custom, unmarshalled) {
+		t.Errorf("want \n%+v, got \n%+v", custom, unmarshalled)
+	}
+
+	extra, err := bson.Marshal(&extraColumnValuesQuery{})
+	if err != nil {
+		t.Error(err)
+	}
+	err = bson.Unmarshal(extra, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 type reflectKeyspaceIdBatchQuery struct {
 	Queries     []reflectBoundQuery
 	Keyspace    string
@@ -568,19 +653,7 @@ func TestKeyspaceIdBatchQuery(t *testing.T) {
 		}},
 		Keyspace:    "keyspace",
 		KeyspaceIds: []kproto.KeyspaceId{kproto.KeyspaceId("10"), kproto.KeyspaceId("20")},
-		Session: &Session{InTransaction: true,
-			ShardSessions: []*ShardSession{{
-				Keyspace:      "a",
-				Shard:         "0",
-				TabletType:    topo.TabletType("replica"),
-				TransactionId: 1,
-			}, {
-				Keyspace:      "b",
-				Shard:         "1",
-				TabletType:    topo.TabletType("master"),
-				TransactionId: 2,
-			}},
-		},
+		Session:     &commonSession,
 	})
 	if err != nil {
 		t.Error(err)
@@ -644,3 +717,54 @@ func TestKeyspaceIdsBatchQueryBadType(t *testing.T) {
 		t.Errorf("want %v, got %v", want, err)
 	}
 }
+
+type reflectKeyRangeBatchQuery struct {
+	Queries    []reflectBoundQuery
+	Keyspace   string
+	KeyRanges  kproto.KeyRangeArray
+	TabletType topo.TabletType
+	Session    *Session
+}
+
+func TestKeyRangeBatchQuery(t *testing.T) {
+	reflected, err := bson.Marshal(&reflectKeyRangeBatchQuery{
+		Queries: []reflectBoundQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+		}},
+		Keyspace:  "keyspace",
+		KeyRanges: []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
+		Session:   &commonSession,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	want := string(reflected)
+
+	custom := KeyRangeBatchQuery{
+		Queries: []tproto.BoundQuery{{
+			Sql:           "query",
+			BindVariables: map[string]interface{}{"val": int64(1)},
+		}},
+		Keyspace:  "keyspace",
+		KeyRanges: []kproto.KeyRange{kproto.KeyRange{Start: "10", End: "18"}},
+		Session:   &commonSession,
+	}
+	encoded, err := bson.Marshal(&custom)
+	if err != nil {
+		t.Error(err)
+	}
+	got := string(encoded)
+	if want != got {
+		t.Errorf("want\n%+v, got\n%+v", want, got)
+	}
+
+	var unmarshalled KeyRangeBatchQuery
+	err = bson.Unmarshal(encoded, &unmarshalled)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(custom, unmarshalled) {
+		t.Errorf("want \n%+v, got \n%+v", custom, unmarshalled)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/context"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// Read-after-write consistency: the sessions with ReadAfterWrite
+// set remember the master position of the shards they committed
+// on, or wrote on outside of a transaction, and their reads on
+// replicas are only served by a replica that reached that position.
+// Otherwise they are served by the master.
+
+// readAfterWriteCounts counts the reads of the read-after-write
+// sessions by where they were served: Replica or Master.
+var readAfterWriteCounts = stats.NewMultiCounters("VtgateReadAfterWrite", []string{"Keyspace", "ShardName", "ServedBy"})
+
+// recordPositions records in session the master positions of the
+// shards committed by the transaction, err being the result of the
+// commit. The positions of the shards whose commit is unresolved, or
+// that cannot be read, are recorded as unknown so they are read from
+// the master.
+func (stc *ScatterConn) recordPositions(context context.Context, session *SafeSession, err error) {
+	var committed, unknown []*proto.ShardSession
+	switch err := err.(type) {
+	case nil:
+		committed = session.ShardSessions
+	case *CommitError:
+		committed = err.Committed
+		unknown = err.Unresolved
+	}
+	for _, shardSession := range committed {
+		if shardSession.TabletType != topo.TYPE_MASTER {
+			continue
+		}
+		sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, topo.TYPE_MASTER)
+		pos, err := sdc.ReplicationPosition(context)
+		if err != nil {
+			log.Warningf("cannot read the master position, reading from the master: %v", err)
+			pos = nil
+		}
+		session.SetPosition(shardSession.Keyspace, shardSession.Shard, pos)
+	}
+	for _, shardSession := range unknown {
+		if shardSession.TabletType == topo.TYPE_MASTER {
+			session.SetPosition(shardSession.Keyspace, shardSession.Shard, nil)
+		}
+	}
+}
+
+// recordWrite records in session the master position of the shard
+// of sdc after sqls, if they were executed on the master outside of a
+// transaction and one of them is a DML.
+func (stc *ScatterConn) recordWrite(context context.Context, sdc *ShardConn, transactionId int64, session *SafeSession, sqls ...string) {
+	if transactionId != 0 || sdc.tabletType != topo.TYPE_MASTER || session == nil || session.Session == nil || !session.ReadAfterWrite {
+		return
+	}
+	for _, sql := range sqls {
+		if !sqlparser.IsDML(sql) {
+			continue
+		}
+		pos, err := sdc.ReplicationPosition(context)
+		if err != nil {
+			log.Warningf("cannot read the master position, reading from the master: %v", err)
+			pos = nil
+		}
+		session.SetPosition(sdc.keyspace, sdc.shard, pos)
+		return
+	}
+}
+
+// readTabletType returns the tablet type the query for keyspace and
+// shard must be sent to: tabletType, unless session does
+// read-after-write and the replica didn't reach the master position
+// it committed. The position is checked on the connection the query
+// then goes to.
+func (stc *ScatterConn) readTabletType(context context.Context, keyspace, shard string, tabletType topo.TabletType, session *SafeSession) topo.TabletType {
+	if tabletType == topo.TYPE_MASTER || session.InTransaction() {
+		return tabletType
+	}
+	want, ok := session.Position(keyspace, shard)
+	if !ok {
+		return tabletType
+	}
+	if want != nil {
+		pos, err := stc.getConnection(context, keyspace, shard, tabletType).ReplicationPosition(context)
+		if err == nil {
+			if reached, _ := myproto.AtLeast(pos, want); reached {
+				readAfterWriteCounts.Add([]string{keyspace, shard, "Replica"}, 1)
+				return tabletType
+			}
+		}
+	}
+	readAfterWriteCounts.Add([]string{keyspace, shard, "Master"}, 1)
+	return topo.TYPE_MASTER
+}
@@ -0,0 +1,145 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+)
+
+// This file uses the sandbox_test framework.
+
+// positionConn is a sandboxConn reporting a replication position.
+// As the sandbox maps the master and the replicas of a shard to the
+// same connection, it returns the positions in order, and fails
+// when there are none left.
+type positionConn struct {
+	*sandboxConn
+
+	mu        sync.Mutex
+	positions []string
+}
+
+func (pc *positionConn) ReplicationPosition(context context.Context) (myproto.GTID, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.positions) == 0 {
+		return nil, fmt.Errorf("error: no position")
+	}
+	pos := myproto.MustParseGTID("MariaDB", pc.positions[0])
+	pc.positions = pc.positions[1:]
+	return pos, nil
+}
+
+func TestReadAfterWrite(t *testing.T) {
+	s := createSandbox("TestReadAfterWrite")
+	pc := &positionConn{sandboxConn: &sandboxConn{}, positions: []string{"0-1-10", "0-1-5", "0-1-10"}}
+	s.MapTestConn("0", pc)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+	session := NewSafeSession(&proto.Session{InTransaction: true, ReadAfterWrite: true})
+	shards := []string{"0"}
+
+	if _, err := stc.Execute(&context.DummyContext{}, "query", nil, "TestReadAfterWrite", shards, topo.TYPE_MASTER, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	want := "[Keyspace: TestReadAfterWrite, Shard: 0, Position: 0-1-10]"
+	if got := fmt.Sprintf("%v", session.ShardPositions); got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// The replica is behind, then it caught up.
+	for _, servedBy := range []string{"Master", "Replica"} {
+		if _, err := stc.Execute(&context.DummyContext{}, "query", nil, "TestReadAfterWrite", shards, topo.TYPE_REPLICA, session); err != nil {
+			t.Fatalf("want nil, got %v", err)
+		}
+		if got := readAfterWriteCounts.Counts()["TestReadAfterWrite.0."+servedBy]; got != 1 {
+			t.Errorf("%v reads: want 1, got %v", servedBy, got)
+		}
+	}
+
+	// The positions are only checked for the read-after-write sessions.
+	pc.positions = []string{"0-1-10"}
+	session.ReadAfterWrite = false
+	if _, err := stc.Execute(&context.DummyContext{}, "query", nil, "TestReadAfterWrite", shards, topo.TYPE_REPLICA, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if len(pc.positions) != 1 {
+		t.Errorf("want the position unread, got %v", pc.positions)
+	}
+}
+
+func TestReadAfterWriteUnknownPosition(t *testing.T) {
+	s := createSandbox("TestReadAfterWriteUnknownPosition")
+	pc := &positionConn{sandboxConn: &sandboxConn{}}
+	s.MapTestConn("0", pc)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 1*time.Millisecond)
+	session := NewSafeSession(&proto.Session{InTransaction: true, ReadAfterWrite: true})
+	shards := []string{"0"}
+
+	if _, err := stc.Execute(&context.DummyContext{}, "query", nil, "TestReadAfterWriteUnknownPosition", shards, topo.TYPE_MASTER, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if err := stc.Commit(&context.DummyContext{}, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	want := "[Keyspace: TestReadAfterWriteUnknownPosition, Shard: 0, Position: <nil>]"
+	if got := fmt.Sprintf("%v", session.ShardPositions); got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	// The reads go to the master without checking the replica.
+	pc.positions = []string{"0-1-10"}
+	if _, err := stc.Execute(&context.DummyContext{}, "query", nil, "TestReadAfterWriteUnknownPosition", shards, topo.TYPE_REPLICA, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if got := readAfterWriteCounts.Counts()["TestReadAfterWriteUnknownPosition.0.Master"]; got != 1 {
+		t.Errorf("want 1, got %v", got)
+	}
+	if len(pc.positions) != 1 {
+		t.Errorf("want the position unread, got %v", pc.positions)
+	}
+}
+
+func TestReadAfterWriteNoTransaction(t *testing.T) {
+	s := createSandbox("TestReadAfterWriteNoTransaction")
+	pc := &positionConn{sandboxConn: &sandboxConn{}, positions: []string{"0-1-10", "0-1-10"}}
+	s.MapTestConn("0", pc)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+	session := NewSafeSession(&proto.Session{ReadAfterWrite: true})
+	shards := []string{"0"}
+
+	// The selects on the master don't record a position.
+	if _, err := stc.Execute(&context.DummyContext{}, "select 1 from a", nil, "TestReadAfterWriteNoTransaction", shards, topo.TYPE_MASTER, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if len(session.ShardPositions) != 0 {
+		t.Errorf("want no position, got %v", session.ShardPositions)
+	}
+
+	if _, err := stc.Execute(&context.DummyContext{}, "/* comment */ insert into a values (1)", nil, "TestReadAfterWriteNoTransaction", shards, topo.TYPE_MASTER, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	want := "[Keyspace: TestReadAfterWriteNoTransaction, Shard: 0, Position: 0-1-10]"
+	if got := fmt.Sprintf("%v", session.ShardPositions); got != want {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	if _, err := stc.Execute(&context.DummyContext{}, "select 1 from a", nil, "TestReadAfterWriteNoTransaction", shards, topo.TYPE_REPLICA, session); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	if got := readAfterWriteCounts.Counts()["TestReadAfterWriteNoTransaction.0.Replica"]; got != 1 {
+		t.Errorf("want 1, got %v", got)
+	}
+}
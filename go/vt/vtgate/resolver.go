@@ -202,6 +202,20 @@ func (res *Resolver) ExecuteBatchKeyspaceIds(context context.Context, query *pro
 	return res.ExecuteBatch(context, query.Queries, query.Keyspace, query.TabletType, query.Session, mapToShards)
 }
 
+// ExecuteBatchKeyRanges executes a group of queries based on KeyRanges.
+// It retries query if new keyspace/shards are re-resolved after a retryable error.
+func (res *Resolver) ExecuteBatchKeyRanges(context context.Context, query *proto.KeyRangeBatchQuery) (*tproto.QueryResultList, error) {
+	mapToShards := func(keyspace string) (string, []string, error) {
+		return mapKeyRangesToShards(
+			res.scatterConn.toposerv,
+			res.scatterConn.cell,
+			keyspace,
+			query.TabletType,
+			query.KeyRanges)
+	}
+	return res.ExecuteBatch(context, query.Queries, query.Keyspace, query.TabletType, query.Session, mapToShards)
+}
+
 // ExecuteBatch executes a group of queries based on shards resolved by given func.
 // It retries query if new keyspace/shards are re-resolved after a retryable error.
 func (res *Resolver) ExecuteBatch(
@@ -122,6 +122,31 @@ func TestResolverExecuteBatchKeyspaceIds(t *testing.T) {
 	})
 }
 
+func TestResolverExecuteBatchKeyRanges(t *testing.T) {
+	testResolverGeneric(t, "TestResolverExecuteBatchKeyRanges", func() (*mproto.QueryResult, error) {
+		kid10, err := key.HexKeyspaceId("10").Unhex()
+		if err != nil {
+			return nil, err
+		}
+		kid25, err := key.HexKeyspaceId("25").Unhex()
+		if err != nil {
+			return nil, err
+		}
+		query := &proto.KeyRangeBatchQuery{
+			Queries:    []tproto.BoundQuery{{"query", nil}},
+			Keyspace:   "TestResolverExecuteBatchKeyRanges",
+			KeyRanges:  []key.KeyRange{key.KeyRange{Start: kid10, End: kid25}},
+			TabletType: topo.TYPE_MASTER,
+		}
+		res := NewResolver(new(sandboxTopo), "", "aa", 1*time.Millisecond, 0, 1*time.Millisecond)
+		qrs, err := res.ExecuteBatchKeyRanges(&context.DummyContext{}, query)
+		if err != nil {
+			return nil, err
+		}
+		return &qrs.List[0], err
+	})
+}
+
 func TestResolverStreamExecuteKeyspaceIds(t *testing.T) {
 	kid10, err := key.HexKeyspaceId("10").Unhex()
 	if err != nil {
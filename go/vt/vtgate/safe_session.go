@@ -7,6 +7,7 @@ package vtgate
 import (
 	"sync"
 
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	"github.com/youtube/vitess/go/vt/topo"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
 )
@@ -49,6 +50,46 @@ func (session *SafeSession) Append(shardSession *proto.ShardSession) {
 	session.ShardSessions = append(session.ShardSessions, shardSession)
 }
 
+// Position returns the master position the session must read for
+// keyspace and shard, if it does read-after-write and committed on
+// the shard. A nil position means it must read from the master.
+func (session *SafeSession) Position(keyspace, shard string) (pos myproto.GTID, ok bool) {
+	if session == nil || session.Session == nil {
+		return nil, false
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if !session.ReadAfterWrite {
+		return nil, false
+	}
+	for _, shardPosition := range session.ShardPositions {
+		if keyspace == shardPosition.Keyspace && shard == shardPosition.Shard {
+			return shardPosition.Position.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetPosition records the master position of keyspace and shard
+// after a commit.
+func (session *SafeSession) SetPosition(keyspace, shard string, pos myproto.GTID) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for _, shardPosition := range session.ShardPositions {
+		if keyspace == shardPosition.Keyspace && shard == shardPosition.Shard {
+			shardPosition.Position.Value = pos
+			return
+		}
+	}
+	session.ShardPositions = append(session.ShardPositions, &proto.ShardPosition{
+		Keyspace: keyspace,
+		Shard:    shard,
+		Position: myproto.GTIDField{Value: pos},
+	})
+}
+
+// Reset ends the transaction. The positions of read-after-write
+// are kept.
 func (session *SafeSession) Reset() {
 	session.mu.Lock()
 	defer session.mu.Unlock()
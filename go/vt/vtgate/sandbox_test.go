@@ -283,7 +283,9 @@ func sandboxDialer(context context.Context, endPoint topo.EndPoint, keyspace, sh
 	if tconn == nil {
 		panic(fmt.Sprintf("can't find conn %v", endPoint.Uid))
 	}
-	tconn.(*sandboxConn).endPoint = endPoint
+	if sbc, ok := tconn.(*sandboxConn); ok {
+		sbc.endPoint = endPoint
+	}
 	return tconn, nil
 }
 
@@ -377,6 +379,13 @@ func (sbc *sandboxConn) StreamExecute(context context.Context, query string, bin
 	return ch, func() error { return err }
 }
 
+func (sbc *sandboxConn) StreamHealth(context context.Context) (<-chan *tproto.HealthStats, tabletconn.ErrFunc) {
+	ch := make(chan *tproto.HealthStats, 1)
+	ch <- &tproto.HealthStats{Healthy: true, Serving: true, MysqlReachable: true, RowcacheHealthy: true}
+	close(ch)
+	return ch, func() error { return nil }
+}
+
 func (sbc *sandboxConn) Begin(context context.Context) (int64, error) {
 	sbc.ExecCount.Add(1)
 	sbc.BeginCount.Add(1)
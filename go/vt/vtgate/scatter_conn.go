@@ -10,9 +10,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/youtube/vitess/go/cache"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
 	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/timer"
 	"github.com/youtube/vitess/go/vt/concurrency"
 	"github.com/youtube/vitess/go/vt/context"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
@@ -33,6 +35,27 @@ type ScatterConn struct {
 	timeout    time.Duration
 	timings    *stats.MultiTimings
 
+	// plans caches the plans of the queries sent to several
+	// shards, see plan_cache.go.
+	plans *cache.LRUCache
+
+	// errorCounts counts the failed tablet calls by error code.
+	// qpsByShard and errorsByShard are the rates of the tablet
+	// calls and of their errors, see shard_stats.go.
+	errorCounts   *stats.MultiCounters
+	qpsByShard    *stats.Rates
+	errorsByShard *stats.Rates
+
+	// discovery picks the tablets of the ShardConns by their
+	// health. If nil, they use a Balancer.
+	discovery *TabletDiscovery
+
+	// transactionMode is TX_BEST_EFFORT or TX_TWOPC.
+	transactionMode string
+	// twoPCWatchdog resolves the abandoned distributed
+	// transactions, in TX_TWOPC mode.
+	twoPCWatchdog *timer.Timer
+
 	mu         sync.Mutex
 	shardConns map[string]*ShardConn
 }
@@ -47,7 +70,7 @@ type shardActionFunc func(conn *ShardConn, transactionId int64, sResults chan<-
 // NewScatterConn creates a new ScatterConn. All input parameters are passed through
 // for creating the appropriate ShardConn.
 func NewScatterConn(serv SrvTopoServer, statsName, cell string, retryDelay time.Duration, retryCount int, timeout time.Duration) *ScatterConn {
-	return &ScatterConn{
+	stc := &ScatterConn{
 		toposerv:   serv,
 		cell:       cell,
 		retryDelay: retryDelay,
@@ -55,7 +78,12 @@ func NewScatterConn(serv SrvTopoServer, statsName, cell string, retryDelay time.
 		timeout:    timeout,
 		timings:    stats.NewMultiTimings(statsName, []string{"Operation", "Keyspace", "ShardName", "DbType"}),
 		shardConns: make(map[string]*ShardConn),
+		plans:      cache.NewLRUCache(int64(*planCacheSize)),
+
+		transactionMode: *transactionMode,
 	}
+	stc.initShardStats(statsName)
+	return stc
 }
 
 // Execute executes a non-streaming query on the specified shards.
@@ -68,6 +96,15 @@ func (stc *ScatterConn) Execute(
 	tabletType topo.TabletType,
 	session *SafeSession,
 ) (*mproto.QueryResult, error) {
+	// The results of a select sent to several shards may need to
+	// be merged.
+	var plan *scatterSelect
+	if len(unique(shards)) > 1 {
+		var err error
+		if plan, query, bindVars, err = stc.planScatter(keyspace, query, bindVars); err != nil {
+			return nil, err
+		}
+	}
 	results, allErrors := stc.multiGo(
 		context,
 		"Execute",
@@ -80,18 +117,27 @@ func (stc *ScatterConn) Execute(
 			if err != nil {
 				return err
 			}
+			stc.recordWrite(context, sdc, transactionId, session, query)
 			sResults <- innerqr
 			return nil
 		})
 
 	qr := new(mproto.QueryResult)
+	var innerqrs []*mproto.QueryResult
 	for innerqr := range results {
 		innerqr := innerqr.(*mproto.QueryResult)
+		if plan != nil {
+			innerqrs = append(innerqrs, innerqr)
+			continue
+		}
 		appendResult(qr, innerqr)
 	}
 	if allErrors.HasErrors() {
 		return nil, allErrors.AggrError(stc.aggregateErrors)
 	}
+	if plan != nil {
+		return plan.merge(innerqrs)
+	}
 	return qr, nil
 }
 
@@ -119,6 +165,7 @@ func (stc *ScatterConn) ExecuteEntityIds(
 			if err != nil {
 				return err
 			}
+			stc.recordWrite(context, sdc, transactionId, session, sql)
 			sResults <- innerqr
 			return nil
 		})
@@ -155,6 +202,11 @@ func (stc *ScatterConn) ExecuteBatch(
 			if err != nil {
 				return err
 			}
+			sqls := make([]string, len(queries))
+			for i, query := range queries {
+				sqls[i] = query.Sql
+			}
+			stc.recordWrite(context, sdc, transactionId, session, sqls...)
 			sResults <- innerqrs
 			return nil
 		})
@@ -174,6 +226,9 @@ func (stc *ScatterConn) ExecuteBatch(
 }
 
 // StreamExecute executes a streaming query on vttablet. The retry rules are the same.
+// The streams of several shards are merged if the query has an ORDER BY
+// or a LIMIT, see stream_merge.go. Once the client is gone or the LIMIT
+// is reached, the rest of the streams is discarded.
 func (stc *ScatterConn) StreamExecute(
 	context context.Context,
 	query string,
@@ -184,6 +239,28 @@ func (stc *ScatterConn) StreamExecute(
 	session *SafeSession,
 	sendReply func(reply *mproto.QueryResult) error,
 ) error {
+	var plan *scatterSelect
+	var streams map[string]chan *mproto.QueryResult
+	if len(unique(shards)) > 1 {
+		var err error
+		if plan, query, bindVars, err = stc.planScatter(keyspace, query, bindVars); err != nil {
+			return err
+		}
+		if err := checkStreamMerge(plan); err != nil {
+			return err
+		}
+		if plan != nil {
+			streams = make(map[string]chan *mproto.QueryResult)
+			for shard := range unique(shards) {
+				streams[shard] = make(chan *mproto.QueryResult, 1)
+			}
+		}
+	}
+	// done is closed when the results are not needed anymore, because
+	// the client went away or the LIMIT was reached: the streams of the
+	// shards are then canceled, and drained without being sent.
+	done := make(chan struct{})
+	streamContext, cancel := withCancel(context)
 	results, allErrors := stc.multiGo(
 		context,
 		"StreamExecute",
@@ -192,45 +269,86 @@ func (stc *ScatterConn) StreamExecute(
 		tabletType,
 		session,
 		func(sdc *ShardConn, transactionId int64, sResults chan<- interface{}) error {
-			sr, errFunc := sdc.StreamExecute(context, query, bindVars, transactionId)
+			sr, errFunc := sdc.StreamExecute(streamContext, query, bindVars, transactionId)
 			if sr != nil {
-				for qr := range sr {
-					sResults <- qr
+				if plan != nil {
+					stream := streams[sdc.shard]
+					for qr := range sr {
+						select {
+						case stream <- qr:
+						case <-done:
+						}
+					}
+				} else {
+					for qr := range sr {
+						select {
+						case sResults <- qr:
+						case <-done:
+						}
+					}
 				}
 			}
 			return errFunc()
 		})
-	var replyErr error
-	for innerqr := range results {
-		// We still need to finish pumping
-		if replyErr != nil {
-			continue
+	if plan == nil {
+		for innerqr := range results {
+			if err := sendReply(innerqr.(*mproto.QueryResult)); err != nil {
+				close(done)
+				cancel()
+				return err
+			}
 		}
-		replyErr = sendReply(innerqr.(*mproto.QueryResult))
+		cancel()
+		return allErrors.AggrError(stc.aggregateErrors)
 	}
-	if replyErr != nil {
-		allErrors.RecordError(replyErr)
+
+	// All the shards are done once results is closed.
+	finished := make(chan struct{})
+	go func() {
+		for _ = range results {
+		}
+		close(finished)
+		for _, stream := range streams {
+			close(stream)
+		}
+	}()
+	var shardStreams []*shardStream
+	for _, stream := range streams {
+		shardStreams = append(shardStreams, &shardStream{index: len(shardStreams), results: stream})
+	}
+	err := plan.mergeStreams(shardStreams, sendReply)
+	close(done)
+	cancel()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-finished:
+		return allErrors.AggrError(stc.aggregateErrors)
+	default:
+		// The LIMIT was reached before the end of the streams.
+		return nil
 	}
-	return allErrors.AggrError(stc.aggregateErrors)
 }
 
-// Commit commits the current transaction. There are no retries on this operation.
-func (stc *ScatterConn) Commit(context context.Context, session *SafeSession) (err error) {
+// withCancel is context.WithCancel, for the functions whose
+// context argument hides the package.
+func withCancel(ctx context.Context) (context.Context, func()) {
+	return context.WithCancel(ctx)
+}
+
+// Commit commits the current transaction. There are no retries on
+// this operation. The transactions spanning several shards are
+// committed according to the transaction mode, see commit.go.
+func (stc *ScatterConn) Commit(context context.Context, session *SafeSession) error {
 	if !session.InTransaction() {
 		return fmt.Errorf("cannot commit: not in transaction")
 	}
-	committing := true
-	for _, shardSession := range session.ShardSessions {
-		sdc := stc.getConnection(context, shardSession.Keyspace, shardSession.Shard, shardSession.TabletType)
-		if !committing {
-			go sdc.Rollback(context, shardSession.TransactionId)
-			continue
-		}
-		if err = sdc.Commit(context, shardSession.TransactionId); err != nil {
-			committing = false
-		}
+	defer session.Reset()
+	err := stc.commit(context, session.ShardSessions)
+	if session.ReadAfterWrite {
+		stc.recordPositions(context, session, err)
 	}
-	session.Reset()
 	return err
 }
 
@@ -246,6 +364,9 @@ func (stc *ScatterConn) Rollback(context context.Context, session *SafeSession)
 
 // Close closes the underlying ShardConn connections.
 func (stc *ScatterConn) Close() error {
+	if stc.twoPCWatchdog != nil {
+		stc.twoPCWatchdog.Stop()
+	}
 	stc.mu.Lock()
 	defer stc.mu.Unlock()
 	for _, v := range stc.shardConns {
@@ -346,15 +467,18 @@ func (stc *ScatterConn) execShardAction(
 	allErrors *concurrency.AllErrorRecorder,
 	results chan interface{},
 ) {
+	tabletType = stc.readTabletType(context, keyspace, shard, tabletType, session)
 	for {
 		sdc := stc.getConnection(context, keyspace, shard, tabletType)
 		transactionId, err := stc.updateSession(context, sdc, keyspace, shard, tabletType, session)
 		if err != nil {
+			stc.errorCounts.Add([]string{keyspace, shard, string(tabletType), errorCode(err)}, 1)
 			allErrors.RecordError(err)
 			return
 		}
 		err = action(sdc, transactionId, results)
 		if err != nil {
+			stc.errorCounts.Add([]string{keyspace, shard, string(tabletType), errorCode(err)}, 1)
 			allErrors.RecordError(err)
 			return
 		}
@@ -370,6 +494,9 @@ func (stc *ScatterConn) getConnection(context context.Context, keyspace, shard s
 	sdc, ok := stc.shardConns[key]
 	if !ok {
 		sdc = NewShardConn(context, stc.toposerv, stc.cell, keyspace, shard, tabletType, stc.retryDelay, stc.retryCount, stc.timeout)
+		if stc.discovery != nil {
+			sdc.balancer = stc.discovery.picker(keyspace, shard, tabletType)
+		}
 		stc.shardConns[key] = sdc
 	}
 	return sdc
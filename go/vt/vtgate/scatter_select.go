@@ -0,0 +1,616 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/sqlparser"
+)
+
+// This file contains the merging of the results of a select sent to
+// several shards, so the client gets the same rows as if the query
+// had run on a single database:
+// - the COUNT, SUM, MIN and MAX aggregates are combined, per group
+//   if the query has a GROUP BY, or into a single row;
+// - the rows of a SELECT DISTINCT are deduplicated;
+// - the rows are sorted by the ORDER BY columns;
+// - the LIMIT is applied once all the rows are merged. If the rows
+//   don't need to be combined, each shard only returns the first
+//   offset+rowcount rows.
+//
+// Numeric columns are compared by value, and the other columns as
+// bytes, regardless of their collation. The queries that can't be
+// merged correctly (COUNT(DISTINCT), AVG, aggregates in expressions
+// like count(*)+1, HAVING with aggregates, ORDER BY or GROUP BY an
+// expression missing from the select list) are rejected. The rows of
+// the shards can't be sorted by a column they don't return, so an
+// ORDER BY column missing from the select list fails the query, before
+// it's sent to the shards if the select list has no *, or once the
+// fields of the results are known.
+
+// aggregates are the aggregate functions that can be combined.
+var aggregates = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+}
+
+// unsupportedAggregates are the aggregate functions that can't be
+// combined from the results of each shard.
+var unsupportedAggregates = map[string]bool{
+	"avg":          true,
+	"group_concat": true,
+	"std":          true,
+	"stddev":       true,
+	"stddev_pop":   true,
+	"stddev_samp":  true,
+	"variance":     true,
+	"var_pop":      true,
+	"var_samp":     true,
+	"bit_and":      true,
+	"bit_or":       true,
+	"bit_xor":      true,
+}
+
+// scatterSelect is the plan to merge the results of a select sent to
+// several shards.
+type scatterSelect struct {
+	sel *sqlparser.Select
+
+	// query is the query to send to the shards. It's empty until
+	// the plan is bound to the values of the LIMIT.
+	query string
+
+	// aggregates maps the index of the aggregate columns to their
+	// function.
+	aggregates map[int]string
+
+	// groupBy is the index of the GROUP BY columns.
+	groupBy []int
+
+	// combine is set if the rows of the shards must be combined.
+	combine bool
+
+	hasLimit         bool
+	offset, rowcount int64
+}
+
+// newScatterSelect returns the plan to merge the results of sql, or
+// nil if the results can just be concatenated. The queries vtgate
+// can't parse are not merged.
+func newScatterSelect(sql string, bindVars map[string]interface{}) (*scatterSelect, error) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, nil
+	}
+	ss, err := planScatterSelect(statement)
+	if err != nil || ss == nil {
+		return ss, err
+	}
+	return ss.bind(bindVars)
+}
+
+// planScatterSelect returns the plan to merge the results of
+// statement, or nil if the results can just be concatenated. If the
+// LIMIT has bind variables, the plan must be bound to their values.
+func planScatterSelect(statement sqlparser.Statement) (*scatterSelect, error) {
+	sel, ok := statement.(*sqlparser.Select)
+	if !ok {
+		return nil, nil
+	}
+	ss := &scatterSelect{
+		sel:        sel,
+		aggregates: make(map[int]string),
+	}
+
+	hasStar := false
+	for i, expr := range sel.SelectExprs {
+		nonStar, ok := expr.(*sqlparser.NonStarExpr)
+		if !ok {
+			hasStar = true
+			continue
+		}
+		funcExpr, ok := nonStar.Expr.(*sqlparser.FuncExpr)
+		if !ok || !isAggregate(funcExpr) {
+			// The aggregates in an expression can't be combined.
+			if aggregate := findAggregate(nonStar.Expr); aggregate != nil {
+				return nil, fmt.Errorf("aggregate %v in an expression is not supported in a scatter query", sqlparser.String(aggregate))
+			}
+			continue
+		}
+		name := strings.ToLower(string(funcExpr.Name))
+		switch {
+		case unsupportedAggregates[name]:
+			return nil, fmt.Errorf("aggregate %v is not supported in a scatter query", sqlparser.String(funcExpr))
+		case !aggregates[name]:
+			continue
+		case funcExpr.Distinct:
+			return nil, fmt.Errorf("distinct aggregate %v is not supported in a scatter query", sqlparser.String(funcExpr))
+		}
+		ss.aggregates[i] = name
+	}
+	if hasStar && (len(ss.aggregates) > 0 || len(sel.GroupBy) > 0) {
+		return nil, fmt.Errorf("aggregates and group by cannot be mixed with * in a scatter query")
+	}
+	for _, expr := range sel.GroupBy {
+		i := findSelectExpr(sel, expr)
+		if i < 0 {
+			return nil, fmt.Errorf("group by expression %v is not in the select list of a scatter query", sqlparser.String(expr))
+		}
+		ss.groupBy = append(ss.groupBy, i)
+	}
+	// With a *, the ORDER BY columns can only be resolved once the
+	// fields of the results are known.
+	if !hasStar {
+		for _, order := range sel.OrderBy {
+			if !isSelected(sel, order.Expr) {
+				return nil, fmt.Errorf("order by expression %v is not in the select list of a scatter query", sqlparser.String(order.Expr))
+			}
+		}
+	}
+	ss.combine = len(ss.aggregates) > 0 || len(ss.groupBy) > 0
+	if ss.combine && sel.Having != nil {
+		return nil, fmt.Errorf("having is not supported in a scatter query with aggregates")
+	}
+
+	ss.hasLimit = sel.Limit != nil
+	if !ss.combine && sel.Distinct == "" && sel.OrderBy == nil && !ss.hasLimit {
+		return nil, nil
+	}
+	if ss.hasLimit {
+		for _, expr := range []sqlparser.ValExpr{sel.Limit.Offset, sel.Limit.Rowcount} {
+			if _, ok := expr.(sqlparser.ValArg); ok {
+				return ss, nil
+			}
+		}
+	}
+	return ss.bind(nil)
+}
+
+// bind returns the plan with the values of the LIMIT, and the query
+// to send to the shards. A plan without bind variables in its LIMIT
+// is already bound.
+func (ss *scatterSelect) bind(bindVars map[string]interface{}) (*scatterSelect, error) {
+	if ss.query != "" {
+		return ss, nil
+	}
+	bound := *ss
+	sel := ss.sel
+	if sel.Limit != nil {
+		var err error
+		if sel.Limit.Offset != nil {
+			if bound.offset, err = limitValue(sel.Limit.Offset, bindVars); err != nil {
+				return nil, err
+			}
+		}
+		if bound.rowcount, err = limitValue(sel.Limit.Rowcount, bindVars); err != nil {
+			return nil, err
+		}
+	}
+
+	// Send the query without the limit if the rows are combined,
+	// and with a limit of offset+rowcount if they are not.
+	pushed := *sel
+	pushed.Limit = nil
+	if bound.hasLimit && !bound.combine {
+		pushed.Limit = &sqlparser.Limit{
+			Rowcount: sqlparser.NumVal(strconv.FormatInt(bound.offset+bound.rowcount, 10)),
+		}
+	}
+	bound.query = sqlparser.String(&pushed)
+	return &bound, nil
+}
+
+// findSelectExpr returns the index of the select expression expr
+// refers to, by position, alias or expression, or -1.
+func findSelectExpr(sel *sqlparser.Select, expr sqlparser.ValExpr) int {
+	if num, ok := expr.(sqlparser.NumVal); ok {
+		pos, err := strconv.Atoi(string(num))
+		if err != nil || pos < 1 || pos > len(sel.SelectExprs) {
+			return -1
+		}
+		return pos - 1
+	}
+	if col, ok := expr.(*sqlparser.ColName); ok && col.Qualifier == nil {
+		for i, selectExpr := range sel.SelectExprs {
+			if nonStar, ok := selectExpr.(*sqlparser.NonStarExpr); ok && bytes.EqualFold(nonStar.As, col.Name) {
+				return i
+			}
+		}
+	}
+	str := sqlparser.String(expr)
+	for i, selectExpr := range sel.SelectExprs {
+		if nonStar, ok := selectExpr.(*sqlparser.NonStarExpr); ok && strings.EqualFold(sqlparser.String(nonStar.Expr), str) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isSelected returns true if the ORDER BY expression expr is in the
+// select list, or is a column returned under its name.
+func isSelected(sel *sqlparser.Select, expr sqlparser.ValExpr) bool {
+	if findSelectExpr(sel, expr) >= 0 {
+		return true
+	}
+	col, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return false
+	}
+	for _, selectExpr := range sel.SelectExprs {
+		nonStar, ok := selectExpr.(*sqlparser.NonStarExpr)
+		if !ok || nonStar.As != nil {
+			continue
+		}
+		if selected, ok := nonStar.Expr.(*sqlparser.ColName); ok && bytes.EqualFold(selected.Name, col.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAggregate returns true if funcExpr is an aggregate function.
+func isAggregate(funcExpr *sqlparser.FuncExpr) bool {
+	name := strings.ToLower(string(funcExpr.Name))
+	return aggregates[name] || unsupportedAggregates[name]
+}
+
+// findAggregate returns the first aggregate function of expr, outside
+// of its subqueries, or nil.
+func findAggregate(expr sqlparser.Expr) (aggregate *sqlparser.FuncExpr) {
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.FuncExpr:
+			if aggregate == nil && isAggregate(node) {
+				aggregate = node
+			}
+		case *sqlparser.Subquery:
+			return false, nil
+		}
+		return aggregate == nil, nil
+	}, expr)
+	return aggregate
+}
+
+// limitValue returns the value of a LIMIT argument.
+func limitValue(expr sqlparser.ValExpr, bindVars map[string]interface{}) (int64, error) {
+	var v int64
+	switch expr := expr.(type) {
+	case sqlparser.NumVal:
+		var err error
+		if v, err = strconv.ParseInt(string(expr), 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid limit %s: %v", []byte(expr), err)
+		}
+	case sqlparser.ValArg:
+		name := string(expr[1:])
+		switch bv := bindVars[name].(type) {
+		case int:
+			v = int64(bv)
+		case int32:
+			v = int64(bv)
+		case int64:
+			v = bv
+		case uint32:
+			v = int64(bv)
+		case uint64:
+			v = int64(bv)
+		default:
+			return 0, fmt.Errorf("invalid limit bind variable %v: %v", name, bindVars[name])
+		}
+	default:
+		return 0, fmt.Errorf("unsupported limit %v", sqlparser.String(expr))
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("invalid limit %v", v)
+	}
+	return v, nil
+}
+
+// merge returns the merged results of the shards.
+func (ss *scatterSelect) merge(results []*mproto.QueryResult) (*mproto.QueryResult, error) {
+	qr := new(mproto.QueryResult)
+	for _, innerqr := range results {
+		appendResult(qr, innerqr)
+	}
+	if len(qr.Fields) == 0 {
+		return qr, nil
+	}
+
+	var err error
+	if ss.combine {
+		if qr.Rows, err = ss.combineRows(qr.Fields, qr.Rows); err != nil {
+			return nil, err
+		}
+	}
+	if ss.sel.Distinct != "" {
+		qr.Rows = distinctRows(qr.Rows)
+	}
+	if ss.sel.OrderBy != nil {
+		if err = ss.sortRows(qr.Fields, qr.Rows); err != nil {
+			return nil, err
+		}
+	}
+	if ss.hasLimit {
+		start := ss.offset
+		if start > int64(len(qr.Rows)) {
+			start = int64(len(qr.Rows))
+		}
+		end := start + ss.rowcount
+		if end > int64(len(qr.Rows)) {
+			end = int64(len(qr.Rows))
+		}
+		qr.Rows = qr.Rows[start:end]
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// combineRows combines the rows of the same group, or all the rows
+// if there is no GROUP BY. The groups keep the order in which they
+// were first seen.
+func (ss *scatterSelect) combineRows(fields []mproto.Field, rows [][]sqltypes.Value) ([][]sqltypes.Value, error) {
+	var combined [][]sqltypes.Value
+	groups := make(map[string]int)
+	for _, row := range rows {
+		if len(row) != len(fields) {
+			return nil, fmt.Errorf("scatter query returned %v values for %v fields", len(row), len(fields))
+		}
+		key := rowKey(row, ss.groupBy)
+		i, ok := groups[key]
+		if !ok {
+			groups[key] = len(combined)
+			combined = append(combined, append([]sqltypes.Value(nil), row...))
+			continue
+		}
+		for col, function := range ss.aggregates {
+			if col >= len(fields) {
+				return nil, fmt.Errorf("scatter query returned %v fields, aggregate %v is missing", len(fields), col+1)
+			}
+			v, err := combineValues(function, fields[col].Type, combined[i][col], row[col])
+			if err != nil {
+				return nil, fmt.Errorf("cannot combine %v: %v", fields[col].Name, err)
+			}
+			combined[i][col] = v
+		}
+	}
+	return combined, nil
+}
+
+// combineValues returns the aggregate of a and b.
+func combineValues(function string, typ int64, a, b sqltypes.Value) (sqltypes.Value, error) {
+	if a.IsNull() {
+		return b, nil
+	}
+	if b.IsNull() {
+		return a, nil
+	}
+	switch function {
+	case "count", "sum":
+		return addValues(typ, a, b)
+	case "min":
+		if compareValues(typ, b, a) < 0 {
+			return b, nil
+		}
+	case "max":
+		if compareValues(typ, b, a) > 0 {
+			return b, nil
+		}
+	}
+	return a, nil
+}
+
+// addValues returns the sum of a and b, which are not NULL. Integer
+// and decimal values are added exactly.
+func addValues(typ int64, a, b sqltypes.Value) (sqltypes.Value, error) {
+	if typ == mproto.VT_FLOAT || typ == mproto.VT_DOUBLE {
+		x, err := strconv.ParseFloat(a.String(), 64)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		y, err := strconv.ParseFloat(b.String(), 64)
+		if err != nil {
+			return sqltypes.Value{}, err
+		}
+		return sqltypes.MakeFractional([]byte(strconv.FormatFloat(x+y, 'g', -1, 64))), nil
+	}
+	x, ok := new(big.Rat).SetString(a.String())
+	if !ok {
+		return sqltypes.Value{}, fmt.Errorf("invalid number %v", a.String())
+	}
+	y, ok := new(big.Rat).SetString(b.String())
+	if !ok {
+		return sqltypes.Value{}, fmt.Errorf("invalid number %v", b.String())
+	}
+	scale := decimalScale(a.String())
+	if s := decimalScale(b.String()); s > scale {
+		scale = s
+	}
+	sum := []byte(x.Add(x, y).FloatString(scale))
+	if scale == 0 {
+		return sqltypes.MakeNumeric(sum), nil
+	}
+	return sqltypes.MakeFractional(sum), nil
+}
+
+// decimalScale returns the number of digits after the decimal point.
+func decimalScale(s string) int {
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return 0
+	}
+	return len(s) - i - 1
+}
+
+// isNumericType returns true if the values of the type are compared
+// as numbers.
+func isNumericType(typ int64) bool {
+	switch typ {
+	case mproto.VT_DECIMAL, mproto.VT_TINY, mproto.VT_SHORT, mproto.VT_LONG,
+		mproto.VT_FLOAT, mproto.VT_DOUBLE, mproto.VT_LONGLONG, mproto.VT_INT24,
+		mproto.VT_YEAR, mproto.VT_NEWDECIMAL:
+		return true
+	}
+	return false
+}
+
+// compareValues returns -1, 0 or 1 if a is smaller, equal or larger
+// than b. NULL is smaller than any value.
+func compareValues(typ int64, a, b sqltypes.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	if isNumericType(typ) {
+		x, okx := new(big.Rat).SetString(a.String())
+		y, oky := new(big.Rat).SetString(b.String())
+		if okx && oky {
+			return x.Cmp(y)
+		}
+	}
+	return bytes.Compare(a.Raw(), b.Raw())
+}
+
+// rowKey returns a key identifying the values of the columns of a row.
+func rowKey(row []sqltypes.Value, columns []int) string {
+	buf := new(bytes.Buffer)
+	for _, col := range columns {
+		if row[col].IsNull() {
+			buf.WriteString("n")
+			continue
+		}
+		raw := row[col].Raw()
+		fmt.Fprintf(buf, "%v:", len(raw))
+		buf.Write(raw)
+	}
+	return buf.String()
+}
+
+// distinctRows removes the duplicate rows, keeping the first one.
+func distinctRows(rows [][]sqltypes.Value) [][]sqltypes.Value {
+	if len(rows) == 0 {
+		return rows
+	}
+	columns := make([]int, len(rows[0]))
+	for i := range columns {
+		columns[i] = i
+	}
+	seen := make(map[string]bool)
+	distinct := rows[:0]
+	for _, row := range rows {
+		key := rowKey(row, columns)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, row)
+	}
+	return distinct
+}
+
+// orderColumn is a resolved ORDER BY expression.
+type orderColumn struct {
+	index int
+	typ   int64
+	desc  bool
+}
+
+// sortRows sorts the rows by the ORDER BY columns.
+func (ss *scatterSelect) sortRows(fields []mproto.Field, rows [][]sqltypes.Value) error {
+	columns, err := ss.orderColumns(fields)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if len(row) != len(fields) {
+			return fmt.Errorf("scatter query returned %v values for %v fields", len(row), len(fields))
+		}
+	}
+	sort.Stable(&rowSorter{rows, columns})
+	return nil
+}
+
+// orderColumns resolves the ORDER BY expressions. The positions and
+// column names are resolved against the returned fields, so the
+// columns of a * can be used.
+func (ss *scatterSelect) orderColumns(fields []mproto.Field) ([]orderColumn, error) {
+	var columns []orderColumn
+	hasStar := false
+	for _, expr := range ss.sel.SelectExprs {
+		if _, ok := expr.(*sqlparser.StarExpr); ok {
+			hasStar = true
+		}
+	}
+	for _, order := range ss.sel.OrderBy {
+		index := -1
+		switch expr := order.Expr.(type) {
+		case sqlparser.NumVal:
+			if pos, err := strconv.Atoi(string(expr)); err == nil {
+				index = pos - 1
+			}
+		case *sqlparser.ColName:
+			for i, field := range fields {
+				if strings.EqualFold(field.Name, string(expr.Name)) {
+					index = i
+					break
+				}
+			}
+		}
+		if index < 0 && !hasStar {
+			index = findSelectExpr(ss.sel, order.Expr)
+		}
+		if index < 0 || index >= len(fields) {
+			return nil, fmt.Errorf("order by expression %v is not in the select list of a scatter query", sqlparser.String(order.Expr))
+		}
+		columns = append(columns, orderColumn{index, fields[index].Type, order.Direction == sqlparser.AST_DESC})
+	}
+	return columns, nil
+}
+
+// compareRows returns -1, 0 or 1 if a sorts before, with or after b
+// by columns.
+func compareRows(columns []orderColumn, a, b []sqltypes.Value) int {
+	for _, col := range columns {
+		c := compareValues(col.typ, a[col.index], b[col.index])
+		if c == 0 {
+			continue
+		}
+		if col.desc {
+			return -c
+		}
+		return c
+	}
+	return 0
+}
+
+// rowSorter sorts rows by a list of columns.
+type rowSorter struct {
+	rows    [][]sqltypes.Value
+	columns []orderColumn
+}
+
+func (rs *rowSorter) Len() int {
+	return len(rs.rows)
+}
+
+func (rs *rowSorter) Swap(i, j int) {
+	rs.rows[i], rs.rows[j] = rs.rows[j], rs.rows[i]
+}
+
+func (rs *rowSorter) Less(i, j int) bool {
+	return compareRows(rs.columns, rs.rows[i], rs.rows[j]) < 0
+}
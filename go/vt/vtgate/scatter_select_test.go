@@ -0,0 +1,259 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+// makeResult builds a result from rows of values, "NULL" being NULL.
+func makeResult(fields []mproto.Field, rows ...[]string) *mproto.QueryResult {
+	qr := &mproto.QueryResult{Fields: fields, RowsAffected: uint64(len(rows))}
+	for _, row := range rows {
+		var values []sqltypes.Value
+		for _, v := range row {
+			if v == "NULL" {
+				values = append(values, sqltypes.Value{})
+				continue
+			}
+			values = append(values, sqltypes.MakeString([]byte(v)))
+		}
+		qr.Rows = append(qr.Rows, values)
+	}
+	return qr
+}
+
+// resultString returns the rows of a result, as "a,b;c,d".
+func resultString(qr *mproto.QueryResult) string {
+	var rows []string
+	for _, row := range qr.Rows {
+		var values []string
+		for _, v := range row {
+			if v.IsNull() {
+				values = append(values, "NULL")
+				continue
+			}
+			values = append(values, v.String())
+		}
+		rows = append(rows, strings.Join(values, ","))
+	}
+	return strings.Join(rows, ";")
+}
+
+func TestScatterSelectQuery(t *testing.T) {
+	table := []struct {
+		sql, query string
+	}{
+		{"select a from t", ""},
+		{"insert into t values (1)", ""},
+		{"not sql", ""},
+		{"select a from t order by a desc", "select a from t order by a desc"},
+		{"select a from t order by a limit 10", "select a from t order by a asc limit 10"},
+		{"select a from t limit 5, 10", "select a from t limit 15"},
+		{"select a from t limit :offset, :count", "select a from t limit 30"},
+		{"select count(*) from t limit 1", "select count(*) from t"},
+		{"select a, sum(b) from t group by a", "select a, sum(b) from t group by a"},
+		{"select distinct a from t", "select distinct a from t"},
+		{"select t.a, b as c from t order by a, c", "select t.a, b as c from t order by a asc, c asc"},
+		{"select * from t order by missing", "select * from t order by missing asc"},
+		{"select count(*) from t where a = (select max(b) from u)", "select count(*) from t where a = (select max(b) from u)"},
+	}
+	bindVars := map[string]interface{}{"offset": 10, "count": int64(20)}
+	for _, tc := range table {
+		ss, err := newScatterSelect(tc.sql, bindVars)
+		if err != nil {
+			t.Errorf("newScatterSelect(%v): %v", tc.sql, err)
+			continue
+		}
+		query := ""
+		if ss != nil {
+			query = ss.query
+		}
+		if query != tc.query {
+			t.Errorf("newScatterSelect(%v): got %q, want %q", tc.sql, query, tc.query)
+		}
+	}
+
+	for _, sql := range []string{
+		"select count(distinct a) from t",
+		"select avg(a) from t",
+		"select *, count(*) from t",
+		"select a from t group by b",
+		"select a, count(*) from t group by a having count(*) > 1",
+		"select a from t limit :missing",
+		"select count(*)+1 from t",
+		"select ifnull(sum(a), 0) from t",
+		"select sum(a)/count(*) from t",
+		"select a, -max(b) from t group by a",
+		"select a from t order by b",
+		"select a from t order by a + 1",
+	} {
+		if _, err := newScatterSelect(sql, bindVars); err == nil {
+			t.Errorf("newScatterSelect(%v) didn't fail", sql)
+		}
+	}
+}
+
+func TestScatterSelectMerge(t *testing.T) {
+	fields := []mproto.Field{
+		{"name", mproto.VT_VAR_STRING},
+		{"id", mproto.VT_LONGLONG},
+	}
+	shard1 := makeResult(fields, []string{"b", "2"}, []string{"c", "10"}, []string{"NULL", "12"})
+	shard2 := makeResult(fields, []string{"a", "9"}, []string{"b", "3"})
+	table := []struct {
+		sql, want string
+	}{
+		{"select name, id from t order by id", "b,2;b,3;a,9;c,10;NULL,12"},
+		{"select name, id from t order by name desc, id desc", "c,10;b,3;b,2;a,9;NULL,12"},
+		{"select * from t order by 1", "NULL,12;a,9;b,2;b,3;c,10"},
+		{"select name, id as x from t order by x desc limit 1, 2", "c,10;a,9"},
+		{"select name, id from t order by id limit 10, 2", ""},
+		{"select distinct name from t order by name", "NULL;a;b;c"},
+	}
+	for _, tc := range table {
+		ss, err := newScatterSelect(tc.sql, nil)
+		if err != nil {
+			t.Fatalf("newScatterSelect(%v): %v", tc.sql, err)
+		}
+		results := []*mproto.QueryResult{shard1, shard2}
+		if strings.HasPrefix(tc.sql, "select distinct") {
+			results = []*mproto.QueryResult{
+				makeResult(fields[:1], []string{"b"}, []string{"c"}, []string{"NULL"}),
+				makeResult(fields[:1], []string{"a"}, []string{"b"}),
+			}
+		}
+		qr, err := ss.merge(results)
+		if err != nil {
+			t.Errorf("merge(%v): %v", tc.sql, err)
+			continue
+		}
+		if got := resultString(qr); got != tc.want {
+			t.Errorf("merge(%v): got %v, want %v", tc.sql, got, tc.want)
+		}
+		if qr.RowsAffected != uint64(len(qr.Rows)) {
+			t.Errorf("merge(%v): RowsAffected %v for %v rows", tc.sql, qr.RowsAffected, len(qr.Rows))
+		}
+	}
+
+	// With a *, the order by columns are resolved by the merge.
+	ss, err := newScatterSelect("select * from t order by other", nil)
+	if err != nil {
+		t.Fatalf("newScatterSelect: %v", err)
+	}
+	if _, err := ss.merge([]*mproto.QueryResult{shard1, shard2}); err == nil {
+		t.Errorf("merge didn't fail for an unknown order by column")
+	}
+}
+
+func TestScatterSelectAggregates(t *testing.T) {
+	fields := []mproto.Field{
+		{"kind", mproto.VT_VAR_STRING},
+		{"count(*)", mproto.VT_LONGLONG},
+		{"sum(amount)", mproto.VT_NEWDECIMAL},
+		{"min(price)", mproto.VT_DOUBLE},
+		{"max(name)", mproto.VT_VAR_STRING},
+	}
+	shard1 := makeResult(fields,
+		[]string{"x", "2", "10.5", "3.5", "bob"},
+		[]string{"y", "1", "NULL", "NULL", "NULL"})
+	shard2 := makeResult(fields,
+		[]string{"z", "4", "7", "20", "alice"},
+		[]string{"x", "3", "0.25", "12", "carol"})
+
+	ss, err := newScatterSelect("select kind, count(*), sum(amount), min(price), max(name) from t group by kind order by 2 desc", nil)
+	if err != nil {
+		t.Fatalf("newScatterSelect: %v", err)
+	}
+	qr, err := ss.merge([]*mproto.QueryResult{shard1, shard2})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got, want := resultString(qr), "x,5,10.75,3.5,carol;z,4,7,20,alice;y,1,NULL,NULL,NULL"; got != want {
+		t.Errorf("merge: got %v, want %v", got, want)
+	}
+
+	// without group by, all the rows are combined
+	ss, err = newScatterSelect("select count(*), sum(amount) from t", nil)
+	if err != nil {
+		t.Fatalf("newScatterSelect: %v", err)
+	}
+	countFields := []mproto.Field{{"count(*)", mproto.VT_LONGLONG}, {"sum(amount)", mproto.VT_NEWDECIMAL}}
+	qr, err = ss.merge([]*mproto.QueryResult{
+		makeResult(countFields, []string{"9223372036854775807", "1"}),
+		makeResult(countFields, []string{"1", "NULL"}),
+		makeResult(countFields, []string{"0", "2"}),
+	})
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if got, want := resultString(qr), "9223372036854775808,3"; got != want {
+		t.Errorf("merge: got %v, want %v", got, want)
+	}
+}
+
+// queryConn returns the same rows for any query, and records the
+// queries it gets.
+type queryConn struct {
+	*sandboxConn
+	qr      *mproto.QueryResult
+	mu      sync.Mutex
+	queries []string
+}
+
+func (qc *queryConn) Execute(context context.Context, query string, bindVars map[string]interface{}, transactionID int64) (*mproto.QueryResult, error) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	qc.queries = append(qc.queries, query)
+	return qc.qr, nil
+}
+
+func TestScatterConnExecuteMerge(t *testing.T) {
+	s := createSandbox("TestScatterConnExecuteMerge")
+	fields := []mproto.Field{{"id", mproto.VT_LONGLONG}}
+	var conns []*queryConn
+	for i, shard := range []string{"0", "1", "2"} {
+		qc := &queryConn{
+			sandboxConn: &sandboxConn{},
+			qr:          makeResult(fields, []string{fmt.Sprintf("%v", 3-i)}, []string{fmt.Sprintf("%v", 10+i)}),
+		}
+		s.MapTestConn(shard, qc)
+		conns = append(conns, qc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+
+	qr, err := stc.Execute(&context.DummyContext{}, "select id from t order by id limit 1, 3", nil, "TestScatterConnExecuteMerge", []string{"0", "1", "2"}, "", nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got, want := resultString(qr), "2;3;10"; got != want {
+		t.Errorf("Execute: got %v, want %v", got, want)
+	}
+	for _, qc := range conns {
+		if len(qc.queries) != 1 || qc.queries[0] != "select id from t order by id asc limit 4" {
+			t.Errorf("shard queries: %v", qc.queries)
+		}
+	}
+
+	// a single shard gets the query as is
+	qr, err = stc.Execute(&context.DummyContext{}, "select id from t order by id limit 1, 3", nil, "TestScatterConnExecuteMerge", []string{"0"}, "", nil)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got, want := resultString(qr), "3;10"; got != want {
+		t.Errorf("Execute: got %v, want %v", got, want)
+	}
+	if q := conns[0].queries[1]; q != "select id from t order by id limit 1, 3" {
+		t.Errorf("single shard query: %v", q)
+	}
+}
@@ -5,17 +5,43 @@
 package vtgate
 
 import (
+	"flag"
 	"fmt"
 	"sync"
 	"time"
 
+	log "github.com/golang/glog"
 	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/stats"
 	"github.com/youtube/vitess/go/vt/context"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
 	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
 	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
+var (
+	retryDeadline = flag.Duration("retry_deadline", 30*time.Second, "time after which vtgate stops retrying a failed tablet call; 0 means no deadline")
+
+	// retryCounts counts the retries of tablet calls by cause.
+	retryCounts = stats.NewMultiCounters("VtgateRetryCounts", []string{"Keyspace", "ShardName", "DbType", "Cause"})
+)
+
+// The causes of retries, as exported in VtgateRetryCounts.
+const (
+	// The tablet is not serving, e.g. it is being restarted or reparented.
+	retryNotServing = "NotServing"
+	// The tablet no longer serves the keyspace and shard, e.g. it was
+	// reassigned to a different one.
+	retryWrongTablet = "WrongTablet"
+	// The tablet could not be dialed, or the connection to it failed.
+	retryConnection = "Connection"
+	// The call did not return within the timeout.
+	retryTimeout = "Timeout"
+	// The tablet has no transaction left to hand out.
+	retryTxPoolFull = "TxPoolFull"
+)
+
 // ShardConn represents a load balanced connection to a group
 // of vttablets that belong to the same shard. ShardConn can
 // be concurrently used across goroutines. Such requests are
@@ -27,11 +53,19 @@ type ShardConn struct {
 	retryDelay time.Duration
 	retryCount int
 	timeout    time.Duration
-	balancer   *Balancer
+	balancer   endPointPicker
+
+	// retryDeadline bounds the time spent retrying a call.
+	retryDeadline time.Duration
 
 	// conn needs a mutex because it can change during the lifetime of ShardConn.
 	mu   sync.Mutex
 	conn tabletconn.TabletConn
+
+	// twoPCConn is the connection whose two-phase commit support
+	// is known, twoPCSupported that support.
+	twoPCConn      tabletconn.TabletConn
+	twoPCSupported bool
 }
 
 // NewShardConn creates a new ShardConn. It creates a Balancer using
@@ -47,16 +81,28 @@ func NewShardConn(ctx context.Context, serv SrvTopoServer, cell, keyspace, shard
 	}
 	blc := NewBalancer(getAddresses, retryDelay)
 	return &ShardConn{
-		keyspace:   keyspace,
-		shard:      shard,
-		tabletType: tabletType,
-		retryDelay: retryDelay,
-		retryCount: retryCount,
-		timeout:    timeout,
-		balancer:   blc,
+		keyspace:      keyspace,
+		shard:         shard,
+		tabletType:    tabletType,
+		retryDelay:    retryDelay,
+		retryCount:    retryCount,
+		timeout:       timeout,
+		balancer:      blc,
+		retryDeadline: *retryDeadline,
 	}
 }
 
+// endPointPicker picks the end points a ShardConn sends its queries
+// to. It is implemented by Balancer, and by TabletDiscovery for
+// health based routing.
+type endPointPicker interface {
+	// Get returns the end point to use.
+	Get() (topo.EndPoint, error)
+
+	// MarkDown reports that an end point failed.
+	MarkDown(uid uint32, reason string)
+}
+
 type ShardConnError struct {
 	Code            int
 	ShardIdentifier string
@@ -134,6 +180,165 @@ func (sdc *ShardConn) Rollback(ctx context.Context, transactionID int64) (err er
 	}, transactionID, false)
 }
 
+// SupportsTwoPC returns true if the tablet of the shard can take part
+// in two-phase commits. The tablet is asked the first time, since it
+// can have them disabled, and its answer is kept for the connection.
+func (sdc *ShardConn) SupportsTwoPC(ctx context.Context) bool {
+	conn, _, err, _ := sdc.getConn(ctx)
+	if err != nil {
+		return false
+	}
+	twoPCConn, ok := conn.(tabletconn.TwoPCConn)
+	if !ok {
+		return false
+	}
+	sdc.mu.Lock()
+	if sdc.twoPCConn == conn {
+		supported := sdc.twoPCSupported
+		sdc.mu.Unlock()
+		return supported
+	}
+	sdc.mu.Unlock()
+
+	// Rolling back a distributed transaction that doesn't exist is a
+	// no-op, which only fails if two-phase commits are disabled.
+	supported := true
+	if err := twoPCConn.RollbackPrepared(ctx, ""); err != nil {
+		log.Infof("two-phase commit not supported by %v/%v on %v: %v", sdc.keyspace, sdc.shard, conn.EndPoint().Host, err)
+		supported = false
+	}
+	sdc.mu.Lock()
+	sdc.twoPCConn, sdc.twoPCSupported = conn, supported
+	sdc.mu.Unlock()
+	return supported
+}
+
+// PrepareTransaction prepares the current transaction for the
+// distributed transaction dtid. The retry rules are the same as
+// Execute.
+func (sdc *ShardConn) PrepareTransaction(ctx context.Context, transactionID int64, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.PrepareTransaction(ctx, transactionID, dtid)
+	}, transactionID, false)
+}
+
+// CommitPrepared commits the transaction prepared for dtid. It is
+// retried on connection errors, as it doesn't depend on the
+// connection.
+func (sdc *ShardConn) CommitPrepared(ctx context.Context, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.CommitPrepared(ctx, dtid)
+	}, 0, false)
+}
+
+// RollbackPrepared rolls back the transaction prepared for dtid. The
+// retry rules are the same as CommitPrepared.
+func (sdc *ShardConn) RollbackPrepared(ctx context.Context, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.RollbackPrepared(ctx, dtid)
+	}, 0, false)
+}
+
+// CreateTransaction saves the transaction record of dtid, with its
+// other participants. The retry rules are the same as CommitPrepared.
+func (sdc *ShardConn) CreateTransaction(ctx context.Context, dtid string, participants []tproto.TwoPCParticipant) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.CreateTransaction(ctx, dtid, participants)
+	}, 0, false)
+}
+
+// StartCommit records the decision to commit dtid, and commits the
+// current transaction with it. The retry rules are the same as
+// Execute.
+func (sdc *ShardConn) StartCommit(ctx context.Context, transactionID int64, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.StartCommit(ctx, transactionID, dtid)
+	}, transactionID, false)
+}
+
+// SetRollback records the decision to roll back dtid. The retry rules
+// are the same as CommitPrepared.
+func (sdc *ShardConn) SetRollback(ctx context.Context, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.SetRollback(ctx, dtid)
+	}, 0, false)
+}
+
+// ConcludeTransaction deletes the transaction record of dtid. The
+// retry rules are the same as CommitPrepared.
+func (sdc *ShardConn) ConcludeTransaction(ctx context.Context, dtid string) (err error) {
+	return sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		return twoPCConn.ConcludeTransaction(ctx, dtid)
+	}, 0, false)
+}
+
+// ReadAbandoned returns the transaction records older than age. The
+// retry rules are the same as CommitPrepared.
+func (sdc *ShardConn) ReadAbandoned(ctx context.Context, age time.Duration) (transactions []tproto.DistributedTransaction, err error) {
+	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		twoPCConn, err := asTwoPCConn(conn)
+		if err != nil {
+			return err
+		}
+		transactions, err = twoPCConn.ReadAbandoned(ctx, age)
+		return err
+	}, 0, false)
+	return transactions, err
+}
+
+func asTwoPCConn(conn tabletconn.TabletConn) (tabletconn.TwoPCConn, error) {
+	twoPCConn, ok := conn.(tabletconn.TwoPCConn)
+	if !ok {
+		return nil, fmt.Errorf("vttablet: two-phase commit not supported")
+	}
+	return twoPCConn, nil
+}
+
+// ReplicationPosition returns the replication position of the
+// tablet, see tabletconn.PositionConn. It is retried like
+// CommitPrepared.
+func (sdc *ShardConn) ReplicationPosition(ctx context.Context) (pos myproto.GTID, err error) {
+	err = sdc.withRetry(ctx, func(conn tabletconn.TabletConn) error {
+		positionConn, ok := conn.(tabletconn.PositionConn)
+		if !ok {
+			// Not a tablet failure, it must not be marked down.
+			return &tabletconn.ServerError{Code: tabletconn.ERR_NORMAL, Err: "vttablet: replication position not supported"}
+		}
+		var innerErr error
+		pos, innerErr = positionConn.ReplicationPosition(ctx)
+		return innerErr
+	}, 0, false)
+	return pos, err
+}
+
 // Close closes the underlying TabletConn. ShardConn can be
 // reused after this because it opens connections on demand.
 func (sdc *ShardConn) Close() {
@@ -156,12 +361,24 @@ func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn
 	var endPoint topo.EndPoint
 	var err error
 	var retry bool
+	var cause string
 	inTransaction := (transactionID != 0)
+	var deadline time.Time
+	if sdc.retryDeadline > 0 {
+		deadline = time.Now().Add(sdc.retryDeadline)
+	}
 	// execute the action at least once even without retrying
 	for i := 0; i < sdc.retryCount+1; i++ {
+		if i > 0 {
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				break
+			}
+			sdc.countRetry(cause)
+		}
 		conn, endPoint, err, retry = sdc.getConn(ctx)
 		if err != nil {
 			if retry {
+				cause = retryConnection
 				continue
 			}
 			return sdc.WrapError(err, endPoint, inTransaction)
@@ -170,7 +387,14 @@ func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn
 		if isStreaming {
 			err = action(conn)
 		} else {
-			timer := time.After(sdc.timeout)
+			// Retries must not run past the deadline.
+			timeout := sdc.timeout
+			if i > 0 && !deadline.IsZero() {
+				if remaining := deadline.Sub(time.Now()); remaining < timeout {
+					timeout = remaining
+				}
+			}
+			timer := time.After(timeout)
 			done := make(chan int)
 			var errAction error
 			go func() {
@@ -179,12 +403,12 @@ func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn
 			}()
 			select {
 			case <-timer:
-				err = tabletconn.OperationalError("vttablet: call timeout")
+				err = errCallTimeout
 			case <-done:
 				err = errAction
 			}
 		}
-		if sdc.canRetry(err, transactionID, conn) {
+		if cause = sdc.retryCause(err, transactionID, conn); cause != "" {
 			continue
 		}
 		return sdc.WrapError(err, endPoint, inTransaction)
@@ -192,6 +416,14 @@ func (sdc *ShardConn) withRetry(ctx context.Context, action func(conn tabletconn
 	return sdc.WrapError(err, endPoint, inTransaction)
 }
 
+// errCallTimeout is returned when a tablet call times out.
+var errCallTimeout = tabletconn.OperationalError("vttablet: call timeout")
+
+// countRetry records a retry in VtgateRetryCounts.
+func (sdc *ShardConn) countRetry(cause string) {
+	retryCounts.Add([]string{sdc.keyspace, sdc.shard, string(sdc.tabletType), cause}, 1)
+}
+
 // getConn reuses an existing connection if possible. Otherwise
 // it returns a connection which it will save for future reuse.
 // If it returns an error,  retry will tell you if getConn can be retried.
@@ -215,30 +447,40 @@ func (sdc *ShardConn) getConn(ctx context.Context) (conn tabletconn.TabletConn,
 	return sdc.conn, endPoint, nil, false
 }
 
-// canRetry determines whether a query can be retried or not.
+// retryCause determines whether a query can be retried or not, and
+// returns the cause of the retry, or "" if it cannot be retried.
 // OperationalErrors like retry/fatal cause a reconnect and retry if query is not in a txn.
+// The reconnect re-resolves the end points of the shard.
 // TxPoolFull causes a retry and all other errors are non-retry.
-func (sdc *ShardConn) canRetry(err error, transactionID int64, conn tabletconn.TabletConn) bool {
+func (sdc *ShardConn) retryCause(err error, transactionID int64, conn tabletconn.TabletConn) string {
 	if err == nil {
-		return false
+		return ""
+	}
+	cause := retryConnection
+	if err == errCallTimeout {
+		cause = retryTimeout
 	}
 	if serverError, ok := err.(*tabletconn.ServerError); ok {
 		switch serverError.Code {
 		case tabletconn.ERR_TX_POOL_FULL:
 			// Retry without reconnecting.
 			time.Sleep(sdc.retryDelay)
-			return true
-		case tabletconn.ERR_RETRY, tabletconn.ERR_FATAL:
-			// No-op: treat these errors as operational by breaking out of this switch
+			return retryTxPoolFull
+		case tabletconn.ERR_RETRY:
+			cause = retryNotServing
+		case tabletconn.ERR_FATAL:
+			cause = retryWrongTablet
 		default:
 			// Should not retry for normal server errors.
-			return false
+			return ""
 		}
 	}
 	// Non-server errors or fatal/retry errors. Retry if we're not in a transaction.
-	inTransaction := (transactionID != 0)
 	sdc.markDown(conn, err.Error())
-	return !inTransaction
+	if transactionID != 0 {
+		return ""
+	}
+	return cause
 }
 
 // markDown closes conn and temporarily marks the associated
@@ -256,6 +498,16 @@ func (sdc *ShardConn) markDown(conn tabletconn.TabletConn, reason string) {
 	sdc.conn = nil
 }
 
+// endPoint returns the end point of the current connection, if any.
+func (sdc *ShardConn) endPoint() (topo.EndPoint, bool) {
+	sdc.mu.Lock()
+	defer sdc.mu.Unlock()
+	if sdc.conn == nil {
+		return topo.EndPoint{}, false
+	}
+	return sdc.conn.EndPoint(), true
+}
+
 // WrapError returns ShardConnError which preserves the original error code if possible,
 // adds the connection context
 // and adds a bit to determine whether the keyspace/shard needs to be
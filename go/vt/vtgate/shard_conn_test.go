@@ -261,3 +261,43 @@ func TestShardConnBeginOther(t *testing.T) {
 		t.Errorf("want 2, got %v", sbc.ExecCount)
 	}
 }
+
+func TestShardConnRetryCounts(t *testing.T) {
+	s := createSandbox("TestShardConnRetryCounts")
+	s.DialMustFail = 1
+	sbc := &sandboxConn{mustFailRetry: 1, mustFailFatal: 1, mustFailConn: 1, mustFailTxPool: 1}
+	s.MapTestConn("0", sbc)
+	sdc := NewShardConn(&context.DummyContext{}, new(sandboxTopo), "aa", "TestShardConnRetryCounts", "0", "", 1*time.Millisecond, 5, 1*time.Millisecond)
+	if _, err := sdc.Execute(nil, "query", nil, 0); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	counts := retryCounts.Counts()
+	for cause, want := range map[string]int64{
+		retryConnection:  2,
+		retryNotServing:  1,
+		retryWrongTablet: 1,
+		retryTxPoolFull:  1,
+		retryTimeout:     0,
+	} {
+		if got := counts["TestShardConnRetryCounts.0.."+cause]; got != want {
+			t.Errorf("%v retries: want %v, got %v", cause, want, got)
+		}
+	}
+}
+
+func TestShardConnRetryDeadline(t *testing.T) {
+	s := createSandbox("TestShardConnRetryDeadline")
+	sbc := &sandboxConn{mustFailRetry: 3}
+	s.MapTestConn("0", sbc)
+	sdc := NewShardConn(&context.DummyContext{}, new(sandboxTopo), "aa", "TestShardConnRetryDeadline", "0", "", 1*time.Millisecond, 3, 1*time.Millisecond)
+	sdc.retryDeadline = 1 * time.Nanosecond
+	_, err := sdc.Execute(nil, "query", nil, 0)
+	want := "retry: err, shard, host: TestShardConnRetryDeadline.0., {Uid:0 Host:0 NamedPortMap:map[vt:1] Health:map[]}"
+	if err == nil || err.Error() != want {
+		t.Errorf("want %s, got %v", want, err)
+	}
+	// The deadline passed before the first retry.
+	if sbc.ExecCount != 1 {
+		t.Errorf("want 1, got %v", sbc.ExecCount)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+	"github.com/youtube/vitess/go/vt/topo"
+)
+
+// This file contains the stats of the tablet calls per keyspace,
+// shard and tablet type: their latency is in the timings of the
+// ScatterConn, their errors are counted by error code, and the rates
+// of both are tracked over the last 15 minutes. A shard whose error
+// rate is above -error_budget is flagged on the status page.
+
+var errorBudget = flag.Float64("error_budget", 0.01, "fraction of the tablet calls of a shard that can fail over the last 15 minutes before the shard is reported as over its error budget")
+
+// errorCodes are the names of the tabletconn error codes in the stats.
+var errorCodes = map[int]string{
+	tabletconn.ERR_NORMAL:            "Normal",
+	tabletconn.ERR_RETRY:             "Retry",
+	tabletconn.ERR_FATAL:             "Fatal",
+	tabletconn.ERR_TX_POOL_FULL:      "TxPoolFull",
+	tabletconn.ERR_NOT_IN_TX:         "NotInTx",
+	tabletconn.ERR_PERMISSION_DENIED: "PermissionDenied",
+	tabletconn.ERR_RESULT_TOO_LARGE:  "ResultTooLarge",
+	tabletconn.ERR_QUOTA_EXCEEDED:    "QuotaExceeded",
+}
+
+// errorCode returns the name of the code of err for the stats. The
+// errors that don't come from a tablet are "Other".
+func errorCode(err error) string {
+	if shardConnErr, ok := err.(*ShardConnError); ok {
+		if name, ok := errorCodes[shardConnErr.Code]; ok {
+			return name
+		}
+	}
+	return "Other"
+}
+
+// initShardStats creates the error counts and the rates of the
+// ScatterConn. They are exported under statsName if it's not empty.
+func (stc *ScatterConn) initShardStats(statsName string) {
+	name := func(suffix string) string {
+		if statsName == "" {
+			return ""
+		}
+		return statsName + suffix
+	}
+	stc.errorCounts = stats.NewMultiCounters(name("ErrorCount"), []string{"Keyspace", "ShardName", "DbType", "Code"})
+	stc.qpsByShard = stats.NewRates(name("QPSByShard"), stats.CounterForDimensions(stc.timings, "Keyspace", "ShardName", "DbType"), 15, 1*time.Minute)
+	stc.errorsByShard = stats.NewRates(name("ErrorsByShard"), stats.CounterForDimensions(stc.errorCounts, "Keyspace", "ShardName", "DbType"), 15, 1*time.Minute)
+	stats.NewRates(name("ErrorsByCode"), stats.CounterForDimension(stc.errorCounts, "Code"), 15, 1*time.Minute)
+}
+
+// ShardStatus is the status of the tablet calls of a keyspace, shard
+// and tablet type, for the status page.
+type ShardStatus struct {
+	Keyspace   string
+	Shard      string
+	TabletType topo.TabletType
+
+	// EndPoint is the tablet the calls are sent to. Connected is
+	// false if there is no connection to a tablet.
+	EndPoint  topo.EndPoint
+	Connected bool
+
+	// QueryCount and ErrorCount are the number of calls and
+	// errors since vtgate started, AvgLatency their average
+	// latency.
+	QueryCount int64
+	ErrorCount int64
+	AvgLatency time.Duration
+
+	// QPS is the latest rate of calls. ErrorRate is the fraction
+	// of the calls that failed over the last 15 minutes.
+	QPS        float64
+	ErrorRate  float64
+	OverBudget bool
+}
+
+// ShardStatus returns the status of the shards vtgate sent queries
+// to, sorted by keyspace, shard and tablet type.
+func (stc *ScatterConn) ShardStatus() []*ShardStatus {
+	stc.mu.Lock()
+	keys := make([]string, 0, len(stc.shardConns))
+	shardConns := make(map[string]*ShardConn, len(stc.shardConns))
+	for key, sdc := range stc.shardConns {
+		keys = append(keys, key)
+		shardConns[key] = sdc
+	}
+	stc.mu.Unlock()
+	sort.Strings(keys)
+
+	// The timings and errors are keyed by keyspace.shard.type,
+	// after the operation for the timings.
+	histograms := stc.timings.Histograms()
+	errorCounts := stats.CounterForDimensions(stc.errorCounts, "Keyspace", "ShardName", "DbType").Counts()
+	qps := stc.qpsByShard.Get()
+	errorRates := stc.errorsByShard.Get()
+
+	var result []*ShardStatus
+	for _, key := range keys {
+		sdc := shardConns[key]
+		status := &ShardStatus{
+			Keyspace:   sdc.keyspace,
+			Shard:      sdc.shard,
+			TabletType: sdc.tabletType,
+			ErrorCount: errorCounts[key],
+		}
+		status.EndPoint, status.Connected = sdc.endPoint()
+
+		var total int64
+		for name, histogram := range histograms {
+			if strings.HasSuffix(name, "."+key) {
+				status.QueryCount += histogram.Count()
+				total += histogram.Total()
+			}
+		}
+		if status.QueryCount > 0 {
+			status.AvgLatency = time.Duration(total / status.QueryCount)
+		}
+
+		var calls, errors float64
+		for i, rate := range qps[key] {
+			calls += rate
+			if i == len(qps[key])-1 {
+				status.QPS = rate
+			}
+		}
+		for _, rate := range errorRates[key] {
+			errors += rate
+		}
+		if calls > 0 {
+			status.ErrorRate = errors / calls
+		}
+		status.OverBudget = status.ErrorRate > *errorBudget
+		result = append(result, status)
+	}
+	return result
+}
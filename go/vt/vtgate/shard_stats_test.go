@@ -0,0 +1,66 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/vt/context"
+)
+
+func TestErrorCode(t *testing.T) {
+	testcases := []struct {
+		err  error
+		want string
+	}{
+		{&ShardConnError{Code: 0, Err: "err"}, "Normal"},
+		{&ShardConnError{Code: 3, Err: "tx_pool_full: err"}, "TxPoolFull"},
+		{&ShardConnError{Code: 100, Err: "err"}, "Other"},
+		{fmt.Errorf("session error"), "Other"},
+	}
+	for _, tc := range testcases {
+		if got := errorCode(tc.err); got != tc.want {
+			t.Errorf("errorCode(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestScatterConnShardStatus(t *testing.T) {
+	s := createSandbox("TestScatterConnShardStatus")
+	sbc0 := &sandboxConn{}
+	s.MapTestConn("0", sbc0)
+	sbc1 := &sandboxConn{mustFailServer: 1}
+	s.MapTestConn("1", sbc1)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		stc.Execute(&context.DummyContext{}, "query", nil, "TestScatterConnShardStatus", []string{"0", "1"}, "", nil)
+	}
+	if got := stc.errorCounts.Counts()["TestScatterConnShardStatus.1..Normal"]; got != 1 {
+		t.Errorf("server errors: %v, want 1", got)
+	}
+
+	status := stc.ShardStatus()
+	if len(status) != 2 {
+		t.Fatalf("ShardStatus: %+v, want 2 shards", status)
+	}
+	for i, want := range []struct {
+		shard                  string
+		queryCount, errorCount int64
+	}{
+		{"0", 2, 0},
+		{"1", 2, 1},
+	} {
+		got := status[i]
+		if got.Keyspace != "TestScatterConnShardStatus" || got.Shard != want.shard || got.QueryCount != want.queryCount || got.ErrorCount != want.errorCount {
+			t.Errorf("ShardStatus[%v] = %+v, want shard %v with %v queries and %v errors", i, got, want.shard, want.queryCount, want.errorCount)
+		}
+		if !got.Connected {
+			t.Errorf("ShardStatus[%v] is not connected", i)
+		}
+	}
+}
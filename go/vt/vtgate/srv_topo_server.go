@@ -23,6 +23,7 @@ import (
 var (
 	srvTopoCacheTTL    = flag.Duration("srv_topo_cache_ttl", 1*time.Second, "how long to use cached entries for topology")
 	enableRemoteMaster = flag.Bool("enable_remote_master", false, "enable remote master access")
+	srvTopoWatch       = flag.Bool("srv_topo_watch", false, "watch the SrvKeyspace and EndPoints objects to get their changes, instead of reading them again after srv_topo_cache_ttl")
 )
 
 const (
@@ -31,6 +32,7 @@ const (
 	errorCategory       = "error"
 	remoteQueryCategory = "remote-query"
 	remoteErrorCategory = "remote-error"
+	staleCategory       = "stale"
 )
 
 // SrvTopoServer is a subset of topo.Server that only contains the serving
@@ -47,10 +49,17 @@ type SrvTopoServer interface {
 // on a topo.Server that uses a cache for two purposes:
 // - limit the QPS to the underlying topo.Server
 // - return the last known value of the data if there is an error
+//
+// With watchSrvGraph, the SrvKeyspace and EndPoints entries are kept
+// up to date by watches (see topo.SrvGraphWatcher) instead of being
+// read again after cacheTTL. If a watch fails, the entry is marked
+// stale and its last value is returned until the watch can be
+// started again, at most every cacheTTL.
 type ResilientSrvTopoServer struct {
 	topoServer         topo.Server
 	cacheTTL           time.Duration
 	enableRemoteMaster bool
+	watchSrvGraph      bool
 	counts             *stats.Counters
 
 	// mutex protects the cache map itself, not the individual
@@ -86,6 +95,13 @@ type srvKeyspaceEntry struct {
 	value            *topo.SrvKeyspace
 	lastError        error
 	lastErrorContext context.Context
+
+	// watching is set while a watch updates the entry, stale if
+	// the last watch failed. watchStartTime is the last time a
+	// watch was started.
+	watching       bool
+	stale          bool
+	watchStartTime time.Time
 }
 
 type endPointsEntry struct {
@@ -107,6 +123,13 @@ type endPointsEntry struct {
 	originalValue    *topo.EndPoints
 	lastError        error
 	lastErrorContext context.Context
+
+	// watching is set while a watch updates the entry, stale if
+	// the last watch failed. watchStartTime is the last time a
+	// watch was started.
+	watching       bool
+	stale          bool
+	watchStartTime time.Time
 }
 
 // filterUnhealthyServers removes the unhealthy servers from the list,
@@ -144,6 +167,7 @@ func NewResilientSrvTopoServer(base topo.Server, counterName string) *ResilientS
 		topoServer:         base,
 		cacheTTL:           *srvTopoCacheTTL,
 		enableRemoteMaster: *enableRemoteMaster,
+		watchSrvGraph:      *srvTopoWatch,
 		counts:             stats.NewCounters(counterName),
 
 		srvKeyspaceNamesCache: make(map[string]*srvKeyspaceNamesEntry),
@@ -223,6 +247,10 @@ func (server *ResilientSrvTopoServer) GetSrvKeyspace(context context.Context, ce
 	entry.mutex.Lock()
 	defer entry.mutex.Unlock()
 
+	if server.watchSrvGraph {
+		return server.getWatchedSrvKeyspace(context, entry)
+	}
+
 	// If the entry is fresh enough, return it
 	if time.Now().Sub(entry.insertionTime) < server.cacheTTL {
 		return entry.value, entry.lastError
@@ -274,6 +302,11 @@ func (server *ResilientSrvTopoServer) GetEndPoints(context context.Context, cell
 	entry.mutex.Lock()
 	defer entry.mutex.Unlock()
 
+	// the remote master needs the SrvShard too, it is not watched
+	if server.watchSrvGraph && !(server.enableRemoteMaster && tabletType == topo.TYPE_MASTER) {
+		return server.getWatchedEndPoints(context, entry)
+	}
+
 	// If the entry is fresh enough, return it
 	if time.Now().Sub(entry.insertionTime) < server.cacheTTL {
 		return entry.value, entry.lastError
@@ -317,6 +350,141 @@ func (server *ResilientSrvTopoServer) GetEndPoints(context context.Context, cell
 	return entry.value, err
 }
 
+// getWatchedSrvKeyspace returns the value of the entry, starting a
+// watch to update it if there is none. The entry has to be locked.
+func (server *ResilientSrvTopoServer) getWatchedSrvKeyspace(context context.Context, entry *srvKeyspaceEntry) (*topo.SrvKeyspace, error) {
+	if entry.watching {
+		return entry.value, entry.lastError
+	}
+
+	// don't try to start the watch more often than cacheTTL
+	if entry.stale && time.Now().Sub(entry.watchStartTime) < server.cacheTTL {
+		server.counts.Add(staleCategory, 1)
+		return entry.value, entry.lastError
+	}
+	entry.watchStartTime = time.Now()
+
+	values, err := topo.WatchSrvKeyspace(server.topoServer, entry.cell, entry.keyspace, make(chan struct{}))
+	var value *topo.SrvKeyspace
+	if err == nil {
+		var ok bool
+		if value, ok = <-values; !ok {
+			err = fmt.Errorf("watch closed")
+		}
+	}
+	if err != nil {
+		entry.stale = true
+		if entry.insertionTime.IsZero() {
+			server.counts.Add(errorCategory, 1)
+			log.Errorf("WatchSrvKeyspace(%v, %v, %v) failed: %v (no cached value, caching and returning error)", context, entry.cell, entry.keyspace, err)
+			entry.lastError = err
+			entry.lastErrorContext = context
+			return nil, err
+		}
+		server.counts.Add(staleCategory, 1)
+		log.Warningf("WatchSrvKeyspace(%v, %v, %v) failed: %v (returning stale cached value: %v %v)", context, entry.cell, entry.keyspace, err, entry.value, entry.lastError)
+		return entry.value, entry.lastError
+	}
+
+	entry.watching = true
+	entry.stale = false
+	entry.lastErrorContext = context
+	entry.setWatchedValue(value)
+	go func() {
+		for value := range values {
+			entry.mutex.Lock()
+			entry.setWatchedValue(value)
+			entry.mutex.Unlock()
+		}
+
+		log.Warningf("WatchSrvKeyspace(%v, %v) stopped, the cached value is stale until it is restarted", entry.cell, entry.keyspace)
+		entry.mutex.Lock()
+		entry.watching = false
+		entry.stale = true
+		entry.mutex.Unlock()
+	}()
+	return entry.value, entry.lastError
+}
+
+// setWatchedValue stores a value sent by the watch. The entry has to
+// be locked.
+func (entry *srvKeyspaceEntry) setWatchedValue(value *topo.SrvKeyspace) {
+	entry.insertionTime = time.Now()
+	entry.value = value
+	entry.lastError = nil
+	if value == nil {
+		entry.lastError = topo.ErrNoNode
+	}
+}
+
+// getWatchedEndPoints returns the value of the entry, starting a
+// watch to update it if there is none. The entry has to be locked.
+func (server *ResilientSrvTopoServer) getWatchedEndPoints(context context.Context, entry *endPointsEntry) (*topo.EndPoints, error) {
+	if entry.watching {
+		return entry.value, entry.lastError
+	}
+
+	// don't try to start the watch more often than cacheTTL
+	if entry.stale && time.Now().Sub(entry.watchStartTime) < server.cacheTTL {
+		server.counts.Add(staleCategory, 1)
+		return entry.value, entry.lastError
+	}
+	entry.watchStartTime = time.Now()
+
+	values, err := topo.WatchEndPoints(server.topoServer, entry.cell, entry.keyspace, entry.shard, entry.tabletType, make(chan struct{}))
+	var value *topo.EndPoints
+	if err == nil {
+		var ok bool
+		if value, ok = <-values; !ok {
+			err = fmt.Errorf("watch closed")
+		}
+	}
+	if err != nil {
+		entry.stale = true
+		if entry.insertionTime.IsZero() {
+			server.counts.Add(errorCategory, 1)
+			log.Errorf("WatchEndPoints(%v, %v, %v, %v, %v) failed: %v (no cached value, caching and returning error)", context, entry.cell, entry.keyspace, entry.shard, entry.tabletType, err)
+			entry.lastError = err
+			entry.lastErrorContext = context
+			return nil, err
+		}
+		server.counts.Add(staleCategory, 1)
+		log.Warningf("WatchEndPoints(%v, %v, %v, %v, %v) failed: %v (returning stale cached value: %v %v)", context, entry.cell, entry.keyspace, entry.shard, entry.tabletType, err, entry.value, entry.lastError)
+		return entry.value, entry.lastError
+	}
+
+	entry.watching = true
+	entry.stale = false
+	entry.lastErrorContext = context
+	entry.setWatchedValue(value)
+	go func() {
+		for value := range values {
+			entry.mutex.Lock()
+			entry.setWatchedValue(value)
+			entry.mutex.Unlock()
+		}
+
+		log.Warningf("WatchEndPoints(%v, %v, %v, %v) stopped, the cached value is stale until it is restarted", entry.cell, entry.keyspace, entry.shard, entry.tabletType)
+		entry.mutex.Lock()
+		entry.watching = false
+		entry.stale = true
+		entry.mutex.Unlock()
+	}()
+	return entry.value, entry.lastError
+}
+
+// setWatchedValue stores a value sent by the watch. The entry has to
+// be locked.
+func (entry *endPointsEntry) setWatchedValue(value *topo.EndPoints) {
+	entry.insertionTime = time.Now()
+	entry.originalValue = value
+	entry.value = filterUnhealthyServers(value)
+	entry.lastError = nil
+	if value == nil {
+		entry.lastError = topo.ErrNoNode
+	}
+}
+
 // EndpointCount returns how many endpoints we have per keyspace/shard/dbtype.
 func (server *ResilientSrvTopoServer) EndpointCount() map[string]int64 {
 	result := make(map[string]int64)
@@ -394,6 +562,7 @@ type SrvKeyspaceCacheStatus struct {
 	Value            *topo.SrvKeyspace
 	LastError        error
 	LastErrorContext context.Context
+	Stale            bool
 }
 
 // StatusAsHTML returns an HTML version of our status.
@@ -462,6 +631,7 @@ type EndPointsCacheStatus struct {
 	OriginalValue    *topo.EndPoints
 	LastError        error
 	LastErrorContext context.Context
+	Stale            bool
 }
 
 // StatusAsHTML returns an HTML version of our status.
@@ -537,6 +707,7 @@ func (server *ResilientSrvTopoServer) CacheStatus() *ResilientSrvTopoServerCache
 			Value:            entry.value,
 			LastError:        entry.lastError,
 			LastErrorContext: entry.lastErrorContext,
+			Stale:            entry.stale,
 		})
 		entry.mutex.Unlock()
 	}
@@ -552,6 +723,7 @@ func (server *ResilientSrvTopoServer) CacheStatus() *ResilientSrvTopoServerCache
 			OriginalValue:    entry.originalValue,
 			LastError:        entry.lastError,
 			LastErrorContext: entry.lastErrorContext,
+			Stale:            entry.stale,
 		})
 		entry.mutex.Unlock()
 	}
@@ -5,13 +5,16 @@
 package vtgate
 
 import (
+	"flag"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/youtube/vitess/go/vt/context"
 	"github.com/youtube/vitess/go/vt/health"
+	"github.com/youtube/vitess/go/vt/memorytopo"
 	"github.com/youtube/vitess/go/vt/topo"
 )
 
@@ -441,3 +444,122 @@ func TestCachedErrors(t *testing.T) {
 		t.Fatalf("GetSrvKeyspace was not called again: %v times", ft.callCount)
 	}
 }
+
+// waitForSrvKeyspace calls GetSrvKeyspace until check returns true,
+// or fails the test after a while.
+func waitForSrvKeyspace(t *testing.T, rsts *ResilientSrvTopoServer, cell, keyspace string, check func(*topo.SrvKeyspace, error) bool) {
+	for i := 0; i < 1000; i++ {
+		if check(rsts.GetSrvKeyspace(&context.DummyContext{}, cell, keyspace)) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("GetSrvKeyspace(%v, %v) didn't return the expected value", cell, keyspace)
+}
+
+// TestWatchSrvGraph will test the watches update the cache.
+func TestWatchSrvGraph(t *testing.T) {
+	ts := memorytopo.NewServer([]string{"cell1"})
+	rsts := NewResilientSrvTopoServer(ts, "TestWatchSrvGraph")
+	rsts.watchSrvGraph = true
+
+	// doesn't exist yet
+	if _, err := rsts.GetSrvKeyspace(&context.DummyContext{}, "cell1", "test_ks"); err != topo.ErrNoNode {
+		t.Fatalf("GetSrvKeyspace returned %v, want ErrNoNode", err)
+	}
+	if _, err := rsts.GetEndPoints(&context.DummyContext{}, "cell1", "test_ks", "0", topo.TYPE_REPLICA); err != topo.ErrNoNode {
+		t.Fatalf("GetEndPoints returned %v, want ErrNoNode", err)
+	}
+
+	// create them, the watches get the values
+	if err := ts.UpdateSrvKeyspace("cell1", "test_ks", &topo.SrvKeyspace{ShardingColumnName: "id"}); err != nil {
+		t.Fatalf("UpdateSrvKeyspace failed: %v", err)
+	}
+	waitForSrvKeyspace(t, rsts, "cell1", "test_ks", func(sk *topo.SrvKeyspace, err error) bool {
+		return err == nil && sk.ShardingColumnName == "id"
+	})
+	if err := ts.UpdateEndPoints("cell1", "test_ks", "0", topo.TYPE_REPLICA, &topo.EndPoints{Entries: []topo.EndPoint{topo.EndPoint{Uid: 1}}}); err != nil {
+		t.Fatalf("UpdateEndPoints failed: %v", err)
+	}
+	for i := 0; ; i++ {
+		ep, err := rsts.GetEndPoints(&context.DummyContext{}, "cell1", "test_ks", "0", topo.TYPE_REPLICA)
+		if err == nil && len(ep.Entries) == 1 && ep.Entries[0].Uid == 1 {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("GetEndPoints didn't return the new value: %v %v", ep, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// update it, the new value is pushed
+	if err := ts.UpdateSrvKeyspace("cell1", "test_ks", &topo.SrvKeyspace{ShardingColumnName: "user_id"}); err != nil {
+		t.Fatalf("UpdateSrvKeyspace failed: %v", err)
+	}
+	waitForSrvKeyspace(t, rsts, "cell1", "test_ks", func(sk *topo.SrvKeyspace, err error) bool {
+		return err == nil && sk.ShardingColumnName == "user_id"
+	})
+}
+
+// failingTopo hides the watches of its topo.Server, so they are
+// polled, and can make GetSrvKeyspace fail.
+type failingTopo struct {
+	topo.Server
+
+	mu   sync.Mutex
+	fail bool
+}
+
+func (ft *failingTopo) setFail(fail bool) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	ft.fail = fail
+}
+
+func (ft *failingTopo) GetSrvKeyspace(cell, keyspace string) (*topo.SrvKeyspace, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if ft.fail {
+		return nil, fmt.Errorf("topo is down")
+	}
+	return ft.Server.GetSrvKeyspace(cell, keyspace)
+}
+
+// TestWatchStale will test the cached value is returned and flagged
+// stale when the watch fails.
+func TestWatchStale(t *testing.T) {
+	flag.Set("topo_watch_poll_interval", "10ms")
+	ft := &failingTopo{Server: memorytopo.NewServer([]string{"cell1"})}
+	if err := ft.UpdateSrvKeyspace("cell1", "test_ks", &topo.SrvKeyspace{ShardingColumnName: "id"}); err != nil {
+		t.Fatalf("UpdateSrvKeyspace failed: %v", err)
+	}
+	rsts := NewResilientSrvTopoServer(ft, "TestWatchStale")
+	rsts.watchSrvGraph = true
+	rsts.cacheTTL = 10 * time.Millisecond
+
+	if sk, err := rsts.GetSrvKeyspace(&context.DummyContext{}, "cell1", "test_ks"); err != nil || sk.ShardingColumnName != "id" {
+		t.Fatalf("GetSrvKeyspace returned %v %v", sk, err)
+	}
+
+	// the topo goes down, the polling watch fails, the cached
+	// value is still returned
+	ft.setFail(true)
+	for i := 0; ; i++ {
+		if status := rsts.CacheStatus(); status.SrvKeyspaces[0].Stale {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("the entry was never marked stale")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sk, err := rsts.GetSrvKeyspace(&context.DummyContext{}, "cell1", "test_ks"); err != nil || sk.ShardingColumnName != "id" {
+		t.Fatalf("GetSrvKeyspace returned %v %v", sk, err)
+	}
+
+	// the topo comes back, the watch is restarted
+	ft.setFail(false)
+	waitForSrvKeyspace(t, rsts, "cell1", "test_ks", func(sk *topo.SrvKeyspace, err error) bool {
+		return !rsts.CacheStatus().SrvKeyspaces[0].Stale
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"container/heap"
+	"fmt"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+)
+
+// This file contains the merging of the streams of a select sent to
+// several shards. Each shard sorts its rows by the ORDER BY columns,
+// so the streams are merge-sorted as the rows arrive, and the LIMIT
+// is applied to the merged stream. The aggregates, GROUP BY and
+// DISTINCT need all the rows, they are not supported in a streaming
+// query.
+
+// streamMergeBatchSize is the number of rows sent per reply of a
+// merged stream.
+const streamMergeBatchSize = 256
+
+// checkStreamMerge returns an error if the streams of the plan can't
+// be merged.
+func checkStreamMerge(ss *scatterSelect) error {
+	if ss == nil {
+		return nil
+	}
+	if ss.combine {
+		return fmt.Errorf("aggregates and group by are not supported in a streaming scatter query")
+	}
+	if ss.sel.Distinct != "" {
+		return fmt.Errorf("distinct is not supported in a streaming scatter query")
+	}
+	return nil
+}
+
+// shardStream is the stream of results of a shard.
+type shardStream struct {
+	index   int
+	results <-chan *mproto.QueryResult
+	rows    [][]sqltypes.Value
+}
+
+// next returns the next row of the stream, or nil at its end.
+func (st *shardStream) next() []sqltypes.Value {
+	for len(st.rows) == 0 {
+		qr, ok := <-st.results
+		if !ok {
+			return nil
+		}
+		st.rows = qr.Rows
+	}
+	row := st.rows[0]
+	st.rows = st.rows[1:]
+	return row
+}
+
+// streamRow is the current row of a stream.
+type streamRow struct {
+	stream *shardStream
+	row    []sqltypes.Value
+}
+
+// streamHeap orders the current rows of the streams by the ORDER BY
+// columns, then by stream.
+type streamHeap struct {
+	columns []orderColumn
+	rows    []streamRow
+}
+
+func (sh *streamHeap) Len() int { return len(sh.rows) }
+
+func (sh *streamHeap) Less(i, j int) bool {
+	if c := compareRows(sh.columns, sh.rows[i].row, sh.rows[j].row); c != 0 {
+		return c < 0
+	}
+	return sh.rows[i].stream.index < sh.rows[j].stream.index
+}
+
+func (sh *streamHeap) Swap(i, j int) { sh.rows[i], sh.rows[j] = sh.rows[j], sh.rows[i] }
+
+func (sh *streamHeap) Push(x interface{}) { sh.rows = append(sh.rows, x.(streamRow)) }
+
+func (sh *streamHeap) Pop() interface{} {
+	last := sh.rows[len(sh.rows)-1]
+	sh.rows = sh.rows[:len(sh.rows)-1]
+	return last
+}
+
+// mergeStreams sends the merged rows of the streams. It returns once
+// the streams are done or the LIMIT is reached. The first result of
+// each stream has the fields.
+func (ss *scatterSelect) mergeStreams(streams []*shardStream, sendReply func(reply *mproto.QueryResult) error) error {
+	var fields []mproto.Field
+	for _, st := range streams {
+		if qr, ok := <-st.results; ok {
+			if fields == nil {
+				fields = qr.Fields
+			}
+			st.rows = qr.Rows
+		}
+	}
+	if fields == nil {
+		return nil
+	}
+	if err := sendReply(&mproto.QueryResult{Fields: fields}); err != nil {
+		return err
+	}
+	columns, err := ss.orderColumns(fields)
+	if err != nil {
+		return err
+	}
+
+	sh := &streamHeap{columns: columns}
+	for _, st := range streams {
+		if row := st.next(); row != nil {
+			sh.rows = append(sh.rows, streamRow{st, row})
+		}
+	}
+	heap.Init(sh)
+	skip, remaining := ss.offset, ss.rowcount
+	reply := new(mproto.QueryResult)
+	for sh.Len() > 0 && (!ss.hasLimit || remaining > 0) {
+		current := &sh.rows[0]
+		if len(current.row) != len(fields) {
+			return fmt.Errorf("scatter query returned %v values for %v fields", len(current.row), len(fields))
+		}
+		if skip > 0 {
+			skip--
+		} else {
+			reply.Rows = append(reply.Rows, current.row)
+			remaining--
+			if len(reply.Rows) == streamMergeBatchSize {
+				if err := sendReply(reply); err != nil {
+					return err
+				}
+				reply = new(mproto.QueryResult)
+			}
+		}
+		if row := current.stream.next(); row != nil {
+			current.row = row
+			heap.Fix(sh, 0)
+		} else {
+			heap.Pop(sh)
+		}
+	}
+	if len(reply.Rows) > 0 {
+		return sendReply(reply)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/tabletserver/tabletconn"
+)
+
+// streamConn streams its results, one per reply, and records the
+// queries it gets. It stops streaming when its context is canceled.
+type streamConn struct {
+	*sandboxConn
+	results []*mproto.QueryResult
+	queries []string
+
+	// streamed is closed once all the results were read, or the
+	// stream was canceled. canceled is then set if it was.
+	streamed chan struct{}
+	canceled bool
+}
+
+func newStreamConn(results ...*mproto.QueryResult) *streamConn {
+	return &streamConn{
+		sandboxConn: &sandboxConn{},
+		results:     results,
+		streamed:    make(chan struct{}),
+	}
+}
+
+func (sc *streamConn) StreamExecute(ctx context.Context, query string, bindVars map[string]interface{}, transactionID int64) (<-chan *mproto.QueryResult, tabletconn.ErrFunc) {
+	sc.queries = append(sc.queries, query)
+	ch := make(chan *mproto.QueryResult)
+	done := context.Done(ctx)
+	go func() {
+		defer close(sc.streamed)
+		defer close(ch)
+		for _, qr := range sc.results {
+			select {
+			case ch <- qr:
+			case <-done:
+				sc.canceled = true
+				return
+			}
+		}
+	}()
+	return ch, func() error { return nil }
+}
+
+func TestScatterConnStreamExecuteMerge(t *testing.T) {
+	s := createSandbox("TestScatterConnStreamExecuteMerge")
+	fields := []mproto.Field{{"id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}
+	conns := []*streamConn{
+		newStreamConn(makeResult(fields, []string{"1", "a"}), makeResult(nil, []string{"4", "b"}, []string{"9", "c"})),
+		newStreamConn(makeResult(fields), makeResult(nil, []string{"2", "d"}), makeResult(nil, []string{"10", "e"})),
+		newStreamConn(makeResult(fields, []string{"3", "f"}, []string{"4", "g"})),
+	}
+	for i, sc := range conns {
+		s.MapTestConn(fmt.Sprintf("%v", i), sc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+
+	qr := new(mproto.QueryResult)
+	replies := 0
+	err := stc.StreamExecute(&context.DummyContext{}, "select id, name from t order by id", nil, "TestScatterConnStreamExecuteMerge", []string{"0", "1", "2"}, "", nil, func(r *mproto.QueryResult) error {
+		if replies == 0 && (len(r.Fields) != 2 || len(r.Rows) != 0) {
+			t.Errorf("first reply: %+v, want the fields", r)
+		}
+		replies++
+		qr.Rows = append(qr.Rows, r.Rows...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamExecute: %v", err)
+	}
+	// The ties are broken by stream, not by shard.
+	if got := resultString(qr); got != "1,a;2,d;3,f;4,b;4,g;9,c;10,e" && got != "1,a;2,d;3,f;4,g;4,b;9,c;10,e" {
+		t.Errorf("StreamExecute: got %v", got)
+	}
+	for _, sc := range conns {
+		if len(sc.queries) != 1 || sc.queries[0] != "select id, name from t order by id asc" {
+			t.Errorf("shard queries: %v", sc.queries)
+		}
+	}
+}
+
+func TestScatterConnStreamExecuteLimit(t *testing.T) {
+	s := createSandbox("TestScatterConnStreamExecuteLimit")
+	fields := []mproto.Field{{"id", mproto.VT_LONGLONG}}
+	var results []*mproto.QueryResult
+	results = append(results, makeResult(fields))
+	results = append(results, makeResult(nil, []string{"10"}, []string{"8"}))
+	for i := 0; i < 100; i++ {
+		results = append(results, makeResult(nil, []string{"0"}))
+	}
+	sc0 := newStreamConn(results...)
+	sc1 := newStreamConn(makeResult(fields, []string{"9"}, []string{"3"}))
+	s.MapTestConn("0", sc0)
+	s.MapTestConn("1", sc1)
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+
+	qr := new(mproto.QueryResult)
+	err := stc.StreamExecute(&context.DummyContext{}, "select id from t order by id desc limit 1, 2", nil, "TestScatterConnStreamExecuteLimit", []string{"0", "1"}, "", nil, func(r *mproto.QueryResult) error {
+		qr.Rows = append(qr.Rows, r.Rows...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamExecute: %v", err)
+	}
+	if got, want := resultString(qr), "9;8"; got != want {
+		t.Errorf("StreamExecute: got %v, want %v", got, want)
+	}
+	if q := sc0.queries[0]; q != "select id from t order by id desc limit 3" {
+		t.Errorf("shard query: %v", q)
+	}
+	// The rest of the stream is canceled.
+	select {
+	case <-sc0.streamed:
+		if !sc0.canceled {
+			t.Errorf("stream was not canceled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("stream was not canceled")
+	}
+
+	if err := stc.StreamExecute(&context.DummyContext{}, "select count(*) from t", nil, "TestScatterConnStreamExecuteLimit", []string{"0", "1"}, "", nil, func(r *mproto.QueryResult) error {
+		return nil
+	}); err == nil {
+		t.Errorf("StreamExecute(count) succeeded")
+	}
+}
+
+func TestScatterConnStreamExecuteCancel(t *testing.T) {
+	s := createSandbox("TestScatterConnStreamExecuteCancel")
+	fields := []mproto.Field{{"id", mproto.VT_LONGLONG}}
+	var conns []*streamConn
+	for i := 0; i < 2; i++ {
+		var results []*mproto.QueryResult
+		results = append(results, makeResult(fields))
+		for j := 0; j < 100; j++ {
+			results = append(results, makeResult(nil, []string{fmt.Sprintf("%v", j)}))
+		}
+		sc := newStreamConn(results...)
+		s.MapTestConn(fmt.Sprintf("%v", i), sc)
+		conns = append(conns, sc)
+	}
+	stc := NewScatterConn(new(sandboxTopo), "", "aa", 1*time.Millisecond, 3, 1*time.Millisecond)
+
+	for _, query := range []string{"select id from t", "select id from t order by id"} {
+		err := stc.StreamExecute(&context.DummyContext{}, query, nil, "TestScatterConnStreamExecuteCancel", []string{"0", "1"}, "", nil, func(*mproto.QueryResult) error {
+			return fmt.Errorf("send error")
+		})
+		if err == nil || err.Error() != "send error" {
+			t.Errorf("StreamExecute(%v): %v, want send error", query, err)
+		}
+		// The streams are canceled once the client is gone.
+		for _, sc := range conns {
+			select {
+			case <-sc.streamed:
+				if !sc.canceled {
+					t.Errorf("StreamExecute(%v): stream was not canceled", query)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("StreamExecute(%v): stream was not canceled", query)
+			}
+			sc.streamed, sc.canceled = make(chan struct{}), false
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// block3DES is the cipher used by the hash: 3DES with a null key, a
+// cheap bijection of 64 bit values which distributes them evenly.
+var block3DES cipher.Block
+
+func init() {
+	var err error
+	if block3DES, err = des.NewTripleDESCipher(make([]byte, 24)); err != nil {
+		panic(err)
+	}
+	Register("hash", NewHash)
+}
+
+// Hash is a Unique and Reversible vindex, whose keyspace id is the
+// hash of a number.
+type Hash struct{}
+
+// NewHash creates a Hash vindex, it has no params.
+func NewHash(params map[string]interface{}) (Vindex, error) {
+	return Hash{}, nil
+}
+
+func (Hash) Cost() int {
+	return 1
+}
+
+func (Hash) Map(cursor VCursor, ids []interface{}) ([]key.KeyspaceId, error) {
+	ksids := make([]key.KeyspaceId, 0, len(ids))
+	for _, id := range ids {
+		num, err := getNumber(id)
+		if err != nil {
+			return nil, fmt.Errorf("hash.Map: %v", err)
+		}
+		ksids = append(ksids, vhash(num))
+	}
+	return ksids, nil
+}
+
+func (Hash) Verify(cursor VCursor, id interface{}, ksid key.KeyspaceId) (bool, error) {
+	num, err := getNumber(id)
+	if err != nil {
+		return false, fmt.Errorf("hash.Verify: %v", err)
+	}
+	return vhash(num) == ksid, nil
+}
+
+func (Hash) ReverseMap(cursor VCursor, ksid key.KeyspaceId) (interface{}, error) {
+	return vunhash(ksid)
+}
+
+func vhash(num uint64) key.KeyspaceId {
+	var plain, hashed [8]byte
+	binary.BigEndian.PutUint64(plain[:], num)
+	block3DES.Encrypt(hashed[:], plain[:])
+	return key.KeyspaceId(hashed[:])
+}
+
+func vunhash(ksid key.KeyspaceId) (uint64, error) {
+	if len(ksid) != 8 {
+		return 0, fmt.Errorf("invalid keyspace id for hash: %v", ksid.Hex())
+	}
+	var plain [8]byte
+	block3DES.Decrypt(plain[:], []byte(ksid))
+	return binary.BigEndian.Uint64(plain[:]), nil
+}
+
+// getNumber returns the uint64 value of a column value: the signed
+// values are used as their two's complement, and the strings are
+// parsed.
+func getNumber(v interface{}) (uint64, error) {
+	switch v := v.(type) {
+	case int:
+		return uint64(v), nil
+	case int32:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case uint:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	case []byte:
+		return parseNumber(string(v))
+	case string:
+		return parseNumber(v)
+	}
+	return 0, fmt.Errorf("unexpected type for %v: %T", v, v)
+}
+
+func parseNumber(s string) (uint64, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a number: %q", s)
+	}
+	return uint64(n), nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/key"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+func init() {
+	Register("lookup_hash", NewLookupHash)
+	Register("lookup_hash_unique", NewLookupHashUnique)
+}
+
+// lookupHash reads the mapping of a vindex from a lookup table, with
+// a From column holding the values, and a To column holding the
+// numbers which hash to the keyspace ids. Its params are Table, From
+// and To.
+type lookupHash struct {
+	table, from, to string
+
+	sel, ver, ins, del string
+}
+
+func newLookupHash(params map[string]interface{}) (lookupHash, error) {
+	var lh lookupHash
+	var err error
+	if lh.table, err = stringParam(params, "Table"); err != nil {
+		return lh, err
+	}
+	if lh.from, err = stringParam(params, "From"); err != nil {
+		return lh, err
+	}
+	if lh.to, err = stringParam(params, "To"); err != nil {
+		return lh, err
+	}
+	lh.sel = fmt.Sprintf("select %s from %s where %s = :%s", lh.to, lh.table, lh.from, lh.from)
+	lh.ver = fmt.Sprintf("select %s from %s where %s = :%s and %s = :%s", lh.from, lh.table, lh.from, lh.from, lh.to, lh.to)
+	lh.ins = fmt.Sprintf("insert into %s(%s, %s) values(:%s, :%s)", lh.table, lh.from, lh.to, lh.from, lh.to)
+	lh.del = fmt.Sprintf("delete from %s where %s = :%s and %s = :%s", lh.table, lh.from, lh.from, lh.to, lh.to)
+	return lh, nil
+}
+
+// lookup returns the keyspace ids of id.
+func (lh *lookupHash) lookup(cursor VCursor, id interface{}) ([]key.KeyspaceId, error) {
+	result, err := cursor.Execute(&tproto.BoundQuery{
+		Sql:           lh.sel,
+		BindVariables: map[string]interface{}{lh.from: id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lookup of %v in %v: %v", id, lh.table, err)
+	}
+	ksids := make([]key.KeyspaceId, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if len(row) != 1 {
+			return nil, fmt.Errorf("lookup of %v in %v: unexpected row %v", id, lh.table, row)
+		}
+		num, err := parseNumber(row[0].String())
+		if err != nil {
+			return nil, fmt.Errorf("lookup of %v in %v: %v", id, lh.table, err)
+		}
+		ksids = append(ksids, vhash(num))
+	}
+	return ksids, nil
+}
+
+func (lh *lookupHash) Verify(cursor VCursor, id interface{}, ksid key.KeyspaceId) (bool, error) {
+	num, err := vunhash(ksid)
+	if err != nil {
+		return false, fmt.Errorf("lookup verify of %v in %v: %v", id, lh.table, err)
+	}
+	result, err := cursor.Execute(&tproto.BoundQuery{
+		Sql:           lh.ver,
+		BindVariables: map[string]interface{}{lh.from: id, lh.to: num},
+	})
+	if err != nil {
+		return false, fmt.Errorf("lookup verify of %v in %v: %v", id, lh.table, err)
+	}
+	return len(result.Rows) > 0, nil
+}
+
+func (lh *lookupHash) Create(cursor VCursor, id interface{}, ksid key.KeyspaceId) error {
+	num, err := vunhash(ksid)
+	if err != nil {
+		return fmt.Errorf("lookup create of %v in %v: %v", id, lh.table, err)
+	}
+	if _, err := cursor.Execute(&tproto.BoundQuery{
+		Sql:           lh.ins,
+		BindVariables: map[string]interface{}{lh.from: id, lh.to: num},
+	}); err != nil {
+		return fmt.Errorf("lookup create of %v in %v: %v", id, lh.table, err)
+	}
+	return nil
+}
+
+func (lh *lookupHash) Delete(cursor VCursor, ids []interface{}, ksid key.KeyspaceId) error {
+	num, err := vunhash(ksid)
+	if err != nil {
+		return fmt.Errorf("lookup delete in %v: %v", lh.table, err)
+	}
+	for _, id := range ids {
+		if _, err := cursor.Execute(&tproto.BoundQuery{
+			Sql:           lh.del,
+			BindVariables: map[string]interface{}{lh.from: id, lh.to: num},
+		}); err != nil {
+			return fmt.Errorf("lookup delete of %v in %v: %v", id, lh.table, err)
+		}
+	}
+	return nil
+}
+
+// LookupHash is a NonUnique Lookup vindex: a value can map to
+// several keyspace ids.
+type LookupHash struct {
+	lookupHash
+}
+
+// NewLookupHash creates a LookupHash vindex.
+func NewLookupHash(params map[string]interface{}) (Vindex, error) {
+	lh, err := newLookupHash(params)
+	if err != nil {
+		return nil, err
+	}
+	return &LookupHash{lh}, nil
+}
+
+func (*LookupHash) Cost() int {
+	return 20
+}
+
+func (lh *LookupHash) Map(cursor VCursor, ids []interface{}) ([][]key.KeyspaceId, error) {
+	ksids := make([][]key.KeyspaceId, 0, len(ids))
+	for _, id := range ids {
+		idKsids, err := lh.lookup(cursor, id)
+		if err != nil {
+			return nil, err
+		}
+		ksids = append(ksids, idKsids)
+	}
+	return ksids, nil
+}
+
+// LookupHashUnique is a Unique Lookup vindex: a value maps to one
+// keyspace id at most. The values missing from the lookup table map
+// to an empty keyspace id.
+type LookupHashUnique struct {
+	lookupHash
+}
+
+// NewLookupHashUnique creates a LookupHashUnique vindex.
+func NewLookupHashUnique(params map[string]interface{}) (Vindex, error) {
+	lh, err := newLookupHash(params)
+	if err != nil {
+		return nil, err
+	}
+	return &LookupHashUnique{lh}, nil
+}
+
+func (*LookupHashUnique) Cost() int {
+	return 10
+}
+
+func (lhu *LookupHashUnique) Map(cursor VCursor, ids []interface{}) ([]key.KeyspaceId, error) {
+	ksids := make([]key.KeyspaceId, 0, len(ids))
+	for _, id := range ids {
+		idKsids, err := lhu.lookup(cursor, id)
+		if err != nil {
+			return nil, err
+		}
+		switch len(idKsids) {
+		case 0:
+			ksids = append(ksids, "")
+		case 1:
+			ksids = append(ksids, idKsids[0])
+		default:
+			return nil, fmt.Errorf("lookup of %v in %v: got %v keyspace ids for a unique vindex", id, lhu.table, len(idKsids))
+		}
+	}
+	return ksids, nil
+}
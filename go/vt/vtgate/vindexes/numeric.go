@@ -0,0 +1,57 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+func init() {
+	Register("numeric", NewNumeric)
+}
+
+// Numeric is a Unique and Reversible vindex, whose keyspace id is
+// the 8 bytes big endian value of a number, for the tables sharded
+// by a column already holding a keyspace id.
+type Numeric struct{}
+
+// NewNumeric creates a Numeric vindex, it has no params.
+func NewNumeric(params map[string]interface{}) (Vindex, error) {
+	return Numeric{}, nil
+}
+
+func (Numeric) Cost() int {
+	return 0
+}
+
+func (Numeric) Map(cursor VCursor, ids []interface{}) ([]key.KeyspaceId, error) {
+	ksids := make([]key.KeyspaceId, 0, len(ids))
+	for _, id := range ids {
+		num, err := getNumber(id)
+		if err != nil {
+			return nil, fmt.Errorf("numeric.Map: %v", err)
+		}
+		ksids = append(ksids, key.Uint64Key(num).KeyspaceId())
+	}
+	return ksids, nil
+}
+
+func (Numeric) Verify(cursor VCursor, id interface{}, ksid key.KeyspaceId) (bool, error) {
+	num, err := getNumber(id)
+	if err != nil {
+		return false, fmt.Errorf("numeric.Verify: %v", err)
+	}
+	return key.Uint64Key(num).KeyspaceId() == ksid, nil
+}
+
+func (Numeric) ReverseMap(cursor VCursor, ksid key.KeyspaceId) (interface{}, error) {
+	if len(ksid) != 8 {
+		return nil, fmt.Errorf("numeric.ReverseMap: invalid keyspace id %v", ksid.Hex())
+	}
+	return binary.BigEndian.Uint64([]byte(ksid)), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+func init() {
+	Register("unicode_loose_md5", NewUnicodeLooseMD5)
+}
+
+// UnicodeLooseMD5 is a Unique vindex for string columns, whose
+// keyspace id is the md5 of the normalized value, so the values a
+// case insensitive collation considers equal are in the same shard:
+// the case is folded, the combining marks are dropped, and the
+// trailing spaces are ignored. The accented letters are not folded to
+// their base letter, unless they are written with a combining mark.
+type UnicodeLooseMD5 struct{}
+
+// NewUnicodeLooseMD5 creates a UnicodeLooseMD5 vindex, it has no
+// params.
+func NewUnicodeLooseMD5(params map[string]interface{}) (Vindex, error) {
+	return UnicodeLooseMD5{}, nil
+}
+
+func (UnicodeLooseMD5) Cost() int {
+	return 1
+}
+
+func (UnicodeLooseMD5) Map(cursor VCursor, ids []interface{}) ([]key.KeyspaceId, error) {
+	ksids := make([]key.KeyspaceId, 0, len(ids))
+	for _, id := range ids {
+		ksid, err := looseMD5(id)
+		if err != nil {
+			return nil, fmt.Errorf("unicode_loose_md5.Map: %v", err)
+		}
+		ksids = append(ksids, ksid)
+	}
+	return ksids, nil
+}
+
+func (UnicodeLooseMD5) Verify(cursor VCursor, id interface{}, ksid key.KeyspaceId) (bool, error) {
+	want, err := looseMD5(id)
+	if err != nil {
+		return false, fmt.Errorf("unicode_loose_md5.Verify: %v", err)
+	}
+	return want == ksid, nil
+}
+
+func looseMD5(id interface{}) (key.KeyspaceId, error) {
+	var s string
+	switch id := id.(type) {
+	case string:
+		s = id
+	case []byte:
+		s = string(id)
+	default:
+		return "", fmt.Errorf("unexpected type for %v: %T", id, id)
+	}
+	sum := md5.Sum([]byte(normalize(s)))
+	return key.KeyspaceId(sum[:]), nil
+}
+
+// normalize returns the loose form of s.
+func normalize(s string) string {
+	s = strings.TrimRight(s, " ")
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return unicode.ToUpper(unicode.ToLower(r))
+	}, s)
+}
@@ -0,0 +1,128 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vindexes contains the VSchema of the keyspaces, which
+// describes how their tables are sharded, and the vindexes, which
+// map the values of a column to keyspace ids. With them, vtgate can
+// find the shards of a row from its column values, instead of
+// requiring the clients to compute the keyspace ids.
+//
+// The built-in vindexes are:
+//   - hash: a unique vindex hashing a number;
+//   - numeric: a unique vindex using a number as is;
+//   - lookup_hash and lookup_hash_unique: vindexes reading the number
+//     to hash from a lookup table;
+//   - unicode_loose_md5: a unique vindex hashing a string, ignoring
+//     case and trailing spaces.
+//
+// Other vindexes can be added with Register.
+package vindexes
+
+import (
+	"fmt"
+	"sync"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/key"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+// VCursor is used by the vindexes that need to run queries, like the
+// lookup vindexes.
+type VCursor interface {
+	Execute(query *tproto.BoundQuery) (*mproto.QueryResult, error)
+}
+
+// Vindex maps the values of a column to keyspace ids. A Vindex also
+// implements Unique or NonUnique.
+type Vindex interface {
+	// Cost is the relative cost of a Map call: the cheapest vindex
+	// of a table is used to route its queries. The computed vindexes
+	// cost 0 or 1, the lookup vindexes 10 or more.
+	Cost() int
+
+	// Verify returns true if id maps to ksid.
+	Verify(cursor VCursor, id interface{}, ksid key.KeyspaceId) (bool, error)
+}
+
+// Unique is a Vindex mapping each value to one keyspace id.
+type Unique interface {
+	Vindex
+	Map(cursor VCursor, ids []interface{}) ([]key.KeyspaceId, error)
+}
+
+// NonUnique is a Vindex mapping each value to any number of keyspace
+// ids.
+type NonUnique interface {
+	Vindex
+	Map(cursor VCursor, ids []interface{}) ([][]key.KeyspaceId, error)
+}
+
+// Reversible is implemented by the vindexes that can compute the
+// value from the keyspace id.
+type Reversible interface {
+	ReverseMap(cursor VCursor, ksid key.KeyspaceId) (interface{}, error)
+}
+
+// Lookup is implemented by the vindexes storing their mapping, which
+// must be updated when the rows of the table owning the vindex are
+// inserted or deleted.
+type Lookup interface {
+	Create(cursor VCursor, id interface{}, ksid key.KeyspaceId) error
+	Delete(cursor VCursor, ids []interface{}, ksid key.KeyspaceId) error
+}
+
+// NewVindexFunc creates a Vindex from the params of its VSchema
+// definition.
+type NewVindexFunc func(params map[string]interface{}) (Vindex, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]NewVindexFunc)
+)
+
+// Register makes a vindex type available to the VSchemas. It is
+// meant to be called from an init function, and panics if the type
+// is registered twice.
+func Register(vindexType string, newVindexFunc NewVindexFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[vindexType]; ok {
+		panic(fmt.Sprintf("vindex type %v is already registered", vindexType))
+	}
+	registry[vindexType] = newVindexFunc
+}
+
+// CreateVindex creates a vindex of a registered type.
+func CreateVindex(vindexType string, params map[string]interface{}) (Vindex, error) {
+	registryMu.Lock()
+	newVindexFunc, ok := registry[vindexType]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown vindex type %v", vindexType)
+	}
+	vindex, err := newVindexFunc(params)
+	if err != nil {
+		return nil, err
+	}
+	switch vindex.(type) {
+	case Unique, NonUnique:
+	default:
+		return nil, fmt.Errorf("vindex type %v is neither Unique nor NonUnique", vindexType)
+	}
+	return vindex, nil
+}
+
+// stringParam returns a required string param.
+func stringParam(params map[string]interface{}, name string) (string, error) {
+	v, ok := params[name]
+	if !ok {
+		return "", fmt.Errorf("missing vindex param %v", name)
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("vindex param %v must be a non empty string: %v", name, v)
+	}
+	return s, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"fmt"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	"github.com/youtube/vitess/go/vt/key"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+)
+
+func TestHash(t *testing.T) {
+	hash, err := CreateVindex("hash", nil)
+	if err != nil {
+		t.Fatalf("CreateVindex: %v", err)
+	}
+	ksids, err := hash.(Unique).Map(nil, []interface{}{1, int64(2), uint64(3), "4", []byte("-1")})
+	if err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	want := []string{"166B40B44ABA4BD6", "06E7EA22CE92708F", "4EB190C9A2FA169C", "D2FD8867D50D2DFE", "355550B2150E2451"}
+	for i, ksid := range ksids {
+		if string(ksid.Hex()) != want[i] {
+			t.Errorf("Map(%v): got %v, want %v", i, ksid.Hex(), want[i])
+		}
+	}
+	if _, err := hash.(Unique).Map(nil, []interface{}{1.5}); err == nil {
+		t.Errorf("Map(1.5) didn't fail")
+	}
+
+	for _, id := range []uint64{0, 1, 1 << 63, 12345678} {
+		ksid := vhash(id)
+		if ok, err := hash.Verify(nil, id, ksid); !ok || err != nil {
+			t.Errorf("Verify(%v): %v %v", id, ok, err)
+		}
+		if got, err := hash.(Reversible).ReverseMap(nil, ksid); err != nil || got.(uint64) != id {
+			t.Errorf("ReverseMap(%v): %v %v", id, got, err)
+		}
+	}
+}
+
+func TestNumeric(t *testing.T) {
+	numeric, err := CreateVindex("numeric", nil)
+	if err != nil {
+		t.Fatalf("CreateVindex: %v", err)
+	}
+	ksids, err := numeric.(Unique).Map(nil, []interface{}{0x0102030405060708})
+	if err != nil || len(ksids) != 1 || ksids[0] != key.KeyspaceId("\x01\x02\x03\x04\x05\x06\x07\x08") {
+		t.Errorf("Map: %v %v", ksids, err)
+	}
+	if got, err := numeric.(Reversible).ReverseMap(nil, ksids[0]); err != nil || got.(uint64) != 0x0102030405060708 {
+		t.Errorf("ReverseMap: %v %v", got, err)
+	}
+}
+
+func TestUnicodeLooseMD5(t *testing.T) {
+	vindex, err := CreateVindex("unicode_loose_md5", nil)
+	if err != nil {
+		t.Fatalf("CreateVindex: %v", err)
+	}
+	ksids, err := vindex.(Unique).Map(nil, []interface{}{"Test", []byte("tEST  "), "tést", "other"})
+	if err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	if ksids[0] != ksids[1] || ksids[0] != ksids[2] || ksids[0] == ksids[3] {
+		t.Errorf("Map: %v", ksids)
+	}
+	if ok, err := vindex.Verify(nil, "TEST", ksids[0]); !ok || err != nil {
+		t.Errorf("Verify: %v %v", ok, err)
+	}
+}
+
+// fakeCursor answers the lookup queries from a table of rows, and
+// records the other queries.
+type fakeCursor struct {
+	rows    map[string][]uint64
+	queries []string
+}
+
+func (fc *fakeCursor) Execute(query *tproto.BoundQuery) (*mproto.QueryResult, error) {
+	fc.queries = append(fc.queries, fmt.Sprintf("%v %v", query.Sql, query.BindVariables))
+	qr := &mproto.QueryResult{Fields: []mproto.Field{{"user_id", mproto.VT_LONGLONG}}}
+	for _, id := range fc.rows[fmt.Sprintf("%v", query.BindVariables["name"])] {
+		qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeString([]byte(fmt.Sprintf("%v", id)))})
+	}
+	return qr, nil
+}
+
+func TestLookupHash(t *testing.T) {
+	params := map[string]interface{}{"Table": "name_user_idx", "From": "name", "To": "user_id"}
+	cursor := &fakeCursor{rows: map[string][]uint64{
+		"alice": []uint64{1},
+		"bob":   []uint64{2, 3},
+	}}
+
+	lh, err := CreateVindex("lookup_hash", params)
+	if err != nil {
+		t.Fatalf("CreateVindex: %v", err)
+	}
+	ksids, err := lh.(NonUnique).Map(cursor, []interface{}{"alice", "bob", "carol"})
+	if err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	if len(ksids) != 3 || len(ksids[0]) != 1 || ksids[0][0] != vhash(1) || len(ksids[1]) != 2 || ksids[1][1] != vhash(3) || len(ksids[2]) != 0 {
+		t.Errorf("Map: %v", ksids)
+	}
+	if got, want := cursor.queries[0], "select user_id from name_user_idx where name = :name map[name:alice]"; got != want {
+		t.Errorf("lookup query: got %v, want %v", got, want)
+	}
+
+	lhu, err := CreateVindex("lookup_hash_unique", params)
+	if err != nil {
+		t.Fatalf("CreateVindex: %v", err)
+	}
+	uniqueKsids, err := lhu.(Unique).Map(cursor, []interface{}{"alice", "carol"})
+	if err != nil || len(uniqueKsids) != 2 || uniqueKsids[0] != vhash(1) || uniqueKsids[1] != "" {
+		t.Errorf("Map: %v %v", uniqueKsids, err)
+	}
+	if _, err := lhu.(Unique).Map(cursor, []interface{}{"bob"}); err == nil {
+		t.Errorf("Map of a value with 2 keyspace ids didn't fail")
+	}
+
+	cursor.queries = nil
+	if err := lh.(Lookup).Create(cursor, "dave", vhash(4)); err != nil {
+		t.Errorf("Create: %v", err)
+	}
+	if err := lh.(Lookup).Delete(cursor, []interface{}{"dave"}, vhash(4)); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	want := []string{
+		"insert into name_user_idx(name, user_id) values(:name, :user_id) map[name:dave user_id:4]",
+		"delete from name_user_idx where name = :name and user_id = :user_id map[name:dave user_id:4]",
+	}
+	if fmt.Sprintf("%v", cursor.queries) != fmt.Sprintf("%v", want) {
+		t.Errorf("queries: got %v, want %v", cursor.queries, want)
+	}
+
+	if _, err := CreateVindex("lookup_hash", map[string]interface{}{"Table": "t"}); err == nil {
+		t.Errorf("CreateVindex without From and To didn't fail")
+	}
+}
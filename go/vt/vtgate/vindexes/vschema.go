@@ -0,0 +1,258 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/youtube/vitess/go/vt/key"
+)
+
+// KeyspaceFormal is the VSchema of a keyspace, as stored in the
+// topology in JSON. For instance:
+//
+//	{
+//	  "Sharded": true,
+//	  "Vindexes": {
+//	    "user_index": {"Type": "hash"},
+//	    "name_index": {
+//	      "Type": "lookup_hash",
+//	      "Params": {"Table": "name_user_idx", "From": "name", "To": "user_id"},
+//	      "Owner": "user"
+//	    }
+//	  },
+//	  "Tables": {
+//	    "user": {"ColVindexes": [
+//	      {"Col": "id", "Name": "user_index"},
+//	      {"Col": "name", "Name": "name_index"}
+//	    ]}
+//	  }
+//	}
+//
+// The first vindex of a table is its primary vindex, which must be
+// Unique: it decides the shard of the rows.
+type KeyspaceFormal struct {
+	Sharded  bool
+	Vindexes map[string]VindexFormal
+	Tables   map[string]TableFormal
+}
+
+// VindexFormal is the definition of a vindex.
+type VindexFormal struct {
+	Type   string
+	Params map[string]interface{}
+
+	// Owner is the table whose inserts and deletes maintain the
+	// entries of a Lookup vindex.
+	Owner string
+}
+
+// TableFormal lists the vindexes of a table.
+type TableFormal struct {
+	ColVindexes []ColVindexFormal
+}
+
+// ColVindexFormal is the vindex of a column.
+type ColVindexFormal struct {
+	Col  string
+	Name string
+}
+
+// ParseKeyspaceFormal parses the JSON VSchema of a keyspace.
+func ParseKeyspaceFormal(data string) (*KeyspaceFormal, error) {
+	kf := &KeyspaceFormal{}
+	if err := json.Unmarshal([]byte(data), kf); err != nil {
+		return nil, fmt.Errorf("invalid VSchema: %v", err)
+	}
+	return kf, nil
+}
+
+// VSchema is the built VSchema of all the keyspaces.
+type VSchema struct {
+	Keyspaces map[string]*Keyspace
+
+	// tables indexes the tables of all the keyspaces, their names
+	// must be unique.
+	tables map[string]*Table
+}
+
+// Keyspace is the built VSchema of a keyspace.
+type Keyspace struct {
+	Name    string
+	Sharded bool
+	Tables  map[string]*Table
+}
+
+// Table is a table and its vindexes.
+type Table struct {
+	Name     string
+	Keyspace *Keyspace
+
+	// ColVindexes are in the VSchema order, the first one is the
+	// primary vindex.
+	ColVindexes []*ColVindex
+
+	// Ordered are the ColVindexes sorted by cost.
+	Ordered []*ColVindex
+
+	// Owned are the Lookup vindexes the table owns.
+	Owned []*ColVindex
+}
+
+// ColVindex is the vindex of a column.
+type ColVindex struct {
+	Col    string
+	Name   string
+	Type   string
+	Owned  bool
+	Vindex Vindex
+}
+
+// BuildVSchema builds and validates the VSchema of the keyspaces.
+func BuildVSchema(formal map[string]*KeyspaceFormal) (*VSchema, error) {
+	vs := &VSchema{
+		Keyspaces: make(map[string]*Keyspace),
+		tables:    make(map[string]*Table),
+	}
+	names := make([]string, 0, len(formal))
+	for name := range formal {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ks, err := buildKeyspace(name, formal[name])
+		if err != nil {
+			return nil, err
+		}
+		for tname, table := range ks.Tables {
+			if other, ok := vs.tables[tname]; ok {
+				return nil, fmt.Errorf("table %v is in keyspaces %v and %v", tname, other.Keyspace.Name, name)
+			}
+			vs.tables[tname] = table
+		}
+		vs.Keyspaces[name] = ks
+	}
+	return vs, nil
+}
+
+func buildKeyspace(name string, kf *KeyspaceFormal) (*Keyspace, error) {
+	ks := &Keyspace{
+		Name:    name,
+		Sharded: kf.Sharded,
+		Tables:  make(map[string]*Table),
+	}
+	if !kf.Sharded && len(kf.Vindexes) > 0 {
+		return nil, fmt.Errorf("unsharded keyspace %v cannot have vindexes", name)
+	}
+
+	vindexes := make(map[string]Vindex)
+	for vname, vf := range kf.Vindexes {
+		vindex, err := CreateVindex(vf.Type, vf.Params)
+		if err != nil {
+			return nil, fmt.Errorf("vindex %v of keyspace %v: %v", vname, name, err)
+		}
+		if _, ok := vindex.(Lookup); ok && vf.Owner != "" {
+			if _, ok := kf.Tables[vf.Owner]; !ok {
+				return nil, fmt.Errorf("vindex %v of keyspace %v: owner table %v not found", vname, name, vf.Owner)
+			}
+		}
+		vindexes[vname] = vindex
+	}
+
+	for tname, tf := range kf.Tables {
+		table := &Table{
+			Name:     tname,
+			Keyspace: ks,
+		}
+		if !kf.Sharded {
+			if len(tf.ColVindexes) > 0 {
+				return nil, fmt.Errorf("table %v of unsharded keyspace %v cannot have vindexes", tname, name)
+			}
+			ks.Tables[tname] = table
+			continue
+		}
+		if len(tf.ColVindexes) == 0 {
+			return nil, fmt.Errorf("table %v of keyspace %v has no vindex", tname, name)
+		}
+		for i, cvf := range tf.ColVindexes {
+			vindex, ok := vindexes[cvf.Name]
+			if !ok {
+				return nil, fmt.Errorf("vindex %v of table %v not found in keyspace %v", cvf.Name, tname, name)
+			}
+			if _, ok := vindex.(Unique); i == 0 && !ok {
+				return nil, fmt.Errorf("primary vindex %v of table %v is not Unique", cvf.Name, tname)
+			}
+			cv := &ColVindex{
+				Col:    cvf.Col,
+				Name:   cvf.Name,
+				Type:   kf.Vindexes[cvf.Name].Type,
+				Owned:  kf.Vindexes[cvf.Name].Owner == tname,
+				Vindex: vindex,
+			}
+			table.ColVindexes = append(table.ColVindexes, cv)
+			if _, ok := vindex.(Lookup); ok && cv.Owned {
+				table.Owned = append(table.Owned, cv)
+			}
+		}
+		table.Ordered = make([]*ColVindex, len(table.ColVindexes))
+		copy(table.Ordered, table.ColVindexes)
+		sort.Stable(byCost(table.Ordered))
+		ks.Tables[tname] = table
+	}
+	return ks, nil
+}
+
+type byCost []*ColVindex
+
+func (bc byCost) Len() int           { return len(bc) }
+func (bc byCost) Swap(i, j int)      { bc[i], bc[j] = bc[j], bc[i] }
+func (bc byCost) Less(i, j int) bool { return bc[i].Vindex.Cost() < bc[j].Vindex.Cost() }
+
+// FindTable returns the table of any keyspace with the given name.
+func (vs *VSchema) FindTable(tablename string) (*Table, error) {
+	table, ok := vs.tables[tablename]
+	if !ok {
+		return nil, fmt.Errorf("table %v not found", tablename)
+	}
+	return table, nil
+}
+
+// FindColVindex returns the cheapest vindex of a column, or nil.
+func (t *Table) FindColVindex(col string) *ColVindex {
+	for _, cv := range t.Ordered {
+		if cv.Col == col {
+			return cv
+		}
+	}
+	return nil
+}
+
+// MapColumn returns the keyspace ids of the rows of the table with
+// the given values in col, for each value.
+func (t *Table) MapColumn(cursor VCursor, col string, ids []interface{}) ([][]key.KeyspaceId, error) {
+	cv := t.FindColVindex(col)
+	if cv == nil {
+		return nil, fmt.Errorf("column %v of table %v has no vindex", col, t.Name)
+	}
+	switch vindex := cv.Vindex.(type) {
+	case Unique:
+		ksids, err := vindex.Map(cursor, ids)
+		if err != nil {
+			return nil, err
+		}
+		result := make([][]key.KeyspaceId, len(ksids))
+		for i, ksid := range ksids {
+			if ksid != "" {
+				result[i] = []key.KeyspaceId{ksid}
+			}
+		}
+		return result, nil
+	case NonUnique:
+		return vindex.Map(cursor, ids)
+	}
+	return nil, fmt.Errorf("vindex %v is neither Unique nor NonUnique", cv.Name)
+}
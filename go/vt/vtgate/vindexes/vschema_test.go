@@ -0,0 +1,90 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vindexes
+
+import (
+	"strings"
+	"testing"
+)
+
+const userVSchema = `{
+  "Sharded": true,
+  "Vindexes": {
+    "user_index": {"Type": "hash"},
+    "name_index": {
+      "Type": "lookup_hash",
+      "Params": {"Table": "name_user_idx", "From": "name", "To": "user_id"},
+      "Owner": "user"
+    }
+  },
+  "Tables": {
+    "user": {"ColVindexes": [
+      {"Col": "id", "Name": "user_index"},
+      {"Col": "name", "Name": "name_index"}
+    ]}
+  }
+}`
+
+func buildTestVSchema(t *testing.T, user string) (*VSchema, error) {
+	kf, err := ParseKeyspaceFormal(user)
+	if err != nil {
+		t.Fatalf("ParseKeyspaceFormal: %v", err)
+	}
+	main, err := ParseKeyspaceFormal(`{"Tables": {"seq": {}}}`)
+	if err != nil {
+		t.Fatalf("ParseKeyspaceFormal: %v", err)
+	}
+	return BuildVSchema(map[string]*KeyspaceFormal{"user": kf, "main": main})
+}
+
+func TestBuildVSchema(t *testing.T) {
+	vs, err := buildTestVSchema(t, userVSchema)
+	if err != nil {
+		t.Fatalf("BuildVSchema: %v", err)
+	}
+	user, err := vs.FindTable("user")
+	if err != nil {
+		t.Fatalf("FindTable: %v", err)
+	}
+	if user.Keyspace.Name != "user" || !user.Keyspace.Sharded || len(user.ColVindexes) != 2 || user.ColVindexes[0].Col != "id" {
+		t.Errorf("user table: %+v", user)
+	}
+	if len(user.Owned) != 1 || user.Owned[0].Col != "name" || user.Owned[0].Type != "lookup_hash" {
+		t.Errorf("owned vindexes: %+v", user.Owned)
+	}
+	if cv := user.FindColVindex("name"); cv == nil || cv.Name != "name_index" {
+		t.Errorf("FindColVindex(name): %+v", cv)
+	}
+	if cv := user.FindColVindex("other"); cv != nil {
+		t.Errorf("FindColVindex(other): %+v", cv)
+	}
+	ksids, err := user.MapColumn(nil, "id", []interface{}{1})
+	if err != nil || len(ksids) != 1 || len(ksids[0]) != 1 || ksids[0][0] != vhash(1) {
+		t.Errorf("MapColumn: %v %v", ksids, err)
+	}
+	if seq, err := vs.FindTable("seq"); err != nil || seq.Keyspace.Sharded {
+		t.Errorf("FindTable(seq): %+v %v", seq, err)
+	}
+	if _, err := vs.FindTable("missing"); err == nil {
+		t.Errorf("FindTable(missing) didn't fail")
+	}
+
+	for _, tc := range []struct {
+		old, new, err string
+	}{
+		{`"Col": "id", "Name": "user_index"`, `"Col": "id", "Name": "name_index"`, "primary vindex name_index of table user is not Unique"},
+		{`"Type": "hash"`, `"Type": "unknown"`, "unknown vindex type unknown"},
+		{`"Owner": "user"`, `"Owner": "other"`, "owner table other not found"},
+		{`"Name": "name_index"}`, `"Name": "missing"}`, "vindex missing of table user not found"},
+		{`"ColVindexes": [`, `"ColVindexes": [], "Other": [`, "table user of keyspace user has no vindex"},
+		{`"Sharded": true`, `"Sharded": false`, "unsharded keyspace user cannot have vindexes"},
+		{`"Tables": {`, `"Tables": {"seq": {"ColVindexes": [{"Col": "id", "Name": "user_index"}]},`, "table seq is in keyspaces main and user"},
+	} {
+		_, err := buildTestVSchema(t, strings.Replace(userVSchema, tc.old, tc.new, 1))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("BuildVSchema with %v: got %v, want %v", tc.new, err, tc.err)
+		}
+	}
+}
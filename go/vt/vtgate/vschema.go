@@ -0,0 +1,122 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/youtube/vitess/go/acl"
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
+)
+
+// vschemaReader is implemented by the SrvTopoServer that can read the
+// VSchema of keyspaces.
+type vschemaReader interface {
+	GetVSchema(context context.Context, keyspace string) (string, error)
+}
+
+// GetVSchema returns the VSchema of a keyspace, read from the global
+// topology. It is not cached, vtgate reads it when it starts.
+func (server *ResilientSrvTopoServer) GetVSchema(context context.Context, keyspace string) (string, error) {
+	return topo.GetVSchema(server.topoServer, keyspace)
+}
+
+// loadVSchema reads the VSchema of the keyspaces served in cell, and
+// builds it. The keyspaces without a VSchema are skipped.
+func loadVSchema(context context.Context, serv SrvTopoServer, cell string) (*vindexes.VSchema, map[string]*vindexes.KeyspaceFormal, error) {
+	formal := make(map[string]*vindexes.KeyspaceFormal)
+	if reader, ok := serv.(vschemaReader); ok {
+		keyspaces, err := serv.GetSrvKeyspaceNames(context, cell)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, keyspace := range keyspaces {
+			data, err := reader.GetVSchema(context, keyspace)
+			if err == topo.ErrNoNode {
+				continue
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot read the VSchema of keyspace %v: %v", keyspace, err)
+			}
+			if formal[keyspace], err = vindexes.ParseKeyspaceFormal(data); err != nil {
+				return nil, nil, fmt.Errorf("keyspace %v: %v", keyspace, err)
+			}
+		}
+	}
+	vschema, err := vindexes.BuildVSchema(formal)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vschema, formal, nil
+}
+
+// VSchema returns the VSchema vtgate uses to route the queries by
+// column values.
+func (vtg *VTGate) VSchema() *vindexes.VSchema {
+	return vtg.vschema
+}
+
+// ExecuteColumnValues executes a non-streaming query on the shards of
+// the rows of table with the values query.ColumnValues in
+// query.ColumnName, found with the vindex of the column. Like with
+// ExecuteEntityIds, the query only returns these rows.
+func (res *Resolver) ExecuteColumnValues(context context.Context, vschema *vindexes.VSchema, table *vindexes.Table, query *proto.ColumnValuesQuery) (*mproto.QueryResult, error) {
+	var entityIds []proto.EntityId
+	if table.Keyspace.Sharded {
+		cursor := &vindexCursor{
+			res:     res,
+			context: context,
+			vschema: vschema,
+			query:   &proto.KeyRangeQuery{TabletType: query.TabletType, Session: query.Session},
+		}
+		ksids, err := table.MapColumn(cursor, query.ColumnName, query.ColumnValues)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range query.ColumnValues {
+			for _, ksid := range ksids[i] {
+				entityIds = append(entityIds, proto.EntityId{ExternalID: v, KeyspaceID: ksid})
+			}
+		}
+	} else {
+		// The single shard of an unsharded keyspace has all the
+		// keyspace ids.
+		for _, v := range query.ColumnValues {
+			entityIds = append(entityIds, proto.EntityId{ExternalID: v})
+		}
+	}
+	if len(entityIds) == 0 {
+		return &mproto.QueryResult{}, nil
+	}
+	return res.ExecuteEntityIds(context, &proto.EntityIdsQuery{
+		Sql:               query.Sql,
+		BindVariables:     query.BindVariables,
+		Keyspace:          table.Keyspace.Name,
+		EntityColumnName:  query.ColumnName,
+		EntityKeyspaceIDs: entityIds,
+		TabletType:        query.TabletType,
+		Session:           query.Session,
+	})
+}
+
+// serveVSchema shows the VSchema vtgate loaded.
+func (vtg *VTGate) serveVSchema(response http.ResponseWriter, request *http.Request) {
+	if err := acl.CheckAccessHTTP(request, acl.DEBUGGING); err != nil {
+		acl.SendError(response, err)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if b, err := json.MarshalIndent(vtg.vschemaFormal, "", "  "); err != nil {
+		response.Write([]byte(err.Error()))
+	} else {
+		response.Write(b)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vtgate
+
+import (
+	"strings"
+	"testing"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	"github.com/youtube/vitess/go/vt/context"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
+)
+
+// vschemaTopo serves the VSchema of the sandbox keyspaces.
+type vschemaTopo struct {
+	sandboxTopo
+	vschemas map[string]string
+}
+
+func (vt *vschemaTopo) GetVSchema(context context.Context, keyspace string) (string, error) {
+	vschema, ok := vt.vschemas[keyspace]
+	if !ok {
+		return "", topo.ErrNoNode
+	}
+	return vschema, nil
+}
+
+func TestLoadVSchema(t *testing.T) {
+	createSandbox("TestLoadVSchemaUser")
+	createSandbox("TestLoadVSchemaMain")
+	serv := &vschemaTopo{vschemas: map[string]string{
+		"TestLoadVSchemaUser": `{"Sharded": true, "Vindexes": {"user_index": {"Type": "hash"}}, "Tables": {"user": {"ColVindexes": [{"Col": "id", "Name": "user_index"}]}}}`,
+	}}
+	vschema, formal, err := loadVSchema(&context.DummyContext{}, serv, "aa")
+	if err != nil {
+		t.Fatalf("loadVSchema: %v", err)
+	}
+	if len(formal) != 1 {
+		t.Errorf("loadVSchema: got the VSchema of %v keyspaces, want 1", len(formal))
+	}
+	table, err := vschema.FindTable("user")
+	if err != nil || table.Keyspace.Name != "TestLoadVSchemaUser" || table.ColVindexes[0].Type != "hash" {
+		t.Errorf("FindTable(user): %+v %v", table, err)
+	}
+
+	serv.vschemas["TestLoadVSchemaMain"] = `{"Sharded": false, "Tables": {"user": {}}}`
+	if _, _, err := loadVSchema(&context.DummyContext{}, serv, "aa"); err == nil {
+		t.Errorf("loadVSchema with a duplicate table didn't fail")
+	}
+	serv.vschemas["TestLoadVSchemaMain"] = `{"Sharded": `
+	if _, _, err := loadVSchema(&context.DummyContext{}, serv, "aa"); err == nil {
+		t.Errorf("loadVSchema with an invalid VSchema didn't fail")
+	}
+}
+
+func TestVTGateExecuteColumnValues(t *testing.T) {
+	vschema := newJoinVSchema(t, "TestColumnValuesUser", "TestColumnValuesMain")
+	defer func(vschema *vindexes.VSchema) {
+		RpcVTGate.vschema = vschema
+	}(RpcVTGate.vschema)
+	RpcVTGate.vschema = vschema
+
+	user := createSandbox("TestColumnValuesUser")
+	user.ShardSpec = "-80-"
+	userRows := tableRows([]mproto.Field{{"id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}, []string{"1", "x"}, []string{"2", "y"})
+	userConns := []*joinConn{newJoinConn(userRows), newJoinConn(userRows)}
+	user.MapTestConn("-80", userConns[0])
+	user.MapTestConn("80-", userConns[1])
+	main := createSandbox("TestColumnValuesMain")
+	main.ShardSpec = "-"
+	mainRows := tableRows([]mproto.Field{{"x", mproto.VT_VAR_STRING}, {"user_id", mproto.VT_LONGLONG}}, []string{"a", "1"}, []string{"b", "2"})
+	lookupRows := tableRows([]mproto.Field{{"user_id", mproto.VT_LONGLONG}, {"name", mproto.VT_VAR_STRING}}, []string{"2", "y"}, []string{"1", "x"})
+	main.MapTestConn("-", newJoinConn(func(query string, bindVars map[string]interface{}) *mproto.QueryResult {
+		if strings.Contains(query, "name_user_idx") {
+			return lookupRows(query, bindVars)
+		}
+		return mainRows(query, bindVars)
+	}))
+
+	testCases := []struct {
+		table, sql, column string
+		values             []interface{}
+		want               string
+		userQueries        int
+	}{{
+		table:       "user",
+		sql:         "select id, name from user",
+		column:      "id",
+		values:      []interface{}{1},
+		want:        "1,x",
+		userQueries: 1,
+	}, {
+		// the lookup vindex reads the id in the main keyspace
+		table:       "user",
+		sql:         "select id, name from user",
+		column:      "name",
+		values:      []interface{}{"y"},
+		want:        "2,y",
+		userQueries: 1,
+	}, {
+		// no row has the name, no shard is queried
+		table:  "user",
+		sql:    "select id, name from user",
+		column: "name",
+		values: []interface{}{"z"},
+		want:   "",
+	}, {
+		table:  "main",
+		sql:    "select x from main",
+		column: "user_id",
+		values: []interface{}{2},
+		want:   "b",
+	}}
+	for _, tcase := range testCases {
+		for _, uc := range userConns {
+			uc.queries = nil
+		}
+		reply := new(proto.QueryResult)
+		q := &proto.ColumnValuesQuery{
+			Sql:          tcase.sql,
+			Table:        tcase.table,
+			ColumnName:   tcase.column,
+			ColumnValues: tcase.values,
+			TabletType:   topo.TYPE_MASTER,
+		}
+		if err := RpcVTGate.ExecuteColumnValues(&context.DummyContext{}, q, reply); err != nil || reply.Error != "" {
+			t.Fatalf("ExecuteColumnValues(%v %v): %v %v", tcase.column, tcase.values, err, reply.Error)
+		}
+		if got := resultString(reply.Result); got != tcase.want {
+			t.Errorf("ExecuteColumnValues(%v %v): got %v, want %v", tcase.column, tcase.values, got, tcase.want)
+		}
+		// the rows are read from the shards their column values
+		// map to, with no scatter
+		if got := len(userConns[0].queries) + len(userConns[1].queries); got != tcase.userQueries {
+			t.Errorf("ExecuteColumnValues(%v %v): got %v user queries, want %v", tcase.column, tcase.values, got, tcase.userQueries)
+		}
+	}
+
+	for _, q := range []*proto.ColumnValuesQuery{
+		{Sql: "select id from unknown", Table: "unknown", ColumnName: "id", ColumnValues: []interface{}{1}, TabletType: topo.TYPE_MASTER},
+		{Sql: "select id from user", Table: "user", ColumnName: "unknown", ColumnValues: []interface{}{1}, TabletType: topo.TYPE_MASTER},
+	} {
+		reply := new(proto.QueryResult)
+		if err := RpcVTGate.ExecuteColumnValues(&context.DummyContext{}, q, reply); err != nil || reply.Error == "" {
+			t.Errorf("ExecuteColumnValues(%v %v) didn't fail: %v", q.Table, q.ColumnName, err)
+		}
+	}
+}
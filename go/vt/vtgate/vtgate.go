@@ -7,6 +7,7 @@
 package vtgate
 
 import (
+	"net/http"
 	"strings"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/youtube/vitess/go/vt/context"
 	"github.com/youtube/vitess/go/vt/logutil"
 	"github.com/youtube/vitess/go/vt/vtgate/proto"
+	"github.com/youtube/vitess/go/vt/vtgate/vindexes"
 )
 
 const errDupKey = "errno 1062"
@@ -40,13 +42,20 @@ type VTGate struct {
 	errors     *stats.MultiCounters
 	infoErrors *stats.Counters
 
+	// vschema describes how the tables of the keyspaces are
+	// sharded, vschemaFormal is its source.
+	vschema       *vindexes.VSchema
+	vschemaFormal map[string]*vindexes.KeyspaceFormal
+
 	// the throttled loggers for all errors, one per API entry
 	logExecuteShard             *logutil.ThrottledLogger
 	logExecuteKeyspaceIds       *logutil.ThrottledLogger
 	logExecuteKeyRanges         *logutil.ThrottledLogger
 	logExecuteEntityIds         *logutil.ThrottledLogger
+	logExecuteColumnValues      *logutil.ThrottledLogger
 	logExecuteBatchShard        *logutil.ThrottledLogger
 	logExecuteBatchKeyspaceIds  *logutil.ThrottledLogger
+	logExecuteBatchKeyRanges    *logutil.ThrottledLogger
 	logStreamExecuteKeyspaceIds *logutil.ThrottledLogger
 	logStreamExecuteKeyRanges   *logutil.ThrottledLogger
 	logStreamExecuteShard       *logutil.ThrottledLogger
@@ -61,8 +70,19 @@ func Init(serv SrvTopoServer, cell string, retryDelay time.Duration, retryCount
 	if RpcVTGate != nil {
 		log.Fatalf("VTGate already initialized")
 	}
+	if *transactionMode != TX_BEST_EFFORT && *transactionMode != TX_TWOPC {
+		log.Fatalf("invalid -transaction_mode %v", *transactionMode)
+	}
+	resolver := NewResolver(serv, "VttabletCall", cell, retryDelay, retryCount, timeout)
+	if *transactionMode == TX_TWOPC {
+		resolver.scatterConn.startTwoPCWatchdog()
+	}
+	if discovery := newTabletDiscoveryFromFlags(serv, cell, retryDelay, timeout); discovery != nil {
+		resolver.scatterConn.discovery = discovery
+		stats.NewMultiCountersFunc("HealthyTabletCount", []string{"Keyspace", "ShardName", "DbType"}, discovery.HealthyTabletCount)
+	}
 	RpcVTGate = &VTGate{
-		resolver:   NewResolver(serv, "VttabletCall", cell, retryDelay, retryCount, timeout),
+		resolver:   resolver,
 		timings:    stats.NewMultiTimings("VtgateApi", []string{"Operation", "Keyspace", "DbType"}),
 		errors:     stats.NewMultiCounters("VtgateApiErrorCounts", []string{"Operation", "Keyspace", "DbType"}),
 		infoErrors: stats.NewCounters("VtgateInfoErrorCounts"),
@@ -71,12 +91,29 @@ func Init(serv SrvTopoServer, cell string, retryDelay time.Duration, retryCount
 		logExecuteKeyspaceIds:       logutil.NewThrottledLogger("ExecuteKeyspaceIds", 5*time.Second),
 		logExecuteKeyRanges:         logutil.NewThrottledLogger("ExecuteKeyRanges", 5*time.Second),
 		logExecuteEntityIds:         logutil.NewThrottledLogger("ExecuteEntityIds", 5*time.Second),
+		logExecuteColumnValues:      logutil.NewThrottledLogger("ExecuteColumnValues", 5*time.Second),
 		logExecuteBatchShard:        logutil.NewThrottledLogger("ExecuteBatchShard", 5*time.Second),
 		logExecuteBatchKeyspaceIds:  logutil.NewThrottledLogger("ExecuteBatchKeyspaceIds", 5*time.Second),
+		logExecuteBatchKeyRanges:    logutil.NewThrottledLogger("ExecuteBatchKeyRanges", 5*time.Second),
 		logStreamExecuteKeyspaceIds: logutil.NewThrottledLogger("StreamExecuteKeyspaceIds", 5*time.Second),
 		logStreamExecuteKeyRanges:   logutil.NewThrottledLogger("StreamExecuteKeyRanges", 5*time.Second),
 		logStreamExecuteShard:       logutil.NewThrottledLogger("StreamExecuteShard", 5*time.Second),
 	}
+	vschema, vschemaFormal, err := loadVSchema(&context.DummyContext{}, serv, cell)
+	if err != nil {
+		log.Errorf("cannot load the VSchema, queries can't be routed by column values: %v", err)
+		vschema, _ = vindexes.BuildVSchema(nil)
+	}
+	RpcVTGate.vschema = vschema
+	RpcVTGate.vschemaFormal = vschemaFormal
+	http.HandleFunc("/debug/vschema", RpcVTGate.serveVSchema)
+
+	plans := resolver.scatterConn.plans
+	stats.Publish("VtgatePlanCacheLength", stats.IntFunc(plans.Length))
+	stats.Publish("VtgatePlanCacheCapacity", stats.IntFunc(plans.Capacity))
+	http.HandleFunc("/debug/vtgate_plans", resolver.scatterConn.servePlans)
+	http.HandleFunc("/debug/vtgate_plans/evict", resolver.scatterConn.serveEvictPlan)
+
 	QPSByOperation = stats.NewRates("QPSByOperation", stats.CounterForDimension(RpcVTGate.timings, "Operation"), 15, 1*time.Minute)
 	QPSByKeyspace = stats.NewRates("QPSByKeyspace", stats.CounterForDimension(RpcVTGate.timings, "Keyspace"), 15, 1*time.Minute)
 	QPSByDbType = stats.NewRates("QPSByDbType", stats.CounterForDimension(RpcVTGate.timings, "DbType"), 15, 1*time.Minute)
@@ -150,7 +187,17 @@ func (vtg *VTGate) ExecuteKeyRanges(context context.Context, query *proto.KeyRan
 	statsKey := []string{"ExecuteKeyRanges", query.Keyspace, string(query.TabletType)}
 	defer vtg.timings.Record(statsKey, startTime)
 
-	qr, err := vtg.resolver.ExecuteKeyRanges(context, query)
+	// The joins of tables of different keyspaces are executed by
+	// vtgate, on the keyspaces of the tables.
+	var qr *mproto.QueryResult
+	join, err := planJoin(vtg.vschema, query.Sql)
+	switch {
+	case err != nil:
+	case join != nil:
+		qr, err = vtg.resolver.executeJoin(context, vtg.vschema, join, query)
+	default:
+		qr, err = vtg.resolver.ExecuteKeyRanges(context, query)
+	}
 	if err == nil {
 		reply.Result = qr
 	} else {
@@ -188,6 +235,37 @@ func (vtg *VTGate) ExecuteEntityIds(context context.Context, query *proto.Entity
 	return nil
 }
 
+// ExecuteColumnValues executes a non-streaming query on the rows of a
+// table with the given column values, routed with the VSchema.
+func (vtg *VTGate) ExecuteColumnValues(context context.Context, query *proto.ColumnValuesQuery, reply *proto.QueryResult) error {
+	startTime := time.Now()
+	table, err := vtg.vschema.FindTable(query.Table)
+	keyspace := ""
+	if err == nil {
+		keyspace = table.Keyspace.Name
+	}
+	statsKey := []string{"ExecuteColumnValues", keyspace, string(query.TabletType)}
+	defer vtg.timings.Record(statsKey, startTime)
+
+	var qr *mproto.QueryResult
+	if err == nil {
+		qr, err = vtg.resolver.ExecuteColumnValues(context, vtg.vschema, table, query)
+	}
+	if err == nil {
+		reply.Result = qr
+	} else {
+		reply.Error = err.Error()
+		if strings.Contains(reply.Error, errDupKey) {
+			vtg.infoErrors.Add("DupKey", 1)
+		} else {
+			vtg.errors.Add(statsKey, 1)
+			vtg.logExecuteColumnValues.Errorf("%v, query: %+v", err, query)
+		}
+	}
+	reply.Session = query.Session
+	return nil
+}
+
 // ExecuteBatchShard executes a group of queries on the specified shards.
 func (vtg *VTGate) ExecuteBatchShard(context context.Context, batchQuery *proto.BatchQueryShard, reply *proto.QueryResultList) error {
 	startTime := time.Now()
@@ -243,6 +321,30 @@ func (vtg *VTGate) ExecuteBatchKeyspaceIds(context context.Context, query *proto
 	return nil
 }
 
+// ExecuteBatchKeyRanges executes a group of queries based on the specified keyranges.
+func (vtg *VTGate) ExecuteBatchKeyRanges(context context.Context, query *proto.KeyRangeBatchQuery, reply *proto.QueryResultList) error {
+	startTime := time.Now()
+	statsKey := []string{"ExecuteBatchKeyRanges", query.Keyspace, string(query.TabletType)}
+	defer vtg.timings.Record(statsKey, startTime)
+
+	qrs, err := vtg.resolver.ExecuteBatchKeyRanges(
+		context,
+		query)
+	if err == nil {
+		reply.List = qrs.List
+	} else {
+		reply.Error = err.Error()
+		if strings.Contains(reply.Error, errDupKey) {
+			vtg.infoErrors.Add("DupKey", 1)
+		} else {
+			vtg.errors.Add(statsKey, 1)
+			vtg.logExecuteBatchKeyRanges.Errorf("%v, query: %+v", err, query)
+		}
+	}
+	reply.Session = query.Session
+	return nil
+}
+
 // StreamExecuteKeyspaceIds executes a streaming query on the specified KeyspaceIds.
 // The KeyspaceIds are resolved to shards using the serving graph.
 // This function currently temporarily enforces the restriction of executing on
@@ -358,3 +460,20 @@ func (vtg *VTGate) Commit(context context.Context, inSession *proto.Session) err
 func (vtg *VTGate) Rollback(context context.Context, inSession *proto.Session) error {
 	return vtg.resolver.Rollback(context, inSession)
 }
+
+// ShardStatus returns the status of the shards vtgate sent queries
+// to, for the status page.
+func (vtg *VTGate) ShardStatus() []*ShardStatus {
+	return vtg.resolver.scatterConn.ShardStatus()
+}
+
+// EvictPlan evicts the cached plan of a query sent to several shards
+// of keyspace. It returns false if there was no such plan.
+func (vtg *VTGate) EvictPlan(keyspace, sql string) bool {
+	return vtg.resolver.scatterConn.EvictPlan(keyspace, sql)
+}
+
+// ClearPlans empties the plan cache.
+func (vtg *VTGate) ClearPlans() {
+	vtg.resolver.scatterConn.ClearPlans()
+}
@@ -373,6 +373,52 @@ func TestVTGateExecuteBatchKeyspaceIds(t *testing.T) {
 	}
 }
 
+func TestVTGateExecuteBatchKeyRanges(t *testing.T) {
+	s := createSandbox("TestVTGateExecuteBatchKeyRanges")
+	sbc1 := &sandboxConn{}
+	sbc2 := &sandboxConn{}
+	s.MapTestConn("-20", sbc1)
+	s.MapTestConn("20-40", sbc2)
+	kr, err := key.ParseKeyRangeParts("10", "30")
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	q := proto.KeyRangeBatchQuery{
+		Queries: []tproto.BoundQuery{{
+			"query",
+			nil,
+		}, {
+			"query",
+			nil,
+		}},
+		Keyspace:   "TestVTGateExecuteBatchKeyRanges",
+		KeyRanges:  []key.KeyRange{kr},
+		TabletType: topo.TYPE_MASTER,
+	}
+	qrl := new(proto.QueryResultList)
+	err = RpcVTGate.ExecuteBatchKeyRanges(&context.DummyContext{}, &q, qrl)
+	if err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+	if len(qrl.List) != 2 {
+		t.Errorf("want 2, got %v", len(qrl.List))
+	}
+	if qrl.List[0].RowsAffected != 2 {
+		t.Errorf("want 2, got %v", qrl.List[0].RowsAffected)
+	}
+	// Both queries go to each shard in a single call.
+	if sbc1.ExecCount != 1 || sbc2.ExecCount != 1 {
+		t.Errorf("want 1, 1, got %v, %v", sbc1.ExecCount, sbc2.ExecCount)
+	}
+
+	q.Session = new(proto.Session)
+	RpcVTGate.Begin(&context.DummyContext{}, q.Session)
+	RpcVTGate.ExecuteBatchKeyRanges(&context.DummyContext{}, &q, qrl)
+	if len(q.Session.ShardSessions) != 2 {
+		t.Errorf("want 2, got %d", len(q.Session.ShardSessions))
+	}
+}
+
 func TestVTGateStreamExecuteKeyspaceIds(t *testing.T) {
 	s := createSandbox("TestVTGateStreamExecuteKeyspaceIds")
 	sbc := &sandboxConn{}
@@ -0,0 +1,610 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youtube/vitess/go/sync2"
+	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/mysqlctl"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/wrangler"
+)
+
+const (
+	// all the states for the worker
+	stateMWNotSarted = "not started"
+	stateMWDone      = "done"
+	stateMWError     = "error"
+
+	stateMWInit           = "initializing"
+	stateMWFindTargets    = "finding target instances"
+	stateMWBackfill       = "backfilling the derived table"
+	stateMWStartStreaming = "starting filtered replication"
+	stateMWCutoverCheck   = "checking the positions for cutover"
+	stateMWCleanUp        = "cleaning up"
+)
+
+// MaterializeWorker creates a derived copy of a table of a source shard
+// in a destination shard: the table is created with its own schema (for
+// instance with different secondary keys), backfilled from a source
+// rdonly tablet stopped at a known position, and then kept in sync by
+// filtered replication from that position. Its last phase waits for
+// filtered replication to catch up with the source master, so the
+// clients can be cut over to the derived table.
+type MaterializeWorker struct {
+	wr                     *wrangler.Wrangler
+	cell                   string
+	sourceKeyspace         string
+	sourceShard            string
+	destinationKeyspace    string
+	destinationShard       string
+	table                  string
+	createSql              string
+	sourceReaderCount      int
+	minTableSizeForSplit   uint64
+	destinationWriterCount int
+	catchUpTimeout         time.Duration
+	cleaner                *wrangler.Cleaner
+
+	// all subsequent fields are protected by the mutex
+	mu    sync.Mutex
+	state string
+
+	// populated if state == stateMWError
+	err error
+
+	// populated during stateMWInit, read-only after that
+	sourceShardInfo *topo.ShardInfo
+
+	// populated during stateMWFindTargets, read-only after that
+	sourceAlias            topo.TabletAlias
+	sourceTablet           *topo.TabletInfo
+	destinationAliases     []topo.TabletAlias
+	destinationTablets     map[topo.TabletAlias]*topo.TabletInfo
+	destinationMasterAlias topo.TabletAlias
+
+	// populated during stateMWBackfill
+	tableStatus    []tableStatus
+	startTime      time.Time
+	sourcePosition myproto.GTID
+
+	// populated during stateMWCutoverCheck
+	masterPosition myproto.GTID
+}
+
+// NewMaterializeWorker returns a new MaterializeWorker object. createSql
+// is the CREATE TABLE statement of the derived table, with
+// {{.DatabaseName}} for the destination database. If it's empty, the
+// table is created with the schema of the source.
+func NewMaterializeWorker(wr *wrangler.Wrangler, cell, sourceKeyspace, sourceShard, destinationKeyspace, destinationShard, table, createSql string, sourceReaderCount int, minTableSizeForSplit uint64, destinationWriterCount int, catchUpTimeout time.Duration) Worker {
+	return &MaterializeWorker{
+		wr:                     wr,
+		cell:                   cell,
+		sourceKeyspace:         sourceKeyspace,
+		sourceShard:            sourceShard,
+		destinationKeyspace:    destinationKeyspace,
+		destinationShard:       destinationShard,
+		table:                  table,
+		createSql:              createSql,
+		sourceReaderCount:      sourceReaderCount,
+		minTableSizeForSplit:   minTableSizeForSplit,
+		destinationWriterCount: destinationWriterCount,
+		catchUpTimeout:         catchUpTimeout,
+		cleaner:                &wrangler.Cleaner{},
+
+		state: stateMWNotSarted,
+	}
+}
+
+func (mw *MaterializeWorker) setState(state string) {
+	mw.mu.Lock()
+	mw.state = state
+	mw.mu.Unlock()
+}
+
+func (mw *MaterializeWorker) recordError(err error) {
+	mw.mu.Lock()
+	mw.state = stateMWError
+	mw.err = err
+	mw.mu.Unlock()
+}
+
+func (mw *MaterializeWorker) tableStatuses() []string {
+	result := make([]string, len(mw.tableStatus))
+	for i := range mw.tableStatus {
+		ts := &mw.tableStatus[i]
+		ts.mu.Lock()
+		result[i] = fmt.Sprintf("%v: %v (%v/%v)", ts.name, ts.state, ts.copiedRows, ts.rowCount)
+		ts.mu.Unlock()
+	}
+	return result
+}
+
+// StatusAsHTML implements the Worker interface
+func (mw *MaterializeWorker) StatusAsHTML() template.HTML {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	result := "<b>Working on:</b> " + mw.destinationKeyspace + "/" + mw.destinationShard + "/" + mw.table + "</br>\n"
+	result += "<b>State:</b> " + mw.state + "</br>\n"
+	switch mw.state {
+	case stateMWError:
+		result += "<b>Error</b>: " + mw.err.Error() + "</br>\n"
+	case stateMWBackfill:
+		result += "<b>Running</b>:</br>\n"
+		result += "<b>Copying from</b>: " + mw.sourceAlias.String() + "</br>\n"
+		result += strings.Join(mw.tableStatuses(), "</br>\n")
+	case stateMWStartStreaming, stateMWCutoverCheck:
+		result += "<b>Streaming from</b>: " + fmt.Sprintf("%v", mw.sourcePosition) + "</br>\n"
+	case stateMWDone:
+		result += "<b>Success</b>:</br>\n"
+		result += strings.Join(mw.tableStatuses(), "</br>\n") + "</br>\n"
+		result += "<b>Caught up with the source master at</b>: " + fmt.Sprintf("%v", mw.masterPosition) + "</br>\n"
+	}
+
+	return template.HTML(result)
+}
+
+// StatusAsText implements the Worker interface
+func (mw *MaterializeWorker) StatusAsText() string {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	result := "Working on: " + mw.destinationKeyspace + "/" + mw.destinationShard + "/" + mw.table + "\n"
+	result += "State: " + mw.state + "\n"
+	switch mw.state {
+	case stateMWError:
+		result += "Error: " + mw.err.Error() + "\n"
+	case stateMWBackfill:
+		result += "Running:\n"
+		result += "Copying from: " + mw.sourceAlias.String() + "\n"
+		result += strings.Join(mw.tableStatuses(), "\n")
+	case stateMWStartStreaming, stateMWCutoverCheck:
+		result += "Streaming from: " + fmt.Sprintf("%v", mw.sourcePosition) + "\n"
+	case stateMWDone:
+		result += "Success:\n"
+		result += strings.Join(mw.tableStatuses(), "\n") + "\n"
+		result += "Caught up with the source master at: " + fmt.Sprintf("%v", mw.masterPosition) + "\n"
+	}
+	return result
+}
+
+func (mw *MaterializeWorker) CheckInterrupted() bool {
+	select {
+	case <-interrupted:
+		mw.recordError(topo.ErrInterrupted)
+		return true
+	default:
+	}
+	return false
+}
+
+// Run implements the Worker interface
+func (mw *MaterializeWorker) Run() {
+	err := mw.run()
+
+	mw.setState(stateMWCleanUp)
+	cerr := mw.cleaner.CleanUp(mw.wr)
+	if cerr != nil {
+		if err != nil {
+			mw.wr.Logger().Errorf("CleanUp failed in addition to job error: %v", cerr)
+		} else {
+			err = cerr
+		}
+	}
+	if err != nil {
+		mw.recordError(err)
+		return
+	}
+	mw.setState(stateMWDone)
+}
+
+func (mw *MaterializeWorker) Error() error {
+	return mw.err
+}
+
+func (mw *MaterializeWorker) run() error {
+	// first state: read what we need to do
+	if err := mw.init(); err != nil {
+		return fmt.Errorf("init() failed: %v", err)
+	}
+	if mw.CheckInterrupted() {
+		return topo.ErrInterrupted
+	}
+
+	// second state: find targets
+	if err := mw.findTargets(); err != nil {
+		return fmt.Errorf("findTargets() failed: %v", err)
+	}
+	if mw.CheckInterrupted() {
+		return topo.ErrInterrupted
+	}
+
+	// third state: create and backfill the table
+	if err := mw.backfill(); err != nil {
+		return fmt.Errorf("backfill() failed: %v", err)
+	}
+	if mw.CheckInterrupted() {
+		return topo.ErrInterrupted
+	}
+
+	// fourth state: start filtered replication
+	if err := mw.startStreaming(); err != nil {
+		return fmt.Errorf("startStreaming() failed: %v", err)
+	}
+	if mw.CheckInterrupted() {
+		return topo.ErrInterrupted
+	}
+
+	// fifth state: wait for filtered replication to catch up
+	if err := mw.cutoverCheck(); err != nil {
+		return fmt.Errorf("cutoverCheck() failed: %v", err)
+	}
+
+	return nil
+}
+
+// init phase:
+// - read the source shard, make sure it has a master
+// - read the destination shard, make sure it has no sources yet
+func (mw *MaterializeWorker) init() error {
+	mw.setState(stateMWInit)
+
+	var err error
+	mw.sourceShardInfo, err = mw.wr.TopoServer().GetShard(mw.sourceKeyspace, mw.sourceShard)
+	if err != nil {
+		return fmt.Errorf("cannot read source shard %v/%v: %v", mw.sourceKeyspace, mw.sourceShard, err)
+	}
+	if mw.sourceShardInfo.MasterAlias.IsZero() {
+		return fmt.Errorf("source shard %v/%v has no master", mw.sourceKeyspace, mw.sourceShard)
+	}
+
+	destinationShardInfo, err := mw.wr.TopoServer().GetShard(mw.destinationKeyspace, mw.destinationShard)
+	if err != nil {
+		return fmt.Errorf("cannot read destination shard %v/%v: %v", mw.destinationKeyspace, mw.destinationShard, err)
+	}
+	if len(destinationShardInfo.SourceShards) > 0 {
+		return fmt.Errorf("destination shard %v/%v already has SourceShards", mw.destinationKeyspace, mw.destinationShard)
+	}
+
+	return nil
+}
+
+// findTargets phase:
+// - find one rdonly in the source shard
+// - mark it as 'checker' pointing back to us
+// - get the aliases of all the targets
+func (mw *MaterializeWorker) findTargets() error {
+	mw.setState(stateMWFindTargets)
+
+	// find an appropriate endpoint in the source shard
+	var err error
+	mw.sourceAlias, err = findChecker(mw.wr, mw.cleaner, mw.cell, mw.sourceKeyspace, mw.sourceShard)
+	if err != nil {
+		return fmt.Errorf("cannot find checker for %v/%v/%v: %v", mw.cell, mw.sourceKeyspace, mw.sourceShard, err)
+	}
+	mw.wr.Logger().Infof("Using tablet %v as the source", mw.sourceAlias)
+
+	// get the tablet info for it
+	mw.sourceTablet, err = mw.wr.TopoServer().GetTablet(mw.sourceAlias)
+	if err != nil {
+		return fmt.Errorf("cannot read tablet %v: %v", mw.sourceAlias, err)
+	}
+
+	// find all the targets in the destination keyspace / shard
+	mw.destinationAliases, err = topo.FindAllTabletAliasesInShard(mw.wr.TopoServer(), mw.destinationKeyspace, mw.destinationShard)
+	if err != nil {
+		return fmt.Errorf("cannot find all target tablets in %v/%v: %v", mw.destinationKeyspace, mw.destinationShard, err)
+	}
+	mw.wr.Logger().Infof("Found %v target aliases", len(mw.destinationAliases))
+
+	// get the TabletInfo for all targets
+	mw.destinationTablets, err = topo.GetTabletMap(mw.wr.TopoServer(), mw.destinationAliases)
+	if err != nil {
+		return fmt.Errorf("cannot read all target tablets in %v/%v: %v", mw.destinationKeyspace, mw.destinationShard, err)
+	}
+
+	// find and validate the master
+	for tabletAlias, ti := range mw.destinationTablets {
+		if ti.Type == topo.TYPE_MASTER {
+			if mw.destinationMasterAlias.IsZero() {
+				mw.destinationMasterAlias = tabletAlias
+			} else {
+				return fmt.Errorf("multiple masters in destination shard: %v and %v at least", mw.destinationMasterAlias, tabletAlias)
+			}
+		}
+	}
+	if mw.destinationMasterAlias.IsZero() {
+		return fmt.Errorf("no master in destination shard")
+	}
+
+	return nil
+}
+
+// backfill phase:
+// - stop replication on the source checker, and get its position
+//   (add a cleanup task to restart replication on it, and change
+//    the existing ChangeSlaveType cleanup action to 'spare' type)
+// - get the schema of the table on the source
+// - create the derived table on all destinations
+// - copy the data with chunked selects
+// - populate the blp_checkpoint table with the source position
+func (mw *MaterializeWorker) backfill() error {
+	mw.setState(stateMWBackfill)
+
+	// stop the source, so the copy is consistent with its position
+	mw.wr.Logger().Infof("Stopping replication on %v", mw.sourceAlias)
+	if err := mw.wr.ActionInitiator().StopSlave(mw.sourceTablet, 30*time.Second); err != nil {
+		return fmt.Errorf("cannot stop slave %v: %v", mw.sourceAlias, err)
+	}
+	wrangler.RecordStartSlaveAction(mw.cleaner, mw.sourceAlias, 30*time.Second)
+	action, err := wrangler.FindChangeSlaveTypeActionByTarget(mw.cleaner, mw.sourceAlias)
+	if err != nil {
+		return fmt.Errorf("cannot find ChangeSlaveType action for %v: %v", mw.sourceAlias, err)
+	}
+	action.TabletType = topo.TYPE_SPARE
+	pos, err := mw.wr.ActionInitiator().SlavePosition(mw.sourceTablet, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot get the position of %v: %v", mw.sourceAlias, err)
+	}
+	mw.wr.Logger().Infof("Source %v stopped at %v", mw.sourceAlias, pos.MasterLogGTIDField)
+
+	// get source schema
+	sourceSchemaDefinition, err := mw.wr.GetSchema(mw.sourceAlias, []string{mw.table}, nil, false)
+	if err != nil {
+		return fmt.Errorf("cannot get schema from source %v: %v", mw.sourceAlias, err)
+	}
+	if len(sourceSchemaDefinition.TableDefinitions) != 1 || sourceSchemaDefinition.TableDefinitions[0].Name != mw.table {
+		return fmt.Errorf("no table %v on source %v", mw.table, mw.sourceAlias)
+	}
+	td := sourceSchemaDefinition.TableDefinitions[0]
+	mw.mu.Lock()
+	mw.tableStatus = make([]tableStatus, 1)
+	mw.tableStatus[0].name = td.Name
+	mw.tableStatus[0].rowCount = td.RowCount
+	mw.tableStatus[0].state = "before table creation"
+	mw.startTime = time.Now()
+	mw.sourcePosition = pos.MasterLogGTIDField.Value
+	mw.mu.Unlock()
+
+	// The destination database may already exist, with other tables.
+	createDbCmds := []string{strings.Replace(sourceSchemaDefinition.DatabaseSchema, "CREATE DATABASE `", "CREATE DATABASE IF NOT EXISTS `", 1)}
+	if mw.createSql != "" {
+		createDbCmds = append(createDbCmds, mw.createSql)
+	} else {
+		create, _, err := mysqlctl.MakeSplitCreateTableSql(td.Schema, "{{.DatabaseName}}", td.Name, "")
+		if err != nil {
+			return fmt.Errorf("MakeSplitCreateTableSql(%v) returned: %v", td.Name, err)
+		}
+		createDbCmds = append(createDbCmds, create)
+	}
+
+	// For each destination tablet (in parallel):
+	// - create the table
+	// - setup the channels to send SQL data chunks
+	//
+	// mu protects the abort channel for closing, and firstError
+	mu := sync.Mutex{}
+	abort := make(chan struct{})
+	var firstError error
+
+	processError := func(format string, args ...interface{}) {
+		mw.wr.Logger().Errorf(format, args...)
+		mu.Lock()
+		if abort != nil {
+			close(abort)
+			abort = nil
+			firstError = fmt.Errorf(format, args...)
+		}
+		mu.Unlock()
+	}
+
+	insertChannels := make([]chan string, len(mw.destinationAliases))
+	destinationWaitGroup := sync.WaitGroup{}
+	for i, tabletAlias := range mw.destinationAliases {
+		insertChannels[i] = make(chan string, mw.destinationWriterCount*2)
+
+		destinationWaitGroup.Add(1)
+		go func(ti *topo.TabletInfo, insertChannel chan string) {
+			defer destinationWaitGroup.Done()
+			mw.wr.Logger().Infof("Creating table %v on tablet %v", mw.table, ti.Alias)
+			if err := runSqlCommands(mw.wr, ti, createDbCmds, abort); err != nil {
+				processError("createDbCmds failed: %v", err)
+				return
+			}
+			for j := 0; j < mw.destinationWriterCount; j++ {
+				destinationWaitGroup.Add(1)
+				go func() {
+					defer destinationWaitGroup.Done()
+					for {
+						select {
+						case cmd, ok := <-insertChannel:
+							if !ok {
+								return
+							}
+							cmd = "INSERT INTO `" + ti.DbName() + "`." + cmd
+							_, err := mw.wr.ActionInitiator().ExecuteFetch(ti, cmd, 0, false, true, 30*time.Second)
+							if err != nil {
+								processError("ExecuteFetch failed: %v", err)
+								return
+							}
+						case <-abort:
+							return
+						}
+					}
+				}()
+			}
+		}(mw.destinationTablets[tabletAlias], insertChannels[i])
+	}
+
+	// Now read the data chunks, and send them to all insertChannels.
+	// The derived table has the columns of the source table, so the
+	// rows are inserted as they are.
+	mw.tableStatus[0].setState("before copy")
+	chunks, err := findChunks(mw.wr, mw.sourceTablet, td, mw.minTableSizeForSplit, mw.sourceReaderCount)
+	if err != nil {
+		return err
+	}
+	sourceWaitGroup := sync.WaitGroup{}
+	sema := sync2.NewSemaphore(mw.sourceReaderCount, 0)
+	for chunkIndex := 0; chunkIndex < len(chunks)-1; chunkIndex++ {
+		sourceWaitGroup.Add(1)
+		go func(chunkIndex int) {
+			defer sourceWaitGroup.Done()
+
+			sema.Acquire()
+			defer sema.Release()
+
+			mw.tableStatus[0].setState("started the copy")
+
+			// build the query, and start the streaming
+			selectSQL := "SELECT " + strings.Join(td.Columns, ", ") + " FROM " + td.Name
+			if chunks[chunkIndex] != "" || chunks[chunkIndex+1] != "" {
+				mw.wr.Logger().Infof("Starting to stream all data from table %v between '%v' and '%v'", td.Name, chunks[chunkIndex], chunks[chunkIndex+1])
+				clauses := make([]string, 0, 2)
+				if chunks[chunkIndex] != "" {
+					clauses = append(clauses, td.PrimaryKeyColumns[0]+">="+chunks[chunkIndex])
+				}
+				if chunks[chunkIndex+1] != "" {
+					clauses = append(clauses, td.PrimaryKeyColumns[0]+"<"+chunks[chunkIndex+1])
+				}
+				selectSQL += " WHERE " + strings.Join(clauses, " AND ")
+			} else {
+				mw.wr.Logger().Infof("Starting to stream all data from table %v", td.Name)
+			}
+			if len(td.PrimaryKeyColumns) > 0 {
+				selectSQL += " ORDER BY " + strings.Join(td.PrimaryKeyColumns, ", ")
+			}
+			qrr, err := NewQueryResultReaderForTablet(mw.wr.TopoServer(), mw.sourceAlias, selectSQL)
+			if err != nil {
+				processError("NewQueryResultReaderForTablet failed: %v", err)
+				return
+			}
+
+			// process the data
+			baseCmd := td.Name + "(" + strings.Join(td.Columns, ", ") + ") VALUES "
+			for {
+				select {
+				case r, ok := <-qrr.Output:
+					if !ok {
+						if err := qrr.Error(); err != nil {
+							processError("QueryResultReader failed: %v", err)
+						}
+						return
+					}
+
+					// send the rows to be inserted
+					mw.tableStatus[0].addCopiedRows(len(r.Rows))
+					cmd := baseCmd + makeValueString(qrr.Fields, r)
+					for _, c := range insertChannels {
+						c <- cmd
+					}
+				case <-abort:
+					return
+				}
+			}
+		}(chunkIndex)
+	}
+	sourceWaitGroup.Wait()
+
+	for _, c := range insertChannels {
+		close(c)
+	}
+	destinationWaitGroup.Wait()
+	if firstError != nil {
+		return firstError
+	}
+	mw.tableStatus[0].setState("finished the copy")
+
+	// then create and populate the blp_checkpoint table, so filtered
+	// replication starts where the copy stopped
+	queries := make([]string, 0, 4)
+	queries = append(queries, binlogplayer.CreateBlpCheckpoint()...)
+	queries = append(queries, binlogplayer.PopulateBlpCheckpoint(0, pos.MasterLogGTIDField.Value, time.Now().Unix(), ""))
+	for _, tabletAlias := range mw.destinationAliases {
+		destinationWaitGroup.Add(1)
+		go func(ti *topo.TabletInfo) {
+			defer destinationWaitGroup.Done()
+			mw.wr.Logger().Infof("Making and populating blp_checkpoint table on tablet %v", ti.Alias)
+			if err := runSqlCommands(mw.wr, ti, queries, abort); err != nil {
+				processError("blp_checkpoint queries failed on tablet %v: %v", ti.Alias, err)
+			}
+		}(mw.destinationTablets[tabletAlias])
+	}
+	destinationWaitGroup.Wait()
+	return firstError
+}
+
+// startStreaming phase:
+// - set the source shard of the destination shard, filtered by the table
+// - reload the schema on all destinations, which starts filtered
+//   replication on the master
+func (mw *MaterializeWorker) startStreaming() error {
+	mw.setState(stateMWStartStreaming)
+
+	mw.wr.Logger().Infof("Setting SourceShard on shard %v/%v", mw.destinationKeyspace, mw.destinationShard)
+	if err := mw.wr.SetSourceShards(mw.destinationKeyspace, mw.destinationShard, []topo.TabletAlias{mw.sourceAlias}, []string{mw.table}); err != nil {
+		return fmt.Errorf("Failed to set source shards: %v", err)
+	}
+
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{} // protects firstError
+	var firstError error
+	for _, tabletAlias := range mw.destinationAliases {
+		wg.Add(1)
+		go func(ti *topo.TabletInfo) {
+			defer wg.Done()
+			mw.wr.Logger().Infof("Reloading schema on tablet %v", ti.Alias)
+			if err := mw.wr.ActionInitiator().ReloadSchema(ti, 30*time.Second); err != nil {
+				mw.wr.Logger().Errorf("ReloadSchema failed on tablet %v: %v", ti.Alias, err)
+				mu.Lock()
+				if firstError == nil {
+					firstError = fmt.Errorf("ReloadSchema failed on tablet %v: %v", ti.Alias, err)
+				}
+				mu.Unlock()
+			}
+		}(mw.destinationTablets[tabletAlias])
+	}
+	wg.Wait()
+	return firstError
+}
+
+// cutoverCheck phase:
+// - get the current position of the source master
+// - wait until filtered replication on the destination master has
+//   reached it
+// Once it has, the derived table is only behind the source table by
+// the filtered replication lag, and the clients can be cut over.
+func (mw *MaterializeWorker) cutoverCheck() error {
+	mw.setState(stateMWCutoverCheck)
+
+	masterTablet, err := mw.wr.TopoServer().GetTablet(mw.sourceShardInfo.MasterAlias)
+	if err != nil {
+		return fmt.Errorf("cannot read source master %v: %v", mw.sourceShardInfo.MasterAlias, err)
+	}
+	masterPos, err := mw.wr.ActionInitiator().MasterPosition(masterTablet, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot get the position of source master %v: %v", mw.sourceShardInfo.MasterAlias, err)
+	}
+
+	mw.wr.Logger().Infof("Waiting for filtered replication on %v to reach %v", mw.destinationMasterAlias, masterPos.MasterLogGTIDField)
+	if err := mw.wr.ActionInitiator().WaitBlpPosition(mw.destinationMasterAlias, blproto.BlpPosition{
+		Uid:       0,
+		GTIDField: masterPos.MasterLogGTIDField,
+	}, mw.catchUpTimeout); err != nil {
+		return fmt.Errorf("filtered replication on %v didn't reach source master position %v: %v", mw.destinationMasterAlias, masterPos.MasterLogGTIDField, err)
+	}
+
+	mw.mu.Lock()
+	mw.masterPosition = masterPos.MasterLogGTIDField.Value
+	mw.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,529 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package worker
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mproto "github.com/youtube/vitess/go/mysql/proto"
+	rpc "github.com/youtube/vitess/go/rpcplus"
+	"github.com/youtube/vitess/go/rpcwrap/bsonrpc"
+	rpcproto "github.com/youtube/vitess/go/rpcwrap/proto"
+	"github.com/youtube/vitess/go/sqltypes"
+	blproto "github.com/youtube/vitess/go/vt/binlog/proto"
+	"github.com/youtube/vitess/go/vt/logutil"
+	myproto "github.com/youtube/vitess/go/vt/mysqlctl/proto"
+	"github.com/youtube/vitess/go/vt/tabletmanager/actionnode"
+	"github.com/youtube/vitess/go/vt/tabletmanager/initiator"
+	tproto "github.com/youtube/vitess/go/vt/tabletserver/proto"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
+	"github.com/youtube/vitess/go/vt/wrangler"
+	"github.com/youtube/vitess/go/vt/wrangler/testlib"
+	"github.com/youtube/vitess/go/vt/zktopo"
+)
+
+// fakeTabletManagerConn is the TabletManagerConn of the wranglers of
+// these tests: it answers the calls of the worker with the schema,
+// results and errors it was given, and records them.
+type fakeTabletManagerConn struct {
+	ts topo.Server
+
+	mu      sync.Mutex
+	schema  *myproto.SchemaDefinition
+	results map[string]*mproto.QueryResult
+	// errors are returned by the methods of that name, or by
+	// ExecuteFetch for that query.
+	errors map[string]error
+	// calls are the methods called on each tablet, and the queries
+	// of ExecuteFetch.
+	calls map[topo.TabletAlias][]string
+}
+
+var fakeConn *fakeTabletManagerConn
+
+func init() {
+	initiator.RegisterTabletManagerConnFactory("fake_materialize", func(ts topo.Server) initiator.TabletManagerConn {
+		return fakeConn
+	})
+}
+
+func (fc *fakeTabletManagerConn) call(tablet *topo.TabletInfo, name string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.calls[tablet.Alias] = append(fc.calls[tablet.Alias], name)
+	return fc.errors[name]
+}
+
+func (fc *fakeTabletManagerConn) callsOf(alias topo.TabletAlias) []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.calls[alias]
+}
+
+func (fc *fakeTabletManagerConn) Ping(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "Ping")
+}
+
+func (fc *fakeTabletManagerConn) GetSchema(tablet *topo.TabletInfo, tables, excludeTables []string, includeViews bool, waitTime time.Duration) (*myproto.SchemaDefinition, error) {
+	if err := fc.call(tablet, "GetSchema"); err != nil {
+		return nil, err
+	}
+	return fc.schema, nil
+}
+
+func (fc *fakeTabletManagerConn) GetPermissions(tablet *topo.TabletInfo, waitTime time.Duration) (*myproto.Permissions, error) {
+	return nil, fc.call(tablet, "GetPermissions")
+}
+
+func (fc *fakeTabletManagerConn) ChangeType(tablet *topo.TabletInfo, dbType topo.TabletType, waitTime time.Duration) error {
+	if err := fc.call(tablet, "ChangeType"); err != nil {
+		return err
+	}
+	return topotools.ChangeType(fc.ts, tablet.Alias, dbType, nil, false)
+}
+
+func (fc *fakeTabletManagerConn) SetBlacklistedTables(tablet *topo.TabletInfo, tables []string, waitTime time.Duration) error {
+	return fc.call(tablet, "SetBlacklistedTables")
+}
+
+func (fc *fakeTabletManagerConn) SetQueryRules(tablet *topo.TabletInfo, rules string, waitTime time.Duration) error {
+	return fc.call(tablet, "SetQueryRules")
+}
+
+func (fc *fakeTabletManagerConn) ReloadSchema(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "ReloadSchema")
+}
+
+func (fc *fakeTabletManagerConn) ExecuteFetch(tablet *topo.TabletInfo, query string, maxRows int, wantFields, disableBinlogs bool, waitTime time.Duration) (*mproto.QueryResult, error) {
+	if err := fc.call(tablet, query); err != nil {
+		return nil, err
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if qr, ok := fc.results[query]; ok {
+		return qr, nil
+	}
+	return &mproto.QueryResult{}, nil
+}
+
+func (fc *fakeTabletManagerConn) SlavePosition(tablet *topo.TabletInfo, waitTime time.Duration) (*myproto.ReplicationPosition, error) {
+	if err := fc.call(tablet, "SlavePosition"); err != nil {
+		return nil, err
+	}
+	return &myproto.ReplicationPosition{MasterLogGTIDField: myproto.GTIDField{Value: myproto.MustParseGTID("MariaDB", "0-1-10")}}, nil
+}
+
+func (fc *fakeTabletManagerConn) WaitSlavePosition(tablet *topo.TabletInfo, replicationPosition *myproto.ReplicationPosition, waitTime time.Duration) (*myproto.ReplicationPosition, error) {
+	return nil, fc.call(tablet, "WaitSlavePosition")
+}
+
+func (fc *fakeTabletManagerConn) MasterPosition(tablet *topo.TabletInfo, waitTime time.Duration) (*myproto.ReplicationPosition, error) {
+	if err := fc.call(tablet, "MasterPosition"); err != nil {
+		return nil, err
+	}
+	return &myproto.ReplicationPosition{MasterLogGTIDField: myproto.GTIDField{Value: myproto.MustParseGTID("MariaDB", "0-1-20")}}, nil
+}
+
+func (fc *fakeTabletManagerConn) StopSlave(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "StopSlave")
+}
+
+func (fc *fakeTabletManagerConn) StopSlaveMinimum(tablet *topo.TabletInfo, gtid myproto.GTID, waitTime time.Duration) (*myproto.ReplicationPosition, error) {
+	return nil, fc.call(tablet, "StopSlaveMinimum")
+}
+
+func (fc *fakeTabletManagerConn) StartSlave(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "StartSlave")
+}
+
+func (fc *fakeTabletManagerConn) GetSlaves(tablet *topo.TabletInfo, waitTime time.Duration) ([]string, error) {
+	return nil, fc.call(tablet, "GetSlaves")
+}
+
+func (fc *fakeTabletManagerConn) WaitBlpPosition(tablet *topo.TabletInfo, blpPosition blproto.BlpPosition, waitTime time.Duration) error {
+	return fc.call(tablet, fmt.Sprintf("WaitBlpPosition(%v)", blpPosition.GTIDField))
+}
+
+func (fc *fakeTabletManagerConn) StopBlp(tablet *topo.TabletInfo, waitTime time.Duration) (*blproto.BlpPositionList, error) {
+	return nil, fc.call(tablet, "StopBlp")
+}
+
+func (fc *fakeTabletManagerConn) StartBlp(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "StartBlp")
+}
+
+func (fc *fakeTabletManagerConn) RunBlpUntil(tablet *topo.TabletInfo, positions *blproto.BlpPositionList, waitTime time.Duration) (*myproto.ReplicationPosition, error) {
+	return nil, fc.call(tablet, "RunBlpUntil")
+}
+
+func (fc *fakeTabletManagerConn) SlaveWasPromoted(tablet *topo.TabletInfo, waitTime time.Duration) error {
+	return fc.call(tablet, "SlaveWasPromoted")
+}
+
+func (fc *fakeTabletManagerConn) SlaveWasRestarted(tablet *topo.TabletInfo, args *actionnode.SlaveWasRestartedArgs, waitTime time.Duration) error {
+	return fc.call(tablet, "SlaveWasRestarted")
+}
+
+// fakeSqlQuery is the query service of the source rdonly: it streams
+// one row per query, the id of the first row of its chunk, and
+// records the queries.
+type fakeSqlQuery struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+var (
+	sqlQuery     = &fakeSqlQuery{}
+	sqlQueryPort int
+	sqlQueryOnce sync.Once
+)
+
+func (sq *fakeSqlQuery) GetSessionId(sessionParams *tproto.SessionParams, sessionInfo *tproto.SessionInfo) error {
+	sessionInfo.SessionId = 1
+	return nil
+}
+
+func (sq *fakeSqlQuery) StreamExecute(ctx *rpcproto.Context, query *tproto.Query, sendReply func(reply interface{}) error) error {
+	sq.mu.Lock()
+	sq.queries = append(sq.queries, query.Sql)
+	sq.mu.Unlock()
+	if err := sendReply(&mproto.QueryResult{Fields: []mproto.Field{
+		{Name: "id", Type: mproto.VT_LONGLONG},
+		{Name: "msg", Type: mproto.VT_VAR_STRING},
+	}}); err != nil {
+		return err
+	}
+	id := "1"
+	if strings.Contains(query.Sql, "id>=") {
+		id = "50"
+	}
+	return sendReply(&mproto.QueryResult{Rows: [][]sqltypes.Value{{
+		sqltypes.MakeString([]byte(id)),
+		sqltypes.MakeString([]byte("msg" + id)),
+	}}})
+}
+
+// Queries returns the queries run since the last call, sorted.
+func (sq *fakeSqlQuery) Queries() []string {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	queries := sq.queries
+	sq.queries = nil
+	sort.Strings(queries)
+	return queries
+}
+
+// startSqlQuery serves sqlQuery over bsonrpc on a local port.
+func startSqlQuery(t *testing.T) {
+	sqlQueryOnce.Do(func() {
+		if err := rpc.RegisterName("SqlQuery", sqlQuery); err != nil {
+			t.Fatalf("RegisterName: %v", err)
+		}
+		bsonrpc.ServeRPC()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		sqlQueryPort = listener.Addr().(*net.TCPAddr).Port
+		go http.Serve(listener, nil)
+	})
+}
+
+const materializeSchema = "CREATE TABLE `t1` (\n" +
+	"  `id` bigint(20) NOT NULL,\n" +
+	"  `msg` varchar(64) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8"
+
+// materializeEnv has a source shard with a master and a rdonly, and a
+// destination shard with a master and a replica.
+type materializeEnv struct {
+	ts                 topo.Server
+	wr                 *wrangler.Wrangler
+	sourceMaster       *testlib.FakeTablet
+	sourceRdonly       *testlib.FakeTablet
+	destinationMaster  *testlib.FakeTablet
+	destinationReplica *testlib.FakeTablet
+}
+
+func newMaterializeEnv(t *testing.T) *materializeEnv {
+	startSqlQuery(t)
+	if err := flag.Set("tablet_manager_protocol", "fake_materialize"); err != nil {
+		t.Fatalf("cannot set tablet_manager_protocol: %v", err)
+	}
+	env := &materializeEnv{}
+	env.ts = zktopo.NewTestServer(t, []string{"cell1"})
+	fakeConn = &fakeTabletManagerConn{
+		ts: env.ts,
+		schema: &myproto.SchemaDefinition{
+			DatabaseSchema: "CREATE DATABASE `{{.DatabaseName}}` /*!40100 DEFAULT CHARACTER SET utf8 */",
+			TableDefinitions: []myproto.TableDefinition{{
+				Name:              "t1",
+				Schema:            materializeSchema,
+				Columns:           []string{"id", "msg"},
+				PrimaryKeyColumns: []string{"id"},
+				Type:              myproto.TABLE_BASE_TABLE,
+				DataLength:        2048,
+				RowCount:          2,
+			}},
+		},
+		results: map[string]*mproto.QueryResult{
+			"SELECT MIN(id), MAX(id) FROM vt_source_keyspace.t1": &mproto.QueryResult{
+				Fields: []mproto.Field{{Name: "min", Type: mproto.VT_LONGLONG}, {Name: "max", Type: mproto.VT_LONGLONG}},
+				Rows:   [][]sqltypes.Value{{sqltypes.MakeString([]byte("0")), sqltypes.MakeString([]byte("100"))}},
+			},
+		},
+		errors: make(map[string]error),
+		calls:  make(map[topo.TabletAlias][]string),
+	}
+	env.wr = wrangler.New(logutil.NewConsoleLogger(), env.ts, time.Minute, time.Second)
+
+	env.sourceMaster = testlib.NewFakeTablet(t, env.wr, "cell1", 0, topo.TYPE_MASTER,
+		testlib.TabletKeyspaceShard(t, "source_keyspace", "0"))
+	env.sourceRdonly = testlib.NewFakeTablet(t, env.wr, "cell1", 1, topo.TYPE_RDONLY,
+		testlib.TabletKeyspaceShard(t, "source_keyspace", "0"),
+		testlib.TabletParent(env.sourceMaster.Tablet.Alias),
+		func(tablet *topo.Tablet) {
+			tablet.IPAddr = "127.0.0.1"
+			tablet.Portmap["vt"] = sqlQueryPort
+		})
+	env.destinationMaster = testlib.NewFakeTablet(t, env.wr, "cell1", 10, topo.TYPE_MASTER,
+		testlib.TabletKeyspaceShard(t, "destination_keyspace", "0"))
+	env.destinationReplica = testlib.NewFakeTablet(t, env.wr, "cell1", 11, topo.TYPE_REPLICA,
+		testlib.TabletKeyspaceShard(t, "destination_keyspace", "0"),
+		testlib.TabletParent(env.destinationMaster.Tablet.Alias))
+	if err := env.wr.RebuildShardGraph("source_keyspace", "0", nil); err != nil {
+		t.Fatalf("RebuildShardGraph failed: %v", err)
+	}
+	return env
+}
+
+func (env *materializeEnv) run() *MaterializeWorker {
+	mw := NewMaterializeWorker(env.wr, "cell1", "source_keyspace", "0", "destination_keyspace", "0", "t1", "", 2, 1024, 2, time.Second).(*MaterializeWorker)
+	mw.Run()
+	return mw
+}
+
+func (env *materializeEnv) tabletType(t *testing.T, ft *testlib.FakeTablet) topo.TabletType {
+	ti, err := env.ts.GetTablet(ft.Tablet.Alias)
+	if err != nil {
+		t.Fatalf("GetTablet failed: %v", err)
+	}
+	return ti.Type
+}
+
+func TestMaterializeCopy(t *testing.T) {
+	env := newMaterializeEnv(t)
+	mw := env.run()
+	if err := mw.Error(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if mw.state != stateMWDone {
+		t.Errorf("state: %v, want %v", mw.state, stateMWDone)
+	}
+
+	// the source rdonly was stopped, and restarted as spare
+	calls := fakeConn.callsOf(env.sourceRdonly.Tablet.Alias)
+	if len(calls) < 2 || calls[len(calls)-2] != "StartSlave" {
+		t.Errorf("source rdonly calls: %v, want StartSlave before the last ChangeType", calls)
+	}
+	if got := env.tabletType(t, env.sourceRdonly); got != topo.TYPE_SPARE {
+		t.Errorf("source rdonly type: %v, want spare", got)
+	}
+
+	// the table was copied in two chunks
+	wantSelects := []string{
+		"SELECT id, msg FROM t1 WHERE id<50 ORDER BY id",
+		"SELECT id, msg FROM t1 WHERE id>=50 ORDER BY id",
+	}
+	if got := sqlQuery.Queries(); !stringsEqual(got, wantSelects) {
+		t.Errorf("source queries:\n%v\nwant:\n%v", got, wantSelects)
+	}
+	for _, ft := range []*testlib.FakeTablet{env.destinationMaster, env.destinationReplica} {
+		calls := fakeConn.callsOf(ft.Tablet.Alias)
+		if len(calls) < 8 {
+			t.Fatalf("calls of %v: %v, want at least 8", ft.Tablet.Alias, calls)
+		}
+		want := []string{
+			"CREATE DATABASE IF NOT EXISTS `vt_destination_keyspace` /*!40100 DEFAULT CHARACTER SET utf8 */",
+			strings.Replace(materializeSchema, "`t1`", "`vt_destination_keyspace`.`t1`", 1),
+		}
+		if !stringsEqual(calls[:2], want) {
+			t.Errorf("create queries of %v:\n%v\nwant:\n%v", ft.Tablet.Alias, calls[:2], want)
+		}
+		inserts := append([]string{}, calls[2:4]...)
+		sort.Strings(inserts)
+		want = []string{
+			"INSERT INTO `vt_destination_keyspace`.t1(id, msg) VALUES (1,'msg1')",
+			"INSERT INTO `vt_destination_keyspace`.t1(id, msg) VALUES (50,'msg50')",
+		}
+		if !stringsEqual(inserts, want) {
+			t.Errorf("inserts of %v:\n%v\nwant:\n%v", ft.Tablet.Alias, inserts, want)
+		}
+		if !strings.HasPrefix(calls[6], "INSERT INTO _vt.blp_checkpoint") || !strings.Contains(calls[6], "0-1-10") {
+			t.Errorf("blp_checkpoint query of %v: %v, want the source position 0-1-10", ft.Tablet.Alias, calls[6])
+		}
+		if calls[7] != "ReloadSchema" {
+			t.Errorf("last call of %v: %v, want ReloadSchema", ft.Tablet.Alias, calls[7])
+		}
+	}
+
+	// filtered replication of the table only, caught up with the
+	// source master
+	si, err := env.ts.GetShard("destination_keyspace", "0")
+	if err != nil {
+		t.Fatalf("GetShard failed: %v", err)
+	}
+	if len(si.SourceShards) != 1 || si.SourceShards[0].Keyspace != "source_keyspace" || !stringsEqual(si.SourceShards[0].Tables, []string{"t1"}) {
+		t.Errorf("SourceShards: %v, want source_keyspace/0 filtered by t1", si.SourceShards)
+	}
+	calls = fakeConn.callsOf(env.destinationMaster.Tablet.Alias)
+	waitCalls := 0
+	for _, call := range calls {
+		if strings.HasPrefix(call, "WaitBlpPosition") {
+			waitCalls++
+			if !strings.Contains(call, "0-1-20") {
+				t.Errorf("WaitBlpPosition on the destination master: %v, want the master position 0-1-20", call)
+			}
+		}
+	}
+	if waitCalls != 1 {
+		t.Errorf("destination master calls: %v, want one WaitBlpPosition", calls)
+	}
+}
+
+func TestMaterializeCreateSql(t *testing.T) {
+	env := newMaterializeEnv(t)
+	createSql := "CREATE TABLE `{{.DatabaseName}}`.`t1` (`id` bigint(20) NOT NULL, `msg` varchar(64), PRIMARY KEY (`id`), KEY `by_msg` (`msg`))"
+	mw := NewMaterializeWorker(env.wr, "cell1", "source_keyspace", "0", "destination_keyspace", "0", "t1", createSql, 1, 1024, 1, time.Second).(*MaterializeWorker)
+	mw.Run()
+	if err := mw.Error(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	want := strings.Replace(createSql, "{{.DatabaseName}}", "vt_destination_keyspace", 1)
+	if calls := fakeConn.callsOf(env.destinationReplica.Tablet.Alias); len(calls) < 2 || calls[1] != want {
+		t.Errorf("destination calls: %v, want %v second", calls, want)
+	}
+	// a single reader doesn't split the table
+	if got := sqlQuery.Queries(); !stringsEqual(got, []string{"SELECT id, msg FROM t1 ORDER BY id"}) {
+		t.Errorf("source queries: %v, want a single select", got)
+	}
+}
+
+func TestMaterializeErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		setup func(t *testing.T, env *materializeEnv)
+		want  string
+	}{
+		{
+			desc: "no source master",
+			setup: func(t *testing.T, env *materializeEnv) {
+				si, err := env.ts.GetShard("source_keyspace", "0")
+				if err != nil {
+					t.Fatalf("GetShard failed: %v", err)
+				}
+				si.MasterAlias = topo.TabletAlias{}
+				if err := env.ts.UpdateShard(si); err != nil {
+					t.Fatalf("UpdateShard failed: %v", err)
+				}
+			},
+			want: "source shard source_keyspace/0 has no master",
+		},
+		{
+			desc: "destination already has sources",
+			setup: func(t *testing.T, env *materializeEnv) {
+				if err := env.wr.SetSourceShards("destination_keyspace", "0", []topo.TabletAlias{env.sourceRdonly.Tablet.Alias}, nil); err != nil {
+					t.Fatalf("SetSourceShards failed: %v", err)
+				}
+			},
+			want: "destination shard destination_keyspace/0 already has SourceShards",
+		},
+		{
+			desc: "no destination master",
+			setup: func(t *testing.T, env *materializeEnv) {
+				if err := env.ts.UpdateTabletFields(env.destinationMaster.Tablet.Alias, func(tablet *topo.Tablet) error {
+					tablet.Type = topo.TYPE_REPLICA
+					return nil
+				}); err != nil {
+					t.Fatalf("UpdateTabletFields failed: %v", err)
+				}
+			},
+			want: "no master in destination shard",
+		},
+		{
+			desc: "stop slave failure",
+			setup: func(t *testing.T, env *materializeEnv) {
+				fakeConn.errors["StopSlave"] = fmt.Errorf("replication is broken")
+			},
+			want: "cannot stop slave cell1-0000000001: replication is broken",
+		},
+		{
+			desc: "missing table",
+			setup: func(t *testing.T, env *materializeEnv) {
+				fakeConn.schema = &myproto.SchemaDefinition{}
+			},
+			want: "no table t1 on source cell1-0000000001",
+		},
+		{
+			desc: "create failure",
+			setup: func(t *testing.T, env *materializeEnv) {
+				fakeConn.errors[strings.Replace(materializeSchema, "`t1`", "`vt_destination_keyspace`.`t1`", 1)] = fmt.Errorf("table exists")
+			},
+			want: "createDbCmds failed: table exists",
+		},
+		{
+			desc: "reload schema failure",
+			setup: func(t *testing.T, env *materializeEnv) {
+				fakeConn.errors["ReloadSchema"] = fmt.Errorf("no tablet server")
+			},
+			want: "ReloadSchema failed on tablet",
+		},
+		{
+			desc: "catch up failure",
+			setup: func(t *testing.T, env *materializeEnv) {
+				fakeConn.errors["WaitBlpPosition(0-1-20)"] = fmt.Errorf("timeout")
+			},
+			want: "filtered replication on cell1-0000000010 didn't reach source master position",
+		},
+	}
+	for _, tc := range testCases {
+		env := newMaterializeEnv(t)
+		tc.setup(t, env)
+		mw := env.run()
+		sqlQuery.Queries()
+		if err := mw.Error(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%v: Run error: %v, want %v", tc.desc, err, tc.want)
+		}
+		if mw.state != stateMWError {
+			t.Errorf("%v: state: %v, want %v", tc.desc, mw.state, stateMWError)
+		}
+		// the cleaner always gives the source rdonly back
+		if got := env.tabletType(t, env.sourceRdonly); got == topo.TYPE_CHECKER {
+			t.Errorf("%v: source rdonly still a checker", tc.desc)
+		}
+	}
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -5,17 +5,12 @@
 package worker
 
 import (
-	"bytes"
 	"fmt"
 	"html/template"
-	"strconv"
 	"strings"
 	"sync"
-	ttemplate "text/template"
 	"time"
 
-	mproto "github.com/youtube/vitess/go/mysql/proto"
-	"github.com/youtube/vitess/go/sqltypes"
 	"github.com/youtube/vitess/go/sync2"
 	"github.com/youtube/vitess/go/vt/binlog/binlogplayer"
 	"github.com/youtube/vitess/go/vt/mysqlctl"
@@ -435,13 +430,13 @@ func (vscw *VerticalSplitCloneWorker) copy() error {
 		go func(ti *topo.TabletInfo, insertChannel chan string) {
 			defer destinationWaitGroup.Done()
 			vscw.wr.Logger().Infof("Creating tables on tablet %v", ti.Alias)
-			if err := vscw.runSqlCommands(ti, createDbCmds, abort); err != nil {
+			if err := runSqlCommands(vscw.wr, ti, createDbCmds, abort); err != nil {
 				processError("createDbCmds failed: %v", err)
 				return
 			}
 			if len(createViewCmds) > 0 {
 				vscw.wr.Logger().Infof("Creating views on tablet %v", ti.Alias)
-				if err := vscw.runSqlCommands(ti, createViewCmds, abort); err != nil {
+				if err := runSqlCommands(vscw.wr, ti, createViewCmds, abort); err != nil {
 					processError("createViewCmds failed: %v", err)
 					return
 				}
@@ -482,7 +477,7 @@ func (vscw *VerticalSplitCloneWorker) copy() error {
 		}
 
 		vscw.tableStatus[tableIndex].setState("before copy")
-		chunks, err := vscw.findChunks(vscw.sourceTablet, td)
+		chunks, err := findChunks(vscw.wr, vscw.sourceTablet, td, vscw.minTableSizeForSplit, vscw.sourceReaderCount)
 		if err != nil {
 			return err
 		}
@@ -568,7 +563,7 @@ func (vscw *VerticalSplitCloneWorker) copy() error {
 			go func(ti *topo.TabletInfo) {
 				defer destinationWaitGroup.Done()
 				vscw.wr.Logger().Infof("Altering tables on tablet %v", ti.Alias)
-				if err := vscw.runSqlCommands(ti, alterTablesCmds, abort); err != nil {
+				if err := runSqlCommands(vscw.wr, ti, alterTablesCmds, abort); err != nil {
 					processError("alterTablesCmds failed on tablet %v: %v", ti.Alias, err)
 				}
 			}(vscw.destinationTablets[tabletAlias])
@@ -599,7 +594,7 @@ func (vscw *VerticalSplitCloneWorker) copy() error {
 			go func(ti *topo.TabletInfo) {
 				defer destinationWaitGroup.Done()
 				vscw.wr.Logger().Infof("Making and populating blp_checkpoint table on tablet %v", ti.Alias)
-				if err := vscw.runSqlCommands(ti, queries, abort); err != nil {
+				if err := runSqlCommands(vscw.wr, ti, queries, abort); err != nil {
 					processError("blp_checkpoint queries failed on tablet %v: %v", ti.Alias, err)
 				}
 			}(vscw.destinationTablets[tabletAlias])
@@ -632,185 +627,3 @@ func (vscw *VerticalSplitCloneWorker) copy() error {
 	destinationWaitGroup.Wait()
 	return firstError
 }
-
-func (vscw *VerticalSplitCloneWorker) runSqlCommands(ti *topo.TabletInfo, commands []string, abort chan struct{}) error {
-	for _, command := range commands {
-		command, err := fillStringTemplate(command, map[string]string{"DatabaseName": ti.DbName()})
-		if err != nil {
-			return fmt.Errorf("fillStringTemplate failed: %v", err)
-		}
-
-		_, err = vscw.wr.ActionInitiator().ExecuteFetch(ti, command, 0, false, true, 30*time.Second)
-		if err != nil {
-			return err
-		}
-
-		// check on abort
-		select {
-		case <-abort:
-			return nil
-		default:
-			break
-		}
-	}
-
-	return nil
-}
-
-// findChunks returns an array of chunks to use for splitting up a table
-// into multiple data chunks. It only works for tables with a primary key
-// (and the primary key first column is an integer type).
-// The array will always look like:
-// "", "value1", "value2", ""
-// A non-split tablet will just return:
-// "", ""
-func (vscw *VerticalSplitCloneWorker) findChunks(ti *topo.TabletInfo, td myproto.TableDefinition) ([]string, error) {
-	result := []string{"", ""}
-
-	// eliminate a few cases we don't split tables for
-	if len(td.PrimaryKeyColumns) == 0 {
-		// no primary key, what can we do?
-		return result, nil
-	}
-	if td.DataLength < vscw.minTableSizeForSplit {
-		// table is too small to split up
-		return result, nil
-	}
-
-	// get the min and max of the leading column of the primary key
-	query := fmt.Sprintf("SELECT MIN(%v), MAX(%v) FROM %v.%v", td.PrimaryKeyColumns[0], td.PrimaryKeyColumns[0], ti.DbName(), td.Name)
-	qr, err := vscw.wr.ActionInitiator().ExecuteFetch(ti, query, 1, true, false, 30*time.Second)
-	if err != nil {
-		vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks: %v", td.Name, err)
-		return result, nil
-	}
-	if len(qr.Rows) != 1 {
-		vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot get min and max", td.Name)
-		return result, nil
-	}
-	if qr.Rows[0][0].IsNull() || qr.Rows[0][1].IsNull() {
-		vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, min or max is NULL: %v %v", td.Name, qr.Rows[0][0], qr.Rows[0][1])
-		return result, nil
-	}
-	switch qr.Fields[0].Type {
-	case mproto.VT_TINY, mproto.VT_SHORT, mproto.VT_LONG, mproto.VT_LONGLONG, mproto.VT_INT24:
-		minNumeric := sqltypes.MakeNumeric(qr.Rows[0][0].Raw())
-		maxNumeric := sqltypes.MakeNumeric(qr.Rows[0][1].Raw())
-		if qr.Rows[0][0].Raw()[0] == '-' {
-			// signed values, use int64
-			min, err := minNumeric.ParseInt64()
-			if err != nil {
-				vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert min: %v %v", td.Name, minNumeric, err)
-				return result, nil
-			}
-			max, err := maxNumeric.ParseInt64()
-			if err != nil {
-				vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert max: %v %v", td.Name, maxNumeric, err)
-				return result, nil
-			}
-			interval := (max - min) / int64(vscw.sourceReaderCount)
-			if interval == 0 {
-				vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, interval=0: %v %v", max, min)
-				return result, nil
-			}
-
-			result = make([]string, vscw.sourceReaderCount+1)
-			result[0] = ""
-			result[vscw.sourceReaderCount] = ""
-			for i := int64(1); i < int64(vscw.sourceReaderCount); i++ {
-				result[i] = fmt.Sprintf("%v", min+interval*i)
-			}
-			return result, nil
-		}
-
-		// unsigned values, use uint64
-		min, err := minNumeric.ParseUint64()
-		if err != nil {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert min: %v %v", td.Name, minNumeric, err)
-			return result, nil
-		}
-		max, err := maxNumeric.ParseUint64()
-		if err != nil {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert max: %v %v", td.Name, maxNumeric, err)
-			return result, nil
-		}
-		interval := (max - min) / uint64(vscw.sourceReaderCount)
-		if interval == 0 {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, interval=0: %v %v", max, min)
-			return result, nil
-		}
-
-		result = make([]string, vscw.sourceReaderCount+1)
-		result[0] = ""
-		result[vscw.sourceReaderCount] = ""
-		for i := uint64(1); i < uint64(vscw.sourceReaderCount); i++ {
-			result[i] = fmt.Sprintf("%v", min+interval*i)
-		}
-		return result, nil
-
-	case mproto.VT_FLOAT, mproto.VT_DOUBLE:
-		min, err := strconv.ParseFloat(qr.Rows[0][0].String(), 64)
-		if err != nil {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert min: %v %v", td.Name, qr.Rows[0][0], err)
-			return result, nil
-		}
-		max, err := strconv.ParseFloat(qr.Rows[0][1].String(), 64)
-		if err != nil {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, cannot convert max: %v %v", td.Name, qr.Rows[0][1].String(), err)
-			return result, nil
-		}
-		interval := (max - min) / float64(vscw.sourceReaderCount)
-		if interval == 0 {
-			vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, interval=0: %v %v", max, min)
-			return result, nil
-		}
-
-		result = make([]string, vscw.sourceReaderCount+1)
-		result[0] = ""
-		result[vscw.sourceReaderCount] = ""
-		for i := 1; i < vscw.sourceReaderCount; i++ {
-			result[i] = fmt.Sprintf("%v", min+interval*float64(i))
-		}
-		return result, nil
-	}
-
-	vscw.wr.Logger().Infof("Not splitting table %v into multiple chunks, primary key not numeric", td.Name)
-	return result, nil
-}
-
-func fillStringTemplate(tmpl string, vars interface{}) (string, error) {
-	myTemplate := ttemplate.Must(ttemplate.New("").Parse(tmpl))
-	data := new(bytes.Buffer)
-	if err := myTemplate.Execute(data, vars); err != nil {
-		return "", err
-	}
-	return data.String(), nil
-}
-
-func makeValueString(fields []mproto.Field, qr *mproto.QueryResult) string {
-	buf := bytes.Buffer{}
-	for i, row := range qr.Rows {
-		if i > 0 {
-			buf.Write([]byte(",("))
-		} else {
-			buf.WriteByte('(')
-		}
-		for j, value := range row {
-			if j > 0 {
-				buf.WriteByte(',')
-			}
-			// convert value back to its original type
-			if !value.IsNull() {
-				switch fields[j].Type {
-				case mproto.VT_TINY, mproto.VT_SHORT, mproto.VT_LONG, mproto.VT_LONGLONG, mproto.VT_INT24:
-					value = sqltypes.MakeNumeric(value.Raw())
-				case mproto.VT_FLOAT, mproto.VT_DOUBLE:
-					value = sqltypes.MakeFractional(value.Raw())
-				}
-			}
-			value.EncodeSql(&buf)
-		}
-		buf.WriteByte(')')
-	}
-	return buf.String()
-}
@@ -11,6 +11,7 @@ import (
 
 	log "github.com/golang/glog"
 	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/vt/topotools"
 )
 
 // As with all distributed systems, things can skew. These functions
@@ -315,3 +316,16 @@ func (wr *Wrangler) ValidateShard(keyspace, shard string, pingTablets bool) erro
 	}()
 	return wr.waitForResults(wg, results)
 }
+
+// CheckTopology checks the consistency of the topology records of the
+// keyspaces (all of them if keyspaces is empty), without talking to
+// the tablets, see topotools.CheckTopology. If fix is set, the
+// problems that can be fixed safely are fixed, and only the other
+// ones are returned.
+func (wr *Wrangler) CheckTopology(keyspaces []string, fix bool) ([]*topotools.Problem, error) {
+	problems, err := topotools.CheckTopology(wr.logger, wr.ts, keyspaces, wr.lockTimeout, interrupted)
+	if err != nil || !fix {
+		return problems, err
+	}
+	return topotools.FixProblems(wr.logger, problems), nil
+}
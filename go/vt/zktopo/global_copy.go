@@ -0,0 +1,77 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/youtube/vitess/go/jscfg"
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the global records copies management code of
+zktopo.Server
+
+The copy of a keyspace is at /zk/<cell>/vt/globalcopy/<keyspace>.
+*/
+
+func zkPathForGlobalCopies(cell string) string {
+	return fmt.Sprintf("/zk/%v/vt/globalcopy", cell)
+}
+
+func (zkts *Server) UpdateGlobalCopy(cell, keyspace string, gc *topo.GlobalCopy) error {
+	path := path.Join(zkPathForGlobalCopies(cell), keyspace)
+	data := jscfg.ToJson(gc)
+	_, err := zkts.zconn.Set(path, data, -1)
+	if zookeeper.IsError(err, zookeeper.ZNONODE) {
+		_, err = zk.CreateRecursive(zkts.zconn, path, data, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	return err
+}
+
+func (zkts *Server) GetGlobalCopy(cell, keyspace string) (*topo.GlobalCopy, error) {
+	path := path.Join(zkPathForGlobalCopies(cell), keyspace)
+	data, _, err := zkts.zconn.Get(path)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return nil, err
+	}
+	gc := &topo.GlobalCopy{}
+	if err := json.Unmarshal([]byte(data), gc); err != nil {
+		return nil, fmt.Errorf("GlobalCopy unmarshal failed: %v %v", data, err)
+	}
+	return gc, nil
+}
+
+func (zkts *Server) GetGlobalCopyKeyspaces(cell string) ([]string, error) {
+	children, _, err := zkts.zconn.Children(zkPathForGlobalCopies(cell))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+func (zkts *Server) DeleteGlobalCopy(cell, keyspace string) error {
+	path := path.Join(zkPathForGlobalCopies(cell), keyspace)
+	if err := zkts.zconn.Delete(path, -1); err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return err
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ package zktopo
 import (
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -127,3 +128,37 @@ func (zkts *Server) LockSrvShardForAction(cell, keyspace, shard, contents string
 func (zkts *Server) UnlockSrvShardForAction(cell, keyspace, shard, lockPath, results string) error {
 	return zkts.unlockForAction(lockPath, results)
 }
+
+// getActionLock returns the first action node of actionDir, which is
+// the one holding the lock, the others are waiting for it.
+func (zkts *Server) getActionLock(actionDir string) (string, string, error) {
+	children, _, err := zkts.zconn.Children(actionDir)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return "", "", err
+	}
+	if len(children) == 0 {
+		return "", "", topo.ErrNoNode
+	}
+	sort.Strings(children)
+	lockPath := path.Join(actionDir, children[0])
+	data, _, err := zkts.zconn.Get(lockPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			// it just ended
+			err = topo.ErrNoNode
+		}
+		return "", "", err
+	}
+	return lockPath, data, nil
+}
+
+func (zkts *Server) GetKeyspaceActionLock(keyspace string) (string, string, error) {
+	return zkts.getActionLock(path.Join(globalKeyspacesPath, keyspace, "action"))
+}
+
+func (zkts *Server) GetShardActionLock(keyspace, shard string) (string, string, error) {
+	return zkts.getActionLock(path.Join(globalKeyspacesPath, keyspace, "shards", shard, "action"))
+}
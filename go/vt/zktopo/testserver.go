@@ -11,7 +11,7 @@ import (
 )
 
 type TestServer struct {
-	topo.Server
+	*Server
 	localCells []string
 }
 
@@ -0,0 +1,43 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zktopo
+
+import (
+	"path"
+
+	"github.com/youtube/vitess/go/vt/topo"
+	"github.com/youtube/vitess/go/zk"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the VSchema management code of zktopo.Server
+
+The VSchema of a keyspace is at /zk/global/vt/keyspaces/<keyspace>/vschema.
+*/
+
+func zkPathForVSchema(keyspace string) string {
+	return path.Join(globalKeyspacesPath, keyspace, "vschema")
+}
+
+func (zkts *Server) SaveVSchema(keyspace, vschema string) error {
+	vschemaPath := zkPathForVSchema(keyspace)
+	_, err := zkts.zconn.Set(vschemaPath, vschema, -1)
+	if zookeeper.IsError(err, zookeeper.ZNONODE) {
+		_, err = zk.CreateRecursive(zkts.zconn, vschemaPath, vschema, 0, zookeeper.WorldACL(zookeeper.PERM_ALL))
+	}
+	return err
+}
+
+func (zkts *Server) GetVSchema(keyspace string) (string, error) {
+	data, _, err := zkts.zconn.Get(zkPathForVSchema(keyspace))
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			err = topo.ErrNoNode
+		}
+		return "", err
+	}
+	return data, nil
+}
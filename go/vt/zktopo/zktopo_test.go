@@ -62,6 +62,12 @@ func TestSrvShardLock(t *testing.T) {
 	test.CheckSrvShardLock(t, ts)
 }
 
+func TestActionLockReader(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckActionLockReader(t, ts)
+}
+
 func TestPid(t *testing.T) {
 	ts := NewTestServer(t, []string{"test"})
 	defer ts.Close()
@@ -73,3 +79,15 @@ func TestActions(t *testing.T) {
 	defer ts.Close()
 	test.CheckActions(t, ts)
 }
+
+func TestGlobalCopy(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckGlobalCopy(t, ts)
+}
+
+func TestVSchema(t *testing.T) {
+	ts := NewTestServer(t, []string{"test"})
+	defer ts.Close()
+	test.CheckVSchema(t, ts)
+}
@@ -42,12 +42,20 @@ type cachedConn struct {
 	mutex  sync.Mutex // used to notify if multiple goroutine simultaneously want a connection
 	zconn  Conn
 	states *stats.States
+
+	// the ephemeral nodes to re-create if the session is lost,
+	// see session.go
+	ephemeralsMutex sync.Mutex
+	ephemerals      map[string]ephemeralNode
 }
 
 type ConnCache struct {
 	mutex        sync.Mutex
 	zconnCellMap map[string]*cachedConn // map cell name to connection
 	useZkocc     bool
+
+	callbacksMutex sync.Mutex
+	callbacks      []RecoveryCallback
 }
 
 func (cc *ConnCache) setState(zcell string, conn *cachedConn, state int64) {
@@ -117,6 +125,7 @@ func (cc *ConnCache) newZookeeperConn(zkAddr, zcell string) (Conn, error) {
 func (cc *ConnCache) handleSessionEvents(cell string, conn Conn, session <-chan zookeeper.Event) {
 	closeRequired := false
 	for event := range session {
+		sessionEvents.Add([]string{cell, sessionStateName(event.State)}, 1)
 		switch event.State {
 		case zookeeper.STATE_EXPIRED_SESSION, zookeeper.STATE_CONNECTING:
 			closeRequired = true
@@ -143,6 +152,9 @@ func (cc *ConnCache) handleSessionEvents(cell string, conn Conn, session <-chan
 			}
 
 			log.Infof("zk conn cache: session for cell %v ended: %v", cell, event)
+			if closeRequired && cached != nil {
+				go cc.recoverSession(cell, cached)
+			}
 			return
 		default:
 			log.Infof("zk conn cache: session for cell %v event: %v", cell, event)
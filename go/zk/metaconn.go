@@ -127,7 +127,11 @@ func (conn *MetaConn) GetW(path string) (data string, stat Stat, watch <-chan zo
 	if err != nil {
 		return
 	}
-	return zconn.GetW(resolveZkPath(path))
+	data, stat, watch, err = zconn.GetW(resolveZkPath(path))
+	if err == nil {
+		watch = conn.connCache.recoverableWatch(watchGet, path, stat, watch)
+	}
+	return
 }
 
 func (conn *MetaConn) Children(path string) (children []string, stat Stat, err error) {
@@ -155,7 +159,11 @@ func (conn *MetaConn) ChildrenW(path string) (children []string, stat Stat, watc
 	if err != nil {
 		return
 	}
-	return zconn.ChildrenW(resolveZkPath(path))
+	children, stat, watch, err = zconn.ChildrenW(resolveZkPath(path))
+	if err == nil {
+		watch = conn.connCache.recoverableWatch(watchChildren, path, stat, watch)
+	}
+	return
 }
 
 func (conn *MetaConn) Exists(path string) (stat Stat, err error) {
@@ -178,7 +186,11 @@ func (conn *MetaConn) ExistsW(path string) (stat Stat, watch <-chan zookeeper.Ev
 	if err != nil {
 		return
 	}
-	return zconn.ExistsW(resolveZkPath(path))
+	stat, watch, err = zconn.ExistsW(resolveZkPath(path))
+	if err == nil {
+		watch = conn.connCache.recoverableWatch(watchExists, path, stat, watch)
+	}
+	return
 }
 
 func (conn *MetaConn) Create(path, value string, flags int, aclv []zookeeper.ACL) (pathCreated string, err error) {
@@ -189,6 +201,9 @@ func (conn *MetaConn) Create(path, value string, flags int, aclv []zookeeper.ACL
 			return
 		}
 		pathCreated, err = zconn.Create(resolveZkPath(path), value, flags, aclv)
+		if err == nil {
+			conn.connCache.addEphemeral(path, value, flags, aclv)
+		}
 		if !shouldRetry(err) {
 			return
 		}
@@ -204,6 +219,9 @@ func (conn *MetaConn) Set(path, value string, version int) (stat Stat, err error
 			return
 		}
 		stat, err = zconn.Set(resolveZkPath(path), value, version)
+		if err == nil {
+			conn.connCache.updateEphemeral(path, value)
+		}
 		if !shouldRetry(err) {
 			return
 		}
@@ -219,6 +237,9 @@ func (conn *MetaConn) Delete(path string, version int) (err error) {
 			return
 		}
 		err = zconn.Delete(resolveZkPath(path), version)
+		if err == nil {
+			conn.connCache.removeEphemeral(path)
+		}
 		if !shouldRetry(err) {
 			return
 		}
@@ -269,6 +290,13 @@ func (conn *MetaConn) SetACL(path string, aclv []zookeeper.ACL, version int) (er
 	return
 }
 
+// AddRecoveryCallback registers a function to call each time the
+// session of a cell is lost and recovered. The ephemeral nodes
+// created through this MetaConn have been re-created by then.
+func (conn *MetaConn) AddRecoveryCallback(cb RecoveryCallback) {
+	conn.connCache.AddRecoveryCallback(cb)
+}
+
 // Implements expvar.Var()
 func (conn *MetaConn) String() string {
 	return conn.connCache.String()
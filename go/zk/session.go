@@ -0,0 +1,328 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"launchpad.net/gozk/zookeeper"
+)
+
+/*
+This file contains the session recovery code of ConnCache.
+
+When the session of a cell is lost (it expired, or the connection to
+the server was lost and the ConnCache closed it), the ConnCache:
+- re-dials the cell,
+- re-creates the ephemeral nodes that were created through it,
+- invokes the registered recovery callbacks.
+The watches set through a MetaConn are re-registered on the new
+session, see recoverableWatch.
+
+Sequence ephemeral nodes (used for locks and elections) are not
+re-created: their sequence number would change, so their owners have
+to notice the loss and start over.
+*/
+
+var (
+	sessionEvents       = stats.NewMultiCounters("ZkSessionEvents", []string{"Cell", "State"})
+	sessionRecoveries   = stats.NewMultiCounters("ZkSessionRecoveries", []string{"Cell", "Result"})
+	recoveredEphemerals = stats.NewCounters("ZkRecoveredEphemerals")
+	recoveredWatches    = stats.NewCounters("ZkRecoveredWatches")
+)
+
+// sessionStateName returns a name for a session event state, used
+// as a stats key.
+func sessionStateName(state int) string {
+	switch state {
+	case zookeeper.STATE_EXPIRED_SESSION:
+		return "Expired"
+	case zookeeper.STATE_AUTH_FAILED:
+		return "AuthFailed"
+	case zookeeper.STATE_CONNECTING:
+		return "Connecting"
+	case zookeeper.STATE_ASSOCIATING:
+		return "Associating"
+	case zookeeper.STATE_CONNECTED:
+		return "Connected"
+	case zookeeper.STATE_CLOSED:
+		return "Closed"
+	}
+	return "Unknown"
+}
+
+// RecoveryCallback is called after the session of a cell was lost and
+// a new one was established, once the ephemeral nodes were re-created.
+type RecoveryCallback func(cell string)
+
+// ephemeralNode is what is needed to re-create an ephemeral node.
+type ephemeralNode struct {
+	value string
+	flags int
+	aclv  []zookeeper.ACL
+}
+
+// AddRecoveryCallback registers a function to call each time a
+// session is recovered.
+func (cc *ConnCache) AddRecoveryCallback(cb RecoveryCallback) {
+	cc.callbacksMutex.Lock()
+	defer cc.callbacksMutex.Unlock()
+	cc.callbacks = append(cc.callbacks, cb)
+}
+
+func (cc *ConnCache) recoveryCallbacks() []RecoveryCallback {
+	cc.callbacksMutex.Lock()
+	defer cc.callbacksMutex.Unlock()
+	return cc.callbacks
+}
+
+// cachedConnForPath returns the cachedConn for the cell of zkPath,
+// or nil if the cache is closed or has never seen that cell.
+func (cc *ConnCache) cachedConnForPath(zkPath string) *cachedConn {
+	zcell, err := ZkCellFromZkPath(zkPath)
+	if err != nil {
+		return nil
+	}
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if cc.zconnCellMap == nil {
+		return nil
+	}
+	return cc.zconnCellMap[zcell]
+}
+
+// closed returns true if Close was called on the cache.
+func (cc *ConnCache) closed() bool {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	return cc.zconnCellMap == nil
+}
+
+// addEphemeral remembers an ephemeral node created on zkPath, so it
+// can be re-created if the session is lost.
+func (cc *ConnCache) addEphemeral(zkPath, value string, flags int, aclv []zookeeper.ACL) {
+	if flags&zookeeper.EPHEMERAL == 0 || flags&zookeeper.SEQUENCE != 0 {
+		return
+	}
+	cached := cc.cachedConnForPath(zkPath)
+	if cached == nil {
+		return
+	}
+	cached.ephemeralsMutex.Lock()
+	defer cached.ephemeralsMutex.Unlock()
+	if cached.ephemerals == nil {
+		cached.ephemerals = make(map[string]ephemeralNode)
+	}
+	cached.ephemerals[zkPath] = ephemeralNode{value, flags, aclv}
+}
+
+// updateEphemeral keeps the value of a remembered ephemeral node up
+// to date.
+func (cc *ConnCache) updateEphemeral(zkPath, value string) {
+	cached := cc.cachedConnForPath(zkPath)
+	if cached == nil {
+		return
+	}
+	cached.ephemeralsMutex.Lock()
+	defer cached.ephemeralsMutex.Unlock()
+	if node, ok := cached.ephemerals[zkPath]; ok {
+		node.value = value
+		cached.ephemerals[zkPath] = node
+	}
+}
+
+// removeEphemeral forgets an ephemeral node that was deleted.
+func (cc *ConnCache) removeEphemeral(zkPath string) {
+	cached := cc.cachedConnForPath(zkPath)
+	if cached == nil {
+		return
+	}
+	cached.ephemeralsMutex.Lock()
+	defer cached.ephemeralsMutex.Unlock()
+	delete(cached.ephemerals, zkPath)
+}
+
+func (cached *cachedConn) ephemeralNodes() map[string]ephemeralNode {
+	cached.ephemeralsMutex.Lock()
+	defer cached.ephemeralsMutex.Unlock()
+	result := make(map[string]ephemeralNode, len(cached.ephemerals))
+	for zkPath, node := range cached.ephemerals {
+		result[zkPath] = node
+	}
+	return result
+}
+
+// recoverSession re-dials a cell whose session was lost, re-creates
+// its ephemeral nodes and invokes the recovery callbacks. It keeps
+// trying until it succeeds or the cache is closed.
+func (cc *ConnCache) recoverSession(cell string, cached *cachedConn) {
+	ephemerals := cached.ephemeralNodes()
+	callbacks := cc.recoveryCallbacks()
+	if len(ephemerals) == 0 && len(callbacks) == 0 {
+		// nothing to do, the next call will re-dial
+		return
+	}
+
+	cellPath := "/" + MagicPrefix + "/" + cell
+	for {
+		if cc.closed() {
+			return
+		}
+		zconn, err := cc.ConnForPath(cellPath)
+		if err != nil {
+			sessionRecoveries.Add([]string{cell, "Failure"}, 1)
+			log.Warningf("zk conn cache: cannot recover session for cell %v: %v", cell, err)
+			time.Sleep(1*time.Second + time.Duration(rand.Int63n(5e9)))
+			continue
+		}
+
+		for zkPath, node := range ephemerals {
+			if err := recreateEphemeral(zconn, resolveZkPath(zkPath), node); err != nil {
+				log.Warningf("zk conn cache: cannot re-create ephemeral node %v: %v", zkPath, err)
+				continue
+			}
+			recoveredEphemerals.Add(cell, 1)
+			log.Infof("zk conn cache: re-created ephemeral node %v", zkPath)
+		}
+		break
+	}
+
+	sessionRecoveries.Add([]string{cell, "Success"}, 1)
+	log.Infof("zk conn cache: recovered session for cell %v", cell)
+	for _, cb := range callbacks {
+		cb(cell)
+	}
+}
+
+// sessionConn is implemented by the connections that know the id of
+// their session, like ZkConn.
+type sessionConn interface {
+	SessionId() int64
+}
+
+// recreateEphemeral creates an ephemeral node again. If the node
+// exists, it is only replaced if it's owned by the current session of
+// zconn: a node of another session may be the one of another process,
+// which must not be deleted.
+func recreateEphemeral(zconn Conn, zkPath string, node ephemeralNode) error {
+	_, err := zconn.Create(zkPath, node.value, node.flags, node.aclv)
+	if err == nil || !zookeeper.IsError(err, zookeeper.ZNODEEXISTS) {
+		return err
+	}
+	stat, err := zconn.Exists(zkPath)
+	if err != nil {
+		return err
+	}
+	if stat != nil {
+		sc, ok := zconn.(sessionConn)
+		if !ok || sc.SessionId() == 0 || stat.EphemeralOwner() != sc.SessionId() {
+			return fmt.Errorf("node exists and is owned by session %#x, not the current session", stat.EphemeralOwner())
+		}
+		if err = zconn.Delete(zkPath, stat.Version()); err != nil {
+			return err
+		}
+	}
+	_, err = zconn.Create(zkPath, node.value, node.flags, node.aclv)
+	return err
+}
+
+// watchKind is the call that set a watch.
+type watchKind int
+
+const (
+	watchGet watchKind = iota
+	watchChildren
+	watchExists
+)
+
+// setWatch sets a watch of the given kind on zconn.
+func setWatch(zconn Conn, kind watchKind, zkPath string) (stat Stat, watch <-chan zookeeper.Event, err error) {
+	switch kind {
+	case watchGet:
+		_, stat, watch, err = zconn.GetW(zkPath)
+	case watchChildren:
+		_, stat, watch, err = zconn.ChildrenW(zkPath)
+	default:
+		stat, watch, err = zconn.ExistsW(zkPath)
+	}
+	return
+}
+
+// missedEvent compares the stat of a node when a watch was set and
+// after it was re-registered on a new session, and returns the event
+// the watch would have fired while the session was down, if any.
+func missedEvent(kind watchKind, zkPath string, oldStat, newStat Stat) (zookeeper.Event, bool) {
+	event := zookeeper.Event{Path: zkPath, State: zookeeper.STATE_CONNECTED}
+	switch {
+	case oldStat == nil && newStat == nil:
+		return event, false
+	case oldStat == nil:
+		event.Type = zookeeper.EVENT_CREATED
+	case newStat == nil:
+		event.Type = zookeeper.EVENT_DELETED
+	case kind == watchChildren && oldStat.Pzxid() != newStat.Pzxid():
+		event.Type = zookeeper.EVENT_CHILD
+	case kind != watchChildren && oldStat.Mzxid() != newStat.Mzxid():
+		event.Type = zookeeper.EVENT_CHANGED
+	default:
+		return event, false
+	}
+	return event, true
+}
+
+// recoverableWatch returns a watch channel that forwards the events
+// of watch, unless it fires because the session was lost. Then it
+// sets the watch again on the new session, and fires if the node
+// changed in the meantime. If the session cannot be recovered, the
+// session event is forwarded.
+func (cc *ConnCache) recoverableWatch(kind watchKind, zkPath string, stat Stat, watch <-chan zookeeper.Event) <-chan zookeeper.Event {
+	result := make(chan zookeeper.Event, 1)
+	go func() {
+		defer close(result)
+		for {
+			event, ok := <-watch
+			if !ok {
+				return
+			}
+			if event.Type != zookeeper.EVENT_SESSION || cc.closed() {
+				result <- event
+				return
+			}
+
+			zcell, _ := ZkCellFromZkPath(zkPath)
+			zconn, err := cc.ConnForPath(zkPath)
+			if err != nil {
+				result <- event
+				return
+			}
+			newStat, newWatch, err := setWatch(zconn, kind, resolveZkPath(zkPath))
+			if err != nil && zookeeper.IsError(err, zookeeper.ZNONODE) {
+				newStat, err = nil, nil
+			}
+			if err != nil {
+				log.Warningf("zk conn cache: cannot re-register watch on %v: %v", zkPath, err)
+				result <- event
+				return
+			}
+			recoveredWatches.Add(zcell, 1)
+			if missed, ok := missedEvent(kind, resolveZkPath(zkPath), stat, newStat); ok {
+				result <- missed
+				return
+			}
+			if newWatch == nil {
+				// the node doesn't exist anymore and GetW or
+				// ChildrenW can't watch it.
+				result <- zookeeper.Event{Type: zookeeper.EVENT_DELETED, Path: resolveZkPath(zkPath), State: zookeeper.STATE_CONNECTED}
+				return
+			}
+			watch = newWatch
+		}
+	}()
+	return result
+}
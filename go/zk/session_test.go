@@ -0,0 +1,141 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zk
+
+import (
+	"testing"
+	"time"
+
+	"launchpad.net/gozk/zookeeper"
+)
+
+// test implementation of Stat, only the zxids,
+// the version and the owner matter
+type testStat struct {
+	mzxid   int64
+	pzxid   int64
+	version int
+	owner   int64
+}
+
+func (s *testStat) Czxid() int64          { return 0 }
+func (s *testStat) Mzxid() int64          { return s.mzxid }
+func (s *testStat) CTime() time.Time      { return time.Time{} }
+func (s *testStat) MTime() time.Time      { return time.Time{} }
+func (s *testStat) Version() int          { return s.version }
+func (s *testStat) CVersion() int         { return 0 }
+func (s *testStat) AVersion() int         { return 0 }
+func (s *testStat) EphemeralOwner() int64 { return s.owner }
+func (s *testStat) DataLength() int       { return 0 }
+func (s *testStat) NumChildren() int      { return 0 }
+func (s *testStat) Pzxid() int64          { return s.pzxid }
+
+func TestMissedEvent(t *testing.T) {
+	table := []struct {
+		kind      watchKind
+		oldStat   Stat
+		newStat   Stat
+		fired     bool
+		eventType int
+	}{
+		{watchGet, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 1, pzxid: 1}, false, 0},
+		{watchGet, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 1, pzxid: 2}, false, 0},
+		{watchGet, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 2, pzxid: 1}, true, zookeeper.EVENT_CHANGED},
+		{watchGet, &testStat{mzxid: 1, pzxid: 1}, nil, true, zookeeper.EVENT_DELETED},
+		{watchChildren, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 2, pzxid: 1}, false, 0},
+		{watchChildren, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 1, pzxid: 2}, true, zookeeper.EVENT_CHILD},
+		{watchExists, nil, nil, false, 0},
+		{watchExists, nil, &testStat{mzxid: 1, pzxid: 1}, true, zookeeper.EVENT_CREATED},
+		{watchExists, &testStat{mzxid: 1, pzxid: 1}, &testStat{mzxid: 2, pzxid: 1}, true, zookeeper.EVENT_CHANGED},
+	}
+	for i, tc := range table {
+		event, fired := missedEvent(tc.kind, "/zk/test/node", tc.oldStat, tc.newStat)
+		if fired != tc.fired {
+			t.Errorf("case %v: fired %v, want %v", i, fired, tc.fired)
+			continue
+		}
+		if fired && (event.Type != tc.eventType || event.Path != "/zk/test/node" || !event.Ok()) {
+			t.Errorf("case %v: bad event %v", i, event)
+		}
+	}
+}
+
+func TestTrackedEphemerals(t *testing.T) {
+	cc := NewConnCache(false)
+	cc.zconnCellMap["test"] = &cachedConn{}
+	acl := zookeeper.WorldACL(zookeeper.PERM_ALL)
+
+	cc.addEphemeral("/zk/test/pid", "1", zookeeper.EPHEMERAL, acl)
+	cc.addEphemeral("/zk/test/lock-", "", zookeeper.EPHEMERAL|zookeeper.SEQUENCE, acl)
+	cc.addEphemeral("/zk/test/node", "", 0, acl)
+	cc.addEphemeral("/zk/other/pid", "1", zookeeper.EPHEMERAL, acl)
+	cc.updateEphemeral("/zk/test/pid", "2")
+	ephemerals := cc.zconnCellMap["test"].ephemeralNodes()
+	if len(ephemerals) != 1 || ephemerals["/zk/test/pid"].value != "2" {
+		t.Errorf("unexpected ephemerals: %v", ephemerals)
+	}
+
+	cc.removeEphemeral("/zk/test/pid")
+	if ephemerals := cc.zconnCellMap["test"].ephemeralNodes(); len(ephemerals) != 0 {
+		t.Errorf("unexpected ephemerals after delete: %v", ephemerals)
+	}
+}
+
+// ephemeralConn is a Conn in session 1 with a single node, for
+// recreateEphemeral. The other methods of Conn are not implemented.
+type ephemeralConn struct {
+	Conn
+	stat    *testStat
+	deleted bool
+	created bool
+}
+
+func (conn *ephemeralConn) SessionId() int64 { return 1 }
+
+func (conn *ephemeralConn) Create(path, value string, flags int, aclv []zookeeper.ACL) (string, error) {
+	if conn.stat != nil {
+		return "", &zookeeper.Error{Op: "create", Code: zookeeper.ZNODEEXISTS, Path: path}
+	}
+	conn.stat = &testStat{owner: 1}
+	conn.created = true
+	return path, nil
+}
+
+func (conn *ephemeralConn) Exists(path string) (Stat, error) {
+	if conn.stat == nil {
+		return nil, nil
+	}
+	return conn.stat, nil
+}
+
+func (conn *ephemeralConn) Delete(path string, version int) error {
+	if conn.stat == nil || version != conn.stat.version {
+		return &zookeeper.Error{Op: "delete", Code: zookeeper.ZBADVERSION, Path: path}
+	}
+	conn.stat = nil
+	conn.deleted = true
+	return nil
+}
+
+func TestRecreateEphemeral(t *testing.T) {
+	node := ephemeralNode{"1", zookeeper.EPHEMERAL, zookeeper.WorldACL(zookeeper.PERM_ALL)}
+
+	conn := &ephemeralConn{}
+	if err := recreateEphemeral(conn, "/zk/test/pid", node); err != nil || !conn.created || conn.deleted {
+		t.Errorf("missing node: err %v, created %v, deleted %v", err, conn.created, conn.deleted)
+	}
+
+	// a node of the current session is replaced
+	conn = &ephemeralConn{stat: &testStat{version: 3, owner: 1}}
+	if err := recreateEphemeral(conn, "/zk/test/pid", node); err != nil || !conn.created || !conn.deleted {
+		t.Errorf("node of the session: err %v, created %v, deleted %v", err, conn.created, conn.deleted)
+	}
+
+	// a node of another session is left alone
+	conn = &ephemeralConn{stat: &testStat{version: 3, owner: 2}}
+	if err := recreateEphemeral(conn, "/zk/test/pid", node); err == nil || conn.created || conn.deleted {
+		t.Errorf("node of another session: err %v, created %v, deleted %v", err, conn.created, conn.deleted)
+	}
+}
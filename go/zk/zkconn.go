@@ -305,6 +305,16 @@ func (conn *ZkConn) Delete(path string, version int) (err error) {
 	return c.Delete(path, version)
 }
 
+// SessionId returns the id of the current session, or 0 if the
+// connection is closed.
+func (conn *ZkConn) SessionId() int64 {
+	c := conn.getConn()
+	if c == nil {
+		return 0
+	}
+	return c.ClientId().SessionId()
+}
+
 // Close will close the connection asynchronously.  It will never
 // fail, even though closing the connection might fail in the
 // background.  Accessing this ZkConn after Close has been called will
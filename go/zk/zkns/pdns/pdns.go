@@ -16,6 +16,7 @@ import (
 	"io"
 	"math/rand"
 	"path"
+	"strconv"
 	"strings"
 
 	log "github.com/golang/glog"
@@ -94,6 +95,14 @@ func (rz *zknsResolver) getResult(qtype, qname string) ([]*pdnsReply, error) {
 	return nil, nil
 }
 
+// ttl returns the TTL of the records made from addrs.
+func ttl(addrs *zkns.ZknsAddrs) string {
+	if addrs.TTL > 0 {
+		return strconv.Itoa(addrs.TTL)
+	}
+	return defaultTTL
+}
+
 // Reverse a slice in place. Return the same slice for convenience.
 func reverse(p []string) []string {
 	i := 0
@@ -137,7 +146,7 @@ func (rz *zknsResolver) getSRV(qname string) ([]*pdnsReply, error) {
 	replies := make([]*pdnsReply, 0, 16)
 	for _, addr := range addrs.Entries {
 		content := fmt.Sprintf("%v\t%v %v %v", defaultPriority, defaultWeight, addr.NamedPortMap[portName], addr.Host)
-		replies = append(replies, &pdnsReply{qname, "IN", "SRV", defaultTTL, defaultId, content})
+		replies = append(replies, &pdnsReply{qname, "IN", "SRV", ttl(addrs), defaultId, content})
 	}
 	return replies, nil
 }
@@ -169,7 +178,7 @@ func (rz *zknsResolver) getCNAME(qname string) ([]*pdnsReply, error) {
 		return nil, nil
 	}
 
-	return []*pdnsReply{&pdnsReply{qname, "IN", "CNAME", defaultTTL, defaultId, addrs.Entries[0].Host}}, nil
+	return []*pdnsReply{&pdnsReply{qname, "IN", "CNAME", ttl(addrs), defaultId, addrs.Entries[0].Host}}, nil
 }
 
 // An A record is generated when there is only one ZknsAddr, it
@@ -201,7 +210,7 @@ func (rz *zknsResolver) getA(qname string) ([]*pdnsReply, error) {
 
 	replies := make([]*pdnsReply, len(addrs.Entries))
 	for i, entry := range addrs.Entries {
-		replies[i] = &pdnsReply{qname, "IN", "A", defaultTTL, defaultId, entry.IPv4}
+		replies[i] = &pdnsReply{qname, "IN", "A", ttl(addrs), defaultId, entry.IPv4}
 	}
 	// Shuffle replies since that seems like the only reasonable strategy in a
 	// stateless distributed environment.
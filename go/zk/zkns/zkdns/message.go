@@ -0,0 +1,220 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zkdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// This file contains the small subset of the DNS wire format (RFC 1035
+// and RFC 2782 for SRV) the server needs: parsing a query with a
+// single question, and building a response with A or SRV answers.
+
+const (
+	typeA   = 1
+	typeSRV = 33
+	typeANY = 255
+
+	classIN  = 1
+	classANY = 255
+
+	rcodeSuccess        = 0
+	rcodeFormatError    = 1
+	rcodeServerFailure  = 2
+	rcodeNameError      = 3
+	rcodeNotImplemented = 4
+	rcodeRefused        = 5
+
+	headerLen = 12
+
+	// maxUDPSize is the largest response sent over UDP. Larger
+	// responses are truncated, and the client retries over TCP.
+	maxUDPSize = 512
+)
+
+var errBadMessage = errors.New("malformed dns message")
+
+// header is the fixed header of a DNS message.
+type header struct {
+	id      uint16
+	flags   uint16
+	qdCount uint16
+	anCount uint16
+	nsCount uint16
+	arCount uint16
+}
+
+// opcode returns the kind of query, 0 is a standard query.
+func (h *header) opcode() int {
+	return int(h.flags>>11) & 0xf
+}
+
+// question is the question section of a query.
+type question struct {
+	name   string // lower case, without the trailing dot
+	qtype  uint16
+	qclass uint16
+}
+
+// rr is an answer resource record. Its name is always the question
+// name.
+type rr struct {
+	rtype uint16
+	ttl   uint32
+	rdata []byte
+}
+
+func (r *rr) String() string {
+	switch r.rtype {
+	case typeA:
+		return fmt.Sprintf("A %v %v", r.ttl, net.IP(r.rdata))
+	case typeSRV:
+		target, _, _ := readName(r.rdata, 6)
+		return fmt.Sprintf("SRV %v %v %v %v %v", r.ttl, binary.BigEndian.Uint16(r.rdata), binary.BigEndian.Uint16(r.rdata[2:]), binary.BigEndian.Uint16(r.rdata[4:]), target)
+	}
+	return fmt.Sprintf("TYPE%v %v", r.rtype, r.ttl)
+}
+
+func newA(ttl uint32, ip net.IP) (*rr, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("not an IPv4 address: %v", ip)
+	}
+	return &rr{typeA, ttl, []byte(ip4)}, nil
+}
+
+func newSRV(ttl uint32, priority, weight, port uint16, target string) (*rr, error) {
+	rdata := make([]byte, 6, 6+len(target)+2)
+	binary.BigEndian.PutUint16(rdata, priority)
+	binary.BigEndian.PutUint16(rdata[2:], weight)
+	binary.BigEndian.PutUint16(rdata[4:], port)
+	rdata, err := appendName(rdata, target)
+	if err != nil {
+		return nil, err
+	}
+	return &rr{typeSRV, ttl, rdata}, nil
+}
+
+// parseQuery reads the header and the question of a query.
+func parseQuery(msg []byte) (*header, *question, error) {
+	if len(msg) < headerLen {
+		return nil, nil, errBadMessage
+	}
+	h := &header{
+		id:      binary.BigEndian.Uint16(msg),
+		flags:   binary.BigEndian.Uint16(msg[2:]),
+		qdCount: binary.BigEndian.Uint16(msg[4:]),
+		anCount: binary.BigEndian.Uint16(msg[6:]),
+		nsCount: binary.BigEndian.Uint16(msg[8:]),
+		arCount: binary.BigEndian.Uint16(msg[10:]),
+	}
+	if h.flags&0x8000 != 0 || h.qdCount != 1 {
+		// a response, or not exactly one question
+		return h, nil, errBadMessage
+	}
+	name, off, err := readName(msg, headerLen)
+	if err != nil {
+		return h, nil, err
+	}
+	if off+4 > len(msg) {
+		return h, nil, errBadMessage
+	}
+	q := &question{
+		name:   strings.ToLower(name),
+		qtype:  binary.BigEndian.Uint16(msg[off:]),
+		qclass: binary.BigEndian.Uint16(msg[off+2:]),
+	}
+	return h, q, nil
+}
+
+// readName reads an uncompressed domain name at off, and returns it
+// without the trailing dot, and the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	for {
+		if off >= len(msg) {
+			return "", 0, errBadMessage
+		}
+		l := int(msg[off])
+		off++
+		if l == 0 {
+			break
+		}
+		if l&0xc0 != 0 {
+			// compression pointers are not expected in a question
+			return "", 0, errBadMessage
+		}
+		if off+l > len(msg) {
+			return "", 0, errBadMessage
+		}
+		labels = append(labels, string(msg[off:off+l]))
+		off += l
+	}
+	return strings.Join(labels, "."), off, nil
+}
+
+// appendName appends a domain name, uncompressed, to b.
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name: %v", name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// buildResponse returns the response to query h / q. q may be nil if
+// the query couldn't be parsed. If the response is larger than
+// maxSize, the answers are dropped and the truncated bit is set.
+func buildResponse(h *header, q *question, rcode int, answers []*rr, maxSize int) []byte {
+	// QR, the query opcode and RD, AA as we are the authority
+	flags := uint16(0x8000) | h.flags&0x7900 | 0x0400 | uint16(rcode)
+	msg := make([]byte, headerLen, maxUDPSize)
+	binary.BigEndian.PutUint16(msg, h.id)
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	if q == nil {
+		return msg
+	}
+	msgWithName, err := appendName(msg, q.name)
+	if err != nil {
+		binary.BigEndian.PutUint16(msg[2:], flags&^0xf|rcodeFormatError)
+		return msg
+	}
+	msg = msgWithName
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	msg = appendUint16(msg, q.qtype)
+	msg = appendUint16(msg, q.qclass)
+	questionEnd := len(msg)
+
+	for _, a := range answers {
+		// the name is a pointer to the question name
+		msg = appendUint16(msg, 0xc000|headerLen)
+		msg = appendUint16(msg, a.rtype)
+		msg = appendUint16(msg, classIN)
+		msg = appendUint16(msg, uint16(a.ttl>>16))
+		msg = appendUint16(msg, uint16(a.ttl))
+		msg = appendUint16(msg, uint16(len(a.rdata)))
+		msg = append(msg, a.rdata...)
+	}
+	if len(msg) > maxSize {
+		binary.BigEndian.PutUint16(msg[2:], flags|0x0200)
+		return msg[:questionEnd]
+	}
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+	return msg
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
@@ -0,0 +1,240 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zkdns is a small DNS server that serves A and SRV records
+// directly from the zkns entries in ZooKeeper, for the clients that
+// can't link the zkns library.
+//
+// The names are mapped to zkns paths the same way as the pdns
+// resolver does: with a domain of zkns.test.zk and a root of
+// /zk/test/zkns, the A records of db.vt.zkns.test.zk are read from
+// /zk/test/zkns/vt/db, and the SRV records of
+// _vtocc.db.vt.zkns.test.zk from the _vtocc named port of the same
+// entry.
+//
+// The TTL of the records is the TTL of the zkns entry if it has one,
+// or the server default.
+package zkdns
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/youtube/vitess/go/stats"
+	"github.com/youtube/vitess/go/zk"
+	"github.com/youtube/vitess/go/zk/zkns"
+	"launchpad.net/gozk/zookeeper"
+)
+
+const (
+	defaultPriority = 0
+	defaultWeight   = 0
+
+	// tcpTimeout is how long we wait for a TCP client to send its
+	// query.
+	tcpTimeout = 10 * time.Second
+)
+
+var (
+	requestCount  = stats.NewInt("ZkDnsRequestCount")
+	responseCodes = stats.NewCounters("ZkDnsResponseCodes")
+)
+
+var rcodeNames = map[int]string{
+	rcodeSuccess:        "NoError",
+	rcodeFormatError:    "FormErr",
+	rcodeServerFailure:  "ServFail",
+	rcodeNameError:      "NXDomain",
+	rcodeNotImplemented: "NotImp",
+	rcodeRefused:        "Refused",
+}
+
+// Server answers the DNS queries for the names in its domain.
+type Server struct {
+	zconn      zk.Conn
+	domain     string // The domain to serve, without leading or trailing dot.
+	zkRoot     string // The root path from which to resolve.
+	defaultTTL uint32 // In seconds.
+}
+
+// NewServer returns a Server for the names in domain, resolved under
+// zkRoot.
+func NewServer(zconn zk.Conn, domain, zkRoot string, defaultTTL time.Duration) *Server {
+	return &Server{
+		zconn:      zconn,
+		domain:     strings.ToLower(strings.Trim(domain, ".")),
+		zkRoot:     zkRoot,
+		defaultTTL: uint32(defaultTTL / time.Second),
+	}
+}
+
+// ServeUDP answers the queries received on conn, until it fails.
+func (s *Server) ServeUDP(conn net.PacketConn) error {
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			response := s.handleQuery(query, maxUDPSize)
+			if response == nil {
+				return
+			}
+			if _, err := conn.WriteTo(response, addr); err != nil {
+				log.Warningf("cannot send dns response to %v: %v", addr, err)
+			}
+		}()
+	}
+}
+
+// ServeTCP answers the queries of the connections accepted on l,
+// until it fails.
+func (s *Server) ServeTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn answers the queries of a TCP connection, each message
+// is preceded by its length.
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			log.Warningf("cannot read dns query from %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+		response := s.handleQuery(query, 0xffff)
+		if response == nil {
+			return
+		}
+		binary.BigEndian.PutUint16(length[:], uint16(len(response)))
+		if _, err := conn.Write(append(length[:], response...)); err != nil {
+			log.Warningf("cannot send dns response to %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handleQuery returns the response to a query, or nil if the query
+// is so broken it doesn't deserve one.
+func (s *Server) handleQuery(query []byte, maxSize int) []byte {
+	requestCount.Add(1)
+	h, q, err := parseQuery(query)
+	if h == nil {
+		responseCodes.Add("Dropped", 1)
+		return nil
+	}
+	rcode := rcodeSuccess
+	var answers []*rr
+	switch {
+	case err != nil:
+		rcode = rcodeFormatError
+	case h.opcode() != 0:
+		rcode = rcodeNotImplemented
+	default:
+		rcode, answers = s.answer(q)
+	}
+	responseCodes.Add(rcodeNames[rcode], 1)
+	return buildResponse(h, q, rcode, answers, maxSize)
+}
+
+// answer returns the records for a question.
+func (s *Server) answer(q *question) (int, []*rr) {
+	if q.qclass != classIN && q.qclass != classANY {
+		return rcodeNotImplemented, nil
+	}
+	var name string
+	switch {
+	case q.name == s.domain:
+		// the domain itself exists, but has no records
+		return rcodeSuccess, nil
+	case strings.HasSuffix(q.name, "."+s.domain):
+		name = strings.TrimSuffix(q.name, "."+s.domain)
+	default:
+		return rcodeRefused, nil
+	}
+
+	// _port.name.subdomain is the named port of
+	// zkRoot/subdomain/name
+	nameParts := strings.Split(name, ".")
+	portName := ""
+	if strings.HasPrefix(nameParts[0], "_") {
+		portName = nameParts[0]
+		nameParts = nameParts[1:]
+	}
+	for i, j := 0, len(nameParts)-1; i < j; i, j = i+1, j-1 {
+		nameParts[i], nameParts[j] = nameParts[j], nameParts[i]
+	}
+	zkPath := path.Join(s.zkRoot, path.Join(nameParts...))
+
+	addrs, err := zkns.ReadAddrs(s.zconn, zkPath)
+	if err != nil {
+		if zookeeper.IsError(err, zookeeper.ZNONODE) {
+			return rcodeNameError, nil
+		}
+		log.Warningf("cannot read zkns entry %v for %v: %v", zkPath, q.name, err)
+		return rcodeServerFailure, nil
+	}
+	if addrs == nil {
+		// a subdomain node, with no data
+		return rcodeSuccess, nil
+	}
+
+	ttl := s.defaultTTL
+	if addrs.TTL > 0 {
+		ttl = uint32(addrs.TTL)
+	}
+	var answers []*rr
+	if portName == "" && (q.qtype == typeA || q.qtype == typeANY) && addrs.IsValidA() {
+		for _, entry := range addrs.Entries {
+			a, err := newA(ttl, net.ParseIP(entry.IPv4))
+			if err != nil {
+				log.Warningf("invalid A record in zkns entry %v: %v", zkPath, err)
+				return rcodeServerFailure, nil
+			}
+			answers = append(answers, a)
+		}
+		// Shuffle the records, there is no better strategy for a
+		// stateless server.
+		for i := range answers {
+			j := rand.Intn(i + 1)
+			answers[i], answers[j] = answers[j], answers[i]
+		}
+	}
+	if portName != "" && (q.qtype == typeSRV || q.qtype == typeANY) && addrs.IsValidSRV() {
+		for _, entry := range addrs.Entries {
+			port, ok := entry.NamedPortMap[portName]
+			if !ok {
+				continue
+			}
+			srv, err := newSRV(ttl, defaultPriority, defaultWeight, uint16(port), entry.Host)
+			if err != nil {
+				log.Warningf("invalid SRV record in zkns entry %v: %v", zkPath, err)
+				return rcodeServerFailure, nil
+			}
+			answers = append(answers, srv)
+		}
+	}
+	return rcodeSuccess, answers
+}
@@ -0,0 +1,163 @@
+// Copyright 2014, Google Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zkdns
+
+import (
+	"encoding/binary"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youtube/vitess/go/zk"
+	"github.com/youtube/vitess/go/zk/fakezk"
+	"github.com/youtube/vitess/go/zk/zkns"
+	"launchpad.net/gozk/zookeeper"
+)
+
+func newTestServer(t *testing.T) *Server {
+	zconn := fakezk.NewConn()
+	if _, err := zk.CreateRecursive(zconn, "/zk/test/zkns/vt/empty", "", 0, zookeeper.WorldACL(zookeeper.PERM_ALL)); err != nil {
+		t.Fatalf("CreateRecursive: %v", err)
+	}
+
+	srv := zkns.NewAddrs()
+	for _, host := range []string{"test1.example.com", "test2.example.com"} {
+		addr := zkns.NewAddr(host)
+		addr.NamedPortMap["_vtocc"] = 6700
+		srv.Entries = append(srv.Entries, *addr)
+	}
+	srv.TTL = 30
+	a := zkns.NewAddrs()
+	a.Entries = append(a.Entries, zkns.ZknsAddr{IPv4: "1.2.3.4"}, zkns.ZknsAddr{IPv4: "1.2.3.5"})
+	for zkPath, addrs := range map[string]*zkns.ZknsAddrs{
+		"/zk/test/zkns/vt/srv": srv,
+		"/zk/test/zkns/vt/a":   a,
+	} {
+		if err := zkns.WriteAddrs(zconn, zkPath, addrs); err != nil {
+			t.Fatalf("WriteAddrs: %v", err)
+		}
+	}
+	return NewServer(zconn, "zkns.test.zk.", "/zk/test/zkns", 5*time.Second)
+}
+
+func newQuery(name string, qtype uint16) []byte {
+	msg := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	msg, _ = appendName(msg, name)
+	msg = appendUint16(msg, qtype)
+	return appendUint16(msg, classIN)
+}
+
+// parseResponse returns the response code and the answers of a
+// response, as strings sorted for comparison.
+func parseResponse(t *testing.T, msg []byte) (int, []string) {
+	if len(msg) < headerLen || binary.BigEndian.Uint16(msg) != 0x1234 {
+		t.Fatalf("bad response header: %v", msg)
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 || flags&0x0100 == 0 {
+		t.Errorf("response flags not set: %x", flags)
+	}
+	anCount := int(binary.BigEndian.Uint16(msg[6:]))
+	off := headerLen
+	if binary.BigEndian.Uint16(msg[4:]) == 1 {
+		var err error
+		if _, off, err = readName(msg, off); err != nil {
+			t.Fatalf("bad question: %v", err)
+		}
+		off += 4
+	}
+	var answers []string
+	for i := 0; i < anCount; i++ {
+		if binary.BigEndian.Uint16(msg[off:]) != 0xc000|headerLen {
+			t.Fatalf("answer %v doesn't point to the question name", i)
+		}
+		r := &rr{
+			rtype: binary.BigEndian.Uint16(msg[off+2:]),
+			ttl:   binary.BigEndian.Uint32(msg[off+6:]),
+		}
+		rdLength := int(binary.BigEndian.Uint16(msg[off+10:]))
+		r.rdata = msg[off+12 : off+12+rdLength]
+		answers = append(answers, r.String())
+		off += 12 + rdLength
+	}
+	sort.Strings(answers)
+	return int(flags & 0xf), answers
+}
+
+func TestQueries(t *testing.T) {
+	s := newTestServer(t)
+	table := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers string
+	}{
+		{"a.vt.zkns.test.zk", typeA, rcodeSuccess, "A 5 1.2.3.4,A 5 1.2.3.5"},
+		{"A.VT.zkns.test.zk", typeANY, rcodeSuccess, "A 5 1.2.3.4,A 5 1.2.3.5"},
+		{"_vtocc.srv.vt.zkns.test.zk", typeSRV, rcodeSuccess, "SRV 30 0 0 6700 test1.example.com,SRV 30 0 0 6700 test2.example.com"},
+		{"_vtocc.srv.vt.zkns.test.zk", typeA, rcodeSuccess, ""},
+		{"_mysql.srv.vt.zkns.test.zk", typeSRV, rcodeSuccess, ""},
+		{"srv.vt.zkns.test.zk", typeA, rcodeSuccess, ""},
+		{"empty.vt.zkns.test.zk", typeA, rcodeSuccess, ""},
+		{"vt.zkns.test.zk", typeA, rcodeSuccess, ""},
+		{"zkns.test.zk", typeA, rcodeSuccess, ""},
+		{"missing.vt.zkns.test.zk", typeA, rcodeNameError, ""},
+		{"a.vt.example.com", typeA, rcodeRefused, ""},
+	}
+	for _, tc := range table {
+		rcode, answers := parseResponse(t, s.handleQuery(newQuery(tc.name, tc.qtype), maxUDPSize))
+		if rcode != tc.rcode || strings.Join(answers, ",") != tc.answers {
+			t.Errorf("query %v %v: got %v %v, want %v %v", tc.name, tc.qtype, rcode, answers, tc.rcode, tc.answers)
+		}
+	}
+
+	// a truncated response has no answers
+	msg := s.handleQuery(newQuery("_vtocc.srv.vt.zkns.test.zk", typeSRV), 64)
+	if flags := binary.BigEndian.Uint16(msg[2:]); flags&0x0200 == 0 {
+		t.Errorf("response not truncated: %x", flags)
+	}
+	if _, answers := parseResponse(t, msg); len(answers) != 0 {
+		t.Errorf("truncated response has answers: %v", answers)
+	}
+
+	// malformed queries
+	if msg := s.handleQuery([]byte{1, 2, 3}, maxUDPSize); msg != nil {
+		t.Errorf("short query got a response: %v", msg)
+	}
+	query := newQuery("a.vt.zkns.test.zk", typeA)
+	if rcode, _ := parseResponse(t, s.handleQuery(query[:len(query)-2], maxUDPSize)); rcode != rcodeFormatError {
+		t.Errorf("truncated query: got rcode %v", rcode)
+	}
+}
+
+func TestServeUDP(t *testing.T) {
+	s := newTestServer(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+	go s.ServeUDP(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Write(newQuery("a.vt.zkns.test.zk", typeA)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	buf := make([]byte, maxUDPSize)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if rcode, answers := parseResponse(t, buf[:n]); rcode != rcodeSuccess || len(answers) != 2 {
+		t.Errorf("got %v %v", rcode, answers)
+	}
+}
@@ -38,6 +38,9 @@ func NewAddr(host string) *ZknsAddr {
 // interpreted as an A.
 type ZknsAddrs struct {
 	Entries []ZknsAddr
+	// TTL is the time to live, in seconds, of the DNS records served
+	// for this entry. Zero means the server default.
+	TTL     int `json:"ttl,omitempty"`
 	version int // zk version to allow non-stomping writes
 }
 
@@ -56,3 +56,21 @@ class TimeoutError(OperationalError):
 
 class TxPoolFull(DatabaseError):
   pass
+
+
+# The caller is not allowed to run the query, per the table ACLs
+# of the server.
+class PermissionDenied(DatabaseError):
+  pass
+
+
+# The result of the query exceeded the max rows or bytes of the
+# server. The query itself did not fail.
+class ResultTooLarge(DatabaseError):
+  pass
+
+
+# The effective caller of the query is over its concurrency
+# or QPS quota on the server.
+class QuotaExceeded(DatabaseError):
+  pass
@@ -27,6 +27,12 @@ def convert_exception(exc, *args):
       return dbexceptions.FatalError(new_args)
     if msg.startswith('tx_pool_full'):
       return dbexceptions.TxPoolFull(new_args)
+    if msg.startswith('permission_denied'):
+      return dbexceptions.PermissionDenied(new_args)
+    if msg.startswith('result_too_large'):
+      return dbexceptions.ResultTooLarge(new_args)
+    if msg.startswith('quota_exceeded'):
+      return dbexceptions.QuotaExceeded(new_args)
     match = _errno_pattern.search(msg)
     if match:
       mysql_errno = int(match.group(1))
@@ -49,6 +55,13 @@ def convert_exception(exc, *args):
 class TabletConnection(object):
   transaction_id = 0
   session_id = 0
+  # caller_id is the effective caller of the queries, used by the
+  # per-caller stats and quotas of the server. The authenticated
+  # user is used if it's not set.
+  caller_id = None
+  # reserved_id is the connection reserved by _reserve: while it's
+  # set, the queries keep the session state of the earlier ones.
+  reserved_id = 0
   _stream_fields = None
   _stream_conversions = None
   _stream_result = None
@@ -88,6 +101,10 @@ class TabletConnection(object):
       self.rollback()
     except Exception:
       pass
+    try:
+      self._release()
+    except Exception:
+      pass
     self.session_id = 0
     self.client.close()
 
@@ -95,8 +112,13 @@ class TabletConnection(object):
     return self.client.is_closed()
 
   def _make_req(self):
-    return {'TransactionId': self.transaction_id,
-            'SessionId': self.session_id}
+    req = {'TransactionId': self.transaction_id,
+           'SessionId': self.session_id}
+    if self.caller_id:
+      req['CallerId'] = self.caller_id
+    if self.reserved_id:
+      req['ReservedId'] = self.reserved_id
+    return req
 
   def begin(self):
     if self.transaction_id:
@@ -143,6 +165,55 @@ class TabletConnection(object):
     except gorpc.GoRpcError as e:
       raise convert_exception(e, str(self))
 
+  # _prepare_transaction prepares the current transaction for the
+  # distributed transaction dtid. It can then only be resolved by
+  # _commit_prepared or _rollback_prepared, possibly from another
+  # connection.
+  def _prepare_transaction(self, dtid):
+    if not self.transaction_id:
+      raise dbexceptions.ProgrammingError('not in a transaction')
+    req = self._make_req()
+    req['Dtid'] = dtid
+    self.transaction_id = 0
+    try:
+      self.client.call('SqlQuery.PrepareTransaction', req)
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), dtid)
+
+  def _commit_prepared(self, dtid):
+    try:
+      self.client.call('SqlQuery.CommitPrepared', {'Dtid': dtid, 'SessionId': self.session_id})
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), dtid)
+
+  def _rollback_prepared(self, dtid):
+    try:
+      self.client.call('SqlQuery.RollbackPrepared', {'Dtid': dtid, 'SessionId': self.session_id})
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), dtid)
+
+  # _reserve reserves a server connection for the session state,
+  # like user variables and SET statements, of the next queries.
+  # It's released by _release, or reclaimed by the server when idle.
+  def _reserve(self):
+    if self.reserved_id:
+      raise dbexceptions.ProgrammingError('connection already reserved')
+    try:
+      response = self.client.call('SqlQuery.ReserveConnection', {'SessionId': self.session_id})
+      self.reserved_id = response.reply['ReservedId']
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self))
+
+  def _release(self):
+    if not self.reserved_id:
+      return
+    req = {'SessionId': self.session_id, 'ReservedId': self.reserved_id}
+    self.reserved_id = 0
+    try:
+      self.client.call('SqlQuery.ReleaseConnection', req)
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self))
+
   def _execute(self, sql, bind_variables):
     new_binds = field_types.convert_bind_vars(bind_variables)
     req = self._make_req()
@@ -172,6 +243,100 @@ class TabletConnection(object):
       raise
     return results, rowcount, lastrowid, fields
 
+  # _prepare returns the id of the prepared statement for sql,
+  # which can then be executed by _execute_prepared.
+  def _prepare(self, sql):
+    req = {'Sql': sql, 'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.Prepare', req)
+      return response.reply['StatementId']
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), sql)
+
+  def _execute_prepared(self, statement_id, bind_variables):
+    new_binds = field_types.convert_bind_vars(bind_variables)
+    req = self._make_req()
+    req['StatementId'] = statement_id
+    req['BindVariables'] = new_binds
+
+    fields = []
+    conversions = []
+    results = []
+    try:
+      response = self.client.call('SqlQuery.ExecutePrepared', req)
+      reply = response.reply
+
+      for field in reply['Fields']:
+        fields.append((field['Name'], field['Type']))
+        conversions.append(field_types.conversions.get(field['Type']))
+
+      for row in reply['Rows']:
+        results.append(tuple(_make_row(row, conversions)))
+
+      rowcount = reply['RowsAffected']
+      lastrowid = reply['InsertId']
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), statement_id, bind_variables)
+    except:
+      logging.exception('gorpc low-level error')
+      raise
+    return results, rowcount, lastrowid, fields
+
+  def _close_prepared(self, statement_id):
+    try:
+      self.client.call('SqlQuery.ClosePrepared', {'StatementId': statement_id, 'SessionId': self.session_id})
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), statement_id)
+
+  # _next_val allocates count consecutive values of the
+  # sequence table, and returns the first one.
+  def _next_val(self, sequence, count=1):
+    req = {'Sequence': sequence, 'Count': count, 'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.NextVal', req)
+      return response.reply['Value']
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), sequence, count)
+
+  # _explain returns the plan the tablet builds for sql, as a dict
+  # of its plan type, reason, table, queries and rowcache usage,
+  # without executing it.
+  def _explain(self, sql):
+    req = {'Sql': sql, 'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.ExplainQuery', req)
+      return response.reply
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), sql)
+
+  # _message_stream is a generator of the messages of the message
+  # table name, as (id, message) tuples. It must be used on a
+  # connection of its own, as it only ends with the query service.
+  def _message_stream(self, name):
+    req = {'Name': name, 'SessionId': self.session_id}
+    try:
+      self.client.stream_call('SqlQuery.MessageStream', req)
+      while True:
+        response = self.client.stream_next()
+        if response is None:
+          return
+        reply = response.reply
+        conversions = [field_types.conversions.get(field['Type']) for field in reply['Fields']]
+        for row in reply['Rows']:
+          yield tuple(_make_row(row, conversions))
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), name)
+
+  # _message_ack acks the messages ids of the message table name, and
+  # returns the number of messages that were not acked yet.
+  def _message_ack(self, name, ids):
+    req = {'Name': name, 'Ids': [str(i) for i in ids], 'SessionId': self.session_id}
+    try:
+      response = self.client.call('SqlQuery.MessageAck', req)
+      return response.reply['Count']
+    except gorpc.GoRpcError as e:
+      raise convert_exception(e, str(self), name, ids)
+
   def _execute_batch(self, sql_list, bind_variables_list):
     query_list = []
     for sql, bind_vars in zip(sql_list, bind_variables_list):
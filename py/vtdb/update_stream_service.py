@@ -23,6 +23,7 @@ class EventData(object):
   PKValues = None
   Sql = None
   Timestamp = None
+  TransactionID = None
   GTIDField = None
 
   def __init__(self, raw_response):
@@ -50,9 +51,21 @@ class UpdateStreamConnection(object):
   def close(self):
     self.client.close()
 
-  def stream_start(self, gtid):
+  def stream_start(self, gtid, tables=None, transaction_markers=False):
+    """Starts the update stream at gtid.
+
+    If tables is set, only the DML events of these tables are streamed.
+    If transaction_markers is set, the events of each transaction come
+    between BEGIN and COMMIT events, with their TransactionID, and the
+    COMMIT events replace the POS events.
+    """
+    req = {"GTIDField": gtid}
+    if tables:
+      req["Tables"] = tables
+    if transaction_markers:
+      req["TransactionMarkers"] = True
     try:
-      self.client.stream_call('UpdateStream.ServeUpdateStream', {"GTIDField": gtid})
+      self.client.stream_call('UpdateStream.ServeUpdateStream', req)
       response = self.client.stream_next()
       if response is None:
         return None
@@ -45,7 +45,27 @@ class MariaDB(MysqlFlavor):
         "RESET SLAVE",
     ]
 
+
+class MySQL56(MysqlFlavor):
+  """Overrides specific to MySQL 5.6"""
+
+  def promote_slave_commands(self):
+    return [
+        "RESET MASTER",
+        "STOP SLAVE",
+        "RESET SLAVE",
+    ]
+
+  def reset_replication_commands(self):
+    return [
+        "RESET MASTER",
+        "STOP SLAVE",
+        "RESET SLAVE",
+    ]
+
 if environment.mysql_flavor == "MariaDB":
   mysql_flavor = MariaDB()
+elif environment.mysql_flavor == "MySQL56":
+  mysql_flavor = MySQL56()
 else:
   mysql_flavor = GoogleMysql()
@@ -205,6 +205,19 @@ class TestCache(framework.TestCase):
     self.env.execute("set vt_spot_check_ratio=0")
     self.assertEqual(self.env.debug_vars()["RowcacheSpotCheckRatio"], 0)
 
+  def test_rowcache_max_lag(self):
+    vstart = self.env.debug_vars()
+    self.assertEqual(vstart["RowcacheMaxLagSeconds"], 0)
+    self.assertEqual(vstart["RowcacheBypassed"], 0)
+    self.env.execute("set vt_rowcache_max_lag=3600")
+    self.assertEqual(self.env.debug_vars()["RowcacheMaxLagSeconds"], 3600)
+    self.env.execute("select * from vtocc_cached2 where eid = 2 and bid = 'foo'")
+    vend = self.env.debug_vars()
+    self.assertEqual(vend["RowcacheBypassed"], 0)
+    self.assertEqual(vstart["RowcacheBypassCount"], vend["RowcacheBypassCount"])
+    self.env.execute("set vt_rowcache_max_lag=0")
+    self.assertEqual(self.env.debug_vars()["RowcacheMaxLagSeconds"], 0)
+
   def _verify_mismatch(self, query, bindvars=None):
     try:
       self.env.execute(query, bindvars)
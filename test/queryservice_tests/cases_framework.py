@@ -41,7 +41,10 @@ class Log(object):
        self.cache_hits,
        self.cache_misses,
        self.cache_absent,
-       self.cache_invalidations) = line.strip().split('\t')
+       self.cache_invalidations,
+       self.rows_affected,
+       self.normalized_sql,
+       self.effective_caller) = line.strip().split('\t')
     except ValueError:
       print "Wrong looking line: %r" % line
       raise
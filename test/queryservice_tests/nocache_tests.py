@@ -1,4 +1,5 @@
 import time
+import urllib2
 
 from vtdb import dbexceptions
 from vtdb import tablet as tablet_conn
@@ -159,6 +160,68 @@ class TestNocache(framework.TestCase):
       self.env.conn.rollback()
       self.env.execute("set vt_strict_mode=1")
 
+  def test_upsert(self):
+    vstart = self.env.debug_vars()
+    self.env.conn.begin()
+    try:
+      self.env.execute("insert into vtocc_a(eid, id, name, foo) values (9, 1, 'a', 'b') on duplicate key update foo = 'c'")
+      cu = self.env.execute("insert into vtocc_a(eid, id, name, foo) values (9, 1, 'a', 'b') on duplicate key update foo = concat(values(foo), 'c')")
+      self.assertEqual(cu.rowcount, 2)
+      cu = self.env.execute("select foo from vtocc_a where eid = 9 and id = 1")
+      self.assertEqual(cu.fetchall(), [('bc',)])
+    finally:
+      self.env.conn.rollback()
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("Queries.Histograms.UPSERT_PK.Count", 0)+2, vend.Queries.Histograms.UPSERT_PK.Count)
+
+  def test_savepoints(self):
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.execute("savepoint a")
+    self.env.conn.begin()
+    try:
+      self.env.execute("insert into vtocc_test values(4, null, null, null)")
+      self.env.execute("savepoint a")
+      self.env.execute("insert into vtocc_test values(5, null, null, null)")
+      self.env.execute("rollback to savepoint a")
+      self.env.execute("release savepoint a")
+      with self.assertRaises(dbexceptions.DatabaseError):
+        self.env.execute("rollback to savepoint a")
+      self.env.conn.commit()
+    except:
+      self.env.conn.rollback()
+      raise
+    cu = self.env.execute("select intval from vtocc_test where intval in (4, 5)")
+    self.assertEqual(cu.fetchall(), [(4,)])
+    self.env.conn.begin()
+    self.env.execute("delete from vtocc_test where intval=4")
+    self.env.conn.commit()
+
+  def test_dml_chunks(self):
+    vstart = self.env.debug_vars()
+    self.env.execute("set vt_dml_chunk_size=1")
+    try:
+      cu = self.env.execute("update vtocc_a set foo='chunked' where eid = 1")
+      self.assertEqual(cu.rowcount, 2)
+      cu = self.env.execute("select foo from vtocc_a where eid = 1")
+      self.assertEqual(cu.fetchall(), [('chunked',), ('chunked',)])
+    finally:
+      self.env.execute("set vt_dml_chunk_size=0")
+      self.env.conn.begin()
+      self.env.execute("update vtocc_a set foo='efgh' where eid = 1 and id = 1")
+      self.env.execute("update vtocc_a set foo='fghi' where eid = 1 and id = 2")
+      self.env.conn.commit()
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.DMLChunkSize, 0)
+    # Two chunks of one row, and an empty one.
+    self.assertEqual(vstart.mget("DMLChunks.vtocc_a", 0)+3, vend.DMLChunks.vtocc_a)
+    self.assertEqual(vstart.mget("Queries.Histograms.COMMIT.Count", 0)+4, vend.Queries.Histograms.COMMIT.Count)
+    try:
+      self.env.execute("update vtocc_a set foo='chunked' where eid = 1")
+    except dbexceptions.DatabaseError as e:
+      self.assertContains(str(e), "not_in_tx: DMLs")
+    else:
+      self.fail("Did not receive exception")
+
   def test_select_lock(self):
     for lock_mode in ['for update', 'lock in share mode']:
       try:
@@ -175,6 +238,26 @@ class TestNocache(framework.TestCase):
       # Make sure the row is not locked for read
       self.env.execute("select * from vtocc_test where intval=2")
 
+  def test_select_lock_limits(self):
+    vstart = self.env.debug_vars()
+    self.env.execute("set vt_max_lock_rows=1")
+    try:
+      self.env.conn.begin()
+      cu = self.env.execute("select * from vtocc_test where intval=2 for update")
+      self.assertEqual(cu.rowcount, 1)
+      try:
+        self.env.execute("select * from vtocc_test where intval in (1, 2) for update")
+      except dbexceptions.DatabaseError as e:
+        self.assertContains(str(e), "result_too_large: Row count exceeded 1")
+      else:
+        self.fail("Did not receive exception")
+      self.env.conn.rollback()
+    finally:
+      self.env.execute("set vt_max_lock_rows=0")
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.MaxLockRows, 0)
+    self.assertEqual(vstart.mget("Queries.Histograms.SELECT_LOCK.Count", 0)+2, vend.Queries.Histograms.SELECT_LOCK.Count)
+
   def test_pool_size(self):
     vstart = self.env.debug_vars()
     self.env.execute("set vt_pool_size=1")
@@ -190,6 +273,23 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vend.Voltron.ConnPool.Capacity, 16)
     self.assertEqual(vend.ConnPoolCapacity, 16)
 
+  def test_pool_resize(self):
+    self.env.http_get("debug/pools?pool=conn&capacity=24&idle_timeout=1s", use_json=False)
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.ConnPoolCapacity, 24)
+    self.assertEqual(vend.ConnPoolMaxCap, 32)
+    self.assertEqual(vend.ConnPoolIdleTimeout, 1e9)
+    self.env.execute("select 1 from dual")
+    time.sleep(1.5)
+    vend = self.env.debug_vars()
+    self.assertNotEqual(vend.ConnPoolIdleClosed, 0)
+    # The pool can't grow beyond its max capacity.
+    with self.assertRaises(urllib2.HTTPError):
+      self.env.http_get("debug/pools?pool=conn&capacity=33", use_json=False)
+    self.env.http_get("debug/pools?pool=conn&capacity=16&idle_timeout=30m", use_json=False)
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.ConnPoolCapacity, 16)
+
   def test_transaction_cap(self):
     self.env.execute("set vt_transaction_cap=1")
     vstart = self.env.debug_vars()
@@ -215,6 +315,68 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vend.TransactionPoolCapacity, 20)
     self.assertEqual(vstart.mget("Errors.TxPoolFull", 0) + 1, vend.Errors.TxPoolFull)
 
+  def test_lock_retries(self):
+    vstart = self.env.debug_vars()
+    self.assertEqual(vstart.MaxDeadlockRetries, 3)
+    self.assertEqual(vstart.MaxLockWaitRetries, 0)
+    self.env.execute("set vt_max_lock_wait_retries=2")
+    try:
+      self.assertEqual(self.env.debug_vars().MaxLockWaitRetries, 2)
+      with self.assertRaises(dbexceptions.DatabaseError):
+        self.env.execute("set vt_max_deadlock_retries=-1")
+    finally:
+      self.env.execute("set vt_max_lock_wait_retries=0")
+
+  def test_reserved_connection(self):
+    vstart = self.env.debug_vars()
+    self.env.conn._reserve()
+    try:
+      self.env.execute("set @reserved = 42")
+      cu = self.env.execute("select @reserved from dual")
+      self.assertEqual(cu.fetchall(), [(42,)])
+      # Reserved connections can't hold transactions.
+      with self.assertRaises(dbexceptions.DatabaseError):
+        self.env.conn.begin()
+        self.env.execute("select 1 from dual")
+      self.env.conn.rollback()
+      vend = self.env.debug_vars()
+      self.assertEqual(vend.ReservedPoolSize, vstart.ReservedPoolSize+1)
+    finally:
+      self.env.conn._release()
+    # The session state is gone with the connection.
+    cu = self.env.execute("select @reserved from dual")
+    self.assertEqual(cu.fetchall(), [(None,)])
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.ReservedPoolSize, vstart.ReservedPoolSize)
+    self.assertEqual(vstart.mget("ReservedPoolEnded.Released", 0)+1, vend.ReservedPoolEnded.Released)
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.conn.reserved_id = 1
+      try:
+        self.env.execute("select 1 from dual")
+      finally:
+        self.env.conn.reserved_id = 0
+
+  def test_reserved_temporary_table(self):
+    self.env.conn._reserve()
+    try:
+      self.env.execute("create temporary table vtocc_tmp(eid int, name varchar(128), primary key(eid))")
+      self.env.execute("insert into vtocc_tmp values(1, 'a'), (2, 'b')")
+      self.env.execute("update vtocc_tmp set name = 'c' where eid = 2")
+      self.env.execute("delete from vtocc_tmp where eid = 1")
+      cu = self.env.execute("select eid, name from vtocc_tmp")
+      self.assertEqual(cu.fetchall(), [(2, 'c')])
+      # Only the DDLs of temporary tables are allowed.
+      with self.assertRaisesRegexp(dbexceptions.DatabaseError, ".*except for temporary tables.*"):
+        self.env.execute("create table vtocc_tmp2(eid int)")
+      self.env.execute("drop temporary table vtocc_tmp")
+      with self.assertRaises(dbexceptions.DatabaseError):
+        self.env.execute("select eid, name from vtocc_tmp")
+    finally:
+      self.env.conn._release()
+    # Temporary tables can't be created on the shared connections.
+    with self.assertRaisesRegexp(dbexceptions.DatabaseError, ".*only allowed on reserved connections.*"):
+      self.env.execute("create temporary table vtocc_tmp(eid int)")
+
   def test_transaction_timeout(self):
     self.env.execute("set vt_transaction_timeout=0.25")
     # wait for any pending transactions to timeout
@@ -241,6 +403,30 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vend.Voltron.ActiveTxPool.Timeout, 30000000000)
     self.assertEqual(vend.ActiveTransactionPoolTimeout, 30000000000)
 
+  def test_transaction_kill(self):
+    vstart = self.env.debug_vars()
+    self.env.conn.begin()
+    self.env.execute("select * from vtocc_test where intval=1")
+    txs = self.env.http_get("/debug/transactions?format=json")
+    self.assertEqual(len(txs), 1)
+    self.assertEqual(txs[0]['TransactionID'], self.env.conn.transaction_id)
+    self.assertEqual(txs[0]['State'], "idle")
+    self.assertEqual(txs[0]['Queries'], ["select * from vtocc_test where intval=1"])
+    # a GET doesn't kill the transaction
+    with self.assertRaises(urllib2.HTTPError):
+      self.env.http_get("/debug/transactions/kill?transactionID=%d" % self.env.conn.transaction_id, use_json=False)
+    self.assertEqual(len(self.env.http_get("/debug/transactions?format=json")), 1)
+    self.env.http_post("/debug/transactions/kill", {"transactionID": self.env.conn.transaction_id})
+    try:
+      self.env.conn.commit()
+    except dbexceptions.DatabaseError as e:
+      self.assertContains(str(e), "not_in_tx: Transaction")
+    else:
+      self.fail("Did not receive exception")
+    self.assertEqual(self.env.http_get("/debug/transactions?format=json"), [])
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("Kills.Transactions", 0)+1, vend.Kills.Transactions)
+
   def test_query_cache(self):
     self.env.execute("set vt_query_cache_size=1")
     bv={'ival1': 1, 'ival2': 1}
@@ -297,6 +483,23 @@ class TestNocache(framework.TestCase):
       mcu.execute("drop table vtocc_temp")
       mcu.close()
 
+  def test_schema_error_reload(self):
+    mcu = self.env.mysql_conn.cursor()
+    mcu.execute("create table vtocc_temp2(intval int, primary key(intval))")
+    try:
+      # Tables created out of band are loaded by the first query.
+      cu = self.env.execute("select * from vtocc_temp2")
+      self.assertEqual(cu.description, [('intval', 3)])
+      mcu.execute("alter table vtocc_temp2 add column strval varchar(10)")
+      # So are the new columns.
+      cu = self.env.execute("select strval from vtocc_temp2")
+      self.assertEqual(cu.description, [('strval', 253)])
+      vend = self.env.debug_vars()
+      self.assertTrue(vend.SchemaErrorReloads.vtocc_temp2 >= 2)
+    finally:
+      mcu.execute("drop table vtocc_temp2")
+      mcu.close()
+
   def test_max_result_size(self):
     self.env.execute("set vt_max_result_size=2")
     vend = self.env.debug_vars()
@@ -304,8 +507,8 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vend.MaxResultSize, 2)
     try:
       self.env.execute("select * from vtocc_test")
-    except dbexceptions.DatabaseError as e:
-      self.assertContains(str(e), "error: Row")
+    except dbexceptions.ResultTooLarge as e:
+      self.assertContains(str(e), "result_too_large: Row count exceeded")
     else:
       self.fail("Did not receive exception")
     self.env.execute("set vt_max_result_size=10000")
@@ -313,6 +516,58 @@ class TestNocache(framework.TestCase):
     self.assertEqual(vend.Voltron.MaxResultSize, 10000)
     self.assertEqual(vend.MaxResultSize, 10000)
 
+  def test_max_result_bytes(self):
+    vstart = self.env.debug_vars()
+    self.env.execute("set vt_max_result_bytes=10")
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.Voltron.MaxResultBytes, 10)
+    self.assertEqual(vend.MaxResultBytes, 10)
+    try:
+      self.env.execute("select * from vtocc_test")
+    except dbexceptions.ResultTooLarge as e:
+      self.assertContains(str(e), "result_too_large: Result bytes exceeded")
+    else:
+      self.fail("Did not receive exception")
+    finally:
+      self.env.execute("set vt_max_result_bytes=%d" % vstart.MaxResultBytes)
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("Errors.ResultTooLarge", 0)+1, vend.Errors.ResultTooLarge)
+
+  def test_directives(self):
+    vstart = self.env.debug_vars()
+    with self.assertRaises(dbexceptions.ResultTooLarge):
+      self.env.execute("select /*vt+ MAX_ROWS=1 */ * from vtocc_test")
+    with self.assertRaises(dbexceptions.ResultTooLarge):
+      self.env.execute("select * from vtocc_test /*vt+ MAX_ROWS=1 */")
+    cu = self.env.execute("select * from vtocc_test /*vt+ MAX_ROWS=3 QUERY_TIMEOUT_MS=1000 */")
+    self.assertEqual(cu.rowcount, 3)
+    cu = self.env.execute("select * from vtocc_test /*vt+ WORKLOAD=olap */")
+    self.assertEqual(cu.rowcount, 3)
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.execute("select * from vtocc_test /*vt+ WORKLOAD=other */")
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("Queries.Histograms.PASS_SELECT.Count", 0)+5, vend.Queries.Histograms.PASS_SELECT.Count)
+    self.assertEqual(vstart.mget("Errors.ResultTooLarge", 0)+2, vend.Errors.ResultTooLarge)
+
+  def test_caller_quota(self):
+    vstart = self.env.debug_vars()
+    conn = self.env.connect()
+    conn.caller_id = 'quota_test'
+    curs = cursor.TabletCursor(conn)
+    self.env.execute("set vt_caller_max_qps=1")
+    try:
+      # At most two of them can run, if they straddle a second.
+      with self.assertRaises(dbexceptions.QuotaExceeded):
+        for i in range(3):
+          curs.execute("select 1 from dual", {})
+    finally:
+      self.env.execute("set vt_caller_max_qps=0")
+    conn.close()
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.CallerQuotaRejections.quota_test, 1)
+    self.assertEqual(vstart.mget("Errors.QuotaExceeded", 0)+1, vend.Errors.QuotaExceeded)
+    self.assertEqual(vend.CallerErrors["quota_test.Execute"], 1)
+
   def test_query_timeout(self):
     vstart = self.env.debug_vars()
     conn = tablet_conn.connect("localhost:%s" % self.env.port, '', 'test_keyspace', '0', 5, user='youtube-dev-dedicated', password='vtpass')
@@ -375,6 +630,7 @@ class TestNocache(framework.TestCase):
     vend = self.env.debug_vars()
     self.assertEqual(vstart.mget("Waits.TotalCount", 0)+1, vend.Waits.TotalCount)
     self.assertEqual(vstart.mget("Waits.Histograms.Consolidations.Count", 0)+1, vend.Waits.Histograms.Consolidations.Count)
+    self.assertEqual(vstart.ConsolidatorWaits+1, vend.ConsolidatorWaits)
 
   def test_batch(self):
     queries = ["select * from vtocc_a where id = :a", "select * from vtocc_b where id = :b"]
@@ -382,6 +638,113 @@ class TestNocache(framework.TestCase):
     results = self.env.conn._execute_batch(queries, bvars)
     self.assertEqual(results, [([(1L, 2L, 'bcde', 'fghi')], 1, 0, [('eid', 8), ('id', 3), ('name', 253), ('foo', 253)]), ([(1L, 2L)], 1, 0, [('eid', 8), ('id', 3)])])
 
+  def test_prepared(self):
+    vstart = self.env.debug_vars()
+    conn = self.env.conn
+    statement_id = conn._prepare("select * from vtocc_a where id = :a /* trailing */")
+    try:
+      vend = self.env.debug_vars()
+      self.assertEqual(vend.PreparedStatements, vstart.PreparedStatements+1)
+      result = conn._execute_prepared(statement_id, {"a": 2})
+      self.assertEqual(result, ([(1L, 2L, 'bcde', 'fghi')], 1, 0, [('eid', 8), ('id', 3), ('name', 253), ('foo', 253)]))
+      # Prepared statements survive the eviction of their plan.
+      self.env.execute("set vt_query_cache_size=1")
+      self.env.execute("select * from vtocc_b where id = :b", {"b": 2})
+      result = conn._execute_prepared(statement_id, {"a": 1})
+      self.assertEqual(result, ([(1L, 1L, 'abcd', 'efgh')], 1, 0, [('eid', 8), ('id', 3), ('name', 253), ('foo', 253)]))
+    finally:
+      self.env.execute("set vt_query_cache_size=5000")
+      conn._close_prepared(statement_id)
+    vend = self.env.debug_vars()
+    self.assertEqual(vend.PreparedStatements, vstart.PreparedStatements)
+    with self.assertRaises(dbexceptions.DatabaseError):
+      conn._execute_prepared(statement_id, {"a": 2})
+    with self.assertRaises(dbexceptions.DatabaseError):
+      conn._prepare("select * from vtocc_nonexistent")
+
+  def test_two_pc(self):
+    conn = self.env.conn
+    try:
+      conn.begin()
+      self.env.execute("insert into vtocc_test values(4, null, null, null)")
+      conn._prepare_transaction("dtid_commit")
+      vend = self.env.debug_vars()
+      self.assertEqual(vend.PreparedTransactions, 1)
+      conn._commit_prepared("dtid_commit")
+      cu = self.env.execute("select intval from vtocc_test where intval = 4")
+      self.assertEqual(cu.rowcount, 1)
+      with self.assertRaises(dbexceptions.DatabaseError):
+        conn._commit_prepared("dtid_commit")
+
+      conn.begin()
+      self.env.execute("insert into vtocc_test values(5, null, null, null)")
+      conn._prepare_transaction("dtid_rollback")
+      conn._rollback_prepared("dtid_rollback")
+      cu = self.env.execute("select intval from vtocc_test where intval = 5")
+      self.assertEqual(cu.rowcount, 0)
+      # Rollbacks can be retried.
+      conn._rollback_prepared("dtid_rollback")
+      vend = self.env.debug_vars()
+      self.assertEqual(vend.PreparedTransactions, 0)
+    finally:
+      conn.rollback()
+      conn.begin()
+      self.env.execute("delete from vtocc_test where intval in (4, 5)")
+      conn.commit()
+
+  def test_messages(self):
+    conn = self.env.conn
+    co2 = self.env.connect()
+    try:
+      conn.begin()
+      self.env.execute("insert into vtocc_msg(id, time_next, epoch, time_created, message) values(1, 0, 0, 0, 'hello')")
+      self.env.execute("insert into vtocc_msg(id, time_next, epoch, time_created, message) values(2, 0, 0, 0, 'world')")
+      conn.commit()
+      messages = co2._message_stream("vtocc_msg")
+      got = sorted([messages.next(), messages.next()])
+      self.assertEqual(got, [(1L, 'hello'), (2L, 'world')])
+      self.assertEqual(conn._message_ack("vtocc_msg", [1]), 1)
+      self.assertEqual(conn._message_ack("vtocc_msg", [1]), 0)
+      # Messages that are not acked are sent again.
+      self.assertEqual(messages.next(), (2L, 'world'))
+      self.assertEqual(conn._message_ack("vtocc_msg", [2]), 1)
+      with self.assertRaises(dbexceptions.DatabaseError):
+        conn._message_ack("vtocc_a", [1])
+    finally:
+      co2.close()
+      conn.begin()
+      self.env.execute("delete from vtocc_msg")
+      conn.commit()
+
+  def test_sequence(self):
+    cu = self.env.execute("select nextval() from vtocc_seq")
+    first = cu.fetchone()[0]
+    cu = self.env.execute("select nextval(:n) from vtocc_seq", {"n": 5})
+    self.assertEqual(cu.fetchone()[0], first+1)
+    self.assertEqual(self.env.conn._next_val("vtocc_seq", 2), first+6)
+    # next_id is past all the values handed out.
+    cu = self.env.execute("select next_id from vtocc_seq")
+    self.assertTrue(cu.fetchone()[0] >= first+8)
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.execute("select nextval() from vtocc_a")
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.conn._next_val("vtocc_a")
+
+  def test_explain(self):
+    vstart = self.env.debug_vars()
+    plan = self.env.conn._explain("delete from vtocc_a where eid = 1 /* trailing */")
+    self.assertEqual(plan['PlanType'], 'DML_SUBQUERY')
+    self.assertEqual(plan['Table'], 'vtocc_a')
+    self.assertEqual(plan['Subquery'], 'select eid, id from vtocc_a where eid = 1 limit :_vtMaxResultSize for update')
+    self.assertEqual(plan['Rowcache'], 'none')
+    plan = self.env.conn._explain("select * from vtocc_a join vtocc_b")
+    self.assertEqual(plan['PlanType'], 'PASS_SELECT')
+    self.assertEqual(plan['Table'], '')
+    vend = self.env.debug_vars()
+    self.assertEqual(vstart.mget("Queries.TotalCount", 0), vend.Queries.TotalCount)
+    with self.assertRaises(dbexceptions.DatabaseError):
+      self.env.conn._explain("select * from vtocc_nonexistent")
+
   def test_bind_in_select(self):
     bv = {'bv': 1}
     cu = self.env.execute('select :bv from vtocc_test', bv)
@@ -429,6 +792,7 @@ class TestNocache(framework.TestCase):
 
   def test_query_stats(self):
     bv = {'eid': 1}
+    vstart = self.env.debug_vars()
     self.env.execute("select eid as query_stats from vtocc_a where eid = :eid", bv)
     self._verify_query_stats(self.env.query_stats(), "select eid as query_stats from vtocc_a where eid = :eid", "vtocc_a", "PASS_SELECT", 1, 2, 0)
     tstartQueryCounts = self._get_vars_query_stats(self.env.debug_vars()["QueryCounts"], "vtocc_a", "PASS_SELECT")
@@ -455,6 +819,11 @@ class TestNocache(framework.TestCase):
     self.assertEqual(tstartRowCounts, tendRowCounts)
     self.assertEqual(tstartErrorCounts+1, tendErrorCounts)
     self.assertTrue((tendTimesNs - tstartTimesNs) > 0)
+    vend = self.env.debug_vars()
+    tstartTableQueries = vstart.mget("TableQueries.Histograms", {}).get("vtocc_a.PASS_SELECT", {}).get("Count", 0)
+    self.assertEqual(tstartTableQueries+2, vend.TableQueries.Histograms["vtocc_a.PASS_SELECT"]["Count"])
+    self.assertEqual(vstart.mget("TableErrors.vtocc_a", 0)+1, vend.TableErrors.vtocc_a)
+    self.assertTrue(vend.TableQueryLatencyPercentilesNs["vtocc_a.PASS_SELECT.p99"] > 0)
 
   def _verify_mismatch(self, query, bindvars=None):
     self._verify_error(query, bindvars, "error: type mismatch")
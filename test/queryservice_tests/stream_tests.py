@@ -56,6 +56,21 @@ class TestStream(framework.TestCase):
           count += 1
         self.assertEqual(count, 10000)
 
+  def test_stream_buffer_rows(self):
+    self._populate_vtocc_big_table(100)
+    self.env.execute("set vt_stream_buffer_rows=7")
+    try:
+      cu = cursor.StreamCursor(self.env.conn)
+      cu.execute("select * from vtocc_big b1, vtocc_big b2", {})
+      count = 0
+      while True:
+        row = cu.fetchone()
+        if row is None:
+          break
+        count += 1
+      self.assertEqual(count, 10000)
+    finally:
+      self.env.execute("set vt_stream_buffer_rows=0")
 
   def test_streaming_error(self):
     with self.assertRaises(dbexceptions.DatabaseError):
@@ -11,6 +11,7 @@ import os
 import shutil
 import subprocess
 import time
+import urllib
 import urllib2
 import uuid
 
@@ -76,6 +77,9 @@ class TestEnv(object):
       return json.loads(data)
     return data
 
+  def http_post(self, path, data):
+    return urllib2.urlopen(self.url(path), urllib.urlencode(data)).read()
+
   def debug_vars(self):
     return framework.MultiDict(self.http_get("/debug/vars"))
 
@@ -297,6 +301,8 @@ class VtoccTestEnv(TestEnv):
       "-schema-override", schema_override,
       "-table-acl-config", table_acl_config,
       "-queryserver-config-strict-table-acl",
+      "-queryserver-config-twopc-enable",
+      "-queryserver-config-max-pool-size", "32",
       "-db-config-app-charset", "utf8",
       "-db-config-app-dbname", "vt_test_keyspace",
       "-db-config-app-host", "localhost",
@@ -62,6 +62,10 @@ insert into vtocc_part2 values(1, 3)
 insert into vtocc_part2 values(2, 4)
 commit
 
+create table vtocc_seq(id int, next_id bigint, cache bigint, primary key(id)) comment 'vitess_sequence'
+insert into vtocc_seq(id, next_id, cache) values(0, 1, 3)
+create table vtocc_msg(id bigint, time_next bigint, epoch bigint, time_created bigint, time_acked bigint, message varchar(128), primary key(id), index next_idx(time_next)) comment 'vitess_message,vt_ack_wait=1,vt_purge_after=1,vt_batch_size=2,vt_poll_interval=0.1'
+
 create table vtocc_acl_no_access(key1 bigint, key2 bigint, primary key(key1))
 create table vtocc_acl_read_only(key1 bigint, key2 bigint, primary key(key1))
 create table vtocc_acl_read_write(key1 bigint, key2 bigint, primary key(key1))
@@ -89,6 +93,8 @@ drop table if exists vtocc_misc
 drop view if exists vtocc_view
 drop table if exists vtocc_part1
 drop table if exists vtocc_part2
+drop table if exists vtocc_seq
+drop table if exists vtocc_msg
 drop table if exists vtocc_acl_no_access
 drop table if exists vtocc_acl_read_only
 drop table if exists vtocc_acl_read_write
@@ -466,6 +466,12 @@ func (conn *Conn) ClientId() *ClientId {
 	return &ClientId{*C.zoo_client_id(conn.handle)}
 }
 
+// SessionId returns the id of the session, as found in the
+// EphemeralOwner of the ephemeral nodes it created.
+func (clientId *ClientId) SessionId() int64 {
+	return int64(clientId.cId.client_id)
+}
+
 // Close terminates the ZooKeeper interaction.
 func (conn *Conn) Close() error {
 